@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/alert"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+const (
+	defaultAlertWebhookRetries = 5
+	defaultAlertQueueSize      = 256
+	alertWebhookTimeout        = 10 * time.Second
+	alertWebhookBackoff        = time.Second
+	alertConsumeCheckInterval  = 10 * time.Second
+)
+
+// alertFlags are the flags of operator alerts, which every node type has.
+type alertFlags struct {
+	webhookURL        *string
+	webhookSecretFile *string
+	webhookRetries    *int
+	queueSize         *int
+}
+
+func newAlertFlags(flagset *flag.FlagSet) *alertFlags {
+	return &alertFlags{
+		webhookURL:        flagset.String("alerts.webhook-url", "", "if set, POST critical events, like quarantined segments, disk watermarks, consume stalls, and clock skew, as JSON to this URL, instead of logging them"),
+		webhookSecretFile: flagset.String("alerts.webhook-secret-file", "", "with -alerts.webhook-url, file of the secret to sign each request's body with, as HMAC-SHA256, in the X-OKLog-Signature header"),
+		webhookRetries:    flagset.Int("alerts.webhook-retries", defaultAlertWebhookRetries, "with -alerts.webhook-url, retry each request this many times, with backoff, while it fails with no response, a 5xx, or 429"),
+		queueSize:         flagset.Int("alerts.queue-size", defaultAlertQueueSize, "queue at most this many alerts to deliver, and drop the rest"),
+	}
+}
+
+// newBus returns the alert Bus of the flags, stamping events with node, with
+// its metrics registered with r. Without a webhook, alerts are logged. It's Run by
+// the caller.
+func (f *alertFlags) newBus(r prometheus.Registerer, node string, logger log.Logger) (*alert.Bus, error) {
+	if *f.queueSize <= 0 {
+		return nil, errors.Errorf("invalid -alerts.queue-size %d", *f.queueSize)
+	}
+	logger = log.With(logger, "component", "Alerts")
+	sink := alert.Sink(alert.LogSink{Logger: logger})
+	if *f.webhookURL != "" {
+		if u, err := url.Parse(*f.webhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, errors.New("invalid -alerts.webhook-url: want an http(s) URL")
+		}
+		var secret []byte
+		if *f.webhookSecretFile != "" {
+			buf, err := ioutil.ReadFile(*f.webhookSecretFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "reading alert webhook secret")
+			}
+			if secret = []byte(strings.TrimSpace(string(buf))); len(secret) == 0 {
+				return nil, errors.Errorf("%s: empty alert webhook secret", *f.webhookSecretFile)
+			}
+		}
+		client := &http.Client{Timeout: alertWebhookTimeout}
+		sink = alert.NewWebhook(*f.webhookURL, secret, client, *f.webhookRetries, alertWebhookBackoff)
+	}
+	var (
+		dropped = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "alerts_dropped_total",
+			Help:      "Alerts dropped, undelivered, as the queue was full.",
+		})
+		failed = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "alerts_failed_total",
+			Help:      "Alerts that failed to be delivered, after any retries.",
+		})
+	)
+	r.MustRegister(dropped, failed)
+	return alert.NewBus(node, []alert.Sink{sink}, *f.queueSize, dropped, failed, logger), nil
+}
+
+// alertReporter reports events to the wrapped reporter, and publishes those
+// that raise alerts to the bus, too.
+type alertReporter struct {
+	store.EventReporter
+	bus *alert.Bus
+}
+
+func (r alertReporter) ReportEvent(e store.Event) {
+	r.EventReporter.ReportEvent(e)
+	if e.Alert == "" {
+		return
+	}
+	details := map[string]string{"op": e.Op}
+	if e.File != "" {
+		details["file"] = e.File
+	}
+	message := e.Msg
+	for _, err := range []error{e.Error, e.Warning} {
+		if err != nil {
+			message = fmt.Sprintf("%v: %s", err, message)
+		}
+	}
+	r.bus.Publish(alert.Event{Type: e.Alert, Message: message, Details: details})
+}
+
+// watchConsumeStalls checks the consumers every interval, and publishes an
+// alert of each that's made no progress for longer than threshold, and
+// another, resolved, once it makes progress again.
+func watchConsumeStalls(consumers []*store.Consumer, threshold, interval time.Duration, bus *alert.Bus, cancel <-chan struct{}) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	stalled := make([]bool, len(consumers))
+	for {
+		select {
+		case <-ticker.C:
+		case <-cancel:
+			return nil
+		}
+		for i, c := range consumers {
+			last := c.LastStep()
+			switch isStalled := time.Since(last) > threshold; {
+			case isStalled && !stalled[i]:
+				bus.Publish(alert.Event{
+					Type:    alert.ConsumeStalled,
+					Message: fmt.Sprintf("consumer has made no progress for over %s", threshold),
+					Details: map[string]string{"consumer": fmt.Sprint(i), "last_step": last.UTC().Format(time.RFC3339)},
+				})
+				stalled[i] = true
+			case !isStalled && stalled[i]:
+				bus.Publish(alert.Event{
+					Type:     alert.ConsumeStalled,
+					Resolved: true,
+					Message:  "consumer is making progress again",
+					Details:  map[string]string{"consumer": fmt.Sprint(i), "last_step": last.UTC().Format(time.RFC3339)},
+				})
+				stalled[i] = false
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/alert"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+func TestAlertReporter(t *testing.T) {
+	sink := make(chanSink, 8)
+	bus := alert.NewBus("node1:7650", []alert.Sink{sink}, 8,
+		prometheus.NewCounter(prometheus.CounterOpts{Name: "dropped"}),
+		prometheus.NewCounter(prometheus.CounterOpts{Name: "failed"}),
+		log.NewNopLogger(),
+	)
+	go bus.Run()
+	defer bus.Stop()
+
+	// Only events that raise alerts are published.
+	r := alertReporter{store.LogReporter{Logger: log.NewNopLogger()}, bus}
+	r.ReportEvent(store.Event{Op: "queryMatchingSegments", File: "/a.flushed", Warning: errors.New("gone")})
+	r.ReportEvent(store.Event{
+		Op: "quarantine", File: "/b.flushed", Warning: errors.New("corrupt segment"),
+		Msg: "moved to /corrupt/b.corrupt", Alert: alert.SegmentQuarantined,
+	})
+	select {
+	case e := <-sink:
+		if want, have := alert.SegmentQuarantined, e.Type; want != have {
+			t.Errorf("type: want %q, have %q", want, have)
+		}
+		if want, have := "corrupt segment: moved to /corrupt/b.corrupt", e.Message; want != have {
+			t.Errorf("message: want %q, have %q", want, have)
+		}
+		if want, have := map[string]string{"op": "quarantine", "file": "/b.flushed"}, e.Details; !reflect.DeepEqual(want, have) {
+			t.Errorf("details: want %v, have %v", want, have)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no alert")
+	}
+	select {
+	case e := <-sink:
+		t.Errorf("want no more alerts, have %+v", e)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+type chanSink chan alert.Event
+
+func (s chanSink) Notify(_ context.Context, e alert.Event) error {
+	s <- e
+	return nil
+}
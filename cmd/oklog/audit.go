@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/go-kit/kit/log"
+
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// auditLogToLogger is the -store.audit-log that audits to the process log.
+const auditLogToLogger = "log"
+
+// newAuditSink returns the sink for -store.audit-log, or nil, if it's empty,
+// i.e. queries aren't audited. A file sink should be closed on shutdown.
+func newAuditSink(dest string, maxSize int64, keep int, logger log.Logger) (store.AuditSink, error) {
+	logger = log.With(logger, "component", "audit")
+	switch dest {
+	case "":
+		return nil, nil
+	case auditLogToLogger:
+		return store.LogAuditSink{Logger: logger}, nil
+	}
+	return store.NewFileAuditSink(dest, maxSize, keep, store.LogReporter{Logger: logger})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// readAuthToken reads the shared API token from filename, or returns an empty
+// token, i.e. no authentication, if filename is empty.
+func readAuthToken(filename string) (string, error) {
+	if filename == "" {
+		return "", nil
+	}
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", errors.Wrap(err, "reading auth token")
+	}
+	token := strings.TrimSpace(string(buf))
+	if token == "" {
+		return "", errors.Errorf("%s: empty auth token", filename)
+	}
+	return token, nil
+}
+
+// exemptPaths are served without a token, with -api.auth-exempt-health.
+var exemptPaths = map[string]bool{"/health": true, "/healthz": true, "/readyz": true, "/metrics": true}
+
+// requireToken rejects requests to next without an Authorization header
+// bearing the token, with 401 Unauthorized. Requests for /health, /healthz,
+// /readyz, and /metrics are let through if exemptHealth is set. An empty token means no
+// authentication. Authenticated requests carry the token's principal, for
+// the store's audit log.
+func requireToken(token string, exemptHealth bool, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	var (
+		want      = []byte("Bearer " + token)
+		principal = tokenPrincipal(token)
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exemptHealth && exemptPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if have := []byte(r.Header.Get("Authorization")); subtle.ConstantTimeCompare(want, have) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="oklog"`)
+			http.Error(w, "missing or invalid auth token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(store.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// tokenPrincipal identifies the holder of a token, without revealing it: by
+// a prefix of its SHA-256, so it's still told apart once it's rotated.
+func tokenPrincipal(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
+
+// tokenTransport makes requests with the token, if it isn't empty. Nodes use
+// it for requests to their peers, and query and stream for requests to nodes.
+func tokenTransport(t http.RoundTripper, token string) http.RoundTripper {
+	if token == "" {
+		return t
+	}
+	return bearerTransport{token, t}
+}
+
+type bearerTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := *req // RoundTrippers mustn't modify the request
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("Authorization", "Bearer "+t.token)
+	return t.next.RoundTrip(&r)
+}
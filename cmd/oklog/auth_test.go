@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/store"
+	"github.com/oklog/oklog/pkg/stream"
+)
+
+func TestRequireToken(t *testing.T) {
+	t.Parallel()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, testcase := range []struct {
+		name          string
+		token         string
+		exemptHealth  bool
+		path          string
+		authorization string
+		want          int
+	}{
+		{"no auth", "", false, "/store/query", "", http.StatusOK},
+		{"missing token", "secret", false, "/store/query", "", http.StatusUnauthorized},
+		{"wrong token", "secret", false, "/store/query", "Bearer nope", http.StatusUnauthorized},
+		{"token without scheme", "secret", false, "/store/query", "secret", http.StatusUnauthorized},
+		{"correct token", "secret", false, "/store/query", "Bearer secret", http.StatusOK},
+		{"health not exempt", "secret", false, "/health", "", http.StatusUnauthorized},
+		{"health exempt", "secret", true, "/health", "", http.StatusOK},
+		{"metrics exempt", "secret", true, "/metrics", "", http.StatusOK},
+		{"readyz exempt", "secret", true, "/readyz", "", http.StatusOK},
+		{"others not exempt", "secret", true, "/store/_query", "", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", testcase.path, nil)
+		if testcase.authorization != "" {
+			req.Header.Set("Authorization", testcase.authorization)
+		}
+		w := httptest.NewRecorder()
+		requireToken(testcase.token, testcase.exemptHealth, ok).ServeHTTP(w, req)
+		if want, have := testcase.want, w.Code; want != have {
+			t.Errorf("%s: want HTTP %d, have %d", testcase.name, want, have)
+		}
+	}
+}
+
+func TestStoreAuth(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "oklog-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	token, err := readAuthToken(tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "secret", token; want != have {
+		t.Fatalf("want token %q, have %q", want, have)
+	}
+
+	// A store node requiring the token, which queries itself with peerToken.
+	newStore := func(peerToken string) (hostport string, close func()) {
+		filelog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, store.FileLogConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			peer               = &hostPeer{}
+			peerClient         = &http.Client{Transport: tokenTransport(&http.Transport{}, peerToken)}
+			replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+			replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
+			duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+			mux                = http.NewServeMux()
+			api                = store.NewAPI(peer, filelog, store.APIConfig{
+				QueryClient:        peerClient,
+				StreamClient:       peerClient,
+				ReplicatedSegments: replicatedSegments,
+				ReplicatedBytes:    replicatedBytes,
+				Duration:           duration,
+				Reporter:           store.LogReporter{Logger: log.NewNopLogger()},
+			})
+		)
+		mux.Handle("/store/", http.StripPrefix("/store", api))
+		server := httptest.NewServer(requireToken(token, false, mux))
+		peer.hostport = strings.TrimPrefix(server.URL, "http://")
+		return peer.hostport, func() { server.Close(); api.Close() }
+	}
+	hostport, closeStore := newStore(token)
+	defer closeStore()
+
+	// User-facing and internal endpoints alike require the token.
+	from := url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339))
+	to := url.QueryEscape(time.Now().Format(time.RFC3339))
+	for _, testcase := range []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"user query without token", "GET", store.APIPathUserQuery + "?from=" + from + "&to=" + to, "", http.StatusUnauthorized},
+		{"user query with wrong token", "GET", store.APIPathUserQuery + "?from=" + from + "&to=" + to, "nope", http.StatusUnauthorized},
+		{"user query with token", "GET", store.APIPathUserQuery + "?from=" + from + "&to=" + to, token, http.StatusOK},
+		{"internal query without token", "GET", store.APIPathInternalQuery + "?from=" + from + "&to=" + to, "", http.StatusUnauthorized},
+		{"internal query with wrong token", "GET", store.APIPathInternalQuery + "?from=" + from + "&to=" + to, "nope", http.StatusUnauthorized},
+		{"internal query with token", "GET", store.APIPathInternalQuery + "?from=" + from + "&to=" + to, token, http.StatusOK},
+		{"replicate without token", "POST", store.APIPathReplicate, "", http.StatusUnauthorized},
+		{"replicate with wrong token", "POST", store.APIPathReplicate, "nope", http.StatusUnauthorized},
+		{"replicate with token", "POST", store.APIPathReplicate, token, http.StatusOK},
+	} {
+		client, scheme := toolClient(nil, testcase.token)
+		req, err := http.NewRequest(testcase.method, scheme+"://"+hostport+"/store"+testcase.path, strings.NewReader(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", testcase.name, err)
+		}
+		resp.Body.Close()
+		if want, have := testcase.want, resp.StatusCode; want != have {
+			t.Errorf("%s: want HTTP %d, have %d", testcase.name, want, have)
+		}
+	}
+
+	// The query command bears the token from its file.
+	if err := runQuery([]string{"-store", "tcp://" + hostport, "-nocopy"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("query without token: want 401, have %v", err)
+	}
+	if err := runQuery([]string{"-store", "tcp://" + hostport, "-auth-token-file", tokenFile, "-nocopy"}); err != nil {
+		t.Errorf("query with token: %v", err)
+	}
+
+	// The stream reader factory, too.
+	for _, testcase := range []struct {
+		token string
+		want  string // error substring, if any
+	}{
+		{"", "401"},
+		{"nope", "401"},
+		{token, ""},
+	} {
+		client, scheme := toolClient(nil, testcase.token)
+		rcf := stream.HTTPReadCloserFactory(client, func(addr string) string {
+			return scheme + "://" + addr + "/store" + store.APIPathUserStream + "?window=100ms"
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		rc, err := rcf(ctx, hostport)
+		switch {
+		case testcase.want == "" && err != nil:
+			t.Errorf("stream with token %q: %v", testcase.token, err)
+		case testcase.want != "" && (err == nil || !strings.Contains(err.Error(), testcase.want)):
+			t.Errorf("stream with token %q: want error containing %q, have %v", testcase.token, testcase.want, err)
+		}
+		if err == nil {
+			rc.Close()
+		}
+		cancel()
+	}
+
+	// A node with the wrong token can't query its peers.
+	badHostport, closeBadStore := newStore("nope")
+	defer closeBadStore()
+	client, scheme := toolClient(nil, token)
+	resp, err := client.Get(scheme + "://" + badHostport + "/store" + store.APIPathUserQuery + "?from=" + from + "&to=" + to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want, have := "1", resp.Header.Get("X-Oklog-Error-Count"); want != have {
+		t.Errorf("peer with wrong token: want error count %s, have %q", want, have)
+	}
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultBenchSamples      = 100000
+	defaultBenchReport       = 10 * time.Second
+	defaultBenchDrainTimeout = 10 * time.Second
+)
+
+// benchTimeFormat is RFC3339, with nanoseconds, in a fixed width, so every
+// record of a -record-size is that size.
+const benchTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+func runBench(args []string) error {
+	if len(args) < 1 {
+		benchUsage()
+		return errors.New("specify a bench command")
+	}
+	switch strings.ToLower(args[0]) {
+	case "write":
+		return runBenchWrite(args[1:])
+	case "query":
+		return runBenchQuery(args[1:])
+	default:
+		benchUsage()
+		return errors.Errorf("unknown bench command %q", args[0])
+	}
+}
+
+func benchUsage() {
+	fmt.Fprintf(os.Stderr, "USAGE\n")
+	fmt.Fprintf(os.Stderr, "  oklog bench <command> [flags]\n")
+	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(os.Stderr, "COMMANDS\n")
+	fmt.Fprintf(os.Stderr, "  write  Write synthetic records to ingest nodes at a fixed rate\n")
+	fmt.Fprintf(os.Stderr, "  query  Query store nodes at a fixed rate\n")
+	fmt.Fprintf(os.Stderr, "\n")
+}
+
+func runBenchWrite(args []string) error {
+	flagset := flag.NewFlagSet("bench write", flag.ExitOnError)
+	var (
+		debug      = flagset.Bool("debug", false, "debug logging, i.e. -log.level=debug")
+		logFormat  = flagset.String("log.format", defaultLogFormat, "log format: logfmt or json")
+		logLevel   = flagset.String("log.level", defaultLogLevel, "log level: debug, info, warn, or error")
+		rate       = flagset.Int("rate", 10000, "records per second, in all")
+		size       = flagset.Int("record-size", 200, "bytes per record, incl. the timestamp, sequence number, and newline")
+		conns      = flagset.Int("connections", 4, "connections to the ingest nodes, each of the forwarder's, sharing the rate")
+		acks       = flagset.Bool("acks", true, "have ingesters acknowledge records, and report how long they took to")
+		hello      = flagset.Bool("hello", false, "negotiate with ingesters with the OKLOG/1 handshake, like forwarders with -forward.hello")
+		clientTime = flagset.Bool("client-timestamps", false, "prefix each record with the time it's written, for ingest nodes with -ingest.client-timestamps")
+		sourceID   = flagset.String("source-id", "", "identify the records to ingesters as from this source, for their -ingest.quota-file")
+		duration   = flagset.Duration("duration", 0, "how long to write for (default until interrupted)")
+		report     = flagset.Duration("report", defaultBenchReport, "how often to log progress (0 for never)")
+		output     = flagset.String("output", "text", "text, or json, for the summary")
+		useTLS     = flagset.Bool("tls", false, "connect to ingest nodes with TLS")
+		tlsCA      = flagset.String("tls.ca", "", "CA certificates to verify ingest nodes with (default system)")
+		tlsCert    = flagset.String("tls.cert", "", "client certificate to present, for mutual TLS")
+		tlsKey     = flagset.String("tls.key", "", "client certificate's private key")
+	)
+	flagset.Usage = usageFor(flagset, "oklog bench write [flags] <ingester> [<ingester>...]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	args = flagset.Args()
+	if len(args) <= 0 {
+		return errors.New("specify at least one ingest address as an argument")
+	}
+	switch {
+	case *rate <= 0:
+		return errors.Errorf("invalid -rate %d", *rate)
+	case *conns <= 0:
+		return errors.Errorf("invalid -connections %d", *conns)
+	case *output != "text" && *output != "json":
+		return errors.Errorf("couldn't parse -output (%q): must be text or json", *output)
+	}
+	if min := benchPrefixSize(*clientTime) + 1 + 1; *size < min {
+		return errors.Errorf("minimum -record-size is %d", min)
+	}
+	urls, err := parseIngestURLs(args)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := toolTLSConfig(*useTLS, *tlsCA, *tlsCert, *tlsKey)
+	if err != nil {
+		return err
+	}
+	logger, err := newLogger(os.Stderr, *logFormat, *logLevel, *debug)
+	if err != nil {
+		return err
+	}
+
+	// Each connection is a target of its own, with its own dialer, so
+	// they're spread over the ingest nodes, as forwarders would be.
+	var (
+		registry = prometheus.NewRegistry()
+		metrics  = newForwardMetrics(registry)
+		latency  = newLatencySample(defaultBenchSamples)
+		targets  []*forwardTarget
+	)
+	for i := 0; i < *conns; i++ {
+		target := newForwardTarget(
+			fmt.Sprintf("bench-%d", i),
+			newIngestDialer(append([]*url.URL(nil), urls...), tlsConfig, *sourceID, *acks, false, *hello, nil, nil, logger).dial,
+			prefixer{},
+			false,
+			*acks,
+			nil,
+			defaultForwardAckWindow,
+			metrics,
+			logger,
+		)
+		if *acks {
+			target.ackLatency = latency
+		}
+		targets = append(targets, target)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	done := benchDone(stop, *duration, logger)
+	summary := benchWrite(targets, registry, latency, *rate, *size, *clientTime, done, *report, logger)
+	return summary.write(os.Stdout, *output == "json")
+}
+
+// benchWrite writes rate records per second, of size bytes, round-robin to
+// the targets, until done is closed, and then waits, for a while, for them
+// to finish writing. Records are the time they're written, with benchTimeFormat,
+// their sequence number, and random words. With clientTime, they're preceded
+// by the time, as ingest.ClientTimestamps expects. A target that can't keep
+// up holds up the rest, so the rate achieved is what the ingesters can take.
+// The summary counts the records and bytes the targets wrote, as recorded in
+// g by their forwardMetrics, and the acknowledgements latency observed.
+func benchWrite(
+	targets []*forwardTarget,
+	g prometheus.Gatherer,
+	latency *latencySample,
+	rate int,
+	size int,
+	clientTime bool,
+	done <-chan struct{},
+	report time.Duration,
+	logger log.Logger,
+) benchSummary {
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t *forwardTarget) {
+			defer wg.Done()
+			t.run()
+		}(t)
+	}
+
+	bodySize := size - benchPrefixSize(clientTime) - 1
+	bodies := randomRecords(10000, bodySize)
+	for i, body := range bodies {
+		bodies[i] = body + strings.Repeat("0", bodySize-len(body)) // trimmed of its trailing space
+	}
+	var (
+		recordsPerCycle, per = cycleFor(rate)
+		ticker               = time.NewTicker(per)
+		begin                = time.Now()
+		stopReport           = benchReport(report, logger, func() []interface{} {
+			records := counterSum(g, "oklog_forward_records_total")
+			return []interface{}{"records", records, "records_per_second", records / time.Since(begin).Seconds(), "acked", latency.count()}
+		})
+	)
+	level.Info(logger).Log("writing", rate, "records_per_second", "record_size", size, "connections", len(targets), "records_per_cycle", recordsPerCycle, "cycle", per)
+	var seq int
+generate:
+	for {
+		select {
+		case <-done:
+			break generate
+		case <-ticker.C:
+		}
+		for i := 0; i < recordsPerCycle; i++ {
+			seq++
+			select {
+			case targets[seq%len(targets)].records <- benchRecord(time.Now(), seq, bodies[seq%len(bodies)], clientTime):
+			case <-done:
+				break generate
+			}
+		}
+	}
+	ticker.Stop()
+	elapsed := time.Since(begin)
+	stopReport()
+
+	for _, t := range targets {
+		close(t.records)
+	}
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(defaultBenchDrainTimeout):
+		level.Warn(logger).Log("drain", "timed out", "after", defaultBenchDrainTimeout)
+	}
+
+	var (
+		records = int64(counterSum(g, "oklog_forward_records_total"))
+		bytes   = int64(counterSum(g, "oklog_forward_bytes_total"))
+	)
+	return benchSummary{
+		Command:          "write",
+		Seconds:          elapsed.Seconds(),
+		Records:          records,
+		Bytes:            bytes,
+		RecordsPerSecond: float64(records) / elapsed.Seconds(),
+		BytesPerSecond:   float64(bytes) / elapsed.Seconds(),
+		Retransmits:      int64(counterSum(g, "oklog_forward_retransmitted_records_total")),
+		Errors:           int64(counterSum(g, "oklog_forward_disconnects") + counterSum(g, "oklog_forward_short_writes")),
+		Latency:          latency.summary(),
+	}
+}
+
+// benchPrefixSize is the size of what precedes the body of a benchRecord.
+func benchPrefixSize(clientTime bool) int {
+	n := len(benchTimeFormat) - len("Z07:00") + len("Z") + 1 + 9 + 1 // "2006-01-02T15:04:05.000000000Z 000000001 "
+	if clientTime {
+		n += 13 + 1 // unix epoch milliseconds, until 2286
+	}
+	return n
+}
+
+func benchRecord(now time.Time, seq int, body string, clientTime bool) []byte {
+	var buf []byte
+	if clientTime {
+		buf = append(strconv.AppendInt(buf, now.UnixNano()/1e6, 10), ' ')
+	}
+	buf = now.UTC().AppendFormat(buf, benchTimeFormat)
+	buf = append(buf, fmt.Sprintf(" %09d ", seq%1e9)...)
+	buf = append(buf, body...)
+	return append(buf, '\n')
+}
+
+func runBenchQuery(args []string) error {
+	flagset := flag.NewFlagSet("bench query", flag.ExitOnError)
+	var (
+		debug       = flagset.Bool("debug", false, "debug logging, i.e. -log.level=debug")
+		logFormat   = flagset.String("log.format", defaultLogFormat, "log format: logfmt or json")
+		logLevel    = flagset.String("log.level", defaultLogLevel, "log level: debug, info, warn, or error")
+		storeAddr   = flagset.String("store", "localhost:7650", "address of store instance to query")
+		window      = flagset.Duration("window", 15*time.Minute, "query from this long ago, up to now")
+		q           = flagset.String("q", "", "query expression")
+		regex       = flagset.Bool("regex", false, "parse -q as regular expression")
+		topic       = flagset.String("topic", "", "only query records of this topic (default all topics)")
+		qps         = flagset.Float64("qps", 1, "queries per second")
+		maxInflight = flagset.Int("max-inflight", 16, "at most this many queries at once; those due meanwhile are skipped")
+		duration    = flagset.Duration("duration", 0, "how long to query for (default until interrupted)")
+		report      = flagset.Duration("report", defaultBenchReport, "how often to log progress (0 for never)")
+		output      = flagset.String("output", "text", "text, or json, for the summary")
+		useTLS      = flagset.Bool("tls", false, "connect to the store with TLS")
+		tlsCA       = flagset.String("tls.ca", "", "CA certificates to verify the store with (default system)")
+		tlsCert     = flagset.String("tls.cert", "", "client certificate to present, for mutual TLS")
+		tlsKey      = flagset.String("tls.key", "", "client certificate's private key")
+		authFile    = flagset.String("auth-token-file", "", "file holding the store's auth token, if it requires one")
+	)
+	flagset.Usage = usageFor(flagset, "oklog bench query [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	switch {
+	case *qps <= 0:
+		return errors.Errorf("invalid -qps %v", *qps)
+	case *maxInflight <= 0:
+		return errors.Errorf("invalid -max-inflight %d", *maxInflight)
+	case *window <= 0:
+		return errors.Errorf("invalid -window %s", *window)
+	case *output != "text" && *output != "json":
+		return errors.Errorf("couldn't parse -output (%q): must be text or json", *output)
+	}
+
+	// Each query is a run of the query command, with these flags.
+	queryArgs := []string{
+		"-store", *storeAddr,
+		"-from", window.String(),
+		"-q", *q,
+		"-regex=" + strconv.FormatBool(*regex),
+		"-topic", *topic,
+		"-tls=" + strconv.FormatBool(*useTLS),
+		"-tls.ca", *tlsCA,
+		"-tls.cert", *tlsCert,
+		"-tls.key", *tlsKey,
+		"-auth-token-file", *authFile,
+	}
+	logger, err := newLogger(os.Stderr, *logFormat, *logLevel, *debug)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	done := benchDone(stop, *duration, logger)
+	summary := benchQuery(queryArgs, *qps, *maxInflight, done, *report, logger)
+	return summary.write(os.Stdout, *output == "json")
+}
+
+// benchQuery runs the query command with args, qps times a second, until done
+// is closed, and then waits, for a while, for the queries in flight to finish.
+// Queries due while maxInflight are in flight are skipped, and counted. A
+// query's latency is how long it took to read every record.
+func benchQuery(args []string, qps float64, maxInflight int, done <-chan struct{}, report time.Duration, logger log.Logger) benchSummary {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		latency     = newLatencySample(defaultBenchSamples)
+		counter     = &recordCounter{}
+		inflight    = make(chan struct{}, maxInflight)
+		wg          sync.WaitGroup
+		queries     int64
+		failures    int64
+		skipped     int64
+		ticker      = time.NewTicker(time.Duration(float64(time.Second) / qps))
+		begin       = time.Now()
+		stopReport  = benchReport(report, logger, func() []interface{} {
+			n := atomic.LoadInt64(&queries)
+			return []interface{}{"queries", n, "queries_per_second", float64(n) / time.Since(begin).Seconds(), "errors", atomic.LoadInt64(&failures), "skipped", atomic.LoadInt64(&skipped)}
+		})
+	)
+	defer cancel()
+	level.Info(logger).Log("querying", qps, "queries_per_second", "max_inflight", maxInflight)
+loop:
+	for {
+		select {
+		case <-done:
+			break loop
+		case <-ticker.C:
+		}
+		select {
+		case inflight <- struct{}{}:
+		default:
+			atomic.AddInt64(&skipped, 1)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-inflight; wg.Done() }()
+			began := time.Now()
+			err := query(ctx, counter, os.Stderr, args)
+			if ctx.Err() != nil {
+				return // cut short, so it doesn't count
+			}
+			atomic.AddInt64(&queries, 1)
+			if err != nil {
+				atomic.AddInt64(&failures, 1)
+				level.Warn(logger).Log("query", "failed", "err", err)
+				return
+			}
+			latency.Observe(time.Since(began).Seconds())
+		}()
+	}
+	ticker.Stop()
+	elapsed := time.Since(begin)
+	stopReport()
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(defaultBenchDrainTimeout):
+		level.Warn(logger).Log("drain", "timed out", "after", defaultBenchDrainTimeout)
+		cancel()
+		<-drained
+	}
+
+	var (
+		n       = atomic.LoadInt64(&queries)
+		records = atomic.LoadInt64(&counter.records)
+		bytes   = atomic.LoadInt64(&counter.bytes)
+	)
+	return benchSummary{
+		Command:          "query",
+		Seconds:          elapsed.Seconds(),
+		Records:          records,
+		Bytes:            bytes,
+		RecordsPerSecond: float64(records) / elapsed.Seconds(),
+		BytesPerSecond:   float64(bytes) / elapsed.Seconds(),
+		Queries:          n,
+		QueriesPerSecond: float64(n) / elapsed.Seconds(),
+		Skipped:          atomic.LoadInt64(&skipped),
+		Errors:           atomic.LoadInt64(&failures),
+		Latency:          latency.summary(),
+	}
+}
+
+// recordCounter counts the records, i.e. lines, and bytes written to it, by
+// any number of queries at once.
+type recordCounter struct {
+	records int64
+	bytes   int64
+}
+
+func (c *recordCounter) Write(p []byte) (int, error) {
+	atomic.AddInt64(&c.records, int64(strings.Count(string(p), "\n")))
+	atomic.AddInt64(&c.bytes, int64(len(p)))
+	return len(p), nil
+}
+
+// benchDone returns a channel that's closed once d has passed, if it isn't 0,
+// or we're interrupted, whichever is first.
+func benchDone(stop <-chan struct{}, d time.Duration, logger log.Logger) <-chan struct{} {
+	var (
+		done        = make(chan struct{})
+		interrupted = make(chan error, 1)
+		deadline    <-chan time.Time
+	)
+	go func() {
+		interrupted <- interrupt(stop)
+	}()
+	if d > 0 {
+		deadline = time.After(d)
+	}
+	go func() {
+		defer close(done)
+		select {
+		case <-deadline:
+		case err := <-interrupted:
+			level.Info(logger).Log("stopping", err)
+		}
+	}()
+	return done
+}
+
+// benchReport logs the keyvals returned by progress every d, until the
+// returned func is called. If d is 0, it never does.
+func benchReport(d time.Duration, logger log.Logger, progress func() []interface{}) func() {
+	if d <= 0 {
+		return func() {}
+	}
+	var (
+		ticker = time.NewTicker(d)
+		stop   = make(chan struct{})
+	)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				level.Info(logger).Log(progress()...)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(stop)
+	}
+}
+
+// counterSum returns the sum of every counter of the named family in g.
+func counterSum(g prometheus.Gatherer, name string) float64 {
+	families, err := g.Gather()
+	if err != nil {
+		return 0
+	}
+	var sum float64
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			sum += m.GetCounter().GetValue()
+		}
+	}
+	return sum
+}
+
+// benchSummary is the outcome of a bench command. Records, and bytes, are
+// those written, or those the queries returned.
+type benchSummary struct {
+	Command          string         `json:"command"`
+	Seconds          float64        `json:"seconds"`
+	Records          int64          `json:"records"`
+	Bytes            int64          `json:"bytes"`
+	RecordsPerSecond float64        `json:"records_per_second"`
+	BytesPerSecond   float64        `json:"bytes_per_second"`
+	Queries          int64          `json:"queries,omitempty"`
+	QueriesPerSecond float64        `json:"queries_per_second,omitempty"`
+	Skipped          int64          `json:"skipped,omitempty"`
+	Retransmits      int64          `json:"retransmits,omitempty"`
+	Errors           int64          `json:"errors"`
+	Latency          latencySummary `json:"latency"`
+}
+
+func (s benchSummary) write(w io.Writer, asJSON bool) error {
+	if asJSON {
+		buf, err := json.MarshalIndent(s, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", buf)
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(tw, "duration\t%s\n", time.Duration(s.Seconds*float64(time.Second)).Round(time.Millisecond))
+	if s.Command == "query" {
+		fmt.Fprintf(tw, "queries\t%d\t%.1f/s\n", s.Queries, s.QueriesPerSecond)
+		fmt.Fprintf(tw, "skipped\t%d\n", s.Skipped)
+	}
+	fmt.Fprintf(tw, "records\t%d\t%.1f/s\n", s.Records, s.RecordsPerSecond)
+	fmt.Fprintf(tw, "bytes\t%s\t%s/s\n", formatBytes(s.Bytes), formatBytes(int64(s.BytesPerSecond)))
+	if s.Command == "write" {
+		fmt.Fprintf(tw, "retransmits\t%d\n", s.Retransmits)
+	}
+	fmt.Fprintf(tw, "errors\t%d\n", s.Errors)
+	if l := s.Latency; l.Count > 0 {
+		fmt.Fprintf(tw, "latency\tp50 %s\tp90 %s\tp99 %s\tmax %s\tmean %s\n", seconds(l.P50), seconds(l.P90), seconds(l.P99), seconds(l.Max), seconds(l.Mean))
+	}
+	return tw.Flush()
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Microsecond)
+}
+
+// latencySample keeps a uniform sample of at most max of the latencies, in
+// seconds, it observes, for their percentiles, by reservoir sampling. It's an
+// observer, safe for concurrent use.
+type latencySample struct {
+	mtx    sync.Mutex
+	max    int
+	n      int64
+	sum    float64
+	most   float64
+	values []float64
+	rand   *rand.Rand
+}
+
+func newLatencySample(max int) *latencySample {
+	return &latencySample{
+		max:  max,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (s *latencySample) Observe(v float64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.n++
+	s.sum += v
+	if v > s.most {
+		s.most = v
+	}
+	if len(s.values) < s.max {
+		s.values = append(s.values, v)
+		return
+	}
+	if i := s.rand.Int63n(s.n); i < int64(s.max) {
+		s.values[i] = v
+	}
+}
+
+func (s *latencySample) count() int64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.n
+}
+
+// latencySummary summarizes latencies, in seconds. The count, mean, and max
+// are of every latency observed; the percentiles, of the sample.
+type latencySummary struct {
+	Count int64   `json:"count"`
+	Mean  float64 `json:"mean_seconds"`
+	P50   float64 `json:"p50_seconds"`
+	P90   float64 `json:"p90_seconds"`
+	P99   float64 `json:"p99_seconds"`
+	Max   float64 `json:"max_seconds"`
+}
+
+func (s *latencySample) summary() latencySummary {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.n == 0 {
+		return latencySummary{}
+	}
+	sorted := append([]float64(nil), s.values...)
+	sort.Float64s(sorted)
+	percentile := func(p float64) float64 {
+		return sorted[int(p*float64(len(sorted)-1))]
+	}
+	return latencySummary{
+		Count: s.n,
+		Mean:  s.sum / float64(s.n),
+		P50:   percentile(.50),
+		P90:   percentile(.90),
+		P99:   percentile(.99),
+		Max:   s.most,
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+func TestLatencySample(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name     string
+		max      int
+		n        int
+		tolerate float64 // of the percentiles
+	}{
+		{"all kept", 1000, 1000, .001},
+		{"sampled", 1000, 100000, .1},
+	} {
+		s := newLatencySample(testcase.max)
+		for i := 1; i <= testcase.n; i++ {
+			s.Observe(float64(i) / float64(testcase.n)) // uniform, up to 1s
+		}
+		summary := s.summary()
+		if want, have := int64(testcase.n), summary.Count; want != have {
+			t.Errorf("%s: want count %d, have %d", testcase.name, want, have)
+		}
+		if want, have := testcase.max, len(s.values); want != have {
+			t.Errorf("%s: want %d kept, have %d", testcase.name, want, have)
+		}
+		if want, have := 1.0, summary.Max; want != have {
+			t.Errorf("%s: want max %v, have %v", testcase.name, want, have)
+		}
+		for _, p := range []struct {
+			want, have float64
+		}{
+			{.5, summary.Mean},
+			{.5, summary.P50},
+			{.9, summary.P90},
+			{.99, summary.P99},
+		} {
+			if math.Abs(p.want-p.have) > testcase.tolerate {
+				t.Errorf("%s: want %v ±%v, have %v", testcase.name, p.want, testcase.tolerate, p.have)
+			}
+		}
+	}
+
+	if want, have := (latencySummary{}), newLatencySample(10).summary(); want != have {
+		t.Errorf("empty: want %+v, have %+v", want, have)
+	}
+}
+
+func TestBenchRecord(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2017, 3, 14, 15, 59, 40, 0, time.FixedZone("CET", 3600))
+	for _, testcase := range []struct {
+		clientTime bool
+		want       string
+	}{
+		{false, "2017-03-14T14:59:40.000000000Z 000000042 body\n"},
+		{true, "1489503580000 2017-03-14T14:59:40.000000000Z 000000042 body\n"},
+	} {
+		have := string(benchRecord(now, 42, "body", testcase.clientTime))
+		if testcase.want != have {
+			t.Errorf("clientTime %v: want %q, have %q", testcase.clientTime, testcase.want, have)
+		}
+		if want, have := len(testcase.want)-len("body\n"), benchPrefixSize(testcase.clientTime); want != have {
+			t.Errorf("clientTime %v: want prefix size %d, have %d", testcase.clientTime, want, have)
+		}
+	}
+}
+
+func TestBenchWrite(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 100000)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s := bufio.NewScanner(conn)
+			if !s.Scan() || s.Text() != ingest.AckHandshake {
+				t.Errorf("want %s handshake, have %q", ingest.AckHandshake, s.Text())
+			}
+			go ackAll(conn, s, received)
+		}
+	}()
+
+	urls, err := parseIngestURLs([]string{"tcp://" + ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		registry = prometheus.NewRegistry()
+		metrics  = newForwardMetrics(registry)
+		latency  = newLatencySample(defaultBenchSamples)
+		targets  []*forwardTarget
+	)
+	for i := 0; i < 2; i++ {
+		target := newForwardTarget(fmt.Sprintf("bench-%d", i), newIngestDialer(append([]*url.URL(nil), urls...), nil, "", true, false, false, nil, nil, log.NewNopLogger()).dial, prefixer{}, false, true, nil, defaultForwardAckWindow, metrics, log.NewNopLogger())
+		target.ackLatency = latency
+		targets = append(targets, target)
+	}
+	// Stop once some records are in, however long it takes to start.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for deadline := time.Now().Add(5 * time.Second); len(received) < 100 && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	summary := benchWrite(targets, registry, latency, 1000, 100, false, done, 0, log.NewNopLogger())
+
+	if summary.Records <= 0 || summary.Records > 1000 {
+		t.Errorf("want up to 1000 records, have %d", summary.Records)
+	}
+	if want, have := summary.Records*100, summary.Bytes; want != have {
+		t.Errorf("want %d bytes, have %d", want, have)
+	}
+	if want, have := summary.Records, summary.Latency.Count; want != have {
+		t.Errorf("want %d acknowledged, have %d", want, have)
+	}
+	if want, have := int64(0), summary.Errors; want != have {
+		t.Errorf("want %d errors, have %d", want, have)
+	}
+	if want, have := int(summary.Records), len(received); want != have {
+		t.Errorf("want %d received, have %d", want, have)
+	}
+	for len(received) > 0 {
+		if line := <-received; len(line) != 100-1 {
+			t.Fatalf("want %d bytes per line, have %d (%q)", 100-1, len(line), line)
+		}
+	}
+}
+
+func TestBenchQuery(t *testing.T) {
+	t.Parallel()
+
+	filelog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, store.FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		peer               = &hostPeer{}
+		replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+		replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
+		duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+		mux                = http.NewServeMux()
+		api                = store.NewAPI(peer, filelog, store.APIConfig{
+			QueryClient:        http.DefaultClient,
+			StreamClient:       http.DefaultClient,
+			ReplicatedSegments: replicatedSegments,
+			ReplicatedBytes:    replicatedBytes,
+			Duration:           duration,
+			Reporter:           store.LogReporter{Logger: log.NewNopLogger()},
+		})
+	)
+	defer api.Close()
+	var segment string
+	for i := 0; i < 3; i++ {
+		segment += fmt.Sprintf("%s record %d\n", ulid.MustNew(ulid.Timestamp(time.Now().Add(-time.Minute)), rand.Reader), i)
+	}
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest("POST", store.APIPathReplicate, strings.NewReader(segment)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+	}
+	mux.Handle("/store/", http.StripPrefix("/store", api))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	peer.hostport = strings.TrimPrefix(server.URL, "http://")
+
+	for _, testcase := range []struct {
+		q       string
+		records int64 // per query
+		errors  bool
+	}{
+		{"record", 3, false},
+		{"record 1", 1, false},
+		{"(", 0, true}, // with -regex, a bad one
+	} {
+		args := []string{"-store", "tcp://" + peer.hostport, "-from", "15m", "-q", testcase.q, "-regex"}
+		done := make(chan struct{})
+		time.AfterFunc(500*time.Millisecond, func() { close(done) })
+		summary := benchQuery(args, 20, 4, done, 0, log.NewNopLogger())
+
+		if summary.Queries <= 0 {
+			t.Errorf("%s: want queries, have none", testcase.q)
+		}
+		if want, have := summary.Queries*testcase.records, summary.Records; want != have {
+			t.Errorf("%s: want %d records, have %d", testcase.q, want, have)
+		}
+		if testcase.errors {
+			if want, have := summary.Queries, summary.Errors; want != have {
+				t.Errorf("%s: want %d errors, have %d", testcase.q, want, have)
+			}
+			continue
+		}
+		if want, have := int64(0), summary.Errors; want != have {
+			t.Errorf("%s: want %d errors, have %d", testcase.q, want, have)
+		}
+		if want, have := summary.Queries, summary.Latency.Count; want != have {
+			t.Errorf("%s: want %d latencies, have %d", testcase.q, want, have)
+		}
+	}
+}
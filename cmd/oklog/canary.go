@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/canary"
+	"github.com/oklog/oklog/pkg/group"
+)
+
+const (
+	defaultCanaryPort             = 7658
+	defaultCanaryInterval         = 30 * time.Second
+	defaultCanaryTimeout          = 10 * time.Second
+	defaultCanaryFailureThreshold = 3
+)
+
+var defaultCanaryAPIAddr = fmt.Sprintf("tcp://0.0.0.0:%d", defaultCanaryPort)
+
+// runCanary checks a cluster end to end, writing sentinel records to its
+// ingest nodes, and querying its store nodes for them, and serves the
+// results as metrics.
+func runCanary(args []string) error {
+	flagset := flag.NewFlagSet("canary", flag.ExitOnError)
+	var (
+		debug      = flagset.Bool("debug", false, "debug logging, i.e. -log.level=debug")
+		logFormat  = flagset.String("log.format", defaultLogFormat, "log format: logfmt or json")
+		logLevel   = flagset.String("log.level", defaultLogLevel, "log level: debug, info, warn, or error")
+		apiAddr    = flagset.String("api", defaultCanaryAPIAddr, "listen address for the canary's metrics, and health check")
+		interval   = flagset.Duration("interval", defaultCanaryInterval, "how often to write a sentinel record, and query for it")
+		timeout    = flagset.Duration("timeout", defaultCanaryTimeout, "give up on a sentinel record that isn't queryable after this long")
+		alertAfter = flagset.Int("alert-after", defaultCanaryFailureThreshold, "raise an alert after this many failed checks in a row (0 for never)")
+		authFile   = flagset.String("auth-token-file", "", "file holding the stores' auth token, if they require one")
+		alerts     = newAlertFlags(flagset)
+		ingesters  = stringslice{}
+		stores     = stringslice{}
+	)
+	flagset.Var(&ingesters, "ingest", "fast or durable ingest address of an ingest node to write to, taking each in turn (repeatable; default localhost:7651)")
+	flagset.Var(&stores, "store", "API address of a store node to query, taking each in turn (repeatable; default localhost:7650)")
+	flagset.Usage = usageFor(flagset, "oklog canary [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if len(ingesters) == 0 {
+		ingesters = stringslice{fmt.Sprintf("localhost:%d", defaultFastPort)}
+	}
+	if len(stores) == 0 {
+		stores = stringslice{fmt.Sprintf("localhost:%d", defaultAPIPort)}
+	}
+	if *interval <= 0 {
+		return errors.Errorf("invalid -interval %s", *interval)
+	}
+	if *timeout <= 0 {
+		return errors.Errorf("invalid -timeout %s", *timeout)
+	}
+	if *alertAfter < 0 {
+		return errors.Errorf("invalid -alert-after %d", *alertAfter)
+	}
+	var ingestAddrs, storeAddrs []string
+	for _, addr := range ingesters {
+		_, hostport, _, _, err := parseAddr(addr, defaultFastPort)
+		if err != nil {
+			return errors.Wrap(err, "couldn't parse -ingest")
+		}
+		ingestAddrs = append(ingestAddrs, hostport)
+	}
+	for _, addr := range stores {
+		_, hostport, _, _, err := parseAddr(addr, defaultAPIPort)
+		if err != nil {
+			return errors.Wrap(err, "couldn't parse -store")
+		}
+		storeAddrs = append(storeAddrs, hostport)
+	}
+	authToken, err := readAuthToken(*authFile)
+	if err != nil {
+		return err
+	}
+
+	// Logging.
+	logger, err := newLogger(os.Stderr, *logFormat, *logLevel, *debug)
+	if err != nil {
+		return err
+	}
+
+	// Instrumentation.
+	checks := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "canary_checks_total",
+		Help:      "Canary checks, by result: success, write_error, query_error, or missing.",
+	}, []string{"result"})
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "oklog",
+		Name:      "canary_latency_seconds",
+		Help:      "How long sentinel records took, from being written to being queryable, for checks that succeeded.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	failures := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "oklog",
+		Name:      "canary_consecutive_failures",
+		Help:      "Canary checks that failed in a row, up to the latest.",
+	})
+	prometheus.MustRegister(checks, latency, failures)
+
+	// The API, of just metrics, and the health check.
+	apiNetwork, apiAddress, _, _, err := parseAddr(*apiAddr, defaultCanaryPort)
+	if err != nil {
+		return err
+	}
+	apiListener, err := net.Listen(apiNetwork, apiAddress)
+	if err != nil {
+		return err
+	}
+	alertBus, err := alerts.newBus(prometheus.DefaultRegisterer, apiListener.Addr().String(), logger)
+	if err != nil {
+		apiListener.Close()
+		return err
+	}
+	client, _ := toolClient(nil, authToken)
+	c := canary.NewCanary(
+		ingestAddrs, storeAddrs,
+		&http.Client{Transport: client.Transport, Timeout: *timeout},
+		*interval, *timeout,
+		*alertAfter, alertBus,
+		checks, latency, failures,
+		log.With(logger, "component", "Canary"),
+	)
+
+	// Execution group.
+	var g group.Group
+	{
+		g.Add(func() error {
+			alertBus.Run()
+			return nil
+		}, func(error) {
+			alertBus.Stop()
+		})
+	}
+	{
+		g.Add(func() error {
+			c.Run()
+			return nil
+		}, func(error) {
+			c.Stop()
+		})
+	}
+	{
+		g.Add(func() error {
+			mux := http.NewServeMux()
+			registerMetrics(mux, prometheus.DefaultGatherer)
+			registerHealthCheck(mux)
+			registerVersion(mux, flagset)
+			return http.Serve(apiListener, mux)
+		}, func(error) {
+			apiListener.Close()
+		})
+	}
+	{
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return interrupt(cancel)
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	return g.Run()
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/store"
+	"github.com/oklog/oklog/pkg/version"
+)
+
+// The exit statuses of oklog check, past 0, for every check passing, and 1,
+// for not being able to check at all, e.g. on bad flags.
+const (
+	exitCheckWarn = 2 // some check warned, and none failed
+	exitCheckFail = 3 // some check failed
+)
+
+const (
+	// defaultCheckConsumeStale is how long ago a store node may last have
+	// asked an ingest node for segments, and still be consuming it.
+	defaultCheckConsumeStale = 5 * time.Minute
+
+	// checkSegmentSizeRatio is how many times the smallest segment size of
+	// a type of node the largest may be, before it's worth a warning.
+	checkSegmentSizeRatio = 4
+)
+
+func runCheck(args []string) error {
+	flagset := flag.NewFlagSet("check", flag.ExitOnError)
+	var (
+		f            = newStatusFlags(flagset)
+		peers        = flagset.String("peers", "", "comma-separated API addresses of the nodes to check, besides any -addr")
+		maxClockSkew = flagset.Duration("max-clock-skew", defaultClockSkewWarning, "fail if any peer's clock is further off another's than this")
+		consumeStale = flagset.Duration("consume-stale", defaultCheckConsumeStale, "fail for ingest nodes no store node has asked for segments within this long")
+	)
+	flagset.Usage = usageFor(flagset, "oklog check -peers host1,host2,... [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	for _, addr := range strings.Split(*peers, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			f.addrs = append(f.addrs, addr)
+		}
+	}
+	format, client, scheme, hostports, err := f.parse()
+	if err != nil {
+		return err
+	}
+
+	snapshot := takeCheckSnapshot(client, scheme, hostports)
+	report := runChecks(snapshot, checkOptions{MaxClockSkew: *maxClockSkew, ConsumeStale: *consumeStale})
+	if err := format.render(os.Stdout, report); err != nil {
+		return err
+	}
+	switch report.Result {
+	case checkFail:
+		return exitError{code: exitCheckFail, err: errors.New("cluster check failed")}
+	case checkWarn:
+		return exitError{code: exitCheckWarn, err: errors.New("cluster check passed, with warnings")}
+	}
+	return nil
+}
+
+// checkSnapshot is what the nodes asked told of themselves, as of Taken.
+type checkSnapshot struct {
+	Taken time.Time   `json:"taken"`
+	Nodes []checkNode `json:"nodes"`
+}
+
+// checkNode is what a node told of itself: its build and flags, its view of
+// the cluster, and, if it's a store node, the ingest nodes it consumes.
+type checkNode struct {
+	Addr    string              `json:"addr"`
+	Info    version.Info        `json:"info"`
+	Peers   []cluster.PeerState `json:"peers,omitempty"`
+	Consume *store.ConsumeLag   `json:"consume,omitempty"`
+	Error   string              `json:"error,omitempty"`
+}
+
+// takeCheckSnapshot asks each node, at the base URL of the scheme and its
+// host:port, for its version, its view of the cluster, and its consume lag.
+// Nodes that can't be asked are recorded with the error.
+func takeCheckSnapshot(client *http.Client, scheme string, hostports []string) checkSnapshot {
+	s := checkSnapshot{Taken: time.Now().UTC(), Nodes: make([]checkNode, len(hostports))}
+	for i, hostport := range hostports {
+		var (
+			n    = &s.Nodes[i]
+			base = scheme + "://" + hostport
+		)
+		n.Addr = hostport
+		if err := getJSON(client, base+"/version", &n.Info); err != nil {
+			n.Error = err.Error()
+			continue
+		}
+		if err := getJSON(client, base+"/cluster"+cluster.APIPathState, &n.Peers); err != nil {
+			n.Error = err.Error()
+			continue
+		}
+		if !n.isStore() {
+			continue
+		}
+		var lag store.ConsumeLag
+		if found, err := getJSONIfFound(client, base+"/store"+store.APIPathLag, &lag); err != nil {
+			n.Error = err.Error()
+		} else if found {
+			n.Consume = &lag
+		}
+	}
+	return s
+}
+
+// answered returns the nodes that could be asked.
+func (s checkSnapshot) answered() []checkNode {
+	var nodes []checkNode
+	for _, n := range s.Nodes {
+		if n.Error == "" {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// peers returns every peer in the views of the nodes that answered, by name,
+// as the first view it's in sees it.
+func (s checkSnapshot) peers() []cluster.PeerState {
+	var (
+		seen  = map[string]bool{}
+		peers []cluster.PeerState
+	)
+	for _, n := range s.answered() {
+		for _, p := range n.Peers {
+			if !seen[p.Name] {
+				seen[p.Name] = true
+				peers = append(peers, p)
+			}
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+	return peers
+}
+
+func (n checkNode) isIngest() bool {
+	return n.Info.NodeType == "ingest" || n.Info.NodeType == "ingeststore"
+}
+
+func (n checkNode) isStore() bool {
+	return n.Info.NodeType == "store" || n.Info.NodeType == "ingeststore"
+}
+
+// flag returns the value of the first of the named flags the node was started
+// with, or def, if it was started with none of them. Flags are named
+// differently by some types of node, e.g. -topic-mode, but -ingest.topic-mode.
+func (n checkNode) flag(def string, names ...string) string {
+	for _, name := range names {
+		if value, ok := n.Info.Flags[name]; ok {
+			return value
+		}
+	}
+	return def
+}
+
+// checkOptions are the thresholds of the checks.
+type checkOptions struct {
+	MaxClockSkew time.Duration
+	ConsumeStale time.Duration
+}
+
+// The results of a check, from best to worst.
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+var checkRank = map[string]int{checkPass: 0, checkWarn: 1, checkFail: 2}
+
+// checkResult is the result of a check, with the details that explain it.
+type checkResult struct {
+	Check   string   `json:"check"`
+	Result  string   `json:"result"`
+	Details []string `json:"details,omitempty"`
+}
+
+// worse makes the result r, if it's worse than the one it has, and adds the
+// detail.
+func (c *checkResult) worse(r string, format string, args ...interface{}) {
+	if checkRank[r] > checkRank[c.Result] {
+		c.Result = r
+	}
+	c.Details = append(c.Details, fmt.Sprintf(format, args...))
+}
+
+// checks are run in order, each over the same snapshot. Each returns its
+// result, without its name, which is filled in.
+var checks = []struct {
+	name string
+	fn   func(checkSnapshot, checkOptions) checkResult
+}{
+	{"reachable", checkReachable},
+	{"version", checkVersions},
+	{"features", checkFeatures},
+	{"replication", checkReplication},
+	{"segment-size", checkSegmentSizes},
+	{"gossip-encryption", checkGossipEncryption},
+	{"tls", checkTLS},
+	{"clock-skew", checkClockSkew},
+	{"ingest-consumed", checkIngestConsumed},
+}
+
+// checkReport is the result of every check, and the worst of them.
+type checkReport struct {
+	Result string        `json:"result"`
+	Checks []checkResult `json:"checks"`
+}
+
+func runChecks(s checkSnapshot, o checkOptions) checkReport {
+	report := checkReport{Result: checkPass}
+	for _, c := range checks {
+		result := c.fn(s, o)
+		result.Check = c.name
+		if checkRank[result.Result] > checkRank[report.Result] {
+			report.Result = result.Result
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+func (r checkReport) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(tw, "CHECK\tRESULT\tDETAILS\n")
+	for _, c := range r.Checks {
+		details := c.Details
+		if len(details) <= 0 {
+			details = []string{"-"}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Check, strings.ToUpper(c.Result), details[0])
+		for _, detail := range details[1:] {
+			fmt.Fprintf(tw, "\t\t%s\n", detail)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%s\n", strings.ToUpper(r.Result))
+	return err
+}
+
+// checkReachable fails for every node that couldn't be asked.
+func checkReachable(s checkSnapshot, _ checkOptions) checkResult {
+	c := checkResult{Result: checkPass}
+	for _, n := range s.Nodes {
+		if n.Error != "" {
+			c.worse(checkFail, "%s: %s", n.Addr, n.Error)
+		}
+	}
+	if c.Result == checkPass {
+		c.Details = []string{fmt.Sprintf("%d node(s) answered", len(s.Nodes))}
+	}
+	return c
+}
+
+// checkVersions fails if the nodes asked, and the peers they see, run
+// different major versions, and warns if they run versions that aren't
+// compatible otherwise, i.e. of different minor versions.
+func checkVersions(s checkSnapshot, _ checkOptions) checkResult {
+	versions := &disagreement{}
+	for _, n := range s.answered() {
+		versions.add(n.Info.Version, n.Addr)
+	}
+	for _, p := range s.peers() {
+		if p.Version != "" {
+			versions.add(p.Version, p.Name)
+		}
+	}
+	c := checkResult{Result: checkPass}
+	if len(versions.values) <= 1 {
+		c.Details = []string{fmt.Sprintf("all %s", versions)}
+		return c
+	}
+	majors := map[int]bool{}
+	for _, v := range versions.values {
+		if major, ok := version.Major(v); ok {
+			majors[major] = true
+		}
+	}
+	for i, a := range versions.values {
+		for _, b := range versions.values[i+1:] {
+			if !version.Compatible(a, b) {
+				c.worse(checkWarn, "%s and %s aren't compatible", a, b)
+			}
+		}
+	}
+	if len(majors) > 1 {
+		c.worse(checkFail, "%d major versions", len(majors))
+	}
+	c.Details = append(c.Details, versions.describe())
+	return c
+}
+
+// checkFeatures fails if ingest nodes parse topics differently, or if some
+// nodes gossip, and others have static peers.
+func checkFeatures(s checkSnapshot, _ checkOptions) checkResult {
+	var (
+		c      = checkResult{Result: checkPass}
+		topics = &disagreement{}
+		static = &disagreement{}
+	)
+	for _, n := range s.answered() {
+		if n.isIngest() {
+			mode := n.flag(topicModeStatic, "topic-mode", "ingest.topic-mode")
+			if mode == topicModeStatic {
+				mode += " " + n.flag(record.DefaultTopic, "topic", "ingest.topic")
+			}
+			topics.add(mode, n.Addr)
+		}
+		static.add(strconv.FormatBool(n.flag("", "cluster.static-peers", "cluster.static-peers-file") != ""), n.Addr)
+	}
+	if len(topics.values) > 1 {
+		c.worse(checkFail, "ingest topic mode: %s", topics.describe())
+	}
+	if len(static.values) > 1 {
+		c.worse(checkFail, "static peers: %s", static.describe())
+	}
+	return c
+}
+
+// checkReplication fails if the store nodes replicate segments to different
+// numbers of store nodes, or to more than there are.
+func checkReplication(s checkSnapshot, _ checkOptions) checkResult {
+	var (
+		c       = checkResult{Result: checkPass}
+		factors = &disagreement{}
+		stores  int
+	)
+	for _, n := range s.answered() {
+		if n.isStore() {
+			factors.add(n.flag(strconv.Itoa(defaultStoreSegmentReplicationFactor), "store.replication-factor"), n.Addr)
+		}
+	}
+	for _, p := range s.peers() {
+		if (p.Type == cluster.PeerTypeStore || p.Type == cluster.PeerTypeIngestStore) && p.State == "alive" {
+			stores++
+		}
+	}
+	switch len(factors.values) {
+	case 0:
+		c.worse(checkWarn, "no store node asked")
+	case 1:
+		factor, err := strconv.Atoi(factors.values[0])
+		if err == nil && stores > 0 && factor > stores {
+			c.worse(checkFail, "replication factor %d, but %d store node(s) alive", factor, stores)
+		} else {
+			c.Details = []string{fmt.Sprintf("replication factor %s", factors)}
+		}
+	default:
+		c.worse(checkFail, "replication factor: %s", factors.describe())
+	}
+	return c
+}
+
+// checkSegmentSizes warns if the ingest nodes flush segments, or the store
+// nodes target segments, of sizes further apart than checkSegmentSizeRatio.
+func checkSegmentSizes(s checkSnapshot, _ checkOptions) checkResult {
+	var (
+		c      = checkResult{Result: checkPass}
+		flush  = &disagreement{}
+		target = &disagreement{}
+	)
+	for _, n := range s.answered() {
+		if n.isIngest() {
+			flush.add(n.flag(strconv.Itoa(defaultIngestSegmentFlushSize), "ingest.segment-flush-size"), n.Addr)
+		}
+		if n.isStore() {
+			target.add(n.flag(strconv.Itoa(defaultStoreSegmentTargetSize), "store.segment-target-size"), n.Addr)
+		}
+	}
+	for _, sizes := range []struct {
+		flag string
+		d    *disagreement
+	}{
+		{"ingest.segment-flush-size", flush},
+		{"store.segment-target-size", target},
+	} {
+		var smallest, largest int64
+		for _, v := range sizes.d.values {
+			size, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || size <= 0 {
+				continue
+			}
+			if smallest == 0 || size < smallest {
+				smallest = size
+			}
+			if size > largest {
+				largest = size
+			}
+		}
+		if smallest > 0 && largest > checkSegmentSizeRatio*smallest {
+			c.worse(checkWarn, "-%s: %s", sizes.flag, sizes.d.describe())
+		}
+	}
+	return c
+}
+
+// checkGossipEncryption fails if some nodes encrypt gossip, and others don't,
+// as they can't talk to each other.
+func checkGossipEncryption(s checkSnapshot, _ checkOptions) checkResult {
+	return checkSetOnAll(s, "cluster.encrypt-key-file", "gossip encrypted")
+}
+
+// checkTLS fails if some nodes serve TLS, and others don't.
+func checkTLS(s checkSnapshot, _ checkOptions) checkResult {
+	return checkSetOnAll(s, "tls.cert", "serving TLS")
+}
+
+// checkSetOnAll fails unless the flag is set on every node that answered, or
+// on none of them, describing those it is set on as what.
+func checkSetOnAll(s checkSnapshot, flag, what string) checkResult {
+	var (
+		c   = checkResult{Result: checkPass}
+		set = &disagreement{}
+	)
+	for _, n := range s.answered() {
+		set.add(strconv.FormatBool(n.flag("", flag) != ""), n.Addr)
+	}
+	switch len(set.values) {
+	case 0:
+	case 1:
+		if set.values[0] == "true" {
+			c.Details = []string{fmt.Sprintf("all %s", what)}
+		} else {
+			c.Details = []string{fmt.Sprintf("none %s", what)}
+		}
+	default:
+		c.worse(checkFail, "-%s set at %s, but not at %s", flag, strings.Join(set.addrs["true"], ", "), strings.Join(set.addrs["false"], ", "))
+	}
+	return c
+}
+
+// checkClockSkew fails for every peer whose clock a node sees further off its
+// own than o.MaxClockSkew.
+func checkClockSkew(s checkSnapshot, o checkOptions) checkResult {
+	c := checkResult{Result: checkPass}
+	var worst time.Duration
+	for _, n := range s.answered() {
+		for _, p := range n.Peers {
+			if p.ClockOffset == "" {
+				continue
+			}
+			offset, err := time.ParseDuration(p.ClockOffset)
+			if err != nil {
+				continue
+			}
+			if offset < 0 {
+				offset = -offset
+			}
+			if offset > worst {
+				worst = offset
+			}
+			if offset > o.MaxClockSkew {
+				c.worse(checkFail, "%s: %s off, as %s sees it", p.Name, p.ClockOffset, n.Addr)
+			}
+		}
+	}
+	if c.Result == checkPass {
+		c.Details = []string{fmt.Sprintf("at most %s off", worst)}
+	}
+	return c
+}
+
+// checkIngestConsumed fails for every alive ingest node that no store node
+// asked has asked for segments within o.ConsumeStale.
+func checkIngestConsumed(s checkSnapshot, o checkOptions) checkResult {
+	var (
+		c        = checkResult{Result: checkPass}
+		consumed = map[string]bool{} // ingest API host:port
+		stores   int
+	)
+	for _, n := range s.answered() {
+		if n.Consume == nil {
+			continue
+		}
+		stores++
+		for _, l := range n.Consume.Ingesters {
+			if !l.Observed.IsZero() && s.Taken.Sub(l.Observed) <= o.ConsumeStale {
+				consumed[l.Ingester] = true
+			}
+		}
+	}
+	var ingests int
+	for _, p := range s.peers() {
+		if (p.Type != cluster.PeerTypeIngest && p.Type != cluster.PeerTypeIngestStore) || p.State != "alive" {
+			continue
+		}
+		ingests++
+		if hostport := fmt.Sprintf("%s:%d", p.APIAddr, p.APIPort); stores > 0 && !consumed[hostport] {
+			c.worse(checkFail, "%s (%s): not consumed by any store node asked, within %s", p.Name, hostport, o.ConsumeStale)
+		}
+	}
+	if stores == 0 && ingests > 0 {
+		c.worse(checkWarn, "no store node asked")
+	}
+	if c.Result == checkPass {
+		c.Details = []string{fmt.Sprintf("%d ingest node(s) consumed", ingests)}
+	}
+	return c
+}
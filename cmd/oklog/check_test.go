@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/store"
+	"github.com/oklog/oklog/pkg/version"
+)
+
+var checkTaken = time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// testCheckSnapshot is a healthy cluster of an ingest node, and two store
+// nodes, all asked.
+func testCheckSnapshot() checkSnapshot {
+	var (
+		ingest = cluster.PeerState{Name: "ingest-1", APIAddr: "10.0.0.1", APIPort: 7650, Type: cluster.PeerTypeIngest, State: "alive", Version: "0.3.1"}
+		store1 = cluster.PeerState{Name: "store-1", APIAddr: "10.0.0.2", APIPort: 7650, Type: cluster.PeerTypeStore, State: "alive", Version: "0.3.1", ClockOffset: "2ms"}
+		store2 = cluster.PeerState{Name: "store-2", APIAddr: "10.0.0.3", APIPort: 7650, Type: cluster.PeerTypeStore, State: "alive", Version: "0.3.1"}
+		peers  = []cluster.PeerState{ingest, store1, store2}
+		lag    = &store.ConsumeLag{Ingesters: []store.IngesterLag{{Ingester: "10.0.0.1:7650", Observed: checkTaken.Add(-time.Second)}}}
+	)
+	return checkSnapshot{Taken: checkTaken, Nodes: []checkNode{
+		{Addr: "10.0.0.1:7650", Info: version.Info{Version: "0.3.1", NodeType: "ingest", Flags: map[string]string{}}, Peers: peers},
+		{Addr: "10.0.0.2:7650", Info: version.Info{Version: "0.3.1", NodeType: "store", Flags: map[string]string{}}, Peers: peers, Consume: lag},
+		{Addr: "10.0.0.3:7650", Info: version.Info{Version: "0.3.1", NodeType: "store", Flags: map[string]string{}}, Peers: peers, Consume: &store.ConsumeLag{}},
+	}}
+}
+
+var testCheckOptions = checkOptions{MaxClockSkew: time.Second, ConsumeStale: time.Minute}
+
+func TestChecks(t *testing.T) {
+	t.Parallel()
+
+	setFlag := func(node int, name, value string) func(*checkSnapshot) {
+		return func(s *checkSnapshot) { s.Nodes[node].Info.Flags[name] = value }
+	}
+	setPeers := func(f func(p *cluster.PeerState)) func(*checkSnapshot) {
+		return func(s *checkSnapshot) {
+			for i := range s.Nodes {
+				peers := append([]cluster.PeerState(nil), s.Nodes[i].Peers...)
+				for j := range peers {
+					f(&peers[j])
+				}
+				s.Nodes[i].Peers = peers
+			}
+		}
+	}
+	for _, testcase := range []struct {
+		name   string
+		check  func(checkSnapshot, checkOptions) checkResult
+		change func(*checkSnapshot)
+		want   string
+		detail string // in the details, if not empty
+	}{
+		{"reachable", checkReachable, nil, checkPass, "3 node(s) answered"},
+		{"unreachable", checkReachable, func(s *checkSnapshot) { s.Nodes[2].Error = "connection refused" }, checkFail, "10.0.0.3:7650: connection refused"},
+
+		{"same version", checkVersions, nil, checkPass, "all 0.3.1"},
+		{"patch versions", checkVersions, func(s *checkSnapshot) { s.Nodes[1].Info.Version = "0.3.2" }, checkPass, "0.3.2 at 10.0.0.2:7650"},
+		{"minor versions", checkVersions, func(s *checkSnapshot) { s.Nodes[1].Info.Version = "0.4.0" }, checkWarn, "0.3.1 and 0.4.0 aren't compatible"},
+		{"major versions", checkVersions, func(s *checkSnapshot) { s.Nodes[1].Info.Version = "1.0.0" }, checkFail, "2 major versions"},
+		{"peer version", checkVersions, setPeers(func(p *cluster.PeerState) {
+			if p.Name == "store-2" {
+				p.Version = "1.0.0"
+			}
+		}), checkFail, "1.0.0 at store-2"},
+		{"dev version", checkVersions, func(s *checkSnapshot) { s.Nodes[1].Info.Version = "dev" }, checkPass, ""},
+
+		{"default features", checkFeatures, nil, checkPass, ""},
+		{"dynamic topics", checkFeatures, setFlag(0, "topic-mode", "dynamic"), checkPass, ""},
+		{"mixed topics", checkFeatures, func(s *checkSnapshot) {
+			s.Nodes[0].Info.Flags["topic-mode"] = "dynamic"
+			s.Nodes = append(s.Nodes, checkNode{Addr: "10.0.0.4:7650", Info: version.Info{NodeType: "ingeststore", Flags: map[string]string{"ingest.topic": "app"}}})
+		}, checkFail, "ingest topic mode: dynamic at 10.0.0.1:7650; static app at 10.0.0.4:7650"},
+		{"mixed static peers", checkFeatures, setFlag(1, "cluster.static-peers", "ingest=10.0.0.1:7650"), checkFail, "static peers"},
+
+		{"default replication", checkReplication, nil, checkPass, "replication factor 2"},
+		{"mixed replication", checkReplication, setFlag(2, "store.replication-factor", "3"), checkFail, "replication factor: 2 at 10.0.0.2:7650; 3 at 10.0.0.3:7650"},
+		{"replication past stores", checkReplication, func(s *checkSnapshot) {
+			s.Nodes[1].Info.Flags["store.replication-factor"] = "3"
+			s.Nodes[2].Info.Flags["store.replication-factor"] = "3"
+		}, checkFail, "replication factor 3, but 2 store node(s) alive"},
+		{"replication, without stores", checkReplication, func(s *checkSnapshot) { s.Nodes = s.Nodes[:1] }, checkWarn, "no store node asked"},
+
+		{"default segment sizes", checkSegmentSizes, nil, checkPass, ""},
+		{"close segment sizes", checkSegmentSizes, setFlag(2, "store.segment-target-size", "67108864"), checkPass, ""},
+		{"far segment sizes", checkSegmentSizes, setFlag(2, "store.segment-target-size", "1048576"), checkWarn, "-store.segment-target-size: 134217728 at 10.0.0.2:7650; 1048576 at 10.0.0.3:7650"},
+
+		{"no gossip encryption", checkGossipEncryption, nil, checkPass, "none gossip encrypted"},
+		{"mixed gossip encryption", checkGossipEncryption, setFlag(0, "cluster.encrypt-key-file", version.Redacted), checkFail, "-cluster.encrypt-key-file set at 10.0.0.1:7650, but not at 10.0.0.2:7650, 10.0.0.3:7650"},
+		{"gossip encryption", checkGossipEncryption, func(s *checkSnapshot) {
+			for i := range s.Nodes {
+				s.Nodes[i].Info.Flags["cluster.encrypt-key-file"] = version.Redacted
+			}
+		}, checkPass, "all gossip encrypted"},
+		{"mixed TLS", checkTLS, setFlag(2, "tls.cert", "/etc/oklog/tls.crt"), checkFail, "-tls.cert set at 10.0.0.3:7650"},
+
+		{"clock skew", checkClockSkew, nil, checkPass, "at most 2ms off"},
+		{"clock skewed", checkClockSkew, setPeers(func(p *cluster.PeerState) {
+			if p.Name == "store-2" {
+				p.ClockOffset = "-3s"
+			}
+		}), checkFail, "store-2: -3s off, as 10.0.0.1:7650 sees it"},
+
+		{"ingest consumed", checkIngestConsumed, nil, checkPass, "1 ingest node(s) consumed"},
+		{"ingest stale", checkIngestConsumed, func(s *checkSnapshot) {
+			s.Nodes[1].Consume = &store.ConsumeLag{Ingesters: []store.IngesterLag{{Ingester: "10.0.0.1:7650", Observed: checkTaken.Add(-time.Hour)}}}
+		}, checkFail, "ingest-1 (10.0.0.1:7650): not consumed by any store node asked"},
+		{"ingest unconsumed", checkIngestConsumed, func(s *checkSnapshot) { s.Nodes[1].Consume = &store.ConsumeLag{} }, checkFail, "ingest-1 (10.0.0.1:7650)"},
+		{"ingest, without stores", checkIngestConsumed, func(s *checkSnapshot) { s.Nodes = s.Nodes[:1] }, checkWarn, "no store node asked"},
+	} {
+		s := testCheckSnapshot()
+		if testcase.change != nil {
+			testcase.change(&s)
+		}
+		c := testcase.check(s, testCheckOptions)
+		if want, have := testcase.want, c.Result; want != have {
+			t.Errorf("%s: want %s, have %s: %q", testcase.name, want, have, c.Details)
+		}
+		if testcase.detail != "" && !strings.Contains(strings.Join(c.Details, "\n"), testcase.detail) {
+			t.Errorf("%s: want details with %q, have %q", testcase.name, testcase.detail, c.Details)
+		}
+	}
+}
+
+func TestCheckReport(t *testing.T) {
+	t.Parallel()
+
+	report := runChecks(testCheckSnapshot(), testCheckOptions)
+	if want, have := checkPass, report.Result; want != have {
+		t.Errorf("healthy: want %s, have %s: %+v", want, have, report.Checks)
+	}
+	if want, have := len(checks), len(report.Checks); want != have {
+		t.Errorf("want %d checks, have %d", want, have)
+	}
+
+	s := testCheckSnapshot()
+	s.Nodes[1].Info.Version = "0.4.0"
+	if want, have := checkWarn, runChecks(s, testCheckOptions).Result; want != have {
+		t.Errorf("warned: want %s, have %s", want, have)
+	}
+	s.Nodes[2].Error = "connection refused"
+	report = runChecks(s, testCheckOptions)
+	if want, have := checkFail, report.Result; want != have {
+		t.Errorf("failed: want %s, have %s", want, have)
+	}
+
+	var buf bytes.Buffer
+	if err := report.writeTable(&buf); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "check", buf.Bytes())
+}
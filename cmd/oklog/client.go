@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/inflight"
+)
+
+// Defaults for the HTTP clients nodes use to talk to each other, suited to
+// nodes on a LAN: one that takes longer than this to connect, or to answer,
+// is better given up on, and retried, or failed over from.
+const (
+	defaultClientDialTimeout           = 5 * time.Second
+	defaultClientResponseHeaderTimeout = 5 * time.Second
+	defaultClientMaxIdleConnsPerHost   = 16
+	defaultClientKeepAlive             = 30 * time.Second
+	defaultClientIdleConnTimeout       = 90 * time.Second
+)
+
+// clientConfig configures the HTTP clients nodes use to talk to each other:
+// to consume, replicate, repair, query, and stream. Zero timeouts are
+// unlimited. If ops is non-nil, requests are registered there while they're
+// in flight.
+type clientConfig struct {
+	dialTimeout           time.Duration
+	tlsHandshakeTimeout   time.Duration
+	responseHeaderTimeout time.Duration
+	maxIdleConnsPerHost   int
+	keepAlive             time.Duration
+	ops                   *inflight.Registry
+}
+
+func (c clientConfig) validate() error {
+	switch {
+	case c.dialTimeout < 0:
+		return errors.Errorf("invalid -cluster.client-dial-timeout %s", c.dialTimeout)
+	case c.tlsHandshakeTimeout < 0:
+		return errors.Errorf("invalid -cluster.client-tls-handshake-timeout %s", c.tlsHandshakeTimeout)
+	case c.responseHeaderTimeout < 0:
+		return errors.Errorf("invalid -cluster.client-response-header-timeout %s", c.responseHeaderTimeout)
+	case c.maxIdleConnsPerHost < 0:
+		return errors.Errorf("invalid -cluster.client-max-idle-conns-per-host %d", c.maxIdleConnsPerHost)
+	}
+	return nil
+}
+
+// transport returns a transport with the config, which makes requests with
+// TLS, if config is non-nil, and with the auth token, if it isn't empty.
+func (c clientConfig) transport(config *tls.Config, token string) http.RoundTripper {
+	return c.ops.Transport(tokenTransport(tlsTransport(&http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   c.dialTimeout,
+			KeepAlive: c.keepAlive,
+		}).DialContext,
+		TLSHandshakeTimeout:   c.tlsHandshakeTimeout,
+		ResponseHeaderTimeout: c.responseHeaderTimeout,
+		MaxIdleConnsPerHost:   c.maxIdleConnsPerHost,
+		IdleConnTimeout:       defaultClientIdleConnTimeout,
+	}, config), token))
+}
+
+// client returns a client of the transport. It has no overall timeout, only
+// those of the transport, up to the response headers, so it's fine for
+// streams, which are read for as long as they last, and queries, which are
+// bounded by their contexts.
+func (c clientConfig) client(config *tls.Config, token string) *http.Client {
+	return &http.Client{Transport: c.transport(config, token)}
+}
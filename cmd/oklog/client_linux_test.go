@@ -0,0 +1,54 @@
+// +build linux
+
+package main
+
+import (
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClientDialTimeout(t *testing.T) {
+	t.Parallel()
+
+	// A node too busy to accept connections: its listener's backlog is
+	// full, so Linux drops further SYNs, and connecting hangs.
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := (&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: sa.(*syscall.SockaddrInet4).Port}).String()
+	for i := 0; i < 2; i++ {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err != nil {
+			break // the backlog's full already
+		}
+		defer conn.Close()
+	}
+
+	client := clientConfig{dialTimeout: 50 * time.Millisecond}.client(nil, "")
+	begin := time.Now()
+	_, err = client.Get("http://" + addr)
+	if err == nil {
+		t.Fatal("want error, have none")
+	}
+	if want, have := "i/o timeout", err.Error(); !strings.Contains(have, want) {
+		t.Errorf("want %q in %q", want, have)
+	}
+	if took := time.Since(begin); took > 400*time.Millisecond {
+		t.Errorf("timed out after %s", took)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientResponseHeaderTimeout(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client := clientConfig{responseHeaderTimeout: 50 * time.Millisecond}.client(nil, "")
+	begin := time.Now()
+	_, err := client.Get(server.URL)
+	if err == nil {
+		t.Fatal("want error, have none")
+	}
+	if want, have := "timeout awaiting response headers", err.Error(); !strings.Contains(have, want) {
+		t.Errorf("want %q in %q", want, have)
+	}
+	if took := time.Since(begin); took > 400*time.Millisecond {
+		t.Errorf("timed out after %s", took)
+	}
+}
+
+func TestClientStreamOutlivesTimeouts(t *testing.T) {
+	t.Parallel()
+
+	// A stream sends its headers straight away, and records for longer
+	// than any of the timeouts.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 5; i++ {
+			w.Write([]byte("record\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	client := clientConfig{
+		dialTimeout:           20 * time.Millisecond,
+		tlsHandshakeTimeout:   20 * time.Millisecond,
+		responseHeaderTimeout: 20 * time.Millisecond,
+	}.client(nil, "")
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := strings.Repeat("record\n", 5), string(body); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestClientTLSHandshakeTimeout(t *testing.T) {
+	t.Parallel()
+
+	// A node that accepts connections, and never answers.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	client := clientConfig{tlsHandshakeTimeout: 50 * time.Millisecond}.client(&tls.Config{InsecureSkipVerify: true}, "")
+	begin := time.Now()
+	_, err = client.Get("http://" + ln.Addr().String())
+	if err == nil {
+		t.Fatal("want error, have none")
+	}
+	if want, have := "TLS handshake timeout", err.Error(); !strings.Contains(have, want) {
+		t.Errorf("want %q in %q", want, have)
+	}
+	if took := time.Since(begin); took > 400*time.Millisecond {
+		t.Errorf("timed out after %s", took)
+	}
+}
+
+func TestClientReusesConnections(t *testing.T) {
+	t.Parallel()
+
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := clientConfig{maxIdleConnsPerHost: defaultClientMaxIdleConnsPerHost}.client(nil, "")
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if want, have := int32(1), atomic.LoadInt32(&conns); want != have {
+		t.Errorf("want %d connection, have %d", want, have)
+	}
+}
+
+func TestClientConfigValidate(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name   string
+		config clientConfig
+		want   string
+	}{
+		{"defaults", clientConfig{defaultClientDialTimeout, defaultTLSHandshakeTimeout, defaultClientResponseHeaderTimeout, defaultClientMaxIdleConnsPerHost, defaultClientKeepAlive, nil}, ""},
+		{"unlimited", clientConfig{}, ""},
+		{"negative dial timeout", clientConfig{dialTimeout: -time.Second}, "-cluster.client-dial-timeout"},
+		{"negative idle connections", clientConfig{maxIdleConnsPerHost: -1}, "-cluster.client-max-idle-conns-per-host"},
+	} {
+		err := testcase.config.validate()
+		switch {
+		case testcase.want == "" && err != nil:
+			t.Errorf("%s: want no error, have %v", testcase.name, err)
+		case testcase.want != "" && (err == nil || !strings.Contains(err.Error(), testcase.want)):
+			t.Errorf("%s: want error with %q, have %v", testcase.name, testcase.want, err)
+		}
+	}
+}
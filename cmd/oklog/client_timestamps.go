@@ -0,0 +1,29 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/ingest"
+)
+
+// defaultClientTimestampSkew is how far from their arrival times the client
+// timestamps of records may be, either way, by default.
+const defaultClientTimestampSkew = 24 * time.Hour
+
+// newClientTimestamps returns the ClientTimestamps for
+// -ingest.client-timestamps, with their metrics registered with r, or nil,
+// if records get the times they arrive.
+func newClientTimestamps(r prometheus.Registerer, enabled bool, maxSkew time.Duration) *ingest.ClientTimestamps {
+	if !enabled {
+		return nil
+	}
+	rejected := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_client_timestamps_rejected_total",
+		Help:      "Records whose client timestamps were unparseable, or out of the skew window, and which got their arrival times instead.",
+	})
+	r.MustRegister(rejected)
+	return ingest.NewClientTimestamps(maxSkew, rejected)
+}
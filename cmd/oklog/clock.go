@@ -0,0 +1,163 @@
+package main
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/alert"
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/ingest"
+)
+
+const (
+	// defaultClockSkewWarning is how far off ours a peer's clock may be, by
+	// default, before we warn about it.
+	defaultClockSkewWarning = time.Second
+
+	// defaultClockCheckInterval is how often clock offsets are checked.
+	// Memberlist probes a peer every second, round robin, so they're
+	// measured about as often as there are peers.
+	defaultClockCheckInterval = 10 * time.Second
+
+	// defaultMaxClockRegression is how far our clock may go back, by
+	// default, before ingest is refused, rather than given IDs at the time
+	// of the latest.
+	defaultMaxClockRegression = 5 * time.Minute
+)
+
+// newClockGuard returns the ClockGuard for -ingest.max-clock-skew, with its
+// metric registered with r, or nil, if records are accepted regardless of
+// skew.
+func newClockGuard(r prometheus.Registerer, limit time.Duration) *ingest.ClockGuard {
+	if limit <= 0 {
+		return nil
+	}
+	refused := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_clock_skewed_records_total",
+		Help:      "Records refused because this node's clock was skewed from the cluster's.",
+	})
+	r.MustRegister(refused)
+	return ingest.NewClockGuard(limit, refused)
+}
+
+// newIDClock returns the IDClock for -ingest.max-clock-regression, with its
+// metrics registered with r.
+func newIDClock(r prometheus.Registerer, limit time.Duration, logger log.Logger) *ingest.IDClock {
+	var (
+		regressions = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "ingest_clock_regressions_total",
+			Help:      "Times this node's clock went back, while record IDs were held at the time of the latest.",
+		})
+		refused = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "ingest_clock_regressed_records_total",
+			Help:      "Records refused because this node's clock went back too far.",
+		})
+	)
+	r.MustRegister(regressions, refused)
+	return ingest.NewIDClock(limit, regressions, refused, logger)
+}
+
+// registerClockOffset registers the gauge of the largest offset of a peer's
+// clock from ours with r.
+func registerClockOffset(r prometheus.Registerer, peer *cluster.Peer) {
+	r.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "oklog",
+		Name:      "cluster_max_clock_offset_seconds",
+		Help:      "Largest offset of a peer's clock from ours, either way, as of the latest probes.",
+	}, func() float64 {
+		var max time.Duration
+		for _, offset := range peer.ClockOffsets() {
+			if offset < 0 {
+				offset = -offset
+			}
+			if offset > max {
+				max = offset
+			}
+		}
+		return max.Seconds()
+	}))
+}
+
+// watchClockSkew checks the peers' clock offsets every interval, and warns
+// of those further off ours than warning, and of our own, once most peers
+// agree it's off, which raises an alert, on the bus, too. The guard, which
+// may be nil, is told our skew, so ingest is refused while it's over its
+// limit.
+func watchClockSkew(peer *cluster.Peer, warning, interval time.Duration, guard *ingest.ClockGuard, bus *alert.Bus, cancel <-chan struct{}, logger log.Logger) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var (
+		warned  = map[string]bool{} // peers over the warning
+		skewed  bool                // us
+		outside = func(d time.Duration) bool { return d > warning || -d > warning }
+	)
+	for {
+		select {
+		case <-ticker.C:
+		case <-cancel:
+			return nil
+		}
+		offsets := peer.ClockOffsets()
+		for addr, offset := range offsets {
+			switch {
+			case outside(offset) && !warned[addr]:
+				level.Warn(logger).Log("peer", addr, "clock_offset", offset, "msg", "peer's clock is off ours")
+				warned[addr] = true
+			case !outside(offset) && warned[addr]:
+				level.Info(logger).Log("peer", addr, "clock_offset", offset, "msg", "peer's clock is back in line")
+				delete(warned, addr)
+			}
+		}
+		for addr := range warned {
+			if _, ok := offsets[addr]; !ok {
+				delete(warned, addr) // it left
+			}
+		}
+
+		skew, ok := peer.ClockSkew()
+		switch {
+		case ok && outside(skew) && !skewed:
+			level.Warn(logger).Log("clock_skew", skew, "msg", "our clock is off the cluster's")
+			bus.Publish(alert.Event{
+				Type:    alert.ClockSkewed,
+				Message: "our clock is off the cluster's",
+				Details: map[string]string{"skew": skew.String(), "limit": warning.String()},
+			})
+			skewed = true
+		case ok && !outside(skew) && skewed:
+			level.Info(logger).Log("clock_skew", skew, "msg", "our clock is back in line")
+			bus.Publish(alert.Event{
+				Type:     alert.ClockSkewed,
+				Resolved: true,
+				Message:  "our clock is back in line",
+				Details:  map[string]string{"skew": skew.String(), "limit": warning.String()},
+			})
+			skewed = false
+		}
+		if guard != nil {
+			wasSkewed := guard.Skewed()
+			guard.SetSkew(skew) // zero, if we can't tell
+			switch isSkewed := guard.Skewed(); {
+			case isSkewed && !wasSkewed:
+				level.Warn(logger).Log("clock_skew", skew, "msg", "refusing ingest")
+			case !isSkewed && wasSkewed:
+				level.Info(logger).Log("clock_skew", skew, "msg", "accepting ingest again")
+			}
+		}
+	}
+}
+
+// newMonotonicIDs returns the MonotonicIDs for -ingest.monotonic-ids, or nil,
+// if records get the IDs of their connection's stream clock.
+func newMonotonicIDs(enabled bool) *ingest.MonotonicIDs {
+	if !enabled {
+		return nil
+	}
+	return ingest.NewMonotonicIDs(nil)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+const (
+	defaultStoreColdRegion    = "us-east-1"
+	defaultStoreColdCacheSize = 10 * 1024 * 1024 * 1024
+)
+
+// newColdTier returns the ColdTier of -store.cold-url, an S3 bucket, and its
+// prefix, with its cache in the store path, and its metrics registered with
+// r, or nil if target is empty. Credentials are taken from the environment,
+// as AWS tools take them.
+func newColdTier(r prometheus.Registerer, target, endpoint, region string, age, retain time.Duration, cacheSize int64, fsys fs.Filesystem, storePath string, logger log.Logger) (*store.ColdTier, error) {
+	if target == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, errors.Errorf("invalid -store.cold-url %q: want an S3 bucket, and a prefix unique to this node, e.g. s3://bucket/oklog/store-1", target)
+	}
+	if age <= 0 || age >= retain {
+		return nil, errors.Errorf("invalid -store.cold-age %s: want it greater than zero, and less than -store.segment-retain %s", age, retain)
+	}
+	if cacheSize <= 0 {
+		return nil, errors.Errorf("invalid -store.cold-cache-size %d", cacheSize)
+	}
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, errors.New("-store.cold-url needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY set")
+	}
+	var (
+		moved = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "store_cold_uploads_total",
+			Help:      "Segments moved to the cold tier, by success.",
+		}, []string{"success"})
+		fetched = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "store_cold_fetches_total",
+			Help:      "Cold segments read by queries, by result (hit, if cached, miss, or error).",
+		}, []string{"result"})
+		cached = prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "oklog",
+			Name:      "store_cold_cache_bytes",
+			Help:      "Bytes of cold segments cached on disk, for queries.",
+		})
+	)
+	r.MustRegister(moved, fetched, cached)
+	coldStore := store.NewS3ColdStore(
+		endpoint,
+		u.Host,
+		strings.Trim(u.Path, "/"),
+		region,
+		accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN"),
+		http.DefaultClient,
+	)
+	return store.NewColdTier(
+		fsys,
+		storePath,
+		coldStore,
+		cacheSize,
+		moved,
+		fetched,
+		cached,
+		store.LogReporter{Logger: log.With(logger, "component", "ColdTier")},
+	)
+}
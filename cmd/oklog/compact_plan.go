@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/store"
+)
+
+const (
+	defaultCompactScheme = "default"
+	defaultCompactFanout = 4
+	defaultCompactWindow = time.Hour
+)
+
+// newCompactionPlanners returns the planners of the -store.compact-scheme,
+// which compact segments up to targetSize.
+func newCompactionPlanners(scheme string, targetSize int64, fanout int, window time.Duration) ([]store.CompactionPlanner, error) {
+	if targetSize <= 0 {
+		return nil, errors.Errorf("invalid -store.compact-target-size %d", targetSize)
+	}
+	switch strings.ToLower(scheme) {
+	case "default":
+		return store.DefaultCompactionPlanners(targetSize), nil
+	case "size-tiered":
+		if fanout < 2 {
+			return nil, errors.Errorf("invalid -store.compact-fanout %d: it must be at least 2", fanout)
+		}
+		return []store.CompactionPlanner{store.NewSizeTieredPlanner(fanout, targetSize)}, nil
+	case "time-window":
+		if window < time.Millisecond {
+			return nil, errors.Errorf("invalid -store.compact-window %s: it must be at least 1ms", window)
+		}
+		return []store.CompactionPlanner{store.NewTimeWindowPlanner(window, targetSize)}, nil
+	default:
+		return nil, errors.Errorf("invalid -store.compact-scheme %q: want default, size-tiered, or time-window", scheme)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/oklog/oklog/pkg/inflight"
+)
+
+// defaultDebugPort is the port of -debug-addr, if it's given without one.
+const defaultDebugPort = 7655
+
+// listenDebug binds the listener of -debug-addr, or returns nil, if it's
+// empty, i.e. there are no debug endpoints.
+func listenDebug(addr string, logger log.Logger) (net.Listener, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	network, address, _, _, err := parseAddr(addr, defaultDebugPort)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	level.Info(logger).Log("debug", fmt.Sprintf("%s://%s", network, address))
+	return ln, nil
+}
+
+// debugHandler serves the debug endpoints: profiles, expvars, and the
+// operations in flight, at /debug/requests. They're served without TLS, or
+// the auth token, so the listener should be reachable only by operators,
+// e.g. on localhost.
+func debugHandler(ops *inflight.Registry) http.Handler {
+	mux := http.NewServeMux()
+	registerProfile(mux)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/debug/requests", ops)
+	return mux
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oklog/oklog/pkg/inflight"
+)
+
+func TestDebugHandler(t *testing.T) {
+	t.Parallel()
+
+	ops := inflight.NewRegistry()
+	server := httptest.NewServer(debugHandler(ops))
+	defer server.Close()
+
+	// Requests made by node clients are listed while they're in flight.
+	client := clientConfig{ops: ops}.client(nil, "")
+	resp, err := client.Get(server.URL + "/debug/requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want, have := "GET "+server.URL+"/debug/requests", string(body); !strings.Contains(have, want) {
+		t.Errorf("want %q in %s", want, have)
+	}
+
+	for path, want := range map[string]string{
+		"/debug/vars":   `"memstats"`,
+		"/debug/pprof/": "goroutine",
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: HTTP %d", path, resp.StatusCode)
+		}
+		if !strings.Contains(string(body), want) {
+			t.Errorf("%s: want %q in the response", path, want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// newDeduper returns the deduper for -store.dedup-window, with its metrics
+// registered with r, or nil, if the window isn't positive, i.e. records
+// aren't deduplicated.
+func newDeduper(r prometheus.Registerer, window time.Duration) *store.Deduper {
+	if window <= 0 {
+		return nil
+	}
+	dropped := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "store_consumed_duplicate_records_total",
+		Help:      "Records dropped by consumers, as they were consumed before, within -store.dedup-window.",
+	})
+	r.MustRegister(dropped)
+	return store.NewDeduper(window, dropped)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// devFlags are the ingeststore flags of oklog dev: a single node, listening
+// only on localhost, with everything under one data directory, small
+// segments that are queryable within a couple of seconds, a short retention,
+// and debug logs. They come ahead of the user's, which override them.
+var devFlags = []string{
+	"-single-node",
+	"-api", fmt.Sprintf("tcp://127.0.0.1:%d", defaultAPIPort),
+	"-ingest.fast", fmt.Sprintf("tcp://127.0.0.1:%d", defaultFastPort),
+	"-ingest.durable", fmt.Sprintf("tcp://127.0.0.1:%d", defaultDurablePort),
+	"-ingest.bulk", fmt.Sprintf("tcp://127.0.0.1:%d", defaultBulkPort),
+	"-ingest.path", filepath.Join("data", "dev", "ingest"),
+	"-ingest.segment-flush-size", "65536",
+	"-ingest.segment-flush-age", "500ms",
+	"-store.path", filepath.Join("data", "dev", "store"),
+	"-store.replication-factor", "1",
+	"-store.segment-target-size", "1048576",
+	"-store.segment-target-age", "500ms",
+	"-store.segment-delay", "10ms",
+	"-store.segment-retain", "24h",
+	"-store.segment-purge", "1m",
+	"-store.drain-grace-period", "1s",
+	"-log.level", "debug",
+}
+
+// runDev runs an ingeststore with devFlags, for a local dev environment in one
+// process. Its metrics are registered with a registry of its own, rather than
+// the default, so it can be run more than once in a process, as by the tests,
+// without registering them twice. They're served along with the default's,
+// as forward serves its own.
+func runDev(args []string) error {
+	registry := prometheus.NewRegistry()
+	return runIngestStore(
+		append(append([]string(nil), devFlags...), args...),
+		registry, prometheus.Gatherers{prometheus.DefaultGatherer, registry},
+	)
+}
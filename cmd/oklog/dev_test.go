@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/oklog/pkg/store"
+)
+
+func TestDev(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oklog-dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var (
+		apiAddr     = fmt.Sprintf("127.0.0.1:%d", freePort(t))
+		durableAddr = fmt.Sprintf("127.0.0.1:%d", freePort(t))
+		exited      = make(chan error, 1)
+	)
+	go func() {
+		exited <- runDev([]string{
+			"-api", "tcp://" + apiAddr,
+			"-ingest.fast", fmt.Sprintf("tcp://127.0.0.1:%d", freePort(t)),
+			"-ingest.durable", "tcp://" + durableAddr,
+			"-ingest.bulk", fmt.Sprintf("tcp://127.0.0.1:%d", freePort(t)),
+			"-ingest.path", filepath.Join(dir, "ingest"),
+			"-store.path", filepath.Join(dir, "store"),
+			"-store.drain-grace-period", "10ms",
+			"-log.level", "error",
+		})
+	}()
+
+	// Write through the ingest port, once it's up.
+	var conn net.Conn
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if conn, err = net.Dial("tcp", durableAddr); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ingest never came up: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(conn, "hello dev %d\n", i)
+	}
+	conn.Close()
+
+	// And read it back through the query endpoint, once it's been consumed.
+	query := fmt.Sprintf("http://%s/store%s?from=%s&to=%s&q=hello", apiAddr, store.APIPathUserQuery, url.QueryEscape("now-1h"), url.QueryEscape("now"))
+	var have string
+	for deadline := time.Now().Add(20 * time.Second); !strings.Contains(have, "hello dev 2"); time.Sleep(100 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("records never queryable; last query had %q", have)
+		}
+		resp, err := http.Get(query)
+		if err != nil {
+			continue
+		}
+		buf, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		have = string(buf)
+	}
+	for i := 0; i < 3; i++ {
+		if want := fmt.Sprintf(" hello dev %d\n", i); strings.Count(have, want) != 1 {
+			t.Errorf("want %q once, have\n%s", want, have)
+		}
+	}
+
+	// Draining stops it.
+	resp, err := http.Post(fmt.Sprintf("http://%s/admin/drain", apiAddr), "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	select {
+	case <-exited:
+	case <-time.After(10 * time.Second):
+		t.Fatal("still running after drain")
+	}
+}
+
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
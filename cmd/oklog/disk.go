@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/oklog/oklog/pkg/alert"
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// publishDiskUsage returns a DiskMonitor publish func, which gossips the disk
+// usage of the store log to the cluster, and tells the API and consumers its
+// level, so they can stop taking segments as the disk fills up. Changes of
+// level raise alerts, on the bus, of the path.
+func publishDiskUsage(peer *cluster.Peer, api *store.API, consumers []*store.Consumer, bus *alert.Bus, path string) func(store.DiskUsage) {
+	last := store.DiskOK
+	return func(u store.DiskUsage) {
+		if u.Level != last {
+			bus.Publish(alert.Event{
+				Type:     alert.DiskWatermark,
+				Resolved: u.Level == store.DiskOK,
+				Message:  fmt.Sprintf("store disk usage went from %s to %s", last, u.Level),
+				Details: map[string]string{
+					"path":            path,
+					"level":           u.Level.String(),
+					"available_bytes": fmt.Sprint(u.AvailableBytes),
+					"capacity_bytes":  fmt.Sprint(u.CapacityBytes),
+				},
+			})
+			last = u.Level
+		}
+		peer.SetCapacity(cluster.Capacity{
+			SegmentBytes:   u.SegmentBytes,
+			TrashBytes:     u.TrashBytes,
+			CapacityBytes:  u.CapacityBytes,
+			AvailableBytes: u.AvailableBytes,
+		})
+		api.SetDiskLevel(u.Level)
+		for _, c := range consumers {
+			c.SetDiskLevel(u.Level)
+		}
+	}
+}
+
+// holdIngestOnLowDisk checks the filesystem of the ingest path every interval,
+// and holds the limiter while at least critical, a fraction, of its capacity
+// is used. Connections aren't read from while it's held, which pushes back on
+// forwarders, rather than failing their writes. Holding and releasing it raise
+// alerts, on the bus. The limiter is released when cancel is closed, so
+// connections can be shut down.
+func holdIngestOnLowDisk(filesys fs.Filesystem, path string, critical float64, interval time.Duration, limiter *ingest.Limiter, bus *alert.Bus, cancel <-chan struct{}, logger log.Logger) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer limiter.Hold(false)
+	var held bool
+	for {
+		switch u, err := filesys.Statfs(path); {
+		case err == fs.ErrStatfsUnsupported:
+			level.Info(logger).Log("disk", "statfs unsupported, not checking")
+			<-cancel
+			return nil
+		case err != nil:
+			level.Warn(logger).Log("disk", "statfs", "err", err)
+		case u.Capacity > 0:
+			hold := 1-float64(u.Available)/float64(u.Capacity) >= critical
+			switch {
+			case hold:
+				level.Warn(logger).Log("disk", "critical", "available_bytes", u.Available, "capacity_bytes", u.Capacity, "msg", "holding ingest connections")
+			case held:
+				level.Info(logger).Log("disk", "ok", "available_bytes", u.Available, "capacity_bytes", u.Capacity, "msg", "releasing ingest connections")
+			}
+			if hold != held {
+				message := "ingest disk usage is over the critical watermark, so ingest connections are held"
+				if !hold {
+					message = "ingest disk usage is under the critical watermark again, so ingest connections are released"
+				}
+				bus.Publish(alert.Event{
+					Type:     alert.DiskWatermark,
+					Resolved: !hold,
+					Message:  message,
+					Details: map[string]string{
+						"path":            path,
+						"level":           "critical",
+						"available_bytes": fmt.Sprint(u.Available),
+						"capacity_bytes":  fmt.Sprint(u.Capacity),
+					},
+				})
+			}
+			limiter.Hold(hold)
+			held = hold
+		}
+		select {
+		case <-ticker.C:
+		case <-cancel:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/cluster"
+)
+
+// readGossipKeys reads the base64 gossip encryption keys from filename, one
+// per line, the first of which is primary. Blank lines, and lines that start
+// with #, are ignored. If filename is empty, there are no keys, i.e. gossip
+// isn't encrypted.
+func readGossipKeys(filename string) ([][]byte, error) {
+	return readKeyFile(filename, "gossip encryption keys")
+}
+
+// readKeyFile reads base64 keys from filename, like readGossipKeys. What they
+// are is for errors.
+func readKeyFile(filename, what string) ([][]byte, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", what)
+	}
+	var keys [][]byte
+	for i, line := range strings.Split(string(buf), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s:%d", filename, i+1)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.Errorf("%s: no %s", filename, what)
+	}
+	return keys, nil
+}
+
+// reloadGossipKeys reloads the gossip encryption keys on SIGHUP, until
+// canceled. If they can't be loaded, the last keys are kept.
+func reloadGossipKeys(peer *cluster.Peer, filename string, cancel <-chan struct{}, logger log.Logger) error {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+	for {
+		select {
+		case <-c:
+			keys, err := readGossipKeys(filename)
+			if err == nil {
+				err = peer.SetKeys(keys)
+			}
+			if err != nil {
+				level.Warn(logger).Log("encrypt_keys", "reload", "err", err)
+				continue
+			}
+			level.Info(logger).Log("encrypt_keys", "reload", "n", len(keys))
+		case <-cancel:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadGossipKeys(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "oklog-encrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, testcase := range []struct {
+		name     string
+		contents string
+		want     [][]byte
+		err      bool
+	}{
+		{"one key", "MDEyMzQ1Njc4OWFiY2RlZg==\n", [][]byte{[]byte("0123456789abcdef")}, false},
+		{"primary first", "# rotating\nZmVkY2JhOTg3NjU0MzIxMA==\n\nMDEyMzQ1Njc4OWFiY2RlZg==\n", [][]byte{[]byte("fedcba9876543210"), []byte("0123456789abcdef")}, false},
+		{"not base64", "not base64!\n", nil, true},
+		{"empty", "# nothing here\n", nil, true},
+	} {
+		filename := filepath.Join(dir, testcase.name)
+		if err := ioutil.WriteFile(filename, []byte(testcase.contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		have, err := readGossipKeys(filename)
+		if want, have := testcase.err, err != nil; want != have {
+			t.Errorf("%s: want error %v, have %v", testcase.name, want, err)
+			continue
+		}
+		if want := testcase.want; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+	}
+
+	// No file, no keys, no encryption.
+	if keys, err := readGossipKeys(""); err != nil || keys != nil {
+		t.Errorf("no file: want no keys, have %q, %v", keys, err)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// Exported segments are named for the segment, with extExport, once they're
+// complete and verified. Until then, they're partial, named for the checksum
+// of the replica being downloaded, too, so a download is only resumed from
+// the replica it began with.
+const (
+	extExport  = ".segment"
+	extPartial = ".partial"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func runExport(args []string) error {
+	flagset := flag.NewFlagSet("export", flag.ExitOnError)
+	var (
+		storeAddr = flagset.String("store", "localhost:7650", "address of store instance to list segments with")
+		from      = flagset.String("from", "24h", "from, as RFC3339 timestamp, unix epoch seconds or milliseconds, ULID, or duration ago")
+		to        = flagset.String("to", "now", "to, as RFC3339 timestamp, unix epoch seconds or milliseconds, ULID, or duration ago")
+		dir       = flagset.String("dir", "", "directory to download segments to (required)")
+		verbose   = flagset.Bool("v", false, "verbose output to stderr")
+		useTLS    = flagset.Bool("tls", false, "connect to the stores with TLS")
+		tlsCA     = flagset.String("tls.ca", "", "CA certificates to verify the stores with (default system)")
+		tlsCert   = flagset.String("tls.cert", "", "client certificate to present, for mutual TLS")
+		tlsKey    = flagset.String("tls.key", "", "client certificate's private key")
+		authFile  = flagset.String("auth-token-file", "", "file holding the stores' auth token, if they require one")
+	)
+	flagset.Usage = usageFor(flagset, "oklog export -dir <directory> [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return errors.New("-dir is required")
+	}
+
+	_, hostport, _, _, err := parseAddr(*storeAddr, defaultAPIPort)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse -store")
+	}
+	tlsConfig, err := toolTLSConfig(*useTLS, *tlsCA, *tlsCert, *tlsKey)
+	if err != nil {
+		return err
+	}
+	authToken, err := readAuthToken(*authFile)
+	if err != nil {
+		return err
+	}
+	client, scheme := toolClient(tlsConfig, authToken)
+
+	now := time.Now()
+	fromStr, err := parseQueryTime(*from, now)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse -from")
+	}
+	toStr, err := parseQueryTime(*to, now)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse -to")
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+
+	e := &exporter{client: client, scheme: scheme, dir: *dir, verbosef: func(string, ...interface{}) {}}
+	if *verbose {
+		e.verbosef = func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, format, args...)
+		}
+	}
+	return e.export(hostport, fromStr, toStr)
+}
+
+// exporter downloads one replica of each sealed segment of a cluster.
+type exporter struct {
+	client   *http.Client
+	scheme   string
+	dir      string
+	verbosef func(format string, args ...interface{})
+}
+
+// export the segments with records from one time to another, as listed by the
+// store node at hostport. Segments already exported are skipped, and partial
+// downloads are resumed. If a replica fails, the next is tried.
+func (e *exporter) export(hostport, from, to string) error {
+	segments, errorCount, err := e.list(hostport, from, to)
+	if err != nil {
+		return err
+	}
+	if errorCount > 0 {
+		fmt.Fprintf(os.Stderr, "%d store node(s) failed to list their segments; the export may be incomplete\n", errorCount)
+	}
+
+	var exported, skipped, failed int
+	for _, s := range segments {
+		if _, err := os.Stat(filepath.Join(e.dir, s.Segment+extExport)); err == nil {
+			skipped++
+			continue
+		}
+		if err := e.exportSegment(s); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", s.Segment, err)
+			failed++
+			continue
+		}
+		exported++
+	}
+	e.verbosef("%d segment(s) exported, %d already exported, %d failed\n", exported, skipped, failed)
+	if failed > 0 {
+		return errors.Errorf("%d of %d segment(s) failed to export", failed, len(segments))
+	}
+	return nil
+}
+
+// list the segments of the cluster, and count the nodes that failed to list
+// theirs.
+func (e *exporter) list(hostport, from, to string) ([]store.ListedSegment, int, error) {
+	u := fmt.Sprintf(
+		"%s://%s/store%s?from=%s&to=%s",
+		e.scheme,
+		hostport,
+		store.APIPathUserSegments,
+		url.QueryEscape(from),
+		url.QueryEscape(to),
+	)
+	e.verbosef("GET %s\n", u)
+	resp, err := e.client.Get(u)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		buf, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, 0, errors.Errorf("GET %s: %s: %s", u, resp.Status, strings.TrimSpace(string(buf)))
+	}
+	var segments []store.ListedSegment
+	if err := json.NewDecoder(resp.Body).Decode(&segments); err != nil {
+		return nil, 0, errors.Wrap(err, "decoding segments")
+	}
+	errorCount, _ := strconv.Atoi(resp.Header.Get("X-Oklog-Error-Count"))
+	return segments, errorCount, nil
+}
+
+// exportSegment downloads a replica of the segment, preferring one that was
+// partially downloaded before.
+func (e *exporter) exportSegment(s store.ListedSegment) error {
+	replicas := append([]store.SegmentReplica(nil), s.Replicas...)
+	sort.SliceStable(replicas, func(i, j int) bool {
+		return e.hasPartial(s, replicas[i]) && !e.hasPartial(s, replicas[j])
+	})
+	var errs []string
+	for _, replica := range replicas {
+		err := e.download(s, replica)
+		if err == nil {
+			e.removePartials(s)
+			return nil
+		}
+		e.verbosef("%s from %s: %v\n", s.Segment, replica.Node, err)
+		errs = append(errs, fmt.Sprintf("%s: %v", replica.Node, err))
+	}
+	return errors.Errorf("no replica could be downloaded (%s)", strings.Join(errs, "; "))
+}
+
+func (e *exporter) partialPath(s store.ListedSegment, replica store.SegmentReplica) string {
+	return filepath.Join(e.dir, fmt.Sprintf("%s.%08x%s", s.Segment, replica.Checksum, extPartial))
+}
+
+func (e *exporter) hasPartial(s store.ListedSegment, replica store.SegmentReplica) bool {
+	_, err := os.Stat(e.partialPath(s, replica))
+	return err == nil
+}
+
+// removePartials of other replicas of the segment, which failed.
+func (e *exporter) removePartials(s store.ListedSegment) {
+	matches, _ := filepath.Glob(filepath.Join(e.dir, s.Segment+".*"+extPartial))
+	for _, match := range matches {
+		os.Remove(match)
+	}
+}
+
+// download the replica of the segment, resuming a partial download of it,
+// and verify it, before renaming it to its exported name. A partial download
+// that fails verification is removed.
+func (e *exporter) download(s store.ListedSegment, replica store.SegmentReplica) error {
+	partial := e.partialPath(s, replica)
+	f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	off, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if off > replica.Size {
+		if err := truncate(f); err != nil {
+			return err
+		}
+		off = 0
+	}
+
+	if off < replica.Size {
+		u := fmt.Sprintf("%s://%s/store%s%s", e.scheme, replica.Node, store.APIPathSegment, url.PathEscape(s.Segment))
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return err
+		}
+		if off > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", off))
+		}
+		e.verbosef("GET %s (from byte %d)\n", u, off)
+		resp, err := e.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusPartialContent && strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", off)):
+			// resumed
+		case resp.StatusCode == http.StatusOK:
+			if err := truncate(f); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("GET %s: %s", u, resp.Status)
+		}
+		if _, err := io.Copy(f, resp.Body); err != nil {
+			return errors.Wrap(err, "downloading") // keep what we have, to resume
+		}
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	h := crc32.New(castagnoli)
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if n != replica.Size || h.Sum32() != replica.Checksum {
+		f.Close()
+		os.Remove(partial)
+		return errors.Errorf("downloaded %d bytes with checksum %08x, want %d bytes with checksum %08x", n, h.Sum32(), replica.Size, replica.Checksum)
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partial, filepath.Join(e.dir, s.Segment+extExport))
+}
+
+// truncate the file, to write it again from the start.
+func truncate(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
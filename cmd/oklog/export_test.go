@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+
+	// Three store nodes, the last of which compresses its compacted segments,
+	// and the first of which fails to serve them. Each segment is replicated
+	// to two, or, on the last, written as compaction would.
+	var (
+		peer      = &hostsPeer{}
+		apis      []*store.API
+		logs      []store.Log
+		downloads int32
+		resumed   int32
+	)
+	for i := 0; i < 3; i++ {
+		filelog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, store.FileLogConfig{Compress: i == 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+			replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
+			duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+			failing            = i == 0
+			api                = store.NewAPI(peer, filelog, store.APIConfig{
+				QueryClient:        http.DefaultClient,
+				StreamClient:       http.DefaultClient,
+				ReplicatedSegments: replicatedSegments,
+				ReplicatedBytes:    replicatedBytes,
+				Duration:           duration,
+				Reporter:           store.LogReporter{Logger: log.NewNopLogger()},
+			})
+		)
+		defer api.Close()
+		server := httptest.NewServer(http.StripPrefix("/store", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, store.APIPathSegment) {
+				if failing {
+					http.Error(w, "nope", http.StatusInternalServerError)
+					return
+				}
+				atomic.AddInt32(&downloads, 1)
+				if r.Header.Get("Range") != "" {
+					atomic.AddInt32(&resumed, 1)
+				}
+			}
+			api.ServeHTTP(w, r)
+		})))
+		defer server.Close()
+		apis = append(apis, api)
+		logs = append(logs, filelog)
+		peer.hostports = append(peer.hostports, strings.TrimPrefix(server.URL, "http://"))
+	}
+
+	var want []string
+	t0 := time.Now().Add(-time.Hour)
+	for i := 0; i < 6; i++ {
+		var (
+			segment string
+			ids     []ulid.ULID
+		)
+		for j := 0; j < 3; j++ {
+			id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(3*i+j)*time.Second)), rand.Reader)
+			record := fmt.Sprintf("%s segment %d record %d\n", id, i, j)
+			ids = append(ids, id)
+			segment += record
+			want = append(want, record)
+		}
+		for _, n := range []int{i % 3, (i + 1) % 3} {
+			if n == 2 {
+				writeCompacted(t, logs[n], segment, ids[0], ids[len(ids)-1])
+				continue
+			}
+			w := httptest.NewRecorder()
+			apis[n].ServeHTTP(w, httptest.NewRequest("POST", store.APIPathReplicate, strings.NewReader(segment)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+			}
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "oklog-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	e := &exporter{client: http.DefaultClient, scheme: "http", dir: dir, verbosef: t.Logf}
+	now := time.Now()
+	from, _ := parseQueryTime("2h", now)
+	to, _ := parseQueryTime("now", now)
+
+	// Every segment is listed once, with both of its replicas.
+	segments, errorCount, err := e.list(peer.hostports[1], from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 0, errorCount; want != have {
+		t.Errorf("error count: want %d, have %d", want, have)
+	}
+	if want, have := 6, len(segments); want != have {
+		t.Fatalf("segments: want %d, have %d", want, have)
+	}
+	for _, s := range segments {
+		if want, have := 2, len(s.Replicas); want != have {
+			t.Errorf("%s: replicas: want %d, have %d", s.Segment, want, have)
+		}
+	}
+
+	// Half of a segment was downloaded before, from a node that serves it.
+	var (
+		s       = segments[1] // on nodes 1 and 2
+		replica = s.Replicas[0]
+	)
+	if replica.Node == peer.hostports[0] {
+		replica = s.Replicas[1]
+	}
+	resp, err := http.Get(fmt.Sprintf("http://%s/store%s%s", replica.Node, store.APIPathSegment, s.Segment))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err := ioutil.WriteFile(e.partialPath(s, replica), buf[:len(buf)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&downloads, 0)
+
+	if err := e.export(peer.hostports[1], from, to); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := int32(6), atomic.LoadInt32(&downloads); want != have {
+		t.Errorf("downloads: want %d, have %d", want, have)
+	}
+	if want, have := int32(1), atomic.LoadInt32(&resumed); want != have {
+		t.Errorf("resumed downloads: want %d, have %d", want, have)
+	}
+
+	// The export has every record exactly once, and nothing partial.
+	var have []string
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	for _, file := range files {
+		if filepath.Ext(file) != extExport {
+			t.Errorf("%s: not exported", filepath.Base(file))
+			continue
+		}
+		have = append(have, readExported(t, file)...)
+	}
+	sort.Strings(have)
+	if want, have := strings.Join(want, ""), strings.Join(have, ""); want != have {
+		t.Errorf("want\n%s\nhave\n%s", want, have)
+	}
+
+	// Exporting again downloads nothing.
+	atomic.StoreInt32(&downloads, 0)
+	if err := e.export(peer.hostports[2], from, to); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := int32(0), atomic.LoadInt32(&downloads); want != have {
+		t.Errorf("downloads: want %d, have %d", want, have)
+	}
+}
+
+// writeCompacted writes the records to a new segment of the log, as
+// compaction would, so it's compressed, if the log compresses them.
+func writeCompacted(t *testing.T, filelog store.Log, records string, low, high ulid.ULID) {
+	segment, err := filelog.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	segment.SetCompacted()
+	if _, err := io.WriteString(segment, records); err != nil {
+		t.Fatal(err)
+	}
+	if err := segment.Close(low, high); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readExported returns the records of an exported segment, decompressing it
+// if necessary.
+func readExported(t *testing.T, file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := store.DecompressSegment(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var records []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		records = append(records, s.Text()+"\n")
+	}
+	return records
+}
+
+type hostsPeer struct{ hostports []string }
+
+func (p *hostsPeer) Current(cluster.PeerType) []string        { return p.hostports }
+func (p *hostsPeer) Zones(cluster.PeerType) map[string]string { return map[string]string{} }
+func (p *hostsPeer) State() map[string]interface{}            { return map[string]interface{}{} }
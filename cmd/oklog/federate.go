@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/federate"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/stream"
+	"github.com/oklog/ulid"
+)
+
+// newCoordinator returns a Coordinator of the clusters of -cluster flags, each
+// name=host:port, whose port defaults to the API port.
+func newCoordinator(flags []string, client *http.Client, scheme string) (*federate.Coordinator, error) {
+	clusters := make([]federate.Cluster, len(flags))
+	for i, s := range flags {
+		c, err := federate.ParseCluster(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't parse -cluster")
+		}
+		_, hostport, _, _, err := parseAddr(c.Addr, defaultAPIPort)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't parse -cluster %s", s)
+		}
+		clusters[i] = federate.Cluster{Name: c.Name, Addr: hostport}
+	}
+	coordinator, err := federate.NewCoordinator(clusters, client, scheme)
+	return coordinator, errors.Wrap(err, "couldn't parse -cluster")
+}
+
+// queryClusters runs a federated query of the clusters of -cluster flags, and
+// writes their merged records to out, formatted, and a warning for each
+// cluster that failed to stderr. It fails only if every cluster did.
+func queryClusters(
+	ctx context.Context,
+	out *cancelingWriter,
+	stderr io.Writer,
+	flags []string,
+	client *http.Client,
+	scheme string,
+	params url.Values,
+	label bool,
+	f recordFormat,
+	verbosePrintf func(string, ...interface{}),
+) error {
+	coordinator, err := newCoordinator(flags, client, scheme)
+	if err != nil {
+		return err
+	}
+	begin := time.Now()
+	verbosePrintf("GET /store/query?%s of %d cluster(s)\n", params.Encode(), len(flags))
+	result := coordinator.Query(ctx, params, label)
+	defer result.Records.Close()
+	_, copyErr := f.copy(out, result.Records)
+	if out.err != nil {
+		return errors.Wrap(out.err, "writing records")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if copyErr != nil {
+		return errors.Wrap(copyErr, "reading records")
+	}
+
+	verbosePrintf("Response in %s\n", time.Since(begin))
+	for _, c := range result.Clusters {
+		if c.Err != nil {
+			fmt.Fprintf(stderr, "WARNING: cluster %s (%s) failed, so its records are missing: %v\n", c.Cluster.Name, c.Cluster.Addr, c.Err)
+			continue
+		}
+		verbosePrintf("cluster %s: %d node(s), %d segment(s) queried, %d error(s), %s server-reported duration\n",
+			c.Cluster.Name, c.Result.NodesQueried, c.Result.SegmentsQueried, c.Result.ErrorCount, c.Result.Duration)
+		if c.Result.Truncated != "" {
+			fmt.Fprintf(stderr, "WARNING: cluster %s results truncated at its store's %s limit (see -store.query-max-%s)\n", c.Cluster.Name, c.Result.Truncated, c.Result.Truncated)
+		}
+	}
+	if n := result.Failed(); n == len(result.Clusters) {
+		return errors.Errorf("all %d clusters failed", n)
+	}
+	return nil
+}
+
+// streamClusters streams the records of the clusters of -cluster flags, merged,
+// to stdout, printing each from the offset of its line, and their failed
+// connections, which are retried, to stderr, as comments, until it's
+// interrupted.
+func streamClusters(
+	stdout, stderr io.Writer,
+	flags []string,
+	client *http.Client,
+	scheme string,
+	params url.Values,
+	window time.Duration,
+	label bool,
+	offset int,
+) error {
+	coordinator, err := newCoordinator(flags, client, scheme)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancelInterrupt := make(chan struct{})
+	defer close(cancelInterrupt)
+	interrupted := make(chan error, 1)
+	go func() {
+		interrupted <- interrupt(cancelInterrupt)
+		cancel()
+	}()
+
+	records, errs := coordinator.Stream(ctx, params, window, label, stream.DefaultBackoffPolicy)
+	for records != nil || errs != nil {
+		select {
+		case b, ok := <-records:
+			if !ok {
+				records = nil
+				continue
+			}
+			if len(b) <= ulid.EncodedSize {
+				continue // not a record
+			}
+			fmt.Fprintf(stdout, "%s%s\n", b[offset:ulid.EncodedSize+1], record.Unescape(b[ulid.EncodedSize+1:]))
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			if e, ok := err.(stream.PeerError); ok {
+				fmt.Fprintf(stderr, "# %s cluster error: %s\n", e.Time.UTC().Format(time.RFC3339), e.Error())
+				continue
+			}
+			return err
+		}
+	}
+	return <-interrupted
+}
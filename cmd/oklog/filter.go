@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/ingest"
+)
+
+// readFilterRules reads the ingest filter rules from filename; see
+// ingest.ParseFilterRules.
+func readFilterRules(filename string) ([]ingest.FilterRule, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading ingest filter rules")
+	}
+	defer f.Close()
+	rules, err := ingest.ParseFilterRules(f)
+	if err != nil {
+		return nil, errors.Wrap(err, filename)
+	}
+	return rules, nil
+}
+
+// newFilter returns the Filter of the rules in filename, with its metric
+// registered with r, or nil if it's empty, i.e. every record is kept.
+func newFilter(r prometheus.Registerer, filename string) (*ingest.Filter, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	rules, err := readFilterRules(filename)
+	if err != nil {
+		return nil, err
+	}
+	records := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_filter_records_total",
+		Help:      "Records each rule of -ingest.filter-file matched, by whether it kept or dropped them.",
+	}, []string{"rule", "result"})
+	r.MustRegister(records)
+	return ingest.NewFilter(rules, records), nil
+}
+
+// reloadFilter reloads the ingest filter rules on SIGHUP, until canceled. If
+// they can't be loaded, the last rules are kept.
+func reloadFilter(filter *ingest.Filter, filename string, cancel <-chan struct{}, logger log.Logger) error {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+	for {
+		select {
+		case <-c:
+			rules, err := readFilterRules(filename)
+			if err != nil {
+				level.Warn(logger).Log("filter", "reload", "err", err)
+				continue
+			}
+			filter.Set(rules)
+			level.Info(logger).Log("filter", "reload", "rules", len(rules))
+		case <-cancel:
+			return nil
+		}
+	}
+}
@@ -2,30 +2,113 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
 	"flag"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/oklog/oklog/pkg/forward"
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/spool"
+)
+
+const (
+	defaultForwardAckTimeout  = 10 * time.Second
+	defaultForwardAckWindow   = 1024
+	defaultForwardBatchWait   = 100 * time.Millisecond
+	defaultForwardBufferSize  = 256 * 1024 * 1024
+	defaultForwardFilePoll    = 250 * time.Millisecond
+	defaultForwardHelloWait   = 5 * time.Second
+	defaultForwardMirrorQueue = 1024
+	defaultForwardQuotaWait   = time.Minute
+	defaultForwardRebalance   = 10 * time.Minute
+	defaultForwardSnappyBytes = 64 * 1024
+	defaultForwardSnappyWait  = 100 * time.Millisecond
+	defaultMultilineMaxLines  = 500
+	defaultMultilineMaxWait   = time.Second
+	defaultMultilineSeparator = " "
+)
+
+const (
+	mirrorPolicyBlock = "block"
+	mirrorPolicyDrop  = "drop"
 )
 
+const (
+	framingNewline        = "newline"
+	framingLengthPrefixed = "length-prefixed"
+)
+
+var defaultForwardFileState = filepath.Join("data", "forward.state")
+
 func runForward(args []string) error {
 	flagset := flag.NewFlagSet("forward", flag.ExitOnError)
 	var (
-		debug    = flagset.Bool("debug", false, "debug logging")
-		apiAddr  = flagset.String("api", "", "listen address for forward API (and metrics)")
-		prefixes = stringslice{}
+		debug       = flagset.Bool("debug", false, "debug logging, i.e. -log.level=debug")
+		logFormat   = flagset.String("log.format", defaultLogFormat, "log format: logfmt or json")
+		logLevel    = flagset.String("log.level", defaultLogLevel, "log level: debug, info, warn, or error")
+		apiAddr     = flagset.String("api", "", "listen address for forward API (and metrics)")
+		useTLS      = flagset.Bool("tls", false, "connect to ingest nodes with TLS")
+		tlsCA       = flagset.String("tls.ca", "", "CA certificates to verify ingest nodes with (default system)")
+		tlsCert     = flagset.String("tls.cert", "", "client certificate to present, for mutual TLS")
+		tlsKey      = flagset.String("tls.key", "", "client certificate's private key")
+		bufferDir   = flagset.String("forward.buffer-dir", "", "spool records here while no ingest node is reachable (default none)")
+		bufferSize  = flagset.Int64("forward.buffer-size", defaultForwardBufferSize, "with -forward.buffer-dir, evict the oldest spooled records past this size")
+		takeover    = flagset.Bool("forward.buffer-takeover", false, "with -forward.buffer-dir, break its lock if the forwarder that holds it has died")
+		prefixHost  = flagset.Bool("forward.prefix-hostname", false, "prefix each log record with this host's name")
+		prefixTime  = flagset.Bool("forward.prefix-timestamp", false, "prefix each log record with the time it's forwarded (RFC3339, UTC)")
+		clientTime  = flagset.Bool("forward.client-timestamps", false, "prefix each log record with the time it's read, for ingest nodes with -ingest.client-timestamps (unix epoch milliseconds)")
+		separator   = flagset.String("forward.prefix-separator", " ", "separator between prefixes, and before the log record")
+		topic       = flagset.String("forward.topic", "", "send each record with this topic, for ingest nodes with dynamic topics; with -forward.topic-pattern, the topic of records it doesn't match (default \"default\")")
+		topicRegex  = flagset.String("forward.topic-pattern", "", "send each record with the topic its first capture group of this regex matches, e.g. 'service=(\\w+)' (default none)")
+		fileState   = flagset.String("file.state", defaultForwardFileState, "with -file, where to save the offsets of tailed files")
+		filePoll    = flagset.Duration("file.poll-interval", defaultForwardFilePoll, "with -file, how often to check files for new records")
+		metricsAddr = flagset.String("forward.metrics-addr", "", "listen address for just the forwarder's metrics (default none)")
+		sourceID    = flagset.String("forward.source-id", "", "identify this forwarder's records to ingesters as from this source, for their -ingest.quota-file")
+		acks        = flagset.Bool("forward.acks", false, "have ingesters acknowledge records, and write those that aren't again, for at-least-once delivery")
+		hello       = flagset.Bool("forward.hello", false, "negotiate acks and framing with ingesters, with the OKLOG/1 handshake; only once every ingester understands it")
+		snappy      = flagset.Bool("forward.snappy", false, "with -forward.hello, compress what's written to ingesters with snappy")
+		snappyWait  = flagset.Duration("forward.snappy-flush-interval", defaultForwardSnappyWait, "with -forward.snappy, the longest a record waits to be compressed and written")
+		snappyBytes = flagset.Int("forward.snappy-flush-bytes", defaultForwardSnappyBytes, "with -forward.snappy, write once this many bytes of records are waiting")
+		batchSize   = flagset.Int("forward.batch-size", 0, "with -forward.hello, write records to ingesters in batches of up to this many (0 for none)")
+		batchWait   = flagset.Duration("forward.batch-wait", defaultForwardBatchWait, "with -forward.batch-size, the longest a record waits for its batch to fill")
+		rebalance   = flagset.Duration("forward.rebalance-interval", defaultForwardRebalance, "with -forward.hello, and more than one ingester, about this often, leave the ingester for another with at least two fewer connections (0 for never)")
+		policy      = flagset.String("forward.mirror-policy", mirrorPolicyBlock, "when a target is down: block, to wait for it, or drop, to forward to the rest")
+		framing     = flagset.String("forward.framing", framingNewline, "newline, or length-prefixed for stdin records of uvarint length and any bytes, incl. newlines")
+		mlStart     = flagset.String("multiline.start-pattern", "", "join lines into multiline records, each starting with a line matching this regex (default none)")
+		mlMaxLines  = flagset.Int("multiline.max-lines", defaultMultilineMaxLines, "with -multiline.start-pattern, the most lines in a record (0 for no limit)")
+		mlMaxWait   = flagset.Duration("multiline.max-wait", defaultMultilineMaxWait, "with -multiline.start-pattern, the longest a record waits for its next line (0 for no limit)")
+		mlSeparator = flagset.String("multiline.separator", defaultMultilineSeparator, "with -multiline.start-pattern, what replaces newlines in a record, unless -forward.framing is length-prefixed")
+		prefixes    = stringslice{}
+		files       = stringslice{}
+		mirrors     = stringslice{}
 	)
+	flagset.Var(&mirrors, "forward.mirror", "also forward every record to these comma-separated ingesters, of another cluster (repeatable)")
+	flagset.Var(&files, "file", "tail files matching this glob, instead of reading stdin (repeatable)")
 	flagset.Var(&prefixes, "prefix", "prefix annotated on each log record (repeatable)")
+	flagset.Var(&prefixes, "forward.prefix", "alias for -prefix")
+	flagset.StringVar(framing, "framing", framingNewline, "alias for -forward.framing")
 	flagset.Usage = usageFor(flagset, "oklog forward [flags] <ingester> [<ingester>...]")
 	if err := flagset.Parse(args); err != nil {
 		return err
@@ -35,47 +118,85 @@ func runForward(args []string) error {
 		return errors.New("specify at least one ingest address as an argument")
 	}
 
+	switch *policy {
+	case mirrorPolicyBlock, mirrorPolicyDrop:
+	default:
+		return errors.Errorf("invalid -forward.mirror-policy %q", *policy)
+	}
+	switch *framing {
+	case framingNewline, framingLengthPrefixed:
+	default:
+		return errors.Errorf("invalid -forward.framing %q", *framing)
+	}
+	framed := *framing == framingLengthPrefixed
+	if *snappy && !*hello {
+		return errors.New("-forward.snappy requires -forward.hello")
+	}
+	if *snappyBytes <= 0 {
+		return errors.Errorf("invalid -forward.snappy-flush-bytes %d", *snappyBytes)
+	}
+	switch {
+	case *batchSize < 0:
+		return errors.Errorf("invalid -forward.batch-size %d", *batchSize)
+	case *batchSize > 0 && !*hello:
+		return errors.New("-forward.batch-size requires -forward.hello")
+	case *batchSize > 0 && framed:
+		return errors.New("-forward.batch-size requires newline -forward.framing")
+	}
+	if *rebalance < 0 {
+		return errors.Errorf("invalid -forward.rebalance-interval %s", *rebalance)
+	}
+	if strings.ContainsAny(*sourceID, " \t\r\n") {
+		return errors.Errorf("invalid -forward.source-id %q: must not contain whitespace", *sourceID)
+	}
+	var topics *forward.TopicRouter
+	if *topic != "" || *topicRegex != "" {
+		var pattern *regexp.Regexp
+		if *topicRegex != "" {
+			re, err := regexp.Compile(*topicRegex)
+			if err != nil {
+				return errors.Wrap(err, "invalid -forward.topic-pattern")
+			}
+			pattern = re
+		}
+		router, err := forward.NewTopicRouter(pattern, *topic)
+		if err != nil {
+			return errors.Wrap(err, "invalid -forward.topic or -forward.topic-pattern")
+		}
+		topics = router
+	}
+	var mlStartRegex *regexp.Regexp
+	if *mlStart != "" {
+		re, err := regexp.Compile(*mlStart)
+		if err != nil {
+			return errors.Wrap(err, "invalid -multiline.start-pattern")
+		}
+		mlStartRegex = re
+	}
+
+	tlsConfig, err := toolTLSConfig(*useTLS, *tlsCA, *tlsCert, *tlsKey)
+	if err != nil {
+		return err
+	}
+
 	// Logging.
-	var logger log.Logger
-	{
-		logLevel := level.AllowInfo()
-		if *debug {
-			logLevel = level.AllowAll()
-		}
-		logger = log.NewLogfmtLogger(os.Stderr)
-		logger = log.With(logger, "ts", log.DefaultTimestampUTC)
-		logger = level.NewFilter(logger, logLevel)
-	}
-
-	// Instrumentation.
-	forwardBytes := prometheus.NewCounter(prometheus.CounterOpts{
-		Namespace: "oklog",
-		Name:      "forward_bytes_total",
-		Help:      "Bytes forwarded.",
-	})
-	forwardRecords := prometheus.NewCounter(prometheus.CounterOpts{
-		Namespace: "oklog",
-		Name:      "forward_records_total",
-		Help:      "Records forwarded.",
-	})
-	disconnects := prometheus.NewCounter(prometheus.CounterOpts{
-		Namespace: "oklog",
-		Name:      "forward_disconnects",
-		Help:      "Number of times forwarder is disconnected from ingester.",
-	})
-	shortWrites := prometheus.NewCounter(prometheus.CounterOpts{
-		Namespace: "oklog",
-		Name:      "forward_short_writes",
-		Help:      "Number of times forwarder performs a short write to the ingester.",
-	})
-	prometheus.MustRegister(
-		forwardBytes,
-		forwardRecords,
-		disconnects,
-		shortWrites,
+	logger, err := newLogger(os.Stderr, *logFormat, *logLevel, *debug)
+	if err != nil {
+		return err
+	}
+
+	// Instrumentation, registered with our own registry, served by the
+	// API, and the metrics server, if either is enabled.
+	var (
+		registry = prometheus.NewRegistry()
+		metrics  *forwardMetrics
 	)
+	if *apiAddr != "" || *metricsAddr != "" {
+		metrics = newForwardMetrics(registry)
+	}
+	metricsHandler := promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, registry}, promhttp.HandlerOpts{})
 
-	// For now, just a quick-and-dirty metrics server.
+	// For now, just a quick-and-dirty API server.
 	if *apiAddr != "" {
 		apiNetwork, apiAddress, _, _, err := parseAddr(*apiAddr, defaultAPIPort)
 		if err != nil {
@@ -87,36 +208,203 @@ func runForward(args []string) error {
 		}
 		go func() {
 			mux := http.NewServeMux()
-			registerMetrics(mux)
+			mux.Handle("/metrics", metricsHandler)
 			registerProfile(mux)
 			registerHealthCheck(mux)
+			registerVersion(mux, flagset)
 			panic(http.Serve(apiListener, mux))
 		}()
 	}
 
-	// Parse URLs for forwarders.
+	// And a server of just the metrics.
+	if *metricsAddr != "" {
+		metricsNetwork, metricsAddress, _, _, err := parseAddr(*metricsAddr, defaultAPIPort)
+		if err != nil {
+			return err
+		}
+		metricsListener, err := net.Listen(metricsNetwork, metricsAddress)
+		if err != nil {
+			return err
+		}
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metricsHandler)
+			panic(http.Serve(metricsListener, mux))
+		}()
+	}
+
+	// Construct the prefixer.
+	prefix := prefixer{
+		static:     prefixes,
+		timestamp:  *prefixTime,
+		clientTime: *clientTime,
+		topics:     topics,
+		separator:  *separator,
+		now:        time.Now,
+	}
+	if *prefixHost {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return errors.Wrap(err, "getting hostname for -forward.prefix-hostname")
+		}
+		prefix.hostname = hostname
+	}
+
+	// One target per cluster: the ingesters given as arguments, and those
+	// of each mirror. In block mode, targets take records one at a time, so
+	// the input waits for the slowest; in drop mode, they queue some.
+	queue := 0
+	if *policy == mirrorPolicyDrop {
+		queue = defaultForwardMirrorQueue
+	}
+	clusters := [][]string{args}
+	for _, mirror := range mirrors {
+		clusters = append(clusters, strings.Split(mirror, ","))
+	}
+	var targets []*forwardTarget
+	for i, addrs := range clusters {
+		name := strings.Join(addrs, ",")
+		urls, err := parseIngestURLs(addrs)
+		if err != nil {
+			return err
+		}
+
+		// The optional spool, which outlives us. Mirrors each have
+		// their own, beneath the first's.
+		var sp *spool.Spool
+		if *bufferDir != "" {
+			dir := *bufferDir
+			if i > 0 {
+				dir = filepath.Join(dir, fmt.Sprintf("mirror-%d", i))
+			}
+			evicted, corrupt := metrics.spoolCounters(name)
+			sp, err = spool.Open(fs.NewRealFilesystem(), dir, *bufferSize, *takeover, evicted, corrupt)
+			if _, ok := err.(spool.LockedError); ok {
+				return errors.Wrap(err, "-forward.buffer-dir is in use by another forwarder")
+			}
+			if err != nil {
+				return errors.Wrap(err, "opening -forward.buffer-dir")
+			}
+			defer sp.Close()
+			if n := sp.Len(); n > 0 {
+				level.Info(logger).Log("buffer", dir, "spooled_records", n)
+			}
+			metrics.buffered(name, sp)
+		}
+
+		var compress *snappyOptions
+		if *snappy {
+			uncompressed, compressed := metrics.snappyCounters(name)
+			compress = &snappyOptions{*snappyWait, *snappyBytes, uncompressed, compressed}
+		}
+		var batch *batchOptions
+		if *batchSize > 0 {
+			batch = &batchOptions{*batchWait, *batchSize}
+		}
+
+		dialer := newIngestDialer(urls, tlsConfig, *sourceID, *acks, framed, *hello, compress, batch, logger)
+		target := newForwardTarget(
+			name,
+			dialer.dial,
+			prefix,
+			framed,
+			*acks,
+			sp,
+			queue,
+			metrics,
+			logger,
+		)
+		if dialer.balanced() && *rebalance > 0 {
+			target.rebalance, target.rebalanceInterval = dialer.rebalance, *rebalance
+		}
+		targets = append(targets, target)
+	}
+
+	// The input is stdin, or the lines of the tailed files, merged. Either
+	// is read a line at a time, if the lines are assembled into records.
+	var input io.Reader = os.Stdin
+	if len(files) > 0 {
+		pr, pw := io.Pipe()
+		rotations, truncations := metrics.tailCounters()
+		tailer, err := forward.NewTailer(files, *fileState, *filePoll, pw, rotations, truncations, logger)
+		if err != nil {
+			return errors.Wrap(err, "tailing -file")
+		}
+		go tailer.Run()
+		defer tailer.Stop()
+		input = pr
+	}
+	switch {
+	case mlStartRegex != nil:
+		input = assembleLines(input, mlStartRegex, *mlMaxLines, *mlMaxWait, *mlSeparator, framed)
+	case framed && len(files) > 0:
+		input = frameLines(input)
+	}
+
+	var stamp func() time.Time
+	if *clientTime {
+		stamp = time.Now
+	}
+	return forwardLines(input, framed, stamp, targets, *policy, logger)
+}
+
+// parseIngestURLs parses the addresses of a cluster's ingest nodes.
+func parseIngestURLs(addrs []string) ([]*url.URL, error) {
 	var urls []*url.URL
-	for _, addr := range args {
+	for _, addr := range addrs {
 		schema, host, _, _, err := parseAddr(addr, defaultFastPort)
 		if err != nil {
-			return errors.Wrap(err, "parsing ingest address")
+			return nil, errors.Wrap(err, "parsing ingest address")
 		}
 		u, err := url.Parse(fmt.Sprintf("%s://%s", schema, host))
 		if err != nil {
-			return errors.Wrap(err, "parsing ingest URL")
+			return nil, errors.Wrap(err, "parsing ingest URL")
 		}
 		if _, _, err := net.SplitHostPort(u.Host); err != nil {
-			return errors.Wrapf(err, "couldn't split host:port")
+			return nil, errors.Wrapf(err, "couldn't split host:port")
 		}
 		urls = append(urls, u)
 	}
+	return urls, nil
+}
 
-	// Construct the prefix expression.
-	var prefix string
-	if len(prefixes) > 0 {
-		prefix = strings.Join(prefixes, " ") + " "
-	}
+// ingestDialer connects to the ingesters of a cluster, given by URLs, for a
+// forwardTarget. Each dial goes to another of the URLs, in a random order,
+// resolving any DNS scheme suffix first. Once connected, it writes the
+// ingest.SourceHandshake, if sourceID isn't empty, then the
+// ingest.AckHandshake, if acks, and then the record.FramingHandshake, if
+// framed.
+//
+// With hello, it negotiates acks and framing with the ingest.HelloHandshake
+// instead, and then writes the ingest.SourceHandshake. An ingester that
+// doesn't answer has taken the hello for a record; the dial fails, and the
+// ingester gets the other handshakes from then on. If compress isn't nil, it
+// negotiates snappy, too, and everything after the hello is compressed. If
+// batch isn't nil, it negotiates batches, and records are written in them.
+//
+// With hello, and more than one URL, each dial asks two of the ingesters, at
+// random, for their ingest.Load, and connects to the less loaded; see
+// chooseIngester. So a node that's just restarted takes its share of
+// forwarders as they reconnect, rather than every one of them, or none.
+type ingestDialer struct {
+	tlsConfig *tls.Config
+	sourceID  string
+	acks      bool
+	framed    bool
+	hello     bool
+	compress  *snappyOptions
+	batch     *batchOptions
+	want      []string // features, with hello
+	logger    log.Logger
 
+	mtx     sync.Mutex
+	urls    []*url.URL
+	legacy  map[string]bool // ingesters that didn't answer hello
+	current *url.URL        // of the last connection, resolved
+}
+
+// newIngestDialer returns an ingestDialer of the URLs, which it shuffles.
+func newIngestDialer(urls []*url.URL, tlsConfig *tls.Config, sourceID string, acks, framed, hello bool, compress *snappyOptions, batch *batchOptions, logger log.Logger) *ingestDialer {
 	// Shuffle the order.
 	rand.Seed(time.Now().UnixNano())
 	for i := range urls {
@@ -124,102 +412,973 @@ func runForward(args []string) error {
 		urls[i], urls[j] = urls[j], urls[i]
 	}
 
-	// Build a scanner for the input, and the last record we scanned.
-	// These both outlive any individual connection to an ingester.
-	// TODO(pb): have flag for backpressure vs. drop
+	var want []string
+	if acks {
+		want = append(want, ingest.FeatureAcks)
+	}
+	if framed {
+		want = append(want, ingest.FeatureFraming)
+	}
+	if compress != nil {
+		want = append(want, ingest.FeatureSnappy)
+	}
+	if batch != nil {
+		want = append(want, ingest.FeatureBatch)
+	}
+	return &ingestDialer{
+		tlsConfig: tlsConfig,
+		sourceID:  sourceID,
+		acks:      acks,
+		framed:    framed,
+		hello:     hello,
+		compress:  compress,
+		batch:     batch,
+		want:      want,
+		logger:    logger,
+		urls:      urls,
+		legacy:    map[string]bool{},
+	}
+}
+
+// balanced reports whether the dialer chooses among ingesters by their load.
+func (d *ingestDialer) balanced() bool {
+	return d.hello && len(d.urls) > 1
+}
+
+// dial connects to the next ingester, or the less loaded of two.
+func (d *ingestDialer) dial() (net.Conn, error) {
+	if !d.balanced() {
+		// Each dial tries the next URL, rotating thru them.
+		d.mtx.Lock()
+		raw := d.urls[0]
+		d.urls = append(d.urls[1:], d.urls[0])
+		d.mtx.Unlock()
+		target, err := d.resolve(raw)
+		if err != nil {
+			return nil, err
+		}
+		return d.connect(target)
+	}
+
+	d.mtx.Lock()
+	i, j := pickTwo(len(d.urls), rand.Intn)
+	raws := []*url.URL{d.urls[i], d.urls[j]}
+	d.mtx.Unlock()
+	var (
+		targets [2]url.URL
+		probes  [2]ingestProbe
+		wg      sync.WaitGroup
+	)
+	for k := range raws {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			target, err := d.resolve(raws[k])
+			if err != nil {
+				probes[k] = ingestProbe{err: err}
+				return
+			}
+			targets[k], probes[k] = target, d.probe(target)
+		}(k)
+	}
+	wg.Wait()
+	k := chooseIngester(probes[0], probes[1])
+	if probes[k].err != nil {
+		return nil, probes[k].err // neither could be reached
+	}
+	level.Debug(d.logger).Log("chose", targets[k].String(), "load", probes[k].load, "over", targets[1-k].String(), "load", probes[1-k].load)
+	return d.connect(targets[k])
+}
+
+// rebalance reports whether the ingester of the last connection has at least
+// two more connections than another, at random, so the forwarder should
+// leave it for that one; see shouldRebalance.
+func (d *ingestDialer) rebalance() bool {
+	d.mtx.Lock()
+	if !d.balanced() || d.current == nil {
+		d.mtx.Unlock()
+		return false
+	}
+	current, raw := *d.current, d.urls[rand.Intn(len(d.urls))]
+	d.mtx.Unlock()
+	other, err := d.resolve(raw)
+	if err != nil || other.Host == current.Host {
+		return false
+	}
 	var (
-		s       = bufio.NewScanner(os.Stdin)
-		backoff = time.Duration(0)
+		probes [2]ingestProbe
+		wg     sync.WaitGroup
 	)
+	for k, target := range []url.URL{current, other} {
+		wg.Add(1)
+		go func(k int, target url.URL) {
+			defer wg.Done()
+			probes[k] = d.probe(target)
+		}(k, target)
+	}
+	wg.Wait()
+	return shouldRebalance(probes[0], probes[1])
+}
+
+// resolve the host of the URL, if its scheme has a DNS suffix, e.g.
+// "tcp+dnssrv://host:port", to one of its records, at random.
+func (d *ingestDialer) resolve(raw *url.URL) (url.URL, error) {
+	target := *raw // resolving mustn't rewrite the flag
+
+	host, port, err := net.SplitHostPort(target.Host)
+	if err != nil {
+		return url.URL{}, errors.Wrapf(err, "unexpected error")
+	}
+
+	fields := strings.SplitN(target.Scheme, "+", 2)
+	if len(fields) == 2 {
+		proto, suffix := fields[0], fields[1]
+		switch suffix {
+		case "dns", "dnsip":
+			ips, err := net.LookupIP(host)
+			if err != nil {
+				return url.URL{}, errors.Wrapf(err, "LookupIP %s", host)
+			}
+			host = ips[rand.Intn(len(ips))].String()
+			target.Scheme, target.Host = proto, net.JoinHostPort(host, port)
+
+		case "dnssrv":
+			_, records, err := net.LookupSRV("", proto, host)
+			if err != nil {
+				return url.URL{}, errors.Wrapf(err, "LookupSRV %s", host)
+			}
+			host = records[rand.Intn(len(records))].Target
+			target.Scheme, target.Host = proto, net.JoinHostPort(host, port) // TODO(pb): take port from SRV record?
+
+		case "dnsaddr":
+			names, err := net.LookupAddr(host)
+			if err != nil {
+				return url.URL{}, errors.Wrapf(err, "LookupAddr %s", host)
+			}
+			host = names[rand.Intn(len(names))]
+			target.Scheme, target.Host = proto, net.JoinHostPort(host, port)
+
+		default:
+			level.Warn(d.logger).Log("unsupported_scheme_suffix", suffix, "using", proto)
+			target.Scheme = proto // target.Host stays the same
+		}
+	}
+	level.Debug(d.logger).Log("raw_target", raw.String(), "resolved_target", target.String())
+	return target, nil
+}
+
+// probe asks the ingester for its load, with a hello of just
+// ingest.FeatureLoad, and hangs up. Ingesters that didn't answer hello
+// aren't asked, as they'd take it for a record.
+func (d *ingestDialer) probe(target url.URL) ingestProbe {
+	d.mtx.Lock()
+	legacy := d.legacy[target.Host]
+	d.mtx.Unlock()
+	conn, err := dialIngest(target.Scheme, target.Host, d.tlsConfig, defaultTLSHandshakeTimeout)
+	if err != nil {
+		return ingestProbe{err: errors.Wrapf(err, "dialing %s", target.String())}
+	}
+	defer conn.Close()
+	if legacy {
+		return ingestProbe{}
+	}
+	agreed, err := hello(conn, []string{ingest.FeatureLoad}, defaultForwardHelloWait)
+	if err == errNoHello {
+		d.mtx.Lock()
+		d.legacy[target.Host] = true
+		d.mtx.Unlock()
+	}
+	if err != nil {
+		return ingestProbe{} // it's there, but its load is unknown
+	}
+	load, ok := ingest.ParseLoad(agreed)
+	return ingestProbe{load: load, known: ok}
+}
+
+// connect to the ingester, and write the handshakes.
+func (d *ingestDialer) connect(target url.URL) (net.Conn, error) {
+	conn, err := dialIngest(target.Scheme, target.Host, d.tlsConfig, defaultTLSHandshakeTimeout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "dialing %s", target.String())
+	}
+	d.mtx.Lock()
+	legacy := d.legacy[target.Host]
+	d.current = &target
+	d.mtx.Unlock()
+	if d.hello && !legacy {
+		switch err := sayHello(conn, d.want, defaultForwardHelloWait); {
+		case err == errNoHello:
+			level.Warn(d.logger).Log("ingester", target.String(), "hello", "unanswered", "using", "old handshakes")
+			d.mtx.Lock()
+			d.legacy[target.Host] = true
+			d.mtx.Unlock()
+			fallthrough
+		case err != nil:
+			conn.Close()
+			return nil, errors.Wrapf(err, "saying hello to %s", target.String())
+		}
+		if d.compress != nil {
+			conn = d.compress.conn(conn)
+		}
+		if d.sourceID != "" {
+			if _, err := conn.Write([]byte(ingest.SourceHandshake + " " + d.sourceID + "\n")); err != nil {
+				conn.Close()
+				return nil, errors.Wrapf(err, "writing source handshake to %s", target.String())
+			}
+		}
+		if d.batch != nil {
+			conn = d.batch.conn(conn)
+		}
+		return conn, nil
+	}
+	if d.sourceID != "" {
+		if _, err := conn.Write([]byte(ingest.SourceHandshake + " " + d.sourceID + "\n")); err != nil {
+			conn.Close()
+			return nil, errors.Wrapf(err, "writing source handshake to %s", target.String())
+		}
+	}
+	if d.acks {
+		if _, err := conn.Write([]byte(ingest.AckHandshake + "\n")); err != nil {
+			conn.Close()
+			return nil, errors.Wrapf(err, "writing ack handshake to %s", target.String())
+		}
+	}
+	if d.framed {
+		if _, err := conn.Write([]byte(record.FramingHandshake + "\n")); err != nil {
+			conn.Close()
+			return nil, errors.Wrapf(err, "writing framing handshake to %s", target.String())
+		}
+	}
+	return conn, nil
+}
 
-	// Enter the connect and forward loop. We do this forever.
-	for ; ; urls = append(urls[1:], urls[0]) { // rotate thru URLs
-		// We gonna try to connect to this first one.
-		target := urls[0]
+// errNoHello is why sayHello fails, if the ingester doesn't answer in time.
+var errNoHello = errors.New("no answer to hello")
+
+// sayHello writes the ingest.HelloHandshake, asking for the features, and
+// reads the answer, for up to timeout. It fails if the ingester doesn't agree
+// to all of them.
+func sayHello(conn net.Conn, features []string, timeout time.Duration) error {
+	agreed, err := hello(conn, features, timeout)
+	if err != nil {
+		return err
+	}
+	for _, f := range features {
+		if !contains(agreed, f) {
+			return errors.Errorf("ingester doesn't support %s", f)
+		}
+	}
+	return nil
+}
 
-		host, port, err := net.SplitHostPort(target.Host)
+// hello writes the ingest.HelloHandshake, asking for the features, and
+// returns those of the answer, read for up to timeout.
+func hello(conn net.Conn, features []string, timeout time.Duration) ([]string, error) {
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+	if _, err := io.WriteString(conn, ingest.Hello(features)+"\n"); err != nil {
+		return nil, err
+	}
+
+	// A byte at a time, so nothing after the answer is read.
+	var (
+		line []byte
+		c    = make([]byte, 1)
+	)
+	for len(line) == 0 || line[len(line)-1] != '\n' {
+		if len(line) > 1024 {
+			return nil, errors.Errorf("answer to hello too long: %q...", line)
+		}
+		if _, err := conn.Read(c); err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return nil, errNoHello
+			}
+			return nil, errors.Wrap(err, "reading answer to hello")
+		}
+		line = append(line, c[0])
+	}
+	agreed, ok := ingest.ParseHello(string(line))
+	if !ok {
+		return nil, errors.Errorf("unexpected answer to hello: %q", line)
+	}
+	return agreed, nil
+}
+
+// snappyOptions are how a forwarder compresses what it writes to ingesters,
+// with ingest.FeatureSnappy: see ingest.SnappyWriter.
+type snappyOptions struct {
+	flushInterval time.Duration
+	flushBytes    int
+	uncompressed  prometheus.Counter
+	compressed    prometheus.Counter
+}
+
+// conn returns conn, compressing what's written to it.
+func (o *snappyOptions) conn(conn net.Conn) net.Conn {
+	return snappyConn{conn, ingest.NewSnappyWriter(conn, o.flushInterval, o.flushBytes, o.uncompressed, o.compressed)}
+}
+
+// snappyConn is a connection to an ingester that agreed to snappy. It's read
+// as it is.
+type snappyConn struct {
+	net.Conn
+	w *ingest.SnappyWriter
+}
+
+func (c snappyConn) Write(p []byte) (int, error) { return c.w.Write(p) }
+
+// Close flushes what's still to be written, first.
+func (c snappyConn) Close() error {
+	c.w.Close()
+	return c.Conn.Close()
+}
+
+// batchOptions are how a forwarder batches the records it writes to
+// ingesters, with ingest.FeatureBatch: see ingest.BatchWriter.
+type batchOptions struct {
+	flushInterval time.Duration
+	flushRecords  int
+}
+
+// conn returns conn, writing records to it in batches.
+func (o *batchOptions) conn(conn net.Conn) net.Conn {
+	return batchConn{conn, ingest.NewBatchWriter(conn, o.flushInterval, o.flushRecords)}
+}
+
+// batchConn is a connection to an ingester that agreed to batches. It's read
+// as it is.
+type batchConn struct {
+	net.Conn
+	w *ingest.BatchWriter
+}
+
+func (c batchConn) Write(p []byte) (int, error) { return c.w.Write(p) }
+
+// Close flushes the batch that's still to be written, first.
+func (c batchConn) Close() error {
+	c.w.Close()
+	return c.Conn.Close()
+}
+
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+// assembleLines returns the multiline records assembled from the lines of r,
+// each on a line, with its newlines replaced by separator, or, if framed,
+// with length-prefixed framing, and its newlines kept.
+func assembleLines(r io.Reader, start *regexp.Regexp, maxLines int, maxWait time.Duration, separator string, framed bool) io.Reader {
+	pr, pw := io.Pipe()
+	emit := func(rec []byte) { pw.Write(append(rec, '\n')) }
+	if framed {
+		emit = func(rec []byte) { pw.Write(record.AppendFrame(nil, rec)) }
+		separator = "\n"
+	}
+	a := forward.NewAssembler(start, maxLines, maxWait, separator, emit)
+	go func() {
+		pw.CloseWithError(a.Run(r))
+	}()
+	return pr
+}
+
+// frameLines returns the lines of r, without their newlines, with
+// length-prefixed framing.
+func frameLines(r io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			pw.Write(record.AppendFrame(nil, s.Bytes()))
+		}
+		pw.CloseWithError(s.Err())
+	}()
+	return pr
+}
+
+// forwardLines sends each line of r to every target, and returns once r is
+// exhausted and the targets have written every record they took. If framed,
+// r has length-prefixed framing instead, and records are sent without it.
+//
+// With mirrorPolicyBlock, each record waits for every target to take it, so
+// one target that's down holds up the rest. With mirrorPolicyDrop, a record
+// that a target can't queue is dropped, for that target only, so the rest
+// carry on.
+//
+// If stamp isn't nil, each record is prefixed with the time it's read, as unix
+// epoch milliseconds, and a space, ahead of any other prefixes. It's the time
+// the record is ingested with; see ingest.ClientTimestamps. Records read while
+// no ingester is reachable keep the time they were read, however long they're
+// spooled.
+func forwardLines(r io.Reader, framed bool, stamp func() time.Time, targets []*forwardTarget, policy string, logger log.Logger) error {
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t *forwardTarget) {
+			defer wg.Done()
+			t.run()
+		}(t)
+	}
+
+	s := bufio.NewScanner(r)
+	if framed {
+		s.Buffer(nil, bufio.MaxScanTokenSize+binary.MaxVarintLen64) // room for a forward.MaxLineSize record, and its length
+		s.Split(record.ScanFrames)
+	}
+	for s.Scan() {
+		record := []byte(s.Text() + "\n")
+		if framed {
+			record = []byte(s.Text())
+		}
+		if stamp != nil {
+			record = append(append(strconv.AppendInt(nil, stamp().UnixNano()/1e6, 10), ' '), record...)
+		}
+		for _, t := range targets {
+			if policy != mirrorPolicyDrop {
+				t.records <- record
+				continue
+			}
+			select {
+			case t.records <- record:
+			default:
+				t.metrics.dropped(t.name, dropReasonQueueFull)
+			}
+		}
+	}
+	level.Info(logger).Log("stdin", "exhausted", "due_to", s.Err())
+
+	for _, t := range targets {
+		close(t.records)
+	}
+	wg.Wait()
+	return nil
+}
+
+// forwardTarget manages the connection to one cluster of ingest nodes. It
+// dials them in turn, redials with backoff whenever the connection is lost,
+// and writes the records sent to it. Records are prefixed as they're written,
+// so those replayed from the spool get the same prefixes as the rest, and, if
+// the target is framed, so is each record, after its prefixes.
+//
+// Without a spool, a record that fails to write is retried on the next
+// connection, and no records are taken while there's no connection. With a
+// spool, records taken while there's no connection are appended to it, and
+// drained, oldest first, ahead of new records once there is.
+//
+// With acks, the ingester acknowledges the records it's written; see
+// ingest.AckHandshake. Up to ackWindow records are written ahead of their
+// acknowledgements, and kept until then: in memory, or, with a spool, in the
+// spool, which every record goes thru. If the connection is lost, or no
+// acknowledgement comes for ackTimeout, those that weren't acknowledged are
+// written again, on the next connection. If ackLatency isn't nil, it observes
+// how long each record took to be acknowledged, from its last write.
+//
+// If rebalance isn't nil, about every rebalanceInterval, jittered, it's asked
+// whether to leave the ingester for another, less loaded. If so, the target
+// stops writing, waits for what it's written to be acknowledged, with acks,
+// and reconnects, to whichever the dial chooses.
+type forwardTarget struct {
+	name       string
+	dial       func() (net.Conn, error)
+	prefix     prefixer
+	framed     bool
+	acks       bool
+	ackWindow  int
+	ackTimeout time.Duration
+	sp         *spool.Spool // may be nil
+	records    chan []byte
+	metrics    *forwardMetrics
+	ackLatency observer // may be nil
+	logger     log.Logger
+
+	rebalance         func() bool // may be nil
+	rebalanceInterval time.Duration
+}
+
+// observer is a prometheus.Histogram, or Summary, or a latencySample, as far
+// as latencies are concerned.
+type observer interface {
+	Observe(float64)
+}
+
+// newForwardTarget returns a target which takes records from a channel
+// buffered for queue records. Don't forget to run it.
+func newForwardTarget(
+	name string,
+	dial func() (net.Conn, error),
+	prefix prefixer,
+	framed bool,
+	acks bool,
+	sp *spool.Spool,
+	queue int,
+	metrics *forwardMetrics,
+	logger log.Logger,
+) *forwardTarget {
+	return &forwardTarget{
+		name:       name,
+		dial:       dial,
+		prefix:     prefix,
+		framed:     framed,
+		acks:       acks,
+		ackWindow:  defaultForwardAckWindow,
+		ackTimeout: defaultForwardAckTimeout,
+		sp:         sp,
+		records:    make(chan []byte, queue),
+		metrics:    metrics,
+		logger:     log.With(logger, "target", name),
+	}
+}
+
+// unacked is a record written to an ingester, and not yet acknowledged:
+// the record itself, or, with a spool, its index there, and when it was
+// written.
+type unacked struct {
+	record  []byte
+	index   uint64
+	written time.Time
+}
+
+// run forwards records until the records channel is closed, and every
+// record is written, and, with acks, acknowledged.
+func (t *forwardTarget) run() {
+	var (
+		conn      net.Conn
+		addr      string
+		hangup    chan error    // receives once the ingester hangs up, or goes away
+		acked     chan uint64   // receives the latest acknowledgement, with acks
+		connected chan net.Conn // non-nil while dialing
+		pending   [][]byte      // records that failed to write, or weren't acknowledged, without a spool
+		inflight  []unacked     // written on this connection, oldest first, with acks
+		written   uint64        // records written on this connection
+		backoff   time.Duration // before the next dial
+		exhausted bool          // the records channel
+		connects  int
+		probing   chan bool // non-nil while asking whether to rebalance
+		moving    bool      // to rebalance, once what's written is acknowledged
+		rebalance <-chan time.Time
+		sp        = t.sp
+		logger    = t.logger
+		ackTimer  = time.NewTimer(t.ackTimeout)
+	)
+	defer ackTimer.Stop()
+	if t.rebalance != nil && t.rebalanceInterval > 0 {
+		// Jittered, so forwarders started together don't all rebalance
+		// together.
+		ticker := time.NewTicker(jitter(t.rebalanceInterval))
+		defer ticker.Stop()
+		rebalance = ticker.C
+	}
+	resetAckTimer := func(d time.Duration) {
+		if !ackTimer.Stop() {
+			select {
+			case <-ackTimer.C:
+			default:
+			}
+		}
+		if d > 0 {
+			ackTimer.Reset(d)
+		}
+	}
+	resetAckTimer(0)
+	ack := func(n uint64) {
+		first := written - uint64(len(inflight)) + 1 // of inflight[0]
+		if n < first || len(inflight) == 0 {
+			return
+		}
+		k := n - first + 1
+		if k > uint64(len(inflight)) {
+			k = uint64(len(inflight))
+		}
+		last := inflight[k-1]
+		if t.ackLatency != nil {
+			now := time.Now()
+			for _, u := range inflight[:k] {
+				t.ackLatency.Observe(now.Sub(u.written).Seconds())
+			}
+		}
+		inflight = inflight[k:]
+		if sp != nil {
+			if err := sp.PopThrough(last.index); err != nil {
+				level.Warn(logger).Log("spool", "pop", "err", err)
+			}
+			t.metrics.buffered(t.name, sp)
+		}
+		backoff = 0 // reset the backoff once records are acknowledged
+		if len(inflight) > 0 {
+			resetAckTimer(t.ackTimeout)
+		} else {
+			resetAckTimer(0)
+		}
+	}
+	pollAcks := func() {
+		select {
+		case n := <-acked:
+			ack(n)
+		default:
+		}
+	}
+	// retransmit the records that weren't acknowledged on a lost
+	// connection, on the next: from the spool, or ahead of those pending.
+	retransmit := func() {
+		if !t.acks {
+			return
+		}
+		t.metrics.retransmitted(t.name, len(inflight))
+		if sp != nil {
+			sp.Rewind()
+		} else {
+			var records [][]byte
+			for _, u := range inflight {
+				records = append(records, u.record)
+			}
+			pending = append(records, pending...)
+		}
+		inflight, written = nil, 0
+		resetAckTimer(0)
+	}
+	disconnect := func(err error) {
+		pollAcks() // the last, before the ingester hung up
+		t.metrics.disconnectedFrom(t.name, addr, false)
+		if err == errGoAway {
+			// The ingester is shutting down, and still reading what
+			// we've written. Close our end, and fail over right away.
+			level.Info(logger).Log("disconnected_from", addr, "due_to", err)
+			backoff = 0
+		} else if err == errRebalance {
+			// Another ingester has fewer connections, and what we've
+			// written is acknowledged. Move right away.
+			level.Info(logger).Log("disconnected_from", addr, "due_to", err)
+			t.metrics.rebalanced(t.name)
+			backoff = 0
+		} else if _, ok := err.(clockSkewedError); ok {
+			// The ingester's clock is off. Others' probably aren't,
+			// so fail over right away.
+			level.Warn(logger).Log("disconnected_from", addr, "due_to", err)
+			backoff = 0
+		} else if _, ok := err.(quotaExceededError); ok {
+			// Our source is over its daily quota. Every ingester
+			// would reject us, so don't hurry back.
+			level.Warn(logger).Log("disconnected_from", addr, "due_to", err)
+			backoff = defaultForwardQuotaWait
+		} else {
+			level.Warn(logger).Log("disconnected_from", addr, "due_to", err)
+		}
+		conn.Close()
+		conn, hangup, acked = nil, nil, nil
+		probing, moving = nil, false
+		retransmit()
+	}
+	alive := func() bool {
+		select {
+		case err := <-hangup:
+			disconnect(err)
+			return false
+		default:
+			return true
+		}
+	}
+	write := func(record []byte, index uint64) bool {
+		raw := record
+		record = t.encode(record)
+		n, err := conn.Write(record)
 		if err != nil {
-			return errors.Wrapf(err, "unexpected error")
+			disconnect(err)
+			return false
+		} else if n < len(record) {
+			t.metrics.disconnectedFrom(t.name, addr, true)
+			level.Warn(logger).Log("short_write_to", addr, "n", n, "less_than", len(record))
+			conn.Close() // TODO(pb): we should do something more sophisticated here
+			conn, hangup, acked = nil, nil, nil
+			retransmit()
+			return false
+		}
+		if t.acks {
+			if len(inflight) == 0 {
+				resetAckTimer(t.ackTimeout)
+			}
+			u := unacked{index: index, written: time.Now()}
+			if sp == nil {
+				u.record = raw
+			}
+			inflight = append(inflight, u)
+			written++
+		} else {
+			backoff = 0 // reset the backoff on a successful write
+		}
+		t.metrics.wrote(t.name, record)
+		return true
+	}
+	queue := func(record []byte) {
+		if sp == nil {
+			pending = append(pending, record)
+			return
+		}
+		if err := sp.Append(record); err != nil {
+			t.metrics.dropped(t.name, dropReasonSpoolError)
+			level.Warn(logger).Log("spool", "append", "err", err)
 		}
+		t.metrics.buffered(t.name, sp)
+	}
 
-		// Support e.g. "tcp+dnssrv://host:port"
-		fields := strings.SplitN(target.Scheme, "+", 2)
-		if len(fields) == 2 {
-			proto, suffix := fields[0], fields[1]
-			switch suffix {
-			case "dns", "dnsip":
-				ips, err := net.LookupIP(host)
-				if err != nil {
-					level.Warn(logger).Log("LookupIP", host, "err", err)
-					backoff = exponential(backoff)
-					time.Sleep(backoff)
-					continue
-				}
-				host = ips[rand.Intn(len(ips))].String()
-				target.Scheme, target.Host = proto, net.JoinHostPort(host, port)
+	for {
+		if exhausted && len(pending) == 0 && len(inflight) == 0 && (sp == nil || sp.Len() == 0) {
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if moving && conn != nil && len(inflight) == 0 {
+			disconnect(errRebalance)
+			continue
+		}
 
-			case "dnssrv":
-				_, records, err := net.LookupSRV("", proto, host)
+		if conn == nil && connected == nil {
+			connected = make(chan net.Conn, 1)
+			go func(c chan<- net.Conn, backoff time.Duration) {
+				time.Sleep(backoff)
+				conn, err := t.dial()
 				if err != nil {
-					level.Warn(logger).Log("LookupSRV", host, "err", err)
-					backoff = exponential(backoff)
-					time.Sleep(backoff)
-					continue
+					level.Warn(logger).Log("dial", "failed", "err", err)
 				}
-				host = records[rand.Intn(len(records))].Target
-				target.Scheme, target.Host = proto, net.JoinHostPort(host, port) // TODO(pb): take port from SRV record?
+				c <- conn
+			}(connected, backoff)
+		}
 
-			case "dnsaddr":
-				names, err := net.LookupAddr(host)
-				if err != nil {
-					level.Warn(logger).Log("LookupAddr", host, "err", err)
-					backoff = exponential(backoff)
-					time.Sleep(backoff)
+		// With a connection, the pending or oldest spooled record goes
+		// first. Meanwhile, new records are spooled behind it. With acks,
+		// records are read ahead from the spool, until the window is full.
+		windowFull := (t.acks && len(inflight) >= t.ackWindow) || moving
+		if conn != nil && !windowFull {
+			var (
+				record  []byte
+				index   uint64
+				spooled bool
+			)
+			switch {
+			case len(pending) > 0:
+				record = pending[0]
+			case sp != nil && t.acks:
+				record, index, spooled = sp.Next()
+			case sp != nil:
+				record, spooled = sp.Peek()
+			}
+			if record != nil {
+				if !alive() {
 					continue
 				}
-				host = names[rand.Intn(len(names))]
-				target.Scheme, target.Host = proto, net.JoinHostPort(host, port)
-
-			default:
-				level.Warn(logger).Log("unsupported_scheme_suffix", suffix, "using", proto)
-				target.Scheme = proto // target.Host stays the same
+				if sp != nil && !exhausted {
+					select {
+					case line, ok := <-t.records:
+						if !ok {
+							exhausted = true
+						} else {
+							queue(line)
+						}
+					default:
+					}
+				}
+				pollAcks()
+				if write(record, index) {
+					switch {
+					case !spooled:
+						pending = pending[1:]
+					case !t.acks:
+						if err := sp.Pop(); err != nil {
+							level.Warn(logger).Log("spool", "pop", "err", err)
+						}
+						t.metrics.buffered(t.name, sp)
+					}
+				}
+				continue
 			}
 		}
-		level.Debug(logger).Log("raw_target", urls[0].String(), "resolved_target", target.String())
 
-		conn, err := net.Dial(target.Scheme, target.Host)
-		if err != nil {
-			level.Warn(logger).Log("Dial", target.String(), "err", err)
-			backoff = exponential(backoff)
-			time.Sleep(backoff)
-			continue
+		// Otherwise, wait for a record, a connection, a hangup, or, with
+		// acks, an acknowledgement. Without a spool, records can only wait
+		// for a connection, and, with acks, for room in the window.
+		in := t.records
+		if exhausted || (sp == nil && (conn == nil || windowFull)) {
+			in = nil
+		}
+		var ackTimeout <-chan time.Time
+		if conn != nil && len(inflight) > 0 {
+			ackTimeout = ackTimer.C
 		}
+		select {
+		case line, ok := <-in:
+			if !ok {
+				exhausted = true
+				continue
+			}
+			if t.acks && sp != nil {
+				queue(line) // so it's kept until it's acknowledged
+				continue
+			}
+			if conn == nil || !alive() || !write(line, 0) {
+				queue(line)
+			}
 
-		ok := s.Scan()
-		for ok {
-			// We enter the loop wanting to write s.Text() to the conn.
-			record := fmt.Sprintf("%s%s\n", prefix, s.Text())
-			if n, err := fmt.Fprintf(conn, record); err != nil {
-				disconnects.Inc()
-				level.Warn(logger).Log("disconnected_from", target.String(), "due_to", err)
-				break
-			} else if n < len(record) {
-				shortWrites.Inc()
-				level.Warn(logger).Log("short_write_to", target.String(), "n", n, "less_than", len(record))
-				break // TODO(pb): we should do something more sophisticated here
+		case c := <-connected:
+			connected = nil
+			if c == nil {
+				backoff = exponential(backoff)
+				continue
 			}
+			conn, addr, hangup = c, c.RemoteAddr().String(), make(chan error, 1)
+			if t.acks {
+				acked = make(chan uint64, 1)
+			}
+			t.metrics.connectedTo(t.name, addr, connects > 0)
+			connects++
+			go func(c net.Conn, hangup chan<- error, acked chan uint64) {
+				hangup <- awaitHangup(c, acked)
+			}(c, hangup, acked)
 
-			// Only once the write succeeds do we scan the next record.
-			backoff = 0 // reset the backoff on a successful write
-			forwardBytes.Add(float64(len(record)))
-			forwardRecords.Inc()
-			ok = s.Scan()
+		case err := <-hangup:
+			disconnect(err)
+
+		case n := <-acked:
+			ack(n)
+
+		case <-ackTimeout:
+			disconnect(errAckTimeout)
+
+		case <-rebalance:
+			if conn == nil || probing != nil || moving {
+				continue
+			}
+			probing = make(chan bool, 1)
+			go func(c chan<- bool) { c <- t.rebalance() }(probing)
+
+		case move := <-probing:
+			probing, moving = nil, move
 		}
-		if !ok {
-			level.Info(logger).Log("stdin", "exhausted", "due_to", s.Err())
-			return nil
+	}
+}
+
+// encode prefixes a record, and frames it, if the target is framed.
+func (t *forwardTarget) encode(line []byte) []byte {
+	line = t.prefix.prefix(line)
+	if t.framed {
+		return record.AppendFrame(nil, line)
+	}
+	return line
+}
+
+// errGoAway is how awaitHangup reports an ingester that's shutting down.
+var errGoAway = errors.New("ingester going away")
+
+// errRebalance is why a connection is dropped to move to a less loaded
+// ingester.
+var errRebalance = errors.New("rebalancing to a less loaded ingester")
+
+// errAckTimeout is why a connection is dropped if the ingester doesn't
+// acknowledge the records written to it in time.
+var errAckTimeout = errors.New("timed out waiting for acknowledgements")
+
+// quotaExceededError is how awaitHangup reports an ingester that rejected
+// our records, because our source is over its quota. It's the rest of the
+// ingest.QuotaExceeded line.
+type quotaExceededError string
+
+func (e quotaExceededError) Error() string { return string(e) }
+
+// clockSkewedError is how awaitHangup reports an ingester that refused our
+// records, because its clock is off. It's the rest of the
+// ingest.ClockSkewed line.
+type clockSkewedError string
+
+func (e clockSkewedError) Error() string { return string(e) }
+
+// awaitHangup reads from a connection to an ingester until it's closed, the
+// ingester says it's going away, that our source is over its quota, that
+// its clock is off, or that a batch was malformed.
+// If acked isn't nil, the latest acknowledgement is sent to it, replacing
+// any it hasn't received. Ingesters write nothing else.
+func awaitHangup(r io.Reader, acked chan uint64) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if s.Text() == ingest.GoAway {
+			return errGoAway
+		}
+		if acked != nil && strings.HasPrefix(s.Text(), ingest.Ack+" ") {
+			n, err := strconv.ParseUint(strings.TrimPrefix(s.Text(), ingest.Ack+" "), 10, 64)
+			if err != nil {
+				return errors.Wrap(err, "bad acknowledgement")
+			}
+			select {
+			case <-acked:
+			default:
+			}
+			acked <- n // we're its only sender
+			continue
 		}
+		if strings.HasPrefix(s.Text(), ingest.QuotaExceeded+" ") {
+			return quotaExceededError(strings.TrimPrefix(s.Text(), ingest.QuotaExceeded+" "))
+		}
+		if strings.HasPrefix(s.Text(), ingest.ClockSkewed+" ") {
+			return clockSkewedError(strings.TrimPrefix(s.Text(), ingest.ClockSkewed+" "))
+		}
+		if strings.HasPrefix(s.Text(), ingest.BadBatch+" ") {
+			return errors.Errorf("ingester rejected a batch: %s", strings.TrimPrefix(s.Text(), ingest.BadBatch+" "))
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// prefixer prepends fields to records: the static prefixes, then the
+// hostname, if it isn't empty, then the time, if timestamp is set.
+// Each field is followed by the separator. Records are otherwise unchanged,
+// including any leading whitespace. If clientTime is set, records start with
+// the time they were read, which stays ahead of the rest, for the ingesters.
+// If topics isn't nil, the topic it routes the record to comes next, ahead of
+// the prefixes, and followed by a space, as ingesters with dynamic topics
+// expect.
+type prefixer struct {
+	static     []string
+	hostname   string
+	timestamp  bool
+	clientTime bool
+	topics     *forward.TopicRouter
+	separator  string
+	now        func() time.Time
+}
+
+func (p prefixer) prefix(record []byte) []byte {
+	if len(p.static) == 0 && p.hostname == "" && !p.timestamp && p.topics == nil {
+		return record
+	}
+	var buf []byte
+	if p.clientTime {
+		if i := bytes.IndexByte(record, ' '); i >= 0 {
+			buf, record = append(buf, record[:i+1]...), record[i+1:]
+		}
+	}
+	if p.topics != nil {
+		buf = append(append(buf, p.topics.Route(record)...), ' ')
+	}
+	for _, field := range p.static {
+		buf = append(append(buf, field...), p.separator...)
 	}
+	if p.hostname != "" {
+		buf = append(append(buf, p.hostname...), p.separator...)
+	}
+	if p.timestamp {
+		buf = append(append(buf, p.now().UTC().Format(time.RFC3339Nano)...), p.separator...)
+	}
+	return append(buf, record...)
+}
+
+// jitter returns a random duration from half of d to one and a half.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
 }
 
 func exponential(d time.Duration) time.Duration {
@@ -0,0 +1,59 @@
+package main
+
+import "github.com/oklog/oklog/pkg/ingest"
+
+// ingestProbe is what a forwarder found asking an ingester for its load.
+type ingestProbe struct {
+	load  ingest.Load
+	known bool  // it answered with its load
+	err   error // it couldn't be reached
+}
+
+// pickTwo returns two different indexes below n, which must be at least 2,
+// at random, as chosen by intn, e.g. rand.Intn.
+func pickTwo(n int, intn func(int) int) (int, int) {
+	i, j := intn(n), intn(n-1)
+	if j >= i {
+		j++
+	}
+	return i, j
+}
+
+// chooseIngester returns which of two ingesters, 0 or 1, to connect to: one
+// that can be reached, over one that can't; otherwise, if both answered with
+// their loads, the less loaded; otherwise, the first, as they were picked at
+// random. Choosing the better of two random ingesters, rather than the best
+// of all, keeps forwarders that reconnect at the same time, e.g. as a node
+// restarts, and all see it idle, from piling onto it.
+func chooseIngester(a, b ingestProbe) int {
+	switch {
+	case a.err != nil && b.err == nil:
+		return 1
+	case a.err == nil && b.err != nil:
+		return 0
+	case a.known && b.known && lessLoaded(b.load, a.load):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// lessLoaded reports whether a is less loaded than b: it has fewer
+// connections, or as many, and fewer bytes per second.
+func lessLoaded(a, b ingest.Load) bool {
+	if a.Connections != b.Connections {
+		return a.Connections < b.Connections
+	}
+	return a.BytesPerSecond < b.BytesPerSecond
+}
+
+// shouldRebalance reports whether to leave the current ingester, whose load
+// counts our connection, for the other: only if both answered with their
+// loads, and the other has at least two fewer connections, so moving makes
+// them more even, rather than trading one imbalance for another.
+func shouldRebalance(current, other ingestProbe) bool {
+	if current.err != nil || other.err != nil || !current.known || !other.known {
+		return false
+	}
+	return current.load.Connections-other.load.Connections >= 2
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestPickTwo(t *testing.T) {
+	t.Parallel()
+
+	// Every pair comes up, and never an ingester twice.
+	for _, n := range []int{2, 3, 5} {
+		var (
+			rnd  = rand.New(rand.NewSource(1))
+			seen = map[[2]int]bool{}
+		)
+		for k := 0; k < 1000; k++ {
+			i, j := pickTwo(n, rnd.Intn)
+			if i == j || i < 0 || j < 0 || i >= n || j >= n {
+				t.Fatalf("%d: want two different indexes below %d, have %d, %d", n, n, i, j)
+			}
+			seen[[2]int{i, j}] = true
+		}
+		if want, have := n*(n-1), len(seen); want != have {
+			t.Errorf("%d: want %d ordered pairs, have %d", n, want, have)
+		}
+	}
+}
+
+func TestChooseIngester(t *testing.T) {
+	t.Parallel()
+
+	var (
+		idle   = ingestProbe{load: ingest.Load{Connections: 0}, known: true}
+		busy   = ingestProbe{load: ingest.Load{Connections: 9, BytesPerSecond: 1 << 20}, known: true}
+		quiet  = ingestProbe{load: ingest.Load{Connections: 9, BytesPerSecond: 1 << 10}, known: true}
+		old    = ingestProbe{} // answered, or not, without its load
+		down   = ingestProbe{err: errors.New("connection refused")}
+		downed = ingestProbe{err: errors.New("no route to host")}
+	)
+	for _, testcase := range []struct {
+		name string
+		a, b ingestProbe
+		want int
+	}{
+		{"less loaded first", idle, busy, 0},
+		{"less loaded second", busy, idle, 1},
+		{"as many connections, fewer bytes", busy, quiet, 1},
+		{"equal", busy, busy, 0},
+		{"unknown load", old, busy, 0},
+		{"unknown load second", busy, old, 0},
+		{"down first", down, busy, 1},
+		{"down second", idle, down, 0},
+		{"down, unknown", down, old, 1},
+		{"both down", down, downed, 0},
+	} {
+		if want, have := testcase.want, chooseIngester(testcase.a, testcase.b); want != have {
+			t.Errorf("%s: want %d, have %d", testcase.name, want, have)
+		}
+	}
+}
+
+func TestShouldRebalance(t *testing.T) {
+	t.Parallel()
+
+	load := func(conns int) ingestProbe {
+		return ingestProbe{load: ingest.Load{Connections: conns}, known: true}
+	}
+	for _, testcase := range []struct {
+		name           string
+		current, other ingestProbe
+		want           bool
+	}{
+		{"much busier", load(10), load(2), true},
+		{"two more", load(3), load(1), true},
+		{"one more", load(3), load(2), false}, // they'd trade places
+		{"even", load(3), load(3), false},
+		{"less busy", load(1), load(5), false},
+		{"unknown current", ingestProbe{}, load(0), false},
+		{"unknown other", load(9), ingestProbe{}, false},
+		{"other down", load(9), ingestProbe{err: errors.New("connection refused")}, false},
+	} {
+		if want, have := testcase.want, shouldRebalance(testcase.current, testcase.other); want != have {
+			t.Errorf("%s: want %v, have %v", testcase.name, want, have)
+		}
+	}
+}
+
+func TestForwardBalance(t *testing.T) {
+	t.Parallel()
+
+	// Three ingesters, each of which says which it is, of every connection
+	// it reads a record from, so its load counts the connection by then.
+	var (
+		connected = make(chan int, 100)
+		addrs     []string
+	)
+	for i := 0; i < 3; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		ingestLog, err := ingest.NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		i := i
+		handler := func(r record.Reader, w *ingest.Writer, idGen ingest.IDGenerator, connectedClients prometheus.Gauge) error {
+			if _, err := r(); err != nil {
+				return nil
+			}
+			connected <- i
+			for {
+				if _, err := r(); err != nil {
+					return nil
+				}
+			}
+		}
+		go ingest.HandleConnections(ln, ingest.ConnectionConfig{
+			Handler:          handler,
+			ReaderFactory:    record.NewDynamicReader,
+			Log:              ingestLog,
+			SegmentFlushAge:  time.Hour,
+			SegmentFlushSize: 1024 * 1024,
+			ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+			Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+			Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+			Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+			SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		})
+		addrs = append(addrs, "tcp://"+ln.Addr().String())
+	}
+	newDialer := func(addrs ...string) *ingestDialer {
+		urls, err := parseIngestURLs(addrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newIngestDialer(urls, nil, "", false, false, true, nil, nil, log.NewNopLogger())
+	}
+	connect := func(d *ingestDialer) (net.Conn, int) {
+		conn, err := d.dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(conn, "topic record\n")
+		select {
+		case i := <-connected:
+			return conn, i
+		case <-time.After(5 * time.Second):
+			t.Fatal("no record")
+			return nil, 0
+		}
+	}
+
+	// Forwarders connecting one after another spread out evenly, though
+	// each only asks two of the ingesters.
+	var (
+		conns  []net.Conn
+		counts = make([]int, len(addrs))
+	)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for k := 0; k < 30; k++ {
+		conn, i := connect(newDialer(addrs...))
+		conns = append(conns, conn)
+		counts[i]++
+	}
+	for _, have := range counts {
+		if have < 7 || have > 13 {
+			t.Errorf("want about 10 connections to each ingester, have %v", counts)
+			break
+		}
+	}
+
+	// Piled onto one ingester, a forwarder rebalances to a less loaded
+	// one; once it's even, it stays.
+	for k := 0; k < 10; k++ {
+		conn, _ := connect(newDialer(addrs[0]))
+		conns = append(conns, conn)
+	}
+	d := newDialer(addrs[0], addrs[1])
+	connectedTo := func(addr string) {
+		u, err := url.Parse(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.current = u
+	}
+	connectedTo(addrs[0])
+	var rebalanced bool
+	for k := 0; k < 10 && !rebalanced; k++ {
+		rebalanced = d.rebalance() // the other is chosen at random
+	}
+	if !rebalanced {
+		t.Errorf("want a rebalance from %s, with 10 more connections than %s", addrs[0], addrs[1])
+	}
+	connectedTo(addrs[1])
+	for k := 0; k < 10; k++ {
+		if d.rebalance() {
+			t.Fatalf("want no rebalance from %s, which is less loaded than %s", addrs[1], addrs[0])
+		}
+	}
+}
+
+func TestForwardRebalance(t *testing.T) {
+	t.Parallel()
+
+	// An ingester that acknowledges everything, and says when each
+	// connection is accepted.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var (
+		accepted = make(chan struct{}, 10)
+		received = make(chan string, 100)
+	)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- struct{}{}
+			s := bufio.NewScanner(conn)
+			if !s.Scan() || s.Text() != ingest.AckHandshake {
+				t.Errorf("want %s handshake, have %q", ingest.AckHandshake, s.Text())
+			}
+			go ackAll(conn, s, received)
+		}
+	}()
+	urls, err := parseIngestURLs([]string{"tcp://" + ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := newForwardTarget(
+		"rebalance",
+		newIngestDialer(urls, nil, "", true, false, false, nil, nil, log.NewNopLogger()).dial,
+		prefixer{},
+		false,
+		true,
+		nil,
+		0,
+		newForwardMetrics(prometheus.NewRegistry()),
+		log.NewNopLogger(),
+	)
+	asked := make(chan struct{}, 100)
+	target.rebalance = func() bool {
+		asked <- struct{}{}
+		return len(asked) == 1 // just the first time
+	}
+	target.rebalanceInterval = 10 * time.Millisecond
+
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- forwardLines(pr, false, nil, []*forwardTarget{target}, mirrorPolicyBlock, log.NewNopLogger())
+	}()
+	await := func(c <-chan struct{}, what string) {
+		select {
+		case <-c:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s", what)
+		}
+	}
+
+	// Records written before the target rebalances are acknowledged on
+	// the first connection, so none are written again on the second.
+	await(accepted, "connection")
+	io.WriteString(pw, strings.Join(lines("before", 10), "\n")+"\n")
+	have := receive(t, received, 10)
+	await(asked, "rebalance")
+	await(accepted, "second connection")
+	io.WriteString(pw, strings.Join(lines("after", 10), "\n")+"\n")
+	pw.Close()
+	have = append(have, receive(t, received, 10)...)
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("forwarder never finished")
+	}
+	if want := append(lines("before", 10), lines("after", 10)...); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := 1.0, counterValue(target.metrics.rebalances.WithLabelValues(target.name)); want != have {
+		t.Errorf("rebalances: want %v, have %v", want, have)
+	}
+	if want, have := 0.0, counterValue(target.metrics.retransmits.WithLabelValues(target.name)); want != have {
+		t.Errorf("retransmitted: want %v, have %v", want, have)
+	}
+}
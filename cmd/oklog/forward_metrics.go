@@ -0,0 +1,242 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/spool"
+)
+
+// Reasons for records dropped by the forwarder.
+const (
+	dropReasonQueueFull  = "queue_full"  // the target was down, with -forward.mirror-policy=drop
+	dropReasonEvicted    = "evicted"     // spooled, and evicted past -forward.buffer-size
+	dropReasonSpoolError = "spool_error" // couldn't be spooled
+)
+
+// forwardMetrics tracks the health of the forwarder's connection to each
+// target cluster, labeled by the target's ingest addresses.
+// A nil *forwardMetrics is valid, and records nothing.
+type forwardMetrics struct {
+	records        *prometheus.CounterVec
+	bytes          *prometheus.CounterVec
+	disconnects    *prometheus.CounterVec
+	reconnects     *prometheus.CounterVec
+	rebalances     *prometheus.CounterVec
+	shortWrites    *prometheus.CounterVec
+	retransmits    *prometheus.CounterVec
+	drops          *prometheus.CounterVec
+	lastWrite      *prometheus.GaugeVec
+	connected      *prometheus.GaugeVec
+	bufferRecords  *prometheus.GaugeVec
+	bufferBytes    *prometheus.GaugeVec
+	corruptBuffers *prometheus.CounterVec
+	uncompressed   *prometheus.CounterVec
+	compressed     *prometheus.CounterVec
+	rotations      prometheus.Counter
+	truncations    prometheus.Counter
+}
+
+// newForwardMetrics returns forwarder metrics registered with r.
+// If r is nil, newForwardMetrics returns nil, and no metrics are recorded.
+func newForwardMetrics(r prometheus.Registerer) *forwardMetrics {
+	if r == nil {
+		return nil
+	}
+	m := &forwardMetrics{
+		records: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "forward_records_total",
+			Help:      "Records forwarded.",
+		}, []string{"target"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "forward_bytes_total",
+			Help:      "Bytes forwarded.",
+		}, []string{"target"}),
+		disconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "forward_disconnects",
+			Help:      "Number of times forwarder is disconnected from ingester.",
+		}, []string{"target"}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "forward_reconnects_total",
+			Help:      "Connections made to an ingester after the first.",
+		}, []string{"target"}),
+		rebalances: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "forward_rebalances_total",
+			Help:      "Connections left for a less loaded ingester, with -forward.rebalance-interval.",
+		}, []string{"target"}),
+		shortWrites: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "forward_short_writes",
+			Help:      "Number of times forwarder performs a short write to the ingester.",
+		}, []string{"target"}),
+		retransmits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "forward_retransmitted_records_total",
+			Help:      "Records written again, because the ingester didn't acknowledge them, with -forward.acks.",
+		}, []string{"target"}),
+		drops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "forward_dropped_records_total",
+			Help:      "Records dropped before they were forwarded.",
+		}, []string{"target", "reason"}),
+		lastWrite: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "oklog",
+			Name:      "forward_last_write_timestamp_seconds",
+			Help:      "Unix time of the last record written to an ingester.",
+		}, []string{"target"}),
+		connected: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "oklog",
+			Name:      "forward_connected",
+			Help:      "1 for the ingester address currently connected to.",
+		}, []string{"target", "addr"}),
+		bufferRecords: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "oklog",
+			Name:      "forward_buffer_records",
+			Help:      "Records spooled, waiting for an ingest node.",
+		}, []string{"target"}),
+		bufferBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "oklog",
+			Name:      "forward_buffer_bytes",
+			Help:      "Size of the spool.",
+		}, []string{"target"}),
+		corruptBuffers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "forward_buffer_corrupt_segments_total",
+			Help:      "Spool segments whose partial or corrupt tail was skipped.",
+		}, []string{"target"}),
+		uncompressed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "forward_snappy_uncompressed_bytes_total",
+			Help:      "Bytes written to ingesters with -forward.snappy, before they're compressed.",
+		}, []string{"target"}),
+		compressed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "forward_snappy_compressed_bytes_total",
+			Help:      "Bytes written to ingesters with -forward.snappy, as they're sent.",
+		}, []string{"target"}),
+		rotations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "forward_file_rotations_total",
+			Help:      "Tailed files that were rotated, and reopened.",
+		}),
+		truncations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "forward_file_truncations_total",
+			Help:      "Tailed files that were truncated, and read again from the start.",
+		}),
+	}
+	r.MustRegister(
+		m.records,
+		m.bytes,
+		m.disconnects,
+		m.reconnects,
+		m.rebalances,
+		m.shortWrites,
+		m.retransmits,
+		m.drops,
+		m.lastWrite,
+		m.connected,
+		m.bufferRecords,
+		m.bufferBytes,
+		m.corruptBuffers,
+		m.uncompressed,
+		m.compressed,
+		m.rotations,
+		m.truncations,
+	)
+	return m
+}
+
+func (m *forwardMetrics) wrote(target string, record []byte) {
+	if m == nil {
+		return
+	}
+	m.records.WithLabelValues(target).Inc()
+	m.bytes.WithLabelValues(target).Add(float64(len(record)))
+	m.lastWrite.WithLabelValues(target).Set(float64(time.Now().UnixNano()) / 1e9)
+}
+
+func (m *forwardMetrics) connectedTo(target, addr string, reconnect bool) {
+	if m == nil {
+		return
+	}
+	if reconnect {
+		m.reconnects.WithLabelValues(target).Inc()
+	}
+	m.connected.WithLabelValues(target, addr).Set(1)
+}
+
+func (m *forwardMetrics) disconnectedFrom(target, addr string, shortWrite bool) {
+	if m == nil {
+		return
+	}
+	if shortWrite {
+		m.shortWrites.WithLabelValues(target).Inc()
+	} else {
+		m.disconnects.WithLabelValues(target).Inc()
+	}
+	m.connected.DeleteLabelValues(target, addr)
+}
+
+func (m *forwardMetrics) rebalanced(target string) {
+	if m == nil {
+		return
+	}
+	m.rebalances.WithLabelValues(target).Inc()
+}
+
+func (m *forwardMetrics) retransmitted(target string, n int) {
+	if m == nil {
+		return
+	}
+	m.retransmits.WithLabelValues(target).Add(float64(n))
+}
+
+func (m *forwardMetrics) dropped(target, reason string) {
+	if m == nil {
+		return
+	}
+	m.drops.WithLabelValues(target, reason).Inc()
+}
+
+// buffered records the depth of the target's spool.
+func (m *forwardMetrics) buffered(target string, sp *spool.Spool) {
+	if m == nil || sp == nil {
+		return
+	}
+	m.bufferRecords.WithLabelValues(target).Set(float64(sp.Len()))
+	m.bufferBytes.WithLabelValues(target).Set(float64(sp.Size()))
+}
+
+// spoolCounters returns the counters for a target's spool to report evicted
+// records and corrupt segments to.
+func (m *forwardMetrics) spoolCounters(target string) (evicted, corrupt prometheus.Counter) {
+	if m == nil {
+		return prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{})
+	}
+	return m.drops.WithLabelValues(target, dropReasonEvicted), m.corruptBuffers.WithLabelValues(target)
+}
+
+// snappyCounters returns the counters for a target's connections to report
+// the bytes they compress, and the compressed bytes they write, to.
+func (m *forwardMetrics) snappyCounters(target string) (uncompressed, compressed prometheus.Counter) {
+	if m == nil {
+		return nil, nil
+	}
+	return m.uncompressed.WithLabelValues(target), m.compressed.WithLabelValues(target)
+}
+
+// tailCounters returns the counters for the tailer to report rotated and
+// truncated files to.
+func (m *forwardMetrics) tailCounters() (rotations, truncations prometheus.Counter) {
+	if m == nil {
+		return prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{})
+	}
+	return m.rotations, m.truncations
+}
@@ -0,0 +1,1174 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/oklog/oklog/pkg/forward"
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/spool"
+)
+
+func TestForwardOutage(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name  string
+		spool bool
+	}{
+		{"with spool", true},
+		{"without spool", false},
+	} {
+		testcase := testcase
+		t.Run(testcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			received := make(chan string, 1000)
+			ingester := newFakeIngester(t, "127.0.0.1:0", received)
+			addr := ingester.addr()
+
+			var sp *spool.Spool
+			if testcase.spool {
+				var err error
+				sp, err = spool.Open(fs.NewVirtualFilesystem(), "/spool", 1024*1024, false, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer sp.Close()
+			}
+			var (
+				target = newTestTarget(addr, prefixer{}, sp, 0)
+				pr, pw = io.Pipe()
+				errc   = make(chan error, 1)
+			)
+			go func() {
+				errc <- forwardLines(pr, false, nil, []*forwardTarget{target}, mirrorPolicyBlock, log.NewNopLogger())
+			}()
+
+			// While connected, records go straight thru.
+			write := func(name string, n int) {
+				for i := 0; i < n; i++ {
+					fmt.Fprintf(pw, "%s %d\n", name, i)
+				}
+			}
+			write("before", 10)
+			if want, have := lines("before", 10), receive(t, received, 10); !reflect.DeepEqual(want, have) {
+				t.Fatalf("want %q, have %q", want, have)
+			}
+
+			// Kill the ingester mid-stream. Once the forwarder notices,
+			// records wait for it: spooled, or, without a spool, unread.
+			ingester.stop()
+			if !within(5*time.Second, func() bool { return counterValue(target.metrics.disconnects.WithLabelValues(target.name)) > 0 }) {
+				t.Fatal("forwarder never noticed the ingester was gone")
+			}
+			const n = 100
+			done := make(chan struct{})
+			go func() {
+				write("during", n)
+				close(done)
+			}()
+			if testcase.spool {
+				<-done
+				if !within(5*time.Second, func() bool { return sp.Len() == n }) {
+					t.Fatalf("want %d spooled records, have %d", n, sp.Len())
+				}
+			}
+
+			// Restore it. Every record arrives, in order.
+			ingester = newFakeIngester(t, addr, received)
+			defer ingester.stop()
+			<-done
+			write("after", 10)
+			pw.Close()
+			want := append(lines("during", n), lines("after", 10)...)
+			if have := receive(t, received, len(want)); !reflect.DeepEqual(want, have) {
+				t.Fatalf("want %q, have %q", want, have)
+			}
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+			if sp != nil && sp.Len() != 0 {
+				t.Errorf("want an empty spool, have %d records", sp.Len())
+			}
+		})
+	}
+}
+
+func TestForwardMirror(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		policy string
+		queue  int
+	}{
+		{mirrorPolicyBlock, 0},
+		{mirrorPolicyDrop, 20},
+	} {
+		testcase := testcase
+		t.Run(testcase.policy, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				receivedA = make(chan string, 1000)
+				receivedB = make(chan string, 1000)
+				ingestA   = newFakeIngester(t, "127.0.0.1:0", receivedA)
+				ingestB   = newFakeIngester(t, "127.0.0.1:0", receivedB)
+				addrB     = ingestB.addr()
+				targetA   = newTestTarget(ingestA.addr(), prefixer{}, nil, testcase.queue)
+				targetB   = newTestTarget(addrB, prefixer{}, nil, testcase.queue)
+				pr, pw    = io.Pipe()
+				errc      = make(chan error, 1)
+			)
+			defer ingestA.stop()
+			go func() {
+				errc <- forwardLines(pr, false, nil, []*forwardTarget{targetA, targetB}, testcase.policy, log.NewNopLogger())
+			}()
+
+			// Paced, so a healthy target never falls a queue behind.
+			write := func(name string, n int) {
+				for i := 0; i < n; i++ {
+					fmt.Fprintf(pw, "%s %d\n", name, i)
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			// Every record goes to both.
+			write("before", 10)
+			for _, received := range []chan string{receivedA, receivedB} {
+				if want, have := lines("before", 10), receive(t, received, 10); !reflect.DeepEqual(want, have) {
+					t.Fatalf("want %q, have %q", want, have)
+				}
+			}
+
+			// Take B down.
+			ingestB.stop()
+			if !within(5*time.Second, func() bool { return counterValue(targetB.metrics.disconnects.WithLabelValues(targetB.name)) > 0 }) {
+				t.Fatal("forwarder never noticed B was gone")
+			}
+			const n = 100
+			done := make(chan struct{})
+			go func() {
+				write("during", n)
+				close(done)
+			}()
+
+			switch testcase.policy {
+			case mirrorPolicyBlock:
+				// A gets no more than the record B is holding up.
+				time.Sleep(100 * time.Millisecond)
+				if have := len(receivedA); have > 1 {
+					t.Fatalf("with B down, A received %d records", have)
+				}
+
+			case mirrorPolicyDrop:
+				// A carries on, while B drops what it can't queue.
+				if want, have := lines("during", n), receive(t, receivedA, n); !reflect.DeepEqual(want, have) {
+					t.Fatalf("want %q, have %q", want, have)
+				}
+				<-done
+				if want, have := float64(n-testcase.queue), counterValue(targetB.metrics.drops.WithLabelValues(targetB.name, dropReasonQueueFull)); want != have {
+					t.Fatalf("B dropped: want %v, have %v", want, have)
+				}
+			}
+
+			// Bring B back. It gets what it didn't drop.
+			ingestB = newFakeIngester(t, addrB, receivedB)
+			defer ingestB.stop()
+			<-done
+			wantA := append(lines("during", n), lines("after", 10)...)
+			wantB := wantA
+			if testcase.policy == mirrorPolicyDrop {
+				// Until it's reconnected, B is still down.
+				if want, have := lines("during", testcase.queue), receive(t, receivedB, testcase.queue); !reflect.DeepEqual(want, have) {
+					t.Fatalf("B: want %q, have %q", want, have)
+				}
+				wantA, wantB = lines("after", 10), lines("after", 10)
+			}
+			write("after", 10)
+			pw.Close()
+			if have := receive(t, receivedA, len(wantA)); !reflect.DeepEqual(wantA, have) {
+				t.Errorf("A: want %q, have %q", wantA, have)
+			}
+			if have := receive(t, receivedB, len(wantB)); !reflect.DeepEqual(wantB, have) {
+				t.Errorf("B: want %q, have %q", wantB, have)
+			}
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+			if want, have := 0.0, counterValue(targetA.metrics.drops.WithLabelValues(targetA.name, dropReasonQueueFull)); want != have {
+				t.Errorf("A dropped: want %v, have %v", want, have)
+			}
+		})
+	}
+}
+
+func TestForwardGoAway(t *testing.T) {
+	t.Parallel()
+
+	var (
+		receivedA = make(chan string, 100)
+		receivedB = make(chan string, 100)
+		ingestA   = newFakeIngester(t, "127.0.0.1:0", receivedA)
+		ingestB   = newFakeIngester(t, "127.0.0.1:0", receivedB)
+		addrs     = []string{ingestA.addr(), ingestB.addr()}
+		dials     int
+	)
+	defer ingestA.stop()
+	defer ingestB.stop()
+	dial := func() (net.Conn, error) {
+		addr := addrs[dials%len(addrs)]
+		dials++
+		return net.Dial("tcp", addr)
+	}
+	var (
+		target = newForwardTarget("A,B", dial, prefixer{}, false, false, nil, 0, newForwardMetrics(prometheus.NewRegistry()), log.NewNopLogger())
+		pr, pw = io.Pipe()
+		errc   = make(chan error, 1)
+	)
+	go func() {
+		errc <- forwardLines(pr, false, nil, []*forwardTarget{target}, mirrorPolicyBlock, log.NewNopLogger())
+	}()
+	for _, line := range lines("before", 10) {
+		fmt.Fprintln(pw, line)
+	}
+	if want, have := lines("before", 10), receive(t, receivedA, 10); !reflect.DeepEqual(want, have) {
+		t.Fatalf("A: want %q, have %q", want, have)
+	}
+
+	// A goes away, without closing the connection, or its listener. The
+	// forwarder fails over to B, right away.
+	ingestA.goAway()
+	if !within(time.Second, func() bool { return counterValue(target.metrics.disconnects.WithLabelValues(target.name)) > 0 }) {
+		t.Fatal("forwarder never noticed A going away")
+	}
+	for _, line := range lines("after", 10) {
+		fmt.Fprintln(pw, line)
+	}
+	pw.Close()
+	if want, have := lines("after", 10), receive(t, receivedB, 10); !reflect.DeepEqual(want, have) {
+		t.Fatalf("B: want %q, have %q", want, have)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-receivedA:
+		t.Errorf("A: got %q after going away", line)
+	default:
+	}
+}
+
+func TestPrefixer(t *testing.T) {
+	t.Parallel()
+
+	now := func() time.Time { return time.Date(2017, 1, 2, 3, 4, 5, 6000000, time.FixedZone("CET", 3600)) }
+	for _, testcase := range []struct {
+		name   string
+		p      prefixer
+		record string
+		want   string
+	}{
+		{"none", prefixer{separator: " "}, "hello\n", "hello\n"},
+		{"static", prefixer{static: []string{"topic"}, separator: " "}, "hello\n", "topic hello\n"},
+		{"several static", prefixer{static: []string{"topic", "app=foo"}, separator: " "}, "hello\n", "topic app=foo hello\n"},
+		{"hostname", prefixer{hostname: "host1", separator: " "}, "hello\n", "host1 hello\n"},
+		{"timestamp", prefixer{timestamp: true, separator: " ", now: now}, "hello\n", "2017-01-02T02:04:05.006Z hello\n"},
+		{"all", prefixer{static: []string{"topic"}, hostname: "host1", timestamp: true, separator: " ", now: now}, "hello\n", "topic host1 2017-01-02T02:04:05.006Z hello\n"},
+		{"separator", prefixer{static: []string{"topic"}, hostname: "host1", separator: " | "}, "hello\n", "topic | host1 | hello\n"},
+		{"leading space", prefixer{static: []string{"topic"}, separator: " "}, "  indented\n", "topic   indented\n"},
+		{"leading tab", prefixer{hostname: "host1", separator: " "}, "\tat main.go:1\n", "host1 \tat main.go:1\n"},
+		{"empty record", prefixer{static: []string{"topic"}, separator: " "}, "\n", "topic \n"},
+		{"client time first", prefixer{static: []string{"topic"}, hostname: "host1", clientTime: true, separator: " | "}, "1483322645006 hello\n", "1483322645006 topic | host1 | hello\n"},
+		{"client time alone", prefixer{clientTime: true, separator: " "}, "1483322645006 hello\n", "1483322645006 hello\n"},
+		{"topic", prefixer{topics: mustTopicRouter(``, "payments"), separator: " | "}, "hello\n", "payments hello\n"},
+		{"routed topic", prefixer{topics: mustTopicRouter(`service=(\w+)`, ""), hostname: "host1", separator: " | "}, "service=web hello\n", "web host1 | service=web hello\n"},
+		{"unrouted topic", prefixer{topics: mustTopicRouter(`service=(\w+)`, ""), separator: " "}, "hello\n", "default hello\n"},
+		{"client time before topic", prefixer{topics: mustTopicRouter(`service=(\w+)`, ""), clientTime: true, separator: " "}, "1483322645006 service=web hello\n", "1483322645006 web service=web hello\n"},
+	} {
+		if want, have := testcase.want, string(testcase.p.prefix([]byte(testcase.record))); want != have {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+	}
+}
+
+func mustTopicRouter(pattern, fallback string) *forward.TopicRouter {
+	var re *regexp.Regexp
+	if pattern != "" {
+		re = regexp.MustCompile(pattern)
+	}
+	r, err := forward.NewTopicRouter(re, fallback)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func TestForwardPrefix(t *testing.T) {
+	t.Parallel()
+
+	// A record spooled by a previous run, before the ingester was reachable.
+	filesys := fs.NewVirtualFilesystem()
+	sp, err := spool.Open(filesys, "/spool", 1024*1024, false, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sp.Append([]byte("  spooled\n")); err != nil {
+		t.Fatal(err)
+	}
+	sp.Close()
+	if sp, err = spool.Open(filesys, "/spool", 1024*1024, false, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{})); err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+
+	received := make(chan string, 10)
+	ingester := newFakeIngester(t, "127.0.0.1:0", received)
+	defer ingester.stop()
+	addr := ingester.addr()
+	p := prefixer{
+		static:    []string{"topic"},
+		hostname:  "host1",
+		timestamp: true,
+		separator: " ",
+		now:       func() time.Time { return time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+	target := newTestTarget(addr, p, sp, 0)
+	if err := forwardLines(strings.NewReader("hello\n\tworld\n"), false, nil, []*forwardTarget{target}, mirrorPolicyBlock, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The replayed record is prefixed like the rest, and the prefixes
+	// count as forwarded bytes.
+	want := []string{
+		"topic host1 2017-01-02T03:04:05Z   spooled",
+		"topic host1 2017-01-02T03:04:05Z hello",
+		"topic host1 2017-01-02T03:04:05Z \tworld",
+	}
+	if have := receive(t, received, len(want)); !reflect.DeepEqual(want, have) {
+		t.Fatalf("want %q, have %q", want, have)
+	}
+	var n int
+	for _, line := range want {
+		n += len(line) + 1
+	}
+	if want, have := float64(n), counterValue(target.metrics.bytes.WithLabelValues(target.name)); want != have {
+		t.Errorf("forwarded bytes: want %v, have %v", want, have)
+	}
+}
+
+func TestForwardBufferLocked(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "oklog-forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The first forwarder's spool, and then a second forwarder, which
+	// gives up straight away, rather than share it.
+	sp, err := spool.Open(fs.NewRealFilesystem(), dir, 1024*1024, false, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- runForward([]string{"-forward.buffer-dir", dir, "-forward.buffer-takeover", "localhost:1"})
+	}()
+	select {
+	case err := <-errc:
+		if err == nil || !strings.Contains(err.Error(), "in use by another forwarder") {
+			t.Fatalf("want the buffer in use, have %v", err)
+		}
+		if have := err.Error(); !strings.Contains(have, fmt.Sprintf("process %d", os.Getpid())) {
+			t.Errorf("want the owner's PID, have %s", have)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the second forwarder to fail")
+	}
+}
+
+func TestForwardMetrics(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan string, 100)
+	ingester := newFakeIngester(t, "127.0.0.1:0", received)
+	addr := ingester.addr()
+	sp, err := spool.Open(fs.NewVirtualFilesystem(), "/spool", 1024*1024, false, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+	var (
+		registry = prometheus.NewRegistry()
+		metrics  = newForwardMetrics(registry)
+		target   = newForwardTarget(addr, func() (net.Conn, error) { return net.Dial("tcp", addr) }, prefixer{}, false, false, sp, 0, metrics, log.NewNopLogger())
+		server   = httptest.NewServer(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		pr, pw   = io.Pipe()
+		errc     = make(chan error, 1)
+	)
+	defer server.Close()
+	go func() {
+		errc <- forwardLines(pr, false, nil, []*forwardTarget{target}, mirrorPolicyBlock, log.NewNopLogger())
+	}()
+
+	// Records go thru, and are counted.
+	begin := time.Now()
+	fmt.Fprint(pw, "a\nbb\nccc\n")
+	receive(t, received, 3)
+	have := scrape(t, server.URL)
+	for name, want := range map[string]float64{
+		`oklog_forward_records_total{target="` + addr + `"}`:                 3,
+		`oklog_forward_bytes_total{target="` + addr + `"}`:                   9,
+		`oklog_forward_connected{addr="` + addr + `",target="` + addr + `"}`: 1,
+		`oklog_forward_buffer_records{target="` + addr + `"}`:                0,
+	} {
+		if have, ok := have[name]; !ok || want != have {
+			t.Errorf("%s: want %v, have %v", name, want, have)
+		}
+	}
+	if last := have[`oklog_forward_last_write_timestamp_seconds{target="`+addr+`"}`]; last < float64(begin.Unix()) {
+		t.Errorf("last write: want after %d, have %v", begin.Unix(), last)
+	}
+
+	// Once the ingester is back, the reconnect is counted.
+	ingester.stop()
+	if !within(5*time.Second, func() bool { return counterValue(metrics.disconnects.WithLabelValues(addr)) > 0 }) {
+		t.Fatal("forwarder never noticed the ingester was gone")
+	}
+	ingester = newFakeIngester(t, addr, received)
+	defer ingester.stop()
+	fmt.Fprint(pw, "dddd\n")
+	pw.Close()
+	receive(t, received, 1)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	have = scrape(t, server.URL)
+	for name, want := range map[string]float64{
+		`oklog_forward_records_total{target="` + addr + `"}`:    4,
+		`oklog_forward_disconnects{target="` + addr + `"}`:      1,
+		`oklog_forward_reconnects_total{target="` + addr + `"}`: 1,
+	} {
+		if have, ok := have[name]; !ok || want != have {
+			t.Errorf("%s: want %v, have %v", name, want, have)
+		}
+	}
+}
+
+// scrape returns the samples served at url's /metrics, by name and labels.
+func scrape(t *testing.T, url string) map[string]float64 {
+	t.Helper()
+	resp, err := http.Get(url + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	samples := map[string]float64{}
+	s := bufio.NewScanner(resp.Body)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		f, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			t.Fatalf("%s: %v", s.Text(), err)
+		}
+		samples[fields[0]] = f
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return samples
+}
+
+func newTestTarget(addr string, prefix prefixer, sp *spool.Spool, queue int) *forwardTarget {
+	return newForwardTarget(
+		addr,
+		func() (net.Conn, error) { return net.Dial("tcp", addr) },
+		prefix,
+		false,
+		false,
+		sp,
+		queue,
+		newForwardMetrics(prometheus.NewRegistry()),
+		log.NewNopLogger(),
+	)
+}
+
+func TestForwardFramed(t *testing.T) {
+	t.Parallel()
+
+	// The ingest node's side, which reads records as a real one would.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := record.NewDynamicReader(conn)
+		for {
+			rec, err := r()
+			if err != nil {
+				return
+			}
+			received <- string(record.Unescape(rec[:len(rec)-1]))
+		}
+	}()
+
+	urls, err := parseIngestURLs([]string{"tcp://" + ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := newForwardTarget(
+		"framed",
+		newIngestDialer(urls, nil, "", false, true, false, nil, nil, log.NewNopLogger()).dial,
+		prefixer{static: []string{"topic"}, separator: " "},
+		true,
+		false,
+		nil,
+		0,
+		newForwardMetrics(prometheus.NewRegistry()),
+		log.NewNopLogger(),
+	)
+	want := []string{
+		"topic multi\nline\n",
+		"topic binary \x00\xff\r\\n",
+		"topic ",
+	}
+	var input []byte
+	for _, rec := range want {
+		input = record.AppendFrame(input, []byte(strings.TrimPrefix(rec, "topic ")))
+	}
+	if err := forwardLines(bytes.NewReader(input), true, nil, []*forwardTarget{target}, mirrorPolicyBlock, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if have := receive(t, received, len(want)); !reflect.DeepEqual(want, have) {
+		t.Fatalf("want %q, have %q", want, have)
+	}
+}
+
+func TestForwardAcks(t *testing.T) {
+	t.Parallel()
+
+	// The first connection is lost, or stalls, after the ingester reads
+	// some records, and before it acknowledges them all. The second
+	// acknowledges everything.
+	for _, testcase := range []struct {
+		name          string
+		spooled       bool
+		first         func(conn net.Conn, s *bufio.Scanner, received chan<- string)
+		want          []string // on the second connection
+		retransmitted float64  // at least
+	}{
+		{"lost", false, loseAfter(3, 2), lines("record", 10)[2:], 1},
+		{"lost, spooled", true, loseAfter(3, 2), lines("record", 10)[2:], 1},
+		{"stalled", false, neverAck, lines("record", 10), 10},
+		{"stalled, spooled", true, neverAck, lines("record", 10), 10},
+	} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			first  = make(chan string, 100)
+			second = make(chan string, 100)
+		)
+		go func() {
+			for i := 0; ; i++ {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				s := bufio.NewScanner(conn)
+				if !s.Scan() || s.Text() != ingest.AckHandshake {
+					t.Errorf("%s: want %s handshake, have %q", testcase.name, ingest.AckHandshake, s.Text())
+				}
+				if i == 0 {
+					go testcase.first(conn, s, first)
+				} else {
+					go ackAll(conn, s, second)
+				}
+			}
+		}()
+
+		var sp *spool.Spool
+		if testcase.spooled {
+			sp, err = spool.Open(fs.NewVirtualFilesystem(), "/spool", 1024*1024, false, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		urls, err := parseIngestURLs([]string{"tcp://" + ln.Addr().String()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := newForwardTarget(
+			testcase.name,
+			newIngestDialer(urls, nil, "", true, false, false, nil, nil, log.NewNopLogger()).dial,
+			prefixer{},
+			false,
+			true,
+			sp,
+			0,
+			newForwardMetrics(prometheus.NewRegistry()),
+			log.NewNopLogger(),
+		)
+		target.ackTimeout = 100 * time.Millisecond
+		errc := make(chan error, 1)
+		go func() {
+			input := strings.Join(lines("record", 10), "\n") + "\n"
+			errc <- forwardLines(strings.NewReader(input), false, nil, []*forwardTarget{target}, mirrorPolicyBlock, log.NewNopLogger())
+		}()
+
+		// Whatever wasn't acknowledged is written again, and the
+		// forwarder is done only once it's all acknowledged.
+		if have := receive(t, second, len(testcase.want)); !reflect.DeepEqual(testcase.want, have) {
+			t.Errorf("%s: want %q, have %q", testcase.name, testcase.want, have)
+		}
+		select {
+		case err := <-errc:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: forwarder never finished", testcase.name)
+		}
+		if retransmitted := counterValue(target.metrics.retransmits.WithLabelValues(target.name)); retransmitted < testcase.retransmitted {
+			t.Errorf("%s: want at least %v retransmitted, have %v", testcase.name, testcase.retransmitted, retransmitted)
+		}
+		if sp != nil {
+			if want, have := 0, sp.Len(); want != have {
+				t.Errorf("%s: want %d records left in the spool, have %d", testcase.name, want, have)
+			}
+			sp.Close()
+		}
+		select {
+		case line := <-second:
+			t.Errorf("%s: unexpected %q", testcase.name, line)
+		default:
+		}
+		ln.Close()
+	}
+}
+
+// loseAfter returns an ingester's side of a connection that reads n
+// records, acknowledges the first acked, and hangs up, discarding whatever
+// else it reads.
+func loseAfter(n, acked int) func(net.Conn, *bufio.Scanner, chan<- string) {
+	return func(conn net.Conn, s *bufio.Scanner, received chan<- string) {
+		defer conn.Close()
+		for i := 0; i < n && s.Scan(); i++ {
+			received <- s.Text()
+		}
+		fmt.Fprintf(conn, "%s %d\n", ingest.Ack, acked)
+		conn.(*net.TCPConn).CloseWrite()
+		for s.Scan() {
+		}
+	}
+}
+
+// neverAck is an ingester's side of a connection that reads records, and
+// never acknowledges them.
+func neverAck(conn net.Conn, s *bufio.Scanner, received chan<- string) {
+	defer conn.Close()
+	for s.Scan() {
+		received <- s.Text()
+	}
+}
+
+// ackAll is an ingester's side of a connection that acknowledges every
+// record it reads.
+func ackAll(conn net.Conn, s *bufio.Scanner, received chan<- string) {
+	defer conn.Close()
+	for n := 1; s.Scan(); n++ {
+		received <- s.Text()
+		fmt.Fprintf(conn, "%s %d\n", ingest.Ack, n)
+	}
+}
+
+// fakeIngester accepts connections like an ingest node's fast API, and
+// sends every line it reads to received.
+type fakeIngester struct {
+	ln    net.Listener
+	mtx   sync.Mutex
+	conns []net.Conn
+}
+
+func newFakeIngester(t *testing.T, addr string, received chan<- string) *fakeIngester {
+	t.Helper()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := &fakeIngester{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			i.mtx.Lock()
+			i.conns = append(i.conns, conn)
+			i.mtx.Unlock()
+			go func() {
+				s := bufio.NewScanner(conn)
+				for s.Scan() {
+					received <- s.Text()
+				}
+			}()
+		}
+	}()
+	return i
+}
+
+func (i *fakeIngester) addr() string { return i.ln.Addr().String() }
+
+// goAway tells every client to go away, like a draining ingest node.
+func (i *fakeIngester) goAway() {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+	for _, conn := range i.conns {
+		fmt.Fprintln(conn, ingest.GoAway)
+	}
+}
+
+// stop closes the listener, and every connection.
+func (i *fakeIngester) stop() {
+	i.ln.Close()
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+	for _, conn := range i.conns {
+		conn.Close()
+	}
+	i.conns = nil
+}
+
+func lines(name string, n int) []string {
+	var lines []string
+	for i := 0; i < n; i++ {
+		lines = append(lines, fmt.Sprintf("%s %d", name, i))
+	}
+	return lines
+}
+
+func receive(t *testing.T, received <-chan string, n int) []string {
+	t.Helper()
+	var have []string
+	for len(have) < n {
+		select {
+		case line := <-received:
+			have = append(have, line)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("want %d records, have %d", n, len(have))
+		}
+	}
+	return have
+}
+
+func TestSayHello(t *testing.T) {
+	t.Parallel()
+
+	// A new ingester, which negotiates, an old one, which takes the hello
+	// for a record, and one that supports less than we want.
+	var (
+		received = make(chan []string, 1)
+		capture  = func(r record.Reader, w *ingest.Writer, idGen ingest.IDGenerator, connectedClients prometheus.Gauge) error {
+			var records []string
+			for {
+				rec, err := r()
+				if err != nil {
+					received <- records
+					return nil
+				}
+				records = append(records, string(rec))
+			}
+		}
+		answer = func(line string) func(net.Conn, *bufio.Scanner, chan<- string) {
+			return func(conn net.Conn, s *bufio.Scanner, lines chan<- string) {
+				defer conn.Close()
+				fmt.Fprintln(conn, line)
+				for s.Scan() {
+				}
+			}
+		}
+	)
+	for _, testcase := range []struct {
+		name     string
+		old      func(net.Conn, *bufio.Scanner, chan<- string) // if not the new ingester
+		features []string
+		want     string // error, if any
+	}{
+		{"new", nil, []string{ingest.FeatureAcks, ingest.FeatureFraming}, ""},
+		{"new, nothing", nil, nil, ""},
+		{"old", neverAck, []string{ingest.FeatureAcks}, errNoHello.Error()},
+		{"less", answer("OKLOG/1 acks"), []string{ingest.FeatureAcks, ingest.FeatureFraming}, "doesn't support framing"},
+		{"confused", answer("ERR what"), []string{ingest.FeatureAcks}, "unexpected answer"},
+	} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		hellos := make(chan string, 100)
+		if testcase.old == nil {
+			ingestLog, err := ingest.NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			go ingest.HandleConnections(ln, ingest.ConnectionConfig{
+				Handler:          capture,
+				ReaderFactory:    record.NewDynamicReader,
+				Log:              ingestLog,
+				SegmentFlushAge:  time.Hour,
+				SegmentFlushSize: 1024 * 1024,
+				ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+				Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+				Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+				Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+				SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+				SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			})
+		} else {
+			go func() {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				s := bufio.NewScanner(conn)
+				testcase.old(conn, s, hellos)
+			}()
+		}
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sayHello(conn, testcase.features, 250*time.Millisecond)
+		switch {
+		case testcase.want == "" && err != nil:
+			t.Errorf("%s: %v", testcase.name, err)
+		case testcase.want != "" && (err == nil || !strings.Contains(err.Error(), testcase.want)):
+			t.Errorf("%s: want error containing %q, have %v", testcase.name, testcase.want, err)
+		}
+
+		// With what's agreed, records go thru as they would have.
+		if testcase.old == nil {
+			rec := "topic a record\n"
+			if contains(testcase.features, ingest.FeatureFraming) {
+				rec = string(record.AppendFrame(nil, []byte("topic a\nrecord")))
+			}
+			io.WriteString(conn, rec)
+			conn.(*net.TCPConn).CloseWrite()
+			select {
+			case records := <-received:
+				if want, have := 1, len(records); want != have {
+					t.Errorf("%s: want %d record, have %q", testcase.name, want, records)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: no records", testcase.name)
+			}
+			remaining, _ := ioutil.ReadAll(conn)
+			if want, have := contains(testcase.features, ingest.FeatureAcks), bytes.Contains(remaining, []byte(ingest.Ack+" 1")); want != have {
+				t.Errorf("%s: want acknowledgement %v, have %q", testcase.name, want, remaining)
+			}
+		}
+		if testcase.name == "old" {
+			if want, have := ingest.Hello(testcase.features), <-hellos; want != have {
+				t.Errorf("%s: want the hello taken for a record, %q, have %q", testcase.name, want, have)
+			}
+		}
+		conn.Close()
+		ln.Close()
+	}
+}
+
+func TestForwardHello(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ingestLog, err := ingest.NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 100)
+	capture := func(r record.Reader, w *ingest.Writer, idGen ingest.IDGenerator, connectedClients prometheus.Gauge) error {
+		for {
+			rec, err := r()
+			if err != nil {
+				return nil
+			}
+			received <- string(rec)
+		}
+	}
+	go ingest.HandleConnections(ln, ingest.ConnectionConfig{
+		Handler:          capture,
+		ReaderFactory:    record.NewDynamicReader,
+		Log:              ingestLog,
+		SegmentFlushAge:  time.Hour,
+		SegmentFlushSize: 1024 * 1024,
+		ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+		Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+		Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+	})
+
+	// With acks and framing negotiated, the forwarder is done once every
+	// record is acknowledged, and multiline records arrive whole.
+	urls, err := parseIngestURLs([]string{"tcp://" + ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := newForwardTarget(
+		"hello",
+		newIngestDialer(urls, nil, "team-a", true, true, true, nil, nil, log.NewNopLogger()).dial,
+		prefixer{},
+		true,
+		true,
+		nil,
+		0,
+		newForwardMetrics(prometheus.NewRegistry()),
+		log.NewNopLogger(),
+	)
+	input := string(record.AppendFrame(record.AppendFrame(nil, []byte("topic one\nline")), []byte("topic two")))
+	errc := make(chan error, 1)
+	go func() {
+		errc <- forwardLines(strings.NewReader(input), true, nil, []*forwardTarget{target}, mirrorPolicyBlock, log.NewNopLogger())
+	}()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("forwarder never finished")
+	}
+	want := []string{"topic " + string(record.Escape([]byte("one\nline"))) + "\n", "topic " + string(record.Escape([]byte("two"))) + "\n"}
+	if have := receive(t, received, 2); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestForwardSnappy(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ingestLog, err := ingest.NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 100)
+	capture := func(r record.Reader, w *ingest.Writer, idGen ingest.IDGenerator, connectedClients prometheus.Gauge) error {
+		for {
+			rec, err := r()
+			if err != nil {
+				return nil
+			}
+			received <- string(rec)
+		}
+	}
+	var (
+		ingestCompressed   = prometheus.NewCounter(prometheus.CounterOpts{})
+		ingestUncompressed = prometheus.NewCounter(prometheus.CounterOpts{})
+	)
+	go ingest.HandleConnections(ln, ingest.ConnectionConfig{
+		Handler:           capture,
+		ReaderFactory:     record.NewDynamicReader,
+		Log:               ingestLog,
+		SegmentFlushAge:   time.Hour,
+		SegmentFlushSize:  1024 * 1024,
+		ConnectedClients:  prometheus.NewGauge(prometheus.GaugeOpts{}),
+		Bytes:             prometheus.NewCounter(prometheus.CounterOpts{}),
+		Records:           prometheus.NewCounter(prometheus.CounterOpts{}),
+		Syncs:             prometheus.NewCounter(prometheus.CounterOpts{}),
+		SegmentAge:        prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SegmentSize:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		CompressedBytes:   ingestCompressed,
+		UncompressedBytes: ingestUncompressed,
+	})
+
+	// The records are too few to fill a frame, so they're flushed by the
+	// interval, and acknowledged.
+	urls, err := parseIngestURLs([]string{"tcp://" + ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := newForwardMetrics(prometheus.NewRegistry())
+	uncompressed, compressed := metrics.snappyCounters("snappy")
+	target := newForwardTarget(
+		"snappy",
+		newIngestDialer(urls, nil, "team-a", true, false, true, &snappyOptions{10 * time.Millisecond, 1024 * 1024, uncompressed, compressed}, nil, log.NewNopLogger()).dial,
+		prefixer{},
+		false,
+		true,
+		nil,
+		0,
+		metrics,
+		log.NewNopLogger(),
+	)
+	var (
+		input string
+		want  []string
+	)
+	for i := 0; i < 10; i++ {
+		line := fmt.Sprintf(`topic {"level":"info","msg":"request served","path":"/api/v1/items","status":200,"n":%d}`, i) + "\n"
+		input += line
+		want = append(want, line)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- forwardLines(strings.NewReader(input), false, nil, []*forwardTarget{target}, mirrorPolicyBlock, log.NewNopLogger())
+	}()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("forwarder never finished")
+	}
+	if have := receive(t, received, len(want)); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	// Both ends count the same, and the records compress.
+	source := ingest.SourceHandshake + " team-a\n"
+	if want, have := float64(len(source+input)), counterValue(uncompressed); want != have {
+		t.Errorf("want %v uncompressed bytes written, have %v", want, have)
+	}
+	if want, have := counterValue(uncompressed), counterValue(ingestUncompressed); want != have {
+		t.Errorf("want %v uncompressed bytes read, have %v", want, have)
+	}
+	if want, have := counterValue(compressed), counterValue(ingestCompressed); want != have {
+		t.Errorf("want %v compressed bytes read, have %v", want, have)
+	}
+	if have, max := counterValue(compressed), counterValue(uncompressed)/2; have <= 0 || have > max {
+		t.Errorf("want up to %v compressed bytes, have %v", max, have)
+	}
+}
+
+func TestForwardBatches(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ingestLog, err := ingest.NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		received = make(chan string, 100)
+		syncs    = prometheus.NewCounter(prometheus.CounterOpts{})
+	)
+	durable := func(r record.Reader, w *ingest.Writer, idGen ingest.IDGenerator, connectedClients prometheus.Gauge) error {
+		for {
+			rec, err := r()
+			if err != nil {
+				return nil
+			}
+			if err := w.Sync(); err != nil {
+				return err
+			}
+			received <- string(rec)
+		}
+	}
+	go ingest.HandleConnections(ln, ingest.ConnectionConfig{
+		Handler:          durable,
+		ReaderFactory:    record.NewDynamicReader,
+		Log:              ingestLog,
+		SegmentFlushAge:  time.Hour,
+		SegmentFlushSize: 1024 * 1024,
+		ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+		Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+		Syncs:            syncs,
+		SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+	})
+
+	// Ten records, in batches of four; the last, of two, is flushed by the
+	// interval. Each is acknowledged.
+	urls, err := parseIngestURLs([]string{"tcp://" + ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := newForwardTarget(
+		"batches",
+		newIngestDialer(urls, nil, "team-a", true, false, true, nil, &batchOptions{10 * time.Millisecond, 4}, log.NewNopLogger()).dial,
+		prefixer{},
+		false,
+		true,
+		nil,
+		0,
+		newForwardMetrics(prometheus.NewRegistry()),
+		log.NewNopLogger(),
+	)
+	var (
+		input string
+		want  []string
+	)
+	for i := 0; i < 10; i++ {
+		line := fmt.Sprintf("topic record %d\n", i)
+		input += line
+		want = append(want, line)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- forwardLines(strings.NewReader(input), false, nil, []*forwardTarget{target}, mirrorPolicyBlock, log.NewNopLogger())
+	}()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("forwarder never finished")
+	}
+	if have := receive(t, received, len(want)); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := float64(3), counterValue(syncs); want != have {
+		t.Errorf("want %v syncs, one per batch, have %v", want, have)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	grpcapi "github.com/oklog/oklog/pkg/api/grpc"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// defaultGRPCPort is the port of -grpc-addr, if it's given without one.
+const defaultGRPCPort = 7654
+
+// listenGRPC binds the listener of -grpc-addr, or returns nil, if it's empty,
+// i.e. there's no gRPC API.
+func listenGRPC(addr string, logger log.Logger) (net.Listener, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	network, address, _, _, err := parseAddr(addr, defaultGRPCPort)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	level.Info(logger).Log("gRPC", fmt.Sprintf("%s://%s", network, address))
+	return ln, nil
+}
+
+// newGRPCServer returns a gRPC server of the API, with TLS, if config isn't
+// nil, which requires the auth token, if it isn't empty.
+func newGRPCServer(api *grpcapi.Server, config *tls.Config, token string) *grpc.Server {
+	var opts []grpc.ServerOption
+	if config != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config)))
+	}
+	if token != "" {
+		opts = append(opts, grpc.StreamInterceptor(requireGRPCToken(token)))
+	}
+	s := grpc.NewServer(opts...)
+	grpcapi.RegisterOKLogServer(s, api)
+	return s
+}
+
+// requireGRPCToken is requireToken for the gRPC API. Every call of the API
+// is a stream, so it's enough to intercept streams.
+func requireGRPCToken(token string) grpc.StreamServerInterceptor {
+	var (
+		want      = []byte("Bearer " + token)
+		principal = tokenPrincipal(token)
+	)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		var have []byte
+		if md, ok := metadata.FromIncomingContext(ss.Context()); ok && len(md["authorization"]) > 0 {
+			have = []byte(md["authorization"][0])
+		}
+		if subtle.ConstantTimeCompare(want, have) != 1 {
+			return status.Error(codes.Unauthenticated, "missing or invalid auth token")
+		}
+		return handler(srv, principalStream{ss, store.WithPrincipal(ss.Context(), principal)})
+	}
+}
+
+// principalStream carries the principal of an authenticated call.
+type principalStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s principalStream) Context() context.Context { return s.ctx }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// exitHandoffIncomplete is the exit status of an ingest node that shut down
+// with segments no store node has, so whatever's decommissioning it can tell.
+const exitHandoffIncomplete = 3
+
+// handOff pushes the segments left in an ingest log at shutdown to the store
+// nodes, for up to timeout. If any remain, it logs them, and fails with
+// exitHandoffIncomplete.
+func handOff(ingestLog ingest.Log, targets []string, client store.Doer, replicationFactor int, timeout time.Duration, logger log.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	level.Info(logger).Log("handoff", "starting", "store_nodes", len(targets), "timeout", timeout)
+	remaining := store.Handoff(ctx, ingestLog, client, targets, replicationFactor, store.LogReporter{Logger: logger})
+	if len(remaining) > 0 {
+		level.Error(logger).Log("handoff", "incomplete", "remaining", len(remaining), "segments", strings.Join(remaining, ","))
+		return exitError{
+			code: exitHandoffIncomplete,
+			err:  errors.Errorf("%d segment(s) not handed off to store nodes", len(remaining)),
+		}
+	}
+	level.Info(logger).Log("handoff", "complete")
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+func TestHandOff(t *testing.T) {
+	t.Parallel()
+
+	ingestLog, err := ingest.NewFileLog(fs.NewVirtualFilesystem(), "/ingest", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, records := range []string{"a 1\n", "rejected 2\n", "b 3\n"} {
+		w, err := ingestLog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(w, records)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A store node that refuses some segments.
+	picky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path != "/store"+store.APIPathReplicate || strings.HasPrefix(string(body), "rejected") {
+			http.Error(w, "no", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, "OK")
+	}))
+	defer picky.Close()
+	target := strings.TrimPrefix(picky.URL, "http://")
+
+	err = handOff(ingestLog, []string{target}, http.DefaultClient, 1, 100*time.Millisecond, log.NewNopLogger())
+	if want, have := exitHandoffIncomplete, exitCode(err); want != have {
+		t.Fatalf("with a segment refused: want exit status %d, have %d (%v)", want, have, err)
+	}
+	segment, err := ingestLog.Oldest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(segment)
+	segment.Failed()
+	if want, have := "rejected 2\n", string(b); want != have {
+		t.Errorf("segment left: want %q, have %q", want, have)
+	}
+	if want, have := int64(1), segmentsLeft(t, ingestLog); want != have {
+		t.Errorf("want %d segment left, have %d", want, have)
+	}
+
+	// With no store nodes, nothing's handed off either; with one that
+	// takes everything, it all is, and the node exits as usual.
+	if want, have := exitHandoffIncomplete, exitCode(handOff(ingestLog, nil, http.DefaultClient, 1, time.Second, log.NewNopLogger())); want != have {
+		t.Errorf("with no store nodes: want exit status %d, have %d", want, have)
+	}
+	accepting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { fmt.Fprintln(w, "OK") }))
+	defer accepting.Close()
+	if err := handOff(ingestLog, []string{strings.TrimPrefix(accepting.URL, "http://")}, http.DefaultClient, 1, time.Second, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := int64(0), segmentsLeft(t, ingestLog); want != have {
+		t.Errorf("want %d segments left, have %d", want, have)
+	}
+}
+
+func segmentsLeft(t *testing.T, ingestLog ingest.Log) int64 {
+	stats, err := ingestLog.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stats.FlushedSegments + stats.PendingSegments
+}
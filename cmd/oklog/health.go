@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+// readiness is the set of checks behind /readyz. A node is ready to take
+// traffic when all of them pass; /healthz only says the process is up.
+type readiness struct {
+	mtx    sync.Mutex
+	names  []string
+	checks map[string]func() error
+}
+
+func newReadiness() *readiness {
+	return &readiness{checks: map[string]func() error{}}
+}
+
+// add a check, which returns why the node isn't ready, or nil. A check of
+// the same name is replaced.
+func (r *readiness) add(name string, check func() error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.checks[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.checks[name] = check
+}
+
+// readyJSON is the body of /readyz: whether the node is ready, and the
+// result of each check, "ok" or why it failed.
+type readyJSON struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+func (r *readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mtx.Lock()
+	names := append([]string(nil), r.names...)
+	checks := make(map[string]func() error, len(r.checks))
+	for name, check := range r.checks {
+		checks[name] = check
+	}
+	r.mtx.Unlock()
+
+	// Checks may block, e.g. on a hung disk, so run them concurrently.
+	var (
+		wg      sync.WaitGroup
+		results = make([]error, len(names))
+	)
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, check func() error) {
+			defer wg.Done()
+			results[i] = check()
+		}(i, checks[name])
+	}
+	wg.Wait()
+
+	body := readyJSON{Ready: true, Checks: map[string]string{}}
+	for i, name := range names {
+		body.Checks[name] = "ok"
+		if results[i] != nil {
+			body.Ready = false
+			body.Checks[name] = results[i].Error()
+		}
+	}
+	buf, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if !body.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(append(buf, '\n'))
+}
+
+func registerReadyCheck(mux *http.ServeMux, ready *readiness) {
+	mux.Handle("/readyz", ready)
+}
+
+// readyFile is created and removed in a data dir, to check it's writable.
+const readyFile = "READY"
+
+// writableCheck checks that files can be created in dir.
+func writableCheck(filesys fs.Filesystem, dir string) func() error {
+	return func() error {
+		path := filepath.Join(dir, readyFile)
+		f, err := filesys.Create(path)
+		if err != nil {
+			return errors.Wrapf(err, "%s isn't writable", dir)
+		}
+		_, err = f.Write([]byte("ready\n"))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if rerr := filesys.Remove(path); err == nil {
+			err = rerr
+		}
+		return errors.Wrapf(err, "%s isn't writable", dir)
+	}
+}
+
+// peersCheck checks that the node sees at least min peers in the cluster,
+// including itself, so it isn't partitioned from the rest.
+func peersCheck(clusterSize func() int, min int) func() error {
+	return func() error {
+		if n := clusterSize(); n < min {
+			return fmt.Errorf("%d peer(s) in the cluster, want at least %d", n, min)
+		}
+		return nil
+	}
+}
+
+// stallCheck checks that a loop, which last made progress at the time given
+// by last, hasn't stalled for longer than threshold.
+func stallCheck(last func() time.Time, threshold time.Duration) func() error {
+	return func() error {
+		if d := time.Since(last()); d > threshold {
+			return fmt.Errorf("no progress for %s, want at most %s", d.Truncate(time.Second), threshold)
+		}
+		return nil
+	}
+}
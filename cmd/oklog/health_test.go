@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestReadiness(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name   string
+		checks map[string]func() error
+		want   int
+		body   readyJSON
+	}{
+		{
+			"no checks",
+			nil,
+			http.StatusOK,
+			readyJSON{Ready: true, Checks: map[string]string{}},
+		},
+		{
+			"passing",
+			map[string]func() error{"a": func() error { return nil }, "b": func() error { return nil }},
+			http.StatusOK,
+			readyJSON{Ready: true, Checks: map[string]string{"a": "ok", "b": "ok"}},
+		},
+		{
+			"failing",
+			map[string]func() error{"a": func() error { return nil }, "b": func() error { return errors.New("disk on fire") }},
+			http.StatusServiceUnavailable,
+			readyJSON{Ready: false, Checks: map[string]string{"a": "ok", "b": "disk on fire"}},
+		},
+	} {
+		ready := newReadiness()
+		for name, check := range testcase.checks {
+			ready.add(name, check)
+		}
+		mux := http.NewServeMux()
+		registerHealthCheck(mux)
+		registerReadyCheck(mux, ready)
+
+		// Health is only about the process, whatever the checks say.
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+		if want, have := http.StatusOK, w.Code; want != have {
+			t.Errorf("%s: /healthz: want HTTP %d, have %d", testcase.name, want, have)
+		}
+
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		if want, have := testcase.want, w.Code; want != have {
+			t.Errorf("%s: /readyz: want HTTP %d, have %d", testcase.name, want, have)
+		}
+		var body readyJSON
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Errorf("%s: %v", testcase.name, err)
+			continue
+		}
+		if want, have := testcase.body, body; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %+v, have %+v", testcase.name, want, have)
+		}
+	}
+}
+
+func TestReadyChecks(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name  string
+		check func() error
+		ok    bool
+	}{
+		{"writable", writableCheck(fs.NewVirtualFilesystem(), "/data"), true},
+		{"read-only", writableCheck(readOnlyFilesystem{fs.NewVirtualFilesystem()}, "/data"), false},
+		{"enough peers", peersCheck(func() int { return 3 }, 3), true},
+		{"partitioned", peersCheck(func() int { return 1 }, 3), false},
+		{"progressing", stallCheck(time.Now, time.Minute), true},
+		{"stalled", stallCheck(func() time.Time { return time.Now().Add(-time.Hour) }, time.Minute), false},
+	} {
+		if want, have := testcase.ok, testcase.check() == nil; want != have {
+			t.Errorf("%s: want ok %v, have %v", testcase.name, want, have)
+		}
+	}
+}
+
+// readOnlyFilesystem fails to create files, like a disk remounted read-only.
+type readOnlyFilesystem struct {
+	fs.Filesystem
+}
+
+func (readOnlyFilesystem) Create(path string) (fs.File, error) {
+	return nil, errors.New("read-only file system")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"net"
@@ -16,9 +17,11 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/cors"
 
+	grpcapi "github.com/oklog/oklog/pkg/api/grpc"
 	"github.com/oklog/oklog/pkg/cluster"
 	"github.com/oklog/oklog/pkg/fs"
 	"github.com/oklog/oklog/pkg/group"
+	"github.com/oklog/oklog/pkg/inflight"
 	"github.com/oklog/oklog/pkg/ingest"
 	"github.com/oklog/oklog/pkg/record"
 )
@@ -30,6 +33,18 @@ const (
 	defaultIngestSegmentFlushSize      = 16 * 1024 * 1024
 	defaultIngestSegmentFlushAge       = 3 * time.Second
 	defaultIngestSegmentPendingTimeout = time.Minute
+	defaultIngestSegmentMinFlushSize   = 1024 * 1024
+	defaultIngestSegmentMaxFlushSize   = 128 * 1024 * 1024
+	defaultIngestTakeoverTimeout       = 5 * time.Second
+	defaultIngestDurableCommitBytes    = 1024 * 1024
+	defaultIngestDrainTimeout          = 5 * time.Second
+	defaultIngestRecordMaxSize         = record.MaxSize
+	defaultIngestHTTPMaxBodySize       = 10 * 1024 * 1024
+	defaultIngestDiskCheckInterval     = 5 * time.Second
+	defaultIngestDiskCriticalWatermark = 0.97
+	defaultSyslogPort                  = 5514
+	defaultSyslogTopic                 = "syslog"
+	defaultSyslogMaxSize               = 64 * 1024
 )
 
 const (
@@ -37,6 +52,11 @@ const (
 	topicModeDynamic = "dynamic"
 )
 
+const (
+	recordSizePolicyTruncate = "truncate"
+	recordSizePolicyReject   = "reject"
+)
+
 var (
 	defaultFastAddr    = fmt.Sprintf("tcp://0.0.0.0:%d", defaultFastPort)
 	defaultDurableAddr = fmt.Sprintf("tcp://0.0.0.0:%d", defaultDurablePort)
@@ -47,27 +67,89 @@ var (
 func runIngest(args []string) error {
 	flagset := flag.NewFlagSet("ingest", flag.ExitOnError)
 	var (
-		debug                 = flagset.Bool("debug", false, "debug logging")
+		debug                 = flagset.Bool("debug", false, "debug logging, i.e. -log.level=debug")
+		logFormat             = flagset.String("log.format", defaultLogFormat, "log format: logfmt or json")
+		logLevel              = flagset.String("log.level", defaultLogLevel, "log level: debug, info, warn, or error")
 		topicMode             = flagset.String("topic-mode", topicModeStatic, "topic mode for ingested records (static, prefix)")
-		topic                 = flagset.String("topic", "default", "static topic name (requires -topic-mode=static)")
+		topic                 = flagset.String("topic", record.DefaultTopic, "static topic name (requires -topic-mode=static)")
 		apiAddr               = flagset.String("api", defaultAPIAddr, "listen address for ingest API")
+		grpcAddr              = flagset.String("grpc-addr", "", "if set, listen address for the gRPC API, whose pushes are like durable writes")
+		debugAddr             = flagset.String("debug-addr", "", "if set, listen address for pprof, expvars, and the operations in flight, at /debug/requests, without TLS or the auth token")
 		fastAddr              = flagset.String("ingest.fast", defaultFastAddr, "listen address for fast (async) writes")
 		durableAddr           = flagset.String("ingest.durable", defaultDurableAddr, "listen address for durable (sync) writes")
 		bulkAddr              = flagset.String("ingest.bulk", defaultBulkAddr, "listen address for bulk (whole-segment) writes")
 		clusterBindAddr       = flagset.String("cluster", defaultClusterAddr, "listen address for cluster")
 		clusterAdvertiseAddr  = flagset.String("cluster.advertise-addr", "", "optional, explicit address to advertise in cluster")
+		clusterZone           = flagset.String("cluster.zone", "", "optional, availability zone (or rack) to advertise in cluster")
+		staticPeers           = flagset.String("cluster.static-peers", "", "if set, even empty, comma-separated type=host:port APIs of peers, instead of gossip")
+		staticPeersFile       = flagset.String("cluster.static-peers-file", "", "if set, file of type=host:port static peers, one per line, re-read on SIGHUP")
+		staticHealthInterval  = flagset.Duration("cluster.static-health-interval", defaultStaticHealthInterval, "with static peers, how often to check their /health")
+		readyMinPeers         = flagset.Int("cluster.ready-min-peers", 1, "/readyz fails while fewer peers than this, counting this node, are in the cluster")
+		clockSkewWarning      = flagset.Duration("cluster.clock-skew-warning", defaultClockSkewWarning, "warn of peers whose clocks are further off ours than this, and of ours, if it's off most peers'")
+		encryptKeyFile        = flagset.String("cluster.encrypt-key-file", "", "optional, file of base64 gossip encryption keys, one per line, primary first, re-read on SIGHUP")
 		ingestPath            = flagset.String("ingest.path", defaultIngestPath, "path holding segment files for ingest tier")
 		segmentFlushSize      = flagset.Int("ingest.segment-flush-size", defaultIngestSegmentFlushSize, "flush segments after they grow to this size")
-		segmentFlushAge       = flagset.Duration("ingest.segment-flush-age", defaultIngestSegmentFlushAge, "flush segments after they are active for this long")
+		segmentFlushAge       = flagset.Duration("ingest.segment-flush-age", defaultIngestSegmentFlushAge, "flush nonempty segments this long after their first write")
+		segmentInterval       = flagset.Duration("ingest.segment-target-interval", 0, "if nonzero, adapt the flush size to the ingest rate, to flush about a segment this often, within -ingest.segment-flush-age")
+		segmentMinSize        = flagset.Int("ingest.segment-min-flush-size", defaultIngestSegmentMinFlushSize, "with -ingest.segment-target-interval, flush segments no smaller than this")
+		segmentMaxSize        = flagset.Int("ingest.segment-max-flush-size", defaultIngestSegmentMaxFlushSize, "with -ingest.segment-target-interval, flush segments no bigger than this")
 		segmentPendingTimeout = flagset.Duration("ingest.segment-pending-timeout", defaultIngestSegmentPendingTimeout, "claimed but uncommitted pending segments are failed after this long")
+		takeoverTimeout       = flagset.Duration("ingest.segment-takeover-timeout", defaultIngestTakeoverTimeout, "flushed segments go to any store node after this long, not only their preferred one; 0 for no preference")
+		durableCommitLatency  = flagset.Duration("ingest.durable-commit-latency", 0, "if nonzero, durable connections share syncs issued within this window")
+		durableCommitBytes    = flagset.Int("ingest.durable-commit-bytes", defaultIngestDurableCommitBytes, "with -ingest.durable-commit-latency, sync early once this many bytes are written")
+		drainTimeout          = flagset.Duration("ingest.drain-timeout", defaultIngestDrainTimeout, "on shutdown, wait this long for clients to finish writing, and go elsewhere")
+		handoffTimeout        = flagset.Duration("ingest.shutdown-handoff-timeout", 0, "if nonzero, on shutdown, push flushed segments that no store node has consumed to store nodes, for up to this long, and exit with status 3 if any remain")
+		handoffReplicas       = flagset.Int("ingest.shutdown-handoff-replication-factor", defaultStoreSegmentReplicationFactor, "with -ingest.shutdown-handoff-timeout, how many store nodes to push each segment to")
+		recordMaxSize         = flagset.Int("ingest.record-max-size", defaultIngestRecordMaxSize, "records bigger than this, at most 1048576, the most stores can read back, are truncated or rejected")
+		recordSizePolicy      = flagset.String("ingest.record-size-policy", recordSizePolicyTruncate, "what to do with oversized records (truncate, reject)")
+		httpMaxBodySize       = flagset.Int64("ingest.http-max-body-size", defaultIngestHTTPMaxBodySize, "max bytes of records POSTed to /ingest at once, before and after gunzipping")
+		connRecordRate        = flagset.Float64("ingest.connection-record-rate", 0, "if nonzero, max records per second read from each connection")
+		connByteRate          = flagset.Float64("ingest.connection-byte-rate", 0, "if nonzero, max bytes per second read from each connection")
+		recordRate            = flagset.Float64("ingest.record-rate", 0, "if nonzero, max records per second read from all connections")
+		byteRate              = flagset.Float64("ingest.byte-rate", 0, "if nonzero, max bytes per second read from all connections")
+		quotaFile             = flagset.String("ingest.quota-file", "", "if set, file of per-source quotas, re-read on SIGHUP; see -forward.source-id")
+		filterFile            = flagset.String("ingest.filter-file", "", "if set, file of rules keeping, dropping, or sampling records by regular expression, before they're given IDs, re-read on SIGHUP")
+		diskCriticalWatermark = flagset.Float64("ingest.disk-critical-watermark", defaultIngestDiskCriticalWatermark, "stop reading from connections, pushing back on forwarders, once this fraction of the -ingest.path filesystem is used")
+		maxClockSkew          = flagset.Duration("ingest.max-clock-skew", 0, "if nonzero, refuse records, telling clients to go elsewhere, while our clock is further off the cluster's than this")
+		maxClockRegression    = flagset.Duration("ingest.max-clock-regression", defaultMaxClockRegression, "refuse records, telling clients to go elsewhere, while our clock is further behind the time of the latest record ID than this, or never, if zero; IDs never go back with the clock regardless")
+		clientTimestamps      = flagset.Bool("ingest.client-timestamps", false, "give records the times prefixed by clients (see -forward.client-timestamps), not the times they arrive")
+		clientTimestampSkew   = flagset.Duration("ingest.client-timestamp-skew", defaultClientTimestampSkew, "with -ingest.client-timestamps, times further than this from arrival are replaced by it")
+		monotonicIDs          = flagset.Bool("ingest.monotonic-ids", false, "give the records of each connection IDs per the ULID spec's monotonicity extension, with fresh entropy every millisecond, incremented within it")
+		syslogAddr            = flagset.String("ingest.syslog-addr", "", "if set, listen address for syslog (TCP and UDP) writes")
+		syslogTopic           = flagset.String("ingest.syslog-topic", defaultSyslogTopic, "topic name for records from syslog")
+		syslogMaxSize         = flagset.Int("ingest.syslog-max-size", defaultSyslogMaxSize, "syslog messages bigger than this are dropped")
 		filesystem            = flagset.String("filesystem", defaultFilesystem, "real, virtual, nop")
+		syncBytes             = flagset.Int("filesystem.sync-bytes", defaultFilesystemSyncBytes, "write files back to disk every this many bytes written, not all at once (0 to leave it to the OS)")
+		dropSealed            = flagset.Bool("filesystem.drop-sealed", false, "drop sealed segments from the page cache, to leave it to queries")
+		mmap                  = flagset.Bool("filesystem.mmap", false, "with -filesystem=real, memory map segments to read them")
+		tlsCert               = flagset.String("tls.cert", "", "if set, serve TLS with this certificate (requires -tls.key)")
+		tlsKey                = flagset.String("tls.key", "", "private key of -tls.cert")
+		tlsClientCA           = flagset.String("tls.client-ca", "", "if set, require client certificates signed by these CAs (mutual TLS)")
+		apiAuthFile           = flagset.String("api.auth-token-file", "", "if set, API requests must bear the token in this file")
+		apiAuthExemptHealth   = flagset.Bool("api.auth-exempt-health", false, "with -api.auth-token-file, serve /health, /healthz, /readyz, and /metrics without a token")
+		alerts                = newAlertFlags(flagset)
 		clusterPeers          = stringslice{}
+		clusterLabels         = stringslice{}
 	)
 	flagset.Var(&clusterPeers, "peer", "cluster peer host:port (repeatable)")
+	flagset.Var(&clusterLabels, "cluster.label", "key=value label to advertise in cluster, and stamp on ingested segments (repeatable)")
 	flagset.Usage = usageFor(flagset, "oklog ingest [flags]")
 	if err := flagset.Parse(args); err != nil {
 		return err
 	}
+	labels, err := parseClusterLabels(clusterLabels)
+	if err != nil {
+		return err
+	}
+	if *diskCriticalWatermark <= 0 || *diskCriticalWatermark > 1 {
+		return errors.Errorf("invalid -ingest.disk-critical-watermark %v", *diskCriticalWatermark)
+	}
+	if *segmentInterval > 0 && (*segmentMinSize <= 0 || *segmentMaxSize < *segmentMinSize) {
+		return errors.Errorf("invalid -ingest.segment-min-flush-size %d, -ingest.segment-max-flush-size %d", *segmentMinSize, *segmentMaxSize)
+	}
+	if *handoffTimeout > 0 && *handoffReplicas <= 0 {
+		return errors.Errorf("invalid -ingest.shutdown-handoff-replication-factor %d", *handoffReplicas)
+	}
 
 	// +-1----------------+   +-2----------+   +-1----------+ +-1----+
 	// | Fast listener    |<--| Write      |-->| ingest.Log | | Peer |
@@ -77,6 +159,9 @@ func runIngest(args []string) error {
 	// +------------------+   |            |     |              |
 	// +-1----------------+   |            |     |              |
 	// | Bulk listener    |<--|            |     |              |
+	// +------------------+   |            |     |              |
+	// +-1----------------+   |            |     |              |
+	// | Syslog listener  |<--|            |     |              |
 	// +------------------+   +------------+     |              |
 	// +-1----------------+   +-2----------+     |              |
 	// | API listener     |<--| Ingest API |-----'              |
@@ -84,15 +169,9 @@ func runIngest(args []string) error {
 	// +------------------+   +------------+
 
 	// Logging.
-	var logger log.Logger
-	{
-		logLevel := level.AllowInfo()
-		if *debug {
-			logLevel = level.AllowAll()
-		}
-		logger = log.NewLogfmtLogger(os.Stderr)
-		logger = log.With(logger, "ts", log.DefaultTimestampUTC)
-		logger = level.NewFilter(logger, logLevel)
+	logger, err := newLogger(os.Stderr, *logFormat, *logLevel, *debug)
+	if err != nil {
+		return err
 	}
 
 	// Instrumentation.
@@ -133,6 +212,11 @@ func runIngest(args []string) error {
 		Help:      "Size of active segment when flushed in bytes.",
 		Buckets:   []float64{1 << 14, 1 << 15, 1 << 16, 1 << 17, 1 << 18, 1 << 19, 1 << 20, 1 << 21, 1 << 22, 1 << 23, 1 << 24},
 	})
+	segmentFlushThreshold := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "oklog",
+		Name:      "ingest_segment_flush_threshold_bytes",
+		Help:      "Size at which active segments are flushed, as adapted to the ingest rate.",
+	})
 	failedSegments := prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "oklog",
 		Name:      "ingest_failed_segments",
@@ -154,6 +238,40 @@ func runIngest(args []string) error {
 		Help:      "API request duration in seconds.",
 		Buckets:   prometheus.DefBuckets,
 	}, []string{"method", "path", "status_code"})
+	syslogDropped := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_syslog_messages_dropped_total",
+		Help:      "Syslog messages dropped, because they were malformed or oversized.",
+	}, []string{"reason"})
+	throttledConnections := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_throttled_connections_total",
+		Help:      "Connections that were throttled by a rate limit, or held, by scope (connection, global, hold).",
+	}, []string{"scope"})
+	throttledSeconds := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_throttled_seconds_total",
+		Help:      "Time connections spent waiting on a rate limit, or held, by scope (connection, global, hold).",
+	}, []string{"scope"})
+	oversizedRecords := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_oversized_records_total",
+		Help:      "Records bigger than the maximum size, by policy (truncate, reject).",
+	}, []string{"policy"})
+	ingestCompressedBytes := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_snappy_compressed_bytes_total",
+		Help:      "Bytes read from clients that compress with snappy, as they were sent.",
+	})
+	ingestUncompressedBytes := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_snappy_uncompressed_bytes_total",
+		Help:      "Bytes read from clients that compress with snappy, once decompressed.",
+	})
+	quotaMetrics := newQuotaMetrics()
+	prometheus.MustRegister(quotaMetrics.collectors()...)
+	ingestLatency := newIngestLatencyMetrics(latencyBuckets)
+	prometheus.MustRegister(ingestLatency.collectors()...)
 	prometheus.MustRegister(
 		connectedClients,
 		ingestWriterBytes,
@@ -162,11 +280,24 @@ func runIngest(args []string) error {
 		ingestWriterRotations,
 		flushedSegmentAge,
 		flushedSegmentSize,
+		segmentFlushThreshold,
 		failedSegments,
 		committedSegments,
 		committedBytes,
 		apiDuration,
+		syslogDropped,
+		throttledConnections,
+		throttledSeconds,
+		oversizedRecords,
+		ingestCompressedBytes,
+		ingestUncompressedBytes,
 	)
+	var segmentSizer *ingest.SegmentSizer // nil for -ingest.segment-flush-size
+	if *segmentInterval > 0 {
+		segmentSizer = ingest.NewSegmentSizer(*segmentInterval, *segmentMinSize, *segmentMaxSize, segmentFlushThreshold)
+	} else {
+		segmentFlushThreshold.Set(float64(*segmentFlushSize))
+	}
 
 	// Parse listener addresses.
 	fastNetwork, fastAddress, _, _, err := parseAddr(*fastAddr, defaultFastPort)
@@ -181,7 +312,14 @@ func runIngest(args []string) error {
 	if err != nil {
 		return err
 	}
-	apiNetwork, apiAddress, _, apiPort, err := parseAddr(*apiAddr, defaultAPIPort)
+	var syslogAddress string
+	if *syslogAddr != "" {
+		_, syslogAddress, _, _, err = parseAddr(*syslogAddr, defaultSyslogPort)
+		if err != nil {
+			return err
+		}
+	}
+	apiNetwork, apiAddress, apiHost, apiPort, err := parseAddr(*apiAddr, defaultAPIPort)
 	if err != nil {
 		return err
 	}
@@ -218,34 +356,88 @@ func runIngest(args []string) error {
 	if clusterAdvertisePort == 0 {
 		clusterAdvertisePort = clusterBindPort
 	}
+	if !listensOn(apiHost, clusterAdvertiseHost) {
+		level.Warn(logger).Log("err", "this node advertises its API on a host it doesn't listen on", "api", apiAddress, "advertised_api", fmt.Sprintf("%s:%d", clusterAdvertiseHost, apiPort))
+		level.Warn(logger).Log("err", "peers will be unable to query or stream from this node")
+		level.Warn(logger).Log("err", "provide -api on all interfaces, or -cluster.advertise-addr as the API's host")
+	}
+
+	// TLS, for listeners.
+	serverTLS, err := serverTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+	if err != nil {
+		return err
+	}
+	if serverTLS != nil {
+		level.Info(logger).Log("tls", "enabled", "client_auth", *tlsClientCA != "")
+	}
+
+	// Auth token, for API requests.
+	authToken, err := readAuthToken(*apiAuthFile)
+	if err != nil {
+		return err
+	}
 
 	// Bind listeners.
 	fastListener, err := net.Listen(fastNetwork, fastAddress)
 	if err != nil {
 		return err
 	}
+	fastListener = tlsListener(fastListener, serverTLS)
 	level.Info(logger).Log("fast", fmt.Sprintf("%s://%s", fastNetwork, fastAddress))
 	durableListener, err := net.Listen(durableNetwork, durableAddress)
 	if err != nil {
 		return err
 	}
+	durableListener = tlsListener(durableListener, serverTLS)
 	level.Info(logger).Log("durable", fmt.Sprintf("%s://%s", durableNetwork, durableAddress))
 	bulkListener, err := net.Listen(bulkNetwork, bulkAddress)
 	if err != nil {
 		return err
 	}
+	bulkListener = tlsListener(bulkListener, serverTLS)
 	level.Info(logger).Log("bulk", fmt.Sprintf("%s://%s", bulkNetwork, bulkAddress))
+	var (
+		syslogListener   net.Listener
+		syslogPacketConn net.PacketConn
+	)
+	if syslogAddress != "" {
+		syslogListener, err = net.Listen("tcp", syslogAddress)
+		if err != nil {
+			return err
+		}
+		syslogPacketConn, err = net.ListenPacket("udp", syslogAddress)
+		if err != nil {
+			return err
+		}
+		level.Info(logger).Log("syslog", fmt.Sprintf("tcp+udp://%s", syslogAddress))
+	}
 	apiListener, err := net.Listen(apiNetwork, apiAddress)
 	if err != nil {
 		return err
 	}
+	apiListener = tlsListener(apiListener, serverTLS)
 	level.Info(logger).Log("API", fmt.Sprintf("%s://%s", apiNetwork, apiAddress))
+	grpcListener, err := listenGRPC(*grpcAddr, logger)
+	if err != nil {
+		return err
+	}
+	debugListener, err := listenDebug(*debugAddr, logger)
+	if err != nil {
+		return err
+	}
+	var ops *inflight.Registry // with -debug-addr
+	if debugListener != nil {
+		ops = inflight.NewRegistry()
+	}
 
 	// Create ingest log.
 	var fsys fs.Filesystem
 	switch strings.ToLower(*filesystem) {
 	case "real":
 		fsys = fs.NewRealFilesystem()
+		if *mmap {
+			fsys = fs.NewRealFilesystemWithMmap()
+		}
 	case "virtual":
 		fsys = fs.NewVirtualFilesystem()
 	case "nop":
@@ -253,8 +445,13 @@ func runIngest(args []string) error {
 	default:
 		return errors.Errorf("invalid -filesystem %q", *filesystem)
 	}
+	fsys = fs.NewWritebackFilesystem(fsys, fs.Writeback{SyncBytes: int64(*syncBytes), DropSealed: *dropSealed})
 
-	ingestLog, err := ingest.NewFileLog(fsys, *ingestPath)
+	alertBus, err := alerts.newBus(prometheus.DefaultRegisterer, fmt.Sprintf("%s:%d", clusterAdvertiseHost, apiPort), logger)
+	if err != nil {
+		return err
+	}
+	ingestLog, err := ingest.NewFileLog(fsys, *ingestPath, labels.String(), log.With(logger, "component", "IngestLog"))
 	if err != nil {
 		return err
 	}
@@ -266,37 +463,133 @@ func runIngest(args []string) error {
 	}()
 	level.Info(logger).Log("ingest_path", *ingestPath)
 
-	// Create peer.
-	peer, err := cluster.NewPeer(
-		clusterBindHost, clusterBindPort,
-		clusterAdvertiseHost, clusterAdvertisePort,
-		clusterPeers,
-		cluster.PeerTypeIngest, apiPort,
-		log.With(logger, "component", "cluster"),
-	)
-	if err != nil {
-		return err
+	// TLS, for requests to peers: static peers' health checks, and handoff.
+	var peerTLS *tls.Config
+	if serverTLS != nil {
+		if peerTLS, err = clientTLSConfig("", *tlsCert, *tlsKey); err != nil {
+			return err
+		}
+	}
+
+	// Create peer, which gossips, unless it has static peers.
+	static := staticPeersGiven(flagset)
+	var peer *cluster.Peer
+	if static {
+		if len(clusterPeers) > 0 {
+			return errors.New("-peer can't be combined with static peers")
+		}
+		if *encryptKeyFile != "" {
+			return errors.New("-cluster.encrypt-key-file can't be combined with static peers, which don't gossip")
+		}
+		peers, err := loadStaticPeers(*staticPeers, *staticPeersFile)
+		if err != nil {
+			return err
+		}
+		peer, err = cluster.NewStaticPeer(
+			clusterAdvertiseHost,
+			cluster.PeerTypeIngest, apiPort,
+			*clusterZone,
+			labels,
+			peers,
+			staticHealthClient(peerTLS, authToken),
+			*staticHealthInterval,
+			log.With(logger, "component", "cluster"),
+		)
+		if err != nil {
+			return err
+		}
+	} else {
+		keys, err := readGossipKeys(*encryptKeyFile)
+		if err != nil {
+			return err
+		}
+		peer, err = cluster.NewPeer(
+			clusterBindHost, clusterBindPort,
+			clusterAdvertiseHost, clusterAdvertisePort,
+			clusterPeers,
+			cluster.PeerTypeIngest, apiPort,
+			*clusterZone,
+			labels,
+			keys,
+			log.With(logger, "component", "cluster"),
+		)
+		if err != nil {
+			return err
+		}
 	}
 	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
 		Namespace: "oklog",
 		Name:      "cluster_size",
 		Help:      "Number of peers in the cluster from this node's perspective.",
 	}, func() float64 { return float64(peer.ClusterSize()) }))
+	registerClockOffset(prometheus.DefaultRegisterer, peer)
 
 	var rfac record.ReaderFactory
 	{
+		var policy record.SizePolicy
+		switch *recordSizePolicy {
+		case recordSizePolicyTruncate:
+			policy = record.Truncate
+		case recordSizePolicyReject:
+			policy = record.Reject
+		default:
+			return fmt.Errorf("record size policy %q invalid, must be %q or %q", *recordSizePolicy, recordSizePolicyTruncate, recordSizePolicyReject)
+		}
+		oversized := oversizedRecords.WithLabelValues(*recordSizePolicy).Inc
+		if *recordMaxSize <= 0 || *recordMaxSize > record.MaxSize {
+			return fmt.Errorf("-ingest.record-max-size %d invalid, must be positive, and at most %d", *recordMaxSize, record.MaxSize)
+		}
+		if *httpMaxBodySize <= 0 {
+			return fmt.Errorf("-ingest.http-max-body-size %d invalid, must be positive", *httpMaxBodySize)
+		}
+
 		topicb := []byte(*topic)
 		switch {
 		case *topicMode == topicModeDynamic:
-			rfac = record.NewDynamicReader
+			rfac = record.DynamicReaderFactory(*recordMaxSize, policy, oversized)
 		case *topicMode == topicModeStatic && record.IsValidTopic(topicb):
-			rfac = record.StaticReaderFactory(topicb)
+			rfac = record.StaticReaderFactory(topicb, *recordMaxSize, policy, oversized)
 		case *topicMode == topicModeStatic && !record.IsValidTopic(topicb):
 			return fmt.Errorf("topic name %q invalid", *topic)
 		default:
 			return fmt.Errorf("topic mode %q invalid, must be %q or %q", *topicMode, topicModeStatic, topicModeDynamic)
 		}
 	}
+	limiter := ingest.NewLimiter(
+		*connRecordRate, *connByteRate,
+		*recordRate, *byteRate,
+		throttledConnections, throttledSeconds,
+	)
+	quotas, err := newQuotas(*quotaFile, quotaMetrics)
+	if err != nil {
+		return err
+	}
+	filter, err := newFilter(prometheus.DefaultRegisterer, *filterFile)
+	if err != nil {
+		return err
+	}
+	timestamps := newClientTimestamps(prometheus.DefaultRegisterer, *clientTimestamps, *clientTimestampSkew)
+	clockGuard := newClockGuard(prometheus.DefaultRegisterer, *maxClockSkew)
+	idClock := newIDClock(prometheus.DefaultRegisterer, *maxClockRegression, log.With(logger, "component", "ingest"))
+	monotonic := newMonotonicIDs(*monotonicIDs)
+	syslogTopicb := []byte(*syslogTopic)
+	if syslogAddress != "" && !record.IsValidTopic(syslogTopicb) {
+		return fmt.Errorf("syslog topic name %q invalid", *syslogTopic)
+	}
+	if syslogAddress != "" && (*syslogMaxSize <= 0 || *syslogMaxSize > record.MaxSize) {
+		return fmt.Errorf("-ingest.syslog-max-size %d invalid, must be positive, and at most %d", *syslogMaxSize, record.MaxSize)
+	}
+
+	ingestAPI := ingest.NewAPI(
+		peer,
+		ingestLog,
+		*segmentPendingTimeout,
+		*takeoverTimeout,
+		failedSegments,
+		committedSegments,
+		committedBytes,
+		apiDuration,
+	)
 
 	// Execution group.
 	var g group.Group
@@ -310,67 +603,325 @@ func runIngest(args []string) error {
 		})
 	}
 	{
+		cancel := make(chan struct{})
 		g.Add(func() error {
-			return ingest.HandleConnections(
-				fastListener,
-				ingest.HandleFastWriter,
-				rfac,
-				ingestLog,
-				*segmentFlushAge, *segmentFlushSize,
-				connectedClients.WithLabelValues("fast"),
-				ingestWriterBytes, ingestWriterRecords, ingestWriterSyncs,
-				flushedSegmentAge, flushedSegmentSize,
-			)
+			return watchClockSkew(peer, *clockSkewWarning, defaultClockCheckInterval, clockGuard, alertBus, cancel, log.With(logger, "component", "cluster"))
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	{
+		g.Add(func() error {
+			alertBus.Run()
+			return nil
+		}, func(error) {
+			alertBus.Stop()
+		})
+	}
+	if static {
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return reloadStaticPeers(peer, *staticPeers, *staticPeersFile, cancel, log.With(logger, "component", "cluster"))
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	if *encryptKeyFile != "" {
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return reloadGossipKeys(peer, *encryptKeyFile, cancel, log.With(logger, "component", "cluster"))
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	if quotas != nil {
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return reloadQuotas(quotas, *quotaFile, cancel, log.With(logger, "component", "ingest"))
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	if filter != nil {
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return reloadFilter(filter, *filterFile, cancel, log.With(logger, "component", "ingest"))
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	{
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return holdIngestOnLowDisk(fsys, *ingestPath, *diskCriticalWatermark, defaultIngestDiskCheckInterval, limiter, alertBus, cancel, log.With(logger, "component", "ingest"))
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	lagMonitor := newIngestLagMonitor(prometheus.DefaultRegisterer, ingestLog, log.With(logger, "component", "ingest"))
+	{
+		g.Add(func() error {
+			lagMonitor.Run()
+			return nil
+		}, func(error) {
+			lagMonitor.Stop()
+		})
+	}
+	connections := ingest.NewConnections(defaultIngestConnectionsWindow, log.With(logger, "component", "ingest"))
+	{
+		g.Add(func() error {
+			connections.Run()
+			return nil
+		}, func(error) {
+			connections.Stop()
+		})
+	}
+	httpWriter, err := ingest.NewWriter(
+		ingestLog,
+		*segmentFlushAge, *segmentFlushSize, segmentSizer,
+		*durableCommitLatency, *durableCommitBytes,
+		ingestWriterBytes, ingestWriterRecords, ingestWriterSyncs,
+		flushedSegmentAge, flushedSegmentSize,
+		log.With(logger, "component", "Writer"),
+	)
+	if err != nil {
+		return err
+	}
+	httpIngester := ingest.NewHTTPIngester(httpWriter, monotonic, rfac, *httpMaxBodySize, limiter, quotas, timestamps, clockGuard, idClock, filter)
+	{
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			<-cancel
+			return nil
+		}, func(error) {
+			close(cancel)
+			httpIngester.Stop()
+		})
+	}
+	{
+		g.Add(func() error {
+			return ingest.HandleConnections(fastListener, ingest.ConnectionConfig{
+				Handler:           ingest.HandleFastWriter,
+				ReaderFactory:     rfac,
+				Log:               ingestLog,
+				Logger:            log.With(logger, "component", "Writer"),
+				SegmentFlushAge:   *segmentFlushAge,
+				SegmentFlushSize:  *segmentFlushSize,
+				Sizer:             segmentSizer,
+				DrainTimeout:      *drainTimeout,
+				Limiter:           limiter,
+				Quotas:            quotas,
+				Timestamps:        timestamps,
+				Clock:             clockGuard,
+				IDClock:           idClock,
+				IDs:               monotonic,
+				Filter:            filter,
+				Connections:       connections,
+				ConnectedClients:  connectedClients.WithLabelValues("fast"),
+				Bytes:             ingestWriterBytes,
+				Records:           ingestWriterRecords,
+				Syncs:             ingestWriterSyncs,
+				SegmentAge:        flushedSegmentAge,
+				SegmentSize:       flushedSegmentSize,
+				WriteLatency:      ingestLatency.write.WithLabelValues("fast"),
+				AckLatency:        ingestLatency.ack,
+				CompressedBytes:   ingestCompressedBytes,
+				UncompressedBytes: ingestUncompressedBytes,
+			})
 		}, func(error) {
 			fastListener.Close()
 		})
 		g.Add(func() error {
-			return ingest.HandleConnections(
-				durableListener,
-				ingest.HandleDurableWriter,
-				rfac,
-				ingestLog,
-				*segmentFlushAge, *segmentFlushSize,
-				connectedClients.WithLabelValues("durable"),
-				ingestWriterBytes, ingestWriterRecords, ingestWriterSyncs,
-				flushedSegmentAge, flushedSegmentSize,
-			)
+			return ingest.HandleConnections(durableListener, ingest.ConnectionConfig{
+				Handler:           ingest.HandleDurableWriter,
+				ReaderFactory:     rfac,
+				Log:               ingestLog,
+				Logger:            log.With(logger, "component", "Writer"),
+				SegmentFlushAge:   *segmentFlushAge,
+				SegmentFlushSize:  *segmentFlushSize,
+				Sizer:             segmentSizer,
+				CommitLatency:     *durableCommitLatency,
+				CommitBytes:       *durableCommitBytes,
+				DrainTimeout:      *drainTimeout,
+				Limiter:           limiter,
+				Quotas:            quotas,
+				Timestamps:        timestamps,
+				Clock:             clockGuard,
+				IDClock:           idClock,
+				IDs:               monotonic,
+				Filter:            filter,
+				Connections:       connections,
+				ConnectedClients:  connectedClients.WithLabelValues("durable"),
+				Bytes:             ingestWriterBytes,
+				Records:           ingestWriterRecords,
+				Syncs:             ingestWriterSyncs,
+				SegmentAge:        flushedSegmentAge,
+				SegmentSize:       flushedSegmentSize,
+				WriteLatency:      ingestLatency.write.WithLabelValues("durable"),
+				AckLatency:        ingestLatency.ack,
+				CompressedBytes:   ingestCompressedBytes,
+				UncompressedBytes: ingestUncompressedBytes,
+			})
 		}, func(error) {
 			durableListener.Close()
 		})
 		g.Add(func() error {
-			return ingest.HandleConnections(
-				bulkListener,
-				ingest.HandleBulkWriter,
-				rfac,
-				ingestLog,
-				*segmentFlushAge, *segmentFlushSize,
-				connectedClients.WithLabelValues("bulk"),
-				ingestWriterBytes, ingestWriterRecords, ingestWriterSyncs,
-				flushedSegmentAge, flushedSegmentSize,
-			)
+			return ingest.HandleConnections(bulkListener, ingest.ConnectionConfig{
+				Handler:           ingest.HandleBulkWriter,
+				ReaderFactory:     rfac,
+				Log:               ingestLog,
+				Logger:            log.With(logger, "component", "Writer"),
+				SegmentFlushAge:   *segmentFlushAge,
+				SegmentFlushSize:  *segmentFlushSize,
+				Sizer:             segmentSizer,
+				DrainTimeout:      *drainTimeout,
+				Limiter:           limiter,
+				Quotas:            quotas,
+				Timestamps:        timestamps,
+				Clock:             clockGuard,
+				IDClock:           idClock,
+				IDs:               monotonic,
+				Filter:            filter,
+				Connections:       connections,
+				ConnectedClients:  connectedClients.WithLabelValues("bulk"),
+				Bytes:             ingestWriterBytes,
+				Records:           ingestWriterRecords,
+				Syncs:             ingestWriterSyncs,
+				SegmentAge:        flushedSegmentAge,
+				SegmentSize:       flushedSegmentSize,
+				WriteLatency:      ingestLatency.write.WithLabelValues("bulk"),
+				AckLatency:        ingestLatency.ack,
+				CompressedBytes:   ingestCompressedBytes,
+				UncompressedBytes: ingestUncompressedBytes,
+			})
 		}, func(error) {
 			bulkListener.Close()
 		})
+		if grpcListener != nil {
+			var (
+				grpcAPI = grpcapi.NewServer(true, nil)
+				server  = newGRPCServer(grpcAPI, serverTLS, authToken)
+			)
+			g.Add(func() error {
+				return ingest.HandleConnections(grpcAPI.Listener(), ingest.ConnectionConfig{
+					Handler:           ingest.HandleDurableWriter,
+					ReaderFactory:     rfac,
+					Log:               ingestLog,
+					Logger:            log.With(logger, "component", "Writer"),
+					SegmentFlushAge:   *segmentFlushAge,
+					SegmentFlushSize:  *segmentFlushSize,
+					Sizer:             segmentSizer,
+					CommitLatency:     *durableCommitLatency,
+					CommitBytes:       *durableCommitBytes,
+					DrainTimeout:      *drainTimeout,
+					Limiter:           limiter,
+					Quotas:            quotas,
+					Timestamps:        timestamps,
+					Clock:             clockGuard,
+					IDClock:           idClock,
+					IDs:               monotonic,
+					Filter:            filter,
+					Connections:       connections,
+					ConnectedClients:  connectedClients.WithLabelValues("grpc"),
+					Bytes:             ingestWriterBytes,
+					Records:           ingestWriterRecords,
+					Syncs:             ingestWriterSyncs,
+					SegmentAge:        flushedSegmentAge,
+					SegmentSize:       flushedSegmentSize,
+					WriteLatency:      ingestLatency.write.WithLabelValues("grpc"),
+					AckLatency:        ingestLatency.ack,
+					CompressedBytes:   ingestCompressedBytes,
+					UncompressedBytes: ingestUncompressedBytes,
+				})
+			}, func(error) {
+				grpcAPI.Listener().Close()
+			})
+			g.Add(func() error {
+				return server.Serve(grpcListener)
+			}, func(error) {
+				server.Stop()
+			})
+		}
+		if syslogAddress != "" {
+			g.Add(func() error {
+				return ingest.HandleConnections(syslogListener, ingest.ConnectionConfig{
+					Handler:          ingest.HandleFastWriter,
+					ReaderFactory:    ingest.SyslogReaderFactory(syslogTopicb, *syslogMaxSize, syslogDropped),
+					Log:              ingestLog,
+					Logger:           log.With(logger, "component", "Writer"),
+					SegmentFlushAge:  *segmentFlushAge,
+					SegmentFlushSize: *segmentFlushSize,
+					Sizer:            segmentSizer,
+					DrainTimeout:     *drainTimeout,
+					Limiter:          limiter,
+					Quotas:           quotas,
+					// no Timestamps: syslog records have no client timestamps
+					Clock:             clockGuard,
+					IDClock:           idClock,
+					IDs:               monotonic,
+					Filter:            filter,
+					Connections:       connections,
+					ConnectedClients:  connectedClients.WithLabelValues("syslog"),
+					Bytes:             ingestWriterBytes,
+					Records:           ingestWriterRecords,
+					Syncs:             ingestWriterSyncs,
+					SegmentAge:        flushedSegmentAge,
+					SegmentSize:       flushedSegmentSize,
+					WriteLatency:      ingestLatency.write.WithLabelValues("syslog"),
+					AckLatency:        ingestLatency.ack,
+					CompressedBytes:   ingestCompressedBytes,
+					UncompressedBytes: ingestUncompressedBytes,
+				})
+			}, func(error) {
+				syslogListener.Close()
+			})
+			g.Add(func() error {
+				return ingest.HandleSyslogPackets(
+					syslogPacketConn,
+					syslogTopicb,
+					*syslogMaxSize,
+					syslogDropped,
+					monotonic,
+					idClock,
+					filter,
+					ingestLog,
+					log.With(logger, "component", "Writer"),
+					*segmentFlushAge, *segmentFlushSize, segmentSizer,
+					ingestWriterBytes, ingestWriterRecords, ingestWriterSyncs,
+					flushedSegmentAge, flushedSegmentSize,
+				)
+			}, func(error) {
+				syslogPacketConn.Close()
+			})
+		}
+		ready := newReadiness()
+		ready.add("ingest.path", writableCheck(fsys, *ingestPath))
+		ready.add("cluster", peersCheck(peer.ClusterSize, *readyMinPeers))
 		g.Add(func() error {
 			mux := http.NewServeMux()
-			mux.Handle("/ingest/", http.StripPrefix("/ingest", ingest.NewAPI(
-				peer,
-				ingestLog,
-				*segmentPendingTimeout,
-				failedSegments,
-				committedSegments,
-				committedBytes,
-				apiDuration,
-			)))
-			registerMetrics(mux)
+			mux.Handle("/ingest/", http.StripPrefix("/ingest", ingestAPI))
+			mux.Handle("/ingest", httpIngester)
+			mux.Handle("/ingest"+ingest.APIPathLag, http.StripPrefix("/ingest", lagMonitor))
+			mux.Handle("/ingest"+ingest.APIPathConnections, http.StripPrefix("/ingest", connections))
+			mux.Handle("/ingest"+ingest.APIPathConnections+"/", http.StripPrefix("/ingest", connections))
+			mux.Handle("/cluster/", http.StripPrefix("/cluster", cluster.NewAPI(peer)))
+			registerMetrics(mux, prometheus.DefaultGatherer)
 			registerProfile(mux)
 			registerHealthCheck(mux)
-			return http.Serve(apiListener, cors.Default().Handler(mux))
+			registerVersion(mux, flagset)
+			registerReadyCheck(mux, ready)
+			return http.Serve(apiListener, cors.Default().Handler(requireToken(authToken, *apiAuthExemptHealth, ops.Handler(mux))))
 		}, func(error) {
 			apiListener.Close()
 		})
 	}
+	if debugListener != nil {
+		g.Add(func() error {
+			return http.Serve(debugListener, debugHandler(ops))
+		}, func(error) {
+			debugListener.Close()
+		})
+	}
 	{
 		cancel := make(chan struct{})
 		g.Add(func() error {
@@ -379,5 +930,23 @@ func runIngest(args []string) error {
 			close(cancel)
 		})
 	}
-	return g.Run()
+	err = g.Run()
+	if *handoffTimeout <= 0 {
+		return err
+	}
+
+	// Once no more records are written, and no store node consumes any
+	// more, hand off the segments that are left.
+	ingestAPI.Stop() // fails pending segments, so they're flushed again
+	client := clientConfig{
+		dialTimeout:           defaultClientDialTimeout,
+		tlsHandshakeTimeout:   defaultTLSHandshakeTimeout,
+		responseHeaderTimeout: defaultClientResponseHeaderTimeout,
+		maxIdleConnsPerHost:   defaultClientMaxIdleConnsPerHost,
+		keepAlive:             defaultClientKeepAlive,
+	}.client(peerTLS, authToken)
+	if handoffErr := handOff(ingestLog, peer.Current(cluster.PeerTypeStore), client, *handoffReplicas, *handoffTimeout, log.With(logger, "component", "handoff")); handoffErr != nil {
+		return handoffErr
+	}
+	return err
 }
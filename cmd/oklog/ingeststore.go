@@ -1,12 +1,17 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -15,49 +20,215 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/cors"
 
+	grpcapi "github.com/oklog/oklog/pkg/api/grpc"
+	"github.com/oklog/oklog/pkg/breaker"
 	"github.com/oklog/oklog/pkg/cluster"
 	"github.com/oklog/oklog/pkg/fs"
 	"github.com/oklog/oklog/pkg/group"
+	"github.com/oklog/oklog/pkg/inflight"
 	"github.com/oklog/oklog/pkg/ingest"
 	"github.com/oklog/oklog/pkg/record"
 	"github.com/oklog/oklog/pkg/store"
+	"github.com/oklog/oklog/pkg/stream"
 	"github.com/oklog/oklog/pkg/ui"
 )
 
-func runIngestStore(args []string) error {
+// runIngestStore runs an ingeststore, with its metrics registered with
+// registerer, and served from gatherer.
+func runIngestStore(args []string, registerer prometheus.Registerer, gatherer prometheus.Gatherer) error {
 	flagset := flag.NewFlagSet("ingeststore", flag.ExitOnError)
 	var (
-		debug                    = flagset.Bool("debug", false, "debug logging")
+		debug                    = flagset.Bool("debug", false, "debug logging, i.e. -log.level=debug")
+		logFormat                = flagset.String("log.format", defaultLogFormat, "log format: logfmt or json")
+		logLevel                 = flagset.String("log.level", defaultLogLevel, "log level: debug, info, warn, or error")
 		apiAddr                  = flagset.String("api", defaultAPIAddr, "listen address for ingest and store APIs")
+		grpcAddr                 = flagset.String("grpc-addr", "", "if set, listen address for the gRPC API, whose pushes are like durable writes")
+		debugAddr                = flagset.String("debug-addr", "", "if set, listen address for pprof, expvars, and the operations in flight, at /debug/requests, without TLS or the auth token")
 		topicMode                = flagset.String("ingest.topic-mode", topicModeStatic, "topic mode for ingested records (static, dynamic)")
-		topic                    = flagset.String("ingest.topic", "default", "static topic name (requires -topic-mode=static)")
+		topic                    = flagset.String("ingest.topic", record.DefaultTopic, "static topic name (requires -topic-mode=static)")
 		fastAddr                 = flagset.String("ingest.fast", defaultFastAddr, "listen address for fast (async) writes")
 		durableAddr              = flagset.String("ingest.durable", defaultDurableAddr, "listen address for durable (sync) writes")
 		bulkAddr                 = flagset.String("ingest.bulk", defaultBulkAddr, "listen address for bulk (whole-segment) writes")
 		clusterBindAddr          = flagset.String("cluster", defaultClusterAddr, "listen address for cluster")
 		clusterAdvertiseAddr     = flagset.String("cluster.advertise-addr", "", "optional, explicit address to advertise in cluster")
+		clusterZone              = flagset.String("cluster.zone", "", "optional, availability zone (or rack) to advertise in cluster")
+		staticPeers              = flagset.String("cluster.static-peers", "", "if set, even empty, comma-separated type=host:port APIs of peers, instead of gossip")
+		staticPeersFile          = flagset.String("cluster.static-peers-file", "", "if set, file of type=host:port static peers, one per line, re-read on SIGHUP")
+		staticHealthInterval     = flagset.Duration("cluster.static-health-interval", defaultStaticHealthInterval, "with static peers, how often to check their /health")
+		readyMinPeers            = flagset.Int("cluster.ready-min-peers", 1, "/readyz fails while fewer peers than this, counting this node, are in the cluster")
+		clockSkewWarning         = flagset.Duration("cluster.clock-skew-warning", defaultClockSkewWarning, "warn of peers whose clocks are further off ours than this, and of ours, if it's off most peers'")
+		encryptKeyFile           = flagset.String("cluster.encrypt-key-file", "", "optional, file of base64 gossip encryption keys, one per line, primary first, re-read on SIGHUP")
+		singleNode               = flagset.Bool("single-node", false, "run as a cluster of one, without gossip or static peers, consuming and replicating segments in-process")
 		ingestPath               = flagset.String("ingest.path", defaultIngestPath, "path holding segment files for ingest tier")
 		segmentFlushSize         = flagset.Int("ingest.segment-flush-size", defaultIngestSegmentFlushSize, "flush segments after they grow to this size")
-		segmentFlushAge          = flagset.Duration("ingest.segment-flush-age", defaultIngestSegmentFlushAge, "flush segments after they are active for this long")
+		segmentFlushAge          = flagset.Duration("ingest.segment-flush-age", defaultIngestSegmentFlushAge, "flush nonempty segments this long after their first write")
+		segmentInterval          = flagset.Duration("ingest.segment-target-interval", 0, "if nonzero, adapt the flush size to the ingest rate, to flush about a segment this often, within -ingest.segment-flush-age")
+		segmentMinSize           = flagset.Int("ingest.segment-min-flush-size", defaultIngestSegmentMinFlushSize, "with -ingest.segment-target-interval, flush segments no smaller than this")
+		segmentMaxSize           = flagset.Int("ingest.segment-max-flush-size", defaultIngestSegmentMaxFlushSize, "with -ingest.segment-target-interval, flush segments no bigger than this")
 		segmentPendingTimeout    = flagset.Duration("ingest.segment-pending-timeout", defaultIngestSegmentPendingTimeout, "claimed but uncommitted pending segments are failed after this long")
+		takeoverTimeout          = flagset.Duration("ingest.segment-takeover-timeout", defaultIngestTakeoverTimeout, "flushed segments go to any store node after this long, not only their preferred one; 0 for no preference")
+		durableCommitLatency     = flagset.Duration("ingest.durable-commit-latency", 0, "if nonzero, durable connections share syncs issued within this window")
+		durableCommitBytes       = flagset.Int("ingest.durable-commit-bytes", defaultIngestDurableCommitBytes, "with -ingest.durable-commit-latency, sync early once this many bytes are written")
+		drainTimeout             = flagset.Duration("ingest.drain-timeout", defaultIngestDrainTimeout, "on shutdown, wait this long for clients to finish writing, and go elsewhere")
+		recordMaxSize            = flagset.Int("ingest.record-max-size", defaultIngestRecordMaxSize, "records bigger than this, at most 1048576, the most stores can read back, are truncated or rejected")
+		recordSizePolicy         = flagset.String("ingest.record-size-policy", recordSizePolicyTruncate, "what to do with oversized records (truncate, reject)")
+		httpMaxBodySize          = flagset.Int64("ingest.http-max-body-size", defaultIngestHTTPMaxBodySize, "max bytes of records POSTed to /ingest at once, before and after gunzipping")
+		connRecordRate           = flagset.Float64("ingest.connection-record-rate", 0, "if nonzero, max records per second read from each connection")
+		connByteRate             = flagset.Float64("ingest.connection-byte-rate", 0, "if nonzero, max bytes per second read from each connection")
+		recordRate               = flagset.Float64("ingest.record-rate", 0, "if nonzero, max records per second read from all connections")
+		byteRate                 = flagset.Float64("ingest.byte-rate", 0, "if nonzero, max bytes per second read from all connections")
+		quotaFile                = flagset.String("ingest.quota-file", "", "if set, file of per-source quotas, re-read on SIGHUP; see -forward.source-id")
+		filterFile               = flagset.String("ingest.filter-file", "", "if set, file of rules keeping, dropping, or sampling records by regular expression, before they're given IDs, re-read on SIGHUP")
+		ingestCriticalWatermark  = flagset.Float64("ingest.disk-critical-watermark", defaultIngestDiskCriticalWatermark, "stop reading from connections, pushing back on forwarders, once this fraction of the -ingest.path filesystem is used")
+		maxClockSkew             = flagset.Duration("ingest.max-clock-skew", 0, "if nonzero, refuse records, telling clients to go elsewhere, while our clock is further off the cluster's than this")
+		maxClockRegression       = flagset.Duration("ingest.max-clock-regression", defaultMaxClockRegression, "refuse records, telling clients to go elsewhere, while our clock is further behind the time of the latest record ID than this, or never, if zero; IDs never go back with the clock regardless")
+		clientTimestamps         = flagset.Bool("ingest.client-timestamps", false, "give records the times prefixed by clients (see -forward.client-timestamps), not the times they arrive")
+		clientTimestampSkew      = flagset.Duration("ingest.client-timestamp-skew", defaultClientTimestampSkew, "with -ingest.client-timestamps, times further than this from arrival are replaced by it")
+		monotonicIDs             = flagset.Bool("ingest.monotonic-ids", false, "give the records of each connection IDs per the ULID spec's monotonicity extension, with fresh entropy every millisecond, incremented within it")
+		syslogAddr               = flagset.String("ingest.syslog-addr", "", "if set, listen address for syslog (TCP and UDP) writes")
+		syslogTopic              = flagset.String("ingest.syslog-topic", defaultSyslogTopic, "topic name for records from syslog")
+		syslogMaxSize            = flagset.Int("ingest.syslog-max-size", defaultSyslogMaxSize, "syslog messages bigger than this are dropped")
 		storePath                = flagset.String("store.path", defaultStorePath, "path holding segment files for storage tier")
+		forceRecovery            = flagset.Bool("store.force-recovery", false, "start even if crash recovery finds ambiguous segments in -store.path, leaving them as they are")
 		segmentConsumers         = flagset.Int("store.segment-consumers", defaultStoreSegmentConsumers, "concurrent segment consumers")
+		consumersPerIngester     = flagset.Int("store.segment-consumers-per-ingester", 0, "if nonzero, the most segment consumers that gather from one ingest node at once, so one with a deep backlog can't occupy them all")
 		segmentTargetSize        = flagset.Int64("store.segment-target-size", defaultStoreSegmentTargetSize, "try to keep store segments about this size")
 		segmentTargetAge         = flagset.Duration("store.segment-target-age", defaultStoreSegmentTargetAge, "replicate once the aggregate segment is this old")
 		segmentDelay             = flagset.Duration("store.segment-delay", defaultStoreSegmentDelay, "request next segment files after this delay")
+		dedupWindow              = flagset.Duration("store.dedup-window", 0, "if nonzero, consumers drop records whose topic and payload match one consumed within this long, best-effort")
 		segmentBufferSize        = flagset.Int64("store.segment-buffer-size", defaultStoreSegmentBufferSize, "per-segment in-memory read buffer during queries")
-		segmentReplicationFactor = flagset.Int("store.segment-replication-factor", defaultStoreSegmentReplicationFactor, "how many copies of each segment to replicate")
+		queryConcurrency         = flagset.Int("store.query-concurrency", 0, "segments read and filtered concurrently per query (0 for GOMAXPROCS)")
+		segmentCompress          = flagset.Bool("store.segment-compress", false, "compress compacted segment files on disk, with zstd")
+		segmentKeyFile           = flagset.String("store.segment-key-file", "", "if set, file of base64 AES-256 master keys, one per line, primary first, re-read on SIGHUP, to encrypt flushed segment files on disk with")
+		queryCacheSize           = flagset.Int64("store.query-cache-size", 0, "if nonzero, cache the results of queries of sealed ranges, up to this many bytes")
+		maxQueryDuration         = flagset.Duration("store.max-query-duration", 0, "if nonzero, stop queries after this long, and return the records found so far, as partial results")
+		queryMaxRecords          = flagset.Int("store.query-max-records", defaultStoreQueryMaxRecords, "truncate the results of each query at this many records, after filtering (0 for no limit)")
+		queryMaxBytes            = flagset.Int64("store.query-max-bytes", defaultStoreQueryMaxBytes, "truncate the results of each query at this many bytes of records, after filtering (0 for no limit)")
+		queryMaxSegments         = flagset.Int("store.query-max-segments", defaultStoreQueryMaxSegments, "truncate each query at this many segments per store node, oldest first, or newest, backward (0 for no limit)")
+		maxConcurrentQueries     = flagset.Int("store.max-concurrent-queries", 0, "if nonzero, serve at most this many user queries at once, and queue the rest")
+		queryQueueSize           = flagset.Int("store.query-queue-size", defaultStoreQueryQueueSize, "with -store.max-concurrent-queries, queue at most this many user queries, and refuse the rest, with HTTP 429")
+		queryQueueTimeout        = flagset.Duration("store.query-queue-timeout", defaultStoreQueryQueueTimeout, "with -store.max-concurrent-queries, refuse user queries still queued after this long, with HTTP 429")
+		maxConcurrentStreams     = flagset.Int("store.max-concurrent-streams", 0, "if nonzero, serve at most this many user streams, live or not, at once, and refuse the rest, with HTTP 429")
+		streamMaxBuffered        = flagset.Int64("store.stream-max-buffered", defaultStoreStreamMaxBuffered, "queue at most this many bytes of records for a streaming client that isn't keeping up, and drop the rest (0 for no limit)")
+		streamMaxStall           = flagset.Duration("store.stream-max-stall", defaultStoreStreamMaxStall, "drop records for a streaming client that's taken longer than this to accept a write (0 for no limit)")
+		streamEvictAfter         = flagset.Duration("store.stream-evict-after", defaultStoreStreamEvictAfter, "disconnect a streaming client that's still dropping records after this long (0 for never)")
+		peerBreakerFailures      = flagset.Int("store.peer-breaker-failures", defaultStorePeerBreakerFailures, "skip a peer, in user streams and in consuming and replicating segments, after this many consecutive failures to reach it; 0 to always try it")
+		peerBreakerWindow        = flagset.Duration("store.peer-breaker-window", defaultStorePeerBreakerWindow, "with -store.peer-breaker-failures, count only the failures within this long of the first")
+		peerBreakerCooldown      = flagset.Duration("store.peer-breaker-cooldown", defaultStorePeerBreakerCooldown, "with -store.peer-breaker-failures, skip a failing peer for this long, then try it with a single probe")
+		queryPlan                = flagset.Bool("store.query-plan", false, "read each segment of a user query from only one of its replicas, preferring those in -cluster.zone")
+		readyStallThreshold      = flagset.Duration("store.ready-stall-threshold", defaultStoreReadyStallThreshold, "/readyz fails while a consumer has made no progress for this long")
+		ioForegroundLatency      = flagset.Duration("store.io-foreground-latency", 0, "if nonzero, cap background I/O, e.g. consuming and compacting, while query reads are slower than this (p90)")
+		ioBackgroundRate         = flagset.Int64("store.io-background-rate", defaultStoreIOBackgroundRate, "with -store.io-foreground-latency, the cap on background I/O, in bytes per second")
+		segmentReplicationFactor = flagset.Int("store.replication-factor", defaultStoreSegmentReplicationFactor, "how many store nodes to replicate each segment to")
+		replicationChunkSize     = flagset.Int("store.replication-chunk-size", defaultStoreReplicationChunkSize, "replicate segments bigger than this in chunks of this size, resumed after transient failures (0 to send them whole)")
+		transferTimeout          = flagset.Duration("store.replication-transfer-timeout", defaultStoreTransferTimeout, "give up on segments replicated in chunks after this long, and abandon those received that get no chunk for this long")
+		shipTo                   = flagset.String("store.ship-to", "", "if set, URL of a standby store node's API, outside the cluster, e.g. https://standby:7650, to ship the segments replicated here first to")
+		shipQueueSize            = flagset.Int("store.ship-queue-size", defaultStoreShipQueueSize, "with -store.ship-to, queue at most this many segments to ship, and drop the oldest, unshipped, past that")
 		segmentRetain            = flagset.Duration("store.segment-retain", defaultStoreSegmentRetain, "retention period for segment files")
+		segmentRetainSize        = flagset.Int64("store.segment-retain-size", 0, "if nonzero, trash the oldest segment files beyond this many bytes")
+		segmentRetainImported    = flagset.Bool("store.segment-retain-imported", false, "apply -store.segment-retain and -store.segment-retain-size to imported segment files, too")
 		segmentPurge             = flagset.Duration("store.segment-purge", defaultStoreSegmentPurge, "purge deleted segment files after this long")
+		coldURL                  = flagset.String("store.cold-url", "", "if set, S3 bucket and prefix, unique to this node, e.g. s3://bucket/oklog/store-1, to move segment files older than -store.cold-age to, and query them from")
+		coldEndpoint             = flagset.String("store.cold-endpoint", "", "with -store.cold-url, URL of the S3 API, e.g. of MinIO, if not AWS's of -store.cold-region")
+		coldRegion               = flagset.String("store.cold-region", defaultStoreColdRegion, "with -store.cold-url, the bucket's region")
+		coldAge                  = flagset.Duration("store.cold-age", 0, "with -store.cold-url, move segment files to it once their newest record is this old, less than -store.segment-retain")
+		coldCacheSize            = flagset.Int64("store.cold-cache-size", defaultStoreColdCacheSize, "with -store.cold-url, cache at most this many bytes of records, of segments fetched from it for queries")
+		compactConcurrency       = flagset.Int("store.compact-concurrency", 1, "maximum concurrent compactions")
+		compactRate              = flagset.Int64("store.compact-rate", 0, "if nonzero, compactions read and write at most this many bytes per second")
+		compactScheme            = flagset.String("store.compact-scheme", defaultCompactScheme, "how to plan compactions: default, size-tiered, or time-window")
+		compactTarget            = flagset.Int64("store.compact-target-size", 0, "if nonzero, compact segments up to this size, rather than -store.segment-target-size")
+		compactFanout            = flagset.Int("store.compact-fanout", defaultCompactFanout, "with -store.compact-scheme=size-tiered, compact this many segments of a size tier at once")
+		compactWindow            = flagset.Duration("store.compact-window", defaultCompactWindow, "with -store.compact-scheme=time-window, only compact segments within the same window of this length, e.g. 1h or 24h")
+		repairRate               = flagset.Int64("store.repair-rate", defaultStoreRepairRate, "repairs replicate at most this many bytes per second")
+		verifyRate               = flagset.Int64("store.verify-rate", defaultStoreVerifyRate, "verifications read at most this many bytes of segments per second")
+		drainGracePeriod         = flagset.Duration("store.drain-grace-period", defaultStoreDrainGracePeriod, "when draining, wait this long for in-flight queries")
+		diskHighWatermark        = flagset.Float64("store.disk-high-watermark", defaultStoreDiskHighWatermark, "stop consuming segments, and warn, once this fraction of the -store.path filesystem is used")
+		diskCriticalWatermark    = flagset.Float64("store.disk-critical-watermark", defaultStoreDiskCriticalWatermark, "also refuse replication once this fraction of the -store.path filesystem is used")
 		uiLocal                  = flagset.Bool("ui.local", false, "ignore embedded files and go straight to the filesystem")
 		filesystem               = flagset.String("filesystem", defaultFilesystem, "real, virtual, nop")
+		syncBytes                = flagset.Int("filesystem.sync-bytes", defaultFilesystemSyncBytes, "write files back to disk every this many bytes written, not all at once (0 to leave it to the OS)")
+		dropSealed               = flagset.Bool("filesystem.drop-sealed", false, "drop sealed segments from the page cache, to leave it to queries")
+		mmap                     = flagset.Bool("filesystem.mmap", false, "with -filesystem=real, memory map segments to read them")
+		tlsCert                  = flagset.String("tls.cert", "", "if set, serve TLS with this certificate (requires -tls.key)")
+		tlsKey                   = flagset.String("tls.key", "", "private key of -tls.cert")
+		tlsClientCA              = flagset.String("tls.client-ca", "", "if set, require client certificates signed by these CAs (mutual TLS)")
+		clientDialTimeout        = flagset.Duration("cluster.client-dial-timeout", defaultClientDialTimeout, "timeout for connecting to other nodes (0 for no limit)")
+		clientTLSTimeout         = flagset.Duration("cluster.client-tls-handshake-timeout", defaultTLSHandshakeTimeout, "with TLS, timeout for handshakes with other nodes (0 for no limit)")
+		clientHeaderTimeout      = flagset.Duration("cluster.client-response-header-timeout", defaultClientResponseHeaderTimeout, "timeout for other nodes' response headers, once a request is sent (0 for no limit); bodies, e.g. of streams, aren't limited")
+		clientIdleConns          = flagset.Int("cluster.client-max-idle-conns-per-host", defaultClientMaxIdleConnsPerHost, "idle connections to keep open to each other node, for reuse")
+		clientKeepAlive          = flagset.Duration("cluster.client-keepalive", defaultClientKeepAlive, "TCP keepalive interval of connections to other nodes (0 for the OS default)")
+		apiAuthFile              = flagset.String("api.auth-token-file", "", "if set, API requests must bear the token in this file")
+		apiAuthExemptHealth      = flagset.Bool("api.auth-exempt-health", false, "with -api.auth-token-file, serve /health, /healthz, /readyz, and /metrics without a token")
+		apiLiveCrossOrigin       = flagset.Bool("api.live-cross-origin", false, "accept live tails, over WebSocket, from pages of other origins")
+		auditLog                 = flagset.String("store.audit-log", "", "if set, audit user queries to this file, or to the process log with \"log\"")
+		auditLogMaxSize          = flagset.Int64("store.audit-log-max-size", defaultStoreAuditLogMaxSize, "rotate the -store.audit-log file once it grows past this size")
+		auditLogKeep             = flagset.Int("store.audit-log-keep", defaultStoreAuditLogKeep, "keep this many rotated -store.audit-log files")
+		tlsCA                    = flagset.String("tls.ca", "", "with TLS, CA certificates to verify peers with (default system)")
+		alerts                   = newAlertFlags(flagset)
 		clusterPeers             = stringslice{}
+		clusterLabels            = stringslice{}
 	)
 	flagset.Var(&clusterPeers, "peer", "cluster peer host:port (repeatable)")
+	flagset.Var(&clusterLabels, "cluster.label", "key=value label to advertise in cluster, and stamp on ingested segments (repeatable)")
+	flagset.IntVar(segmentReplicationFactor, "store.segment-replication-factor", defaultStoreSegmentReplicationFactor, "DEPRECATED: use -store.replication-factor")
 	flagset.Usage = usageFor(flagset, "oklog ingeststore [flags]")
 	if err := flagset.Parse(args); err != nil {
 		return err
 	}
+	labels, err := parseClusterLabels(clusterLabels)
+	if err != nil {
+		return err
+	}
+	if *singleNode && (len(clusterPeers) > 0 || staticPeersGiven(flagset)) {
+		return errors.New("-single-node can't be combined with -peer, or static peers")
+	}
+	if *ingestCriticalWatermark <= 0 || *ingestCriticalWatermark > 1 {
+		return errors.Errorf("invalid -ingest.disk-critical-watermark %v", *ingestCriticalWatermark)
+	}
+	if *segmentInterval > 0 && (*segmentMinSize <= 0 || *segmentMaxSize < *segmentMinSize) {
+		return errors.Errorf("invalid -ingest.segment-min-flush-size %d, -ingest.segment-max-flush-size %d", *segmentMinSize, *segmentMaxSize)
+	}
+	if *segmentReplicationFactor < 1 {
+		return errors.Errorf("invalid -store.replication-factor %d", *segmentReplicationFactor)
+	}
+	if *replicationChunkSize < 0 {
+		return errors.Errorf("invalid -store.replication-chunk-size %d", *replicationChunkSize)
+	}
+	if *transferTimeout <= 0 {
+		return errors.Errorf("invalid -store.replication-transfer-timeout %s", *transferTimeout)
+	}
+	if *maxConcurrentQueries < 0 {
+		return errors.Errorf("invalid -store.max-concurrent-queries %d", *maxConcurrentQueries)
+	}
+	if *queryQueueSize < 0 {
+		return errors.Errorf("invalid -store.query-queue-size %d", *queryQueueSize)
+	}
+	if *queryQueueTimeout <= 0 {
+		return errors.Errorf("invalid -store.query-queue-timeout %s", *queryQueueTimeout)
+	}
+	if *maxConcurrentStreams < 0 {
+		return errors.Errorf("invalid -store.max-concurrent-streams %d", *maxConcurrentStreams)
+	}
+	if *peerBreakerFailures < 0 {
+		return errors.Errorf("invalid -store.peer-breaker-failures %d", *peerBreakerFailures)
+	}
+	if *peerBreakerFailures > 0 && *peerBreakerWindow <= 0 {
+		return errors.Errorf("invalid -store.peer-breaker-window %s", *peerBreakerWindow)
+	}
+	if *peerBreakerFailures > 0 && *peerBreakerCooldown <= 0 {
+		return errors.Errorf("invalid -store.peer-breaker-cooldown %s", *peerBreakerCooldown)
+	}
+	if *diskHighWatermark <= 0 || *diskHighWatermark > *diskCriticalWatermark || *diskCriticalWatermark > 1 {
+		return errors.Errorf("invalid -store.disk-high-watermark %v, -store.disk-critical-watermark %v", *diskHighWatermark, *diskCriticalWatermark)
+	}
+	compactTargetSize := *segmentTargetSize
+	if *compactTarget > 0 {
+		compactTargetSize = *compactTarget
+	}
+	compactionPlanners, err := newCompactionPlanners(*compactScheme, compactTargetSize, *compactFanout, *compactWindow)
+	if err != nil {
+		return err
+	}
 
 	// +-1----------------+   +-2----------+   +-1----------+  +-1---------+  +-1-----+
 	// | Fast listener    |<--| Write      |-->| ingest.Log |  | store.Log |  | Peer  |
@@ -85,15 +256,9 @@ func runIngestStore(args []string) error {
 	//                        +------------+
 
 	// Logging.
-	var logger log.Logger
-	{
-		logLevel := level.AllowInfo()
-		if *debug {
-			logLevel = level.AllowAll()
-		}
-		logger = log.NewLogfmtLogger(os.Stderr)
-		logger = log.With(logger, "ts", log.DefaultTimestampUTC)
-		logger = level.NewFilter(logger, logLevel)
+	logger, err := newLogger(os.Stderr, *logFormat, *logLevel, *debug)
+	if err != nil {
+		return err
 	}
 
 	// Instrumentation.
@@ -134,6 +299,11 @@ func runIngestStore(args []string) error {
 		Help:      "Size of active segment when flushed in bytes.",
 		Buckets:   []float64{1 << 14, 1 << 15, 1 << 16, 1 << 17, 1 << 18, 1 << 19, 1 << 20, 1 << 21, 1 << 22, 1 << 23, 1 << 24},
 	})
+	segmentFlushThreshold := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "oklog",
+		Name:      "ingest_segment_flush_threshold_bytes",
+		Help:      "Size at which active segments are flushed, as adapted to the ingest rate.",
+	})
 	failedSegments := prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "oklog",
 		Name:      "ingest_failed_segments",
@@ -155,6 +325,16 @@ func runIngestStore(args []string) error {
 		Help:      "Duration of each compaction in seconds.",
 		Buckets:   prometheus.DefBuckets,
 	}, []string{"kind", "compacted", "result"})
+	compactBytes := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "store_compact_bytes",
+		Help:      "Bytes read and written by compactions, by direction i.e. read or write.",
+	}, []string{"direction"})
+	compactQueue := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "oklog",
+		Name:      "store_compact_queue_depth",
+		Help:      "Compactions waiting for a free slot.",
+	})
 	consumedSegments := prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "oklog",
 		Name:      "store_consumed_segments",
@@ -165,6 +345,21 @@ func runIngestStore(args []string) error {
 		Name:      "store_consumed_bytes",
 		Help:      "Bytes consumed from ingest nodes.",
 	})
+	consumeLag := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "oklog",
+		Name:      "store_consume_lag_seconds",
+		Help:      "Age of the oldest record of the segment each ingest node last gave this node's consumers, as of when it gave it, or zero, if it had none.",
+	}, []string{"ingester"})
+	consumePending := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "oklog",
+		Name:      "store_consume_pending_segments",
+		Help:      "Segments gathered from each ingest node by this node's consumers, not yet replicated and committed.",
+	}, []string{"ingester"})
+	consumeLastCommit := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "oklog",
+		Name:      "store_consume_last_commit_timestamp_seconds",
+		Help:      "When segments of each ingest node were last committed by this node's consumers, in Unix time.",
+	}, []string{"ingester"})
 	replicatedSegments := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "oklog",
 		Name:      "store_replicated_segments",
@@ -185,13 +380,72 @@ func runIngestStore(args []string) error {
 		Name:      "store_purged_segments",
 		Help:      "Segments purged from trash.",
 	}, []string{"success"})
+	corruptSegments := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "store_corrupt_segments",
+		Help:      "Segments quarantined after failing checksum verification.",
+	})
+	diskBytes := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "oklog",
+		Name:      "store_disk_bytes",
+		Help:      "Disk usage of -store.path, by kind i.e. segments, trash, capacity, or available.",
+	}, []string{"kind"})
+	queriesInFlight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "oklog",
+		Name:      "store_queries_in_flight",
+		Help:      "User queries being served, with -store.max-concurrent-queries, and streams, with -store.max-concurrent-streams, by kind i.e. query or stream.",
+	}, []string{"kind"})
+	queriesQueued := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "oklog",
+		Name:      "store_queries_queued",
+		Help:      "User queries waiting for a free slot, with -store.max-concurrent-queries, by kind i.e. query.",
+	}, []string{"kind"})
+	peerBreakerState := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "oklog",
+		Name:      "store_peer_breaker_state",
+		Help:      "State of this node's breaker of each peer it's failed to reach, with -store.peer-breaker-failures: 0 for closed, 1 for half-open, 2 for open.",
+	}, []string{"peer"})
 	apiDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: "oklog",
 		Name:      "api_request_duration_seconds",
 		Help:      "API request duration in seconds.",
 		Buckets:   prometheus.DefBuckets,
 	}, []string{"method", "path", "status_code"})
-	prometheus.MustRegister(
+	syslogDropped := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_syslog_messages_dropped_total",
+		Help:      "Syslog messages dropped, because they were malformed or oversized.",
+	}, []string{"reason"})
+	throttledConnections := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_throttled_connections_total",
+		Help:      "Connections that were throttled by a rate limit, or held, by scope (connection, global, hold).",
+	}, []string{"scope"})
+	throttledSeconds := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_throttled_seconds_total",
+		Help:      "Time connections spent waiting on a rate limit, or held, by scope (connection, global, hold).",
+	}, []string{"scope"})
+	oversizedRecords := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_oversized_records_total",
+		Help:      "Records bigger than the maximum size, by policy (truncate, reject).",
+	}, []string{"policy"})
+	ingestCompressedBytes := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_snappy_compressed_bytes_total",
+		Help:      "Bytes read from clients that compress with snappy, as they were sent.",
+	})
+	ingestUncompressedBytes := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "ingest_snappy_uncompressed_bytes_total",
+		Help:      "Bytes read from clients that compress with snappy, once decompressed.",
+	})
+	quotaMetrics := newQuotaMetrics()
+	registerer.MustRegister(quotaMetrics.collectors()...)
+	ingestLatency := newIngestLatencyMetrics(latencyBuckets)
+	registerer.MustRegister(ingestLatency.collectors()...)
+	registerer.MustRegister(
 		connectedClients,
 		ingestWriterBytes,
 		ingestWriterRecords,
@@ -199,18 +453,43 @@ func runIngestStore(args []string) error {
 		ingestWriterRotations,
 		flushedSegmentAge,
 		flushedSegmentSize,
+		segmentFlushThreshold,
 		failedSegments,
 		committedSegments,
 		committedBytes,
 		compactDuration,
+		compactBytes,
+		compactQueue,
 		consumedSegments,
 		consumedBytes,
+		consumeLag,
+		consumePending,
+		consumeLastCommit,
 		replicatedSegments,
 		replicatedBytes,
 		trashedSegments,
 		purgedSegments,
+		corruptSegments,
+		diskBytes,
+		queriesInFlight,
+		queriesQueued,
+		peerBreakerState,
 		apiDuration,
+		syslogDropped,
+		throttledConnections,
+		throttledSeconds,
+		oversizedRecords,
+		ingestCompressedBytes,
+		ingestUncompressedBytes,
 	)
+	var segmentSizer *ingest.SegmentSizer // nil for -ingest.segment-flush-size
+	if *segmentInterval > 0 {
+		segmentSizer = ingest.NewSegmentSizer(*segmentInterval, *segmentMinSize, *segmentMaxSize, segmentFlushThreshold)
+	} else {
+		segmentFlushThreshold.Set(float64(*segmentFlushSize))
+	}
+	streamMetrics := stream.NewMetrics(registerer)
+	queryMetrics := store.NewQueryMetrics(registerer, latencyBuckets)
 
 	// Parse listener addresses.
 	fastNetwork, fastAddress, _, _, err := parseAddr(*fastAddr, defaultFastPort)
@@ -225,7 +504,14 @@ func runIngestStore(args []string) error {
 	if err != nil {
 		return err
 	}
-	apiNetwork, apiAddress, _, apiPort, err := parseAddr(*apiAddr, defaultAPIPort)
+	var syslogAddress string
+	if *syslogAddr != "" {
+		_, syslogAddress, _, _, err = parseAddr(*syslogAddr, defaultSyslogPort)
+		if err != nil {
+			return err
+		}
+	}
+	apiNetwork, apiAddress, apiHost, apiPort, err := parseAddr(*apiAddr, defaultAPIPort)
 	if err != nil {
 		return err
 	}
@@ -262,34 +548,105 @@ func runIngestStore(args []string) error {
 	if clusterAdvertisePort == 0 {
 		clusterAdvertisePort = clusterBindPort
 	}
+	if !listensOn(apiHost, clusterAdvertiseHost) {
+		level.Warn(logger).Log("err", "this node advertises its API on a host it doesn't listen on", "api", apiAddress, "advertised_api", fmt.Sprintf("%s:%d", clusterAdvertiseHost, apiPort))
+		level.Warn(logger).Log("err", "peers will be unable to query or stream from this node")
+		level.Warn(logger).Log("err", "provide -api on all interfaces, or -cluster.advertise-addr as the API's host")
+	}
+
+	// TLS, for listeners, and for requests to peers.
+	var peerTLS *tls.Config
+	serverTLS, err := serverTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+	if err != nil {
+		return err
+	}
+	if serverTLS != nil {
+		peerTLS, err = clientTLSConfig(*tlsCA, *tlsCert, *tlsKey)
+		if err != nil {
+			return err
+		}
+		level.Info(logger).Log("tls", "enabled", "client_auth", *tlsClientCA != "")
+	}
+
+	clients := clientConfig{
+		dialTimeout:           *clientDialTimeout,
+		tlsHandshakeTimeout:   *clientTLSTimeout,
+		responseHeaderTimeout: *clientHeaderTimeout,
+		maxIdleConnsPerHost:   *clientIdleConns,
+		keepAlive:             *clientKeepAlive,
+	}
+	if err := clients.validate(); err != nil {
+		return err
+	}
+
+	// Auth token, for API requests.
+	authToken, err := readAuthToken(*apiAuthFile)
+	if err != nil {
+		return err
+	}
 
 	// Bind listeners.
 	fastListener, err := net.Listen(fastNetwork, fastAddress)
 	if err != nil {
 		return err
 	}
+	fastListener = tlsListener(fastListener, serverTLS)
 	level.Info(logger).Log("fast", fmt.Sprintf("%s://%s", fastNetwork, fastAddress))
 	durableListener, err := net.Listen(durableNetwork, durableAddress)
 	if err != nil {
 		return err
 	}
+	durableListener = tlsListener(durableListener, serverTLS)
 	level.Info(logger).Log("durable", fmt.Sprintf("%s://%s", durableNetwork, durableAddress))
 	bulkListener, err := net.Listen(bulkNetwork, bulkAddress)
 	if err != nil {
 		return err
 	}
+	bulkListener = tlsListener(bulkListener, serverTLS)
 	level.Info(logger).Log("bulk", fmt.Sprintf("%s://%s", bulkNetwork, bulkAddress))
+	var (
+		syslogListener   net.Listener
+		syslogPacketConn net.PacketConn
+	)
+	if syslogAddress != "" {
+		syslogListener, err = net.Listen("tcp", syslogAddress)
+		if err != nil {
+			return err
+		}
+		syslogPacketConn, err = net.ListenPacket("udp", syslogAddress)
+		if err != nil {
+			return err
+		}
+		level.Info(logger).Log("syslog", fmt.Sprintf("tcp+udp://%s", syslogAddress))
+	}
 	apiListener, err := net.Listen(apiNetwork, apiAddress)
 	if err != nil {
 		return err
 	}
+	apiListener = tlsListener(apiListener, serverTLS)
 	level.Info(logger).Log("API", fmt.Sprintf("%s://%s", apiNetwork, apiAddress))
+	grpcListener, err := listenGRPC(*grpcAddr, logger)
+	if err != nil {
+		return err
+	}
+	debugListener, err := listenDebug(*debugAddr, logger)
+	if err != nil {
+		return err
+	}
+	var ops *inflight.Registry // with -debug-addr
+	if debugListener != nil {
+		ops = inflight.NewRegistry()
+	}
+	clients.ops = ops
 
 	// Create ingestlog.
 	var fsys fs.Filesystem
 	switch strings.ToLower(*filesystem) {
 	case "real":
 		fsys = fs.NewRealFilesystem()
+		if *mmap {
+			fsys = fs.NewRealFilesystemWithMmap()
+		}
 	case "virtual":
 		fsys = fs.NewVirtualFilesystem()
 	case "nop":
@@ -297,7 +654,8 @@ func runIngestStore(args []string) error {
 	default:
 		return errors.Errorf("invalid -filesystem %q", *filesystem)
 	}
-	ingestLog, err := ingest.NewFileLog(fsys, *ingestPath)
+	fsys = fs.NewWritebackFilesystem(fsys, fs.Writeback{SyncBytes: int64(*syncBytes), DropSealed: *dropSealed})
+	ingestLog, err := ingest.NewFileLog(fsys, *ingestPath, labels.String(), log.With(logger, "component", "IngestLog"))
 	if err != nil {
 		return err
 	}
@@ -309,12 +667,37 @@ func runIngestStore(args []string) error {
 	level.Info(logger).Log("ingest_path", *ingestPath)
 
 	// Create storelog.
-	storeLog, err := store.NewFileLog(
-		fsys,
-		*storePath,
-		*segmentTargetSize, *segmentBufferSize,
-		store.LogReporter{Logger: log.With(logger, "component", "FileLog")},
-	)
+	queryCache := newQueryCache(registerer, *queryCacheSize)
+	coldTier, err := newColdTier(registerer, *coldURL, *coldEndpoint, *coldRegion, *coldAge, *segmentRetain, *coldCacheSize, fsys, *storePath, logger)
+	if err != nil {
+		return err
+	}
+	masterKeys, err := newSegmentKeys(*segmentKeyFile)
+	if err != nil {
+		return err
+	}
+	var segmentKeys store.KeyWrapper // not a nil *MasterKeys
+	if masterKeys != nil {
+		segmentKeys = masterKeys
+	}
+	alertBus, err := alerts.newBus(registerer, fmt.Sprintf("%s:%d", clusterAdvertiseHost, apiPort), logger)
+	if err != nil {
+		return err
+	}
+	scheduledFS := fs.NewScheduledFilesystem(fsys, newIOScheduler(registerer, *ioForegroundLatency, *ioBackgroundRate))
+	storeLog, err := store.NewFileLog(scheduledFS, *storePath, *segmentTargetSize, *segmentBufferSize, store.FileLogConfig{
+		QueryConcurrency: *queryConcurrency,
+		Compress:         *segmentCompress,
+		Keys:             segmentKeys,
+		Cache:            queryCache,
+		Cold:             coldTier,
+		ForceRecovery:    *forceRecovery,
+		CorruptSegments:  corruptSegments,
+		Reporter:         alertReporter{store.LogReporter{Logger: log.With(logger, "component", "FileLog")}, alertBus},
+	})
+	if _, ok := errors.Cause(err).(store.RecoveryError); ok {
+		return errors.Wrap(err, "inspect the ambiguous segments, or start anyway with -store.force-recovery")
+	}
 	if err != nil {
 		return err
 	}
@@ -325,53 +708,142 @@ func runIngestStore(args []string) error {
 	}()
 	level.Info(logger).Log("store_path", *storePath)
 
-	// Create peer.
-	peer, err := cluster.NewPeer(
-		clusterBindHost, clusterBindPort,
-		clusterAdvertiseHost, clusterAdvertisePort,
-		clusterPeers,
-		cluster.PeerTypeIngestStore, apiPort,
-		log.With(logger, "component", "cluster"),
-	)
-	if err != nil {
-		return err
+	// Create peer, which gossips, unless it has static peers, or it's a
+	// single node, which is a static peer without any.
+	static := staticPeersGiven(flagset)
+	var peer *cluster.Peer
+	if *singleNode {
+		peer, err = cluster.NewStaticPeer(
+			clusterAdvertiseHost,
+			cluster.PeerTypeIngestStore, apiPort,
+			*clusterZone,
+			labels,
+			nil,
+			staticHealthClient(peerTLS, authToken),
+			*staticHealthInterval,
+			log.With(logger, "component", "cluster"),
+		)
+		if err != nil {
+			return err
+		}
+	} else if static {
+		if len(clusterPeers) > 0 {
+			return errors.New("-peer can't be combined with static peers")
+		}
+		if *encryptKeyFile != "" {
+			return errors.New("-cluster.encrypt-key-file can't be combined with static peers, which don't gossip")
+		}
+		peers, err := loadStaticPeers(*staticPeers, *staticPeersFile)
+		if err != nil {
+			return err
+		}
+		peer, err = cluster.NewStaticPeer(
+			clusterAdvertiseHost,
+			cluster.PeerTypeIngestStore, apiPort,
+			*clusterZone,
+			labels,
+			peers,
+			staticHealthClient(peerTLS, authToken),
+			*staticHealthInterval,
+			log.With(logger, "component", "cluster"),
+		)
+		if err != nil {
+			return err
+		}
+	} else {
+		keys, err := readGossipKeys(*encryptKeyFile)
+		if err != nil {
+			return err
+		}
+		peer, err = cluster.NewPeer(
+			clusterBindHost, clusterBindPort,
+			clusterAdvertiseHost, clusterAdvertisePort,
+			clusterPeers,
+			cluster.PeerTypeIngestStore, apiPort,
+			*clusterZone,
+			labels,
+			keys,
+			log.With(logger, "component", "cluster"),
+		)
+		if err != nil {
+			return err
+		}
 	}
-	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+	registerer.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
 		Namespace: "oklog",
 		Name:      "cluster_size",
 		Help:      "Number of peers in the cluster from this node's perspective.",
 	}, func() float64 { return float64(peer.ClusterSize()) }))
+	registerClockOffset(registerer, peer)
 
-	// Create the HTTP clients we'll use for various purposes.
-	unlimitedClient := http.DefaultClient // no timeouts, be careful
-	timeoutClient := &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			ResponseHeaderTimeout: 5 * time.Second,
-			Dial: (&net.Dialer{
-				Timeout:   10 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).Dial,
-			TLSHandshakeTimeout: 10 * time.Second,
-			DisableKeepAlives:   false,
-			MaxIdleConnsPerHost: 1,
-		},
+	// Create the HTTP client we'll use to talk to other nodes, for every
+	// purpose. It has no overall timeout, so streams can go on; see
+	// clientConfig.
+	peerClient := clients.client(peerTLS, authToken)
+
+	// A single node talks to itself, to gather its segments, replicate them,
+	// and query them, in-process, with peerAPIs, once its ingest and store
+	// APIs are registered with it.
+	peerAPIs := http.NewServeMux()
+	if *singleNode {
+		peerClient = loopbackClient(peer.APIAddr(), peerAPIs, peerClient)
 	}
 
 	var rfac record.ReaderFactory
 	{
+		var policy record.SizePolicy
+		switch *recordSizePolicy {
+		case recordSizePolicyTruncate:
+			policy = record.Truncate
+		case recordSizePolicyReject:
+			policy = record.Reject
+		default:
+			return fmt.Errorf("record size policy %q invalid, must be %q or %q", *recordSizePolicy, recordSizePolicyTruncate, recordSizePolicyReject)
+		}
+		oversized := oversizedRecords.WithLabelValues(*recordSizePolicy).Inc
+		if *recordMaxSize <= 0 || *recordMaxSize > record.MaxSize {
+			return fmt.Errorf("-ingest.record-max-size %d invalid, must be positive, and at most %d", *recordMaxSize, record.MaxSize)
+		}
+		if *httpMaxBodySize <= 0 {
+			return fmt.Errorf("-ingest.http-max-body-size %d invalid, must be positive", *httpMaxBodySize)
+		}
+
 		topicb := []byte(*topic)
 		switch {
 		case *topicMode == topicModeDynamic:
-			rfac = record.NewDynamicReader
+			rfac = record.DynamicReaderFactory(*recordMaxSize, policy, oversized)
 		case *topicMode == topicModeStatic && record.IsValidTopic(topicb):
-			rfac = record.StaticReaderFactory(topicb)
+			rfac = record.StaticReaderFactory(topicb, *recordMaxSize, policy, oversized)
 		case *topicMode == topicModeStatic && !record.IsValidTopic(topicb):
 			return fmt.Errorf("topic name %q invalid", *topic)
 		default:
 			return fmt.Errorf("topic mode %q invalid, must be %q or %q", *topicMode, topicModeStatic, topicModeDynamic)
 		}
 	}
+	limiter := ingest.NewLimiter(
+		*connRecordRate, *connByteRate,
+		*recordRate, *byteRate,
+		throttledConnections, throttledSeconds,
+	)
+	quotas, err := newQuotas(*quotaFile, quotaMetrics)
+	if err != nil {
+		return err
+	}
+	filter, err := newFilter(registerer, *filterFile)
+	if err != nil {
+		return err
+	}
+	timestamps := newClientTimestamps(registerer, *clientTimestamps, *clientTimestampSkew)
+	clockGuard := newClockGuard(registerer, *maxClockSkew)
+	idClock := newIDClock(registerer, *maxClockRegression, log.With(logger, "component", "ingest"))
+	monotonic := newMonotonicIDs(*monotonicIDs)
+	syslogTopicb := []byte(*syslogTopic)
+	if syslogAddress != "" && !record.IsValidTopic(syslogTopicb) {
+		return fmt.Errorf("syslog topic name %q invalid", *syslogTopic)
+	}
+	if syslogAddress != "" && (*syslogMaxSize <= 0 || *syslogMaxSize > record.MaxSize) {
+		return fmt.Errorf("-ingest.syslog-max-size %d invalid, must be positive, and at most %d", *syslogMaxSize, record.MaxSize)
+	}
 
 	// Execution group.
 	var g group.Group
@@ -385,63 +857,291 @@ func runIngestStore(args []string) error {
 		})
 	}
 	{
+		cancel := make(chan struct{})
 		g.Add(func() error {
-			return ingest.HandleConnections(
-				fastListener,
-				ingest.HandleFastWriter,
-				rfac,
-				ingestLog,
-				*segmentFlushAge, *segmentFlushSize,
-				connectedClients.WithLabelValues("fast"),
-				ingestWriterBytes, ingestWriterRecords, ingestWriterSyncs,
-				flushedSegmentAge, flushedSegmentSize,
-			)
+			return watchClockSkew(peer, *clockSkewWarning, defaultClockCheckInterval, clockGuard, alertBus, cancel, log.With(logger, "component", "cluster"))
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	{
+		g.Add(func() error {
+			alertBus.Run()
+			return nil
+		}, func(error) {
+			alertBus.Stop()
+		})
+	}
+	if static {
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return reloadStaticPeers(peer, *staticPeers, *staticPeersFile, cancel, log.With(logger, "component", "cluster"))
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	if *encryptKeyFile != "" {
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return reloadGossipKeys(peer, *encryptKeyFile, cancel, log.With(logger, "component", "cluster"))
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	if masterKeys != nil {
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return reloadSegmentKeys(masterKeys, *segmentKeyFile, cancel, log.With(logger, "component", "FileLog"))
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	if quotas != nil {
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return reloadQuotas(quotas, *quotaFile, cancel, log.With(logger, "component", "ingest"))
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	if filter != nil {
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return reloadFilter(filter, *filterFile, cancel, log.With(logger, "component", "ingest"))
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	{
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return holdIngestOnLowDisk(fsys, *ingestPath, *ingestCriticalWatermark, defaultIngestDiskCheckInterval, limiter, alertBus, cancel, log.With(logger, "component", "ingest"))
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	lagMonitor := newIngestLagMonitor(registerer, ingestLog, log.With(logger, "component", "ingest"))
+	{
+		g.Add(func() error {
+			lagMonitor.Run()
+			return nil
+		}, func(error) {
+			lagMonitor.Stop()
+		})
+	}
+	connections := ingest.NewConnections(defaultIngestConnectionsWindow, log.With(logger, "component", "ingest"))
+	{
+		g.Add(func() error {
+			connections.Run()
+			return nil
+		}, func(error) {
+			connections.Stop()
+		})
+	}
+	httpWriter, err := ingest.NewWriter(
+		ingestLog,
+		*segmentFlushAge, *segmentFlushSize, segmentSizer,
+		*durableCommitLatency, *durableCommitBytes,
+		ingestWriterBytes, ingestWriterRecords, ingestWriterSyncs,
+		flushedSegmentAge, flushedSegmentSize,
+		log.With(logger, "component", "Writer"),
+	)
+	if err != nil {
+		return err
+	}
+	httpIngester := ingest.NewHTTPIngester(httpWriter, monotonic, rfac, *httpMaxBodySize, limiter, quotas, timestamps, clockGuard, idClock, filter)
+	{
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			<-cancel
+			return nil
+		}, func(error) {
+			close(cancel)
+			httpIngester.Stop()
+		})
+	}
+	{
+		g.Add(func() error {
+			return ingest.HandleConnections(fastListener, ingest.ConnectionConfig{
+				Handler:           ingest.HandleFastWriter,
+				ReaderFactory:     rfac,
+				Log:               ingestLog,
+				Logger:            log.With(logger, "component", "Writer"),
+				SegmentFlushAge:   *segmentFlushAge,
+				SegmentFlushSize:  *segmentFlushSize,
+				Sizer:             segmentSizer,
+				DrainTimeout:      *drainTimeout,
+				Limiter:           limiter,
+				Quotas:            quotas,
+				Timestamps:        timestamps,
+				Clock:             clockGuard,
+				IDClock:           idClock,
+				IDs:               monotonic,
+				Filter:            filter,
+				Connections:       connections,
+				ConnectedClients:  connectedClients.WithLabelValues("fast"),
+				Bytes:             ingestWriterBytes,
+				Records:           ingestWriterRecords,
+				Syncs:             ingestWriterSyncs,
+				SegmentAge:        flushedSegmentAge,
+				SegmentSize:       flushedSegmentSize,
+				WriteLatency:      ingestLatency.write.WithLabelValues("fast"),
+				AckLatency:        ingestLatency.ack,
+				CompressedBytes:   ingestCompressedBytes,
+				UncompressedBytes: ingestUncompressedBytes,
+			})
 		}, func(error) {
 			fastListener.Close()
 		})
 		g.Add(func() error {
-			return ingest.HandleConnections(
-				durableListener,
-				ingest.HandleDurableWriter,
-				rfac,
-				ingestLog,
-				*segmentFlushAge, *segmentFlushSize,
-				connectedClients.WithLabelValues("durable"),
-				ingestWriterBytes, ingestWriterRecords, ingestWriterSyncs,
-				flushedSegmentAge, flushedSegmentSize,
-			)
+			return ingest.HandleConnections(durableListener, ingest.ConnectionConfig{
+				Handler:           ingest.HandleDurableWriter,
+				ReaderFactory:     rfac,
+				Log:               ingestLog,
+				Logger:            log.With(logger, "component", "Writer"),
+				SegmentFlushAge:   *segmentFlushAge,
+				SegmentFlushSize:  *segmentFlushSize,
+				Sizer:             segmentSizer,
+				CommitLatency:     *durableCommitLatency,
+				CommitBytes:       *durableCommitBytes,
+				DrainTimeout:      *drainTimeout,
+				Limiter:           limiter,
+				Quotas:            quotas,
+				Timestamps:        timestamps,
+				Clock:             clockGuard,
+				IDClock:           idClock,
+				IDs:               monotonic,
+				Filter:            filter,
+				Connections:       connections,
+				ConnectedClients:  connectedClients.WithLabelValues("durable"),
+				Bytes:             ingestWriterBytes,
+				Records:           ingestWriterRecords,
+				Syncs:             ingestWriterSyncs,
+				SegmentAge:        flushedSegmentAge,
+				SegmentSize:       flushedSegmentSize,
+				WriteLatency:      ingestLatency.write.WithLabelValues("durable"),
+				AckLatency:        ingestLatency.ack,
+				CompressedBytes:   ingestCompressedBytes,
+				UncompressedBytes: ingestUncompressedBytes,
+			})
 		}, func(error) {
 			durableListener.Close()
 		})
 		g.Add(func() error {
-			return ingest.HandleConnections(
-				bulkListener,
-				ingest.HandleBulkWriter,
-				rfac,
-				ingestLog,
-				*segmentFlushAge, *segmentFlushSize,
-				connectedClients.WithLabelValues("bulk"),
-				ingestWriterBytes, ingestWriterRecords, ingestWriterSyncs,
-				flushedSegmentAge, flushedSegmentSize,
-			)
+			return ingest.HandleConnections(bulkListener, ingest.ConnectionConfig{
+				Handler:           ingest.HandleBulkWriter,
+				ReaderFactory:     rfac,
+				Log:               ingestLog,
+				Logger:            log.With(logger, "component", "Writer"),
+				SegmentFlushAge:   *segmentFlushAge,
+				SegmentFlushSize:  *segmentFlushSize,
+				Sizer:             segmentSizer,
+				DrainTimeout:      *drainTimeout,
+				Limiter:           limiter,
+				Quotas:            quotas,
+				Timestamps:        timestamps,
+				Clock:             clockGuard,
+				IDClock:           idClock,
+				IDs:               monotonic,
+				Filter:            filter,
+				Connections:       connections,
+				ConnectedClients:  connectedClients.WithLabelValues("bulk"),
+				Bytes:             ingestWriterBytes,
+				Records:           ingestWriterRecords,
+				Syncs:             ingestWriterSyncs,
+				SegmentAge:        flushedSegmentAge,
+				SegmentSize:       flushedSegmentSize,
+				WriteLatency:      ingestLatency.write.WithLabelValues("bulk"),
+				AckLatency:        ingestLatency.ack,
+				CompressedBytes:   ingestCompressedBytes,
+				UncompressedBytes: ingestUncompressedBytes,
+			})
 		}, func(error) {
 			bulkListener.Close()
 		})
+		if syslogAddress != "" {
+			g.Add(func() error {
+				return ingest.HandleConnections(syslogListener, ingest.ConnectionConfig{
+					Handler:          ingest.HandleFastWriter,
+					ReaderFactory:    ingest.SyslogReaderFactory(syslogTopicb, *syslogMaxSize, syslogDropped),
+					Log:              ingestLog,
+					Logger:           log.With(logger, "component", "Writer"),
+					SegmentFlushAge:  *segmentFlushAge,
+					SegmentFlushSize: *segmentFlushSize,
+					Sizer:            segmentSizer,
+					DrainTimeout:     *drainTimeout,
+					Limiter:          limiter,
+					Quotas:           quotas,
+					// no Timestamps: syslog records have no client timestamps
+					Clock:             clockGuard,
+					IDClock:           idClock,
+					IDs:               monotonic,
+					Filter:            filter,
+					Connections:       connections,
+					ConnectedClients:  connectedClients.WithLabelValues("syslog"),
+					Bytes:             ingestWriterBytes,
+					Records:           ingestWriterRecords,
+					Syncs:             ingestWriterSyncs,
+					SegmentAge:        flushedSegmentAge,
+					SegmentSize:       flushedSegmentSize,
+					WriteLatency:      ingestLatency.write.WithLabelValues("syslog"),
+					AckLatency:        ingestLatency.ack,
+					CompressedBytes:   ingestCompressedBytes,
+					UncompressedBytes: ingestUncompressedBytes,
+				})
+			}, func(error) {
+				syslogListener.Close()
+			})
+			g.Add(func() error {
+				return ingest.HandleSyslogPackets(
+					syslogPacketConn,
+					syslogTopicb,
+					*syslogMaxSize,
+					syslogDropped,
+					monotonic,
+					idClock,
+					filter,
+					ingestLog,
+					log.With(logger, "component", "Writer"),
+					*segmentFlushAge, *segmentFlushSize, segmentSizer,
+					ingestWriterBytes, ingestWriterRecords, ingestWriterSyncs,
+					flushedSegmentAge, flushedSegmentSize,
+				)
+			}, func(error) {
+				syslogPacketConn.Close()
+			})
+		}
 	}
+	breakers := breaker.NewSet(breaker.Policy{
+		Failures: *peerBreakerFailures,
+		Window:   *peerBreakerWindow,
+		Cooldown: *peerBreakerCooldown,
+	}, peerBreakerState)
+	peer.SetBreakers(breakers)
+	dedup := newDeduper(registerer, *dedupWindow)
+	scheduler := store.NewConsumeScheduler(*consumersPerIngester, consumeLag, consumePending, consumeLastCommit)
+	var consumers []*store.Consumer
 	for i := 0; i < *segmentConsumers; i++ {
 		c := store.NewConsumer(
 			peer,
-			timeoutClient,
+			peer.APIAddr(),
+			peerClient,
 			*segmentTargetSize,
 			*segmentTargetAge,
 			*segmentDelay,
 			*segmentReplicationFactor,
+			*replicationChunkSize,
+			*transferTimeout,
+			dedup,
+			breakers,
+			scheduler,
 			consumedSegments,
 			consumedBytes,
 			replicatedSegments.WithLabelValues("egress"),
 			replicatedBytes.WithLabelValues("egress"),
 			store.LogReporter{Logger: log.With(logger, "component", "Consumer")},
 		)
+		consumers = append(consumers, c)
 		g.Add(func() error {
 			c.Run()
 			return nil
@@ -449,65 +1149,256 @@ func runIngestStore(args []string) error {
 			c.Stop()
 		})
 	}
+	compacter := store.NewCompacter(
+		storeLog,
+		compactTargetSize,
+		compactionPlanners,
+		*segmentRetain,
+		*segmentRetainSize,
+		*segmentRetainImported,
+		*segmentPurge,
+		coldTier, *coldAge,
+		*compactConcurrency,
+		*compactRate,
+		compactDuration,
+		compactBytes,
+		compactQueue,
+		trashedSegments,
+		purgedSegments,
+		store.LogReporter{Logger: log.With(logger, "component", "Compacter")},
+	)
 	{
-		c := store.NewCompacter(
-			storeLog,
-			*segmentTargetSize,
-			*segmentRetain,
-			*segmentPurge,
-			compactDuration,
-			trashedSegments,
-			purgedSegments,
-			store.LogReporter{Logger: log.With(logger, "component", "Compacter")},
-		)
 		g.Add(func() error {
-			c.Run()
+			compacter.Run()
 			return nil
 		}, func(error) {
-			c.Stop()
+			compacter.Stop()
 		})
 	}
+	shipper, err := newShipper(registerer, *shipTo, *shipQueueSize, peerClient, storeLog, fsys, *storePath, logger)
+	if err != nil {
+		return err
+	}
+	if shipper != nil {
+		g.Add(func() error {
+			shipper.Run()
+			return nil
+		}, func(error) {
+			shipper.Stop()
+		})
+	}
+	transfers, err := store.NewTransfers(
+		fsys,
+		filepath.Join(*storePath, "transfers"),
+		*transferTimeout,
+		store.LogReporter{Logger: log.With(logger, "component", "Transfers")},
+	)
+	if err != nil {
+		return err
+	}
+	{
+		g.Add(func() error {
+			transfers.Run()
+			return nil
+		}, func(error) {
+			transfers.Stop()
+		})
+	}
+	auditSink, err := newAuditSink(*auditLog, *auditLogMaxSize, *auditLogKeep, logger)
+	if err != nil {
+		return errors.Wrap(err, "opening -store.audit-log")
+	}
+	if closer, ok := auditSink.(io.Closer); ok {
+		defer closer.Close()
+	}
+	api := store.NewAPI(peer, storeLog, store.APIConfig{
+		QueryClient:        peerClient,
+		StreamClient:       peerClient,
+		ReplicatedSegments: replicatedSegments.WithLabelValues("ingress"),
+		ReplicatedBytes:    replicatedBytes.WithLabelValues("ingress"),
+		Duration:           apiDuration,
+		StreamMetrics:      streamMetrics,
+		QueryMetrics:       queryMetrics,
+		Reporter:           store.LogReporter{Logger: log.With(logger, "component", "API")},
+		Audit:              auditSink,
+		Planner:            newQueryPlanner(registerer, *queryPlan, *clusterZone),
+		MaxQueryDuration:   *maxQueryDuration,
+		Limits:             store.QueryLimits{Records: *queryMaxRecords, Bytes: *queryMaxBytes, Segments: *queryMaxSegments},
+		StreamLimits:       store.StreamLimits{Buffered: *streamMaxBuffered, Stall: *streamMaxStall, Evict: *streamEvictAfter},
+		Transfers:          transfers,
+		Queries:            store.NewLimiter(*maxConcurrentQueries, *queryQueueSize, *queryQueueTimeout, queriesInFlight.WithLabelValues("query"), queriesQueued.WithLabelValues("query")),
+		Streams:            store.NewLimiter(*maxConcurrentStreams, 0, 0, queriesInFlight.WithLabelValues("stream"), queriesQueued.WithLabelValues("stream")),
+		Breakers:           breakers,
+		Shipper:            shipper,
+		CrossOriginLive:    *apiLiveCrossOrigin,
+	})
+	diskMonitor := store.NewDiskMonitor(
+		storeLog,
+		fsys, *storePath,
+		defaultStoreDiskCheckInterval,
+		*diskHighWatermark, *diskCriticalWatermark,
+		diskBytes,
+		publishDiskUsage(peer, api, consumers, alertBus, *storePath),
+		store.LogReporter{Logger: log.With(logger, "component", "DiskMonitor")},
+	)
+	{
+		g.Add(func() error {
+			diskMonitor.Run()
+			return nil
+		}, func(error) {
+			diskMonitor.Stop()
+		})
+	}
+	ready := newReadiness()
+	ready.add("ingest.path", writableCheck(fsys, *ingestPath))
+	ready.add("store.path", writableCheck(fsys, *storePath))
+	ready.add("cluster", peersCheck(peer.ClusterSize, *readyMinPeers))
+	for i, c := range consumers {
+		ready.add(fmt.Sprintf("consumer %d", i), stallCheck(c.LastStep, *readyStallThreshold))
+	}
+	{
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			return watchConsumeStalls(consumers, *readyStallThreshold, alertConsumeCheckInterval, alertBus, cancel)
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	drainRequests := make(chan struct{})
 	{
 		g.Add(func() error {
 			mux := http.NewServeMux()
-			mux.Handle("/ingest/", http.StripPrefix("/ingest", ingest.NewAPI(
+			peerAPIs.Handle("/ingest/", http.StripPrefix("/ingest", ingest.NewAPI(
 				peer,
 				ingestLog,
 				*segmentPendingTimeout,
+				*takeoverTimeout,
 				failedSegments,
 				committedSegments,
 				committedBytes,
 				apiDuration,
 			)))
-			api := store.NewAPI(
-				peer,
-				storeLog,
-				timeoutClient,
-				unlimitedClient,
-				replicatedSegments.WithLabelValues("ingress"),
-				replicatedBytes.WithLabelValues("ingress"),
-				apiDuration,
-				store.LogReporter{Logger: log.With(logger, "component", "API")},
-			)
 			defer func() {
 				if err := api.Close(); err != nil {
 					level.Warn(logger).Log("err", err)
 				}
 			}()
-			mux.Handle("/store/", http.StripPrefix("/store", api))
+			repairer := store.NewRepairer(
+				peer,
+				peerClient,
+				*segmentReplicationFactor,
+				*repairRate,
+				store.LogReporter{Logger: log.With(logger, "component", "Repairer")},
+			)
+			defer repairer.Stop()
+			peerAPIs.Handle("/store/", http.StripPrefix("/store", api))
+			mux.Handle("/ingest/", peerAPIs)
+			mux.Handle("/ingest", httpIngester)
+			mux.Handle("/ingest"+ingest.APIPathLag, http.StripPrefix("/ingest", lagMonitor))
+			mux.Handle("/ingest"+ingest.APIPathConnections, http.StripPrefix("/ingest", connections))
+			mux.Handle("/ingest"+ingest.APIPathConnections+"/", http.StripPrefix("/ingest", connections))
+			mux.Handle("/store/", peerAPIs)
+			mux.Handle("/store"+store.APIPathRepair, http.StripPrefix("/store", repairer))
+			mux.Handle("/store"+store.APIPathCompact, http.StripPrefix("/store"+store.APIPathCompact, compacter))
+			mux.Handle("/store"+store.APIPathCompact+"/", http.StripPrefix("/store"+store.APIPathCompact, compacter))
+			mux.Handle("/store"+store.APIPathStatus, http.StripPrefix("/store", diskMonitor))
+			mux.Handle("/store"+store.APIPathLag, http.StripPrefix("/store", scheduler))
+			mux.Handle("/cluster/", http.StripPrefix("/cluster", cluster.NewAPI(peer)))
 			mux.Handle("/ui/", http.StripPrefix("/ui", ui.NewAPI(logger, *uiLocal)))
-			registerMetrics(mux)
+			registerMetrics(mux, gatherer)
 			registerProfile(mux)
 			registerHealthCheck(mux)
-			return http.Serve(apiListener, cors.Default().Handler(mux))
+			registerVersion(mux, flagset)
+			registerReadyCheck(mux, ready)
+			registerDrain(mux, drainRequests)
+			registerTrash(mux, compacter)
+			registerVerify(mux, store.NewVerifier(
+				storeLog,
+				*verifyRate,
+				store.LogReporter{Logger: log.With(logger, "component", "Verifier")},
+			), false)
+			registerConfig(mux, compacter)
+			return http.Serve(apiListener, cors.Default().Handler(requireToken(authToken, *apiAuthExemptHealth, ops.Handler(mux))))
 		}, func(error) {
 			apiListener.Close()
 		})
 	}
+	if debugListener != nil {
+		g.Add(func() error {
+			return http.Serve(debugListener, debugHandler(ops))
+		}, func(error) {
+			debugListener.Close()
+		})
+	}
+	if grpcListener != nil {
+		var (
+			grpcAPI = grpcapi.NewServer(true, api)
+			server  = newGRPCServer(grpcAPI, serverTLS, authToken)
+		)
+		g.Add(func() error {
+			return ingest.HandleConnections(grpcAPI.Listener(), ingest.ConnectionConfig{
+				Handler:           ingest.HandleDurableWriter,
+				ReaderFactory:     rfac,
+				Log:               ingestLog,
+				Logger:            log.With(logger, "component", "Writer"),
+				SegmentFlushAge:   *segmentFlushAge,
+				SegmentFlushSize:  *segmentFlushSize,
+				Sizer:             segmentSizer,
+				CommitLatency:     *durableCommitLatency,
+				CommitBytes:       *durableCommitBytes,
+				DrainTimeout:      *drainTimeout,
+				Limiter:           limiter,
+				Quotas:            quotas,
+				Timestamps:        timestamps,
+				Clock:             clockGuard,
+				IDClock:           idClock,
+				IDs:               monotonic,
+				Filter:            filter,
+				Connections:       connections,
+				ConnectedClients:  connectedClients.WithLabelValues("grpc"),
+				Bytes:             ingestWriterBytes,
+				Records:           ingestWriterRecords,
+				Syncs:             ingestWriterSyncs,
+				SegmentAge:        flushedSegmentAge,
+				SegmentSize:       flushedSegmentSize,
+				WriteLatency:      ingestLatency.write.WithLabelValues("grpc"),
+				AckLatency:        ingestLatency.ack,
+				CompressedBytes:   ingestCompressedBytes,
+				UncompressedBytes: ingestUncompressedBytes,
+			})
+		}, func(error) {
+			grpcAPI.Listener().Close()
+		})
+		g.Add(func() error {
+			return server.Serve(grpcListener)
+		}, func(error) {
+			server.Stop()
+		})
+	}
+	{
+		// SIGTERM drains the node before exiting; SIGINT exits immediately.
+		sigterm := make(chan os.Signal, 1)
+		signal.Notify(sigterm, syscall.SIGTERM)
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			select {
+			case sig := <-sigterm:
+				level.Info(logger).Log("received", sig)
+			case <-drainRequests:
+				level.Info(logger).Log("received", "drain request")
+			case <-cancel:
+				return errors.New("canceled")
+			}
+			return drainStore(api, peer, consumers, *drainGracePeriod, log.With(logger, "component", "Drain"))
+		}, func(error) {
+			signal.Stop(sigterm)
+			close(cancel)
+		})
+	}
 	{
 		cancel := make(chan struct{})
 		g.Add(func() error {
-			return interrupt(cancel)
+			return interruptOn(cancel, syscall.SIGINT)
 		}, func(error) {
 			close(cancel)
 		})
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/ingest"
+)
+
+// defaultIngestLagCheckInterval is how often ingest nodes check how far behind
+// the consumers of their segments are.
+const defaultIngestLagCheckInterval = 5 * time.Second
+
+// defaultIngestConnectionsWindow is the window over which ingest nodes rate
+// each connection, on the connections endpoint.
+const defaultIngestConnectionsWindow = 10 * time.Second
+
+// newIngestLagMonitor returns the lag monitor of the ingest log, with its
+// gauges registered with r.
+func newIngestLagMonitor(r prometheus.Registerer, ingestLog ingest.Log, logger log.Logger) *ingest.LagMonitor {
+	var (
+		segments = prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "oklog",
+			Name:      "ingest_unconsumed_segments",
+			Help:      "Segments flushed, or pending with a store node, but not yet committed.",
+		})
+		bytes = prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "oklog",
+			Name:      "ingest_unconsumed_bytes",
+			Help:      "Bytes of the segments flushed, or pending with a store node, but not yet committed.",
+		})
+		lag = prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "oklog",
+			Name:      "ingest_consume_lag_seconds",
+			Help:      "Age of the oldest record in a segment not yet committed, by its ID, or zero, if there are none.",
+		})
+	)
+	r.MustRegister(segments, bytes, lag)
+	return ingest.NewLagMonitor(ingestLog, defaultIngestLagCheckInterval, segments, bytes, lag, logger)
+}
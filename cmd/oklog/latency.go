@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// latencyBuckets are the histogram buckets, in seconds, of the latencies of
+// ingesting and querying logs: from the submillisecond write of a record to
+// the active segment, to a query over many segments that takes most of the
+// default maximum query duration.
+var latencyBuckets = []float64{
+	.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05,
+	.1, .25, .5, 1, 2.5, 5, 10, 30,
+}
+
+// ingestLatencyMetrics are the latency histograms of ingest connections.
+type ingestLatencyMetrics struct {
+	write *prometheus.HistogramVec
+	ack   prometheus.Histogram
+}
+
+func newIngestLatencyMetrics(buckets []float64) ingestLatencyMetrics {
+	return ingestLatencyMetrics{
+		write: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "oklog",
+			Name:      "ingest_record_write_duration_seconds",
+			Help:      "Time to write each record to the active segment, including any sync, by write mode.",
+			Buckets:   buckets,
+		}, []string{"mode"}),
+		ack: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "oklog",
+			Name:      "ingest_ack_duration_seconds",
+			Help:      "Time from reading the first record an acknowledgement covers to writing it, for clients that ask for acks.",
+			Buckets:   buckets,
+		}),
+	}
+}
+
+func (m ingestLatencyMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.write, m.ack}
+}
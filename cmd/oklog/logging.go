@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultLogFormat = "logfmt"
+	defaultLogLevel  = "info"
+)
+
+// newLogger returns the logger of the -log.format and -log.level flags,
+// writing to w. Each event is timestamped, and has a level key; those below
+// the level are dropped. The -debug flag is kept as a shorthand for
+// -log.level=debug.
+func newLogger(w io.Writer, format, lvl string, debug bool) (log.Logger, error) {
+	var logger log.Logger
+	switch format {
+	case "logfmt":
+		logger = log.NewLogfmtLogger(log.NewSyncWriter(w))
+	case "json":
+		logger = log.NewJSONLogger(log.NewSyncWriter(w))
+	default:
+		return nil, errors.Errorf("invalid -log.format %q: want logfmt or json", format)
+	}
+	if debug {
+		lvl = "debug"
+	}
+	var allow level.Option
+	switch lvl {
+	case "debug":
+		allow = level.AllowDebug()
+	case "info":
+		allow = level.AllowInfo()
+	case "warn":
+		allow = level.AllowWarn()
+	case "error":
+		allow = level.AllowError()
+	default:
+		return nil, errors.Errorf("invalid -log.level %q: want debug, info, warn, or error", lvl)
+	}
+	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
+	return level.NewFilter(logger, allow), nil
+}
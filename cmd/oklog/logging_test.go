@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+func TestNewLogger(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		format, lvl string
+		debug       bool
+		want        []string // substrings of the lines, in order
+	}{
+		{"logfmt", "info", false, []string{"level=info msg=b", "level=error msg=c"}},
+		{"logfmt", "info", true, []string{"level=debug msg=a", "level=info msg=b", "level=error msg=c"}},
+		{"logfmt", "error", false, []string{"level=error msg=c"}},
+		{"json", "debug", false, []string{`"level":"debug","msg":"a"`, `"level":"info","msg":"b"`, `"level":"error","msg":"c"`}},
+	} {
+		var buf bytes.Buffer
+		logger, err := newLogger(&buf, testcase.format, testcase.lvl, testcase.debug)
+		if err != nil {
+			t.Errorf("%s %s: %v", testcase.format, testcase.lvl, err)
+			continue
+		}
+		level.Debug(logger).Log("msg", "a")
+		level.Info(logger).Log("msg", "b")
+		level.Error(logger).Log("msg", "c")
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if want, have := len(testcase.want), len(lines); want != have {
+			t.Errorf("%s %s: want %d lines, have %d: %q", testcase.format, testcase.lvl, want, have, lines)
+			continue
+		}
+		for i, want := range testcase.want {
+			if have := lines[i]; !strings.Contains(have, want) || !strings.Contains(have, "ts") {
+				t.Errorf("%s %s: want %s, with a ts, have %s", testcase.format, testcase.lvl, want, have)
+			}
+		}
+	}
+}
+
+func TestNewLoggerInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct{ format, lvl string }{
+		{"text", "info"},
+		{"logfmt", "verbose"},
+	} {
+		if _, err := newLogger(&bytes.Buffer{}, testcase.format, testcase.lvl, false); err == nil {
+			t.Errorf("%s %s: want error, have none", testcase.format, testcase.lvl)
+		}
+	}
+}
@@ -16,10 +16,12 @@ import (
 	"text/tabwriter"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-)
 
-var version = "dev" // set by release script
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/version"
+)
 
 func usage() {
 	fmt.Fprintf(os.Stderr, "USAGE\n")
@@ -30,12 +32,22 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  ingest       Ingester node\n")
 	fmt.Fprintf(os.Stderr, "  store        Storage node\n")
 	fmt.Fprintf(os.Stderr, "  ingeststore  Combination ingest+store node, for small installations\n")
+	fmt.Fprintf(os.Stderr, "  dev          Single-node ingeststore, with defaults for a local dev environment\n")
 	fmt.Fprintf(os.Stderr, "  query        Querying commandline tool\n")
 	fmt.Fprintf(os.Stderr, "  stream       Streaming commandline tool\n")
+	fmt.Fprintf(os.Stderr, "  replay       Replay the traces of oklog stream -trace-dir, for debugging deduplication\n")
+	fmt.Fprintf(os.Stderr, "  status       Cluster and store status commandline tool\n")
+	fmt.Fprintf(os.Stderr, "  check        Cluster-wide configuration sanity check, for CI and pre-deploy gates\n")
+	fmt.Fprintf(os.Stderr, "  canary       End-to-end check of a cluster, writing sentinel records, and querying for them\n")
+	fmt.Fprintf(os.Stderr, "  export       Segment export commandline tool, for archival\n")
+	fmt.Fprintf(os.Stderr, "  merge        Merge and deduplicate exported segments, offline\n")
+	fmt.Fprintf(os.Stderr, "  verify       Audit a store node's segments, and quarantine damaged ones\n")
 	fmt.Fprintf(os.Stderr, "  testsvc      Test service, emits log lines at a fixed rate\n")
+	fmt.Fprintf(os.Stderr, "  bench        Load generator, for sizing ingest and store nodes\n")
+	fmt.Fprintf(os.Stderr, "  ulid         ULID commandline tool\n")
 	fmt.Fprintf(os.Stderr, "\n")
 	fmt.Fprintf(os.Stderr, "VERSION\n")
-	fmt.Fprintf(os.Stderr, "  %s (%s)\n", version, runtime.Version())
+	fmt.Fprintf(os.Stderr, "  %s (%s)\n", version.Version, runtime.Version())
 	fmt.Fprintf(os.Stderr, "\n")
 }
 
@@ -54,13 +66,35 @@ func main() {
 	case "store":
 		run = runStore
 	case "ingeststore":
-		run = runIngestStore
+		run = func(args []string) error {
+			return runIngestStore(args, prometheus.DefaultRegisterer, prometheus.DefaultGatherer)
+		}
+	case "dev":
+		run = runDev
 	case "query":
 		run = runQuery
 	case "stream":
 		run = runStream
+	case "replay":
+		run = runReplay
+	case "status":
+		run = runStatus
+	case "check":
+		run = runCheck
+	case "canary":
+		run = runCanary
+	case "export":
+		run = runExport
+	case "merge":
+		run = runMerge
+	case "verify":
+		run = runVerify
 	case "testsvc":
 		run = runTestService
+	case "bench":
+		run = runBench
+	case "ulid":
+		run = runULID
 	default:
 		usage()
 		os.Exit(1)
@@ -68,16 +102,35 @@ func main() {
 
 	if err := run(os.Args[2:]); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
+// exitError is an error that a mode exits with a particular status for.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string { return e.err.Error() }
+
+// exitCode returns the status to exit with, after err: 1, unless it's an
+// exitError.
+func exitCode(err error) int {
+	if e, ok := errors.Cause(err).(exitError); ok {
+		return e.code
+	}
+	return 1
+}
+
 const (
 	defaultAPIPort     = 7650
 	defaultClusterPort = 7659
 	defaultFilesystem  = "real"
 )
 
+const defaultFilesystemSyncBytes = 8 * 1024 * 1024
+
 var (
 	defaultAPIAddr     = fmt.Sprintf("tcp://0.0.0.0:%d", defaultAPIPort)
 	defaultClusterAddr = fmt.Sprintf("tcp://0.0.0.0:%d", defaultClusterPort)
@@ -98,8 +151,12 @@ func (ss *stringslice) String() string {
 }
 
 func interrupt(cancel <-chan struct{}) error {
+	return interruptOn(cancel, syscall.SIGINT, syscall.SIGTERM)
+}
+
+func interruptOn(cancel <-chan struct{}, sigs ...os.Signal) error {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(c, sigs...)
 	select {
 	case sig := <-c:
 		return fmt.Errorf("received signal %s", sig)
@@ -143,14 +200,22 @@ func parseAddr(addr string, defaultPort int) (network, address, host string, por
 }
 
 func registerHealthCheck(mux *http.ServeMux) {
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	health := func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintln(w, "OK")
-	})
+	}
+	mux.HandleFunc("/health", health)
+	mux.HandleFunc("/healthz", health)
+}
+
+// registerVersion serves the version of this build at /version, along with
+// the node type, i.e. the mode, and the flags it was started with, redacted.
+func registerVersion(mux *http.ServeMux, flagset *flag.FlagSet) {
+	mux.Handle("/version", version.Handler(version.Get(flagset.Name(), flagset)))
 }
 
-func registerMetrics(mux *http.ServeMux) {
-	mux.Handle("/metrics", promhttp.Handler())
+func registerMetrics(mux *http.ServeMux, g prometheus.Gatherer) {
+	mux.Handle("/metrics", promhttp.HandlerFor(g, promhttp.HandlerOpts{}))
 }
 
 func registerProfile(mux *http.ServeMux) {
@@ -180,6 +245,23 @@ func usageFor(fs *flag.FlagSet, short string) func() {
 	}
 }
 
+// parseClusterLabels parses key=value -cluster.label flags, and checks they
+// fit in the gossip metadata.
+func parseClusterLabels(ss stringslice) (cluster.Labels, error) {
+	labels := cluster.Labels{}
+	for _, s := range ss {
+		key, value, err := cluster.ParseLabel(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "-cluster.label")
+		}
+		labels[key] = value
+	}
+	if err := labels.Validate(); err != nil {
+		return nil, errors.Wrap(err, "-cluster.label")
+	}
+	return labels, nil
+}
+
 func hasNonlocal(clusterPeers stringslice) bool {
 	for _, peer := range clusterPeers {
 		if host, _, err := net.SplitHostPort(peer); err == nil {
@@ -194,6 +276,17 @@ func hasNonlocal(clusterPeers stringslice) bool {
 	return false
 }
 
+// listensOn reports whether a listener bound to bindHost accepts connections
+// to host, which peers are told to connect to. Bound to a hostname, rather
+// than an IP, it may, so that's assumed.
+func listensOn(bindHost, host string) bool {
+	bindIP := net.ParseIP(bindHost)
+	if bindIP == nil || bindIP.IsUnspecified() {
+		return true
+	}
+	return bindIP.Equal(net.ParseIP(host))
+}
+
 func isUnroutable(addr string) bool {
 	if host, _, err := net.SplitHostPort(addr); err == nil {
 		addr = host
@@ -158,3 +158,25 @@ func TestIsUnroutable(t *testing.T) {
 		})
 	}
 }
+
+func TestListensOn(t *testing.T) {
+	for _, testcase := range []struct {
+		bindHost string
+		host     string
+		want     bool
+	}{
+		{"", "10.0.0.1", true},
+		{"0.0.0.0", "10.0.0.1", true},
+		{"::", "10.0.0.1", true},
+		{"10.0.0.1", "10.0.0.1", true},
+		{"10.0.0.2", "10.0.0.1", false},
+		{"127.0.0.1", "10.0.0.1", false},
+		{"myhost", "10.0.0.1", true},
+	} {
+		t.Run(testcase.bindHost+"/"+testcase.host, func(t *testing.T) {
+			if want, have := testcase.want, listensOn(testcase.bindHost, testcase.host); want != have {
+				t.Errorf("want %v, have %v", want, have)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/mergelog"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+func runMerge(args []string) error {
+	flagset := flag.NewFlagSet("merge", flag.ExitOnError)
+	var (
+		output         = flagset.String("o", "", "file to write the merge to, once it's complete (default stdout)")
+		keepDuplicates = flagset.Bool("keep-duplicates", false, "keep every record with the same ULID, not just the first")
+		strict         = flagset.Bool("strict", false, "fail on malformed lines, and records out of ULID order, rather than skipping them")
+		maxRecordSize  = flagset.Int("max-record-size", mergelog.DefaultMaxRecordSize, "biggest record that may be merged; bigger ones fail the merge")
+		verbose        = flagset.Bool("v", false, "verbose output to stderr")
+	)
+	flagset.Usage = usageFor(flagset, "oklog merge [flags] <file> ...")
+	files, err := parseInterspersed(flagset, args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		flagset.Usage()
+		return errors.New("no files to merge")
+	}
+	opts := mergelog.Options{
+		KeepDuplicates: *keepDuplicates,
+		Strict:         *strict,
+		MaxRecordSize:  *maxRecordSize,
+	}
+	var summary io.Writer = ioutil.Discard
+	if *verbose {
+		summary = os.Stderr
+	}
+	return mergeCommand(os.Stdout, summary, files, *output, opts)
+}
+
+// parseInterspersed parses the flags of args, which may come before, after,
+// or among the other arguments, as in oklog merge a b -o c, and returns the
+// other arguments.
+func parseInterspersed(flagset *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := flagset.Parse(args); err != nil {
+			return nil, err
+		}
+		parsed := args[:len(args)-flagset.NArg()]
+		if args = flagset.Args(); len(args) == 0 {
+			return rest, nil
+		}
+		if len(parsed) > 0 && parsed[len(parsed)-1] == "--" {
+			return append(rest, args...), nil // the rest aren't flags
+		}
+		rest, args = append(rest, args[0]), args[1:]
+	}
+}
+
+// mergeCommand merges the segment files to stdout, or to the output file, if
+// it's given, and writes a summary of the merge to summary.
+func mergeCommand(stdout, summary io.Writer, files []string, output string, opts mergelog.Options) error {
+	for _, file := range files {
+		if output != "" && filepath.Clean(file) == filepath.Clean(output) {
+			return errors.Errorf("-o %s is one of the files being merged", output)
+		}
+	}
+
+	var readers []io.Reader
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r, err := store.DecompressSegment(f) // as exported segments may be compressed
+		if err != nil {
+			return errors.Wrap(err, file)
+		}
+		defer r.Close()
+		readers = append(readers, r)
+	}
+
+	// The merge is written beside -o, and renamed into place once it's
+	// complete, so a failed merge doesn't leave half of one behind.
+	w, commit := stdout, func() error { return nil }
+	if output != "" {
+		f, err := ioutil.TempFile(filepath.Dir(output), "."+filepath.Base(output)+".")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name()) // unless it's renamed
+		defer f.Close()
+		w, commit = f, func() error {
+			if err := f.Close(); err != nil {
+				return err
+			}
+			return os.Rename(f.Name(), output)
+		}
+	}
+
+	m := mergelog.NewMerger(opts, readers...)
+	bw := bufio.NewWriter(w)
+	var n int64
+	for m.Next() {
+		if _, err := bw.Write(m.Record()); err != nil {
+			return errors.Wrap(err, "writing merge")
+		}
+		n++
+	}
+	if err := m.Err(); err != nil {
+		return errors.Wrap(err, "merging")
+	}
+	if err := bw.Flush(); err != nil {
+		return errors.Wrap(err, "writing merge")
+	}
+	if err := commit(); err != nil {
+		return errors.Wrap(err, "writing merge")
+	}
+	fmt.Fprintf(summary, "%d record(s) merged from %d file(s), %d duplicate(s) and %d malformed line(s) skipped\n", n, len(files), m.Duplicates(), m.Malformed())
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/mergelog"
+)
+
+func TestMergeCommand(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "oklog-merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	record := func(ms uint64, s string) string { return ulid.MustNew(ms, nil).String() + " " + s + "\n" }
+	a, b, c := record(1, "a"), record(2, "b"), record(3, "c")
+
+	// One segment as stored, and one compressed, which repeats a record.
+	plain := filepath.Join(dir, "plain.segment")
+	if err := ioutil.WriteFile(plain, []byte(a+c), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write([]byte(b + c))
+	zw.Close()
+	compressed := filepath.Join(dir, "compressed.segment")
+	if err := ioutil.WriteFile(compressed, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, summary bytes.Buffer
+	if err := mergeCommand(&stdout, &summary, []string{plain, compressed}, "", mergelog.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := a+b+c, stdout.String(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := "3 record(s) merged from 2 file(s), 1 duplicate(s) and 0 malformed line(s) skipped\n", summary.String(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	// To a file, which isn't written if the merge fails.
+	output := filepath.Join(dir, "merged.segment")
+	if err := mergeCommand(&stdout, ioutil.Discard, []string{plain, compressed}, output, mergelog.Options{KeepDuplicates: true}); err != nil {
+		t.Fatal(err)
+	}
+	if have, err := ioutil.ReadFile(output); err != nil || string(have) != a+b+c+c {
+		t.Errorf("want %q, have %q (%v)", a+b+c+c, have, err)
+	}
+	if err := ioutil.WriteFile(plain, []byte(a+"junk\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := mergeCommand(&stdout, ioutil.Discard, []string{plain, compressed}, output, mergelog.Options{Strict: true}); err == nil {
+		t.Error("want error merging a malformed segment strictly, have none")
+	}
+	if have, err := ioutil.ReadFile(output); err != nil || string(have) != a+b+c+c {
+		t.Errorf("failed merge: want %q kept, have %q (%v)", a+b+c+c, have, err)
+	}
+	if err := mergeCommand(&stdout, ioutil.Discard, []string{plain, output}, output, mergelog.Options{}); err == nil {
+		t.Error("want error merging to one of the inputs, have none")
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, ".merged*")); len(files) > 0 {
+		t.Errorf("want no temporary files left, have %v", files)
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		args   []string
+		files  []string
+		output string
+	}{
+		{[]string{"a", "b"}, []string{"a", "b"}, ""},
+		{[]string{"-o", "c", "a", "b"}, []string{"a", "b"}, "c"},
+		{[]string{"a", "b", "-o", "c"}, []string{"a", "b"}, "c"},
+		{[]string{"a", "-o", "c", "b"}, []string{"a", "b"}, "c"},
+		{[]string{"a", "--", "-o"}, []string{"a", "-o"}, ""},
+	} {
+		flagset := flag.NewFlagSet("merge", flag.ContinueOnError)
+		output := flagset.String("o", "", "")
+		files, err := parseInterspersed(flagset, testcase.args)
+		if err != nil {
+			t.Errorf("%v: %v", testcase.args, err)
+			continue
+		}
+		if want, have := testcase.files, files; !reflect.DeepEqual(want, have) {
+			t.Errorf("%v: want files %v, have %v", testcase.args, want, have)
+		}
+		if want, have := testcase.output, *output; want != have {
+			t.Errorf("%v: want -o %q, have %q", testcase.args, want, have)
+		}
+	}
+}
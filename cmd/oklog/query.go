@@ -1,36 +1,106 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/oklog/oklog/pkg/record"
 	"github.com/oklog/oklog/pkg/store"
+	"github.com/oklog/oklog/pkg/stream"
+	"github.com/oklog/oklog/pkg/ulidutil"
 	"github.com/oklog/ulid"
 )
 
 func runQuery(args []string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		stop        = make(chan struct{})
+		interrupted = make(chan error, 1)
+	)
+	defer close(stop)
+	go func() {
+		interrupted <- interrupt(stop)
+		cancel()
+	}()
+
+	// A reader of stdout that goes away, like head, fails our writes to it,
+	// rather than killing us, so we stop querying, and exit quietly.
+	signal.Ignore(syscall.SIGPIPE)
+	if err := query(ctx, os.Stdout, os.Stderr, args); err != nil {
+		if ctx.Err() != nil {
+			return <-interrupted
+		}
+		if isBrokenPipe(err) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// query runs the query command, writing records to stdout, and everything
+// else, like warnings and statistics, to stderr, until it's done, the context
+// is canceled, or stdout fails.
+func query(ctx context.Context, stdout, stderr io.Writer, args []string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	out := &cancelingWriter{w: stdout, cancel: cancel}
+
 	flagset := flag.NewFlagSet("query", flag.ExitOnError)
+	flagset.SetOutput(stderr)
 	var (
 		storeAddr = flagset.String("store", "localhost:7650", "address of store instance to query")
-		from      = flagset.String("from", "1h", "from, as RFC3339 timestamp or duration ago")
-		to        = flagset.String("to", "now", "to, as RFC3339 timestamp or duration ago")
+		from      = flagset.String("from", "1h", "from, as RFC3339 timestamp, unix epoch seconds or milliseconds, ULID, or duration ago")
+		to        = flagset.String("to", "now", "to, as RFC3339 timestamp, unix epoch seconds or milliseconds, ULID, or duration ago")
 		q         = flagset.String("q", "", "query expression")
 		regex     = flagset.Bool("regex", false, "parse -q as regular expression")
+		extract   = flagset.Bool("extract", false, "print only what the capture groups of -q matched, tab-separated (implies -regex)")
+		topic     = flagset.String("topic", "", "only query records of this topic (default all topics)")
+		limit     = flagset.Int("limit", 0, "return at most this many records per page (0 for unlimited)")
+		follow    = flagset.Bool("follow-pages", false, "with -limit, fetch all pages one after the other")
+		cont      = flagset.String("continue", "", "continuation token of the next page, from a previous limited query")
+		tail      = flagset.Bool("follow", false, "then stream new records as they arrive, without gaps or duplicates")
+		window    = flagset.Duration("window", stream.DefaultDedupeWindow, "with -follow, the stream's deduplication window")
+		reverse   = flagset.Bool("reverse", false, "return the newest records first")
+		sample    = flagset.Float64("sample", 0, "return about this fraction of records, e.g. 0.01 (default all)")
 		stats     = flagset.Bool("stats", false, "statistics only, no records (implies -v)")
+		fresh     = flagset.Bool("wait-for-fresh", false, "wait, for up to 10s, until the stores have every record up to -to, e.g. just ingested")
 		nocopy    = flagset.Bool("nocopy", false, "don't read the response body")
 		withulid  = flagset.Bool("ulid", false, "include ULID prefix with each record")
+		noulid    = flagset.Bool("no-ulid", false, "strip the ULID prefix of each record (the default)")
 		withtime  = flagset.Bool("time", false, "include time prefix with each record")
+		ulidtime  = flagset.Bool("ulid-time", false, "replace the ULID prefix of each record with its time, as an RFC3339 UTC timestamp to the millisecond")
+		null      = flagset.Bool("null", false, "end each record with a NUL byte, rather than a newline, as records may hold newlines")
+		output    = flagset.String("output", "text", "text, or json for one JSON object per record (or for -stats)")
 		verbose   = flagset.Bool("v", false, "verbose output to stderr")
+		useTLS    = flagset.Bool("tls", false, "connect to the store with TLS")
+		tlsCA     = flagset.String("tls.ca", "", "CA certificates to verify the store with (default system)")
+		tlsCert   = flagset.String("tls.cert", "", "client certificate to present, for mutual TLS")
+		tlsKey    = flagset.String("tls.key", "", "client certificate's private key")
+		authFile  = flagset.String("auth-token-file", "", "file holding the store's auth token, if it requires one")
+		labels    = stringslice{}
+		clusters  = stringslice{}
+		byCluster = flagset.Bool("cluster-label", false, "with -cluster, label each record with its cluster's name, after its prefix")
+		origin    = flagset.Bool("show-origin", false, "annotate each record with the store node, and segment, it was read from, after its prefix")
 	)
+	flagset.Var(&labels, "label", "only query segments from ingest nodes with this key:value label (repeatable)")
+	flagset.Var(&clusters, "cluster", "name=host:port of a store instance of another cluster to query, and merge, instead of -store (repeatable)")
+	flagset.BoolVar(tail, "f", false, "short for -follow")
 	flagset.Usage = usageFor(flagset, "oklog query [flags]")
 	if err := flagset.Parse(args); err != nil {
 		return err
@@ -41,7 +111,7 @@ func runQuery(args []string) error {
 	verbosePrintf := func(string, ...interface{}) {}
 	if *verbose || *stats {
 		verbosePrintf = func(format string, args ...interface{}) {
-			fmt.Fprintf(os.Stderr, format, args...)
+			fmt.Fprintf(stderr, format, args...)
 		}
 	}
 
@@ -49,117 +119,353 @@ func runQuery(args []string) error {
 	if err != nil {
 		return errors.Wrap(err, "couldn't parse -store")
 	}
+	tlsConfig, err := toolTLSConfig(*useTLS, *tlsCA, *tlsCert, *tlsKey)
+	if err != nil {
+		return err
+	}
+	authToken, err := readAuthToken(*authFile)
+	if err != nil {
+		return err
+	}
+	client, scheme := toolClient(tlsConfig, authToken)
 
-	fromDuration, durationErr := time.ParseDuration(*from)
-	fromTime, timeErr := time.Parse(time.RFC3339Nano, *from)
-	fromNow := strings.ToLower(*from) == "now"
-	var fromStr string
-	switch {
-	case fromNow:
-		fromStr = time.Now().Format(time.RFC3339)
-	case durationErr == nil && timeErr != nil:
-		fromStr = time.Now().Add(neg(fromDuration)).Format(time.RFC3339)
-	case durationErr != nil && timeErr == nil:
-		fromStr = fromTime.Format(time.RFC3339)
-	default:
-		return fmt.Errorf("couldn't parse -from (%q) as either duration or time", *from)
+	now := time.Now()
+	fromStr, err := parseQueryTime(*from, now)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse -from")
+	}
+	toStr, err := parseQueryTime(*to, now)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse -to")
 	}
 
-	toDuration, durationErr := time.ParseDuration(*to)
-	toTime, timeErr := time.Parse(time.RFC3339, *to)
-	toNow := strings.ToLower(*to) == "now"
-	var toStr string
-	switch {
-	case toNow:
-		toStr = time.Now().Format(time.RFC3339)
-	case durationErr == nil && timeErr != nil:
-		toStr = time.Now().Add(neg(toDuration)).Format(time.RFC3339)
-	case durationErr != nil && timeErr == nil:
-		toStr = toTime.Format(time.RFC3339)
+	var asJSON bool
+	switch *output {
+	case "text":
+	case "json":
+		asJSON = true
 	default:
-		return fmt.Errorf("couldn't parse -to (%q) as either duration or time", *to)
+		return errors.Errorf("couldn't parse -output (%q): must be text or json", *output)
 	}
 
+	// Statistics come as headers, or as a JSON body, which HEAD can't have.
 	method := "GET"
-	if *stats {
+	var asFormat string
+	switch {
+	case asJSON && *stats:
+		asFormat = "&format=json&stats=true"
+	case asJSON:
+		asFormat = "&format=json"
+	case *stats:
 		method = "HEAD"
 	}
 
 	var asRegex string
-	if *regex {
+	if *regex || *extract {
 		asRegex = "&regex=true"
 	}
+	if *extract {
+		asRegex += "&extract=true"
+	}
+
+	var asOrigin string
+	if *origin {
+		asOrigin = "&annotate=origin"
+	}
+
+	var asTopic string
+	if *topic != "" {
+		if !record.IsValidTopic([]byte(*topic)) {
+			return errors.Wrap(record.ErrIllegalTopicName, "couldn't parse -topic")
+		}
+		asTopic = "&topic=" + url.QueryEscape(*topic)
+	}
+
+	var asLabels string
+	for _, label := range labels {
+		asLabels += "&label=" + url.QueryEscape(label)
+	}
+
+	var asDirection string
+	if *reverse {
+		asDirection = "&direction=backward"
+	}
+
+	var asSample string
+	if *sample < 0 || *sample > 1 {
+		return errors.New("couldn't parse -sample: must be between 0 and 1")
+	}
+	if *sample > 0 {
+		asSample = "&sample=" + strconv.FormatFloat(*sample, 'g', -1, 64)
+	}
+
+	var asFresh string
+	if *fresh {
+		asFresh = "&wait_for_fresh=true"
+	}
+
+	var asLimit string
+	if *limit < 0 {
+		return errors.New("couldn't parse -limit: must not be negative")
+	}
+	if *limit > 0 {
+		asLimit = fmt.Sprintf("&limit=%d", *limit)
+	}
+
+	// Following picks up the stream after the last record of the query,
+	// which must be the newest, so every page is fetched, in order.
+	var since ulid.ULID
+	if *tail {
+		switch {
+		case *stats, *nocopy, asJSON, *reverse, *extract, len(labels) > 0:
+			return errors.New("-follow can't be combined with -stats, -nocopy, -output json, -reverse, -extract, or -label")
+		}
+		if *window <= 0 {
+			return errors.Wrap(stream.ErrInvalidWindow, "couldn't parse -window")
+		}
+		*follow = true
+		if since, err = queryULID(toStr); err != nil {
+			return errors.Wrap(err, "couldn't parse -to")
+		}
+	}
+
+	var prefixes int
+	for _, set := range []bool{*withulid, *noulid, *withtime, *ulidtime} {
+		if set {
+			prefixes++
+		}
+	}
+	if prefixes > 1 {
+		return errors.New("only one of -ulid, -no-ulid, -time, and -ulid-time may be given")
+	}
+	if *null && asJSON {
+		return errors.New("-null can't be combined with -output json")
+	}
+	f := recordFormat{prefix: noPrefix, delim: '\n'}
+	switch {
+	case *withulid:
+		f.prefix = ulidPrefix
+	case *withtime:
+		f.prefix = localTimePrefix
+	case *ulidtime:
+		f.prefix = ulidTimePrefix
+	}
+	if *null {
+		f.delim = 0
+	}
+
+	// Pages, and continuations, are per cluster, so federated queries are
+	// fetched at once, whole.
+	if len(clusters) > 0 {
+		switch {
+		case *limit > 0, *follow, *cont != "", *tail, *stats, *nocopy, asJSON:
+			return errors.New("-cluster can't be combined with -limit, -follow-pages, -continue, -follow, -stats, -nocopy, or -output json")
+		}
+		params, err := url.ParseQuery(fmt.Sprintf(
+			"from=%s&to=%s&q=%s%s%s%s%s%s%s%s",
+			url.QueryEscape(fromStr),
+			url.QueryEscape(toStr),
+			url.QueryEscape(*q),
+			asRegex,
+			asOrigin,
+			asTopic,
+			asLabels,
+			asDirection,
+			asSample,
+			asFresh,
+		))
+		if err != nil {
+			return err
+		}
+		return queryClusters(ctx, out, stderr, clusters, client, scheme, params, *byCluster, f, verbosePrintf)
+	}
+
+	token := *cont
+	for {
+		var asContinue string
+		if token != "" {
+			asContinue = "&continue=" + url.QueryEscape(token)
+		}
+
+		req, err := http.NewRequest(method, fmt.Sprintf(
+			"%s://%s/store%s?from=%s&to=%s&q=%s%s%s%s%s%s%s%s%s%s%s",
+			scheme,
+			hostport,
+			store.APIPathUserQuery,
+			url.QueryEscape(fromStr),
+			url.QueryEscape(toStr),
+			url.QueryEscape(*q),
+			asRegex,
+			asOrigin,
+			asTopic,
+			asLabels,
+			asDirection,
+			asSample,
+			asFresh,
+			asLimit,
+			asContinue,
+			asFormat,
+		), nil)
+		if err != nil {
+			return err
+		}
+		verbosePrintf("GET %s\n", req.URL.String())
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			req.URL.RawQuery = "" // for pretty print
+			if resp.StatusCode == http.StatusBadRequest {
+				buf, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+				resp.Body.Close()
+				return errors.Errorf("%s %s: %s: %s", req.Method, req.URL.String(), resp.Status, strings.TrimSpace(string(buf)))
+			}
+			return errors.Errorf("%s %s: %s", req.Method, req.URL.String(), resp.Status)
+		}
+
+		var result store.QueryResult
+		if err := result.DecodeFrom(resp); err != nil {
+			return errors.Wrap(err, "decoding query result")
+		}
+
+		qtype := "normal string"
+		if result.Params.Regex {
+			qtype = "regular expression"
+		}
+
+		verbosePrintf("Response in %s\n", time.Since(begin))
+		verbosePrintf("Queried from %s\n", result.Params.From)
+		verbosePrintf("Queried to %s\n", result.Params.To)
+		verbosePrintf("Queried %s %q\n", qtype, result.Params.Q)
+		verbosePrintf("%d node(s) queried\n", result.NodesQueried)
+		verbosePrintf("%d segment(s) queried\n", result.SegmentsQueried)
+		verbosePrintf("%dB (%dMiB) maximum data set size\n", result.MaxDataSetSize, result.MaxDataSetSize/(1024*1024))
+		verbosePrintf("%d error(s)\n", result.ErrorCount)
+		verbosePrintf("%s server-reported duration\n", result.Duration)
+		if result.Watermark != nil {
+			verbosePrintf("replicated up to %s\n", result.Watermark.Format(time.RFC3339Nano))
+		}
+		if *fresh && !result.Fresh() {
+			fmt.Fprintf(stderr, "WARNING: the stores may not have every record up to -to yet; records after the watermark may be missing\n")
+		}
+
+		var copyErr error
+		switch {
+		case *nocopy:
+			break
+		case asJSON:
+			_, copyErr = io.Copy(out, result.Records)
+		case *tail:
+			tracked := track(result.Records, &since)
+			_, copyErr = f.copy(out, tracked)
+			tracked.Close()
+		default:
+			_, copyErr = f.copy(out, result.Records)
+		}
+		result.Records.Close()
+		if out.err != nil {
+			return errors.Wrap(out.err, "writing records")
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if copyErr != nil {
+			return errors.Wrap(copyErr, "reading records") // e.g. partial results
+		}
+		if result.Truncated != "" {
+			fmt.Fprintf(stderr, "WARNING: results truncated at the store's %s limit (see -store.query-max-%s)\n", result.Truncated, result.Truncated)
+		}
+
+		// Stats are complete once the records are read.
+		if s := result.Stats; s != nil {
+			verbosePrintf("%d segment(s) considered, %d pruned by time range, %d by bloom filter\n", s.SegmentsConsidered, s.SegmentsPruned, s.SegmentsFiltered)
+			verbosePrintf("%d record(s) scanned, %d matched, %d duplicate(s) dropped\n", s.RecordsScanned, s.RecordsMatched, s.RecordsDeduplicated)
+			if result.Params.Sample > 0 {
+				verbosePrintf("sampled %g, of about %d record(s)\n", result.Params.Sample, s.RecordsEstimated)
+			}
+			verbosePrintf("%dB (%dMiB) read\n", s.BytesRead, s.BytesRead/(1024*1024))
+			verbosePrintf("%s plan, %s read, %s merge\n", s.PlanDuration, s.ReadDuration, s.MergeDuration)
+		}
+
+		if result.Continue == "" {
+			break
+		}
+		if !*follow {
+			fmt.Fprintf(stderr, "more records available; continue with -continue %s\n", result.Continue)
+			return nil
+		}
+		token = result.Continue
+	}
+	if !*tail {
+		return nil
+	}
 
-	req, err := http.NewRequest(method, fmt.Sprintf(
-		"http://%s/store%s?from=%s&to=%s&q=%s%s",
+	// The stream replays what was stored since the last record, and then
+	// carries on with new records, so none are missed, or repeated.
+	req, err := http.NewRequest("GET", fmt.Sprintf(
+		"%s://%s/store%s?q=%s&window=%s&since=%s&errors=true%s%s%s%s",
+		scheme,
 		hostport,
-		store.APIPathUserQuery,
-		url.QueryEscape(fromStr),
-		url.QueryEscape(toStr),
+		store.APIPathUserStream,
 		url.QueryEscape(*q),
+		url.QueryEscape(window.String()),
+		since.String(),
 		asRegex,
+		asOrigin,
+		asTopic,
+		asSample,
 	), nil)
 	if err != nil {
 		return err
 	}
 	verbosePrintf("GET %s\n", req.URL.String())
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		req.URL.RawQuery = "" // for pretty print
 		return errors.Errorf("%s %s: %s", req.Method, req.URL.String(), resp.Status)
 	}
-
-	var result store.QueryResult
-	if err := result.DecodeFrom(resp); err != nil {
-		return errors.Wrap(err, "decoding query result")
-	}
-
-	qtype := "normal string"
-	if result.Params.Regex {
-		qtype = "regular expression"
-	}
-
-	verbosePrintf("Response in %s\n", time.Since(begin))
-	verbosePrintf("Queried from %s\n", result.Params.From)
-	verbosePrintf("Queried to %s\n", result.Params.To)
-	verbosePrintf("Queried %s %q\n", qtype, result.Params.Q)
-	verbosePrintf("%d node(s) queried\n", result.NodesQueried)
-	verbosePrintf("%d segment(s) queried\n", result.SegmentsQueried)
-	verbosePrintf("%dB (%dMiB) maximum data set size\n", result.MaxDataSetSize, result.MaxDataSetSize/(1024*1024))
-	verbosePrintf("%d error(s)\n", result.ErrorCount)
-	verbosePrintf("%s server-reported duration\n", result.Duration)
-
-	switch {
-	case *nocopy:
-		break
-	case *withulid:
-		io.Copy(os.Stdout, result.Records)
-	case *withtime:
-		io.Copy(os.Stdout, parseTime(result.Records))
-	default:
-		io.Copy(os.Stdout, strip(result.Records))
+	records := streamRecords(resp.Body, stderr)
+	defer records.Close()
+	if _, err := f.copy(out, records); err != nil {
+		if out.err != nil {
+			return errors.Wrap(out.err, "writing records")
+		}
+		return err
 	}
-	result.Records.Close()
-
-	return nil
+	return ctx.Err()
 }
 
-func neg(d time.Duration) time.Duration {
-	if d > 0 {
-		d = -d
+// queryULID returns the least ULID after a -to flag, as resolved by
+// parseQueryTime, i.e. of a record that the query didn't return.
+func queryULID(s string) (ulid.ULID, error) {
+	if id, err := ulid.Parse(s); err == nil {
+		return id, nil
 	}
-	return d
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+	ms, err := ulidutil.Timestamp(t)
+	return ulidutil.Min(ms), err
 }
 
-func strip(r io.Reader) io.Reader {
+// track passes the records of r through, and sets max to the greatest ULID
+// among them, if that's greater.
+func track(r io.Reader, max *ulid.ULID) io.ReadCloser {
 	pr, pw := io.Pipe()
 	go func() {
-		s := bufio.NewScanner(r)
+		s := record.NewScanner(r)
 		for s.Scan() {
-			pw.Write(s.Bytes()[ulid.EncodedSize+1:])
+			var id ulid.ULID
+			if len(s.Bytes()) >= ulid.EncodedSize && id.UnmarshalText(s.Bytes()[:ulid.EncodedSize]) == nil && id.Compare(*max) > 0 {
+				*max = id
+			}
+			pw.Write(s.Bytes())
 			pw.Write([]byte{'\n'})
 		}
 		pw.CloseWithError(s.Err())
@@ -167,25 +473,127 @@ func strip(r io.Reader) io.Reader {
 	return pr
 }
 
-func parseTime(r io.Reader) io.Reader {
+// streamRecords passes the records of a streaming query response through,
+// dropping heartbeats, and writing peer errors to stderr.
+func streamRecords(r io.Reader, stderr io.Writer) io.ReadCloser {
 	pr, pw := io.Pipe()
 	go func() {
-		s := bufio.NewScanner(r)
+		s := record.NewScanner(r)
 		for s.Scan() {
-			id, _ := ulid.Parse(s.Text()[:ulid.EncodedSize])
-			var (
-				msec = id.Time()
-				sec  = msec / 1e3
-				rem  = msec % 1e3
-				nsec = rem * 1e6
-				t    = time.Unix(int64(sec), int64(nsec))
-			)
-
-			pw.Write([]byte(t.Format(time.RFC3339)))
-			pw.Write(s.Bytes()[ulid.EncodedSize:])
+			switch {
+			case len(s.Bytes()) == 0:
+				continue // heartbeat
+			case bytes.HasPrefix(s.Bytes(), []byte("#")):
+				fmt.Fprintf(stderr, "%s\n", s.Bytes()) // peer error
+				continue
+			}
+			pw.Write(s.Bytes())
 			pw.Write([]byte{'\n'})
 		}
 		pw.CloseWithError(s.Err())
 	}()
 	return pr
 }
+
+// parseQueryTime resolves a -from or -to flag to something the store API
+// understands. Bare durations mean that long ago; anything else is as per
+// store.ParseTime, except ULIDs, which we pass along as they are.
+func parseQueryTime(s string, now time.Time) (string, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(neg(d)).Format(time.RFC3339Nano), nil
+	}
+	if _, err := ulid.Parse(s); err == nil {
+		return s, nil
+	}
+	t, err := store.ParseTime(s, now)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(time.RFC3339Nano), nil
+}
+
+func neg(d time.Duration) time.Duration {
+	if d > 0 {
+		d = -d
+	}
+	return d
+}
+
+// recordFormat is how records are written out: each with a prefix, in place
+// of its ULID, and unescaped, as it was ingested, and ended with delim.
+type recordFormat struct {
+	prefix func(id ulid.ULID) string
+	delim  byte
+}
+
+// copy the records of r to w, formatted, until r is done, or w fails.
+func (f recordFormat) copy(w io.Writer, r io.Reader) (n int64, err error) {
+	var (
+		s   = record.NewScanner(r)
+		buf []byte
+	)
+	for s.Scan() {
+		line := s.Bytes()
+		if len(line) < ulid.EncodedSize+1 {
+			continue // not a record
+		}
+		var id ulid.ULID
+		id.UnmarshalText(line[:ulid.EncodedSize])
+		buf = append(buf[:0], f.prefix(id)...)
+		buf = append(buf, record.Unescape(line[ulid.EncodedSize+1:])...)
+		buf = append(buf, f.delim)
+		m, err := w.Write(buf)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, s.Err()
+}
+
+func noPrefix(ulid.ULID) string { return "" }
+
+func ulidPrefix(id ulid.ULID) string { return id.String() + " " }
+
+func localTimePrefix(id ulid.ULID) string {
+	return ulidutil.TimeOf(id).Local().Format(time.RFC3339) + " "
+}
+
+// ulidTimeLayout is RFC3339, to the millisecond of ULIDs, so every timestamp
+// is as long as the rest, and they sort as they read.
+const ulidTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+func ulidTimePrefix(id ulid.ULID) string {
+	return ulidutil.TimeOf(id).UTC().Format(ulidTimeLayout) + " "
+}
+
+// cancelingWriter cancels the query once a write fails, e.g. because the
+// reader of stdout went away, so it stops fetching records that can't be
+// written, and keeps the error. Writes after that fail at once.
+type cancelingWriter struct {
+	w      io.Writer
+	cancel context.CancelFunc
+	err    error
+}
+
+func (w *cancelingWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	if err != nil {
+		w.err = err
+		w.cancel()
+	}
+	return n, err
+}
+
+// isBrokenPipe returns true if err is from writing to a pipe, or socket,
+// whose reader went away.
+func isBrokenPipe(err error) bool {
+	err = errors.Cause(err)
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == syscall.EPIPE
+}
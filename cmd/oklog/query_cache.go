@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// newQueryCache returns the cache for -store.query-cache-size, with its
+// metrics registered with r, or nil, if the size isn't positive, i.e. query
+// results aren't cached.
+func newQueryCache(r prometheus.Registerer, maxBytes int64) *store.QueryCache {
+	if maxBytes <= 0 {
+		return nil
+	}
+	lookups := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "store_query_cache_lookups_total",
+		Help:      "Queries of sealed ranges looked up in the query cache, by result (hit, miss).",
+	}, []string{"result"})
+	evictions := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "store_query_cache_evictions_total",
+		Help:      "Query results evicted from the query cache to make room.",
+	})
+	r.MustRegister(lookups, evictions)
+	return store.NewQueryCache(maxBytes, lookups.WithLabelValues("hit"), lookups.WithLabelValues("miss"), evictions)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// newQueryPlanner returns the planner for -store.query-plan, with its metrics
+// registered with r, or nil, if user queries aren't planned, i.e. they're
+// sent to every store node in full.
+func newQueryPlanner(r prometheus.Registerer, enabled bool, zone string) *store.QueryPlanner {
+	if !enabled {
+		return nil
+	}
+	fallbacks := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "store_query_plan_fallbacks_total",
+		Help:      "Segments of planned queries read from another replica, as the store node they were planned on failed.",
+	})
+	r.MustRegister(fallbacks)
+	return store.NewQueryPlanner(zone, fallbacks)
+}
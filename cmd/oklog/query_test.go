@@ -0,0 +1,529 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+func TestParseQueryTime(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2017, 3, 14, 15, 59, 40, 0, time.UTC)
+	for input, want := range map[string]string{
+		"1h":                         "2017-03-14T14:59:40Z",
+		"-1h":                        "2017-03-14T14:59:40Z",
+		"now":                        "2017-03-14T15:59:40Z",
+		"now-90s":                    "2017-03-14T15:58:10Z",
+		"1489507180123":              "2017-03-14T15:59:40.123Z",
+		"2017-03-14T15:59:40Z":       "2017-03-14T15:59:40Z",
+		"01BB6RQR190000000000000000": "01BB6RQR190000000000000000",
+	} {
+		have, err := parseQueryTime(input, now)
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		if want != have {
+			t.Errorf("%q: want %q, have %q", input, want, have)
+		}
+	}
+
+	if _, err := parseQueryTime("yesterday", now); err == nil {
+		t.Errorf("want error, have none")
+	}
+}
+
+func TestRunQueryTimes(t *testing.T) {
+	t.Parallel()
+
+	filelog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, store.FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		peer               = &hostPeer{}
+		replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+		replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
+		duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+		mux                = http.NewServeMux()
+		api                = store.NewAPI(peer, filelog, store.APIConfig{
+			QueryClient:        http.DefaultClient,
+			StreamClient:       http.DefaultClient,
+			ReplicatedSegments: replicatedSegments,
+			ReplicatedBytes:    replicatedBytes,
+			Duration:           duration,
+			Reporter:           store.LogReporter{Logger: log.NewNopLogger()},
+		})
+	)
+	defer api.Close()
+	mux.Handle("/store/", http.StripPrefix("/store", api))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	peer.hostport = strings.TrimPrefix(server.URL, "http://")
+
+	for _, testcase := range []struct {
+		from, to string
+		want     string // error substring, if any
+	}{
+		{"-15m", "now", ""},
+		{"1489507180", "1489507180123", ""},
+		{"2017-03-14T15:59:40Z", "now-1m", ""},
+		{"now", "1h", "400"},
+		{"nope", "now", "couldn't parse -from"},
+	} {
+		err := runQuery([]string{"-store", "tcp://" + peer.hostport, "-from", testcase.from, "-to", testcase.to, "-nocopy"})
+		switch {
+		case testcase.want == "" && err != nil:
+			t.Errorf("-from %s -to %s: %v", testcase.from, testcase.to, err)
+		case testcase.want != "" && (err == nil || !strings.Contains(err.Error(), testcase.want)):
+			t.Errorf("-from %s -to %s: want error containing %q, have %v", testcase.from, testcase.to, testcase.want, err)
+		}
+	}
+}
+
+func TestRunQueryExtract(t *testing.T) {
+	t.Parallel()
+
+	filelog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, store.FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		peer               = &hostPeer{}
+		replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+		replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
+		duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+		mux                = http.NewServeMux()
+		api                = store.NewAPI(peer, filelog, store.APIConfig{
+			QueryClient:        http.DefaultClient,
+			StreamClient:       http.DefaultClient,
+			ReplicatedSegments: replicatedSegments,
+			ReplicatedBytes:    replicatedBytes,
+			Duration:           duration,
+			Reporter:           store.LogReporter{Logger: log.NewNopLogger()},
+		})
+	)
+	defer api.Close()
+	mux.Handle("/store/", http.StripPrefix("/store", api))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	peer.hostport = strings.TrimPrefix(server.URL, "http://")
+
+	var segment string
+	for i, line := range []string{
+		"GET /orders user_id=42 latency=7ms",
+		"GET /healthz",
+		"POST /orders user_id=7 latency=120ms",
+	} {
+		segment += fmt.Sprintf("%s %s\n", ulid.MustNew(ulid.Timestamp(time.Now().Add(time.Duration(i-10)*time.Minute)), rand.Reader), line)
+	}
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest("POST", store.APIPathReplicate, strings.NewReader(segment)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+	}
+
+	var have bytes.Buffer
+	if err := query(context.Background(), &have, ioutil.Discard, []string{"-store", "tcp://" + peer.hostport, "-from", "1h", "-q", `user_id=(\d+) latency=(\d+)ms`, "-extract"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "42\t7\n7\t120\n"; want != have.String() {
+		t.Errorf("want %q, have %q", want, have.String())
+	}
+	if err := query(context.Background(), ioutil.Discard, ioutil.Discard, []string{"-store", "tcp://" + peer.hostport, "-q", "user_id", "-extract"}); err == nil || !strings.Contains(err.Error(), "no capture groups") {
+		t.Errorf("without capture groups: want error, have %v", err)
+	}
+}
+
+func TestRunQueryOutput(t *testing.T) {
+	t.Parallel()
+
+	filelog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, store.FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		peer               = &hostPeer{}
+		replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+		replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
+		duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+		mux                = http.NewServeMux()
+		api                = store.NewAPI(peer, filelog, store.APIConfig{
+			QueryClient:        http.DefaultClient,
+			StreamClient:       http.DefaultClient,
+			ReplicatedSegments: replicatedSegments,
+			ReplicatedBytes:    replicatedBytes,
+			Duration:           duration,
+			Reporter:           store.LogReporter{Logger: log.NewNopLogger()},
+		})
+	)
+	defer api.Close()
+	mux.Handle("/store/", http.StripPrefix("/store", api))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	peer.hostport = strings.TrimPrefix(server.URL, "http://")
+
+	// The second record was ingested with framing, and holds a newline.
+	var (
+		t0  = time.Now().Add(-10 * time.Minute).Truncate(time.Millisecond)
+		t1  = t0.Add(time.Minute)
+		id0 = ulid.MustNew(ulid.Timestamp(t0), rand.Reader)
+		id1 = ulid.MustNew(ulid.Timestamp(t1), rand.Reader)
+	)
+	segment := fmt.Sprintf("%s web GET /\n%s web %s\n", id0, id1, record.Escape([]byte("panic: oops\n  at main")))
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest("POST", store.APIPathReplicate, strings.NewReader(segment)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+	}
+
+	ts := func(t time.Time) string { return t.UTC().Format("2006-01-02T15:04:05.000Z07:00") }
+	for _, testcase := range []struct {
+		flags      []string
+		wantStdout string
+		wantStderr string
+	}{
+		{nil, "web GET /\nweb panic: oops\n  at main\n", ""},
+		{[]string{"-no-ulid"}, "web GET /\nweb panic: oops\n  at main\n", ""},
+		{[]string{"-ulid"}, fmt.Sprintf("%s web GET /\n%s web panic: oops\n  at main\n", id0, id1), ""},
+		{[]string{"-ulid-time"}, fmt.Sprintf("%s web GET /\n%s web panic: oops\n  at main\n", ts(t0), ts(t1)), ""},
+		{[]string{"-null"}, "web GET /\x00web panic: oops\n  at main\x00", ""},
+		{[]string{"--ulid-time", "--null"}, fmt.Sprintf("%s web GET /\x00%s web panic: oops\n  at main\x00", ts(t0), ts(t1)), ""},
+		{[]string{"-limit", "1", "-null"}, "web GET /\x00", "more records available"},
+		{[]string{"-v"}, "web GET /\nweb panic: oops\n  at main\n", "node(s) queried"},
+	} {
+		var stdout, stderr bytes.Buffer
+		args := append([]string{"-store", "tcp://" + peer.hostport, "-from", "1h"}, testcase.flags...)
+		if err := query(context.Background(), &stdout, &stderr, args); err != nil {
+			t.Errorf("%v: %v", testcase.flags, err)
+			continue
+		}
+		if want, have := testcase.wantStdout, stdout.String(); want != have {
+			t.Errorf("%v: stdout: want %q, have %q", testcase.flags, want, have)
+		}
+		switch want, have := testcase.wantStderr, stderr.String(); {
+		case want == "" && have != "":
+			t.Errorf("%v: stderr: want nothing, have %q", testcase.flags, have)
+		case !strings.Contains(have, want):
+			t.Errorf("%v: stderr: want %q, have %q", testcase.flags, want, have)
+		}
+	}
+
+	for _, flags := range [][]string{
+		{"-ulid", "-no-ulid"},
+		{"-time", "-ulid-time"},
+		{"-null", "-output", "json"},
+	} {
+		args := append([]string{"-store", "tcp://" + peer.hostport}, flags...)
+		if err := query(context.Background(), ioutil.Discard, ioutil.Discard, args); err == nil {
+			t.Errorf("%v: want error, have none", flags)
+		}
+	}
+}
+
+func TestRunQueryClusters(t *testing.T) {
+	t.Parallel()
+
+	// Each cluster is a store node of its own, with its own records; both
+	// hold the same one, which isn't deduplicated across them.
+	serve := func(segment string) *httptest.Server {
+		filelog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, store.FileLogConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			peer               = &hostPeer{}
+			replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+			replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
+			duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+			mux                = http.NewServeMux()
+			api                = store.NewAPI(peer, filelog, store.APIConfig{
+				QueryClient:        http.DefaultClient,
+				StreamClient:       http.DefaultClient,
+				ReplicatedSegments: replicatedSegments,
+				ReplicatedBytes:    replicatedBytes,
+				Duration:           duration,
+				Reporter:           store.LogReporter{Logger: log.NewNopLogger()},
+			})
+		)
+		mux.Handle("/store/", http.StripPrefix("/store", api))
+		server := httptest.NewServer(mux)
+		peer.hostport = strings.TrimPrefix(server.URL, "http://")
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest("POST", store.APIPathReplicate, strings.NewReader(segment)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+		return server
+	}
+	var (
+		t0 = time.Now().Add(-10 * time.Minute)
+		id = func(i int) ulid.ULID {
+			return ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Second)), rand.Reader)
+		}
+		a   = id(0)
+		b   = id(1)
+		c   = id(2)
+		us  = serve(fmt.Sprintf("%s GET /\n%s same\n", a, c))
+		eu  = serve(fmt.Sprintf("%s POST /\n%s same\n", b, c))
+		off = httptest.NewServer(http.NotFoundHandler())
+	)
+	for _, s := range []*httptest.Server{us, eu, off} {
+		defer s.Close()
+	}
+	clusters := []string{
+		"-cluster", "us=tcp://" + strings.TrimPrefix(us.URL, "http://"),
+		"-cluster", "eu=tcp://" + strings.TrimPrefix(eu.URL, "http://"),
+	}
+
+	for _, testcase := range []struct {
+		flags      []string
+		wantStdout string
+		wantStderr string
+	}{
+		{nil, "GET /\nPOST /\nsame\nsame\n", ""},
+		{[]string{"-cluster-label", "-ulid"}, fmt.Sprintf("%s us GET /\n%s eu POST /\n%s us same\n%s eu same\n", a, b, c, c), ""},
+		{[]string{"-reverse", "-cluster-label"}, "us same\neu same\neu POST /\nus GET /\n", ""},
+		{[]string{"-cluster", "off=tcp://" + strings.TrimPrefix(off.URL, "http://")}, "GET /\nPOST /\nsame\nsame\n", "WARNING: cluster off"},
+	} {
+		var stdout, stderr bytes.Buffer
+		args := append(append([]string{"-from", "1h"}, clusters...), testcase.flags...)
+		if err := query(context.Background(), &stdout, &stderr, args); err != nil {
+			t.Errorf("%v: %v", testcase.flags, err)
+			continue
+		}
+		if want, have := testcase.wantStdout, stdout.String(); want != have {
+			t.Errorf("%v: stdout: want %q, have %q", testcase.flags, want, have)
+		}
+		switch want, have := testcase.wantStderr, stderr.String(); {
+		case want == "" && have != "":
+			t.Errorf("%v: stderr: want nothing, have %q", testcase.flags, have)
+		case !strings.Contains(have, want):
+			t.Errorf("%v: stderr: want %q, have %q", testcase.flags, want, have)
+		}
+	}
+
+	for _, flags := range [][]string{
+		{"-cluster", "off=tcp://" + strings.TrimPrefix(off.URL, "http://")},
+		{"-cluster", "us=localhost:1", "-cluster", "us=localhost:2"},
+		{"-cluster", "localhost:1"},
+		{"-cluster", "us=localhost:1", "-limit", "1"},
+		{"-cluster", "us=localhost:1", "-follow"},
+	} {
+		if err := query(context.Background(), ioutil.Discard, ioutil.Discard, flags); err == nil {
+			t.Errorf("%v: want error, have none", flags)
+		}
+	}
+}
+
+func TestRunQueryClosedStdout(t *testing.T) {
+	t.Parallel()
+
+	filelog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, store.FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		peer               = &hostPeer{}
+		replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+		replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
+		duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+		mux                = http.NewServeMux()
+		api                = store.NewAPI(peer, filelog, store.APIConfig{
+			QueryClient:        http.DefaultClient,
+			StreamClient:       http.DefaultClient,
+			ReplicatedSegments: replicatedSegments,
+			ReplicatedBytes:    replicatedBytes,
+			Duration:           duration,
+			Reporter:           store.LogReporter{Logger: log.NewNopLogger()},
+		})
+	)
+	defer api.Close()
+	mux.Handle("/store/", http.StripPrefix("/store", api))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	peer.hostport = strings.TrimPrefix(server.URL, "http://")
+
+	var segment string
+	for i := 0; i < 10; i++ {
+		segment += fmt.Sprintf("%s record %d\n", ulid.MustNew(ulid.Timestamp(time.Now().Add(time.Duration(i-10)*time.Minute)), rand.Reader), i)
+	}
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest("POST", store.APIPathReplicate, strings.NewReader(segment)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+	}
+
+	// Following never finishes by itself, so it must stop once stdout is
+	// closed, as by head, with the error of the write.
+	for _, flags := range [][]string{
+		{"-from", "1h"},
+		{"-from", "1h", "-f"},
+	} {
+		pr, pw := io.Pipe()
+		go func() {
+			bufio.NewReader(pr).ReadString('\n')
+			pr.CloseWithError(syscall.EPIPE)
+		}()
+		done := make(chan error, 1)
+		go func() {
+			done <- query(context.Background(), pw, ioutil.Discard, append([]string{"-store", "tcp://" + peer.hostport}, flags...))
+		}()
+		select {
+		case err := <-done:
+			if !isBrokenPipe(err) {
+				t.Errorf("%v: want broken pipe, have %v", flags, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v: query didn't stop once stdout was closed", flags)
+		}
+	}
+}
+
+func TestRunQueryFollow(t *testing.T) {
+	t.Parallel()
+
+	filelog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, store.FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		peer               = &hostPeer{}
+		replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+		replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
+		duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+		mux                = http.NewServeMux()
+		api                = store.NewAPI(peer, filelog, store.APIConfig{
+			QueryClient:        http.DefaultClient,
+			StreamClient:       http.DefaultClient,
+			ReplicatedSegments: replicatedSegments,
+			ReplicatedBytes:    replicatedBytes,
+			Duration:           duration,
+			Reporter:           store.LogReporter{Logger: log.NewNopLogger()},
+		})
+	)
+	defer api.Close()
+
+	var (
+		mtx  sync.Mutex
+		want []string
+	)
+	replicate := func(ago ...time.Duration) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		var segment string
+		for _, d := range ago {
+			record := fmt.Sprintf("%s record %d\n", ulid.MustNew(ulid.Timestamp(time.Now().Add(-d)), rand.Reader), len(want))
+			segment += record
+			want = append(want, record)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest("POST", store.APIPathReplicate, strings.NewReader(segment)))
+		if w.Code != http.StatusOK {
+			t.Errorf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	// Records are stored before the query, between it and the stream, and
+	// once the stream is running.
+	replicate(30*time.Minute, 20*time.Minute, 10*time.Minute)
+	var gap sync.Once
+	mux.Handle("/store/", http.StripPrefix("/store", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == store.APIPathUserStream {
+			gap.Do(func() {
+				time.Sleep(2 * time.Millisecond) // after the query's -to
+				replicate(0, 0)
+			})
+		}
+		api.ServeHTTP(w, r)
+	})))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	peer.hostport = strings.TrimPrefix(server.URL, "http://")
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		pr, pw      = io.Pipe()
+		done        = make(chan error, 1)
+		lines       = make(chan string)
+	)
+	defer cancel()
+	go func() {
+		err := query(ctx, pw, ioutil.Discard, []string{"-store", "tcp://" + peer.hostport, "-from", "1h", "-f", "-window", "100ms", "-ulid"})
+		pw.Close()
+		done <- err
+	}()
+	go func() {
+		s := bufio.NewScanner(pr)
+		for s.Scan() {
+			lines <- s.Text() + "\n"
+		}
+		close(lines)
+	}()
+	var have []string
+	read := func(n int) {
+		timeout := time.After(5 * time.Second)
+		for len(have) < n {
+			select {
+			case line := <-lines:
+				have = append(have, line)
+			case <-timeout:
+				t.Fatalf("timeout waiting for %d records; have %q", n, have)
+			}
+		}
+	}
+
+	// Once the records in between are replayed, the stream is live.
+	read(5)
+	replicate(0)
+	read(6)
+
+	// Cancel promptly, and with no more records.
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("want an error once canceled, have none")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the query to return")
+	}
+	for line := range lines {
+		have = append(have, line)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	sort.Strings(want) // by ULID
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+type hostPeer struct{ hostport string }
+
+func (p *hostPeer) Current(cluster.PeerType) []string        { return []string{p.hostport} }
+func (p *hostPeer) Zones(cluster.PeerType) map[string]string { return map[string]string{} }
+func (p *hostPeer) State() map[string]interface{}            { return map[string]interface{}{} }
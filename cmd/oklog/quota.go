@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/ingest"
+)
+
+// quotaMetrics are the metrics of per-source ingest quotas, by source.
+type quotaMetrics struct {
+	records          *prometheus.CounterVec
+	bytes            *prometheus.CounterVec
+	bytesToday       *prometheus.GaugeVec
+	throttledSeconds *prometheus.CounterVec
+	rejectedRecords  *prometheus.CounterVec
+}
+
+func newQuotaMetrics() quotaMetrics {
+	return quotaMetrics{
+		records: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "ingest_source_records_total",
+			Help:      "Records read from each source, with -ingest.quota-file.",
+		}, []string{"source"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "ingest_source_bytes_total",
+			Help:      "Bytes read from each source, with -ingest.quota-file.",
+		}, []string{"source"}),
+		bytesToday: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "oklog",
+			Name:      "ingest_source_bytes_today",
+			Help:      "Bytes read from each source today (UTC), against its daily quota.",
+		}, []string{"source"}),
+		throttledSeconds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "ingest_source_throttled_seconds_total",
+			Help:      "Time each source's connections spent waiting on its record rate quota.",
+		}, []string{"source"}),
+		rejectedRecords: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "ingest_source_rejected_records_total",
+			Help:      "Records rejected because their source was over its daily byte quota.",
+		}, []string{"source"}),
+	}
+}
+
+func (m quotaMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.records, m.bytes, m.bytesToday, m.throttledSeconds, m.rejectedRecords}
+}
+
+// readQuotas reads the per-source ingest quotas from filename; see
+// ingest.ParseQuotas.
+func readQuotas(filename string) (map[string]ingest.Quota, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading ingest quotas")
+	}
+	defer f.Close()
+	quotas, err := ingest.ParseQuotas(f)
+	if err != nil {
+		return nil, errors.Wrap(err, filename)
+	}
+	return quotas, nil
+}
+
+// newQuotas returns the quotas in filename, or nil if it's empty, i.e. there
+// are no quotas.
+func newQuotas(filename string, m quotaMetrics) (*ingest.Quotas, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	quotas, err := readQuotas(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ingest.NewQuotas(quotas, m.records, m.bytes, m.bytesToday, m.throttledSeconds, m.rejectedRecords), nil
+}
+
+// reloadQuotas reloads the ingest quotas on SIGHUP, until canceled. If they
+// can't be loaded, the last quotas are kept.
+func reloadQuotas(quotas *ingest.Quotas, filename string, cancel <-chan struct{}, logger log.Logger) error {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+	for {
+		select {
+		case <-c:
+			q, err := readQuotas(filename)
+			if err != nil {
+				level.Warn(logger).Log("quotas", "reload", "err", err)
+				continue
+			}
+			quotas.Set(q)
+			level.Info(logger).Log("quotas", "reload", "sources", len(q))
+		case <-cancel:
+			return nil
+		}
+	}
+}
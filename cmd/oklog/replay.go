@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/stream"
+)
+
+// exitReplayDuplicates is the exit status of oklog replay when the replayed
+// stream emits a record more than once.
+const exitReplayDuplicates = 2
+
+func runReplay(args []string) error {
+	flagset := flag.NewFlagSet("replay", flag.ExitOnError)
+	var (
+		traceDir = flagset.String("trace-dir", "", "directory of the trace files of oklog stream -trace-dir to replay")
+		withulid = flagset.Bool("ulid", false, "include ULID prefix with each record")
+	)
+	flagset.Usage = usageFor(flagset, "oklog replay [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if *traceDir == "" {
+		return errors.New("-trace-dir is required")
+	}
+
+	var offset = ulid.EncodedSize + 1
+	if *withulid {
+		offset = 0
+	}
+	return replay(os.Stdout, os.Stderr, *traceDir, offset)
+}
+
+// replay the traces in dir through deduplication, as the stream they're of
+// did, printing the records it emits from the offset of their line, and, to
+// stderr, those it emits more than once, which it fails with
+// exitReplayDuplicates for.
+func replay(stdout, stderr io.Writer, dir string, offset int) error {
+	traces, err := stream.ReadTraces(dir)
+	if err != nil {
+		return err
+	}
+	var (
+		seen       = map[string]int{}
+		duplicates int
+	)
+	if err := stream.Replay(traces, func(b []byte) {
+		if len(b) <= ulid.EncodedSize {
+			return // not a record
+		}
+		id := string(b[:ulid.EncodedSize])
+		if seen[id]++; seen[id] > 1 {
+			duplicates++
+			fmt.Fprintf(stderr, "# duplicate %s, emitted %d times\n", id, seen[id])
+		}
+		fmt.Fprintf(stdout, "%s%s\n", b[offset:ulid.EncodedSize+1], record.Unescape(b[ulid.EncodedSize+1:]))
+	}); err != nil {
+		return err
+	}
+	if duplicates > 0 {
+		return exitError{
+			code: exitReplayDuplicates,
+			err:  errors.Errorf("%d duplicate record(s) in %d record(s) replayed", duplicates, len(seen)+duplicates),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oklog/oklog/pkg/cluster"
+)
+
+func TestReplayCommand(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "oklog-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A peer that sends a record again, long after its first time, e.g.
+	// as it replays what a reconnecting stream missed, from too far back.
+	trace := strings.Join([]string{
+		"# oklog stream trace",
+		"# peer 10.0.0.1:7650",
+		"# window 1s",
+		"# start 2017-06-01T12:00:00.000000000Z",
+		"2017-06-01T12:00:00.060000000Z 01BHHRDNHJ3MQKRJTTD5W8F5N5 GET /index.html 200",
+		"2017-06-01T12:00:00.510000000Z 01BHHRDNZM1CE2TFJFB9NQS3CY GET /favicon.ico 404",
+		"2017-06-01T12:00:05.000000000Z 01BHHRDNHJ3MQKRJTTD5W8F5N5 GET /index.html 200",
+		"# end 2017-06-01T12:00:08.000000000Z",
+		"",
+	}, "\n")
+	if err := ioutil.WriteFile(filepath.Join(dir, "10.0.0.1_7650.trace"), []byte(trace), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = replay(&stdout, &stderr, dir, 0)
+	if want, have := exitReplayDuplicates, exitCode(err); want != have {
+		t.Errorf("exit code: want %d, have %d (%v)", want, have, err)
+	}
+	if want, have := strings.Join([]string{
+		"01BHHRDNHJ3MQKRJTTD5W8F5N5 GET /index.html 200",
+		"01BHHRDNZM1CE2TFJFB9NQS3CY GET /favicon.ico 404",
+		"01BHHRDNHJ3MQKRJTTD5W8F5N5 GET /index.html 200",
+		"",
+	}, "\n"), stdout.String(); want != have {
+		t.Errorf("stdout: want %q, have %q", want, have)
+	}
+	if want, have := "# duplicate 01BHHRDNHJ3MQKRJTTD5W8F5N5, emitted 2 times\n", stderr.String(); want != have {
+		t.Errorf("stderr: want %q, have %q", want, have)
+	}
+
+	if err := replay(ioutil.Discard, ioutil.Discard, filepath.Join(dir, "missing"), 0); err == nil {
+		t.Errorf("want an error replaying no traces, have none")
+	}
+}
+
+func TestStreamPeers(t *testing.T) {
+	t.Parallel()
+
+	peers := []cluster.PeerState{
+		{APIAddr: "10.0.0.1", APIPort: 7650, Type: cluster.PeerTypeStore, State: cluster.PeerStateAlive},
+		{APIAddr: "10.0.0.2", APIPort: 7650, Type: cluster.PeerTypeIngestStore, State: cluster.PeerStateAlive},
+		{APIAddr: "10.0.0.3", APIPort: 7650, Type: cluster.PeerTypeStore, State: cluster.PeerStateLeaving},
+		{APIAddr: "10.0.0.4", APIPort: 7650, Type: cluster.PeerTypeIngest, State: cluster.PeerStateAlive},
+	}
+	if want, have := []string{"10.0.0.1:7650", "10.0.0.2:7650"}, streamPeers(peers); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	peers = append(peers, cluster.PeerState{APIAddr: "10.0.0.5", APIPort: 7650, Type: cluster.PeerTypeReadOnlyStore, State: cluster.PeerStateAlive})
+	if want, have := []string{"10.0.0.5:7650"}, streamPeers(peers); !reflect.DeepEqual(want, have) {
+		t.Errorf("read-only: want %v, have %v", want, have)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+// newIOScheduler returns the scheduler for -store.io-foreground-latency,
+// with its metrics registered with r, or nil, if the latency isn't positive,
+// i.e. background I/O is never capped.
+func newIOScheduler(r prometheus.Registerer, threshold time.Duration, bytesPerSecond int64) *fs.IOScheduler {
+	if threshold <= 0 {
+		return nil
+	}
+	capped := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "oklog",
+		Name:      "store_background_io_capped",
+		Help:      "1 while background I/O is capped, because queries are slow.",
+	})
+	throttledSeconds := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "oklog",
+		Name:      "store_background_io_throttled_seconds_total",
+		Help:      "Time background I/O, e.g. consuming and compacting, waited on the cap.",
+	})
+	r.MustRegister(capped, throttledSeconds)
+	return fs.NewIOScheduler(threshold, bytesPerSecond, capped, throttledSeconds)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// newSegmentKeys returns the master keys for -store.segment-key-file, read
+// like gossip encryption keys, or nil, if filename is empty, i.e. segments
+// aren't encrypted.
+func newSegmentKeys(filename string) (*store.MasterKeys, error) {
+	keys, err := readKeyFile(filename, "segment master keys")
+	if err != nil || keys == nil {
+		return nil, err
+	}
+	return store.NewMasterKeys(keys)
+}
+
+// reloadSegmentKeys reloads the segment master keys on SIGHUP, until
+// canceled. If they can't be loaded, the last keys are kept.
+func reloadSegmentKeys(masterKeys *store.MasterKeys, filename string, cancel <-chan struct{}, logger log.Logger) error {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+	for {
+		select {
+		case <-c:
+			keys, err := readKeyFile(filename, "segment master keys")
+			if err == nil {
+				err = masterKeys.Set(keys)
+			}
+			if err != nil {
+				level.Warn(logger).Log("segment_keys", "reload", "err", err)
+				continue
+			}
+			level.Info(logger).Log("segment_keys", "reload", "n", len(keys))
+		case <-cancel:
+			return nil
+		}
+	}
+}
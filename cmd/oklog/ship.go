@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// newShipper returns the Shipper of -store.ship-to, with its queue in the
+// store path, and its metrics registered with r, or nil if target is empty.
+func newShipper(r prometheus.Registerer, target string, queueSize int, client *http.Client, storeLog store.Log, fsys fs.Filesystem, storePath string, logger log.Logger) (*store.Shipper, error) {
+	if target == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.Errorf("invalid -store.ship-to %q: want the URL of a store node's API, e.g. https://standby:7650", target)
+	}
+	if queueSize <= 0 {
+		return nil, errors.Errorf("invalid -store.ship-queue-size %d", queueSize)
+	}
+	var (
+		backlog = prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "oklog",
+			Name:      "store_ship_backlog_segments",
+			Help:      "Segments queued to be shipped to -store.ship-to.",
+		})
+		lastShipped = prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "oklog",
+			Name:      "store_ship_last_shipped_timestamp_seconds",
+			Help:      "Unix time a segment was last shipped to -store.ship-to.",
+		})
+		dropped = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "store_ship_dropped_segments_total",
+			Help:      "Segments that were queued, but never shipped, to -store.ship-to, as the queue was full, or they were compacted first.",
+		})
+	)
+	r.MustRegister(backlog, lastShipped, dropped)
+	return store.NewShipper(
+		target,
+		client,
+		storeLog,
+		fsys,
+		filepath.Join(storePath, "ship.queue"),
+		queueSize,
+		backlog,
+		lastShipped,
+		dropped,
+		store.LogReporter{Logger: log.With(logger, "component", "Shipper")},
+	)
+}
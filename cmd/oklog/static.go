@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/cluster"
+)
+
+const defaultStaticHealthInterval = time.Second
+
+// staticPeersGiven reports whether the node should run with static peers,
+// instead of gossip. An empty -cluster.static-peers counts, so a single node
+// can run without any peers at all.
+func staticPeersGiven(flagset *flag.FlagSet) (given bool) {
+	flagset.Visit(func(f *flag.Flag) {
+		if f.Name == "cluster.static-peers" || f.Name == "cluster.static-peers-file" {
+			given = true
+		}
+	})
+	return given
+}
+
+// loadStaticPeers parses the comma-separated static peers in list, and those
+// in the file, if it isn't empty, one per line. Blank lines, and lines that
+// start with #, are ignored.
+func loadStaticPeers(list, filename string) ([]cluster.StaticPeer, error) {
+	var specs []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			specs = append(specs, s)
+		}
+	}
+	if filename != "" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading -cluster.static-peers-file")
+		}
+		defer f.Close()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			if line := strings.TrimSpace(s.Text()); line != "" && !strings.HasPrefix(line, "#") {
+				specs = append(specs, line)
+			}
+		}
+		if err := s.Err(); err != nil {
+			return nil, errors.Wrap(err, "reading -cluster.static-peers-file")
+		}
+	}
+	peers := make([]cluster.StaticPeer, 0, len(specs))
+	for _, spec := range specs {
+		p, err := cluster.ParseStaticPeer(spec)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+// reloadStaticPeers reloads the static peers on SIGHUP, until canceled. If
+// they can't be loaded, the last peers are kept.
+func reloadStaticPeers(peer *cluster.Peer, list, filename string, cancel <-chan struct{}, logger log.Logger) error {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+	for {
+		select {
+		case <-c:
+			peers, err := loadStaticPeers(list, filename)
+			if err != nil {
+				level.Warn(logger).Log("static_peers", "reload", "err", err)
+				continue
+			}
+			if err := peer.SetStaticPeers(peers); err != nil {
+				return err
+			}
+			level.Info(logger).Log("static_peers", "reload", "n", len(peers))
+		case <-cancel:
+			return nil
+		}
+	}
+}
+
+// staticHealthClient returns the client for health checks of static peers,
+// over TLS if config is non-nil, and with the auth token, if it isn't empty.
+func staticHealthClient(config *tls.Config, token string) *http.Client {
+	return &http.Client{
+		Transport: tokenTransport(tlsTransport(&http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSHandshakeTimeout: defaultTLSHandshakeTimeout,
+		}, config), token),
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+func TestStaticPeers(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "oklog-static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// An ingest node and a store node, which know each other only from
+	// their static peers. There's no memberlist at all.
+	var (
+		ingestMux    = http.NewServeMux()
+		storeMux     = http.NewServeMux()
+		ingestServer = httptest.NewServer(ingestMux)
+		storeServer  = httptest.NewServer(storeMux)
+		ingestHost   = strings.TrimPrefix(ingestServer.URL, "http://")
+		storeHost    = strings.TrimPrefix(storeServer.URL, "http://")
+	)
+	defer ingestServer.Close()
+	defer storeServer.Close()
+	registerHealthCheck(ingestMux)
+	registerHealthCheck(storeMux)
+
+	// The store node reads its peers from a file.
+	peersFile := filepath.Join(dir, "peers")
+	if err := ioutil.WriteFile(peersFile, []byte("# the ingest node\ningest="+ingestHost+"\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	storePeers, err := loadStaticPeers("", peersFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ingestPeers, err := loadStaticPeers("store="+storeHost, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ingestPeer := newStaticTestPeer(t, cluster.PeerTypeIngest, ingestHost, ingestPeers)
+	defer ingestPeer.Leave(time.Second)
+	storePeer := newStaticTestPeer(t, cluster.PeerTypeStore, storeHost, storePeers)
+	defer storePeer.Leave(time.Second)
+	if want, have := []string{ingestHost}, storePeer.Current(cluster.PeerTypeIngest); !reflect.DeepEqual(want, have) {
+		t.Fatalf("store node's ingest peers: want %v, have %v", want, have)
+	}
+	if want, have := []string{storeHost}, ingestPeer.Current(cluster.PeerTypeStore); !reflect.DeepEqual(want, have) {
+		t.Fatalf("ingest node's store peers: want %v, have %v", want, have)
+	}
+
+	// The ingest node has a segment of records, waiting to be consumed.
+	ingestLog, err := ingest.NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segment, err := ingestLog.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(segment, "%s topic hello %d\n", ulid.MustNew(ulid.Now(), rand.Reader), i)
+	}
+	if err := segment.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ingestAPI := ingest.NewAPI(
+		ingestPeer, ingestLog, time.Minute, time.Second,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"}),
+	)
+	defer ingestAPI.Stop()
+	ingestMux.Handle("/ingest/", http.StripPrefix("/ingest", ingestAPI))
+
+	// The store node consumes it, and replicates it to itself.
+	storeLog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, store.FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		reporter           = store.LogReporter{Logger: log.NewNopLogger()}
+		replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+		storeAPI           = store.NewAPI(storePeer, storeLog, store.APIConfig{
+			QueryClient:        http.DefaultClient,
+			StreamClient:       http.DefaultClient,
+			ReplicatedSegments: replicatedSegments,
+			ReplicatedBytes:    prometheus.NewCounter(prometheus.CounterOpts{}),
+			Duration:           prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"}),
+			Reporter:           reporter,
+		})
+	)
+	defer storeAPI.Close()
+	storeMux.Handle("/store/", http.StripPrefix("/store", storeAPI))
+	consumer := store.NewConsumer(
+		storePeer, storePeer.APIAddr(), http.DefaultClient,
+		1024, 10*time.Millisecond, 10*time.Millisecond, 1, 0, 0, nil, nil, nil,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		reporter,
+	)
+	go consumer.Run()
+	defer consumer.Stop()
+
+	if !within(5*time.Second, func() bool { return counterValue(replicatedSegments) > 0 }) {
+		t.Fatal("segment was never replicated")
+	}
+	if !within(5*time.Second, func() bool {
+		stats, err := ingestLog.Stats()
+		return err == nil && stats.FlushedSegments == 0 && stats.PendingSegments == 0
+	}) {
+		t.Fatal("segment was never committed")
+	}
+}
+
+func newStaticTestPeer(t *testing.T, typ cluster.PeerType, hostport string, peers []cluster.StaticPeer) *cluster.Peer {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := cluster.NewStaticPeer(host, typ, port, "", nil, peers, staticHealthClient(nil, ""), 50*time.Millisecond, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return peer
+}
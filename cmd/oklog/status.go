@@ -0,0 +1,678 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+func runStatus(args []string) error {
+	if len(args) < 1 {
+		statusUsage()
+		return errors.New("specify a status command")
+	}
+	switch strings.ToLower(args[0]) {
+	case "cluster":
+		return runStatusCluster(args[1:])
+	case "store":
+		return runStatusStore(args[1:])
+	case "lag":
+		return runStatusLag(args[1:])
+	default:
+		statusUsage()
+		return errors.Errorf("unknown status command %q", args[0])
+	}
+}
+
+func statusUsage() {
+	fmt.Fprintf(os.Stderr, "USAGE\n")
+	fmt.Fprintf(os.Stderr, "  oklog status <command> [flags]\n")
+	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(os.Stderr, "COMMANDS\n")
+	fmt.Fprintf(os.Stderr, "  cluster  Each node's view of the cluster, merged, with any disagreements\n")
+	fmt.Fprintf(os.Stderr, "  store    Each store node's segments, disk usage, and compactions\n")
+	fmt.Fprintf(os.Stderr, "  lag      How far behind the store nodes are of each ingest node's segments\n")
+	fmt.Fprintf(os.Stderr, "\n")
+}
+
+// statusFlags are the flags of every status command.
+type statusFlags struct {
+	addrs    stringslice
+	output   *string
+	useTLS   *bool
+	tlsCA    *string
+	tlsCert  *string
+	tlsKey   *string
+	authFile *string
+}
+
+func newStatusFlags(flagset *flag.FlagSet) *statusFlags {
+	f := &statusFlags{}
+	flagset.Var(&f.addrs, "addr", "API address of a node to ask, default localhost:7650 (repeatable)")
+	f.output = flagset.String("output", "table", "table, json, or go-template=<template>, executed with the status")
+	f.useTLS = flagset.Bool("tls", false, "connect to the nodes with TLS")
+	f.tlsCA = flagset.String("tls.ca", "", "CA certificates to verify the nodes with (default system)")
+	f.tlsCert = flagset.String("tls.cert", "", "client certificate to present, for mutual TLS")
+	f.tlsKey = flagset.String("tls.key", "", "client certificate's private key")
+	f.authFile = flagset.String("auth-token-file", "", "file holding the nodes' auth token, if they require one")
+	return f
+}
+
+// statusTimeout bounds each request of a status command, so an unresponsive
+// node is reported, rather than waited on.
+const statusTimeout = 10 * time.Second
+
+// parse returns the format, the client, its URL scheme, and the host:ports
+// of the nodes the flags ask for.
+func (f *statusFlags) parse() (format statusFormat, client *http.Client, scheme string, hostports []string, err error) {
+	format, err = parseStatusFormat(*f.output)
+	if err != nil {
+		return format, nil, "", nil, err
+	}
+	tlsConfig, err := toolTLSConfig(*f.useTLS, *f.tlsCA, *f.tlsCert, *f.tlsKey)
+	if err != nil {
+		return format, nil, "", nil, err
+	}
+	authToken, err := readAuthToken(*f.authFile)
+	if err != nil {
+		return format, nil, "", nil, err
+	}
+	base, scheme := toolClient(tlsConfig, authToken)
+	client = &http.Client{Transport: base.Transport, Timeout: statusTimeout}
+	addrs := f.addrs
+	if len(addrs) <= 0 {
+		addrs = stringslice{"localhost:7650"}
+	}
+	for _, addr := range addrs {
+		_, hostport, _, _, err := parseAddr(addr, defaultAPIPort)
+		if err != nil {
+			return format, nil, "", nil, errors.Wrapf(err, "couldn't parse -addr %s", addr)
+		}
+		hostports = append(hostports, hostport)
+	}
+	return format, client, scheme, hostports, nil
+}
+
+// statusFormat renders a status: as a table, as JSON, or with a template.
+type statusFormat struct {
+	json bool
+	tmpl *template.Template
+}
+
+// tabular is a status that renders itself as a table.
+type tabular interface {
+	writeTable(w io.Writer) error
+}
+
+func parseStatusFormat(output string) (statusFormat, error) {
+	switch {
+	case output == "table":
+		return statusFormat{}, nil
+	case output == "json":
+		return statusFormat{json: true}, nil
+	case strings.HasPrefix(output, "go-template="):
+		tmpl, err := template.New("output").Parse(strings.TrimPrefix(output, "go-template="))
+		if err != nil {
+			return statusFormat{}, errors.Wrap(err, "couldn't parse -output template")
+		}
+		return statusFormat{tmpl: tmpl}, nil
+	default:
+		return statusFormat{}, errors.Errorf("couldn't parse -output (%q): must be table, json, or go-template=<template>", output)
+	}
+}
+
+func (f statusFormat) render(w io.Writer, status tabular) error {
+	switch {
+	case f.json:
+		buf, err := json.MarshalIndent(status, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", buf)
+		return err
+	case f.tmpl != nil:
+		return f.tmpl.Execute(w, status)
+	default:
+		return status.writeTable(w)
+	}
+}
+
+// getJSON decodes the JSON response to a GET of the URL into v.
+func getJSON(client *http.Client, url string, v interface{}) error {
+	found, err := getJSONIfFound(client, url, v)
+	if err == nil && !found {
+		err = errors.Errorf("%s: %d %s", url, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+	}
+	return err
+}
+
+// getJSONIfFound is getJSON, but returns false, not an error, if the URL isn't
+// found, e.g. as the node isn't of the type that serves it.
+func getJSONIfFound(client *http.Client, url string, v interface{}) (bool, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, errors.Errorf("%s: %s", url, resp.Status)
+	}
+	return true, errors.Wrap(json.NewDecoder(resp.Body).Decode(v), url)
+}
+
+func runStatusCluster(args []string) error {
+	flagset := flag.NewFlagSet("status cluster", flag.ExitOnError)
+	f := newStatusFlags(flagset)
+	flagset.Usage = usageFor(flagset, "oklog status cluster [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	format, client, scheme, hostports, err := f.parse()
+	if err != nil {
+		return err
+	}
+
+	views := make([]clusterView, len(hostports))
+	for i, hostport := range hostports {
+		views[i].Addr = hostport
+		if err := getJSON(client, scheme+"://"+hostport+"/cluster"+cluster.APIPathState, &views[i].Peers); err != nil {
+			views[i].Error = err.Error()
+		}
+	}
+	status := mergeClusterViews(views)
+	if err := format.render(os.Stdout, status); err != nil {
+		return err
+	}
+	if status.unreachable() {
+		return errors.New("no node could be asked")
+	}
+	return nil
+}
+
+// clusterView is a node's view of the cluster.
+type clusterView struct {
+	Addr  string              `json:"addr"`
+	Peers []cluster.PeerState `json:"peers,omitempty"`
+	Error string              `json:"error,omitempty"`
+}
+
+// clusterStatus is the cluster, as its nodes see it, merged. Fields the views
+// disagree on list every value, in the order of the views, and the
+// disagreement is described.
+type clusterStatus struct {
+	Peers         []clusterPeerStatus `json:"peers"`
+	Views         []clusterView       `json:"views"`
+	Disagreements []string            `json:"disagreements,omitempty"`
+}
+
+// clusterPeerStatus is a peer, as the views see it. Skew is its clock offset,
+// as the first view that's probed it sees it. Breakers lists the views whose
+// breakers of it aren't closed. Seen counts the views it's in.
+type clusterPeerStatus struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	State    string   `json:"state"`
+	Zone     string   `json:"zone,omitempty"`
+	Version  string   `json:"version,omitempty"`
+	Skew     string   `json:"skew,omitempty"`
+	API      string   `json:"api"`
+	Breakers []string `json:"breakers,omitempty"`
+	Seen     int      `json:"seen"`
+}
+
+// mergeClusterViews merges the views that could be had into one status.
+func mergeClusterViews(views []clusterView) clusterStatus {
+	var (
+		names = map[string]bool{}
+		seen  []clusterView // the views we have
+	)
+	for _, v := range views {
+		if v.Error != "" {
+			continue
+		}
+		seen = append(seen, v)
+		for _, p := range v.Peers {
+			names[p.Name] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	status := clusterStatus{Peers: []clusterPeerStatus{}, Views: views}
+	for _, name := range sorted {
+		var (
+			ps      = clusterPeerStatus{Name: name}
+			fields  = map[string]*disagreement{}
+			missing []string
+		)
+		for _, v := range seen {
+			p, ok := findPeer(v.Peers, name)
+			if !ok {
+				missing = append(missing, v.Addr)
+				continue
+			}
+			ps.Seen++
+			if ps.Skew == "" {
+				ps.Skew = p.ClockOffset
+			}
+			if p.Breaker != "" && p.Breaker != "closed" {
+				ps.Breakers = append(ps.Breakers, fmt.Sprintf("%s at %s", p.Breaker, v.Addr))
+			}
+			for _, field := range []struct {
+				name, value string
+			}{
+				{"type", string(p.Type)},
+				{"state", p.State},
+				{"zone", p.Zone},
+				{"version", p.Version},
+				{"api", fmt.Sprintf("%s:%d", p.APIAddr, p.APIPort)},
+			} {
+				if fields[field.name] == nil {
+					fields[field.name] = &disagreement{}
+				}
+				fields[field.name].add(field.value, v.Addr)
+			}
+		}
+		ps.Type, ps.State, ps.Zone = fields["type"].String(), fields["state"].String(), fields["zone"].String()
+		ps.Version, ps.API = fields["version"].String(), fields["api"].String()
+		status.Peers = append(status.Peers, ps)
+
+		if len(missing) > 0 {
+			status.Disagreements = append(status.Disagreements, fmt.Sprintf("%s: not seen by %s", name, strings.Join(missing, ", ")))
+		}
+		for _, field := range []string{"type", "state", "zone", "version", "api"} {
+			if d := fields[field]; len(d.values) > 1 {
+				status.Disagreements = append(status.Disagreements, fmt.Sprintf("%s: %s %s", name, field, d.describe()))
+			}
+		}
+	}
+	return status
+}
+
+func findPeer(peers []cluster.PeerState, name string) (cluster.PeerState, bool) {
+	for _, p := range peers {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return cluster.PeerState{}, false
+}
+
+// disagreement collects the values views have for a field of a peer, and
+// which views have each, in the order they're added.
+type disagreement struct {
+	values []string
+	addrs  map[string][]string
+}
+
+func (d *disagreement) add(value, addr string) {
+	if d.addrs == nil {
+		d.addrs = map[string][]string{}
+	}
+	if _, ok := d.addrs[value]; !ok {
+		d.values = append(d.values, value)
+	}
+	d.addrs[value] = append(d.addrs[value], addr)
+}
+
+func (d *disagreement) String() string {
+	return strings.Join(d.values, "/")
+}
+
+func (d *disagreement) describe() string {
+	var parts []string
+	for _, value := range d.values {
+		if value == "" {
+			value = `""`
+		}
+		parts = append(parts, fmt.Sprintf("%s at %s", value, strings.Join(d.addrs[value], ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// unreachable reports whether no view could be had.
+func (s clusterStatus) unreachable() bool {
+	for _, v := range s.Views {
+		if v.Error == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (s clusterStatus) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(tw, "NAME\tTYPE\tSTATE\tZONE\tVERSION\tSKEW\tAPI\tBREAKERS\tSEEN\n")
+	for _, p := range s.Peers {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d/%d\n",
+			p.Name, dash(p.Type), dash(p.State), dash(p.Zone), dash(p.Version), dash(p.Skew), p.API, dash(strings.Join(p.Breakers, ", ")), p.Seen, len(s.Views)-len(s.errors()),
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	writeSection(w, "DISAGREEMENTS", s.Disagreements)
+	writeSection(w, "ERRORS", s.errors())
+	return nil
+}
+
+func (s clusterStatus) errors() []string {
+	var errs []string
+	for _, v := range s.Views {
+		if v.Error != "" {
+			errs = append(errs, fmt.Sprintf("%s: %s", v.Addr, v.Error))
+		}
+	}
+	return errs
+}
+
+func runStatusStore(args []string) error {
+	flagset := flag.NewFlagSet("status store", flag.ExitOnError)
+	f := newStatusFlags(flagset)
+	flagset.Usage = usageFor(flagset, "oklog status store [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	format, client, scheme, hostports, err := f.parse()
+	if err != nil {
+		return err
+	}
+
+	status := storeStatus{Nodes: make([]storeNodeStatus, len(hostports))}
+	for i, hostport := range hostports {
+		n := &status.Nodes[i]
+		n.Addr = hostport
+		base := scheme + "://" + hostport + "/store"
+		if err := getJSON(client, base+store.APIPathStatus, &n.Disk); err != nil {
+			n.Error = err.Error()
+			continue
+		}
+		if err := getJSON(client, base+store.APIPathCompact, &n.Compaction); err != nil {
+			n.Error = err.Error()
+			continue
+		}
+		status.Total.add(n)
+	}
+	if err := format.render(os.Stdout, status); err != nil {
+		return err
+	}
+	if status.Total.Nodes == 0 {
+		return errors.New("no node could be asked")
+	}
+	return nil
+}
+
+// storeStatus is the status of each store node asked, and their total.
+type storeStatus struct {
+	Nodes []storeNodeStatus `json:"nodes"`
+	Total storeTotal        `json:"total"`
+}
+
+// storeNodeStatus is a store node's disk usage, and compactions.
+type storeNodeStatus struct {
+	Addr       string              `json:"addr"`
+	Disk       store.DiskUsage     `json:"disk"`
+	Compaction store.CompactStatus `json:"compaction"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// storeTotal sums the nodes that answered.
+type storeTotal struct {
+	Nodes          int   `json:"nodes"`
+	Segments       int64 `json:"segments"`
+	SegmentBytes   int64 `json:"segment_bytes"`
+	TrashSegments  int64 `json:"trash_segments"`
+	TrashBytes     int64 `json:"trash_bytes"`
+	CapacityBytes  int64 `json:"capacity_bytes"`
+	AvailableBytes int64 `json:"available_bytes"`
+	Running        int   `json:"running"`
+	Queued         int   `json:"queued"`
+}
+
+func (t *storeTotal) add(n *storeNodeStatus) {
+	t.Nodes++
+	t.Segments += n.Disk.Segments
+	t.SegmentBytes += n.Disk.SegmentBytes
+	t.TrashSegments += n.Disk.TrashSegments
+	t.TrashBytes += n.Disk.TrashBytes
+	t.CapacityBytes += n.Disk.CapacityBytes
+	t.AvailableBytes += n.Disk.AvailableBytes
+	t.Running += n.Compaction.Running
+	t.Queued += n.Compaction.Queued
+}
+
+func (s storeStatus) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(tw, "ADDR\tSEGMENTS\tBYTES\tTRASH\tTRASH-BYTES\tAVAILABLE\tCAPACITY\tDISK\tCOMPACTING\tQUEUED\tPAUSED\n")
+	var errs []string
+	for _, n := range s.Nodes {
+		if n.Error != "" {
+			errs = append(errs, fmt.Sprintf("%s: %s", n.Addr, n.Error))
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%s\t%s\t%s\t%s\t%d/%d\t%d\t%t\n",
+			n.Addr, n.Disk.Segments, formatBytes(n.Disk.SegmentBytes), n.Disk.TrashSegments, formatBytes(n.Disk.TrashBytes),
+			formatBytes(n.Disk.AvailableBytes), formatBytes(n.Disk.CapacityBytes), n.Disk.Level,
+			n.Compaction.Running, n.Compaction.Concurrency, n.Compaction.Queued, n.Compaction.Paused,
+		)
+	}
+	if s.Total.Nodes > 1 {
+		t := s.Total
+		fmt.Fprintf(tw, "TOTAL\t%d\t%s\t%d\t%s\t%s\t%s\t-\t%d\t%d\t-\n",
+			t.Segments, formatBytes(t.SegmentBytes), t.TrashSegments, formatBytes(t.TrashBytes),
+			formatBytes(t.AvailableBytes), formatBytes(t.CapacityBytes), t.Running, t.Queued,
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	writeSection(w, "ERRORS", errs)
+	return nil
+}
+
+func runStatusLag(args []string) error {
+	flagset := flag.NewFlagSet("status lag", flag.ExitOnError)
+	f := newStatusFlags(flagset)
+	flagset.Usage = usageFor(flagset, "oklog status lag [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	format, client, scheme, hostports, err := f.parse()
+	if err != nil {
+		return err
+	}
+
+	status := lagStatus{Nodes: make([]lagNodeStatus, len(hostports))}
+	for i, hostport := range hostports {
+		status.Nodes[i] = getLag(client, scheme+"://"+hostport, hostport)
+	}
+	status.total()
+	if err := format.render(os.Stdout, status); err != nil {
+		return err
+	}
+	if status.Total.Nodes == 0 {
+		return errors.New("no node could be asked")
+	}
+	return nil
+}
+
+// getLag asks the node at the base URL for its lag, as an ingest node, a
+// store node, or both.
+func getLag(client *http.Client, base, addr string) lagNodeStatus {
+	var (
+		n          = lagNodeStatus{Addr: addr}
+		ingestLag  ingest.Lag
+		consumeLag store.ConsumeLag
+	)
+	if found, err := getJSONIfFound(client, base+"/ingest"+ingest.APIPathLag, &ingestLag); err != nil {
+		n.Error = err.Error()
+		return n
+	} else if found {
+		n.Ingest = &ingestLag
+	}
+	if found, err := getJSONIfFound(client, base+"/store"+store.APIPathLag, &consumeLag); err != nil {
+		n.Error = err.Error()
+		return n
+	} else if found {
+		n.Store = &consumeLag
+	}
+	if n.Ingest == nil && n.Store == nil {
+		n.Error = "neither an ingest nor a store node"
+	}
+	return n
+}
+
+// lagStatus is how far behind each node asked is, and the total, across them.
+type lagStatus struct {
+	Nodes []lagNodeStatus `json:"nodes"`
+	Total lagTotal        `json:"total"`
+}
+
+// lagNodeStatus is an ingest node's lag, as the consumers of its segments
+// are behind, and a store node's, of each ingest node it consumes. A node of
+// both types has both.
+type lagNodeStatus struct {
+	Addr   string            `json:"addr"`
+	Ingest *ingest.Lag       `json:"ingest,omitempty"`
+	Store  *store.ConsumeLag `json:"store,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// lagTotal sums the unconsumed segments of the ingest nodes that answered,
+// and the pending segments of the store nodes. LagSeconds is the greatest
+// ingest node's.
+type lagTotal struct {
+	Nodes           int     `json:"nodes"`
+	Segments        int64   `json:"segments"`
+	Bytes           int64   `json:"bytes"`
+	LagSeconds      float64 `json:"lag_seconds"`
+	PendingSegments int     `json:"pending_segments"`
+}
+
+func (s *lagStatus) total() {
+	s.Total = lagTotal{}
+	for _, n := range s.Nodes {
+		if n.Error != "" {
+			continue
+		}
+		s.Total.Nodes++
+		if n.Ingest != nil {
+			s.Total.Segments += n.Ingest.Segments
+			s.Total.Bytes += n.Ingest.Bytes
+			if n.Ingest.LagSeconds > s.Total.LagSeconds {
+				s.Total.LagSeconds = n.Ingest.LagSeconds
+			}
+		}
+		if n.Store != nil {
+			for _, l := range n.Store.Ingesters {
+				s.Total.PendingSegments += l.PendingSegments
+			}
+		}
+	}
+}
+
+func (s lagStatus) writeTable(w io.Writer) error {
+	var (
+		tw   = tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+		errs []string
+	)
+	fmt.Fprintf(tw, "INGEST\tSEGMENTS\tBYTES\tOLDEST\tLAG\n")
+	for _, n := range s.Nodes {
+		if n.Error != "" {
+			errs = append(errs, fmt.Sprintf("%s: %s", n.Addr, n.Error))
+			continue
+		}
+		if l := n.Ingest; l != nil {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", n.Addr, l.Segments, formatBytes(l.Bytes), formatTime(l.Oldest), formatSeconds(l.LagSeconds))
+		}
+	}
+	if t := s.Total; t.Nodes > 1 {
+		fmt.Fprintf(tw, "TOTAL\t%d\t%s\t-\t%s\n", t.Segments, formatBytes(t.Bytes), formatSeconds(t.LagSeconds))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n")
+	tw = tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(tw, "STORE\tINGESTER\tLAG\tPENDING\tLAST-COMMIT\n")
+	for _, n := range s.Nodes {
+		if n.Error != "" || n.Store == nil {
+			continue
+		}
+		for _, l := range n.Store.Ingesters {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", n.Addr, l.Ingester, formatSeconds(l.LagSeconds), l.PendingSegments, formatTime(l.LastCommit))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	writeSection(w, "ERRORS", errs)
+	return nil
+}
+
+// formatSeconds formats the seconds as a duration, to the second.
+func formatSeconds(seconds float64) string {
+	return (time.Duration(seconds*float64(time.Second)) / time.Second * time.Second).String()
+}
+
+// formatTime formats the time in RFC3339, in UTC, or as a dash, if it's zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// writeSection writes the lines under the heading, after a blank line, if
+// there are any.
+func writeSection(w io.Writer, heading string, lines []string) {
+	if len(lines) <= 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s\n", heading)
+	for _, line := range lines {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatBytes formats n bytes in the largest binary unit that leaves an
+// integer part, with one decimal.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// golden compares have to the named golden file in testdata, or, with
+// -update, writes it.
+func golden(t *testing.T, name string, have []byte) {
+	t.Helper()
+	filename := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(filename, have, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, have) {
+		t.Errorf("%s: want\n%s\nhave\n%s", filename, want, have)
+	}
+}
+
+func testClusterViews() []clusterView {
+	var (
+		ingest = cluster.PeerState{Name: "ingest-1", APIAddr: "10.0.0.1", APIPort: 7650, Type: cluster.PeerTypeIngest, State: "alive", Zone: "a", Version: "v0.3.0"}
+		store1 = cluster.PeerState{Name: "store-1", APIAddr: "10.0.0.2", APIPort: 7650, Type: cluster.PeerTypeStore, State: "alive", Zone: "a", Version: "v0.3.0", ClockOffset: "1.5ms"}
+		store2 = cluster.PeerState{Name: "store-2", APIAddr: "10.0.0.3", APIPort: 7650, Type: cluster.PeerTypeStore, State: "alive", Zone: "b", Version: "v0.3.0"}
+	)
+	suspect := store2
+	suspect.State, suspect.Breaker = "suspect", "open"
+	return []clusterView{
+		{Addr: "10.0.0.1:7650", Peers: []cluster.PeerState{ingest, store1, store2}},
+		{Addr: "10.0.0.2:7650", Peers: []cluster.PeerState{ingest, store1, suspect}},
+		{Addr: "10.0.0.3:7650", Peers: []cluster.PeerState{store1, store2}},
+		{Addr: "10.0.0.4:7650", Error: "connection refused"},
+	}
+}
+
+func TestClusterStatusTable(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := mergeClusterViews(testClusterViews()).writeTable(&buf); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "status_cluster", buf.Bytes())
+}
+
+func TestMergeClusterViews(t *testing.T) {
+	t.Parallel()
+
+	status := mergeClusterViews(testClusterViews())
+	if want, have := 3, len(status.Peers); want != have {
+		t.Fatalf("want %d peers, have %d", want, have)
+	}
+	for _, testcase := range []struct {
+		peer     int
+		name     string
+		state    string
+		breakers string
+		seen     int
+	}{
+		{0, "ingest-1", "alive", "", 2},
+		{1, "store-1", "alive", "", 3},
+		{2, "store-2", "alive/suspect", "open at 10.0.0.2:7650", 3},
+	} {
+		p := status.Peers[testcase.peer]
+		if want, have := testcase.name, p.Name; want != have {
+			t.Errorf("peer %d: want name %q, have %q", testcase.peer, want, have)
+		}
+		if want, have := testcase.state, p.State; want != have {
+			t.Errorf("%s: want state %q, have %q", p.Name, want, have)
+		}
+		if want, have := testcase.breakers, strings.Join(p.Breakers, ", "); want != have {
+			t.Errorf("%s: want breakers %q, have %q", p.Name, want, have)
+		}
+		if want, have := testcase.seen, p.Seen; want != have {
+			t.Errorf("%s: want seen %d, have %d", p.Name, want, have)
+		}
+	}
+	want := []string{
+		"ingest-1: not seen by 10.0.0.3:7650",
+		"store-2: state alive at 10.0.0.1:7650, 10.0.0.3:7650; suspect at 10.0.0.2:7650",
+	}
+	if have := status.Disagreements; strings.Join(want, "\n") != strings.Join(have, "\n") {
+		t.Errorf("want disagreements %q, have %q", want, have)
+	}
+	if status.unreachable() {
+		t.Errorf("want reachable, have unreachable")
+	}
+	if !mergeClusterViews([]clusterView{{Addr: "x", Error: "down"}}).unreachable() {
+		t.Errorf("want unreachable, have reachable")
+	}
+}
+
+func TestStoreStatusTable(t *testing.T) {
+	t.Parallel()
+
+	status := storeStatus{Nodes: []storeNodeStatus{
+		{
+			Addr:       "10.0.0.2:7650",
+			Disk:       store.DiskUsage{Segments: 120, SegmentBytes: 3 << 30, TrashSegments: 4, TrashBytes: 96 << 20, CapacityBytes: 100 << 30, AvailableBytes: 60 << 30, Level: store.DiskOK},
+			Compaction: store.CompactStatus{Running: 1, Queued: 3, Concurrency: 2},
+		},
+		{
+			Addr:       "10.0.0.3:7650",
+			Disk:       store.DiskUsage{Segments: 80, SegmentBytes: 2 << 30, CapacityBytes: 100 << 30, AvailableBytes: 9 << 30, Level: store.DiskHigh},
+			Compaction: store.CompactStatus{Paused: true, Concurrency: 2},
+		},
+		{
+			Addr:  "10.0.0.4:7650",
+			Error: "connection refused",
+		},
+	}}
+	for i := range status.Nodes {
+		if status.Nodes[i].Error == "" {
+			status.Total.add(&status.Nodes[i])
+		}
+	}
+	var buf bytes.Buffer
+	if err := status.writeTable(&buf); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "status_store", buf.Bytes())
+}
+
+func TestLagStatus(t *testing.T) {
+	t.Parallel()
+
+	// An ingest node with a backlog, a store node consuming it, a node of
+	// both types, idle, and one that's neither.
+	var (
+		oldest     = time.Date(2017, 3, 14, 15, 0, 0, 0, time.UTC)
+		lastCommit = time.Date(2017, 3, 14, 16, 0, 0, 0, time.UTC)
+		handlers   = []map[string]interface{}{
+			{"/ingest" + ingest.APIPathLag: ingest.Lag{Segments: 12, Bytes: 3 << 20, Oldest: oldest, LagSeconds: 90.5}},
+			{"/store" + store.APIPathLag: store.ConsumeLag{Ingesters: []store.IngesterLag{
+				{Ingester: "10.0.0.1:7650", LagSeconds: 88, PendingSegments: 2, LastCommit: lastCommit},
+				{Ingester: "10.0.0.3:7650"},
+			}}},
+			{
+				"/ingest" + ingest.APIPathLag: ingest.Lag{},
+				"/store" + store.APIPathLag:   store.ConsumeLag{Ingesters: []store.IngesterLag{{Ingester: "10.0.0.1:7650", LagSeconds: 61, PendingSegments: 1}}},
+			},
+			{},
+		}
+		status = lagStatus{Nodes: make([]lagNodeStatus, len(handlers))}
+	)
+	for i, paths := range handlers {
+		paths := paths
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			v, ok := paths[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(v)
+		}))
+		defer server.Close()
+		status.Nodes[i] = getLag(http.DefaultClient, server.URL, fmt.Sprintf("10.0.0.%d:7650", i+1))
+	}
+	status.total()
+	if want, have := (lagTotal{Nodes: 3, Segments: 12, Bytes: 3 << 20, LagSeconds: 90.5, PendingSegments: 3}), status.Total; want != have {
+		t.Errorf("total: want %+v, have %+v", want, have)
+	}
+	var buf bytes.Buffer
+	if err := status.writeTable(&buf); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "status_lag", buf.Bytes())
+}
+
+func TestParseStatusFormat(t *testing.T) {
+	t.Parallel()
+
+	status := storeStatus{Nodes: []storeNodeStatus{}, Total: storeTotal{Nodes: 2, Segments: 7}}
+	for _, testcase := range []struct {
+		output string
+		want   string // rendered, or the error
+	}{
+		{"json", "{\n    \"nodes\": [],\n    \"total\": {\n        \"nodes\": 2,\n        \"segments\": 7,"},
+		{"go-template={{.Total.Segments}} segments", "7 segments"},
+		{"go-template={{.Total", "couldn't parse -output template"},
+		{"yaml", "must be table, json, or go-template"},
+	} {
+		format, err := parseStatusFormat(testcase.output)
+		if err != nil {
+			if !strings.Contains(err.Error(), testcase.want) {
+				t.Errorf("%s: want error with %q, have %v", testcase.output, testcase.want, err)
+			}
+			continue
+		}
+		var buf bytes.Buffer
+		if err := format.render(&buf, status); err != nil {
+			t.Errorf("%s: %v", testcase.output, err)
+			continue
+		}
+		if have := buf.String(); !strings.HasPrefix(have, testcase.want) {
+			t.Errorf("%s: want %q, have %q", testcase.output, testcase.want, have)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+
+	for n, want := range map[int64]string{
+		0:             "0B",
+		1023:          "1023B",
+		1024:          "1.0KiB",
+		1536:          "1.5KiB",
+		3 << 30:       "3.0GiB",
+		5<<40 + 1<<39: "5.5TiB",
+	} {
+		if have := formatBytes(n); want != have {
+			t.Errorf("%d: want %q, have %q", n, want, have)
+		}
+	}
+}
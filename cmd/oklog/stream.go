@@ -1,16 +1,22 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/oklog/oklog/pkg/cluster"
 	"github.com/oklog/oklog/pkg/group"
+	"github.com/oklog/oklog/pkg/record"
 	"github.com/oklog/oklog/pkg/store"
+	"github.com/oklog/oklog/pkg/stream"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 )
@@ -21,9 +27,22 @@ func runStream(args []string) error {
 		storeAddr = flagset.String("store", "localhost:7650", "address of store instance to query")
 		q         = flagset.String("q", "", "query expression")
 		regex     = flagset.Bool("regex", false, "parse -q as regular expression")
-		window    = flagset.Duration("window", 3*time.Second, "deduplication window")
+		window    = flagset.Duration("window", stream.DefaultDedupeWindow, "deduplication window")
 		withulid  = flagset.Bool("ulid", false, "include ULID prefix with each record")
+		since     = flagset.String("since", "", "resume after this ULID, replaying missed records")
+		topic     = flagset.String("topic", "", "only stream records of this topic (default all topics)")
+		sample    = flagset.Float64("sample", 0, "stream about this fraction of records, e.g. 0.01 (default all)")
+		useTLS    = flagset.Bool("tls", false, "connect to the store with TLS")
+		tlsCA     = flagset.String("tls.ca", "", "CA certificates to verify the store with (default system)")
+		tlsCert   = flagset.String("tls.cert", "", "client certificate to present, for mutual TLS")
+		tlsKey    = flagset.String("tls.key", "", "client certificate's private key")
+		authFile  = flagset.String("auth-token-file", "", "file holding the store's auth token, if it requires one")
+		byCluster = flagset.Bool("cluster-label", false, "with -cluster, label each record with its cluster's name, after its ULID")
+		origin    = flagset.Bool("show-origin", false, "annotate each record with the store node, and segment, it was read from, after its ULID")
+		traceDir  = flagset.String("trace-dir", "", "stream from each store node, rather than via -store, recording what each sends to a trace file in this directory, for oklog replay")
+		clusters  = stringslice{}
 	)
+	flagset.Var(&clusters, "cluster", "name=host:port of a store instance of another cluster to stream, and merge, instead of -store (repeatable)")
 	flagset.Usage = usageFor(flagset, "oklog stream [flags]")
 	if err := flagset.Parse(args); err != nil {
 		return err
@@ -33,30 +52,111 @@ func runStream(args []string) error {
 	if err != nil {
 		return errors.Wrap(err, "couldn't parse -store")
 	}
+	tlsConfig, err := toolTLSConfig(*useTLS, *tlsCA, *tlsCert, *tlsKey)
+	if err != nil {
+		return err
+	}
+	authToken, err := readAuthToken(*authFile)
+	if err != nil {
+		return err
+	}
+	client, scheme := toolClient(tlsConfig, authToken)
+	if *window <= 0 {
+		return errors.Wrap(stream.ErrInvalidWindow, "couldn't parse -window")
+	}
 
 	var asRegex string
 	if *regex {
 		asRegex = "&regex=true"
 	}
 
+	var asOrigin string
+	if *origin {
+		asOrigin = "&annotate=origin"
+	}
+
+	var asSince string
+	if *since != "" {
+		id, err := ulid.Parse(*since)
+		if err != nil {
+			return errors.Wrap(err, "couldn't parse -since")
+		}
+		asSince = "&since=" + id.String()
+	}
+
+	var asTopic string
+	if *topic != "" {
+		if !record.IsValidTopic([]byte(*topic)) {
+			return errors.Wrap(record.ErrIllegalTopicName, "couldn't parse -topic")
+		}
+		asTopic = "&topic=" + url.QueryEscape(*topic)
+	}
+
+	var asSample string
+	if *sample < 0 || *sample > 1 {
+		return errors.New("couldn't parse -sample: must be between 0 and 1")
+	}
+	if *sample > 0 {
+		asSample = "&sample=" + strconv.FormatFloat(*sample, 'g', -1, 64)
+	}
+
 	var offset = ulid.EncodedSize + 1
 	if *withulid {
 		offset = 0
 	}
 
+	if *traceDir != "" {
+		if len(clusters) > 0 {
+			return errors.New("-trace-dir can't trace -cluster streams")
+		}
+		params, err := url.ParseQuery(fmt.Sprintf(
+			"q=%s%s%s%s",
+			url.QueryEscape(*q),
+			asRegex,
+			asOrigin,
+			asSample,
+		))
+		if err != nil {
+			return err
+		}
+		return streamTraced(os.Stdout, os.Stderr, client, scheme, hostport, params, *since, *topic, *window, *traceDir, offset)
+	}
+
+	if len(clusters) > 0 {
+		params, err := url.ParseQuery(fmt.Sprintf(
+			"q=%s&window=%s%s%s%s%s%s",
+			url.QueryEscape(*q),
+			url.QueryEscape(window.String()),
+			asRegex,
+			asOrigin,
+			asSince,
+			asTopic,
+			asSample,
+		))
+		if err != nil {
+			return err
+		}
+		return streamClusters(os.Stdout, os.Stderr, clusters, client, scheme, params, *window, *byCluster, offset)
+	}
+
 	req, err := http.NewRequest("GET", fmt.Sprintf(
-		"http://%s/store%s?q=%s&window=%s%s",
+		"%s://%s/store%s?q=%s&window=%s&errors=true%s%s%s%s%s",
+		scheme,
 		hostport,
 		store.APIPathUserStream,
 		url.QueryEscape(*q),
 		url.QueryEscape(window.String()),
 		asRegex,
+		asOrigin,
+		asSince,
+		asTopic,
+		asSample,
 	), nil)
 	if err != nil {
 		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -69,9 +169,17 @@ func runStream(args []string) error {
 	var g group.Group
 	{
 		g.Add(func() error {
-			scanner := bufio.NewScanner(resp.Body)
+			scanner := record.NewScanner(resp.Body)
 			for scanner.Scan() {
-				fmt.Fprintf(os.Stdout, "%s\n", scanner.Bytes()[offset:])
+				if len(scanner.Bytes()) == 0 {
+					continue // heartbeat
+				}
+				if scanner.Bytes()[0] == '#' {
+					fmt.Fprintf(os.Stderr, "%s\n", scanner.Bytes()) // peer error
+					continue
+				}
+				b := scanner.Bytes()
+				fmt.Fprintf(os.Stdout, "%s%s\n", b[offset:ulid.EncodedSize+1], record.Unescape(b[ulid.EncodedSize+1:]))
 			}
 			return scanner.Err()
 		}, func(error) {
@@ -88,3 +196,113 @@ func runStream(args []string) error {
 	}
 	return g.Run()
 }
+
+// streamTraced streams the records of the store nodes of the cluster of the
+// store at hostport, as the store would, but from each node itself, so that
+// what each sends is recorded, and when, to a trace file in dir, for oklog
+// replay. Records are printed from the offset of their line, and failed
+// connections, which are retried, to stderr, as comments, until it's
+// interrupted.
+func streamTraced(
+	stdout, stderr io.Writer,
+	client *http.Client,
+	scheme, hostport string,
+	params url.Values,
+	since, topic string,
+	window time.Duration,
+	dir string,
+	offset int,
+) error {
+	tracer, err := stream.NewTracer(dir, window)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tracer.Close(); err != nil {
+			fmt.Fprintf(stderr, "trace: %v\n", err)
+		}
+	}()
+
+	// The peers are those the store would stream from.
+	var last []string
+	peerFactory := func() []string {
+		var peers []cluster.PeerState
+		if err := getJSON(client, scheme+"://"+hostport+"/cluster"+cluster.APIPathState, &peers); err != nil {
+			return last // until it answers again
+		}
+		last = streamPeers(peers)
+		return last
+	}
+	readCloserFactory := stream.HTTPReadCloserFactory(client, func(addr string) string {
+		return fmt.Sprintf("%s://%s/store%s?%s", scheme, addr, store.APIPathInternalStream, params.Encode())
+	})
+	errs := make(chan stream.PeerError, 16)
+	options := []stream.ExecuteOption{
+		stream.WithTracer(tracer),
+		stream.WithErrors(errs),
+		stream.WithPeerRefreshInterval(10 * time.Second),
+	}
+	if since != "" {
+		options = append(options, stream.WithSince(ulid.MustParse(since))) // validated by runStream
+	}
+	if topic != "" {
+		options = append(options, stream.WithTopic(topic))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancelInterrupt := make(chan struct{})
+	defer close(cancelInterrupt)
+	interrupted := make(chan error, 1)
+	go func() {
+		interrupted <- interrupt(cancelInterrupt)
+		cancel()
+	}()
+
+	raw := make(chan []byte, 1024)
+	go func() {
+		stream.Execute(ctx, peerFactory, readCloserFactory, time.Sleep, time.NewTicker, raw, options...)
+		close(raw)
+	}()
+	deduplicated := make(chan []byte, 1024)
+	go func() {
+		stream.Deduplicate(raw, window, time.NewTicker, deduplicated)
+		close(deduplicated)
+	}()
+	for {
+		select {
+		case b, ok := <-deduplicated:
+			if !ok {
+				return <-interrupted
+			}
+			if len(b) <= ulid.EncodedSize {
+				continue // not a record
+			}
+			fmt.Fprintf(stdout, "%s%s\n", b[offset:ulid.EncodedSize+1], record.Unescape(b[ulid.EncodedSize+1:]))
+		case e := <-errs:
+			fmt.Fprintf(stderr, "# %s peer error: %s\n", e.Time.UTC().Format(time.RFC3339), e.Error())
+		}
+	}
+}
+
+// streamPeers returns the API host:ports of the peers a store streams from:
+// its read-only store nodes, if it has any, or else its store nodes.
+func streamPeers(peers []cluster.PeerState) []string {
+	var stores, readOnly []string
+	for _, p := range peers {
+		if p.State != cluster.PeerStateAlive {
+			continue
+		}
+		hostport := net.JoinHostPort(p.APIAddr, strconv.Itoa(p.APIPort))
+		switch p.Type {
+		case cluster.PeerTypeStore, cluster.PeerTypeIngestStore:
+			stores = append(stores, hostport)
+		case cluster.PeerTypeReadOnlyStore:
+			readOnly = append(readOnly, hostport)
+		}
+	}
+	if len(readOnly) > 0 {
+		return readOnly
+	}
+	return stores
+}
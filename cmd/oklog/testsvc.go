@@ -37,24 +37,7 @@ func runTestService(args []string) error {
 	if recsz <= 0 {
 		return errors.Errorf("with -id %q, minimum -size is %d", *id, presz+1+1)
 	}
-	var (
-		charset = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
-		wordMin = 5
-		wordMax = 20
-		records = make([]string, 10000)
-	)
-	for i := 0; i < len(records); i++ {
-		record := make([]rune, recsz)
-		wordLen := wordMin + rand.Intn(wordMax-wordMin)
-		for j := range record {
-			if (j % wordLen) == (wordLen - 1) {
-				record[j] = ' '
-			} else {
-				record[j] = rune(charset[rand.Intn(len(charset))])
-			}
-		}
-		records[i] = strings.TrimSpace(string(record))
-	}
+	records := randomRecords(10000, recsz)
 
 	// Prepare some statistics.
 	var (
@@ -84,16 +67,7 @@ func runTestService(args []string) error {
 
 	// Emit.
 
-	// Calculate cycle parameters.
-	// If cycles are too short, we never meet our rate target.
-	var (
-		recordsPerCycle = 1
-		timePerCycle    = time.Duration(float64(time.Second) / float64(*rate))
-	)
-	for timePerCycle < 50*time.Millisecond {
-		recordsPerCycle *= 2
-		timePerCycle *= 2
-	}
+	recordsPerCycle, timePerCycle := cycleFor(*rate)
 
 	// Emit!
 	var count int
@@ -122,3 +96,38 @@ func runTestService(args []string) error {
 	}
 	return nil
 }
+
+// randomRecords returns n records of size bytes, of random words.
+func randomRecords(n, size int) []string {
+	var (
+		charset = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+		wordMin = 5
+		wordMax = 20
+		records = make([]string, n)
+	)
+	for i := 0; i < len(records); i++ {
+		record := make([]rune, size)
+		wordLen := wordMin + rand.Intn(wordMax-wordMin)
+		for j := range record {
+			if (j % wordLen) == (wordLen - 1) {
+				record[j] = ' '
+			} else {
+				record[j] = rune(charset[rand.Intn(len(charset))])
+			}
+		}
+		records[i] = strings.TrimSpace(string(record))
+	}
+	return records
+}
+
+// cycleFor returns how many records to emit each cycle, and how long each
+// cycle is, to emit rate records per second. If cycles are too short, we
+// never meet our rate target.
+func cycleFor(rate int) (recordsPerCycle int, timePerCycle time.Duration) {
+	recordsPerCycle, timePerCycle = 1, time.Duration(float64(time.Second)/float64(rate))
+	for timePerCycle < 50*time.Millisecond {
+		recordsPerCycle *= 2
+		timePerCycle *= 2
+	}
+	return recordsPerCycle, timePerCycle
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultTLSHandshakeTimeout = 10 * time.Second
+
+// serverTLSConfig returns the TLS config for a node's listeners, or nil if
+// neither certFile nor keyFile is given. With a clientCAFile, clients must
+// present a certificate signed by one of its CAs, i.e. mutual TLS.
+func serverTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, errors.New("-tls.client-ca requires -tls.cert and -tls.key")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading -tls.cert and -tls.key")
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading -tls.client-ca")
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// clientTLSConfig returns the TLS config for connections to nodes. Their
+// certificates are verified against the CAs in caFile, or the system's if it's
+// empty. With a certFile and keyFile, that certificate is presented to nodes
+// that ask for one.
+func clientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading -tls.ca")
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading -tls.cert and -tls.key")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// toolTLSConfig returns the TLS config for the forward, query, and stream
+// commands, or nil if they shouldn't use TLS. Any of the files implies TLS.
+func toolTLSConfig(enabled bool, caFile, certFile, keyFile string) (*tls.Config, error) {
+	if !enabled && caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	return clientTLSConfig(caFile, certFile, keyFile)
+}
+
+// toolClient returns the HTTP client, and URL scheme, for the query and
+// stream commands to talk to store nodes, with TLS if config is non-nil, and
+// the auth token, if it isn't empty.
+func toolClient(config *tls.Config, token string) (client *http.Client, scheme string) {
+	scheme = "http"
+	if config != nil {
+		scheme = "https"
+	}
+	if config == nil && token == "" {
+		return http.DefaultClient, scheme
+	}
+	return &http.Client{
+		Transport: tokenTransport(&http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     config,
+			TLSHandshakeTimeout: defaultTLSHandshakeTimeout,
+		}, token),
+	}, scheme
+}
+
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(buf) {
+		return nil, errors.Errorf("%s: no PEM encoded certificates", filename)
+	}
+	return pool, nil
+}
+
+// tlsListener serves TLS on ln, if config is non-nil.
+func tlsListener(ln net.Listener, config *tls.Config) net.Listener {
+	if config == nil {
+		return ln
+	}
+	return tls.NewListener(ln, config)
+}
+
+// tlsTransport configures t to make requests to nodes over TLS, if config is
+// non-nil. Nodes turn each other's addresses into http URLs; with TLS, every
+// node in the cluster serves https instead, so the URLs are upgraded.
+func tlsTransport(t *http.Transport, config *tls.Config) http.RoundTripper {
+	if config == nil {
+		return t
+	}
+	t.TLSClientConfig = config
+	return httpsTransport{t}
+}
+
+type httpsTransport struct{ next http.RoundTripper }
+
+func (t httpsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		u := *req.URL
+		u.Scheme = "https"
+		r := *req // RoundTrippers mustn't modify the request
+		r.URL = &u
+		req = &r
+	}
+	return t.next.RoundTrip(req)
+}
+
+// dialIngest connects to an ingest node, with TLS if config is non-nil. The
+// handshake is complete before dialIngest returns, so a node that isn't
+// serving TLS is an error after the timeout, rather than a hang.
+func dialIngest(network, address string, config *tls.Config, timeout time.Duration) (net.Conn, error) {
+	if config == nil {
+		return net.Dial(network, address)
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, network, address, config)
+	if err, ok := err.(net.Error); ok && err.Timeout() {
+		return nil, errors.Wrap(err, "TLS handshake timed out; is the ingest node serving TLS?")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "TLS")
+	}
+	return conn, nil
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/store"
+	"github.com/oklog/oklog/pkg/stream"
+)
+
+func TestForwardTLS(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "oklog-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certs := writeTestCerts(t, dir)
+
+	serverTLS, err := serverTLSConfig(certs.serverCert, certs.serverKey, certs.ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, testcase := range []struct {
+		name      string
+		serverTLS *tls.Config
+		caFile    string
+		certFile  string
+		keyFile   string
+		want      string // dial error substring, if any
+		ingested  bool
+	}{
+		{"mutual TLS", serverTLS, certs.ca, certs.clientCert, certs.clientKey, "", true},
+		{"no client certificate", serverTLS, certs.ca, "", "", "", false},
+		{"unknown CA", serverTLS, certs.otherCA, certs.clientCert, certs.clientKey, "certificate", false},
+		{"plaintext ingest node", nil, certs.ca, certs.clientCert, certs.clientKey, "TLS", false},
+	} {
+		testcase := testcase
+		clientTLS, err := toolTLSConfig(true, testcase.caFile, testcase.certFile, testcase.keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(testcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			ingestLog, err := ingest.NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			records := prometheus.NewCounter(prometheus.CounterOpts{})
+			errc := make(chan error, 1)
+			go func() {
+				errc <- ingest.HandleConnections(tlsListener(ln, testcase.serverTLS), ingest.ConnectionConfig{
+					Handler:          ingest.HandleFastWriter,
+					ReaderFactory:    record.NewDynamicReader,
+					Log:              ingestLog,
+					SegmentFlushAge:  time.Hour,
+					SegmentFlushSize: 1024 * 1024,
+					ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+					Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+					Records:          records,
+					Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+					SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+					SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+				})
+			}()
+
+			conn, err := dialIngest("tcp", ln.Addr().String(), clientTLS, 250*time.Millisecond)
+			if testcase.want != "" {
+				if err == nil || !strings.Contains(err.Error(), testcase.want) {
+					t.Fatalf("want error containing %q, have %v", testcase.want, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The record is written. A rejected client learns about it on
+			// its next read.
+			fmt.Fprintf(conn, "topic hello\n")
+			if testcase.ingested && !within(time.Second, func() bool { return counterValue(records) > 0 }) {
+				t.Fatal("record was never written")
+			}
+			if !testcase.ingested {
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				if _, err := conn.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+					t.Fatalf("want rejection, have %v", err)
+				}
+			}
+
+			// Once the node shuts down, any record is flushed.
+			conn.Close()
+			ln.Close()
+			<-errc
+			stats, err := ingestLog.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 0
+			if testcase.ingested {
+				want = 1
+			}
+			if have := int(stats.FlushedSegments); want != have {
+				t.Fatalf("want %d flushed segments, have %d", want, have)
+			}
+		})
+	}
+}
+
+func TestStreamTLS(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "oklog-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certs := writeTestCerts(t, dir)
+
+	// A store node, serving mutual TLS, which streams from itself over TLS.
+	serverTLS, err := serverTLSConfig(certs.serverCert, certs.serverKey, certs.ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerTLS, err := clientTLSConfig(certs.ca, certs.clientCert, certs.clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filelog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, store.FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		peer               = &hostPeer{}
+		peerClient         = &http.Client{Transport: tlsTransport(&http.Transport{}, peerTLS)}
+		replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+		replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
+		duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+		mux                = http.NewServeMux()
+		api                = store.NewAPI(peer, filelog, store.APIConfig{
+			QueryClient:        peerClient,
+			StreamClient:       peerClient,
+			ReplicatedSegments: replicatedSegments,
+			ReplicatedBytes:    replicatedBytes,
+			Duration:           duration,
+			Reporter:           store.LogReporter{Logger: log.NewNopLogger()},
+		})
+	)
+	defer api.Close()
+	mux.Handle("/store/", http.StripPrefix("/store", api))
+	server := httptest.NewUnstartedServer(mux)
+	server.TLS = serverTLS
+	server.StartTLS()
+	defer server.Close()
+	peer.hostport = strings.TrimPrefix(server.URL, "https://")
+
+	// Clients without TLS, or without a certificate, are refused.
+	if resp, err := http.Get("http://" + peer.hostport + "/store" + store.APIPathUserStream); err != nil {
+		t.Errorf("plaintext: %v", err)
+	} else if want, have := http.StatusBadRequest, resp.StatusCode; want != have {
+		t.Errorf("plaintext: want HTTP %d, have %d", want, have)
+	}
+	noCertTLS, err := toolTLSConfig(true, certs.ca, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noCertClient, _ := toolClient(noCertTLS, "")
+	if _, err := noCertClient.Get("https://" + peer.hostport + "/store" + store.APIPathUserStream); err == nil {
+		t.Errorf("no client certificate: want error, have none")
+	}
+
+	// A client with a certificate streams records as they're replicated.
+	clientTLS, err := toolTLSConfig(true, certs.ca, certs.clientCert, certs.clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, scheme := toolClient(clientTLS, "")
+	rcf := stream.HTTPReadCloserFactory(client, func(addr string) string {
+		return fmt.Sprintf("%s://%s/store%s?window=100ms", scheme, addr, store.APIPathUserStream)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rc, err := rcf(ctx, peer.hostport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	lines := make(chan string)
+	go func() {
+		s := bufio.NewScanner(rc)
+		for s.Scan() {
+			if s.Text() != "" { // skip heartbeats
+				lines <- s.Text()
+			}
+		}
+		close(lines)
+	}()
+
+	// The stream to the node itself may take a moment to connect, so keep
+	// replicating until a record comes through.
+	timeout := time.After(5 * time.Second)
+	for {
+		id := ulid.MustNew(ulid.Now(), rand.Reader)
+		resp, err := client.Post(
+			fmt.Sprintf("%s://%s/store%s", scheme, peer.hostport, store.APIPathReplicate),
+			"application/binary",
+			strings.NewReader(fmt.Sprintf("%s topic hello\n", id)),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want, have := http.StatusOK, resp.StatusCode; want != have {
+			t.Fatalf("replicate: want HTTP %d, have %d", want, have)
+		}
+		select {
+		case line := <-lines:
+			if !strings.HasSuffix(line, " topic hello") {
+				t.Fatalf("unexpected record %q", line)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("timeout waiting for records")
+		}
+	}
+}
+
+type testCerts struct {
+	ca, otherCA           string
+	serverCert, serverKey string
+	clientCert, clientKey string
+}
+
+// writeTestCerts writes a CA, and server and client certificates signed by
+// it, and an unrelated CA, to dir.
+func writeTestCerts(t *testing.T, dir string) testCerts {
+	ca, caKey := newTestCert(t, "ca", nil, nil, true)
+	other, _ := newTestCert(t, "other", nil, nil, true)
+	server, serverKey := newTestCert(t, "server", ca, caKey, false)
+	client, clientKey := newTestCert(t, "client", ca, caKey, false)
+
+	write := func(name, typ string, der []byte) string {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	writeKey := func(name string, key *ecdsa.PrivateKey) string {
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return write(name, "EC PRIVATE KEY", der)
+	}
+	return testCerts{
+		ca:         write("ca.pem", "CERTIFICATE", ca.Raw),
+		otherCA:    write("other.pem", "CERTIFICATE", other.Raw),
+		serverCert: write("server.pem", "CERTIFICATE", server.Raw),
+		serverKey:  writeKey("server-key.pem", serverKey),
+		clientCert: write("client.pem", "CERTIFICATE", client.Raw),
+		clientKey:  writeKey("client-key.pem", clientKey),
+	}
+}
+
+// newTestCert returns a certificate for localhost, signed by parent, or
+// self-signed if parent is nil.
+func newTestCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if isCA {
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func counterValue(c prometheus.Counter) float64 {
+	var m dto.Metric
+	c.Write(&m)
+	return m.GetCounter().GetValue()
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+func within(d time.Duration, f func() bool) bool {
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) {
+		if f() {
+			return true
+		}
+		time.Sleep(d / 10)
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/store"
+	"github.com/oklog/oklog/pkg/ulidutil"
+	"github.com/oklog/ulid"
+)
+
+func runULID(args []string) error {
+	flagset := flag.NewFlagSet("ulid", flag.ExitOnError)
+	flagset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE\n")
+		fmt.Fprintf(os.Stderr, "  oklog ulid inspect <ulid>     time and entropy of a ULID\n")
+		fmt.Fprintf(os.Stderr, "  oklog ulid at <time>          least and greatest ULIDs of a time\n")
+		fmt.Fprintf(os.Stderr, "  oklog ulid range <from> <to>  least and greatest ULIDs from one time to another\n")
+		fmt.Fprintf(os.Stderr, "\n")
+		fmt.Fprintf(os.Stderr, "Times are as for oklog query -from and -to.\n")
+		fmt.Fprintf(os.Stderr, "\n")
+	}
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+	if err := ulidCommand(os.Stdout, flagset.Args(), time.Now()); err != nil {
+		if err == errUsage {
+			flagset.Usage()
+		}
+		return err
+	}
+	return nil
+}
+
+var errUsage = errors.New("bad usage")
+
+// ulidCommand runs the ulid subcommand of args, and writes the result to w.
+// Relative times are resolved against now.
+func ulidCommand(w io.Writer, args []string, now time.Time) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch cmd, args := args[0], args[1:]; {
+	case cmd == "inspect" && len(args) == 1:
+		id, err := ulidutil.Parse(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "ULID     %s\n", id)
+		fmt.Fprintf(w, "Time     %s\n", ulidutil.TimeOf(id).Format(time.RFC3339Nano))
+		fmt.Fprintf(w, "Unix ms  %d\n", id.Time())
+		fmt.Fprintf(w, "Entropy  %s\n", hex.EncodeToString(id.Entropy()))
+		return nil
+
+	case cmd == "at" && len(args) == 1:
+		t, err := parseULIDTime(args[0], now)
+		if err != nil {
+			return err
+		}
+		min, max, err := ulidutil.At(t)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Time  %s\n", ulidutil.TimeOf(min).Format(time.RFC3339Nano))
+		fmt.Fprintf(w, "Min   %s\n", min)
+		fmt.Fprintf(w, "Max   %s\n", max)
+		return nil
+
+	case cmd == "range" && len(args) == 2:
+		from, err := parseULIDTime(args[0], now)
+		if err != nil {
+			return errors.Wrap(err, "from")
+		}
+		to, err := parseULIDTime(args[1], now)
+		if err != nil {
+			return errors.Wrap(err, "to")
+		}
+		lo, hi, err := ulidutil.Range(from, to)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "From  %s  %s\n", lo, ulidutil.TimeOf(lo).Format(time.RFC3339Nano))
+		fmt.Fprintf(w, "To    %s  %s\n", hi, ulidutil.TimeOf(hi).Format(time.RFC3339Nano))
+		return nil
+	}
+	return errUsage
+}
+
+// parseULIDTime parses a time like parseQueryTime, or the time of a ULID.
+func parseULIDTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(neg(d)), nil
+	}
+	if id, err := ulid.Parse(s); err == nil {
+		return ulidutil.TimeOf(id), nil
+	}
+	return store.ParseTime(s, now)
+}
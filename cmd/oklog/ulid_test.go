@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestULIDCommand(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2017, 3, 14, 15, 59, 40, 585000000, time.UTC)
+	for _, testcase := range []struct {
+		args []string
+		want string // output, or error substring
+	}{
+		{
+			[]string{"inspect", "01BB6RQR19000000000000000A"},
+			"ULID     01BB6RQR19000000000000000A\nTime     2017-03-14T15:59:40.585Z\nUnix ms  1489507180585\nEntropy  0000000000000000000a\n",
+		},
+		{
+			[]string{"at", "now"},
+			"Time  2017-03-14T15:59:40.585Z\nMin   01BB6RQR190000000000000000\nMax   01BB6RQR19ZZZZZZZZZZZZZZZZ\n",
+		},
+		{
+			[]string{"range", "1m", "01BB6RQR19000000000000000A"},
+			"From  01BB6RNXE90000000000000000  2017-03-14T15:58:40.585Z\nTo    01BB6RQR19ZZZZZZZZZZZZZZZZ  2017-03-14T15:59:40.585Z\n",
+		},
+		{[]string{"inspect", "01BB6RQR19"}, "has 10 characters, not 26"},
+		{[]string{"at", "1969-12-31T23:59:59Z"}, "before the Unix epoch"},
+		{[]string{"range", "now", "1h"}, "is after to"},
+		{[]string{"range", "now"}, "bad usage"},
+		{[]string{"nope"}, "bad usage"},
+	} {
+		var buf bytes.Buffer
+		err := ulidCommand(&buf, testcase.args, now)
+		if err != nil {
+			if !strings.Contains(err.Error(), testcase.want) {
+				t.Errorf("%v: want error containing %q, have %v", testcase.args, testcase.want, err)
+			}
+			continue
+		}
+		if want, have := testcase.want, buf.String(); want != have {
+			t.Errorf("%v: want %q, have %q", testcase.args, want, have)
+		}
+	}
+}
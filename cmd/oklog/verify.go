@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/store"
+)
+
+func runVerify(args []string) error {
+	flagset := flag.NewFlagSet("verify", flag.ExitOnError)
+	var (
+		addr       = flagset.String("addr", "localhost:7650", "address of the store (or ingeststore) node to verify")
+		quarantine = flagset.Bool("quarantine", false, "quarantine the segments found damaged, so they're neither queried nor compacted")
+		verbose    = flagset.Bool("v", false, "verbose output to stderr, with each segment as it's verified")
+		useTLS     = flagset.Bool("tls", false, "connect to the store with TLS")
+		tlsCA      = flagset.String("tls.ca", "", "CA certificates to verify the store with (default system)")
+		tlsCert    = flagset.String("tls.cert", "", "client certificate to present, for mutual TLS")
+		tlsKey     = flagset.String("tls.key", "", "client certificate's private key")
+		authFile   = flagset.String("auth-token-file", "", "file holding the store's auth token, if it requires one")
+	)
+	flagset.Usage = usageFor(flagset, "oklog verify [flags]")
+	if err := flagset.Parse(args); err != nil {
+		return err
+	}
+
+	_, hostport, _, _, err := parseAddr(*addr, defaultAPIPort)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse -addr")
+	}
+	tlsConfig, err := toolTLSConfig(*useTLS, *tlsCA, *tlsCert, *tlsKey)
+	if err != nil {
+		return err
+	}
+	authToken, err := readAuthToken(*authFile)
+	if err != nil {
+		return err
+	}
+	client, scheme := toolClient(tlsConfig, authToken)
+
+	var progress io.Writer = ioutil.Discard
+	if *verbose {
+		progress = os.Stderr
+	}
+	url := fmt.Sprintf("%s://%s/admin/verify?quarantine=%v", scheme, hostport, *quarantine)
+	return verifyCommand(os.Stdout, progress, client, url)
+}
+
+// verifyCommand starts a verification at url, and writes the problems found,
+// and the summary, to stdout, and each segment, as it's verified, to
+// progress. It fails if any segment is damaged, or the verification didn't
+// finish. Interrupting it cancels the verification.
+func verifyCommand(stdout, progress io.Writer, client *http.Client, url string) error {
+	resp, err := client.Post(url, "text/plain", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return errors.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var (
+		summary *store.VerifySummary
+		s       = bufio.NewScanner(resp.Body)
+	)
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		var u store.VerifyUpdate
+		if err := json.Unmarshal(s.Bytes(), &u); err != nil {
+			return errors.Wrapf(err, "parsing %q", s.Text())
+		}
+		if sv := u.Segment; sv != nil {
+			fmt.Fprintf(progress, "%d/%d %s: %d record(s), %d byte(s), %d problem(s)\n", sv.Done, sv.Total, sv.Name, sv.Records, sv.Bytes, sv.ProblemCount)
+			for _, p := range sv.Problems {
+				if p.Line > 0 {
+					fmt.Fprintf(stdout, "%s: %s, line %d: %s\n", sv.Name, p.Kind, p.Line, p.Detail)
+				} else {
+					fmt.Fprintf(stdout, "%s: %s: %s\n", sv.Name, p.Kind, p.Detail)
+				}
+			}
+			if n := sv.ProblemCount - len(sv.Problems); n > 0 {
+				fmt.Fprintf(stdout, "%s: %d more problem(s)\n", sv.Name, n)
+			}
+			if sv.Quarantined {
+				fmt.Fprintf(stdout, "%s: quarantined\n", sv.Name)
+			}
+		}
+		if u.Summary != nil {
+			summary = u.Summary
+		}
+	}
+	if err := s.Err(); err != nil {
+		return errors.Wrap(err, "reading verification")
+	}
+	if summary == nil {
+		return errors.New("verification ended without a summary")
+	}
+
+	fmt.Fprintf(stdout, "%d of %d segment(s) verified, %d record(s), %d byte(s), in %s: %d damaged, %d quarantined\n",
+		summary.Segments, summary.Total, summary.Records, summary.Bytes,
+		summary.Finished.Sub(summary.Started), len(summary.Damaged), summary.Quarantined)
+	switch {
+	case summary.State != "done":
+		return errors.Errorf("verification %s: %s", summary.State, summary.Error)
+	case len(summary.Damaged) > 0:
+		return errors.Errorf("%d damaged segment(s)", len(summary.Damaged))
+	}
+	return nil
+}
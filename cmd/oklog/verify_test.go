@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+func TestVerifyCommand(t *testing.T) {
+	t.Parallel()
+
+	filelog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, store.FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+	var ids []ulid.ULID
+	for i := 0; i < 4; i++ {
+		ids = append(ids, ulid.MustNew(ulid.Timestamp(time.Now().Add(time.Duration(i)*time.Second)), nil))
+	}
+	for _, segment := range []struct {
+		low, high ulid.ULID
+		records   string
+	}{
+		{ids[0], ids[1], fmt.Sprintf("%s a\n%s b\n", ids[0], ids[1])},
+		{ids[2], ids[3], fmt.Sprintf("%s a\n%s b\n", ids[3], ids[2])}, // unsorted
+	} {
+		w, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(segment.records))
+		if err := w.Close(segment.low, segment.high); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	verifier := store.NewVerifier(filelog, 0, store.LogReporter{Logger: log.NewNopLogger()})
+	for _, readOnly := range []bool{true, false} {
+		mux := http.NewServeMux()
+		registerVerify(mux, verifier, readOnly)
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		// Read-only nodes don't quarantine.
+		var stdout, progress bytes.Buffer
+		err := verifyCommand(&stdout, &progress, http.DefaultClient, server.URL+"/admin/verify?quarantine=true")
+		if readOnly {
+			if err == nil || !strings.Contains(err.Error(), "403") {
+				t.Errorf("read-only: want 403, have %v", err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatal("want an error for the damaged segment, have none")
+		}
+		damaged := fmt.Sprintf("%s-%s", ids[2], ids[3])
+		for _, want := range []string{
+			damaged + ": unsorted, line 2: ",
+			damaged + ": quarantined",
+			"2 of 2 segment(s) verified, 4 record(s)",
+			"1 damaged, 1 quarantined",
+		} {
+			if !strings.Contains(stdout.String(), want) {
+				t.Errorf("want %q in\n%s", want, stdout.String())
+			}
+		}
+		if want, have := 2, strings.Count(progress.String(), "\n"); want != have {
+			t.Errorf("want %d lines of progress, have %d:\n%s", want, have, progress.String())
+		}
+
+		// Once it's quarantined, what's left is fine.
+		stdout.Reset()
+		if err := verifyCommand(&stdout, ioutil.Discard, http.DefaultClient, server.URL+"/admin/verify"); err != nil {
+			t.Errorf("after quarantine: %v\n%s", err, stdout.String())
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Package alert notifies operators of critical events on a node, e.g. a
+// segment that's quarantined, or a disk that's filling up, without them
+// having to scrape its metrics. Components publish events to a Bus, which
+// delivers each to every Sink; see Webhook, and LogSink.
+package alert
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// These are the types of events. Each of them, but for SegmentQuarantined,
+// is published again, Resolved, once its condition is over.
+const (
+	// SegmentQuarantined is a store segment that failed checksum
+	// verification, which was moved to the corrupt directory. Details has
+	// its "file".
+	SegmentQuarantined = "segment_quarantined"
+
+	// DiskWatermark is a disk whose usage crossed a watermark, either way.
+	// Details has the "path", and its "level": for store paths, high or
+	// critical, or ok, once it's Resolved; for ingest paths, critical.
+	DiskWatermark = "disk_watermark"
+
+	// ConsumeStalled is a store consumer that's made no progress for a
+	// while. Details has the "consumer", and when it "last_step"ped.
+	ConsumeStalled = "consume_stalled"
+
+	// ClockSkewed is this node's clock, which is off the cluster's by more
+	// than the limit. Details has the "skew", and the "limit".
+	ClockSkewed = "clock_skewed"
+
+	// CanaryFailing is the canary, whose sentinel records haven't made it
+	// from an ingester to a query of the stores, for a number of checks in
+	// a row. Details has the number of "failures", and the last "error".
+	CanaryFailing = "canary_failing"
+)
+
+// Event is a notification of something an operator should know about. It's
+// delivered as its JSON, with the fields' names in their tags.
+type Event struct {
+	Type     string            `json:"type"`               // one of the above
+	Time     time.Time         `json:"time"`               // when it happened
+	Node     string            `json:"node"`               // e.g. the API address it advertises
+	Resolved bool              `json:"resolved,omitempty"` // its condition is over
+	Message  string            `json:"message"`            // for humans
+	Details  map[string]string `json:"details,omitempty"`  // by type
+}
+
+// Sink delivers events somewhere. Notify may block, and is done with, i.e.
+// it must return, once the context is canceled.
+type Sink interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// LogSink logs events to the wrapped logger, at Warn level, or Info level,
+// once they're resolved.
+type LogSink struct{ log.Logger }
+
+// Notify implements Sink.
+func (s LogSink) Notify(_ context.Context, e Event) error {
+	levelFunc := level.Warn
+	if e.Resolved {
+		levelFunc = level.Info
+	}
+	keyvals := []interface{}{"alert", e.Type, "resolved", e.Resolved, "msg", e.Message}
+	for k, v := range e.Details {
+		keyvals = append(keyvals, k, v)
+	}
+	return levelFunc(s.Logger).Log(keyvals...)
+}
+
+// Bus delivers the events published to it to each of its sinks, in the
+// order they're published. Publishing never waits: each sink has a queue of
+// its own, and events that don't fit in it are dropped, so a sink that's
+// slow, or gone, like a dead webhook endpoint, holds up neither the data
+// path, nor the other sinks.
+type Bus struct {
+	node    string
+	sinks   []Sink
+	queues  []chan Event
+	dropped prometheus.Counter
+	failed  prometheus.Counter
+	logger  log.Logger
+	stop    chan chan struct{}
+}
+
+// NewBus returns a Bus of the sinks, which stamps the events published to it
+// with the node. Each sink has a queue of queueSize events. Dropped counts
+// the events that didn't fit, and failed those a sink failed to deliver,
+// which are logged to logger. Don't forget to Run it.
+func NewBus(node string, sinks []Sink, queueSize int, dropped, failed prometheus.Counter, logger log.Logger) *Bus {
+	queues := make([]chan Event, len(sinks))
+	for i := range queues {
+		queues[i] = make(chan Event, queueSize)
+	}
+	return &Bus{
+		node:    node,
+		sinks:   sinks,
+		queues:  queues,
+		dropped: dropped,
+		failed:  failed,
+		logger:  logger,
+		stop:    make(chan chan struct{}),
+	}
+}
+
+// Publish the event to every sink, with the Bus's node, and the time, unless
+// it has one. It's a no-op on a nil Bus.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	e.Node = b.node
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, queue := range b.queues {
+		select {
+		case queue <- e:
+		default:
+			b.dropped.Inc()
+		}
+	}
+}
+
+// Run delivers the published events, until Stop is invoked. Events still
+// queued then are dropped, and deliveries in flight are canceled.
+func (b *Bus) Run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := range b.sinks {
+		wg.Add(1)
+		go func(sink Sink, queue <-chan Event) {
+			defer wg.Done()
+			for {
+				select {
+				case e := <-queue:
+					if err := sink.Notify(ctx, e); err != nil && ctx.Err() == nil {
+						b.failed.Inc()
+						level.Warn(b.logger).Log("alert", e.Type, "err", err, "msg", "failed to deliver alert")
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(b.sinks[i], b.queues[i])
+	}
+	q := <-b.stop
+	cancel()
+	wg.Wait()
+	close(q)
+}
+
+// Stop the Bus, once its deliveries in flight return.
+func (b *Bus) Stop() {
+	q := make(chan struct{})
+	b.stop <- q
+	<-q
+}
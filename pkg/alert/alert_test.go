@@ -0,0 +1,122 @@
+package alert
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestBusDoesNotBlock(t *testing.T) {
+	t.Parallel()
+
+	// One sink is stuck, e.g. on a dead webhook endpoint, until the Bus is
+	// stopped. The other gets every event, in order, regardless.
+	var (
+		stuck   = &recordingSink{block: true}
+		healthy = &recordingSink{}
+		dropped = prometheus.NewCounter(prometheus.CounterOpts{Name: "dropped"})
+		failed  = prometheus.NewCounter(prometheus.CounterOpts{Name: "failed"})
+		bus     = NewBus("node1:7650", []Sink{stuck, healthy}, 3, dropped, failed, log.NewNopLogger())
+	)
+	go bus.Run()
+
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			bus.Publish(Event{Type: DiskWatermark, Message: string(rune('a' + i))})
+			for len(healthy.events()) <= i || i == 0 && len(stuck.events()) == 0 {
+				time.Sleep(time.Millisecond) // till it's delivered, and the other's stuck
+			}
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocked")
+	}
+
+	var want []string
+	for i := 0; i < 10; i++ {
+		want = append(want, string(rune('a'+i)))
+	}
+	if have := healthy.messages(); !reflect.DeepEqual(want, have) {
+		t.Errorf("healthy sink: want %v, have %v", want, have)
+	}
+	for _, e := range healthy.events() {
+		if e.Node != "node1:7650" || e.Time.IsZero() {
+			t.Errorf("want the node, and a time, have %+v", e)
+		}
+	}
+
+	// The stuck sink took one, and queued three, so the rest were dropped.
+	stopped := make(chan struct{})
+	go func() { bus.Stop(); close(stopped) }()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop blocked")
+	}
+	if want, have := 6.0, counterValue(t, dropped); want != have {
+		t.Errorf("dropped: want %v, have %v", want, have)
+	}
+	if want, have := 0.0, counterValue(t, failed); want != have {
+		t.Errorf("failed: want %v, have %v", want, have)
+	}
+}
+
+func TestNilBus(t *testing.T) {
+	t.Parallel()
+
+	var bus *Bus
+	bus.Publish(Event{Type: ClockSkewed}) // no panic
+}
+
+// recordingSink records the events it's notified of, and, if block is set,
+// blocks on each until the context's canceled.
+type recordingSink struct {
+	block bool
+
+	mtx sync.Mutex
+	evs []Event
+}
+
+func (s *recordingSink) Notify(ctx context.Context, e Event) error {
+	s.mtx.Lock()
+	s.evs = append(s.evs, e)
+	s.mtx.Unlock()
+	if s.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (s *recordingSink) events() []Event {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]Event(nil), s.evs...)
+}
+
+func (s *recordingSink) messages() []string {
+	var messages []string
+	for _, e := range s.events() {
+		messages = append(messages, e.Message)
+	}
+	return messages
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
@@ -0,0 +1,112 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Webhook requests carry these headers, besides the Content-Type, which is
+// application/json. The signature is of the body, and is only sent if the
+// Webhook has a secret; see Sign.
+const (
+	HeaderEvent     = "X-OKLog-Event" // the event's Type
+	HeaderSignature = "X-OKLog-Signature"
+)
+
+// Doer is satisfied by *http.Client.
+type Doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Webhook is a Sink that POSTs each event, as its JSON, to a URL. Requests
+// that fail without a response, or with a 5xx, or 429 Too Many Requests, are
+// retried, with backoff, up to retries times, before the event is given up
+// on. Any other response that isn't 2xx is given up on right away.
+type Webhook struct {
+	url     string
+	secret  []byte
+	client  Doer
+	retries int
+	backoff time.Duration // before the first retry, doubling for the next
+}
+
+// NewWebhook returns a Webhook to url, whose requests are signed with the
+// secret, unless it's empty, and made with the client, which should have a
+// timeout. The first retry of a request is after backoff, and each after
+// that waits twice as long as the one before.
+func NewWebhook(url string, secret []byte, client Doer, retries int, backoff time.Duration) *Webhook {
+	return &Webhook{
+		url:     url,
+		secret:  secret,
+		client:  client,
+		retries: retries,
+		backoff: backoff,
+	}
+}
+
+// Sign returns the signature of the body with the secret, as it's sent in
+// HeaderSignature: "sha256=", and the hex of the HMAC-SHA256 of the body.
+// Receivers should compute it themselves, and compare them in constant time,
+// e.g. with hmac.Equal.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify implements Sink.
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "encoding event")
+	}
+	wait := w.backoff
+	for retry := 0; ; retry++ {
+		retryable, err := w.post(ctx, e.Type, body)
+		if err == nil || !retryable || retry >= w.retries {
+			return err
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+		wait *= 2
+	}
+}
+
+// post the body, and return whether it's worth trying again, if it fails.
+func (w *Webhook) post(ctx context.Context, typ string, body []byte) (retryable bool, err error) {
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, typ)
+	if len(w.secret) > 0 {
+		req.Header.Set(HeaderSignature, Sign(w.secret, body))
+	}
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	defer io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096)) // so the connection's reused
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	err = errors.Errorf("webhook responded %s", resp.Status)
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
@@ -0,0 +1,128 @@
+package alert
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	t.Parallel()
+
+	event := Event{
+		Type:    SegmentQuarantined,
+		Time:    time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC),
+		Node:    "node1:7650",
+		Message: "moved to corrupt/x.corrupt",
+		Details: map[string]string{"file": "/store/x.flushed"},
+	}
+	for _, testcase := range []struct {
+		name     string
+		statuses []int // of the receiver's responses, then 204s
+		retries  int
+		requests int
+		err      bool
+	}{
+		{"delivered", nil, 3, 1, false},
+		{"retried", []int{503, 500, 429}, 3, 4, false},
+		{"retries run out", []int{503, 503, 503}, 2, 3, true},
+		{"not retried", []int{400}, 3, 1, true},
+		{"redirect isn't success", []int{304}, 3, 1, true},
+	} {
+		testcase := testcase
+		t.Run(testcase.name, func(t *testing.T) {
+			t.Parallel()
+			r := &testReceiver{t: t, secret: []byte("shh"), statuses: testcase.statuses}
+			server := httptest.NewServer(r)
+			defer server.Close()
+
+			w := NewWebhook(server.URL, []byte("shh"), http.DefaultClient, testcase.retries, time.Millisecond)
+			err := w.Notify(context.Background(), event)
+			if want, have := testcase.err, err != nil; want != have {
+				t.Errorf("want error %v, have %v", want, err)
+			}
+			requests := r.received()
+			if want, have := testcase.requests, len(requests); want != have {
+				t.Fatalf("want %d requests, have %d", want, have)
+			}
+			for _, have := range requests {
+				if want := event; !reflect.DeepEqual(want, have) {
+					t.Errorf("want %+v, have %+v", want, have)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookCanceled(t *testing.T) {
+	t.Parallel()
+
+	r := &testReceiver{t: t, statuses: []int{503, 503, 503}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	w := NewWebhook(server.URL, nil, http.DefaultClient, 3, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if want, have := context.Canceled, w.Notify(ctx, Event{Type: ConsumeStalled}); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+// testReceiver is a webhook endpoint, which checks the signature of every
+// request, if it has a secret, or that there's none, if it hasn't, and
+// responds with its statuses, in turn, and then 204 No Content.
+type testReceiver struct {
+	t      *testing.T
+	secret []byte
+
+	mtx      sync.Mutex
+	statuses []int
+	events   []Event
+}
+
+func (r *testReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		r.t.Error(err)
+	}
+	sig := req.Header.Get(HeaderSignature)
+	switch {
+	case len(r.secret) == 0 && sig != "":
+		r.t.Errorf("want no signature, have %q", sig)
+	case len(r.secret) > 0 && !hmac.Equal([]byte(Sign(r.secret, body)), []byte(sig)):
+		r.t.Errorf("signature %q doesn't match the body", sig)
+	}
+	if want, have := "application/json", req.Header.Get("Content-Type"); want != have {
+		r.t.Errorf("Content-Type: want %q, have %q", want, have)
+	}
+	var e Event
+	if err := json.Unmarshal(body, &e); err != nil {
+		r.t.Error(err)
+	}
+	if want, have := e.Type, req.Header.Get(HeaderEvent); want != have {
+		r.t.Errorf("%s: want %q, have %q", HeaderEvent, want, have)
+	}
+
+	r.mtx.Lock()
+	r.events = append(r.events, e)
+	status := http.StatusNoContent
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	r.mtx.Unlock()
+	w.WriteHeader(status)
+}
+
+func (r *testReceiver) received() []Event {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]Event(nil), r.events...)
+}
@@ -0,0 +1,396 @@
+// Package client is a client of the store API, for programs that query OK
+// Log. Requests that fail for want of a connection, or a healthy node, are
+// retried with backoff. Bounded queries resume after the last record they
+// received in full, with a continuation token, so a retried query never
+// returns a record twice, or skips one.
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/store"
+	"github.com/oklog/oklog/pkg/stream"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+// Client queries the store API of a node, which queries the rest of its
+// cluster. A Client is safe for concurrent use.
+type Client struct {
+	base    url.URL
+	client  stream.Doer
+	backoff stream.BackoffPolicy
+	retries int
+}
+
+// NewClient returns a Client of the store API at addr, e.g.
+// http://localhost:7650. Requests are made with the client, which is the
+// place to add auth tokens or TLS, and mustn't time out, if it's used for
+// streams. A request that fails with a retryable Error is retried, after a
+// delay by the backoff policy, up to retries times in a row, before the
+// Error is returned; only the delays' Base, Max, and Jitter apply.
+func NewClient(addr string, client stream.Doer, backoff stream.BackoffPolicy, retries int) (*Client, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing store address")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, errors.Errorf("store address %q isn't an http(s) URL", addr)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return &Client{
+		base:    *u,
+		client:  client,
+		backoff: backoff,
+		retries: retries,
+	}, nil
+}
+
+// Error is a failed request of the store API.
+type Error struct {
+	StatusCode int  // of the response, or zero, if it failed without one
+	Retryable  bool // if making the request again may succeed
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("store API: %d %s: %v", e.StatusCode, http.StatusText(e.StatusCode), e.Err)
+	}
+	return fmt.Sprintf("store API: %v", e.Err)
+}
+
+// IsRetryable returns true if err is a retryable Error. Those returned by a
+// Client are the ones its retries ran out for.
+func IsRetryable(err error) bool {
+	e, ok := errors.Cause(err).(*Error)
+	return ok && e.Retryable
+}
+
+// responseError is the Error of a response that isn't OK. Nodes that are
+// unavailable, e.g. draining, or temporarily overloaded, are worth retrying.
+func responseError(resp *http.Response) *Error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &Error{
+		StatusCode: resp.StatusCode,
+		Retryable:  resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+		Err:        errors.New(strings.TrimSpace(string(body))),
+	}
+}
+
+// Query selects the records of a bounded query.
+type Query struct {
+	From, To time.Time // required
+	Q        string    // records containing Q, or matching it, if Regex is set
+	Regex    bool
+	Topic    string // records of this topic, if it isn't empty
+	Backward bool   // newest records first
+
+	// PageSize, if positive, is the most records fetched by each request.
+	// Otherwise, all of them are fetched by one, unless the store's limits
+	// truncate it; either way, the records are read until they run out.
+	PageSize int
+}
+
+// Query returns the records selected by the query, in order. No request is
+// made until Next is called.
+func (c *Client) Query(ctx context.Context, q Query) *Records {
+	return &Records{ctx: ctx, c: c, q: q}
+}
+
+// Records iterates over the records of a query, fetching them as they're
+// read, and resuming after the last one, if a request fails. It isn't safe
+// for concurrent use.
+type Records struct {
+	ctx context.Context
+	c   *Client
+	q   Query
+
+	body       io.ReadCloser // of the current request, if any
+	br         *bufio.Reader
+	result     store.QueryResult
+	token      string    // continuation token of the next request
+	last       ulid.ULID // of the last record read, or zero
+	failures   int       // in a row
+	record     stream.Record
+	errorCount int
+	err        error
+	done       bool
+}
+
+// Next advances to the next record, which is then available from Record. It
+// returns false once the records run out, or a request fails for good, when
+// Err says which.
+func (r *Records) Next() bool {
+	for r.err == nil && !r.done {
+		if r.body == nil {
+			if err := r.open(); err != nil {
+				r.fail(err)
+			}
+			continue
+		}
+		line, err := r.br.ReadBytes('\n')
+		if err == nil {
+			if r.accept(line) {
+				return true
+			}
+			continue
+		}
+
+		// The records ran out. If they were cut short, what there was of the
+		// last one is dropped, and we resume after the one before.
+		r.close()
+		switch {
+		case err == io.EOF && len(line) == 0 && r.result.Continue != "":
+			r.token = r.result.Continue
+		case err == io.EOF && len(line) == 0:
+			r.done = true
+		case r.ctx.Err() != nil:
+			r.err = r.ctx.Err()
+		default:
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			r.fail(&Error{Retryable: true, Err: errors.Wrap(err, "reading records")})
+		}
+	}
+	return false
+}
+
+// accept the complete line as the next record, if it is one.
+func (r *Records) accept(line []byte) bool {
+	line = line[:len(line)-1]
+	if len(line) == 0 {
+		return false // a heartbeat
+	}
+	rec, ok := parseRecord(line)
+	if !ok {
+		r.close()
+		r.err = &Error{Err: errors.Errorf("malformed record %q", line)}
+		return false
+	}
+	if r.last != (ulid.ULID{}) && (!r.q.Backward && rec.ID.Compare(r.last) <= 0 || r.q.Backward && rec.ID.Compare(r.last) >= 0) {
+		return false // had it already
+	}
+	r.record = rec
+	r.last, r.token, r.failures = rec.ID, store.ContinueToken(rec.ID), 0
+	return true
+}
+
+// open the request for the records after the last one, or the next page.
+func (r *Records) open() error {
+	v := url.Values{}
+	v.Set("from", r.q.From.Format(time.RFC3339Nano))
+	v.Set("to", r.q.To.Format(time.RFC3339Nano))
+	if r.q.Q != "" {
+		v.Set("q", r.q.Q)
+	}
+	if r.q.Regex {
+		v.Set("regex", "true")
+	}
+	if r.q.Topic != "" {
+		v.Set("topic", r.q.Topic)
+	}
+	if r.q.Backward {
+		v.Set("direction", "backward")
+	}
+	if r.q.PageSize > 0 {
+		v.Set("limit", strconv.Itoa(r.q.PageSize))
+	}
+	if r.token != "" {
+		v.Set("continue", r.token)
+	}
+	req, err := http.NewRequest("GET", r.c.url("/store"+store.APIPathUserQuery, v), nil)
+	if err != nil {
+		return &Error{Err: err}
+	}
+	resp, err := r.c.client.Do(req.WithContext(r.ctx))
+	if err != nil {
+		if r.ctx.Err() != nil {
+			return r.ctx.Err()
+		}
+		return &Error{Retryable: true, Err: err}
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		defer resp.Body.Close()
+		return responseError(resp)
+	}
+	r.result = store.QueryResult{}
+	if err := r.result.DecodeFrom(resp); err != nil {
+		resp.Body.Close()
+		return &Error{StatusCode: resp.StatusCode, Err: errors.Wrap(err, "decoding response")}
+	}
+	r.errorCount += r.result.ErrorCount
+	r.body, r.br = r.result.Records, bufio.NewReader(r.result.Records)
+	return nil
+}
+
+// fail the current request with err. If it's retryable, and retries are
+// left, we wait out the backoff, and try again.
+func (r *Records) fail(err error) {
+	if !IsRetryable(err) || r.failures >= r.c.retries {
+		r.err = err
+		return
+	}
+	r.failures++
+	t := time.NewTimer(r.c.delay(r.failures))
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-r.ctx.Done():
+		r.err = r.ctx.Err()
+	}
+}
+
+func (r *Records) close() {
+	if r.body != nil {
+		r.body.Close()
+		r.body, r.br = nil, nil
+	}
+}
+
+// Record returns the current record.
+func (r *Records) Record() stream.Record { return r.record }
+
+// Err returns the error that stopped Next, if any.
+func (r *Records) Err() error { return r.err }
+
+// ErrorCount returns how many times a store node failed to return its
+// records, over every request so far. The records may be incomplete, if
+// it isn't zero.
+func (r *Records) ErrorCount() int { return r.errorCount }
+
+// Close the current request, if any. Next returns false after that.
+func (r *Records) Close() error {
+	r.close()
+	r.done = true
+	return nil
+}
+
+// delay returns how long to wait before the given retry of a request.
+func (c *Client) delay(retry int) time.Duration {
+	d := c.backoff.Base
+	for i := 1; i < retry && d < c.backoff.Max; i++ {
+		d *= 2
+	}
+	if d > c.backoff.Max {
+		d = c.backoff.Max
+	}
+	if c.backoff.Jitter > 0 {
+		d += time.Duration(float64(d) * c.backoff.Jitter * (2*rand.Float64() - 1))
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// url returns the URL of the path on the Client's node, with the values.
+func (c *Client) url(path string, v url.Values) string {
+	u := c.base
+	u.Path += path
+	u.RawQuery = v.Encode()
+	return u.String()
+}
+
+// clientIdleTimeout is how long a stream waits for data, or heartbeats,
+// before it reconnects. Store nodes send a heartbeat every ten seconds.
+const clientIdleTimeout = 30 * time.Second
+
+// Stream the records selected by the query, as they're written, until the
+// context is canceled, when both chans are closed. The records are already
+// deduplicated, and merged, by the store node, which queries the rest of its
+// cluster. If the connection fails, it's retried with the Client's backoff
+// policy, regardless of its retries, from the last record received, and the
+// error is sent to the error chan, which is buffered, and dropped if it's
+// full, so it needn't be read at all. Records without a valid ULID are
+// skipped.
+func (c *Client) Stream(ctx context.Context, q stream.Query) (<-chan stream.Record, <-chan error) {
+	var (
+		records = make(chan stream.Record, 1024)
+		errs    = make(chan error, 64)
+	)
+	peerErrs := make(chan stream.PeerError, cap(errs))
+	options := []stream.ExecuteOption{
+		stream.WithBackoff(c.backoff),
+		stream.WithIdleTimeout(clientIdleTimeout),
+		stream.WithErrors(peerErrs),
+		stream.WithTopic(q.Topic),
+	}
+	if q.Since != (ulid.ULID{}) {
+		options = append(options, stream.WithSince(q.Since))
+	}
+	v := url.Values{}
+	if q.Q != "" {
+		v.Set("q", q.Q)
+	}
+	if q.Regex {
+		v.Set("regex", "true")
+	}
+	rcf := stream.HTTPReadCloserFactory(c.client, func(string) string {
+		return c.url("/store"+store.APIPathUserStream, v)
+	})
+	peers := func() []string { return []string{c.base.Host} }
+
+	// Execute returns when the context is canceled, once its connection is
+	// done, so nothing is sent to raw, or peerErrs, after that.
+	raw := make(chan []byte, 1024)
+	go func() {
+		stream.Execute(ctx, peers, rcf, time.Sleep, time.NewTicker, raw, options...)
+		close(raw)
+		close(peerErrs)
+	}()
+	go func() {
+		for err := range peerErrs {
+			select {
+			case errs <- &Error{Retryable: true, Err: err.Err}:
+			default:
+			}
+		}
+		close(errs)
+	}()
+	go func() {
+		defer close(records)
+		for line := range raw {
+			rec, ok := parseRecord(line)
+			if !ok {
+				continue
+			}
+			select {
+			case records <- rec:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return records, errs
+}
+
+// parseRecord parses a line of records, without its newline, i.e. a ULID, a
+// space, and the record, as it's stored.
+func parseRecord(line []byte) (stream.Record, bool) {
+	if len(line) <= ulid.EncodedSize || line[ulid.EncodedSize] != ' ' {
+		return stream.Record{}, false
+	}
+	id, err := ulidutil.Parse(string(line[:ulid.EncodedSize]))
+	if err != nil {
+		return stream.Record{}, false
+	}
+	return stream.Record{
+		ID:   id,
+		Time: ulidutil.TimeOf(id),
+		Data: record.Unescape(line[ulid.EncodedSize+1:]),
+	}, true
+}
@@ -0,0 +1,353 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/store"
+	"github.com/oklog/oklog/pkg/stream"
+)
+
+func TestQueryResumes(t *testing.T) {
+	t.Parallel()
+
+	ids := testIDs(10)
+	lineSize := ulid.EncodedSize + len(" record 0\n")
+	for _, testcase := range []struct {
+		name     string
+		cuts     []int
+		pageSize int
+		backward bool
+	}{
+		{"no cuts", nil, 0, false},
+		{"mid line", []int{lineSize + 5, 3*lineSize - 1}, 0, false},
+		{"mid ULID", []int{10, lineSize + 10}, 0, false},
+		{"line boundary", []int{lineSize, 2 * lineSize}, 0, false},
+		{"before any", []int{0, 0, 0}, 0, false},
+		{"backward", []int{lineSize + 5, 2*lineSize - 1}, 0, true},
+		{"pages", []int{lineSize + 5, -1, lineSize - 1}, 3, false},
+		{"backward pages", []int{-1, 2*lineSize + 1}, 4, true},
+	} {
+		testcase := testcase
+		t.Run(testcase.name, func(t *testing.T) {
+			t.Parallel()
+			fs := &fakeStore{ids: ids, cuts: testcase.cuts}
+			server := httptest.NewServer(fs)
+			defer server.Close()
+			c := testClient(t, server.URL, 3)
+
+			records := c.Query(context.Background(), Query{
+				From:     time.Now().Add(-time.Hour),
+				To:       time.Now(),
+				Backward: testcase.backward,
+				PageSize: testcase.pageSize,
+			})
+			defer records.Close()
+			var have []string
+			for records.Next() {
+				rec := records.Record()
+				have = append(have, fmt.Sprintf("%s %s", rec.ID, rec.Data))
+			}
+			if err := records.Err(); err != nil {
+				t.Fatal(err)
+			}
+			var want []string
+			for i := range ids {
+				if testcase.backward {
+					i = len(ids) - 1 - i
+				}
+				want = append(want, fmt.Sprintf("%s record %d", ids[i], i))
+			}
+			if !reflect.DeepEqual(want, have) {
+				t.Errorf("want\n%s\nhave\n%s", strings.Join(want, "\n"), strings.Join(have, "\n"))
+			}
+		})
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name      string
+		statuses  []int
+		cuts      []int
+		retries   int
+		requests  int
+		status    int // of the error, or 0 for none
+		retryable bool
+	}{
+		{"retried", []int{503, 500, 429}, nil, 3, 4, 0, false},
+		{"retries run out", []int{503, 503}, nil, 1, 2, 503, true},
+		{"not retryable", []int{400}, nil, 3, 1, 400, false},
+		{"cuts run out", nil, []int{3, 3, 3}, 2, 3, 0, true},
+		{"progress resets retries", nil, []int{60, 60, 60, 60, 60, 60, 60}, 1, 8, 0, false},
+	} {
+		testcase := testcase
+		t.Run(testcase.name, func(t *testing.T) {
+			t.Parallel()
+			fs := &fakeStore{ids: testIDs(8), statuses: testcase.statuses, cuts: testcase.cuts}
+			server := httptest.NewServer(fs)
+			defer server.Close()
+			c := testClient(t, server.URL, testcase.retries)
+
+			records := c.Query(context.Background(), Query{From: time.Now().Add(-time.Hour), To: time.Now()})
+			defer records.Close()
+			for records.Next() {
+			}
+			err := records.Err()
+			if want, have := testcase.requests, fs.requestCount(); want != have {
+				t.Errorf("requests: want %d, have %d", want, have)
+			}
+			if testcase.status == 0 && !testcase.retryable {
+				if err != nil {
+					t.Errorf("want no error, have %v", err)
+				}
+				return
+			}
+			e, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("want an *Error, have %T %v", err, err)
+			}
+			if want, have := testcase.status, e.StatusCode; want != have {
+				t.Errorf("status: want %d, have %d", want, have)
+			}
+			if want, have := testcase.retryable, IsRetryable(err); want != have {
+				t.Errorf("retryable: want %v, have %v (%v)", want, have, err)
+			}
+		})
+	}
+}
+
+func TestQueryCanceled(t *testing.T) {
+	t.Parallel()
+
+	fs := &fakeStore{ids: testIDs(4), statuses: []int{503, 503, 503}}
+	server := httptest.NewServer(fs)
+	defer server.Close()
+	c, err := NewClient(server.URL, http.DefaultClient, stream.BackoffPolicy{Base: time.Hour, Max: time.Hour}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	records := c.Query(ctx, Query{From: time.Now().Add(-time.Hour), To: time.Now()})
+	if records.Next() {
+		t.Fatal("want no records")
+	}
+	if want, have := context.Canceled, records.Err(); want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	ids := testIDs(6)
+	var (
+		mtx    sync.Mutex
+		sinces []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/store"+store.APIPathUserStream {
+			http.NotFound(w, r)
+			return
+		}
+		mtx.Lock()
+		sinces = append(sinces, r.URL.Query().Get("since"))
+		first := len(sinces) == 1
+		mtx.Unlock()
+
+		// The first connection is cut in the middle of the fourth record.
+		cw := &cuttingWriter{ResponseWriter: w, left: -1}
+		if first {
+			cw.left = 3*len(recordLine(ids, 0)) + 7
+		}
+		since, _ := ulid.Parse(r.URL.Query().Get("since"))
+		for i, id := range ids {
+			if id.Compare(since) > 0 {
+				cw.Write([]byte(recordLine(ids, i)))
+			}
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	c := testClient(t, server.URL, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	records, _ := c.Stream(ctx, stream.Query{})
+	var have []string
+	for rec := range records {
+		have = append(have, fmt.Sprintf("%s %s", rec.ID, rec.Data))
+		if len(have) == len(ids) {
+			cancel()
+		}
+	}
+	var want []string
+	for i := range ids {
+		want = append(want, strings.TrimSuffix(recordLine(ids, i), "\n"))
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want\n%s\nhave\n%s", strings.Join(want, "\n"), strings.Join(have, "\n"))
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(sinces) < 2 || sinces[1] != ids[2].String() {
+		t.Errorf("want a reconnect since %s, have %q", ids[2], sinces)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	t.Parallel()
+
+	for addr, want := range map[string]string{
+		"http://localhost:7650":       "http://localhost:7650/store/query",
+		"https://oklog.example/base/": "https://oklog.example/base/store/query",
+		"localhost:7650":              "",
+		"ftp://localhost":             "",
+		"http://":                     "",
+	} {
+		c, err := NewClient(addr, http.DefaultClient, stream.DefaultBackoffPolicy, 0)
+		if want == "" {
+			if err == nil {
+				t.Errorf("%s: want an error, have none", addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", addr, err)
+			continue
+		}
+		if have := c.url("/store"+store.APIPathUserQuery, nil); want != have {
+			t.Errorf("%s: want %s, have %s", addr, want, have)
+		}
+	}
+}
+
+func testIDs(n int) []ulid.ULID {
+	var (
+		ids = make([]ulid.ULID, n)
+		now = time.Now().Add(-time.Minute)
+	)
+	for i := range ids {
+		ids[i] = ulid.MustNew(ulid.Timestamp(now.Add(time.Duration(i)*time.Millisecond)), nil)
+	}
+	return ids
+}
+
+func testClient(t *testing.T, addr string, retries int) *Client {
+	c, err := NewClient(addr, http.DefaultClient, stream.BackoffPolicy{Base: time.Millisecond, Max: 5 * time.Millisecond}, retries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func recordLine(ids []ulid.ULID, i int) string {
+	return fmt.Sprintf("%s record %d\n", ids[i], i)
+}
+
+// fakeStore serves queries of its records like the store API, from the
+// continuation token, and a page at a time, if they're limited. The first
+// responses fail with its statuses, and the next are cut short, with a broken
+// connection, at the byte offsets of its cuts, if they aren't negative.
+type fakeStore struct {
+	ids []ulid.ULID
+
+	mtx      sync.Mutex
+	statuses []int
+	cuts     []int
+	requests int
+}
+
+func (fs *fakeStore) requestCount() int {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	return fs.requests
+}
+
+func (fs *fakeStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.mtx.Lock()
+	fs.requests++
+	status, cut := 0, -1
+	switch {
+	case len(fs.statuses) > 0:
+		status, fs.statuses = fs.statuses[0], fs.statuses[1:]
+	case len(fs.cuts) > 0:
+		cut, fs.cuts = fs.cuts[0], fs.cuts[1:]
+	}
+	fs.mtx.Unlock()
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if r.URL.Path != "/store"+store.APIPathUserQuery {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Every record after the continuation token, in order, if any.
+	query := r.URL.Query()
+	order := make([]int, len(fs.ids))
+	for i := range order {
+		order[i] = i
+		if query.Get("direction") == "backward" {
+			order[i] = len(fs.ids) - 1 - i
+		}
+	}
+	if token := query.Get("continue"); token != "" {
+		for j, i := range order {
+			if store.ContinueToken(fs.ids[i]) == token {
+				order = order[j+1:]
+				break
+			}
+		}
+	}
+	var qr store.QueryResult
+	qr.Params.From.Parse(query.Get("from"))
+	qr.Params.To.Parse(query.Get("to"))
+	if limit, _ := strconv.Atoi(query.Get("limit")); limit > 0 && limit < len(order) {
+		order = order[:limit]
+		qr.Continue = store.ContinueToken(fs.ids[order[limit-1]])
+	}
+	var body []string
+	for _, i := range order {
+		body = append(body, recordLine(fs.ids, i))
+	}
+	qr.Records = ioutil.NopCloser(strings.NewReader(strings.Join(body, "")))
+	qr.EncodeTo(&cuttingWriter{ResponseWriter: w, left: cut})
+}
+
+// cuttingWriter breaks the connection once left bytes of the body are
+// written, unless left is negative.
+type cuttingWriter struct {
+	http.ResponseWriter
+	left int
+}
+
+func (w *cuttingWriter) Write(p []byte) (int, error) {
+	if w.left < 0 {
+		return w.ResponseWriter.Write(p)
+	}
+	if len(p) > w.left {
+		w.ResponseWriter.Write(p[:w.left])
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.left -= len(p)
+	return w.ResponseWriter.Write(p)
+}
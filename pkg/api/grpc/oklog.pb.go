@@ -0,0 +1,582 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: oklog.proto
+
+package grpc
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// Record is a log record.
+type Record struct {
+	// ID is the ULID, which the ingester gives each record; Push ignores it.
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Data is the record, starting with its topic, if the ingester expects
+	// one, without a trailing newline. It may contain newlines.
+	Data                 []byte   `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Record) Reset()         { *m = Record{} }
+func (m *Record) String() string { return proto.CompactTextString(m) }
+func (*Record) ProtoMessage()    {}
+func (*Record) Descriptor() ([]byte, []int) {
+	return fileDescriptor_12587e7f9352b9f6, []int{0}
+}
+
+func (m *Record) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Record.Unmarshal(m, b)
+}
+func (m *Record) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Record.Marshal(b, m, deterministic)
+}
+func (m *Record) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Record.Merge(m, src)
+}
+func (m *Record) XXX_Size() int {
+	return xxx_messageInfo_Record.Size(m)
+}
+func (m *Record) XXX_DiscardUnknown() {
+	xxx_messageInfo_Record.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Record proto.InternalMessageInfo
+
+func (m *Record) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Record) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+// PushResponse is the result of a Push.
+type PushResponse struct {
+	// Records is how many records were synced.
+	Records              uint64   `protobuf:"varint,1,opt,name=records,proto3" json:"records,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PushResponse) Reset()         { *m = PushResponse{} }
+func (m *PushResponse) String() string { return proto.CompactTextString(m) }
+func (*PushResponse) ProtoMessage()    {}
+func (*PushResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_12587e7f9352b9f6, []int{1}
+}
+
+func (m *PushResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PushResponse.Unmarshal(m, b)
+}
+func (m *PushResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PushResponse.Marshal(b, m, deterministic)
+}
+func (m *PushResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PushResponse.Merge(m, src)
+}
+func (m *PushResponse) XXX_Size() int {
+	return xxx_messageInfo_PushResponse.Size(m)
+}
+func (m *PushResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_PushResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PushResponse proto.InternalMessageInfo
+
+func (m *PushResponse) GetRecords() uint64 {
+	if m != nil {
+		return m.Records
+	}
+	return 0
+}
+
+// QueryRequest takes the parameters of the HTTP query API.
+type QueryRequest struct {
+	From                 string   `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To                   string   `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	Q                    string   `protobuf:"bytes,3,opt,name=q,proto3" json:"q,omitempty"`
+	Regex                bool     `protobuf:"varint,4,opt,name=regex,proto3" json:"regex,omitempty"`
+	Topic                string   `protobuf:"bytes,5,opt,name=topic,proto3" json:"topic,omitempty"`
+	Labels               []string `protobuf:"bytes,6,rep,name=labels,proto3" json:"labels,omitempty"`
+	Limit                int32    `protobuf:"varint,7,opt,name=limit,proto3" json:"limit,omitempty"`
+	Continue             string   `protobuf:"bytes,8,opt,name=continue,proto3" json:"continue,omitempty"`
+	Backward             bool     `protobuf:"varint,9,opt,name=backward,proto3" json:"backward,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *QueryRequest) Reset()         { *m = QueryRequest{} }
+func (m *QueryRequest) String() string { return proto.CompactTextString(m) }
+func (*QueryRequest) ProtoMessage()    {}
+func (*QueryRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_12587e7f9352b9f6, []int{2}
+}
+
+func (m *QueryRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_QueryRequest.Unmarshal(m, b)
+}
+func (m *QueryRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_QueryRequest.Marshal(b, m, deterministic)
+}
+func (m *QueryRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_QueryRequest.Merge(m, src)
+}
+func (m *QueryRequest) XXX_Size() int {
+	return xxx_messageInfo_QueryRequest.Size(m)
+}
+func (m *QueryRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_QueryRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_QueryRequest proto.InternalMessageInfo
+
+func (m *QueryRequest) GetFrom() string {
+	if m != nil {
+		return m.From
+	}
+	return ""
+}
+
+func (m *QueryRequest) GetTo() string {
+	if m != nil {
+		return m.To
+	}
+	return ""
+}
+
+func (m *QueryRequest) GetQ() string {
+	if m != nil {
+		return m.Q
+	}
+	return ""
+}
+
+func (m *QueryRequest) GetRegex() bool {
+	if m != nil {
+		return m.Regex
+	}
+	return false
+}
+
+func (m *QueryRequest) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *QueryRequest) GetLabels() []string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *QueryRequest) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+func (m *QueryRequest) GetContinue() string {
+	if m != nil {
+		return m.Continue
+	}
+	return ""
+}
+
+func (m *QueryRequest) GetBackward() bool {
+	if m != nil {
+		return m.Backward
+	}
+	return false
+}
+
+// TailRequest takes the parameters of the HTTP stream API.
+type TailRequest struct {
+	Q                    string   `protobuf:"bytes,1,opt,name=q,proto3" json:"q,omitempty"`
+	Regex                bool     `protobuf:"varint,2,opt,name=regex,proto3" json:"regex,omitempty"`
+	Topic                string   `protobuf:"bytes,3,opt,name=topic,proto3" json:"topic,omitempty"`
+	Labels               []string `protobuf:"bytes,4,rep,name=labels,proto3" json:"labels,omitempty"`
+	Since                string   `protobuf:"bytes,5,opt,name=since,proto3" json:"since,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TailRequest) Reset()         { *m = TailRequest{} }
+func (m *TailRequest) String() string { return proto.CompactTextString(m) }
+func (*TailRequest) ProtoMessage()    {}
+func (*TailRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_12587e7f9352b9f6, []int{3}
+}
+
+func (m *TailRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TailRequest.Unmarshal(m, b)
+}
+func (m *TailRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TailRequest.Marshal(b, m, deterministic)
+}
+func (m *TailRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TailRequest.Merge(m, src)
+}
+func (m *TailRequest) XXX_Size() int {
+	return xxx_messageInfo_TailRequest.Size(m)
+}
+func (m *TailRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_TailRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TailRequest proto.InternalMessageInfo
+
+func (m *TailRequest) GetQ() string {
+	if m != nil {
+		return m.Q
+	}
+	return ""
+}
+
+func (m *TailRequest) GetRegex() bool {
+	if m != nil {
+		return m.Regex
+	}
+	return false
+}
+
+func (m *TailRequest) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *TailRequest) GetLabels() []string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *TailRequest) GetSince() string {
+	if m != nil {
+		return m.Since
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*Record)(nil), "oklog.Record")
+	proto.RegisterType((*PushResponse)(nil), "oklog.PushResponse")
+	proto.RegisterType((*QueryRequest)(nil), "oklog.QueryRequest")
+	proto.RegisterType((*TailRequest)(nil), "oklog.TailRequest")
+}
+
+func init() { proto.RegisterFile("oklog.proto", fileDescriptor_12587e7f9352b9f6) }
+
+var fileDescriptor_12587e7f9352b9f6 = []byte{
+	// 341 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x92, 0xc1, 0x4e, 0xab, 0x40,
+	0x14, 0x86, 0x33, 0x14, 0x68, 0x39, 0xe5, 0xde, 0xc5, 0xb9, 0x37, 0x66, 0xd2, 0x15, 0x61, 0x45,
+	0x62, 0x6d, 0x8c, 0xbe, 0x81, 0x5b, 0x4d, 0xd4, 0x89, 0x2b, 0x77, 0x14, 0x46, 0x9c, 0x94, 0x32,
+	0x74, 0x18, 0xa2, 0x3e, 0x86, 0xaf, 0xe6, 0x13, 0x19, 0x0e, 0xd0, 0x54, 0xdb, 0xdd, 0x7c, 0x9c,
+	0x33, 0xe7, 0xfc, 0x3f, 0xff, 0xc0, 0x5c, 0x6f, 0x4a, 0x5d, 0xac, 0x6a, 0xa3, 0xad, 0x46, 0x8f,
+	0x20, 0x5e, 0x82, 0x2f, 0x64, 0xa6, 0x4d, 0x8e, 0x7f, 0xc1, 0x51, 0x39, 0x67, 0x11, 0x4b, 0x02,
+	0xe1, 0xa8, 0x1c, 0x11, 0xdc, 0x3c, 0xb5, 0x29, 0x77, 0x22, 0x96, 0x84, 0x82, 0xce, 0x71, 0x02,
+	0xe1, 0x43, 0xdb, 0xbc, 0x0a, 0xd9, 0xd4, 0xba, 0x6a, 0x24, 0x72, 0x98, 0x1a, 0xba, 0xdd, 0xd0,
+	0x45, 0x57, 0x8c, 0x18, 0x7f, 0x31, 0x08, 0x1f, 0x5b, 0x69, 0x3e, 0x84, 0xdc, 0xb5, 0xb2, 0xb1,
+	0xdd, 0xb8, 0x17, 0xa3, 0xb7, 0xc3, 0x02, 0x3a, 0x77, 0x2b, 0xad, 0xa6, 0x05, 0x81, 0x70, 0xac,
+	0xc6, 0x10, 0xd8, 0x8e, 0x4f, 0x08, 0xd9, 0x0e, 0xff, 0x83, 0x67, 0x64, 0x21, 0xdf, 0xb9, 0x1b,
+	0xb1, 0x64, 0x26, 0x7a, 0xe8, 0xbe, 0x5a, 0x5d, 0xab, 0x8c, 0x7b, 0xd4, 0xd7, 0x03, 0x9e, 0x81,
+	0x5f, 0xa6, 0x6b, 0x59, 0x36, 0xdc, 0x8f, 0x26, 0x49, 0x20, 0x06, 0xea, 0xba, 0x4b, 0xb5, 0x55,
+	0x96, 0x4f, 0x23, 0x96, 0x78, 0xa2, 0x07, 0x5c, 0xc0, 0x2c, 0xd3, 0x95, 0x55, 0x55, 0x2b, 0xf9,
+	0x8c, 0xc6, 0xec, 0xb9, 0xab, 0xad, 0xd3, 0x6c, 0xf3, 0x96, 0x9a, 0x9c, 0x07, 0xb4, 0x78, 0xcf,
+	0x71, 0x0b, 0xf3, 0xa7, 0x54, 0x95, 0xa3, 0x25, 0x92, 0xcb, 0x8e, 0xe4, 0x3a, 0x27, 0xe5, 0x4e,
+	0x4e, 0xcb, 0x75, 0x7f, 0xcb, 0x6d, 0x54, 0x95, 0xc9, 0xd1, 0x1c, 0xc1, 0xd5, 0x27, 0x03, 0xef,
+	0xfe, 0xf6, 0x4e, 0x17, 0xb8, 0x04, 0xb7, 0xfb, 0xff, 0xf8, 0x67, 0xd5, 0x47, 0xd9, 0x47, 0xb7,
+	0xf8, 0x37, 0xe0, 0x61, 0x36, 0x09, 0xc3, 0x0b, 0xf0, 0x28, 0x02, 0x1c, 0xeb, 0x87, 0x81, 0x2c,
+	0x7e, 0xce, 0xb8, 0x64, 0x78, 0x0e, 0x6e, 0xe7, 0x0e, 0x71, 0x28, 0x1c, 0x58, 0x3d, 0x6a, 0xbe,
+	0xf1, 0x9f, 0xdd, 0xc2, 0xd4, 0xd9, 0xda, 0xa7, 0xd7, 0x74, 0xfd, 0x3d, 0x00, 0x36, 0x64, 0x12,
+	0xd0, 0x5c, 0x02, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// OKLogClient is the client API for OKLog service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type OKLogClient interface {
+	// Push writes the records of the stream to the ingester, as a
+	// connection to the durable writer does, and returns once they're all
+	// synced, or the ingester fails.
+	Push(ctx context.Context, opts ...grpc.CallOption) (OKLog_PushClient, error)
+	// Query returns the records of a user query, as the HTTP query API
+	// does. If there are more pages, the continue token is in the trailer.
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (OKLog_QueryClient, error)
+	// Tail streams the records, as they're replicated, that match, until
+	// the call is canceled, as the HTTP stream API does.
+	Tail(ctx context.Context, in *TailRequest, opts ...grpc.CallOption) (OKLog_TailClient, error)
+}
+
+type oKLogClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewOKLogClient(cc *grpc.ClientConn) OKLogClient {
+	return &oKLogClient{cc}
+}
+
+func (c *oKLogClient) Push(ctx context.Context, opts ...grpc.CallOption) (OKLog_PushClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_OKLog_serviceDesc.Streams[0], "/oklog.OKLog/Push", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &oKLogPushClient{stream}
+	return x, nil
+}
+
+type OKLog_PushClient interface {
+	Send(*Record) error
+	CloseAndRecv() (*PushResponse, error)
+	grpc.ClientStream
+}
+
+type oKLogPushClient struct {
+	grpc.ClientStream
+}
+
+func (x *oKLogPushClient) Send(m *Record) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *oKLogPushClient) CloseAndRecv() (*PushResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(PushResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *oKLogClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (OKLog_QueryClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_OKLog_serviceDesc.Streams[1], "/oklog.OKLog/Query", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &oKLogQueryClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type OKLog_QueryClient interface {
+	Recv() (*Record, error)
+	grpc.ClientStream
+}
+
+type oKLogQueryClient struct {
+	grpc.ClientStream
+}
+
+func (x *oKLogQueryClient) Recv() (*Record, error) {
+	m := new(Record)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *oKLogClient) Tail(ctx context.Context, in *TailRequest, opts ...grpc.CallOption) (OKLog_TailClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_OKLog_serviceDesc.Streams[2], "/oklog.OKLog/Tail", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &oKLogTailClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type OKLog_TailClient interface {
+	Recv() (*Record, error)
+	grpc.ClientStream
+}
+
+type oKLogTailClient struct {
+	grpc.ClientStream
+}
+
+func (x *oKLogTailClient) Recv() (*Record, error) {
+	m := new(Record)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// OKLogServer is the server API for OKLog service.
+type OKLogServer interface {
+	// Push writes the records of the stream to the ingester, as a
+	// connection to the durable writer does, and returns once they're all
+	// synced, or the ingester fails.
+	Push(OKLog_PushServer) error
+	// Query returns the records of a user query, as the HTTP query API
+	// does. If there are more pages, the continue token is in the trailer.
+	Query(*QueryRequest, OKLog_QueryServer) error
+	// Tail streams the records, as they're replicated, that match, until
+	// the call is canceled, as the HTTP stream API does.
+	Tail(*TailRequest, OKLog_TailServer) error
+}
+
+// UnimplementedOKLogServer can be embedded to have forward compatible implementations.
+type UnimplementedOKLogServer struct {
+}
+
+func (*UnimplementedOKLogServer) Push(srv OKLog_PushServer) error {
+	return status.Errorf(codes.Unimplemented, "method Push not implemented")
+}
+func (*UnimplementedOKLogServer) Query(req *QueryRequest, srv OKLog_QueryServer) error {
+	return status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+func (*UnimplementedOKLogServer) Tail(req *TailRequest, srv OKLog_TailServer) error {
+	return status.Errorf(codes.Unimplemented, "method Tail not implemented")
+}
+
+func RegisterOKLogServer(s *grpc.Server, srv OKLogServer) {
+	s.RegisterService(&_OKLog_serviceDesc, srv)
+}
+
+func _OKLog_Push_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(OKLogServer).Push(&oKLogPushServer{stream})
+}
+
+type OKLog_PushServer interface {
+	SendAndClose(*PushResponse) error
+	Recv() (*Record, error)
+	grpc.ServerStream
+}
+
+type oKLogPushServer struct {
+	grpc.ServerStream
+}
+
+func (x *oKLogPushServer) SendAndClose(m *PushResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *oKLogPushServer) Recv() (*Record, error) {
+	m := new(Record)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _OKLog_Query_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OKLogServer).Query(m, &oKLogQueryServer{stream})
+}
+
+type OKLog_QueryServer interface {
+	Send(*Record) error
+	grpc.ServerStream
+}
+
+type oKLogQueryServer struct {
+	grpc.ServerStream
+}
+
+func (x *oKLogQueryServer) Send(m *Record) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _OKLog_Tail_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TailRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OKLogServer).Tail(m, &oKLogTailServer{stream})
+}
+
+type OKLog_TailServer interface {
+	Send(*Record) error
+	grpc.ServerStream
+}
+
+type oKLogTailServer struct {
+	grpc.ServerStream
+}
+
+func (x *oKLogTailServer) Send(m *Record) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _OKLog_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "oklog.OKLog",
+	HandlerType: (*OKLogServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Push",
+			Handler:       _OKLog_Push_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Query",
+			Handler:       _OKLog_Query_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Tail",
+			Handler:       _OKLog_Tail_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "oklog.proto",
+}
@@ -0,0 +1,421 @@
+// Package grpc serves the ingest and query APIs over gRPC, for clients that
+// would sooner use protobuf types than the text protocols. The generated
+// client is in oklog.pb.go; regenerate it from oklog.proto, with protoc and
+// protoc-gen-go, with plugins=grpc.
+//
+// The server is a thin adapter over the text protocols, so records are the
+// same either way. Each push is a connection to the ingester, taken from the
+// Listener by ingest.HandleConnections, and each query or tail is a request
+// to the store API.
+package grpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/oklog/ulid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// Trailer keys of Query.
+const (
+	TrailerContinue   = "oklog-continue"    // the continue token of the next page, if there is one
+	TrailerErrorCount = "oklog-error-count" // of store nodes that failed, if any
+)
+
+// Server implements OKLogServer with the APIs of a node.
+type Server struct {
+	ingest bool
+	store  http.Handler
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+	pushes uint64 // to tell their connections apart; atomic
+}
+
+// NewServer returns a Server. If ingest is set, pushes are served by whatever
+// accepts connections from the Listener. Queries and tails are served by the
+// store API, which is nil on nodes without one. Either unset is Unimplemented.
+func NewServer(ingest bool, store http.Handler) *Server {
+	return &Server{
+		ingest: ingest,
+		store:  store,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+// Push implements OKLogServer. The records are framed, so they may contain
+// newlines, and acknowledged, so Push knows once they're synced.
+func (s *Server) Push(stream OKLog_PushServer) error {
+	if !s.ingest {
+		return status.Error(codes.Unimplemented, "not an ingest node")
+	}
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := pushConn{server, pushAddr(fmt.Sprintf("%s#%d", peerAddr(stream.Context()), atomic.AddUint64(&s.pushes, 1)))}
+	select {
+	case s.conns <- conn:
+	case <-s.closed:
+		return status.Error(codes.Unavailable, "ingester going away")
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	}
+
+	// The ingester's replies are read as they come, so it never waits on us.
+	var (
+		acks   = make(chan uint64, 1)
+		hangup = make(chan error, 1)
+	)
+	go func() { hangup <- readReplies(client, acks) }()
+
+	if _, err := io.WriteString(client, ingest.AckHandshake+"\n"+record.FramingHandshake+"\n"); err != nil {
+		return hangupError(<-hangup)
+	}
+	var sent uint64
+	for {
+		rec, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := client.Write(record.AppendFrame(nil, rec.Data)); err != nil {
+			return hangupError(<-hangup)
+		}
+		sent++
+	}
+
+	// Records written, but not yet acknowledged, would be lost if we closed
+	// the connection now.
+	var acked uint64
+	for acked < sent {
+		select {
+		case acked = <-acks:
+		case err := <-hangup:
+			select {
+			case acked = <-acks:
+			default:
+			}
+			if acked < sent {
+				return hangupError(err)
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+	return stream.SendAndClose(&PushResponse{Records: acked})
+}
+
+// readReplies reads the ingester's replies to a push until it hangs up, and
+// returns why. The latest acknowledgement is sent to acks, replacing any that
+// wasn't received.
+func readReplies(r io.Reader, acks chan uint64) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		switch line := s.Text(); {
+		case line == ingest.GoAway:
+			return status.Error(codes.Unavailable, "ingester going away")
+		case strings.HasPrefix(line, ingest.QuotaExceeded+" "):
+			return status.Error(codes.ResourceExhausted, strings.TrimPrefix(line, ingest.QuotaExceeded+" "))
+		case strings.HasPrefix(line, ingest.ClockSkewed+" "):
+			return status.Error(codes.Unavailable, strings.TrimPrefix(line, ingest.ClockSkewed+" "))
+		case strings.HasPrefix(line, ingest.Ack+" "):
+			n, err := strconv.ParseUint(strings.TrimPrefix(line, ingest.Ack+" "), 10, 64)
+			if err != nil {
+				return status.Errorf(codes.Internal, "bad acknowledgement %q", line)
+			}
+			select {
+			case <-acks:
+			default:
+			}
+			acks <- n // we're its only sender
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// hangupError is the status of a push the ingester hung up on.
+func hangupError(err error) error {
+	if _, ok := status.FromError(err); ok && err != io.EOF {
+		return err
+	}
+	return status.Error(codes.Unavailable, "ingester hung up")
+}
+
+// Listener returns the listener of the connections of pushes. Closing it
+// fails pushes not yet accepted.
+func (s *Server) Listener() net.Listener {
+	return listener{s}
+}
+
+type listener struct{ s *Server }
+
+func (l listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.s.conns:
+		return conn, nil
+	case <-l.s.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (l listener) Close() error {
+	l.s.once.Do(func() { close(l.s.closed) })
+	return nil
+}
+
+func (l listener) Addr() net.Addr { return pushAddr("grpc") }
+
+var errListenerClosed = status.Error(codes.Unavailable, "listener closed")
+
+// pushConn is the ingester's end of a push. Its address is that of the
+// client, and a counter, since ingest.HandleConnections tells connections
+// apart by their addresses.
+type pushConn struct {
+	net.Conn
+	addr pushAddr
+}
+
+func (c pushConn) RemoteAddr() net.Addr { return c.addr }
+
+type pushAddr string
+
+func (a pushAddr) Network() string { return "grpc" }
+func (a pushAddr) String() string  { return string(a) }
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return "unknown"
+}
+
+// Query implements OKLogServer.
+func (s *Server) Query(req *QueryRequest, stream OKLog_QueryServer) error {
+	if s.store == nil {
+		return status.Error(codes.Unimplemented, "not a store node")
+	}
+	v := url.Values{}
+	setValues(v, "from", req.From)
+	setValues(v, "to", req.To)
+	setValues(v, "q", req.Q)
+	setValues(v, "topic", req.Topic)
+	setValues(v, "label", req.Labels...)
+	setValues(v, "continue", req.Continue)
+	if req.Regex {
+		v.Set("regex", "")
+	}
+	if req.Limit > 0 {
+		v.Set("limit", strconv.Itoa(int(req.Limit)))
+	}
+	if req.Backward {
+		v.Set("direction", "backward")
+	}
+	resp := s.serveStore(stream.Context(), store.APIPathUserQuery, v)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return storeError(resp)
+	}
+	var qr store.QueryResult
+	if err := qr.DecodeFrom(resp); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer qr.Records.Close()
+	if err := sendRecords(bufio.NewReader(qr.Records), stream.Send); err != nil {
+		return err
+	}
+	trailer := metadata.MD{}
+	if qr.Continue != "" {
+		trailer.Set(TrailerContinue, qr.Continue)
+	}
+	if qr.ErrorCount > 0 {
+		trailer.Set(TrailerErrorCount, strconv.Itoa(qr.ErrorCount))
+	}
+	stream.SetTrailer(trailer)
+	return nil
+}
+
+// Tail implements OKLogServer.
+func (s *Server) Tail(req *TailRequest, stream OKLog_TailServer) error {
+	if s.store == nil {
+		return status.Error(codes.Unimplemented, "not a store node")
+	}
+	v := url.Values{}
+	setValues(v, "q", req.Q)
+	setValues(v, "topic", req.Topic)
+	setValues(v, "label", req.Labels...)
+	setValues(v, "since", req.Since)
+	if req.Regex {
+		v.Set("regex", "")
+	}
+	resp := s.serveStore(stream.Context(), store.APIPathUserStream, v)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return storeError(resp)
+	}
+	if err := sendRecords(bufio.NewReader(resp.Body), stream.Send); err != nil {
+		return err
+	}
+	return stream.Context().Err() // the stream only ends once it's canceled
+}
+
+func setValues(v url.Values, key string, values ...string) {
+	for _, value := range values {
+		if value != "" {
+			v.Add(key, value)
+		}
+	}
+}
+
+// sendRecords sends the records of a query or stream response, as they're
+// read. Other lines, like heartbeats, are skipped.
+func sendRecords(br *bufio.Reader, send func(*Record) error) error {
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > ulid.EncodedSize && line[ulid.EncodedSize] == ' ' {
+			rec := &Record{
+				Id:   string(line[:ulid.EncodedSize]),
+				Data: recordData(line[ulid.EncodedSize+1:]),
+			}
+			if err := send(rec); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+	}
+}
+
+// recordData is the record as it was ingested, given the line it's stored
+// as, without its ULID.
+func recordData(line []byte) []byte {
+	return record.Unescape(bytes.TrimSuffix(line, []byte{'\n'}))
+}
+
+// storeError is the status of a failed store API response.
+func storeError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	code := codes.Internal
+	switch resp.StatusCode {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	}
+	return status.Errorf(code, "store API: %s: %s", resp.Status, bytes.TrimSpace(body))
+}
+
+// serveStore makes a GET request of the store API, in process, and returns
+// the response as soon as its headers are written. The body is streamed as
+// it's written, and the request is canceled with the context.
+func (s *Server) serveStore(ctx context.Context, path string, v url.Values) *http.Response {
+	req, err := http.NewRequest("GET", path+"?"+v.Encode(), nil)
+	if err != nil {
+		panic(err) // only our own path and values
+	}
+	req = req.WithContext(ctx)
+	req.RemoteAddr = peerAddr(ctx)
+
+	pr, pw := io.Pipe()
+	w := &pipeResponseWriter{
+		header:  http.Header{},
+		resp:    &http.Response{Status: "200 OK", StatusCode: http.StatusOK, Body: pr, Trailer: http.Header{}},
+		body:    pw,
+		started: make(chan struct{}),
+	}
+	go func() {
+		s.store.ServeHTTP(w, req)
+		w.finish()
+		pw.Close()
+	}()
+	<-w.started
+	return w.resp
+}
+
+// pipeResponseWriter writes a handler's response to an http.Response, whose
+// body is the read end of the pipe.
+type pipeResponseWriter struct {
+	header  http.Header
+	resp    *http.Response
+	body    *io.PipeWriter
+	started chan struct{} // closed once the headers are written
+	wrote   bool
+}
+
+func (w *pipeResponseWriter) Header() http.Header { return w.header }
+
+func (w *pipeResponseWriter) WriteHeader(code int) {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	w.resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(code))
+	w.resp.StatusCode = code
+	w.resp.Header = copyHeader(w.header)
+	close(w.started)
+}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+func (w *pipeResponseWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+}
+
+// finish writes the headers, if the handler didn't, and the trailers it
+// declared, before the body is closed.
+func (w *pipeResponseWriter) finish() {
+	w.WriteHeader(http.StatusOK)
+	for _, keys := range w.resp.Header["Trailer"] {
+		for _, key := range strings.Split(keys, ",") {
+			key = http.CanonicalHeaderKey(strings.TrimSpace(key))
+			if values, ok := w.header[key]; ok {
+				w.resp.Trailer[key] = values
+			}
+		}
+	}
+	for key, values := range w.header {
+		if strings.HasPrefix(key, http.TrailerPrefix) {
+			w.resp.Trailer[http.CanonicalHeaderKey(strings.TrimPrefix(key, http.TrailerPrefix))] = values
+		}
+	}
+}
+
+func copyHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
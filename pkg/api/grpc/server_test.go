@@ -0,0 +1,288 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+func TestPushQueryHTTP(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+	defer f.close()
+
+	// Records pushed over gRPC are stored as if they were written over TCP,
+	// so queries over HTTP find them, newlines and all.
+	records := []string{"topic first record", "topic second\nrecord", "topic third record"}
+	push, err := f.client.Push(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range records {
+		if err := push.Send(&Record{Data: []byte(data)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err := push.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := uint64(len(records)), resp.Records; want != have {
+		t.Errorf("Push: want %d records, have %d", want, have)
+	}
+	f.replicateIngested(t, len(records))
+
+	httpResp, err := http.Get(f.server.URL + "/store" + store.APIPathUserQuery + "?from=2000-01-01T00:00:00Z&to=2100-01-01T00:00:00Z&q=record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var qr store.QueryResult
+	if err := qr.DecodeFrom(httpResp); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := ioutil.ReadAll(qr.Records)
+	qr.Records.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have []string
+	for _, line := range strings.SplitAfter(string(lines), "\n") {
+		if line != "" {
+			have = append(have, string(recordData([]byte(line[27:]))))
+		}
+	}
+	if want, have := strings.Join(records, "|"), strings.Join(have, "|"); want != have {
+		t.Errorf("HTTP query: want %q, have %q", want, have)
+	}
+}
+
+func TestReplicateQueryGRPC(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+	defer f.close()
+
+	// Records written over HTTP are found by queries over gRPC.
+	f.replicate(t, segment)
+	query, err := f.client.Query(context.Background(), &QueryRequest{
+		From:  "01BB6RQR190000000000000000",
+		To:    "01BB6RXQ090000000000000000",
+		Q:     "Beta",
+		Limit: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have []string
+	for {
+		rec, err := query.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		have = append(have, rec.Id+" "+string(rec.Data))
+	}
+	if want, have := "01BB6RRTB70000000000000000 Beta", strings.Join(have, "|"); want != have {
+		t.Errorf("Query: want %q, have %q", want, have)
+	}
+	if have := query.Trailer().Get(TrailerContinue); len(have) != 1 || have[0] == "" {
+		t.Errorf("Query: want a continue token, have %v", have)
+	}
+
+	// Records replicated once a tail starts are sent to it.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tail, err := f.client.Tail(ctx, &TailRequest{Q: "Tailed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailed := make(chan *Record, 1)
+	go func() {
+		rec, err := tail.Recv()
+		if err != nil {
+			t.Error(err)
+			close(tailed)
+			return
+		}
+		tailed <- rec
+	}()
+	for i := 0; ; i++ {
+		f.replicate(t, fmt.Sprintf("01BB6S%020d Tailed\n", i))
+		select {
+		case rec := <-tailed:
+			if rec == nil {
+				return
+			}
+			if want, have := "Tailed", string(rec.Data); want != have {
+				t.Errorf("Tail: want %q, have %q", want, have)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for tail")
+		}
+	}
+}
+
+const segment = "" +
+	"01BB6RQR190000000000000000 Alpha\n" +
+	"01BB6RRTB70000000000000000 Beta\n" +
+	"01BB6RSR1W0000000000000000 Beta\n" +
+	"01BB6RT5GR0000000000000000 Gamma\n"
+
+// fixture is an ingest and store node, serving gRPC, with its store API
+// mounted at /store/ of an HTTP server.
+type fixture struct {
+	ingestLog ingest.Log
+	storeAPI  *store.API
+	server    *httptest.Server
+	grpc      *grpc.Server
+	ln        net.Listener
+	conn      *grpc.ClientConn
+	client    OKLogClient
+	push      net.Listener
+}
+
+func newFixture(t *testing.T) *fixture {
+	ingestLog, err := ingest.NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeLog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, store.FileLogConfig{Reporter: store.LogReporter{Logger: log.NewNopLogger()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		peer     = &selfPeer{}
+		mux      = http.NewServeMux()
+		storeAPI = store.NewAPI(peer, storeLog, store.APIConfig{
+			QueryClient:        http.DefaultClient,
+			StreamClient:       http.DefaultClient,
+			ReplicatedSegments: prometheus.NewCounter(prometheus.CounterOpts{}),
+			ReplicatedBytes:    prometheus.NewCounter(prometheus.CounterOpts{}),
+			Duration:           prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"}),
+			Reporter:           store.LogReporter{Logger: log.NewNopLogger()},
+		})
+	)
+	mux.Handle("/store/", http.StripPrefix("/store", storeAPI))
+	server := httptest.NewServer(mux)
+	peer.addr = strings.TrimPrefix(server.URL, "http://")
+
+	api := NewServer(true, storeAPI)
+	push := api.Listener()
+	go ingest.HandleConnections(push, ingest.ConnectionConfig{
+		Handler:          ingest.HandleDurableWriter,
+		ReaderFactory:    record.NewDynamicReader,
+		Log:              ingestLog,
+		SegmentFlushAge:  10 * time.Millisecond,
+		SegmentFlushSize: 1024 * 1024,
+		CommitLatency:    10 * time.Millisecond,
+		CommitBytes:      1024,
+		ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+		Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+		Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	RegisterOKLogServer(s, api)
+	go s.Serve(ln)
+	conn, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fixture{
+		ingestLog: ingestLog,
+		storeAPI:  storeAPI,
+		server:    server,
+		grpc:      s,
+		ln:        ln,
+		conn:      conn,
+		client:    NewOKLogClient(conn),
+		push:      push,
+	}
+}
+
+// replicateIngested moves ingested segments to the store, until it has the
+// given number of records.
+func (f *fixture) replicateIngested(t *testing.T, records int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for records > 0 {
+		s, err := f.ingestLog.Oldest()
+		if err == ingest.ErrNoSegmentsAvailable && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := ioutil.ReadAll(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.replicate(t, string(buf))
+		if err := s.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		records -= bytes.Count(buf, []byte{'\n'})
+	}
+}
+
+func (f *fixture) replicate(t *testing.T, segment string) {
+	resp, err := http.Post(f.server.URL+"/store"+store.APIPathReplicate, "text/plain", bytes.NewReader([]byte(segment)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		t.Fatalf("Replicate failed: HTTP %d: %s", resp.StatusCode, body)
+	}
+}
+
+func (f *fixture) close() {
+	f.conn.Close()
+	f.grpc.Stop()
+	f.push.Close()
+	f.server.Close()
+	f.storeAPI.Close()
+}
+
+// selfPeer is a cluster of one node, at addr.
+type selfPeer struct{ addr string }
+
+func (p *selfPeer) Current(t cluster.PeerType) []string {
+	if t == cluster.PeerTypeStore {
+		return []string{p.addr}
+	}
+	return nil
+}
+func (*selfPeer) Zones(cluster.PeerType) map[string]string { return map[string]string{} }
+func (*selfPeer) State() map[string]interface{}            { return map[string]interface{}{} }
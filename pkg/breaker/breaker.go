@@ -0,0 +1,168 @@
+// Package breaker keeps a circuit breaker per peer, so that clients stop
+// trying a peer that keeps failing, for a while, rather than wait on it, or
+// pile retries onto it, every time.
+package breaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// State of a peer's breaker.
+type State int
+
+// Breakers start closed, and trip open after enough failures. Once the
+// cool-down has passed, they're half-open: a single probe is let through, and
+// it closes the breaker if it succeeds, or trips it again if it fails.
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// Policy describes when a peer's breaker trips: after Failures consecutive
+// failures, within Window of the first of them. It stays open for Cooldown,
+// and a probe that hasn't reported back within Cooldown is taken as lost, so
+// that another may be let through.
+type Policy struct {
+	Failures int
+	Window   time.Duration
+	Cooldown time.Duration
+}
+
+// Set is the breakers of the peers, by address, e.g. API host:port. It's safe
+// for concurrent use, and meant to be shared by every client of the peers.
+// A nil *Set is valid, and lets everything through.
+type Set struct {
+	policy Policy
+	state  *prometheus.GaugeVec
+	now    func() time.Time
+
+	mtx   sync.Mutex
+	peers map[string]*peer // those with failures, or not closed
+}
+
+type peer struct {
+	state    State
+	failures int
+	since    time.Time // of the first failure, or when the state began
+}
+
+// NewSet returns the breakers of the policy. The state gauge, labeled by peer,
+// is set to each peer's state, once it's seen a failure: 0 for closed, 1 for
+// half-open, and 2 for open. If the policy's Failures is zero, NewSet returns
+// nil, which lets everything through.
+func NewSet(policy Policy, state *prometheus.GaugeVec) *Set {
+	if policy.Failures <= 0 {
+		return nil
+	}
+	return &Set{
+		policy: policy,
+		state:  state,
+		now:    time.Now,
+		peers:  map[string]*peer{},
+	}
+}
+
+// Allow reports whether to try the peer. A peer whose breaker is open is
+// skipped until the cool-down has passed; then, Allow lets a single probe
+// through, and skips the peer again until the probe's outcome is reported.
+// Every try that's allowed must report its outcome, with Success or Failure.
+func (s *Set) Allow(addr string) bool {
+	if s == nil {
+		return true
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	p, ok := s.peers[addr]
+	if !ok || p.state == Closed {
+		return true
+	}
+	if s.now().Sub(p.since) < s.policy.Cooldown {
+		return false // open, or half-open with a probe out
+	}
+	s.set(addr, p, HalfOpen) // the probe
+	return true
+}
+
+// Success reports that a try of the peer succeeded, which closes its breaker.
+func (s *Set) Success(addr string) {
+	if s == nil {
+		return
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	p, ok := s.peers[addr]
+	if !ok {
+		return
+	}
+	if p.state != Closed {
+		s.set(addr, p, Closed)
+	}
+	delete(s.peers, addr)
+}
+
+// Failure reports that a try of the peer failed. Enough of them trip its
+// breaker; a failed probe trips it again straight away.
+func (s *Set) Failure(addr string) {
+	if s == nil {
+		return
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	now := s.now()
+	p, ok := s.peers[addr]
+	if !ok {
+		p = &peer{state: Closed}
+		s.peers[addr] = p
+		s.state.WithLabelValues(addr).Set(float64(Closed))
+	}
+	switch p.state {
+	case Closed:
+		if p.failures == 0 || now.Sub(p.since) > s.policy.Window {
+			p.failures, p.since = 0, now
+		}
+		p.failures++
+		if p.failures >= s.policy.Failures {
+			s.set(addr, p, Open)
+		}
+	case HalfOpen:
+		s.set(addr, p, Open)
+	case Open:
+		// A try from before it tripped.
+	}
+}
+
+// State returns the state of the peer's breaker.
+func (s *Set) State(addr string) State {
+	if s == nil {
+		return Closed
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if p, ok := s.peers[addr]; ok {
+		return p.state
+	}
+	return Closed
+}
+
+// set the state of the peer, from now. The mutex must be held.
+func (s *Set) set(addr string, p *peer, state State) {
+	p.state, p.failures, p.since = state, 0, s.now()
+	s.state.WithLabelValues(addr).Set(float64(state))
+}
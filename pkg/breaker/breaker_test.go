@@ -0,0 +1,105 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSet(t *testing.T) {
+	t.Parallel()
+
+	var (
+		state = prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"peer"})
+		s     = NewSet(Policy{Failures: 3, Window: time.Minute, Cooldown: 10 * time.Second}, state)
+		now   = time.Unix(1000, 0)
+	)
+	s.now = func() time.Time { return now }
+	check := func(step string, want State, allow bool) {
+		t.Helper()
+		if have := s.State("a:1"); want != have {
+			t.Errorf("%s: state: want %s, have %s", step, want, have)
+		}
+		if want, have := float64(want), gaugeOf(state, "a:1"); want != have {
+			t.Errorf("%s: gauge: want %v, have %v", step, want, have)
+		}
+		if have := s.Allow("a:1"); allow != have {
+			t.Errorf("%s: allow: want %v, have %v", step, allow, have)
+		}
+	}
+
+	// Failures that aren't consecutive, or within the window, don't trip it.
+	s.Failure("a:1")
+	s.Failure("a:1")
+	s.Success("a:1")
+	s.Failure("a:1")
+	s.Failure("a:1")
+	now = now.Add(2 * time.Minute)
+	s.Failure("a:1")
+	check("scattered failures", Closed, true)
+
+	// Enough of them do, until the cool-down has passed.
+	s.Failure("a:1")
+	s.Failure("a:1")
+	check("tripped", Open, false)
+	now = now.Add(5 * time.Second)
+	check("cooling down", Open, false)
+
+	// Then a single probe goes through, which trips it again if it fails.
+	now = now.Add(5 * time.Second)
+	if !s.Allow("a:1") {
+		t.Error("probe: want allowed")
+	}
+	check("probing", HalfOpen, false)
+	s.Failure("a:1")
+	check("failed probe", Open, false)
+
+	// A probe that never reports back is taken as lost, after a cool-down.
+	now = now.Add(10 * time.Second)
+	if !s.Allow("a:1") {
+		t.Error("second probe: want allowed")
+	}
+	now = now.Add(5 * time.Second)
+	check("probe out", HalfOpen, false)
+	now = now.Add(5 * time.Second)
+	if !s.Allow("a:1") {
+		t.Error("after a lost probe: want allowed")
+	}
+
+	// A probe that succeeds closes it.
+	s.Success("a:1")
+	check("recovered", Closed, true)
+	s.Failure("a:1")
+	check("fresh failure", Closed, true)
+
+	// Other peers are unaffected.
+	if want, have := Closed, s.State("b:2"); want != have {
+		t.Errorf("other peer: want %s, have %s", want, have)
+	}
+}
+
+func TestSetNil(t *testing.T) {
+	t.Parallel()
+
+	s := NewSet(Policy{}, prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"peer"}))
+	if s != nil {
+		t.Fatal("want no breakers, for no failures")
+	}
+	for i := 0; i < 10; i++ {
+		s.Failure("a:1")
+	}
+	if !s.Allow("a:1") {
+		t.Error("want everything allowed")
+	}
+	if want, have := Closed, s.State("a:1"); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
+
+func gaugeOf(g *prometheus.GaugeVec, peer string) float64 {
+	var m dto.Metric
+	g.WithLabelValues(peer).Write(&m)
+	return m.GetGauge().GetValue()
+}
@@ -0,0 +1,295 @@
+// Package canary proves the whole pipeline of a cluster works, end to end,
+// rather than just that its processes are up. Every so often, a Canary writes
+// a sentinel record to an ingester, as a forwarder would, and queries the
+// stores for it, until it's found, timing how long that took.
+package canary
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/alert"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// Topic is the topic of sentinel records, reserved for them, so they're easy
+// to tell from, and to leave out of, the records of users' queries. A
+// sentinel record is the topic, and the unique token it's queried by. To an
+// ingester with static topics, the topic is just a prefix, in the record, of
+// the token, which is found all the same.
+const Topic = "oklog-canary"
+
+const (
+	// pollInterval is how often a Canary queries the stores for its
+	// sentinel record, until it's found.
+	pollInterval = 100 * time.Millisecond
+
+	// clockSlack widens the range of those queries, either side of when the
+	// record was written, as the ingester that gives it its ULID, and so its
+	// time, may not agree with the clock of the Canary.
+	clockSlack = time.Minute
+)
+
+// These are the results of a check, as counted by a Canary.
+const (
+	resultSuccess    = "success"
+	resultWriteError = "write_error" // the ingester didn't take the record
+	resultQueryError = "query_error" // the stores couldn't be queried
+	resultMissing    = "missing"     // they could, but the record wasn't there in time
+)
+
+// Canary checks a cluster by writing sentinel records to it, and reading
+// them back. Each check takes the next of the ingesters to write to, and of
+// the stores to query, in turn, so each of them is checked, in the end. A
+// store queries every other, so the record is found wherever it was
+// replicated. As it may be replicated more than once, or the stores may
+// return it more than once, e.g. in the middle of compaction, it's enough
+// that it's found at all.
+type Canary struct {
+	ingesters        []string // fast or durable ingest listeners, as host:port
+	stores           []string // store APIs, as host:port
+	client           *http.Client
+	interval         time.Duration
+	timeout          time.Duration
+	failureThreshold int
+	bus              *alert.Bus
+	checks           *prometheus.CounterVec
+	latency          prometheus.Histogram
+	failures         prometheus.Gauge
+	logger           log.Logger
+	newToken         func() string
+	stop             chan chan struct{}
+
+	mtx         sync.Mutex // serializes checks
+	next        int        // ingester and store to check
+	consecutive int        // failed checks in a row
+	alerting    bool
+}
+
+// NewCanary returns a Canary that writes to the ingesters, and queries the
+// stores, with the client, every interval, giving up on each check after
+// timeout. Checks are counted by their result, and the latency of those that
+// succeed observed, with failures set to how many have failed in a row. Once
+// failureThreshold have, if it's positive, an alert is published to the bus,
+// which may be nil, and resolved once a check succeeds again.
+func NewCanary(
+	ingesters, stores []string,
+	client *http.Client,
+	interval, timeout time.Duration,
+	failureThreshold int,
+	bus *alert.Bus,
+	checks *prometheus.CounterVec,
+	latency prometheus.Histogram,
+	failures prometheus.Gauge,
+	logger log.Logger,
+) *Canary {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Canary{
+		ingesters:        ingesters,
+		stores:           stores,
+		client:           client,
+		interval:         interval,
+		timeout:          timeout,
+		failureThreshold: failureThreshold,
+		bus:              bus,
+		checks:           checks,
+		latency:          latency,
+		failures:         failures,
+		logger:           logger,
+		newToken:         func() string { return ulid.MustNew(ulid.Now(), rand.Reader).String() },
+		stop:             make(chan chan struct{}),
+	}
+}
+
+// Run checks the cluster every interval, starting right away, until Stop.
+func (c *Canary) Run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			c.Check(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	q := <-c.stop
+	cancel()
+	<-done
+	close(q)
+}
+
+// Stop the Canary, canceling its check in flight, if any.
+func (c *Canary) Stop() {
+	q := make(chan struct{})
+	c.stop <- q
+	<-q
+}
+
+// Check the cluster once: write a sentinel record, and query for it, until
+// it's found, or the timeout. It returns how long that took, from before it
+// was written, or why it failed. A check that's canceled, via ctx, isn't
+// counted either way.
+func (c *Canary) Check(ctx context.Context) (time.Duration, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	ingester, storeAddr := c.ingesters[c.next%len(c.ingesters)], c.stores[c.next%len(c.stores)]
+	c.next++
+
+	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	token := c.newToken()
+	begin := time.Now()
+	result, err := resultSuccess, c.write(checkCtx, ingester, token)
+	if err != nil {
+		result = resultWriteError
+	} else {
+		result, err = c.find(checkCtx, storeAddr, token, begin)
+	}
+	took := time.Since(begin)
+	if ctx.Err() != nil {
+		return took, ctx.Err() // canceled, e.g. by Stop, so it's not counted
+	}
+
+	c.checks.WithLabelValues(result).Inc()
+	if err != nil {
+		c.consecutive++
+		c.failures.Set(float64(c.consecutive))
+		level.Warn(c.logger).Log("ingester", ingester, "store", storeAddr, "token", token, "result", result, "failures", c.consecutive, "err", err)
+		if c.failureThreshold > 0 && c.consecutive >= c.failureThreshold && !c.alerting {
+			c.bus.Publish(alert.Event{
+				Type:    alert.CanaryFailing,
+				Message: fmt.Sprintf("%d canary checks in a row failed", c.consecutive),
+				Details: map[string]string{"failures": strconv.Itoa(c.consecutive), "error": err.Error()},
+			})
+			c.alerting = true
+		}
+		return took, err
+	}
+	c.latency.Observe(took.Seconds())
+	if c.alerting {
+		c.bus.Publish(alert.Event{
+			Type:     alert.CanaryFailing,
+			Resolved: true,
+			Message:  fmt.Sprintf("canary check succeeded, after %d failed", c.consecutive),
+			Details:  map[string]string{"failures": strconv.Itoa(c.consecutive)},
+		})
+		c.alerting = false
+	}
+	c.consecutive = 0
+	c.failures.Set(0)
+	level.Debug(c.logger).Log("ingester", ingester, "store", storeAddr, "token", token, "result", result, "took", took)
+	return took, nil
+}
+
+// write the sentinel record of the token to the ingester. Like a forwarder,
+// it closes its side of the connection once it's written, and the ingester
+// closes its own once the record is in its log.
+func (c *Canary) write(ctx context.Context, ingester, token string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", ingester)
+	if err != nil {
+		return errors.Wrap(err, "dialing ingester")
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := fmt.Fprintf(conn, "%s %s\n", Topic, token); err != nil {
+		return errors.Wrap(err, "writing sentinel record")
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+	if _, err := ioutil.ReadAll(conn); err != nil {
+		return errors.Wrap(err, "waiting for ingester")
+	}
+	return nil
+}
+
+// find the sentinel record of the token, written at about begin, querying the
+// store every pollInterval, until it's there, or ctx is done. It returns the
+// result of the check, and if it failed, the error of the latest query.
+func (c *Canary) find(ctx context.Context, storeAddr, token string, begin time.Time) (string, error) {
+	uri := fmt.Sprintf(
+		"http://%s/store%s?from=%s&to=%s&q=%s",
+		storeAddr, store.APIPathUserQuery,
+		url.QueryEscape(begin.Add(-clockSlack).UTC().Format(time.RFC3339Nano)),
+		url.QueryEscape(begin.Add(c.timeout+clockSlack).UTC().Format(time.RFC3339Nano)),
+		url.QueryEscape(token),
+	)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		n, err := c.query(ctx, uri, token)
+		if err == nil && n > 0 {
+			return resultSuccess, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if err != nil {
+				return resultQueryError, err
+			}
+			return resultMissing, errors.Errorf("sentinel record not found after %s", time.Since(begin))
+		}
+	}
+}
+
+// query the store, and return how many times the sentinel record of the
+// token is in the results.
+func (c *Canary) query(ctx context.Context, uri, token string) (int, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, errors.Wrap(err, "querying store")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		buf, _ := ioutil.ReadAll(resp.Body)
+		return 0, errors.Errorf("querying store: %s: %s", resp.Status, strings.TrimSpace(string(buf)))
+	}
+	var result store.QueryResult
+	if err := result.DecodeFrom(resp); err != nil {
+		return 0, errors.Wrap(err, "decoding query result")
+	}
+	defer result.Records.Close()
+	var (
+		n    int
+		want = " " + Topic + " " + token // after the ULID, or the static topic
+		s    = record.NewScanner(result.Records)
+	)
+	for s.Scan() {
+		if strings.HasSuffix(s.Text(), want) {
+			n++
+		}
+	}
+	return n, errors.Wrap(s.Err(), "reading query result")
+}
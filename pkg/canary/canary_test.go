@@ -0,0 +1,180 @@
+package canary
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/alert"
+	"github.com/oklog/oklog/pkg/clustertest"
+)
+
+func TestCanary(t *testing.T) {
+	t.Parallel()
+
+	c, err := clustertest.Start(1, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	canary, m := newTestCanary(c, []string{c.Ingesters[0].IngestAddr}, 0, nil)
+
+	// The sentinel record makes it through, from the ingester to the stores.
+	took, err := canary.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if took <= 0 {
+		t.Errorf("want a latency, have %s", took)
+	}
+
+	// A sentinel record that's there more than once, e.g. as it was
+	// written again, is found all the same.
+	canary.newToken = func() string { return "twice" }
+	if err := c.WriteRecords(Topic + " twice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := canary.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := 2., counterValue(t, m.checks.WithLabelValues(resultSuccess)); want != have {
+		t.Errorf("want %v successful checks, have %v", want, have)
+	}
+	if want, have := uint64(2), histogramCount(t, m.latency); want != have {
+		t.Errorf("want %d latencies observed, have %d", want, have)
+	}
+}
+
+func TestCanaryFailures(t *testing.T) {
+	t.Parallel()
+
+	c, err := clustertest.Start(1, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Checks go to each ingester in turn. The first two are down, so the
+	// first two checks fail, raising an alert, and the third resolves it.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := ln.Addr().String()
+	ln.Close()
+	var (
+		sink = &recordingSink{}
+		bus  = alert.NewBus("canary", []alert.Sink{sink}, 8, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}), log.NewNopLogger())
+	)
+	go bus.Run()
+	defer bus.Stop()
+	canary, m := newTestCanary(c, []string{down, down, c.Ingesters[0].IngestAddr}, 2, bus)
+
+	for i, want := range []struct {
+		ok       bool
+		failures float64
+	}{
+		{false, 1},
+		{false, 2},
+		{true, 0},
+	} {
+		_, err := canary.Check(context.Background())
+		if want, have := want.ok, err == nil; want != have {
+			t.Errorf("check %d: want ok %v, have error %v", i+1, want, err)
+		}
+		if want, have := want.failures, gaugeValue(t, m.failures); want != have {
+			t.Errorf("check %d: want %v failures in a row, have %v", i+1, want, have)
+		}
+	}
+	if want, have := 2., counterValue(t, m.checks.WithLabelValues(resultWriteError)); want != have {
+		t.Errorf("want %v write errors, have %v", want, have)
+	}
+
+	var events []alert.Event
+	for deadline := time.Now().Add(time.Second); len(events) < 2 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		events = sink.events()
+	}
+	if want, have := 2, len(events); want != have {
+		t.Fatalf("want %d alerts, have %d: %+v", want, have, events)
+	}
+	for i, resolved := range []bool{false, true} {
+		if events[i].Type != alert.CanaryFailing || events[i].Resolved != resolved {
+			t.Errorf("alert %d: want %s, resolved %v, have %s, resolved %v", i+1, alert.CanaryFailing, resolved, events[i].Type, events[i].Resolved)
+		}
+	}
+}
+
+type testMetrics struct {
+	checks   *prometheus.CounterVec
+	latency  prometheus.Histogram
+	failures prometheus.Gauge
+}
+
+// newTestCanary returns a Canary of the cluster, writing to the ingesters,
+// and querying every store, and its metrics.
+func newTestCanary(c *clustertest.Cluster, ingesters []string, failureThreshold int, bus *alert.Bus) (*Canary, testMetrics) {
+	var stores []string
+	for _, n := range c.Stores {
+		stores = append(stores, n.Addr)
+	}
+	m := testMetrics{
+		checks:   prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"result"}),
+		latency:  prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		failures: prometheus.NewGauge(prometheus.GaugeOpts{}),
+	}
+	return NewCanary(ingesters, stores, &http.Client{}, time.Minute, 10*time.Second, failureThreshold, bus, m.checks, m.latency, m.failures, nil), m
+}
+
+// recordingSink records the alerts it's notified of.
+type recordingSink struct {
+	mtx sync.Mutex
+	evs []alert.Event
+}
+
+func (s *recordingSink) Notify(ctx context.Context, e alert.Event) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.evs = append(s.evs, e)
+	return nil
+}
+
+func (s *recordingSink) events() []alert.Event {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]alert.Event(nil), s.evs...)
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func gaugeValue(t *testing.T, g prometheus.Gauge) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := g.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func histogramCount(t *testing.T, h prometheus.Histogram) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,119 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// These are the cluster API URL paths.
+const (
+	APIPathState    = "/state"
+	APIPathCapacity = "/capacity"
+)
+
+// API serves this node's view of the cluster.
+type API struct {
+	peer ClusterPeer
+}
+
+// ClusterPeer models Peer.
+type ClusterPeer interface {
+	Peers() []PeerState
+}
+
+// NewAPI returns a usable cluster API.
+func NewAPI(peer ClusterPeer) *API {
+	return &API{peer: peer}
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method, path := r.Method, r.URL.Path
+	switch {
+	case method == "GET" && path == APIPathState:
+		a.handleState(w, r)
+	case method == "GET" && path == APIPathCapacity:
+		a.handleCapacity(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleState serves the state of every peer, as JSON. It only reads what
+// memberlist and the delegate already know, so it's cheap to poll.
+func (a *API) handleState(w http.ResponseWriter, r *http.Request) {
+	var (
+		_, pretty = r.URL.Query()["pretty"]
+		peers     = a.peer.Peers()
+		buf       []byte
+		err       error
+	)
+	if pretty {
+		buf, err = json.MarshalIndent(peers, "", "    ")
+	} else {
+		buf, err = json.Marshal(peers)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(buf)
+}
+
+// ClusterCapacity is the disk usage of the store nodes in the cluster, as
+// they last gossiped it, and its total.
+type ClusterCapacity struct {
+	Nodes []NodeCapacity `json:"nodes"`
+	Total Capacity       `json:"total"`
+}
+
+// NodeCapacity is the disk usage of a store node.
+type NodeCapacity struct {
+	Name    string   `json:"name"`
+	APIAddr string   `json:"api_addr"`
+	APIPort int      `json:"api_port"`
+	Type    PeerType `json:"type"`
+	State   string   `json:"state"`
+	Zone    string   `json:"zone,omitempty"`
+	Capacity
+}
+
+// handleCapacity serves the disk usage of every live peer that gossips it,
+// as JSON. Dead peers are absent, and don't count towards the total.
+func (a *API) handleCapacity(w http.ResponseWriter, r *http.Request) {
+	var (
+		_, pretty = r.URL.Query()["pretty"]
+		res       = ClusterCapacity{Nodes: []NodeCapacity{}}
+		buf       []byte
+		err       error
+	)
+	for _, p := range a.peer.Peers() {
+		if p.Capacity == nil || p.State == PeerStateDead {
+			continue
+		}
+		res.Nodes = append(res.Nodes, NodeCapacity{
+			Name:     p.Name,
+			APIAddr:  p.APIAddr,
+			APIPort:  p.APIPort,
+			Type:     p.Type,
+			State:    p.State,
+			Zone:     p.Zone,
+			Capacity: *p.Capacity,
+		})
+		res.Total.SegmentBytes += p.Capacity.SegmentBytes
+		res.Total.TrashBytes += p.Capacity.TrashBytes
+		res.Total.CapacityBytes += p.Capacity.CapacityBytes
+		res.Total.AvailableBytes += p.Capacity.AvailableBytes
+	}
+	if pretty {
+		buf, err = json.MarshalIndent(res, "", "    ")
+	} else {
+		buf, err = json.Marshal(res)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(buf)
+}
@@ -0,0 +1,207 @@
+package cluster
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/hashicorp/memberlist"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/breaker"
+)
+
+func TestAPIState(t *testing.T) {
+	t.Parallel()
+
+	var (
+		self    = &memberlist.Node{Name: "self", Addr: net.ParseIP("10.0.0.1"), Port: 7659, PMin: 1, PMax: 5, PCur: 2}
+		leaving = &memberlist.Node{Name: "leaving", Addr: net.ParseIP("10.0.0.2"), Port: 7659, PMin: 1, PMax: 5, PCur: 2}
+		unknown = &memberlist.Node{Name: "unknown", Addr: net.ParseIP("10.0.0.3"), Port: 7659, PMin: 1, PMax: 4, PCur: 4}
+		dead    = &memberlist.Node{Name: "dead", Addr: net.ParseIP("10.0.0.4"), Port: 7659, PMin: 1, PMax: 5, PCur: 2}
+		now     = time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+	d := newDelegate(log.NewNopLogger())
+	d.now = func() time.Time { return now }
+	d.init("self", PeerTypeIngestStore, "10.0.0.1", 7650, "us-east-1a", func() int { return 3 })
+	buf, err := json.Marshal(map[string]peerInfo{
+		"leaving": {Type: PeerTypeStore, APIAddr: "10.0.0.2", APIPort: 7650, Leaving: true, Version: "1.2.3"},
+		"dead":    {Type: PeerTypeIngest, APIAddr: "10.0.0.4", APIPort: 7650, Zone: "us-east-1b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.MergeRemoteState(buf, false)
+	d.NotifyLeave(dead)
+	peer := &Peer{
+		ml: fakeMemberlist{self: self, members: []*memberlist.Node{unknown, self, leaving}},
+		d:  d,
+	}
+
+	server := httptest.NewServer(NewAPI(peer))
+	defer server.Close()
+	want := `[
+	{"name":"dead","addr":"10.0.0.4:7659","api_addr":"10.0.0.4","api_port":7650,"type":"ingest","state":"dead","zone":"us-east-1b",
+	 "protocol":{"min":1,"max":5,"current":2},"delegate_protocol":{"min":0,"max":0,"current":0}},
+	{"name":"leaving","addr":"10.0.0.2:7659","api_addr":"10.0.0.2","api_port":7650,"type":"store","state":"leaving","version":"1.2.3",
+	 "protocol":{"min":1,"max":5,"current":2},"delegate_protocol":{"min":0,"max":0,"current":0}},
+	{"name":"self","addr":"10.0.0.1:7659","api_addr":"10.0.0.1","api_port":7650,"type":"ingeststore","state":"alive","zone":"us-east-1a","version":"dev","self":true,
+	 "protocol":{"min":1,"max":5,"current":2},"delegate_protocol":{"min":0,"max":0,"current":0}},
+	{"name":"unknown","addr":"10.0.0.3:7659","api_addr":"","api_port":0,"type":"","state":"alive",
+	 "protocol":{"min":1,"max":4,"current":4},"delegate_protocol":{"min":0,"max":0,"current":0}}
+]`
+	for _, testcase := range []struct {
+		query  string
+		pretty bool
+	}{
+		{"", false},
+		{"?pretty", true},
+	} {
+		body := get(t, server.URL+APIPathState+testcase.query)
+		if want, have := testcase.pretty, strings.Contains(body, "\n    "); want != have {
+			t.Errorf("%q: want pretty=%v, have %v: %s", testcase.query, want, have, body)
+		}
+		if want, have := decode(t, want), decode(t, body); !reflect.DeepEqual(want, have) {
+			t.Errorf("%q: want %v, have %v", testcase.query, want, have)
+		}
+	}
+
+	// Dead peers are forgotten after a while.
+	now = now.Add(departureRetention + time.Second)
+	if want, have := []string{"leaving", "self", "unknown"}, names(peer.Peers()); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestPeersBreakers(t *testing.T) {
+	t.Parallel()
+
+	var (
+		self  = &memberlist.Node{Name: "self"}
+		other = &memberlist.Node{Name: "other"}
+		fine  = &memberlist.Node{Name: "fine"}
+		d     = newDelegate(log.NewNopLogger())
+	)
+	d.init("self", PeerTypeStore, "10.0.0.1", 7650, "", func() int { return 3 })
+	buf, err := json.Marshal(map[string]peerInfo{
+		"other": {Type: PeerTypeStore, APIAddr: "10.0.0.2", APIPort: 7650},
+		"fine":  {Type: PeerTypeStore, APIAddr: "10.0.0.3", APIPort: 7650},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.MergeRemoteState(buf, false)
+	peer := &Peer{ml: fakeMemberlist{self: self, members: []*memberlist.Node{self, other, fine}}, d: d}
+
+	// Without breakers, there's nothing to report.
+	for _, ps := range peer.Peers() {
+		if ps.Breaker != "" {
+			t.Errorf("%s: without breakers, want none, have %q", ps.Name, ps.Breaker)
+		}
+	}
+
+	breakers := breaker.NewSet(breaker.Policy{Failures: 1, Cooldown: time.Hour}, prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"peer"}))
+	breakers.Failure("10.0.0.2:7650")
+	peer.SetBreakers(breakers)
+	have := map[string]string{}
+	for _, ps := range peer.Peers() {
+		have[ps.Name] = ps.Breaker
+	}
+	if want := map[string]string{"self": "", "other": "open", "fine": "closed"}; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestAPICapacity(t *testing.T) {
+	t.Parallel()
+
+	var (
+		self  = &memberlist.Node{Name: "self"}
+		other = &memberlist.Node{Name: "other"}
+		old   = &memberlist.Node{Name: "old"}
+		dead  = &memberlist.Node{Name: "dead"}
+	)
+	d := newDelegate(log.NewNopLogger())
+	d.init("self", PeerTypeStore, "10.0.0.1", 7650, "us-east-1a", func() int { return 4 })
+	d.setCapacity(Capacity{SegmentBytes: 100, TrashBytes: 10, CapacityBytes: 1000, AvailableBytes: 800})
+	buf, err := json.Marshal(map[string]peerInfo{
+		"other": {Type: PeerTypeStore, APIAddr: "10.0.0.2", APIPort: 7650, Leaving: true, Disk: []int64{200, 20, 2000, 1500}},
+		"old":   {Type: PeerTypeStore, APIAddr: "10.0.0.3", APIPort: 7650}, // doesn't gossip capacity
+		"dead":  {Type: PeerTypeStore, APIAddr: "10.0.0.4", APIPort: 7650, Disk: []int64{1, 1, 1, 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.MergeRemoteState(buf, false)
+	d.NotifyLeave(dead)
+	peer := &Peer{
+		ml: fakeMemberlist{self: self, members: []*memberlist.Node{self, other, old}},
+		d:  d,
+	}
+
+	server := httptest.NewServer(NewAPI(peer))
+	defer server.Close()
+	want := `{
+	"nodes": [
+		{"name":"other","api_addr":"10.0.0.2","api_port":7650,"type":"store","state":"leaving",
+		 "segment_bytes":200,"trash_bytes":20,"capacity_bytes":2000,"available_bytes":1500},
+		{"name":"self","api_addr":"10.0.0.1","api_port":7650,"type":"store","state":"alive","zone":"us-east-1a",
+		 "segment_bytes":100,"trash_bytes":10,"capacity_bytes":1000,"available_bytes":800}
+	],
+	"total": {"segment_bytes":300,"trash_bytes":30,"capacity_bytes":3000,"available_bytes":2300}
+}`
+	if want, have := decode(t, want), decode(t, get(t, server.URL+APIPathCapacity)); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+type fakeMemberlist struct {
+	self    *memberlist.Node
+	members []*memberlist.Node
+}
+
+func (ml fakeMemberlist) LocalNode() *memberlist.Node       { return ml.self }
+func (ml fakeMemberlist) Members() []*memberlist.Node       { return ml.members }
+func (ml fakeMemberlist) NumMembers() int                   { return len(ml.members) }
+func (ml fakeMemberlist) Leave(timeout time.Duration) error { return nil }
+
+func get(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Fatalf("GET %s: want %d, have %d", url, want, have)
+	}
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("%v: %s", err, s)
+	}
+	return v
+}
+
+func names(peers []PeerState) []string {
+	var names []string
+	for _, p := range peers {
+		names = append(names, p.Name)
+	}
+	return names
+}
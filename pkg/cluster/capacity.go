@@ -0,0 +1,39 @@
+package cluster
+
+// Capacity is the disk usage of a store node's data directory, in bytes.
+type Capacity struct {
+	SegmentBytes   int64 `json:"segment_bytes"`   // of live segments
+	TrashBytes     int64 `json:"trash_bytes"`     // of trashed segments, not yet purged
+	CapacityBytes  int64 `json:"capacity_bytes"`  // of the filesystem
+	AvailableBytes int64 `json:"available_bytes"` // of the filesystem, to us
+}
+
+// SetCapacity sets the disk usage we gossip, as a store node. It isn't
+// broadcast; other peers learn about it at their next push/pull with us, or
+// with a peer that already has it. Static peers don't gossip, so only we
+// know our capacity.
+func (p *Peer) SetCapacity(c Capacity) {
+	p.d.setCapacity(c)
+}
+
+func (d *delegate) setCapacity(c Capacity) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	info := d.data[d.myName]
+	info.Disk = []int64{c.SegmentBytes, c.TrashBytes, c.CapacityBytes, c.AvailableBytes}
+	d.data[d.myName] = info
+}
+
+// capacity decodes the gossiped disk usage, which peers that don't gossip
+// it, or that speak a later version of it, don't have.
+func (info peerInfo) capacity() *Capacity {
+	if len(info.Disk) < 4 {
+		return nil
+	}
+	return &Capacity{
+		SegmentBytes:   info.Disk[0],
+		TrashBytes:     info.Disk[1],
+		CapacityBytes:  info.Disk[2],
+		AvailableBytes: info.Disk[3],
+	}
+}
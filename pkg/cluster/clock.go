@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// minClockPeers is how many peers' clocks we need to know before we can
+// tell whether ours is the one that's off. With just one, either may be.
+const minClockPeers = 2
+
+// ClockOffsets returns how far ahead of ours the clock of each peer we've
+// probed is, by API host:port. Offsets are measured by memberlist probes,
+// which carry the wall-clock time of the peer that acks them, and are
+// corrected for half the round trip. Static peers aren't probed, so they're
+// absent.
+func (p *Peer) ClockOffsets() map[string]time.Duration {
+	return p.d.clockOffsets()
+}
+
+// ClockSkew returns how far ahead of the cluster's our clock is, i.e. the
+// median of the peers' offsets, negated. ULIDs are ordered by the clocks of
+// the nodes that assign them, so a skewed ingest node misorders its records
+// against everyone else's. It's false until at least two peers are probed,
+// since with just one, it can't tell whose clock is off.
+func (p *Peer) ClockSkew() (time.Duration, bool) {
+	return p.d.clockSkew()
+}
+
+func (d *delegate) clockOffsets() map[string]time.Duration {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	res := map[string]time.Duration{}
+	for name, offset := range d.offsets {
+		if info, ok := d.data[name]; ok {
+			res[info.hostport()] = offset
+		}
+	}
+	return res
+}
+
+func (d *delegate) clockOffset(name string) (time.Duration, bool) {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	offset, ok := d.offsets[name]
+	return offset, ok
+}
+
+func (d *delegate) clockSkew() (time.Duration, bool) {
+	d.mtx.RLock()
+	offsets := make([]time.Duration, 0, len(d.offsets))
+	for _, offset := range d.offsets {
+		offsets = append(offsets, offset)
+	}
+	d.mtx.RUnlock()
+	if len(offsets) < minClockPeers {
+		return 0, false
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	median := offsets[len(offsets)/2]
+	if len(offsets)%2 == 0 && abs(offsets[len(offsets)/2-1]) < abs(median) {
+		median = offsets[len(offsets)/2-1] // the benefit of the doubt
+	}
+	return -median, true
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// AckPayload is invoked when an ack is being sent; the returned bytes will be
+// appended to the ack. It's our wall-clock time, in Unix nanoseconds.
+// Implements memberlist.PingDelegate.
+func (d *delegate) AckPayload() []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(d.now().UnixNano()))
+	return buf
+}
+
+// NotifyPingComplete is invoked when an ack for a ping is received, with the
+// other node's AckPayload. Peers that don't send their time are ignored.
+// Implements memberlist.PingDelegate.
+func (d *delegate) NotifyPingComplete(other *memberlist.Node, rtt time.Duration, payload []byte) {
+	if len(payload) != 8 {
+		return
+	}
+	var (
+		theirs = time.Unix(0, int64(binary.BigEndian.Uint64(payload)))
+		ours   = d.now().Add(-rtt / 2) // when they acked, by our clock
+	)
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if _, ok := d.data[other.Name]; !ok {
+		return // it left, or we've yet to learn about it
+	}
+	d.offsets[other.Name] = theirs.Sub(ours)
+}
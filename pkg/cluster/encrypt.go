@@ -0,0 +1,86 @@
+package cluster
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/pkg/errors"
+)
+
+// Gossip may be encrypted with symmetric keys, shared by every peer. The first
+// key is the primary, which gossip is encrypted with; the others are only
+// tried when decrypting. So keys are rotated in three steps, each applied to
+// every peer before the next: add the new key after the primary, make it the
+// primary, and remove the old key.
+
+// newKeyring returns a keyring of the keys, the first of which is primary, or
+// nil, i.e. no encryption, if there are no keys.
+func newKeyring(keys [][]byte) (*memberlist.Keyring, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if err := validateKeys(keys); err != nil {
+		return nil, err
+	}
+	return memberlist.NewKeyring(keys[1:], keys[0])
+}
+
+func validateKeys(keys [][]byte) error {
+	for i, key := range keys {
+		if err := memberlist.ValidateKey(key); err != nil {
+			return errors.Wrapf(err, "key %d", i+1)
+		}
+	}
+	return nil
+}
+
+// SetKeys replaces the keys gossip is encrypted with, the first of which is
+// primary. Encryption can't be enabled or disabled on a running peer, so a peer
+// created without keys can't be given any, and vice versa.
+func (p *Peer) SetKeys(keys [][]byte) error {
+	switch {
+	case p.keyring == nil && len(keys) > 0:
+		return errors.New("gossip isn't encrypted, and can't be without a restart")
+	case p.keyring == nil:
+		return nil
+	case len(keys) == 0:
+		return errors.New("gossip is encrypted, and can't stop being without a restart")
+	}
+	if err := validateKeys(keys); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := p.keyring.AddKey(key); err != nil {
+			return err
+		}
+	}
+	if err := p.keyring.UseKey(keys[0]); err != nil {
+		return err
+	}
+	for _, key := range p.keyring.GetKeys() {
+		if !containsKey(keys, key) {
+			if err := p.keyring.RemoveKey(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func containsKey(keys [][]byte, key []byte) bool {
+	for _, k := range keys {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEncryptionError reports whether err, from joining, means we and the peer
+// we tried to join disagree about encryption: one of us encrypts gossip, and
+// the other doesn't, or we don't share a key. Memberlist reports these, from
+// either side, as errors about encrypted state, or keys that can't decrypt.
+func isEncryptionError(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "crypt")
+}
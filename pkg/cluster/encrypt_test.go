@@ -0,0 +1,132 @@
+package cluster
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestPeerEncryption(t *testing.T) {
+	t.Parallel()
+
+	var (
+		key1 = []byte("0123456789abcdef")
+		key2 = []byte("fedcba9876543210")
+		key3 = []byte("not the right key, at all!......")
+	)
+	seed, seedAddr := newTestPeer(t, nil, key1)
+	defer seed.Leave(time.Second)
+
+	for _, testcase := range []struct {
+		name string
+		keys [][]byte
+		ok   bool
+	}{
+		{"same key", [][]byte{key1}, true},
+		{"also accepts the seed's key", [][]byte{key2, key1}, false}, // but the seed can't decrypt key2
+		{"wrong key", [][]byte{key3}, false},
+		{"no encryption", nil, false},
+	} {
+		peer, err := newPeer(t, []string{seedAddr}, testcase.keys...)
+		if want, have := testcase.ok, err == nil; want != have {
+			t.Errorf("%s: want ok=%v, have error %v", testcase.name, want, err)
+		}
+		if peer != nil {
+			peer.Leave(time.Second)
+		}
+	}
+
+	// Peers without encryption can't join encrypted ones, either.
+	plain, plainAddr := newTestPeer(t, nil)
+	defer plain.Leave(time.Second)
+	if _, err := newPeer(t, []string{plainAddr}, key1); err == nil {
+		t.Errorf("encrypted peer joined an unencrypted one")
+	}
+	if err := plain.SetKeys([][]byte{key1}); err == nil {
+		t.Errorf("encryption was enabled without a restart")
+	}
+	if err := seed.SetKeys(nil); err == nil {
+		t.Errorf("encryption was disabled without a restart")
+	}
+	if err := seed.SetKeys([][]byte{[]byte("short")}); err == nil {
+		t.Errorf("invalid key was accepted")
+	}
+}
+
+func TestPeerKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	var (
+		oldKey = []byte("0123456789abcdef")
+		newKey = []byte("fedcba9876543210")
+	)
+	a, aAddr := newTestPeer(t, nil, oldKey)
+	defer a.Leave(time.Second)
+	b, _ := newTestPeer(t, []string{aAddr}, oldKey)
+	defer b.Leave(time.Second)
+
+	// Add the new key as a secondary. Nothing changes for peers with the
+	// old key, but peers that have both keys can join.
+	for _, p := range []*Peer{a, b} {
+		if err := p.SetKeys([][]byte{oldKey, newKey}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, _ := newTestPeer(t, []string{aAddr}, oldKey)
+	defer c.Leave(time.Second)
+	if _, err := newPeer(t, []string{aAddr}, newKey); err == nil {
+		t.Errorf("peer with only the new key joined before it was primary")
+	}
+
+	// Make the new key primary, and then remove the old one. Now only peers
+	// with the new key can join.
+	for _, keys := range [][][]byte{{newKey, oldKey}, {newKey}} {
+		for _, p := range []*Peer{a, b, c} {
+			if err := p.SetKeys(keys); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	d, _ := newTestPeer(t, []string{aAddr}, newKey)
+	defer d.Leave(time.Second)
+	if _, err := newPeer(t, []string{aAddr}, oldKey); err == nil {
+		t.Errorf("peer with the old key joined after it was removed")
+	}
+
+	// The peer with only the new key was let in, by peers that could read
+	// it, though it couldn't read them, so it couldn't tell them it left.
+	// It's a member until they find it gone.
+	for deadline := time.Now().Add(20 * time.Second); a.ClusterSize() != 4 && time.Now().Before(deadline); {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if want, have := 4, a.ClusterSize(); want != have {
+		t.Errorf("cluster size: want %d, have %d", want, have)
+	}
+}
+
+// newTestPeer returns a store peer on a free local port, which joined the
+// existing peers, and its cluster address.
+func newTestPeer(t *testing.T, existing []string, keys ...[]byte) (*Peer, string) {
+	peer, err := newPeer(t, existing, keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := peer.ml.LocalNode()
+	return peer, net.JoinHostPort(n.Addr.String(), strconv.Itoa(int(n.Port)))
+}
+
+func newPeer(t *testing.T, existing []string, keys ...[]byte) (*Peer, error) {
+	return NewPeer("127.0.0.1", freePort(t), "", 0, existing, PeerTypeStore, 7650, "", nil, keys, log.NewNopLogger())
+}
+
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
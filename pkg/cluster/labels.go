@@ -0,0 +1,93 @@
+package cluster
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/pkg/errors"
+)
+
+// Labels are arbitrary key=value pairs describing a node, e.g. env=staging.
+// They're gossiped as the node's metadata, and ingest nodes stamp them on the
+// segments they seal, so queries can select records by the labels of the
+// nodes that ingested them.
+type Labels map[string]string
+
+// MaxLabelBytes is the most a node's labels may take, encoded, since that's
+// all the metadata memberlist gossips per node.
+const MaxLabelBytes = memberlist.MetaMaxSize
+
+// ParseLabel parses a key=value label.
+func ParseLabel(s string) (key, value string, err error) {
+	fields := strings.SplitN(s, "=", 2)
+	if len(fields) != 2 {
+		return "", "", errors.Errorf("label %q: want key=value", s)
+	}
+	if err := ValidateLabel(fields[0], fields[1]); err != nil {
+		return "", "", err
+	}
+	return fields[0], fields[1], nil
+}
+
+// ValidateLabel returns an error if the key or value is empty, or has other
+// than letters, digits, and any of "-", "_", and ".".
+func ValidateLabel(key, value string) error {
+	for _, s := range []string{key, value} {
+		if s == "" || strings.IndexFunc(s, invalidLabelRune) >= 0 {
+			return errors.Errorf("label %s=%s: keys and values must be letters, digits, -, _, or .", key, value)
+		}
+	}
+	return nil
+}
+
+func invalidLabelRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	case r == '-', r == '_', r == '.':
+		return false
+	}
+	return true
+}
+
+// ParseLabels parses labels encoded by String. The empty string is no labels.
+func ParseLabels(s string) (Labels, error) {
+	labels := Labels{}
+	if s == "" {
+		return labels, nil
+	}
+	for _, label := range strings.Split(s, ",") {
+		key, value, err := ParseLabel(label)
+		if err != nil {
+			return nil, err
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// String encodes the labels compactly, and canonically, as comma-separated
+// key=value pairs, ordered by key.
+func (l Labels) String() string {
+	pairs := make([]string, 0, len(l))
+	for key, value := range l {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Validate returns an error if any label is invalid, or if the labels take
+// more than MaxLabelBytes, encoded.
+func (l Labels) Validate() error {
+	for key, value := range l {
+		if err := ValidateLabel(key, value); err != nil {
+			return err
+		}
+	}
+	if n := len(l.String()); n > MaxLabelBytes {
+		return errors.Errorf("labels take %d bytes, encoded, more than the %d that are gossiped", n, MaxLabelBytes)
+	}
+	return nil
+}
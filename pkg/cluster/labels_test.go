@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestParseLabels(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		input string
+		want  Labels
+		ok    bool
+	}{
+		{"", Labels{}, true},
+		{"env=staging", Labels{"env": "staging"}, true},
+		{"env=staging,region=eu-west-1", Labels{"env": "staging", "region": "eu-west-1"}, true},
+		{"version=1.2.3_rc", Labels{"version": "1.2.3_rc"}, true},
+		{"env", nil, false},
+		{"env=", nil, false},
+		{"=staging", nil, false},
+		{"env=stag ing", nil, false},
+		{"env=staging,", nil, false},
+		{"env:staging", nil, false},
+	} {
+		have, err := ParseLabels(testcase.input)
+		if want, have := testcase.ok, err == nil; want != have {
+			t.Errorf("%q: want ok=%v, have error %v", testcase.input, want, err)
+			continue
+		}
+		if want := testcase.want; !reflect.DeepEqual(want, have) {
+			t.Errorf("%q: want %v, have %v", testcase.input, want, have)
+		}
+	}
+}
+
+func TestLabelsString(t *testing.T) {
+	t.Parallel()
+
+	labels := Labels{"region": "eu-west-1", "env": "staging", "az": "b"}
+	if want, have := "az=b,env=staging,region=eu-west-1", labels.String(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if parsed, err := ParseLabels(labels.String()); err != nil || !reflect.DeepEqual(labels, parsed) {
+		t.Errorf("round trip: want %v, have %v (%v)", labels, parsed, err)
+	}
+}
+
+func TestLabelsValidate(t *testing.T) {
+	t.Parallel()
+
+	if err := (Labels{"env": strings.Repeat("x", MaxLabelBytes-len("env="))}).Validate(); err != nil {
+		t.Errorf("labels of %d bytes: %v", MaxLabelBytes, err)
+	}
+	if err := (Labels{"env": strings.Repeat("x", MaxLabelBytes)}).Validate(); err == nil {
+		t.Errorf("labels over %d bytes: want error, have none", MaxLabelBytes)
+	}
+	if err := (Labels{"env": "stag/ing"}).Validate(); err == nil {
+		t.Errorf("invalid label: want error, have none")
+	}
+	if _, err := NewPeer("127.0.0.1", freePort(t), "", 0, nil, PeerTypeIngest, 7650, "", Labels{"env": strings.Repeat("x", MaxLabelBytes)}, nil, log.NewNopLogger()); err == nil {
+		t.Errorf("NewPeer with oversized labels: want error, have none")
+	}
+}
+
+func TestPeerLabels(t *testing.T) {
+	t.Parallel()
+
+	labels := Labels{"env": "staging", "region": "eu-west-1"}
+	a, err := NewPeer("127.0.0.1", freePort(t), "", 0, nil, PeerTypeIngest, 7650, "", labels, nil, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Leave(time.Second)
+	n := a.ml.LocalNode()
+	b, _ := newTestPeer(t, []string{net.JoinHostPort(n.Addr.String(), strconv.Itoa(int(n.Port)))})
+	defer b.Leave(time.Second)
+
+	// Each peer sees the other's labels, gossiped as its metadata.
+	for _, testcase := range []struct {
+		name string
+		peer *Peer
+	}{
+		{"labeled peer", a},
+		{"other peer", b},
+	} {
+		have := map[string]Labels{}
+		for _, state := range testcase.peer.Peers() {
+			have[state.Name] = state.Labels
+		}
+		want := map[string]Labels{a.Name(): labels, b.Name(): {}}
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %v, have %v", testcase.name, want, have)
+		}
+	}
+}
@@ -2,7 +2,8 @@
 //
 // Ingest and store instances join the same cluster and know about each other.
 // Store instances consume segments from each ingest instance, and broadcast
-// queries to each store instance. In the future, ingest instances will share
+// queries to each store instance, or to each read-only store instance, if
+// there are any. In the future, ingest instances will share
 // load information to potentially refuse connections and balance writes.
 package cluster
 
@@ -11,6 +12,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,12 +22,26 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"github.com/hashicorp/memberlist"
 	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/breaker"
+	"github.com/oklog/oklog/pkg/version"
 )
 
 // Peer represents this node in the cluster.
 type Peer struct {
-	ml *memberlist.Memberlist
-	d  *delegate
+	ml       memberList
+	d        *delegate
+	keyring  *memberlist.Keyring // nil if gossip isn't encrypted
+	breakers *breaker.Set        // this node's, of the other nodes; may be nil
+}
+
+// memberList models memberlist.Memberlist.
+type memberList interface {
+	LocalNode() *memberlist.Node
+	Members() []*memberlist.Node
+	NumMembers() int
+	Leave(timeout time.Duration) error
 }
 
 // PeerType enumerates the types of nodes in the cluster.
@@ -40,11 +56,23 @@ const (
 
 	// PeerTypeIngestStore serves both ingest and store APIs.
 	PeerTypeIngestStore = "ingeststore"
+
+	// PeerTypeReadOnlyStore serves the store API, from segments replicated
+	// to it, but doesn't consume segments from ingest nodes, or repair
+	// other store nodes. It doesn't match PeerTypeStore, so it doesn't
+	// count towards the replication factor.
+	PeerTypeReadOnlyStore = "readonlystore"
 )
 
 // NewPeer creates or joins a cluster with the existing peers.
 // We will listen for cluster communications on the bind addr:port.
-// We advertise a PeerType HTTP API, reachable on apiPort.
+// We advertise a PeerType HTTP API, reachable on apiPort, in the given zone,
+// which may be empty, with the given labels, which are gossiped as our
+// metadata.
+//
+// If keys isn't empty, gossip is encrypted with them; see SetKeys. Peers that
+// can't be joined because they disagree about encryption are an error, unless
+// other peers could be joined.
 //
 // If advertiseAddr is not empty, we will advertise ourself as reachable for
 // cluster communications on that address; otherwise, memberlist will extract
@@ -54,11 +82,22 @@ func NewPeer(
 	advertiseAddr string, advertisePort int,
 	existing []string,
 	t PeerType, apiPort int,
+	zone string,
+	labels Labels,
+	keys [][]byte,
 	logger log.Logger,
 ) (*Peer, error) {
 	level.Debug(logger).Log("bind_addr", bindAddr, "bind_port", bindPort, "ParseIP", net.ParseIP(bindAddr).String())
 
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+	keyring, err := newKeyring(keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "gossip encryption")
+	}
 	d := newDelegate(logger)
+	d.meta = []byte(labels.String()) // before Create, which gossips it
 	config := memberlist.DefaultLANConfig()
 	{
 		config.Name = uuid.New()
@@ -72,23 +111,36 @@ func NewPeer(
 		config.LogOutput = ioutil.Discard
 		config.Delegate = d
 		config.Events = d
+		config.Ping = d
+		config.Keyring = keyring
 	}
 	ml, err := memberlist.Create(config)
 	if err != nil {
 		return nil, err
 	}
 
-	d.init(config.Name, t, ml.LocalNode().Addr.String(), apiPort, ml.NumMembers)
-	n, _ := ml.Join(existing)
+	d.init(config.Name, t, ml.LocalNode().Addr.String(), apiPort, zone, ml.NumMembers)
+	n, err := ml.Join(existing)
 	level.Debug(logger).Log("Join", n)
+	if isEncryptionError(err) {
+		if n == 0 {
+			// A peer that can read us, though we can't read it, may have
+			// let us in, so leave, as far as we can, before shutting down.
+			ml.Leave(time.Second)
+			ml.Shutdown()
+			return nil, errors.Wrap(err, "peers disagree about gossip encryption")
+		}
+		level.Warn(logger).Log("msg", "some peers disagree about gossip encryption", "err", err)
+	}
 
 	if len(existing) > 0 {
 		go warnIfAlone(ml, logger, 5*time.Second)
 	}
 
 	return &Peer{
-		ml: ml,
-		d:  d,
+		ml:      ml,
+		d:       d,
+		keyring: keyring,
 	}, nil
 }
 
@@ -105,11 +157,31 @@ func (p *Peer) Leave(timeout time.Duration) error {
 	return p.ml.Leave(timeout)
 }
 
+// Leaving marks this peer as leaving the cluster, and gossips that state to
+// the other peers. Leaving peers are still members, so in-flight work can
+// complete, but they're no longer returned by Current or Zones, so new work
+// goes elsewhere.
+func (p *Peer) Leaving() {
+	p.d.leaving()
+}
+
 // Current API host:ports for the given type of node.
+// Peers that are leaving the cluster are absent.
 func (p *Peer) Current(t PeerType) []string {
 	return p.d.current(t)
 }
 
+// Zones of the current API host:ports for the given type of node. Peers that
+// don't advertise a zone, or are leaving the cluster, are absent.
+func (p *Peer) Zones(t PeerType) map[string]string {
+	return p.d.zones(t)
+}
+
+// APIAddr returns our API host:port, as other peers find it in Current.
+func (p *Peer) APIAddr() string {
+	return p.d.self().hostport()
+}
+
 // Name returns the unique ID of this peer in the cluster.
 func (p *Peer) Name() string {
 	return p.ml.LocalNode().Name
@@ -120,6 +192,101 @@ func (p *Peer) ClusterSize() int {
 	return p.ml.NumMembers()
 }
 
+// These are the states of peers in the cluster. Memberlist doesn't tell us
+// which peers it suspects, so they're alive until they're declared dead.
+const (
+	PeerStateAlive   = "alive"
+	PeerStateLeaving = "leaving"
+	PeerStateDead    = "dead"
+)
+
+// PeerState describes a peer, from this node's point of view.
+type PeerState struct {
+	Name             string          `json:"name"`
+	Addr             string          `json:"addr,omitempty"` // for cluster communication
+	APIAddr          string          `json:"api_addr"`
+	APIPort          int             `json:"api_port"`
+	Type             PeerType        `json:"type"`
+	State            string          `json:"state"`
+	Zone             string          `json:"zone,omitempty"`
+	Labels           Labels          `json:"labels,omitempty"`
+	Version          string          `json:"version,omitempty"`
+	Self             bool            `json:"self,omitempty"`
+	Capacity         *Capacity       `json:"capacity,omitempty"`
+	ClockOffset      string          `json:"clock_offset,omitempty"` // ahead of ours, if it's been probed
+	Breaker          string          `json:"breaker,omitempty"`      // of its API, by this node, if it keeps them
+	Protocol         ProtocolVersion `json:"protocol"`
+	DelegateProtocol ProtocolVersion `json:"delegate_protocol"`
+}
+
+// ProtocolVersion is the range of versions of a protocol a peer understands,
+// and the version it speaks.
+type ProtocolVersion struct {
+	Min     uint8 `json:"min"`
+	Max     uint8 `json:"max"`
+	Current uint8 `json:"current"`
+}
+
+// Peers returns the state of every member of the cluster, including this
+// one, and of the peers that recently died or left, ordered by name.
+func (p *Peer) Peers() []PeerState {
+	var (
+		self    = p.ml.LocalNode().Name
+		data    = p.d.state()
+		members = p.ml.Members()
+		res     = make([]PeerState, 0, len(members))
+	)
+	for _, n := range members {
+		info := data[n.Name]
+		state := PeerStateAlive
+		if info.Leaving {
+			state = PeerStateLeaving
+		}
+		ps := newPeerState(n, info, state, n.Name == self)
+		if offset, ok := p.d.clockOffset(n.Name); ok {
+			ps.ClockOffset = offset.String()
+		}
+		if p.breakers != nil && !ps.Self {
+			ps.Breaker = p.breakers.State(info.hostport()).String()
+		}
+		res = append(res, ps)
+	}
+	for _, d := range p.d.departures() {
+		res = append(res, newPeerState(&d.node, d.info, PeerStateDead, false))
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func newPeerState(n *memberlist.Node, info peerInfo, state string, self bool) PeerState {
+	var addr string // static peers don't have one
+	if n.Addr != nil {
+		addr = net.JoinHostPort(n.Addr.String(), strconv.Itoa(int(n.Port)))
+	}
+	labels, _ := ParseLabels(string(n.Meta)) // not ours to complain about
+	return PeerState{
+		Name:             n.Name,
+		Addr:             addr,
+		APIAddr:          info.APIAddr,
+		APIPort:          info.APIPort,
+		Type:             info.Type,
+		State:            state,
+		Zone:             info.Zone,
+		Labels:           labels,
+		Version:          info.Version,
+		Self:             self,
+		Capacity:         info.capacity(),
+		Protocol:         ProtocolVersion{n.PMin, n.PMax, n.PCur},
+		DelegateProtocol: ProtocolVersion{n.DMin, n.DMax, n.DCur},
+	}
+}
+
+// SetBreakers makes Peers report the state of this node's breakers of the
+// other peers, by API host:port. It must be invoked before Peers is.
+func (p *Peer) SetBreakers(breakers *breaker.Set) {
+	p.breakers = breakers
+}
+
 // State returns a JSON-serializable dump of cluster state.
 // Useful for debug.
 func (p *Peer) State() map[string]interface{} {
@@ -131,31 +298,57 @@ func (p *Peer) State() map[string]interface{} {
 	}
 }
 
-// delegate manages gossiped data: the set of peers, their type, and API port.
+// delegate manages gossiped data: the set of peers, their type, API port,
+// zone, disk usage, and whether they're leaving. It also remembers the peers that left
+// the cluster, or died, for a while, and how far off our clock theirs are.
 // Clients must invoke init before the delegate can be used.
 // Inspired by https://github.com/asim/memberlist/blob/master/memberlist.go
 type delegate struct {
-	mtx    sync.RWMutex
-	bcast  *memberlist.TransmitLimitedQueue
-	data   map[string]peerInfo
-	logger log.Logger
+	mtx      sync.RWMutex
+	bcast    *memberlist.TransmitLimitedQueue
+	myName   string
+	meta     []byte // our labels
+	data     map[string]peerInfo
+	departed map[string]departure
+	warned   map[string]bool          // peers of incompatible versions
+	offsets  map[string]time.Duration // of peers' clocks, ahead of ours
+	now      func() time.Time
+	logger   log.Logger
 }
 
+// departure is a peer that left the cluster, or died.
+type departure struct {
+	node memberlist.Node
+	info peerInfo
+	at   time.Time
+}
+
+// departureRetention is how long departed peers are remembered.
+const departureRetention = 5 * time.Minute
+
 type peerInfo struct {
 	Type    PeerType `json:"type"`
 	APIAddr string   `json:"api_addr"`
 	APIPort int      `json:"api_port"`
+	Zone    string   `json:"zone,omitempty"`
+	Leaving bool     `json:"leaving,omitempty"`
+	Version string   `json:"version,omitempty"`
+	Disk    []int64  `json:"disk,omitempty"` // Capacity, compactly, in field order
 }
 
 func newDelegate(logger log.Logger) *delegate {
 	return &delegate{
-		bcast:  nil,
-		data:   map[string]peerInfo{},
-		logger: logger,
+		bcast:    nil,
+		data:     map[string]peerInfo{},
+		departed: map[string]departure{},
+		warned:   map[string]bool{},
+		offsets:  map[string]time.Duration{},
+		now:      time.Now,
+		logger:   logger,
 	}
 }
 
-func (d *delegate) init(myName string, myType PeerType, apiAddr string, apiPort int, numNodes func() int) {
+func (d *delegate) init(myName string, myType PeerType, apiAddr string, apiPort int, zone string, numNodes func() int) {
 	d.mtx.Lock()
 	defer d.mtx.Unlock()
 	// As far as I can tell, it is only luck which ensures the d.bcast isn't
@@ -166,23 +359,70 @@ func (d *delegate) init(myName string, myType PeerType, apiAddr string, apiPort
 		NumNodes:       numNodes,
 		RetransmitMult: 3,
 	}
-	d.data[myName] = peerInfo{myType, apiAddr, apiPort}
+	d.myName = myName
+	d.data[myName] = peerInfo{myType, apiAddr, apiPort, zone, false, version.Version, nil}
+}
+
+// leaving updates our own peer info, and queues it for broadcast, so other
+// peers learn about it before the next push/pull.
+func (d *delegate) leaving() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	info := d.data[d.myName]
+	if info.Leaving {
+		return
+	}
+	info.Leaving = true
+	d.data[d.myName] = info
+	buf, err := json.Marshal(map[string]peerInfo{d.myName: info})
+	if err != nil {
+		panic(err)
+	}
+	d.bcast.QueueBroadcast(peerInfoBroadcast(buf))
+}
+
+func (d *delegate) self() peerInfo {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	return d.data[d.myName]
 }
 
 func (d *delegate) current(t PeerType) (res []string) {
 	for _, info := range d.state() {
-		var (
-			matchIngest      = t == PeerTypeIngest && (info.Type == PeerTypeIngest || info.Type == PeerTypeIngestStore)
-			matchStore       = t == PeerTypeStore && (info.Type == PeerTypeStore || info.Type == PeerTypeIngestStore)
-			matchIngestStore = t == PeerTypeIngestStore && info.Type == PeerTypeIngestStore
-		)
-		if matchIngest || matchStore || matchIngestStore {
-			res = append(res, net.JoinHostPort(info.APIAddr, strconv.Itoa(info.APIPort)))
+		if info.matches(t) {
+			res = append(res, info.hostport())
+		}
+	}
+	return res
+}
+
+func (d *delegate) zones(t PeerType) map[string]string {
+	res := map[string]string{}
+	for _, info := range d.state() {
+		if info.matches(t) && info.Zone != "" {
+			res[info.hostport()] = info.Zone
 		}
 	}
 	return res
 }
 
+func (info peerInfo) matches(t PeerType) bool {
+	if info.Leaving {
+		return false
+	}
+	var (
+		matchIngest      = t == PeerTypeIngest && (info.Type == PeerTypeIngest || info.Type == PeerTypeIngestStore)
+		matchStore       = t == PeerTypeStore && (info.Type == PeerTypeStore || info.Type == PeerTypeIngestStore)
+		matchIngestStore = t == PeerTypeIngestStore && info.Type == PeerTypeIngestStore
+		matchReadOnly    = t == PeerTypeReadOnlyStore && info.Type == PeerTypeReadOnlyStore
+	)
+	return matchIngest || matchStore || matchIngestStore || matchReadOnly
+}
+
+func (info peerInfo) hostport() string {
+	return net.JoinHostPort(info.APIAddr, strconv.Itoa(info.APIPort))
+}
+
 func (d *delegate) state() map[string]peerInfo {
 	d.mtx.RLock()
 	defer d.mtx.RUnlock()
@@ -193,6 +433,31 @@ func (d *delegate) state() map[string]peerInfo {
 	return res
 }
 
+// departures returns the peers that departed within departureRetention.
+func (d *delegate) departures() []departure {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	var (
+		res    []departure
+		cutoff = d.now().Add(-departureRetention)
+	)
+	for _, dep := range d.departed {
+		if dep.at.After(cutoff) {
+			res = append(res, dep)
+		}
+	}
+	return res
+}
+
+// peerInfoBroadcast is a JSON-encoded map[string]peerInfo, the same format
+// as LocalState, so that NotifyMsg can decode it.
+// Implements memberlist.Broadcast.
+type peerInfoBroadcast []byte
+
+func (b peerInfoBroadcast) Invalidates(memberlist.Broadcast) bool { return false }
+func (b peerInfoBroadcast) Message() []byte                       { return []byte(b) }
+func (b peerInfoBroadcast) Finished()                             {}
+
 // NodeMeta is used to retrieve meta-data about the current node
 // when broadcasting an alive message. It's length is limited to
 // the given byte size. This metadata is available in the Node structure.
@@ -200,7 +465,11 @@ func (d *delegate) state() map[string]peerInfo {
 func (d *delegate) NodeMeta(limit int) []byte {
 	d.mtx.RLock()
 	defer d.mtx.RUnlock()
-	return []byte{} // no metadata
+	if len(d.meta) > limit {
+		level.Error(d.logger).Log("method", "NodeMeta", "err", "labels are too big to gossip", "limit", limit)
+		return []byte{}
+	}
+	return d.meta
 }
 
 // NotifyMsg is called when a user-data message is received.
@@ -221,7 +490,11 @@ func (d *delegate) NotifyMsg(b []byte) {
 	defer d.mtx.Unlock()
 	for k, v := range data {
 		// Removing data is handled by NotifyLeave
+		if k == d.myName {
+			continue // we know better
+		}
 		d.data[k] = v
+		d.checkVersion(k, v)
 	}
 }
 
@@ -274,15 +547,36 @@ func (d *delegate) MergeRemoteState(buf []byte, join bool) {
 	d.mtx.Lock()
 	defer d.mtx.Unlock()
 	for k, v := range data {
+		if k == d.myName {
+			continue // we know better
+		}
 		d.data[k] = v
+		d.checkVersion(k, v)
 	}
 }
 
+// checkVersion warns, once, of a peer whose version differs from ours by
+// more than the patch version. It must be called with the mutex held.
+func (d *delegate) checkVersion(name string, info peerInfo) {
+	if name == d.myName || d.warned[name] {
+		return
+	}
+	mine := d.data[d.myName].Version
+	if version.Compatible(mine, info.Version) {
+		return
+	}
+	d.warned[name] = true
+	level.Warn(d.logger).Log("msg", "peer runs an incompatible version", "peer", info.hostport(), "version", info.Version, "ours", mine)
+}
+
 // NotifyJoin is invoked when a node is detected to have joined.
 // The Node argument must not be modified.
 // Implements memberlist.EventDelegate.
 func (d *delegate) NotifyJoin(n *memberlist.Node) {
 	level.Debug(d.logger).Log("received", "NotifyJoin", "node", n.Name, "addr", fmt.Sprintf("%s:%d", n.Addr, n.Port))
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	delete(d.departed, n.Name)
 }
 
 // NotifyUpdate is invoked when a node is detected to have updated, usually
@@ -299,5 +593,14 @@ func (d *delegate) NotifyLeave(n *memberlist.Node) {
 	level.Debug(d.logger).Log("received", "NotifyLeave", "node", n.Name, "addr", fmt.Sprintf("%s:%d", n.Addr, n.Port))
 	d.mtx.Lock()
 	defer d.mtx.Unlock()
+	now := d.now()
+	for name, dep := range d.departed {
+		if now.Sub(dep.at) > departureRetention {
+			delete(d.departed, name)
+		}
+	}
+	d.departed[n.Name] = departure{node: *n, info: d.data[n.Name], at: now}
 	delete(d.data, n.Name)
+	delete(d.warned, n.Name)
+	delete(d.offsets, n.Name)
 }
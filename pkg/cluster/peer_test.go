@@ -0,0 +1,249 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/hashicorp/memberlist"
+)
+
+func TestDelegateZones(t *testing.T) {
+	d := newDelegate(log.NewNopLogger())
+	d.init("self", PeerTypeStore, "10.0.0.1", 7650, "us-east-1a", func() int { return 3 })
+
+	// Zones are gossiped along with the rest of the peer info.
+	buf, err := json.Marshal(map[string]peerInfo{
+		"other":    {Type: PeerTypeIngestStore, APIAddr: "10.0.0.2", APIPort: 7650, Zone: "us-east-1b"},
+		"zoneless": {Type: PeerTypeStore, APIAddr: "10.0.0.3", APIPort: 7650},
+		"ingest":   {Type: PeerTypeIngest, APIAddr: "10.0.0.4", APIPort: 7650, Zone: "us-east-1c"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.MergeRemoteState(buf, false)
+
+	want := map[string]string{
+		"10.0.0.1:7650": "us-east-1a",
+		"10.0.0.2:7650": "us-east-1b",
+	}
+	if have := d.zones(PeerTypeStore); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestDelegateCurrentAPIPorts(t *testing.T) {
+	d := newDelegate(log.NewNopLogger())
+	d.init("self", PeerTypeStore, "10.0.0.1", 7650, "", func() int { return 3 })
+
+	// Peers gossip on one port, and serve their APIs on others, not
+	// necessarily the default; they're found by the ones they advertise.
+	buf, err := json.Marshal(map[string]peerInfo{
+		"other": {Type: PeerTypeStore, APIAddr: "10.0.0.2", APIPort: 8650},
+		"third": {Type: PeerTypeIngestStore, APIAddr: "10.0.0.3", APIPort: 9650},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.MergeRemoteState(buf, false)
+	for _, node := range []*memberlist.Node{
+		{Name: "other", Addr: []byte{10, 0, 0, 2}, Port: 7659},
+		{Name: "third", Addr: []byte{10, 0, 0, 3}, Port: 7659},
+	} {
+		d.NotifyJoin(node)
+	}
+
+	want := []string{"10.0.0.1:7650", "10.0.0.2:8650", "10.0.0.3:9650"}
+	if have := sorted(d.current(PeerTypeStore)); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestDelegateLeaving(t *testing.T) {
+	self := newDelegate(log.NewNopLogger())
+	self.init("self", PeerTypeStore, "10.0.0.1", 7650, "", func() int { return 2 })
+	other := newDelegate(log.NewNopLogger())
+	other.init("other", PeerTypeStore, "10.0.0.2", 7650, "", func() int { return 2 })
+	other.MergeRemoteState(self.LocalState(false), false)
+
+	if want, have := []string{"10.0.0.1:7650", "10.0.0.2:7650"}, sorted(other.current(PeerTypeStore)); !reflect.DeepEqual(want, have) {
+		t.Fatalf("before leaving: want %v, have %v", want, have)
+	}
+
+	// The leaving state is broadcast, and other peers stop selecting us.
+	self.leaving()
+	if want, have := []string(nil), self.current(PeerTypeStore); !reflect.DeepEqual(want, have) {
+		t.Errorf("self: want %v, have %v", want, have)
+	}
+	for _, b := range self.GetBroadcasts(0, 1<<16) {
+		other.NotifyMsg(b)
+	}
+	if want, have := []string{"10.0.0.2:7650"}, other.current(PeerTypeStore); !reflect.DeepEqual(want, have) {
+		t.Errorf("other: want %v, have %v", want, have)
+	}
+
+	// But we're still a member, until we actually leave.
+	if want, have := true, other.state()["self"].Leaving; want != have {
+		t.Errorf("other state: want Leaving=%v, have %v", want, have)
+	}
+}
+
+func TestDelegateCapacity(t *testing.T) {
+	self := newDelegate(log.NewNopLogger())
+	self.init("self", PeerTypeStore, "10.0.0.1", 7650, "", func() int { return 2 })
+	other := newDelegate(log.NewNopLogger())
+	other.init("other", PeerTypeStore, "10.0.0.2", 7650, "", func() int { return 2 })
+	other.MergeRemoteState(self.LocalState(false), false)
+
+	// Our capacity is gossiped at the next push/pull.
+	if want, have := (*Capacity)(nil), other.state()["self"].capacity(); want != have {
+		t.Fatalf("before: want %v, have %v", want, have)
+	}
+	c := Capacity{SegmentBytes: 1, TrashBytes: 2, CapacityBytes: 4, AvailableBytes: 3}
+	self.setCapacity(c)
+	stale := other.LocalState(false)
+	other.MergeRemoteState(self.LocalState(false), false)
+	if have := other.state()["self"].capacity(); have == nil || *have != c {
+		t.Errorf("other: want %v, have %v", c, have)
+	}
+
+	// Other peers' view of us, which may be stale, doesn't override ours.
+	self.MergeRemoteState(stale, false)
+	if have := self.self().capacity(); have == nil || *have != c {
+		t.Errorf("self: want %v, have %v", c, have)
+	}
+}
+
+func TestDelegateClockOffsets(t *testing.T) {
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	self := newDelegate(log.NewNopLogger())
+	self.init("self", PeerTypeIngest, "10.0.0.1", 7650, "", func() int { return 4 })
+	self.now = func() time.Time { return now }
+	buf, err := json.Marshal(map[string]peerInfo{
+		"a": {Type: PeerTypeStore, APIAddr: "10.0.0.2", APIPort: 7650},
+		"b": {Type: PeerTypeStore, APIAddr: "10.0.0.3", APIPort: 7650},
+		"c": {Type: PeerTypeStore, APIAddr: "10.0.0.4", APIPort: 7650},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	self.MergeRemoteState(buf, false)
+
+	// Each peer acks our probe with its time, half a round trip before we
+	// get it. Peers that don't send it are ignored.
+	ack := func(name string, clock time.Time, rtt time.Duration) {
+		peer := newDelegate(log.NewNopLogger())
+		peer.now = func() time.Time { return clock.Add(-rtt / 2) }
+		self.NotifyPingComplete(&memberlist.Node{Name: name}, rtt, peer.AckPayload())
+	}
+	ack("a", now.Add(40*time.Minute), 10*time.Millisecond)
+	self.NotifyPingComplete(&memberlist.Node{Name: "b"}, time.Millisecond, nil)
+	if want, have := map[string]time.Duration{"10.0.0.2:7650": 40 * time.Minute}, self.clockOffsets(); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	// With just one peer, it can't tell whose clock is off.
+	if _, ok := self.clockSkew(); ok {
+		t.Errorf("one peer: want no skew, have one")
+	}
+
+	// With more, whoever disagrees with most peers is off.
+	for _, testcase := range []struct {
+		b, c time.Duration
+		want time.Duration
+	}{
+		{40 * time.Minute, 40 * time.Minute, -40 * time.Minute}, // we're behind
+		{0, time.Second, -time.Second},
+		{0, 0, 0}, // a is ahead
+		{40 * time.Minute, 0, -40 * time.Minute},
+	} {
+		ack("b", now.Add(testcase.b), 0)
+		ack("c", now.Add(testcase.c), 2*time.Millisecond)
+		have, ok := self.clockSkew()
+		if !ok || testcase.want != have {
+			t.Errorf("b %s, c %s: want skew %s, have %s (%v)", testcase.b, testcase.c, testcase.want, have, ok)
+		}
+	}
+
+	// Peers that leave are forgotten.
+	self.NotifyLeave(&memberlist.Node{Name: "c"})
+	self.NotifyLeave(&memberlist.Node{Name: "b"})
+	if _, ok := self.clockSkew(); ok {
+		t.Errorf("after leaving: want no skew, have one")
+	}
+	ack("b", now, 0)
+	if want, have := 1, len(self.clockOffsets()); want != have {
+		t.Errorf("after leaving: want %d offset, have %d", want, have)
+	}
+}
+
+func TestDelegateVersions(t *testing.T) {
+	var buf bytes.Buffer
+	d := newDelegate(log.NewLogfmtLogger(&buf))
+	d.init("self", PeerTypeStore, "10.0.0.1", 7650, "", func() int { return 3 })
+	info := d.data["self"]
+	info.Version = "1.2.3"
+	d.data["self"] = info
+
+	// Versions are gossiped, and peers more than a patch apart are warned
+	// of, once.
+	for i := 0; i < 2; i++ {
+		state, err := json.Marshal(map[string]peerInfo{
+			"patch": {Type: PeerTypeStore, APIAddr: "10.0.0.2", APIPort: 7650, Version: "1.2.4"},
+			"minor": {Type: PeerTypeStore, APIAddr: "10.0.0.3", APIPort: 7650, Version: "1.3.0"},
+			"dev":   {Type: PeerTypeStore, APIAddr: "10.0.0.4", APIPort: 7650, Version: "dev"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.MergeRemoteState(state, false)
+	}
+	if want, have := "1.3.0", d.state()["minor"].Version; want != have {
+		t.Errorf("want version %q, have %q", want, have)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if want, have := 1, len(lines); want != have {
+		t.Fatalf("want %d warning, have %d: %q", want, have, lines)
+	}
+	if want, have := "peer=10.0.0.3:7650", lines[0]; !strings.Contains(have, want) {
+		t.Errorf("want %q in %q", want, have)
+	}
+}
+
+func TestDelegateReadOnlyStore(t *testing.T) {
+	d := newDelegate(log.NewNopLogger())
+	d.init("self", PeerTypeReadOnlyStore, "10.0.0.1", 7650, "", func() int { return 3 })
+	buf, err := json.Marshal(map[string]peerInfo{
+		"store":       {Type: PeerTypeStore, APIAddr: "10.0.0.2", APIPort: 7650},
+		"ingeststore": {Type: PeerTypeIngestStore, APIAddr: "10.0.0.3", APIPort: 7650},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.MergeRemoteState(buf, false)
+
+	// Read-only store nodes are their own type, which other store nodes
+	// don't match, so they're never counted among them.
+	for _, testcase := range []struct {
+		t    PeerType
+		want []string
+	}{
+		{PeerTypeStore, []string{"10.0.0.2:7650", "10.0.0.3:7650"}},
+		{PeerTypeReadOnlyStore, []string{"10.0.0.1:7650"}},
+		{PeerTypeIngest, []string{"10.0.0.3:7650"}},
+	} {
+		if want, have := testcase.want, sorted(d.current(testcase.t)); !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %v, have %v", testcase.t, want, have)
+		}
+	}
+}
+
+func sorted(a []string) []string {
+	sort.Strings(a)
+	return a
+}
@@ -0,0 +1,286 @@
+package cluster
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/hashicorp/memberlist"
+	"github.com/pkg/errors"
+)
+
+// StaticPeer is a peer given by the user, rather than discovered by gossip.
+type StaticPeer struct {
+	Type    PeerType
+	APIAddr string
+	APIPort int
+	Zone    string
+}
+
+// ParseStaticPeer parses a static peer from type=host:port, optionally
+// followed by @zone, e.g. store=10.0.0.2:7650@us-east-1a.
+func ParseStaticPeer(s string) (StaticPeer, error) {
+	tokens := strings.SplitN(strings.TrimSpace(s), "=", 2)
+	if len(tokens) != 2 {
+		return StaticPeer{}, errors.Errorf("static peer %q: want type=host:port", s)
+	}
+	var p StaticPeer
+	switch t := PeerType(tokens[0]); t {
+	case PeerTypeIngest, PeerTypeStore, PeerTypeIngestStore, PeerTypeReadOnlyStore:
+		p.Type = t
+	default:
+		return StaticPeer{}, errors.Errorf("static peer %q: type must be %s, %s, %s, or %s", s, PeerTypeIngest, PeerTypeStore, PeerTypeIngestStore, PeerTypeReadOnlyStore)
+	}
+	hostport := tokens[1]
+	if i := strings.LastIndex(hostport, "@"); i >= 0 {
+		hostport, p.Zone = hostport[:i], hostport[i+1:]
+	}
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return StaticPeer{}, errors.Wrapf(err, "static peer %q", s)
+	}
+	if p.APIPort, err = strconv.Atoi(port); err != nil {
+		return StaticPeer{}, errors.Wrapf(err, "static peer %q", s)
+	}
+	p.APIAddr = host
+	return p, nil
+}
+
+func (p StaticPeer) hostport() string {
+	return net.JoinHostPort(p.APIAddr, strconv.Itoa(p.APIPort))
+}
+
+// staticPeerFailures is how many health checks in a row a static peer must
+// fail before it's considered dead. One success revives it.
+const staticPeerFailures = 3
+
+// NewStaticPeer returns a Peer that doesn't gossip. Its peers are given, and
+// checked by a GET of their /health, with client, every interval. Peers that
+// fail their health checks are dead, and absent from Current and Zones,
+// until they pass again. We advertise a PeerType HTTP API, reachable on
+// advertiseAddr:apiPort, in the given zone, which may be empty. Our labels
+// are only known to us, since there's no gossip.
+//
+// Static peers don't hear about each other leaving, so Leaving only affects
+// this node's own view of the cluster.
+func NewStaticPeer(
+	advertiseAddr string,
+	t PeerType, apiPort int,
+	zone string,
+	labels Labels,
+	peers []StaticPeer,
+	client *http.Client,
+	interval time.Duration,
+	logger log.Logger,
+) (*Peer, error) {
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+	self := StaticPeer{Type: t, APIAddr: advertiseAddr, APIPort: apiPort, Zone: zone}
+	d := newDelegate(logger)
+	d.meta = []byte(labels.String())
+	d.init(self.hostport(), t, advertiseAddr, apiPort, zone, func() int { return 1 })
+	s := &staticMembers{
+		self:     memberlist.Node{Name: self.hostport(), Meta: d.meta},
+		d:        d,
+		peers:    map[string]*staticMember{},
+		client:   client,
+		interval: interval,
+		stop:     make(chan chan struct{}),
+		logger:   logger,
+	}
+	s.set(peers)
+	go s.loop()
+	return &Peer{
+		ml: s,
+		d:  d,
+	}, nil
+}
+
+// SetStaticPeers replaces the peers of a Peer returned by NewStaticPeer, and
+// checks their health. Peers that were already known keep their state.
+func (p *Peer) SetStaticPeers(peers []StaticPeer) error {
+	s, ok := p.ml.(*staticMembers)
+	if !ok {
+		return errors.New("not a static peer")
+	}
+	s.set(peers)
+	return nil
+}
+
+// staticMembers stands in for memberlist, for static peers. Each peer's info
+// is put in the delegate as it becomes healthy, and removed as it dies, like
+// gossip would do.
+type staticMembers struct {
+	mtx      sync.RWMutex // protects peers
+	checkMtx sync.Mutex   // serializes checks
+	self     memberlist.Node
+	d        *delegate
+	peers    map[string]*staticMember // by API host:port
+	client   *http.Client
+	interval time.Duration
+	stop     chan chan struct{}
+	logger   log.Logger
+}
+
+type staticMember struct {
+	peer     StaticPeer
+	alive    bool
+	failures int
+}
+
+func (m *staticMember) node() *memberlist.Node {
+	return &memberlist.Node{Name: m.peer.hostport()}
+}
+
+// set replaces the peers, and checks their health, so new peers are
+// available right away, if they're healthy.
+func (s *staticMembers) set(peers []StaticPeer) {
+	s.mtx.Lock()
+	next := map[string]*staticMember{}
+	for _, p := range peers {
+		hostport := p.hostport()
+		if hostport == s.self.Name {
+			continue // that's us
+		}
+		if m, ok := s.peers[hostport]; ok && m.peer == p {
+			next[hostport] = m
+			continue
+		}
+		next[hostport] = &staticMember{peer: p}
+	}
+	var removed []*staticMember
+	for hostport, m := range s.peers {
+		if next[hostport] != m && m.alive {
+			removed = append(removed, m)
+		}
+	}
+	s.peers = next
+	s.mtx.Unlock()
+
+	for _, m := range removed {
+		s.d.NotifyLeave(m.node())
+	}
+	s.check()
+}
+
+func (s *staticMembers) loop() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.check()
+		case q := <-s.stop:
+			close(q)
+			return
+		}
+	}
+}
+
+// check checks the health of every peer, concurrently, and updates the
+// delegate with those that came to life, or died.
+func (s *staticMembers) check() {
+	s.checkMtx.Lock()
+	defer s.checkMtx.Unlock()
+
+	s.mtx.RLock()
+	var (
+		members = make([]*staticMember, 0, len(s.peers))
+		healthy = make([]bool, len(s.peers))
+		wg      sync.WaitGroup
+	)
+	for _, m := range s.peers {
+		members = append(members, m)
+	}
+	s.mtx.RUnlock()
+	for i, m := range members {
+		wg.Add(1)
+		go func(i int, hostport string) {
+			defer wg.Done()
+			err := s.healthCheck(hostport)
+			if err != nil {
+				level.Debug(s.logger).Log("static_peer", hostport, "health", err)
+			}
+			healthy[i] = err == nil
+		}(i, m.peer.hostport())
+	}
+	wg.Wait()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for i, m := range members {
+		if s.peers[m.peer.hostport()] != m {
+			continue // replaced while we were checking
+		}
+		switch {
+		case healthy[i] && !m.alive:
+			m.alive, m.failures = true, 0
+			level.Info(s.logger).Log("static_peer", m.peer.hostport(), "state", PeerStateAlive)
+			s.d.NotifyJoin(m.node())
+			s.d.mtx.Lock()
+			s.d.data[m.peer.hostport()] = peerInfo{m.peer.Type, m.peer.APIAddr, m.peer.APIPort, m.peer.Zone, false, "", nil}
+			s.d.mtx.Unlock()
+		case healthy[i]:
+			m.failures = 0
+		case m.alive:
+			if m.failures++; m.failures >= staticPeerFailures {
+				m.alive = false
+				level.Warn(s.logger).Log("static_peer", m.peer.hostport(), "state", PeerStateDead)
+				s.d.NotifyLeave(m.node())
+			}
+		}
+	}
+}
+
+func (s *staticMembers) healthCheck(hostport string) error {
+	req, err := http.NewRequest("GET", "http://"+hostport+"/health", nil)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+	defer cancel()
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *staticMembers) LocalNode() *memberlist.Node {
+	return &s.self
+}
+
+func (s *staticMembers) Members() []*memberlist.Node {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	nodes := []*memberlist.Node{&s.self}
+	for _, m := range s.peers {
+		if m.alive {
+			nodes = append(nodes, m.node())
+		}
+	}
+	return nodes
+}
+
+func (s *staticMembers) NumMembers() int {
+	return len(s.Members())
+}
+
+// Leave stops the health checks. There's no one to tell.
+func (s *staticMembers) Leave(timeout time.Duration) error {
+	q := make(chan struct{})
+	s.stop <- q
+	<-q
+	return nil
+}
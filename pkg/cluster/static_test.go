@@ -0,0 +1,151 @@
+package cluster
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestParseStaticPeer(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		input string
+		want  StaticPeer
+		err   bool
+	}{
+		{"store=10.0.0.2:7650", StaticPeer{PeerTypeStore, "10.0.0.2", 7650, ""}, false},
+		{"ingest=ingest1:7650@us-east-1a", StaticPeer{PeerTypeIngest, "ingest1", 7650, "us-east-1a"}, false},
+		{" ingeststore=[::1]:7650 ", StaticPeer{PeerTypeIngestStore, "::1", 7650, ""}, false},
+		{"readonlystore=10.0.0.5:7650", StaticPeer{PeerTypeReadOnlyStore, "10.0.0.5", 7650, ""}, false},
+		{"10.0.0.2:7650", StaticPeer{}, true},
+		{"query=10.0.0.2:7650", StaticPeer{}, true},
+		{"store=10.0.0.2", StaticPeer{}, true},
+		{"store=10.0.0.2:api", StaticPeer{}, true},
+	} {
+		have, err := ParseStaticPeer(testcase.input)
+		if want, have := testcase.err, err != nil; want != have {
+			t.Errorf("%q: want error %v, have %v", testcase.input, want, err)
+			continue
+		}
+		if want := testcase.want; want != have {
+			t.Errorf("%q: want %+v, have %+v", testcase.input, want, have)
+		}
+	}
+}
+
+func TestStaticPeerHealth(t *testing.T) {
+	t.Parallel()
+
+	// Two store peers, and an ingest peer, whose health we control.
+	var (
+		a, _        = newHealthServer()
+		b, bHealthy = newHealthServer()
+		c, cHealthy = newHealthServer()
+	)
+	defer a.Close()
+	defer b.Close()
+	defer c.Close()
+	atomic.StoreInt32(cHealthy, 0) // down from the start
+	peer, err := NewStaticPeer(
+		"10.0.0.1", PeerTypeStore, 7650, "", nil,
+		[]StaticPeer{
+			staticPeer(t, PeerTypeStore, a),
+			staticPeer(t, PeerTypeStore, b),
+			staticPeer(t, PeerTypeIngest, c),
+			{PeerTypeStore, "10.0.0.1", 7650, ""}, // ourselves
+		},
+		http.DefaultClient, time.Hour, log.NewNopLogger(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Leave(time.Second)
+	check := peer.ml.(*staticMembers).check
+
+	// Healthy peers are current right away, along with ourselves.
+	if want, have := sorted([]string{"10.0.0.1:7650", hostport(a), hostport(b)}), sorted(peer.Current(PeerTypeStore)); !reflect.DeepEqual(want, have) {
+		t.Fatalf("store: want %v, have %v", want, have)
+	}
+	if want, have := []string(nil), peer.Current(PeerTypeIngest); !reflect.DeepEqual(want, have) {
+		t.Fatalf("ingest: want %v, have %v", want, have)
+	}
+
+	// A peer that fails a few health checks is dead. One that passes is
+	// alive again.
+	atomic.StoreInt32(bHealthy, 0)
+	atomic.StoreInt32(cHealthy, 1)
+	for i := 0; i < staticPeerFailures; i++ {
+		if want, have := 3, len(peer.Current(PeerTypeStore)); want != have {
+			t.Fatalf("after %d failed checks: want %d store peers, have %d", i, want, have)
+		}
+		check()
+	}
+	if want, have := sorted([]string{"10.0.0.1:7650", hostport(a)}), sorted(peer.Current(PeerTypeStore)); !reflect.DeepEqual(want, have) {
+		t.Errorf("store: want %v, have %v", want, have)
+	}
+	if want, have := []string{hostport(c)}, peer.Current(PeerTypeIngest); !reflect.DeepEqual(want, have) {
+		t.Errorf("ingest: want %v, have %v", want, have)
+	}
+	states := map[string]string{}
+	for _, s := range peer.Peers() {
+		states[s.Name] = s.State
+	}
+	if want, have := map[string]string{
+		"10.0.0.1:7650": PeerStateAlive,
+		hostport(a):     PeerStateAlive,
+		hostport(b):     PeerStateDead,
+		hostport(c):     PeerStateAlive,
+	}, states; !reflect.DeepEqual(want, have) {
+		t.Errorf("states: want %v, have %v", want, have)
+	}
+
+	// Peers can be replaced, e.g. on SIGHUP.
+	if err := peer.SetStaticPeers([]StaticPeer{staticPeer(t, PeerTypeStore, b)}); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(bHealthy, 1)
+	check()
+	if want, have := sorted([]string{"10.0.0.1:7650", hostport(b)}), sorted(peer.Current(PeerTypeStore)); !reflect.DeepEqual(want, have) {
+		t.Errorf("after reload: want %v, have %v", want, have)
+	}
+	if want, have := 2, peer.ClusterSize(); want != have {
+		t.Errorf("cluster size: want %d, have %d", want, have)
+	}
+}
+
+// newHealthServer serves /health, which is OK while healthy is nonzero.
+func newHealthServer() (*httptest.Server, *int32) {
+	healthy := int32(1)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || atomic.LoadInt32(&healthy) == 0 {
+			http.Error(w, "unhealthy", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})), &healthy
+}
+
+func staticPeer(t *testing.T, typ PeerType, server *httptest.Server) StaticPeer {
+	host, port, err := net.SplitHostPort(hostport(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return StaticPeer{Type: typ, APIAddr: host, APIPort: p}
+}
+
+func hostport(server *httptest.Server) string {
+	return strings.TrimPrefix(server.URL, "http://")
+}
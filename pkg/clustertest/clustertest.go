@@ -0,0 +1,434 @@
+// Package clustertest runs a small OK Log cluster in the test process, of
+// ingest and store nodes, on ephemeral ports, with virtual filesystems, so
+// integration tests can write records to it, and query and stream them, like
+// they would a real one.
+package clustertest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/store"
+)
+
+// These are the timings of the cluster's nodes, much shorter than the
+// defaults, so records make it from an ingester to the stores in well under
+// a second.
+const (
+	healthInterval    = 50 * time.Millisecond
+	segmentFlushAge   = 10 * time.Millisecond
+	segmentFlushSize  = 1024 * 1024
+	segmentTargetSize = 128 * 1024
+	segmentTargetAge  = 10 * time.Millisecond
+	segmentDelay      = 10 * time.Millisecond
+	pendingTimeout    = time.Minute
+	takeoverTimeout   = time.Second
+)
+
+// Cluster is a running cluster. Its nodes know each other as static peers,
+// so there's no gossip. Close it when the test is done.
+type Cluster struct {
+	Ingesters []*Node
+	Stores    []*Node
+
+	client *http.Client
+
+	mtx     sync.Mutex
+	next    int // ingester to write to
+	written int // records
+}
+
+// Node is a node of the cluster.
+type Node struct {
+	Type       cluster.PeerType
+	Addr       string // of its API, as host:port
+	IngestAddr string // of its fast ingest listener, as host:port, for ingest nodes
+
+	stop []func() // last to first, like defers
+}
+
+// Start a cluster of ingesters ingest nodes, and stores store nodes, which
+// replicate each segment to replicationFactor of them. Start returns once
+// every node sees the others.
+func Start(ingesters, stores, replicationFactor int) (*Cluster, error) {
+	if ingesters <= 0 || stores <= 0 {
+		return nil, errors.Errorf("need at least one ingest and one store node, have %d and %d", ingesters, stores)
+	}
+	if replicationFactor <= 0 {
+		return nil, errors.Errorf("invalid replication factor %d", replicationFactor)
+	}
+
+	// All the listeners first, so every node knows its peers' addresses.
+	c := &Cluster{client: &http.Client{}}
+	var (
+		nodes     []*Node
+		listeners []net.Listener
+	)
+	for i := 0; i < ingesters+stores; i++ {
+		typ := cluster.PeerTypeIngest
+		if i >= ingesters {
+			typ = cluster.PeerTypeStore
+		}
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return nil, errors.Wrap(err, "API listener")
+		}
+		listeners = append(listeners, ln)
+		n := &Node{Type: typ, Addr: ln.Addr().String()}
+		nodes = append(nodes, n)
+		if typ == cluster.PeerTypeIngest {
+			c.Ingesters = append(c.Ingesters, n)
+		} else {
+			c.Stores = append(c.Stores, n)
+		}
+	}
+
+	for i, n := range nodes {
+		var peers []cluster.StaticPeer
+		for _, other := range nodes {
+			if other != n {
+				peers = append(peers, staticPeer(other))
+			}
+		}
+		var err error
+		if n.Type == cluster.PeerTypeIngest {
+			err = n.startIngest(listeners[i], peers)
+		} else {
+			err = n.startStore(listeners[i], peers, replicationFactor)
+		}
+		if err != nil {
+			for _, ln := range listeners[i+1:] {
+				ln.Close()
+			}
+			c.Close()
+			return nil, errors.Wrapf(err, "starting %s node %s", n.Type, n.Addr)
+		}
+	}
+
+	if err := c.waitForPeers(5 * time.Second); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func staticPeer(n *Node) cluster.StaticPeer {
+	host, port := splitHostPort(n.Addr)
+	return cluster.StaticPeer{Type: n.Type, APIAddr: host, APIPort: port}
+}
+
+func splitHostPort(hostport string) (string, int) {
+	host, portStr, _ := net.SplitHostPort(hostport)
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+// newPeer returns the node's static peer, and serves its health check, and
+// cluster API, on the mux.
+func (n *Node) newPeer(mux *http.ServeMux, peers []cluster.StaticPeer) (*cluster.Peer, error) {
+	host, port := splitHostPort(n.Addr)
+	peer, err := cluster.NewStaticPeer(host, n.Type, port, "", nil, peers, &http.Client{}, healthInterval, log.NewNopLogger())
+	if err != nil {
+		return nil, err
+	}
+	n.stop = append(n.stop, func() { peer.Leave(time.Second) })
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintln(w, "OK") })
+	mux.Handle("/cluster/", http.StripPrefix("/cluster", cluster.NewAPI(peer)))
+	return peer, nil
+}
+
+// serve the mux on the listener, until the node is stopped.
+func (n *Node) serve(ln net.Listener, mux *http.ServeMux) {
+	server := &http.Server{Handler: mux}
+	done := make(chan struct{})
+	go func() { server.Serve(ln); close(done) }()
+	n.stop = append(n.stop, func() { server.Close(); <-done })
+}
+
+func (n *Node) startIngest(ln net.Listener, peers []cluster.StaticPeer) error {
+	mux := http.NewServeMux()
+	n.serve(ln, mux)
+	peer, err := n.newPeer(mux, peers)
+	if err != nil {
+		return err
+	}
+	ingestLog, err := ingest.NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		return err
+	}
+
+	fastListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return errors.Wrap(err, "fast ingest listener")
+	}
+	n.IngestAddr = fastListener.Addr().String()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ingest.HandleConnections(fastListener, ingest.ConnectionConfig{
+			Handler:          ingest.HandleFastWriter,
+			ReaderFactory:    record.DynamicReaderFactory(record.MaxSize, record.Truncate, nil),
+			Log:              ingestLog,
+			SegmentFlushAge:  segmentFlushAge,
+			SegmentFlushSize: segmentFlushSize,
+			ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+			Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+			Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+			Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+			SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		})
+	}()
+	n.stop = append(n.stop, func() { fastListener.Close(); <-done })
+
+	api := ingest.NewAPI(
+		peer, ingestLog, pendingTimeout, takeoverTimeout,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		newDuration(),
+	)
+	n.stop = append(n.stop, api.Stop)
+	mux.Handle("/ingest/", http.StripPrefix("/ingest", api))
+	return nil
+}
+
+func (n *Node) startStore(ln net.Listener, peers []cluster.StaticPeer, replicationFactor int) error {
+	mux := http.NewServeMux()
+	n.serve(ln, mux)
+	peer, err := n.newPeer(mux, peers)
+	if err != nil {
+		return err
+	}
+	var (
+		reporter = store.LogReporter{Logger: log.NewNopLogger()}
+		client   = &http.Client{}
+	)
+	storeLog, err := store.NewFileLog(fs.NewVirtualFilesystem(), "/", segmentTargetSize, 1024, store.FileLogConfig{Reporter: reporter})
+	if err != nil {
+		return err
+	}
+	api := store.NewAPI(peer, storeLog, store.APIConfig{
+		QueryClient:        client,
+		StreamClient:       client,
+		ReplicatedSegments: prometheus.NewCounter(prometheus.CounterOpts{}),
+		ReplicatedBytes:    prometheus.NewCounter(prometheus.CounterOpts{}),
+		Duration:           newDuration(),
+		Reporter:           reporter,
+	})
+	n.stop = append(n.stop, func() { api.Close() })
+	mux.Handle("/store/", http.StripPrefix("/store", api))
+
+	consumer := store.NewConsumer(
+		peer, peer.APIAddr(), client,
+		segmentTargetSize, segmentTargetAge, segmentDelay,
+		replicationFactor,
+		0, 0,
+		nil, nil, nil,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		reporter,
+	)
+	go consumer.Run()
+	n.stop = append(n.stop, consumer.Stop)
+	return nil
+}
+
+func newDuration() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+}
+
+// waitForPeers waits until every node sees every other as alive.
+func (c *Cluster) waitForPeers(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for _, n := range append(append([]*Node{}, c.Ingesters...), c.Stores...) {
+		for {
+			var states []cluster.PeerState
+			err := c.getJSON(n.Addr, "/cluster"+cluster.APIPathState, &states)
+			alive := 0
+			for _, s := range states {
+				if s.State == cluster.PeerStateAlive {
+					alive++
+				}
+			}
+			if err == nil && alive == len(c.Ingesters)+len(c.Stores) {
+				break
+			}
+			if time.Now().After(deadline) {
+				return errors.Errorf("%s sees %d of %d nodes alive (%v)", n.Addr, alive, len(c.Ingesters)+len(c.Stores), err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// WriteRecords writes the records, one per line, to an ingester, as a
+// forwarder would, taking each ingester in turn. A record's first word is
+// its topic, if it's a valid one; otherwise, it's record.DefaultTopic. They're written once
+// WriteRecords returns, but have yet to be replicated to the stores;
+// WaitForReplication waits for that.
+func (c *Cluster) WriteRecords(records ...string) error {
+	c.mtx.Lock()
+	n := c.Ingesters[c.next%len(c.Ingesters)]
+	c.next++
+	c.mtx.Unlock()
+
+	conn, err := net.Dial("tcp", n.IngestAddr)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(conn)
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\n", r)
+	}
+	if err := w.Flush(); err != nil {
+		conn.Close()
+		return err
+	}
+	// The ingester reads to the end of the connection, and closes its own,
+	// once the records are in its log.
+	conn.(*net.TCPConn).CloseWrite()
+	ioutil.ReadAll(conn)
+	conn.Close()
+
+	c.mtx.Lock()
+	c.written += len(records)
+	c.mtx.Unlock()
+	return nil
+}
+
+// WaitForReplication waits until every record written to the cluster so far
+// can be queried, or returns an error after timeout.
+func (c *Cluster) WaitForReplication(timeout time.Duration) error {
+	c.mtx.Lock()
+	want := c.written
+	c.mtx.Unlock()
+	deadline := time.Now().Add(timeout)
+	for {
+		records, err := c.Query("")
+		if err == nil && len(records) >= want {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("after %s, %d of %d records replicated (%v)", timeout, len(records), want, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Query the records, of all time, matching q, via the first store node. The
+// records are returned in the order of their ULIDs, as they're stored, i.e. their topic, then
+// the record, but without their ULIDs.
+func (c *Cluster) Query(q string) ([]string, error) {
+	uri := fmt.Sprintf("http://%s/store%s?from=%s&to=now&q=%s", c.Stores[0].Addr, store.APIPathUserQuery, ulid.ULID{}, url.QueryEscape(q))
+	resp, err := c.client.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s: %s", store.APIPathUserQuery, resp.Status)
+	}
+	var result store.QueryResult
+	if err := result.DecodeFrom(resp); err != nil {
+		return nil, errors.Wrap(err, "decoding query result")
+	}
+	defer result.Records.Close()
+	var records []string
+	s := record.NewScanner(result.Records)
+	for s.Scan() {
+		records = append(records, stripULID(s.Text()))
+	}
+	return records, s.Err()
+}
+
+// Stream the records matching q, as they're written to the cluster, from the
+// time Stream is invoked, via the first store node. Records are sent on the
+// returned chan, like Query returns them, until the context is done, when it's
+// closed.
+func (c *Cluster) Stream(ctx context.Context, q string) (<-chan string, error) {
+	uri := fmt.Sprintf("http://%s/store%s?q=%s&window=10ms", c.Stores[0].Addr, store.APIPathUserStream, url.QueryEscape(q))
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("GET %s: %s", store.APIPathUserStream, resp.Status)
+	}
+	records := make(chan string)
+	go func() {
+		defer close(records)
+		defer resp.Body.Close()
+		s := record.NewScanner(resp.Body)
+		for s.Scan() {
+			if len(s.Bytes()) == 0 {
+				continue // heartbeat
+			}
+			select {
+			case records <- stripULID(s.Text()):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return records, nil
+}
+
+func stripULID(record string) string {
+	if len(record) > ulid.EncodedSize && record[ulid.EncodedSize] == ' ' {
+		return record[ulid.EncodedSize+1:]
+	}
+	return record
+}
+
+func (c *Cluster) getJSON(hostport, path string, v interface{}) error {
+	resp, err := c.client.Get("http://" + hostport + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("GET %s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Close stops every node, stores first, so nothing is left consuming, and
+// waits for them. Each node stops what it started in reverse: its consumer
+// before its API, and its API before its server.
+func (c *Cluster) Close() {
+	for _, n := range append(append([]*Node{}, c.Stores...), c.Ingesters...) {
+		for i := len(n.stop) - 1; i >= 0; i-- {
+			n.stop[i]()
+		}
+	}
+}
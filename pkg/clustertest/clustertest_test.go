@@ -0,0 +1,127 @@
+package clustertest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+
+	c, err := Start(2, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Records forwarded to each ingester make it to the stores, and are
+	// queried from all of them, once each.
+	var want []string
+	for i := 0; i < 4; i++ {
+		records := []string{fmt.Sprintf("greeting hello %d", i), fmt.Sprintf("greeting goodbye %d", i)}
+		if err := c.WriteRecords(records...); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, records[0])
+	}
+	if err := c.WaitForReplication(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	have, err := c.Query("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(have) // records written to different ingesters at once are in no order
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	c, err := Start(1, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	records, err := c.Stream(ctx, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stream only sees records once it's connected to every store node,
+	// so keep writing until one comes through.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+			c.WriteRecords("greeting goodbye", "greeting hello")
+		}
+	}()
+	select {
+	case record := <-records:
+		if want, have := "greeting hello", record; want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no record streamed")
+	}
+
+	// The chan is closed once the context is done.
+	cancel()
+	for range records {
+	}
+}
+
+func TestBigRecords(t *testing.T) {
+	t.Parallel()
+
+	c, err := Start(1, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Records bigger than bufio.MaxScanTokenSize, up to the biggest that
+	// ingesters accept, make it through, as they're consumed, replicated,
+	// merged, and queried, and so do their neighbours.
+	want := []string{
+		"big " + strings.Repeat("a", 100*1024),
+		"small b",
+		"big " + strings.Repeat("c", record.MaxSize-len("big ")), // as the topic counts, here
+	}
+	if err := c.WriteRecords(want...); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitForReplication(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	have, err := c.Query("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != len(have) {
+		t.Fatalf("want %d records, have %d", len(want), len(have))
+	}
+	for i := range want {
+		if want[i] != have[i] {
+			t.Errorf("record %d: want %d bytes, have %d: %.32q...", i, len(want[i]), len(have[i]), have[i])
+		}
+	}
+}
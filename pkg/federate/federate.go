@@ -0,0 +1,175 @@
+// Package federate queries, and streams, several independent OK Log clusters
+// as one, e.g. a cluster per region, without joining them. Each cluster is
+// asked through one of its store nodes, which deduplicates the records of its
+// own cluster, as usual. The clusters' records are merged in ULID order, but
+// never deduplicated across clusters, since they're different records, however
+// alike; they may be labeled with the name of their cluster, to tell them
+// apart.
+package federate
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/store"
+	"github.com/oklog/oklog/pkg/stream"
+)
+
+// Cluster is one of the clusters of a federation.
+type Cluster struct {
+	Name string // labels its records, e.g. us-east
+	Addr string // API address of one of its store nodes, i.e. host:port
+}
+
+// validName is what a cluster's name may be: it's written into records, as a
+// label, so it mustn't hold spaces.
+var validName = regexp.MustCompile(`^[0-9A-Za-z_.-]{1,64}$`)
+
+// ParseCluster parses a cluster given as name=host:port.
+func ParseCluster(s string) (Cluster, error) {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return Cluster{}, errors.Errorf("%q: want name=host:port", s)
+	}
+	c := Cluster{Name: s[:i], Addr: s[i+1:]}
+	if !validName.MatchString(c.Name) {
+		return Cluster{}, errors.Errorf("%q: name must be 1 to 64 letters, digits, or any of _.-", s)
+	}
+	if c.Addr == "" {
+		return Cluster{}, errors.Errorf("%q: missing address", s)
+	}
+	return c, nil
+}
+
+// Coordinator queries and streams a federation of clusters. It has no state of
+// its own beyond its clusters, so one may serve any number of requests, at
+// once.
+type Coordinator struct {
+	clusters []Cluster
+	client   stream.Doer
+	scheme   string
+}
+
+// NewCoordinator returns a Coordinator of the clusters, whose names must be
+// valid, and unique. Requests are made with the client, by the scheme, http or
+// https; the client mustn't time out if it's used for streams, since they
+// don't end, and it's the place to add auth tokens.
+func NewCoordinator(clusters []Cluster, client stream.Doer, scheme string) (*Coordinator, error) {
+	if len(clusters) == 0 {
+		return nil, errors.New("no clusters")
+	}
+	seen := map[string]bool{}
+	for _, c := range clusters {
+		if !validName.MatchString(c.Name) {
+			return nil, errors.Errorf("cluster %q: invalid name", c.Name)
+		}
+		if seen[c.Name] {
+			return nil, errors.Errorf("cluster %q: given twice", c.Name)
+		}
+		seen[c.Name] = true
+	}
+	return &Coordinator{
+		clusters: clusters,
+		client:   client,
+		scheme:   scheme,
+	}, nil
+}
+
+// ClusterResult is how a federated query went on one cluster.
+type ClusterResult struct {
+	Cluster Cluster
+	Result  store.QueryResult // its Records are merged into the federated Result's
+	Err     error             // if the cluster failed, at once or while its records are read
+}
+
+// Result of a federated query.
+type Result struct {
+	// Clusters are in the order of the Coordinator's clusters.
+	Clusters []ClusterResult
+
+	// Records of every cluster that answered, merged in the direction of the
+	// query; those with the same ULID come in the order of their clusters. A
+	// cluster whose records fail partway through has its Err set, and its
+	// remaining records are left out, so Records itself doesn't fail; check
+	// the Clusters once it's read.
+	Records io.ReadCloser
+}
+
+// Failed returns the number of clusters with errors.
+func (r Result) Failed() int {
+	var n int
+	for _, c := range r.Clusters {
+		if c.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Query every cluster at once, with params as per the store API's query
+// endpoint, e.g. from, to, q, and direction. Continuations and limits are
+// per-cluster, so they aren't supported; JSON and statistics-only results
+// aren't either. If label is true, each record is labeled with the name of its
+// cluster, between its ULID and the record.
+//
+// Query doesn't fail as a whole: clusters that fail have their Err set in the
+// Result, and the others' records are merged regardless.
+func (c *Coordinator) Query(ctx context.Context, params url.Values, label bool) Result {
+	results := make([]ClusterResult, len(c.clusters))
+	var wg sync.WaitGroup
+	for i := range c.clusters {
+		results[i].Cluster = c.clusters[i]
+		wg.Add(1)
+		go func(r *ClusterResult) {
+			defer wg.Done()
+			r.Err = c.query(ctx, r, params)
+		}(&results[i])
+	}
+	wg.Wait()
+	backward := params.Get("direction") == "backward"
+	return Result{
+		Clusters: results,
+		Records:  newMergeReadCloser(results, backward, label),
+	}
+}
+
+// query the cluster of r, and decode its result into r.
+func (c *Coordinator) query(ctx context.Context, r *ClusterResult, params url.Values) error {
+	u := url.URL{
+		Scheme:   c.scheme,
+		Host:     r.Cluster.Addr,
+		Path:     "/store" + store.APIPathUserQuery,
+		RawQuery: params.Encode(),
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return errors.Wrap(err, "NewRequest")
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent: // ErrorCount says how partial
+	case http.StatusBadRequest:
+		buf, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return errors.Errorf("GET: %s: %s", resp.Status, strings.TrimSpace(string(buf)))
+	default:
+		resp.Body.Close()
+		return errors.Errorf("GET: %s", resp.Status)
+	}
+	if err := r.Result.DecodeFrom(resp); err != nil {
+		resp.Body.Close()
+		return errors.Wrap(err, "decoding query result")
+	}
+	return nil
+}
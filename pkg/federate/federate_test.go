@@ -0,0 +1,305 @@
+package federate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/store"
+	"github.com/oklog/oklog/pkg/stream"
+)
+
+func TestParseCluster(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		input string
+		want  Cluster
+		err   bool
+	}{
+		{"us-east=host1:7650", Cluster{"us-east", "host1:7650"}, false},
+		{"eu_west.2=10.0.0.1:7650", Cluster{"eu_west.2", "10.0.0.1:7650"}, false},
+		{"host1:7650", Cluster{}, true},
+		{"=host1:7650", Cluster{}, true},
+		{"us east=host1:7650", Cluster{}, true},
+		{"us-east=", Cluster{}, true},
+	} {
+		have, err := ParseCluster(testcase.input)
+		if want, have := testcase.err, err != nil; want != have {
+			t.Errorf("%q: want error %v, have %v", testcase.input, want, err)
+			continue
+		}
+		if want := testcase.want; want != have {
+			t.Errorf("%q: want %+v, have %+v", testcase.input, want, have)
+		}
+	}
+}
+
+func TestNewCoordinator(t *testing.T) {
+	t.Parallel()
+
+	for _, clusters := range [][]Cluster{
+		nil,
+		{{"a", "host1:7650"}, {"a", "host2:7650"}},
+		{{"a b", "host1:7650"}},
+	} {
+		if _, err := NewCoordinator(clusters, http.DefaultClient, "http"); err == nil {
+			t.Errorf("%v: want error, have none", clusters)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+
+	var (
+		east = newFakeCluster(id(1)+" one", id(3)+" three", id(5)+" same")
+		west = newFakeCluster(id(2)+" two", id(5)+" same", id(6)+" six")
+		down = httptest.NewServer(http.NotFoundHandler())
+		torn = newFakeCluster(id(4) + " four")
+	)
+	torn.fail = true
+	for _, s := range []*httptest.Server{east.Server, west.Server, down, torn.Server} {
+		defer s.Close()
+	}
+	c, err := NewCoordinator([]Cluster{
+		{"east", addr(east.Server)},
+		{"west", addr(west.Server)},
+		{"down", addr(down)},
+		{"torn", addr(torn.Server)},
+	}, http.DefaultClient, "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		name      string
+		direction string
+		label     bool
+		want      []string
+	}{
+		{
+			name: "forward",
+			want: []string{
+				id(1) + " one", id(2) + " two", id(3) + " three",
+				id(5) + " same", id(5) + " same", id(6) + " six",
+			},
+		},
+		{
+			name:      "backward",
+			direction: "backward",
+			want: []string{
+				id(6) + " six", id(5) + " same", id(5) + " same",
+				id(3) + " three", id(2) + " two", id(1) + " one",
+			},
+		},
+		{
+			name:  "labeled",
+			label: true,
+			want: []string{
+				id(1) + " east one", id(2) + " west two", id(3) + " east three",
+				id(5) + " east same", id(5) + " west same", id(6) + " west six",
+			},
+		},
+	} {
+		params := url.Values{"from": {id(0)}, "to": {id(9)}, "q": {"needle"}}
+		if testcase.direction != "" {
+			params.Set("direction", testcase.direction)
+		}
+		result := c.Query(context.Background(), params, testcase.label)
+		buf, err := ioutil.ReadAll(result.Records)
+		result.Records.Close()
+		if err != nil {
+			t.Errorf("%s: %v", testcase.name, err)
+			continue
+		}
+		if want, have := testcase.want, strings.Split(strings.TrimSpace(string(buf)), "\n"); !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+
+		// Each cluster is reported on, in order: down failed at once, and
+		// torn as its records were read, so the record it tore is left out.
+		var failed []string
+		for i, r := range result.Clusters {
+			if want, have := c.clusters[i], r.Cluster; want != have {
+				t.Errorf("%s: cluster %d: want %v, have %v", testcase.name, i, want, have)
+			}
+			if r.Err != nil {
+				failed = append(failed, r.Cluster.Name)
+			} else if want, have := "needle", r.Result.Params.Q; want != have {
+				t.Errorf("%s: %s: q: want %q, have %q", testcase.name, r.Cluster.Name, want, have)
+			}
+		}
+		if want, have := []string{"down", "torn"}, failed; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: failed: want %v, have %v", testcase.name, want, have)
+		}
+		if want, have := 2, result.Failed(); want != have {
+			t.Errorf("%s: Failed: want %d, have %d", testcase.name, want, have)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	var (
+		east = newFakeCluster(id(1)+" one", id(3)+" same", id(4)+" four")
+		west = newFakeCluster(id(2)+" two", id(3)+" same")
+		down = httptest.NewServer(http.NotFoundHandler())
+	)
+	for _, s := range []*httptest.Server{east.Server, west.Server, down} {
+		defer s.Close()
+	}
+	c, err := NewCoordinator([]Cluster{
+		{"east", addr(east.Server)},
+		{"west", addr(west.Server)},
+		{"down", addr(down)},
+	}, http.DefaultClient, "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		name  string
+		since ulid.ULID
+		label bool
+		want  []string
+	}{
+		{
+			name: "all",
+			want: []string{id(1) + " one", id(2) + " two", id(3) + " same", id(3) + " same", id(4) + " four"},
+		},
+		{
+			name:  "since",
+			since: ulid.MustParse(id(2)),
+			label: true,
+			want:  []string{id(3) + " east same", id(3) + " west same", id(4) + " east four"},
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		params := url.Values{}
+		if testcase.since != (ulid.ULID{}) {
+			params.Set("since", testcase.since.String())
+		}
+		records, errs := c.Stream(ctx, params, 100*time.Millisecond, testcase.label, stream.BackoffPolicy{Base: time.Millisecond, Max: time.Millisecond})
+		var have []string
+		for len(have) < len(testcase.want) {
+			select {
+			case record := <-records:
+				have = append(have, string(record))
+			case <-time.After(5 * time.Second):
+				cancel()
+				t.Fatalf("%s: timeout, have %q", testcase.name, have)
+			}
+		}
+		if want := testcase.want; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+
+		// The cluster that's down is reported by name.
+		select {
+		case err := <-errs:
+			if want, have := "down", err.(stream.PeerError).Addr; want != have {
+				t.Errorf("%s: error: want %s, have %s (%v)", testcase.name, want, have, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: timeout waiting for an error", testcase.name)
+		}
+		cancel()
+		for range records {
+		}
+	}
+}
+
+func TestStreamInvalidWindow(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewCoordinator([]Cluster{{"a", "localhost:0"}}, http.DefaultClient, "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, errs := c.Stream(context.Background(), url.Values{}, 0, false, stream.DefaultBackoffPolicy)
+	if want, have := stream.ErrInvalidWindow, <-errs; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if _, ok := <-records; ok {
+		t.Error("records: want closed, have a record")
+	}
+}
+
+// fakeCluster serves the query and stream endpoints of the store API, like a
+// store node of a cluster holding the records, which are in order.
+type fakeCluster struct {
+	*httptest.Server
+	records []string
+	fail    bool // queries fail partway through the last record
+}
+
+func newFakeCluster(records ...string) *fakeCluster {
+	c := &fakeCluster{records: records}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/store"+store.APIPathUserQuery, c.query)
+	mux.HandleFunc("/store"+store.APIPathUserStream, c.stream)
+	c.Server = httptest.NewServer(mux)
+	return c
+}
+
+func (c *fakeCluster) query(w http.ResponseWriter, r *http.Request) {
+	records := append([]string(nil), c.records...)
+	if r.URL.Query().Get("direction") == "backward" {
+		for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+			records[i], records[j] = records[j], records[i]
+		}
+	}
+	var body io.Reader = strings.NewReader(strings.Join(records, "\n") + "\n")
+	if c.fail {
+		s := strings.Join(records, "\n")
+		body = io.MultiReader(strings.NewReader(s[:len(s)-2]), failingReader{})
+	}
+	result := store.QueryResult{Records: ioutil.NopCloser(body)}
+	result.Params.From.Parse(r.URL.Query().Get("from"))
+	result.Params.To.Parse(r.URL.Query().Get("to"))
+	result.Params.Q = r.URL.Query().Get("q")
+	result.EncodeTo(w)
+}
+
+func (c *fakeCluster) stream(w http.ResponseWriter, r *http.Request) {
+	var since string
+	if s := r.URL.Query().Get("since"); s != "" {
+		since = s
+	}
+	for _, record := range c.records {
+		if record[:ulid.EncodedSize] > since {
+			fmt.Fprintf(w, "%s\n", record)
+		}
+	}
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case <-time.After(10 * time.Millisecond):
+			fmt.Fprintf(w, "\n") // heartbeat
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("query timed out") }
+
+func id(i int) string { return ulid.MustNew(uint64(1500000000000+i), nil).String() }
+
+func addr(s *httptest.Server) string { return strings.TrimPrefix(s.URL, "http://") }
@@ -0,0 +1,114 @@
+package federate
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+)
+
+// mergeReadCloser merges the records of clusters' query results by ULID,
+// keeping every record, even the same one from two clusters. It's read by one
+// goroutine, which sets the Err of a cluster whose records fail.
+type mergeReadCloser struct {
+	results  []ClusterResult
+	cursors  []*mergeCursor // of the clusters still being read
+	backward bool           // descending ULIDs, newest first
+	label    bool
+	buf      []byte // what's left of the record being read out
+}
+
+// mergeCursor is the next record of a cluster.
+type mergeCursor struct {
+	result *ClusterResult
+	r      *bufio.Reader
+	record []byte // with its newline
+}
+
+func newMergeReadCloser(results []ClusterResult, backward, label bool) *mergeReadCloser {
+	m := &mergeReadCloser{results: results, backward: backward, label: label}
+	for i := range results {
+		if results[i].Err != nil || results[i].Result.Records == nil {
+			continue
+		}
+		c := &mergeCursor{result: &results[i], r: bufio.NewReader(results[i].Result.Records)}
+		if c.advance() {
+			m.cursors = append(m.cursors, c)
+		}
+	}
+	return m
+}
+
+// advance reads the next record, and returns false if there isn't one, in
+// which case the cluster's Err is set if its records failed.
+func (c *mergeCursor) advance() bool {
+	for {
+		line, err := c.r.ReadBytes('\n')
+		if err == io.EOF && len(line) > 0 {
+			line, err = append(line, '\n'), nil // the last record, unterminated
+		}
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			c.result.Err = errors.Wrap(err, "reading records")
+			return false
+		}
+		if len(line) <= ulid.EncodedSize {
+			continue // not a record
+		}
+		c.record = line
+		return true
+	}
+}
+
+// next returns the index of the cursor with the next record to be read out.
+func (m *mergeReadCloser) next() int {
+	var j int
+	for i := 1; i < len(m.cursors); i++ {
+		cmp := bytes.Compare(m.cursors[i].record[:ulid.EncodedSize], m.cursors[j].record[:ulid.EncodedSize])
+		if (!m.backward && cmp < 0) || (m.backward && cmp > 0) {
+			j = i
+		}
+	}
+	return j
+}
+
+func (m *mergeReadCloser) Read(p []byte) (int, error) {
+	for len(m.buf) == 0 {
+		if len(m.cursors) == 0 {
+			return 0, io.EOF
+		}
+		i := m.next()
+		c := m.cursors[i]
+		if m.label {
+			m.buf = append(m.buf, c.record[:ulid.EncodedSize+1]...)
+			m.buf = append(m.buf, c.result.Cluster.Name...)
+			m.buf = append(m.buf, ' ')
+			m.buf = append(m.buf, c.record[ulid.EncodedSize+1:]...)
+		} else {
+			m.buf = append(m.buf, c.record...)
+		}
+		if !c.advance() {
+			m.cursors = append(m.cursors[:i], m.cursors[i+1:]...)
+		}
+	}
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+// Close the records of every cluster.
+func (m *mergeReadCloser) Close() error {
+	var err error
+	for _, r := range m.results {
+		if r.Result.Records != nil {
+			if cerr := r.Result.Records.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,247 @@
+package federate
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/store"
+	"github.com/oklog/oklog/pkg/stream"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+// streamIdleTimeout is how long a stream waits for data, or heartbeats, from a
+// cluster before reconnecting. Store nodes send a heartbeat every ten seconds.
+const streamIdleTimeout = 30 * time.Second
+
+// Stream the records of every cluster, with params as per the store API's
+// stream endpoint, e.g. q, since, and window, until the context is canceled,
+// when both chans are closed. Each record is a ULID, a space, and the record,
+// without its newline; if label is true, the name of its cluster, and a space,
+// come between them.
+//
+// Each cluster deduplicates its own records within its window; its stream is
+// then merged with the others' in ULID order, within this window, so records
+// are delivered up to both windows after they're written. Records of different
+// clusters are never deduplicated, even if they have the same ULID. Failed
+// connections to clusters are retried by the backoff policy, and sent as
+// PeerErrors, with the cluster's name as their Addr, to the error chan, which
+// is buffered, and dropped if it's full. A zero or negative window fails the
+// stream with ErrInvalidWindow.
+func (c *Coordinator) Stream(ctx context.Context, params url.Values, window time.Duration, label bool, backoff stream.BackoffPolicy) (<-chan []byte, <-chan error) {
+	var (
+		records = make(chan []byte, 1024)
+		errs    = make(chan error, 64)
+	)
+	if window <= 0 {
+		errs <- stream.ErrInvalidWindow
+		close(errs)
+		close(records)
+		return records, errs
+	}
+
+	// Execute resumes each cluster after the last record it sent, so since
+	// and topic are its to set, per connection.
+	params = copyValues(params)
+	peerErrs := make(chan stream.PeerError, cap(errs))
+	options := []stream.ExecuteOption{
+		stream.WithBackoff(backoff),
+		stream.WithIdleTimeout(streamIdleTimeout),
+		stream.WithErrors(peerErrs),
+		stream.WithTopic(params.Get("topic")),
+	}
+	if s := params.Get("since"); s != "" {
+		since, err := ulid.Parse(s)
+		if err != nil {
+			errs <- errors.Wrap(err, "since")
+			close(errs)
+			close(records)
+			return records, errs
+		}
+		options = append(options, stream.WithSince(since))
+	}
+	params.Del("since")
+	params.Del("topic")
+	params.Del("errors") // they're comments, not records
+
+	var (
+		names = make([]string, len(c.clusters))
+		addrs = map[string]string{}
+	)
+	for i, cluster := range c.clusters {
+		names[i] = cluster.Name
+		addrs[cluster.Name] = cluster.Addr
+	}
+	rcf := stream.HTTPReadCloserFactory(c.client, func(name string) string {
+		return (&url.URL{
+			Scheme:   c.scheme,
+			Host:     addrs[name],
+			Path:     "/store" + store.APIPathUserStream,
+			RawQuery: params.Encode(),
+		}).String()
+	})
+
+	// Records are labeled as they arrive, when they're still known by their
+	// cluster.
+	rcf = labeler(rcf, label)
+
+	// Execute returns when the context is canceled, once its connections
+	// are done, so nothing is sent to raw, or peerErrs, after that.
+	raw := make(chan []byte, 1024)
+	go func() {
+		stream.Execute(ctx, func() []string { return names }, rcf, time.Sleep, time.NewTicker, raw, options...)
+		close(raw)
+		close(peerErrs)
+	}()
+	go func() {
+		for err := range peerErrs {
+			select {
+			case errs <- err:
+			default:
+			}
+		}
+		close(errs)
+	}()
+
+	// reorder returns when raw is closed. Records still buffered then are
+	// drained, whether or not anyone's reading, so it doesn't block.
+	ordered := make(chan []byte, 1024)
+	go func() {
+		reorder(raw, window, time.NewTicker, ordered)
+		close(ordered)
+	}()
+	go func() {
+		defer close(records)
+		for line := range ordered {
+			select {
+			case records <- line:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return records, errs
+}
+
+// labeler returns a ReadCloserFactory of rcf's streams, whose records are
+// labeled with the name of their cluster, i.e. the addr they're read from, if
+// label is true.
+func labeler(rcf stream.ReadCloserFactory, label bool) stream.ReadCloserFactory {
+	if !label {
+		return rcf
+	}
+	return func(ctx context.Context, name string) (io.ReadCloser, error) {
+		rc, err := rcf(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		return newLabelReadCloser(rc, name), nil
+	}
+}
+
+// labelReadCloser labels the records of a cluster's stream with its name,
+// after their ULIDs, and passes heartbeats through. Lines that aren't records
+// are dropped.
+type labelReadCloser struct {
+	*io.PipeReader
+	rc io.ReadCloser
+}
+
+func newLabelReadCloser(rc io.ReadCloser, name string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		s := record.NewScanner(rc)
+		var buf []byte
+		for s.Scan() {
+			line := s.Bytes()
+			switch {
+			case len(line) == 0:
+				buf = append(buf[:0], '\n') // heartbeat
+			case len(line) <= ulid.EncodedSize || line[ulid.EncodedSize] != ' ':
+				continue
+			default:
+				buf = append(buf[:0], line[:ulid.EncodedSize+1]...)
+				buf = append(buf, name...)
+				buf = append(buf, ' ')
+				buf = append(buf, line[ulid.EncodedSize+1:]...)
+				buf = append(buf, '\n')
+			}
+			if _, err := pw.Write(buf); err != nil {
+				return
+			}
+		}
+		pw.CloseWithError(s.Err())
+	}()
+	return labelReadCloser{pr, rc}
+}
+
+func (rc labelReadCloser) Close() error {
+	rc.PipeReader.Close()
+	return rc.rc.Close()
+}
+
+// reorder sends the records of in to out in ULID order, holding each for the
+// window, until in is closed, when the records still held are sent, too. Unlike
+// stream.Deduplicate, which it mirrors, it keeps records with the same ULID.
+// Records older than one that's been sent are sent with the next batch.
+func reorder(in <-chan []byte, window time.Duration, ticker func(time.Duration) *time.Ticker, out chan<- []byte) {
+	var (
+		held = &recordHeap{}
+		tk   = ticker(window / 10)
+	)
+	defer tk.Stop()
+	for {
+		select {
+		case record, ok := <-in:
+			if !ok {
+				for held.Len() > 0 {
+					out <- heap.Pop(held).([]byte)
+				}
+				return
+			}
+			if len(record) >= ulid.EncodedSize {
+				heap.Push(held, record)
+			}
+
+		case now := <-tk.C:
+			pivot, _ := ulidutil.Min(ulid.Timestamp(now.Add(-window))).MarshalText()
+			for held.Len() > 0 && bytes.Compare((*held)[0][:ulid.EncodedSize], pivot) < 0 {
+				out <- heap.Pop(held).([]byte)
+			}
+		}
+	}
+}
+
+// recordHeap is a min-heap of records, by ULID, and then by the rest of them,
+// e.g. their labels.
+type recordHeap [][]byte
+
+func (h recordHeap) Len() int { return len(h) }
+
+func (h recordHeap) Less(i, j int) bool { return bytes.Compare(h[i], h[j]) < 0 }
+
+func (h recordHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *recordHeap) Push(x interface{}) { *h = append(*h, x.([]byte)) }
+
+func (h *recordHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return x
+}
+
+func copyValues(v url.Values) url.Values {
+	c := url.Values{}
+	for k, vs := range v {
+		c[k] = append([]string(nil), vs...)
+	}
+	return c
+}
@@ -13,24 +13,68 @@
 
 package flock
 
-import "syscall"
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+)
 
 type windowsLock struct {
 	fd syscall.Handle
 }
 
 func (fl *windowsLock) Release() error {
+	if err := fl.set(false); err != nil {
+		return err
+	}
 	return syscall.Close(fl.fd)
 }
 
+// set locks or unlocks the first byte of the file, which is all it takes to
+// keep other lockers out, since they lock the same byte.
+func (fl *windowsLock) set(lock bool) error {
+	var (
+		ol  syscall.Overlapped
+		r   uintptr
+		err error
+	)
+	if lock {
+		r, _, err = procLockFileEx.Call(uintptr(fl.fd), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	} else {
+		r, _, err = procUnlockFileEx.Call(uintptr(fl.fd), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	}
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
 func newLock(fileName string) (Releaser, error) {
 	pathp, err := syscall.UTF16PtrFromString(fileName)
 	if err != nil {
 		return nil, err
 	}
-	fd, err := syscall.CreateFile(pathp, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.CREATE_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	// The file is shared, like on Unix, so the lock is what keeps other
+	// lockers out, and the file can be removed while it's held.
+	const share = syscall.FILE_SHARE_READ | syscall.FILE_SHARE_WRITE | syscall.FILE_SHARE_DELETE
+	fd, err := syscall.CreateFile(pathp, syscall.GENERIC_READ|syscall.GENERIC_WRITE, share, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
 	if err != nil {
 		return nil, err
 	}
-	return &windowsLock{fd}, nil
+	l := &windowsLock{fd}
+	if err := l.set(true); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return l, nil
 }
@@ -0,0 +1,11 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package forward
+
+import "os"
+
+// idOf returns the zero fileID, as files have no portable identity here.
+// Tailers detect truncation, but not rotation, and resume files by path.
+func idOf(info os.FileInfo) fileID {
+	return fileID{}
+}
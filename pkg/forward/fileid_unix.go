@@ -0,0 +1,17 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package forward
+
+import (
+	"os"
+	"syscall"
+)
+
+// idOf returns the device and inode of the file.
+func idOf(info os.FileInfo) fileID {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}
+	}
+	return fileID{Dev: uint64(st.Dev), Ino: uint64(st.Ino)}
+}
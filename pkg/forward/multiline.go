@@ -0,0 +1,127 @@
+package forward
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"time"
+)
+
+// Assembler joins lines into multiline records, e.g. stack traces, which
+// would otherwise be forwarded as a record per line. A record starts with a
+// line matching the start pattern, and goes on until the next one. Lines
+// before the first start, e.g. the rest of a record that began before the
+// forwarder did, make up a record of their own.
+//
+// A record is also complete once it has maxLines lines, or it's been pending
+// for maxWait, so the last one isn't held until the next starts; a zero
+// maxLines or maxWait means no limit. Records are at most MaxLineSize bytes,
+// so a record that would grow past that is cut short, and the rest of it is
+// another record.
+type Assembler struct {
+	start     *regexp.Regexp
+	maxLines  int
+	maxWait   time.Duration
+	separator []byte
+	emit      func(record []byte)
+	record    []byte
+	lines     int       // in the pending record
+	since     time.Time // the pending record's first line was added
+}
+
+// NewAssembler returns an Assembler of records starting with lines that match
+// start, which passes each complete record to emit. Lines are joined with
+// separator, and the record isn't newline-terminated.
+func NewAssembler(start *regexp.Regexp, maxLines int, maxWait time.Duration, separator string, emit func(record []byte)) *Assembler {
+	return &Assembler{
+		start:     start,
+		maxLines:  maxLines,
+		maxWait:   maxWait,
+		separator: []byte(separator),
+		emit:      emit,
+	}
+}
+
+// Add the line, without its newline, at time now. A pending record that's
+// past its deadline is flushed first.
+func (a *Assembler) Add(line []byte, now time.Time) {
+	a.Tick(now)
+	if a.lines > 0 && (a.start.Match(line) || len(a.record)+len(a.separator)+len(line) > MaxLineSize) {
+		a.Flush()
+	}
+	if a.lines == 0 {
+		a.since = now
+	} else {
+		a.record = append(a.record, a.separator...)
+	}
+	a.record = append(a.record, line...)
+	a.lines++
+	if a.maxLines > 0 && a.lines >= a.maxLines {
+		a.Flush()
+	}
+}
+
+// Deadline returns when the pending record will have waited maxWait, and
+// false if there's no such record.
+func (a *Assembler) Deadline() (time.Time, bool) {
+	if a.lines == 0 || a.maxWait <= 0 {
+		return time.Time{}, false
+	}
+	return a.since.Add(a.maxWait), true
+}
+
+// Tick flushes the pending record, if it's past its deadline at time now.
+func (a *Assembler) Tick(now time.Time) {
+	if deadline, ok := a.Deadline(); ok && !now.Before(deadline) {
+		a.Flush()
+	}
+}
+
+// Flush emits the pending record, if any, complete or not.
+func (a *Assembler) Flush() {
+	if a.lines == 0 {
+		return
+	}
+	a.emit(a.record)
+	a.record, a.lines = nil, 0
+}
+
+// Run adds each line of r, as it's read, and flushes records as their
+// deadlines pass. Once r is exhausted, it flushes the last record, and
+// returns the error that ended the read, if any.
+func (a *Assembler) Run(r io.Reader) error {
+	lines := make(chan []byte)
+	errc := make(chan error, 1)
+	go func() {
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			lines <- append([]byte(nil), s.Bytes()...)
+		}
+		errc <- s.Err()
+		close(lines)
+	}()
+
+	for {
+		var (
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+		if deadline, ok := a.Deadline(); ok {
+			timer = time.NewTimer(deadline.Sub(time.Now()))
+			timeout = timer.C
+		}
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				a.Flush()
+				return <-errc
+			}
+			a.Add(line, time.Now())
+		case now := <-timeout:
+			a.Tick(now)
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
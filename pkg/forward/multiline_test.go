@@ -0,0 +1,224 @@
+package forward
+
+import (
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssembler(t *testing.T) {
+	t.Parallel()
+
+	// Each event adds a line, or, if tick, advances the fake clock, at
+	// the given time since the start. The stream ends with a flush.
+	type event struct {
+		at   time.Duration
+		line string
+		tick bool
+	}
+	start := regexp.MustCompile(`^\S`) // continuations are indented
+	for _, testcase := range []struct {
+		name     string
+		maxLines int
+		maxWait  time.Duration
+		events   []event
+		want     []string // emitted before the final flush
+		rest     string   // emitted by it
+	}{
+		{
+			name: "stack trace",
+			events: []event{
+				{0, "Exception in thread main", false},
+				{0, "\tat Foo.bar(Foo.java:1)", false},
+				{0, "\tat Foo.main(Foo.java:2)", false},
+				{0, "next", false},
+			},
+			want: []string{"Exception in thread main|\tat Foo.bar(Foo.java:1)|\tat Foo.main(Foo.java:2)"},
+			rest: "next",
+		},
+		{
+			name: "consecutive starts",
+			events: []event{
+				{0, "a", false},
+				{0, "b", false},
+				{0, "c", false},
+			},
+			want: []string{"a", "b"},
+			rest: "c",
+		},
+		{
+			name: "orphan continuations",
+			events: []event{
+				{0, " rest of a record", false},
+				{0, " that began before", false},
+				{0, "a", false},
+				{0, " a2", false},
+			},
+			want: []string{" rest of a record| that began before"},
+			rest: "a| a2",
+		},
+		{
+			name: "empty lines continue",
+			events: []event{
+				{0, "a", false},
+				{0, "", false},
+				{0, " a3", false},
+			},
+			rest: "a|| a3",
+		},
+		{
+			name:     "max lines",
+			maxLines: 2,
+			events: []event{
+				{0, "a", false},
+				{0, " a2", false},
+				{0, " a3", false},
+				{0, " a4", false},
+				{0, " a5", false},
+			},
+			want: []string{"a| a2", " a3| a4"},
+			rest: " a5",
+		},
+		{
+			name:     "one line at most",
+			maxLines: 1,
+			events: []event{
+				{0, "a", false},
+				{0, " a2", false},
+			},
+			want: []string{"a", " a2"},
+		},
+		{
+			name:    "timeout",
+			maxWait: time.Second,
+			events: []event{
+				{0, "a", false},
+				{500 * time.Millisecond, " a2", false},
+				{999 * time.Millisecond, "", true},
+				{time.Second, "", true},
+				{2 * time.Second, "", true},
+				{3 * time.Second, " late", false},
+				{3500 * time.Millisecond, "b", false},
+			},
+			want: []string{"a| a2", " late"},
+			rest: "b",
+		},
+		{
+			name:    "timeout from the first line",
+			maxWait: time.Second,
+			events: []event{
+				{0, "a", false},
+				{900 * time.Millisecond, " a2", false},
+				{1800 * time.Millisecond, " a3", false},
+			},
+			want: []string{"a| a2"},
+			rest: " a3",
+		},
+		{
+			name: "no timeout",
+			events: []event{
+				{0, "a", false},
+				{time.Hour, "", true},
+			},
+			rest: "a",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var (
+				t0   = time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+				have []string
+				a    = NewAssembler(start, testcase.maxLines, testcase.maxWait, "|", func(record []byte) {
+					have = append(have, string(record))
+				})
+			)
+			for _, e := range testcase.events {
+				if e.tick {
+					a.Tick(t0.Add(e.at))
+				} else {
+					a.Add([]byte(e.line), t0.Add(e.at))
+				}
+			}
+			if !reflect.DeepEqual(testcase.want, have) {
+				t.Errorf("want %q, have %q", testcase.want, have)
+			}
+
+			have = nil
+			a.Flush()
+			var want []string
+			if testcase.rest != "" {
+				want = []string{testcase.rest}
+			}
+			if !reflect.DeepEqual(want, have) {
+				t.Errorf("flush: want %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestAssemblerMaxLineSize(t *testing.T) {
+	t.Parallel()
+
+	var have []string
+	a := NewAssembler(regexp.MustCompile(`^start`), 0, 0, "\n", func(record []byte) {
+		have = append(have, string(record))
+	})
+	line := strings.Repeat("x", MaxLineSize/3)
+	a.Add([]byte("start"), time.Now())
+	for i := 0; i < 3; i++ {
+		a.Add([]byte(line), time.Now())
+	}
+	a.Flush()
+	if want, have := 2, len(have); want != have {
+		t.Fatalf("want %d records, have %d", want, have)
+	}
+	for _, record := range have {
+		if len(record) > MaxLineSize {
+			t.Errorf("record of %d bytes, more than %d", len(record), MaxLineSize)
+		}
+	}
+}
+
+func TestAssemblerRun(t *testing.T) {
+	t.Parallel()
+
+	// The last record is flushed once it's waited, while the input is
+	// still open, and the rest once the input is exhausted.
+	var (
+		lines   = make(chan string, 1)
+		records = make(chan string, 10)
+		a       = NewAssembler(regexp.MustCompile(`^\S`), 0, 100*time.Millisecond, " ", func(record []byte) {
+			records <- string(record)
+		})
+		r, w = io.Pipe()
+		done = make(chan error, 1)
+	)
+	go func() { done <- a.Run(r) }()
+	go func() {
+		for line := range lines {
+			w.Write([]byte(line + "\n"))
+		}
+		w.Close()
+	}()
+
+	lines <- "a\n a2" // at once, well within the wait
+	select {
+	case record := <-records:
+		if want, have := "a  a2", record; want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the flush")
+	}
+
+	lines <- "b"
+	close(lines)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "b", <-records; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
@@ -0,0 +1,358 @@
+// Package forward implements inputs for the forwarder, other than stdin, and
+// the assembly of multiline records from its input.
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MaxLineSize is the longest record a Tailer writes. Longer lines are split,
+// so they fit in a bufio.Scanner's default buffer.
+const MaxLineSize = bufio.MaxScanTokenSize - 1
+
+// fileID identifies a file independent of its path, so it can be followed
+// across renames. The zero fileID means the platform can't tell.
+type fileID struct {
+	Dev uint64 `json:"dev"`
+	Ino uint64 `json:"ino"`
+}
+
+// Tailer follows files matching glob patterns, like tail -F, and writes their
+// lines to a writer, as they're appended. New files matching the patterns are
+// picked up as they appear.
+//
+// A file is rotated when its path names a different file, i.e. inode, than
+// the one being read. The old file is read to its end, and the new one from
+// its start. If the old file was renamed to a path that also matches, it's
+// recognized, and not read again. A file that shrinks was truncated, and is
+// read again from its start.
+//
+// The offset of each file is saved in a state file, after every poll, so a
+// restarted Tailer resumes where it left off. Files are recognized by inode,
+// so those rotated while the Tailer wasn't running are resumed, too, if their
+// new paths match. But a file rotated more than once between polls, to paths
+// that don't match, can't be found, and the lines written to it after the
+// previous poll are lost.
+type Tailer struct {
+	patterns    []string
+	statePath   string
+	interval    time.Duration
+	w           io.Writer
+	files       map[string]*tailedFile // by path
+	state       map[string]fileState   // by path, as of the last poll
+	stop        chan chan struct{}
+	rotations   prometheus.Counter
+	truncations prometheus.Counter
+	logger      log.Logger
+}
+
+type tailedFile struct {
+	path    string
+	f       *os.File
+	id      fileID
+	offset  int64  // of the first byte not yet written
+	partial []byte // read, but without a newline yet
+}
+
+type fileState struct {
+	ID     fileID `json:"id"`
+	Offset int64  `json:"offset"`
+}
+
+// NewTailer returns a Tailer of the files matching patterns, which writes
+// their lines to w every interval, and saves its state at statePath.
+// Rotated and truncated files are counted by rotations and truncations.
+// Don't forget to Run it.
+func NewTailer(
+	patterns []string,
+	statePath string,
+	interval time.Duration,
+	w io.Writer,
+	rotations, truncations prometheus.Counter,
+	logger log.Logger,
+) (*Tailer, error) {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "pattern %q", pattern)
+		}
+	}
+	state, err := loadState(statePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading %s", statePath)
+	}
+	return &Tailer{
+		patterns:    patterns,
+		statePath:   statePath,
+		interval:    interval,
+		w:           w,
+		files:       map[string]*tailedFile{},
+		state:       state,
+		stop:        make(chan chan struct{}),
+		rotations:   rotations,
+		truncations: truncations,
+		logger:      logger,
+	}, nil
+}
+
+// Run tails the files until Stop is invoked.
+func (t *Tailer) Run() {
+	poll := time.NewTicker(t.interval)
+	defer poll.Stop()
+	t.poll()
+	for {
+		select {
+		case <-poll.C:
+			t.poll()
+
+		case q := <-t.stop:
+			for _, file := range t.files {
+				file.f.Close()
+			}
+			close(q)
+			return
+		}
+	}
+}
+
+// Stop the Tailer. Its state is as of the last poll.
+func (t *Tailer) Stop() {
+	q := make(chan struct{})
+	t.stop <- q
+	<-q
+}
+
+// poll reads what's new in the files being tailed, follows rotations and
+// truncations, picks up new files, and saves the state.
+func (t *Tailer) poll() {
+	// Read what's been appended to the files we have open, before looking
+	// at what their paths name now.
+	rotated := map[fileID]int64{}
+	for path, file := range t.files {
+		t.read(file)
+		info, err := os.Stat(path)
+		switch {
+		case err != nil || (file.id != fileID{} && idOf(info) != file.id):
+			// Rotated, or removed. There's nothing more to read from
+			// the old file, since nothing appends to it anymore.
+			if len(file.partial) > 0 {
+				t.write(file, append(file.partial, '\n'), int64(len(file.partial)))
+				file.partial = nil
+			}
+			if file.id != (fileID{}) {
+				rotated[file.id] = file.offset
+			}
+			file.f.Close()
+			delete(t.files, path)
+			if err == nil {
+				t.rotations.Inc()
+				level.Debug(t.logger).Log("file", path, "rotated", true)
+			}
+
+		case info.Size() < file.offset:
+			t.truncations.Inc()
+			level.Debug(t.logger).Log("file", path, "truncated_from", file.offset, "to", info.Size())
+			if _, err := file.f.Seek(0, io.SeekStart); err != nil {
+				level.Warn(t.logger).Log("file", path, "err", err)
+				file.f.Close()
+				delete(t.files, path)
+				continue
+			}
+			file.offset, file.partial = 0, nil
+			t.read(file)
+		}
+	}
+
+	// Open new files, rotated or otherwise, resuming any we know.
+	for _, path := range t.glob() {
+		if _, ok := t.files[path]; ok {
+			continue
+		}
+		file, err := t.open(path, rotated)
+		if err != nil {
+			level.Warn(t.logger).Log("file", path, "err", err)
+			continue
+		}
+		t.files[path] = file
+		t.read(file)
+	}
+
+	t.saveState()
+}
+
+// glob returns the paths matching the patterns, in order.
+func (t *Tailer) glob() []string {
+	seen := map[string]bool{}
+	for _, pattern := range t.patterns {
+		matches, _ := filepath.Glob(pattern) // patterns are validated
+		for _, path := range matches {
+			seen[path] = true
+		}
+	}
+	paths := make([]string, 0, len(seen))
+	for path := range seen {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// open opens the file at path, at the offset we were at in it, if we know
+// it: from this poll's rotations, or the state. Otherwise, it's a new file,
+// and read from its start.
+func (t *Tailer) open(path string, rotated map[fileID]int64) (*tailedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, errors.New("is a directory")
+	}
+	file := &tailedFile{path: path, f: f, id: idOf(info)}
+	if offset, ok := rotated[file.id]; ok && file.id != (fileID{}) {
+		file.offset = offset
+	} else {
+		file.offset = t.resume(path, file.id)
+	}
+	if file.offset > info.Size() {
+		file.offset = 0 // truncated, or a new file reusing the inode
+	}
+	if _, err := f.Seek(file.offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// resume returns the saved offset of the file, by its ID if it has one, and
+// so across renames, or otherwise by its path.
+func (t *Tailer) resume(path string, id fileID) int64 {
+	if id == (fileID{}) {
+		return t.state[path].Offset
+	}
+	for _, s := range t.state {
+		if s.ID == id {
+			return s.Offset
+		}
+	}
+	return 0
+}
+
+// read writes the complete lines appended to the file since the last read.
+func (t *Tailer) read(file *tailedFile) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := file.f.Read(buf)
+		if n > 0 {
+			file.partial = append(file.partial, buf[:n]...)
+			t.writeLines(file)
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			level.Warn(t.logger).Log("file", file.path, "err", err)
+			return
+		}
+	}
+}
+
+// writeLines writes the complete lines in the file's partial buffer, and
+// splits off any line that's grown too long.
+func (t *Tailer) writeLines(file *tailedFile) {
+	for {
+		i := bytes.IndexByte(file.partial, '\n')
+		switch {
+		case i >= 0:
+			t.write(file, file.partial[:i+1], int64(i+1))
+			file.partial = file.partial[i+1:]
+		case len(file.partial) >= MaxLineSize:
+			line := append(file.partial[:MaxLineSize:MaxLineSize], '\n')
+			t.write(file, line, MaxLineSize)
+			file.partial = file.partial[MaxLineSize:]
+		default:
+			// Keep what's left, without holding on to the rest of
+			// the buffer.
+			file.partial = append([]byte(nil), file.partial...)
+			return
+		}
+	}
+}
+
+// write writes a line to w, and advances the file's offset by n bytes.
+func (t *Tailer) write(file *tailedFile, line []byte, n int64) {
+	if _, err := t.w.Write(line); err != nil {
+		level.Warn(t.logger).Log("file", file.path, "err", err)
+		return
+	}
+	file.offset += n
+}
+
+// saveState saves the offsets of the files being tailed. The state is
+// written to a temporary file, and renamed over the last, so a crash leaves
+// one or the other.
+func (t *Tailer) saveState() {
+	state := make(map[string]fileState, len(t.files))
+	for path, file := range t.files {
+		state[path] = fileState{ID: file.id, Offset: file.offset}
+	}
+	t.state = state
+	if t.statePath == "" {
+		return
+	}
+	buf, err := json.Marshal(state)
+	if err != nil {
+		level.Warn(t.logger).Log("state", t.statePath, "err", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(t.statePath), 0755); err != nil {
+		level.Warn(t.logger).Log("state", t.statePath, "err", err)
+		return
+	}
+	tmp := t.statePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		level.Warn(t.logger).Log("state", t.statePath, "err", err)
+		return
+	}
+	if err := os.Rename(tmp, t.statePath); err != nil {
+		level.Warn(t.logger).Log("state", t.statePath, "err", err)
+	}
+}
+
+// loadState loads the state at path. A missing state file is an empty state;
+// an empty path means no state file at all.
+func loadState(path string) (map[string]fileState, error) {
+	state := map[string]fileState{}
+	if path == "" {
+		return state, nil
+	}
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
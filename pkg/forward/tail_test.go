@@ -0,0 +1,271 @@
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTailerAppend(t *testing.T) {
+	t.Parallel()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	tl, buf := newTestTailer(t, "", path)
+
+	// Only complete lines are written; the rest waits for its newline.
+	appendFile(t, path, "a\nb\npar")
+	if want, have := []string{"a", "b"}, poll(tl, buf); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	appendFile(t, path, "tial\nc\n")
+	if want, have := []string{"partial", "c"}, poll(tl, buf); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := []string(nil), poll(tl, buf); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	// Overlong lines are split.
+	appendFile(t, path, strings.Repeat("x", MaxLineSize+10)+"\n")
+	want := []string{strings.Repeat("x", MaxLineSize), strings.Repeat("x", 10)}
+	if have := poll(tl, buf); !reflect.DeepEqual(want, have) {
+		t.Errorf("want 2 lines of %d and 10 bytes, have %d lines", MaxLineSize, len(have))
+	}
+}
+
+func TestTailerRotation(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name    string
+		pattern string
+		rotate  func(t *testing.T, path string)
+		want    []string
+	}{
+		{
+			name:    "rename and create",
+			pattern: "app.log",
+			rotate: func(t *testing.T, path string) {
+				appendFile(t, path, "b\n")
+				rename(t, path, path+".1")
+				appendFile(t, path, "c\n")
+			},
+			want: []string{"b", "c"},
+		},
+		{
+			name:    "rotated twice between polls",
+			pattern: "app.log",
+			rotate: func(t *testing.T, path string) {
+				appendFile(t, path, "b\n")
+				rename(t, path, path+".1")
+				appendFile(t, path, "c\n")
+				rename(t, path+".1", path+".2")
+				rename(t, path, path+".1")
+				appendFile(t, path, "d\n")
+			},
+			want: []string{"b", "d"}, // c is in a file we never saw
+		},
+		{
+			name:    "rotated twice between polls to matching paths",
+			pattern: "app.log*",
+			rotate: func(t *testing.T, path string) {
+				appendFile(t, path, "b\n")
+				rename(t, path, path+".1")
+				appendFile(t, path, "c\n")
+				rename(t, path+".1", path+".2")
+				rename(t, path, path+".1")
+				appendFile(t, path, "d\n")
+			},
+			want: []string{"b", "d", "c"}, // a isn't read again from app.log.2
+		},
+		{
+			name:    "partial line at rotation",
+			pattern: "app.log",
+			rotate: func(t *testing.T, path string) {
+				appendFile(t, path, "b")
+				rename(t, path, path+".1")
+				appendFile(t, path, "c\n")
+			},
+			want: []string{"b", "c"},
+		},
+		{
+			name:    "shrinks",
+			pattern: "app.log",
+			rotate: func(t *testing.T, path string) {
+				if err := os.Truncate(path, 0); err != nil {
+					t.Fatal(err)
+				}
+				appendFile(t, path, "c\n")
+			},
+			want: []string{"c"},
+		},
+		{
+			name:    "removed and recreated",
+			pattern: "app.log",
+			rotate: func(t *testing.T, path string) {
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+				appendFile(t, path, "c\n")
+			},
+			want: []string{"c"},
+		},
+	} {
+		dir := tempDir(t)
+		path := filepath.Join(dir, "app.log")
+		tl, buf := newTestTailer(t, "", filepath.Join(dir, testcase.pattern))
+		appendFile(t, path, "a1\na2\n")
+		if want, have := []string{"a1", "a2"}, poll(tl, buf); !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+		testcase.rotate(t, path)
+		if want, have := testcase.want, poll(tl, buf); !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+
+		// And the new file is followed.
+		appendFile(t, path, "e\n")
+		if want, have := []string{"e"}, poll(tl, buf); !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: after rotation: want %q, have %q", testcase.name, want, have)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestTailerNewFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	tl, buf := newTestTailer(t, "", filepath.Join(dir, "*.log"))
+	if want, have := []string(nil), poll(tl, buf); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	// Files matching the pattern are read from their start, once they
+	// appear. Others are ignored.
+	appendFile(t, filepath.Join(dir, "a.log"), "a\n")
+	appendFile(t, filepath.Join(dir, "b.txt"), "b\n")
+	if want, have := []string{"a"}, poll(tl, buf); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	appendFile(t, filepath.Join(dir, "c.log"), "c\n")
+	appendFile(t, filepath.Join(dir, "a.log"), "a\n")
+	if want, have := []string{"a", "c"}, poll(tl, buf); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestTailerResume(t *testing.T) {
+	t.Parallel()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	var (
+		path  = filepath.Join(dir, "app.log")
+		state = filepath.Join(dir, "state", "tail.json")
+	)
+	tl, buf := newTestTailer(t, state, path+"*")
+	appendFile(t, path, "a\nb\n")
+	if want, have := []string{"a", "b"}, poll(tl, buf); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	// A restarted tailer picks up where the last left off.
+	appendFile(t, path, "c\n")
+	tl, buf = newTestTailer(t, state, path+"*")
+	if want, have := []string{"c"}, poll(tl, buf); !reflect.DeepEqual(want, have) {
+		t.Errorf("restarted: want %q, have %q", want, have)
+	}
+
+	// Even if the file was rotated in the meantime.
+	appendFile(t, path, "d\n")
+	rename(t, path, path+".1")
+	appendFile(t, path, "e\n")
+	tl, buf = newTestTailer(t, state, path+"*")
+	if want, have := []string{"e", "d"}, poll(tl, buf); !reflect.DeepEqual(want, have) {
+		t.Errorf("restarted after rotation: want %q, have %q", want, have)
+	}
+}
+
+func TestTailerRun(t *testing.T) {
+	t.Parallel()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	pr, pw := io.Pipe()
+	tl, err := NewTailer([]string{path}, "", 10*time.Millisecond, pw, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go tl.Run()
+	defer tl.Stop()
+
+	s := bufio.NewScanner(pr)
+	for _, line := range []string{"a", "b", "c"} {
+		appendFile(t, path, line+"\n")
+		if !s.Scan() {
+			t.Fatal(s.Err())
+		}
+		if want, have := line, s.Text(); want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	}
+}
+
+func newTestTailer(t *testing.T, statePath string, patterns ...string) (*Tailer, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	tl, err := NewTailer(patterns, statePath, time.Hour, buf, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tl, buf
+}
+
+// poll polls the tailer, and returns the lines it wrote.
+func poll(tl *Tailer, buf *bytes.Buffer) []string {
+	tl.poll()
+	defer buf.Reset()
+	if buf.Len() == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "oklog-tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func appendFile(t *testing.T, path, s string) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func rename(t *testing.T, from, to string) {
+	if err := os.Rename(from, to); err != nil {
+		t.Fatal(err)
+	}
+}
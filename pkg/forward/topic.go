@@ -0,0 +1,59 @@
+package forward
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// TopicRouter selects the topic of each record, which the forwarder writes
+// ahead of it, for ingesters with dynamic topics. With a pattern, the topic is
+// what its first capture group to match captured, so e.g. `service=(\w+)`
+// routes "service=payments ..." to the payments topic. Records the pattern
+// doesn't match, or which capture nothing, or something that isn't a valid
+// topic, get the fallback topic, as do all records without a pattern.
+type TopicRouter struct {
+	pattern  *regexp.Regexp
+	fallback []byte
+}
+
+// NewTopicRouter returns a TopicRouter with the pattern, which may be nil, and
+// the fallback topic, which is record.DefaultTopic if it's empty. The pattern
+// must have at least one capture group, and the fallback must be a valid
+// topic.
+func NewTopicRouter(pattern *regexp.Regexp, fallback string) (*TopicRouter, error) {
+	if fallback == "" {
+		fallback = record.DefaultTopic
+	}
+	if !record.IsValidTopic([]byte(fallback)) {
+		return nil, errors.Wrapf(record.ErrIllegalTopicName, "topic %q", fallback)
+	}
+	if pattern != nil && pattern.NumSubexp() < 1 {
+		return nil, errors.Errorf("topic pattern %q has no capture group", pattern)
+	}
+	return &TopicRouter{
+		pattern:  pattern,
+		fallback: []byte(fallback),
+	}, nil
+}
+
+// Route returns the topic of the record. It's called for every record, so it
+// only allocates to match the pattern.
+func (r *TopicRouter) Route(rec []byte) []byte {
+	if r.pattern == nil {
+		return r.fallback
+	}
+	m := r.pattern.FindSubmatchIndex(rec)
+	for i := 2; i+1 < len(m); i += 2 {
+		if m[i] < 0 || m[i] == m[i+1] {
+			continue // the group didn't capture anything
+		}
+		if topic := rec[m[i]:m[i+1]]; record.IsValidTopic(topic) {
+			return topic
+		}
+		break
+	}
+	return r.fallback
+}
@@ -0,0 +1,88 @@
+package forward
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTopicRouter(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name     string
+		pattern  string
+		fallback string
+		record   string
+		want     string
+	}{
+		{"no pattern", "", "", "service=payments hello\n", "default"},
+		{"no pattern, fallback", "", "web", "service=payments hello\n", "web"},
+		{"match", `service=(\w+)`, "", "level=info service=payments hello\n", "payments"},
+		{"no match", `service=(\w+)`, "web", "level=info hello\n", "web"},
+		{"empty capture", `service=(\w*)`, "", "service= hello\n", "default"},
+		{"invalid capture", `service=(\S+)`, "", "service=pay~ments hello\n", "default"},
+		{"first of several groups", `service=(\w+)|app=(\w+)`, "", "service=payments app=web\n", "payments"},
+		{"second of several groups", `service=(\w+)|app=(\w+)`, "", "app=web level=info\n", "web"},
+		{"outer group", `((\w+)-api)`, "", "GET payments-api /\n", "payments-api"},
+	} {
+		var pattern *regexp.Regexp
+		if testcase.pattern != "" {
+			pattern = regexp.MustCompile(testcase.pattern)
+		}
+		r, err := NewTopicRouter(pattern, testcase.fallback)
+		if err != nil {
+			t.Fatalf("%s: %v", testcase.name, err)
+		}
+		if want, have := testcase.want, string(r.Route([]byte(testcase.record))); want != have {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+	}
+}
+
+func TestTopicRouterInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name     string
+		pattern  *regexp.Regexp
+		fallback string
+		want     string
+	}{
+		{"no capture group", regexp.MustCompile(`service=\w+`), "", "no capture group"},
+		{"invalid fallback", nil, "pay ments", "illegal topic name"},
+		{"overlong fallback", nil, strings.Repeat("a", 129), "illegal topic name"},
+	} {
+		_, err := NewTopicRouter(testcase.pattern, testcase.fallback)
+		if err == nil {
+			t.Errorf("%s: want error, have none", testcase.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), testcase.want) {
+			t.Errorf("%s: want error with %q, have %q", testcase.name, testcase.want, err)
+		}
+	}
+}
+
+func BenchmarkTopicRouter(b *testing.B) {
+	r, err := NewTopicRouter(regexp.MustCompile(`service=(\w+)`), "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bc := range []struct {
+		name   string
+		record string
+	}{
+		{"match", "ts=2017-01-02T03:04:05Z level=info service=payments msg=\"charged card\" amount=42\n"},
+		{"no match", "ts=2017-01-02T03:04:05Z level=info msg=\"charged card\" amount=42\n"},
+	} {
+		rec := []byte(bc.record)
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(rec)))
+			for i := 0; i < b.N; i++ {
+				r.Route(rec)
+			}
+		})
+	}
+}
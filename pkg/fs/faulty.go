@@ -0,0 +1,245 @@
+package fs
+
+import (
+	"errors"
+	"io/ioutil"
+	"sync"
+)
+
+// ErrInjected is returned by the operations a FaultyFilesystem fails.
+var ErrInjected = errors.New("injected fault")
+
+// ErrCrashed is returned by writes to files created before a
+// FaultyFilesystem crashed.
+var ErrCrashed = errors.New("filesystem crashed")
+
+// FaultyFilesystem wraps a filesystem, typically a virtual one, to fail its
+// operations on demand, and to simulate crashes, so tests can check that
+// writers survive them. It models a disk on which what's written to a file is
+// only durable once the file is synced, but creates, renames, and removes are
+// durable right away.
+type FaultyFilesystem struct {
+	Filesystem
+	mtx    sync.Mutex
+	counts map[string]int          // op: calls so far
+	faults map[string]int          // op: call that fails
+	torn   bool                    // crashes tear the last write
+	gen    int                     // crashes so far
+	files  map[string]*faultyState // by path, files written since the last crash
+	locks  map[string]bool         // held
+}
+
+// faultyState tracks what's durable in a file.
+type faultyState struct {
+	size   int64 // written
+	synced int64 // durable
+	last   int64 // offset of the last write
+}
+
+// NewFaultyFilesystem wraps filesys. Files already in it are durable.
+func NewFaultyFilesystem(filesys Filesystem) *FaultyFilesystem {
+	return &FaultyFilesystem{
+		Filesystem: filesys,
+		counts:     map[string]int{},
+		faults:     map[string]int{},
+		files:      map[string]*faultyState{},
+		locks:      map[string]bool{},
+	}
+}
+
+// Fail makes the nth next call of op fail with ErrInjected, with no effect.
+// Op is "create", "write", "sync", "rename", or "remove"; n is 1 for the
+// very next call.
+func (fs *FaultyFilesystem) Fail(op string, n int) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	fs.faults[op] = fs.counts[op] + n
+}
+
+// SetTornWrites sets whether crashes tear the last write to each file: if it
+// wasn't synced, a prefix of it survives, along with everything written
+// before it, as if the disk lost power in the middle of writing it back.
+func (fs *FaultyFilesystem) SetTornWrites(torn bool) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	fs.torn = torn
+}
+
+// Crash discards what was written to files since they were last synced,
+// releases their locks, and forgets the faults yet to be injected, as if the
+// machine crashed. Afterwards, files created before the crash fail writes and
+// syncs with ErrCrashed, but the filesystem can be used, e.g. to recover, as
+// usual.
+func (fs *FaultyFilesystem) Crash() error {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	fs.gen++
+	for path, state := range fs.files {
+		keep := state.synced
+		if fs.torn && state.last >= state.synced && state.size > state.last {
+			keep = state.last + (state.size-state.last)/2
+		}
+		if keep < state.size {
+			if err := fs.truncate(path, keep); err != nil {
+				return err
+			}
+		}
+	}
+	for path := range fs.locks {
+		if fs.Filesystem.Exists(path) {
+			if err := fs.truncate(path, 0); err != nil {
+				return err
+			}
+		}
+	}
+	fs.faults = map[string]int{}
+	fs.files = map[string]*faultyState{}
+	fs.locks = map[string]bool{}
+	return nil
+}
+
+func (fs *FaultyFilesystem) truncate(path string, size int64) error {
+	f, err := fs.Filesystem.Open(path)
+	if err != nil {
+		return err
+	}
+	buf, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if f, err = fs.Filesystem.Create(path); err != nil {
+		return err
+	}
+	if _, err := f.Write(buf[:size]); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// inject counts a call of op, and returns ErrInjected if it's meant to fail.
+// It's called with the mutex held.
+func (fs *FaultyFilesystem) inject(op string) error {
+	fs.counts[op]++
+	if n, ok := fs.faults[op]; ok && n == fs.counts[op] {
+		delete(fs.faults, op)
+		return ErrInjected
+	}
+	return nil
+}
+
+// Create a file, whose writes are durable once synced.
+func (fs *FaultyFilesystem) Create(path string) (File, error) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	if err := fs.inject("create"); err != nil {
+		return nil, err
+	}
+	f, err := fs.Filesystem.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &faultyState{}
+	fs.files[path] = state
+	return &faultyFile{File: f, fs: fs, gen: fs.gen, state: state}, nil
+}
+
+// Rename oldname to newname, which is durable right away.
+func (fs *FaultyFilesystem) Rename(oldname, newname string) error {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	if err := fs.inject("rename"); err != nil {
+		return err
+	}
+	if err := fs.Filesystem.Rename(oldname, newname); err != nil {
+		return err
+	}
+	if state, ok := fs.files[oldname]; ok {
+		fs.files[newname] = state
+	} else {
+		delete(fs.files, newname)
+	}
+	delete(fs.files, oldname)
+	return nil
+}
+
+// Remove path, which is durable right away.
+func (fs *FaultyFilesystem) Remove(path string) error {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	if err := fs.inject("remove"); err != nil {
+		return err
+	}
+	if err := fs.Filesystem.Remove(path); err != nil {
+		return err
+	}
+	delete(fs.files, path)
+	return nil
+}
+
+// Lock path, until it's released, or the filesystem crashes.
+func (fs *FaultyFilesystem) Lock(path string) (Releaser, bool, error) {
+	r, existed, err := fs.Filesystem.Lock(path)
+	if err != nil {
+		return r, existed, err
+	}
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	fs.locks[path] = true
+	gen := fs.gen
+	return virtualReleaser(func() error {
+		fs.mtx.Lock()
+		crashed := fs.gen != gen
+		if !crashed {
+			delete(fs.locks, path)
+		}
+		fs.mtx.Unlock()
+		if crashed {
+			return ErrCrashed // the lock went with the process
+		}
+		return r.Release()
+	}), existed, nil
+}
+
+type faultyFile struct {
+	File
+	fs    *FaultyFilesystem
+	gen   int // of the filesystem, when the file was created
+	state *faultyState
+}
+
+func (f *faultyFile) Write(p []byte) (int, error) {
+	f.fs.mtx.Lock()
+	defer f.fs.mtx.Unlock()
+	if f.gen != f.fs.gen {
+		return 0, ErrCrashed
+	}
+	if err := f.fs.inject("write"); err != nil {
+		return 0, err
+	}
+	n, err := f.File.Write(p)
+	f.state.last = f.state.size
+	f.state.size += int64(n)
+	return n, err
+}
+
+func (f *faultyFile) skip(n int64) error {
+	return Skip(f.File, n)
+}
+
+func (f *faultyFile) Sync() error {
+	f.fs.mtx.Lock()
+	defer f.fs.mtx.Unlock()
+	if f.gen != f.fs.gen {
+		return ErrCrashed
+	}
+	if err := f.fs.inject("sync"); err != nil {
+		return err
+	}
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+	f.state.synced = f.state.size
+	return nil
+}
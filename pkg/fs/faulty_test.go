@@ -0,0 +1,124 @@
+package fs
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestFaultyFail(t *testing.T) {
+	t.Parallel()
+
+	filesys := NewFaultyFilesystem(NewVirtualFilesystem())
+	f, err := filesys.Create("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the second write fails, and has no effect.
+	filesys.Fail("write", 2)
+	for i, want := range []error{nil, ErrInjected, nil} {
+		if _, have := f.Write([]byte("abc")); want != have {
+			t.Errorf("write %d: want %v, have %v", i+1, want, have)
+		}
+	}
+	if want, have := "abcabc", read(t, filesys, "/foo"); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	filesys.Fail("sync", 1)
+	if want, have := ErrInjected, f.Sync(); want != have {
+		t.Errorf("sync: want %v, have %v", want, have)
+	}
+	filesys.Fail("rename", 1)
+	if want, have := ErrInjected, filesys.Rename("/foo", "/bar"); want != have {
+		t.Errorf("rename: want %v, have %v", want, have)
+	}
+	if !filesys.Exists("/foo") || filesys.Exists("/bar") {
+		t.Errorf("failed rename had an effect")
+	}
+}
+
+func TestFaultyCrash(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name string
+		torn bool
+		want map[string]string
+	}{
+		{
+			name: "clean",
+			want: map[string]string{"/synced": "abcdef", "/renamed": "abc", "/unsynced": "", "/existing": "old"},
+		},
+		{
+			name: "torn",
+			torn: true,
+			want: map[string]string{"/synced": "abcdef", "/renamed": "abcdefgh", "/unsynced": "ab", "/existing": "old"},
+		},
+	} {
+		virtual := NewVirtualFilesystem()
+		if f, err := virtual.Create("/existing"); err != nil {
+			t.Fatal(err)
+		} else {
+			f.Write([]byte("old"))
+		}
+		filesys := NewFaultyFilesystem(virtual)
+		filesys.SetTornWrites(testcase.torn)
+		write := func(path string, syncAfter int, writes ...string) File {
+			f, err := filesys.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, s := range writes {
+				if _, err := f.Write([]byte(s)); err != nil {
+					t.Fatal(err)
+				}
+				if i+1 == syncAfter {
+					if err := f.Sync(); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			return f
+		}
+		write("/synced", 2, "abc", "def")
+		write("/active", 1, "abc", "def", "ghij")
+		write("/unsynced", 0, "abcd")
+		if err := filesys.Rename("/active", "/renamed"); err != nil {
+			t.Fatal(err)
+		}
+		stale := write("/stale", 0)
+		if _, _, err := filesys.Lock("/LOCK"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := filesys.Crash(); err != nil {
+			t.Fatal(err)
+		}
+		for path, want := range testcase.want {
+			if have := read(t, filesys, path); want != have {
+				t.Errorf("%s: %s: want %q, have %q", testcase.name, path, want, have)
+			}
+		}
+		if _, err := stale.Write([]byte("x")); err != ErrCrashed {
+			t.Errorf("%s: write after crash: want %v, have %v", testcase.name, ErrCrashed, err)
+		}
+		if _, _, err := filesys.Lock("/LOCK"); err != nil {
+			t.Errorf("%s: lock after crash: %v", testcase.name, err)
+		}
+	}
+}
+
+func read(t *testing.T, filesys Filesystem, path string) string {
+	t.Helper()
+	f, err := filesys.Open(path)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	defer f.Close()
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
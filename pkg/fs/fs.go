@@ -2,6 +2,7 @@
 package fs
 
 import (
+	"errors"
 	"io"
 	"path/filepath"
 	"time"
@@ -18,6 +19,17 @@ type Filesystem interface {
 	Chtimes(path string, atime, mtime time.Time) error
 	Walk(root string, walkFn filepath.WalkFunc) error
 	Lock(path string) (r Releaser, existed bool, err error)
+
+	// Statfs returns the usage of the filesystem holding the path.
+	Statfs(path string) (Usage, error)
+}
+
+// Usage of a filesystem, in bytes, as statfs reports it. Available is what's
+// free to us, which, unlike root, can't use the blocks some filesystems keep
+// in reserve.
+type Usage struct {
+	Capacity  int64
+	Available int64
 }
 
 // File is the subset of methods we use on an *os.File.
@@ -28,9 +40,23 @@ type File interface {
 	Name() string
 	Size() int64
 	Sync() error
+
+	// SyncRange starts writing the n bytes at off back to disk, and returns
+	// without waiting for them. It doesn't make them durable; that still
+	// takes Sync, which then has less left to write.
+	SyncRange(off, n int64) error
+
+	// DropCache advises that the file won't be read again soon, so its
+	// pages can be dropped from the page cache. Only pages already written
+	// back are dropped.
+	DropCache() error
 }
 
 // Releaser is returned by Lock calls.
 type Releaser interface {
 	Release() error
 }
+
+// ErrStatfsUnsupported is returned by Statfs of real filesystems on platforms
+// we don't know how to ask.
+var ErrStatfsUnsupported = errors.New("statfs isn't supported on this platform")
@@ -8,6 +8,7 @@ func TestLock(t *testing.T) {
 	lock := "TESTLOCK"
 	for name, filesys := range map[string]Filesystem{
 		"virtual": NewVirtualFilesystem(),
+		"windows": NewVirtualFilesystemWithWindowsSemantics(),
 		"real":    NewRealFilesystem(),
 	} {
 		t.Run(name, func(t *testing.T) {
@@ -18,7 +19,10 @@ func TestLock(t *testing.T) {
 			if existed {
 				t.Fatal("initial claim: lock file already exists")
 			}
-			if _, existed, _ = filesys.Lock(lock); !existed {
+			if _, existed, err = filesys.Lock(lock); err == nil {
+				t.Fatal("second claim: want error, have none")
+			}
+			if !existed {
 				t.Fatal("second claim: want existed true, have false")
 			}
 			if err := r.Release(); err != nil {
@@ -0,0 +1,65 @@
+package fs
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// mmapFile is a file opened for reading, and memory mapped. It doesn't embed
+// the *os.File, so nothing reads from it behind the mapping's back.
+type mmapFile struct {
+	f    *os.File
+	data []byte
+	r    *bytes.Reader
+}
+
+// newMmapFile maps f, which is closed along with the mapping. If f can't be
+// mapped, it's left open, to be read as usual.
+func newMmapFile(f *os.File) (*mmapFile, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := mmap(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	return &mmapFile{f: f, data: data, r: bytes.NewReader(data)}, nil
+}
+
+func (f *mmapFile) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
+
+// WriteTo writes the rest of the file to w, straight from the mapping.
+func (f *mmapFile) WriteTo(w io.Writer) (int64, error) {
+	return f.r.WriteTo(w)
+}
+
+func (f *mmapFile) skip(n int64) error {
+	_, err := f.r.Seek(n, io.SeekCurrent)
+	return err
+}
+
+func (f *mmapFile) Write(p []byte) (int, error) {
+	return f.f.Write(p) // fails, since f is read-only
+}
+
+// Close unmaps the file, and closes it. Further reads return io.EOF.
+func (f *mmapFile) Close() error {
+	f.r = bytes.NewReader(nil)
+	return multiCloser{munmapper(f.data), f.f}.Close()
+}
+
+func (f *mmapFile) Name() string                 { return f.f.Name() }
+func (f *mmapFile) Size() int64                  { return int64(len(f.data)) }
+func (f *mmapFile) Sync() error                  { return nil }
+func (f *mmapFile) SyncRange(off, n int64) error { return nil }
+func (f *mmapFile) DropCache() error             { return dropCache(f.f) }
+
+type munmapper []byte
+
+func (m munmapper) Close() error {
+	return munmap(m)
+}
@@ -0,0 +1,14 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package fs
+
+import (
+	"errors"
+	"os"
+)
+
+func mmap(f *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("mmap isn't supported on this platform")
+}
+
+func munmap(data []byte) error { return nil }
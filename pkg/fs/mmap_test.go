@@ -0,0 +1,149 @@
+package fs
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestMmapRead(t *testing.T) {
+	t.Parallel()
+
+	root, err := ioutil.TempDir("", "oklog-fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	var (
+		filesys = NewRealFilesystemWithMmap()
+		path    = filepath.Join(root, "segment")
+		want    = "01ARYZ6S41TSV4RRFFQ69G5FAV One\n01ARYZ6S41TSV4RRFFZZZZZZZZ Two\n"
+	)
+	if err := ioutil.WriteFile(path, []byte(want), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := filesys.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.(*mmapFile); !ok && (runtime.GOOS == "linux" || runtime.GOOS == "darwin") {
+		t.Errorf("want a mapped file, have %T", f)
+	}
+	if want, have := int64(len(want)), f.Size(); want != have {
+		t.Errorf("Size: want %d, have %d", want, have)
+	}
+
+	// The mapping stays valid while the file is moved to the trash, and
+	// removed, until it's closed.
+	trashed := filepath.Join(root, "trashed")
+	if err := filesys.Rename(path, trashed); err != nil {
+		t.Fatal(err)
+	}
+	if err := filesys.Remove(trashed); err != nil {
+		t.Fatal(err)
+	}
+	have, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := want, string(have); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Read(make([]byte, 1)); n != 0 || err == nil {
+		t.Errorf("Read after Close: want 0, error, have %d, %v", n, err)
+	}
+}
+
+func TestMmapFallback(t *testing.T) {
+	t.Parallel()
+
+	root, err := ioutil.TempDir("", "oklog-fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// Empty files can't be mapped, but can be read.
+	path := filepath.Join(root, "empty")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewRealFilesystemWithMmap().Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, ok := f.(realFile); !ok {
+		t.Errorf("want an unmapped file, have %T", f)
+	}
+	if have, err := ioutil.ReadAll(f); err != nil || len(have) != 0 {
+		t.Errorf("want nothing, have %q (%v)", have, err)
+	}
+}
+
+// BenchmarkRealRead reads a 256MB segment of 100 byte records line by line,
+// the way queries and compaction do, with and without memory mapping.
+func BenchmarkRealRead(b *testing.B) {
+	const (
+		segmentSize = 256 << 20
+		recordSize  = 100
+	)
+	root, err := ioutil.TempDir("", "oklog-fs")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "segment")
+	f, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	for i := 0; i < segmentSize/recordSize; i++ {
+		fmt.Fprintf(w, "01ARYZ6S41TSV4RRFFQ69G5FAV %072d\n", i)
+	}
+	if err := w.Flush(); err != nil {
+		b.Fatal(err)
+	}
+	f.Close()
+
+	for _, bc := range []struct {
+		name    string
+		filesys Filesystem
+	}{
+		{"read", NewRealFilesystem()},
+		{"mmap", NewRealFilesystemWithMmap()},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(segmentSize)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				f, err := bc.filesys.Open(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				var n int
+				s := bufio.NewScanner(f)
+				for s.Scan() {
+					n++
+				}
+				if err := s.Err(); err != nil {
+					b.Fatal(err)
+				}
+				f.Close()
+				if want, have := segmentSize/recordSize, n; want != have {
+					b.Fatalf("want %d records, have %d", want, have)
+				}
+			}
+		})
+	}
+}
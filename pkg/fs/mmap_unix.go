@@ -0,0 +1,27 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package fs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func mmap(f *os.File, size int64) ([]byte, error) {
+	if size <= 0 {
+		return nil, errors.New("can't map an empty file")
+	}
+	if int64(int(size)) != size {
+		return nil, errors.New("file too big to map")
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, os.NewSyscallError("mmap", err)
+	}
+	return data, nil
+}
+
+func munmap(data []byte) error {
+	return os.NewSyscallError("munmap", syscall.Munmap(data))
+}
@@ -21,15 +21,18 @@ func (nopFilesystem) MkdirAll(path string) error                        { return
 func (nopFilesystem) Chtimes(path string, atime, mtime time.Time) error { return nil }
 func (nopFilesystem) Walk(root string, walkFn filepath.WalkFunc) error  { return nil }
 func (nopFilesystem) Lock(path string) (Releaser, bool, error)          { return nopReleaser{}, false, nil }
+func (nopFilesystem) Statfs(path string) (Usage, error)                 { return Usage{}, nil }
 
 type nopFile struct{}
 
-func (nopFile) Read(p []byte) (int, error)  { return len(p), nil }
-func (nopFile) Write(p []byte) (int, error) { return len(p), nil }
-func (nopFile) Close() error                { return nil }
-func (nopFile) Name() string                { return "" }
-func (nopFile) Size() int64                 { return 0 }
-func (nopFile) Sync() error                 { return nil }
+func (nopFile) Read(p []byte) (int, error)   { return len(p), nil }
+func (nopFile) Write(p []byte) (int, error)  { return len(p), nil }
+func (nopFile) Close() error                 { return nil }
+func (nopFile) Name() string                 { return "" }
+func (nopFile) Size() int64                  { return 0 }
+func (nopFile) Sync() error                  { return nil }
+func (nopFile) SyncRange(off, n int64) error { return nil }
+func (nopFile) DropCache() error             { return nil }
 
 type nopReleaser struct{}
 
@@ -0,0 +1,9 @@
+// +build !windows
+
+package fs
+
+import "os"
+
+func openFile(path string) (*os.File, error) {
+	return os.Open(path)
+}
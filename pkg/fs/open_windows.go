@@ -0,0 +1,23 @@
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// openFile opens path for reading. Unlike os.Open, it shares the file for
+// deletion, so it can be renamed or removed while it's open, like on Unix,
+// e.g. when compaction takes a segment that's being queried. A removed file
+// keeps its name until it's closed, though.
+func openFile(path string) (*os.File, error) {
+	pathp, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	const share = syscall.FILE_SHARE_READ | syscall.FILE_SHARE_WRITE | syscall.FILE_SHARE_DELETE
+	h, err := syscall.CreateFile(pathp, syscall.GENERIC_READ, share, nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
@@ -12,13 +12,23 @@ import (
 
 const mkdirAllMode = 0755
 
-// NewRealFilesystem yields a real disk filesystem
-// with optional memory mapping for file reading.
+// NewRealFilesystem yields a real disk filesystem.
 func NewRealFilesystem() Filesystem {
 	return realFilesystem{}
 }
 
-type realFilesystem struct{}
+// NewRealFilesystemWithMmap yields a real disk filesystem which memory maps
+// the files it opens, so they're read without copying them from the kernel.
+// Reads see the file as it was when it was opened, even once it's renamed or
+// removed, until it's closed. Files that can't be mapped, e.g. empty files,
+// or on filesystems or platforms that don't support it, are read as usual.
+func NewRealFilesystemWithMmap() Filesystem {
+	return realFilesystem{mmap: true}
+}
+
+type realFilesystem struct {
+	mmap bool
+}
 
 func (realFilesystem) Create(path string) (File, error) {
 	f, err := os.Create(path)
@@ -30,10 +40,15 @@ func (realFilesystem) Create(path string) (File, error) {
 }
 
 func (fs realFilesystem) Open(path string) (File, error) {
-	f, err := os.Open(path)
+	f, err := openFile(path)
 	if err != nil {
 		return nil, err
 	}
+	if fs.mmap {
+		if mf, err := newMmapFile(f); err == nil {
+			return mf, nil
+		}
+	}
 	return realFile{
 		File:   f,
 		Reader: f,
@@ -66,6 +81,10 @@ func (realFilesystem) Walk(root string, walkFn filepath.WalkFunc) error {
 	return filepath.Walk(root, walkFn)
 }
 
+func (realFilesystem) Statfs(path string) (Usage, error) {
+	return statfs(path)
+}
+
 func (realFilesystem) Lock(path string) (r Releaser, existed bool, err error) {
 	r, existed, err = flock.New(path)
 	r = deletingReleaser{path, r}
@@ -99,6 +118,21 @@ func (f realFile) Close() error {
 	return f.Closer.Close()
 }
 
+// skip seeks past n bytes, or to the end. The Reader reads from the File, so
+// it reads on from there.
+func (f realFile) skip(n int64) error {
+	_, err := f.File.Seek(n, io.SeekCurrent)
+	return err
+}
+
+func (f realFile) SyncRange(off, n int64) error {
+	return syncRange(f.File, off, n)
+}
+
+func (f realFile) DropCache() error {
+	return dropCache(f.File)
+}
+
 func (f realFile) Size() int64 {
 	fi, err := f.File.Stat()
 	if err != nil {
@@ -0,0 +1,230 @@
+package fs
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	ioLatencySamples  = 100             // foreground reads the quantile is of
+	ioLatencyQuantile = 0.9             // of the foreground read times
+	ioMinSamples      = 10              // before background I/O is capped
+	ioIdle            = 5 * time.Second // without foreground reads, to release the cap
+)
+
+// IOScheduler shares a disk between two classes of I/O: foreground I/O, e.g.
+// the queries of a store node, and background I/O, e.g. its consuming,
+// storing replicated segments, and compacting them. Background I/O is unlimited,
+// until foreground I/O suffers: while the 90th percentile of the times of
+// recent query reads is over a threshold, background I/O is capped at a
+// number of bytes per second. Once there have been no query reads for a few
+// seconds, the node is idle, and the cap is released.
+//
+// The I/O of a Filesystem is scheduled by wrapping it with
+// NewScheduledFilesystem. A nil IOScheduler schedules nothing.
+type IOScheduler struct {
+	threshold        time.Duration
+	bytesPerSecond   int64
+	capped           prometheus.Gauge
+	throttledSeconds prometheus.Counter
+	now              func() time.Time
+	sleep            func(time.Duration)
+
+	mtx       sync.Mutex
+	samples   []time.Duration // of recent foreground reads, a ring
+	oldest    int             // of the samples, once the ring is full
+	slow      bool            // the quantile of the samples is over the threshold
+	last      time.Time       // of the last foreground read
+	next      time.Time       // when the next background bytes may go, while capped
+	wasCapped bool
+}
+
+// NewIOScheduler returns an IOScheduler that caps background I/O at
+// bytesPerSecond while foreground reads are slower than threshold. The
+// capped gauge is 1 while background I/O is capped, and throttledSeconds
+// counts the time background I/O waits on the cap.
+func NewIOScheduler(threshold time.Duration, bytesPerSecond int64, capped prometheus.Gauge, throttledSeconds prometheus.Counter) *IOScheduler {
+	return newIOScheduler(threshold, bytesPerSecond, capped, throttledSeconds, time.Now, time.Sleep)
+}
+
+func newIOScheduler(threshold time.Duration, bytesPerSecond int64, capped prometheus.Gauge, throttledSeconds prometheus.Counter, now func() time.Time, sleep func(time.Duration)) *IOScheduler {
+	return &IOScheduler{
+		threshold:        threshold,
+		bytesPerSecond:   bytesPerSecond,
+		capped:           capped,
+		throttledSeconds: throttledSeconds,
+		now:              now,
+		sleep:            sleep,
+	}
+}
+
+// observe a foreground read, which took d.
+func (s *IOScheduler) observe(d time.Duration) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	now := s.now()
+	if now.Sub(s.last) > ioIdle {
+		s.samples, s.oldest = s.samples[:0], 0 // it's been idle, so forget
+	}
+	s.last = now
+	if len(s.samples) < ioLatencySamples {
+		s.samples = append(s.samples, d)
+	} else {
+		s.samples[s.oldest] = d
+		s.oldest = (s.oldest + 1) % ioLatencySamples
+	}
+	s.slow = len(s.samples) >= ioMinSamples && quantile(s.samples, ioLatencyQuantile) > s.threshold
+	s.updateCapped(now)
+}
+
+// wait before n bytes of background I/O may go.
+func (s *IOScheduler) wait(n int) {
+	if n <= 0 {
+		return
+	}
+	s.mtx.Lock()
+	now := s.now()
+	if !s.updateCapped(now) {
+		s.mtx.Unlock()
+		return
+	}
+
+	// Idle time doesn't bank credit, so bursts stay short.
+	if s.next.Before(now) {
+		s.next = now
+	}
+	due := s.next
+	s.next = s.next.Add(time.Duration(float64(n) / float64(s.bytesPerSecond) * float64(time.Second)))
+	s.mtx.Unlock()
+
+	if d := due.Sub(now); d > 0 {
+		s.throttledSeconds.Add(d.Seconds())
+		s.sleep(d)
+	}
+}
+
+// updateCapped returns whether background I/O is capped now, and updates the
+// gauge. It must be called with the mutex held.
+func (s *IOScheduler) updateCapped(now time.Time) bool {
+	capped := s.slow && now.Sub(s.last) <= ioIdle && s.bytesPerSecond > 0
+	if capped != s.wasCapped {
+		s.wasCapped = capped
+		if capped {
+			s.capped.Set(1)
+		} else {
+			s.capped.Set(0)
+		}
+	}
+	return capped
+}
+
+// quantile q of the durations, which are left alone.
+func quantile(durations []time.Duration, q float64) time.Duration {
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(q*float64(len(sorted)-1))]
+}
+
+// NewScheduledFilesystem wraps filesys, so reads and writes of its files are
+// background I/O, scheduled by s, except for the files of its foreground
+// view; see Foreground. If s is nil, filesys is returned as is.
+func NewScheduledFilesystem(filesys Filesystem, s *IOScheduler) Filesystem {
+	if s == nil {
+		return filesys
+	}
+	return scheduledFilesystem{Filesystem: filesys, s: s}
+}
+
+// Foreground returns the view of filesys for foreground I/O, e.g. queries,
+// whose reads are timed, so background I/O can make way for them. If filesys
+// isn't scheduled, it's returned as is.
+func Foreground(filesys Filesystem) Filesystem {
+	switch fs := filesys.(type) {
+	case scheduledFilesystem:
+		fs.foreground = true
+		return fs
+	case writebackFilesystem:
+		fs.Filesystem = Foreground(fs.Filesystem)
+		return fs
+	}
+	return filesys
+}
+
+type scheduledFilesystem struct {
+	Filesystem
+	s          *IOScheduler
+	foreground bool
+}
+
+func (fs scheduledFilesystem) Create(path string) (File, error) {
+	f, err := fs.Filesystem.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return fs.wrap(f), nil
+}
+
+func (fs scheduledFilesystem) Open(path string) (File, error) {
+	f, err := fs.Filesystem.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return fs.wrap(f), nil
+}
+
+func (fs scheduledFilesystem) wrap(f File) File {
+	if fs.foreground {
+		return foregroundFile{f, fs.s}
+	}
+	return backgroundFile{f, fs.s}
+}
+
+// foregroundFile times its reads.
+type foregroundFile struct {
+	File
+	s *IOScheduler
+}
+
+func (f foregroundFile) Read(p []byte) (int, error) {
+	begin := f.s.now()
+	n, err := f.File.Read(p)
+	f.s.observe(f.s.now().Sub(begin))
+	return n, err
+}
+
+func (f foregroundFile) skip(n int64) error {
+	return Skip(f.File, n)
+}
+
+// backgroundFile waits on the scheduler after its reads, and before its
+// writes, so they stay within the cap, if there is one.
+type backgroundFile struct {
+	File
+	s *IOScheduler
+}
+
+func (f backgroundFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.s.wait(n)
+	return n, err
+}
+
+func (f backgroundFile) Write(p []byte) (int, error) {
+	f.s.wait(len(p))
+	return f.File.Write(p)
+}
+
+// skip passes Skip on to the wrapped file. Bytes it skips by seeking aren't
+// read, so they don't count against the cap.
+func (f backgroundFile) skip(n int64) error {
+	return Skip(f.File, n)
+}
+
+// seal passes Seal on to the wrapped file.
+func (f backgroundFile) seal() error {
+	return Seal(f.File)
+}
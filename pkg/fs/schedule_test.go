@@ -0,0 +1,139 @@
+package fs
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestIOScheduler(t *testing.T) {
+	t.Parallel()
+
+	// A fake clock, which sleeping, and reading slow files, advances.
+	var (
+		now              = time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+		latency          time.Duration
+		capped           = prometheus.NewGauge(prometheus.GaugeOpts{})
+		throttledSeconds = prometheus.NewCounter(prometheus.CounterOpts{})
+		s                = newIOScheduler(
+			10*time.Millisecond, 1000, capped, throttledSeconds,
+			func() time.Time { return now },
+			func(d time.Duration) { now = now.Add(d) },
+		)
+		slow    = slowFilesystem{NewVirtualFilesystem(), func() { now = now.Add(latency) }}
+		filesys = NewScheduledFilesystem(slow, s)
+	)
+	if _, err := slow.Create("/query"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queries read through the foreground view, which sees through other
+	// wrappers.
+	foreground := Foreground(NewWritebackFilesystem(filesys, Writeback{SyncBytes: 1024}))
+	query := func(reads int) {
+		f, err := foreground.Open("/query")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		for i := 0; i < reads; i++ {
+			f.Read(make([]byte, 1))
+		}
+	}
+
+	// Everything else is in the background. It takes however long it waits
+	// on the cap, as the virtual filesystem is instantaneous.
+	background := func() (bytesPerSecond float64) {
+		f, err := filesys.Create("/segment")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		begin := now
+		for i := 0; i < 10; i++ {
+			if _, err := f.Write(make([]byte, 100)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		now = now.Add(100 * time.Millisecond) // the last write's share
+		return 1000 / now.Sub(begin).Seconds()
+	}
+	gauge := func(g prometheus.Gauge) float64 {
+		var m dto.Metric
+		g.Write(&m)
+		return m.GetGauge().GetValue()
+	}
+	counter := func(c prometheus.Counter) float64 {
+		var m dto.Metric
+		c.Write(&m)
+		return m.GetCounter().GetValue()
+	}
+
+	uncapped := background()
+	if uncapped < 10000 {
+		t.Fatalf("without queries: want uncapped background I/O, have %.0f bytes/s", uncapped)
+	}
+
+	// Fast queries leave the background alone.
+	latency = time.Millisecond
+	query(ioLatencySamples)
+	if have := background(); have < uncapped {
+		t.Errorf("with fast queries: want %.0f bytes/s, have %.0f", uncapped, have)
+	}
+
+	// Slow queries cap it.
+	latency = 50 * time.Millisecond
+	query(ioLatencySamples)
+	if want, have := 1000.0, background(); want != have {
+		t.Errorf("with slow queries: want %.0f bytes/s, have %.0f", want, have)
+	}
+	if want, have := 1.0, gauge(capped); want != have {
+		t.Errorf("with slow queries: capped: want %v, have %v", want, have)
+	}
+	if want, have := 0.9, counter(throttledSeconds); math.Abs(want-have) > 1e-6 {
+		t.Errorf("with slow queries: throttled seconds: want %v, have %v", want, have)
+	}
+
+	// Once there are no more queries, the node is idle, and the cap goes.
+	now = now.Add(2 * ioIdle)
+	if have := background(); have < uncapped {
+		t.Errorf("idle: want %.0f bytes/s, have %.0f", uncapped, have)
+	}
+	if want, have := 0.0, gauge(capped); want != have {
+		t.Errorf("idle: capped: want %v, have %v", want, have)
+	}
+
+	// A few slow reads after idling aren't enough to cap it again.
+	query(ioMinSamples - 1)
+	if have := background(); have < uncapped {
+		t.Errorf("after a few slow reads: want %.0f bytes/s, have %.0f", uncapped, have)
+	}
+}
+
+// slowFilesystem opens files which call advance on every read, and read
+// nothing, but succeed.
+type slowFilesystem struct {
+	Filesystem
+	advance func()
+}
+
+func (fs slowFilesystem) Open(path string) (File, error) {
+	f, err := fs.Filesystem.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return slowFile{f, fs.advance}, nil
+}
+
+type slowFile struct {
+	File
+	advance func()
+}
+
+func (f slowFile) Read(p []byte) (int, error) {
+	f.advance()
+	return len(p), nil
+}
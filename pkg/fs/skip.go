@@ -0,0 +1,24 @@
+package fs
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// Skip advances the read offset of f, which was opened for reading, by n
+// bytes, or to its end, if it has fewer left. Files that can seek do, so the
+// bytes are never read; others are read, and the bytes discarded.
+func Skip(f File, n int64) error {
+	if s, ok := f.(skipper); ok {
+		return s.skip(n)
+	}
+	_, err := io.CopyN(ioutil.Discard, f, n)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+type skipper interface {
+	skip(n int64) error
+}
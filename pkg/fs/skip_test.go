@@ -0,0 +1,77 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSkip(t *testing.T) {
+	t.Parallel()
+
+	root, err := ioutil.TempDir("", "oklog-fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	s := NewIOScheduler(time.Second, 1<<20, prometheus.NewGauge(prometheus.GaugeOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
+	for _, testcase := range []struct {
+		name    string
+		filesys Filesystem
+		root    string
+	}{
+		{"virtual", NewVirtualFilesystem(), "/"},
+		{"real", NewRealFilesystem(), root},
+		{"mmap", NewRealFilesystemWithMmap(), root},
+		{"wrapped", NewScheduledFilesystem(NewWritebackFilesystem(NewRealFilesystem(), Writeback{SyncBytes: 1}), s), root},
+		{"unskippable", unskippableFilesystem{NewVirtualFilesystem()}, "/"},
+	} {
+		path := filepath.Join(testcase.root, testcase.name)
+		f, err := testcase.filesys.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte("0123456789"))
+		f.Close()
+
+		for _, n := range []int64{0, 4, 10, 20} {
+			f, err := testcase.filesys.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Skip(f, n); err != nil {
+				t.Errorf("%s: Skip(%d): %v", testcase.name, n, err)
+			}
+			buf, err := ioutil.ReadAll(f)
+			f.Close()
+			if err != nil {
+				t.Errorf("%s: after Skip(%d): %v", testcase.name, n, err)
+			}
+			want := ""
+			if n < 10 {
+				want = "0123456789"[n:]
+			}
+			if have := string(buf); want != have {
+				t.Errorf("%s: after Skip(%d): want %q, have %q", testcase.name, n, want, have)
+			}
+		}
+	}
+}
+
+// unskippableFilesystem opens files which hide how they skip, so Skip reads.
+type unskippableFilesystem struct {
+	Filesystem
+}
+
+func (fs unskippableFilesystem) Open(path string) (File, error) {
+	f, err := fs.Filesystem.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ File }{f}, nil
+}
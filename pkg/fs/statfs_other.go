@@ -0,0 +1,7 @@
+// +build !darwin,!dragonfly,!freebsd,!linux
+
+package fs
+
+func statfs(path string) (Usage, error) {
+	return Usage{}, ErrStatfsUnsupported
+}
@@ -0,0 +1,19 @@
+// +build darwin dragonfly freebsd linux
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+func statfs(path string) (Usage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Usage{}, os.NewSyscallError("statfs", err)
+	}
+	return Usage{
+		Capacity:  int64(st.Blocks) * int64(st.Bsize),
+		Available: int64(st.Bavail) * int64(st.Bsize),
+	}, nil
+}
@@ -2,24 +2,137 @@ package fs
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // NewVirtualFilesystem yields an in-memory filesystem.
 func NewVirtualFilesystem() Filesystem {
+	return NewVirtualFilesystemWithSyncHook(nil)
+}
+
+// SyncHook is invoked whenever a file is synced, with the name it was created
+// with, and its size as of the sync. Sync returns after the hook does.
+type SyncHook func(name string, size int64)
+
+// NewVirtualFilesystemWithSyncHook yields an in-memory filesystem that calls
+// the hook on every sync. It's useful to test durability guarantees, or to
+// simulate slow disks.
+func NewVirtualFilesystemWithSyncHook(hook SyncHook) Filesystem {
+	return &virtualFilesystem{
+		files:  map[string]*virtualFile{},
+		onSync: hook,
+	}
+}
+
+// NewVirtualFilesystemWithRecorder yields an in-memory filesystem that records
+// how its files are written back, i.e. synced, and dropped from the cache.
+func NewVirtualFilesystemWithRecorder(r *Recorder) Filesystem {
+	return &virtualFilesystem{
+		files:    map[string]*virtualFile{},
+		recorder: r,
+	}
+}
+
+// NewVirtualFilesystemWithWindowsSemantics yields an in-memory filesystem
+// that, like Windows, refuses to rename or remove files that are open, or to
+// rename over them, so tests can check that code copes.
+func NewVirtualFilesystemWithWindowsSemantics() Filesystem {
+	return &virtualFilesystem{
+		files:   map[string]*virtualFile{},
+		windows: true,
+	}
+}
+
+// NewVirtualFilesystemWithCapacity yields an in-memory filesystem whose
+// Statfs reports the given capacity, which may be changed at any time, e.g.
+// to run out of space. What its files take is used; the rest is available.
+// Writes don't fail for lack of space, though. Other virtual filesystems have
+// DefaultVirtualCapacity.
+func NewVirtualFilesystemWithCapacity(capacity *VirtualCapacity) Filesystem {
 	return &virtualFilesystem{
-		files: map[string]*virtualFile{},
+		files:    map[string]*virtualFile{},
+		capacity: capacity,
 	}
 }
 
+// DefaultVirtualCapacity is the capacity of virtual filesystems, in bytes,
+// unless they're given one.
+const DefaultVirtualCapacity = 1 << 40
+
+// VirtualCapacity is the capacity of a virtual filesystem, in bytes. It's
+// safe for concurrent use.
+type VirtualCapacity struct {
+	bytes int64 // atomic
+}
+
+// NewVirtualCapacity returns a capacity of the given bytes.
+func NewVirtualCapacity(bytes int64) *VirtualCapacity {
+	return &VirtualCapacity{bytes: bytes}
+}
+
+// Set the capacity.
+func (c *VirtualCapacity) Set(bytes int64) {
+	atomic.StoreInt64(&c.bytes, bytes)
+}
+
+func (c *VirtualCapacity) get() int64 {
+	if c == nil {
+		return DefaultVirtualCapacity
+	}
+	return atomic.LoadInt64(&c.bytes)
+}
+
+// errFileInUse is returned by renames and removes of open files, with Windows
+// semantics.
+var errFileInUse = errors.New("the file is in use by another process")
+
+// Recorder records the syncs, range syncs, and cache drops of the files in a
+// virtual filesystem, in order.
+type Recorder struct {
+	mtx   sync.Mutex
+	calls []Call
+}
+
+// Call is a call recorded by a Recorder. Op is "sync", "sync_range", or
+// "drop_cache", of the file created with Name. Off and N are the range of a
+// sync_range; for the others, they're the whole file.
+type Call struct {
+	Op     string
+	Name   string
+	Off, N int64
+}
+
+// Calls returns the calls recorded so far.
+func (r *Recorder) Calls() []Call {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+func (r *Recorder) record(c Call) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.calls = append(r.calls, c)
+}
+
 type virtualFilesystem struct {
-	mtx   sync.RWMutex
-	files map[string]*virtualFile
+	mtx      sync.RWMutex
+	files    map[string]*virtualFile
+	onSync   SyncHook
+	recorder *Recorder        // may be nil
+	windows  bool             // open files can't be renamed or removed
+	capacity *VirtualCapacity // may be nil
 }
 
 func (fs *virtualFilesystem) Create(path string) (File, error) {
@@ -27,9 +140,15 @@ func (fs *virtualFilesystem) Create(path string) (File, error) {
 	defer fs.mtx.Unlock()
 	// os.Create truncates any existing file. So we do, too.
 	f := &virtualFile{
-		name:  path,
-		atime: time.Now(),
-		mtime: time.Now(),
+		name:     path,
+		atime:    time.Now(),
+		mtime:    time.Now(),
+		onSync:   fs.onSync,
+		recorder: fs.recorder,
+		handles:  1, // this one
+	}
+	if old, ok := fs.files[path]; ok && fs.windows && old.inUse() {
+		return nil, &os.PathError{Op: "create", Path: path, Err: errFileInUse}
 	}
 	fs.files[path] = f
 	return f, nil
@@ -42,15 +161,22 @@ func (fs *virtualFilesystem) Open(path string) (File, error) {
 	if !ok {
 		return nil, os.ErrNotExist
 	}
-	return f, nil
+	f.mtx.Lock()
+	f.handles++
+	f.mtx.Unlock()
+	return &virtualHandle{virtualFile: f, name: path}, nil
 }
 
 func (fs *virtualFilesystem) Remove(path string) error {
 	fs.mtx.Lock()
 	defer fs.mtx.Unlock()
-	if _, ok := fs.files[path]; !ok {
+	f, ok := fs.files[path]
+	if !ok {
 		return os.ErrNotExist
 	}
+	if fs.windows && f.inUse() {
+		return &os.PathError{Op: "remove", Path: path, Err: errFileInUse}
+	}
 	delete(fs.files, path)
 	return nil
 }
@@ -62,6 +188,11 @@ func (fs *virtualFilesystem) Rename(oldname, newname string) error {
 	if !ok {
 		return os.ErrNotExist
 	}
+	if fs.windows {
+		if existing, ok := fs.files[newname]; f.inUse() || ok && existing.inUse() {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errFileInUse}
+		}
+	}
 	delete(fs.files, oldname)
 	fs.files[newname] = f // potentially destructive to newname!
 	return nil
@@ -85,7 +216,9 @@ func (fs *virtualFilesystem) Chtimes(path string, atime, mtime time.Time) error
 	if !ok {
 		return os.ErrNotExist
 	}
+	f.mtx.Lock()
 	f.atime, f.mtime = atime, mtime
+	f.mtx.Unlock()
 	return nil
 }
 
@@ -103,11 +236,14 @@ func (fs *virtualFilesystem) Walk(root string, walkFn filepath.WalkFunc) error {
 		if !strings.HasPrefix(path, root) {
 			continue // TODO(pb): this heuristic could be better, if necessary
 		}
-		if err := walkFn(path, virtualFileInfo{
+		f.mtx.Lock() // it may be being written
+		info := virtualFileInfo{
 			name:  f.name,
 			size:  int64(f.buf.Len()),
 			mtime: f.mtime,
-		}, nil); err != nil {
+		}
+		f.mtx.Unlock()
+		if err := walkFn(path, info, nil); err != nil {
 			return err
 		}
 	}
@@ -136,18 +272,86 @@ func (fs *virtualFilesystem) Lock(path string) (r Releaser, existed bool, err er
 	return virtualReleaser(func() error { return fs.Remove(path) }), existed, nil
 }
 
+func (fs *virtualFilesystem) Statfs(path string) (Usage, error) {
+	fs.mtx.Lock()
+	defer fs.mtx.Unlock()
+	var used int64
+	for _, f := range fs.files {
+		used += f.Size()
+	}
+	capacity := fs.capacity.get()
+	available := capacity - used
+	if available < 0 {
+		available = 0
+	}
+	return Usage{Capacity: capacity, Available: available}, nil
+}
+
 type virtualFile struct {
-	name  string
-	mtx   sync.Mutex
-	buf   bytes.Buffer
-	atime time.Time
-	mtime time.Time
+	name     string
+	mtx      sync.Mutex
+	buf      bytes.Buffer
+	atime    time.Time
+	mtime    time.Time
+	off      int       // read offset of the handle returned by Create
+	closed   bool      // the handle returned by Create
+	handles  int       // open
+	onSync   SyncHook  // may be nil
+	recorder *Recorder // may be nil
+}
+
+// virtualHandle is a file returned by Open. Like a file descriptor, it has
+// its own read offset, so multiple readers don't interfere with each other.
+// And, like an *os.File, it's named by the path it was opened with, which
+// may differ from the name the file was created with.
+type virtualHandle struct {
+	*virtualFile
+	name   string
+	off    int
+	closed bool
+}
+
+func (h *virtualHandle) Name() string { return h.name }
+
+func (h *virtualHandle) Close() error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if !h.closed {
+		h.closed = true
+		h.handles--
+	}
+	return nil
+}
+
+func (h *virtualHandle) Read(p []byte) (int, error) {
+	return h.readAt(&h.off, p)
+}
+
+func (h *virtualHandle) skip(n int64) error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.off += int(n)
+	return nil
 }
 
 func (f *virtualFile) Read(p []byte) (int, error) {
+	return f.readAt(&f.off, p)
+}
+
+// readAt reads from the given offset, and advances it. Reads don't consume
+// the file, so it can be opened and read again.
+func (f *virtualFile) readAt(off *int, p []byte) (int, error) {
 	f.mtx.Lock()
 	defer f.mtx.Unlock()
-	return f.buf.Read(p)
+	if *off >= f.buf.Len() {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, f.buf.Bytes()[*off:])
+	*off += n
+	return n, nil
 }
 
 func (f *virtualFile) Write(p []byte) (int, error) {
@@ -156,16 +360,48 @@ func (f *virtualFile) Write(p []byte) (int, error) {
 	return f.buf.Write(p)
 }
 
-func (f *virtualFile) Close() error { return nil }
+func (f *virtualFile) Close() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if !f.closed {
+		f.closed = true
+		f.handles--
+	}
+	return nil
+}
+
 func (f *virtualFile) Name() string { return f.name }
 
+func (f *virtualFile) inUse() bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.handles > 0
+}
+
 func (f *virtualFile) Size() int64 {
 	f.mtx.Lock()
 	defer f.mtx.Unlock()
 	return int64(f.buf.Len())
 }
 
-func (f *virtualFile) Sync() error { return nil }
+func (f *virtualFile) Sync() error {
+	size := f.Size()
+	f.recorder.record(Call{Op: "sync", Name: f.name, N: size})
+	if f.onSync != nil {
+		f.onSync(f.name, size)
+	}
+	return nil
+}
+
+func (f *virtualFile) SyncRange(off, n int64) error {
+	f.recorder.record(Call{Op: "sync_range", Name: f.name, Off: off, N: n})
+	return nil
+}
+
+func (f *virtualFile) DropCache() error {
+	f.recorder.record(Call{Op: "drop_cache", Name: f.name, N: f.Size()})
+	return nil
+}
 
 type virtualFileInfo struct {
 	name  string
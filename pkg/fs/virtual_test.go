@@ -0,0 +1,147 @@
+package fs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestVirtualReadTwice(t *testing.T) {
+	t.Parallel()
+
+	filesys := NewVirtualFilesystem()
+	f, err := filesys.Create("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		f, err := filesys.Open("/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, have := "hello", string(b); want != have {
+			t.Errorf("read %d: want %q, have %q", i+1, want, have)
+		}
+		if want, have := int64(5), f.Size(); want != have {
+			t.Errorf("read %d: want size %d, have %d", i+1, want, have)
+		}
+	}
+}
+
+func TestVirtualSyncHook(t *testing.T) {
+	t.Parallel()
+
+	var synced []string
+	filesys := NewVirtualFilesystemWithSyncHook(func(name string, size int64) {
+		synced = append(synced, fmt.Sprintf("%s:%d", name, size))
+	})
+	f, err := filesys.Create("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"hello", ", world"} {
+		if _, err := f.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want, have := []string{"/foo:5", "/foo:12"}, synced; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestVirtualWindowsSemantics(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name    string
+		filesys Filesystem
+		refuse  bool
+	}{
+		{"default", NewVirtualFilesystem(), false},
+		{"windows", NewVirtualFilesystemWithWindowsSemantics(), true},
+	} {
+		filesys := testcase.filesys
+		for _, path := range []string{"/open", "/other"} {
+			f, err := filesys.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+		}
+		f, err := filesys.Open("/open")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// While it's open, it can't be renamed, renamed over, or removed.
+		for op, err := range map[string]error{
+			"rename":      filesys.Rename("/open", "/renamed"),
+			"rename over": filesys.Rename("/other", "/open"),
+			"remove":      filesys.Remove("/open"),
+		} {
+			if want, have := testcase.refuse, err != nil; want != have {
+				t.Errorf("%s: %s while open: want refused %v, have %v (%v)", testcase.name, op, want, have, err)
+			}
+		}
+
+		// Once it's closed, it can, even if it was closed twice.
+		if !testcase.refuse {
+			continue
+		}
+		f.Close()
+		f.Close()
+		if err := filesys.Rename("/open", "/renamed"); err != nil {
+			t.Errorf("%s: rename once closed: %v", testcase.name, err)
+		}
+		if err := filesys.Remove("/renamed"); err != nil {
+			t.Errorf("%s: remove once closed: %v", testcase.name, err)
+		}
+	}
+}
+
+func TestVirtualStatfs(t *testing.T) {
+	t.Parallel()
+
+	capacity := NewVirtualCapacity(100)
+	filesys := NewVirtualFilesystemWithCapacity(capacity)
+	f, err := filesys.Create("/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(make([]byte, 60)); err != nil {
+		t.Fatal(err)
+	}
+	for _, testcase := range []struct {
+		capacity int64
+		want     Usage
+	}{
+		{100, Usage{Capacity: 100, Available: 40}},
+		{200, Usage{Capacity: 200, Available: 140}},
+		{50, Usage{Capacity: 50, Available: 0}}, // writes don't fail, though
+	} {
+		capacity.Set(testcase.capacity)
+		have, err := filesys.Statfs("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := testcase.want; want != have {
+			t.Errorf("capacity %d: want %+v, have %+v", testcase.capacity, want, have)
+		}
+	}
+
+	// Without a capacity, there's plenty of room.
+	if have, err := NewVirtualFilesystem().Statfs("/"); err != nil || have.Capacity != DefaultVirtualCapacity {
+		t.Errorf("default: want capacity %d, have %+v (%v)", DefaultVirtualCapacity, have, err)
+	}
+}
@@ -0,0 +1,87 @@
+package fs
+
+import "sync"
+
+// Writeback controls how files are written back to disk as they're written.
+// Without it, the OS writes back dirty pages when it sees fit, which, for a
+// big file, may mean all at once, when it's synced, stalling its writer for
+// seconds.
+type Writeback struct {
+	// SyncBytes, if positive, starts writing back a file every time this
+	// many bytes are written to it, so it doesn't accumulate dirty pages.
+	SyncBytes int64
+
+	// DropSealed drops sealed files from the page cache, to leave it to the
+	// files that are still being read, e.g. by queries.
+	DropSealed bool
+}
+
+// NewWritebackFilesystem wraps filesys, so the files it creates are written
+// back per wb.
+func NewWritebackFilesystem(filesys Filesystem, wb Writeback) Filesystem {
+	if wb.SyncBytes <= 0 && !wb.DropSealed {
+		return filesys
+	}
+	return writebackFilesystem{filesys, wb}
+}
+
+type writebackFilesystem struct {
+	Filesystem
+	wb Writeback
+}
+
+func (fs writebackFilesystem) Create(path string) (File, error) {
+	f, err := fs.Filesystem.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &writebackFile{File: f, wb: fs.wb}, nil
+}
+
+// Seal tells the filesystem that f, which it created, is complete, and won't
+// be written again. With Writeback.DropSealed, f is dropped from the page
+// cache. Only pages already written back are dropped, so seal after Sync to
+// drop them all. Sealing is advice, and errors are only worth logging.
+func Seal(f File) error {
+	if s, ok := f.(sealer); ok {
+		return s.seal()
+	}
+	return nil
+}
+
+type sealer interface {
+	seal() error
+}
+
+type writebackFile struct {
+	File
+	wb      Writeback
+	mtx     sync.Mutex
+	written int64 // bytes written
+	synced  int64 // bytes written back, or being written back
+}
+
+// Write p, and start writing back what's been written since the last time,
+// once that's SyncBytes. Writing back is advice, so it doesn't fail writes.
+func (f *writebackFile) Write(p []byte) (int, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	n, err := f.File.Write(p)
+	f.written += int64(n)
+	if f.wb.SyncBytes > 0 && f.written-f.synced >= f.wb.SyncBytes {
+		f.File.SyncRange(f.synced, f.written-f.synced)
+		f.synced = f.written
+	}
+	return n, err
+}
+
+func (f *writebackFile) skip(n int64) error {
+	return Skip(f.File, n)
+}
+
+func (f *writebackFile) seal() error {
+	if !f.wb.DropSealed {
+		return nil
+	}
+	return f.File.DropCache()
+}
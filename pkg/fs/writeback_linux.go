@@ -0,0 +1,24 @@
+// +build amd64 arm64
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	syncFileRangeWrite = 0x2 // SYNC_FILE_RANGE_WRITE
+	fadviseDontNeed    = 4   // POSIX_FADV_DONTNEED
+)
+
+func syncRange(f *os.File, off, n int64) error {
+	return os.NewSyscallError("sync_file_range", syscall.SyncFileRange(int(f.Fd()), off, n, syncFileRangeWrite))
+}
+
+func dropCache(f *os.File) error {
+	if _, _, errno := syscall.Syscall6(syscall.SYS_FADVISE64, f.Fd(), 0, 0, fadviseDontNeed, 0, 0); errno != 0 {
+		return os.NewSyscallError("fadvise64", errno)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteback(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name string
+		wb   Writeback
+		want []Call
+	}{
+		{
+			name: "off",
+			wb:   Writeback{},
+			want: nil,
+		},
+		{
+			name: "sync bytes",
+			wb:   Writeback{SyncBytes: 10},
+			want: []Call{
+				{Op: "sync_range", Name: "/foo", Off: 0, N: 12},
+				{Op: "sync_range", Name: "/foo", Off: 12, N: 10},
+			},
+		},
+		{
+			name: "drop sealed",
+			wb:   Writeback{DropSealed: true},
+			want: []Call{
+				{Op: "drop_cache", Name: "/foo", N: 25},
+			},
+		},
+		{
+			name: "both",
+			wb:   Writeback{SyncBytes: 20, DropSealed: true},
+			want: []Call{
+				{Op: "sync_range", Name: "/foo", Off: 0, N: 22},
+				{Op: "drop_cache", Name: "/foo", N: 25},
+			},
+		},
+	} {
+		var (
+			r       = &Recorder{}
+			filesys = NewWritebackFilesystem(NewVirtualFilesystemWithRecorder(r), testcase.wb)
+		)
+		f, err := filesys.Create("/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []int{6, 6, 5, 5, 3} {
+			if _, err := f.Write(make([]byte, n)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := Seal(f); err != nil {
+			t.Fatal(err)
+		}
+		if want, have := testcase.want, r.Calls(); !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %+v, have %+v", testcase.name, want, have)
+		}
+	}
+}
+
+func TestWritebackRealFilesystem(t *testing.T) {
+	t.Parallel()
+
+	root, err := ioutil.TempDir("", "oklog-fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// The advice may be ignored, but mustn't fail, or mangle the file.
+	filesys := NewWritebackFilesystem(NewRealFilesystem(), Writeback{SyncBytes: 4096, DropSealed: true})
+	path := filepath.Join(root, "segment")
+	f, err := filesys.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make([]byte, 3*4096+123)
+	for i := range want {
+		want[i] = byte(i)
+	}
+	for p := want; len(p) > 0; {
+		n := 1000
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := f.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Seal(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	have, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %d bytes, have %d, or different ones", len(want), len(have))
+	}
+}
+
+// BenchmarkWriteback writes a 1GB segment, in 1MB writes, and syncs it, like
+// an ingest node flushing a big segment. With range syncs, the writes take
+// about as long, but the worst of them, and the final sync, are shorter.
+func BenchmarkWriteback(b *testing.B) {
+	const (
+		segmentSize = 1 << 30
+		writeSize   = 1 << 20
+	)
+	root, err := ioutil.TempDir("", "oklog-fs")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	p := make([]byte, writeSize)
+	for _, bc := range []struct {
+		name      string
+		syncBytes int64
+	}{
+		{"no range sync", 0},
+		{"range sync 8MB", 8 << 20},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			filesys := NewWritebackFilesystem(NewRealFilesystem(), Writeback{SyncBytes: bc.syncBytes})
+			b.SetBytes(segmentSize)
+			var maxWrite, maxSync time.Duration
+			for i := 0; i < b.N; i++ {
+				path := filepath.Join(root, "segment")
+				f, err := filesys.Create(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for n := 0; n < segmentSize; n += writeSize {
+					begin := time.Now()
+					if _, err := f.Write(p); err != nil {
+						b.Fatal(err)
+					}
+					if took := time.Since(begin); took > maxWrite {
+						maxWrite = took
+					}
+				}
+				begin := time.Now()
+				if err := f.Sync(); err != nil {
+					b.Fatal(err)
+				}
+				if took := time.Since(begin); took > maxSync {
+					maxSync = took
+				}
+				f.Close()
+				os.Remove(path)
+			}
+			b.ReportMetric(float64(maxWrite)/float64(time.Millisecond), "max-write-ms")
+			b.ReportMetric(float64(maxSync)/float64(time.Millisecond), "max-sync-ms")
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package inflight
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Handler returns next, registering each request it serves as a "server"
+// operation, counting the bytes of its body, and of the response. If the
+// registry is nil, Handler returns next.
+func (r *Registry) Handler(next http.Handler) http.Handler {
+	if r == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		op := r.Register("server", req.Method+" "+req.URL.RequestURI())
+		defer r.Deregister(op)
+		if req.Body != nil {
+			req.Body = &countingBody{ReadCloser: req.Body, op: op}
+		}
+		next.ServeHTTP(&countingWriter{ResponseWriter: w, op: op}, req)
+	})
+}
+
+// Transport returns next, registering each request it makes as a "client"
+// operation, from when it's sent to when its response body is closed,
+// counting the bytes of its body, and of the response's. If the registry is
+// nil, Transport returns next.
+func (r *Registry) Transport(next http.RoundTripper) http.RoundTripper {
+	if r == nil {
+		return next
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		op := r.Register("client", req.Method+" "+req.URL.String())
+		if req.Body != nil {
+			clone := *req // a RoundTripper mustn't modify the request
+			clone.Body = &countingBody{ReadCloser: req.Body, op: op}
+			req = &clone
+		}
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			r.Deregister(op)
+			return nil, err
+		}
+		resp.Body = &countingBody{ReadCloser: resp.Body, op: op, done: func() { r.Deregister(op) }}
+		return resp, nil
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// countingBody counts the bytes read from a request or response body. If
+// done is non-nil, it's called once, when the body is closed.
+type countingBody struct {
+	io.ReadCloser
+	op   *Op
+	done func()
+	once sync.Once
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.op.Add(n)
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.done != nil {
+		b.once.Do(b.done)
+	}
+	return err
+}
+
+// countingWriter counts the bytes written to a response. It flushes, and
+// hijacks, if the response does; the bytes written to a hijacked
+// connection aren't counted.
+type countingWriter struct {
+	http.ResponseWriter
+	op *Op
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.op.Add(n)
+	return n, err
+}
+
+func (w *countingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *countingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response doesn't support hijacking")
+	}
+	return h.Hijack()
+}
@@ -0,0 +1,120 @@
+// Package inflight tracks the operations a node is in the middle of, like
+// the queries it's serving, and the segments it's consuming and replicating,
+// so they can be listed while diagnosing it.
+package inflight
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Registry holds the operations in flight. It's safe for concurrent use.
+// A nil *Registry is valid, and registers nothing.
+type Registry struct {
+	mtx  sync.Mutex
+	next uint64
+	ops  map[uint64]*Op
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{ops: map[uint64]*Op{}}
+}
+
+// Op is an operation in flight. A nil *Op is valid, and counts nothing.
+type Op struct {
+	id     uint64
+	kind   string
+	target string
+	begin  time.Time
+	bytes  int64 // atomic
+}
+
+// Register an operation of the kind, e.g. "server" or "client", on the
+// target, e.g. a method and URL, which begins now. Deregister it once it's
+// done.
+func (r *Registry) Register(kind, target string) *Op {
+	if r == nil {
+		return nil
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.next++
+	op := &Op{id: r.next, kind: kind, target: target, begin: time.Now()}
+	r.ops[op.id] = op
+	return op
+}
+
+// Deregister the operation, once it's done. It's safe to deregister an
+// operation more than once.
+func (r *Registry) Deregister(op *Op) {
+	if r == nil || op == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.ops, op.id)
+}
+
+// Add n bytes to those the operation has sent or received so far.
+func (op *Op) Add(n int) {
+	if op == nil {
+		return
+	}
+	atomic.AddInt64(&op.bytes, int64(n))
+}
+
+// Status is a snapshot of an operation in flight.
+type Status struct {
+	ID       uint64    `json:"id"`
+	Kind     string    `json:"kind"`
+	Target   string    `json:"target"`
+	Begin    time.Time `json:"begin"`
+	Duration string    `json:"duration"`
+	Bytes    int64     `json:"bytes"` // sent or received so far
+}
+
+// Snapshot returns the operations in flight, oldest first.
+func (r *Registry) Snapshot() []Status {
+	if r == nil {
+		return nil
+	}
+	r.mtx.Lock()
+	statuses := make([]Status, 0, len(r.ops))
+	for _, op := range r.ops {
+		statuses = append(statuses, Status{
+			ID:       op.id,
+			Kind:     op.kind,
+			Target:   op.target,
+			Begin:    op.begin,
+			Duration: time.Since(op.begin).String(),
+			Bytes:    atomic.LoadInt64(&op.bytes),
+		})
+	}
+	r.mtx.Unlock()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ID < statuses[j].ID })
+	return statuses
+}
+
+// ServeHTTP serves the snapshot as JSON.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	statuses := r.Snapshot()
+	if statuses == nil {
+		statuses = []Status{} // not null
+	}
+	buf, err := json.MarshalIndent(statuses, "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(buf)
+}
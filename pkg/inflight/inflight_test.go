@@ -0,0 +1,261 @@
+package inflight
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	a := r.Register("server", "GET /store/query?q=a")
+	b := r.Register("client", "POST http://store2/store/replicate")
+	a.Add(10)
+	a.Add(5)
+
+	have := r.Snapshot()
+	if want, have := 2, len(have); want != have {
+		t.Fatalf("want %d operations, have %d", want, have)
+	}
+	for i, want := range []Status{
+		{Kind: "server", Target: "GET /store/query?q=a", Bytes: 15},
+		{Kind: "client", Target: "POST http://store2/store/replicate", Bytes: 0},
+	} {
+		if want.Kind != have[i].Kind || want.Target != have[i].Target || want.Bytes != have[i].Bytes {
+			t.Errorf("%d: want %+v, have %+v", i, want, have[i])
+		}
+		if have[i].Begin.IsZero() || have[i].Duration == "" {
+			t.Errorf("%d: want begin and duration, have %+v", i, have[i])
+		}
+	}
+
+	r.Deregister(a)
+	r.Deregister(a) // again
+	if want, have := []string{"POST http://store2/store/replicate"}, targets(r.Snapshot()); fmt.Sprint(want) != fmt.Sprint(have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	r.Deregister(b)
+	if want, have := 0, len(r.Snapshot()); want != have {
+		t.Errorf("want %d operations, have %d", want, have)
+	}
+}
+
+func TestRegistryNil(t *testing.T) {
+	t.Parallel()
+
+	var r *Registry
+	op := r.Register("server", "GET /")
+	op.Add(1)
+	r.Deregister(op)
+	if have := r.Snapshot(); have != nil {
+		t.Errorf("want no operations, have %v", have)
+	}
+	h := http.NotFoundHandler()
+	if r.Handler(h) == nil {
+		t.Error("want the handler, have nil")
+	}
+	if want, have := http.DefaultTransport, r.Transport(http.DefaultTransport); want != have {
+		t.Errorf("want the transport, have %v", have)
+	}
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	t.Parallel()
+
+	var (
+		r    = NewRegistry()
+		wg   sync.WaitGroup
+		stop = make(chan struct{})
+		done = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for _, s := range r.Snapshot() {
+				if s.Bytes < 0 || s.Bytes > 100 {
+					t.Errorf("%s: bytes %d", s.Target, s.Bytes)
+				}
+			}
+		}
+	}()
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				op := r.Register("server", fmt.Sprintf("GET /%d/%d", i, j))
+				for k := 0; k < 10; k++ {
+					op.Add(10)
+				}
+				r.Deregister(op)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(stop)
+	<-done
+
+	if want, have := 0, len(r.Snapshot()); want != have {
+		t.Errorf("want %d operations, have %d", want, have)
+	}
+	ids := map[uint64]bool{}
+	for i := 0; i < 10; i++ {
+		ids[r.Register("server", "GET /").id] = true
+	}
+	if want, have := 10, len(ids); want != have {
+		t.Errorf("want %d unique IDs, have %d", want, have)
+	}
+}
+
+func TestHandlerSnapshotMidOperation(t *testing.T) {
+	t.Parallel()
+
+	var (
+		r       = NewRegistry()
+		written = make(chan struct{})
+		finish  = make(chan struct{})
+	)
+	server := httptest.NewServer(r.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ioutil.ReadAll(req.Body)
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		close(written)
+		<-finish
+		w.Write([]byte("second\n"))
+	})))
+	defer server.Close()
+
+	respc := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Post(server.URL+"/store/query?from=a&to=b", "text/plain", strings.NewReader("body"))
+		if err != nil {
+			t.Error(err)
+			close(respc)
+			return
+		}
+		respc <- resp
+	}()
+	<-written
+
+	// The request is in flight, having read its body, and written a line.
+	have := r.Snapshot()
+	if want, have := 1, len(have); want != have {
+		t.Fatalf("want %d operation, have %d", want, have)
+	}
+	if want, have := "POST /store/query?from=a&to=b", have[0].Target; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := "server", have[0].Kind; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := int64(len("body")+len("first\n")), have[0].Bytes; want != have {
+		t.Errorf("want %d bytes, have %d", want, have)
+	}
+
+	// It's served as JSON.
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/debug/requests", nil))
+	var served []Status
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	if want, have := 1, len(served); want != have {
+		t.Errorf("want %d operation served, have %d", want, have)
+	}
+
+	close(finish)
+	resp := <-respc
+	if resp == nil {
+		t.FailNow()
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want, have := "first\nsecond\n", string(body); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(r.Snapshot()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("want no operations, have %v", targets(r.Snapshot()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// With none in flight, it's an empty list.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/debug/requests", nil))
+	if want, have := "[]", w.Body.String(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ioutil.ReadAll(req.Body)
+		w.Write([]byte("response"))
+	}))
+	defer server.Close()
+
+	r := NewRegistry()
+	client := &http.Client{Transport: r.Transport(http.DefaultTransport)}
+	req, err := http.NewRequest("POST", server.URL+"/store/replicate", strings.NewReader("segment"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The request is in flight until its response body is closed.
+	body, _ := ioutil.ReadAll(resp.Body)
+	have := r.Snapshot()
+	if want, have := 1, len(have); want != have {
+		t.Fatalf("want %d operation, have %d", want, have)
+	}
+	if want, have := "POST "+server.URL+"/store/replicate", have[0].Target; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := "client", have[0].Kind; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := int64(len("segment")+len(body)), have[0].Bytes; want != have {
+		t.Errorf("want %d bytes, have %d", want, have)
+	}
+	resp.Body.Close()
+	resp.Body.Close() // again
+	if want, have := 0, len(r.Snapshot()); want != have {
+		t.Errorf("want %d operations, have %d", want, have)
+	}
+
+	// Failed requests aren't left registered.
+	if _, err := client.Get("http://127.0.0.1:1/"); err == nil {
+		t.Fatal("want error, have none")
+	}
+	if want, have := 0, len(r.Snapshot()); want != have {
+		t.Errorf("want %d operations, have %d", want, have)
+	}
+}
+
+func targets(statuses []Status) []string {
+	var targets []string
+	for _, s := range statuses {
+		targets = append(targets, s.Target)
+	}
+	return targets
+}
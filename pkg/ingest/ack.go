@@ -0,0 +1,147 @@
+package ingest
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// AckHandshake is the line a client may write, after any SourceHandshake
+// and before any record.FramingHandshake, to have its records acknowledged.
+// The ingester then writes lines of "ACK <n>" to the client, each meaning
+// that the first n records the client wrote on the connection are in the
+// active segment, or, with HandleDurableWriter, synced. Acknowledgements
+// are cumulative, and coalesced, so they may skip numbers.
+//
+// A client should keep each record until it's acknowledged, and write
+// those that aren't again, on a new connection, if the connection is lost.
+// That makes delivery at least once: a record written again may have been
+// ingested already, and is then ingested twice. Records rejected for their
+// size aren't counted, so acknowledgements can lag, and cause more records
+// to be written again, but never fewer.
+const AckHandshake = "ACKS"
+
+// Ack starts the lines an ingester writes to acknowledge records; see
+// AckHandshake.
+const Ack = "ACK"
+
+// ackWriteTimeout bounds how long an acknowledgement waits on a client
+// that isn't reading them.
+const ackWriteTimeout = 5 * time.Second
+
+// readAcks reads the AckHandshake from the start of r, if it's there, and
+// returns whether it was, and the rest of r.
+func readAcks(r io.Reader) (bool, io.Reader, error) {
+	ok, br, err := matchPrefix(r, AckHandshake+"\n")
+	if err != nil {
+		return false, nil, err
+	}
+	return ok, br, nil
+}
+
+// acker acknowledges the records a ConnectionHandler reads from a
+// connection. A handler reads the next record only once it's written the
+// last, so each read acknowledges every record read before it. The
+// acknowledgements are written by a goroutine of their own, so the handler
+// never waits on the client, and those that pile up meanwhile are
+// coalesced.
+//
+// On a batched connection, records are acknowledged a batch at a time: none
+// is until the last of its batch has been read, and written, and the Sync
+// the Writer held back, if any, has been performed.
+//
+// If latency is non-nil, it observes the time from when the first record an
+// acknowledgement covers was read to when the acknowledgement is written.
+type acker struct {
+	conn    net.Conn
+	latency observer
+	read    uint64    // by the handler
+	first   time.Time // by the handler: the first record read since acked
+	acked   uint64    // atomic
+	mtx     sync.Mutex
+	pending time.Time // the first record acked, but not yet written
+	more    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newAcker(conn net.Conn, latency observer) *acker {
+	a := &acker{
+		conn:    conn,
+		latency: latency,
+		more:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// reader wraps the connection's record.Reader, to acknowledge the records
+// the handler reads from it, and writes to w.
+func (a *acker) reader(r record.Reader, w *Writer) record.Reader {
+	return func() ([]byte, error) {
+		if a.read > atomic.LoadUint64(&a.acked) && !w.batch.more() {
+			if err := w.release(); err != nil {
+				return nil, err
+			}
+			a.mtx.Lock()
+			atomic.StoreUint64(&a.acked, a.read)
+			if a.pending.IsZero() {
+				a.pending = a.first
+			}
+			a.mtx.Unlock()
+			a.first = time.Time{}
+			select {
+			case a.more <- struct{}{}:
+			default:
+			}
+		}
+		record, err := r()
+		if err == nil {
+			a.read++
+			if a.latency != nil && a.first.IsZero() {
+				a.first = time.Now()
+			}
+		}
+		return record, err
+	}
+}
+
+func (a *acker) run() {
+	defer close(a.done)
+	var sent uint64
+	for stopped := false; !stopped; {
+		select {
+		case <-a.more:
+		case <-a.stop:
+			stopped = true
+		}
+		a.mtx.Lock()
+		n, pending := atomic.LoadUint64(&a.acked), a.pending
+		a.pending = time.Time{}
+		a.mtx.Unlock()
+		if n > sent {
+			a.conn.SetWriteDeadline(time.Now().Add(ackWriteTimeout))
+			if _, err := fmt.Fprintf(a.conn, "%s %d\n", Ack, n); err != nil {
+				return // the client writes the records again
+			}
+			sent = n
+			if a.latency != nil && !pending.IsZero() {
+				a.latency.Observe(time.Since(pending).Seconds())
+			}
+		}
+	}
+}
+
+// close writes the last acknowledgement, if it's due, and returns once it's
+// written. Call it once the handler returns.
+func (a *acker) close() {
+	close(a.stop)
+	<-a.done
+}
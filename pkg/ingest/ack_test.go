@@ -0,0 +1,137 @@
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestHandleConnectionsAcks(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name      string
+		h         ConnectionHandler
+		handshake string
+	}{
+		{"fast", HandleFastWriter, AckHandshake + "\n"},
+		{"durable", HandleDurableWriter, AckHandshake + "\n"},
+		{"with source", HandleFastWriter, SourceHandshake + " team-a\n" + AckHandshake + "\n"},
+	} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			records = prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"handler"})
+			syncs   = prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"handler"})
+		)
+		go HandleConnections(ln, ConnectionConfig{
+			Handler:          testcase.h,
+			ReaderFactory:    record.NewDynamicReader,
+			Log:              log,
+			SegmentFlushAge:  time.Hour,
+			SegmentFlushSize: 1024 * 1024,
+			ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+			Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+			Records:          records.WithLabelValues(testcase.name),
+			Syncs:            syncs.WithLabelValues(testcase.name),
+			SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		})
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(conn, testcase.handshake)
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(conn, "topic record %d\n", i)
+		}
+
+		// Every record acknowledged is written, and with the durable
+		// handler, synced.
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var (
+			s    = bufio.NewScanner(conn)
+			last int
+		)
+		awaitAck := func(n int) {
+			t.Helper()
+			for last < n && s.Scan() {
+				var acked int
+				if _, err := fmt.Sscanf(s.Text(), Ack+" %d", &acked); err != nil {
+					t.Fatalf("%s: %q: %v", testcase.name, s.Text(), err)
+				}
+				if acked <= last {
+					t.Errorf("%s: ACK %d after ACK %d", testcase.name, acked, last)
+				}
+				if written := int(counterValue(t, records, testcase.name)); written < acked {
+					t.Errorf("%s: ACK %d with %d records written", testcase.name, acked, written)
+				}
+				if testcase.name == "durable" && counterValue(t, syncs, testcase.name) == 0 {
+					t.Errorf("%s: ACK %d before any sync", testcase.name, acked)
+				}
+				last = acked
+			}
+			if last < n {
+				t.Fatalf("%s: want ACK %d, have ACK %d (%v)", testcase.name, n, last, s.Err())
+			}
+		}
+		awaitAck(3)
+
+		// The last records are acknowledged before the connection closes.
+		for i := 3; i < 5; i++ {
+			fmt.Fprintf(conn, "topic record %d\n", i)
+		}
+		conn.(*net.TCPConn).CloseWrite()
+		awaitAck(5)
+		if s.Scan() {
+			t.Errorf("%s: unexpected %q after the last ACK", testcase.name, s.Text())
+		}
+		conn.Close()
+		ln.Close()
+	}
+}
+
+func TestReadAcks(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		input string
+		acks  bool
+		rest  string
+	}{
+		{"", false, ""},
+		{"ACKS\n", true, ""},
+		{"ACKS\ntopic a\n", true, "topic a\n"},
+		{"ACKS topic a\n", false, "ACKS topic a\n"},
+		{"ACK\n", false, "ACK\n"},
+		{"topic a\n", false, "topic a\n"},
+	} {
+		acks, r, err := readAcks(strings.NewReader(testcase.input))
+		if err != nil {
+			t.Errorf("%q: %v", testcase.input, err)
+			continue
+		}
+		if want, have := testcase.acks, acks; want != have {
+			t.Errorf("%q: want %v, have %v", testcase.input, want, have)
+		}
+		rest, _ := bufio.NewReader(r).ReadString(0)
+		if want, have := testcase.rest, rest; want != have {
+			t.Errorf("%q: want rest %q, have %q", testcase.input, want, have)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"net/http"
 	"strconv"
@@ -11,6 +12,8 @@ import (
 
 	"github.com/pborman/uuid"
 	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/cluster"
 )
 
 // These are the ingest API URL paths.
@@ -21,13 +24,35 @@ const (
 	APIPathFailed       = "/failed"
 	APIPathSegmentState = "/_segmentstate"
 	APIPathClusterState = "/_clusterstate"
+	APIPathLag          = "/lag"         // served by the LagMonitor
+	APIPathConnections  = "/connections" // served by Connections
 )
 
+// HTTPHeaderLabels is the header of a read segment with the labels it was
+// stamped with, if any.
+const HTTPHeaderLabels = "X-Oklog-Labels"
+
+// HTTPHeaderFlushed is the header of the next segment's ID with when it was
+// flushed, in RFC3339, so consumers can tell how far behind they are.
+const HTTPHeaderFlushed = "X-Oklog-Flushed"
+
 // API serves the ingest API.
+//
+// Each segment has a preferred consumer, among the store nodes, chosen by
+// rendezvous hashing of its ID, so consumers don't all contend for the same
+// segments, and a node joining or leaving only moves its share. Consumers
+// that identify themselves are given the oldest segment they're preferred
+// for, or any segment that's waited out the takeover timeout since it was
+// flushed, e.g. as its preferred consumer is gone, or falling behind.
+// Segments are still handed out one consumer at a time, and committed or
+// failed, so if a consumer dies with a segment, it's failed after the pending
+// timeout, and given to the next.
 type API struct {
 	peer              ClusterPeer
 	log               Log
 	timeout           time.Duration
+	takeover          time.Duration
+	now               func() time.Time
 	pending           map[string]pendingSegment
 	action            chan func()
 	stop              chan chan struct{}
@@ -45,14 +70,17 @@ type pendingSegment struct {
 
 // ClusterPeer models cluster.Peer.
 type ClusterPeer interface {
+	Current(cluster.PeerType) []string
 	State() map[string]interface{}
 }
 
-// NewAPI returns a usable ingest API.
+// NewAPI returns a usable ingest API. Consumers may take segments they're not
+// preferred for once they were flushed takeoverTimeout ago; zero means right
+// away, i.e. there's no preference.
 func NewAPI(
 	peer ClusterPeer,
 	log Log,
-	pendingSegmentTimeout time.Duration,
+	pendingSegmentTimeout, takeoverTimeout time.Duration,
 	failedSegments, committedSegments, committedBytes prometheus.Counter,
 	duration *prometheus.HistogramVec,
 ) *API {
@@ -60,6 +88,8 @@ func NewAPI(
 		peer:              peer,
 		log:               log,
 		timeout:           pendingSegmentTimeout,
+		takeover:          takeoverTimeout,
+		now:               time.Now,
 		pending:           map[string]pendingSegment{},
 		action:            make(chan func()),
 		stop:              make(chan chan struct{}),
@@ -154,13 +184,18 @@ func (a *API) clean(now time.Time) {
 }
 
 func (a *API) handleNext(w http.ResponseWriter, r *http.Request) {
+	type next struct {
+		id      string
+		flushed time.Time
+	}
 	var (
 		notFound   = make(chan struct{})
 		otherError = make(chan error)
-		nextID     = make(chan string)
+		nextID     = make(chan next)
 	)
+	consumer := r.URL.Query().Get("consumer")
 	a.action <- func() {
-		s, err := a.log.Oldest()
+		s, flushed, err := a.oldestFor(consumer)
 		if err == ErrNoSegmentsAvailable {
 			close(notFound)
 			return
@@ -171,16 +206,74 @@ func (a *API) handleNext(w http.ResponseWriter, r *http.Request) {
 		}
 		id := uuid.New()
 		a.pending[id] = pendingSegment{s, time.Now().Add(a.timeout), false}
-		nextID <- id
+		nextID <- next{id, flushed}
 	}
 	select {
 	case <-notFound:
 		http.NotFound(w, r)
 	case err := <-otherError:
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-	case id := <-nextID:
-		fmt.Fprint(w, id)
+	case next := <-nextID:
+		if !next.flushed.IsZero() {
+			w.Header().Set(HTTPHeaderFlushed, next.flushed.UTC().Format(time.RFC3339Nano))
+		}
+		fmt.Fprint(w, next.id)
+	}
+}
+
+// oldestFor returns the oldest segment for the consumer, identified by its
+// API host:port, as the cluster knows it, and when it was flushed. Consumers
+// that don't identify themselves get the oldest segment.
+func (a *API) oldestFor(consumer string) (ReadSegment, time.Time, error) {
+	var (
+		accept = func(id string, flushed time.Time) bool { return true }
+		chosen time.Time
+	)
+	if consumer != "" && a.takeover > 0 {
+		var (
+			consumers = a.peer.Current(cluster.PeerTypeStore)
+			now       = a.now()
+		)
+		if !contains(consumers, consumer) {
+			consumers = append(consumers, consumer) // we'll hear of it soon
+		}
+		accept = func(id string, flushed time.Time) bool {
+			return now.Sub(flushed) >= a.takeover || preferredConsumer(consumers, id) == consumer
+		}
+	}
+	segment, err := a.log.OldestWhere(func(id string, flushed time.Time) bool {
+		ok := accept(id, flushed)
+		if ok && (chosen.IsZero() || flushed.Before(chosen)) {
+			chosen = flushed // of the oldest accepted, which is chosen
+		}
+		return ok
+	})
+	return segment, chosen, err
+}
+
+// preferredConsumer returns the consumer with the highest rendezvous hash of
+// the segment ID. The ID is hashed last, since consumers' names differ in
+// only a few bytes, which FNV doesn't mix well into the high bits otherwise.
+func preferredConsumer(consumers []string, id string) (preferred string) {
+	var best uint64
+	for _, consumer := range consumers {
+		h := fnv.New64a()
+		h.Write([]byte(consumer))
+		h.Write([]byte(id))
+		if score := h.Sum64(); preferred == "" || score > best || (score == best && consumer < preferred) {
+			preferred, best = consumer, score
+		}
 	}
+	return preferred
+}
+
+func contains(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
 }
 
 func (a *API) handleRead(w http.ResponseWriter, r *http.Request) {
@@ -206,6 +299,9 @@ func (a *API) handleRead(w http.ResponseWriter, r *http.Request) {
 	}
 	select {
 	case s := <-segment:
+		if labels := s.Labels(); labels != "" {
+			w.Header().Set(HTTPHeaderLabels, labels)
+		}
 		io.Copy(w, s)
 	case <-notFound:
 		http.NotFound(w, r)
@@ -0,0 +1,307 @@
+package ingest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestPreferredConsumer(t *testing.T) {
+	t.Parallel()
+
+	// Removing a consumer only moves the segments it was preferred for.
+	var (
+		consumers = []string{"a:1", "b:1", "c:1", "d:1"}
+		without   = []string{"a:1", "b:1", "d:1"}
+		counts    = map[string]int{}
+	)
+	for i := 0; i < 1000; i++ {
+		id := uuid.New()
+		before, after := preferredConsumer(consumers, id), preferredConsumer(without, id)
+		counts[before]++
+		if before != "c:1" && before != after {
+			t.Fatalf("%s: moved from %s to %s", id, before, after)
+		}
+		if want, have := before, preferredConsumer([]string{"d:1", "c:1", "b:1", "a:1"}, id); want != have {
+			t.Fatalf("%s: order matters: want %s, have %s", id, want, have)
+		}
+	}
+	for _, consumer := range consumers {
+		if n := counts[consumer]; n < 150 {
+			t.Errorf("%s: preferred for only %d of 1000 segments", consumer, n)
+		}
+	}
+	if want, have := "", preferredConsumer(nil, "segment"); want != have {
+		t.Errorf("no consumers: want %q, have %q", want, have)
+	}
+}
+
+func TestConsumeChurn(t *testing.T) {
+	t.Parallel()
+
+	// Consumers come and go, and some die holding segments, while segments
+	// are flushed. Every segment is committed exactly once, and, until its
+	// takeover timeout, only by its preferred consumer.
+	log, err := NewFileLog(fs.NewVirtualFilesystem(), "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	var (
+		peer = &mutablePeer{}
+		a    = NewAPI(
+			peer, log, time.Minute, time.Hour,
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"}),
+		)
+		clock = time.Now()
+	)
+	a.now = func() time.Time { return clock }
+	defer a.Stop()
+
+	var (
+		rng       = rand.New(rand.NewSource(1))
+		ids       = map[string]string{} // segment content: ID
+		committed = map[string]int{}    // segment content: commits
+		alive     []string              // consumers
+		joined    int
+	)
+	flush := func() {
+		w, err := log.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := fmt.Sprintf("segment %d\n", len(ids))
+		fmt.Fprint(w, content)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		ids[content] = segmentID(w.(fileWriteSegment).f.Name())
+	}
+	join := func() {
+		joined++
+		alive = append(alive, fmt.Sprintf("store-%d:7650", joined))
+		if rng.Intn(2) == 0 {
+			peer.set(alive) // or the ingester hears of it later
+		}
+	}
+	leave := func(i int) {
+		alive = append(alive[:i:i], alive[i+1:]...)
+		peer.set(alive)
+	}
+	// consume a segment as the consumer, and report whether there was one.
+	// Dying consumers read it, but never commit it.
+	consume := func(consumer string, die bool) bool {
+		id, code := do(a, "GET", APIPathNext, "consumer", consumer)
+		if code == http.StatusNotFound {
+			return false
+		}
+		if code != http.StatusOK {
+			t.Fatalf("%s: next: %d", consumer, code)
+		}
+		content, code := do(a, "GET", APIPathRead, "id", id)
+		if code != http.StatusOK {
+			t.Fatalf("%s: read: %d", consumer, code)
+		}
+		if clock.Sub(time.Now()) < a.takeover {
+			consumers := peer.Current(cluster.PeerTypeStore)
+			if !contains(consumers, consumer) {
+				consumers = append(consumers, consumer)
+			}
+			if preferred := preferredConsumer(consumers, ids[content]); preferred != consumer {
+				t.Fatalf("%s: got %q, for %s", consumer, content, preferred)
+			}
+		}
+		if die {
+			return true
+		}
+		if _, code := do(a, "POST", APIPathCommit, "id", id); code != http.StatusOK {
+			t.Fatalf("%s: commit: %d", consumer, code)
+		}
+		committed[content]++
+		return true
+	}
+	// fail the segments of dead consumers, past the pending timeout.
+	fail := func() {
+		done := make(chan struct{})
+		a.action <- func() { a.clean(time.Now().Add(2 * a.timeout)); close(done) }
+		<-done
+	}
+
+	for i := 0; i < 3; i++ {
+		join()
+	}
+	peer.set(alive)
+	for round := 0; round < 500; round++ {
+		switch n := rng.Intn(10); {
+		case n < 3:
+			flush()
+		case n == 3:
+			join()
+		case n == 4 && len(alive) > 1:
+			leave(rng.Intn(len(alive)))
+		case n == 5 && len(alive) > 1:
+			i := rng.Intn(len(alive))
+			consume(alive[i], true)
+			leave(i)
+		case n == 6:
+			fail()
+		default:
+			consume(alive[rng.Intn(len(alive))], false)
+		}
+	}
+
+	// Everyone who's left drains what they're preferred for, but one node,
+	// which is stuck, and whose segments wait out their takeover timeout.
+	// Then anyone takes them.
+	var (
+		nodes = append(alive, "stuck:7650")
+		stuck = func() (n int64) {
+			for content, id := range ids {
+				if committed[content] == 0 && preferredConsumer(nodes, id) == "stuck:7650" {
+					n++
+				}
+			}
+			return n
+		}
+	)
+	peer.set(nodes)
+	for stuck() < 3 {
+		flush()
+	}
+	fail()
+	for _, consumer := range alive {
+		for consume(consumer, false) {
+		}
+	}
+	if stats, err := log.Stats(); err != nil {
+		t.Fatal(err)
+	} else if want, have := stuck(), stats.FlushedSegments; want != have {
+		t.Fatalf("before the takeover: want %d segments left, have %d", want, have)
+	}
+	clock = clock.Add(2 * a.takeover)
+	for consume(alive[0], false) {
+	}
+
+	if want, have := len(ids), len(committed); want != have {
+		t.Errorf("want %d segments committed, have %d", want, have)
+	}
+	var twice []string
+	for content, n := range committed {
+		if n != 1 {
+			twice = append(twice, strings.TrimSpace(content))
+		}
+	}
+	sort.Strings(twice)
+	if len(twice) > 0 {
+		t.Errorf("committed more than once: %v", twice)
+	}
+	stats, err := log.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := int64(0), stats.FlushedSegments+stats.PendingSegments; want != have {
+		t.Errorf("want %d segments left, have %d", want, have)
+	}
+}
+
+// do serves a request of the API, with the given query, and returns the
+// response body and status.
+func TestAPINextFlushed(t *testing.T) {
+	t.Parallel()
+
+	log, err := NewFileLog(fs.NewVirtualFilesystem(), "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	a := NewAPI(
+		&mutablePeer{}, log, time.Minute, 0,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"}),
+	)
+	defer a.Stop()
+
+	// The next segment's ID comes with when it was flushed, so consumers
+	// can tell how far behind they are.
+	before := time.Now().Add(-time.Second) // file times may be truncated
+	w, err := log.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(w, "segment\n")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest("GET", APIPathNext+"?consumer=store:7650", nil))
+	if want, have := http.StatusOK, rec.Code; want != have {
+		t.Fatalf("want HTTP %d, have %d", want, have)
+	}
+	flushed, err := time.Parse(time.RFC3339Nano, rec.Header().Get(HTTPHeaderFlushed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flushed.Before(before) || flushed.After(after) {
+		t.Errorf("want flushed between %s and %s, have %s", before, after, flushed)
+	}
+
+	// Without a next segment, there's nothing to be behind.
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest("GET", APIPathNext, nil))
+	if want, have := http.StatusNotFound, rec.Code; want != have {
+		t.Fatalf("want HTTP %d, have %d", want, have)
+	}
+	if have := rec.Header().Get(HTTPHeaderFlushed); have != "" {
+		t.Errorf("want no %s, have %q", HTTPHeaderFlushed, have)
+	}
+}
+
+func do(a *API, method, path, key, value string) (string, int) {
+	r := httptest.NewRequest(method, path+"?"+url.Values{key: {value}}.Encode(), nil)
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+	body, _ := ioutil.ReadAll(w.Body)
+	return string(body), w.Code
+}
+
+type mutablePeer struct {
+	mtx    sync.Mutex
+	stores []string
+}
+
+func (p *mutablePeer) set(stores []string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.stores = append([]string(nil), stores...)
+}
+
+func (p *mutablePeer) Current(t cluster.PeerType) []string {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if t != cluster.PeerTypeStore {
+		return nil
+	}
+	return append([]string(nil), p.stores...)
+}
+
+func (p *mutablePeer) State() map[string]interface{} { return nil }
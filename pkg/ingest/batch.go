@@ -0,0 +1,268 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// BatchHeader starts the line ahead of each batch of records a client writes,
+// once it's agreed to FeatureBatch: "BATCH <count> <bytes>", where bytes is
+// the size of the records that follow, and count is the number of them, each
+// ending with a newline. A batch is read whole before any of its records is
+// written, and acknowledged as a unit. With HandleDurableWriter, one sync
+// covers it.
+const BatchHeader = "BATCH"
+
+// BadBatch starts the line an ingester writes to a client before it closes
+// the connection, because a batch is malformed: its count and bytes don't
+// agree, or it's bigger than MaxBatchSize. The rest of the line says why.
+// The records of the batch aren't written, nor are later ones read.
+const BadBatch = "BADBATCH"
+
+// MaxBatchSize is the most bytes of records a batch may have.
+const MaxBatchSize = 16 * 1024 * 1024
+
+// maxBatchHeaderSize bounds the line of a BatchHeader.
+const maxBatchHeaderSize = 64
+
+// batchReader reads the records of a batched connection. Each batch is read
+// whole, and checked, before the first of its records is returned, and the
+// next record is read ahead, so more tells whether the last record returned
+// ends its batch.
+type batchReader struct {
+	br      *bufio.Reader
+	rfac    record.ReaderFactory
+	buf     []byte        // of the current batch
+	records record.Reader // of the current batch
+	next    []byte        // record of the current batch, read ahead
+}
+
+func newBatchReader(r io.Reader, rfac record.ReaderFactory) *batchReader {
+	return &batchReader{br: bufio.NewReader(r), rfac: rfac}
+}
+
+// more returns whether the current batch has records yet to be read. It's
+// false for a nil batchReader.
+func (b *batchReader) more() bool {
+	return b != nil && b.next != nil
+}
+
+// read implements record.Reader.
+func (b *batchReader) read() ([]byte, error) {
+	for b.next == nil {
+		if err := b.readBatch(); err != nil {
+			return nil, err
+		}
+		if err := b.readAhead(); err != nil {
+			return nil, err
+		}
+	}
+	record := b.next
+	if err := b.readAhead(); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// readAhead reads the next record of the current batch, if there is one.
+// Records the factory rejects for their size are skipped, so a batch may
+// have none.
+func (b *batchReader) readAhead() error {
+	next, err := b.records()
+	switch {
+	case err == io.EOF:
+		b.next = nil
+	case err != nil:
+		return err
+	default:
+		b.next = next
+	}
+	return nil
+}
+
+// readBatch reads the next batch, and checks it.
+func (b *batchReader) readBatch() error {
+	line, err := b.br.ReadSlice('\n')
+	switch {
+	case err == io.EOF && len(line) == 0:
+		return io.EOF
+	case err == io.EOF:
+		return errors.Wrap(io.ErrUnexpectedEOF, "reading batch header")
+	case err == bufio.ErrBufferFull || len(line) > maxBatchHeaderSize:
+		return batchError{"batch header too long"}
+	case err != nil:
+		return errors.Wrap(err, "reading batch header")
+	}
+	count, size, err := parseBatchHeader(line)
+	if err != nil {
+		return err
+	}
+	if cap(b.buf) < size {
+		b.buf = make([]byte, size)
+	}
+	b.buf = b.buf[:size]
+	if _, err := io.ReadFull(b.br, b.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return errors.Wrap(err, "reading batch")
+	}
+	if n := bytes.Count(b.buf, []byte{'\n'}); n != count || b.buf[size-1] != '\n' {
+		return batchError{fmt.Sprintf("batch of %d records has %d newline-terminated lines in its %d bytes", count, n, size)}
+	}
+	b.records = b.rfac(bytes.NewReader(b.buf))
+	return nil
+}
+
+// parseBatchHeader parses a line of a BatchHeader, with its newline.
+func parseBatchHeader(line []byte) (count, size int, err error) {
+	fields := bytes.Fields(line)
+	if len(fields) != 3 || string(fields[0]) != BatchHeader {
+		return 0, 0, batchError{fmt.Sprintf("want a batch header, have %q", bytes.TrimSpace(line))}
+	}
+	count, err = strconv.Atoi(string(fields[1]))
+	if err != nil || count <= 0 {
+		return 0, 0, batchError{fmt.Sprintf("invalid batch count %q", fields[1])}
+	}
+	size, err = strconv.Atoi(string(fields[2]))
+	if err != nil || size <= 0 {
+		return 0, 0, batchError{fmt.Sprintf("invalid batch size %q", fields[2])}
+	}
+	if size > MaxBatchSize {
+		return 0, 0, batchError{fmt.Sprintf("batch of %d bytes is over the maximum of %d", size, MaxBatchSize)}
+	}
+	return count, size, nil
+}
+
+// batchError is returned by a batchReader for a malformed batch.
+type batchError struct {
+	msg string
+}
+
+func (e batchError) Error() string { return e.msg }
+
+// BatchWriter writes records in batches, for a connection that agreed to
+// FeatureBatch. Records are buffered, and written as a batch once
+// flushRecords are buffered, or flushInterval after the first of them,
+// whichever is sooner, or before the batch would grow past MaxBatchSize.
+// Each write must be of whole records, each ending with a newline. It's safe
+// for concurrent use.
+type BatchWriter struct {
+	mtx           sync.Mutex
+	w             io.Writer
+	flushInterval time.Duration
+	flushRecords  int
+	buf           []byte // the header, and the records of the batch
+	records       int
+	timer         *time.Timer
+	err           error // sticky
+}
+
+// errBatchWriterClosed is what's returned by writes to a closed BatchWriter.
+var errBatchWriterClosed = errors.New("batch writer closed")
+
+// NewBatchWriter returns a BatchWriter to w. With a flushInterval of zero,
+// every write is flushed, as a batch of its own.
+func NewBatchWriter(w io.Writer, flushInterval time.Duration, flushRecords int) *BatchWriter {
+	return &BatchWriter{
+		w:             w,
+		flushInterval: flushInterval,
+		flushRecords:  flushRecords,
+	}
+}
+
+// Write implements io.Writer. It fails once a flush has.
+func (w *BatchWriter) Write(p []byte) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if p[len(p)-1] != '\n' {
+		return 0, errors.New("batched records must end with a newline")
+	}
+	if len(p) > MaxBatchSize {
+		return 0, errors.Errorf("%d bytes of records don't fit in a batch", len(p))
+	}
+	if w.records > 0 && len(w.buf)-maxBatchHeaderSize+len(p) > MaxBatchSize {
+		if err := w.flush(); err != nil {
+			return 0, err
+		}
+	}
+	if w.records == 0 {
+		w.buf = append(w.buf[:0], make([]byte, maxBatchHeaderSize)...) // room for the header
+	}
+	w.buf = append(w.buf, p...)
+	w.records += bytes.Count(p, []byte{'\n'})
+	switch {
+	case w.flushInterval <= 0 || w.records >= w.flushRecords:
+		if err := w.flush(); err != nil {
+			return len(p), err
+		}
+	case w.timer == nil:
+		w.timer = time.AfterFunc(w.flushInterval, func() { w.Flush() })
+	}
+	return len(p), nil
+}
+
+// Flush writes whatever is buffered, as a batch.
+func (w *BatchWriter) Flush() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	return w.flush()
+}
+
+// flush writes the header, right-aligned in the room left for it, and the
+// records, with a single write.
+func (w *BatchWriter) flush() error {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if w.records == 0 {
+		return nil
+	}
+	var header [maxBatchHeaderSize]byte
+	h := strconv.AppendInt(append(append(header[:0], BatchHeader...), ' '), int64(w.records), 10)
+	h = strconv.AppendInt(append(h, ' '), int64(len(w.buf)-maxBatchHeaderSize), 10)
+	h = append(h, '\n')
+	start := maxBatchHeaderSize - len(h)
+	copy(w.buf[start:], h)
+	w.records = 0
+	if _, err := w.w.Write(w.buf[start:]); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// Close flushes whatever is buffered. Further writes fail. It doesn't close
+// the underlying writer.
+func (w *BatchWriter) Close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.err != nil {
+		if w.err == errBatchWriterClosed {
+			return nil
+		}
+		return w.err
+	}
+	err := w.flush()
+	w.err = errBatchWriterClosed
+	return err
+}
@@ -0,0 +1,320 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestBatchReader(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name    string
+		input   string
+		records []string
+		more    []bool // after each record
+		bad     bool   // a batchError
+		err     bool
+	}{
+		{"none", "", nil, nil, false, false},
+		{"batches", "BATCH 2 16\ntopic a\ntopic b\nBATCH 1 8\ntopic c\n", []string{"topic a\n", "topic b\n", "topic c\n"}, []bool{true, false, false}, false, false},
+		{"count mismatch", "BATCH 3 16\ntopic a\ntopic b\nBATCH 1 8\ntopic c\n", nil, nil, true, true},
+		{"no last newline", "BATCH 2 15\ntopic a\ntopic b", nil, nil, true, true},
+		{"not a batch", "topic a\n", nil, nil, true, true},
+		{"invalid count", "BATCH 0 8\ntopic a\n", nil, nil, true, true},
+		{"too big", fmt.Sprintf("BATCH 1 %d\n", MaxBatchSize+1), nil, nil, true, true},
+		{"header too long", "BATCH 1 8" + strings.Repeat(" ", maxBatchHeaderSize) + "\ntopic a\n", nil, nil, true, true},
+		{"after a good batch", "BATCH 1 8\ntopic a\nBATCH 2 8\ntopic b\n", []string{"topic a\n"}, []bool{false}, true, true},
+		{"cut short", "BATCH 2 16\ntopic a\n", nil, nil, false, true},
+		{"header cut short", "BATCH 1 8\ntopic a\nBATCH 1", []string{"topic a\n"}, []bool{false}, false, true},
+	} {
+		var (
+			b       = newBatchReader(strings.NewReader(testcase.input), record.NewDynamicReader)
+			records []string
+			more    []bool
+			err     error
+		)
+		for {
+			var rec []byte
+			if rec, err = b.read(); err != nil {
+				break
+			}
+			records, more = append(records, string(rec)), append(more, b.more())
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		if want, have := testcase.records, records; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want records %q, have %q", testcase.name, want, have)
+		}
+		if want, have := testcase.more, more; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want more %v, have %v", testcase.name, want, have)
+		}
+		if want, have := testcase.err, err != nil; want != have {
+			t.Errorf("%s: want error %v, have %v", testcase.name, want, err)
+		}
+		if _, bad := err.(batchError); testcase.bad != bad {
+			t.Errorf("%s: want batch error %v, have %v", testcase.name, testcase.bad, err)
+		}
+	}
+}
+
+func TestBatchWriter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := NewBatchWriter(&buf, time.Hour, 3)
+	for i := 0; i < 4; i++ {
+		fmt.Fprintf(w, "topic record %d\n", i)
+	}
+	if want, have := "BATCH 3 45\ntopic record 0\ntopic record 1\ntopic record 2\n", buf.String(); want != have {
+		t.Fatalf("want %q, have %q", want, have)
+	}
+	if _, err := io.WriteString(w, "topic unterminated"); err == nil {
+		t.Error("want error writing a partial record, have none")
+	}
+	buf.Reset()
+	io.WriteString(w, "topic record 4\ntopic record 5\n")
+	if want, have := "BATCH 3 45\ntopic record 3\ntopic record 4\ntopic record 5\n", buf.String(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	// What's left is flushed on close.
+	buf.Reset()
+	io.WriteString(w, "topic record 6\n")
+	w.Close()
+	if want, have := "BATCH 1 15\ntopic record 6\n", buf.String(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if _, err := io.WriteString(w, "topic record 7\n"); err == nil {
+		t.Error("want error after close, have none")
+	}
+
+	// A write that would take the batch past the maximum flushes it first.
+	buf.Reset()
+	w = NewBatchWriter(&buf, time.Hour, 1000)
+	big := strings.Repeat("x", MaxBatchSize/2) + "\n" // two are too big
+	io.WriteString(w, big)
+	io.WriteString(w, big)
+	if want, have := fmt.Sprintf("BATCH 1 %d\n%s", len(big), big), buf.String(); want != have {
+		t.Errorf("want one batch of %d bytes, have %d bytes", len(want), len(have))
+	}
+
+	// On a quiet connection, batches are flushed after the interval.
+	var flushed bytes.Buffer
+	done := make(chan struct{})
+	w = NewBatchWriter(notifyingWriter{&flushed, done}, 10*time.Millisecond, 1000)
+	io.WriteString(w, "topic quiet\n")
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch never flushed")
+	}
+	if want, have := "BATCH 1 12\ntopic quiet\n", flushed.String(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+type notifyingWriter struct {
+	w    io.Writer
+	done chan struct{}
+}
+
+func (w notifyingWriter) Write(p []byte) (int, error) {
+	defer close(w.done)
+	return w.w.Write(p)
+}
+
+func TestHandleConnectionsBatch(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		filter  = NewFilter(mustParseFilterRules(t, "drop debug"), prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"rule", "result"}))
+		records = prometheus.NewCounter(prometheus.CounterOpts{})
+		syncs   = prometheus.NewCounter(prometheus.CounterOpts{})
+	)
+	go HandleConnections(ln, ConnectionConfig{
+		Handler:          HandleDurableWriter,
+		ReaderFactory:    record.NewDynamicReader,
+		Log:              log,
+		SegmentFlushAge:  time.Hour,
+		SegmentFlushSize: 1024 * 1024,
+		Filter:           filter,
+		ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+		Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		Records:          records,
+		Syncs:            syncs,
+		SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+	})
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, Hello([]string{FeatureAcks, FeatureBatch})+"\n")
+	s := bufio.NewScanner(conn)
+	if !s.Scan() || s.Text() != Hello([]string{FeatureAcks, FeatureBatch}) {
+		t.Fatalf("unexpected answer to hello: %q (%v)", s.Text(), s.Err())
+	}
+
+	// Three batches of four records; the last of the second is dropped by
+	// the filter, so its sync is held back until it's read.
+	w := NewBatchWriter(conn, time.Hour, 4)
+	for i := 0; i < 12; i++ {
+		level := "info"
+		if i == 7 {
+			level = "debug"
+		}
+		fmt.Fprintf(w, "app %s %d\n", level, i)
+	}
+
+	// Records are acknowledged a batch at a time, once they're synced.
+	for last := 0; last < 12; {
+		if !s.Scan() {
+			t.Fatalf("want ACK 12, have ACK %d (%v)", last, s.Err())
+		}
+		var acked int
+		if _, err := fmt.Sscanf(s.Text(), Ack+" %d", &acked); err != nil {
+			t.Fatalf("%q: %v", s.Text(), err)
+		}
+		if acked%4 != 0 {
+			t.Errorf("ACK %d in the middle of a batch", acked)
+		}
+		if synced := int(counted(syncs)); synced < acked/4 {
+			t.Errorf("ACK %d with %d syncs", acked, synced)
+		}
+		last = acked
+	}
+	if want, have := 11.0, counted(records); want != have {
+		t.Errorf("want %v records written, have %v", want, have)
+	}
+	if want, have := 3.0, counted(syncs); want != have {
+		t.Errorf("want %v syncs, one per batch, have %v", want, have)
+	}
+
+	// A malformed batch closes the connection, with none of its records
+	// written.
+	io.WriteString(conn, "BATCH 3 24\napp info 12\napp info 13\n")
+	if !s.Scan() || !strings.HasPrefix(s.Text(), BadBatch+" ") {
+		t.Fatalf("want %s, have %q (%v)", BadBatch, s.Text(), s.Err())
+	}
+	if rest, err := ioutil.ReadAll(conn); err != nil || len(rest) > 0 {
+		t.Errorf("want the connection closed, have %q (%v)", rest, err)
+	}
+	if want, have := 11.0, counted(records); want != have {
+		t.Errorf("want %v records written, have %v", want, have)
+	}
+}
+
+// BenchmarkBatchedWrites forwards records to an ingester, as a forwarder
+// does, each written by itself, or in batches, and reports the writes each
+// record takes.
+func BenchmarkBatchedWrites(b *testing.B) {
+	lines := logLines(1000)
+	for _, testcase := range []struct {
+		name      string
+		batchSize int
+	}{
+		{"unbatched", 0},
+		{"batch=10", 10},
+		{"batch=100", 100},
+		{"batch=1000", 1000},
+	} {
+		b.Run(testcase.name, func(b *testing.B) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer ln.Close()
+			log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			records := prometheus.NewCounter(prometheus.CounterOpts{})
+			go HandleConnections(ln, ConnectionConfig{
+				Handler:          HandleDurableWriter,
+				ReaderFactory:    record.NewDynamicReader,
+				Log:              log,
+				SegmentFlushAge:  time.Hour,
+				SegmentFlushSize: 64 * 1024 * 1024,
+				ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+				Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+				Records:          records,
+				Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+				SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+				SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			})
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer conn.Close()
+			var (
+				writes uint64
+				cw     = countingConn{conn, &writes}
+				w      io.Writer
+			)
+			if testcase.batchSize > 0 {
+				io.WriteString(conn, Hello([]string{FeatureBatch})+"\n")
+				if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+					b.Fatal(err)
+				}
+				w = NewBatchWriter(cw, time.Hour, testcase.batchSize)
+			} else {
+				w = cw
+			}
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(strings.Join(lines, ""))))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, line := range lines {
+					if _, err := io.WriteString(w, line); err != nil {
+						b.Fatal(err)
+					}
+				}
+				for want := float64((i + 1) * len(lines)); counted(records) < want; {
+					time.Sleep(100 * time.Microsecond)
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadUint64(&writes))/float64(b.N*len(lines)), "writes/record")
+		})
+	}
+}
+
+// countingConn counts the writes to its connection.
+type countingConn struct {
+	net.Conn
+	writes *uint64
+}
+
+func (c countingConn) Write(p []byte) (int, error) {
+	atomic.AddUint64(c.writes, 1)
+	return c.Conn.Write(p)
+}
@@ -0,0 +1,81 @@
+package ingest
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// ClockSkewed starts the line an ingester writes to a client before it
+// closes the connection, because the ingester's clock is too far off the
+// cluster's to give its records IDs. The rest of the line says by how much.
+// Other ingesters may well be fine, so clients should try them.
+const ClockSkewed = "SKEW"
+
+// ClockGuard refuses records while this node's clock is skewed, i.e. further
+// off the rest of the cluster's than a limit. IDs are ordered by time, so
+// the records a skewed node gives IDs to are misordered against everyone
+// else's, which queries can't undo.
+type ClockGuard struct {
+	limit   time.Duration
+	skew    int64 // time.Duration, atomically
+	refused prometheus.Counter
+}
+
+// NewClockGuard returns a ClockGuard that refuses records while the skew
+// is over the limit; see SetSkew. refused counts the records refused.
+func NewClockGuard(limit time.Duration, refused prometheus.Counter) *ClockGuard {
+	return &ClockGuard{
+		limit:   limit,
+		refused: refused,
+	}
+}
+
+// SetSkew sets how far ahead of the cluster's our clock is, e.g. as
+// cluster.Peer.ClockSkew measures it. It's zero until it's set.
+func (g *ClockGuard) SetSkew(skew time.Duration) {
+	atomic.StoreInt64(&g.skew, int64(skew))
+}
+
+// Skewed reports whether the skew is over the limit.
+func (g *ClockGuard) Skewed() bool {
+	skew := time.Duration(atomic.LoadInt64(&g.skew))
+	return skew > g.limit || -skew > g.limit
+}
+
+// Reader wraps the record.Reader for a connection. While the clock is
+// skewed, the reader returns an error instead of the record it read.
+// A nil ClockGuard returns r unchanged.
+func (g *ClockGuard) Reader(r record.Reader) record.Reader {
+	if g == nil {
+		return r
+	}
+	return func() ([]byte, error) {
+		record, err := r()
+		if err != nil {
+			return record, err
+		}
+		if g.Skewed() {
+			g.refused.Inc()
+			return nil, clockError{skew: time.Duration(atomic.LoadInt64(&g.skew)), limit: g.limit}
+		}
+		return record, nil
+	}
+}
+
+// clockError is returned by a ClockGuard reader while the clock is skewed.
+type clockError struct {
+	skew  time.Duration
+	limit time.Duration
+}
+
+func (e clockError) Error() string {
+	if e.skew < 0 {
+		return fmt.Sprintf("ingester's clock is %s behind the cluster's, over the limit of %s", -e.skew, e.limit)
+	}
+	return fmt.Sprintf("ingester's clock is %s ahead of the cluster's, over the limit of %s", e.skew, e.limit)
+}
@@ -0,0 +1,108 @@
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestClockGuardReader(t *testing.T) {
+	t.Parallel()
+
+	var (
+		refused = prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"node"})
+		g       = NewClockGuard(time.Second, refused.WithLabelValues("self"))
+		r       = g.Reader(func() ([]byte, error) { return []byte("topic record\n"), nil })
+	)
+	for _, testcase := range []struct {
+		skew time.Duration
+		want bool // refused
+	}{
+		{0, false},
+		{time.Second, false},
+		{-time.Second, false},
+		{time.Second + 1, true},
+		{-40 * time.Minute, true},
+		{500 * time.Millisecond, false},
+	} {
+		g.SetSkew(testcase.skew)
+		_, err := r()
+		if want, have := testcase.want, err != nil; want != have {
+			t.Errorf("skew %s: want refused %v, have %v (%v)", testcase.skew, want, have, err)
+		}
+		if _, ok := err.(clockError); err != nil && !ok {
+			t.Errorf("skew %s: want clockError, have %T", testcase.skew, err)
+		}
+	}
+	if want, have := 2.0, counterValue(t, refused, "self"); want != have {
+		t.Errorf("want %v refused records, have %v", want, have)
+	}
+
+	// A nil ClockGuard accepts everything.
+	var none *ClockGuard
+	if _, err := none.Reader(r)(); err != nil {
+		t.Errorf("nil ClockGuard: want no error, have %v", err)
+	}
+}
+
+func TestHandleConnectionsClockSkewed(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	filesys := fs.NewVirtualFilesystem()
+	log, err := NewFileLog(filesys, "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewClockGuard(time.Second, prometheus.NewCounter(prometheus.CounterOpts{}))
+	go HandleConnections(ln, ConnectionConfig{
+		Handler:          HandleFastWriter,
+		ReaderFactory:    record.NewDynamicReader,
+		Log:              log,
+		SegmentFlushAge:  time.Hour,
+		SegmentFlushSize: 1024 * 1024,
+		Clock:            g,
+		ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+		Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+		Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+	})
+
+	// While our clock is skewed, clients are told so, and disconnected, at
+	// their first record.
+	g.SetSkew(-40 * time.Minute)
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "topic record\n")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := ClockSkewed+" ingester's clock is 40m0s behind the cluster's, over the limit of 1s\n", line; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if _, err := io.Copy(ioutil.Discard, conn); err != nil {
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			t.Errorf("never disconnected")
+		}
+	}
+}
@@ -10,28 +10,142 @@ import (
 	"sync"
 	"time"
 
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/oklog/oklog/pkg/record"
-	"github.com/oklog/ulid"
 )
 
-// HandleConnections passes each connection from the listener to the connection handler.
-// Terminate the function by closing the listener.
-func HandleConnections(
-	ln net.Listener,
-	h ConnectionHandler,
-	rfac record.ReaderFactory,
-	log Log,
-	segmentFlushAge time.Duration,
-	segmentFlushSize int,
-	connectedClients prometheus.Gauge,
-	bytes, records, syncs prometheus.Counter,
-	segmentAge, segmentSize prometheus.Histogram,
-) error {
+// ConnectionConfig configures HandleConnections. Handler, ReaderFactory, Log,
+// ConnectedClients, and the Writer metrics, Bytes through SegmentSize, are
+// required; the rest may be left zero. See HandleConnections for what each
+// does.
+type ConnectionConfig struct {
+	Handler       ConnectionHandler
+	ReaderFactory record.ReaderFactory
+	Log           Log
+	Logger        log.Logger
+
+	SegmentFlushAge  time.Duration
+	SegmentFlushSize int
+	Sizer            *SegmentSizer
+	CommitLatency    time.Duration
+	CommitBytes      int
+	DrainTimeout     time.Duration
+
+	Limiter     *Limiter
+	Quotas      *Quotas
+	Timestamps  *ClientTimestamps
+	Clock       *ClockGuard
+	IDClock     *IDClock
+	IDs         *MonotonicIDs
+	Filter      *Filter
+	Connections *Connections
+
+	ConnectedClients        prometheus.Gauge
+	Bytes, Records, Syncs   prometheus.Counter
+	SegmentAge, SegmentSize prometheus.Histogram
+
+	WriteLatency, AckLatency           observer // a prometheus.Histogram, or Summary
+	CompressedBytes, UncompressedBytes prometheus.Counter
+}
+
+// HandleConnections passes each connection from the listener to the
+// connection handler, per the config. Terminate the function by closing the
+// listener.
+//
+// With a nonzero DrainTimeout, connections are drained when the listener is
+// closed: each client is sent GoAway, and the connection is half-closed.
+// Records the client has written are still read, and written to the active
+// segment, until it closes its end, or up to DrainTimeout. Then whatever
+// connections remain are closed.
+//
+// With a nonzero CommitLatency, all connections share a single Writer, which
+// group commits syncs from many connections; see NewWriter. That's only useful
+// for handlers that Sync, like HandleDurableWriter. Otherwise, each connection
+// gets its own Writer, and its own active segment.
+//
+// Connections that end with an error are logged to Logger, which may be nil,
+// at debug level, as are the writers' rotations; failed syncs are logged as
+// errors.
+//
+// If Limiter is non-nil, records are read from each connection no faster than
+// it allows; see Limiter.
+//
+// Clients may identify their source with the SourceHandshake. If Quotas is
+// non-nil, each source's connections are held to its quota; a connection
+// whose source is over its daily quota is told so, with QuotaExceeded, and
+// closed.
+//
+// Clients may ask for their records to be acknowledged, with the
+// AckHandshake. Instead, they may negotiate acknowledgements, and framing,
+// with the HelloHandshake. They may ask for this node's Load with it, too,
+// to choose among ingesters; a client that only asks for that, and then
+// hangs up, is no connection of the Load's.
+//
+// Clients that negotiate FeatureBatch write their records in batches, each
+// after a BatchHeader. A malformed batch is rejected whole: the client is
+// told so, with BadBatch, and the connection is closed.
+//
+// If Timestamps is non-nil, records get IDs with the times clients gave
+// them, rather than the times they arrived; see ClientTimestamps. IDs are
+// then no longer in order in the active segment.
+//
+// If Clock is non-nil, a connection whose records arrive while this node's
+// clock is skewed is told so, with ClockSkewed, and closed; see ClockGuard.
+//
+// If IDClock is non-nil, records get the times of their IDs from it, so they
+// don't go back with this node's clock, and a connection whose records arrive
+// while it's too far behind is told so, too; see IDClock.
+//
+// If IDs is non-nil, records get their IDs from it, so that those of each
+// connection are monotonic within a millisecond; see MonotonicIDs.
+//
+// If Filter is non-nil, records it drops are skipped before they're given
+// IDs; see Filter. They're still acknowledged, and still count against their
+// source's quota.
+//
+// If Connections is non-nil, each connection's records, and their bytes, are
+// counted in it, with its source, if it gives one, until it ends; see
+// Connections.
+//
+// If Sizer is non-nil, the writers flush segments at the size it chooses for
+// the ingest rate, rather than at SegmentFlushSize; see SegmentSizer.
+//
+// If WriteLatency is non-nil, it observes how long the handler takes to write
+// each record, from when it's read, to when the next is asked for: with
+// HandleDurableWriter, that includes the sync. If AckLatency is non-nil, it
+// observes how long each acknowledgement takes, from when the first record it
+// acknowledges was read, to when it's written to the client.
+//
+// Clients that negotiate FeatureSnappy write the rest of the connection
+// compressed; it's decompressed before the records are read from it, and a
+// corrupt frame terminates the connection. If CompressedBytes and
+// UncompressedBytes are non-nil, they count the bytes of those connections
+// before and after.
+func HandleConnections(ln net.Listener, cfg ConnectionConfig) error {
+	logger := nopIfNil(cfg.Logger)
+
+	// A shared writer needs a shared clock, too. Its IDs are generated by the
+	// writer, one at a time, so the clock is safe to share.
+	var (
+		shared      *Writer
+		sharedNewID func(ms uint64) string
+	)
+	if cfg.CommitLatency > 0 {
+		w, err := NewWriter(cfg.Log, cfg.SegmentFlushAge, cfg.SegmentFlushSize, cfg.Sizer, cfg.CommitLatency, cfg.CommitBytes, cfg.Bytes, cfg.Records, cfg.Syncs, cfg.SegmentAge, cfg.SegmentSize, logger)
+		if err != nil {
+			return err
+		}
+		defer w.Stop() // after all connections are terminated
+		shared, sharedNewID = w, cfg.IDs.newStream()
+	}
+
 	// We shouldn't return until all connections are terminated.
 	m := newConnectionManager()
-	defer m.shutdown()
+	defer m.drain(cfg.DrainTimeout)
+	load := newLoadMeter()
 
 	for {
 		// Accept a connection.
@@ -40,30 +154,129 @@ func HandleConnections(
 			return err
 		}
 
-		// Create a new writer for this connection.
+		// Create a new writer for this connection, unless it's shared.
 		// It's important that it be closed.
-		w, err := NewWriter(log, segmentFlushAge, segmentFlushSize, bytes, records, syncs, segmentAge, segmentSize)
-		if err != nil {
-			return err
-		}
+		w, newID := shared, sharedNewID
+		if w == nil {
+			w, err = NewWriter(cfg.Log, cfg.SegmentFlushAge, cfg.SegmentFlushSize, cfg.Sizer, 0, 0, cfg.Bytes, cfg.Records, cfg.Syncs, cfg.SegmentAge, cfg.SegmentSize, logger)
+			if err != nil {
+				return err
+			}
 
-		// Create a new logical clock for the stream and ID generator for this connection.
-		clock := newStreamClock()
-		idGen := func() string { return ulid.MustNew(ulid.Now(), clock).String() }
+			// Create a new stream of IDs for this connection.
+			newID = cfg.IDs.newStream()
+		}
 
 		// Register the connection in the manager, and launch the handler.
 		// The handler may exit from the client, or via manager shutdown.
 		// In either case, the writer is closed.
 		m.register(conn)
+		stats := cfg.Connections.register(conn)
 		go func() {
 			defer conn.Close()
-			h(rfac(conn), w, idGen, connectedClients)
-			w.Stop() // make sure it's flushed
+			agreed, hello, r, err := readHello(conn, load)
+			if err == nil {
+				r = load.reader(r)
+			}
+			if err == nil && agreed.snappy {
+				r = newSnappyReader(r, cfg.CompressedBytes, cfg.UncompressedBytes)
+			}
+			var source string
+			if err == nil {
+				source, r, err = readSource(r)
+				cfg.Connections.identify(stats, source)
+			}
+			acks := agreed.acks
+			if err == nil && !hello {
+				acks, r, err = readAcks(r)
+			}
+			if err == nil {
+				defer load.connected()()
+				// A batched connection's records are read a batch at a
+				// time, and it gets a Writer of its own, to sync them so.
+				var (
+					rr record.Reader
+					cw = w
+				)
+				if agreed.batch {
+					batch := newBatchReader(r, cfg.ReaderFactory)
+					rr, cw = batch.read, &Writer{writer: w.writer, batch: batch}
+				} else {
+					rr = cfg.ReaderFactory(agreed.reader(r))
+				}
+				rr = stats.reader(rr)
+
+				// A handler generates the ID of a record after it's read,
+				// and before the next, so its time is that of the last.
+				rr, ms := cfg.Timestamps.Reader(cfg.Quotas.Reader(source, cfg.Clock.Reader(cfg.IDClock.Reader(cfg.Limiter.Reader(rr)))))
+				if cfg.Timestamps == nil {
+					ms = cfg.IDClock.Now
+				}
+				idGen := func() string { return newID(ms()) }
+				var a *acker
+				if acks {
+					a = newAcker(conn, cfg.AckLatency)
+					rr = a.reader(rr, cw) // under the filter, so dropped records are acknowledged
+				}
+				rr = timeWrites(cfg.Filter.Reader(rr), cfg.WriteLatency)
+				err = cfg.Handler(rr, cw, idGen, cfg.ConnectedClients)
+				if err == nil {
+					err = cw.release() // of a batch whose last record was dropped
+				}
+				if a != nil {
+					a.close() // before any QuotaExceeded, ClockSkewed, or BadBatch
+				}
+				switch err := err.(type) {
+				case quotaError:
+					conn.SetWriteDeadline(time.Now().Add(time.Second))
+					fmt.Fprintln(conn, QuotaExceeded, err.Error())
+				case clockError, regressionError:
+					conn.SetWriteDeadline(time.Now().Add(time.Second))
+					fmt.Fprintln(conn, ClockSkewed, err.Error())
+				case batchError:
+					conn.SetWriteDeadline(time.Now().Add(time.Second))
+					fmt.Fprintln(conn, BadBatch, err.Error())
+				}
+			}
+			if err != nil {
+				level.Debug(logger).Log("conn", conn.RemoteAddr(), "source", source, "err", err)
+			}
+			if w != shared {
+				w.Stop() // make sure it's flushed
+			}
+			cfg.Connections.remove(stats)
 			m.remove(conn)
 		}()
 	}
 }
 
+// observer is a prometheus.Histogram, or Summary, as far as latencies are
+// concerned.
+type observer interface {
+	Observe(float64)
+}
+
+// timeWrites returns r, observing the time from each record it returns to
+// the next read, which the handler makes once it's written the record. If
+// latency is nil, it returns r.
+func timeWrites(r record.Reader, latency observer) record.Reader {
+	if latency == nil {
+		return r
+	}
+	var read time.Time
+	return func() ([]byte, error) {
+		if !read.IsZero() {
+			latency.Observe(time.Since(read).Seconds())
+		}
+		record, err := r()
+		read = time.Time{}
+		if err == nil {
+			read = time.Now()
+		}
+		return record, err
+	}
+}
+
 // ConnectionHandler forwards records from the net.Conn to the IngestLog.
 type ConnectionHandler func(r record.Reader, w *Writer, idGen IDGenerator, connectedClients prometheus.Gauge) error
 
@@ -88,7 +301,9 @@ func HandleFastWriter(r record.Reader, w *Writer, idGen IDGenerator, connectedCl
 }
 
 // HandleDurableWriter is a ConnectionHandler that writes records to the
-// IngestLog and syncs after each record.
+// IngestLog and syncs after each record. The next record isn't read from the
+// connection until the sync completes. With a shared Writer, syncs are group
+// committed.
 func HandleDurableWriter(r record.Reader, w *Writer, idGen IDGenerator, connectedClients prometheus.Gauge) (err error) {
 	connectedClients.Inc()
 	defer connectedClients.Dec()
@@ -101,8 +316,7 @@ func HandleDurableWriter(r record.Reader, w *Writer, idGen IDGenerator, connecte
 		if err != nil {
 			return err
 		}
-		// TODO(pb): short writes are possible
-		if _, err := fmt.Fprintf(w, "%s %s", idGen(), record); err != nil {
+		if err := w.WriteRecord(idGen, record); err != nil {
 			return err
 		}
 		if err := w.Sync(); err != nil {
@@ -117,6 +331,12 @@ func HandleBulkWriter(r record.Reader, w *Writer, idGen IDGenerator, connectedCl
 	return errors.New("TODO(pb): not implemented")
 }
 
+// GoAway is the line an ingester writes to its clients when it's shutting
+// down. Ingesters otherwise never write to clients. A client should stop
+// writing, close the connection, and carry on with another ingester. Records
+// it wrote before it closed the connection are still ingested.
+const GoAway = "GOAWAY"
+
 // IDGenerator should return unique record identifiers, i.e. ULIDs.
 type IDGenerator func() string
 
@@ -154,6 +374,40 @@ func (m *connectionManager) shutdown() {
 	}
 }
 
+// drain tells every client to go away, and waits up to timeout for them to
+// close their connections, before shutting down. With a timeout of zero,
+// connections are shut down right away.
+func (m *connectionManager) drain(timeout time.Duration) {
+	if timeout > 0 {
+		m.goAway(timeout)
+		deadline := time.Now().Add(timeout)
+		ticker := time.NewTicker(10 * time.Millisecond)
+		for range ticker.C {
+			if m.isEmpty() || time.Now().After(deadline) {
+				break
+			}
+		}
+		ticker.Stop()
+	}
+	m.shutdown()
+}
+
+// goAway writes GoAway to every connection, and half-closes it, if it can
+// be, so clients that don't know GoAway see EOF, and reconnect elsewhere.
+func (m *connectionManager) goAway(timeout time.Duration) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	for _, conn := range m.active {
+		conn.SetWriteDeadline(time.Now().Add(timeout))
+		fmt.Fprintln(conn, GoAway)
+		if cw, ok := conn.(interface {
+			CloseWrite() error
+		}); ok {
+			cw.CloseWrite()
+		}
+	}
+}
+
 func (m *connectionManager) closeAllConnections() {
 	m.mtx.RLock()
 	defer m.mtx.RUnlock()
@@ -1,6 +1,7 @@
 package ingest
 
 import (
+	"bufio"
 	"bytes"
 	cryptorand "crypto/rand"
 	"encoding/binary"
@@ -17,6 +18,7 @@ import (
 	"github.com/oklog/ulid"
 
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 
 	"github.com/oklog/oklog/pkg/fs"
 	"github.com/oklog/oklog/pkg/record"
@@ -32,7 +34,7 @@ func TestHandleConnectionsCleanup(t *testing.T) {
 	// Set up a file log using our mock FS.
 	// The mock FS counts file closures.
 	fs := &mockFilesystem{}
-	log, err := NewFileLog(fs, "/")
+	log, err := NewFileLog(fs, "/", "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -52,10 +54,19 @@ func TestHandleConnectionsCleanup(t *testing.T) {
 		segmentSize       = prometheus.NewHistogram(prometheus.HistogramOpts{})
 	)
 	go func() {
-		errc <- HandleConnections(
-			ln, connectionHandler, record.NewDynamicReader, log, segmentFlushAge, segmentFlushSize,
-			connectedClients, bytes, records, syncs, segmentAge, segmentSize,
-		)
+		errc <- HandleConnections(ln, ConnectionConfig{
+			Handler:          connectionHandler,
+			ReaderFactory:    record.NewDynamicReader,
+			Log:              log,
+			SegmentFlushAge:  segmentFlushAge,
+			SegmentFlushSize: segmentFlushSize,
+			ConnectedClients: connectedClients,
+			Bytes:            bytes,
+			Records:          records,
+			Syncs:            syncs,
+			SegmentAge:       segmentAge,
+			SegmentSize:      segmentSize,
+		})
 	}()
 
 	// Connect to the handler.
@@ -109,6 +120,102 @@ func TestHandleConnectionsCleanup(t *testing.T) {
 	}
 }
 
+func TestHandleConnectionsDrain(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const drainTimeout = time.Second
+	var (
+		records  = prometheus.NewCounter(prometheus.CounterOpts{})
+		ingested = func() float64 {
+			var m dto.Metric
+			records.Write(&m)
+			return m.GetCounter().GetValue()
+		}
+		errc = make(chan error, 1)
+	)
+	go func() {
+		errc <- HandleConnections(ln, ConnectionConfig{
+			Handler:          HandleFastWriter,
+			ReaderFactory:    record.NewDynamicReader,
+			Log:              log,
+			SegmentFlushAge:  time.Hour,
+			SegmentFlushSize: 1024 * 1024,
+			DrainTimeout:     drainTimeout,
+			ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+			Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+			Records:          records,
+			Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+			SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		})
+	}()
+
+	// One client plays along; the other ignores us.
+	polite, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rude, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rude.Close()
+	fmt.Fprint(polite, "topic before\n")
+	fmt.Fprint(rude, "topic rude\n")
+	if !within(time.Second, func() bool { return ingested() == 2 }) {
+		t.Fatal("timeout waiting for writes")
+	}
+
+	// Once the listener is closed, clients are told to go away, and see
+	// EOF after that. What the polite client writes after hearing it is
+	// still ingested.
+	begin := time.Now()
+	ln.Close()
+	s := bufio.NewScanner(polite)
+	if !s.Scan() {
+		t.Fatalf("want %s, have %v", GoAway, s.Err())
+	}
+	if want, have := GoAway, s.Text(); want != have {
+		t.Fatalf("want %q, have %q", want, have)
+	}
+	if s.Scan() {
+		t.Fatalf("want EOF, have %q", s.Text())
+	}
+	fmt.Fprint(polite, "topic in-flight\n")
+	polite.Close()
+
+	// The rude client is cut off after the drain timeout.
+	select {
+	case <-errc:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for shutdown")
+	}
+	if took := time.Since(begin); took < drainTimeout {
+		t.Errorf("shut down after %s, before the drain timeout of %s", took, drainTimeout)
+	}
+	if want, have := 3.0, ingested(); want != have {
+		t.Errorf("records: want %v, have %v", want, have)
+	}
+	stats, err := log.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := int64(0), stats.ActiveSegments; want != have {
+		t.Errorf("active segments: want %d, have %d", want, have)
+	}
+	if want, have := int64(2), stats.FlushedSegments; want != have {
+		t.Errorf("flushed segments: want %d, have %d", want, have)
+	}
+}
+
 func echo(t *testing.T) ConnectionHandler {
 	return func(read record.Reader, w *Writer, _ IDGenerator, _ prometheus.Gauge) error {
 		for {
@@ -146,15 +253,18 @@ func (fs *mockFilesystem) MkdirAll(path string) error                        { r
 func (fs *mockFilesystem) Chtimes(path string, atime, mtime time.Time) error { return nil }
 func (fs *mockFilesystem) Walk(root string, walkFn filepath.WalkFunc) error  { return nil }
 func (fs *mockFilesystem) Lock(string) (fs.Releaser, bool, error)            { return mockReleaser{}, false, nil }
+func (*mockFilesystem) Statfs(string) (fs.Usage, error)                      { return fs.Usage{}, nil }
 
 type mockFile struct{ wr, cl *uint64 }
 
-func (f *mockFile) Read(p []byte) (int, error)  { return len(p), nil }
-func (f *mockFile) Write(p []byte) (int, error) { atomic.AddUint64(f.wr, 1); return len(p), nil }
-func (f *mockFile) Close() error                { atomic.AddUint64(f.cl, 1); return nil }
-func (f *mockFile) Name() string                { return "" }
-func (f *mockFile) Size() int64                 { return 0 }
-func (f *mockFile) Sync() error                 { return nil }
+func (f *mockFile) Read(p []byte) (int, error)   { return len(p), nil }
+func (f *mockFile) Write(p []byte) (int, error)  { atomic.AddUint64(f.wr, 1); return len(p), nil }
+func (f *mockFile) Close() error                 { atomic.AddUint64(f.cl, 1); return nil }
+func (f *mockFile) Name() string                 { return "" }
+func (f *mockFile) Size() int64                  { return 0 }
+func (f *mockFile) Sync() error                  { return nil }
+func (f *mockFile) SyncRange(off, n int64) error { return nil }
+func (f *mockFile) DropCache() error             { return nil }
 
 type mockReleaser struct{}
 
@@ -221,3 +331,129 @@ func BenchmarkStreamClockULID(b *testing.B) {
 		})
 	}
 }
+
+func TestHandleConnectionsLatency(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		reg          = prometheus.NewRegistry()
+		buckets      = []float64{.001, .025, .05, 10}
+		writeLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "write", Help: "Write latency.", Buckets: buckets}, []string{"mode"})
+		ackLatency   = prometheus.NewHistogram(prometheus.HistogramOpts{Name: "ack", Help: "Ack latency.", Buckets: buckets})
+	)
+	reg.MustRegister(writeLatency, ackLatency)
+
+	// A handler that takes at least 30ms to write each record.
+	slow := func(r record.Reader, w *Writer, idGen IDGenerator, connectedClients prometheus.Gauge) error {
+		return HandleFastWriter(func() ([]byte, error) {
+			record, err := r()
+			if err == nil {
+				time.Sleep(30 * time.Millisecond)
+			}
+			return record, err
+		}, w, idGen, connectedClients)
+	}
+	go HandleConnections(ln, ConnectionConfig{
+		Handler:          slow,
+		ReaderFactory:    record.NewDynamicReader,
+		Log:              log,
+		SegmentFlushAge:  time.Hour,
+		SegmentFlushSize: 1024 * 1024,
+		ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+		Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+		Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		WriteLatency:     writeLatency.WithLabelValues("slow"),
+		AckLatency:       ackLatency,
+	})
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintln(conn, AckHandshake)
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(conn, "topic record %d\n", i)
+	}
+	conn.(*net.TCPConn).CloseWrite()
+
+	// The connection is closed once the handler is done, and every record
+	// it wrote observed.
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var last string
+	for s := bufio.NewScanner(conn); s.Scan(); {
+		last = s.Text()
+	}
+	if want, have := Ack+" 3", last; want != have {
+		t.Fatalf("want %q, have %q", want, have)
+	}
+
+	write := gatherHistogram(t, reg, "write", "slow")
+	if want, have := uint64(3), write.GetSampleCount(); want != have {
+		t.Errorf("writes: want %d observations, have %d", want, have)
+	}
+	if want, have := uint64(0), bucketCount(write, .025); want != have {
+		t.Errorf("writes: want %d observations under 25ms, have %d", want, have)
+	}
+	if want, have := uint64(3), bucketCount(write, 10); want != have {
+		t.Errorf("writes: want %d observations under 10s, have %d", want, have)
+	}
+
+	// Acknowledgements are coalesced, so there's at least one, and each is
+	// written after the record before it.
+	ack := gatherHistogram(t, reg, "ack", "")
+	if ack.GetSampleCount() < 1 {
+		t.Errorf("acks: want observations, have none")
+	}
+	if want, have := uint64(0), bucketCount(ack, .025); want != have {
+		t.Errorf("acks: want %d observations under 25ms, have %d", want, have)
+	}
+	if want, have := ack.GetSampleCount(), bucketCount(ack, 10); want != have {
+		t.Errorf("acks: want %d observations under 10s, have %d", want, have)
+	}
+}
+
+// gatherHistogram returns the histogram name from g, with the label value,
+// if it has a label.
+func gatherHistogram(t *testing.T, g prometheus.Gatherer, name, label string) *dto.Histogram {
+	t.Helper()
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if len(m.GetLabel()) == 0 && label == "" || len(m.GetLabel()) > 0 && m.GetLabel()[0].GetValue() == label {
+				return m.GetHistogram()
+			}
+		}
+	}
+	t.Fatalf("no histogram %s{%s}", name, label)
+	return nil
+}
+
+// bucketCount returns the cumulative count of the bucket of h with the upper
+// bound le.
+func bucketCount(h *dto.Histogram, le float64) uint64 {
+	for _, b := range h.GetBucket() {
+		if b.GetUpperBound() == le {
+			return b.GetCumulativeCount()
+		}
+	}
+	return 0
+}
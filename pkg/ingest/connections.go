@@ -0,0 +1,272 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// connectionSampleInterval is how often Connections samples the counts of
+// each connection, for its rate.
+const connectionSampleInterval = time.Second
+
+// ConnectionStats are the stats of a connection to the ingester, as of when
+// they're read. Source is empty if the client didn't identify its source. The
+// rates are over the window of the Connections, or since the connection was
+// made, if that's sooner.
+type ConnectionStats struct {
+	ID          string    `json:"id"`
+	RemoteAddr  string    `json:"remote_addr"`
+	LocalAddr   string    `json:"local_addr"` // i.e. which of the ingester's listeners
+	Source      string    `json:"source,omitempty"`
+	Connected   time.Time `json:"connected"`
+	Records     int64     `json:"records"`
+	Bytes       int64     `json:"bytes"`
+	RecordsRate float64   `json:"records_per_second"`
+	BytesRate   float64   `json:"bytes_per_second"`
+}
+
+// Connections tracks the stats of each connection to the ingester, so a spike
+// in ingest can be put down to the producer responsible, and serves them on
+// the connections endpoint. It should be mounted at APIPathConnections, and
+// at APIPathConnections plus a slash, for DELETE of a connection's ID, which
+// closes the connection, e.g. of a producer that won't be quiet.
+//
+// Counting a record is a couple of atomic adds, to counters of its own
+// connection. Every connectionSampleInterval, while it Runs, Connections
+// samples the counters, and the rates are those of the samples over the
+// window, worked out when the stats are read.
+type Connections struct {
+	window time.Duration
+	logger log.Logger
+	now    func() time.Time
+	stop   chan chan struct{}
+
+	mtx   sync.Mutex
+	next  uint64
+	conns map[string]*connStats // by ID
+}
+
+// connStats is the stats of a connection, and the connection, to close. The
+// records and bytes are updated atomically, and the rest of the fields are
+// guarded by the Connections' mutex, but for those that don't change.
+type connStats struct {
+	records int64 // first, so they're 64-bit aligned
+	bytes   int64
+
+	id        string
+	conn      net.Conn
+	connected time.Time
+	source    string
+	samples   []connSample // oldest first
+}
+
+type connSample struct {
+	t       time.Time
+	records int64
+	bytes   int64
+}
+
+// NewConnections returns a Connections that rates connections over window.
+// Connections it closes are logged to logger, which may be nil.
+func NewConnections(window time.Duration, logger log.Logger) *Connections {
+	return &Connections{
+		window: window,
+		logger: nopIfNil(logger),
+		now:    time.Now,
+		stop:   make(chan chan struct{}),
+		conns:  map[string]*connStats{},
+	}
+}
+
+// Run samples the connections every connectionSampleInterval, until Stop.
+func (c *Connections) Run() {
+	ticker := time.NewTicker(connectionSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.sample()
+		case q := <-c.stop:
+			close(q)
+			return
+		}
+	}
+}
+
+// Stop the Connections from sampling.
+func (c *Connections) Stop() {
+	q := make(chan struct{})
+	c.stop <- q
+	<-q
+}
+
+// register the connection, and return its stats, which are tracked until it's
+// removed. A nil Connections tracks nothing, and returns nil stats.
+func (c *Connections) register(conn net.Conn) *connStats {
+	if c == nil {
+		return nil
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.next++
+	now := c.now()
+	s := &connStats{
+		id:        strconv.FormatUint(c.next, 10),
+		conn:      conn,
+		connected: now,
+		samples:   []connSample{{t: now}},
+	}
+	c.conns[s.id] = s
+	return s
+}
+
+// remove the connection of the stats, once it's ended.
+func (c *Connections) remove(s *connStats) {
+	if c == nil || s == nil {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.conns, s.id)
+}
+
+// identify the source of the connection of the stats, if it's told us.
+func (c *Connections) identify(s *connStats, source string) {
+	if c == nil || s == nil {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	s.source = source
+}
+
+// sample the counts of every connection, dropping the samples that have
+// fallen out of the window, but for the latest of them, from which the rate
+// over the whole window is worked out.
+func (c *Connections) sample() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	now := c.now()
+	for _, s := range c.conns {
+		s.samples = append(s.samples, connSample{
+			t:       now,
+			records: atomic.LoadInt64(&s.records),
+			bytes:   atomic.LoadInt64(&s.bytes),
+		})
+		var n int
+		for n+1 < len(s.samples) && !s.samples[n+1].t.After(now.Add(-c.window)) {
+			n++
+		}
+		s.samples = s.samples[n:]
+	}
+}
+
+// Stats returns the stats of the current connections, busiest first: by the
+// rate of their bytes, and then of their records.
+func (c *Connections) Stats() []ConnectionStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	now := c.now()
+	stats := make([]ConnectionStats, 0, len(c.conns))
+	for _, s := range c.conns {
+		cs := ConnectionStats{
+			ID:         s.id,
+			RemoteAddr: s.conn.RemoteAddr().String(),
+			LocalAddr:  s.conn.LocalAddr().String(),
+			Source:     s.source,
+			Connected:  s.connected.UTC(),
+			Records:    atomic.LoadInt64(&s.records),
+			Bytes:      atomic.LoadInt64(&s.bytes),
+		}
+		if oldest := s.samples[0]; now.After(oldest.t) {
+			seconds := now.Sub(oldest.t).Seconds()
+			cs.RecordsRate = float64(cs.Records-oldest.records) / seconds
+			cs.BytesRate = float64(cs.Bytes-oldest.bytes) / seconds
+		}
+		stats = append(stats, cs)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].BytesRate != stats[j].BytesRate {
+			return stats[i].BytesRate > stats[j].BytesRate
+		}
+		if stats[i].RecordsRate != stats[j].RecordsRate {
+			return stats[i].RecordsRate > stats[j].RecordsRate
+		}
+		return stats[i].Connected.Before(stats[j].Connected)
+	})
+	return stats
+}
+
+// Close the connection of the ID. The connection's handler sees it closed,
+// and ends, as if the client had gone away, and the client reconnects, as it
+// would then, too. It returns false if there's no connection of the ID.
+func (c *Connections) Close(id string) bool {
+	c.mtx.Lock()
+	s, ok := c.conns[id]
+	var source string
+	if ok {
+		source = s.source
+	}
+	c.mtx.Unlock()
+	if !ok {
+		return false
+	}
+	level.Info(c.logger).Log("conn", s.conn.RemoteAddr(), "source", source, "id", id, "closed", "by request")
+	s.conn.Close()
+	return true
+}
+
+// ServeHTTP serves GET of the stats of the connections, as JSON, and DELETE of
+// a connection, by its ID, after a slash, which closes it.
+func (c *Connections) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, APIPathConnections), "/"); {
+	case r.Method == "GET" && id == "":
+		buf, err := json.MarshalIndent(c.Stats(), "", "    ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(buf)
+
+	case r.Method == "DELETE" && id != "":
+		if !c.Close(id) {
+			http.Error(w, fmt.Sprintf("no connection %s", id), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(map[string]string{"closed": id})
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// reader returns r, counting the records it reads, and their bytes, to the
+// stats. With nil stats, it returns r.
+func (s *connStats) reader(r record.Reader) record.Reader {
+	if s == nil {
+		return r
+	}
+	return func() ([]byte, error) {
+		b, err := r()
+		if err == nil {
+			atomic.AddInt64(&s.records, 1)
+			atomic.AddInt64(&s.bytes, int64(len(b)))
+		}
+		return b, err
+	}
+}
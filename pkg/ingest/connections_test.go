@@ -0,0 +1,242 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestConnections(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := NewConnections(time.Minute, nil)
+	go HandleConnections(ln, ConnectionConfig{
+		Handler:          HandleFastWriter,
+		ReaderFactory:    record.NewDynamicReader,
+		Log:              log,
+		SegmentFlushAge:  time.Hour,
+		SegmentFlushSize: 1024 * 1024,
+		Connections:      conns,
+		ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+		Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+		Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+	})
+	server := httptest.NewServer(http.StripPrefix("/ingest", conns))
+	defer server.Close()
+	get := func() (stats []ConnectionStats) {
+		resp, err := http.Get(server.URL + "/ingest" + APIPathConnections)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+			t.Fatal(err)
+		}
+		return stats
+	}
+
+	// The noisy client says who it is, and writes more than the quiet one.
+	noisy, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer noisy.Close()
+	quiet, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer quiet.Close()
+	fmt.Fprintf(noisy, "%s noisy\n", SourceHandshake)
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(noisy, "topic noisy %d\n", i) // 14 bytes
+	}
+	fmt.Fprintf(quiet, "topic quiet 0\n")
+	if !within(time.Second, func() bool {
+		stats := get()
+		return len(stats) == 2 && stats[0].Records == 10 && stats[1].Records == 1
+	}) {
+		t.Fatalf("want 10 records of one connection, and 1 of the other, have %+v", get())
+	}
+
+	// The busiest is first.
+	stats := get()
+	if want, have := "noisy", stats[0].Source; want != have {
+		t.Errorf("busiest: want source %q, have %q", want, have)
+	}
+	if want, have := int64(140), stats[0].Bytes; want != have {
+		t.Errorf("busiest: want %d bytes, have %d", want, have)
+	}
+	if stats[0].BytesRate <= stats[1].BytesRate {
+		t.Errorf("want the busiest first, have %+v", stats)
+	}
+	if want, have := noisy.LocalAddr().String(), stats[0].RemoteAddr; want != have {
+		t.Errorf("busiest: want remote address %s, have %s", want, have)
+	}
+	if want, have := "", stats[1].Source; want != have {
+		t.Errorf("quiet: want source %q, have %q", want, have)
+	}
+
+	// Closing the noisy client's connection disconnects it, and drops it
+	// from the stats. Closing it again, or another, is not found.
+	req, _ := http.NewRequest("DELETE", server.URL+"/ingest"+APIPathConnections+"/"+stats[0].ID, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Fatalf("DELETE: want %d, have %d", want, have)
+	}
+	noisy.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.Copy(ioutil.Discard, noisy); err != nil {
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			t.Errorf("noisy: never disconnected")
+		}
+	}
+	if !within(time.Second, func() bool { return len(get()) == 1 }) {
+		t.Fatalf("want 1 connection, have %+v", get())
+	}
+	for _, id := range []string{stats[0].ID, "nonexistent"} {
+		req, _ := http.NewRequest("DELETE", server.URL+"/ingest"+APIPathConnections+"/"+id, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want, have := http.StatusNotFound, resp.StatusCode; want != have {
+			t.Errorf("DELETE %s: want %d, have %d", id, want, have)
+		}
+	}
+
+	// The quiet client carries on, and is dropped once it hangs up.
+	fmt.Fprintf(quiet, "topic quiet 1\n")
+	if !within(time.Second, func() bool { stats := get(); return len(stats) == 1 && stats[0].Records == 2 }) {
+		t.Fatalf("quiet: want 2 records, have %+v", get())
+	}
+	quiet.Close()
+	if !within(time.Second, func() bool { return len(get()) == 0 }) {
+		t.Fatalf("want no connections, have %+v", get())
+	}
+}
+
+func TestConnectionsRate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		conns = NewConnections(10*time.Second, nil)
+		now   = time.Unix(1500000000, 0)
+	)
+	conns.now = func() time.Time { return now }
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	s := conns.register(server)
+	r := s.reader(func() ([]byte, error) { return []byte("topic record\n"), nil }) // 13 bytes
+
+	// Rates are since the connection was made, until it's been a window,
+	// and then over the window.
+	read := func(n int) {
+		for i := 0; i < n; i++ {
+			r()
+		}
+	}
+	for _, testcase := range []struct {
+		records int
+		rate    float64 // of records, per second
+	}{
+		{100, 100}, // 100 in 1s
+		{100, 100}, // 200 in 2s
+		{400, 200}, // 600 in 3s
+	} {
+		read(testcase.records)
+		now = now.Add(time.Second)
+		conns.sample()
+		if want, have := testcase.rate, conns.Stats()[0].RecordsRate; want != have {
+			t.Errorf("want %v records per second, have %v", want, have)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		read(10)
+		now = now.Add(time.Second)
+		conns.sample()
+	}
+	stats := conns.Stats()
+	if want, have := 10., stats[0].RecordsRate; want != have {
+		t.Errorf("after the window: want %v records per second, have %v", want, have)
+	}
+	if want, have := 130., stats[0].BytesRate; want != have {
+		t.Errorf("after the window: want %v bytes per second, have %v", want, have)
+	}
+	if want, have := int64(700), stats[0].Records; want != have {
+		t.Errorf("want %d records, have %d", want, have)
+	}
+	if n := len(s.samples); n > 12 {
+		t.Errorf("want samples of at most the window, have %d", n)
+	}
+
+	// A nil Connections tracks nothing.
+	var nilConns *Connections
+	s = nilConns.register(server)
+	nilConns.identify(s, "source")
+	if _, err := s.reader(func() ([]byte, error) { return nil, nil })(); err != nil {
+		t.Errorf("nil stats: want no error, have %v", err)
+	}
+	nilConns.remove(s)
+}
+
+func BenchmarkConnections(b *testing.B) {
+	record := []byte("app 2017-01-02T03:04:05Z level=info msg=\"request served\" path=/api/v1/users status=200\n")
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	for _, testcase := range []struct {
+		name  string
+		conns *Connections
+	}{
+		{"nil", nil},
+		{"tracked", NewConnections(time.Minute, nil)},
+	} {
+		b.Run(testcase.name, func(b *testing.B) {
+			r := testcase.conns.register(server).reader(func() ([]byte, error) { return record, nil })
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r()
+			}
+		})
+	}
+	b.Run("parallel", func(b *testing.B) {
+		conns := NewConnections(time.Minute, nil)
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			// A connection each, as each is read by its own handler.
+			r := conns.register(server).reader(func() ([]byte, error) { return record, nil })
+			for pb.Next() {
+				r()
+			}
+		})
+	})
+}
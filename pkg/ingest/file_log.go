@@ -1,28 +1,50 @@
 package ingest
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
 	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 
 	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ulidutil"
 )
 
 const (
-	extActive  = ".active"
-	extFlushed = ".flushed"
-	extPending = ".pending"
+	extActive   = ".active"
+	extFlushed  = ".flushed"
+	extPending  = ".pending"
+	extTrimming = ".trimming" // an active segment, without its torn tail
+
+	// extLabels is the extension of the file stored alongside each segment,
+	// once it's sealed, with the labels of this node at the time. It shares
+	// its basename with the segment, regardless of the segment's state.
+	extLabels = ".labels"
 
 	lockFile = "LOCK"
 )
 
 // NewFileLog returns a Log implemented via the filesystem.
 // All filesystem ops will be rooted at path root.
-func NewFileLog(filesys fs.Filesystem, root string) (Log, error) {
+// Segments are stamped with labels, encoded by cluster.Labels, when they're
+// closed; they may be empty.
+// Active segments left behind by a crash are recovered, and what's salvaged
+// from them, and discarded, is logged to logger, which may be nil.
+func NewFileLog(filesys fs.Filesystem, root string, labels string, logger log.Logger) (Log, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
 	if err := filesys.MkdirAll(root); err != nil {
 		return nil, errors.Wrapf(err, "creating path %s", root)
 	}
@@ -36,12 +58,13 @@ func NewFileLog(filesys fs.Filesystem, root string) (Log, error) {
 		// So this is like Prometheus "crash recovery" mode.
 		// But we don't have anything special we need to do.
 	}
-	if err := recoverSegments(filesys, root); err != nil {
+	if err := recoverSegments(filesys, root, labels, logger); err != nil {
 		return nil, errors.Wrap(err, "during recovery")
 	}
 	return &fileLog{
 		root:     root,
 		filesys:  filesys,
+		labels:   labels,
 		releaser: r,
 	}, nil
 }
@@ -49,6 +72,7 @@ func NewFileLog(filesys fs.Filesystem, root string) (Log, error) {
 type fileLog struct {
 	root     string
 	filesys  fs.Filesystem
+	labels   string
 	releaser fs.Releaser
 }
 
@@ -61,11 +85,18 @@ func (log *fileLog) Create() (WriteSegment, error) {
 		return nil, err
 	}
 
-	return fileWriteSegment{log.filesys, f}, nil
+	return fileWriteSegment{log.filesys, f, log.labels}, nil
 }
 
 // Oldest returns the oldest flushed segment.
 func (log *fileLog) Oldest() (ReadSegment, error) {
+	return log.OldestWhere(func(string, time.Time) bool { return true })
+}
+
+// OldestWhere returns the oldest flushed segment that accept accepts. The ID
+// of a segment is its basename, which it keeps, whatever its state; it was
+// flushed when its file was last modified, which failing it doesn't change.
+func (log *fileLog) OldestWhere(accept func(id string, flushed time.Time) bool) (ReadSegment, error) {
 	var (
 		oldest = time.Now()
 		chosen string
@@ -80,7 +111,7 @@ func (log *fileLog) Oldest() (ReadSegment, error) {
 		if filepath.Ext(path) != extFlushed {
 			return nil // skip
 		}
-		if t := info.ModTime(); t.Before(oldest) {
+		if t := info.ModTime(); t.Before(oldest) && accept(segmentID(path), t) {
 			chosen, oldest = path, t
 		}
 		return nil
@@ -104,7 +135,13 @@ func (log *fileLog) Oldest() (ReadSegment, error) {
 		return nil, err
 	}
 
-	return fileReadSegment{log.filesys, f}, nil
+	return fileReadSegment{log.filesys, f, readLabels(log.filesys, newname)}, nil
+}
+
+// segmentID returns the ID of the segment at path.
+func segmentID(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
 }
 
 func (log *fileLog) Stats() (LogStats, error) {
@@ -120,24 +157,60 @@ func (log *fileLog) Stats() (LogStats, error) {
 		case extActive:
 			stats.ActiveSegments++
 			stats.ActiveBytes += info.Size()
+			stats.OldestActive = oldestOf(stats.OldestActive, log.firstRecordTime(path))
 		case extFlushed:
 			stats.FlushedSegments++
 			stats.FlushedBytes += info.Size()
+			stats.OldestSealed = oldestOf(stats.OldestSealed, log.firstRecordTime(path))
 		case extPending:
 			stats.PendingSegments++
 			stats.PendingBytes += info.Size()
+			stats.OldestSealed = oldestOf(stats.OldestSealed, log.firstRecordTime(path))
 		}
 		return nil
 	})
 	return stats, nil
 }
 
+// firstRecordTime returns the time of the first record of the segment at
+// path, by its ID, which, as records are written in the order they're given
+// IDs, is the segment's oldest. It's zero if the segment can't be read, e.g.
+// as it's just been committed, or doesn't begin with an ID.
+func (log *fileLog) firstRecordTime(path string) time.Time {
+	f, err := log.filesys.Open(path)
+	if err != nil {
+		return time.Time{}
+	}
+	defer f.Close()
+	buf := make([]byte, ulid.EncodedSize)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return time.Time{}
+	}
+	id, err := ulid.Parse(string(buf))
+	if err != nil {
+		return time.Time{}
+	}
+	return ulidutil.TimeOf(id)
+}
+
+// oldestOf returns the earlier of the times, ignoring zero.
+func oldestOf(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
 func (log *fileLog) Close() error {
 	return log.releaser.Release()
 }
 
-func recoverSegments(filesys fs.Filesystem, root string) error {
-	var toRename []string
+// recoverSegments makes active and pending segments available for read
+// again. Active segments were never sealed, so they're trimmed after their
+// last well-formed record, as a crash may have torn what follows, and stamped
+// with labels now.
+func recoverSegments(filesys fs.Filesystem, root string, labels string, logger log.Logger) error {
+	var toRename, toRemove []string
 	filesys.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -148,14 +221,36 @@ func recoverSegments(filesys fs.Filesystem, root string) error {
 		switch filepath.Ext(path) {
 		case extActive, extPending:
 			toRename = append(toRename, path)
+		case extTrimming:
+			toRemove = append(toRemove, path)
 		}
 		return nil
 	})
+	// Segments that were being trimmed still have their active originals.
+	for _, path := range toRemove {
+		if err := filesys.Remove(path); err != nil {
+			return err
+		}
+	}
 	for _, path := range toRename {
 		var (
 			oldname = path
 			newname = modifyExtension(oldname, extFlushed)
 		)
+		if filepath.Ext(oldname) == extActive {
+			salvaged, discarded, err := trimSegment(filesys, oldname)
+			if err != nil {
+				return err
+			}
+			if discarded > 0 {
+				level.Warn(logger).Log("recovered", newname, "salvaged_bytes", salvaged, "discarded_bytes", discarded)
+			} else {
+				level.Info(logger).Log("recovered", newname, "salvaged_bytes", salvaged, "discarded_bytes", discarded)
+			}
+			if err := writeLabels(filesys, oldname, labels); err != nil {
+				return err
+			}
+		}
 		if err := filesys.Rename(oldname, newname); err != nil {
 			return err
 		}
@@ -163,9 +258,88 @@ func recoverSegments(filesys fs.Filesystem, root string) error {
 	return nil
 }
 
+// trimSegment trims the active segment at path after its last well-formed
+// record, and returns how many bytes it kept, and discarded. The trimmed
+// segment is written aside, and renamed over the original, so a crash while
+// trimming loses nothing.
+func trimSegment(filesys fs.Filesystem, path string) (salvaged, discarded int64, err error) {
+	f, err := filesys.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	buf, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "reading %s", path)
+	}
+	n := wellFormedRecords(buf)
+	if n == len(buf) {
+		return int64(n), 0, nil // intact
+	}
+	trimming := modifyExtension(path, extTrimming)
+	t, err := filesys.Create(trimming)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "trimming %s", path)
+	}
+	if _, err := t.Write(buf[:n]); err != nil {
+		t.Close()
+		return 0, 0, errors.Wrapf(err, "trimming %s", path)
+	}
+	if err := t.Sync(); err != nil {
+		t.Close()
+		return 0, 0, errors.Wrapf(err, "trimming %s", path)
+	}
+	if err := t.Close(); err != nil {
+		return 0, 0, errors.Wrapf(err, "trimming %s", path)
+	}
+	if err := filesys.Rename(trimming, path); err != nil {
+		return 0, 0, err
+	}
+	return int64(n), int64(len(buf) - n), nil
+}
+
+// wellFormedRecords returns the length of the records at the start of buf
+// which are well-formed, i.e. a ULID, a space, and the rest of the record,
+// up to a newline. A crash may tear the end of a segment in the middle of a
+// record, or leave garbage, e.g. zeros, where records were never written
+// back, so everything from the first record that isn't well-formed is
+// suspect, even if it looks like records again later.
+func wellFormedRecords(buf []byte) int {
+	var n int
+	for n < len(buf) {
+		end := bytes.IndexByte(buf[n:], '\n')
+		if end < 0 {
+			break // no newline, so it's torn, however good it looks
+		}
+		if !wellFormed(buf[n : n+end]) {
+			break
+		}
+		n += end + 1
+	}
+	return n
+}
+
+// wellFormed reports whether the record, without its newline, begins with a
+// ULID, and a space.
+func wellFormed(record []byte) bool {
+	if len(record) <= ulid.EncodedSize || record[ulid.EncodedSize] != ' ' {
+		return false
+	}
+	if record[0] > '7' {
+		return false // too big to be a ULID
+	}
+	for _, c := range record[:ulid.EncodedSize] {
+		if !strings.ContainsRune(ulid.Encoding, unicode.ToUpper(rune(c))) {
+			return false
+		}
+	}
+	return true
+}
+
 type fileWriteSegment struct {
-	fs fs.Filesystem
-	f  fs.File
+	fs     fs.Filesystem
+	f      fs.File
+	labels string
 }
 
 func (w fileWriteSegment) Write(p []byte) (int, error) {
@@ -176,12 +350,17 @@ func (w fileWriteSegment) Sync() error {
 	return w.f.Sync()
 }
 
-// Close closes the segment and makes it available for read.
+// Close closes the segment, stamps it with our labels, and makes it available
+// for read.
 func (w fileWriteSegment) Close() error {
+	fs.Seal(w.f) // just advice
 	if err := w.f.Close(); err != nil {
 		return err
 	}
 	oldname := w.f.Name()
+	if err := writeLabels(w.fs, oldname, w.labels); err != nil {
+		return err
+	}
 	newname := modifyExtension(oldname, extFlushed)
 	return w.fs.Rename(oldname, newname)
 }
@@ -194,8 +373,9 @@ func (w fileWriteSegment) Delete() error {
 }
 
 type fileReadSegment struct {
-	fs fs.Filesystem
-	f  fs.File
+	fs     fs.Filesystem
+	f      fs.File
+	labels string
 }
 
 func (r fileReadSegment) Read(p []byte) (int, error) {
@@ -207,7 +387,11 @@ func (r fileReadSegment) Commit() error {
 	if err := r.f.Close(); err != nil {
 		return err
 	}
-	return r.fs.Remove(r.f.Name())
+	if err := r.fs.Remove(r.f.Name()); err != nil {
+		return err
+	}
+	r.fs.Remove(modifyExtension(r.f.Name(), extLabels)) // may not exist
+	return nil
 }
 
 // Failed closes the segment and makes it available again.
@@ -224,6 +408,41 @@ func (r fileReadSegment) Size() int64 {
 	return r.f.Size()
 }
 
+// Labels the segment was stamped with.
+func (r fileReadSegment) Labels() string {
+	return r.labels
+}
+
+// writeLabels stamps the segment at path with labels, unless there are none.
+func writeLabels(filesys fs.Filesystem, path, labels string) error {
+	if labels == "" {
+		return nil
+	}
+	f, err := filesys.Create(modifyExtension(path, extLabels))
+	if err != nil {
+		return errors.Wrap(err, "stamping labels")
+	}
+	if _, err := f.Write([]byte(labels)); err != nil {
+		f.Close()
+		return errors.Wrap(err, "stamping labels")
+	}
+	return f.Close()
+}
+
+// readLabels returns the labels the segment at path was stamped with, if any.
+func readLabels(filesys fs.Filesystem, path string) string {
+	f, err := filesys.Open(modifyExtension(path, extLabels))
+	if err != nil {
+		return "" // never stamped
+	}
+	defer f.Close()
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
+
 func modifyExtension(filename, newExt string) string {
 	return filename[:len(filename)-len(filepath.Ext(filename))] + newExt
 }
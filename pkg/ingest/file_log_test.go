@@ -1,10 +1,18 @@
 package ingest
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+
 	"github.com/oklog/oklog/pkg/fs"
 )
 
@@ -27,7 +35,7 @@ func TestRecoverSegments(t *testing.T) {
 		}
 	}
 
-	filelog, err := NewFileLog(filesys, "")
+	filelog, err := NewFileLog(filesys, "", "", nil)
 	if err != nil {
 		t.Fatalf("NewFileLog: %v", err)
 	}
@@ -59,6 +67,189 @@ func TestRecoverSegments(t *testing.T) {
 	}
 }
 
+func TestWellFormedRecords(t *testing.T) {
+	t.Parallel()
+
+	const (
+		a = "01ARYZ6S41TSV4RRFFQ69G5FAV first record\n"
+		b = "01ARYZ6S41TSV4RRFFQ69G5FAW second record\n"
+	)
+	for _, testcase := range []struct {
+		name string
+		buf  string
+		want int
+	}{
+		{"empty", "", 0},
+		{"intact", a + b, len(a + b)},
+		{"empty record", "01ARYZ6S41TSV4RRFFQ69G5FAV \n", ulid.EncodedSize + 2},
+		{"lowercase ULID", strings.ToLower(a), len(a)},
+		{"torn record", a + b[:len(b)/2], len(a)},
+		{"torn ULID", a + b[:10], len(a)},
+		{"no newline", a + strings.TrimSuffix(b, "\n"), len(a)},
+		{"zeros", a + string(make([]byte, 512)), len(a)},
+		{"zeros and a newline", a + string(make([]byte, 40)) + "\n" + b, len(a)},
+		{"no ULID", a + "second record, no ULID\n" + b, len(a)},
+		{"invalid character", a + strings.Replace(b, "F", "U", 1) + b, len(a)},
+		{"ULID too big", a + "8" + b[1:], len(a)},
+		{"no space", a + strings.Replace(b, " ", "_", 1), len(a)},
+		{"just a ULID", a + "01ARYZ6S41TSV4RRFFQ69G5FAW\n", len(a)},
+		{"garbage first", "\x00" + a, 0},
+	} {
+		if want, have := testcase.want, wellFormedRecords([]byte(testcase.buf)); want != have {
+			t.Errorf("%s: want %d, have %d", testcase.name, want, have)
+		}
+	}
+}
+
+func TestRecoverTornSegments(t *testing.T) {
+	t.Parallel()
+
+	const (
+		a = "01ARYZ6S41TSV4RRFFQ69G5FAV first record\n"
+		b = "01ARYZ6S41TSV4RRFFQ69G5FAW second record\n"
+		c = "01ARYZ6S41TSV4RRFFQ69G5FAX third record\n"
+		d = "01ARYZ6S41TSV4RRFFQ69G5FAY fourth record, which is torn\n"
+	)
+	for _, testcase := range []struct {
+		name      string
+		torn      bool
+		want      string // salvaged
+		discarded int
+	}{
+		// Unsynced writes are lost whole, so what's left is intact.
+		{"lost", false, a + b, 0},
+		// The last write is torn, after its ULID, but before its newline.
+		{"torn", true, a + b + c, len(d) / 2},
+	} {
+		filesys := fs.NewFaultyFilesystem(fs.NewVirtualFilesystem())
+		filesys.SetTornWrites(testcase.torn)
+		filelog, err := NewFileLog(filesys, "/", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range []string{a, b} {
+			if _, err := w.Write([]byte(record)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range []string{c, d} {
+			if _, err := w.Write([]byte(record)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := filesys.Crash(); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		recovered, err := NewFileLog(filesys, "/", "", log.NewLogfmtLogger(&buf))
+		if err != nil {
+			t.Fatalf("%s: recovering: %v", testcase.name, err)
+		}
+		segment, err := recovered.Oldest()
+		if err != nil {
+			t.Fatalf("%s: %v", testcase.name, err)
+		}
+		have, err := ioutil.ReadAll(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := testcase.want; want != string(have) {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+		for _, want := range []string{
+			"salvaged_bytes=" + strconv.Itoa(len(testcase.want)),
+			"discarded_bytes=" + strconv.Itoa(testcase.discarded),
+		} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%s: want %s logged, have %q", testcase.name, want, buf.String())
+			}
+		}
+		recovered.Close()
+	}
+}
+
+func TestSegmentLabels(t *testing.T) {
+	t.Parallel()
+
+	for _, labels := range []string{"", "env=staging,region=eu"} {
+		filesys := fs.NewVirtualFilesystem()
+		filelog, err := NewFileLog(filesys, "/", labels, nil)
+		if err != nil {
+			t.Fatalf("%q: NewFileLog: %v", labels, err)
+		}
+
+		// Segments are stamped with the log's labels when they're sealed.
+		w, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("01ARYZ6S41TSV4RRFFQ69G5FAV One\n"))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := filelog.Oldest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, have := labels, r.Labels(); want != have {
+			t.Errorf("%q: want %q, have %q", labels, want, have)
+		}
+
+		// And the stamp goes with the segment.
+		if err := r.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		filesys.Walk("/", func(path string, info os.FileInfo, err error) error {
+			if filepath.Base(path) != lockFile && !info.IsDir() {
+				t.Errorf("%q: after Commit: found unexpected file %s", labels, path)
+			}
+			return nil
+		})
+		filelog.Close()
+	}
+}
+
+func TestSegmentWriteback(t *testing.T) {
+	t.Parallel()
+
+	var (
+		r       = &fs.Recorder{}
+		filesys = fs.NewWritebackFilesystem(fs.NewVirtualFilesystemWithRecorder(r), fs.Writeback{SyncBytes: 64, DropSealed: true})
+	)
+	filelog, err := NewFileLog(filesys, "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+
+	// Long writes are written back as they go, and dropped once sealed.
+	w, err := filelog.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		w.Write([]byte("01ARYZ6S41TSV4RRFFQ69G5FAV One, two, three, four, five\n"))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, c := range r.Calls() {
+		ops = append(ops, c.Op)
+	}
+	if want, have := []string{"sync_range", "sync_range", "drop_cache"}, ops; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
 func TestLockBehavior(t *testing.T) {
 	t.Parallel()
 
@@ -83,13 +274,13 @@ func TestLockBehavior(t *testing.T) {
 			f.Close()
 
 			// NewFileLog should manage this fine.
-			filelog, err := NewFileLog(filesys, root)
+			filelog, err := NewFileLog(filesys, root, "", nil)
 			if err != nil {
 				t.Fatalf("initial NewFileLog: %v", err)
 			}
 
 			// But a second FileLog should fail.
-			if _, err := NewFileLog(filesys, root); err == nil {
+			if _, err := NewFileLog(filesys, root, "", nil); err == nil {
 				t.Fatalf("second NewFileLog: want error, have none")
 			} else {
 				t.Logf("second NewFileLog: got expected error: %v", err)
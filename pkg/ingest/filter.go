@@ -0,0 +1,204 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"hash/fnv"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// FilterAction is what a FilterRule does with the records it matches.
+type FilterAction string
+
+// The actions of filter rules.
+const (
+	FilterKeep   FilterAction = "keep"
+	FilterDrop   FilterAction = "drop"
+	FilterSample FilterAction = "sample"
+)
+
+// FilterRule decides the fate of the records its pattern matches.
+type FilterRule struct {
+	Action  FilterAction
+	Rate    float64 // of records kept, from 0 to 1, with FilterSample
+	Pattern *regexp.Regexp
+}
+
+// String returns the rule as it's written in a rules file.
+func (r FilterRule) String() string {
+	if r.Action == FilterSample {
+		return string(r.Action) + " " + strconv.FormatFloat(r.Rate, 'g', -1, 64) + " " + r.Pattern.String()
+	}
+	return string(r.Action) + " " + r.Pattern.String()
+}
+
+// ParseFilterRules parses filter rules, one per line: an action, keep, drop,
+// or sample, with sample followed by the rate of records to keep, and then
+// the regular expression of the records it applies to, which is the rest of
+// the line, and may hold spaces. Blank lines, and lines starting with a #,
+// are ignored. For example,
+//
+//	keep   level=error
+//	drop   ^chatty-app .* level=debug
+//	sample 0.01 healthcheck
+func ParseFilterRules(r io.Reader) ([]FilterRule, error) {
+	var (
+		rules []FilterRule
+		s     = bufio.NewScanner(r)
+		n     int
+	)
+	for s.Scan() {
+		n++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule FilterRule
+		action, rest := cutField(line)
+		switch rule.Action = FilterAction(action); rule.Action {
+		case FilterKeep, FilterDrop:
+		case FilterSample:
+			var rate string
+			rate, rest = cutField(rest)
+			var err error
+			rule.Rate, err = strconv.ParseFloat(rate, 64)
+			if err == nil && (rule.Rate < 0 || rule.Rate > 1) {
+				err = errors.New("must be from 0 to 1")
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d: sample rate %q", n, rate)
+			}
+		default:
+			return nil, errors.Errorf("line %d: unknown action %q, want keep, drop, or sample", n, action)
+		}
+		if rest == "" {
+			return nil, errors.Errorf("line %d: missing regular expression", n)
+		}
+		var err error
+		if rule.Pattern, err = regexp.Compile(rest); err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		rules = append(rules, rule)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// cutField returns the first field of s, and the rest of it, trimmed.
+func cutField(s string) (string, string) {
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+// Filter drops records by rules, before they're given IDs, e.g. the debug
+// logs of a third-party host whose forwarder we don't control. Each record
+// is decided by the first rule that matches it: keep keeps it, drop drops
+// it, and sample keeps the rate of the records it matches. Sampling is by a
+// hash of the record, so a record that's written again, e.g. after its
+// connection is lost, is sampled the same way. Records that match no rule
+// are kept.
+type Filter struct {
+	rules   atomic.Value // []filterRule
+	records *prometheus.CounterVec
+}
+
+// filterRule is a FilterRule with its metrics.
+type filterRule struct {
+	FilterRule
+	threshold     uint64 // of hashes that are kept, with FilterSample
+	kept, dropped prometheus.Counter
+}
+
+// NewFilter returns a Filter by the rules, which may be changed later with
+// Set. records counts the records each rule keeps and drops, partitioned
+// by rule, as it's written, and by result, kept or dropped.
+func NewFilter(rules []FilterRule, records *prometheus.CounterVec) *Filter {
+	f := &Filter{records: records}
+	f.Set(rules)
+	return f
+}
+
+// Set replaces the rules. Connections switch to them with their next
+// record.
+func (f *Filter) Set(rules []FilterRule) {
+	compiled := make([]filterRule, len(rules))
+	for i, rule := range rules {
+		compiled[i] = filterRule{
+			FilterRule: rule,
+			kept:       f.records.WithLabelValues(rule.String(), "kept"),
+			dropped:    f.records.WithLabelValues(rule.String(), "dropped"),
+		}
+		if rule.Action == FilterSample {
+			compiled[i].threshold = sampleThreshold(rule.Rate)
+		}
+	}
+	f.rules.Store(compiled)
+}
+
+// sampleThreshold returns the hash under which records are kept, so the rate
+// of them are. Rates of 1 keep every record regardless.
+func sampleThreshold(rate float64) uint64 {
+	return uint64(rate*(1<<53)) << 11
+}
+
+// Keep reports whether the record should be kept. Rules match the record
+// without its trailing newline. A nil Filter keeps every record.
+func (f *Filter) Keep(record []byte) bool {
+	if f == nil {
+		return true
+	}
+	rules := f.rules.Load().([]filterRule)
+	if len(rules) == 0 {
+		return true
+	}
+	line := bytes.TrimSuffix(record, []byte{'\n'})
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Pattern.Match(line) {
+			continue
+		}
+		keep := rule.Action == FilterKeep
+		if rule.Action == FilterSample {
+			h := fnv.New64a()
+			h.Write(line)
+			keep = h.Sum64() < rule.threshold || rule.Rate >= 1
+		}
+		if keep {
+			rule.kept.Inc()
+		} else {
+			rule.dropped.Inc()
+		}
+		return keep
+	}
+	return true
+}
+
+// Reader wraps the record.Reader for a connection, skipping the records the
+// filter drops. A nil Filter returns r unchanged.
+func (f *Filter) Reader(r record.Reader) record.Reader {
+	if f == nil {
+		return r
+	}
+	return func() ([]byte, error) {
+		for {
+			record, err := r()
+			if err != nil || f.Keep(record) {
+				return record, err
+			}
+		}
+	}
+}
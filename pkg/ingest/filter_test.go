@@ -0,0 +1,246 @@
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestParseFilterRules(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name  string
+		input string
+		want  []string // the rules, as strings
+		err   bool
+	}{
+		{
+			name:  "empty",
+			input: "\n# nothing yet\n\n",
+		},
+		{
+			name:  "rules",
+			input: "keep level=error\n  # debug spam\ndrop\t^chatty .* level=debug  \nsample 0.25 GET /healthz\n",
+			want:  []string{"keep level=error", "drop ^chatty .* level=debug", "sample 0.25 GET /healthz"},
+		},
+		{name: "unknown action", input: "discard foo\n", err: true},
+		{name: "missing pattern", input: "drop\n", err: true},
+		{name: "missing rate", input: "sample foo\n", err: true},
+		{name: "rate over 1", input: "sample 1.5 foo\n", err: true},
+		{name: "bad pattern", input: "drop (foo\n", err: true},
+	} {
+		rules, err := ParseFilterRules(strings.NewReader(testcase.input))
+		if want, have := testcase.err, err != nil; want != have {
+			t.Errorf("%s: want error %v, have %v", testcase.name, want, err)
+			continue
+		}
+		var have []string
+		for _, rule := range rules {
+			have = append(have, rule.String())
+		}
+		if want, have := fmt.Sprint(testcase.want), fmt.Sprint(have); want != have {
+			t.Errorf("%s: want %s, have %s", testcase.name, want, have)
+		}
+	}
+}
+
+func TestFilterOrder(t *testing.T) {
+	t.Parallel()
+
+	records := prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"rule", "result"})
+	f := NewFilter(mustParseFilterRules(t, `
+		keep level=error
+		drop level=(debug|error)
+		sample 0 ^noisy
+	`), records)
+	for record, want := range map[string]bool{
+		"app level=error boom\n": true,  // kept by the first rule, though the second matches
+		"app level=debug meh\n":  false, // dropped by the second
+		"noisy level=info\n":     false, // sampled away by the third
+		"app level=info\n":       true,  // matches none
+	} {
+		if have := f.Keep([]byte(record)); want != have {
+			t.Errorf("%q: want %v, have %v", record, want, have)
+		}
+	}
+
+	// Each rule counts what it decided.
+	for _, testcase := range []struct {
+		rule, result string
+		want         float64
+	}{
+		{"keep level=error", "kept", 1},
+		{"drop level=(debug|error)", "dropped", 1},
+		{"sample 0 ^noisy", "dropped", 1},
+		{"sample 0 ^noisy", "kept", 0},
+	} {
+		var m dto.Metric
+		records.WithLabelValues(testcase.rule, testcase.result).Write(&m)
+		if want, have := testcase.want, m.GetCounter().GetValue(); want != have {
+			t.Errorf("%s %s: want %v, have %v", testcase.rule, testcase.result, want, have)
+		}
+	}
+}
+
+func TestFilterSample(t *testing.T) {
+	t.Parallel()
+
+	newFilter := func(rules string) *Filter {
+		return NewFilter(mustParseFilterRules(t, rules), prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"rule", "result"}))
+	}
+	var (
+		a, b = newFilter("sample 0.1 ."), newFilter("sample 0.1 .")
+		all  = newFilter("sample 1 .")
+		none = newFilter("sample 0 .")
+		n    = 10000
+		kept int
+	)
+	for i := 0; i < n; i++ {
+		record := []byte(fmt.Sprintf("topic record %d\n", i))
+		keep := a.Keep(record)
+		if keep {
+			kept++
+		}
+
+		// The same record is sampled the same way, every time, by any
+		// filter with the rule.
+		if want, have := keep, a.Keep(record); want != have {
+			t.Fatalf("%q: sampled %v, then %v", record, want, have)
+		}
+		if want, have := keep, b.Keep(record); want != have {
+			t.Fatalf("%q: sampled %v by one filter, %v by another", record, want, have)
+		}
+		if !all.Keep(record) {
+			t.Fatalf("%q: dropped at a rate of 1", record)
+		}
+		if none.Keep(record) {
+			t.Fatalf("%q: kept at a rate of 0", record)
+		}
+	}
+	if kept < n/10*8/10 || kept > n/10*12/10 {
+		t.Errorf("kept %d of %d records at a rate of 0.1", kept, n)
+	}
+}
+
+func TestHandleConnectionsFilterReload(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := NewFilter(mustParseFilterRules(t, "drop debug"), prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"rule", "result"}))
+
+	// The handler passes on each record it's given.
+	records := make(chan string)
+	capture := func(r record.Reader, w *Writer, idGen IDGenerator, connectedClients prometheus.Gauge) error {
+		defer close(records)
+		for {
+			rec, err := r()
+			if err != nil {
+				return err
+			}
+			records <- string(rec)
+		}
+	}
+	go HandleConnections(ln, ConnectionConfig{
+		Handler:          capture,
+		ReaderFactory:    record.NewDynamicReader,
+		Log:              log,
+		SegmentFlushAge:  time.Hour,
+		SegmentFlushSize: 1024 * 1024,
+		Filter:           filter,
+		ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+		Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+		Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+	})
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintln(conn, AckHandshake)
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case have := <-records:
+			if want != have {
+				t.Fatalf("want %q, have %q", want, have)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %q", want)
+		}
+	}
+
+	fmt.Fprint(conn, "app debug 1\napp info 2\n")
+	expect("app info 2\n")
+
+	// The connection carries on with the new rules.
+	filter.Set(mustParseFilterRules(t, "drop info"))
+	fmt.Fprint(conn, "app info 3\napp debug 4\n")
+	expect("app debug 4\n")
+	conn.(*net.TCPConn).CloseWrite()
+	if _, ok := <-records; ok {
+		t.Fatal("want no more records")
+	}
+
+	// Every record written is acknowledged, including those dropped, so the
+	// client doesn't write them again.
+	var last string
+	for s := bufio.NewScanner(conn); s.Scan(); {
+		last = s.Text()
+	}
+	if want, have := Ack+" 4", last; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func BenchmarkFilter(b *testing.B) {
+	record := []byte("app 2017-01-02T03:04:05Z level=info msg=\"request served\" path=/api/v1/users status=200\n")
+	for _, testcase := range []struct {
+		name   string
+		filter *Filter
+	}{
+		{"nil", nil},
+		{"no rules", NewFilter(nil, prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"rule", "result"}))},
+		{"rules", NewFilter(mustParseFilterRules(b, "keep level=error\ndrop level=debug\nsample 0.5 status=500"), prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"rule", "result"}))},
+	} {
+		b.Run(testcase.name, func(b *testing.B) {
+			r := testcase.filter.Reader(func() ([]byte, error) { return record, nil })
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r()
+			}
+		})
+	}
+}
+
+func mustParseFilterRules(tb testing.TB, s string) []FilterRule {
+	tb.Helper()
+	rules, err := ParseFilterRules(strings.NewReader(s))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return rules
+}
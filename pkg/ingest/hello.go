@@ -0,0 +1,139 @@
+package ingest
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// HelloHandshake starts the line a client may write first, to negotiate the
+// features of the connection, in place of the AckHandshake and the
+// record.FramingHandshake: "OKLOG/1", a space, and the features it wants,
+// comma-separated, e.g. "OKLOG/1 acks,framing". An ingester that understands
+// it answers with a line of the same form, listing the features it agreed to:
+// those of the client's it supports, in the client's order, and maybe none.
+// The client may then write the SourceHandshake, and then its records, with
+// the agreed features.
+//
+// An ingester that doesn't understand it takes it for a record, and never
+// answers, so clients should only say hello to ingesters known to.
+const HelloHandshake = "OKLOG/1"
+
+// Features a client may ask for with the HelloHandshake.
+const (
+	FeatureAcks    = "acks"    // as with the AckHandshake
+	FeatureFraming = "framing" // length-prefixed, as with record.FramingHandshake
+	FeatureSnappy  = "snappy"  // everything after the answer compressed, with snappy's framing format
+	FeatureBatch   = "batch"   // records written in batches, each after a BatchHeader; not with framing
+	FeatureLoad    = "load"    // the ingester's Load, in the answer; see Load
+)
+
+// helloWriteTimeout bounds how long an answer to a hello waits on a client
+// that isn't reading it.
+const helloWriteTimeout = 5 * time.Second
+
+// maxHelloSize bounds the line of a HelloHandshake.
+const maxHelloSize = 1024
+
+// Hello returns the line of a HelloHandshake, or an answer to one, with the
+// features, without its newline.
+func Hello(features []string) string {
+	return HelloHandshake + " " + strings.Join(features, ",")
+}
+
+// ParseHello parses a line of a HelloHandshake, or an answer to one, with or
+// without its newline, and returns its features, and whether it was one.
+func ParseHello(line string) ([]string, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, HelloHandshake+" ") {
+		return nil, false
+	}
+	var features []string
+	for _, f := range strings.Split(strings.TrimPrefix(line, HelloHandshake+" "), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			features = append(features, f)
+		}
+	}
+	return features, true
+}
+
+// features are those agreed for a connection.
+type features struct {
+	acks    bool
+	framing bool
+	snappy  bool
+	batch   bool
+}
+
+// reader returns r, for the connection's record.ReaderFactory. With framing,
+// it's preceded by the record.FramingHandshake, which the factory expects.
+func (f features) reader(r io.Reader) io.Reader {
+	if !f.framing {
+		return r
+	}
+	return io.MultiReader(strings.NewReader(record.FramingHandshake+"\n"), r)
+}
+
+// readHello reads the HelloHandshake from the start of the connection, if
+// it's there, and answers it, agreeing to every feature we support, and
+// giving the load of the meter, if it's asked for. It returns the agreed
+// features, whether there was a hello, and the rest of the connection.
+func readHello(conn net.Conn, load *loadMeter) (features, bool, io.Reader, error) {
+	ok, br, err := matchPrefix(conn, HelloHandshake+" ")
+	if err != nil {
+		return features{}, false, nil, err
+	}
+	if !ok {
+		return features{}, false, br, nil
+	}
+	line, err := br.ReadSlice('\n')
+	switch {
+	case err == bufio.ErrBufferFull || len(line) > maxHelloSize:
+		return features{}, false, nil, errors.New("hello too long")
+	case err == io.EOF:
+		return features{}, false, nil, errors.Wrap(io.ErrUnexpectedEOF, "reading hello")
+	case err != nil:
+		return features{}, false, nil, errors.Wrap(err, "reading hello")
+	}
+	wanted, _ := ParseHello(HelloHandshake + " " + string(line))
+	var (
+		f      features
+		agreed []string
+	)
+	for _, feature := range wanted {
+		switch feature {
+		case FeatureAcks:
+			f.acks = true
+		case FeatureFraming:
+			if f.batch {
+				continue // whichever the client asks for first
+			}
+			f.framing = true
+		case FeatureSnappy:
+			f.snappy = true
+		case FeatureBatch:
+			if f.framing {
+				continue
+			}
+			f.batch = true
+		case FeatureLoad:
+			agreed = append(agreed, load.load().String())
+			continue
+		default:
+			continue // not one we support
+		}
+		agreed = append(agreed, feature)
+	}
+	conn.SetWriteDeadline(time.Now().Add(helloWriteTimeout))
+	defer conn.SetWriteDeadline(time.Time{})
+	if _, err := io.WriteString(conn, Hello(agreed)+"\n"); err != nil {
+		return features{}, false, nil, errors.Wrap(err, "answering hello")
+	}
+	return f, true, br, nil
+}
@@ -0,0 +1,157 @@
+package ingest
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestParseHello(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		line     string
+		features []string
+		ok       bool
+	}{
+		{"OKLOG/1 acks,framing\n", []string{"acks", "framing"}, true},
+		{"OKLOG/1 acks", []string{"acks"}, true},
+		{"OKLOG/1 \n", nil, true},
+		{"OKLOG/1 acks,,framing \r\n", []string{"acks", "framing"}, true},
+		{"OKLOG/1\n", nil, false},
+		{"OKLOG/2 acks\n", nil, false},
+		{"topic record\n", nil, false},
+	} {
+		features, ok := ParseHello(testcase.line)
+		if want, have := testcase.ok, ok; want != have {
+			t.Errorf("%q: want ok %v, have %v", testcase.line, want, have)
+		}
+		if want, have := testcase.features, features; !reflect.DeepEqual(want, have) {
+			t.Errorf("%q: want %q, have %q", testcase.line, want, have)
+		}
+	}
+	if want, have := "OKLOG/1 acks,framing", Hello([]string{FeatureAcks, FeatureFraming}); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestHandleConnectionsHello(t *testing.T) {
+	t.Parallel()
+
+	frames := string(record.AppendFrame(record.AppendFrame(nil, []byte("topic multi\nline")), []byte("topic b")))
+	framed := readAll(t, record.NewDynamicReader(strings.NewReader(record.FramingHandshake+"\n"+frames)))
+
+	for _, testcase := range []struct {
+		name    string
+		input   string
+		answer  string // to the hello, if any
+		records []string
+		acks    bool
+	}{
+		{"old client", "topic a\ntopic b\n", "", []string{"topic a\n", "topic b\n"}, false},
+		{"old client, acks", AckHandshake + "\ntopic a\n", "", []string{"topic a\n"}, true},
+		{"old client, framing", record.FramingHandshake + "\n" + frames, "", framed, false},
+		{"hello, nothing", "OKLOG/1 \ntopic a\n", "OKLOG/1 ", []string{"topic a\n"}, false},
+		{"hello, acks", "OKLOG/1 acks\ntopic a\ntopic b\n", "OKLOG/1 acks", []string{"topic a\n", "topic b\n"}, true},
+		{"hello, framing", "OKLOG/1 framing\n" + frames, "OKLOG/1 framing", framed, false},
+		{"hello, unsupported", "OKLOG/1 gzip,framing,acks\n" + frames, "OKLOG/1 framing,acks", framed, true},
+		{"hello, framing, not batch", "OKLOG/1 framing,batch\n" + frames, "OKLOG/1 framing", framed, false},
+		{"hello, batch", "OKLOG/1 batch,framing\nBATCH 2 16\ntopic a\ntopic b\n", "OKLOG/1 batch", []string{"topic a\n", "topic b\n"}, false},
+		{"hello, load", "OKLOG/1 acks,load\ntopic a\n", "OKLOG/1 acks,load=0:0", []string{"topic a\n"}, true}, // no connection of the load's, yet
+		{"hello, source", "OKLOG/1 acks\n" + SourceHandshake + " team-a\ntopic a\n", "OKLOG/1 acks", []string{"topic a\n"}, true},
+		{"hello, then old handshake", "OKLOG/1 acks\n" + AckHandshake + "\ntopic a\n", "OKLOG/1 acks", []string{"default " + AckHandshake + "\n", "topic a\n"}, true}, // a record, of no topic
+	} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		received := make(chan []string, 1)
+		capture := func(r record.Reader, w *Writer, idGen IDGenerator, connectedClients prometheus.Gauge) error {
+			records := readAll(t, r)
+			received <- records
+			return nil
+		}
+		go HandleConnections(ln, ConnectionConfig{
+			Handler:          capture,
+			ReaderFactory:    record.NewDynamicReader,
+			Log:              log,
+			SegmentFlushAge:  time.Hour,
+			SegmentFlushSize: 1024 * 1024,
+			ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+			Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+			Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+			Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+			SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		})
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		io.WriteString(conn, testcase.input)
+		conn.(*net.TCPConn).CloseWrite()
+
+		select {
+		case records := <-received:
+			if want, have := testcase.records, records; !reflect.DeepEqual(want, have) {
+				t.Errorf("%s: want records %q, have %q", testcase.name, want, have)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no records", testcase.name)
+		}
+
+		// The answer comes first, then the acknowledgements, if any.
+		var lines []string
+		for s := bufio.NewScanner(conn); s.Scan(); {
+			lines = append(lines, s.Text())
+		}
+		if testcase.answer != "" {
+			if len(lines) == 0 || lines[0] != testcase.answer {
+				t.Errorf("%s: want answer %q, have %q", testcase.name, testcase.answer, lines)
+				conn.Close()
+				ln.Close()
+				continue
+			}
+			lines = lines[1:]
+		}
+		switch {
+		case testcase.acks && (len(lines) == 0 || !strings.HasPrefix(lines[len(lines)-1], Ack+" ")):
+			t.Errorf("%s: want acknowledgements, have %q", testcase.name, lines)
+		case !testcase.acks && len(lines) > 0:
+			t.Errorf("%s: want nothing, have %q", testcase.name, lines)
+		}
+		conn.Close()
+		ln.Close()
+	}
+}
+
+func readAll(t *testing.T, r record.Reader) []string {
+	t.Helper()
+	var records []string
+	for {
+		rec, err := r()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Errorf("reading records: %v", err)
+			return records
+		}
+		records = append(records, string(rec))
+	}
+}
@@ -0,0 +1,278 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// HTTPIngestResult is the summary of the records of a POST to the
+// HTTPIngester: how many were written, and their bytes, not counting their
+// IDs, and the first and last of those IDs. Records the filter drops aren't
+// written, but they're counted. If the records couldn't all be written, e.g.
+// as the source is over its quota, Error says why; those before it are still
+// written, and those after, not counted as dropped.
+type HTTPIngestResult struct {
+	Records int    `json:"records"`
+	Bytes   int64  `json:"bytes"`
+	Dropped int    `json:"dropped,omitempty"`
+	First   string `json:"first,omitempty"`
+	Last    string `json:"last,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HTTPIngester ingests records POSTed to the ingest API, for producers that
+// can't hold a connection open, like serverless functions, or curl. It should
+// be mounted at /ingest.
+//
+// The body is newline-delimited records, as over a connection, and may be
+// gzipped, with a Content-Encoding of gzip; it's at most maxBodySize bytes,
+// before and after. A final record needn't end with a newline, as the body is
+// known to be complete. The records are read whole, by the ReaderFactory, for
+// the same topics, and record size limits, before any is written: a body
+// that's too big, or malformed, writes nothing. They're then subject to the
+// limiter, the clocks, the quota of the source given with HTTPHeaderSource,
+// if any, client timestamps, and the filter, as the records of a connection
+// are; see HandleConnections.
+//
+// The mode parameter is fast, the default, or durable, which doesn't return
+// until a sync covers the records, as HandleDurableWriter doesn't read the
+// next record until then. Either way, the response is an HTTPIngestResult, as
+// JSON, which for a durable POST, with HTTP 200, means the records are safe.
+//
+// Every POST writes to the same Writer, which the HTTPIngester owns, with one
+// stream of IDs, so the records of concurrent POSTs share a segment.
+type HTTPIngester struct {
+	newID       func(ms uint64) string
+	rfac        record.ReaderFactory
+	maxBodySize int64
+	limiter     *Limiter
+	quotas      *Quotas
+	timestamps  *ClientTimestamps
+	clock       *ClockGuard
+	idClock     *IDClock
+	filter      *Filter
+
+	mtx     sync.RWMutex // held for reading by each POST
+	w       *Writer
+	stopped bool
+}
+
+// HTTPHeaderSource is the header of a POST to the HTTPIngester with the ID of
+// its source, as in the SourceHandshake of a connection.
+const HTTPHeaderSource = "X-Oklog-Source"
+
+// NewHTTPIngester returns an HTTPIngester that writes to w, with IDs from ids,
+// which may be nil, read by rfac, from bodies of at most maxBodySize bytes.
+// The limiter, quotas, timestamps, clocks, and filter may each be nil; see
+// HandleConnections. Stop the HTTPIngester to stop w.
+func NewHTTPIngester(
+	w *Writer,
+	ids *MonotonicIDs,
+	rfac record.ReaderFactory,
+	maxBodySize int64,
+	limiter *Limiter,
+	quotas *Quotas,
+	timestamps *ClientTimestamps,
+	clock *ClockGuard,
+	idClock *IDClock,
+	filter *Filter,
+) *HTTPIngester {
+	return &HTTPIngester{
+		newID:       ids.newStream(),
+		rfac:        rfac,
+		maxBodySize: maxBodySize,
+		limiter:     limiter,
+		quotas:      quotas,
+		timestamps:  timestamps,
+		clock:       clock,
+		idClock:     idClock,
+		filter:      filter,
+		w:           w,
+	}
+}
+
+// Stop the HTTPIngester, once the POSTs in flight are done, and its Writer,
+// which flushes it. Further POSTs are refused, with HTTP 503.
+func (h *HTTPIngester) Stop() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if !h.stopped {
+		h.stopped = true
+		h.w.Stop()
+	}
+}
+
+// ServeHTTP ingests the records POSTed.
+func (h *HTTPIngester) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var durable bool
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", "fast":
+	case "durable":
+		durable = true
+	default:
+		http.Error(w, fmt.Sprintf("mode %q: want fast, or durable", mode), http.StatusBadRequest)
+		return
+	}
+	body, code, err := h.readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	records, err := readAllRecords(h.rfac(bytes.NewReader(body)))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading records: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	if h.stopped {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	result, err := h.write(records, r.Header.Get(HTTPHeaderSource))
+	code = http.StatusOK
+	switch err.(type) {
+	case nil:
+	case quotaError:
+		code = http.StatusTooManyRequests
+	case clockError, regressionError:
+		code = http.StatusServiceUnavailable // go elsewhere
+	default:
+		code = http.StatusInternalServerError
+	}
+	if durable && result.Records > 0 {
+		if syncErr := h.w.Sync(); syncErr != nil && err == nil {
+			err, code = syncErr, http.StatusInternalServerError // the records may be lost
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(result)
+}
+
+// readBody reads the body of the request, gunzipped, if it's gzipped. If it
+// can't, it returns the HTTP status code to say so, and why.
+func (h *HTTPIngester) readBody(r *http.Request) ([]byte, int, error) {
+	body, err := readAtMost(r.Body, h.maxBodySize)
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.Wrap(err, "reading body")
+	}
+	if body == nil {
+		return nil, http.StatusRequestEntityTooLarge, errors.Errorf("body is over %d bytes", h.maxBodySize)
+	}
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.Wrap(err, "gunzipping body")
+		}
+		if body, err = readAtMost(zr, h.maxBodySize); err != nil {
+			return nil, http.StatusBadRequest, errors.Wrap(err, "gunzipping body")
+		}
+		if body == nil {
+			return nil, http.StatusRequestEntityTooLarge, errors.Errorf("body is over %d bytes, gunzipped", h.maxBodySize)
+		}
+	default:
+		return nil, http.StatusUnsupportedMediaType, errors.Errorf("Content-Encoding %q: want gzip, or none", encoding)
+	}
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		body = append(body, '\n')
+	}
+	return body, 0, nil
+}
+
+// readAtMost reads r, to its end, if that's no more than max bytes, and
+// returns nil otherwise.
+func readAtMost(r io.Reader, max int64) ([]byte, error) {
+	buf, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) > max {
+		return nil, nil
+	}
+	if buf == nil {
+		buf = []byte{}
+	}
+	return buf, nil
+}
+
+// readAllRecords reads the records of r, to its end.
+func readAllRecords(r record.Reader) ([][]byte, error) {
+	var records [][]byte
+	for {
+		rec, err := r()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+}
+
+// write the records from the source, in order, until they're all written, or
+// one can't be, and return what was.
+func (h *HTTPIngester) write(records [][]byte, source string) (HTTPIngestResult, error) {
+	var (
+		result HTTPIngestResult
+		next   int
+	)
+	// As for a connection, the ID of a record is generated once it's read,
+	// so its time is that of the last read.
+	rr, ms := h.timestamps.Reader(h.quotas.Reader(source, h.clock.Reader(h.idClock.Reader(h.limiter.Reader(func() ([]byte, error) {
+		if next >= len(records) {
+			return nil, io.EOF
+		}
+		next++
+		return records[next-1], nil
+	})))))
+	if h.timestamps == nil {
+		ms = h.idClock.Now
+	}
+	idGen := func() string {
+		id := h.newID(ms())
+		if result.First == "" {
+			result.First = id
+		}
+		result.Last = id
+		return id
+	}
+	rr = h.filter.Reader(rr)
+	for {
+		rec, err := rr()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		if err := h.w.WriteRecord(idGen, rec); err != nil {
+			return result, err
+		}
+		result.Records++
+		result.Bytes += int64(len(rec))
+	}
+	result.Dropped = next - result.Records
+	return result, nil
+}
@@ -0,0 +1,226 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestHTTPIngester(t *testing.T) {
+	t.Parallel()
+
+	gzipped := func(s string) string {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(s))
+		zw.Close()
+		return buf.String()
+	}
+	for _, testcase := range []struct {
+		name     string
+		method   string
+		path     string
+		encoding string
+		body     string
+		code     int
+		want     []string // records written
+	}{
+		{"records", "POST", "/ingest", "", "app a\napp b\n", http.StatusOK, []string{"app a", "app b"}},
+		{"no final newline", "POST", "/ingest", "", "app a\napp b", http.StatusOK, []string{"app a", "app b"}},
+		{"default topic", "POST", "/ingest?mode=fast", "", "!a\n", http.StatusOK, []string{"default !a"}},
+		{"record size limit", "POST", "/ingest", "", "app 0123456789abcdef\napp b\n", http.StatusOK, []string{"app b"}},
+		{"empty", "POST", "/ingest", "", "", http.StatusOK, nil},
+		{"gzip", "POST", "/ingest", "gzip", gzipped("app a\napp b\n"), http.StatusOK, []string{"app a", "app b"}},
+		{"bad gzip", "POST", "/ingest", "gzip", "app a\n", http.StatusBadRequest, nil},
+		{"other encoding", "POST", "/ingest", "br", "app a\n", http.StatusUnsupportedMediaType, nil},
+		{"oversized", "POST", "/ingest", "", strings.Repeat("app a\n", 11), http.StatusRequestEntityTooLarge, nil},
+		{"oversized gunzipped", "POST", "/ingest", "gzip", gzipped(strings.Repeat("app a\n", 11)), http.StatusRequestEntityTooLarge, nil},
+		{"bad mode", "POST", "/ingest?mode=bulk", "", "app a\n", http.StatusBadRequest, nil},
+		{"GET", "GET", "/ingest", "", "", http.StatusMethodNotAllowed, nil},
+	} {
+		filesys := fs.NewVirtualFilesystem()
+		h := newTestHTTPIngester(t, filesys, nil, nil)
+		r := httptest.NewRequest(testcase.method, testcase.path, strings.NewReader(testcase.body))
+		if testcase.encoding != "" {
+			r.Header.Set("Content-Encoding", testcase.encoding)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		h.Stop()
+		if want, have := testcase.code, w.Code; want != have {
+			t.Errorf("%s: want HTTP %d, have %d: %s", testcase.name, want, have, w.Body.String())
+			continue
+		}
+
+		// The IDs are given in order, and summed up, with the records.
+		var have []string
+		ids := readIDs(t, filesys)
+		for _, rec := range readRecords(t, filesys) {
+			have = append(have, rec[ulid.EncodedSize+1:])
+		}
+		if want := testcase.want; strings.Join(want, "\n") != strings.Join(have, "\n") {
+			t.Errorf("%s: want records %q, have %q", testcase.name, want, have)
+		}
+		if testcase.code != http.StatusOK {
+			continue
+		}
+		var result HTTPIngestResult
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("%s: %v", testcase.name, err)
+		}
+		want := HTTPIngestResult{Records: len(ids)}
+		for _, rec := range testcase.want {
+			want.Bytes += int64(len(rec) + 1)
+		}
+		if len(ids) > 0 {
+			want.First, want.Last = ids[0], ids[len(ids)-1]
+		}
+		if want != result {
+			t.Errorf("%s: want %+v, have %+v", testcase.name, want, result)
+		}
+	}
+}
+
+func TestHTTPIngesterDurable(t *testing.T) {
+	t.Parallel()
+
+	// The first sync is held until it's released. Every sync is recorded,
+	// so the durable POST can be checked to have waited for its records'.
+	var (
+		mtx     sync.Mutex
+		synced  = map[string]int64{}
+		syncing = make(chan struct{})
+		release = make(chan struct{})
+		once    sync.Once
+	)
+	filesys := fs.NewVirtualFilesystemWithSyncHook(func(name string, size int64) {
+		once.Do(func() {
+			close(syncing)
+			<-release
+		})
+		mtx.Lock()
+		defer mtx.Unlock()
+		synced[name] = size
+	})
+	h := newTestHTTPIngester(t, filesys, nil, nil)
+	defer h.Stop()
+
+	// A fast POST returns without a sync.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/ingest", strings.NewReader("app fast\n")))
+	if want, have := http.StatusOK, w.Code; want != have {
+		t.Fatalf("fast: want HTTP %d, have %d", want, have)
+	}
+	select {
+	case <-syncing:
+		t.Fatal("fast: want no sync, have one")
+	default:
+	}
+
+	// A durable POST doesn't return until its sync does.
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/ingest?mode=durable", strings.NewReader("app one\napp two\n")))
+		done <- w
+	}()
+	select {
+	case <-syncing:
+	case <-time.After(time.Second):
+		t.Fatal("durable: timeout waiting for the sync")
+	}
+	select {
+	case w := <-done:
+		t.Fatalf("durable: want no response before the sync, have HTTP %d", w.Code)
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	w = <-done
+	if want, have := http.StatusOK, w.Code; want != have {
+		t.Fatalf("durable: want HTTP %d, have %d", want, have)
+	}
+	for _, rec := range []string{"app fast\n", "app one\n", "app two\n"} {
+		if !isSynced(filesys, &mtx, synced, rec) {
+			t.Errorf("durable: want %q synced, have it not", rec)
+		}
+	}
+}
+
+func TestHTTPIngesterFilterQuota(t *testing.T) {
+	t.Parallel()
+
+	rules, err := ParseFilterRules(strings.NewReader("drop level=debug\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		filter = NewFilter(rules, prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"rule", "result"}))
+		m      = newTestQuotaMetrics()
+		quotas = NewQuotas(
+			map[string]Quota{"noisy": {BytesPerDay: 20}},
+			m.records, m.bytes, m.bytesToday, m.throttledSeconds, m.rejectedRecords,
+		)
+		h = newTestHTTPIngester(t, fs.NewVirtualFilesystem(), filter, quotas)
+	)
+	defer h.Stop()
+
+	for _, testcase := range []struct {
+		name   string
+		source string
+		body   string
+		code   int
+		want   HTTPIngestResult // but for the IDs
+	}{
+		{"dropped", "", "app level=debug\napp level=info\n", http.StatusOK, HTTPIngestResult{Records: 1, Bytes: 15, Dropped: 1}},
+		{"over quota", "noisy", "app 0123456\napp 0123456\napp 0123456\n", http.StatusTooManyRequests, HTTPIngestResult{Records: 1, Bytes: 12}},
+	} {
+		r := httptest.NewRequest("POST", "/ingest", strings.NewReader(testcase.body))
+		if testcase.source != "" {
+			r.Header.Set(HTTPHeaderSource, testcase.source)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if want, have := testcase.code, w.Code; want != have {
+			t.Errorf("%s: want HTTP %d, have %d", testcase.name, want, have)
+		}
+		var have HTTPIngestResult
+		if err := json.NewDecoder(w.Body).Decode(&have); err != nil {
+			t.Fatalf("%s: %v", testcase.name, err)
+		}
+		if (testcase.code == http.StatusOK) != (have.Error == "") {
+			t.Errorf("%s: want an error with HTTP %d, have %q", testcase.name, testcase.code, have.Error)
+		}
+		have.First, have.Last, have.Error = "", "", ""
+		if want := testcase.want; want != have {
+			t.Errorf("%s: want %+v, have %+v", testcase.name, want, have)
+		}
+	}
+}
+
+// newTestHTTPIngester returns an HTTPIngester, of bodies of at most 64 bytes,
+// and records of at most 16, that are rejected, if they're any bigger.
+func newTestHTTPIngester(t *testing.T, filesys fs.Filesystem, filter *Filter, quotas *Quotas) *HTTPIngester {
+	log, err := NewFileLog(filesys, "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHTTPIngester(
+		newTestWriter(t, log, 0, 0),
+		nil,
+		record.DynamicReaderFactory(16, record.Reject, nil),
+		64,
+		nil, quotas, nil, nil, nil, filter,
+	)
+}
@@ -0,0 +1,134 @@
+package ingest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// IDClock is this node's clock, as it gives records their IDs. If the clock
+// goes back, e.g. when it's stepped to correct it, the IDs of the records
+// written since would sort before those written just before: instead, the
+// IDClock holds the time of the latest ID until the clock has caught up, so
+// IDs are in order, as the streams of IDs increment their entropy within a
+// millisecond; see MonotonicIDs.
+//
+// It's one clock for the node, shared by every connection. If the clock is
+// further back than a limit, holding the time would give too many records
+// the same one, so records are refused instead, until it's caught up to
+// within the limit.
+type IDClock struct {
+	limit       time.Duration
+	regressions prometheus.Counter
+	refused     prometheus.Counter
+	logger      log.Logger
+	now         func() time.Time
+
+	mtx      sync.Mutex
+	last     uint64 // ms, of the latest ID
+	behind   bool   // the clock's before last, in a regression
+	refusing bool
+}
+
+// NewIDClock returns an IDClock that refuses records while the clock is more
+// than the limit behind the latest ID's time, or never, if the limit isn't
+// positive. regressions counts the times the clock went back, and refused the
+// records refused. Each regression is logged once, as it starts.
+func NewIDClock(limit time.Duration, regressions, refused prometheus.Counter, logger log.Logger) *IDClock {
+	return &IDClock{
+		limit:       limit,
+		regressions: regressions,
+		refused:     refused,
+		logger:      nopIfNil(logger),
+		now:         time.Now,
+	}
+}
+
+// Now returns the time, as unix epoch milliseconds, to give the ID of a
+// record written now. It never goes back. A nil IDClock returns ulid.Now.
+func (c *IDClock) Now() uint64 {
+	if c == nil {
+		return ulid.Now()
+	}
+	ms, _ := c.observe()
+	return ms
+}
+
+// Reader wraps the record.Reader for a connection. While the clock is too
+// far behind, the reader returns an error instead of the record it read.
+// That's so, too, for records whose times their clients give, as the times
+// they arrived are wrong. A nil IDClock returns r unchanged.
+func (c *IDClock) Reader(r record.Reader) record.Reader {
+	if c == nil {
+		return r
+	}
+	return func() ([]byte, error) {
+		record, err := r()
+		if err != nil {
+			return record, err
+		}
+		if err := c.check(); err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+}
+
+// check returns a regressionError, counting a refused record, if the clock
+// is too far behind.
+func (c *IDClock) check() error {
+	if _, behind := c.observe(); c.limit > 0 && behind > c.limit {
+		c.refused.Inc()
+		return regressionError{behind: behind, limit: c.limit}
+	}
+	return nil
+}
+
+// observe returns the time of the latest ID, advancing it to the clock's,
+// unless the clock is behind it, and by how much.
+func (c *IDClock) observe() (uint64, time.Duration) {
+	now := ulid.Timestamp(c.now())
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if now >= c.last {
+		if c.behind {
+			level.Info(c.logger).Log("msg", "clock caught up, record IDs follow it again")
+		}
+		c.last, c.behind, c.refusing = now, false, false
+		return now, 0
+	}
+	behind := time.Duration(c.last-now) * time.Millisecond
+	if !c.behind {
+		c.regressions.Inc()
+		level.Warn(c.logger).Log("clock_regression", behind, "msg", "clock went back, holding record IDs at the latest ID's time")
+		c.behind = true
+	}
+	refusing := c.limit > 0 && behind > c.limit
+	switch {
+	case refusing && !c.refusing:
+		level.Error(c.logger).Log("clock_regression", behind, "limit", c.limit, "msg", "refusing ingest")
+	case !refusing && c.refusing:
+		level.Info(c.logger).Log("clock_regression", behind, "limit", c.limit, "msg", "accepting ingest again")
+	}
+	c.refusing = refusing
+	return c.last, behind
+}
+
+// regressionError is returned by an IDClock reader while the clock is too far
+// behind. Clients are told so as they are of a skewed clock, with
+// ClockSkewed, since other ingesters may well be fine.
+type regressionError struct {
+	behind time.Duration
+	limit  time.Duration
+}
+
+func (e regressionError) Error() string {
+	return fmt.Sprintf("ingester's clock went back %s, over the limit of %s", e.behind, e.limit)
+}
@@ -0,0 +1,159 @@
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestIDClock(t *testing.T) {
+	t.Parallel()
+
+	var (
+		counters = prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"counter"})
+		c        = NewIDClock(5*time.Minute, counters.WithLabelValues("regressions"), counters.WithLabelValues("refused"), nil)
+		t0       = time.Unix(1500000000, 0)
+		now      time.Time
+		newID    = NewMonotonicIDs(func() io.Reader { return rand.New(rand.NewSource(1)) }).newStream()
+		r        = c.Reader(func() ([]byte, error) { return []byte("topic record\n"), nil })
+		last     string
+	)
+	c.now = func() time.Time { return now }
+	for _, testcase := range []struct {
+		name        string
+		now         time.Time
+		want        time.Time // of the ID
+		refused     bool
+		regressions float64
+	}{
+		{"start", t0, t0, false, 0},
+		{"forward", t0.Add(time.Second), t0.Add(time.Second), false, 0},
+		{"back a little", t0.Add(-time.Second), t0.Add(time.Second), false, 1},
+		{"still behind", t0, t0.Add(time.Second), false, 1},
+		{"caught up", t0.Add(2 * time.Second), t0.Add(2 * time.Second), false, 1},
+		{"back a lot", t0.Add(-10 * time.Minute), t0.Add(2 * time.Second), true, 2},
+		{"within the limit", t0.Add(-4 * time.Minute), t0.Add(2 * time.Second), false, 2},
+		{"back again", t0.Add(-6 * time.Minute), t0.Add(2 * time.Second), true, 2},
+		{"caught up again", t0.Add(time.Minute), t0.Add(time.Minute), false, 2},
+	} {
+		now = testcase.now
+		_, err := r()
+		if want, have := testcase.refused, err != nil; want != have {
+			t.Errorf("%s: want refused %v, have %v (%v)", testcase.name, want, have, err)
+		}
+		if _, ok := err.(regressionError); err != nil && !ok {
+			t.Errorf("%s: want regressionError, have %T", testcase.name, err)
+		}
+		ms := c.Now()
+		if want, have := ulid.Timestamp(testcase.want), ms; want != have {
+			t.Errorf("%s: want ID time %d, have %d", testcase.name, want, have)
+		}
+		if want, have := testcase.regressions, counterValue(t, counters, "regressions"); want != have {
+			t.Errorf("%s: want %v regressions, have %v", testcase.name, want, have)
+		}
+
+		// IDs never go back, whatever the clock does.
+		id := newID(ms)
+		if id <= last {
+			t.Errorf("%s: want an ID after %s, have %s", testcase.name, last, id)
+		}
+		last = id
+	}
+	if want, have := 2.0, counterValue(t, counters, "refused"); want != have {
+		t.Errorf("want %v refused records, have %v", want, have)
+	}
+
+	// Without a limit, records are never refused.
+	c = NewIDClock(0, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}), nil)
+	c.now = func() time.Time { return now }
+	c.Now()
+	now = now.Add(-time.Hour)
+	if err := c.check(); err != nil {
+		t.Errorf("no limit: want no error, have %v", err)
+	}
+
+	// A nil IDClock follows the clock, and accepts everything.
+	var none *IDClock
+	if _, err := none.Reader(func() ([]byte, error) { return []byte("topic record\n"), nil })(); err != nil {
+		t.Errorf("nil IDClock: want no error, have %v", err)
+	}
+	if have := none.Now(); have == 0 {
+		t.Errorf("nil IDClock: want the time, have %d", have)
+	}
+}
+
+func TestHandleConnectionsClockRegressed(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mtx sync.Mutex
+		now = time.Now()
+		c   = NewIDClock(5*time.Minute, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}), nil)
+	)
+	c.now = func() time.Time {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return now
+	}
+	c.Now()
+	go HandleConnections(ln, ConnectionConfig{
+		Handler:          HandleFastWriter,
+		ReaderFactory:    record.NewDynamicReader,
+		Log:              log,
+		SegmentFlushAge:  time.Hour,
+		SegmentFlushSize: 1024 * 1024,
+		IDClock:          c,
+		ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+		Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+		Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+	})
+
+	// While our clock is too far back, clients are told so, as they are of
+	// a skewed clock, and disconnected, at their first record.
+	mtx.Lock()
+	now = now.Add(-10 * time.Minute)
+	mtx.Unlock()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "topic record\n")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := ClockSkewed+" ingester's clock went back 10m0s, over the limit of 5m0s\n", line; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if _, err := io.Copy(ioutil.Discard, conn); err != nil {
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			t.Errorf("never disconnected")
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package ingest
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+// MonotonicIDs gives the records of each connection IDs per the ULID spec's
+// monotonicity extension: the first ID of a millisecond has random entropy,
+// and the rest of that millisecond's increment it, so records read in
+// sequence on one connection sort in that sequence, whatever the rate.
+//
+// By default, each connection's IDs have a random prefix, fixed for the
+// connection, and a counter; they're ordered, too, but most of their entropy
+// bytes are the same. MonotonicIDs draws fresh entropy every millisecond
+// instead, which is what other ULID implementations expect of them.
+type MonotonicIDs struct {
+	entropy func() io.Reader
+}
+
+// NewMonotonicIDs returns MonotonicIDs that draw the entropy of each
+// connection from a reader returned by entropy, which is called once per
+// connection, and needn't be safe for concurrent use; reads that fail panic.
+// If entropy is nil, each connection has its own math/rand source, seeded by
+// the time. Tests may inject a deterministic source.
+func NewMonotonicIDs(entropy func() io.Reader) *MonotonicIDs {
+	if entropy == nil {
+		entropy = func() io.Reader { return rand.New(rand.NewSource(time.Now().UnixNano())) }
+	}
+	return &MonotonicIDs{entropy: entropy}
+}
+
+// newStream returns the ID generator of a new stream of records, e.g. a
+// connection's, which returns the ID of a record at a millisecond
+// timestamp. It's not safe for concurrent use. A nil MonotonicIDs returns a
+// generator on a new streamClock.
+func (m *MonotonicIDs) newStream() func(ms uint64) string {
+	if m == nil {
+		clock := newStreamClock()
+		return func(ms uint64) string { return ulid.MustNew(ms, clock).String() }
+	}
+	s := monotonicStream{entropy: m.entropy()}
+	return s.next
+}
+
+// monotonicStream generates the IDs of one stream of records.
+type monotonicStream struct {
+	entropy io.Reader
+	ms      uint64
+	last    [10]byte
+	started bool
+}
+
+// next returns the ID of a record at ms. Within the same millisecond as the
+// last, the ID is the last one's, incremented; if the 80 bits of entropy
+// overflow, which they're astronomically unlikely to, it moves on to the next
+// millisecond. Any other millisecond, e.g. an earlier one a client's
+// timestamp gave, starts afresh.
+func (s *monotonicStream) next(ms uint64) string {
+	if !s.started || ms != s.ms {
+		s.fill(ms)
+	} else if !increment(s.last[:]) {
+		s.fill(s.ms + 1)
+	}
+	return ulid.MustNew(s.ms, bytes.NewReader(s.last[:])).String()
+}
+
+// fill draws fresh entropy for the first ID of a millisecond.
+func (s *monotonicStream) fill(ms uint64) {
+	if _, err := io.ReadFull(s.entropy, s.last[:]); err != nil {
+		panic(err)
+	}
+	s.ms, s.started = ms, true
+}
+
+// increment b, as a big-endian integer, by 1. It returns false if it
+// overflows, wrapping b to zero.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
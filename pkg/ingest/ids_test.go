@@ -0,0 +1,154 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestMonotonicIDs(t *testing.T) {
+	t.Parallel()
+
+	entropy := func(b ...byte) func() io.Reader {
+		return func() io.Reader { return bytes.NewReader(b) }
+	}
+	for _, testcase := range []struct {
+		name    string
+		entropy func() io.Reader
+		ms      []uint64
+		want    []string // ms and entropy, in hex
+	}{
+		{
+			name:    "same millisecond",
+			entropy: entropy(0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0xfe),
+			ms:      []uint64{1, 1, 1},
+			want:    []string{"1 000000000000000001fe", "1 000000000000000001ff", "1 00000000000000000200"},
+		},
+		{
+			name: "next millisecond",
+			entropy: entropy(
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0x09,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0x03,
+			),
+			ms:   []uint64{1, 1, 2},
+			want: []string{"1 00000000000000000009", "1 0000000000000000000a", "2 00000000000000000003"},
+		},
+		{
+			name: "earlier millisecond",
+			entropy: entropy(
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0x09,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0x03,
+			),
+			ms:   []uint64{5, 4},
+			want: []string{"5 00000000000000000009", "4 00000000000000000003"},
+		},
+		{
+			name: "overflow",
+			entropy: entropy(
+				0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0x07,
+			),
+			ms:   []uint64{1, 1},
+			want: []string{"1 ffffffffffffffffffff", "2 00000000000000000007"},
+		},
+	} {
+		newID := NewMonotonicIDs(testcase.entropy).newStream()
+		var have []string
+		for _, ms := range testcase.ms {
+			id := ulid.MustParse(newID(ms))
+			have = append(have, fmt.Sprintf("%d %x", id.Time(), id.Entropy()))
+		}
+		if want, have := fmt.Sprint(testcase.want), fmt.Sprint(have); want != have {
+			t.Errorf("%s: want %s, have %s", testcase.name, want, have)
+		}
+	}
+}
+
+func TestHandleConnectionsMonotonicIDs(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The handler keeps each record with the ID it's given, as it would be
+	// written to the segment.
+	results := make(chan []string, 1)
+	capture := func(r record.Reader, w *Writer, idGen IDGenerator, connectedClients prometheus.Gauge) error {
+		var records []string
+		for {
+			rec, err := r()
+			if err != nil {
+				results <- records
+				return err
+			}
+			records = append(records, idGen()+" "+string(rec))
+		}
+	}
+	ids := NewMonotonicIDs(func() io.Reader { return rand.New(rand.NewSource(1)) })
+	go HandleConnections(ln, ConnectionConfig{
+		Handler:          capture,
+		ReaderFactory:    record.NewDynamicReader,
+		Log:              log,
+		SegmentFlushAge:  time.Hour,
+		SegmentFlushSize: 1024 * 1024,
+		IDs:              ids,
+		ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+		Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+		Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+	})
+
+	// Plenty of records, so many share a millisecond.
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	const n = 10000
+	var input bytes.Buffer
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&input, "topic record %05d\n", i)
+	}
+	conn.Write(input.Bytes())
+	conn.(*net.TCPConn).CloseWrite()
+
+	var records []string
+	select {
+	case records = <-results:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for records")
+	}
+	if want, have := n, len(records); want != have {
+		t.Fatalf("want %d records, have %d", want, have)
+	}
+
+	// Queries return records in ID order, which is the order they were
+	// written in.
+	sorted := append([]string(nil), records...)
+	sort.Strings(sorted)
+	for i, r := range sorted {
+		if want, have := fmt.Sprintf("topic record %05d\n", i), r[ulid.EncodedSize+1:]; want != have {
+			t.Fatalf("record %d: want %q, have %q", i, want, have)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package ingest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Lag is how far behind the consumers of an ingest log are: the segments that
+// are sealed, i.e. flushed, or pending with a consumer, but not committed,
+// and the age of the oldest record in them, by its ID. Once every segment is
+// consumed, there's no lag, however long ago the last record was written.
+//
+// The Watermark is the time before which every record written to the log has
+// been consumed, i.e. is in the stores, and so in the results of queries: the
+// time of the oldest record that's yet to be, sealed or active, or else of
+// the check. See the store's wait_for_fresh query parameter.
+type Lag struct {
+	Segments   int64     `json:"segments"`
+	Bytes      int64     `json:"bytes"`
+	Oldest     time.Time `json:"oldest"` // zero if there are no segments
+	LagSeconds float64   `json:"lag_seconds"`
+	Watermark  time.Time `json:"watermark"`
+	Updated    time.Time `json:"updated"`
+}
+
+// LagMonitor tracks the lag of the ingest log, and serves it on the lag
+// endpoint. It should be mounted at APIPathLag.
+type LagMonitor struct {
+	log      Log
+	interval time.Duration
+	segments prometheus.Gauge
+	bytes    prometheus.Gauge
+	seconds  prometheus.Gauge
+	logger   log.Logger
+	now      func() time.Time
+	stop     chan chan struct{}
+
+	mtx sync.Mutex
+	lag Lag
+}
+
+// NewLagMonitor returns a LagMonitor of the log, which it checks every
+// interval. Each check sets the gauges of the sealed segments, their bytes,
+// and the lag, in seconds.
+func NewLagMonitor(
+	log Log,
+	interval time.Duration,
+	segments, bytes, seconds prometheus.Gauge,
+	logger log.Logger,
+) *LagMonitor {
+	return &LagMonitor{
+		log:      log,
+		interval: interval,
+		segments: segments,
+		bytes:    bytes,
+		seconds:  seconds,
+		logger:   nopIfNil(logger),
+		now:      time.Now,
+		stop:     make(chan chan struct{}),
+	}
+}
+
+// Run checks the lag, immediately and then every interval, until Stop.
+func (m *LagMonitor) Run() {
+	m.Check()
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.Check()
+		case q := <-m.stop:
+			close(q)
+			return
+		}
+	}
+}
+
+// Stop the monitor from checking.
+func (m *LagMonitor) Stop() {
+	q := make(chan struct{})
+	m.stop <- q
+	<-q
+}
+
+// Check the lag now, and return it.
+func (m *LagMonitor) Check() Lag {
+	stats, err := m.log.Stats()
+	if err != nil {
+		level.Warn(m.logger).Log("during", "lag check", "err", err)
+		return m.Lag()
+	}
+	now := m.now()
+	lag := Lag{
+		Segments: stats.FlushedSegments + stats.PendingSegments,
+		Bytes:    stats.FlushedBytes + stats.PendingBytes,
+		Oldest:   stats.OldestSealed,
+		Updated:  now.UTC(),
+	}
+	lag.Watermark = oldestOf(now, oldestOf(stats.OldestSealed, stats.OldestActive)).UTC()
+	if !lag.Oldest.IsZero() && now.After(lag.Oldest) {
+		lag.LagSeconds = now.Sub(lag.Oldest).Seconds()
+	}
+
+	m.mtx.Lock()
+	m.lag = lag
+	m.mtx.Unlock()
+
+	m.segments.Set(float64(lag.Segments))
+	m.bytes.Set(float64(lag.Bytes))
+	m.seconds.Set(lag.LagSeconds)
+	return lag
+}
+
+// Lag returns the lag as of the latest check.
+func (m *LagMonitor) Lag() Lag {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.lag
+}
+
+// ServeHTTP serves the lag as of the latest check, as JSON, or, with the
+// fresh query parameter, of a check made now, e.g. for a query's watermark.
+func (m *LagMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lag := m.Lag()
+	if _, fresh := r.URL.Query()["fresh"]; fresh {
+		lag = m.Check()
+	}
+	buf, err := json.MarshalIndent(lag, "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(buf)
+}
@@ -0,0 +1,137 @@
+package ingest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestLagMonitor(t *testing.T) {
+	t.Parallel()
+
+	log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		gauges = prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"gauge"})
+		m      = NewLagMonitor(log, time.Hour, gauges.WithLabelValues("segments"), gauges.WithLabelValues("bytes"), gauges.WithLabelValues("seconds"), nil)
+		now    = time.Unix(1500000000, 0)
+	)
+	m.now = func() time.Time { return now }
+	gauge := func(name string) float64 {
+		var metric dto.Metric
+		gauges.WithLabelValues(name).Write(&metric)
+		return metric.GetGauge().GetValue()
+	}
+	write := func(contents ...string) {
+		w, err := log.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(w, strings.Join(contents, ""))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record := func(age time.Duration) string {
+		return fmt.Sprintf("%s record\n", ulid.MustNew(ulid.Timestamp(now.Add(-age)), nil))
+	}
+
+	// A backlog of known ages: the lag is that of the oldest record, in
+	// any segment, not the oldest segment's first.
+	write(record(2*time.Minute), record(time.Minute))
+	write(record(10*time.Minute), record(9*time.Minute))
+	write("no ID\n")
+	lag := m.Check()
+	if want, have := int64(3), lag.Segments; want != have {
+		t.Errorf("want %d segments, have %d", want, have)
+	}
+	if want, have := now.Add(-10*time.Minute).UTC(), lag.Oldest; !want.Equal(have) {
+		t.Errorf("want oldest %s, have %s", want, have)
+	}
+	if want, have := 600., lag.LagSeconds; want != have {
+		t.Errorf("want lag %v, have %v", want, have)
+	}
+	if want, have := now.Add(-10*time.Minute).UTC(), lag.Watermark; !want.Equal(have) {
+		t.Errorf("want watermark %s, have %s", want, have)
+	}
+	for name, want := range map[string]float64{"segments": 3, "bytes": float64(lag.Bytes), "seconds": 600} {
+		if have := gauge(name); want != have {
+			t.Errorf("gauge %s: want %v, have %v", name, want, have)
+		}
+	}
+
+	// Segments pending with a consumer are still behind, until they're
+	// committed.
+	var segments []ReadSegment
+	for {
+		s, err := log.Oldest()
+		if err == ErrNoSegmentsAvailable {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		segments = append(segments, s)
+	}
+	if want, have := 600., m.Check().LagSeconds; want != have {
+		t.Errorf("pending: want lag %v, have %v", want, have)
+	}
+	for _, s := range segments {
+		if err := s.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Idle, with everything consumed, there's no lag, however much later the
+	// check, and everything before it is consumed.
+	now = now.Add(time.Hour)
+	if want, have := (Lag{Watermark: now.UTC(), Updated: now.UTC()}), m.Check(); want != have {
+		t.Errorf("idle: want %+v, have %+v", want, have)
+	}
+	if want, have := 0., gauge("seconds"); want != have {
+		t.Errorf("idle: want lag gauge %v, have %v", want, have)
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", APIPathLag, nil))
+	if want, have := http.StatusOK, w.Code; want != have {
+		t.Errorf("GET: want HTTP %d, have %d", want, have)
+	}
+	if want, have := `"lag_seconds": 0`, w.Body.String(); !strings.Contains(have, want) {
+		t.Errorf("GET: want %s, have %s", want, have)
+	}
+
+	// Records still being written aren't lag, as they aren't sealed, but
+	// they're yet to be consumed, so they hold the watermark back. Without
+	// fresh, the lag is that of the last check, from before they were.
+	active, err := log.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer active.Close()
+	fmt.Fprint(active, record(time.Second))
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", APIPathLag, nil))
+	if want, have := fmt.Sprintf(`"watermark": "%s"`, now.UTC().Format(time.RFC3339)), w.Body.String(); !strings.Contains(have, want) {
+		t.Errorf("GET: want %s, have %s", want, have)
+	}
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", APIPathLag+"?fresh=true", nil))
+	if want, have := fmt.Sprintf(`"watermark": "%s"`, now.Add(-time.Second).UTC().Format(time.RFC3339)), w.Body.String(); !strings.Contains(have, want) {
+		t.Errorf("GET fresh: want %s, have %s", want, have)
+	}
+	if want, have := 0., m.Lag().LagSeconds; want != have {
+		t.Errorf("active: want lag %v, have %v", want, have)
+	}
+}
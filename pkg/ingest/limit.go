@@ -0,0 +1,194 @@
+package ingest
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// Rate limits apply per connection, and to the node as a whole.
+const (
+	limitScopeConnection = "connection"
+	limitScopeGlobal     = "global"
+	limitScopeHold       = "hold"
+)
+
+// Limiter caps the rate at which records are read from connections, in
+// records and bytes per second. Each connection has its own limit, and all
+// connections share a global limit. A connection over either limit isn't read
+// from until it's back under, which pushes back on the client, rather than
+// dropping its records. A zero limit means unlimited.
+type Limiter struct {
+	connRecords      float64
+	connBytes        float64
+	globalRecords    *tokenBucket
+	globalBytes      *tokenBucket
+	throttledConns   *prometheus.CounterVec
+	throttledSeconds *prometheus.CounterVec
+	now              func() time.Time
+	sleep            func(time.Duration)
+
+	mtx      sync.Mutex
+	released chan struct{} // non-nil while held; closed by release
+}
+
+// NewLimiter returns a Limiter with the given per-connection and global
+// limits. The counters are partitioned by scope, "connection" or "global".
+// throttledConns counts connections that were ever throttled, and
+// throttledSeconds the time spent waiting.
+func NewLimiter(
+	connRecords, connBytes float64,
+	globalRecords, globalBytes float64,
+	throttledConns, throttledSeconds *prometheus.CounterVec,
+) *Limiter {
+	return newLimiter(
+		connRecords, connBytes,
+		globalRecords, globalBytes,
+		throttledConns, throttledSeconds,
+		time.Now, time.Sleep,
+	)
+}
+
+func newLimiter(
+	connRecords, connBytes float64,
+	globalRecords, globalBytes float64,
+	throttledConns, throttledSeconds *prometheus.CounterVec,
+	now func() time.Time,
+	sleep func(time.Duration),
+) *Limiter {
+	return &Limiter{
+		connRecords:      connRecords,
+		connBytes:        connBytes,
+		globalRecords:    newTokenBucket(globalRecords, now()),
+		globalBytes:      newTokenBucket(globalBytes, now()),
+		throttledConns:   throttledConns,
+		throttledSeconds: throttledSeconds,
+		now:              now,
+		sleep:            sleep,
+	}
+}
+
+// Reader wraps the record.Reader for a single connection. Each record is
+// returned only once the connection and the node are within their limits.
+// A nil Limiter returns r unchanged.
+func (l *Limiter) Reader(r record.Reader) record.Reader {
+	if l == nil {
+		return r
+	}
+	var (
+		connRecords = newTokenBucket(l.connRecords, l.now())
+		connBytes   = newTokenBucket(l.connBytes, l.now())
+		throttled   = map[string]bool{}
+	)
+	return func() ([]byte, error) {
+		record, err := r()
+		if err != nil {
+			return record, err
+		}
+		l.wait(limitScopeConnection, connRecords, connBytes, len(record), throttled)
+		l.wait(limitScopeGlobal, l.globalRecords, l.globalBytes, len(record), throttled)
+		l.waitHeld(throttled)
+		return record, nil
+	}
+}
+
+// Hold stops every connection from being read, as if it were over its limit,
+// e.g. while the disk is nearly full, until it's released. Records that were
+// already read when the hold began are held, too, rather than written.
+// Connections that are held can't be shut down, so the Limiter should be
+// released ahead of that.
+func (l *Limiter) Hold(hold bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	switch {
+	case hold && l.released == nil:
+		l.released = make(chan struct{})
+	case !hold && l.released != nil:
+		close(l.released)
+		l.released = nil
+	}
+}
+
+// waitHeld waits for the Limiter to be released, if it's held.
+func (l *Limiter) waitHeld(throttled map[string]bool) {
+	l.mtx.Lock()
+	released := l.released
+	l.mtx.Unlock()
+	if released == nil {
+		return
+	}
+	if !throttled[limitScopeHold] {
+		throttled[limitScopeHold] = true
+		l.throttledConns.WithLabelValues(limitScopeHold).Inc()
+	}
+	begin := l.now()
+	<-released
+	l.throttledSeconds.WithLabelValues(limitScopeHold).Add(l.now().Sub(begin).Seconds())
+}
+
+// wait takes a record of n bytes from the buckets for a scope, and sleeps
+// until they can afford it.
+func (l *Limiter) wait(scope string, records, bytes *tokenBucket, n int, throttled map[string]bool) {
+	now := l.now()
+	d := records.take(1, now)
+	if bd := bytes.take(float64(n), now); bd > d {
+		d = bd
+	}
+	if d <= 0 {
+		return
+	}
+	if !throttled[scope] {
+		throttled[scope] = true
+		l.throttledConns.WithLabelValues(scope).Inc()
+	}
+	l.throttledSeconds.WithLabelValues(scope).Add(d.Seconds())
+	l.sleep(d)
+}
+
+// tokenBucket fills at rate tokens per second, up to a burst of one second's
+// worth. Takes may overdraw the bucket, so that a record bigger than the
+// burst eventually gets through; the debt is paid off before the next take
+// succeeds. A nil tokenBucket is unlimited.
+type tokenBucket struct {
+	mtx    sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	burst := math.Max(rate, 1)
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+// take removes n tokens from the bucket, and returns how long the caller
+// should wait before using them.
+func (b *tokenBucket) take(n float64, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
@@ -0,0 +1,162 @@
+package ingest
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestLimiterThroughput(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name          string
+		connRecords   float64
+		connBytes     float64
+		globalRecords float64
+		globalBytes   float64
+		conns         int
+		recordSize    int
+		wantRecords   float64 // per second, per connection
+		wantScope     string
+	}{
+		{"connection records", 100, 0, 0, 0, 1, 10, 100, limitScopeConnection},
+		{"connection bytes", 0, 1000, 0, 0, 1, 100, 10, limitScopeConnection},
+		{"tighter of records and bytes", 100, 1000, 0, 0, 1, 100, 10, limitScopeConnection},
+		{"global records", 0, 0, 100, 0, 4, 10, 25, limitScopeGlobal},
+		{"global bytes", 0, 0, 0, 4000, 2, 100, 20, limitScopeGlobal},
+		{"connection under global", 10, 0, 100, 0, 1, 10, 10, limitScopeConnection},
+		{"global under connection", 100, 0, 20, 0, 1, 10, 20, limitScopeGlobal},
+	} {
+		testcase := testcase
+		t.Run(testcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			// A fake clock, which sleeping advances.
+			var (
+				epoch = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+				now   = epoch
+				d     = 10 * time.Second
+			)
+			throttledConns := prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"scope"})
+			throttledSeconds := prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"scope"})
+			l := newLimiter(
+				testcase.connRecords, testcase.connBytes,
+				testcase.globalRecords, testcase.globalBytes,
+				throttledConns, throttledSeconds,
+				func() time.Time { return now },
+				func(d time.Duration) { now = now.Add(d) },
+			)
+
+			// Fast fake connections, read round robin, as fast as the
+			// limiter lets them. With one clock, their sleeps add up, so
+			// only one connection is used where per-connection limits bind.
+			p := append(bytes.Repeat([]byte{'x'}, testcase.recordSize-1), '\n')
+			readers := make([]record.Reader, testcase.conns)
+			for i := range readers {
+				readers[i] = l.Reader(func() ([]byte, error) { return p, nil })
+			}
+			var n int
+			for now.Sub(epoch) < d {
+				for _, r := range readers {
+					if _, err := r(); err != nil {
+						t.Fatal(err)
+					}
+					n++
+				}
+			}
+
+			// Discount the initial burst, of one second's worth.
+			want := testcase.wantRecords * float64(testcase.conns)
+			have := (float64(n) - want) / now.Sub(epoch).Seconds()
+			if math.Abs(want-have)/want > 0.02 {
+				t.Errorf("want %.1f records/sec, have %.1f", want, have)
+			}
+			if want, have := float64(testcase.conns), counterValue(t, throttledConns, testcase.wantScope); want != have {
+				t.Errorf("throttled connections: want %v, have %v", want, have)
+			}
+			if have := counterValue(t, throttledSeconds, testcase.wantScope); have < 0.9*d.Seconds() {
+				t.Errorf("throttled seconds: want about %v, have %v", d.Seconds(), have)
+			}
+		})
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	t.Parallel()
+
+	throttledConns := prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"scope"})
+	throttledSeconds := prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"scope"})
+	l := newLimiter(
+		0, 0, 0, 0,
+		throttledConns, throttledSeconds,
+		time.Now,
+		func(time.Duration) { t.Fatal("unlimited reader slept") },
+	)
+	r := l.Reader(func() ([]byte, error) { return []byte("topic hello\n"), nil })
+	for i := 0; i < 10000; i++ {
+		if _, err := r(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, scope := range []string{limitScopeConnection, limitScopeGlobal} {
+		if want, have := 0.0, counterValue(t, throttledConns, scope); want != have {
+			t.Errorf("%s: want %v, have %v", scope, want, have)
+		}
+	}
+}
+
+func TestLimiterHold(t *testing.T) {
+	t.Parallel()
+
+	throttledConns := prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"scope"})
+	throttledSeconds := prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"scope"})
+	l := NewLimiter(0, 0, 0, 0, throttledConns, throttledSeconds)
+	r := l.Reader(func() ([]byte, error) { return []byte("topic hello\n"), nil })
+	if _, err := r(); err != nil {
+		t.Fatal(err)
+	}
+
+	// While the limiter is held, records aren't returned.
+	l.Hold(true)
+	l.Hold(true) // idempotent
+	records := make(chan []byte)
+	go func() {
+		for i := 0; i < 2; i++ {
+			record, err := r()
+			if err != nil {
+				t.Error(err)
+			}
+			records <- record
+		}
+	}()
+	select {
+	case <-records:
+		t.Fatal("held limiter returned a record")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Once it's released, they are, again.
+	l.Hold(false)
+	for i := 0; i < 2; i++ {
+		select {
+		case record := <-records:
+			if want, have := "topic hello\n", string(record); want != have {
+				t.Errorf("want %q, have %q", want, have)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for released record")
+		}
+	}
+	if want, have := 1.0, counterValue(t, throttledConns, limitScopeHold); want != have {
+		t.Errorf("throttled connections: want %v, have %v", want, have)
+	}
+	if have := counterValue(t, throttledSeconds, limitScopeHold); have < 0.05 {
+		t.Errorf("throttled seconds: want at least 0.05, have %v", have)
+	}
+}
@@ -0,0 +1,111 @@
+package ingest
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loadRateHalfLife is the half life of the ingest rate in a Load, which is
+// shorter than the SegmentSizer's, so clients see a change in traffic soon.
+const loadRateHalfLife = 10 * time.Second
+
+// Load is how busy an ingester is, as a hint for clients choosing which
+// to connect to. A client gets it with FeatureLoad, in the answer to its
+// HelloHandshake, as "load=<connections>:<bytes per second>", in place of the
+// feature, e.g. "OKLOG/1 acks,load=12:524288".
+type Load struct {
+	Connections    int   // writing records, i.e. past their handshakes
+	BytesPerSecond int64 // read from connections, as an exponentially weighted moving average
+}
+
+// String returns the Load as it's given in an answer to a hello.
+func (l Load) String() string {
+	return fmt.Sprintf("%s=%d:%d", FeatureLoad, l.Connections, l.BytesPerSecond)
+}
+
+// ParseLoad returns the Load among the features of an answer to a hello, and
+// whether there was one.
+func ParseLoad(features []string) (Load, bool) {
+	for _, f := range features {
+		if !strings.HasPrefix(f, FeatureLoad+"=") {
+			continue
+		}
+		fields := strings.SplitN(strings.TrimPrefix(f, FeatureLoad+"="), ":", 2)
+		if len(fields) != 2 {
+			return Load{}, false
+		}
+		conns, err := strconv.Atoi(fields[0])
+		if err != nil || conns < 0 {
+			return Load{}, false
+		}
+		bps, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || bps < 0 {
+			return Load{}, false
+		}
+		return Load{Connections: conns, BytesPerSecond: bps}, true
+	}
+	return Load{}, false
+}
+
+// loadMeter measures the Load of the connections of HandleConnections.
+type loadMeter struct {
+	mtx   sync.Mutex
+	conns int
+	rate  rateEstimator
+	now   func() time.Time
+}
+
+func newLoadMeter() *loadMeter {
+	return &loadMeter{
+		rate: rateEstimator{tick: ingestRateTick, halfLife: loadRateHalfLife},
+		now:  time.Now,
+	}
+}
+
+// connected counts a connection, until the returned func is called.
+func (m *loadMeter) connected() (disconnected func()) {
+	m.mtx.Lock()
+	m.conns++
+	m.mtx.Unlock()
+	return func() {
+		m.mtx.Lock()
+		m.conns--
+		m.mtx.Unlock()
+	}
+}
+
+// reader returns r, counting what's read from it.
+func (m *loadMeter) reader(r io.Reader) io.Reader {
+	return &loadReader{r, m}
+}
+
+func (m *loadMeter) observe(n int) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.rate.observe(n, m.now())
+}
+
+// load returns the Load, as of now.
+func (m *loadMeter) load() Load {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.rate.observe(0, m.now()) // so a quiet spell counts
+	return Load{Connections: m.conns, BytesPerSecond: int64(m.rate.rate)}
+}
+
+type loadReader struct {
+	r io.Reader
+	m *loadMeter
+}
+
+func (r *loadReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.m.observe(n)
+	}
+	return n, err
+}
@@ -0,0 +1,75 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLoad(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		features []string
+		want     Load
+		ok       bool
+	}{
+		{[]string{"acks", "load=12:524288"}, Load{12, 524288}, true},
+		{[]string{"load=0:0"}, Load{}, true},
+		{[]string{"acks"}, Load{}, false},
+		{[]string{"load"}, Load{}, false}, // not answered, but echoed
+		{[]string{"load=12"}, Load{}, false},
+		{[]string{"load=-1:0"}, Load{}, false},
+		{[]string{"load=a:b"}, Load{}, false},
+		{nil, Load{}, false},
+	} {
+		have, ok := ParseLoad(testcase.features)
+		if want := testcase.ok; want != ok {
+			t.Errorf("%q: want ok %v, have %v", testcase.features, want, ok)
+		}
+		if want := testcase.want; want != have {
+			t.Errorf("%q: want %+v, have %+v", testcase.features, want, have)
+		}
+	}
+	if load, ok := ParseLoad([]string{Load{3, 1024}.String()}); !ok || load != (Load{3, 1024}) {
+		t.Errorf("want %+v to round-trip, have %+v", Load{3, 1024}, load)
+	}
+}
+
+func TestLoadMeter(t *testing.T) {
+	t.Parallel()
+
+	var (
+		m   = newLoadMeter()
+		now = time.Unix(0, 0)
+	)
+	m.now = func() time.Time { return now }
+
+	a, b := m.connected(), m.connected()
+	if want, have := 2, m.load().Connections; want != have {
+		t.Errorf("want %d connections, have %d", want, have)
+	}
+	a()
+	if want, have := 1, m.load().Connections; want != have {
+		t.Errorf("want %d connections, have %d", want, have)
+	}
+	b()
+
+	// 64KB read a second after the last load, then quiet, which decays
+	// the rate.
+	r := m.reader(strings.NewReader(strings.Repeat("x", 64*1024)))
+	now = now.Add(time.Second)
+	if n, err := r.Read(make([]byte, 64*1024)); err != nil || n != 64*1024 {
+		t.Fatalf("read %d bytes: %v", n, err)
+	}
+	if want, have := int64(64*1024), m.load().BytesPerSecond; want != have {
+		t.Errorf("want %d bytes per second, have %d", want, have)
+	}
+	now = now.Add(loadRateHalfLife)
+	if want, have := int64(32*1024), m.load().BytesPerSecond; want != have {
+		t.Errorf("after a half life: want %d bytes per second, have %d", want, have)
+	}
+	if want, have := 0, m.load().Connections; want != have {
+		t.Errorf("want %d connections, have %d", want, have)
+	}
+}
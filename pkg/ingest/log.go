@@ -3,14 +3,17 @@ package ingest
 import (
 	"errors"
 	"io"
+	"time"
 )
 
 // Log is an abstraction for segments on an ingest node.
 // A new active segment may be created and written to.
-// The oldest flushed segment may be selected and read from.
+// The oldest flushed segment may be selected and read from, or the oldest
+// that a consumer accepts, given the segment's ID and when it was flushed.
 type Log interface {
 	Create() (WriteSegment, error)
 	Oldest() (ReadSegment, error)
+	OldestWhere(accept func(id string, flushed time.Time) bool) (ReadSegment, error)
 	Stats() (LogStats, error)
 	Close() error
 }
@@ -29,11 +32,13 @@ type WriteSegment interface {
 // ReadSegment is a segment that can be read from.
 // Once read, it may be committed and thus deleted.
 // Or it may be failed, and made available for selection again.
+// It has the labels of the node that ingested it, encoded by cluster.Labels.
 type ReadSegment interface {
 	io.Reader
 	Commit() error
 	Failed() error
 	Size() int64
+	Labels() string
 }
 
 // ErrNoSegmentsAvailable is returned by IngestLog Oldest,
@@ -48,4 +53,12 @@ type LogStats struct {
 	FlushedBytes    int64
 	PendingSegments int64
 	PendingBytes    int64
+
+	// OldestSealed is the time of the oldest record in a flushed or pending
+	// segment, by its ID, or zero if there are none.
+	OldestSealed time.Time
+
+	// OldestActive is the time of the oldest record in an active segment,
+	// by its ID, or zero if there are none.
+	OldestActive time.Time
 }
@@ -0,0 +1,306 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// SourceHandshake starts the line a client may write first, to identify the
+// source of its records for quotas: "SOURCE <id>". It comes before any
+// record.FramingHandshake.
+const SourceHandshake = "SOURCE"
+
+// QuotaExceeded starts the line an ingester writes to a client before it
+// closes the connection, because the client's source is over its daily byte
+// quota. The rest of the line says which source, and what its quota is.
+const QuotaExceeded = "QUOTA"
+
+// DefaultSource is the source of clients that don't identify themselves,
+// or whose source isn't in the quotas.
+const DefaultSource = "default"
+
+// Quota limits the records from a source. A zero limit means unlimited.
+type Quota struct {
+	RecordsPerSecond float64
+	BytesPerDay      int64
+}
+
+// ParseQuotas parses quotas, one source per line: its ID, then any of
+// records-per-second=N and bytes-per-day=N. Blank lines, and everything
+// after a #, are ignored. Sources that aren't listed share the quota of
+// DefaultSource, which is unlimited unless it's listed too.
+func ParseQuotas(r io.Reader) (map[string]Quota, error) {
+	var (
+		quotas = map[string]Quota{}
+		s      = bufio.NewScanner(r)
+		n      int
+	)
+	for s.Scan() {
+		n++
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		source := fields[0]
+		if _, ok := quotas[source]; ok {
+			return nil, errors.Errorf("line %d: source %s is listed twice", n, source)
+		}
+		var q Quota
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, errors.Errorf("line %d: %q isn't key=value", n, field)
+			}
+			var err error
+			switch kv[0] {
+			case "records-per-second":
+				q.RecordsPerSecond, err = strconv.ParseFloat(kv[1], 64)
+				if err == nil && q.RecordsPerSecond < 0 {
+					err = errors.New("must not be negative")
+				}
+			case "bytes-per-day":
+				q.BytesPerDay, err = strconv.ParseInt(kv[1], 10, 64)
+				if err == nil && q.BytesPerDay < 0 {
+					err = errors.New("must not be negative")
+				}
+			default:
+				err = errors.New("unknown key, want records-per-second or bytes-per-day")
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d: %s", n, kv[0])
+			}
+		}
+		quotas[source] = q
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return quotas, nil
+}
+
+// Quotas enforces a Quota per source, shared by all of the source's
+// connections to this node. A source over its record rate isn't read from
+// until it's back under, like with Limiter. A source over its daily byte
+// quota has its records rejected, and its connections closed, until the
+// next day, in UTC. Quotas are per node: a source may send its quota to
+// each ingester.
+type Quotas struct {
+	mtx              sync.RWMutex
+	quotas           map[string]Quota
+	sources          map[string]*sourceQuota
+	records          *prometheus.CounterVec
+	bytes            *prometheus.CounterVec
+	bytesToday       *prometheus.GaugeVec
+	throttledSeconds *prometheus.CounterVec
+	rejectedRecords  *prometheus.CounterVec
+	now              func() time.Time
+	sleep            func(time.Duration)
+}
+
+// sourceQuota is the state of a source's quota on this node. Its quota and
+// records are guarded by the Quotas' mutex.
+type sourceQuota struct {
+	quota   Quota
+	records *tokenBucket
+
+	mtx   sync.Mutex
+	day   time.Time
+	bytes int64 // read on day
+}
+
+// NewQuotas returns Quotas enforcing the given quotas, which may be changed
+// later with Set. Each metric is partitioned by source, which is either a
+// source in the quotas, or DefaultSource. records and bytes count what's
+// read from each source, and bytesToday what's counted against its daily
+// quota; throttledSeconds counts the time spent waiting on record rates,
+// and rejectedRecords the records rejected by daily quotas.
+func NewQuotas(
+	quotas map[string]Quota,
+	records, bytes *prometheus.CounterVec,
+	bytesToday *prometheus.GaugeVec,
+	throttledSeconds, rejectedRecords *prometheus.CounterVec,
+) *Quotas {
+	return newQuotas(
+		quotas,
+		records, bytes,
+		bytesToday,
+		throttledSeconds, rejectedRecords,
+		time.Now, time.Sleep,
+	)
+}
+
+func newQuotas(
+	quotas map[string]Quota,
+	records, bytes *prometheus.CounterVec,
+	bytesToday *prometheus.GaugeVec,
+	throttledSeconds, rejectedRecords *prometheus.CounterVec,
+	now func() time.Time,
+	sleep func(time.Duration),
+) *Quotas {
+	q := &Quotas{
+		sources:          map[string]*sourceQuota{},
+		records:          records,
+		bytes:            bytes,
+		bytesToday:       bytesToday,
+		throttledSeconds: throttledSeconds,
+		rejectedRecords:  rejectedRecords,
+		now:              now,
+		sleep:            sleep,
+	}
+	q.Set(quotas)
+	return q
+}
+
+// Set replaces the quotas. What each source has read today still counts
+// against its new quota. Sources that are no longer listed fall into
+// DefaultSource.
+func (q *Quotas) Set(quotas map[string]Quota) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.quotas = quotas
+	if _, ok := quotas[DefaultSource]; !ok {
+		q.quotas = map[string]Quota{DefaultSource: {}}
+		for source, quota := range quotas {
+			q.quotas[source] = quota
+		}
+	}
+	for source, quota := range q.quotas {
+		s, ok := q.sources[source]
+		if !ok {
+			q.sources[source] = &sourceQuota{quota: quota, records: newTokenBucket(quota.RecordsPerSecond, q.now())}
+			continue
+		}
+		if s.quota.RecordsPerSecond != quota.RecordsPerSecond {
+			s.records = newTokenBucket(quota.RecordsPerSecond, q.now())
+		}
+		s.quota = quota
+	}
+}
+
+// Reader wraps the record.Reader for a connection from the source with the
+// ID, which may be empty. Each record is returned only once the source is
+// within its record rate. Once the source is over its daily byte quota, the
+// reader returns an error instead. A nil Quotas returns r unchanged.
+func (q *Quotas) Reader(id string, r record.Reader) record.Reader {
+	if q == nil {
+		return r
+	}
+	return func() ([]byte, error) {
+		record, err := r()
+		if err != nil {
+			return record, err
+		}
+		source, s, quota, records := q.lookup(id)
+		if err := q.count(source, s, quota, len(record)); err != nil {
+			return nil, err
+		}
+		if d := records.take(1, q.now()); d > 0 {
+			q.throttledSeconds.WithLabelValues(source).Add(d.Seconds())
+			q.sleep(d)
+		}
+		return record, nil
+	}
+}
+
+// lookup returns the name of the source with the ID, its state, and its
+// current quota and record rate bucket. Those may change with Set, so
+// they're looked up for every record.
+func (q *Quotas) lookup(id string) (string, *sourceQuota, Quota, *tokenBucket) {
+	q.mtx.RLock()
+	defer q.mtx.RUnlock()
+	if _, ok := q.quotas[id]; !ok {
+		id = DefaultSource
+	}
+	s := q.sources[id]
+	return id, s, s.quota, s.records
+}
+
+// count a record of n bytes against the source's daily quota, unless it
+// would put the source over it.
+func (q *Quotas) count(source string, s *sourceQuota, quota Quota, n int) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if today := q.now().UTC().Truncate(24 * time.Hour); !today.Equal(s.day) {
+		s.day, s.bytes = today, 0
+	}
+	if quota.BytesPerDay > 0 && s.bytes+int64(n) > quota.BytesPerDay {
+		q.rejectedRecords.WithLabelValues(source).Inc()
+		return quotaError{source: source, bytesPerDay: quota.BytesPerDay}
+	}
+	s.bytes += int64(n)
+	q.records.WithLabelValues(source).Inc()
+	q.bytes.WithLabelValues(source).Add(float64(n))
+	q.bytesToday.WithLabelValues(source).Set(float64(s.bytes))
+	return nil
+}
+
+// quotaError is returned by a Quotas reader once its source is over its
+// daily byte quota.
+type quotaError struct {
+	source      string
+	bytesPerDay int64
+}
+
+func (e quotaError) Error() string {
+	return fmt.Sprintf("source %s is over its quota of %d bytes per day", e.source, e.bytesPerDay)
+}
+
+// readSource reads the SourceHandshake from the start of r, if it's there,
+// and returns the source ID, or an empty string, and the rest of r.
+func readSource(r io.Reader) (string, io.Reader, error) {
+	ok, br, err := matchPrefix(r, SourceHandshake+" ")
+	if err != nil {
+		return "", nil, err
+	}
+	if !ok {
+		return "", br, nil
+	}
+	line, err := br.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", nil, errors.Wrap(err, "reading source handshake")
+	}
+	return strings.TrimSpace(line), br, nil
+}
+
+// matchPrefix reads the prefix from the start of r, if it's there, and
+// returns whether it was, and the rest of r. Bytes are read one at a time
+// until they can't be the prefix, so a client that doesn't send it isn't
+// kept waiting.
+func matchPrefix(r io.Reader, prefix string) (bool, *bufio.Reader, error) {
+	var (
+		br   = bufio.NewReader(r)
+		read []byte
+	)
+	for i := 0; i < len(prefix); i++ {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return false, bufio.NewReader(bytes.NewReader(read)), nil
+		}
+		if err != nil {
+			return false, nil, err
+		}
+		read = append(read, c)
+		if c != prefix[i] {
+			return false, bufio.NewReader(io.MultiReader(bytes.NewReader(read), br)), nil
+		}
+	}
+	return true, br, nil
+}
@@ -0,0 +1,267 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestParseQuotas(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		input string
+		want  map[string]Quota
+		err   string // substring, if any
+	}{
+		{"", map[string]Quota{}, ""},
+		{
+			"# teams\nteam-a records-per-second=100 bytes-per-day=1000000\n\nteam-b bytes-per-day=5 # tiny\ndefault records-per-second=0.5\n",
+			map[string]Quota{
+				"team-a":      {RecordsPerSecond: 100, BytesPerDay: 1000000},
+				"team-b":      {BytesPerDay: 5},
+				DefaultSource: {RecordsPerSecond: 0.5},
+			},
+			"",
+		},
+		{"unlimited\n", map[string]Quota{"unlimited": {}}, ""},
+		{"a bytes-per-day=1\na records-per-second=1\n", nil, "line 2: source a is listed twice"},
+		{"a bytes-per-day\n", nil, `line 1: "bytes-per-day" isn't key=value`},
+		{"a bytes-per-hour=1\n", nil, "line 1: bytes-per-hour: unknown key"},
+		{"a bytes-per-day=1.5\n", nil, "line 1: bytes-per-day"},
+		{"a records-per-second=-1\n", nil, "line 1: records-per-second: must not be negative"},
+	} {
+		have, err := ParseQuotas(strings.NewReader(testcase.input))
+		switch {
+		case testcase.err == "" && err != nil:
+			t.Errorf("%q: %v", testcase.input, err)
+		case testcase.err == "" && !reflect.DeepEqual(testcase.want, have):
+			t.Errorf("%q: want %v, have %v", testcase.input, testcase.want, have)
+		case testcase.err != "" && (err == nil || !strings.Contains(err.Error(), testcase.err)):
+			t.Errorf("%q: want error containing %q, have %v", testcase.input, testcase.err, err)
+		}
+	}
+}
+
+func TestQuotasIsolation(t *testing.T) {
+	t.Parallel()
+
+	// A fake clock, which sleeping advances.
+	var (
+		now   = time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+		slept time.Duration
+		m     = newTestQuotaMetrics()
+	)
+	q := newQuotas(
+		map[string]Quota{
+			"noisy": {RecordsPerSecond: 5, BytesPerDay: 1000},
+			"quiet": {RecordsPerSecond: 1000, BytesPerDay: 1000000},
+		},
+		m.records, m.bytes, m.bytesToday, m.throttledSeconds, m.rejectedRecords,
+		func() time.Time { return now },
+		func(d time.Duration) { now = now.Add(d); slept += d },
+	)
+	p := append(append([]byte("topic "), bytes.Repeat([]byte{'x'}, 93)...), '\n') // 100 bytes
+	source := func() ([]byte, error) { return p, nil }
+	var (
+		noisy     = q.Reader("noisy", source)
+		quiet     = q.Reader("quiet", source)
+		unknown   = q.Reader("nobody", source)
+		anonymous = q.Reader("", source)
+		readUntil = func(r record.Reader, n int) (int, error) {
+			for i := 0; i < n; i++ {
+				if _, err := r(); err != nil {
+					return i, err
+				}
+			}
+			return n, nil
+		}
+	)
+
+	// The noisy source is throttled, and then rejected, once it's read its
+	// daily quota.
+	n, err := readUntil(noisy, 100)
+	if want, have := 10, n; want != have {
+		t.Errorf("noisy: want %d records, have %d", want, have)
+	}
+	if _, ok := err.(quotaError); !ok {
+		t.Fatalf("noisy: want quota error, have %v", err)
+	}
+	if want, have := "source noisy is over its quota of 1000 bytes per day", err.Error(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	throttled := slept
+	if throttled <= 0 {
+		t.Errorf("noisy: never throttled")
+	}
+
+	// The quiet source is unaffected, within its own rate.
+	if n, err := readUntil(quiet, 1000); err != nil {
+		t.Fatalf("quiet: after %d records: %v", n, err)
+	}
+	if want, have := throttled, slept; want != have {
+		t.Errorf("quiet: throttled for %s", have-want)
+	}
+	if _, err := noisy(); err == nil {
+		t.Errorf("noisy: want quota error after the quiet source reads")
+	}
+
+	// Sources that aren't listed, and clients that didn't say, share the
+	// default source, which is unlimited.
+	for _, r := range []record.Reader{unknown, anonymous} {
+		if n, err := readUntil(r, 1000); err != nil {
+			t.Fatalf("default: after %d records: %v", n, err)
+		}
+	}
+
+	for _, testcase := range []struct {
+		source   string
+		records  float64
+		today    float64
+		rejected float64
+	}{
+		{"noisy", 10, 1000, 2},
+		{"quiet", 1000, 100000, 0},
+		{DefaultSource, 2000, 200000, 0},
+	} {
+		if want, have := testcase.records, counterValue(t, m.records, testcase.source); want != have {
+			t.Errorf("%s: records: want %v, have %v", testcase.source, want, have)
+		}
+		if want, have := 100*testcase.records, counterValue(t, m.bytes, testcase.source); want != have {
+			t.Errorf("%s: bytes: want %v, have %v", testcase.source, want, have)
+		}
+		if want, have := testcase.today, gaugeValue(t, m.bytesToday, testcase.source); want != have {
+			t.Errorf("%s: bytes today: want %v, have %v", testcase.source, want, have)
+		}
+		if want, have := testcase.rejected, counterValue(t, m.rejectedRecords, testcase.source); want != have {
+			t.Errorf("%s: rejected records: want %v, have %v", testcase.source, want, have)
+		}
+	}
+	if want, have := 0.0, counterValue(t, m.throttledSeconds, "quiet"); want != have {
+		t.Errorf("quiet: throttled seconds: want %v, have %v", want, have)
+	}
+
+	// A bigger quota takes effect right away; a new day, at midnight UTC.
+	q.Set(map[string]Quota{"noisy": {BytesPerDay: 1500}})
+	if n, _ := readUntil(noisy, 100); n != 5 {
+		t.Errorf("noisy, with a bigger quota: want 5 records, have %d", n)
+	}
+	now = time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	if n, _ := readUntil(noisy, 100); n != 15 {
+		t.Errorf("noisy, the next day: want 15 records, have %d", n)
+	}
+	if n, err := readUntil(quiet, 1000); err != nil {
+		t.Errorf("quiet, no longer listed: after %d records: %v", n, err)
+	}
+}
+
+func TestHandleConnectionsQuotas(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	filesys := fs.NewVirtualFilesystem()
+	log, err := NewFileLog(filesys, "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestQuotaMetrics()
+	quotas := NewQuotas(
+		map[string]Quota{"noisy": {BytesPerDay: 25}},
+		m.records, m.bytes, m.bytesToday, m.throttledSeconds, m.rejectedRecords,
+	)
+	go HandleConnections(ln, ConnectionConfig{
+		Handler:          HandleFastWriter,
+		ReaderFactory:    record.NewDynamicReader,
+		Log:              log,
+		SegmentFlushAge:  time.Hour,
+		SegmentFlushSize: 1024 * 1024,
+		Quotas:           quotas,
+		ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+		Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+		Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+	})
+
+	// The noisy client is told it's over its quota, and disconnected. The
+	// quiet one, which doesn't say who it is, carries on.
+	noisy, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer noisy.Close()
+	quiet, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer quiet.Close()
+	fmt.Fprintf(noisy, "%s noisy\n", SourceHandshake)
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(noisy, "topic noisy %d\n", i) // 14 bytes
+		fmt.Fprintf(quiet, "topic quiet %d\n", i)
+	}
+	noisy.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(noisy).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := QuotaExceeded+" source noisy is over its quota of 25 bytes per day\n", line; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if _, err := io.Copy(ioutil.Discard, noisy); err != nil {
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			t.Errorf("noisy: never disconnected")
+		}
+	}
+	fmt.Fprintf(quiet, "topic quiet %d\n", 3)
+	if !within(time.Second, func() bool { return counterValue(t, m.records, DefaultSource) == 4 }) {
+		t.Fatalf("quiet: want 4 records, have %v", counterValue(t, m.records, DefaultSource))
+	}
+	if want, have := 1.0, counterValue(t, m.records, "noisy"); want != have {
+		t.Errorf("noisy: want %v records, have %v", want, have)
+	}
+	if want, have := 1.0, counterValue(t, m.rejectedRecords, "noisy"); want != have {
+		t.Errorf("noisy: want %v rejected records, have %v", want, have)
+	}
+}
+
+type testQuotaMetrics struct {
+	records, bytes, throttledSeconds, rejectedRecords *prometheus.CounterVec
+	bytesToday                                        *prometheus.GaugeVec
+}
+
+func newTestQuotaMetrics() testQuotaMetrics {
+	return testQuotaMetrics{
+		records:          prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"source"}),
+		bytes:            prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"source"}),
+		throttledSeconds: prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"source"}),
+		rejectedRecords:  prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"source"}),
+		bytesToday:       prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"source"}),
+	}
+}
+
+func gaugeValue(t *testing.T, gv *prometheus.GaugeVec, label string) float64 {
+	var m dto.Metric
+	if err := gv.WithLabelValues(label).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}
@@ -0,0 +1,114 @@
+package ingest
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The ingest rate is estimated over ticks of at least ingestRateTick, and
+// the estimate halves its weight on what was ingested ingestRateHalfLife ago,
+// so bursts are averaged out, and a lasting change in traffic is followed
+// within a few minutes.
+const (
+	ingestRateTick     = time.Second
+	ingestRateHalfLife = time.Minute
+)
+
+// SegmentSizer chooses the size at which active segments are flushed,
+// adapting it to the ingest rate, so that a segment is flushed about once per
+// interval: neither a quiet node takes hours to fill one, nor a busy node
+// flushes one every couple of seconds, for compaction to churn through. The
+// writers of a node share one SegmentSizer, and so the node's rate; between
+// them, they flush about as many bytes per interval as one segment's worth.
+type SegmentSizer struct {
+	interval  time.Duration
+	min, max  int
+	threshold prometheus.Gauge
+	now       func() time.Time
+
+	mtx  sync.Mutex
+	rate rateEstimator
+	size int
+}
+
+// NewSegmentSizer returns a SegmentSizer that aims for a segment per
+// interval, no smaller than min bytes, and no bigger than max. Until the rate
+// is known, segments are flushed at min. The threshold gauge is set to the
+// size it chooses.
+func NewSegmentSizer(interval time.Duration, min, max int, threshold prometheus.Gauge) *SegmentSizer {
+	threshold.Set(float64(min))
+	return &SegmentSizer{
+		interval:  interval,
+		min:       min,
+		max:       max,
+		threshold: threshold,
+		now:       time.Now,
+		rate:      rateEstimator{tick: ingestRateTick, halfLife: ingestRateHalfLife},
+		size:      min,
+	}
+}
+
+// written records that n bytes were ingested, and returns the size at which
+// to flush segments.
+func (s *SegmentSizer) written(n int) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.rate.observe(n, s.now()) {
+		s.size = adaptiveSegmentSize(s.rate.rate, s.interval, s.min, s.max)
+		s.threshold.Set(float64(s.size))
+	}
+	return s.size
+}
+
+// adaptiveSegmentSize returns the size of a segment that's filled in
+// interval, at rate bytes per second, clamped between min and max.
+func adaptiveSegmentSize(rate float64, interval time.Duration, min, max int) int {
+	size := rate * interval.Seconds()
+	switch {
+	case size <= float64(min) || math.IsNaN(size):
+		return min
+	case size >= float64(max):
+		return max
+	default:
+		return int(size)
+	}
+}
+
+// rateEstimator estimates a rate of bytes per second, as an exponentially
+// weighted moving average. The bytes observed within a tick are taken as
+// one sample, so a burst counts as spread over the tick it comes in, and the
+// quiet time before it.
+type rateEstimator struct {
+	tick     time.Duration
+	halfLife time.Duration
+	rate     float64 // bytes per second
+	pending  int     // bytes since last
+	last     time.Time
+	primed   bool // rate has a sample
+}
+
+// observe n bytes at now, and report whether the rate was updated.
+func (e *rateEstimator) observe(n int, now time.Time) bool {
+	if e.last.IsZero() {
+		e.last = now
+	}
+	e.pending += n
+	elapsed := now.Sub(e.last)
+	if elapsed < e.tick {
+		return false
+	}
+	sample := float64(e.pending) / elapsed.Seconds()
+	if e.primed {
+		// A long gap weighs the sample, and the quiet time it includes,
+		// all the more.
+		alpha := 1 - math.Exp2(-elapsed.Seconds()/e.halfLife.Seconds())
+		e.rate += alpha * (sample - e.rate)
+	} else {
+		e.rate, e.primed = sample, true
+	}
+	e.pending, e.last = 0, now
+	return true
+}
@@ -0,0 +1,160 @@
+package ingest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestAdaptiveSegmentSize(t *testing.T) {
+	t.Parallel()
+
+	const mb = 1024 * 1024
+	for _, testcase := range []struct {
+		name     string
+		rate     float64
+		interval time.Duration
+		want     int
+	}{
+		{"idle", 0, 10 * time.Second, 1 * mb},
+		{"trickle", 1024, 10 * time.Second, 1 * mb},
+		{"in range", 2 * mb, 10 * time.Second, 20 * mb},
+		{"longer interval", 2 * mb, 30 * time.Second, 60 * mb},
+		{"at max", 12.8 * mb, 10 * time.Second, 128 * mb},
+		{"flood", 1000 * mb, 10 * time.Second, 128 * mb},
+		{"no rate", math.NaN(), 10 * time.Second, 1 * mb},
+	} {
+		if want, have := testcase.want, adaptiveSegmentSize(testcase.rate, testcase.interval, 1*mb, 128*mb); want != have {
+			t.Errorf("%s: want %d, have %d", testcase.name, want, have)
+		}
+	}
+}
+
+func TestRateEstimatorBursty(t *testing.T) {
+	t.Parallel()
+
+	// Traffic averaging 1MB/s, in writes of 1KB, arrives in a burst every
+	// period, for ten minutes; then, steadily, at a tenth of the rate.
+	const (
+		mb     = 1024 * 1024
+		record = 1024
+	)
+	for _, testcase := range []struct {
+		name   string
+		period time.Duration
+	}{
+		{"steady", 10 * time.Millisecond},
+		{"bursts every second", time.Second},
+		{"bursts every 10s", 10 * time.Second},
+		{"bursts every 30s", 30 * time.Second},
+	} {
+		var (
+			e     = rateEstimator{tick: ingestRateTick, halfLife: ingestRateHalfLife}
+			now   = time.Unix(0, 0)
+			burst = int(mb * testcase.period.Seconds())
+			low   = math.Inf(1)
+			high  = math.Inf(-1)
+		)
+		for elapsed := time.Duration(0); elapsed < 10*time.Minute; elapsed += testcase.period {
+			for n := 0; n < burst; n += record {
+				if e.observe(record, now.Add(elapsed)) && elapsed > 3*time.Minute {
+					low, high = math.Min(low, e.rate), math.Max(high, e.rate)
+				}
+			}
+		}
+		if low < 0.8*mb || high > 1.25*mb {
+			t.Errorf("%s: want the estimate within 20%% of 1MB/s, have %.2f-%.2fMB/s", testcase.name, low/mb, high/mb)
+		}
+
+		// A lasting change is followed within a few half-lives.
+		now = now.Add(10 * time.Minute)
+		for elapsed := time.Duration(0); elapsed < 5*ingestRateHalfLife; elapsed += 100 * time.Millisecond {
+			e.observe(mb/100, now.Add(elapsed))
+		}
+		if have := e.rate; have < 0.08*mb || have > 0.15*mb {
+			t.Errorf("%s: after the rate drops to 0.1MB/s, want it followed, have %.2fMB/s", testcase.name, have/mb)
+		}
+	}
+}
+
+func TestWriterSegmentSizer(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now       = time.Unix(0, 0)
+		threshold = prometheus.NewGauge(prometheus.GaugeOpts{})
+		sizer     = NewSegmentSizer(10*time.Second, 1000, 100000, threshold)
+	)
+	log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizer.now = func() time.Time { return now }
+	w, err := newWriter(
+		log, time.Hour, 1000000, sizer, 0, 0,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		nil,
+		func() time.Time { return now },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go w.loop(nil)
+	defer w.Stop()
+	flushed := func() int {
+		stats, err := log.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int(stats.FlushedSegments)
+	}
+
+	// 50 bytes per second, for a segment per 10s, is below the minimum.
+	record := make([]byte, 100)
+	for i := 0; i < 30; i++ {
+		if _, err := w.Write(record[:50]); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+	if want, have := 1000.0, gauged(threshold); want != have {
+		t.Errorf("at 50B/s: want threshold %v, have %v", want, have)
+	}
+
+	// 2KB per second is a segment of 20KB, once the rate is followed, so a
+	// minute of it is flushed as about 6.
+	for i := 0; i < 20*300; i++ {
+		if _, err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(50 * time.Millisecond)
+	}
+	if have := gauged(threshold); have < 18000 || have > 22000 {
+		t.Errorf("at 2KB/s: want threshold about 20000, have %v", have)
+	}
+	before := flushed()
+	for i := 0; i < 20*60; i++ {
+		if _, err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(50 * time.Millisecond)
+	}
+	if have := flushed() - before; have < 5 || have > 7 {
+		t.Errorf("at 2KB/s: want about 6 segments a minute, have %d", have)
+	}
+}
+
+func gauged(g prometheus.Gauge) float64 {
+	var m dto.Metric
+	g.Write(&m)
+	return m.GetGauge().GetValue()
+}
@@ -0,0 +1,167 @@
+package ingest
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SnappyWriter compresses what's written to it, with snappy's framing
+// format, for a connection that agreed to FeatureSnappy. Writes are buffered,
+// and flushed as a frame once flushBytes are buffered, or flushInterval after
+// the first of them, whichever is sooner, so records on a quiet connection
+// aren't held up for long. It's safe for concurrent use.
+type SnappyWriter struct {
+	mtx           sync.Mutex
+	w             *snappy.Writer
+	flushInterval time.Duration
+	flushBytes    int
+	buffered      int
+	timer         *time.Timer
+	err           error // sticky
+	uncompressed  prometheus.Counter
+}
+
+// errSnappyWriterClosed is what's returned by writes to a closed SnappyWriter.
+var errSnappyWriterClosed = errors.New("snappy writer closed")
+
+// NewSnappyWriter returns a SnappyWriter to w. With a flushInterval of zero,
+// every write is flushed. The bytes written to it are counted by
+// uncompressed, and those it writes to w by compressed, if they're non-nil.
+func NewSnappyWriter(w io.Writer, flushInterval time.Duration, flushBytes int, uncompressed, compressed prometheus.Counter) *SnappyWriter {
+	return &SnappyWriter{
+		w:             snappy.NewBufferedWriter(countingWriter{w, compressed}),
+		flushInterval: flushInterval,
+		flushBytes:    flushBytes,
+		uncompressed:  uncompressed,
+	}
+}
+
+// Write implements io.Writer. It fails once a flush has.
+func (w *SnappyWriter) Write(p []byte) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	if w.uncompressed != nil {
+		w.uncompressed.Add(float64(n))
+	}
+	if err != nil {
+		w.err = err
+		return n, err
+	}
+	w.buffered += n
+	switch {
+	case w.flushInterval <= 0 || w.buffered >= w.flushBytes:
+		if err := w.flush(); err != nil {
+			return n, err
+		}
+	case w.timer == nil:
+		w.timer = time.AfterFunc(w.flushInterval, func() { w.Flush() })
+	}
+	return n, nil
+}
+
+// Flush writes whatever is buffered, as a frame.
+func (w *SnappyWriter) Flush() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	return w.flush()
+}
+
+func (w *SnappyWriter) flush() error {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if w.buffered == 0 {
+		return nil
+	}
+	w.buffered = 0
+	if err := w.w.Flush(); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// Close flushes whatever is buffered. Further writes fail. It doesn't close
+// the underlying writer.
+func (w *SnappyWriter) Close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.err != nil {
+		if w.err == errSnappyWriterClosed {
+			return nil
+		}
+		return w.err
+	}
+	err := w.flush()
+	w.err = errSnappyWriterClosed
+	return err
+}
+
+// newSnappyReader returns the decompressed stream of a connection that
+// agreed to FeatureSnappy. A frame that's corrupt, or cut short, fails the
+// read, so nothing of it reaches the records. The bytes read from r are
+// counted by compressed, and those returned by uncompressed, if they're
+// non-nil.
+func newSnappyReader(r io.Reader, compressed, uncompressed prometheus.Counter) io.Reader {
+	src := &countingReader{r: r, c: compressed}
+	return snappyReader{snappy.NewReader(src), src, uncompressed}
+}
+
+type snappyReader struct {
+	r            *snappy.Reader
+	src          *countingReader
+	uncompressed prometheus.Counter
+}
+
+func (r snappyReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.uncompressed != nil {
+		r.uncompressed.Add(float64(n))
+	}
+	if err != nil && err != io.EOF && err != r.src.err {
+		err = errors.Wrap(err, "decompressing snappy stream") // not the connection's
+	}
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	c prometheus.Counter
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if w.c != nil {
+		w.c.Add(float64(n))
+	}
+	return n, err
+}
+
+// countingReader counts what's read from r, and keeps its last error.
+type countingReader struct {
+	r   io.Reader
+	c   prometheus.Counter
+	err error
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.c != nil {
+		r.c.Add(float64(n))
+	}
+	r.err = err
+	return n, err
+}
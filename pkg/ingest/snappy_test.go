@@ -0,0 +1,263 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestSnappyRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	lines := logLines(1000)
+	for _, testcase := range []struct {
+		name          string
+		flushInterval time.Duration
+		flushBytes    int
+	}{
+		{"every write", 0, 0},
+		{"small frames", time.Hour, 100},
+		{"big frames", time.Hour, 1024 * 1024},
+	} {
+		var (
+			buf                                bytes.Buffer
+			wroteUncompressed, wroteCompressed = prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{})
+			readCompressed, readUncompressed   = prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{})
+			w                                  = NewSnappyWriter(&buf, testcase.flushInterval, testcase.flushBytes, wroteUncompressed, wroteCompressed)
+		)
+		for _, line := range lines {
+			if _, err := io.WriteString(w, line); err != nil {
+				t.Fatalf("%s: %v", testcase.name, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: %v", testcase.name, err)
+		}
+		if _, err := w.Write([]byte("more\n")); err == nil {
+			t.Errorf("%s: want error writing after close, have none", testcase.name)
+		}
+
+		compressed := buf.Len()
+		have, err := ioutil.ReadAll(newSnappyReader(&buf, readCompressed, readUncompressed))
+		if err != nil {
+			t.Fatalf("%s: %v", testcase.name, err)
+		}
+		if want := strings.Join(lines, ""); want != string(have) {
+			t.Errorf("%s: want %d bytes back, have %d", testcase.name, len(want), len(have))
+		}
+		for _, c := range []struct {
+			name       string
+			want, have float64
+		}{
+			{"written uncompressed", float64(len(have)), counted(wroteUncompressed)},
+			{"written compressed", float64(compressed), counted(wroteCompressed)},
+			{"read compressed", float64(compressed), counted(readCompressed)},
+			{"read uncompressed", float64(len(have)), counted(readUncompressed)},
+		} {
+			if c.want != c.have {
+				t.Errorf("%s: want %v bytes %s, have %v", testcase.name, c.want, c.name, c.have)
+			}
+		}
+	}
+}
+
+func TestSnappyWriterFlushInterval(t *testing.T) {
+	t.Parallel()
+
+	pr, pw := io.Pipe()
+	w := NewSnappyWriter(pw, 10*time.Millisecond, 1024*1024, nil, nil)
+	defer w.Close()
+	if _, err := io.WriteString(w, "topic a\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Well short of flushBytes, the record still arrives.
+	got := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 100)
+		n, _ := newSnappyReader(pr, nil, nil).Read(buf)
+		got <- string(buf[:n])
+	}()
+	select {
+	case have := <-got:
+		if want := "topic a\n"; want != have {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("never flushed")
+	}
+}
+
+func TestHandleConnectionsSnappyCorrupt(t *testing.T) {
+	t.Parallel()
+
+	// A frame for each record, so the first is read before the second.
+	var buf bytes.Buffer
+	w := NewSnappyWriter(&buf, 0, 0, nil, nil)
+	io.WriteString(w, "topic a\n")
+	io.WriteString(w, "topic b\n")
+	w.Close()
+	good := buf.String()
+	corrupt := []byte(good)
+	corrupt[len(corrupt)-3] ^= 0xff // in the last frame's data, under its checksum
+
+	for _, testcase := range []struct {
+		name    string
+		input   string
+		records []string
+		err     string
+	}{
+		{"good", good, []string{"topic a\n", "topic b\n"}, ""},
+		{"corrupt", string(corrupt), []string{"topic a\n"}, "decompressing snappy stream"},
+		{"cut short", good[:len(good)-3], []string{"topic a\n"}, "decompressing snappy stream"},
+		{"not snappy", "topic a\ntopic b\n", nil, ""}, // fails before the handler
+	} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		type result struct {
+			records []string
+			err     error
+		}
+		results := make(chan result, 1)
+		capture := func(r record.Reader, w *Writer, idGen IDGenerator, connectedClients prometheus.Gauge) error {
+			var res result
+			for {
+				rec, err := r()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					res.err = err
+					break
+				}
+				res.records = append(res.records, string(rec))
+			}
+			results <- res
+			return res.err
+		}
+		go HandleConnections(ln, ConnectionConfig{
+			Handler:          capture,
+			ReaderFactory:    record.NewDynamicReader,
+			Log:              log,
+			SegmentFlushAge:  time.Hour,
+			SegmentFlushSize: 1024 * 1024,
+			ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+			Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+			Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+			Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+			SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		})
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		io.WriteString(conn, Hello([]string{FeatureSnappy})+"\n"+testcase.input)
+		conn.(*net.TCPConn).CloseWrite()
+
+		// The connection is closed after the answer to the hello.
+		if _, err := ioutil.ReadAll(conn); err != nil {
+			t.Fatalf("%s: connection never terminated: %v", testcase.name, err)
+		}
+		var res result
+		select {
+		case res = <-results:
+		default:
+		}
+		if want, have := fmt.Sprint(testcase.records), fmt.Sprint(res.records); want != have {
+			t.Errorf("%s: want records %s, have %s", testcase.name, want, have)
+		}
+		switch {
+		case testcase.err == "" && res.err != nil:
+			t.Errorf("%s: want no error, have %v", testcase.name, res.err)
+		case testcase.err != "" && (res.err == nil || !strings.HasPrefix(res.err.Error(), testcase.err)):
+			t.Errorf("%s: want error %q, have %v", testcase.name, testcase.err, res.err)
+		}
+		conn.Close()
+		ln.Close()
+	}
+}
+
+// BenchmarkSnappy compresses and decompresses JSON log lines, in frames of a
+// forwarder's default size, and reports how well they compress.
+func BenchmarkSnappy(b *testing.B) {
+	var (
+		lines = logLines(10000)
+		input = []byte(strings.Join(lines, ""))
+		out   = make([]byte, 64*1024)
+		buf   bytes.Buffer
+	)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		w := NewSnappyWriter(&buf, time.Hour, 64*1024, nil, nil)
+		for _, line := range lines {
+			io.WriteString(w, line)
+		}
+		w.Close()
+		if i == 0 {
+			b.ReportMetric(float64(len(input))/float64(buf.Len()), "ratio")
+		}
+		r := snappy.NewReader(&buf)
+		for {
+			if _, err := r.Read(out); err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// logLines returns n records, as a forwarder of verbose JSON logs writes them.
+func logLines(n int) []string {
+	var (
+		levels  = []string{"debug", "info", "info", "info", "warn", "error"}
+		methods = []string{"GET", "GET", "POST", "PUT", "DELETE"}
+		paths   = []string{"/api/v1/users", "/api/v1/orders", "/api/v1/orders/items", "/healthz", "/metrics"}
+		lines   = make([]string, n)
+		ts      = time.Date(2017, 3, 14, 15, 59, 40, 0, time.UTC)
+	)
+	for i := range lines {
+		lines[i] = fmt.Sprintf(
+			`web {"ts":"%s","level":"%s","caller":"server.go:%d","method":"%s","path":"%s","status":%d,"duration_ms":%.3f,"request_id":"%08x","user_agent":"Mozilla/5.0 (X11; Linux x86_64)"}`+"\n",
+			ts.Add(time.Duration(i)*time.Millisecond).Format(time.RFC3339Nano),
+			levels[i%len(levels)],
+			100+i%50,
+			methods[i%len(methods)],
+			paths[i%len(paths)],
+			[]int{200, 200, 200, 201, 404, 500}[i%6],
+			float64(i%1000)/7,
+			i*2654435761,
+		)
+	}
+	return lines
+}
+
+func counted(c prometheus.Counter) float64 {
+	var m dto.Metric
+	c.Write(&m)
+	return m.GetCounter().GetValue()
+}
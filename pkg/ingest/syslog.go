@@ -0,0 +1,436 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// Syslog frames that can't be parsed, or are larger than the maximum size,
+// are dropped, and counted by reason.
+const (
+	syslogDroppedMalformed = "malformed"
+	syslogDroppedOversized = "oversized"
+)
+
+var (
+	errSyslogPRI            = errors.New("invalid or missing PRI")
+	errSyslogHeader         = errors.New("truncated header")
+	errSyslogFieldLength    = errors.New("header field too long")
+	errSyslogSDUnterminated = errors.New("unterminated structured data")
+	errSyslogFrameLength    = errors.New("invalid octet count")
+)
+
+// SyslogReaderFactory returns a ReaderFactory for syslog over TCP, per RFC
+// 6587. Each frame may use octet counting, i.e. be prefixed with its length,
+// or be terminated by a newline. Frames are parsed per RFC 5424, or RFC 3164
+// as a fallback, and converted to records with the given topic; see
+// HandleSyslogPackets. Frames bigger than maxSize, or that can't be parsed,
+// are dropped, and counted by reason.
+func SyslogReaderFactory(topic []byte, maxSize int, dropped *prometheus.CounterVec) record.ReaderFactory {
+	return func(r io.Reader) record.Reader {
+		br := bufio.NewReaderSize(r, maxSize+1)
+		return func() ([]byte, error) {
+			for {
+				frame, err := readSyslogFrame(br, maxSize)
+				if err == errSyslogFrameLength {
+					dropped.WithLabelValues(syslogDroppedMalformed).Inc()
+					return nil, err // we can't find the next frame
+				}
+				if err == bufio.ErrBufferFull {
+					dropped.WithLabelValues(syslogDroppedOversized).Inc()
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				if len(frame) == 0 {
+					continue // tolerate blank lines
+				}
+				m, err := parseSyslog(frame)
+				if err != nil {
+					dropped.WithLabelValues(syslogDroppedMalformed).Inc()
+					continue
+				}
+				return m.record(topic), nil
+			}
+		}
+	}
+}
+
+// HandleSyslogPackets reads syslog messages, one per datagram, from conn, and
+// writes them to a new active segment in the log, as records with the given
+// topic. Messages are parsed per RFC 5424, or RFC 3164 as a fallback. The
+// priority, hostname, and app name become a prefix of the record, like
+//
+//	topic pri=daemon.err host=myhost app=myapp [structured data] message
+//
+// where missing hostnames and app names are "-". Datagrams bigger than
+// maxSize, or that can't be parsed, are dropped, and counted by reason.
+// If ids is non-nil, the records get their IDs from it, as one stream. If
+// idClock is non-nil, they get the times of their IDs from it; datagrams
+// aren't refused while it's too far behind, as there's no one to tell. If
+// filter is non-nil, records it drops are skipped.
+// Terminate the function by closing conn.
+func HandleSyslogPackets(
+	conn net.PacketConn,
+	topic []byte,
+	maxSize int,
+	dropped *prometheus.CounterVec,
+	ids *MonotonicIDs,
+	idClock *IDClock,
+	filter *Filter,
+	log Log,
+	logger log.Logger,
+	segmentFlushAge time.Duration,
+	segmentFlushSize int,
+	sizer *SegmentSizer,
+	bytes, records, syncs prometheus.Counter,
+	segmentAge, segmentSize prometheus.Histogram,
+) error {
+	w, err := NewWriter(log, segmentFlushAge, segmentFlushSize, sizer, 0, 0, bytes, records, syncs, segmentAge, segmentSize, logger)
+	if err != nil {
+		return err
+	}
+	defer w.Stop() // make sure it's flushed
+	newID := ids.newStream()
+	idGen := func() string { return newID(idClock.Now()) }
+	return handleSyslogPackets(conn, w, idGen, filter, topic, maxSize, dropped)
+}
+
+func handleSyslogPackets(conn net.PacketConn, w *Writer, idGen IDGenerator, filter *Filter, topic []byte, maxSize int, dropped *prometheus.CounterVec) error {
+	buf := make([]byte, maxSize+1)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		if n > maxSize {
+			dropped.WithLabelValues(syslogDroppedOversized).Inc()
+			continue
+		}
+		m, err := parseSyslog(bytes.TrimRight(buf[:n], "\r\n"))
+		if err != nil {
+			dropped.WithLabelValues(syslogDroppedMalformed).Inc()
+			continue
+		}
+		record := m.record(topic)
+		if !filter.Keep(record) {
+			continue
+		}
+		if err := w.WriteRecord(idGen, record); err != nil {
+			return err
+		}
+	}
+}
+
+// readSyslogFrame reads the next frame, without its framing. Frames that
+// start with a digit use octet counting; others are terminated by a newline.
+// An oversized frame is discarded, and bufio.ErrBufferFull returned.
+func readSyslogFrame(br *bufio.Reader, maxSize int) ([]byte, error) {
+	c, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if '1' <= c && c <= '9' {
+		return readOctetCountedFrame(br, c, maxSize)
+	}
+	br.UnreadByte()
+	line, err := br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		for err == bufio.ErrBufferFull {
+			_, err = br.ReadSlice('\n')
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return nil, bufio.ErrBufferFull
+	}
+	if err == io.EOF && len(line) > 0 {
+		err = nil // a final frame without a newline
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+func readOctetCountedFrame(br *bufio.Reader, first byte, maxSize int) ([]byte, error) {
+	n := int(first - '0')
+	for digits := 1; ; digits++ {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == ' ' {
+			break
+		}
+		if c < '0' || c > '9' || digits >= 9 {
+			return nil, errSyslogFrameLength
+		}
+		n = 10*n + int(c-'0')
+	}
+	if n > maxSize {
+		if _, err := br.Discard(n); err != nil {
+			return nil, err
+		}
+		return nil, bufio.ErrBufferFull
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(br, frame); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(frame, "\r\n"), nil
+}
+
+// syslogMessage is a parsed syslog frame. Missing string fields are "-", the
+// RFC 5424 NILVALUE.
+type syslogMessage struct {
+	facility       int
+	severity       int
+	hostname       string
+	appName        string
+	procID         string
+	msgID          string
+	structuredData []byte
+	msg            []byte
+}
+
+// parseSyslog parses an RFC 5424 frame, or an RFC 3164 frame if it isn't.
+func parseSyslog(frame []byte) (syslogMessage, error) {
+	pri, rest, err := parseSyslogPRI(frame)
+	if err != nil {
+		return syslogMessage{}, err
+	}
+	m := syslogMessage{
+		facility: pri / 8,
+		severity: pri % 8,
+		hostname: "-",
+		appName:  "-",
+		procID:   "-",
+		msgID:    "-",
+	}
+	if isRFC5424(rest) {
+		err := m.parseRFC5424(rest)
+		return m, err
+	}
+	m.parseRFC3164(rest)
+	return m, nil
+}
+
+// parseSyslogPRI parses the leading <PRI>, which both RFCs have in common.
+func parseSyslogPRI(b []byte) (pri int, rest []byte, err error) {
+	if len(b) < 3 || b[0] != '<' {
+		return 0, nil, errSyslogPRI
+	}
+	i := bytes.IndexByte(b[:min(len(b), 5)], '>')
+	if i < 2 {
+		return 0, nil, errSyslogPRI
+	}
+	pri, err = strconv.Atoi(string(b[1:i]))
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, nil, errSyslogPRI
+	}
+	return pri, b[i+1:], nil
+}
+
+// isRFC5424 reports whether the header after the PRI starts with a version,
+// and a valid timestamp.
+func isRFC5424(b []byte) bool {
+	version, rest := nextSyslogField(b)
+	if len(version) < 1 || len(version) > 2 || version[0] == '0' {
+		return false
+	}
+	for _, c := range version {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	timestamp, _ := nextSyslogField(rest)
+	if string(timestamp) == "-" {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339Nano, string(timestamp))
+	return err == nil
+}
+
+// parseRFC5424 parses the header after the PRI:
+// VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP SD [SP MSG]
+// A missing structured data element is tolerated.
+func (m *syslogMessage) parseRFC5424(b []byte) error {
+	_, b = nextSyslogField(b) // version
+	_, b = nextSyslogField(b) // timestamp; we use our own
+	for _, field := range []struct {
+		dst    *string
+		maxLen int
+	}{
+		{&m.hostname, 255},
+		{&m.appName, 48},
+		{&m.procID, 128},
+		{&m.msgID, 32},
+	} {
+		var value []byte
+		value, b = nextSyslogField(b)
+		if len(value) == 0 {
+			return errSyslogHeader
+		}
+		if len(value) > field.maxLen {
+			return errSyslogFieldLength
+		}
+		*field.dst = string(value)
+	}
+	sd, b, err := splitStructuredData(b)
+	if err != nil {
+		return err
+	}
+	m.structuredData = sd
+	m.msg = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf")) // BOM
+	return nil
+}
+
+// splitStructuredData splits the structured data from the message that may
+// follow it. The NILVALUE yields no structured data.
+func splitStructuredData(b []byte) (sd, rest []byte, err error) {
+	switch {
+	case len(b) == 0:
+		return nil, nil, nil // tolerate missing SD, as well as the message
+	case b[0] == '-' && (len(b) == 1 || b[1] == ' '):
+		return nil, b[min(len(b), 2):], nil
+	case b[0] != '[':
+		return nil, b, nil // tolerate missing SD before a message
+	}
+	i := 0
+	for i < len(b) && b[i] == '[' {
+		end := sdElementEnd(b[i:])
+		if end < 0 {
+			return nil, nil, errSyslogSDUnterminated
+		}
+		i += end + 1
+	}
+	sd, rest = b[:i], b[i:]
+	if len(rest) > 0 && rest[0] == ' ' {
+		rest = rest[1:]
+	}
+	return sd, rest, nil
+}
+
+// sdElementEnd returns the index of the ']' that closes the SD-ELEMENT at the
+// start of b, skipping escaped characters in quoted values; or -1.
+func sdElementEnd(b []byte) int {
+	quoted := false
+	for i := 1; i < len(b); i++ {
+		switch {
+		case quoted && b[i] == '\\':
+			i++
+		case b[i] == '"':
+			quoted = !quoted
+		case !quoted && b[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseRFC3164 parses the header after the PRI: [TIMESTAMP SP HOSTNAME SP]
+// [TAG[PID]:] MSG. In practice, parts of it are frequently missing, so it's
+// parsed loosely, and never fails.
+func (m *syslogMessage) parseRFC3164(b []byte) {
+	if len(b) >= len(time.Stamp) {
+		if _, err := time.Parse(time.Stamp, string(b[:len(time.Stamp)])); err == nil {
+			b = bytes.TrimLeft(b[len(time.Stamp):], " ")
+
+			// The hostname follows the timestamp, unless it's the tag.
+			if field, rest := nextSyslogField(b); len(field) > 0 && len(rest) > 0 && !bytes.ContainsAny(field, "[:") {
+				m.hostname, b = string(field), rest
+			}
+		}
+	}
+	if app, pid, rest, ok := parseSyslogTag(b); ok {
+		m.appName, m.procID, b = app, pid, rest
+	}
+	m.msg = b
+}
+
+// parseSyslogTag parses an RFC 3164 TAG, like "app:" or "app[pid]:".
+func parseSyslogTag(b []byte) (app, pid string, rest []byte, ok bool) {
+	i := bytes.IndexAny(b[:min(len(b), 49)], " [:")
+	if i <= 0 {
+		return "", "", nil, false
+	}
+	app = string(b[:i])
+	pid = "-"
+	if b[i] == '[' {
+		j := bytes.IndexByte(b[i:], ']')
+		if j < 2 {
+			return "", "", nil, false
+		}
+		pid = string(b[i+1 : i+j])
+		i += j + 1
+	}
+	if i >= len(b) || b[i] != ':' {
+		return "", "", nil, false
+	}
+	return app, pid, bytes.TrimLeft(b[i+1:], " "), true
+}
+
+func nextSyslogField(b []byte) (field, rest []byte) {
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		return b[:i], b[i+1:]
+	}
+	return b, nil
+}
+
+// record renders the message as a record with the given topic. Records are a
+// single line, so any newlines in the message are replaced by spaces.
+func (m syslogMessage) record(topic []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(topic)
+	fmt.Fprintf(&buf, " pri=%s.%s host=%s app=%s", syslogFacility(m.facility), syslogSeverities[m.severity], m.hostname, m.appName)
+	for _, b := range [][]byte{m.structuredData, bytes.TrimRight(m.msg, " \r\n")} {
+		if len(b) == 0 {
+			continue
+		}
+		buf.WriteByte(' ')
+		for _, c := range b {
+			if c == '\n' || c == '\r' {
+				c = ' '
+			}
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+}
+
+func syslogFacility(facility int) string {
+	if facility < len(syslogFacilities) {
+		return syslogFacilities[facility]
+	}
+	return "local" + strconv.Itoa(facility-16)
+}
+
+var syslogSeverities = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,281 @@
+package ingest
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestParseSyslog(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name  string
+		input string
+		want  string // record with topic "syslog", or empty for an error
+	}{
+		{
+			name:  "RFC 5424",
+			input: `<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed for lonvick on /dev/pts/8`,
+			want:  "syslog pri=auth.crit host=mymachine.example.com app=su 'su root' failed for lonvick on /dev/pts/8\n",
+		},
+		{
+			name:  "RFC 5424 with structured data",
+			input: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] An application event log entry...`,
+			want:  "syslog pri=local4.notice host=mymachine.example.com app=evntslog [exampleSDID@32473 iut=\"3\" eventSource=\"Application\" eventID=\"1011\"] An application event log entry...\n",
+		},
+		{
+			name:  "RFC 5424 with escaped structured data",
+			input: `<165>1 - host app - - [id a="x\]y" b="\"q\""][other@1 c="d"] msg`,
+			want:  "syslog pri=local4.notice host=host app=app [id a=\"x\\]y\" b=\"\\\"q\\\"\"][other@1 c=\"d\"] msg\n",
+		},
+		{
+			name:  "RFC 5424 with structured data and no message",
+			input: `<165>1 2003-10-11T22:14:15.003Z host app - - [id a="b"]`,
+			want:  "syslog pri=local4.notice host=host app=app [id a=\"b\"]\n",
+		},
+		{
+			name:  "RFC 5424 without structured data",
+			input: `<13>1 2003-10-11T22:14:15.003Z host app 123 ID1`,
+			want:  "syslog pri=user.notice host=host app=app\n",
+		},
+		{
+			name:  "RFC 5424 with a message but no structured data",
+			input: `<13>1 2003-10-11T22:14:15.003Z host app 123 ID1 hello`,
+			want:  "syslog pri=user.notice host=host app=app hello\n",
+		},
+		{
+			name:  "RFC 5424 without hostname",
+			input: `<13>1 - - app - - - hello`,
+			want:  "syslog pri=user.notice host=- app=app hello\n",
+		},
+		{
+			name:  "RFC 5424 with BOM",
+			input: "<13>1 - host app - - - \xef\xbb\xbfhello",
+			want:  "syslog pri=user.notice host=host app=app hello\n",
+		},
+		{
+			name:  "RFC 5424 with newlines",
+			input: "<13>1 - host app - - - multi\nline\r\nmessage\n",
+			want:  "syslog pri=user.notice host=host app=app multi line  message\n",
+		},
+		{
+			name:  "RFC 5424 truncated header",
+			input: `<13>1 2003-10-11T22:14:15.003Z host app`,
+			want:  "",
+		},
+		{
+			name:  "RFC 5424 unterminated structured data",
+			input: `<13>1 - host app - - [id a="b] msg`,
+			want:  "",
+		},
+		{
+			name:  "RFC 5424 hostname too long",
+			input: `<13>1 - ` + strings.Repeat("h", 256) + ` app - - - msg`,
+			want:  "",
+		},
+		{
+			name:  "RFC 3164",
+			input: `<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8`,
+			want:  "syslog pri=auth.crit host=mymachine app=su 'su root' failed for lonvick on /dev/pts/8\n",
+		},
+		{
+			name:  "RFC 3164 with pid and single digit day",
+			input: `<30>Oct  1 22:14:15 fw1 sshd[1234]: Accepted publickey`,
+			want:  "syslog pri=daemon.info host=fw1 app=sshd Accepted publickey\n",
+		},
+		{
+			name:  "RFC 3164 without hostname",
+			input: `<30>Oct 11 22:14:15 sshd[1234]: Accepted publickey`,
+			want:  "syslog pri=daemon.info host=- app=sshd Accepted publickey\n",
+		},
+		{
+			name:  "RFC 3164 without timestamp",
+			input: `<30>sshd: Accepted publickey`,
+			want:  "syslog pri=daemon.info host=- app=sshd Accepted publickey\n",
+		},
+		{
+			name:  "RFC 3164 without anything",
+			input: `<13>just a message`,
+			want:  "syslog pri=user.notice host=- app=- just a message\n",
+		},
+		{
+			name:  "RFC 3164 that looks like RFC 5424",
+			input: `<13>1 thing happened`,
+			want:  "syslog pri=user.notice host=- app=- 1 thing happened\n",
+		},
+		{
+			name:  "empty message",
+			input: `<13>`,
+			want:  "syslog pri=user.notice host=- app=-\n",
+		},
+		{
+			name:  "missing PRI",
+			input: `Oct 11 22:14:15 mymachine su: hello`,
+			want:  "",
+		},
+		{
+			name:  "unterminated PRI",
+			input: `<13 hello`,
+			want:  "",
+		},
+		{
+			name:  "PRI out of range",
+			input: `<192>1 - host app - - - hello`,
+			want:  "",
+		},
+		{
+			name:  "PRI not a number",
+			input: `<ab>hello`,
+			want:  "",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			m, err := parseSyslog([]byte(testcase.input))
+			if testcase.want == "" {
+				if err == nil {
+					t.Fatalf("want error, have %q", m.record([]byte("syslog")))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := testcase.want, string(m.record([]byte("syslog"))); want != have {
+				t.Errorf("want %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestSyslogReaderFactory(t *testing.T) {
+	t.Parallel()
+
+	var (
+		rfc5424 = `<13>1 - host app - - - octet counted`
+		input   = strings.Join([]string{
+			// Octet counting and newline framing can be mixed per frame.
+			"36 " + rfc5424,
+			"<13>newline framed\n",
+			"\n", // blank lines are skipped
+			"<13>trailing CRLF\r\n",
+			"not syslog at all\n",
+			"<13>" + strings.Repeat("x", 100) + "\n",
+			"104 <13>" + strings.Repeat("x", 100),
+			"20 <13>contains\nnewline",
+			"<13>final frame without newline",
+		}, "")
+		dropped = prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"reason"})
+		read    = SyslogReaderFactory([]byte("syslog"), 64, dropped)(strings.NewReader(input))
+	)
+	var have []string
+	for {
+		record, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		have = append(have, string(record))
+	}
+	want := []string{
+		"syslog pri=user.notice host=host app=app octet counted\n",
+		"syslog pri=user.notice host=- app=- newline framed\n",
+		"syslog pri=user.notice host=- app=- trailing CRLF\n",
+		"syslog pri=user.notice host=- app=- contains newline\n",
+		"syslog pri=user.notice host=- app=- final frame without newline\n",
+	}
+	if strings.Join(want, "") != strings.Join(have, "") {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := 1.0, counterValue(t, dropped, syslogDroppedMalformed); want != have {
+		t.Errorf("malformed: want %v, have %v", want, have)
+	}
+	if want, have := 2.0, counterValue(t, dropped, syslogDroppedOversized); want != have {
+		t.Errorf("oversized: want %v, have %v", want, have)
+	}
+}
+
+func TestSyslogReaderFactoryBadOctetCount(t *testing.T) {
+	t.Parallel()
+
+	dropped := prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"reason"})
+	read := SyslogReaderFactory([]byte("syslog"), 64, dropped)(strings.NewReader("12x <13>hello\n<13>hello\n"))
+	if _, err := read(); err != errSyslogFrameLength {
+		t.Errorf("want %v, have %v", errSyslogFrameLength, err)
+	}
+}
+
+func TestHandleSyslogPackets(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filesys := fs.NewVirtualFilesystem()
+	log, err := NewFileLog(filesys, "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newTestWriter(t, log, 0, 0)
+	dropped := prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"reason"})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- handleSyslogPackets(conn, w, newTestIDGenerator(), nil, []byte("syslog"), 64, dropped)
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for _, datagram := range []string{
+		"<13>1 - host app - - - hello",
+		"garbage",
+		"<13>" + strings.Repeat("x", 100),
+		"<13>world\n",
+	} {
+		if _, err := client.Write([]byte(datagram)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !within(time.Second, func() bool {
+		return counterValue(t, dropped, syslogDroppedMalformed) == 1 &&
+			counterValue(t, dropped, syslogDroppedOversized) == 1
+	}) {
+		t.Fatal("datagrams were never dropped")
+	}
+
+	conn.Close()
+	<-errc
+	w.Stop()
+	var have []string
+	for _, record := range readRecords(t, filesys) {
+		have = append(have, record[ulid.EncodedSize+1:])
+	}
+	want := []string{
+		"syslog pri=user.notice host=host app=app hello",
+		"syslog pri=user.notice host=- app=- world",
+	}
+	if strings.Join(want, "|") != strings.Join(have, "|") {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func counterValue(t *testing.T, cv *prometheus.CounterVec, label string) float64 {
+	var m dto.Metric
+	if err := cv.WithLabelValues(label).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
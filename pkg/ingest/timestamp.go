@@ -0,0 +1,90 @@
+package ingest
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// ClientTimestamps takes the time of each record from the record itself,
+// rather than from when it arrived, so records buffered by a client, or
+// replayed from its spool, keep the time they were written. The first field
+// of each record, up to a space, is its time, as unix epoch milliseconds, or
+// RFC3339, e.g. as prefixed by the forwarder with -forward.client-timestamps.
+//
+// A record whose time is more than the max skew from the time it arrived,
+// either way, or before the unix epoch, gets the time it arrived, instead,
+// and is counted as rejected. So does a record whose first field isn't a
+// time, which is left as it is. The field is otherwise stripped, since it's
+// in the record's ID.
+type ClientTimestamps struct {
+	maxSkew  time.Duration
+	rejected prometheus.Counter
+	now      func() time.Time
+}
+
+// NewClientTimestamps returns ClientTimestamps that accept times up to the
+// max skew from the arrival time of their records.
+func NewClientTimestamps(maxSkew time.Duration, rejected prometheus.Counter) *ClientTimestamps {
+	return &ClientTimestamps{
+		maxSkew:  maxSkew,
+		rejected: rejected,
+		now:      time.Now,
+	}
+}
+
+// Reader wraps the record.Reader for a connection, and returns the time, as
+// unix epoch milliseconds, of the last record it read. With nil
+// ClientTimestamps, r is unchanged, and records get the time of their IDs,
+// i.e. when they're written.
+func (c *ClientTimestamps) Reader(r record.Reader) (record.Reader, func() uint64) {
+	if c == nil {
+		return r, ulid.Now
+	}
+	var last uint64
+	return func() ([]byte, error) {
+		rec, err := r()
+		if err != nil {
+			return rec, err
+		}
+		last, rec = c.parse(rec)
+		return rec, nil
+	}, func() uint64 { return last }
+}
+
+// parse returns the time of the record, and the record without it.
+func (c *ClientTimestamps) parse(rec []byte) (uint64, []byte) {
+	now := c.now()
+	i := bytes.IndexByte(rec, ' ')
+	if i <= 0 {
+		c.rejected.Inc()
+		return ulid.Timestamp(now), rec
+	}
+	t, ok := parseTimestamp(string(rec[:i]))
+	if !ok {
+		c.rejected.Inc()
+		return ulid.Timestamp(now), rec
+	}
+	if t.Before(time.Unix(0, 0)) || t.Before(now.Add(-c.maxSkew)) || t.After(now.Add(c.maxSkew)) {
+		c.rejected.Inc()
+		return ulid.Timestamp(now), rec[i+1:]
+	}
+	return ulid.Timestamp(t), rec[i+1:]
+}
+
+// parseTimestamp parses unix epoch milliseconds, or RFC3339.
+func parseTimestamp(s string) (time.Time, bool) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(ms/1e3, (ms%1e3)*1e6), true
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
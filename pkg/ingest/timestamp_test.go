@@ -0,0 +1,143 @@
+package ingest
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+)
+
+func TestClientTimestamps(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now     = time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+		arrival = ulid.Timestamp(now)
+		hourAgo = ulid.Timestamp(now.Add(-time.Hour))
+	)
+	for _, testcase := range []struct {
+		name     string
+		input    string
+		time     uint64
+		record   string
+		rejected bool
+	}{
+		{"epoch millis", fmt.Sprintf("%d topic hello\n", hourAgo), hourAgo, "topic hello\n", false},
+		{"RFC3339", "2017-01-02T02:04:05Z topic hello\n", hourAgo, "topic hello\n", false},
+		{"RFC3339 with zone", "2017-01-02T03:04:05+01:00 topic hello\n", hourAgo, "topic hello\n", false},
+		{"too old", "2016-12-31T03:04:05Z topic hello\n", arrival, "topic hello\n", true},
+		{"too new", "2017-01-04T03:04:05Z topic hello\n", arrival, "topic hello\n", true},
+		{"before epoch", "-1 topic hello\n", arrival, "topic hello\n", true},
+		{"unparseable", "topic hello\n", arrival, "topic hello\n", true},
+		{"one field", "hello\n", arrival, "hello\n", true},
+	} {
+		var (
+			rejected = prometheus.NewCounter(prometheus.CounterOpts{})
+			c        = NewClientTimestamps(24*time.Hour, rejected)
+			read     = false
+		)
+		c.now = func() time.Time { return now }
+		r, last := c.Reader(func() ([]byte, error) {
+			if read {
+				return nil, io.EOF
+			}
+			read = true
+			return []byte(testcase.input), nil
+		})
+		rec, err := r()
+		if err != nil {
+			t.Errorf("%s: %v", testcase.name, err)
+			continue
+		}
+		if want, have := testcase.record, string(rec); want != have {
+			t.Errorf("%s: want record %q, have %q", testcase.name, want, have)
+		}
+		if want, have := testcase.time, last(); want != have {
+			t.Errorf("%s: want time %d, have %d", testcase.name, want, have)
+		}
+		var m dto.Metric
+		rejected.Write(&m)
+		if want, have := testcase.rejected, m.GetCounter().GetValue() > 0; want != have {
+			t.Errorf("%s: want rejected %v, have %v", testcase.name, want, have)
+		}
+		if _, err := r(); err != io.EOF {
+			t.Errorf("%s: want EOF, have %v", testcase.name, err)
+		}
+	}
+}
+
+func TestHandleConnectionsClientTimestamps(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	log, err := NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The handler reports the time of the ID of each record it reads.
+	var (
+		times = make(chan uint64)
+		h     = func(r record.Reader, w *Writer, idGen IDGenerator, connectedClients prometheus.Gauge) error {
+			for {
+				if _, err := r(); err != nil {
+					return nil
+				}
+				id, err := ulid.Parse(idGen())
+				if err != nil {
+					return err
+				}
+				times <- id.Time()
+			}
+		}
+		timestamps = NewClientTimestamps(time.Hour, prometheus.NewCounter(prometheus.CounterOpts{}))
+	)
+	go HandleConnections(ln, ConnectionConfig{
+		Handler:          h,
+		ReaderFactory:    record.NewDynamicReader,
+		Log:              log,
+		SegmentFlushAge:  time.Hour,
+		SegmentFlushSize: 1024 * 1024,
+		Timestamps:       timestamps,
+		ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{}),
+		Bytes:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		Records:          prometheus.NewCounter(prometheus.CounterOpts{}),
+		Syncs:            prometheus.NewCounter(prometheus.CounterOpts{}),
+		SegmentAge:       prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SegmentSize:      prometheus.NewHistogram(prometheus.HistogramOpts{}),
+	})
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Records written out of order get IDs in the order they were written,
+	// not the order they arrived.
+	now := ulid.Now()
+	for _, ms := range []uint64{now - 2000, now - 3000, now - 1000} {
+		fmt.Fprintf(conn, "%d topic record\n", ms)
+	}
+	for _, want := range []uint64{now - 2000, now - 3000, now - 1000} {
+		select {
+		case have := <-times:
+			if want != have {
+				t.Errorf("want time %d, have %d", want, have)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for records")
+		}
+	}
+}
@@ -3,122 +3,319 @@ package ingest
 import (
 	"time"
 
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 // NewWriter converts a Log to an io.Writer. Active segments are rotated
-// once sz bytes are written, or every d if the segment is nonempty.
+// once sz bytes are written, or as many as sizer chooses, if it's non-nil, or
+// once their first write is d old, whichever comes first. Empty segments are
+// never rotated.
+//
+// Syncs are group committed: a Sync waits up to commitLatency for others to
+// join it, so that a single sync of the active segment covers all of them.
+// The sync happens early if commitBytes are written in the meantime. With a
+// commitLatency of zero, every Sync is performed immediately.
+//
+// Failed syncs are logged to logger, which may be nil, once per run of them,
+// and rotations at debug level; nothing is logged per write.
 func NewWriter(
 	log Log,
 	d time.Duration,
 	sz int,
+	sizer *SegmentSizer,
+	commitLatency time.Duration,
+	commitBytes int,
+	bytes, records, syncs prometheus.Counter,
+	age, size prometheus.Histogram,
+	logger log.Logger,
+) (*Writer, error) {
+	w, err := newWriter(log, d, sz, sizer, commitLatency, commitBytes, bytes, records, syncs, age, size, logger, time.Now)
+	if err != nil {
+		return nil, err
+	}
+	rotate := time.NewTicker(ageCheckInterval(d))
+	go func() {
+		defer rotate.Stop()
+		w.loop(rotate.C)
+	}()
+	return w, nil
+}
+
+// Segment age is checked a few times per d, so that segments are rotated
+// reasonably soon after they're d old.
+func ageCheckInterval(d time.Duration) time.Duration {
+	if d < 4*time.Millisecond {
+		return time.Millisecond
+	}
+	return d / 4
+}
+
+// newWriter returns a Writer that tells time with now. Run its loop with a
+// source of ticks, which trigger age-based segment rotation.
+func newWriter(
+	log Log,
+	d time.Duration,
+	sz int,
+	sizer *SegmentSizer,
+	commitLatency time.Duration,
+	commitBytes int,
 	bytes, records, syncs prometheus.Counter,
 	age, size prometheus.Histogram,
+	logger log.Logger,
+	now func() time.Time,
 ) (*Writer, error) {
 	curr, err := log.Create()
 	if err != nil {
 		return nil, err
 	}
-	w := &Writer{
-		log:     log,
-		curr:    curr,
-		cursz:   0,
-		maxsz:   sz,
-		action:  make(chan func()),
+	return &Writer{writer: &writer{
+		log:    log,
+		curr:   curr,
+		cursz:  0,
+		maxsz:  sz,
+		sizer:  sizer,
+		maxage: d,
+		now:    now,
+		action: make(chan func()),
+		commit: commitQueue{
+			latency:  commitLatency,
+			maxBytes: commitBytes,
+		},
 		bytes:   bytes,
 		records: records,
 		syncs:   syncs,
 		age:     age,
 		size:    size,
+		logger:  nopIfNil(logger),
 		stop:    make(chan chan struct{}),
+	}}, nil
+}
+
+// nopIfNil returns logger, or a no-op logger, if it's nil. It's for the
+// functions whose Log parameter hides the log package.
+func nopIfNil(logger log.Logger) log.Logger {
+	if logger == nil {
+		return log.NewNopLogger()
 	}
-	go w.loop(d)
-	return w, nil
+	return logger
 }
 
 // Writer implements io.Writer on top of a Log.
+//
+// A Writer may be shared by many connections. Each batched connection, that
+// agreed to FeatureBatch, gets a Writer of its own, in front of the shared
+// one, which holds the Syncs of each batch's records back until the last, so
+// one sync covers the batch.
 type Writer struct {
+	*writer
+	batch *batchReader // of the connection, if it's batched
+	held  bool         // a Sync was held back
+}
+
+// Sync the current segment to disk. Sync returns once a sync covering all
+// previous writes has completed, subject to group commit. On a batched
+// connection, a Sync after a record with more to come in its batch returns
+// at once, and the next covers it.
+func (w *Writer) Sync() error {
+	if w.batch != nil {
+		if w.held = w.batch.more(); w.held {
+			return nil
+		}
+	}
+	return w.writer.Sync()
+}
+
+// release performs the Sync held back, if any, e.g. once the last record of
+// a batch is filtered out, and never written.
+func (w *Writer) release() error {
+	if !w.held {
+		return nil
+	}
+	return w.Sync()
+}
+
+type writer struct {
 	log     Log
 	curr    WriteSegment
 	curts   time.Time // of first write
 	cursz   int
 	maxsz   int
+	sizer   *SegmentSizer // nil for maxsz
+	maxage  time.Duration
+	now     func() time.Time
 	action  chan func()
+	commit  commitQueue
 	bytes   prometheus.Counter
 	records prometheus.Counter
 	syncs   prometheus.Counter
 	age     prometheus.Histogram
 	size    prometheus.Histogram
+	logger  log.Logger
 	stop    chan chan struct{}
 }
 
+// commitQueue collects Syncs waiting for the next group commit.
+type commitQueue struct {
+	latency  time.Duration
+	maxBytes int
+	waiting  []chan<- error   // Syncs covered by the next commit
+	unsynced int              // bytes written since the last commit
+	timer    <-chan time.Time // nil unless a commit is scheduled
+	err      error            // of a commit no Sync was waiting for
+	failing  bool             // since the last commit that succeeded
+}
+
 // Write implements io.Writer.
-func (w *Writer) Write(p []byte) (int, error) {
+func (w *writer) Write(p []byte) (int, error) {
 	type res struct {
 		n   int
 		err error
 	}
 	c := make(chan res)
 	w.action <- func() {
-		n, err := w.curr.Write(p)
-		if err != nil {
-			c <- res{n, err}
-			return
-		}
-		if w.curts.IsZero() {
-			w.curts = time.Now()
-		}
-		w.bytes.Add(float64(n))
-		w.records.Inc()
-		w.cursz += n
-		if w.cursz >= w.maxsz {
-			w.closeRotate()
-		}
+		n, err := w.write(p)
 		c <- res{n, err}
 	}
 	r := <-c
 	return r.n, r.err
 }
 
-// Sync the current segment to disk.
-func (w *Writer) Sync() error {
+// WriteRecord writes a record to the active segment, prefixed with an ID from
+// idGen. The ID is generated as part of the write, so IDs stay in order in the
+// segment, even when many connections share the Writer and the generator.
+func (w *writer) WriteRecord(idGen IDGenerator, record []byte) error {
 	c := make(chan error)
 	w.action <- func() {
-		c <- w.curr.Sync()
-		w.syncs.Inc()
+		_, err := w.write(append([]byte(idGen()+" "), record...))
+		c <- err
+	}
+	return <-c
+}
+
+func (w *writer) write(p []byte) (int, error) {
+	n, err := w.curr.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if w.curts.IsZero() {
+		w.curts = w.now()
+	}
+	w.bytes.Add(float64(n))
+	w.records.Inc()
+	w.cursz += n
+	w.commit.unsynced += n
+	maxsz := w.maxsz
+	if w.sizer != nil {
+		maxsz = w.sizer.written(n)
+	}
+	if w.cursz >= maxsz {
+		w.closeRotate()
+	}
+	return n, nil
+}
+
+func (w *writer) Sync() error {
+	c := make(chan error, 1)
+	w.action <- func() {
+		if err := w.commit.err; err != nil {
+			w.commit.err = nil
+			c <- err // the writes it covered may be lost
+			return
+		}
+		if w.commit.latency > 0 && w.commit.unsynced <= 0 {
+			c <- nil // covered by a previous commit
+			return
+		}
+		w.commit.waiting = append(w.commit.waiting, c)
+		switch {
+		case w.commit.latency <= 0:
+			w.syncWaiting()
+		case w.commit.maxBytes > 0 && w.commit.unsynced >= w.commit.maxBytes:
+			w.syncWaiting()
+		case w.commit.timer == nil:
+			w.commit.timer = time.After(w.commit.latency)
+		}
 	}
 	return <-c
 }
 
+// syncWaiting syncs the current segment, and returns the result to all
+// waiting Syncs. With group commit, a Sync may be covered by a commit that
+// happened before it was invoked, so unsynced writes are synced even without
+// waiting Syncs.
+func (w *writer) syncWaiting() {
+	w.sync(w.commit.latency > 0) // errors go to the Syncs
+}
+
+// syncClosing syncs the current segment before it's closed, if anything
+// written to it is unsynced. A Sync that comes after the segment is closed
+// only syncs the next one, so it can't cover the writes in this one. It
+// reports whether the segment is synced; if not, it's better left active, so
+// recovery trims what a crash may tear from it.
+func (w *writer) syncClosing() bool {
+	return w.sync(true) == nil
+}
+
+func (w *writer) sync(unsynced bool) error {
+	waiting := len(w.commit.waiting) > 0
+	unsynced = unsynced && w.commit.unsynced > 0
+	if !waiting && !unsynced {
+		return nil
+	}
+	err := w.curr.Sync()
+	w.syncs.Inc()
+	switch {
+	case err != nil && !w.commit.failing:
+		level.Error(w.logger).Log("during", "sync", "err", err)
+	case err == nil && w.commit.failing:
+		level.Info(w.logger).Log("during", "sync", "msg", "recovered")
+	}
+	w.commit.failing = err != nil
+	for _, c := range w.commit.waiting {
+		c <- err
+	}
+	if err != nil && !waiting {
+		w.commit.err = err // for the next Sync
+	}
+	w.commit.waiting = w.commit.waiting[:0]
+	w.commit.timer = nil
+	if err == nil {
+		w.commit.unsynced = 0
+	}
+	return err
+}
+
 // Stop terminates the Writer. No further writes are allowed.
-func (w *Writer) Stop() {
+func (w *writer) Stop() {
 	c := make(chan struct{})
 	w.stop <- c
 	<-c
 }
 
 // loop serializes the events that hit the Writer. That includes user requests,
-// like Write, Sync, and Stop; and the time.Ticker that controls time-based
-// segment rotation.
+// like Write, Sync, and Stop; the ticks that drive age-based segment rotation;
+// and the timer that triggers group commits.
 //
 // We need this single point of synchronization only because of the time-based
 // segment rotation, which is asynchronous. Without that, we could control
 // everything pretty elegantly from the Write method via a simple mutex.
-func (w *Writer) loop(d time.Duration) {
-	rotate := time.NewTicker(d)
-	defer rotate.Stop()
+func (w *writer) loop(tick <-chan time.Time) {
 	for {
 		select {
 		case f := <-w.action:
 			f()
 
-		case <-rotate.C:
-			// Note we invoke closeRotate every d, even if it's been only a
-			// short while since the last flush to disk. This could be optimized
-			// by only starting the timer once bytes are written and resetting
-			// it with every segment rotation, at the cost of some garbage
-			// generation. Profiling data is necessary.
-			w.closeRotate()
+		case now := <-tick:
+			// The age of a segment is measured from its first write, so
+			// a segment is never rotated just because it was idle.
+			if w.cursz > 0 && now.Sub(w.curts) >= w.maxage {
+				w.closeRotate()
+			}
+
+		case <-w.commit.timer:
+			w.syncWaiting()
 
 		case c := <-w.stop:
 			w.closeOnly()
@@ -129,40 +326,52 @@ func (w *Writer) loop(d time.Duration) {
 	}
 }
 
-func (w *Writer) closeRotate() {
+func (w *writer) closeRotate() {
 	if w.cursz <= 0 {
 		// closeRotate is called, but the segment is empty!
 		// We can just keep it open, instead of cycling it.
 		return
 	}
+	if !w.syncClosing() { // before the segment goes away
+		return // try again with the next write
+	}
 	if w.curr != nil {
 		if err := w.curr.Close(); err != nil {
+			level.Error(w.logger).Log("during", "close", "err", err)
 			panic(err)
 		}
-		w.age.Observe(time.Since(w.curts).Seconds())
+		w.age.Observe(w.now().Sub(w.curts).Seconds())
 		w.size.Observe(float64(w.cursz))
+		level.Debug(w.logger).Log("during", "rotate", "bytes", w.cursz, "age", w.now().Sub(w.curts))
 	}
 	next, err := w.log.Create()
 	if err != nil {
+		level.Error(w.logger).Log("during", "create", "err", err)
 		panic(err)
 	}
 	w.curr, w.curts, w.cursz = next, time.Time{}, 0
 }
 
-func (w *Writer) closeOnly() {
+func (w *writer) closeOnly() {
 	// This function exists because we need to rotate the active segment away
 	// when the user requests a stop. That is, we shouldn't leave an active
 	// segment lying around.
+	synced := w.syncClosing() // before the segment goes away
 	if w.curr != nil {
-		if w.cursz <= 0 {
+		switch {
+		case w.cursz <= 0:
 			// closeOnly is called, but the segment is empty!
 			// Delete the active segment instead of syncing it.
 			w.curr.Delete()
-		} else {
+		case !synced:
+			// Leave the active segment, for recovery to trim.
+			level.Warn(w.logger).Log("during", "stop", "msg", "leaving the active segment unsynced, for recovery to trim")
+		default:
 			if err := w.curr.Close(); err != nil {
+				level.Error(w.logger).Log("during", "close", "err", err)
 				panic(err)
 			}
-			w.age.Observe(time.Since(w.curts).Seconds())
+			w.age.Observe(w.now().Sub(w.curts).Seconds())
 			w.size.Observe(float64(w.cursz))
 		}
 		w.curr, w.curts, w.cursz = nil, time.Time{}, 0
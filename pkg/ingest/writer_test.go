@@ -0,0 +1,424 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestWriterGroupCommit(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name          string
+		commitLatency time.Duration
+		commitBytes   int
+		writers       int
+		records       int  // per writer
+		everySync     bool // each Sync syncs
+		fewerSyncs    bool // Syncs are coalesced
+	}{
+		{"disabled", 0, 0, 4, 25, true, false},
+		{"by latency", 5 * time.Millisecond, 0, 8, 25, false, true},
+		{"by bytes", time.Hour, 1, 4, 25, false, false},
+	} {
+		testcase := testcase
+		t.Run(testcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Track the size of each file as of its latest sync.
+			var (
+				mtx    sync.Mutex
+				synced = map[string]int64{}
+				syncs  int
+			)
+			filesys := fs.NewVirtualFilesystemWithSyncHook(func(name string, size int64) {
+				mtx.Lock()
+				defer mtx.Unlock()
+				synced[name] = size
+				syncs++
+			})
+			log, err := NewFileLog(filesys, "/", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := newTestWriter(t, log, testcase.commitLatency, testcase.commitBytes)
+			idGen := newTestIDGenerator()
+
+			// Many writers write records, and sync after each one. Once a
+			// sync returns, the record must have been on disk.
+			var wg sync.WaitGroup
+			errs := make(chan error, testcase.writers)
+			for i := 0; i < testcase.writers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < testcase.records; j++ {
+						record := fmt.Sprintf("topic writer %d record %d\n", i, j)
+						if err := w.WriteRecord(idGen, []byte(record)); err != nil {
+							errs <- err
+							return
+						}
+						if err := w.Sync(); err != nil {
+							errs <- err
+							return
+						}
+						if !isSynced(filesys, &mtx, synced, record) {
+							errs <- fmt.Errorf("Sync returned before %q was synced", record)
+							return
+						}
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Fatal(err)
+			}
+			w.Stop()
+
+			total := testcase.writers * testcase.records
+			mtx.Lock()
+			defer mtx.Unlock()
+			if testcase.everySync && syncs != total {
+				t.Errorf("want %d syncs, have %d", total, syncs)
+			}
+			if testcase.fewerSyncs && syncs >= total {
+				t.Errorf("want fewer than %d syncs, have %d", total, syncs)
+			}
+
+			// Records from all writers share a segment, in ID order.
+			ids := readIDs(t, filesys)
+			if want, have := total, len(ids); want != have {
+				t.Errorf("want %d records, have %d", want, have)
+			}
+			if !sort.StringsAreSorted(ids) {
+				t.Errorf("record IDs aren't sorted")
+			}
+		})
+	}
+}
+
+func TestWriterFlushAge(t *testing.T) {
+	t.Parallel()
+
+	filesys := fs.NewVirtualFilesystem()
+	log, err := NewFileLog(filesys, "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fake clock drives the writer.
+	var (
+		epoch = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		now   = epoch
+		tick  = make(chan time.Time)
+		d     = 3 * time.Second
+	)
+	w, err := newWriter(
+		log, d, 1024*1024, nil, 0, 0,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		nil,
+		func() time.Time { return now },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go w.loop(tick)
+	defer w.Stop()
+
+	// advance the clock, and wait for the writer to notice.
+	advance := func(by time.Duration) {
+		now = now.Add(by)
+		tick <- now
+		w.Sync() // round trip through the loop
+	}
+	flushed := func() int {
+		stats, err := log.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int(stats.FlushedSegments)
+	}
+
+	// An empty segment is never flushed.
+	advance(2 * d)
+	if want, have := 0, flushed(); want != have {
+		t.Fatalf("empty: want %d flushed segments, have %d", want, have)
+	}
+
+	// A nonempty segment is flushed once its first write is d old.
+	if _, err := w.Write([]byte("01BB6RQR190000000000000000 topic hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	advance(d - time.Second)
+	if want, have := 0, flushed(); want != have {
+		t.Fatalf("younger than d: want %d flushed segments, have %d", want, have)
+	}
+	advance(time.Second)
+	if want, have := 1, flushed(); want != have {
+		t.Fatalf("d old: want %d flushed segments, have %d", want, have)
+	}
+
+	// The new active segment is empty, so it stays put.
+	advance(2 * d)
+	if want, have := 1, flushed(); want != have {
+		t.Fatalf("after flush: want %d flushed segments, have %d", want, have)
+	}
+}
+
+func BenchmarkWriterGroupCommit(b *testing.B) {
+	const writers = 16
+	for _, commitLatency := range []time.Duration{0, time.Millisecond, 5 * time.Millisecond} {
+		b.Run(fmt.Sprintf("latency=%s", commitLatency), func(b *testing.B) {
+			// Simulate a disk which takes a while to sync.
+			filesys := fs.NewVirtualFilesystemWithSyncHook(func(string, int64) {
+				time.Sleep(500 * time.Microsecond)
+			})
+			log, err := NewFileLog(filesys, "/", "", nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			w := newTestWriter(b, log, commitLatency, 1024*1024)
+			defer w.Stop()
+			idGen := newTestIDGenerator()
+			record := []byte("topic some moderately sized record, typical of a log line\n")
+
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for i := 0; i < writers; i++ {
+				n := b.N / writers
+				if i < b.N%writers {
+					n++
+				}
+				wg.Add(1)
+				go func(n int) {
+					defer wg.Done()
+					for j := 0; j < n; j++ {
+						if err := w.WriteRecord(idGen, record); err != nil {
+							b.Error(err)
+							return
+						}
+						if err := w.Sync(); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				}(n)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestWriterCrashConsistency(t *testing.T) {
+	t.Parallel()
+
+	for seed := int64(0); seed < 100; seed++ {
+		// A durable writer writes records, until a fault, or a crash, at a
+		// random point. Segments are small, so they're rotated often.
+		var (
+			rng     = rand.New(rand.NewSource(seed))
+			filesys = fs.NewFaultyFilesystem(fs.NewVirtualFilesystem())
+			op      = []string{"write", "sync"}[rng.Intn(2)]
+			crash   = rng.Intn(100)
+			written = map[string]bool{}
+			acked   []string
+		)
+		filesys.SetTornWrites(rng.Intn(2) == 0)
+		filesys.Fail(op, 1+rng.Intn(100))
+		log, err := NewFileLog(filesys, "/", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := NewWriter(
+			log, time.Hour, 200, nil, 0, 0,
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			nil,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idGen := newTestIDGenerator()
+		for i := 0; i < crash; i++ {
+			record := fmt.Sprintf("record %d", i)
+			written[record] = true
+			if err := w.WriteRecord(idGen, []byte(record+"\n")); err != nil {
+				break
+			}
+			if err := w.Sync(); err != nil {
+				break
+			}
+			acked = append(acked, record)
+		}
+
+		// The writer and its log are abandoned, as if the process died: a
+		// new log recovers their segments.
+		if err := filesys.Crash(); err != nil {
+			t.Fatal(err)
+		}
+		recovered, err := NewFileLog(filesys, "/", "", nil)
+		if err != nil {
+			t.Fatalf("seed %d: recovering: %v", seed, err)
+		}
+		have := map[string]bool{}
+		for _, line := range readRecords(t, filesys) {
+			if len(line) <= ulid.EncodedSize || !written[line[ulid.EncodedSize+1:]] {
+				t.Errorf("seed %d: %s fault: recovered %q, which wasn't written", seed, op, line)
+				continue
+			}
+			have[line[ulid.EncodedSize+1:]] = true
+		}
+		for _, record := range acked {
+			if !have[record] {
+				t.Errorf("seed %d: %s fault: %q was acknowledged, but lost", seed, op, record)
+			}
+		}
+		recovered.Close()
+	}
+}
+
+func TestWriterLogsFailedSyncs(t *testing.T) {
+	t.Parallel()
+
+	var (
+		filesys = fs.NewFaultyFilesystem(fs.NewVirtualFilesystem())
+		events  []string
+		logger  = log.LoggerFunc(func(keyvals ...interface{}) error {
+			events = append(events, fmt.Sprint(keyvals...)) // from the Writer's loop only
+			return nil
+		})
+	)
+	ingestLog, err := NewFileLog(filesys, "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriter(
+		ingestLog, time.Hour, 1024*1024, nil, 0, 0,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		logger,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// A run of failed syncs is logged once, as is the recovery from it.
+	idGen := newTestIDGenerator()
+	for _, fail := range []bool{true, true, false, false} {
+		if fail {
+			filesys.Fail("sync", 1)
+		}
+		if err := w.WriteRecord(idGen, []byte("topic record\n")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Sync(); (err != nil) != fail {
+			t.Fatalf("want failure %v, have %v", fail, err)
+		}
+	}
+	want := []string{
+		fmt.Sprint(level.Key(), level.ErrorValue(), "during", "sync", "err", fs.ErrInjected),
+		fmt.Sprint(level.Key(), level.InfoValue(), "during", "sync", "msg", "recovered"),
+	}
+	if have := events; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func newTestWriter(t testing.TB, log Log, commitLatency time.Duration, commitBytes int) *Writer {
+	w, err := NewWriter(
+		log, time.Hour, 1024*1024*1024, nil, commitLatency, commitBytes,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func newTestIDGenerator() IDGenerator {
+	clock := newStreamClock()
+	return func() string { return ulid.MustNew(ulid.Now(), clock).String() }
+}
+
+// isSynced reports whether the record is within the synced part of a file.
+func isSynced(filesys fs.Filesystem, mtx *sync.Mutex, synced map[string]int64, record string) bool {
+	mtx.Lock()
+	defer mtx.Unlock()
+	for name, size := range synced {
+		f, err := filesys.Open(name)
+		if err != nil {
+			continue // flushed, and renamed
+		}
+		buf, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		if bytes.Contains(buf[:size], []byte(" "+record)) {
+			return true
+		}
+	}
+	return false
+}
+
+// readIDs reads the record IDs from every flushed segment, in order.
+func readIDs(t *testing.T, filesys fs.Filesystem) (ids []string) {
+	for _, record := range readRecords(t, filesys) {
+		ids = append(ids, record[:ulid.EncodedSize])
+	}
+	return ids
+}
+
+// readRecords reads the records from every flushed segment, in order.
+func readRecords(t *testing.T, filesys fs.Filesystem) (records []string) {
+	filesys.Walk("/", func(path string, info os.FileInfo, err error) error {
+		if filepath.Ext(path) != extFlushed {
+			return nil
+		}
+		f, err := filesys.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			records = append(records, s.Text())
+		}
+		return s.Err()
+	})
+	return records
+}
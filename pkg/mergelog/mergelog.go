@@ -0,0 +1,321 @@
+// Package mergelog merges logs of ULID-prefixed records, such as OK Log's
+// segments, into one, in ULID order, deduplicating records with the same
+// ULID, e.g. replicas of one record. It's how store nodes merge segments, as
+// they compact and query them, and it works as well offline, on exported
+// segments.
+//
+// A record is a line that starts with its ULID, in its text encoding, and
+// then a space, or the end of the line. Each log must be in ULID order, as
+// segments are, oldest first, or with Options.Descending, newest first.
+//
+// Lines that aren't records are malformed. By default, they're skipped, and
+// counted; with Options.Strict, they fail the merge, as do records out of
+// order. Otherwise, a record out of order is merged where it's found, so the
+// merge is out of order, too.
+package mergelog
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// DefaultMaxRecordSize is the size of the biggest record that may be merged,
+// by default, with its newline: that of the biggest record ingesters accept.
+// Bigger records fail the merge.
+const DefaultMaxRecordSize = record.MaxLineSize
+
+// Options of a merge. The zero value merges logs oldest first,
+// deduplicating, and skipping malformed lines.
+type Options struct {
+	Descending     bool // the logs, and the merge, are newest first
+	KeepDuplicates bool // yield every record with the same ULID, not just the first
+	Strict         bool // fail on malformed lines, and records out of order
+	MaxRecordSize  int  // if zero, DefaultMaxRecordSize
+}
+
+// Errors of records, with Options.Strict.
+var (
+	ErrMalformed  = errors.New("malformed record")
+	ErrOutOfOrder = errors.New("record out of order")
+)
+
+// RecordError is the error of a merge that fails on a record.
+type RecordError struct {
+	Reader int   // index of the reader of the record
+	Line   int64 // of the record in its reader, from 1
+	Err    error // ErrMalformed or ErrOutOfOrder
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("reader %d, line %d: %v", e.Reader, e.Line, e.Err)
+}
+
+// Merger merges records from several readers. Only the current record of
+// each reader is held in memory, so memory use is proportional to the number
+// of readers, not their size. Use it like a bufio.Scanner:
+//
+//	m := mergelog.NewMerger(mergelog.Options{}, readers...)
+//	for m.Next() {
+//		use(m.ID(), m.Record())
+//	}
+//	if err := m.Err(); err != nil {
+//		...
+//	}
+type Merger struct {
+	opts       Options
+	cursors    cursorHeap
+	started    bool    // cursors are initialized
+	yielded    *cursor // whose record was yielded, and is advanced next
+	record     []byte
+	id         ulid.ULID
+	err        error
+	duplicates int64 // atomic
+	malformed  int64 // atomic
+}
+
+// NewMerger returns a Merger of the readers, which may include nil ones.
+func NewMerger(opts Options, readers ...io.Reader) *Merger {
+	if opts.MaxRecordSize <= 0 {
+		opts.MaxRecordSize = DefaultMaxRecordSize
+	}
+	m := &Merger{opts: opts}
+	m.cursors.descending = opts.Descending
+	for i, r := range readers {
+		if r == nil {
+			continue
+		}
+		s := bufio.NewScanner(r)
+		s.Split(scanLinesPreserveNewline)
+		initial := 64 * 1024
+		if initial > opts.MaxRecordSize {
+			initial = opts.MaxRecordSize
+		}
+		s.Buffer(make([]byte, initial), opts.MaxRecordSize)
+		m.cursors.c = append(m.cursors.c, &cursor{index: i, scanner: s})
+	}
+	return m
+}
+
+// Next advances the merge to the next record, which is then available from
+// Record and ID. It returns false when every reader is drained, or the merge
+// fails; Err tells which.
+func (m *Merger) Next() bool {
+	if m.err != nil {
+		return false
+	}
+	if !m.started {
+		m.started = true
+		cursors := m.cursors.c[:0]
+		for _, c := range m.cursors.c {
+			ok, err := c.advance(m)
+			if err != nil {
+				m.err = err
+				return false
+			}
+			if ok {
+				cursors = append(cursors, c)
+			}
+		}
+		m.cursors.c = cursors
+		heap.Init(&m.cursors)
+	}
+
+	// The record yielded last is in its scanner's buffer, so its cursor is
+	// only advanced now.
+	if m.yielded != nil {
+		last := m.yielded.id
+		m.yielded = nil
+		if err := m.pop(); err != nil {
+			m.err = err
+			return false
+		}
+		for !m.opts.KeepDuplicates && len(m.cursors.c) > 0 && m.cursors.c[0].id == last {
+			atomic.AddInt64(&m.duplicates, 1)
+			if err := m.pop(); err != nil {
+				m.err = err
+				return false
+			}
+		}
+	}
+	if len(m.cursors.c) == 0 {
+		return false
+	}
+	c := m.cursors.c[0]
+	m.yielded, m.record, m.id = c, c.record, c.id
+	return true
+}
+
+// pop advances the cursor of the first record, and restores heap order.
+func (m *Merger) pop() error {
+	ok, err := m.cursors.c[0].advance(m)
+	if err != nil {
+		return err
+	}
+	if ok {
+		heap.Fix(&m.cursors, 0)
+	} else {
+		heap.Remove(&m.cursors, 0)
+	}
+	return nil
+}
+
+// Record returns the current record, with its newline, which is added if its
+// reader ended without one. It's only valid until the next call to Next.
+func (m *Merger) Record() []byte { return m.record }
+
+// ID returns the ULID of the current record.
+func (m *Merger) ID() ulid.ULID { return m.id }
+
+// Err returns the error that failed the merge, if any. A reader that fails
+// fails the merge, as does a record bigger than Options.MaxRecordSize, and,
+// with Options.Strict, a RecordError.
+func (m *Merger) Err() error { return m.err }
+
+// Duplicates returns the number of records skipped so far, as they had the
+// ULID of the record before them. It's safe to call during the merge.
+func (m *Merger) Duplicates() int64 { return atomic.LoadInt64(&m.duplicates) }
+
+// Malformed returns the number of malformed lines skipped so far. It's safe
+// to call during the merge.
+func (m *Merger) Malformed() int64 { return atomic.LoadInt64(&m.malformed) }
+
+// cursor is the current record of one reader.
+type cursor struct {
+	index   int // of the reader, to break ties
+	scanner *bufio.Scanner
+	line    int64
+	record  []byte
+	id      ulid.ULID
+	buf     []byte // of a record without its newline, at the end of its reader
+}
+
+// advance to the next record, skipping malformed lines, unless the merge is
+// strict. It returns false once the reader is drained.
+func (c *cursor) advance(m *Merger) (bool, error) {
+	prev, first := c.id, c.line == 0
+	for c.scanner.Scan() {
+		c.line++
+		record := c.scanner.Bytes()
+		if !parseRecord(record, &c.id) {
+			if m.opts.Strict {
+				return false, &RecordError{Reader: c.index, Line: c.line, Err: ErrMalformed}
+			}
+			atomic.AddInt64(&m.malformed, 1)
+			continue
+		}
+		if m.opts.Strict && !first && before(c.id, prev, m.opts.Descending) {
+			return false, &RecordError{Reader: c.index, Line: c.line, Err: ErrOutOfOrder}
+		}
+		if record[len(record)-1] != '\n' {
+			c.buf = append(append(c.buf[:0], record...), '\n')
+			record = c.buf
+		}
+		c.record = record
+		return true, nil
+	}
+	return false, errors.Wrapf(c.scanner.Err(), "reader %d", c.index)
+}
+
+// parseRecord parses the ULID of record into id, and returns whether the
+// record is well-formed.
+func parseRecord(record []byte, id *ulid.ULID) bool {
+	line := bytes.TrimSuffix(record, []byte{'\n'})
+	if len(line) < ulid.EncodedSize || len(line) > ulid.EncodedSize && line[ulid.EncodedSize] != ' ' {
+		return false
+	}
+	return id.UnmarshalText(line[:ulid.EncodedSize]) == nil
+}
+
+// before reports whether a comes before b, oldest first, or newest first, if
+// descending.
+func before(a, b ulid.ULID, descending bool) bool {
+	if descending {
+		return a.Compare(b) > 0
+	}
+	return a.Compare(b) < 0
+}
+
+// cursorHeap orders cursors by the ULIDs of their current records, oldest
+// first, or newest first, if it's descending. Of records with the same ULID,
+// the one from the first reader comes first, either way.
+type cursorHeap struct {
+	c          []*cursor
+	descending bool
+}
+
+func (h cursorHeap) Len() int { return len(h.c) }
+func (h cursorHeap) Less(i, j int) bool {
+	if h.c[i].id != h.c[j].id {
+		return before(h.c[i].id, h.c[j].id, h.descending)
+	}
+	return h.c[i].index < h.c[j].index
+}
+func (h cursorHeap) Swap(i, j int)       { h.c[i], h.c[j] = h.c[j], h.c[i] }
+func (h *cursorHeap) Push(x interface{}) { h.c = append(h.c, x.(*cursor)) }
+func (h *cursorHeap) Pop() interface{} {
+	c := h.c[len(h.c)-1]
+	h.c = h.c[:len(h.c)-1]
+	return c
+}
+
+// Like bufio.ScanLines, but retain the \n.
+func scanLinesPreserveNewline(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[0 : i+1], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Reader reads the records of a merge, as one log.
+type Reader struct {
+	*Merger
+	pending []byte // rest of the record being read
+}
+
+// NewReader returns a Reader of the merge of the readers.
+func NewReader(opts Options, readers ...io.Reader) *Reader {
+	return &Reader{Merger: NewMerger(opts, readers...)}
+}
+
+// NewMergeReader returns a reader of the records of the readers, each in ULID
+// order, merged in ULID order, and deduplicated, skipping malformed lines.
+func NewMergeReader(readers ...io.Reader) io.Reader {
+	return NewReader(Options{}, readers...)
+}
+
+// Read implements io.Reader. Records may be read in parts.
+func (r *Reader) Read(p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		if len(r.pending) == 0 {
+			if !r.Next() {
+				if err := r.Err(); err != nil {
+					return n, err
+				}
+				if n == 0 {
+					return 0, io.EOF
+				}
+				break
+			}
+			r.pending = r.Record()
+		}
+		m := copy(p[n:], r.pending)
+		r.pending, n = r.pending[m:], n+m
+	}
+	return n, nil
+}
@@ -0,0 +1,227 @@
+package mergelog
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/oklog/ulid"
+)
+
+func TestMergeReader(t *testing.T) {
+	t.Parallel()
+
+	a, b, c := rec(1, "a"), rec(2, "b"), rec(3, "c")
+	for _, testcase := range []struct {
+		name  string
+		input []string
+		want  string
+	}{
+		{"none", nil, ""},
+		{"empty", []string{"", ""}, ""},
+		{"one", []string{a + b + c}, a + b + c},
+		{"interleaved", []string{a + c, b}, a + b + c},
+		{"duplicates", []string{a + b, a + b + c, b + c}, a + b + c},
+		{"no trailing newline", []string{strings.TrimSuffix(a+c, "\n"), b}, a + b + c},
+		{"malformed", []string{a + "\n" + "short\n" + c, "not a ulid at all, but long enough\n" + b}, a + b + c},
+		{"bare ULID", []string{id(1) + "\n", b}, id(1) + "\n" + b},
+	} {
+		readers := make([]io.Reader, len(testcase.input))
+		for i, s := range testcase.input {
+			readers[i] = strings.NewReader(s)
+		}
+		have, err := ioutil.ReadAll(NewMergeReader(readers...))
+		if err != nil {
+			t.Errorf("%s: %v", testcase.name, err)
+			continue
+		}
+		if want, have := testcase.want, string(have); want != have {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+	}
+}
+
+func TestMergerOptions(t *testing.T) {
+	t.Parallel()
+
+	a, b, c := rec(1, "a"), rec(2, "b"), rec(3, "c")
+	for _, testcase := range []struct {
+		name       string
+		opts       Options
+		input      []string
+		want       []string
+		duplicates int64
+		malformed  int64
+		err        error
+	}{
+		{
+			name:       "deduplicated",
+			input:      []string{a + b, rec(2, "B") + c},
+			want:       []string{a, b, c}, // the first reader's wins
+			duplicates: 1,
+		},
+		{
+			name:  "duplicates kept",
+			opts:  Options{KeepDuplicates: true},
+			input: []string{a + b, rec(2, "B") + c},
+			want:  []string{a, b, rec(2, "B"), c},
+		},
+		{
+			name:       "descending",
+			opts:       Options{Descending: true},
+			input:      []string{c + a, c + b},
+			want:       []string{c, b, a},
+			duplicates: 1,
+		},
+		{
+			name:      "malformed skipped",
+			input:     []string{a + "junk\n" + c, b + "\n"},
+			want:      []string{a, b, c},
+			malformed: 2,
+		},
+		{
+			name:  "malformed strict",
+			opts:  Options{Strict: true},
+			input: []string{a + c, b + "junk\n"},
+			want:  []string{a, b}, // the merge fails as the reader reaches the line
+			err:   &RecordError{Reader: 1, Line: 2, Err: ErrMalformed},
+		},
+		{
+			name:  "out of order",
+			input: []string{c + a, b},
+			want:  []string{b, c, a},
+		},
+		{
+			name:  "out of order strict",
+			opts:  Options{Strict: true},
+			input: []string{c + a, b},
+			want:  []string{b, c},
+			err:   &RecordError{Reader: 0, Line: 2, Err: ErrOutOfOrder},
+		},
+	} {
+		readers := make([]io.Reader, len(testcase.input))
+		for i, s := range testcase.input {
+			readers[i] = strings.NewReader(s)
+		}
+		m := NewMerger(testcase.opts, readers...)
+		var have []string
+		for m.Next() {
+			if want, have := m.Record()[:ulid.EncodedSize], []byte(m.ID().String()); string(want) != string(have) {
+				t.Errorf("%s: ID: want %s, have %s", testcase.name, want, have)
+			}
+			have = append(have, string(m.Record()))
+		}
+		if want := testcase.want; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+		if want, have := testcase.err, m.Err(); !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want error %v, have %v", testcase.name, want, have)
+		}
+		if want, have := testcase.duplicates, m.Duplicates(); want != have {
+			t.Errorf("%s: want %d duplicates, have %d", testcase.name, want, have)
+		}
+		if want, have := testcase.malformed, m.Malformed(); want != have {
+			t.Errorf("%s: want %d malformed, have %d", testcase.name, want, have)
+		}
+	}
+}
+
+func TestMergeRandom(t *testing.T) {
+	t.Parallel()
+
+	// Random logs, each with a random subset of the records, so that many
+	// are duplicated across them, and some within one, merge to the sorted
+	// set of every record.
+	for seed := int64(0); seed < 200; seed++ {
+		var (
+			rng      = rand.New(rand.NewSource(seed))
+			nRecords = rng.Intn(200)
+			nReaders = 1 + rng.Intn(8)
+			logs     = make([][]string, nReaders)
+			want     []string
+			copies   int64
+		)
+		for i, ms := 0, uint64(0); i < nRecords; i++ {
+			ms += uint64(rng.Intn(3)) // records often share a millisecond
+			want = append(want, fmt.Sprintf("%s record %d\n", ulid.MustNew(ms, rng), i))
+		}
+		sort.Strings(want)
+		for _, r := range want {
+			j := rng.Intn(nReaders)
+			logs[j] = append(logs[j], r)
+			for j := range logs {
+				for rng.Intn(4) == 0 {
+					logs[j], copies = append(logs[j], r), copies+1
+				}
+			}
+		}
+		for _, descending := range []bool{false, true} {
+			want := want
+			if descending {
+				want = reversed(want)
+			}
+			readers := make([]io.Reader, nReaders)
+			for j := range logs {
+				records := logs[j]
+				if descending {
+					records = reversed(records)
+				}
+				readers[j] = strings.NewReader(strings.Join(records, ""))
+			}
+			mr := NewReader(Options{Descending: descending}, readers...)
+			var r io.Reader = mr
+			if seed%2 == 0 {
+				r = iotest.OneByteReader(r) // records are read in parts
+			}
+			have, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("seed %d: %v", seed, err)
+			}
+			if want, have := strings.Join(want, ""), string(have); want != have {
+				t.Fatalf("seed %d, descending %v: want\n%s\nhave\n%s", seed, descending, want, have)
+			}
+			if want, have := copies, mr.Duplicates(); want != have {
+				t.Fatalf("seed %d, descending %v: want %d duplicates, have %d", seed, descending, want, have)
+			}
+		}
+	}
+}
+
+func TestMaxRecordSize(t *testing.T) {
+	t.Parallel()
+
+	big := rec(1, strings.Repeat("x", 100))
+	for _, testcase := range []struct {
+		max int
+		ok  bool
+	}{
+		{max: len(big), ok: true},
+		{max: len(big) - 1, ok: false},
+	} {
+		m := NewMerger(Options{MaxRecordSize: testcase.max}, strings.NewReader(big))
+		if want, have := testcase.ok, m.Next(); want != have {
+			t.Errorf("%d: want %v, have %v (%v)", testcase.max, want, have, m.Err())
+		}
+		if want, have := testcase.ok, m.Err() == nil; want != have {
+			t.Errorf("%d: want no error %v, have %v", testcase.max, want, m.Err())
+		}
+	}
+}
+
+func id(ms uint64) string { return ulid.MustNew(ms, nil).String() }
+
+func rec(ms uint64, s string) string { return id(ms) + " " + s + "\n" }
+
+func reversed(a []string) []string {
+	r := make([]string, len(a))
+	for i := range a {
+		r[len(a)-1-i] = a[i]
+	}
+	return r
+}
@@ -0,0 +1,198 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// FramingHandshake is the line a client writes first, to send records with
+// length-prefixed framing instead of newlines: each record is a uvarint
+// length, followed by that many bytes, which may include newlines, or any
+// other bytes. The records are otherwise the same, e.g. they start with a
+// topic, if the ingester expects one.
+const FramingHandshake = "FRAMING length-prefixed"
+
+// EscapeMarker starts the payload of an escaped record, i.e. everything after
+// its topic. Records sent with length-prefixed framing are stored escaped, so
+// each is still a line: their backslashes are doubled, and their newlines are
+// written as \n. Other records are stored as they are, unless their payload
+// starts with the marker; then they're escaped too, so Unescape is exact.
+const EscapeMarker = '\x1e'
+
+// Escape returns the payload, escaped, and prefixed with EscapeMarker.
+func Escape(payload []byte) []byte {
+	buf := make([]byte, 0, 1+len(payload)+bytes.Count(payload, []byte{'\n'})+bytes.Count(payload, []byte{'\\'}))
+	buf = append(buf, EscapeMarker)
+	for _, c := range payload {
+		switch c {
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\\':
+			buf = append(buf, '\\', '\\')
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+// Unescape returns the record as it was ingested, given the record as it's
+// stored, without its ULID. Records that weren't escaped are returned as they
+// are, so it's safe to call on any record.
+func Unescape(record []byte) []byte {
+	i := bytes.IndexByte(record, ' ')
+	if i < 0 || i+1 >= len(record) || record[i+1] != EscapeMarker {
+		return record
+	}
+	var (
+		payload = record[i+2:]
+		buf     = append(make([]byte, 0, len(record)), record[:i+1]...)
+	)
+	for j := 0; j < len(payload); j++ {
+		c := payload[j]
+		if c == '\\' && j+1 < len(payload) {
+			j++
+			switch c = payload[j]; c {
+			case 'n':
+				c = '\n'
+			case '\\':
+			default:
+				buf = append(buf, '\\') // never escaped; keep it
+			}
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+// AppendFrame appends the record to dst with length-prefixed framing.
+func AppendFrame(dst, record []byte) []byte {
+	var n [binary.MaxVarintLen64]byte
+	dst = append(dst, n[:binary.PutUvarint(n[:], uint64(len(record)))]...)
+	return append(dst, record...)
+}
+
+// ScanFrames is a bufio.SplitFunc for records with length-prefixed framing.
+// Each token is a record, without its length.
+func ScanFrames(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	n, k := binary.Uvarint(data)
+	switch {
+	case k < 0:
+		return 0, nil, errFrameTooLong
+	case k > 0 && uint64(len(data)-k) >= n:
+		return k + int(n), data[k : k+int(n)], nil
+	case atEOF && len(data) > 0:
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	return 0, nil, nil // request more data
+}
+
+var errFrameTooLong = errors.New("record length overflows")
+
+// recordReader reads records from br, newline-delimited, unless the client
+// opens with FramingHandshake. Records are at most maxSize bytes; see readLine.
+type recordReader struct {
+	br        *bufio.Reader
+	maxSize   int
+	policy    SizePolicy
+	oversized func()
+	started   bool // the first line was read
+	framed    bool
+}
+
+func newRecordReader(r io.Reader, maxSize int, policy SizePolicy, oversized func()) *recordReader {
+	return &recordReader{br: bufio.NewReader(r), maxSize: maxSize, policy: policy, oversized: oversized}
+}
+
+// next returns the next record, and whether it was framed. Records that
+// weren't end with their newline; framed records don't.
+func (r *recordReader) next() (record []byte, framed bool, err error) {
+	if r.framed {
+		record, err = readFrame(r.br, r.maxSize, r.policy, r.oversized)
+		return record, true, err
+	}
+	if record, err = readLine(r.br, r.maxSize, r.policy, r.oversized); err != nil {
+		return nil, false, err
+	}
+	if !r.started {
+		r.started = true
+		if string(record) == FramingHandshake+"\n" {
+			r.framed = true
+			return r.next()
+		}
+	}
+	return record, false, nil
+}
+
+// line returns the record, made of prefix and payload, as the line it's
+// stored as. The payload is escaped if it was framed, or if it starts with
+// EscapeMarker.
+func line(prefix, payload []byte, framed bool) []byte {
+	if !framed && (len(payload) == 0 || payload[0] != EscapeMarker) {
+		return append(prefix[:len(prefix):len(prefix)], payload...)
+	}
+	if !framed {
+		payload = payload[:len(payload)-1] // the newline
+	}
+	escaped := Escape(payload)
+	buf := make([]byte, 0, len(prefix)+len(escaped)+1)
+	return append(append(append(buf, prefix...), escaped...), '\n')
+}
+
+// readFrame reads the next record from br with length-prefixed framing. Like
+// readLine, it keeps at most maxSize bytes of a record in memory, and
+// truncates or rejects longer ones per the policy. The record is returned
+// without a trailing newline, since it may end with one of its own.
+func readFrame(br *bufio.Reader, maxSize int, policy SizePolicy, oversized func()) ([]byte, error) {
+	for {
+		n, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		if maxSize <= 0 || n <= uint64(maxSize) {
+			// The buffer grows as the record arrives, so a bogus length
+			// doesn't allocate it all up front.
+			var buf bytes.Buffer
+			if _, err := io.CopyN(&buf, br, int64(n)); err != nil {
+				return nil, unexpected(err)
+			}
+			return buf.Bytes(), nil
+		}
+
+		if oversized != nil {
+			oversized()
+		}
+		keep := 0
+		if policy == Truncate {
+			keep = maxSize - len(TruncatedMarker)
+			if keep < 0 {
+				keep = 0
+			}
+		}
+		record := make([]byte, keep)
+		if _, err := io.ReadFull(br, record); err != nil {
+			return nil, unexpected(err)
+		}
+		if _, err := io.CopyN(ioutil.Discard, br, int64(n)-int64(keep)); err != nil {
+			return nil, unexpected(err)
+		}
+		if policy == Truncate {
+			return append(record, TruncatedMarker...), nil
+		}
+	}
+}
+
+// unexpected turns EOF in the middle of a record into io.ErrUnexpectedEOF.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,205 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var framingPayloads = []string{
+	"plain",
+	"multi\nline\nrecord",
+	"trailing newline\n",
+	"\n",
+	"",
+	`back\slash \n not a newline \\n`,
+	"\x1e starts with the marker",
+	"binary \x00\x01\xff\xfe\r\n\x1b[31m",
+	string(allBytes()),
+}
+
+func allBytes() []byte {
+	b := make([]byte, 256)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+func TestFramingRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name    string
+		factory ReaderFactory
+		topic   string // prepended by the client, if the factory is dynamic
+	}{
+		{"dynamic", DynamicReaderFactory(0, Truncate, nil), "topic_A "},
+		{"static", StaticReaderFactory([]byte("topic_B"), 0, Truncate, nil), ""},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			input := []byte(FramingHandshake + "\n")
+			for _, payload := range framingPayloads {
+				input = AppendFrame(input, []byte(testcase.topic+payload))
+			}
+
+			r := testcase.factory(bytes.NewReader(input))
+			for _, payload := range framingPayloads {
+				stored, err := r()
+				if err != nil {
+					t.Fatalf("%q: %v", payload, err)
+				}
+				if i := bytes.IndexByte(stored, '\n'); i != len(stored)-1 {
+					t.Fatalf("%q: stored as %q, which isn't one line", payload, stored)
+				}
+				want := "topic_A " + payload
+				if testcase.topic == "" {
+					want = "topic_B " + payload
+				}
+				if have := string(Unescape(stored[:len(stored)-1])); want != have {
+					t.Errorf("want %q, have %q", want, have)
+				}
+			}
+			if _, err := r(); err != io.EOF {
+				t.Errorf("want EOF, have %v", err)
+			}
+		})
+	}
+}
+
+func TestFramingNegotiation(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name  string
+		input string
+		err   error
+		want  []string // as stored
+	}{
+		{
+			name:  "lines",
+			input: "topic_A foo\ntopic_A bar\n",
+			want:  []string{"topic_A foo\n", "topic_A bar\n"},
+		},
+		{
+			name:  "handshake after the first line",
+			input: "topic_A foo\n" + FramingHandshake + "\n",
+			want:  []string{"topic_A foo\n", FramingHandshake + "\n"},
+		},
+		{
+			name:  "line with the marker",
+			input: "topic_A \x1efoo\\n\n",
+			want:  []string{"topic_A \x1e\x1efoo\\\\n\n"},
+		},
+		{
+			name:  "framed",
+			input: string(AppendFrame([]byte(FramingHandshake+"\n"), []byte("topic_A foo\nbar"))),
+			want:  []string{"topic_A \x1efoo\\nbar\n"},
+		},
+		{
+			name:  "framed without a topic",
+			input: string(AppendFrame([]byte(FramingHandshake+"\n"), []byte("foo\nbar"))),
+			want:  []string{"default \x1efoo\\nbar\n"},
+		},
+		{
+			name:  "partial frame",
+			input: string(AppendFrame([]byte(FramingHandshake+"\n"), []byte("topic_A foo"))[:len(FramingHandshake)+5]),
+			err:   io.ErrUnexpectedEOF,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var (
+				r    = NewDynamicReader(strings.NewReader(testcase.input))
+				have []string
+				err  error
+			)
+			for {
+				var rec []byte
+				if rec, err = r(); err != nil {
+					break
+				}
+				have = append(have, string(rec))
+			}
+			if want := testcase.err; (want == nil && err != io.EOF) || (want != nil && err != want) {
+				t.Errorf("want error %v, have %v", want, err)
+			}
+			if !reflect.DeepEqual(testcase.want, have) {
+				t.Errorf("want %q, have %q", testcase.want, have)
+			}
+		})
+	}
+}
+
+func TestFramingMaxSize(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name   string
+		policy SizePolicy
+		want   []string
+	}{
+		{"truncate", Truncate, []string{"topic_A \x1eshort\\n\n", "topic_A \x1e" + "012345678901" + TruncatedMarker + "\n", "topic_A \x1eafter\n"}},
+		{"reject", Reject, []string{"topic_A \x1eshort\\n\n", "topic_A \x1eafter\n"}},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			input := []byte(FramingHandshake + "\n")
+			for _, payload := range []string{"short\n", "0123456789012345678901234567890123456789", "after"} {
+				input = AppendFrame(input, []byte("topic_A "+payload))
+			}
+			var (
+				oversized int
+				r         = DynamicReaderFactory(32, testcase.policy, func() { oversized++ })(bytes.NewReader(input))
+				have      []string
+			)
+			for {
+				rec, err := r()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				have = append(have, string(rec))
+			}
+			if !reflect.DeepEqual(testcase.want, have) {
+				t.Errorf("want %q, have %q", testcase.want, have)
+			}
+			if want, have := 1, oversized; want != have {
+				t.Errorf("oversized: want %d, have %d", want, have)
+			}
+		})
+	}
+}
+
+func TestScanFrames(t *testing.T) {
+	t.Parallel()
+
+	var input []byte
+	for _, payload := range framingPayloads {
+		input = AppendFrame(input, []byte(payload))
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(input))
+	s.Split(ScanFrames)
+	var have []string
+	for s.Scan() {
+		have = append(have, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := framingPayloads; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	s = bufio.NewScanner(bytes.NewReader(input[:len(input)-1]))
+	s.Split(ScanFrames)
+	for s.Scan() {
+	}
+	if want, have := io.ErrUnexpectedEOF, s.Err(); want != have {
+		t.Errorf("partial frame: want %v, have %v", want, have)
+	}
+}
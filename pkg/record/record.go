@@ -5,11 +5,43 @@ import (
 	"bytes"
 	"errors"
 	"io"
+
+	"github.com/oklog/ulid"
 )
 
 // ErrIllegalTopicName is returned if a topic's character sequence is invalid.
 var ErrIllegalTopicName = errors.New("illegal topic name")
 
+// DefaultTopic is the topic of records that don't start with a valid topic
+// identifier. It's also the static topic used by default by the ingest tier.
+const DefaultTopic = "default"
+
+var (
+	defaultTopic       = []byte(DefaultTopic)
+	defaultTopicPrefix = []byte(DefaultTopic + " ")
+)
+
+// MaxTopicLength is the longest a topic may be.
+const MaxTopicLength = 128
+
+// MaxSize is the biggest record ingesters may be configured to accept, not
+// counting its topic, or the newline.
+const MaxSize = 1024 * 1024
+
+// MaxLineSize is the longest line of a stored record: its ULID, its topic,
+// and a record of MaxSize, each but the last followed by a space, and the
+// newline. Whatever reads records back, from segments, or query results,
+// should allow for it; see NewScanner.
+const MaxLineSize = ulid.EncodedSize + 1 + MaxTopicLength + 1 + MaxSize + 1
+
+// NewScanner returns a bufio.Scanner of r, with room for lines of up to
+// MaxLineSize, rather than the default of bufio.MaxScanTokenSize.
+func NewScanner(r io.Reader) *bufio.Scanner {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, MaxLineSize)
+	return s
+}
+
 // Reader emits records.
 // It returns io.EOF if the underlying record source has no more data.
 type Reader func() (record []byte, err error)
@@ -17,47 +49,127 @@ type Reader func() (record []byte, err error)
 // RecordReaderFactory returns a new RecordReader backed by the given reader.
 type ReaderFactory func(io.Reader) Reader
 
+// SizePolicy determines what a Reader does with records bigger than its
+// maximum size.
+type SizePolicy int
+
+const (
+	// Truncate oversized records to the maximum size, ending them with
+	// TruncatedMarker.
+	Truncate SizePolicy = iota
+
+	// Reject oversized records, skipping to the next one.
+	Reject
+)
+
+// TruncatedMarker ends records that were truncated, before the newline.
+const TruncatedMarker = " [truncated]"
+
 // NewDynamicReader returns a record reader that expects each input record from r
-// to start with a space-delimited topic identifier.
+// to start with a space-delimited topic identifier. Records that don't are
+// given DefaultTopic, ahead of the whole record.
 func NewDynamicReader(r io.Reader) Reader {
-	br := bufio.NewReader(r)
+	return DynamicReaderFactory(0, Truncate, nil)(r)
+}
 
-	return func() ([]byte, error) {
-		l, err := br.ReadBytes('\n')
-		if err != nil {
-			return nil, err
-		}
-		// Validate that a correct topic prefix exists.
-		if i := bytes.IndexByte(l, ' '); i < 0 || !IsValidTopic(l[:i]) {
-			return nil, ErrIllegalTopicName
+// DynamicReaderFactory returns a RecordReaderFactory like NewDynamicReader,
+// for records of at most maxSize bytes, not counting the newline. Oversized
+// records are handled per the policy, and reported to oversized, if it's
+// non-nil. A maxSize of zero means unlimited.
+func DynamicReaderFactory(maxSize int, policy SizePolicy, oversized func()) ReaderFactory {
+	return func(r io.Reader) Reader {
+		rr := newRecordReader(r, maxSize, policy, oversized)
+
+		return func() ([]byte, error) {
+			l, framed, err := rr.next()
+			if err != nil {
+				return nil, err
+			}
+			// Records without a valid topic prefix get the default.
+			i := bytes.IndexByte(l, ' ')
+			if i < 0 || !IsValidTopic(l[:i]) {
+				return line(defaultTopicPrefix, l, framed), nil
+			}
+			return line(l[:i+1], l[i+1:], framed), nil
 		}
-		return l, nil
 	}
 }
 
 // StaticReaderFactory returns a RecordReaderFactory that prefixes all records
-// with the given bytes as topic.
+// with the given bytes as topic. Records are at most maxSize bytes, not
+// counting the topic or the newline; see DynamicReaderFactory.
 // Callers must ensure the topic identifier is valid.
-func StaticReaderFactory(topic []byte) ReaderFactory {
+func StaticReaderFactory(topic []byte, maxSize int, policy SizePolicy, oversized func()) ReaderFactory {
 	topic = append(topic, ' ')
 
 	return func(r io.Reader) Reader {
-		br := bufio.NewReader(r)
+		rr := newRecordReader(r, maxSize, policy, oversized)
 
 		return func() ([]byte, error) {
-			l, err := br.ReadBytes('\n')
+			l, framed, err := rr.next()
 			if err != nil {
 				return nil, err
 			}
-			return append(topic, l...), nil
+			return line(topic, l, framed), nil
+		}
+	}
+}
+
+// readLine reads the next newline-terminated line from br. If the line is
+// longer than maxSize, not counting the newline, no more than that is kept in
+// memory, and it's truncated or rejected per the policy. Rejected lines are
+// skipped, by reading through to the next newline.
+func readLine(br *bufio.Reader, maxSize int, policy SizePolicy, oversized func()) ([]byte, error) {
+	if maxSize <= 0 {
+		return br.ReadBytes('\n')
+	}
+	var (
+		line    []byte
+		tooLong bool
+	)
+	for {
+		// Fragments are only valid until the next read, so copy them.
+		// Keep up to maxSize bytes and the newline; more is too long.
+		frag, err := br.ReadSlice('\n')
+		if room := maxSize + 1 - len(line); len(frag) > room {
+			line = append(line, frag[:room]...)
+			tooLong = true
+		} else {
+			line = append(line, frag...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue // the line goes on
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !tooLong {
+			return line, nil
+		}
+
+		if oversized != nil {
+			oversized()
+		}
+		switch policy {
+		case Truncate:
+			n := maxSize - len(TruncatedMarker)
+			if n < 0 {
+				n = 0
+			}
+			return append(append(line[:n], TruncatedMarker...), '\n'), nil
+		default:
+			line, tooLong = line[:0], false
 		}
 	}
 }
 
 // IsValidTopic ensures that the a topic only contains allowed characters. It implements
-// the regex [a-zA-Z0-9][a-zA-Z0-9_-]*
+// the regex [a-zA-Z0-9][a-zA-Z0-9_-]*, up to MaxTopicLength characters.
 // It takes a byte slice to avoid memory allocations at the caller.
 func IsValidTopic(b []byte) bool {
+	if len(b) > MaxTopicLength {
+		return false
+	}
 	for i, c := range b {
 		if i > 0 && (c == '_' || c == '-') {
 			continue
@@ -69,3 +181,13 @@ func IsValidTopic(b []byte) bool {
 	}
 	return len(b) > 0
 }
+
+// Topic returns the topic of a record, i.e. its leading space-delimited
+// identifier. The record must not include its ULID. If the record doesn't
+// start with a valid topic, DefaultTopic is returned.
+func Topic(record []byte) []byte {
+	if i := bytes.IndexByte(record, ' '); i > 0 && IsValidTopic(record[:i]) {
+		return record[:i]
+	}
+	return defaultTopic
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -25,17 +26,19 @@ func TestDynamicReader(t *testing.T) {
 		}, {
 			name:  "no-topic",
 			input: "topic_A foo1\nabcdef\ntopic_B foo2\n",
-			exp:   []string{"topic_A foo1\n"},
-			err:   ErrIllegalTopicName,
+			exp:   []string{"topic_A foo1\n", "default abcdef\n", "topic_B foo2\n"},
 		}, {
 			name:  "empty-record",
 			input: "topic_A foo1\n\ntopic_B foo2\n",
-			exp:   []string{"topic_A foo1\n"},
-			err:   ErrIllegalTopicName,
+			exp:   []string{"topic_A foo1\n", "default \n", "topic_B foo2\n"},
 		}, {
 			name:  "bad-topic",
 			input: "to~pic foo1\n",
-			err:   ErrIllegalTopicName,
+			exp:   []string{"default to~pic foo1\n"},
+		}, {
+			name:  "long-topic",
+			input: strings.Repeat("a", MaxTopicLength) + " foo1\n" + strings.Repeat("a", MaxTopicLength+1) + " foo2\n",
+			exp:   []string{strings.Repeat("a", MaxTopicLength) + " foo1\n", "default " + strings.Repeat("a", MaxTopicLength+1) + " foo2\n"},
 		},
 	} {
 		t.Run(c.name, func(t *testing.T) {
@@ -89,7 +92,7 @@ func TestStaticReader(t *testing.T) {
 			var rec []byte
 			var err error
 
-			r := StaticReaderFactory([]byte("topic_A"))(bytes.NewBufferString(c.input))
+			r := StaticReaderFactory([]byte("topic_A"), 0, Truncate, nil)(bytes.NewBufferString(c.input))
 			for {
 				rec, err = r()
 				if err != nil {
@@ -106,3 +109,106 @@ func TestStaticReader(t *testing.T) {
 		})
 	}
 }
+
+func TestReaderSizeLimit(t *testing.T) {
+	const maxSize = 16
+	var (
+		atLimit = "t " + strings.Repeat("a", maxSize-2) + "\n"
+		oneOver = "t " + strings.Repeat("b", maxSize-1) + "\n"
+		huge    = "t " + strings.Repeat("c", 10000) + "\n" // bigger than the bufio buffer
+	)
+	for _, c := range []struct {
+		name      string
+		policy    SizePolicy
+		input     string
+		exp       []string
+		oversized int
+	}{
+		{
+			name:   "truncate at limit",
+			policy: Truncate,
+			input:  atLimit,
+			exp:    []string{atLimit},
+		},
+		{
+			name:      "truncate one over",
+			policy:    Truncate,
+			input:     oneOver,
+			exp:       []string{"t bb [truncated]\n"},
+			oversized: 1,
+		},
+		{
+			name:      "truncate continues",
+			policy:    Truncate,
+			input:     "t foo\n" + huge + huge + "t bar\n",
+			exp:       []string{"t foo\n", "t cc [truncated]\n", "t cc [truncated]\n", "t bar\n"},
+			oversized: 2,
+		},
+		{
+			name:   "reject at limit",
+			policy: Reject,
+			input:  atLimit,
+			exp:    []string{atLimit},
+		},
+		{
+			name:      "reject one over",
+			policy:    Reject,
+			input:     oneOver + atLimit,
+			exp:       []string{atLimit},
+			oversized: 1,
+		},
+		{
+			name:      "reject continues",
+			policy:    Reject,
+			input:     "t foo\n" + huge + huge + "t bar\n" + oneOver + "t baz\n",
+			exp:       []string{"t foo\n", "t bar\n", "t baz\n"},
+			oversized: 3,
+		},
+		{
+			name:      "reject at EOF",
+			policy:    Reject,
+			input:     "t foo\n" + huge[:len(huge)-1],
+			exp:       []string{"t foo\n"},
+			oversized: 0,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var (
+				res       []string
+				oversized int
+			)
+			r := DynamicReaderFactory(maxSize, c.policy, func() { oversized++ })(bytes.NewBufferString(c.input))
+			for {
+				rec, err := r()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				res = append(res, string(rec))
+			}
+			if !reflect.DeepEqual(c.exp, res) {
+				t.Fatalf("unexpected records: want (%q), got (%q)", c.exp, res)
+			}
+			if c.oversized != oversized {
+				t.Fatalf("unexpected oversized records: want %d, got %d", c.oversized, oversized)
+			}
+		})
+	}
+}
+
+func TestTopic(t *testing.T) {
+	for input, want := range map[string]string{
+		"topic_A foo\n": "topic_A",
+		"topic_A \n":    "topic_A",
+		"foo\n":         DefaultTopic,
+		"to~pic foo\n":  DefaultTopic,
+		" foo\n":        DefaultTopic,
+		"":              DefaultTopic,
+	} {
+		if have := string(Topic([]byte(input))); want != have {
+			t.Errorf("%q: want %q, have %q", input, want, have)
+		}
+	}
+}
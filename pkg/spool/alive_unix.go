@@ -0,0 +1,12 @@
+// +build !windows,!plan9
+
+package spool
+
+import "syscall"
+
+// processAlive reports whether the process exists. One we may not signal
+// exists, too.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
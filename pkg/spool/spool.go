@@ -0,0 +1,557 @@
+// Package spool implements a queue of records on disk, which outlives the
+// process. The forwarder spools records while no ingest node is reachable,
+// and drains them, oldest first, once one is.
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+const (
+	extSpool = ".spool"
+	lockFile = "LOCK"
+	pidFile  = "PID" // of the spool's owner, while it's locked
+
+	// Each entry is the length and CRC-32 of its record, big-endian,
+	// followed by the record.
+	entryHeaderSize = 8
+
+	// The spool is split into about this many segment files, so the
+	// oldest can be evicted, or deleted once drained, without rewriting
+	// the rest.
+	segmentsPerSpool = 8
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Spool is a FIFO queue of records in segment files beneath a root
+// directory. Its size is capped; appending past the cap evicts the oldest
+// segment. Entries are checksummed, and on open, each segment is read up to
+// its first partial or corrupt entry, e.g. one being written when the
+// previous owner crashed, and the rest of it is skipped.
+//
+// Records are deleted once popped, which the forwarder does after writing
+// them to an ingest node, or, with acknowledgements, once the ingest node
+// acknowledges them. So after a crash, a record may be forwarded twice.
+//
+// Each record has an index, one more than the record appended before it,
+// which is only valid until the spool is closed.
+type Spool struct {
+	mtx      sync.Mutex
+	filesys  fs.Filesystem
+	root     string
+	releaser fs.Releaser
+	capacity int64
+	segments []*segment // oldest first; each has unpopped records
+	active   fs.File    // the last segment's, if it's being appended to
+	head     []byte     // the oldest record, once peeked
+	nextSeq  uint64
+	nextIdx  uint64 // index of the next record appended
+	cursor   uint64 // index of the next record Next returns, unless popped
+	evicted  prometheus.Counter
+	corrupt  prometheus.Counter
+}
+
+type segment struct {
+	path    string
+	size    int64  // bytes of valid entries
+	records int    // not yet popped
+	first   uint64 // index of the first record not yet popped
+	popped  int    // records before it, in the file
+	f       fs.File
+	r       *bufio.Reader // reading f, once peeked
+	nread   int           // records r has read
+}
+
+// Open returns the spool at path root, with the records left in it by any
+// previous owner. The spool holds at most capacity bytes of entries.
+// Records evicted to stay under the cap are counted by evictedRecords, and
+// segments with a partial or corrupt entry by corruptSegments.
+//
+// A spool has a single owner at a time: it's locked until it's closed, and
+// Open fails if it's locked already, with a LockedError. If takeover is true,
+// a lock whose owner has died, without releasing it, is broken; one whose
+// owner is alive never is.
+func Open(filesys fs.Filesystem, root string, capacity int64, takeover bool, evictedRecords, corruptSegments prometheus.Counter) (*Spool, error) {
+	if capacity <= 0 {
+		return nil, errors.Errorf("invalid spool capacity %d", capacity)
+	}
+	if err := filesys.MkdirAll(root); err != nil {
+		return nil, errors.Wrapf(err, "creating path %s", root)
+	}
+	r, err := lock(filesys, root, takeover)
+	if err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		filesys:  filesys,
+		root:     root,
+		releaser: r,
+		capacity: capacity,
+		evicted:  evictedRecords,
+		corrupt:  corruptSegments,
+	}
+	if err := s.recover(); err != nil {
+		r.Release()
+		return nil, errors.Wrap(err, "during recovery")
+	}
+	return s, nil
+}
+
+// LockedError is returned by Open when another owner holds the spool, e.g.
+// another forwarder with the same spool directory. PID is the owner's
+// process ID, or zero, if it's unknown.
+type LockedError struct {
+	Root string
+	PID  int
+	Err  error
+}
+
+func (e LockedError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("spool %s is locked, by another process: %v", e.Root, e.Err)
+	}
+	return fmt.Sprintf("spool %s is locked, by process %d: %v", e.Root, e.PID, e.Err)
+}
+
+// lock the spool, and record our PID as its owner's. If it's locked already,
+// and takeover is true, and its owner is known, and dead, it's broken first.
+func lock(filesys fs.Filesystem, root string, takeover bool) (fs.Releaser, error) {
+	var (
+		lock = filepath.Join(root, lockFile)
+		pid  = filepath.Join(root, pidFile)
+	)
+	r, _, err := filesys.Lock(lock)
+	if err != nil {
+		owner := readPID(filesys, pid)
+		if !takeover || owner == 0 || processAlive(owner) {
+			return nil, LockedError{Root: root, PID: owner, Err: err}
+		}
+		if err := filesys.Remove(lock); err != nil {
+			return nil, errors.Wrapf(err, "breaking the lock of dead process %d", owner)
+		}
+		if r, _, err = filesys.Lock(lock); err != nil {
+			return nil, LockedError{Root: root, PID: readPID(filesys, pid), Err: err}
+		}
+	}
+	if err := writePID(filesys, pid, os.Getpid()); err != nil {
+		r.Release()
+		return nil, errors.Wrapf(err, "writing %s", pid)
+	}
+	return pidReleaser{filesys, pid, r}, nil
+}
+
+// pidReleaser removes the PID file before releasing the lock, so that it's
+// never that of an owner that's gone.
+type pidReleaser struct {
+	filesys fs.Filesystem
+	pid     string
+	fs.Releaser
+}
+
+func (r pidReleaser) Release() error {
+	r.filesys.Remove(r.pid)
+	return r.Releaser.Release()
+}
+
+// readPID returns the PID in the file, or zero, if there's none.
+func readPID(filesys fs.Filesystem, path string) int {
+	f, err := filesys.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	var pid int
+	if _, err := fmt.Fscan(f, &pid); err != nil || pid < 0 {
+		return 0
+	}
+	return pid
+}
+
+func writePID(filesys fs.Filesystem, path string, pid int) error {
+	f, err := filesys.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, pid); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// recover scans the segments left by a previous owner. They're never
+// appended to again, since the filesystem can't truncate their invalid
+// tails; new records go to a new segment.
+func (s *Spool) recover() error {
+	seqs := map[uint64]string{}
+	if err := s.filesys.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if filepath.Clean(path) != filepath.Clean(s.root) {
+				return filepath.SkipDir // e.g. another spool
+			}
+			return nil
+		}
+		if filepath.Dir(path) != filepath.Clean(s.root) || filepath.Ext(path) != extSpool {
+			return nil
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), extSpool), 10, 64)
+		if err != nil {
+			return nil // not ours
+		}
+		seqs[seq] = path
+		return nil
+	}); err != nil {
+		return err
+	}
+	sorted := make([]uint64, 0, len(seqs))
+	for seq := range seqs {
+		sorted = append(sorted, seq)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for _, seq := range sorted {
+		seg, err := s.scan(seqs[seq])
+		if err != nil {
+			return err
+		}
+		if seg.records == 0 {
+			if err := s.filesys.Remove(seg.path); err != nil {
+				return err
+			}
+			continue
+		}
+		seg.first = s.nextIdx
+		s.nextIdx += uint64(seg.records)
+		s.segments = append(s.segments, seg)
+	}
+	if len(sorted) > 0 {
+		s.nextSeq = sorted[len(sorted)-1] + 1
+	}
+	s.evict()
+	return nil
+}
+
+// scan counts the valid entries of the segment at path.
+func (s *Spool) scan(path string) (*segment, error) {
+	f, err := s.filesys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		seg = &segment{path: path}
+		r   = bufio.NewReader(f)
+	)
+	for {
+		record, err := readEntry(r, f.Size()-seg.size)
+		if err == io.EOF {
+			return seg, nil
+		}
+		if err != nil {
+			s.corrupt.Inc() // the rest of the segment is skipped
+			return seg, nil
+		}
+		seg.size += int64(entryHeaderSize + len(record))
+		seg.records++
+	}
+}
+
+// Append adds a record to the spool, evicting the oldest segments if the
+// spool is over capacity.
+func (s *Spool) Append(record []byte) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.active == nil || s.segments[len(s.segments)-1].size >= s.capacity/segmentsPerSpool {
+		if err := s.rotate(); err != nil {
+			return errors.Wrap(err, "creating spool segment")
+		}
+	}
+	buf := make([]byte, entryHeaderSize+len(record))
+	binary.BigEndian.PutUint32(buf[0:], uint32(len(record)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.Checksum(record, castagnoli))
+	copy(buf[entryHeaderSize:], record)
+	seg := s.segments[len(s.segments)-1]
+	if _, err := s.active.Write(buf); err != nil {
+		// The segment may end in a partial entry now, so it's sealed,
+		// and read up to its last complete one.
+		s.active.Close()
+		s.active = nil
+		return errors.Wrap(err, "appending to spool")
+	}
+	seg.size += int64(len(buf))
+	seg.records++
+	s.nextIdx++
+	s.evict()
+	return nil
+}
+
+// rotate seals the active segment, if any, and creates a new one.
+func (s *Spool) rotate() error {
+	if s.active != nil {
+		s.active.Sync()
+		s.active.Close()
+		s.active = nil
+	}
+	path := filepath.Join(s.root, fmt.Sprintf("%020d%s", s.nextSeq, extSpool))
+	f, err := s.filesys.Create(path)
+	if err != nil {
+		return err
+	}
+	s.nextSeq++
+	s.active = f
+	s.segments = append(s.segments, &segment{path: path, first: s.nextIdx})
+	return nil
+}
+
+// evict removes the oldest segments while the spool is over capacity, always
+// keeping the newest.
+func (s *Spool) evict() {
+	for s.size() > s.capacity && len(s.segments) > 1 {
+		s.evicted.Add(float64(s.segments[0].records))
+		s.remove(0)
+	}
+}
+
+// remove deletes the ith segment. If it's the oldest, any peeked record
+// goes with it.
+func (s *Spool) remove(i int) error {
+	seg := s.segments[i]
+	s.segments = append(s.segments[:i:i], s.segments[i+1:]...)
+	if i == 0 {
+		s.head = nil
+	}
+	if seg.f != nil {
+		seg.f.Close()
+	}
+	if i == len(s.segments) && s.active != nil {
+		s.active.Close() // it was the last segment's
+		s.active = nil
+	}
+	return s.filesys.Remove(seg.path)
+}
+
+func (s *Spool) size() (n int64) {
+	for _, seg := range s.segments {
+		n += seg.size
+	}
+	return n
+}
+
+// Peek returns the oldest record, without removing it from the spool.
+// It returns false if the spool is empty.
+func (s *Spool) Peek() ([]byte, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for s.head == nil {
+		if len(s.segments) == 0 {
+			return nil, false
+		}
+		record, err := s.segments[0].read(s.filesys, s.segments[0].popped)
+		if err != nil {
+			// The segment was damaged since we scanned it. Skip it.
+			s.corrupt.Inc()
+			s.remove(0)
+			continue
+		}
+		s.head = record
+	}
+	return s.head, true
+}
+
+// Pop removes the record returned by the last call to Peek, unless it's been
+// evicted since. A segment is deleted once all of its records are popped.
+func (s *Spool) Pop() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.head == nil {
+		return nil
+	}
+	s.head = nil
+	seg := s.segments[0]
+	seg.records--
+	seg.popped++
+	seg.first++
+	if seg.records > 0 {
+		return nil
+	}
+	return s.remove(0)
+}
+
+// Next returns the oldest record that Next hasn't returned since the last
+// Rewind, and its index, without removing it from the spool. It returns
+// false if there's no such record. The forwarder sends records ahead of
+// their acknowledgements with Next, and pops them with PopThrough.
+func (s *Spool) Next() ([]byte, uint64, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for i := 0; i < len(s.segments); {
+		seg := s.segments[i]
+		if s.cursor < seg.first {
+			s.cursor = seg.first // the records before were popped, or evicted
+		}
+		if s.cursor >= seg.first+uint64(seg.records) {
+			i++
+			continue
+		}
+		record, err := seg.read(s.filesys, seg.popped+int(s.cursor-seg.first))
+		if err != nil {
+			// The segment was damaged since we scanned it. Skip it.
+			s.corrupt.Inc()
+			s.remove(i)
+			continue
+		}
+		index := s.cursor
+		s.cursor++
+		return record, index, true
+	}
+	return nil, 0, false
+}
+
+// Rewind makes Next start again from the oldest record.
+func (s *Spool) Rewind() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.cursor = 0
+}
+
+// PopThrough removes the records up to and including the one with the
+// index, as returned by Next, except those evicted since.
+func (s *Spool) PopThrough(index uint64) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for len(s.segments) > 0 {
+		seg := s.segments[0]
+		if seg.first > index {
+			return nil
+		}
+		s.head = nil
+		if n := index - seg.first + 1; n < uint64(seg.records) {
+			seg.records -= int(n)
+			seg.popped += int(n)
+			seg.first += n
+			return nil
+		}
+		if err := s.remove(0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Len returns the number of records in the spool.
+func (s *Spool) Len() (n int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, seg := range s.segments {
+		n += seg.records
+	}
+	return n
+}
+
+// Size returns the number of bytes in the spool, including the entries of
+// records already popped from segments that aren't yet deleted.
+func (s *Spool) Size() int64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.size()
+}
+
+// Close syncs and closes the spool's files, and releases its lock.
+// The records it holds are read again by the next Open.
+func (s *Spool) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, seg := range s.segments {
+		if seg.f != nil {
+			seg.f.Close()
+		}
+	}
+	if s.active != nil {
+		s.active.Sync()
+		s.active.Close()
+		s.active = nil
+	}
+	return s.releaser.Release()
+}
+
+// read returns the segment's kth record, counting those already popped.
+// Records are read in order, so reading one before the last means reading
+// the file again, from the start.
+func (seg *segment) read(filesys fs.Filesystem, k int) ([]byte, error) {
+	if seg.r != nil && seg.nread > k {
+		seg.f.Close()
+		seg.f, seg.r = nil, nil
+	}
+	if seg.r == nil {
+		f, err := filesys.Open(seg.path)
+		if err != nil {
+			return nil, err
+		}
+		seg.f, seg.r, seg.nread = f, bufio.NewReader(f), 0
+	}
+	for {
+		record, err := readEntry(seg.r, seg.size)
+		if err != nil {
+			return nil, err
+		}
+		seg.nread++
+		if seg.nread > k {
+			return record, nil
+		}
+	}
+}
+
+// readEntry reads an entry of at most max bytes, and verifies its checksum.
+// It returns io.EOF only if there are no more entries, and
+// io.ErrUnexpectedEOF for a partial one.
+func readEntry(r io.Reader, max int64) ([]byte, error) {
+	var header [entryHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	var (
+		size = binary.BigEndian.Uint32(header[0:])
+		sum  = binary.BigEndian.Uint32(header[4:])
+	)
+	if int64(entryHeaderSize)+int64(size) > max {
+		return nil, io.ErrUnexpectedEOF // or a corrupt size
+	}
+	record := make([]byte, size)
+	if _, err := io.ReadFull(r, record); err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(record, castagnoli) != sum {
+		return nil, errors.New("checksum mismatch")
+	}
+	return record, nil
+}
@@ -0,0 +1,501 @@
+package spool
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestSpoolOrder(t *testing.T) {
+	t.Parallel()
+
+	filesys := fs.NewVirtualFilesystem()
+	s := openSpool(t, filesys, 4096)
+	want := records(0, 100)
+	for _, record := range want {
+		if err := s.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want, have := len(want), s.Len(); want != have {
+		t.Fatalf("Len: want %d, have %d", want, have)
+	}
+	if have := len(segmentFiles(t, filesys)); have <= 1 {
+		t.Fatalf("want several segments, have %d", have)
+	}
+
+	// Peeking twice yields the same record; popping moves on.
+	if first, _ := s.Peek(); string(first) != string(want[0]) {
+		t.Fatalf("Peek: want %q, have %q", want[0], first)
+	}
+	if have := drain(t, s); !reflect.DeepEqual(want, have) {
+		t.Fatalf("want %q, have %q", want, have)
+	}
+	if want, have := 0, s.Len(); want != have {
+		t.Errorf("Len: want %d, have %d", want, have)
+	}
+	if want, have := 0, len(segmentFiles(t, filesys)); want != have {
+		t.Errorf("segments after draining: want %d, have %d", want, have)
+	}
+
+	// It keeps working once empty.
+	if err := s.Append([]byte("again\n")); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := [][]byte{[]byte("again\n")}, drain(t, s); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestSpoolReopen(t *testing.T) {
+	t.Parallel()
+
+	filesys := fs.NewVirtualFilesystem()
+	s := openSpool(t, filesys, 4096)
+	for _, record := range records(0, 50) {
+		if err := s.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Pop a few, so the oldest segment is partially drained.
+	for i := 0; i < 5; i++ {
+		s.Peek()
+		if err := s.Pop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records in a partially drained segment were popped, but are still
+	// on disk, so they're read again: forwarded at least once.
+	s = openSpool(t, filesys, 4096)
+	for _, record := range records(50, 60) {
+		if err := s.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	have := drain(t, s)
+	if want := records(0, 60); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestSpoolEviction(t *testing.T) {
+	t.Parallel()
+
+	const capacity = 1024
+	var (
+		filesys = fs.NewVirtualFilesystem()
+		evicted = prometheus.NewCounter(prometheus.CounterOpts{})
+		corrupt = prometheus.NewCounter(prometheus.CounterOpts{})
+	)
+	s, err := Open(filesys, "/spool", capacity, false, evicted, corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Each entry is 8+10 bytes, so the spool holds about 56 of them.
+	all := records(0, 500)
+	for _, record := range all {
+		if err := s.Append(record); err != nil {
+			t.Fatal(err)
+		}
+		if size := s.Size(); size > capacity {
+			t.Fatalf("spool grew to %d bytes, over its capacity of %d", size, capacity)
+		}
+	}
+
+	// The newest records survive, in order, and the rest are counted.
+	have := drain(t, s)
+	if len(have) < capacity/(entryHeaderSize+len(all[0]))*7/8 {
+		t.Errorf("only %d records survived", len(have))
+	}
+	if want := all[len(all)-len(have):]; !reflect.DeepEqual(want, have) {
+		t.Errorf("want the newest %d records, have %q", len(have), have)
+	}
+	if want, have := float64(len(all)-len(have)), counterValue(t, evicted); want != have {
+		t.Errorf("evicted: want %v, have %v", want, have)
+	}
+}
+
+func TestSpoolNext(t *testing.T) {
+	t.Parallel()
+
+	filesys := fs.NewVirtualFilesystem()
+	s := openSpool(t, filesys, 1024)
+	defer s.Close()
+	for _, record := range records(0, 20) {
+		if err := s.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	next := func(n int) ([][]byte, uint64) {
+		var (
+			records [][]byte
+			last    uint64
+		)
+		for i := 0; i < n; i++ {
+			record, index, ok := s.Next()
+			if !ok {
+				break
+			}
+			records, last = append(records, record), index
+		}
+		return records, last
+	}
+
+	// Next reads ahead of the oldest record, across segments, without
+	// popping anything.
+	have, last := next(15)
+	if want := records(0, 15); !reflect.DeepEqual(want, have) {
+		t.Fatalf("want %q, have %q", want, have)
+	}
+	if want, have := 20, s.Len(); want != have {
+		t.Fatalf("Len: want %d, have %d", want, have)
+	}
+
+	// Popping thru an index pops what's before it, too. Rewinding starts
+	// again from what's left.
+	if err := s.PopThrough(last - 5); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 10, s.Len(); want != have {
+		t.Fatalf("Len after PopThrough: want %d, have %d", want, have)
+	}
+	if have, _ := next(2); !reflect.DeepEqual(records(15, 17), have) {
+		t.Fatalf("before Rewind: want %q, have %q", records(15, 17), have)
+	}
+	s.Rewind()
+	have, _ = next(100)
+	if want := records(10, 20); !reflect.DeepEqual(want, have) {
+		t.Fatalf("after Rewind: want %q, have %q", want, have)
+	}
+	if first, _ := s.Peek(); string(first) != string(records(10, 11)[0]) {
+		t.Errorf("Peek: want %q, have %q", records(10, 11)[0], first)
+	}
+
+	// Records evicted while they're read ahead are skipped, and popping
+	// thru them doesn't pop the records appended since.
+	_, last = next(100)
+	for _, record := range records(20, 120) {
+		if err := s.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.PopThrough(last); err != nil {
+		t.Fatal(err)
+	}
+	have, _ = next(1000)
+	if len(have) == 0 || string(have[len(have)-1]) != string(records(119, 120)[0]) {
+		t.Fatalf("after eviction: want the newest records, have %q", have)
+	}
+	if want, have := len(have), s.Len(); want != have {
+		t.Errorf("Len after eviction: want %d, have %d", want, have)
+	}
+	if want := records(120-len(have), 120); !reflect.DeepEqual(want, have) {
+		t.Errorf("after eviction: want %q, have %q", want, have)
+	}
+}
+
+func TestSpoolCorruptTail(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name   string
+		damage func([]byte) []byte
+	}{
+		{"partial header", func(p []byte) []byte { return p[:len(p)-16] }},
+		{"partial record", func(p []byte) []byte { return p[:len(p)-3] }},
+		{"bad checksum", func(p []byte) []byte { p[len(p)-2] ^= 0xFF; return p }},
+		{"bad size", func(p []byte) []byte { p[len(p)-18] = 0xFF; return p }},
+	} {
+		// Write the records 0 thru 9 to one segment, and damage the
+		// last. With 10 byte records, the last entry starts 18 bytes
+		// from the end of the segment.
+		filesys := fs.NewVirtualFilesystem()
+		s := openSpool(t, filesys, 1024*1024)
+		for _, record := range records(0, 10) {
+			if err := s.Append(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		files := segmentFiles(t, filesys)
+		if len(files) != 1 {
+			t.Fatalf("%s: want 1 segment, have %d", testcase.name, len(files))
+		}
+		rewrite(t, filesys, files[0], testcase.damage)
+
+		// On reopen, the damaged entry is skipped, and new records come
+		// after the intact ones.
+		corrupt := prometheus.NewCounter(prometheus.CounterOpts{})
+		s, err := Open(filesys, "/spool", 1024*1024, false, prometheus.NewCounter(prometheus.CounterOpts{}), corrupt)
+		if err != nil {
+			t.Fatalf("%s: %v", testcase.name, err)
+		}
+		if want, have := 1.0, counterValue(t, corrupt); want != have {
+			t.Errorf("%s: corrupt segments: want %v, have %v", testcase.name, want, have)
+		}
+		for _, record := range records(10, 12) {
+			if err := s.Append(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := append(records(0, 9), records(10, 12)...)
+		if have := drain(t, s); !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+		s.Close()
+	}
+}
+
+func TestSpoolRealFilesystem(t *testing.T) {
+	t.Parallel()
+
+	root, err := ioutil.TempDir("", "oklog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// Write, and partially write, like a crash mid-append.
+	filesys := fs.NewRealFilesystem()
+	s := openSpoolAt(t, filesys, root, 1024)
+	for _, record := range records(0, 20) {
+		if err := s.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(root, "*"+extSpool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	f, err := os.OpenFile(files[len(files)-1], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 10, 1, 2})
+	f.Close()
+
+	s = openSpoolAt(t, filesys, root, 1024)
+	defer s.Close()
+	if want, have := records(0, 20), drain(t, s); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestSpoolNested(t *testing.T) {
+	t.Parallel()
+
+	root, err := ioutil.TempDir("", "oklog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// A spool beneath another is its own.
+	filesys := fs.NewRealFilesystem()
+	outer := openSpoolAt(t, filesys, root, 1024)
+	inner := openSpoolAt(t, filesys, filepath.Join(root, "inner"), 1024)
+	outer.Append([]byte("outer\n"))
+	inner.Append([]byte("inner\n"))
+	outer.Close()
+	inner.Close()
+
+	outer = openSpoolAt(t, filesys, root, 1024)
+	defer outer.Close()
+	if want, have := [][]byte{[]byte("outer\n")}, drain(t, outer); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestSpoolLock(t *testing.T) {
+	t.Parallel()
+
+	root, err := ioutil.TempDir("", "oklog-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// A second owner is refused, even with takeover, since the first is
+	// alive, and told who the first is.
+	filesys := fs.NewRealFilesystem()
+	s := openSpoolAt(t, filesys, root, 1024)
+	for _, takeover := range []bool{false, true} {
+		_, err := Open(filesys, root, 1024, takeover, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
+		locked, ok := err.(LockedError)
+		if !ok {
+			t.Fatalf("takeover %v: want LockedError, have %v", takeover, err)
+		}
+		if want, have := os.Getpid(), locked.PID; want != have {
+			t.Errorf("takeover %v: PID: want %d, have %d", takeover, want, have)
+		}
+	}
+
+	// Once it's closed, the spool can be opened again.
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if filesys.Exists(filepath.Join(root, pidFile)) {
+		t.Errorf("%s remains after Close", pidFile)
+	}
+	openSpoolAt(t, filesys, root, 1024).Close()
+}
+
+func TestSpoolTakeover(t *testing.T) {
+	t.Parallel()
+
+	// A process that's exited, whose PID is most likely unused.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	dead := cmd.ProcessState.Pid()
+	if processAlive(dead) {
+		t.Skip("can't tell whether processes are alive here")
+	}
+
+	for _, testcase := range []struct {
+		name     string
+		owner    int
+		takeover bool
+		broken   bool
+	}{
+		{"dead owner", dead, false, false},
+		{"dead owner, takeover", dead, true, true},
+		{"live owner, takeover", os.Getpid(), true, false},
+		{"unknown owner, takeover", 0, true, false},
+	} {
+		// A lock left by the owner. The virtual filesystem takes a lock
+		// file that isn't empty as held.
+		filesys := fs.NewVirtualFilesystem()
+		if _, _, err := filesys.Lock("/spool/" + lockFile); err != nil {
+			t.Fatal(err)
+		}
+		if testcase.owner != 0 {
+			if err := writePID(filesys, "/spool/"+pidFile, testcase.owner); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s, err := Open(filesys, "/spool", 1024, testcase.takeover, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
+		if testcase.broken {
+			if err != nil {
+				t.Fatalf("%s: %v", testcase.name, err)
+			}
+			if want, have := os.Getpid(), readPID(filesys, "/spool/"+pidFile); want != have {
+				t.Errorf("%s: PID: want %d, have %d", testcase.name, want, have)
+			}
+			s.Close()
+			continue
+		}
+		locked, ok := err.(LockedError)
+		if !ok {
+			t.Fatalf("%s: want LockedError, have %v", testcase.name, err)
+		}
+		if want, have := testcase.owner, locked.PID; want != have {
+			t.Errorf("%s: PID: want %d, have %d", testcase.name, want, have)
+		}
+	}
+}
+
+func openSpool(t *testing.T, filesys fs.Filesystem, capacity int64) *Spool {
+	return openSpoolAt(t, filesys, "/spool", capacity)
+}
+
+func openSpoolAt(t *testing.T, filesys fs.Filesystem, root string, capacity int64) *Spool {
+	t.Helper()
+	s, err := Open(filesys, root, capacity, false, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// records returns records i thru j-1, each 10 bytes.
+func records(i, j int) [][]byte {
+	var records [][]byte
+	for ; i < j; i++ {
+		records = append(records, []byte(fmt.Sprintf("record%03d\n", i)))
+	}
+	return records
+}
+
+func drain(t *testing.T, s *Spool) [][]byte {
+	t.Helper()
+	var records [][]byte
+	for {
+		record, ok := s.Peek()
+		if !ok {
+			return records
+		}
+		records = append(records, record)
+		if err := s.Pop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func segmentFiles(t *testing.T, filesys fs.Filesystem) []string {
+	t.Helper()
+	var files []string
+	if err := filesys.Walk("/spool", func(path string, info os.FileInfo, err error) error {
+		if err == nil && filepath.Ext(path) == extSpool {
+			files = append(files, path)
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func rewrite(t *testing.T, filesys fs.Filesystem, path string, damage func([]byte) []byte) {
+	t.Helper()
+	f, err := filesys.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if f, err = filesys.Create(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(damage(buf)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Limiter admits at most max requests at once. Requests beyond that wait
+// their turn, first come, first served, in a queue of at most queue, for at
+// most timeout; those it can't admit are refused, with HTTP 429, and a
+// Retry-After. With a queue of zero, requests beyond max are refused
+// immediately. A nil *Limiter is valid, and admits everything.
+type Limiter struct {
+	max        int
+	queue      int
+	timeout    time.Duration
+	retryAfter time.Duration
+	inflight   prometheus.Gauge
+	queued     prometheus.Gauge
+
+	mtx     sync.Mutex
+	n       int        // admitted
+	waiters *list.List // of chan struct{}, closed when admitted
+}
+
+// NewLimiter returns a Limiter of max requests at once, queueing at most
+// queue more, each for at most timeout. The inflight and queued gauges are
+// set to how many requests are admitted, and waiting. If max is zero,
+// NewLimiter returns nil, which admits everything.
+func NewLimiter(max, queue int, timeout time.Duration, inflight, queued prometheus.Gauge) *Limiter {
+	if max <= 0 {
+		return nil
+	}
+	retryAfter := timeout
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	return &Limiter{
+		max:        max,
+		queue:      queue,
+		timeout:    timeout,
+		retryAfter: retryAfter,
+		inflight:   inflight,
+		queued:     queued,
+		waiters:    list.New(),
+	}
+}
+
+// Handler returns next, serving each request once it's admitted, and
+// refusing those that aren't. A request that's admitted is released once
+// next returns, as it does when the client goes away; one that's waiting
+// gives up its place in the queue.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.acquire(r.Context()) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(l.retryAfter.Seconds())))
+			http.Error(w, "too many concurrent requests", http.StatusTooManyRequests)
+			return
+		}
+		defer l.release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acquire admits a request, and returns true, once there's room for it,
+// unless the queue is full, it waits longer than the timeout, or the
+// context is done first.
+func (l *Limiter) acquire(ctx context.Context) bool {
+	l.mtx.Lock()
+	if l.n < l.max && l.waiters.Len() == 0 {
+		l.n++
+		l.inflight.Set(float64(l.n))
+		l.mtx.Unlock()
+		return true
+	}
+	if l.waiters.Len() >= l.queue {
+		l.mtx.Unlock()
+		return false
+	}
+	admitted := make(chan struct{})
+	e := l.waiters.PushBack(admitted)
+	l.queued.Set(float64(l.waiters.Len()))
+	l.mtx.Unlock()
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case <-admitted:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	select {
+	case <-admitted:
+		l.handOff() // admitted as we gave up: pass the place on
+	default:
+		l.waiters.Remove(e)
+		l.queued.Set(float64(l.waiters.Len()))
+	}
+	return false
+}
+
+// release the place of an admitted request.
+func (l *Limiter) release() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.handOff()
+}
+
+// handOff gives the place of an admitted request to the next waiting, if
+// any, or frees it. The mutex must be held.
+func (l *Limiter) handOff() {
+	if e := l.waiters.Front(); e != nil {
+		l.waiters.Remove(e)
+		l.queued.Set(float64(l.waiters.Len()))
+		close(e.Value.(chan struct{}))
+		return
+	}
+	l.n--
+	l.inflight.Set(float64(l.n))
+}
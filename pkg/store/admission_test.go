@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestLimiterFIFO(t *testing.T) {
+	t.Parallel()
+
+	var (
+		inflight = prometheus.NewGauge(prometheus.GaugeOpts{})
+		queued   = prometheus.NewGauge(prometheus.GaugeOpts{})
+		l        = NewLimiter(1, 3, time.Minute, inflight, queued)
+		hold     = make(chan struct{})
+		mtx      sync.Mutex
+		order    []string
+	)
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		order = append(order, r.URL.Query().Get("n"))
+		mtx.Unlock()
+		if r.URL.Query().Get("n") == "0" {
+			<-hold
+		}
+	}))
+	serve := func(n int) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/?n=%d", n), nil))
+		return w
+	}
+
+	// The first is admitted, and holds its place; the next three queue up,
+	// in turn, and the one after that is refused.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() { defer wg.Done(); serve(0) }()
+	waitGauge(t, inflight, 1)
+	for n := 1; n <= 3; n++ {
+		wg.Add(1)
+		go func(n int) { defer wg.Done(); serve(n) }(n)
+		waitGauge(t, queued, float64(n))
+	}
+	w := serve(4)
+	if want, have := http.StatusTooManyRequests, w.Code; want != have {
+		t.Errorf("with the queue full: want HTTP %d, have %d", want, have)
+	}
+	if want, have := "60", w.Header().Get("Retry-After"); want != have {
+		t.Errorf("Retry-After: want %q, have %q", want, have)
+	}
+
+	close(hold)
+	wg.Wait()
+	if want, have := fmt.Sprint([]string{"0", "1", "2", "3"}), fmt.Sprint(order); want != have {
+		t.Errorf("served: want %s, have %s", want, have)
+	}
+	if want, have := 0.0, gaugeOf(inflight); want != have {
+		t.Errorf("in flight, after: want %v, have %v", want, have)
+	}
+	if want, have := 0.0, gaugeOf(queued); want != have {
+		t.Errorf("queued, after: want %v, have %v", want, have)
+	}
+}
+
+func TestLimiterRefused(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name    string
+		queue   int
+		timeout time.Duration
+	}{
+		{"no queue", 0, 0},
+		{"queue timeout", 1, 10 * time.Millisecond},
+	} {
+		var (
+			l    = NewLimiter(1, testcase.queue, testcase.timeout, prometheus.NewGauge(prometheus.GaugeOpts{}), prometheus.NewGauge(prometheus.GaugeOpts{}))
+			hold = make(chan struct{})
+		)
+		h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-hold }))
+		done := make(chan struct{})
+		go func() { h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)); close(done) }()
+		waitGauge(t, l.inflight, 1)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if want, have := http.StatusTooManyRequests, w.Code; want != have {
+			t.Errorf("%s: want HTTP %d, have %d", testcase.name, want, have)
+		}
+		if want, have := "1", w.Header().Get("Retry-After"); want != have {
+			t.Errorf("%s: Retry-After: want %q, have %q", testcase.name, want, have)
+		}
+		close(hold)
+		<-done
+	}
+}
+
+func TestLimiterDisconnect(t *testing.T) {
+	t.Parallel()
+
+	var (
+		inflight = prometheus.NewGauge(prometheus.GaugeOpts{})
+		queued   = prometheus.NewGauge(prometheus.GaugeOpts{})
+		l        = NewLimiter(1, 1, time.Minute, inflight, queued)
+		served   = make(chan string, 2)
+	)
+	// Handlers return once their client goes away, as queries do.
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served <- r.URL.Query().Get("n")
+		<-r.Context().Done()
+	}))
+	request := func(n int) (*http.Request, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		return httptest.NewRequest("GET", fmt.Sprintf("/?n=%d", n), nil).WithContext(ctx), cancel
+	}
+	var wg sync.WaitGroup
+	serve := func(r *http.Request) {
+		wg.Add(1)
+		go func() { defer wg.Done(); h.ServeHTTP(httptest.NewRecorder(), r) }()
+	}
+
+	// A client that goes away while queued gives up its place.
+	r0, cancel0 := request(0)
+	serve(r0)
+	<-served
+	r1, cancel1 := request(1)
+	serve(r1)
+	waitGauge(t, queued, 1)
+	cancel1()
+	waitGauge(t, queued, 0)
+
+	// One that goes away while served releases its place, to the next.
+	r2, cancel2 := request(2)
+	defer cancel2()
+	serve(r2)
+	waitGauge(t, queued, 1)
+	cancel0()
+	if want, have := "2", <-served; want != have {
+		t.Errorf("served next: want %s, have %s", want, have)
+	}
+	if want, have := 1.0, gaugeOf(inflight); want != have {
+		t.Errorf("in flight: want %v, have %v", want, have)
+	}
+	cancel2()
+	wg.Wait()
+	if want, have := 0.0, gaugeOf(inflight); want != have {
+		t.Errorf("in flight, after: want %v, have %v", want, have)
+	}
+}
+
+func TestLimiterNil(t *testing.T) {
+	t.Parallel()
+
+	l := NewLimiter(0, 10, time.Second, prometheus.NewGauge(prometheus.GaugeOpts{}), prometheus.NewGauge(prometheus.GaugeOpts{}))
+	if l != nil {
+		t.Fatal("want no limiter, for no limit")
+	}
+	w := httptest.NewRecorder()
+	l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if want, have := http.StatusOK, w.Code; want != have {
+		t.Errorf("want HTTP %d, have %d", want, have)
+	}
+}
+
+func gaugeOf(g prometheus.Gauge) float64 {
+	var m dto.Metric
+	g.Write(&m)
+	return m.GetGauge().GetValue()
+}
+
+// waitGauge waits for the gauge to read want.
+func waitGauge(t *testing.T, g prometheus.Gauge, want float64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for gaugeOf(g) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("want gauge %v, have %v", want, gaugeOf(g))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -3,38 +3,83 @@ package store
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/golang/snappy"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/oklog/oklog/pkg/breaker"
 	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/record"
 	"github.com/oklog/oklog/pkg/stream"
+	"github.com/oklog/oklog/pkg/ulidutil"
 )
 
 // These are the store API URL paths.
 const (
-	APIPathUserQuery      = "/query"
-	APIPathInternalQuery  = "/_query"
-	APIPathUserStream     = "/stream"
-	APIPathInternalStream = "/_stream"
-	APIPathReplicate      = "/replicate"
-	APIPathClusterState   = "/_clusterstate"
+	APIPathUserQuery        = "/query"
+	APIPathInternalQuery    = "/_query"
+	APIPathUserStream       = "/stream"
+	APIPathUserLive         = "/stream/ws" // WebSocket
+	APIPathInternalStream   = "/_stream"
+	APIPathReplicate        = "/replicate"
+	APIPathReplicateChunk   = "/replicate/chunk"
+	APIPathClusterState     = "/_clusterstate"
+	APIPathUserSegments     = "/segments"
+	APIPathInternalSegments = "/_segments"
+	APIPathInternalCoverage = "/_coverage"
+	APIPathImportSegment    = "/segments/import"
+	APIPathSegment          = "/segment/" // followed by the segment name
+	APIPathRepair           = "/repair"   // served by the Repairer
+	APIPathCompact          = "/compact"  // served by the Compacter
+	APIPathStatus           = "/status"   // served by the DiskMonitor
+	APIPathLag              = "/lag"      // served by the ConsumeScheduler
 )
 
+// Streaming query responses carry heartbeats, i.e. empty lines, when there
+// are no records to send, so that idle connections can be told apart from
+// dead ones. Store nodes reading from each other give up on a connection
+// after streamIdleTimeout without data.
+const (
+	streamHeartbeatInterval = 10 * time.Second
+	streamIdleTimeout       = 3 * streamHeartbeatInterval
+)
+
+// A stream reports the failures of each peer it reads from at most once per
+// streamPeerErrorInterval, so a peer that can't be reached, e.g. because it
+// advertises an API address it doesn't listen on, shows up in the logs
+// without flooding them.
+const streamPeerErrorInterval = time.Minute
+
+// Live streams, over WebSocket, buffer at most liveMaxBuffered bytes of
+// records for a client that isn't keeping up, and then close the socket.
+const liveMaxBuffered = 4 << 20
+
+// Draining nodes, and nodes at DiskCritical, refuse replication requests with
+// 503 Service Unavailable, and ask clients to retry, elsewhere, after
+// drainRetryAfter.
+const drainRetryAfter = 5 * time.Second
+
 // ClusterPeer models cluster.Peer.
 type ClusterPeer interface {
 	Current(cluster.PeerType) []string
+	Zones(cluster.PeerType) map[string]string
 	State() map[string]interface{}
 }
 
@@ -53,43 +98,189 @@ type API struct {
 	replicatedSegments prometheus.Counter
 	replicatedBytes    prometheus.Counter
 	duration           *prometheus.HistogramVec
+	streamMetrics      *stream.Metrics
+	queryMetrics       *QueryMetrics
+	streamHeartbeat    time.Duration
+	liveMaxBuffered    int64
+	inflight           *inflightRequests
 	reporter           EventReporter
+	audit              AuditSink
+	planner            *QueryPlanner
+	maxQueryDuration   time.Duration // zero for no limit
+	limits             QueryLimits
+	streamLimits       StreamLimits
+	transfers          *Transfers   // nil to refuse chunked replication
+	queries            *Limiter     // of user queries
+	streams            *Limiter     // of user streams
+	breakers           *breaker.Set // of store nodes; nil to always try them
+	shipper            *Shipper     // nil to ship no segments
+	crossOriginLive    bool         // accept live tails from other origins
+	diskLevel          int32        // DiskLevel, atomic
+	watermarks         watermarks   // of user queries
 }
 
-// NewAPI returns a usable API.
-func NewAPI(
-	peer ClusterPeer,
-	log Log,
-	queryClient, streamClient Doer,
-	replicatedSegments, replicatedBytes prometheus.Counter,
-	duration *prometheus.HistogramVec,
-	reporter EventReporter,
-) *API {
+// APIConfig configures NewAPI. QueryClient, StreamClient, ReplicatedSegments,
+// ReplicatedBytes, and Duration are required; the rest may be left zero.
+type APIConfig struct {
+	QueryClient  Doer // should time out
+	StreamClient Doer // should not time out
+
+	ReplicatedSegments, ReplicatedBytes prometheus.Counter
+	Duration                            *prometheus.HistogramVec
+	StreamMetrics                       *stream.Metrics
+	QueryMetrics                        *QueryMetrics
+
+	// Reporter, if non-nil, is reported the API's events.
+	Reporter EventReporter
+
+	// Audit, if non-nil, records every user query and stream, once it's
+	// done.
+	Audit AuditSink
+
+	// Planner, if non-nil, has user queries read each segment from only one
+	// store node; otherwise they're sent to every store node, in full.
+	Planner *QueryPlanner
+
+	// MaxQueryDuration, if it's positive, stops queries after it, with the
+	// records they've found so far. Limits truncate them.
+	MaxQueryDuration time.Duration
+	Limits           QueryLimits
+
+	// StreamLimits hold the streams whose clients can't keep up.
+	StreamLimits StreamLimits
+
+	// Transfers, if non-nil, stages segments replicated in chunks;
+	// otherwise, senders replicate them whole.
+	Transfers *Transfers
+
+	// Queries and Streams, if non-nil, admit user queries, and user streams,
+	// live or not. Internal queries and streams, which other nodes fan user
+	// ones out to, aren't limited, so one that's been admitted by a node
+	// isn't refused by the rest.
+	Queries, Streams *Limiter
+
+	// Breakers, if non-nil, have user streams skip the store nodes whose
+	// breakers are open.
+	Breakers *breaker.Set
+
+	// Shipper, if non-nil, is queued the segments this node is the first
+	// replica of, to ship.
+	Shipper *Shipper
+
+	// CrossOriginLive accepts live tails, over WebSocket, from pages of
+	// other origins than the API's own; by default, they're refused.
+	CrossOriginLive bool
+}
+
+// NewAPI returns a usable API, serving the log, per the config.
+func NewAPI(peer ClusterPeer, log Log, cfg APIConfig) *API {
 	return &API{
 		peer:               peer,
 		log:                log,
-		queryClient:        queryClient,
-		streamClient:       streamClient,
+		queryClient:        cfg.QueryClient,
+		streamClient:       cfg.StreamClient,
 		streamQueries:      newQueryRegistry(),
-		replicatedSegments: replicatedSegments,
-		replicatedBytes:    replicatedBytes,
-		duration:           duration,
-		reporter:           reporter,
+		replicatedSegments: cfg.ReplicatedSegments,
+		replicatedBytes:    cfg.ReplicatedBytes,
+		duration:           cfg.Duration,
+		streamMetrics:      cfg.StreamMetrics,
+		queryMetrics:       cfg.QueryMetrics,
+		streamHeartbeat:    streamHeartbeatInterval,
+		liveMaxBuffered:    liveMaxBuffered,
+		inflight:           newInflightRequests(),
+		reporter:           nopIfNil(cfg.Reporter),
+		audit:              cfg.Audit,
+		planner:            cfg.Planner,
+		maxQueryDuration:   cfg.MaxQueryDuration,
+		limits:             cfg.Limits,
+		streamLimits:       cfg.StreamLimits,
+		transfers:          cfg.Transfers,
+		queries:            cfg.Queries,
+		streams:            cfg.Streams,
+		breakers:           cfg.Breakers,
+		shipper:            cfg.Shipper,
+		crossOriginLive:    cfg.CrossOriginLive,
+	}
+}
+
+// queryContext returns the context of a query, which is canceled once the
+// client goes away, or the query has run for the maximum query duration.
+func (a *API) queryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if a.maxQueryDuration <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), a.maxQueryDuration)
+}
+
+// reportPartial reports a query that was stopped before its results were
+// complete, because of its context, if it was.
+func (a *API) reportPartial(ctx context.Context, op string) {
+	if err := ctx.Err(); err != nil {
+		a.reporter.ReportEvent(Event{
+			Op: op, Warning: err,
+			Msg: "query stopped early: its results are partial",
+		})
 	}
 }
 
+// queryPeers returns the store nodes that user queries fan out to: the
+// read-only ones, which are there to take the load, if there are any, or
+// else the rest.
+func (a *API) queryPeers() []string {
+	if peers := a.peer.Current(cluster.PeerTypeReadOnlyStore); len(peers) > 0 {
+		return peers
+	}
+	return a.peer.Current(cluster.PeerTypeStore)
+}
+
 // Close out the API, including the streaming query registry.
 func (a *API) Close() error {
 	return a.streamQueries.Close()
 }
 
+// Drain the API ahead of shutdown. New replication requests are refused, with
+// a retryable status code, so consumers send segments to other nodes. Queries
+// are still served, as other nodes may not yet know we're leaving.
+func (a *API) Drain() {
+	a.inflight.drain()
+}
+
+// SetDiskLevel tells the API how full this node's disk is. At DiskCritical,
+// replication requests and segment imports are refused, with a retryable
+// status code, so they go to other nodes.
+func (a *API) SetDiskLevel(level DiskLevel) {
+	atomic.StoreInt32(&a.diskLevel, int32(level))
+}
+
+// refuseDiskCritical refuses a request that would write to the store log,
+// and returns true, if the node is at DiskCritical.
+func (a *API) refuseDiskCritical(w http.ResponseWriter) bool {
+	if DiskLevel(atomic.LoadInt32(&a.diskLevel)) < DiskCritical {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(drainRetryAfter.Seconds())))
+	http.Error(w, "node is low on disk", http.StatusServiceUnavailable)
+	return true
+}
+
+// Wait for in-flight queries and replications to complete, up to timeout.
+// Wait should be invoked after Drain. Streaming queries aren't waited for, as
+// they never complete; Close terminates them.
+func (a *API) Wait(timeout time.Duration) error {
+	return a.inflight.wait(timeout)
+}
+
 func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	iw := &interceptingWriter{http.StatusOK, w}
 	w = iw
 	defer func(begin time.Time) {
+		path := r.URL.Path
+		if strings.HasPrefix(path, APIPathSegment) {
+			path = APIPathSegment // not a label per segment
+		}
 		a.duration.WithLabelValues(
 			r.Method,
-			r.URL.Path,
+			path,
 			strconv.Itoa(iw.code),
 		).Observe(time.Since(begin).Seconds())
 	}(time.Now())
@@ -100,22 +291,151 @@ func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r.URL.Path = APIPathUserQuery
 		http.Redirect(w, r, r.URL.String(), http.StatusTemporaryRedirect)
 	case (method == "GET" || method == "HEAD") && path == APIPathUserQuery:
-		a.handleUserQuery(w, r)
-	case (method == "GET" || method == "HEAD") && path == APIPathInternalQuery:
+		a.inflight.begin()
+		defer a.inflight.end()
+		qa, w := a.beginAudit(iw, r, true)
+		defer a.endAudit(qa, r)
+		a.queries.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			a.handleUserQuery(w, r, qa)
+		})).ServeHTTP(w, r)
+	case (method == "GET" || method == "HEAD" || method == "POST") && path == APIPathInternalQuery:
+		a.inflight.begin()
+		defer a.inflight.end()
 		a.handleInternalQuery(w, r)
+	case method == "GET" && path == APIPathUserLive:
+		qa, w := a.beginAudit(iw, r, false)
+		defer a.endAudit(qa, r)
+		a.streams.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			a.handleUserLive(w, r, qa)
+		})).ServeHTTP(w, r)
 	case method == "GET" && path == APIPathUserStream:
-		a.handleUserStream(w, r)
+		qa, w := a.beginAudit(iw, r, false)
+		defer a.endAudit(qa, r)
+		a.streams.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			a.handleUserStream(w, r, qa)
+		})).ServeHTTP(w, r)
 	case method == "GET" && path == APIPathInternalStream:
 		a.handleInternalStream(w, r)
 	case method == "POST" && path == APIPathReplicate:
+		if a.refuseDiskCritical(w) {
+			return
+		}
+		if !a.inflight.beginUnlessDraining() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(drainRetryAfter.Seconds())))
+			http.Error(w, "node is draining", http.StatusServiceUnavailable)
+			return
+		}
+		defer a.inflight.end()
 		a.handleReplicate(w, r)
+	case method == "POST" && path == APIPathReplicateChunk:
+		if a.refuseDiskCritical(w) {
+			return
+		}
+		if !a.inflight.beginUnlessDraining() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(drainRetryAfter.Seconds())))
+			http.Error(w, "node is draining", http.StatusServiceUnavailable)
+			return
+		}
+		defer a.inflight.end()
+		a.handleReplicateChunk(w, r)
+	case (method == "GET" || method == "DELETE") && path == APIPathReplicateChunk:
+		a.handleReplicateChunk(w, r)
 	case method == "GET" && path == APIPathClusterState:
 		a.handleClusterState(w, r)
+	case method == "GET" && path == APIPathUserSegments:
+		a.inflight.begin()
+		defer a.inflight.end()
+		a.handleUserSegments(w, r)
+	case method == "GET" && path == APIPathInternalSegments:
+		a.inflight.begin()
+		defer a.inflight.end()
+		a.handleInternalSegments(w, r)
+	case method == "GET" && path == APIPathInternalCoverage:
+		a.handleInternalCoverage(w, r)
+	case method == "POST" && path == APIPathImportSegment:
+		if a.refuseDiskCritical(w) {
+			return
+		}
+		if !a.inflight.beginUnlessDraining() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(drainRetryAfter.Seconds())))
+			http.Error(w, "node is draining", http.StatusServiceUnavailable)
+			return
+		}
+		defer a.inflight.end()
+		a.handleImportSegment(w, r)
+	case (method == "GET" || method == "HEAD") && strings.HasPrefix(path, APIPathSegment):
+		a.handleSegment(w, r)
 	default:
 		http.NotFound(w, r)
 	}
 }
 
+// inflightRequests counts requests being served, so a draining node can wait
+// for them to complete.
+type inflightRequests struct {
+	mtx      sync.Mutex
+	draining bool
+	n        int
+	idle     chan struct{} // closed when draining, and n reaches zero
+}
+
+func newInflightRequests() *inflightRequests {
+	return &inflightRequests{idle: make(chan struct{})}
+}
+
+func (ir *inflightRequests) begin() {
+	ir.mtx.Lock()
+	defer ir.mtx.Unlock()
+	ir.n++
+}
+
+func (ir *inflightRequests) beginUnlessDraining() bool {
+	ir.mtx.Lock()
+	defer ir.mtx.Unlock()
+	if ir.draining {
+		return false
+	}
+	ir.n++
+	return true
+}
+
+func (ir *inflightRequests) end() {
+	ir.mtx.Lock()
+	defer ir.mtx.Unlock()
+	ir.n--
+	ir.signalIdle()
+}
+
+func (ir *inflightRequests) drain() {
+	ir.mtx.Lock()
+	defer ir.mtx.Unlock()
+	ir.draining = true
+	ir.signalIdle()
+}
+
+// signalIdle must be called with the mutex held.
+func (ir *inflightRequests) signalIdle() {
+	if !ir.draining || ir.n > 0 {
+		return
+	}
+	select {
+	case <-ir.idle: // already closed
+	default:
+		close(ir.idle)
+	}
+}
+
+func (ir *inflightRequests) wait(timeout time.Duration) error {
+	select {
+	case <-ir.idle:
+		return nil
+	case <-time.After(timeout):
+		ir.mtx.Lock()
+		defer ir.mtx.Unlock()
+		return errors.Errorf("%d request(s) still in flight after %s", ir.n, timeout)
+	}
+}
+
 type interceptingWriter struct {
 	code int
 	http.ResponseWriter
@@ -134,31 +454,122 @@ func (iw *interceptingWriter) Flush() {
 	}
 }
 
-func (a *API) handleUserQuery(w http.ResponseWriter, r *http.Request) {
+func (iw *interceptingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := iw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response doesn't support hijacking")
+	}
+	return h.Hijack()
+}
+
+func (a *API) handleUserQuery(w http.ResponseWriter, r *http.Request, qa *queryAudit) {
 	begin := time.Now()
 
 	// Validate user input.
 	var qp QueryParams
-	if err := qp.DecodeFrom(r.URL, rangeRequired); err != nil {
+	err := qp.DecodeFrom(r.URL, rangeRequired)
+	qa.params(qp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	asJSON, err := wantJSON(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bucket, err := parseHistogram(r.URL, qp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	download, err := parseDownload(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, err := parseReport(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dedup, err := parseDedup(r.URL)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	waitForFresh, err := parseWaitForFresh(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The query, including the queries of the other nodes, stops when the
+	// client goes away, or it's taken too long.
+	ctx, cancel := a.queryContext(r)
+	defer cancel()
 
-	members := a.peer.Current(cluster.PeerTypeStore)
+	// Records before the watermark are in the stores, so in the results; it's
+	// taken before the query, for that to hold. A query near the live edge
+	// may wait for the watermark to pass its end, or else tells the client
+	// where it is, so it knows the records after it may be missing.
+	var watermark time.Time
+	if waitForFresh {
+		watermark = a.waitForFresh(ctx, qp.To.Time)
+	} else {
+		watermark = a.watermark(ctx, false)
+	}
+
+	// HEAD requests are statistics queries. So are GET requests with the
+	// stats parameter, which can have a JSON body. Histogram queries read
+	// every record, but return only counts, as do replication reports, in
+	// buckets of the histogram, if any.
+	method := r.Method
+	_, statsOnly := r.URL.Query()["stats"]
+	if report != "" && (download != "" || statsOnly || method == "HEAD") {
+		http.Error(w, "reports are of records, not statistics or downloads", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case bucket > 0 || report != "":
+		method, statsOnly = "GET", false
+	case statsOnly || method == "HEAD":
+		method, statsOnly = "HEAD", true
+	}
+	if download != "" && (bucket > 0 || statsOnly) {
+		http.Error(w, "downloads are of records, not statistics or histograms", http.StatusBadRequest)
+		return
+	}
+
+	members := a.queryPeers()
 	if len(members) <= 0 {
 		// Very odd; we should at least find ourselves!
 		http.Error(w, "no store nodes available", http.StatusServiceUnavailable)
 		return
 	}
 
-	var requests []*http.Request
-	for _, hostport := range members {
+	// Pin relative times like now or -15m, so all nodes query the same range.
+	pinned := r.URL.Query()
+	pinned.Set("from", qp.From.ULID.String())
+	pinned.Set("to", qp.To.ULID.String())
+	pinned.Del("download")
+	pinned.Del("report")
+	pinned.Del("dedup")
+	pinned.Del("wait_for_fresh")
+	if bucket > 0 || report != "" {
+		pinned.Del("histogram")
+		pinned.Del("limit") // histograms count every record
+	}
+
+	// Planned queries read only the given segments of a node, which are
+	// POSTed, as there may be many. Nil segments read everything.
+	newRequest := func(hostport string, segments []string) (*http.Request, error) {
 		// Copy original URL, to save all the query params, etc.
 		u, err := url.Parse(r.URL.String())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return nil, err
 		}
+		u.RawQuery = pinned.Encode()
 
 		// Fix the scheme, host, and path.
 		// (These may be empty due to StripPrefix.)
@@ -166,36 +577,125 @@ func (a *API) handleUserQuery(w http.ResponseWriter, r *http.Request) {
 		u.Host = hostport
 		u.Path = fmt.Sprintf("store%s", APIPathInternalQuery)
 
-		// Construct a new request.
-		req, err := http.NewRequest(r.Method, u.String(), nil)
+		if segments == nil {
+			req, err := http.NewRequest(method, u.String(), nil)
+			if err != nil {
+				return nil, err
+			}
+			return req.WithContext(ctx), nil
+		}
+		form := url.Values{"segment": segments}
+		if method == "HEAD" {
+			form.Set("stats", "")
+		}
+		req, err := http.NewRequest("POST", u.String(), strings.NewReader(form.Encode()))
 		if err != nil {
-			err = errors.Wrapf(err, "constructing request for %s", hostport)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return nil, err
 		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req.WithContext(ctx), nil
+	}
 
-		// Execute that request later.
-		requests = append(requests, req)
+	// Without a planner, every node reads everything. So it does for the
+	// records of every replica, not deduplicated, or counted in a report.
+	var (
+		plan  = queryPlan{}
+		cov   coverage
+		zones map[string]string
+	)
+	if a.planner != nil && dedup && report == "" {
+		plan, cov, zones = a.planQuery(members, qp.From.ULID, qp.To.ULID)
+	} else {
+		for _, hostport := range members {
+			plan[hostport] = nil
+		}
 	}
 
-	// Execute all requests concurrently.
+	// Execute all requests concurrently, in rounds. The segments a node
+	// fails to read are planned again, on the other nodes holding them, for
+	// the next round. That ends when every segment is read, or lost.
 	type response struct {
-		resp *http.Response
-		err  error
+		hostport string
+		segments []string
+		resp     *http.Response
+		err      error
 	}
-	c := make(chan response, len(requests))
-	for _, req := range requests {
-		go func(req *http.Request) {
-			resp, err := a.queryClient.Do(req)
-			c <- response{resp, err}
-		}(req)
+	var (
+		responses []response
+		failed    = map[string]bool{}
+	)
+	for len(plan) > 0 {
+		requests := map[string]*http.Request{}
+		for hostport, segments := range plan {
+			req, err := newRequest(hostport, segments)
+			if err != nil {
+				for _, response := range responses {
+					if response.err == nil {
+						response.resp.Body.Close()
+					}
+				}
+				err = errors.Wrapf(err, "constructing request for %s", hostport)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			requests[hostport] = req
+		}
+		c := make(chan response, len(requests))
+		for hostport, req := range requests {
+			go func(hostport string, segments []string, req *http.Request) {
+				resp, err := a.queryClient.Do(req)
+				c <- response{hostport, segments, resp, err}
+			}(hostport, plan[hostport], req)
+		}
+
+		replanned := queryPlan{}
+		for range requests {
+			response := <-c
+			if response.segments == nil || (response.err == nil && response.resp.StatusCode/100 == 2) {
+				responses = append(responses, response)
+				continue
+			}
+			failed[response.hostport] = true
+			next, lost := a.planner.plan(cov, zones, failed, response.segments)
+			for hostport, segments := range next {
+				replanned[hostport] = append(replanned[hostport], segments...)
+			}
+			a.planner.fallbacks.Add(float64(len(response.segments) - len(lost)))
+			if len(lost) > 0 {
+				responses = append(responses, response) // an error, below
+				continue
+			}
+			if response.err == nil {
+				response.resp.Body.Close()
+			}
+			err := response.err
+			if err == nil {
+				err = errors.New(response.resp.Status)
+			}
+			a.reporter.ReportEvent(Event{
+				Op: "handleUserQuery", Error: err,
+				Msg: fmt.Sprintf("query of store %s failed: reading its %d segment(s) from other stores", response.hostport, len(response.segments)),
+			})
+		}
+		plan = replanned
 	}
 
 	// We'll collect responses into a single QueryResult.
 	qr := QueryResult{Params: qp}
+	if !watermark.IsZero() {
+		qr.Watermark = &watermark
+	}
 
 	// We'll merge all records in a single pass.
-	var rcs []io.ReadCloser
+	// If the query is limited, and some store has more records, the page can
+	// only include records up to the last one returned by that store.
+	var (
+		rcs       []io.ReadCloser
+		nodeStats []*QueryStats
+		cutoff    *ulid.ULID
+		truncated string                           // by the segment limit of a node, if any
+		scanned   = map[string][]segmentPosition{} // by the nodes, for the next page
+	)
 	defer func() {
 		// Don't leak if we need to make an early return.
 		for i, rc := range rcs {
@@ -209,10 +709,6 @@ func (a *API) handleUserQuery(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	// Collect responses.
-	responses := make([]response, cap(c))
-	for i := 0; i < len(responses); i++ {
-		responses[i] = <-c
-	}
 	for i, response := range responses {
 		// Direct error, network problem?
 		if response.err != nil {
@@ -268,8 +764,42 @@ func (a *API) handleUserQuery(w http.ResponseWriter, r *http.Request) {
 		// We do a single lazy merge of all records, at the end!
 		// Extract the records ReadCloser, for later processing.
 		rcs = append(rcs, partialResult.Records)
+		nodeStats = append(nodeStats, partialResult.Stats)
 		partialResult.Records = nil
 
+		// Find the cutoff of a limited query, or one truncated by a node.
+		if partialResult.Truncated != "" {
+			truncated = partialResult.Truncated
+		}
+		if partialResult.Continue != "" {
+			last, err := decodeContinue(partialResult.Continue)
+			if err != nil {
+				a.reporter.ReportEvent(Event{
+					Op: "handleUserQuery", Error: err,
+					Msg: fmt.Sprintf("gather query response from store %d/%d: invalid continuation", i+1, len(responses)),
+				})
+				qr.ErrorCount++
+				continue
+			}
+			if cutoff == nil || (!qp.Backward && last.Compare(*cutoff) < 0) || (qp.Backward && last.Compare(*cutoff) > 0) {
+				cutoff = &last
+			}
+		}
+		if partialResult.scanned != "" {
+			c, err := decodeContinuation(partialResult.scanned)
+			if err != nil {
+				a.reporter.ReportEvent(Event{
+					Op: "handleUserQuery", Error: err,
+					Msg: fmt.Sprintf("gather query response from store %d/%d: invalid scanned segments", i+1, len(responses)),
+				})
+				qr.ErrorCount++
+				continue
+			}
+			for node, positions := range c.nodes {
+				scanned[node] = positions
+			}
+		}
+
 		// Merge everything else, though.
 		if err := qr.Merge(partialResult); err != nil {
 			err = errors.Wrap(err, "merging results")
@@ -278,21 +808,149 @@ func (a *API) handleUserQuery(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Now bind all the partial ReadClosers together.
-	mrc, err := newMergeReadCloser(rcs)
-	if err != nil {
-		err = errors.Wrap(err, "constructing merging reader")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// A replication report counts the records of each node, rather than
+	// merging them.
+	if report == reportReplication {
+		readers := make([]io.Reader, len(rcs))
+		for i, rc := range rcs {
+			readers[i] = rc
+		}
+		rep, err := replicationReport(readers, qp.order(), qp.From.ULID, qp.To.ULID, bucket)
+		if err != nil {
+			err = errors.Wrap(err, "counting replicas")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		qr.Stats = &QueryStats{}
+		for _, s := range nodeStats {
+			qr.Stats.merge(*s)
+		}
+		qr.Duration = time.Since(begin).String() // overwrite
+		qr.encodeReplicationTo(w, rep)
 		return
 	}
+
+	// Now bind all the partial ReadClosers together.
+	var (
+		mergeBegin = time.Now()
+		counters   = &queryCounters{}
+		mrc        io.ReadCloser
+	)
+	if dedup {
+		mrc = newMergeReadCloser(rcs, qp.order(), counters)
+	} else {
+		mrc = newReplicaMergeReadCloser(rcs, qp.order())
+	}
+	rcs = nil // don't double-close on return
+
+	// The stats of each node are complete once its records are merged.
+	stats := &QueryStats{}
+	mrc = newFinishReadCloser(mrc, func() {
+		for _, s := range nodeStats {
+			stats.merge(*s)
+		}
+		stats.RecordsDeduplicated += atomic.LoadInt64(&counters.deduplicated)
+		stats.MergeDuration = time.Since(mergeBegin)
+	})
 	qr.Records = mrc // lazy reader
-	rcs = nil        // don't double-close on return
+	qr.Stats = stats
+
+	// Histogram queries return only the buckets.
+	if bucket > 0 {
+		buckets, err := histogram(mrc, qp.From.ULID, qp.To.ULID, bucket)
+		mrc.Close()
+		if err != nil {
+			err = errors.Wrap(err, "counting records")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		qr.Records = nil
+		qr.Duration = time.Since(begin).String() // overwrite
+		qr.encodeHistogramTo(w, buckets)
+		return
+	}
+
+	// Limited queries return a single page. The page may be cut short by
+	// the limits, and unlimited queries, too, as they're written; a limit
+	// of records no greater than the page can't cut it short.
+	// The next page reads on from where each node read its segments, up to
+	// the last record of this one.
+	maxRecords := a.limits.Records
+	if qp.Limit > 0 && qp.Limit <= maxRecords {
+		maxRecords = 0
+	}
+	continueFrom := func(last ulid.ULID) string {
+		c := continuation{last: last, nodes: map[string][]segmentPosition{}}
+		for node, bounds := range scanned {
+			c.nodes[node] = advance(bounds, last, qp.Backward)
+		}
+		return c.encode()
+	}
+	if qp.Limit > 0 && !statsOnly {
+		trc := newTruncatingReadCloser(mrc, maxRecords, a.limits.Bytes, nil, "", qp.order(), continueFrom, &qr)
+		page, token, err := paginate(trc, qp.Limit, cutoff, qp.order(), continueFrom)
+		trc.Close()
+		if err != nil {
+			err = errors.Wrap(err, "paginating records")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		full := bytes.Count(page, []byte{'\n'}) >= qp.Limit
+		switch {
+		case qr.Truncated != "" && full:
+			qr.Truncated = "" // the page is full anyway
+			fallthrough
+		case qr.Truncated != "":
+			token = qr.Continue
+		case token != "" && truncated != "" && !full:
+			qr.Truncated = truncated // the page ends where a node's did
+		}
+		qr.Records = ioutil.NopCloser(bytes.NewReader(page))
+		qr.Continue = token
+	}
+	if qp.Limit <= 0 && !statsOnly && (maxRecords > 0 || a.limits.Bytes > 0 || cutoff != nil) {
+		qr.Records = newTruncatingReadCloser(qr.Records, maxRecords, a.limits.Bytes, cutoff, truncated, qp.order(), continueFrom, &qr)
+	}
+
+	// Statistics queries have no records, and so complete stats.
+	if statsOnly {
+		qr.Records.Close()
+		qr.Records = nil
+	}
 
 	// Return!
+	qr.Records = qa.countRecords(qr.Records)
 	qr.Duration = time.Since(begin).String() // overwrite
+	defer a.reportPartial(ctx, "handleUserQuery")
+	if download != "" {
+		qr.encodeDownloadTo(w, download, asJSON)
+		return
+	}
+	if asJSON {
+		qr.EncodeJSONTo(w)
+		return
+	}
 	qr.EncodeTo(w)
 }
 
+// wantJSON reports whether a user query asks for JSON results, with the format
+// parameter, or by accepting newline-delimited JSON.
+func wantJSON(r *http.Request) (bool, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "json":
+		return true, nil
+	case "text":
+		return false, nil
+	case "":
+		return strings.Contains(r.Header.Get("Accept"), "application/x-ndjson"), nil
+	default:
+		return false, errors.Errorf("parsing 'format': %q isn't json or text", format)
+	}
+}
+
+// handleInternalQuery queries this node. Planned queries are POSTed, with a
+// form body of the segment to read, repeated, and stats, for statistics
+// queries; see QueryPlanner.
 func (a *API) handleInternalQuery(w http.ResponseWriter, r *http.Request) {
 	var qp QueryParams
 	if err := qp.DecodeFrom(r.URL, rangeRequired); err != nil {
@@ -304,30 +962,151 @@ func (a *API) handleInternalQuery(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "HEAD" {
 		statsOnly = true
 	}
+	if r.Method == "POST" {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		qp.Segments = append([]string{}, r.PostForm["segment"]...) // not nil
+		_, statsOnly = r.PostForm["stats"]
+	}
 
-	result, err := a.log.Query(qp, statsOnly)
+	ctx, cancel := a.queryContext(r)
+	defer cancel()
+	qp.maxSegments = a.limits.Segments
+	qp.node = r.Host // as its peers address it
+	result, err := a.log.Query(ctx, qp, statsOnly)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if statsOnly {
+		result.Records.Close()
+		result.Records = nil // so the stats are a header, not a trailer
+	}
 
 	result.EncodeTo(w)
+	a.reportPartial(ctx, "handleInternalQuery")
 }
 
-func (a *API) handleUserStream(w http.ResponseWriter, r *http.Request) {
-	// Validate user input.
+// handleInternalCoverage lists the names of the segments this node would read
+// for a query of the range; see QueryPlanner. Unlike handleInternalSegments,
+// it reads none of them.
+func (a *API) handleInternalCoverage(w http.ResponseWriter, r *http.Request) {
 	var qp QueryParams
-	if err := qp.DecodeFrom(r.URL, rangeNotRequired); err != nil {
+	if err := qp.DecodeFrom(r.URL, rangeRequired); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	segments, err := a.log.Queryable(qp.From.ULID, ulidutil.Max(qp.To.ULID.Time()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if segments == nil {
+		segments = []string{}
+	}
+	buf, err := json.Marshal(segments)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(append(buf, '\n'))
+}
 
-	window, err := time.ParseDuration(r.URL.Query().Get("window"))
+// listCoverage gets the coverage of the store node at hostport.
+func (a *API) listCoverage(hostport string, params url.Values) ([]string, error) {
+	u := url.URL{
+		Scheme:   "http",
+		Host:     hostport,
+		Path:     fmt.Sprintf("store%s", APIPathInternalCoverage),
+		RawQuery: params.Encode(),
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
-		window = 3 * time.Second
+		return nil, err
+	}
+	resp, err := a.queryClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		buf, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, errors.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(buf)))
 	}
-	if window < 100*time.Millisecond {
-		window = 100 * time.Millisecond
+	var segments []string
+	if err := json.NewDecoder(resp.Body).Decode(&segments); err != nil {
+		return nil, errors.Wrap(err, "decoding coverage")
+	}
+	return segments, nil
+}
+
+// planQuery plans a query of the range for the members. Members whose
+// coverage can't be listed are planned to read everything, as without a
+// plan, i.e. with nil segments.
+func (a *API) planQuery(members []string, from, to ulid.ULID) (queryPlan, coverage, map[string]string) {
+	type listing struct {
+		hostport string
+		segments []string
+		err      error
+	}
+	params := url.Values{"from": {from.String()}, "to": {to.String()}}
+	c := make(chan listing, len(members))
+	for _, hostport := range members {
+		go func(hostport string) {
+			segments, err := a.listCoverage(hostport, params)
+			c <- listing{hostport, segments, err}
+		}(hostport)
+	}
+
+	var (
+		plan = queryPlan{}
+		cov  = coverage{}
+	)
+	for range members {
+		l := <-c
+		if l.err != nil {
+			a.reporter.ReportEvent(Event{
+				Op: "handleUserQuery", Error: l.err,
+				Msg: fmt.Sprintf("list coverage of store %s: querying it in full", l.hostport),
+			})
+			plan[l.hostport] = nil
+			continue
+		}
+		cov[l.hostport] = l.segments
+	}
+
+	zones := map[string]string{}
+	for _, t := range []cluster.PeerType{cluster.PeerTypeStore, cluster.PeerTypeReadOnlyStore} {
+		for node, zone := range a.peer.Zones(t) {
+			zones[node] = zone
+		}
+	}
+	planned, _ := a.planner.plan(cov, zones, nil, cov.segments())
+	for hostport, segments := range planned {
+		plan[hostport] = segments
+	}
+	return plan, cov, zones
+}
+
+func (a *API) handleUserStream(w http.ResponseWriter, r *http.Request, qa *queryAudit) {
+	usp, err := parseUserStreamParams(r.URL)
+	qa.params(usp.qp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// EventSource asks for Server-Sent Events, and, when it reconnects, for
+	// the records after the last one it got.
+	events := acceptsEventStream(r.Header.Get("Accept"))
+	if events {
+		if err := resumeFromLastEventID(r, &usp); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
 	flusher, ok := w.(http.Flusher)
@@ -336,9 +1115,75 @@ func (a *API) handleUserStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	peerFactory := func() []string {
-		return a.peer.Current(cluster.PeerTypeStore)
+	// If the user asks for errors, we report failed connections to peers
+	// as comments in the stream.
+	var errs chan stream.PeerError
+	if _, ok := r.URL.Query()["errors"]; ok {
+		errs = make(chan stream.PeerError, 16)
+	}
+
+	// Sampled streams say so, and, if they end, how many records the
+	// sampled ones stand for.
+	if usp.qp.Sample > 0 {
+		w.Header().Set(httpHeaderSample, strconv.FormatFloat(usp.qp.Sample, 'g', -1, 64))
+		w.Header().Set("Trailer", httpHeaderSampleEstimate)
+	}
+
+	// We can range over the records chan. A failed write of an event, e.g.
+	// to a client that went away behind a proxy, cancels the stream.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	records := limitStream(a.userStream(ctx, r, usp, errs), a.streamLimits, true, a.queryMetrics)
+	if events {
+		w.Header().Set("Content-Type", eventStreamType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no") // e.g. nginx, which buffers responses
+	}
+	cw, cflusher, finish := compressStream(w, r, flusher)
+	var n, size int64
+	if events {
+		n, size = writeEvents(cw, cflusher, records, errs, a.streamHeartbeat, cancel)
+	} else {
+		n, size = writeStream(cw, cflusher, records, []byte{'\n'}, errs, a.streamHeartbeat)
+	}
+	finish()
+	qa.add(n, size)
+	if usp.qp.Sample > 0 {
+		w.Header().Set(httpHeaderSampleEstimate, strconv.FormatInt(estimateRecords(n, usp.qp.Sample), 10))
+	}
+}
+
+// userStreamParams are the parameters of a user stream.
+type userStreamParams struct {
+	qp     QueryParams
+	since  ulid.ULID
+	resume bool
+	window time.Duration // to deduplicate
+}
+
+// parseUserStreamParams validates user input.
+func parseUserStreamParams(u *url.URL) (usp userStreamParams, err error) {
+	if err := usp.qp.DecodeFrom(u, rangeNotRequired); err != nil {
+		return usp, err
+	}
+	if usp.since, usp.resume, err = parseSince(u); err != nil {
+		return usp, err
+	}
+	usp.window, err = time.ParseDuration(u.Query().Get("window"))
+	if err != nil {
+		usp.window = stream.DefaultDedupeWindow
+	}
+	if usp.window < 100*time.Millisecond {
+		usp.window = 100 * time.Millisecond
 	}
+	return usp, nil
+}
+
+// userStream streams the records of r from every queried peer, deduplicated,
+// until the context is canceled, when the returned chan is closed. Failed
+// connections to peers are reported, and sent to errs, if it isn't nil.
+func (a *API) userStream(ctx context.Context, r *http.Request, usp userStreamParams, errs chan<- stream.PeerError) <-chan []byte {
+	peerFactory := a.queryPeers
 
 	// Use the special stream client, which doesn't time out.
 	readCloserFactory := stream.HTTPReadCloserFactory(a.streamClient, func(addr string) string {
@@ -358,11 +1203,27 @@ func (a *API) handleUserStream(w http.ResponseWriter, r *http.Request) {
 		return u.String()
 	})
 
+	// If the user asks to resume, each peer replays what the user missed.
+	peerErrs := make(chan stream.PeerError, 16)
+	go a.reportStreamErrors(ctx, peerErrs, errs)
+	options := []stream.ExecuteOption{
+		stream.WithMetrics(a.streamMetrics),
+		stream.WithIdleTimeout(streamIdleTimeout),
+		stream.WithErrors(peerErrs),
+		stream.WithBreakers(a.breakers),
+	}
+	if usp.resume {
+		options = append(options, stream.WithSince(usp.since))
+	}
+	if usp.qp.Topic != "" {
+		options = append(options, stream.WithTopic(usp.qp.Topic))
+	}
+
 	// Execute returns when the context is canceled.
 	// We must close the raw chan, which we own.
 	raw := make(chan []byte, 1024)
 	go func() {
-		stream.Execute(r.Context(), peerFactory, readCloserFactory, time.Sleep, time.NewTicker, raw)
+		stream.Execute(ctx, peerFactory, readCloserFactory, time.Sleep, time.NewTicker, raw, options...)
 		close(raw)
 	}()
 
@@ -370,15 +1231,159 @@ func (a *API) handleUserStream(w http.ResponseWriter, r *http.Request) {
 	// We must close the deduplicated chan, which we own.
 	deduplicated := make(chan []byte, 1024)
 	go func() {
-		stream.Deduplicate(raw, window, time.NewTicker, deduplicated)
+		stream.Deduplicate(raw, usp.window, time.NewTicker, deduplicated)
 		close(deduplicated)
 	}()
+	return deduplicated
+}
 
-	// Thus, we can range over the deduplicated chan.
-	for record := range deduplicated {
-		w.Write(record)
-		w.Write([]byte{'\n'})
-		flusher.Flush()
+// reportStreamErrors reports the failed connections of a stream to its peers,
+// each peer's at most once per streamPeerErrorInterval, and passes them all on
+// to errs, if it isn't nil, until the context is canceled.
+func (a *API) reportStreamErrors(ctx context.Context, peerErrs <-chan stream.PeerError, errs chan<- stream.PeerError) {
+	reported := map[string]time.Time{}
+	for {
+		select {
+		case e := <-peerErrs:
+			if last, ok := reported[e.Addr]; !ok || e.Time.Sub(last) >= streamPeerErrorInterval {
+				reported[e.Addr] = e.Time
+				a.reporter.ReportEvent(Event{
+					Op: "userStream", Warning: e.Err,
+					Msg: fmt.Sprintf("streaming from store %s, as advertised: connection failed", e.Addr),
+				})
+			}
+			select {
+			case errs <- e:
+			default:
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleUserLive serves a user stream over WebSocket, for the UI's live tail.
+// Each record is a binary message, as records needn't be valid UTF-8, and, if
+// the user asks for errors, each peer error is a text message, beginning with
+// "#". A client that falls more than liveMaxBuffered bytes behind is closed
+// with a policy violation, and the reason.
+func (a *API) handleUserLive(w http.ResponseWriter, r *http.Request, qa *queryAudit) {
+	usp, err := parseUserStreamParams(r.URL)
+	qa.params(usp.qp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, ok := upgradeWebSocket(w, r, a.crossOriginLive)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+
+	// Once the connection is ours, only the client's close frame, or a read
+	// error, tells us the client has gone.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	var (
+		pongs   = make(chan []byte, 1)
+		closing = make(chan []byte, 1) // the close frame to answer with
+	)
+	go func() {
+		defer cancel()
+		for {
+			op, payload, err := conn.readFrame(0)
+			if err == errWebSocketProtocol {
+				closing <- closePayload(wsCloseProtocolError, err.Error())
+				return
+			}
+			if err != nil {
+				return
+			}
+			switch op {
+			case wsOpPing:
+				select {
+				case pongs <- payload:
+				default: // one pong will do
+				}
+			case wsOpClose:
+				closing <- payload // echo the client's status code
+				return
+			}
+		}
+	}()
+
+	var errs chan stream.PeerError
+	if _, ok := r.URL.Query()["errors"]; ok {
+		errs = make(chan stream.PeerError, 16)
+	}
+	records := a.userStream(ctx, r, usp, errs)
+
+	// The records are queued for the writer, below. If the queue fills up,
+	// the client is too slow. Either way, we drain the records chan, until
+	// it's closed, once the context is canceled.
+	var (
+		queue    = make(chan []byte, 1024)
+		buffered int64 // bytes in the queue
+		slow     = make(chan struct{})
+	)
+	go func() {
+		var overflowed bool
+		for record := range records {
+			if overflowed {
+				continue
+			}
+			if atomic.AddInt64(&buffered, int64(len(record))) > a.liveMaxBuffered {
+				overflowed = true
+				close(slow)
+				continue
+			}
+			select {
+			case queue <- record:
+			default:
+				overflowed = true
+				close(slow)
+			}
+		}
+	}()
+
+	tk := time.NewTicker(a.streamHeartbeat)
+	defer tk.Stop()
+	for {
+		var err error
+		select {
+		case record := <-queue:
+			atomic.AddInt64(&buffered, -int64(len(record)))
+			if err = conn.writeFrame(wsOpBinary, record); err == nil {
+				qa.add(1, int64(len(record)))
+			}
+
+		case e := <-errs:
+			err = conn.writeFrame(wsOpText, []byte(fmt.Sprintf("# %s peer error: %s", e.Time.UTC().Format(time.RFC3339), e.Error())))
+
+		case payload := <-pongs:
+			err = conn.writeFrame(wsOpPong, payload)
+
+		case <-tk.C:
+			err = conn.writeFrame(wsOpPing, nil)
+
+		case <-slow:
+			reason := fmt.Sprintf("too slow: more than %d bytes behind", a.liveMaxBuffered)
+			conn.writeClose(wsClosePolicyViolation, reason)
+			qa.fail(errors.New(reason))
+			return
+
+		case <-ctx.Done():
+			select {
+			case payload := <-closing:
+				conn.writeFrame(wsOpClose, payload)
+			default:
+				conn.writeClose(wsCloseGoingAway, "")
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
 	}
 }
 
@@ -395,48 +1400,190 @@ func (a *API) handleInternalStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	since, resume, err := parseSince(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	pass := recordFilterPlain([]byte(qp.Q))
 	if qp.Regex {
 		// QueryParams.DecodeFrom validated the regex.
 		pass = recordFilterRegex(regexp.MustCompile(qp.Q))
 	}
+	if qp.Topic != "" {
+		pass = recordFilterTopic([]byte(qp.Topic), pass)
+	}
+	if qp.Sample > 0 {
+		pass = recordFilterSample(qp.Sample, pass)
+	}
+
+	// Annotated records are of this node, as its peers address it.
+	if qp.Annotate {
+		qp.node = r.Host
+	}
 
 	// The records chan is closed when the context is canceled.
-	records := a.streamQueries.Register(r.Context(), pass)
+	// Register before replaying, so no records fall in between.
+	records := a.streamQueries.Register(r.Context(), pass, qp.node)
+
+	// When resuming, replay records from the log first.
+	if resume {
+		records = resumeStream(r.Context(), a.log, qp, since, records, a.reporter)
+	}
 
 	// Thus, we range over the records chan.
-	for record := range records {
-		w.Write(record) // includes trailing newline
+	// Records already include a trailing newline.
+	cw, cflusher, finish := compressStream(w, r, flusher)
+	defer finish()
+	writeStream(cw, cflusher, limitStream(records, a.streamLimits, false, a.queryMetrics), nil, nil, a.streamHeartbeat)
+}
+
+// writeStream writes each record, plus the suffix, to w until the records
+// chan is closed. If no record has been written in the past heartbeat
+// interval, an empty line is written instead. Peer errors are written as
+// comment lines, beginning with "#", as records that are comments already,
+// e.g. of records dropped, are. It returns the number of records written, and
+// their bytes, including the suffixes, but not comments.
+func writeStream(w io.Writer, flusher http.Flusher, records <-chan []byte, suffix []byte, errs <-chan stream.PeerError, heartbeat time.Duration) (n, size int64) {
+	flusher.Flush() // send headers straight away, so the client knows we're here
+	tk := time.NewTicker(heartbeat)
+	defer tk.Stop()
+	var active bool
+	for {
+		select {
+		case record, ok := <-records:
+			if !ok {
+				return n, size
+			}
+			w.Write(record)
+			w.Write(suffix)
+			if len(record) == 0 || record[0] != '#' {
+				n, size = n+1, size+int64(len(record)+len(suffix))
+			}
+			active = true
+
+		case e := <-errs:
+			fmt.Fprintf(w, "# %s peer error: %s\n", e.Time.UTC().Format(time.RFC3339), e.Error())
+			active = true
+
+		case <-tk.C:
+			if active {
+				active = false
+				continue
+			}
+			w.Write([]byte{'\n'})
+		}
 		flusher.Flush()
 	}
 }
 
+// compressStream returns a writer and flusher for a streaming query response.
+// If the client accepts snappy, the response is compressed with snappy's
+// framing format, or else, if it accepts gzip, with gzip. Every flush also
+// flushes the compressor, so records and heartbeats are never held back.
+// The finish func must be called once writing is done.
+func compressStream(w http.ResponseWriter, r *http.Request, flusher http.Flusher) (io.Writer, http.Flusher, func()) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	switch accept := r.Header.Get("Accept-Encoding"); {
+	case acceptsEncoding(accept, "snappy"):
+		w.Header().Set("Content-Encoding", "snappy")
+		sw := snappy.NewBufferedWriter(w)
+		return sw, snappyFlusher{sw, flusher}, func() { sw.Close() }
+	case acceptsEncoding(accept, "gzip"):
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		return gz, gzipFlusher{gz, flusher}, func() { gz.Close() }
+	default:
+		return w, flusher, func() {}
+	}
+}
+
+type snappyFlusher struct {
+	sw      *snappy.Writer
+	flusher http.Flusher
+}
+
+func (f snappyFlusher) Flush() {
+	f.sw.Flush()
+	f.flusher.Flush()
+}
+
+type gzipFlusher struct {
+	gz      *gzip.Writer
+	flusher http.Flusher
+}
+
+func (f gzipFlusher) Flush() {
+	f.gz.Flush()
+	f.flusher.Flush()
+}
+
+// acceptsEncoding parses an Accept-Encoding header, and reports whether it
+// accepts the content coding. Quality values are only checked for zero,
+// which means "not acceptable".
+func acceptsEncoding(header, coding string) bool {
+	for _, token := range strings.Split(header, ",") {
+		parts := strings.Split(token, ";")
+		if strings.TrimSpace(parts[0]) != coding {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if q := strings.TrimSpace(param); strings.HasPrefix(q, "q=") {
+				if v, err := strconv.ParseFloat(q[2:], 64); err == nil && v == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
 func (a *API) handleReplicate(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
-	segment, err := a.log.Create()
+	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	var buf bytes.Buffer
-	lo, hi, n, err := teeRecords(r.Body, segment, &buf)
+	if n, err := a.replicate(body, r.Header[httpHeaderOrigins], r.Header.Get(httpHeaderShip) == "true"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else if n == 0 {
+		fmt.Fprintln(w, "No records")
+	} else {
+		fmt.Fprintln(w, "OK")
+	}
+}
+
+// replicate writes the records of a replicated segment, from the origins, to
+// a new segment, and returns the bytes of records written, which may be none.
+// If ship is true, the segment is queued to be shipped to the standby.
+func (a *API) replicate(body []byte, origins []string, ship bool) (int, error) {
+	segment, err := a.log.Create()
+	if err != nil {
+		return 0, err
+	}
+	segment.SetOrigins(origins)
+	body = sortRecords(body) // segments must be sorted, however they arrive
+	lo, hi, n, err := teeRecords(bytes.NewReader(body), segment)
 	if err != nil {
 		segment.Delete()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return 0, err
 	} else if n == 0 {
 		segment.Delete()
-		fmt.Fprintln(w, "No records")
-		return
+		return 0, nil
 	}
 	if err := segment.Close(lo, hi); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return 0, err
+	}
+	if ship {
+		a.shipper.Enqueue(fmt.Sprintf("%s-%s", lo, hi))
 	}
-	go a.streamQueries.Match(buf.Bytes()) // TODO(pb): validate `go`
+	go a.streamQueries.Match(fmt.Sprintf("%s-%s", lo, hi), body) // TODO(pb): validate `go`
 	a.replicatedSegments.Inc()
 	a.replicatedBytes.Add(float64(n))
-	fmt.Fprintln(w, "OK")
+	return n, nil
 }
 
 func (a *API) handleClusterState(w http.ResponseWriter, r *http.Request) {
@@ -454,7 +1601,7 @@ func teeRecords(src io.Reader, dst ...io.Writer) (lo, hi ulid.ULID, n int, err e
 		first = true
 		id    ulid.ULID
 		w     = io.MultiWriter(dst...)
-		s     = bufio.NewScanner(src)
+		s     = record.NewScanner(src)
 	)
 	s.Split(scanLinesPreserveNewline)
 	for s.Scan() {
@@ -1,21 +1,34 @@
 package store
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/oklog/oklog/pkg/cluster"
 	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/stream"
 	"github.com/oklog/ulid"
 )
 
@@ -57,6 +70,38 @@ func TestTeeRecords(t *testing.T) {
 	}
 }
 
+func TestAPIReplicateUnsorted(t *testing.T) {
+	t.Parallel()
+
+	a, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer a.Close()
+
+	// Records ingested with client timestamps arrive in any order, and are
+	// sorted, so queries of any range find them, in order.
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(recordE+recordB+recordH+recordA)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+	}
+	for _, testcase := range []struct {
+		from, to string
+		want     string
+	}{
+		{"01BB6RQR190000000000000000", "01BB6RXQ090000000000000000", recordA + recordB + recordE + recordH}, // A to I
+		{"01BB6RT5GR0000000000000000", "01BB6RWTY70000000000000000", recordE},                               // C to G
+	} {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("%s?from=%s&to=%s", APIPathInternalQuery, testcase.from, testcase.to), nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Query failed: HTTP %d: %s", w.Code, strings.TrimSpace(w.Body.String()))
+		}
+		if want, have := testcase.want, w.Body.String(); want != have {
+			t.Errorf("%s to %s: want %q, have %q", testcase.from, testcase.to, want, have)
+		}
+	}
+}
+
 func TestAPIInternalQueryFromULID(t *testing.T) {
 	t.Parallel()
 
@@ -82,6 +127,529 @@ func TestAPIInternalQueryFromULID(t *testing.T) {
 	}
 }
 
+func TestAPIInternalQueryPagination(t *testing.T) {
+	t.Parallel()
+
+	a, err := newFixtureAPI(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	var (
+		pages []string
+		token string
+	)
+	for {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", fmt.Sprintf(
+			"%s?from=%s&to=%s&limit=2&continue=%s",
+			APIPathInternalQuery,
+			"01BB6RQR190000000000000000", // A
+			"01BB6RXQ090000000000000000", // I
+			token,
+		), nil)
+		a.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Query failed: HTTP %d: %s", w.Code, strings.TrimSpace(w.Body.String()))
+		}
+		pages = append(pages, w.Body.String())
+		if token = w.Header().Get(httpHeaderContinue); token == "" {
+			break
+		}
+		if len(pages) > 10 {
+			t.Fatalf("too many pages: %q", pages)
+		}
+	}
+	want := []string{
+		recordA + recordB,
+		recordC + recordD,
+		recordE + recordF,
+		recordG + recordH,
+		recordI,
+	}
+	if !reflect.DeepEqual(want, pages) {
+		t.Errorf("want pages %q, have %q", want, pages)
+	}
+}
+
+func TestAPIUserQueryPagination(t *testing.T) {
+	t.Parallel()
+
+	// Two store nodes with interleaved records, and one record in common.
+	var addrs []string
+	for _, records := range []string{
+		recordA + recordC + recordE + recordG + recordI,
+		recordB + recordC + recordD + recordF + recordH,
+	} {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(records)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+		addrs = append(addrs, strings.TrimPrefix(server.URL, "http://"))
+	}
+	front, server := newStreamFixture(t, staticPeer(addrs))
+	defer server.Close()
+	defer front.Close()
+
+	// Walk all pages; every record shows up once, in order.
+	var (
+		have  []string
+		token string
+	)
+	for i := 0; ; i++ {
+		resp, err := http.Get(fmt.Sprintf(
+			"%s/store%s?from=%s&to=%s&limit=3&continue=%s",
+			server.URL,
+			APIPathUserQuery,
+			"01BB6RQR190000000000000000", // A
+			"01BB6RXQ090000000000000000", // I
+			token,
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var qr QueryResult
+		if err := qr.DecodeFrom(resp); err != nil {
+			t.Fatal(err)
+		}
+		page, _ := ioutil.ReadAll(qr.Records)
+		qr.Records.Close()
+		if n := strings.Count(string(page), "\n"); n > 3 {
+			t.Errorf("page %d: want at most 3 records, have %d", i, n)
+		}
+		have = append(have, string(page))
+		if token = qr.Continue; token == "" {
+			break
+		}
+		if i > 10 {
+			t.Fatalf("too many pages: %q", have)
+		}
+	}
+	if want, have := recordA+recordB+recordC+recordD+recordE+recordF+recordG+recordH+recordI, strings.Join(have, ""); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestAPIUserQueryPaginationLateSegment(t *testing.T) {
+	t.Parallel()
+
+	var (
+		nodes []*API
+		addrs []string
+	)
+	for _, records := range []string{
+		recordA + recordC + recordE + recordG + recordI,
+		recordB + recordD + recordF + recordH,
+	} {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(records)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+		nodes = append(nodes, a)
+		addrs = append(addrs, strings.TrimPrefix(server.URL, "http://"))
+	}
+	front, server := newStreamFixture(t, staticPeer(addrs))
+	defer server.Close()
+	defer front.Close()
+
+	// After the first page, a segment lands late, with a record older than
+	// the page's last. It's still read, on the next page.
+	const recordLate = "01BB6RRTB70000000000000001 late\n" // after B, before C
+	var (
+		have  []string
+		token string
+	)
+	for i := 0; ; i++ {
+		resp, err := http.Get(fmt.Sprintf(
+			"%s/store%s?from=%s&to=%s&limit=3&continue=%s",
+			server.URL,
+			APIPathUserQuery,
+			"01BB6RQR190000000000000000", // A
+			"01BB6RXQ090000000000000000", // I
+			token,
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var qr QueryResult
+		if err := qr.DecodeFrom(resp); err != nil {
+			t.Fatal(err)
+		}
+		page, _ := ioutil.ReadAll(qr.Records)
+		qr.Records.Close()
+		have = append(have, string(page))
+		if token = qr.Continue; token == "" {
+			break
+		}
+		if i == 0 {
+			w := httptest.NewRecorder()
+			nodes[0].ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(recordLate)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+			}
+		}
+		if i > 10 {
+			t.Fatalf("too many pages: %q", have)
+		}
+	}
+	if want, have := recordA+recordB+recordC+recordLate+recordD+recordE+recordF+recordG+recordH+recordI, strings.Join(have, ""); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestAPIInternalQueryBackward(t *testing.T) {
+	t.Parallel()
+
+	a, err := newFixtureAPI(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	var (
+		pages []string
+		token string
+	)
+	for {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", fmt.Sprintf(
+			"%s?from=%s&to=%s&direction=backward&limit=2&continue=%s",
+			APIPathInternalQuery,
+			"01BB6RQR190000000000000000", // A
+			"01BB6RXQ090000000000000000", // I
+			token,
+		), nil)
+		a.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Query failed: HTTP %d: %s", w.Code, strings.TrimSpace(w.Body.String()))
+		}
+		pages = append(pages, w.Body.String())
+		if token = w.Header().Get(httpHeaderContinue); token == "" {
+			break
+		}
+		if len(pages) > 10 {
+			t.Fatalf("too many pages: %q", pages)
+		}
+	}
+	want := []string{
+		recordI + recordH,
+		recordG + recordF,
+		recordE + recordD,
+		recordC + recordB,
+		recordA,
+	}
+	if !reflect.DeepEqual(want, pages) {
+		t.Errorf("want pages %q, have %q", want, pages)
+	}
+}
+
+func TestAPIUserQueryBackward(t *testing.T) {
+	t.Parallel()
+
+	// Two store nodes with interleaved records, and one record in common.
+	var addrs []string
+	for _, records := range []string{
+		recordA + recordC + recordE + recordG + recordI,
+		recordB + recordC + recordD + recordF + recordH,
+	} {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(records)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+		addrs = append(addrs, strings.TrimPrefix(server.URL, "http://"))
+	}
+	front, server := newStreamFixture(t, staticPeer(addrs))
+	defer server.Close()
+	defer front.Close()
+
+	// The first page has the newest records.
+	// Walking all pages, every record shows up once, newest first.
+	var (
+		have  []string
+		token string
+	)
+	for i := 0; ; i++ {
+		resp, err := http.Get(fmt.Sprintf(
+			"%s/store%s?from=%s&to=%s&direction=backward&limit=3&continue=%s",
+			server.URL,
+			APIPathUserQuery,
+			"01BB6RQR190000000000000000", // A
+			"01BB6RXQ090000000000000000", // I
+			token,
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var qr QueryResult
+		if err := qr.DecodeFrom(resp); err != nil {
+			t.Fatal(err)
+		}
+		page, _ := ioutil.ReadAll(qr.Records)
+		qr.Records.Close()
+		if i == 0 {
+			if want, have := recordI+recordH+recordG, string(page); want != have {
+				t.Errorf("first page: want %q, have %q", want, have)
+			}
+		}
+		have = append(have, string(page))
+		if token = qr.Continue; token == "" {
+			break
+		}
+		if i > 10 {
+			t.Fatalf("too many pages: %q", have)
+		}
+	}
+	if want, have := recordI+recordH+recordG+recordF+recordE+recordD+recordC+recordB+recordA, strings.Join(have, ""); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestAPIInternalQueryStats(t *testing.T) {
+	t.Parallel()
+
+	// Three segments: A-C, D-F, and G-I.
+	a, err := newFixtureAPI(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for _, testcase := range []struct {
+		name   string
+		method string
+		query  string
+		want   QueryStats
+	}{
+		{
+			name:   "all",
+			method: "GET",
+			query:  "from=01BB6RQR190000000000000000&to=01BB6RXQ090000000000000000",
+			want:   QueryStats{SegmentsConsidered: 3, RecordsScanned: 9, RecordsMatched: 9, BytesRead: int64(len(strings.Join(segments, "")))},
+		},
+		{
+			name:   "pruned by time range",
+			method: "GET",
+			query:  "from=01BB6RV5R00000000000000000&to=01BB6RW6C60000000000000000", // D to F
+			want:   QueryStats{SegmentsConsidered: 3, SegmentsPruned: 2, RecordsScanned: 3, RecordsMatched: 3, BytesRead: int64(len(segments[1]))},
+		},
+		{
+			name:   "filtered by bloom filter",
+			method: "GET",
+			query:  "from=01BB6RQR190000000000000000&to=01BB6RXQ090000000000000000&q=17:01:51",
+			want:   QueryStats{SegmentsConsidered: 3, SegmentsFiltered: 2, RecordsScanned: 3, RecordsMatched: 1, BytesRead: int64(len(segments[1]))},
+		},
+		{
+			name:   "filtered by label",
+			method: "GET",
+			query:  "from=01BB6RQR190000000000000000&to=01BB6RXQ090000000000000000&label=env:prod",
+			want:   QueryStats{SegmentsConsidered: 3, SegmentsFiltered: 1, RecordsScanned: 6, RecordsMatched: 6, BytesRead: int64(len(segments[0] + segments[1]))},
+		},
+		{
+			name:   "filtered by labels of one origin",
+			method: "GET",
+			query:  "from=01BB6RQR190000000000000000&to=01BB6RXQ090000000000000000&label=env:staging&label=region:eu",
+			want:   QueryStats{SegmentsConsidered: 3, SegmentsFiltered: 2, RecordsScanned: 3, RecordsMatched: 3, BytesRead: int64(len(segments[1]))},
+		},
+		{
+			name:   "filtered by labels of different origins",
+			method: "GET",
+			query:  "from=01BB6RQR190000000000000000&to=01BB6RXQ090000000000000000&label=env:prod&label=region:eu",
+			want:   QueryStats{SegmentsConsidered: 3, SegmentsFiltered: 3},
+		},
+		{
+			name:   "stats only",
+			method: "HEAD",
+			query:  "from=01BB6RV5R00000000000000000&to=01BB6RW6C60000000000000000",
+			want:   QueryStats{SegmentsConsidered: 3, SegmentsPruned: 2},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, httptest.NewRequest(testcase.method, APIPathInternalQuery+"?"+testcase.query, nil))
+			resp := w.Result()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Query failed: HTTP %d: %s", w.Code, strings.TrimSpace(w.Body.String()))
+			}
+
+			// Stats of records come after the records, in a trailer.
+			encoded := resp.Trailer.Get(httpHeaderStats)
+			if testcase.method == "HEAD" {
+				encoded = resp.Header.Get(httpHeaderStats)
+			}
+			var have QueryStats
+			if err := json.Unmarshal([]byte(encoded), &have); err != nil {
+				t.Fatalf("%q: %v", encoded, err)
+			}
+			if have.PlanDuration <= 0 {
+				t.Errorf("want positive plan duration, have %s", have.PlanDuration)
+			}
+			have.PlanDuration, have.ReadDuration = 0, 0
+			if want := testcase.want; want != have {
+				t.Errorf("want %+v, have %+v", want, have)
+			}
+		})
+	}
+}
+
+func TestAPIUserQueryStats(t *testing.T) {
+	t.Parallel()
+
+	// Two store nodes with interleaved records, and one record in common.
+	var addrs []string
+	for _, records := range []string{
+		recordA + recordC + recordE + recordG + recordI,
+		recordB + recordC + recordD + recordF + recordH,
+	} {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(records)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+		addrs = append(addrs, strings.TrimPrefix(server.URL, "http://"))
+	}
+	front, server := newStreamFixture(t, staticPeer(addrs))
+	defer server.Close()
+	defer front.Close()
+
+	for _, limit := range []int{0, 4} {
+		resp, err := http.Get(fmt.Sprintf(
+			"%s/store%s?from=%s&to=%s&limit=%d",
+			server.URL,
+			APIPathUserQuery,
+			"01BB6RQR190000000000000000", // A
+			"01BB6RXQ090000000000000000", // I
+			limit,
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var qr QueryResult
+		if err := qr.DecodeFrom(resp); err != nil {
+			t.Fatal(err)
+		}
+
+		// The stats aren't known until the records are read.
+		if want, have := (QueryStats{}), *qr.Stats; want != have {
+			t.Errorf("limit %d: before reading: want %+v, have %+v", limit, want, have)
+		}
+		page, _ := ioutil.ReadAll(qr.Records)
+		qr.Records.Close()
+
+		have := *qr.Stats
+		if have.MergeDuration <= 0 {
+			t.Errorf("limit %d: want positive merge duration, have %s", limit, have.MergeDuration)
+		}
+		have.PlanDuration, have.ReadDuration, have.MergeDuration = 0, 0, 0
+		// Even for a page of 4, each node scans all of its 5 records, to
+		// know whether there are more. Record C is on both nodes.
+		want := QueryStats{SegmentsConsidered: 2, RecordsScanned: 10, RecordsMatched: 10, RecordsDeduplicated: 1, BytesRead: int64(10 * len(recordA))}
+		if want != have {
+			t.Errorf("limit %d: want %+v, have %+v", limit, want, have)
+		}
+		if limit == 0 {
+			if want, have := 9, strings.Count(string(page), "\n"); want != have {
+				t.Errorf("want %d records, have %d", want, have)
+			}
+		}
+	}
+}
+
+func TestAPIUserQuerySample(t *testing.T) {
+	t.Parallel()
+
+	// Two store nodes with the same records, which they sample alike, so
+	// each sampled record is returned once.
+	var (
+		records  = sampleRecords(1000)
+		segment  = string(bytes.Join(records, nil))
+		all      = func([]byte) bool { return true }
+		pass     = recordFilterSample(0.1, all)
+		want     string
+		addrs    []string
+		from, to = records[0][:ulid.EncodedSize], records[len(records)-1][:ulid.EncodedSize]
+	)
+	for _, record := range records {
+		if pass(record) {
+			want += string(record)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(segment)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+		addrs = append(addrs, strings.TrimPrefix(server.URL, "http://"))
+	}
+	front, server := newStreamFixture(t, staticPeer(addrs))
+	defer server.Close()
+	defer front.Close()
+
+	resp, err := http.Get(fmt.Sprintf("%s/store%s?from=%s&to=%s&sample=0.1", server.URL, APIPathUserQuery, from, to))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var qr QueryResult
+	if err := qr.DecodeFrom(resp); err != nil {
+		t.Fatal(err)
+	}
+	page, _ := ioutil.ReadAll(qr.Records)
+	qr.Records.Close()
+	if want, have := want, string(page); want != have {
+		t.Errorf("want %d records, have %d", strings.Count(want, "\n"), strings.Count(have, "\n"))
+	}
+	if want, have := 0.1, qr.Params.Sample; want != have {
+		t.Errorf("sample: want %v, have %v", want, have)
+	}
+	if want, have := int64(10*strings.Count(want, "\n")), qr.Stats.RecordsEstimated; want != have {
+		t.Errorf("estimate: want %d, have %d", want, have)
+	}
+
+	resp, err = http.Get(fmt.Sprintf("%s/store%s?from=%s&to=%s&sample=2", server.URL, APIPathUserQuery, from, to))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want, have := http.StatusBadRequest, resp.StatusCode; want != have {
+		t.Errorf("sample=2: want HTTP %d, have %d", want, have)
+	}
+}
+
+func TestAPIQueryBadPagination(t *testing.T) {
+	t.Parallel()
+
+	a, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer a.Close()
+
+	for _, params := range []string{"limit=-1", "limit=x", "continue=nope", "direction=up"} {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("GET", APIPathInternalQuery+"?from=01BB6RQR190000000000000000&to=01BB6RXQ090000000000000000&"+params, nil))
+		if want, have := http.StatusBadRequest, w.Code; want != have {
+			t.Errorf("%s: want HTTP %d, have %d", params, want, have)
+		}
+	}
+}
+
 var (
 	recordA  = "01BB6RQR190000000000000000 A 2017-03-14T16:59:40.585457189+01:00\n"
 	recordB  = "01BB6RRTB70000000000000000 B 2017-03-14T17:00:15.719316824+01:00\n"
@@ -97,8 +665,77 @@ var (
 		recordD + recordE + recordF, // second segment
 		recordG + recordH + recordI, // third segment
 	}
+	origins = [][]string{
+		{"env=prod"},                          // first segment
+		{"env=prod", "env=staging,region=eu"}, // second segment
+		nil,                                   // third segment
+	}
 )
 
+func TestAPIDrain(t *testing.T) {
+	t.Parallel()
+
+	// Three segments: A-C, D-F, and G-I.
+	a, err := newFixtureAPI(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	// Hold a query in flight, across the drain.
+	blocking := &blockingLog{Log: a.log, started: make(chan struct{}), release: make(chan struct{})}
+	a.log = blocking
+	query := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("GET", APIPathInternalQuery+"?from=01BB6RQR190000000000000000&to=01BB6RXQ090000000000000000", nil))
+		query <- w
+	}()
+	<-blocking.started
+	a.Drain()
+
+	// New replication is refused, in a way that invites retrying elsewhere.
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(segments[0])))
+	if want, have := http.StatusServiceUnavailable, w.Code; want != have {
+		t.Errorf("replicate: want HTTP %d, have %d", want, have)
+	}
+	if want, have := "5", w.Header().Get("Retry-After"); want != have {
+		t.Errorf("replicate: want Retry-After %q, have %q", want, have)
+	}
+
+	// The drain waits for the query.
+	if err := a.Wait(10 * time.Millisecond); err == nil {
+		t.Errorf("Wait: want error with a query in flight, have none")
+	}
+	close(blocking.release)
+	if err := a.Wait(time.Second); err != nil {
+		t.Errorf("Wait: %v", err)
+	}
+
+	// And the query completes successfully.
+	w = <-query
+	if want, have := http.StatusOK, w.Code; want != have {
+		t.Fatalf("query: want HTTP %d, have %d: %s", want, have, strings.TrimSpace(w.Body.String()))
+	}
+	if want, have := strings.Join(segments, ""), w.Body.String(); want != have {
+		t.Errorf("query: want %q, have %q", want, have)
+	}
+}
+
+// blockingLog signals started, and waits for release, before a single query.
+type blockingLog struct {
+	Log
+	started chan struct{}
+	release chan struct{}
+}
+
+func (l *blockingLog) Query(ctx context.Context, qp QueryParams, statsOnly bool) (QueryResult, error) {
+	close(l.started)
+	<-l.release
+	return l.Log.Query(ctx, qp, statsOnly)
+}
+
 func newFixtureAPI(t *testing.T) (*API, error) {
 	// Loggers.
 	var (
@@ -109,7 +746,7 @@ func newFixtureAPI(t *testing.T) (*API, error) {
 
 	// Construct a virtual file log.
 	filesys := fs.NewVirtualFilesystem()
-	filelog, err := NewFileLog(filesys, "/", 10240, 1024, logReporter)
+	filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{Reporter: logReporter})
 	if err != nil {
 		return nil, err
 	}
@@ -122,13 +759,23 @@ func newFixtureAPI(t *testing.T) (*API, error) {
 		replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
 		replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
 		duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
-		a                  = NewAPI(peer, filelog, queryClient, streamClient, replicatedSegments, replicatedBytes, duration, apiReporter)
+		a                  = NewAPI(peer, filelog, APIConfig{
+			QueryClient:        queryClient,
+			StreamClient:       streamClient,
+			ReplicatedSegments: replicatedSegments,
+			ReplicatedBytes:    replicatedBytes,
+			Duration:           duration,
+			Reporter:           apiReporter,
+		})
 	)
 
 	// Populate the store via the replicate API.
 	for i, segment := range segments {
 		w := httptest.NewRecorder()
 		r := httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(segment))
+		for _, origin := range origins[i] {
+			r.Header.Add(httpHeaderOrigins, origin)
+		}
 		a.ServeHTTP(w, r)
 		if w.Code != http.StatusOK {
 			a.Close()
@@ -148,9 +795,1037 @@ func newFixtureAPI(t *testing.T) (*API, error) {
 
 type mockClusterPeer struct{}
 
-func (mockClusterPeer) Current(cluster.PeerType) []string { return []string{} }
-func (mockClusterPeer) State() map[string]interface{}     { return map[string]interface{}{} }
+func (mockClusterPeer) Current(cluster.PeerType) []string        { return []string{} }
+func (mockClusterPeer) Zones(cluster.PeerType) map[string]string { return map[string]string{} }
+func (mockClusterPeer) State() map[string]interface{}            { return map[string]interface{}{} }
 
 type mockDoer struct{}
 
 func (mockDoer) Do(*http.Request) (*http.Response, error) { return nil, errors.New("not implemented") }
+
+func TestWriteStreamHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	var (
+		w       = httptest.NewRecorder()
+		records = make(chan []byte)
+		done    = make(chan struct{})
+	)
+	go func() {
+		writeStream(w, w, records, []byte{'\n'}, nil, 5*time.Millisecond)
+		close(done)
+	}()
+
+	records <- []byte(strings.TrimSpace(recordA))
+	time.Sleep(50 * time.Millisecond) // plenty of heartbeats
+	records <- []byte(strings.TrimSpace(recordB))
+	close(records)
+	<-done
+
+	body := w.Body.String()
+	if !strings.HasPrefix(body, recordA+"\n") {
+		t.Fatalf("want record A followed by heartbeats, have %q", body)
+	}
+	if !strings.HasSuffix(body, "\n"+recordB) {
+		t.Fatalf("want heartbeats followed by record B, have %q", body)
+	}
+	var nonempty []string
+	for _, line := range strings.Split(body, "\n") {
+		if line != "" {
+			nonempty = append(nonempty, line+"\n")
+		}
+	}
+	if want, have := recordA+recordB, strings.Join(nonempty, ""); want != have {
+		t.Errorf("want only records and heartbeats, have %q", body)
+	}
+}
+
+func TestWriteStreamPeerErrors(t *testing.T) {
+	t.Parallel()
+
+	var (
+		w       = httptest.NewRecorder()
+		records = make(chan []byte)
+		errs    = make(chan stream.PeerError)
+		done    = make(chan struct{})
+	)
+	go func() {
+		writeStream(w, w, records, []byte{'\n'}, errs, time.Hour)
+		close(done)
+	}()
+
+	errs <- stream.PeerError{
+		Addr: "1.2.3.4:7650",
+		Err:  errors.New("connection refused"),
+		Time: time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	records <- []byte(strings.TrimSpace(recordA))
+	close(records)
+	<-done
+
+	want := "# 2017-01-02T03:04:05Z peer error: 1.2.3.4:7650: connection refused\n" + recordA
+	if have := w.Body.String(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestAPIUserStreamRegexPushdown(t *testing.T) {
+	t.Parallel()
+
+	// Two store nodes holding replicas of the same data.
+	var backends []*API
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		backends = append(backends, a)
+		addrs = append(addrs, strings.TrimPrefix(server.URL, "http://"))
+	}
+
+	// The node serving the user's streaming query fans out to both.
+	front, server := newStreamFixture(t, staticPeer(addrs))
+	defer server.Close()
+	defer front.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest("GET", server.URL+"/store"+APIPathUserStream+"?regex=true&window=100ms&q="+url.QueryEscape("^(A|C) "), nil)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// Wait for the internal streams to be established, then write records.
+	for _, a := range backends {
+		waitForStreamQueries(t, a, 1)
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(segments[0]+segments[1])))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	// Only the matching records arrive, and only once.
+	var (
+		lines = make(chan string)
+		have  []string
+	)
+	go func() {
+		s := bufio.NewScanner(resp.Body)
+		for s.Scan() {
+			if s.Text() != "" { // skip heartbeats
+				lines <- s.Text() + "\n"
+			}
+		}
+		close(lines)
+	}()
+	timeout := time.After(time.Second)
+	for len(have) < 2 {
+		select {
+		case line := <-lines:
+			have = append(have, line)
+		case <-timeout:
+			t.Fatalf("timeout waiting for records; have %q", have)
+		}
+	}
+	select {
+	case line := <-lines:
+		t.Errorf("unexpected record %q", line)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if want, have := recordA+recordC, strings.Join(have, ""); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestAPIUserStreamPeerPorts(t *testing.T) {
+	t.Parallel()
+
+	// Store nodes advertising their APIs on ports of their own, none of
+	// them the default, and one advertising a port it doesn't listen on.
+	var backends []*API
+	var addrs []string
+	for i := 0; i < 3; i++ {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		backends = append(backends, a)
+		addrs = append(addrs, strings.TrimPrefix(server.URL, "http://"))
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := ln.Addr().String()
+	ln.Close()
+
+	front, server := newStreamFixture(t, staticPeer(append(addrs, unreachable)))
+	defer server.Close()
+	defer front.Close()
+	events := &eventRecorder{}
+	front.reporter = events
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest("GET", server.URL+"/store"+APIPathUserStream+"?window=100ms", nil)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// Each reachable node streams its own record.
+	for i, a := range backends {
+		waitForStreamQueries(t, a, 1)
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader([]string{recordA, recordB, recordC}[i])))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+	}
+	var (
+		lines = make(chan string)
+		have  []string
+	)
+	go func() {
+		s := bufio.NewScanner(resp.Body)
+		for s.Scan() {
+			if s.Text() != "" { // skip heartbeats
+				lines <- s.Text() + "\n"
+			}
+		}
+		close(lines)
+	}()
+	timeout := time.After(time.Second)
+	for len(have) < 3 {
+		select {
+		case line := <-lines:
+			have = append(have, line)
+		case <-timeout:
+			t.Fatalf("timeout waiting for records; have %q", have)
+		}
+	}
+	sort.Strings(have)
+	if want, have := recordA+recordB+recordC, strings.Join(have, ""); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	// The unreachable node is reported, once.
+	var reported []Event
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		events.mtx.Lock()
+		reported = append(reported[:0], events.events...)
+		events.mtx.Unlock()
+		if len(reported) > 0 {
+			break
+		}
+	}
+	time.Sleep(200 * time.Millisecond) // for the retries, which aren't reported
+	events.mtx.Lock()
+	reported = append(reported[:0], events.events...)
+	events.mtx.Unlock()
+	if want, have := 1, len(reported); want != have {
+		t.Fatalf("want %d reported event, have %d: %v", want, have, reported)
+	}
+	if want, have := unreachable, reported[0].Msg; !strings.Contains(have, want) {
+		t.Errorf("want %q in %q", want, have)
+	}
+}
+
+func TestAPIUserStreamBadRegex(t *testing.T) {
+	t.Parallel()
+
+	a, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer a.Close()
+
+	for _, path := range []string{APIPathUserStream, APIPathInternalStream} {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("GET", path+"?regex=true&q="+url.QueryEscape("(unclosed"), nil))
+		if want, have := http.StatusBadRequest, w.Code; want != have {
+			t.Errorf("%s: want HTTP %d, have %d", path, want, have)
+		}
+		if want, have := "compiling regex", w.Body.String(); !strings.Contains(have, want) {
+			t.Errorf("%s: want %q in body, have %q", path, want, have)
+		}
+	}
+}
+
+func TestAPIUserStreamResume(t *testing.T) {
+	t.Parallel()
+
+	// Recent records, so they're within the replay overlap.
+	var records []string
+	for i, t0 := 0, time.Now().Add(-time.Second); i < 5; i++ {
+		id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Millisecond)), nil)
+		records = append(records, fmt.Sprintf("%s R%d\n", id, i))
+	}
+
+	// Two store nodes holding replicas of the same data.
+	var backends []*API
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		backends = append(backends, a)
+		addrs = append(addrs, strings.TrimPrefix(server.URL, "http://"))
+	}
+	replicate := func(records ...string) {
+		for _, a := range backends {
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(strings.Join(records, ""))))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+			}
+		}
+	}
+	front, server := newStreamFixture(t, staticPeer(addrs))
+	defer server.Close()
+	defer front.Close()
+
+	// attach a reader resuming after the since record, read n records, and
+	// verify that nothing else arrives before detaching.
+	attach := func(since string, n int, during func()) []string {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		id := since[:ulid.EncodedSize]
+		req, _ := http.NewRequest("GET", server.URL+"/store"+APIPathUserStream+"?window=100ms&since="+id, nil)
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		lines := make(chan string)
+		go func() {
+			s := bufio.NewScanner(resp.Body)
+			for s.Scan() {
+				if s.Text() != "" { // skip heartbeats
+					lines <- s.Text() + "\n"
+				}
+			}
+			close(lines)
+		}()
+		for _, a := range backends {
+			waitForStreamQueries(t, a, 1)
+		}
+		during()
+
+		var have []string
+		timeout := time.After(time.Second)
+		for len(have) < n {
+			select {
+			case line := <-lines:
+				have = append(have, line)
+			case <-timeout:
+				t.Fatalf("timeout waiting for records; have %q", have)
+			}
+		}
+		select {
+		case line := <-lines:
+			t.Errorf("unexpected record %q", line)
+		case <-time.After(300 * time.Millisecond):
+		}
+		return have
+	}
+
+	// The first reader resumes after R0, so it gets the rest of the replay.
+	// Then it goes away.
+	replicate(records[:3]...)
+	have := attach(records[0], 2, func() {})
+	if want, have := records[1]+records[2], strings.Join(have, ""); want != have {
+		t.Fatalf("first reader: want %q, have %q", want, have)
+	}
+
+	// R3 is written while no reader is attached. The second reader resumes
+	// from the last record it saw, and gets R3 from the replay, and R4 live.
+	replicate(records[3])
+	have = attach(have[len(have)-1], 2, func() { replicate(records[4]) })
+	if want, have := records[3]+records[4], strings.Join(have, ""); want != have {
+		t.Errorf("second reader: want %q, have %q", want, have)
+	}
+}
+
+func TestAPIStreamBadSince(t *testing.T) {
+	t.Parallel()
+
+	a, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer a.Close()
+
+	for _, path := range []string{APIPathUserStream, APIPathInternalStream} {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("GET", path+"?since=nope", nil))
+		if want, have := http.StatusBadRequest, w.Code; want != have {
+			t.Errorf("%s: want HTTP %d, have %d", path, want, have)
+		}
+	}
+}
+
+func TestAPIInternalStreamTopics(t *testing.T) {
+	t.Parallel()
+
+	a, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer a.Close()
+
+	// Stream two topics concurrently.
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		topics      = []string{"topic_A", record.DefaultTopic}
+		lines       = map[string]chan string{}
+	)
+	defer cancel()
+	for _, topic := range topics {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("%s/store%s?topic=%s", server.URL, APIPathInternalStream, topic), nil)
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		c := make(chan string, 16)
+		lines[topic] = c
+		go func(body io.Reader) {
+			s := bufio.NewScanner(body)
+			for s.Scan() {
+				if s.Text() != "" { // skip heartbeats
+					c <- s.Text() + "\n"
+				}
+			}
+		}(resp.Body)
+	}
+	waitForStreamQueries(t, a, len(topics))
+
+	var (
+		recordA1 = "01BB6RQR190000000000000000 topic_A one\n"
+		recordB1 = "01BB6RRTB70000000000000000 topic_B one\n"
+		recordX1 = "01BB6RT5GS0000000000000000 no-topic~ one\n"
+		recordA2 = "01BB6RV5R00000000000000000 topic_A two\n"
+		recordD1 = "01BB6RVR490000000000000000 default one\n"
+	)
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(recordA1+recordB1+recordX1+recordA2+recordD1)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+	}
+
+	for topic, want := range map[string]string{
+		"topic_A":           recordA1 + recordA2,
+		record.DefaultTopic: recordX1 + recordD1,
+	} {
+		var have []string
+		timeout := time.After(time.Second)
+		for len(have) < 2 {
+			select {
+			case line := <-lines[topic]:
+				have = append(have, line)
+			case <-timeout:
+				t.Fatalf("%s: timeout waiting for records; have %q", topic, have)
+			}
+		}
+		select {
+		case line := <-lines[topic]:
+			t.Errorf("%s: unexpected record %q", topic, line)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if have := strings.Join(have, ""); want != have {
+			t.Errorf("%s: want %q, have %q", topic, want, have)
+		}
+	}
+
+	// The same topic filter applies to queries.
+	w = httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest("GET", APIPathInternalQuery+"?from=01BB6RQR190000000000000000&to=01BB6RVR490000000000000000&topic=topic_B", nil))
+	if want, have := recordB1, w.Body.String(); want != have {
+		t.Errorf("query: want %q, have %q", want, have)
+	}
+	if want, have := "topic_B", w.Header().Get(httpHeaderTopic); want != have {
+		t.Errorf("query: want topic header %q, have %q", want, have)
+	}
+}
+
+func TestAPIBadTopic(t *testing.T) {
+	t.Parallel()
+
+	a, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer a.Close()
+
+	for _, path := range []string{APIPathInternalQuery, APIPathUserStream, APIPathInternalStream} {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("GET", path+"?topic=to~pic", nil))
+		if want, have := http.StatusBadRequest, w.Code; want != have {
+			t.Errorf("%s: want HTTP %d, have %d", path, want, have)
+		}
+	}
+}
+
+func TestAPIBadLabel(t *testing.T) {
+	t.Parallel()
+
+	a, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer a.Close()
+
+	for _, label := range []string{"env", "env=staging", "env:", "env:stag/ing"} {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("GET", APIPathInternalQuery+"?label="+url.QueryEscape(label), nil))
+		if want, have := http.StatusBadRequest, w.Code; want != have {
+			t.Errorf("%q: want HTTP %d, have %d", label, want, have)
+		}
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		header, coding string
+		want           bool
+	}{
+		{"", "gzip", false},
+		{"gzip", "gzip", true},
+		{"deflate, gzip;q=1.0", "gzip", true},
+		{"gzip;q=0", "gzip", false},
+		{"gzip; q=0.5, snappy", "gzip", true},
+		{"gzip; q=0.5, snappy", "snappy", true},
+		{"snappy;q=0, gzip", "snappy", false},
+		{"x-gzip", "gzip", false},
+	} {
+		if want, have := testcase.want, acceptsEncoding(testcase.header, testcase.coding); want != have {
+			t.Errorf("%q, %s: want %v, have %v", testcase.header, testcase.coding, want, have)
+		}
+	}
+}
+
+func TestAPIInternalStreamCompression(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name   string
+		accept string // instead of what the factory asks for, if not empty
+		want   string
+	}{
+		{"snappy", "", "snappy"},
+		{"gzip", "gzip", "gzip"},
+		{"identity", "identity", ""},
+	} {
+		testcase := testcase
+		t.Run(testcase.name, func(t *testing.T) {
+			t.Parallel()
+			testAPIInternalStreamCompression(t, testcase.accept, testcase.want)
+		})
+	}
+}
+
+func testAPIInternalStreamCompression(t *testing.T, accept, want string) {
+	a, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer a.Close()
+	a.streamHeartbeat = 10 * time.Millisecond
+
+	// The transport doesn't decompress anything itself, so it's the
+	// factory that does.
+	var (
+		transport = &http.Transport{DisableCompression: true}
+		encodings = make(chan string, 1)
+		client    = doerFunc(func(req *http.Request) (*http.Response, error) {
+			if accept != "" {
+				req.Header.Set("Accept-Encoding", accept)
+			}
+			resp, err := (&http.Client{Transport: transport}).Do(req)
+			if err == nil {
+				encodings <- resp.Header.Get("Content-Encoding")
+			}
+			return resp, err
+		})
+		rcf = stream.HTTPReadCloserFactory(client, func(addr string) string {
+			return fmt.Sprintf("%s/store%s?q=", server.URL, APIPathInternalStream)
+		})
+	)
+	defer transport.CloseIdleConnections()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rc, err := rcf(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if have := <-encodings; want != have {
+		t.Errorf("Content-Encoding: want %q, have %q", want, have)
+	}
+
+	lines := make(chan string)
+	go func() {
+		s := bufio.NewScanner(rc)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+		close(lines)
+	}()
+
+	// Heartbeats make it through the compressor.
+	select {
+	case line := <-lines:
+		if line != "" {
+			t.Fatalf("want heartbeat, have %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for heartbeat")
+	}
+
+	// So do records, without waiting for the compressor to fill up.
+	waitForStreamQueries(t, a, 1)
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(recordA+recordB)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+	}
+	var have []string
+	timeout := time.After(time.Second)
+	for len(have) < 2 {
+		select {
+		case line := <-lines:
+			if line != "" {
+				have = append(have, line+"\n")
+			}
+		case <-timeout:
+			t.Fatalf("timeout waiting for records; have %q", have)
+		}
+	}
+	if want, have := recordA+recordB, strings.Join(have, ""); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func BenchmarkWriteStream(b *testing.B) {
+	for _, encoding := range []string{"identity", "gzip", "snappy"} {
+		b.Run(encoding, func(b *testing.B) {
+			var (
+				rawBytes  int64
+				wireBytes int64
+			)
+			for i := 0; i < b.N; i++ {
+				var (
+					w       = httptest.NewRecorder()
+					r       = httptest.NewRequest("GET", APIPathInternalStream, nil)
+					records = make(chan []byte, 1024)
+				)
+				r.Header.Set("Accept-Encoding", encoding)
+				for j := 0; j < cap(records); j++ {
+					record := []byte(segments[j%len(segments)])
+					rawBytes += int64(len(record))
+					records <- record
+				}
+				close(records)
+				cw, flusher, finish := compressStream(w, r, w)
+				writeStream(cw, flusher, records, nil, nil, time.Hour)
+				finish()
+				wireBytes += int64(w.Body.Len())
+			}
+			b.SetBytes(rawBytes / int64(b.N))
+			b.Logf("%d raw bytes, %d bytes on the wire (%.1f%%)", rawBytes, wireBytes, 100*float64(wireBytes)/float64(rawBytes))
+		})
+	}
+}
+
+type doerFunc func(*http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) { return f(req) }
+
+// newStreamFixture returns an empty API served by a real HTTP server, so
+// that other nodes can stream from it.
+func newStreamFixture(t *testing.T, peer ClusterPeer) (*API, *httptest.Server) {
+	filelog, err := NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, FileLogConfig{Reporter: LogReporter{log.NewNopLogger()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+		replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
+		duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+		mux                = http.NewServeMux()
+		a                  = NewAPI(peer, filelog, APIConfig{
+			QueryClient:        http.DefaultClient,
+			StreamClient:       http.DefaultClient,
+			ReplicatedSegments: replicatedSegments,
+			ReplicatedBytes:    replicatedBytes,
+			Duration:           duration,
+			Reporter:           LogReporter{log.NewNopLogger()},
+		})
+	)
+	mux.Handle("/store/", http.StripPrefix("/store", a))
+	return a, httptest.NewServer(mux)
+}
+
+func waitForStreamQueries(t *testing.T, a *API, n int) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		a.streamQueries.mtx.RLock()
+		have := len(a.streamQueries.reg)
+		a.streamQueries.mtx.RUnlock()
+		if have >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %d streaming queries; have %d", n, have)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// staticPeer is a cluster of nodes of every type, except read-only store.
+type staticPeer []string
+
+func (p staticPeer) Current(t cluster.PeerType) []string {
+	if t == cluster.PeerTypeReadOnlyStore {
+		return nil
+	}
+	return p
+}
+func (staticPeer) Zones(cluster.PeerType) map[string]string { return map[string]string{} }
+func (staticPeer) State() map[string]interface{}            { return map[string]interface{}{} }
+
+// typedPeers is a cluster of nodes by type.
+type typedPeers map[cluster.PeerType][]string
+
+func (p typedPeers) Current(t cluster.PeerType) []string    { return p[t] }
+func (typedPeers) Zones(cluster.PeerType) map[string]string { return map[string]string{} }
+func (typedPeers) State() map[string]interface{}            { return map[string]interface{}{} }
+
+func TestAPIQueryPeers(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name  string
+		peers typedPeers
+		want  []string
+	}{
+		{
+			name:  "store",
+			peers: typedPeers{cluster.PeerTypeStore: {"store1", "store2"}},
+			want:  []string{"store1", "store2"},
+		},
+		{
+			name:  "read-only preferred",
+			peers: typedPeers{cluster.PeerTypeStore: {"store1", "store2"}, cluster.PeerTypeReadOnlyStore: {"replica1"}},
+			want:  []string{"replica1"},
+		},
+		{
+			name:  "no read-only left",
+			peers: typedPeers{cluster.PeerTypeStore: {"store1"}, cluster.PeerTypeReadOnlyStore: {}},
+			want:  []string{"store1"},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			a := NewAPI(testcase.peers, nil, APIConfig{
+				QueryClient:        mockDoer{},
+				StreamClient:       mockDoer{},
+				ReplicatedSegments: prometheus.NewCounter(prometheus.CounterOpts{}),
+				ReplicatedBytes:    prometheus.NewCounter(prometheus.CounterOpts{}),
+			})
+			defer a.Close()
+			if want, have := testcase.want, a.queryPeers(); !reflect.DeepEqual(want, have) {
+				t.Errorf("want %v, have %v", want, have)
+			}
+		})
+	}
+}
+
+func TestUserQueryJSON(t *testing.T) {
+	t.Parallel()
+
+	peers := make(staticPeer, 1)
+	a, server := newStreamFixture(t, peers)
+	defer server.Close()
+	defer a.Close()
+	peers[0] = strings.TrimPrefix(server.URL, "http://")
+
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(recordA+recordB)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+	}
+
+	query := func(params string, header http.Header) (*http.Response, []byte) {
+		req, err := http.NewRequest("GET", fmt.Sprintf(
+			"%s/store%s?from=%s&to=%s%s",
+			server.URL,
+			APIPathUserQuery,
+			"01BB6RQR190000000000000000", // A
+			"01BB6RRTB70000000000000000", // B
+			params,
+		), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		buf, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: HTTP %d: %s", params, resp.StatusCode, buf)
+		}
+		return resp, buf
+	}
+
+	// Records, by parameter or by Accept header.
+	want := "" +
+		`{"ulid":"01BB6RQR190000000000000000","time":"2017-03-14T15:59:40.585Z","topic":"A","record":"A 2017-03-14T16:59:40.585457189+01:00"}` + "\n" +
+		`{"ulid":"01BB6RRTB70000000000000000","time":"2017-03-14T16:00:15.719Z","topic":"B","record":"B 2017-03-14T17:00:15.719316824+01:00"}` + "\n"
+	for _, testcase := range []struct {
+		params string
+		header http.Header
+	}{
+		{params: "&format=json"},
+		{header: http.Header{"Accept": {"application/x-ndjson"}}},
+	} {
+		resp, buf := query(testcase.params, testcase.header)
+		if want, have := "application/x-ndjson; charset=utf-8", resp.Header.Get("Content-Type"); want != have {
+			t.Errorf("%s %v: Content-Type: want %q, have %q", testcase.params, testcase.header, want, have)
+		}
+		if have := string(buf); want != have {
+			t.Errorf("%s %v: want %s, have %s", testcase.params, testcase.header, want, have)
+		}
+	}
+
+	// Statistics.
+	_, buf := query("&format=json&stats", nil)
+	var stats map[string]interface{}
+	if err := json.Unmarshal(buf, &stats); err != nil {
+		t.Fatalf("%v: %s", err, buf)
+	}
+	if want, have := 1.0, stats["nodes_queried"]; want != have {
+		t.Errorf("nodes_queried: want %v, have %v", want, have)
+	}
+	if want, have := 1.0, stats["segments_queried"]; want != have {
+		t.Errorf("segments_queried: want %v, have %v", want, have)
+	}
+	if _, ok := stats["query"].(map[string]interface{}); !ok {
+		t.Errorf("query: want object, have %v", stats["query"])
+	}
+}
+
+func TestAPIUserQueryCancel(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name   string
+		params string
+	}{
+		// A query that matches nothing reads every block of the segment,
+		// without writing anything, so only the context stops it, once the
+		// client's gone.
+		{"no matches", "&q=" + url.QueryEscape("^$") + "&regex=true"},
+
+		// A download that isn't read stops, too, as it can't be written.
+		{"download", "&download=gzip"},
+	} {
+		testcase := testcase
+		t.Run(testcase.name, func(t *testing.T) {
+			t.Parallel()
+			testUserQueryCancel(t, testcase.params)
+		})
+	}
+}
+
+func testUserQueryCancel(t *testing.T, params string) {
+	filesys, filelog := newSlowQueryFixture(t, 20000)
+	defer filelog.Close()
+
+	var (
+		mux    = http.NewServeMux()
+		server = httptest.NewServer(mux)
+		a      = NewAPI(staticPeer{strings.TrimPrefix(server.URL, "http://")}, filelog, APIConfig{
+			QueryClient:        http.DefaultClient,
+			StreamClient:       http.DefaultClient,
+			ReplicatedSegments: prometheus.NewCounter(prometheus.CounterOpts{}),
+			ReplicatedBytes:    prometheus.NewCounter(prometheus.CounterOpts{}),
+			Duration:           prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"}),
+			Reporter:           &eventRecorder{},
+		})
+	)
+	defer server.Close()
+	defer a.Close()
+	mux.Handle("/store/", http.StripPrefix("/store", a))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/store%s?from=%s&to=%s%s",
+		server.URL, APIPathUserQuery, ulid.ULID{}, ulid.MustNew(ulid.Now(), nil), params,
+	), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if resp, err := http.DefaultClient.Do(req.WithContext(ctx)); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	// Disconnect mid-scan.
+	for deadline := time.Now().Add(5 * time.Second); filesys.readCount() < 20; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the query never started reading: %d reads", filesys.readCount())
+		}
+	}
+	cancel()
+	<-done
+	canceled := filesys.readCount()
+
+	// Reads stop soon after, well before the end of the segment.
+	var stopped int64
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		prev := filesys.readCount()
+		time.Sleep(50 * time.Millisecond)
+		if stopped = filesys.readCount(); stopped == prev {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("reads didn't stop: %d reads", stopped)
+		}
+	}
+	if want, have := int64(64), stopped-canceled; have > want {
+		t.Errorf("want at most %d reads after the client went away, have %d", want, have)
+	}
+	if blocks := filesys.blocks(); stopped >= blocks {
+		t.Errorf("read all %d blocks of the segment", blocks)
+	}
+}
+
+func TestAPIQueryMaxDuration(t *testing.T) {
+	t.Parallel()
+
+	// Queries that take too long are cut short, and return what they have,
+	// marked partial.
+	_, filelog := newSlowQueryFixture(t, 20000)
+	defer filelog.Close()
+
+	reporter := &eventRecorder{}
+	a := NewAPI(mockClusterPeer{}, filelog, APIConfig{
+		QueryClient:        mockDoer{},
+		StreamClient:       mockDoer{},
+		ReplicatedSegments: prometheus.NewCounter(prometheus.CounterOpts{}),
+		ReplicatedBytes:    prometheus.NewCounter(prometheus.CounterOpts{}),
+		Duration:           prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"}),
+		Reporter:           reporter,
+		MaxQueryDuration:   50 * time.Millisecond,
+	})
+	defer a.Close()
+	server := httptest.NewServer(a)
+	defer server.Close()
+
+	begin := time.Now()
+	resp, err := http.Get(fmt.Sprintf("%s%s?from=%s&to=%s", server.URL, APIPathInternalQuery, ulid.ULID{}, ulid.MustNew(ulid.Now(), nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result QueryResult
+	if err := result.DecodeFrom(resp); err != nil {
+		t.Fatal(err)
+	}
+	records, err := ioutil.ReadAll(result.Records)
+	result.Records.Close()
+	if err == nil || !strings.Contains(err.Error(), "partial") {
+		t.Errorf("want partial results, have error %v", err)
+	}
+	if n := bytes.Count(records, []byte{'\n'}); n >= 20000 {
+		t.Errorf("want some of the records, have all %d", n)
+	}
+	if took := time.Since(begin); took > 2*time.Second {
+		t.Errorf("query took %s", took)
+	}
+	var warned bool
+	for _, e := range reporter.events {
+		warned = warned || (e.Op == "handleInternalQuery" && e.Warning != nil)
+	}
+	if !warned {
+		t.Errorf("partial results weren't reported: %+v", reporter.events)
+	}
+}
+
+// newSlowQueryFixture returns a file log with a segment of n records, which is
+// read a block at a time, each read slow and counted.
+func newSlowQueryFixture(t *testing.T, n int) (*slowFilesystem, Log) {
+	filesys := &slowFilesystem{Filesystem: fs.NewVirtualFilesystem(), delay: time.Millisecond}
+	filelog, err := NewFileLog(filesys, "/", 1<<30, 1024, FileLogConfig{
+		QueryConcurrency: 1,
+		Reporter:         &eventRecorder{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	segment, err := filelog.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		t0          = time.Now().Add(-time.Hour)
+		first, last ulid.ULID
+	)
+	for i := 0; i < n; i++ {
+		id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Millisecond)), nil)
+		if i == 0 {
+			first = id
+		}
+		last = id
+		fmt.Fprintf(segment, "%s record %d of the slow segment\n", id, i)
+	}
+	if err := segment.Close(first, last); err != nil {
+		t.Fatal(err)
+	}
+	filesys.Walk("/", func(path string, info os.FileInfo, err error) error {
+		if filepath.Ext(path) == extFlushed {
+			filesys.size = info.Size()
+		}
+		return nil
+	})
+	return filesys, filelog
+}
+
+// slowFilesystem counts the reads of its files, each of at most a block, and
+// taking delay.
+type slowFilesystem struct {
+	fs.Filesystem
+	delay time.Duration
+	size  int64 // of the segment
+	reads int64 // atomic
+}
+
+func (f *slowFilesystem) Open(path string) (fs.File, error) {
+	file, err := f.Filesystem.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return slowFile{file, f}, nil
+}
+
+func (f *slowFilesystem) readCount() int64 { return atomic.LoadInt64(&f.reads) }
+
+// blocks is how many reads it takes to read the segment.
+func (f *slowFilesystem) blocks() int64 { return (f.size + slowBlockSize - 1) / slowBlockSize }
+
+const slowBlockSize = 4096
+
+type slowFile struct {
+	fs.File
+	fs *slowFilesystem
+}
+
+func (f slowFile) Read(p []byte) (int, error) {
+	if len(p) > slowBlockSize {
+		p = p[:slowBlockSize]
+	}
+	atomic.AddInt64(&f.fs.reads, 1)
+	time.Sleep(f.fs.delay)
+	return f.File.Read(p)
+}
@@ -0,0 +1,333 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// AuditSink records the user queries served by the API. Audit is called once
+// per query, when it's done: a bounded query once its response is written,
+// or it fails, and a streaming query once it ends. It's called concurrently.
+type AuditSink interface {
+	Audit(AuditEvent)
+}
+
+// These are the dispositions of audited queries.
+const (
+	AuditOK       = "ok"       // including streams the client hung up on
+	AuditPartial  = "partial"  // some store nodes failed
+	AuditFailed   = "failed"   // see the Error
+	AuditCanceled = "canceled" // the client hung up on a bounded query
+)
+
+// AuditEvent describes a user query. Records and Bytes count the records
+// returned, and their bytes, before any compression or JSON encoding.
+type AuditEvent struct {
+	Time        time.Time     `json:"ts"` // when the query began
+	Path        string        `json:"path"`
+	RemoteAddr  string        `json:"remote_addr"`
+	Principal   string        `json:"principal,omitempty"` // with token auth
+	From        string        `json:"from,omitempty"`      // RFC3339, if bounded
+	To          string        `json:"to,omitempty"`
+	Q           string        `json:"q"`
+	Regex       bool          `json:"regex"`
+	Topic       string        `json:"topic,omitempty"`
+	Records     int64         `json:"records"`
+	Bytes       int64         `json:"bytes"`
+	Duration    time.Duration `json:"duration_ns"`
+	Status      int           `json:"status"`
+	Disposition string        `json:"disposition"`
+	Error       string        `json:"error,omitempty"`
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of the context with the principal that made
+// the request, e.g. as authenticated by a token, to audit.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func principalFrom(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// queryAudit collects the AuditEvent of a user query, as it's served.
+// A nil queryAudit collects nothing, so handlers needn't check.
+type queryAudit struct {
+	event   AuditEvent
+	w       *interceptingWriter
+	records int64 // atomic
+	bytes   int64 // atomic
+	bounded bool
+	errMsg  []byte // the start of an error response
+}
+
+const auditMaxError = 256
+
+// beginAudit of the request made to w, which must be the interceptingWriter
+// of ServeHTTP, or returns nil, if there's no AuditSink, and no QueryMetrics.
+// Bounded queries are canceled if the client hangs up; streams end that way.
+// The returned writer should be served to, so error responses are captured.
+func (a *API) beginAudit(w *interceptingWriter, r *http.Request, bounded bool) (*queryAudit, http.ResponseWriter) {
+	if a.audit == nil && a.queryMetrics == nil {
+		return nil, w
+	}
+	qa := &queryAudit{
+		event: AuditEvent{
+			Time:       time.Now(),
+			Path:       r.URL.Path,
+			RemoteAddr: r.RemoteAddr,
+			Principal:  principalFrom(r.Context()),
+		},
+		w:       w,
+		bounded: bounded,
+	}
+	return qa, &auditingWriter{w, qa}
+}
+
+// params records the query's parameters, once they're parsed.
+func (qa *queryAudit) params(qp QueryParams) {
+	if qa == nil {
+		return
+	}
+	if !qp.From.Time.IsZero() || !qp.To.Time.IsZero() {
+		qa.event.From = qp.From.Time.UTC().Format(time.RFC3339Nano)
+		qa.event.To = qp.To.Time.UTC().Format(time.RFC3339Nano)
+	}
+	qa.event.Q, qa.event.Regex, qa.event.Topic = qp.Q, qp.Regex, qp.Topic
+}
+
+// add n records, of the given total size, to those returned.
+func (qa *queryAudit) add(n, size int64) {
+	if qa == nil {
+		return
+	}
+	atomic.AddInt64(&qa.records, n)
+	atomic.AddInt64(&qa.bytes, size)
+}
+
+// fail the query, even if the response status is OK, e.g. when a stream is
+// cut off.
+func (qa *queryAudit) fail(err error) {
+	if qa == nil {
+		return
+	}
+	qa.errMsg = []byte(err.Error())
+}
+
+// countRecords returns rc, adding the records read from it to the audit.
+func (qa *queryAudit) countRecords(rc io.ReadCloser) io.ReadCloser {
+	if qa == nil || rc == nil {
+		return rc
+	}
+	return &auditingReadCloser{rc, qa}
+}
+
+// end the audit, observe the query's metrics, and send the event to the
+// sink, if there is one.
+func (a *API) endAudit(qa *queryAudit, r *http.Request) {
+	if qa == nil {
+		return
+	}
+	e := qa.event
+	e.Records, e.Bytes = atomic.LoadInt64(&qa.records), atomic.LoadInt64(&qa.bytes)
+	e.Duration = time.Since(e.Time)
+	e.Status = qa.w.code
+	switch {
+	case e.Status >= 400 || qa.errMsg != nil:
+		e.Disposition = AuditFailed
+		e.Error = string(bytes.TrimSpace(qa.errMsg))
+	case qa.bounded && r.Context().Err() != nil:
+		e.Disposition = AuditCanceled
+		e.Error = r.Context().Err().Error()
+	case e.Status == http.StatusPartialContent:
+		e.Disposition = AuditPartial
+	default:
+		e.Disposition = AuditOK
+	}
+	a.queryMetrics.observe(e, qa.bounded)
+	if a.audit != nil {
+		a.audit.Audit(e)
+	}
+}
+
+// auditingWriter captures the start of error responses.
+type auditingWriter struct {
+	*interceptingWriter
+	qa *queryAudit
+}
+
+func (aw *auditingWriter) Write(p []byte) (int, error) {
+	if aw.code >= 400 && len(aw.qa.errMsg) < auditMaxError {
+		n := auditMaxError - len(aw.qa.errMsg)
+		if n > len(p) {
+			n = len(p)
+		}
+		aw.qa.errMsg = append(aw.qa.errMsg, p[:n]...)
+	}
+	return aw.interceptingWriter.Write(p)
+}
+
+// auditingReadCloser counts the records read from a query result.
+type auditingReadCloser struct {
+	io.ReadCloser
+	qa *queryAudit
+}
+
+func (rc *auditingReadCloser) Read(p []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(p)
+	rc.qa.add(int64(bytes.Count(p[:n], []byte{'\n'})), int64(n))
+	return n, err
+}
+
+// LogAuditSink logs each AuditEvent to the wrapped logger, at info level.
+type LogAuditSink struct{ log.Logger }
+
+// Audit implements AuditSink.
+func (s LogAuditSink) Audit(e AuditEvent) {
+	keyvals := []interface{}{
+		"audit", "query",
+		"path", e.Path,
+		"remote_addr", e.RemoteAddr,
+	}
+	if e.Principal != "" {
+		keyvals = append(keyvals, "principal", e.Principal)
+	}
+	if e.From != "" {
+		keyvals = append(keyvals, "from", e.From, "to", e.To)
+	}
+	keyvals = append(keyvals, "q", e.Q, "regex", e.Regex)
+	if e.Topic != "" {
+		keyvals = append(keyvals, "topic", e.Topic)
+	}
+	keyvals = append(keyvals,
+		"records", e.Records,
+		"bytes", e.Bytes,
+		"duration", e.Duration,
+		"status", e.Status,
+		"disposition", e.Disposition,
+	)
+	if e.Error != "" {
+		keyvals = append(keyvals, "error", e.Error)
+	}
+	level.Info(s.Logger).Log(keyvals...)
+}
+
+// FileAuditSink writes each AuditEvent to a file, as a line of JSON. Once the
+// file grows past maxSize, it's rotated: renamed with the suffix .1, after
+// the one before is renamed .2, and so on, up to keep old files.
+type FileAuditSink struct {
+	mtx      sync.Mutex
+	filename string
+	maxSize  int64
+	keep     int
+	f        *os.File
+	size     int64
+	reporter EventReporter
+}
+
+// NewFileAuditSink opens, or creates, the file, to append AuditEvents to.
+// Errors writing or rotating the file are reported, and the event dropped.
+func NewFileAuditSink(filename string, maxSize int64, keep int, reporter EventReporter) (*FileAuditSink, error) {
+	s := &FileAuditSink{
+		filename: filename,
+		maxSize:  maxSize,
+		keep:     keep,
+		reporter: reporter,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileAuditSink) open() error {
+	f, err := os.OpenFile(s.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, fi.Size()
+	return nil
+}
+
+// Audit implements AuditSink.
+func (s *FileAuditSink) Audit(e AuditEvent) {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		panic(err) // AuditEvent always marshals
+	}
+	buf = append(buf, '\n')
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			s.reporter.ReportEvent(Event{Op: "Audit", File: s.filename, Error: err, Msg: "dropped audit event"})
+			return
+		}
+	}
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(buf)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			s.reporter.ReportEvent(Event{Op: "Audit", File: s.filename, Error: err, Msg: "rotation failed"})
+			if s.f == nil {
+				return
+			}
+		}
+	}
+	n, err := s.f.Write(buf)
+	s.size += int64(n)
+	if err != nil {
+		s.reporter.ReportEvent(Event{Op: "Audit", File: s.filename, Error: err, Msg: "dropped audit event"})
+	}
+}
+
+// rotate must be called with the mutex held.
+func (s *FileAuditSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	s.f = nil
+	if s.keep <= 0 {
+		if err := os.Remove(s.filename); err != nil {
+			return err
+		}
+		return s.open()
+	}
+	for i := s.keep - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.filename, i), fmt.Sprintf("%s.%d", s.filename, i+1))
+	}
+	if err := os.Rename(s.filename, s.filename+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// Close the file.
+func (s *FileAuditSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
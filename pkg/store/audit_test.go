@@ -0,0 +1,235 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// captureSink is an AuditSink that sends its events down a channel.
+type captureSink chan AuditEvent
+
+func (s captureSink) Audit(e AuditEvent) { s <- e }
+
+func (s captureSink) next(t *testing.T) AuditEvent {
+	select {
+	case e := <-s:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for audit event")
+		return AuditEvent{}
+	}
+}
+
+func TestAuditUserQuery(t *testing.T) {
+	t.Parallel()
+
+	backend, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer backend.Close()
+	for _, segment := range segments {
+		w := httptest.NewRecorder()
+		backend.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(segment)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+	}
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	var (
+		addr     = strings.TrimPrefix(server.URL, "http://")
+		deadAddr = strings.TrimPrefix(dead.URL, "http://")
+		all      = strings.Join(segments, "")
+		bounds   = "from=01BB6RQR190000000000000000&to=01BB6RXQ090000000000000000"
+	)
+
+	for _, testcase := range []struct {
+		name        string
+		peers       staticPeer
+		params      string
+		principal   string
+		status      int
+		disposition string
+		records     int64
+		bytes       int64
+		err         string // substring, if any
+	}{
+		{"ok", staticPeer{addr}, bounds + "&q=A", "token:0a0b0c0d", http.StatusOK, AuditOK, 1, int64(len(recordA)), ""},
+		{"bad from", staticPeer{addr}, "from=nope", "", http.StatusBadRequest, AuditFailed, 0, 0, "nope"},
+		{"dead peer", staticPeer{addr, deadAddr}, bounds, "", http.StatusPartialContent, AuditPartial, 9, int64(len(all)), ""},
+	} {
+		front, frontServer := newStreamFixture(t, testcase.peers)
+		sink := make(captureSink, 1)
+		front.audit = sink
+
+		r := httptest.NewRequest("GET", APIPathUserQuery+"?"+testcase.params, nil)
+		if testcase.principal != "" {
+			r = r.WithContext(WithPrincipal(r.Context(), testcase.principal))
+		}
+		w := httptest.NewRecorder()
+		front.ServeHTTP(w, r)
+		e := sink.next(t)
+		frontServer.Close()
+		front.Close()
+
+		if want, have := testcase.status, w.Code; want != have {
+			t.Errorf("%s: want HTTP %d, have %d: %s", testcase.name, want, have, w.Body.String())
+		}
+		if want, have := testcase.status, e.Status; want != have {
+			t.Errorf("%s: status: want %d, have %d", testcase.name, want, have)
+		}
+		if want, have := testcase.disposition, e.Disposition; want != have {
+			t.Errorf("%s: disposition: want %q, have %q (%s)", testcase.name, want, have, e.Error)
+		}
+		if want, have := testcase.records, e.Records; want != have {
+			t.Errorf("%s: records: want %d, have %d", testcase.name, want, have)
+		}
+		if want, have := testcase.bytes, e.Bytes; want != have {
+			t.Errorf("%s: bytes: want %d, have %d", testcase.name, want, have)
+		}
+		if want, have := testcase.principal, e.Principal; want != have {
+			t.Errorf("%s: principal: want %q, have %q", testcase.name, want, have)
+		}
+		if want, have := APIPathUserQuery, e.Path; want != have {
+			t.Errorf("%s: path: want %q, have %q", testcase.name, want, have)
+		}
+		if testcase.err != "" && !strings.Contains(e.Error, testcase.err) {
+			t.Errorf("%s: want error containing %q, have %q", testcase.name, testcase.err, e.Error)
+		}
+		if testcase.err == "" && e.Error != "" {
+			t.Errorf("%s: unexpected error %q", testcase.name, e.Error)
+		}
+		if testcase.status == http.StatusOK && (e.From == "" || e.To == "" || e.Q != "A") {
+			t.Errorf("%s: want from, to and q, have %+v", testcase.name, e)
+		}
+	}
+}
+
+func TestAuditUserStream(t *testing.T) {
+	t.Parallel()
+
+	backend, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer backend.Close()
+	front, frontServer := newStreamFixture(t, staticPeer{strings.TrimPrefix(server.URL, "http://")})
+	defer frontServer.Close()
+	defer front.Close()
+	sink := make(captureSink, 1)
+	front.audit = sink
+
+	// Stream two records, then hang up, which is how streams end.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest("GET", frontServer.URL+"/store"+APIPathUserStream+"?window=10ms&q=[AC]&regex=true", nil)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	waitForStreamQueries(t, backend, 1)
+
+	w := httptest.NewRecorder()
+	backend.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(recordA+recordB+recordC)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+	}
+	var have []string
+	for s := bufio.NewScanner(resp.Body); len(have) < 2 && s.Scan(); {
+		if s.Text() != "" { // skip heartbeats
+			have = append(have, s.Text()+"\n")
+		}
+	}
+	if want, have := recordA+recordC, strings.Join(have, ""); want != have {
+		t.Fatalf("want %q, have %q", want, have)
+	}
+	select {
+	case e := <-sink:
+		t.Fatalf("audited before the stream ended: %+v", e)
+	default:
+	}
+	cancel()
+
+	e := sink.next(t)
+	if want, have := int64(2), e.Records; want != have {
+		t.Errorf("records: want %d, have %d", want, have)
+	}
+	if want, have := int64(len(recordA+recordC)), e.Bytes; want != have {
+		t.Errorf("bytes: want %d, have %d", want, have)
+	}
+	if want, have := AuditOK, e.Disposition; want != have {
+		t.Errorf("disposition: want %q, have %q (%s)", want, have, e.Error)
+	}
+	if want, have := APIPathUserStream, e.Path; want != have {
+		t.Errorf("path: want %q, have %q", want, have)
+	}
+	if e.Q != "[AC]" || !e.Regex || e.From != "" {
+		t.Errorf("want q=[AC] regex=true and no bounds, have %+v", e)
+	}
+	if e.Duration <= 0 {
+		t.Errorf("want a duration, have %s", e.Duration)
+	}
+}
+
+func TestFileAuditSinkRotation(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "oklog-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "audit.log")
+
+	// The events are all the same size, and two fit in a file.
+	event := func(i int) AuditEvent {
+		return AuditEvent{Path: APIPathUserQuery, Q: fmt.Sprint(i), Records: int64(i), Disposition: AuditOK}
+	}
+	buf, _ := json.Marshal(event(0))
+	maxSize := 2 * int64(len(buf)+1)
+	s, err := NewFileAuditSink(filename, maxSize, 2, LogReporter{log.NewNopLogger()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 9; i++ {
+		s.Audit(event(i))
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the newest events are kept, newest last.
+	var qs []string
+	for _, name := range []string{filename + ".2", filename + ".1", filename} {
+		buf, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(buf)) > maxSize {
+			t.Errorf("%s: %d bytes, over the max size", name, len(buf))
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(buf)), "\n") {
+			var e AuditEvent
+			if err := json.Unmarshal([]byte(line), &e); err != nil {
+				t.Fatalf("%s: %q: %v", name, line, err)
+			}
+			qs = append(qs, e.Q)
+		}
+	}
+	if want, have := "4 5 6 7 8", strings.Join(qs, " "); want != have {
+		t.Errorf("want events %s, have %s", want, have)
+	}
+	if _, err := os.Stat(filename + ".3"); !os.IsNotExist(err) {
+		t.Errorf("want no more than 2 old files, have %s.3 (%v)", filename, err)
+	}
+}
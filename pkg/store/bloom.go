@@ -0,0 +1,258 @@
+package store
+
+import (
+	"io"
+	"io/ioutil"
+	"regexp/syntax"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+const (
+	// extBloom is the extension of the filter file stored alongside each
+	// segment. It shares its basename with the segment, regardless of the
+	// segment's state.
+	extBloom = ".bloom"
+
+	// Each filter records the 4-byte grams of the whitespace-delimited tokens
+	// in a segment. Any literal of at least gramSize non-whitespace bytes
+	// that occurs in a record consists of grams of one of its tokens, so a
+	// segment whose filter lacks any of those grams can't match.
+	gramSize = 4
+
+	bloomHashes  = 4
+	bloomMinBits = 1 << 10
+	bloomMaxBits = 1 << 26
+
+	// If more than half of the bits are set, the filter would match most
+	// queries anyway, and isn't worth storing.
+	bloomMaxFill = 0.5
+)
+
+// bloomFilter is a fixed-size bloom filter over grams.
+type bloomFilter struct {
+	bits []byte // length is a power of 2
+}
+
+// newBloomFilter for a segment of the given target size.
+func newBloomFilter(segmentTargetSize int64) *bloomFilter {
+	nbits := int64(bloomMinBits)
+	for nbits < segmentTargetSize/2 && nbits < bloomMaxBits {
+		nbits <<= 1
+	}
+	return &bloomFilter{bits: make([]byte, nbits/8)}
+}
+
+func (f *bloomFilter) add(gram uint32) {
+	h1, h2 := hashGram(gram)
+	mask := uint32(len(f.bits)*8 - 1)
+	for i := uint32(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) & mask
+		f.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+func (f *bloomFilter) has(gram uint32) bool {
+	h1, h2 := hashGram(gram)
+	mask := uint32(len(f.bits)*8 - 1)
+	for i := uint32(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) & mask
+		if f.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// mayContain returns false if no token recorded by the filter contains the
+// literal, which must not contain whitespace.
+func (f *bloomFilter) mayContain(literal []byte) bool {
+	for i := 0; i+gramSize <= len(literal); i++ {
+		if !f.has(makeGram(literal[i:])) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *bloomFilter) fill() float64 {
+	var set int
+	for _, b := range f.bits {
+		for ; b != 0; b &= b - 1 {
+			set++
+		}
+	}
+	return float64(set) / float64(len(f.bits)*8)
+}
+
+// writeBloomFilter to path, and sync it, since a filter torn by a crash would
+// make queries skip the segment. Partially written files are removed.
+func writeBloomFilter(filesys fs.Filesystem, path string, f *bloomFilter) error {
+	file, err := filesys.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(f.bits); err != nil {
+		file.Close()
+		filesys.Remove(path)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		filesys.Remove(path)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		filesys.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// readBloomFilter from path.
+func readBloomFilter(filesys fs.Filesystem, path string) (*bloomFilter, error) {
+	file, err := filesys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	bits, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(bits); n == 0 || n&(n-1) != 0 {
+		return nil, errors.Errorf("invalid bloom filter size %d", n)
+	}
+	return &bloomFilter{bits: bits}, nil
+}
+
+// gramWriter feeds the grams of records written to it into a bloom filter.
+// Records may be split across writes. The leading ULID of each record isn't
+// part of what queries match, so it's skipped.
+type gramWriter struct {
+	filter *bloomFilter
+	offset int    // in the current record
+	window uint32 // last bytes of the current token
+	n      int    // length of the current token
+}
+
+func newGramWriter(filter *bloomFilter) *gramWriter {
+	return &gramWriter{filter: filter}
+}
+
+func (w *gramWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if c == '\n' {
+			w.offset, w.n = 0, 0
+			continue
+		}
+		w.offset++
+		if w.offset <= ulid.EncodedSize+1 {
+			continue
+		}
+		if isSpace(c) {
+			w.n = 0
+			continue
+		}
+		w.window = w.window<<8 | uint32(c)
+		if w.n++; w.n >= gramSize {
+			w.filter.add(w.window)
+		}
+	}
+	return len(p), nil
+}
+
+var _ io.Writer = (*gramWriter)(nil)
+
+// queryLiteral returns the longest run of non-whitespace bytes that every
+// record matching the query must contain, or nil if there isn't one of at
+// least gramSize bytes, in which case a bloom filter can't help.
+func queryLiteral(q string, regex bool) []byte {
+	var literals [][]byte
+	if !regex {
+		literals = [][]byte{[]byte(q)}
+	} else if re, err := syntax.Parse(q, syntax.Perl); err == nil {
+		literals = requiredLiterals(re.Simplify())
+	}
+
+	var longest []byte
+	for _, literal := range literals {
+		for _, run := range splitSpace(literal) {
+			if len(run) > len(longest) {
+				longest = run
+			}
+		}
+	}
+	if len(longest) < gramSize {
+		return nil
+	}
+	return longest
+}
+
+// requiredLiterals returns literals that occur in every match of re.
+func requiredLiterals(re *syntax.Regexp) [][]byte {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return nil
+		}
+		return [][]byte{[]byte(string(re.Rune))}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min < 1 {
+			return nil
+		}
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpConcat:
+		var literals [][]byte
+		for _, sub := range re.Sub {
+			literals = append(literals, requiredLiterals(sub)...)
+		}
+		return literals
+	default:
+		return nil
+	}
+}
+
+func splitSpace(b []byte) [][]byte {
+	var runs [][]byte
+	start := -1
+	for i, c := range b {
+		switch {
+		case isSpace(c) && start >= 0:
+			runs = append(runs, b[start:i])
+			start = -1
+		case !isSpace(c) && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		runs = append(runs, b[start:])
+	}
+	return runs
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	default:
+		return false
+	}
+}
+
+func makeGram(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+func hashGram(gram uint32) (h1, h2 uint32) {
+	h := uint64(gram) * 0x9E3779B97F4A7C15
+	h ^= h >> 29
+	h *= 0xBF58476D1CE4E5B9
+	h ^= h >> 32
+	return uint32(h), uint32(h>>32) | 1
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestQueryLiteral(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		q     string
+		regex bool
+		want  string
+	}{
+		{"", false, ""},
+		{"abc", false, ""},
+		{"request-1234", false, "request-1234"},
+		{"foo barbaz qux", false, "barbaz"},
+		{"a b c d", false, ""},
+		{"abcd", true, "abcd"},
+		{`id=(\d+) user=alice`, true, "user=alice"},
+		{`x+abcdef$`, true, "abcdef"},
+		{`(?i)abcdef`, true, ""},
+		{`abcd|efgh`, true, ""},
+		{`(abcd)?`, true, ""},
+		{`(abcdef){2}`, true, "abcdef"},
+		{`[`, true, ""},
+	} {
+		t.Run(fmt.Sprintf("%q regex=%v", testcase.q, testcase.regex), func(t *testing.T) {
+			if want, have := testcase.want, string(queryLiteral(testcase.q, testcase.regex)); want != have {
+				t.Fatalf("want %q, have %q", want, have)
+			}
+		})
+	}
+}
+
+func TestBloomFilterNoFalseNegatives(t *testing.T) {
+	t.Parallel()
+
+	filesys := fs.NewVirtualFilesystem()
+	filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+
+	// Segments of random records, written in random chunks, so records and
+	// tokens are split across writes.
+	var (
+		rng     = rand.New(rand.NewSource(1))
+		t0      = time.Now().Add(-time.Hour)
+		records []string
+		tokens  []string
+	)
+	for i := 0; i < 10; i++ {
+		var (
+			buf       bytes.Buffer
+			low, high ulid.ULID
+		)
+		for j := 0; j < 20; j++ {
+			id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i*20+j)*time.Second)), rng)
+			if j == 0 {
+				low = id
+			}
+			high = id
+			var fields []string
+			for k := 0; k < 1+rng.Intn(4); k++ {
+				token := randomToken(rng, 4+rng.Intn(12))
+				fields = append(fields, token)
+				tokens = append(tokens, token)
+			}
+			record := fmt.Sprintf("%s %s\n", id, strings.Join(fields, " \t"[rng.Intn(2):][:1]))
+			records = append(records, record)
+			buf.WriteString(record)
+		}
+		segment, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for p := buf.Bytes(); len(p) > 0; {
+			n := 1 + rng.Intn(len(p))
+			if _, err := segment.Write(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+		}
+		if err := segment.Close(low, high); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := func(q string, regex bool) string {
+		result, err := filelog.Query(context.Background(), QueryParams{
+			From:  ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(t0), nil)},
+			To:    ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(time.Now()), nil)},
+			Q:     q,
+			Regex: regex,
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer result.Records.Close()
+		records, err := ioutil.ReadAll(result.Records)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(records)
+	}
+
+	// Every substring of every token that's long enough to use the filter
+	// must still be found.
+	for _, token := range tokens {
+		begin := rng.Intn(len(token) - gramSize + 1)
+		end := begin + gramSize + rng.Intn(len(token)-begin-gramSize+1)
+		literal := token[begin:end]
+		var want []string
+		for _, record := range records {
+			if strings.Contains(record[ulid.EncodedSize+1:], literal) {
+				want = append(want, record)
+			}
+		}
+		for _, regex := range []bool{false, true} {
+			q := literal
+			if regex {
+				q = "x*" + regexp.QuoteMeta(literal)
+			}
+			if want, have := strings.Join(want, ""), query(q, regex); want != have {
+				t.Fatalf("%q (regex=%v): want %q, have %q", q, regex, want, have)
+			}
+		}
+	}
+}
+
+func TestQuerySkipsSegmentsByBloomFilter(t *testing.T) {
+	t.Parallel()
+
+	filesys := &openRecorder{Filesystem: fs.NewVirtualFilesystem()}
+	filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+
+	t0 := time.Now().Add(-time.Minute)
+	var paths []string
+	for i, payload := range []string{"GET /foo request=deadbeef", "GET /bar request=cafebabe"} {
+		id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Second)), nil)
+		segment, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(segment, "%s %s\n", id, payload)
+		if err := segment.Close(id, id); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, fmt.Sprintf("/%s-%s", id, id))
+	}
+
+	result, err := filelog.Query(context.Background(), QueryParams{
+		From: ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(t0), nil)},
+		To:   ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(time.Now()), nil)},
+		Q:    "cafebabe",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(result.Records)
+	result.Records.Close()
+
+	// Both filters are consulted, but only the second segment is read.
+	want := []string{
+		paths[0] + extBloom,
+		paths[1] + extBloom,
+		paths[1] + extChecksum,
+		paths[1] + extFlushed,
+	}
+	if have := filesys.opened(); !reflect.DeepEqual(want, have) {
+		t.Fatalf("want %v, have %v", want, have)
+	}
+}
+
+func randomToken(rng *rand.Rand, n int) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789=-_/."
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[rng.Intn(len(alphabet))]
+	}
+	return string(b)
+}
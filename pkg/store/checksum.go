@@ -0,0 +1,178 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+const (
+	// extChecksum is the extension of the checksum file stored alongside
+	// each segment. Like the bloom filter, it shares the segment's basename.
+	extChecksum = ".crc"
+
+	// extCorrupt is the extension given to segments which fail checksum
+	// verification, as they're moved to the corruptDir.
+	extCorrupt = ".corrupt"
+	corruptDir = "corrupt"
+
+	// Segments are checksummed in blocks, so corruption is detected before
+	// any record of the block it's in is read, without having to verify
+	// the whole segment before the first record.
+	checksumBlockSize = 64 * 1024
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// errCorruptSegment is returned when a segment fails checksum verification.
+var errCorruptSegment = errors.New("segment failed checksum verification")
+
+// blockChecksum computes the CRC32C of each block of the bytes written to it.
+type blockChecksum struct {
+	sums []uint32
+	crc  uint32
+	n    int // bytes in the current block
+}
+
+func (c *blockChecksum) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := checksumBlockSize - c.n
+		if n > len(p) {
+			n = len(p)
+		}
+		c.crc = crc32.Update(c.crc, castagnoli, p[:n])
+		if c.n += n; c.n == checksumBlockSize {
+			c.sums = append(c.sums, c.crc)
+			c.crc, c.n = 0, 0
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// blocks returns the checksums of all blocks, including the last, partial one.
+func (c *blockChecksum) blocks() []uint32 {
+	if c.n == 0 {
+		return c.sums
+	}
+	return append(c.sums[:len(c.sums):len(c.sums)], c.crc)
+}
+
+// writeChecksums to path, as the block size followed by the block checksums,
+// and sync them, so a crash can't leave too few for the segment, which would
+// fail it as corrupt. Partially written files are removed.
+func writeChecksums(filesys fs.Filesystem, path string, sums []uint32) error {
+	buf := make([]byte, 4+4*len(sums))
+	binary.BigEndian.PutUint32(buf, checksumBlockSize)
+	for i, sum := range sums {
+		binary.BigEndian.PutUint32(buf[4+4*i:], sum)
+	}
+	f, err := filesys.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		filesys.Remove(path)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		filesys.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		filesys.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// readChecksums from path.
+func readChecksums(filesys fs.Filesystem, path string) ([]uint32, error) {
+	f, err := filesys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < 4 || len(buf)%4 != 0 || binary.BigEndian.Uint32(buf) != checksumBlockSize {
+		return nil, errCorruptSegment
+	}
+	sums := make([]uint32, (len(buf)-4)/4)
+	for i := range sums {
+		sums[i] = binary.BigEndian.Uint32(buf[4+4*i:])
+	}
+	return sums, nil
+}
+
+// checksumReader verifies each block of the underlying reader before yielding
+// any of it. If a block fails verification, or there are more or fewer blocks
+// than checksums, it calls corrupt once, and returns errCorruptSegment.
+type checksumReader struct {
+	r       io.Reader
+	sums    []uint32
+	corrupt func()
+	buf     []byte
+	off     int
+	err     error
+}
+
+func newChecksumReader(r io.Reader, sums []uint32, corrupt func()) *checksumReader {
+	return &checksumReader{r: r, sums: sums, corrupt: corrupt}
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	if r.off == len(r.buf) && r.err == nil {
+		r.err = r.fill()
+		if r.err == errCorruptSegment {
+			r.corrupt()
+		}
+	}
+	if r.off == len(r.buf) {
+		return 0, r.err
+	}
+	n := copy(p, r.buf[r.off:])
+	r.off += n
+	return n, nil
+}
+
+// fill the buffer with the next verified block.
+func (r *checksumReader) fill() error {
+	if r.buf == nil {
+		r.buf = make([]byte, checksumBlockSize)
+	}
+	n, err := io.ReadFull(r.r, r.buf[:checksumBlockSize])
+	r.buf, r.off = r.buf[:n], 0
+	switch {
+	case err == io.EOF && len(r.sums) == 0:
+		return io.EOF
+	case err != nil && err != io.EOF && err != io.ErrUnexpectedEOF:
+		return err
+	case n == 0 || len(r.sums) == 0 || crc32.Checksum(r.buf, castagnoli) != r.sums[0]:
+		r.buf = r.buf[:0]
+		return errCorruptSegment
+	}
+	r.sums = r.sums[1:]
+	return nil
+}
+
+// truncateCorrupt ends reads of a corrupt segment file, rather than failing
+// them.
+type truncateCorrupt struct{ fs.File }
+
+func (f truncateCorrupt) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if err == errCorruptSegment {
+		err = io.EOF
+	}
+	return n, err
+}
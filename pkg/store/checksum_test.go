@@ -0,0 +1,239 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestChecksumReader(t *testing.T) {
+	t.Parallel()
+
+	data := make([]byte, 3*checksumBlockSize+123)
+	rand.New(rand.NewSource(1)).Read(data)
+	var checksum blockChecksum
+	checksum.Write(data[:100]) // in pieces, across block boundaries
+	checksum.Write(data[100 : checksumBlockSize+1])
+	checksum.Write(data[checksumBlockSize+1:])
+	sums := checksum.blocks()
+	if want, have := 4, len(sums); want != have {
+		t.Fatalf("blocks: want %d, have %d", want, have)
+	}
+
+	flipped := append([]byte{}, data...)
+	flipped[2*checksumBlockSize+10] ^= 0x01
+
+	for _, testcase := range []struct {
+		name    string
+		input   []byte
+		want    []byte // before the error
+		corrupt bool
+	}{
+		{"intact", data, data, false},
+		{"flipped", flipped, data[:2*checksumBlockSize], true},
+		{"truncated", data[:len(data)-1], data[:3*checksumBlockSize], true},
+		{"truncated at block", data[:3*checksumBlockSize], data[:3*checksumBlockSize], true},
+		{"extended", append(append([]byte{}, data...), 'x'), data[:3*checksumBlockSize], true},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var corrupted int
+			r := newChecksumReader(bytes.NewReader(testcase.input), sums, func() { corrupted++ })
+			have, err := ioutil.ReadAll(r)
+			if want := testcase.want; !bytes.Equal(want, have) {
+				t.Errorf("want %d bytes, have %d", len(want), len(have))
+			}
+			if testcase.corrupt {
+				if want, have := errCorruptSegment, err; want != have {
+					t.Errorf("error: want %v, have %v", want, have)
+				}
+				if _, err := r.Read(make([]byte, 1)); err != errCorruptSegment {
+					t.Errorf("error on subsequent Read: want %v, have %v", errCorruptSegment, err)
+				}
+			} else if err != nil {
+				t.Errorf("error: want none, have %v", err)
+			}
+			if want, have := map[bool]int{true: 1, false: 0}[testcase.corrupt], corrupted; want != have {
+				t.Errorf("corrupt calls: want %d, have %d", want, have)
+			}
+		})
+	}
+}
+
+func TestQueryQuarantinesCorruptSegment(t *testing.T) {
+	t.Parallel()
+
+	var (
+		corruptSegments = prometheus.NewCounter(prometheus.CounterOpts{Name: "corrupt"})
+		t0              = time.Now().Add(-time.Minute)
+		ids             []ulid.ULID
+		records         bytes.Buffer
+	)
+	for i := 0; i < 4; i++ {
+		ids = append(ids, ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Second)), nil))
+	}
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&records, "%s record %d\n", ids[i], i)
+	}
+
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			filesys := fs.NewVirtualFilesystem()
+			filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{
+				Compress:        compress,
+				CorruptSegments: corruptSegments,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer filelog.Close()
+
+			// Two copies of the same records, as if compacted twice on
+			// this node, in segments with different names, so they're
+			// compressed, if the log compresses them.
+			for _, high := range []ulid.ULID{ids[2], ids[3]} {
+				segment, err := filelog.Create()
+				if err != nil {
+					t.Fatal(err)
+				}
+				segment.SetCompacted()
+				segment.Write(records.Bytes())
+				if err := segment.Close(ids[0], high); err != nil {
+					t.Fatal(err)
+				}
+			}
+			corrupt := fmt.Sprintf("/%s-%s", ids[0], ids[2])
+			flipByte(t, filesys, corrupt+extFlushed)
+
+			// The query succeeds, with records from the surviving copy.
+			result, err := filelog.Query(context.Background(), QueryParams{
+				From: ulidOrTime{ULID: ids[0]},
+				To:   ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(time.Now()), nil)},
+			}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := ioutil.ReadAll(result.Records)
+			result.Records.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := records.String(); want != string(have) {
+				t.Errorf("records: want %q, have %q", want, string(have))
+			}
+
+			// And the corrupt copy has been quarantined.
+			want := []string{
+				filepath.Join("/", corruptDir, filepath.Base(corrupt)+extCorrupt),
+				filepath.Join("/", corruptDir, filepath.Base(corrupt)+extChecksum),
+			}
+			if have := filesIn(filesys, filepath.Join("/", corruptDir)); !reflect.DeepEqual(want, have) {
+				t.Errorf("quarantined: want %v, have %v", want, have)
+			}
+		})
+	}
+
+	var m dto.Metric
+	corruptSegments.Write(&m)
+	if want, have := 2.0, m.GetCounter().GetValue(); want != have {
+		t.Errorf("corrupt segments: want %v, have %v", want, have)
+	}
+}
+
+func TestCompactionQuarantinesCorruptSegment(t *testing.T) {
+	t.Parallel()
+
+	filesys := fs.NewVirtualFilesystem()
+	filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+
+	t0 := time.Now().Add(-time.Minute)
+	var paths []string
+	for i := 0; i < 3; i++ {
+		id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Second)), nil)
+		segment, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(segment, "%s record %d\n", id, i)
+		if err := segment.Close(id, id); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, fmt.Sprintf("/%s-%s", id, id))
+	}
+	flipByte(t, filesys, paths[1]+extFlushed)
+
+	// Compaction fails rather than writing a merged segment without the
+	// corrupt segment's records, and then purging their only local copy.
+	readSegments, err := filelog.Sequential()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readers := make([]io.Reader, len(readSegments))
+	for i := range readSegments {
+		readers[i] = readSegments[i]
+	}
+	if _, err := mergeRecordsToLog(filelog, 10240, readers...); err == nil {
+		t.Fatal("mergeRecordsToLog: want error, have none")
+	}
+	for _, readSegment := range readSegments {
+		readSegment.Reset() // the corrupt one fails
+	}
+
+	if !filesys.Exists(filepath.Join("/", corruptDir, filepath.Base(paths[1])+extCorrupt)) {
+		t.Errorf("%s wasn't quarantined", paths[1])
+	}
+	for _, path := range []string{paths[0], paths[2]} {
+		if !filesys.Exists(path + extFlushed) {
+			t.Errorf("%s is missing", path+extFlushed)
+		}
+	}
+}
+
+// flipByte flips a bit in the last byte of the file at path.
+func flipByte(t *testing.T, filesys fs.Filesystem, path string) {
+	f, err := filesys.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0x01
+	if f, err = filesys.Create(path); err != nil {
+		t.Fatal(err)
+	}
+	f.Write(data)
+	f.Close()
+}
+
+func filesIn(filesys fs.Filesystem, dir string) []string {
+	var files []string
+	filesys.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if filepath.Dir(path) == dir {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
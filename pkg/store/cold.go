@@ -0,0 +1,661 @@
+package store
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+// ColdStore is an object store that sealed segments are moved to once they're
+// old enough that they needn't be queried fast, e.g. S3; see ColdTier. Objects
+// are named by keys, which are segment names, with an extension.
+type ColdStore interface {
+	// Put the object of the key, of size bytes read from r, replacing any
+	// object of the same key.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+
+	// Get the object of the key. It returns ErrSegmentNotFound if there's
+	// no such object.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete the object of the key. Deleting an object that doesn't exist
+	// isn't an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// MemColdStore is a ColdStore in memory, for tests, and for trying out a cold
+// tier without an object store.
+type MemColdStore struct {
+	mtx     sync.Mutex
+	objects map[string][]byte
+	gets    int
+}
+
+// NewMemColdStore returns an empty MemColdStore.
+func NewMemColdStore() *MemColdStore {
+	return &MemColdStore{objects: map[string][]byte{}}
+}
+
+// Put implements ColdStore.
+func (s *MemColdStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if int64(len(buf)) != size {
+		return errors.Errorf("%s: read %d bytes, want %d", key, len(buf), size)
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.objects[key] = buf
+	return nil
+}
+
+// Get implements ColdStore.
+func (s *MemColdStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	buf, ok := s.objects[key]
+	if !ok {
+		return nil, ErrSegmentNotFound
+	}
+	s.gets++
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+// Delete implements ColdStore.
+func (s *MemColdStore) Delete(ctx context.Context, key string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+// Keys returns the keys of the objects in the store, in order.
+func (s *MemColdStore) Keys() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Gets returns how many objects have been got from the store.
+func (s *MemColdStore) Gets() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.gets
+}
+
+const (
+	// coldManifestFile, in the store path, lists the segments in the cold
+	// store, as they're only there, and not on disk.
+	coldManifestFile = "cold.manifest"
+
+	// coldCacheDir, in the store path, holds the segments fetched from the
+	// cold store, for queries.
+	coldCacheDir = "cold"
+
+	extCold     = ".cold"     // a segment fetched from the cold store
+	extDownload = ".download" // a segment being fetched
+	extUpload   = ".upload"   // a segment being moved to the cold store
+	extColdZstd = ".zst"      // of the keys of segments in the cold store
+)
+
+// ColdTier moves sealed segments to a ColdStore, and fetches them back, for
+// queries whose range they overlap.
+//
+// The Compacter moves segments once their newest record is older than its
+// cold age, compressed, as compacted segments are, and removes them from
+// disk. The segments in the cold
+// store are listed in a manifest in the store path, so queries know of them,
+// and retention applies to them, as to the segments on disk.
+//
+// Queries fetch the cold segments they read into a cache, in the store path,
+// as they're stored, which keeps the least recently used of them within its
+// size in bytes, of their records, but for those being read. A nil ColdTier holds no segments.
+type ColdTier struct {
+	filesys  fs.Filesystem
+	root     string
+	store    ColdStore
+	maxBytes int64
+	moved    *prometheus.CounterVec // by success
+	fetched  *prometheus.CounterVec // by result
+	cached   prometheus.Gauge       // bytes
+	reporter EventReporter
+	changed  func(low, high ulid.ULID) // as segments are moved, or expire
+
+	mtx      sync.Mutex
+	segments []coldSegment // the manifest, in order
+	size     int64         // of the cache
+	lru      *list.List    // of *coldCacheEntry, most recently used first
+	entries  map[string]*coldCacheEntry
+}
+
+// coldSegment is a segment in the cold store, as listed in the manifest. Size
+// is of its records, and Stored, of its object. Origins are its labels'.
+type coldSegment struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Stored   int64     `json:"stored"`
+	Origins  []string  `json:"origins,omitempty"`
+	Uploaded time.Time `json:"uploaded"`
+
+	low, high ulid.ULID
+}
+
+type coldManifest struct {
+	Segments []coldSegment `json:"segments"`
+}
+
+// coldCacheEntry is a segment in the cache, or being fetched into it, until
+// ready is closed. Once it is, err is set, if it couldn't be fetched. Entries
+// are evicted once they're unused.
+type coldCacheEntry struct {
+	name  string
+	size  int64
+	elem  *list.Element // nil until it's fetched
+	users int
+	ready chan struct{}
+	err   error
+}
+
+// NewColdTier returns a ColdTier of the store path root, moving segments to
+// the cold store. Its manifest is read, if there is one, and anything in the
+// cache that isn't a whole segment of it is removed. The cache is kept to
+// maxBytes, at most, but for segments being read. Segments moved are counted
+// by moved, by "success", and fetched, by "result": hit, if they're in the
+// cache, miss, if they're fetched, or error. The size of the cache is cached.
+func NewColdTier(filesys fs.Filesystem, root string, store ColdStore, maxBytes int64, moved, fetched *prometheus.CounterVec, cached prometheus.Gauge, reporter EventReporter) (*ColdTier, error) {
+	if reporter == nil {
+		reporter = LogReporter{log.NewNopLogger()}
+	}
+	t := &ColdTier{
+		filesys:  filesys,
+		root:     root,
+		store:    store,
+		maxBytes: maxBytes,
+		moved:    moved,
+		fetched:  fetched,
+		cached:   cached,
+		reporter: reporter,
+		changed:  func(low, high ulid.ULID) {},
+		lru:      list.New(),
+		entries:  map[string]*coldCacheEntry{},
+	}
+	if err := t.readManifest(); err != nil {
+		return nil, err
+	}
+	if err := filesys.MkdirAll(t.cacheDir()); err != nil {
+		return nil, errors.Wrapf(err, "creating path %s", t.cacheDir())
+	}
+	t.rebuildCache()
+	return t, nil
+}
+
+func (t *ColdTier) cacheDir() string {
+	return filepath.Join(t.root, coldCacheDir)
+}
+
+func (t *ColdTier) cachePath(name string) string {
+	return filepath.Join(t.cacheDir(), name+extCold)
+}
+
+// readManifest reads the segments of the manifest, if there is one.
+func (t *ColdTier) readManifest() error {
+	path := filepath.Join(t.root, coldManifestFile)
+	if !t.filesys.Exists(path) {
+		return nil
+	}
+	f, err := t.filesys.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", path)
+	}
+	defer f.Close()
+	var m coldManifest
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return errors.Wrapf(err, "reading %s", path)
+	}
+	for _, s := range m.Segments {
+		low, high, err := parseFilename(s.Name)
+		if err != nil {
+			t.reporter.ReportEvent(Event{Op: "readColdManifest", File: s.Name, Warning: err, Msg: "won't query malformed cold segment"})
+			continue
+		}
+		s.low, s.high = low, high
+		t.segments = append(t.segments, s)
+	}
+	sort.Slice(t.segments, func(i, j int) bool { return t.segments[i].Name < t.segments[j].Name })
+	return nil
+}
+
+// writeManifest writes the segments aside, and renames them over the
+// manifest, so a crash leaves the old one, or the new one. It must be called
+// with the mutex held.
+func (t *ColdTier) writeManifest() error {
+	var (
+		path = filepath.Join(t.root, coldManifestFile)
+		tmp  = path + ".tmp"
+	)
+	buf, err := json.MarshalIndent(coldManifest{Segments: t.segments}, "", "    ")
+	if err != nil {
+		return err
+	}
+	f, err := t.filesys.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(buf, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return t.filesys.Rename(tmp, path)
+}
+
+// rebuildCache adds the whole segments in the cache directory to the cache,
+// least recently modified first, and removes everything else.
+func (t *ColdTier) rebuildCache() {
+	listed := map[string]bool{}
+	for _, s := range t.segments {
+		listed[s.Name] = true
+	}
+	type cachedFile struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cachedFile
+	t.filesys.Walk(t.cacheDir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if name := basename(path); filepath.Ext(path) == extCold && listed[name] {
+			size, err := logicalSize(t.filesys, path, info.Size())
+			if err == nil {
+				files = append(files, cachedFile{name, size, info.ModTime()})
+				return nil
+			}
+			t.reporter.ReportEvent(Event{Op: "rebuildColdCache", File: path, Warning: err, Msg: "removing unreadable cached segment"})
+		}
+		if err := t.filesys.Remove(path); err != nil {
+			t.reporter.ReportEvent(Event{Op: "rebuildColdCache", File: path, Warning: err, Msg: "failed to remove stray file"})
+		}
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for _, f := range files {
+		e := &coldCacheEntry{name: f.name, size: f.size, ready: make(chan struct{})}
+		close(e.ready)
+		e.elem = t.lru.PushFront(e)
+		t.entries[f.name] = e
+		t.size += f.size
+	}
+	t.evict()
+}
+
+// move the read segment, whose records are read from r, to the cold store,
+// and, once it's listed in the manifest, purge it. If it can't be moved, it's
+// reset.
+func (t *ColdTier) move(ctx context.Context, segment ReadSegment, r io.Reader) (err error) {
+	name := basename(segment.Name())
+	defer func() {
+		t.moved.WithLabelValues(fmt.Sprint(err == nil)).Inc()
+		if err != nil {
+			if rerr := segment.Reset(); rerr != nil {
+				t.reporter.ReportEvent(Event{Op: "moveToCold", File: segment.Name(), Warning: rerr, Msg: "failed to reset segment"})
+			}
+		}
+	}()
+	low, high, err := parseFilename(name)
+	if err != nil {
+		return err
+	}
+
+	// The object is written aside, first, as its size must be known, and
+	// then compressed, as compaction seals segments, so both tiers store
+	// segments in one format.
+	var (
+		plain  = filepath.Join(t.cacheDir(), name+extUpload)
+		upload = plain + extSealing
+		size   int64
+	)
+	defer t.filesys.Remove(plain)
+	defer t.filesys.Remove(upload)
+	if size, err = writeAside(t.filesys, plain, r); err != nil {
+		return errors.Wrap(err, "writing segment aside")
+	}
+	if _, err = sealSegment(t.filesys, plain, upload, true, nil); err != nil {
+		return errors.Wrap(err, "compressing segment")
+	}
+	f, err := t.filesys.Open(upload)
+	if err != nil {
+		return err
+	}
+	stored := f.Size()
+	err = t.store.Put(ctx, name+extColdZstd, f, stored)
+	f.Close()
+	if err != nil {
+		return errors.Wrap(err, "putting segment")
+	}
+
+	// Once it's listed, it's safe to purge. Until it's purged, queries read
+	// it on disk.
+	s := coldSegment{Name: name, Size: size, Stored: stored, Origins: segment.Origins(), Uploaded: time.Now().UTC(), low: low, high: high}
+	t.mtx.Lock()
+	i := sort.Search(len(t.segments), func(i int) bool { return t.segments[i].Name >= name })
+	if i < len(t.segments) && t.segments[i].Name == name {
+		t.segments[i] = s
+	} else {
+		t.segments = append(t.segments, coldSegment{})
+		copy(t.segments[i+1:], t.segments[i:])
+		t.segments[i] = s
+	}
+	err = t.writeManifest()
+	t.mtx.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "writing manifest")
+	}
+	if err := segment.Purge(); err != nil {
+		t.reporter.ReportEvent(Event{Op: "moveToCold", File: segment.Name(), Warning: err, Msg: "moved, but failed to purge segment"})
+	}
+	t.changed(low, high)
+	return nil
+}
+
+// writeAside writes what's read from r to a file at path, and returns how
+// many bytes were read.
+func writeAside(filesys fs.Filesystem, path string, r io.Reader) (int64, error) {
+	f, err := filesys.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// expire the segments whose newest record is older than oldestRecord: they're
+// deleted from the cold store, the manifest, and the cache. It returns how
+// many expired.
+func (t *ColdTier) expire(ctx context.Context, oldestRecord time.Time) int {
+	if t == nil {
+		return 0
+	}
+	oldestID := ulidutil.Min(ulid.Timestamp(oldestRecord))
+	t.mtx.Lock()
+	var expired []coldSegment
+	for _, s := range t.segments {
+		if s.high.Compare(oldestID) < 0 {
+			expired = append(expired, s)
+		}
+	}
+	t.mtx.Unlock()
+
+	var n int
+	for _, s := range expired {
+		if err := t.store.Delete(ctx, s.Name+extColdZstd); err != nil {
+			t.reporter.ReportEvent(Event{Op: "expireCold", File: s.Name, Error: err, Msg: "failed to delete cold segment"})
+			continue
+		}
+		t.mtx.Lock()
+		for i := range t.segments {
+			if t.segments[i].Name == s.Name {
+				t.segments = append(t.segments[:i], t.segments[i+1:]...)
+				break
+			}
+		}
+		err := t.writeManifest()
+		if e, ok := t.entries[s.Name]; ok && e.elem != nil && e.users == 0 {
+			t.remove(e)
+		}
+		t.mtx.Unlock()
+		if err != nil {
+			t.reporter.ReportEvent(Event{Op: "expireCold", File: s.Name, Error: err, Msg: "failed to write manifest"})
+		}
+		t.changed(s.low, s.high)
+		n++
+	}
+	return n
+}
+
+// overlapping returns the cold segments overlapping the range from one ULID
+// to another, in order, and how many there are in all.
+func (t *ColdTier) overlapping(from, to ulid.ULID) (segments []coldSegment, total int) {
+	if t == nil {
+		return nil, 0
+	}
+	if from.Compare(to) > 0 {
+		from, to = to, from
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for _, s := range t.segments {
+		if s.low.Compare(to) <= 0 && s.high.Compare(from) >= 0 {
+			segments = append(segments, s)
+		}
+	}
+	return segments, len(t.segments)
+}
+
+// fetch opens the cold segment from the cache, fetching it into the cache
+// first, if it isn't there, to read its records, as segments on disk are
+// read. It's kept in the cache until the file is closed.
+func (t *ColdTier) fetch(ctx context.Context, filesys fs.Filesystem, s coldSegment) (fs.File, error) {
+	t.mtx.Lock()
+	e, ok := t.entries[s.Name]
+	if !ok {
+		e = &coldCacheEntry{name: s.Name, ready: make(chan struct{})}
+		t.entries[s.Name] = e
+	}
+	e.users++
+	if e.elem != nil {
+		t.lru.MoveToFront(e.elem)
+	}
+	t.mtx.Unlock()
+
+	result := "hit"
+	if !ok {
+		result = "miss"
+		t.download(ctx, e)
+	}
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		t.release(e)
+		return nil, ctx.Err()
+	}
+	if e.err != nil {
+		t.fetched.WithLabelValues("error").Inc()
+		t.release(e)
+		return nil, e.err
+	}
+	f, err := openSegmentFile(filesys, t.cachePath(s.Name), nil, func(path string) {
+		t.reporter.ReportEvent(Event{Op: "fetchCold", File: path, Error: errCorruptSegment, Msg: "cached segment is corrupt"})
+	})
+	if err != nil {
+		t.fetched.WithLabelValues("error").Inc()
+		t.release(e)
+		return nil, err
+	}
+	t.fetched.WithLabelValues(result).Inc()
+	return &coldFile{File: f, release: func() { t.release(e) }}, nil
+}
+
+// download the entry's segment into the cache, and make it ready. A segment
+// that can't be downloaded is dropped from the cache, so it's tried again by
+// the next query.
+func (t *ColdTier) download(ctx context.Context, e *coldCacheEntry) {
+	size, err := t.get(ctx, e.name)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if err != nil {
+		e.err = errors.Wrapf(err, "fetching cold segment %s", e.name)
+		delete(t.entries, e.name)
+		close(e.ready)
+		return
+	}
+	e.size = size
+	e.elem = t.lru.PushFront(e)
+	t.size += size
+	close(e.ready)
+	t.evict()
+}
+
+// get the segment's object from the cold store, and write it aside, as it's
+// stored, and then to its path in the cache. It returns the logical size of
+// the segment, which the cache is charged, as compaction sizes segments by it.
+func (t *ColdTier) get(ctx context.Context, name string) (int64, error) {
+	rc, err := t.store.Get(ctx, name+extColdZstd)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	download := filepath.Join(t.cacheDir(), name+extDownload)
+	f, err := t.filesys.Create(download)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, rc)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = t.filesys.Rename(download, t.cachePath(name))
+	}
+	if err != nil {
+		t.filesys.Remove(download)
+		return 0, err
+	}
+	size, err := logicalSize(t.filesys, t.cachePath(name), n)
+	if err != nil {
+		t.filesys.Remove(t.cachePath(name))
+	}
+	return size, err
+}
+
+// release the entry, as a query's done with it, and evict what's no longer
+// used, if the cache is over its size.
+func (t *ColdTier) release(e *coldCacheEntry) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	e.users--
+	t.evict()
+}
+
+// evict the least recently used segments that aren't being read, until the
+// cache is within its size. It must be called with the mutex held.
+func (t *ColdTier) evict() {
+	for elem := t.lru.Back(); elem != nil && t.size > t.maxBytes; {
+		prev := elem.Prev()
+		if e := elem.Value.(*coldCacheEntry); e.users <= 0 {
+			t.remove(e)
+		}
+		elem = prev
+	}
+	t.cached.Set(float64(t.size))
+}
+
+// remove the fetched entry from the cache, and its segment from disk. It must
+// be called with the mutex held.
+func (t *ColdTier) remove(e *coldCacheEntry) {
+	t.lru.Remove(e.elem)
+	delete(t.entries, e.name)
+	t.size -= e.size
+	if err := t.filesys.Remove(t.cachePath(e.name)); err != nil && err != os.ErrNotExist {
+		t.reporter.ReportEvent(Event{Op: "evictCold", File: e.name, Warning: err, Msg: "failed to remove cached segment"})
+	}
+	t.cached.Set(float64(t.size))
+}
+
+// coldFile is a segment in the cache, which is released when it's closed.
+type coldFile struct {
+	fs.File
+	once    sync.Once
+	release func()
+}
+
+func (f *coldFile) Close() error {
+	err := f.File.Close()
+	f.once.Do(f.release)
+	return err
+}
+
+// withColdSegments adds the cold segments overlapping the range from one ULID
+// to another, opened, to the segments a query reads, which are returned in
+// order. Those on disk, too, e.g. as they're only
+// just moved, are read there. Cold segments have no bloom filters, so every
+// one matching the labels, and the plan, if any, is read. Segments that can't
+// be fetched are skipped, and reported.
+func (fl *fileLog) withColdSegments(ctx context.Context, segments []readSegment, from, to ulid.ULID, labels []labelMatcher, planned []string, stats *QueryStats) []readSegment {
+	cold, total := fl.cold.overlapping(from, to)
+	stats.SegmentsConsidered += total
+	stats.SegmentsPruned += total - len(cold)
+	if len(cold) == 0 {
+		return segments
+	}
+	var (
+		local  = map[string]bool{}
+		inPlan map[string]bool
+	)
+	for _, s := range segments {
+		local[basename(s.path)] = true
+	}
+	if planned != nil {
+		inPlan = map[string]bool{}
+		for _, name := range planned {
+			inPlan[name] = true
+		}
+	}
+	for _, s := range cold {
+		if local[s.Name] || (inPlan != nil && !inPlan[s.Name]) {
+			stats.SegmentsPruned++
+			continue
+		}
+		if len(labels) > 0 && !originsMatch(s.Origins, labels) {
+			stats.SegmentsFiltered++
+			continue
+		}
+		f, err := fl.cold.fetch(ctx, fl.queryFilesys, s)
+		if err != nil {
+			fl.reporter.ReportEvent(Event{Op: "queryMatchingSegments", File: s.Name, Error: err, Msg: "skipping cold segment"})
+			continue
+		}
+		segments = append(segments, readSegment{path: f.Name(), file: f, size: f.Size()})
+	}
+	sort.SliceStable(segments, func(i, j int) bool { return basename(segments[i].path) < basename(segments[j].path) })
+	return segments
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3EmptyPayload    = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" // SHA-256 of nothing
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+)
+
+// S3ColdStore is a ColdStore of objects in an S3 bucket, or in any object
+// store with the same API, e.g. MinIO, beneath a prefix. Requests are signed
+// with AWS Signature Version 4, and addressed path-style, which every such
+// store supports.
+type S3ColdStore struct {
+	endpoint     string
+	bucket       string
+	prefix       string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       Doer
+}
+
+// NewS3ColdStore returns a ColdStore of the objects beneath prefix in the
+// bucket, at the endpoint, e.g. https://s3.eu-west-1.amazonaws.com, or, if
+// it's empty, at the AWS endpoint of the region. Requests are signed with the
+// access and secret keys, and the session token, if it isn't empty, and sent
+// with client.
+func NewS3ColdStore(endpoint, bucket, prefix, region, accessKey, secretKey, sessionToken string, client Doer) *S3ColdStore {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	return &S3ColdStore{
+		endpoint:     strings.TrimSuffix(endpoint, "/"),
+		bucket:       bucket,
+		prefix:       strings.Trim(prefix, "/"),
+		region:       region,
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: sessionToken,
+		client:       client,
+	}
+}
+
+// Put implements ColdStore.
+func (s *S3ColdStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	req, err := s.newRequest(ctx, "PUT", key, ioutil.NopCloser(r))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := s.do(req, s3UnsignedPayload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return s3Error(req, resp)
+}
+
+// Get implements ColdStore.
+func (s *S3ColdStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.newRequest(ctx, "GET", key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req, s3EmptyPayload)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrSegmentNotFound
+	}
+	if err := s3Error(req, resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete implements ColdStore.
+func (s *S3ColdStore) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, "DELETE", key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, s3EmptyPayload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil // already gone
+	}
+	return s3Error(req, resp)
+}
+
+func (s *S3ColdStore) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	path := "/" + s3Escape(s.bucket) + "/"
+	if s.prefix != "" {
+		path += s3Escape(s.prefix) + "/"
+	}
+	req, err := http.NewRequest(method, s.endpoint+path+s3Escape(key), body)
+	if err != nil {
+		return nil, err
+	}
+	return req.WithContext(ctx), nil
+}
+
+// do signs the request, whose body has the payload hash, and sends it.
+func (s *S3ColdStore) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+	s.sign(req, payloadHash, time.Now())
+	return s.client.Do(req)
+}
+
+// sign the request, as of t, with its host and all of its headers, which
+// must be set by then, and the payload hash.
+func (s *S3ColdStore) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// The canonical request: the method, path, query string, and headers,
+	// in order, and the payload hash.
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical []string
+	canonical = append(canonical, req.Method, req.URL.EscapedPath(), req.URL.Query().Encode())
+	for _, name := range names {
+		canonical = append(canonical, name+":"+headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonical = append(canonical, "", signedHeaders, payloadHash)
+
+	// The string to sign is of the canonical request's hash, in the scope
+	// of the date, region, and service, and signed with a key derived from
+	// the secret key, through each of them.
+	var (
+		scope = strings.Join([]string{t.Format(s3DateFormat), s.region, "s3", "aws4_request"}, "/")
+		hash  = sha256.Sum256([]byte(strings.Join(canonical, "\n")))
+		toSig = strings.Join([]string{s3Algorithm, t.Format(s3TimeFormat), scope, hex.EncodeToString(hash[:])}, "\n")
+		key   = []byte("AWS4" + s.secretKey)
+	)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, toSig)),
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape escapes the path as S3 expects: everything but unreserved
+// characters, and slashes, which separate the segments of the path.
+func s3Escape(path string) string {
+	var buf []byte
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			buf = append(buf, c)
+		default:
+			buf = append(buf, fmt.Sprintf("%%%02X", c)...)
+		}
+	}
+	return string(buf)
+}
+
+// s3Error returns the error of an unsuccessful response, with the start of
+// its body, which says why.
+func s3Error(req *http.Request, resp *http.Response) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	buf, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return errors.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(buf)))
+}
@@ -0,0 +1,307 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+func TestColdTier(t *testing.T) {
+	t.Parallel()
+
+	var (
+		filesys = fs.NewVirtualFilesystem()
+		store   = NewMemColdStore()
+		moved   = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "moved"}, []string{"success"})
+		fetched = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "fetched"}, []string{"result"})
+		cached  = prometheus.NewGauge(prometheus.GaugeOpts{Name: "cached"})
+	)
+	newTier := func() *ColdTier {
+		// Segments are of two records, of 36 bytes each, so the cache
+		// holds two of them.
+		tier, err := NewColdTier(filesys, "/", store, 150, moved, fetched, cached, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tier
+	}
+	tier := newTier()
+	filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{Cold: tier})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+
+	// Segments a minute apart, of two records each, the first two of them
+	// old enough to move.
+	var (
+		t0      = time.Now().Add(-time.Hour)
+		entropy = rand.New(rand.NewSource(5))
+	)
+	for i := 0; i < 3; i++ {
+		segment, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var low, high ulid.ULID
+		for j := 0; j < 2; j++ {
+			id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Minute+time.Duration(j)*time.Second)), entropy)
+			fmt.Fprintf(segment, "%s record %d\n", id, 2*i+j)
+			if j == 0 {
+				low = id
+			}
+			high = id
+		}
+		if err := segment.Close(low, high); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := NewCompacter(
+		filelog, 1024*1024, nil, 2*time.Hour, 0, false, time.Hour, tier, time.Hour-90*time.Second, 1, 0,
+		prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "compact"}, []string{"kind", "compacted", "result"}),
+		prometheus.NewCounterVec(prometheus.CounterOpts{Name: "compact_bytes"}, []string{"op"}),
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "compact_queue"}),
+		prometheus.NewCounterVec(prometheus.CounterOpts{Name: "trash"}, []string{"success"}),
+		prometheus.NewCounterVec(prometheus.CounterOpts{Name: "purge"}, []string{"success"}),
+		LogReporter{log.NewNopLogger()},
+	)
+	c.moveToCold()
+	c.wg.Wait()
+
+	// The moved segments are in the cold store, and listed, and gone from
+	// disk, sidecars and all.
+	if want, have := 2, len(store.Keys()); want != have {
+		t.Fatalf("want %d cold segments, have %d: %v", want, have, store.Keys())
+	}
+	if want, have := 2., counterValue(moved.WithLabelValues("true")); want != have {
+		t.Errorf("want %v segments moved, have %v", want, have)
+	}
+	coldNames := map[string]bool{}
+	for _, key := range store.Keys() {
+		coldNames[basename(key)] = true
+	}
+	var left []string
+	filesys.Walk("/", func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && filepath.Dir(path) == "/" && coldNames[basename(path)] {
+			left = append(left, path)
+		}
+		return nil
+	})
+	if len(left) > 0 {
+		t.Errorf("want moved segments gone from disk, have %v", left)
+	}
+
+	query := func(from, to time.Time) (records []byte, cold int) {
+		result, err := filelog.Query(context.Background(), QueryParams{
+			From: ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(from), nil)},
+			To:   ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(to), nil)},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer result.Records.Close()
+		records, err = ioutil.ReadAll(result.Records)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return records, result.ColdSegments
+	}
+
+	// Queries read cold segments, through the cache, in order with the
+	// rest, and say how many they read.
+	records, cold := query(t0.Add(-time.Minute), time.Now())
+	if want, have := 6, bytes.Count(records, []byte{'\n'}); want != have {
+		t.Fatalf("want %d records, have %d: %q", want, have, records)
+	}
+	for i := 0; i < 6; i++ {
+		if want := fmt.Sprintf("record %d\n", i); !bytes.Contains(records, []byte(want)) {
+			t.Errorf("want %q, have %q", want, records)
+		}
+	}
+	if want, have := 2, cold; want != have {
+		t.Errorf("want %d cold segments queried, have %d", want, have)
+	}
+	if _, cold := query(t0.Add(90*time.Second), time.Now()); cold != 0 {
+		t.Errorf("want no cold segments queried, have %d", cold)
+	}
+	query(t0.Add(-time.Minute), t0.Add(30*time.Second))
+	if want, have := 2, store.Gets(); want != have {
+		t.Errorf("want %d cold segments fetched, have %d", want, have)
+	}
+	for _, testcase := range []struct {
+		result string
+		want   float64
+	}{
+		{"miss", 2},
+		{"hit", 1},
+		{"error", 0},
+	} {
+		if have := counterValue(fetched.WithLabelValues(testcase.result)); testcase.want != have {
+			t.Errorf("%s: want %v fetches, have %v", testcase.result, testcase.want, have)
+		}
+	}
+
+	// They're stored, and cached, as compacted segments are, compressed,
+	// and the cache is charged for their records.
+	for _, key := range store.Keys() {
+		rc, err := store.Get(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		object, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		if !isCompressed(bufio.NewReader(bytes.NewReader(object))) {
+			t.Errorf("%s: want a compressed segment, have %q", key, object)
+		}
+		f, err := filesys.Open(tier.cachePath(basename(key)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isCompressed(bufio.NewReader(f)) {
+			t.Errorf("%s: want a compressed cached segment", key)
+		}
+		f.Close()
+	}
+	if want, have := 144., gaugeValue(cached); want != have {
+		t.Errorf("want %v bytes cached, have %v", want, have)
+	}
+
+	// On restart, the manifest and the cache are as they were, but for
+	// leftovers of fetches cut short.
+	f, err := filesys.Create("/cold/stray.download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	restarted := newTier()
+	if segments, total := restarted.overlapping(ulid.ULID{}, ulidutil.Max(ulid.MaxTime())); len(segments) != 2 || total != 2 {
+		t.Errorf("restarted: want 2 cold segments, have %d of %d", len(segments), total)
+	}
+	if want, have := 2, restarted.lru.Len(); want != have {
+		t.Errorf("restarted: want %d cached segments, have %d", want, have)
+	}
+	if filesys.Exists("/cold/stray.download") {
+		t.Errorf("restarted: want the download removed, but it's still there")
+	}
+
+	// Retention applies to the cold tier, too.
+	if want, have := 1, tier.expire(context.Background(), t0.Add(30*time.Second)); want != have {
+		t.Errorf("want %d cold segment expired, have %d", want, have)
+	}
+	if want, have := 1, len(store.Keys()); want != have {
+		t.Errorf("after retention: want %d cold segment, have %d", want, have)
+	}
+	if records, _ := query(t0.Add(-time.Minute), time.Now()); bytes.Contains(records, []byte("record 0\n")) {
+		t.Errorf("after retention: want record 0 gone, have %q", records)
+	}
+}
+
+func TestColdTierEviction(t *testing.T) {
+	t.Parallel()
+
+	filesys := fs.NewVirtualFilesystem()
+	tier, err := NewColdTier(
+		filesys, "/", NewMemColdStore(), 100,
+		prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"success"}),
+		prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"result"}),
+		prometheus.NewGauge(prometheus.GaugeOpts{}),
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var segments []coldSegment
+	for i := 0; i < 3; i++ {
+		low := ulid.MustNew(uint64(i*1000), nil)
+		high := ulid.MustNew(uint64(i*1000+1), nil)
+		name := fmt.Sprintf("%s-%s", low, high)
+		var buf bytes.Buffer
+		zw, err := newCompressWriter(&buf, 60)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw.Write(bytes.Repeat([]byte{'a'}, 60))
+		zw.Close()
+		if err := tier.store.Put(context.Background(), name+extColdZstd, &buf, int64(buf.Len())); err != nil {
+			t.Fatal(err)
+		}
+		segments = append(segments, coldSegment{Name: name, low: low, high: high})
+	}
+
+	// A segment being read isn't evicted, even past the cache's size.
+	first, err := tier.fetch(context.Background(), filesys, segments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := tier.fetch(context.Background(), filesys, segments[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := int64(120), tier.size; want != have {
+		t.Errorf("want %d bytes cached, have %d", want, have)
+	}
+	first.Close()
+	if want, have := int64(60), tier.size; want != have {
+		t.Errorf("closed: want %d bytes cached, have %d", want, have)
+	}
+	if filesys.Exists(tier.cachePath(segments[0].Name)) {
+		t.Errorf("want the least recently used segment evicted, but it's still there")
+	}
+	second.Close()
+
+	// Nor is a segment that's not in the cold store cached.
+	if _, err := tier.fetch(context.Background(), filesys, coldSegment{Name: "missing"}); err == nil {
+		t.Errorf("want an error fetching a missing segment, have none")
+	}
+	if _, ok := tier.entries["missing"]; ok {
+		t.Errorf("want the missing segment dropped from the cache, but it's still there")
+	}
+}
+
+func TestQueryResultColdSegments(t *testing.T) {
+	t.Parallel()
+
+	var (
+		w    = httptest.NewRecorder()
+		from ulidOrTime
+		to   ulidOrTime
+	)
+	from.Parse("-1h")
+	to.Parse("now")
+	result := QueryResult{Params: QueryParams{From: from, To: to}, NodesQueried: 1, ColdSegments: 3}
+	result.encodeHeaders(w)
+	if want, have := "3", w.Header().Get(httpHeaderColdSegments); want != have {
+		t.Fatalf("want %s header %q, have %q", httpHeaderColdSegments, want, have)
+	}
+
+	var decoded QueryResult
+	if err := decoded.DecodeFrom(&http.Response{Header: w.Header(), Body: ioutil.NopCloser(strings.NewReader(""))}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 3, decoded.ColdSegments; want != have {
+		t.Errorf("decoded: want %d, have %d", want, have)
+	}
+	if err := decoded.Merge(QueryResult{ColdSegments: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 5, decoded.ColdSegments; want != have {
+		t.Errorf("merged: want %d, have %d", want, have)
+	}
+}
@@ -1,9 +1,13 @@
 package store
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -11,36 +15,87 @@ import (
 
 // Compacter is responsible for all post-flush segment mutation. That includes
 // compacting highly-overlapping segments, compacting small and sequential
-// segments, and enforcing the retention window.
+// segments, moving old segments to the cold tier, and enforcing the retention
+// window and size.
 type Compacter struct {
 	log               Log
 	segmentTargetSize int64
+	planners          []CompactionPlanner
 	retain            time.Duration
+	retainSize        int64
+	trashImported     bool
 	purge             time.Duration
+	cold              *ColdTier
+	coldAge           time.Duration
+	throttle          *throttle
 	stop              chan chan struct{}
+	ctx               context.Context // canceled on Stop
+	cancel            context.CancelFunc
+	wg                sync.WaitGroup // running and queued compactions
+	choose            sync.Mutex     // serializes the choice of segments
+	mtx               sync.Mutex     // protects the following, and retain and retainSize
+	queued            int
+	running           int
+	tiering           bool // segments are being moved to the cold tier
+	concurrency       int
+	freed             chan struct{} // closed when a slot is freed, or added
 	compactDuration   *prometheus.HistogramVec
+	compactBytes      *prometheus.CounterVec
+	compactQueue      prometheus.Gauge
 	trashSegments     *prometheus.CounterVec
 	purgeSegments     *prometheus.CounterVec
 	reporter          EventReporter
 }
 
 // NewCompacter creates a Compacter.
+// Compactions are planned by each of the planners in turn, or if there are
+// none, by DefaultCompactionPlanners, and write segments of segmentTargetSize.
+// If retainSize is greater than zero, the oldest segments are trashed whenever
+// the untrashed segments take more than that many bytes, whatever their age.
+// Imported segments are left alone by both, unless trashImported is true.
+// If cold isn't nil, and coldAge is greater than zero, segments whose newest
+// record is older than that are moved to the cold tier, which retention then
+// applies to, too.
+// Up to concurrency compactions run at once, and together, they read and
+// write at most bytesPerSecond, unless it's zero.
 // Don't forget to Run it.
 func NewCompacter(
 	log Log,
-	segmentTargetSize int64, retain time.Duration, purge time.Duration,
-	compactDuration *prometheus.HistogramVec, trashSegments, purgeSegments *prometheus.CounterVec,
+	segmentTargetSize int64, planners []CompactionPlanner, retain time.Duration, retainSize int64, trashImported bool, purge time.Duration,
+	cold *ColdTier, coldAge time.Duration,
+	concurrency int, bytesPerSecond int64,
+	compactDuration *prometheus.HistogramVec, compactBytes *prometheus.CounterVec, compactQueue prometheus.Gauge,
+	trashSegments, purgeSegments *prometheus.CounterVec,
 	reporter EventReporter,
 ) *Compacter {
+	if len(planners) == 0 {
+		planners = DefaultCompactionPlanners(segmentTargetSize)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Compacter{
 		log:               log,
 		segmentTargetSize: segmentTargetSize,
+		planners:          planners,
 		retain:            retain,
+		retainSize:        retainSize,
+		trashImported:     trashImported,
 		purge:             purge,
+		cold:              cold,
+		coldAge:           coldAge,
+		throttle:          newThrottle(bytesPerSecond),
+		concurrency:       concurrency,
+		freed:             make(chan struct{}),
 		stop:              make(chan chan struct{}),
+		ctx:               ctx,
+		cancel:            cancel,
 		trashSegments:     trashSegments,
 		purgeSegments:     purgeSegments,
 		compactDuration:   compactDuration,
+		compactBytes:      compactBytes,
+		compactQueue:      compactQueue,
 		reporter:          reporter,
 	}
 }
@@ -48,12 +103,18 @@ func NewCompacter(
 // Run performs compactions and cleanups.
 // Run returns when Stop is invoked.
 func (c *Compacter) Run() {
-	ops := []func(){
-		func() { c.compact("Overlapping", c.log.Overlapping) },
-		func() { c.compact("Sequential", c.log.Sequential) },
+	var ops []func()
+	for _, planner := range c.planners {
+		planner := planner
+		ops = append(ops, func() {
+			c.schedule(planner.Kind(), func() ([]ReadSegment, error) { return c.log.Compactable(planner) })
+		})
+	}
+	ops = append(ops,
 		func() { c.moveToTrash() },
+		func() { c.moveToCold() },
 		func() { c.emptyTrash() },
-	}
+	)
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
 	for {
@@ -63,6 +124,8 @@ func (c *Compacter) Run() {
 			ops = append(ops[1:], ops[0]) // shift
 
 		case q := <-c.stop:
+			c.cancel() // interrupts throttled and paused compactions
+			c.wg.Wait()
 			close(q)
 			return
 		}
@@ -82,6 +145,74 @@ func (c *Compacter) Stop() {
 	<-q
 }
 
+// schedule a compaction to run as soon as there's a free slot. At most one
+// compaction per slot waits, so a backlog doesn't queue up without bound.
+func (c *Compacter) schedule(kind string, getSegments func() ([]ReadSegment, error)) {
+	c.mtx.Lock()
+	if c.queued >= c.concurrency {
+		c.mtx.Unlock()
+		return
+	}
+	c.queued++
+	c.compactQueue.Set(float64(c.queued))
+	c.mtx.Unlock()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		err := c.acquire()
+		c.mtx.Lock()
+		c.queued--
+		c.compactQueue.Set(float64(c.queued))
+		c.mtx.Unlock()
+		if err != nil {
+			return
+		}
+		defer c.release()
+
+		// Don't pick segments while paused; they'd sit in the reading state.
+		if err := c.throttle.wait(c.ctx, 0); err != nil {
+			return
+		}
+		c.compact(kind, getSegments)
+	}()
+}
+
+// acquire waits for a free slot, and takes it. It returns an error if the
+// compacter is stopped first.
+func (c *Compacter) acquire() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for c.running >= c.concurrency {
+		freed := c.freed
+		c.mtx.Unlock()
+		select {
+		case <-freed:
+		case <-c.ctx.Done():
+		}
+		c.mtx.Lock()
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	c.running++
+	return nil
+}
+
+// release the slot of a compaction.
+func (c *Compacter) release() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.running--
+	c.wake()
+}
+
+// wake the compactions waiting for a slot. The mutex must be held.
+func (c *Compacter) wake() {
+	close(c.freed)
+	c.freed = make(chan struct{})
+}
+
 func (c *Compacter) compact(kind string, getSegments func() ([]ReadSegment, error)) (compacted int, result string) {
 	defer func(begin time.Time) {
 		c.compactDuration.WithLabelValues(
@@ -91,8 +222,11 @@ func (c *Compacter) compact(kind string, getSegments func() ([]ReadSegment, erro
 		).Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	// Fetch the segments that can be compacted.
+	// Fetch the segments that can be compacted. Concurrent compactions
+	// take turns, so they don't fight over the same segments.
+	c.choose.Lock()
 	readSegments, err := getSegments()
+	c.choose.Unlock()
 	if err == ErrNoSegmentsAvailable {
 		return 0, "NoSegmentsAvailable" // no problem
 	}
@@ -119,11 +253,18 @@ func (c *Compacter) compact(kind string, getSegments func() ([]ReadSegment, erro
 	// Merge and write all of the read segments into the log.
 	// It may create multiple segments, if it's too much data.
 	// That's why we use the specialized mergeRecordsToLog.
-	readers := make([]io.Reader, len(readSegments))
+	// Reads and writes are throttled, to leave disk bandwidth for queries.
+	// The merged segments keep the union of the read segments' origins.
+	var (
+		readers = make([]io.Reader, len(readSegments))
+		origins = make([][]string, len(readSegments))
+	)
 	for i, readSegment := range readSegments {
-		readers[i] = readSegment
+		readers[i] = throttledReader{c.ctx, c.throttle, c.compactBytes.WithLabelValues("read"), readSegment}
+		origins[i] = readSegment.Origins()
 	}
-	if _, err := mergeRecordsToLog(c.log, c.segmentTargetSize, readers...); err != nil {
+	dst := throttledLog{originLog{c.log, mergeOrigins(origins...)}, c.ctx, c.throttle, c.compactBytes.WithLabelValues("write")}
+	if _, err := mergeRecordsToLog(dst, c.segmentTargetSize, readers...); err != nil {
 		c.reporter.ReportEvent(Event{
 			Op: "compact", Error: err,
 			Msg: fmt.Sprintf("compact %s failed during mergeRecordsToLog", kind),
@@ -152,15 +293,91 @@ func (c *Compacter) compact(kind string, getSegments func() ([]ReadSegment, erro
 }
 
 func (c *Compacter) moveToTrash() {
-	oldestRecord := time.Now().Add(-c.retain)
-	readSegments, err := c.log.Trashable(oldestRecord)
+	// Both retention policies apply; whichever selects a segment first
+	// trashes it. Size goes last, so it only counts what age leaves behind.
+	c.mtx.Lock()
+	retain, retainSize := c.retain, c.retainSize
+	c.mtx.Unlock()
+	oldestRecord := time.Now().Add(-retain)
+	c.trash("age", func() ([]ReadSegment, error) { return c.log.Trashable(oldestRecord, c.trashImported) })
+	if retainSize > 0 {
+		c.trash("size", func() ([]ReadSegment, error) { return c.log.TrashableBySize(retainSize, c.trashImported) })
+	}
+	if n := c.cold.expire(c.ctx, oldestRecord); n > 0 {
+		c.reporter.ReportEvent(Event{
+			Op:  "moveToTrash",
+			Msg: fmt.Sprintf("deleted %d cold segment(s) by age retention policy", n),
+		})
+	}
+}
+
+// moveToCold moves the segments older than the cold age to the cold tier, in
+// the background, as uploads may be slow. Only one batch moves at a time.
+func (c *Compacter) moveToCold() {
+	if c.cold == nil || c.coldAge <= 0 {
+		return
+	}
+	c.mtx.Lock()
+	if c.tiering {
+		c.mtx.Unlock()
+		return
+	}
+	c.tiering = true
+	c.mtx.Unlock()
+
+	c.choose.Lock()
+	readSegments, err := c.log.Trashable(time.Now().Add(-c.coldAge), c.trashImported)
+	c.choose.Unlock()
+	if err != nil {
+		if err != ErrNoSegmentsAvailable {
+			c.reporter.ReportEvent(Event{
+				Op: "moveToCold", Error: err,
+				Msg: "fetching read segments to move failed",
+			})
+		}
+		c.mtx.Lock()
+		c.tiering = false
+		c.mtx.Unlock()
+		return
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer func() {
+			c.mtx.Lock()
+			c.tiering = false
+			c.mtx.Unlock()
+		}()
+		for _, segment := range readSegments {
+			// Uploads read the segment like compactions do, throttled.
+			r := throttledReader{c.ctx, c.throttle, c.compactBytes.WithLabelValues("read"), segment}
+			if err := c.cold.move(c.ctx, segment, r); err != nil {
+				c.reporter.ReportEvent(Event{
+					Op: "moveToCold", File: segment.Name(), Error: err,
+					Msg: "Moving a read segment to the cold tier failed",
+				})
+				continue
+			}
+			c.reporter.ReportEvent(Event{
+				Op: "moveToCold", File: segment.Name(),
+				Msg: "moved to the cold tier",
+			})
+		}
+	}()
+}
+
+func (c *Compacter) trash(policy string, getSegments func() ([]ReadSegment, error)) {
+	c.choose.Lock()
+	readSegments, err := getSegments()
+	c.choose.Unlock()
 	if err == ErrNoSegmentsAvailable {
 		return // no problem
 	}
 	if err != nil {
 		c.reporter.ReportEvent(Event{
 			Op: "moveToTrash", Error: err,
-			Msg: "fetching Trashable read segments failed",
+			Msg: fmt.Sprintf("fetching read segments to trash by %s failed", policy),
 		})
 		return
 	}
@@ -168,25 +385,37 @@ func (c *Compacter) moveToTrash() {
 		if err := segment.Trash(); err != nil {
 			// We can't do anything but log the error.
 			c.reporter.ReportEvent(Event{
-				Op: "moveToTrash", Error: err,
+				Op: "moveToTrash", File: segment.Name(), Error: err,
 				Msg: "Trashing a read segment failed",
 			})
+			c.trashSegments.WithLabelValues("false").Inc()
+			continue
 		}
+		c.reporter.ReportEvent(Event{
+			Op: "moveToTrash", File: segment.Name(),
+			Msg: fmt.Sprintf("trashed by %s retention policy", policy),
+		})
+		c.trashSegments.WithLabelValues("true").Inc()
 	}
 }
 
 func (c *Compacter) emptyTrash() {
-	oldestModTime := time.Now().Add(-c.purge)
+	c.purgeTrash(time.Now().Add(-c.purge))
+}
+
+// purgeTrash purges the segments trashed before oldestModTime, and returns
+// how many it purged.
+func (c *Compacter) purgeTrash(oldestModTime time.Time) (purged int) {
 	trashSegments, err := c.log.Purgeable(oldestModTime)
 	if err == ErrNoSegmentsAvailable {
-		return // no problem
+		return 0 // no problem
 	}
 	if err != nil {
 		c.reporter.ReportEvent(Event{
 			Op: "emptyTrash", Error: err,
 			Msg: "fetching Purgeable segments failed",
 		})
-		return
+		return 0
 	}
 	for _, segment := range trashSegments {
 		if err := segment.Purge(); err != nil {
@@ -195,6 +424,56 @@ func (c *Compacter) emptyTrash() {
 				Op: "emptyTrash", Error: err,
 				Msg: "Purging a read segment failed",
 			})
+			c.purgeSegments.WithLabelValues("false").Inc()
+			continue
 		}
+		c.purgeSegments.WithLabelValues("true").Inc()
+		purged++
+	}
+	return purged
+}
+
+// CompactStatus is the state of a node's compactions, as served by the
+// compaction admin API.
+type CompactStatus struct {
+	Paused         bool  `json:"paused"`
+	Running        int   `json:"running"`
+	Queued         int   `json:"queued"`
+	Concurrency    int   `json:"concurrency"`
+	BytesPerSecond int64 `json:"bytes_per_second"`
+}
+
+// ServeHTTP serves the compaction admin API: GET for the status, and POST to
+// /pause or /resume compactions, e.g. to shed load during incidents. Paused
+// compactions stop where they are, and pick up again when resumed.
+func (c *Compacter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/pause":
+		c.throttle.pause()
+		c.reporter.ReportEvent(Event{Op: "compact", Msg: "paused"})
+	case r.Method == "POST" && r.URL.Path == "/resume":
+		c.throttle.unpause()
+		c.reporter.ReportEvent(Event{Op: "compact", Msg: "resumed"})
+	case r.Method == "GET" && (r.URL.Path == "" || r.URL.Path == "/"):
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	c.mtx.Lock()
+	queued, running, concurrency := c.queued, c.running, c.concurrency
+	c.mtx.Unlock()
+	buf, err := json.MarshalIndent(CompactStatus{
+		Paused:         c.throttle.isPaused(),
+		Running:        running,
+		Queued:         queued,
+		Concurrency:    concurrency,
+		BytesPerSecond: c.throttle.rate(),
+	}, "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(buf)
 }
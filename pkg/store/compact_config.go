@@ -0,0 +1,159 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CompactConfig is the part of a Compacter's configuration that can be
+// changed while it runs: the retention window and size, how many compactions
+// run at once, and how many bytes per second they read and write, together,
+// or zero, for no limit.
+type CompactConfig struct {
+	Retain         time.Duration
+	RetainSize     int64
+	Concurrency    int
+	BytesPerSecond int64
+}
+
+// Validate returns an error if the config can't be applied.
+func (cfg CompactConfig) Validate() error {
+	switch {
+	case cfg.Retain <= 0:
+		return errors.New("retain must be positive")
+	case cfg.RetainSize < 0:
+		return errors.New("retain_size can't be negative")
+	case cfg.Concurrency < 1:
+		return errors.New("concurrency must be at least 1")
+	case cfg.BytesPerSecond < 0:
+		return errors.New("bytes_per_second can't be negative")
+	}
+	return nil
+}
+
+// MarshalJSON encodes the retention window as a duration string, like 168h0m0s.
+func (cfg CompactConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(compactConfigJSON{
+		Retain:         cfg.Retain.String(),
+		RetainSize:     cfg.RetainSize,
+		Concurrency:    cfg.Concurrency,
+		BytesPerSecond: cfg.BytesPerSecond,
+	})
+}
+
+// UnmarshalJSON decodes what MarshalJSON encodes. Fields that are missing keep
+// their values, so a partial config updates cfg.
+func (cfg *CompactConfig) UnmarshalJSON(buf []byte) error {
+	v := compactConfigJSON{
+		Retain:         cfg.Retain.String(),
+		RetainSize:     cfg.RetainSize,
+		Concurrency:    cfg.Concurrency,
+		BytesPerSecond: cfg.BytesPerSecond,
+	}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return err
+	}
+	retain, err := time.ParseDuration(v.Retain)
+	if err != nil {
+		return fmt.Errorf("retain: %v", err)
+	}
+	*cfg = CompactConfig{
+		Retain:         retain,
+		RetainSize:     v.RetainSize,
+		Concurrency:    v.Concurrency,
+		BytesPerSecond: v.BytesPerSecond,
+	}
+	return nil
+}
+
+type compactConfigJSON struct {
+	Retain         string `json:"retain"`
+	RetainSize     int64  `json:"retain_size"`
+	Concurrency    int    `json:"concurrency"`
+	BytesPerSecond int64  `json:"bytes_per_second"`
+}
+
+// Config returns the effective config of the compacter.
+func (c *Compacter) Config() CompactConfig {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return CompactConfig{
+		Retain:         c.retain,
+		RetainSize:     c.retainSize,
+		Concurrency:    c.concurrency,
+		BytesPerSecond: c.throttle.rate(),
+	}
+}
+
+// SetConfig validates the config, and applies all of it, or, if it's invalid,
+// none of it. A new retention window or size applies from the next retention
+// pass; a new rate, from the next read or write of running compactions.
+// Lowering the concurrency doesn't stop compactions that are running, but new
+// ones wait until fewer are.
+func (c *Compacter) SetConfig(cfg CompactConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	c.mtx.Lock()
+	c.retain, c.retainSize = cfg.Retain, cfg.RetainSize
+	c.throttle.setRate(cfg.BytesPerSecond)
+	if cfg.Concurrency != c.concurrency {
+		c.concurrency = cfg.Concurrency
+		c.wake()
+	}
+	c.mtx.Unlock()
+	c.reporter.ReportEvent(Event{
+		Op: "SetConfig",
+		Msg: fmt.Sprintf(
+			"retain %s, retain size %d, concurrency %d, bytes per second %d",
+			cfg.Retain, cfg.RetainSize, cfg.Concurrency, cfg.BytesPerSecond,
+		),
+	})
+	return nil
+}
+
+// ConfigHandler serves the config admin API: GET returns the effective config,
+// as JSON, and PUT applies a new one, from a JSON body with any of retain, a
+// duration like 24h, retain_size, concurrency, and bytes_per_second. Fields
+// that are missing keep their values. Invalid configs are refused, and none of
+// them is applied.
+func (c *Compacter) ConfigHandler() http.Handler {
+	var mtx sync.Mutex // serializes PUTs, so none is lost between Config and SetConfig
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "" && r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case "GET":
+		case "PUT":
+			mtx.Lock()
+			defer mtx.Unlock()
+			cfg := c.Config()
+			if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := c.SetConfig(cfg); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		buf, err := json.MarshalIndent(c.Config(), "", "    ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(buf)
+	})
+}
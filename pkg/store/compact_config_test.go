@@ -0,0 +1,158 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestCompacterConfigRetain(t *testing.T) {
+	t.Parallel()
+
+	filelog, err := NewFileLog(fs.NewVirtualFilesystem(), "/", 1024, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+	var (
+		reporter = &eventRecorder{}
+		c        = NewCompacter(
+			filelog, 1024, nil, 7*24*time.Hour, 0, false, time.Hour, nil, 0, 1, 0,
+			prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "compact"}, []string{"kind", "compacted", "result"}),
+			prometheus.NewCounterVec(prometheus.CounterOpts{Name: "bytes"}, []string{"direction"}),
+			prometheus.NewGauge(prometheus.GaugeOpts{Name: "queue"}),
+			prometheus.NewCounterVec(prometheus.CounterOpts{Name: "trash"}, []string{"success"}),
+			prometheus.NewCounterVec(prometheus.CounterOpts{Name: "purge"}, []string{"success"}),
+			reporter,
+		)
+		server = httptest.NewServer(c.ConfigHandler())
+	)
+	defer server.Close()
+
+	// A segment from a day ago is within 7d of retention.
+	id := ulid.MustNew(ulid.Timestamp(time.Now().Add(-24*time.Hour)), nil)
+	segment, err := filelog.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(segment, "%s record\n", id)
+	if err := segment.Close(id, id); err != nil {
+		t.Fatal(err)
+	}
+	c.moveToTrash()
+	if have := reporter.trashed(); len(have) != 0 {
+		t.Fatalf("with 7d of retention: want nothing trashed, have %v", have)
+	}
+
+	// Once retention is down to 1h, the next pass trashes it.
+	cfg := putConfig(t, server.URL, `{"retain": "1h"}`, http.StatusOK)
+	if want, have := (CompactConfig{Retain: time.Hour, Concurrency: 1}), cfg; want != have {
+		t.Errorf("config: want %+v, have %+v", want, have)
+	}
+	c.moveToTrash()
+	want := map[string]string{fmt.Sprintf("/%s-%s%s", id, id, extReading): "age"}
+	if have := reporter.trashed(); !reflect.DeepEqual(want, have) {
+		t.Errorf("with 1h of retention: want %v, have %v", want, have)
+	}
+}
+
+func TestCompacterConfigInvalid(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCompacter(nil, 1000, &eventRecorder{})
+	server := httptest.NewServer(c.ConfigHandler())
+	defer server.Close()
+
+	// Updates with any invalid value are refused, and none of them applies.
+	want := c.Config()
+	for _, body := range []string{
+		`{"retain": "1h", "concurrency": 0}`,
+		`{"retain": "0s"}`,
+		`{"retain": "soon"}`,
+		`{"retain_size": -1, "bytes_per_second": 10}`,
+		`{"bytes_per_second": -1}`,
+		`not json`,
+	} {
+		putConfig(t, server.URL, body, http.StatusBadRequest)
+		if have := c.Config(); want != have {
+			t.Errorf("%s: want %+v, have %+v", body, want, have)
+		}
+	}
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var have CompactConfig
+	if err := json.NewDecoder(resp.Body).Decode(&have); err != nil {
+		t.Fatal(err)
+	}
+	if want != have {
+		t.Errorf("GET: want %+v, have %+v", want, have)
+	}
+}
+
+func TestCompacterConfigConcurrency(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCompacter(nil, 0, &eventRecorder{})
+	defer c.cancel()
+	if err := c.acquire(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A compaction waiting for a slot takes one as soon as there are more.
+	acquired := make(chan error, 1)
+	go func() { acquired <- c.acquire() }()
+	select {
+	case err := <-acquired:
+		t.Fatalf("acquired a second slot of one: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	cfg := c.Config()
+	cfg.Concurrency = 2
+	if err := c.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the second slot")
+	}
+}
+
+func putConfig(t *testing.T, url, body string, code int) (cfg CompactConfig) {
+	t.Helper()
+	req, err := http.NewRequest("PUT", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if want, have := code, resp.StatusCode; want != have {
+		t.Fatalf("PUT %s: want %d, have %d", body, want, have)
+	}
+	if code == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg
+}
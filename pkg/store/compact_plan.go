@@ -0,0 +1,182 @@
+package store
+
+import (
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+// FlushedSegment describes a flushed segment, for planning compactions.
+type FlushedSegment struct {
+	Path      string
+	Low, High ulid.ULID
+	Size      int64 // logical, i.e. uncompressed
+}
+
+// CompactionPlanner plans compactions. It chooses the segments to merge from
+// their descriptions alone, so it doesn't touch the disk. A Compacter runs its
+// planners in turn; see NewCompacter.
+type CompactionPlanner interface {
+	// Kind of compaction planned, e.g. "Overlapping", for metrics and events.
+	Kind() string
+
+	// Plan returns the paths of segments to merge together, chosen from the
+	// flushed segments, which are ordered by their oldest record. It returns
+	// none if no merge is worth it yet.
+	Plan(segments []FlushedSegment) []string
+}
+
+// DefaultCompactionPlanners returns the planners of the segment with the most
+// overlap, if it's at least three, and of runs of small sequential segments,
+// up to segmentTargetSize, which is how segments have always been compacted.
+func DefaultCompactionPlanners(segmentTargetSize int64) []CompactionPlanner {
+	return []CompactionPlanner{
+		NewOverlappingPlanner(3),
+		NewSequentialPlanner(segmentTargetSize),
+	}
+}
+
+// NewOverlappingPlanner returns a planner of the segment which overlaps the
+// most others, along with them, as long as that's at least minimum segments.
+func NewOverlappingPlanner(minimum int) CompactionPlanner {
+	return overlappingPlanner{minimum}
+}
+
+type overlappingPlanner struct {
+	minimum int
+}
+
+func (p overlappingPlanner) Kind() string { return "Overlapping" }
+
+func (p overlappingPlanner) Plan(segments []FlushedSegment) []string {
+	// We make a simple n-squared algorithm for now.
+	// For each segment, compare against all other segments, and keep the
+	// one with the most overlap. It and all of its overlapping friends
+	// become our candidates.
+	var candidates []string
+	for i, a := range segments {
+		overlaps := []string{a.Path}
+		for j, b := range segments {
+			if i == j {
+				continue // we will overlap with ourselves, natch
+			}
+			if overlap(a.Low, a.High, b.Low, b.High) {
+				overlaps = append(overlaps, b.Path)
+			}
+		}
+		if len(overlaps) > len(candidates) {
+			candidates = overlaps
+		}
+	}
+
+	// The most overlap may still not be enough.
+	if len(candidates) < p.minimum {
+		return nil
+	}
+	return candidates
+}
+
+// NewSequentialPlanner returns a planner of the first run of at least two
+// segments which, together, are no bigger than targetSize.
+func NewSequentialPlanner(targetSize int64) CompactionPlanner {
+	return sequentialPlanner{targetSize}
+}
+
+type sequentialPlanner struct {
+	targetSize int64
+}
+
+func (p sequentialPlanner) Kind() string { return "Sequential" }
+
+func (p sequentialPlanner) Plan(segments []FlushedSegment) []string {
+	const minimumSegments = 2
+	segmentInfos := make([]segmentInfo, len(segments))
+	for i, segment := range segments {
+		segmentInfos[i] = segmentInfo{segment.Low.String(), segment.Path, segment.Size}
+	}
+	candidates := chooseFirstSequential(segmentInfos, minimumSegments, p.targetSize)
+	if len(candidates) < minimumSegments {
+		return nil
+	}
+	return candidates
+}
+
+// NewSizeTieredPlanner returns a planner which sorts segments smaller than
+// targetSize into tiers, each fanout times smaller than the one above. The
+// first tier is from targetSize/fanout up to targetSize, and so on. Once a
+// tier has fanout segments, the oldest are merged, which takes them up a
+// tier, or more. Segments of targetSize or more are never merged again, so
+// a large targetSize and fanout make for large segments, rarely merged, and
+// small ones make for many small merges. fanout must be at least 2.
+func NewSizeTieredPlanner(fanout int, targetSize int64) CompactionPlanner {
+	return sizeTieredPlanner{fanout, targetSize}
+}
+
+type sizeTieredPlanner struct {
+	fanout     int
+	targetSize int64
+}
+
+func (p sizeTieredPlanner) Kind() string { return "SizeTiered" }
+
+func (p sizeTieredPlanner) Plan(segments []FlushedSegment) []string {
+	tiers := map[int][]string{}
+	for _, segment := range segments {
+		if segment.Size >= p.targetSize {
+			continue // big enough already
+		}
+		var tier int
+		for floor := p.targetSize / int64(p.fanout); segment.Size < floor; floor /= int64(p.fanout) {
+			tier++
+		}
+		tiers[tier] = append(tiers[tier], segment.Path)
+		if len(tiers[tier]) >= p.fanout {
+			return tiers[tier]
+		}
+	}
+	return nil
+}
+
+// NewTimeWindowPlanner returns a planner which only merges segments within
+// the same window of time, e.g. the same hour or day, so segments never span
+// more than one window, and a window's segments are retained together. A
+// segment belongs to the window of its oldest record. The segments smaller
+// than targetSize in the oldest window with at least two of them are merged,
+// however many there are.
+func NewTimeWindowPlanner(window time.Duration, targetSize int64) CompactionPlanner {
+	return timeWindowPlanner{window, targetSize}
+}
+
+type timeWindowPlanner struct {
+	window     time.Duration
+	targetSize int64
+}
+
+func (p timeWindowPlanner) Kind() string { return "TimeWindow" }
+
+func (p timeWindowPlanner) Plan(segments []FlushedSegment) []string {
+	const minimumSegments = 2
+	var (
+		candidates []string
+		current    time.Time
+	)
+	for _, segment := range segments {
+		window := ulidutil.TimeOf(segment.Low).Truncate(p.window)
+		if !window.Equal(current) {
+			if len(candidates) >= minimumSegments {
+				break
+			}
+			candidates, current = nil, window
+		}
+		if segment.Size >= p.targetSize {
+			continue // big enough already
+		}
+		candidates = append(candidates, segment.Path)
+	}
+	if len(candidates) < minimumSegments {
+		return nil
+	}
+	return candidates
+}
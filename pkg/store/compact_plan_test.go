@@ -0,0 +1,121 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+func TestCompactionPlanners(t *testing.T) {
+	t.Parallel()
+
+	// Segments are described by their name, the minutes of their oldest and
+	// newest records, past midnight, and their size.
+	t0 := time.Date(2017, 3, 14, 0, 0, 0, 0, time.UTC)
+	segment := func(name string, low, high int, size int64) FlushedSegment {
+		return FlushedSegment{
+			Path: name,
+			Low:  ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(low)*time.Minute)), nil),
+			High: ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(high)*time.Minute)), nil),
+			Size: size,
+		}
+	}
+
+	for _, testcase := range []struct {
+		name     string
+		planner  CompactionPlanner
+		segments []FlushedSegment
+		want     []string
+	}{
+		{
+			name:    "overlapping",
+			planner: NewOverlappingPlanner(3),
+			segments: []FlushedSegment{
+				segment("a", 0, 10, 100),
+				segment("b", 5, 15, 100),
+				segment("c", 8, 20, 100),
+				segment("d", 30, 40, 100),
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name:    "too little overlap",
+			planner: NewOverlappingPlanner(3),
+			segments: []FlushedSegment{
+				segment("a", 0, 10, 100),
+				segment("b", 5, 15, 100),
+				segment("c", 20, 30, 100),
+			},
+			want: nil,
+		},
+		{
+			name:    "sequential",
+			planner: NewSequentialPlanner(250),
+			segments: []FlushedSegment{
+				segment("a", 0, 1, 300),
+				segment("b", 2, 3, 100),
+				segment("c", 4, 5, 100),
+				segment("d", 6, 7, 100),
+			},
+			want: []string{"b", "c"},
+		},
+		{
+			name:    "size-tiered, first full tier",
+			planner: NewSizeTieredPlanner(2, 1000),
+			segments: []FlushedSegment{
+				segment("a", 0, 1, 1000), // done
+				segment("b", 2, 3, 600),  // [500, 1000)
+				segment("c", 4, 5, 100),  // [62, 125)
+				segment("d", 6, 7, 300),  // [250, 500)
+				segment("e", 8, 9, 110),  // [62, 125)
+				segment("f", 10, 11, 700),
+			},
+			want: []string{"c", "e"},
+		},
+		{
+			name:    "size-tiered, no full tier",
+			planner: NewSizeTieredPlanner(4, 1000),
+			segments: []FlushedSegment{
+				segment("a", 0, 1, 600),
+				segment("b", 2, 3, 100),
+				segment("c", 4, 5, 300),
+				segment("d", 6, 7, 700),
+				segment("e", 8, 9, 2000),
+			},
+			want: nil,
+		},
+		{
+			name:    "time-window, oldest window with two",
+			planner: NewTimeWindowPlanner(time.Hour, 1000),
+			segments: []FlushedSegment{
+				segment("a", 0, 70, 100),  // the first hour, alone
+				segment("b", 60, 65, 100), // the second hour
+				segment("c", 61, 62, 2000),
+				segment("d", 62, 100, 100),
+				segment("e", 130, 131, 100), // the third
+				segment("f", 140, 141, 100),
+			},
+			want: []string{"b", "d"},
+		},
+		{
+			name:    "time-window, no window with two",
+			planner: NewTimeWindowPlanner(24*time.Hour, 1000),
+			segments: []FlushedSegment{
+				segment("a", 0, 10, 100),
+				segment("b", 20, 30, 1000),
+				segment("c", 24*60, 24*60+1, 100),
+			},
+			want: nil,
+		},
+	} {
+		testcase := testcase
+		t.Run(testcase.name, func(t *testing.T) {
+			t.Parallel()
+			if want, have := testcase.want, testcase.planner.Plan(testcase.segments); !reflect.DeepEqual(want, have) {
+				t.Errorf("want %v, have %v", want, have)
+			}
+		})
+	}
+}
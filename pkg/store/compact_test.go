@@ -0,0 +1,428 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestMoveToTrashBySize(t *testing.T) {
+	t.Parallel()
+
+	const (
+		segmentTargetSize = 1024 // so bloom filters are 128 bytes
+		retain            = time.Hour
+		retainSize        = 1000
+	)
+	var (
+		filesys  = fs.NewVirtualFilesystem()
+		reporter = &eventRecorder{}
+		now      = time.Now()
+	)
+	filelog, err := NewFileLog(filesys, "/", segmentTargetSize, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+
+	// Segments of 100 bytes, plus a 128 byte bloom filter and 8 bytes of
+	// checksums: one past the age retention window, and ten within it.
+	writeSegment := func(ts time.Time) string {
+		id := ulid.MustNew(ulid.Timestamp(ts), nil)
+		segment, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(segment, "%s %s\n", id, strings.Repeat("x", 100-ulid.EncodedSize-2))
+		if err := segment.Close(id, id); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("/%s-%s", id, id)
+	}
+	old := writeSegment(now.Add(-2 * retain))
+	var recent []string
+	for i := 0; i < 10; i++ {
+		recent = append(recent, writeSegment(now.Add(-retain/2).Add(time.Duration(i)*time.Second)))
+	}
+
+	// And the oldest segment of all, which is being compacted.
+	compacting := fmt.Sprintf("/%s-%s", ulid.MustNew(0, nil), ulid.MustNew(0, nil))
+	if f, err := filesys.Create(compacting + extReading); err != nil {
+		t.Fatal(err)
+	} else {
+		f.Write(make([]byte, 100))
+		f.Close()
+	}
+
+	c := NewCompacter(
+		filelog, segmentTargetSize, nil, retain, retainSize, false, time.Hour, nil, 0, 1, 0,
+		prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "compact"}, []string{"kind", "compacted", "result"}),
+		prometheus.NewCounterVec(prometheus.CounterOpts{Name: "bytes"}, []string{"direction"}),
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "queue"}),
+		prometheus.NewCounterVec(prometheus.CounterOpts{Name: "trash"}, []string{"success"}),
+		prometheus.NewCounterVec(prometheus.CounterOpts{Name: "purge"}, []string{"success"}),
+		reporter,
+	)
+	c.moveToTrash()
+
+	// The 10 recent segments and the compacting one take 10*236+100 bytes.
+	// Trashing the oldest 7 of the recent ones gets under the budget.
+	want := map[string]string{old + extReading: "age"}
+	for _, path := range recent[:7] {
+		want[path+extReading] = "size"
+	}
+	if have := reporter.trashed(); !reflect.DeepEqual(want, have) {
+		t.Errorf("trashed: want %v, have %v", want, have)
+	}
+
+	wantFiles := []string{compacting + extReading}
+	for _, path := range recent[7:] {
+		wantFiles = append(wantFiles, path+extBloom, path+extChecksum, path+extFlushed)
+	}
+	for _, path := range append([]string{old}, recent[:7]...) {
+		wantFiles = append(wantFiles, path+extTrashed)
+	}
+	sort.Strings(wantFiles)
+	var haveFiles []string
+	filesys.Walk("/", func(path string, info os.FileInfo, err error) error {
+		if filepath.Ext(path) != "" {
+			haveFiles = append(haveFiles, path)
+		}
+		return nil
+	})
+	sort.Strings(haveFiles)
+	if !reflect.DeepEqual(wantFiles, haveFiles) {
+		t.Errorf("files: want %v, have %v", wantFiles, haveFiles)
+	}
+
+	// Now that we're within budget, nothing else goes.
+	c.moveToTrash()
+	if have := reporter.trashed(); !reflect.DeepEqual(want, have) {
+		t.Errorf("trashed again: want %v, have %v", want, have)
+	}
+}
+
+// eventRecorder records which segments were trashed by which policy.
+type eventRecorder struct {
+	mtx    sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) ReportEvent(e Event) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *eventRecorder) trashed() map[string]string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	trashed := map[string]string{}
+	for _, e := range r.events {
+		var policy string
+		if _, err := fmt.Sscanf(e.Msg, "trashed by %s retention policy", &policy); err == nil {
+			trashed[e.File] = policy
+		}
+	}
+	return trashed
+}
+
+func TestCompactThrottled(t *testing.T) {
+	t.Parallel()
+
+	// Three overlapping segments of 2KB each are read, and merged into one
+	// of 6KB, for 12KB of I/O. At 24KB/sec, that takes about half a second.
+	compact := func(bytesPerSecond int64) time.Duration {
+		filelog, err := NewFileLog(fs.NewVirtualFilesystem(), "/", 1024*1024, 1024, FileLogConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer filelog.Close()
+		writeOverlappingSegments(t, filelog, 3, 2048)
+
+		c := newTestCompacter(filelog, bytesPerSecond, &eventRecorder{})
+		begin := time.Now()
+		if compacted, result := c.compact("Overlapping", filelog.Overlapping); compacted != 3 || result != "OK" {
+			t.Fatalf("compact: want 3 segments OK, have %d %s", compacted, result)
+		}
+		return time.Since(begin)
+	}
+	var (
+		unthrottled = compact(0)
+		throttled   = compact(24 * 1024)
+	)
+	if min := 350 * time.Millisecond; throttled < min {
+		t.Errorf("throttled: want at least %s, have %s", min, throttled)
+	}
+	if unthrottled >= throttled {
+		t.Errorf("unthrottled took %s, throttled %s", unthrottled, throttled)
+	}
+}
+
+func TestCompacterPause(t *testing.T) {
+	t.Parallel()
+
+	filesys := fs.NewVirtualFilesystem()
+	filelog, err := NewFileLog(filesys, "/", 1024*1024, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+	writeOverlappingSegments(t, filelog, 3, 1024)
+
+	c := newTestCompacter(filelog, 0, &eventRecorder{})
+	status := func(method, path string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		c.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: HTTP %d", method, path, w.Code)
+		}
+		var status map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	// While paused, a scheduled compaction takes a slot, but doesn't start.
+	if want, have := true, status("POST", "/pause")["paused"]; want != have {
+		t.Fatalf("paused: want %v, have %v", want, have)
+	}
+	c.schedule("Overlapping", filelog.Overlapping)
+	time.Sleep(50 * time.Millisecond)
+	if want, have := 3, countSegments(t, filesys)[extFlushed]; want != have {
+		t.Errorf("paused: want %d flushed segments, have %d", want, have)
+	}
+	if want, have := 1.0, status("GET", "/")["running"]; want != have {
+		t.Errorf("paused: want %v running, have %v", want, have)
+	}
+
+	// Once resumed, it runs to completion.
+	if want, have := false, status("POST", "/resume")["paused"]; want != have {
+		t.Fatalf("resumed: want paused %v, have %v", want, have)
+	}
+	c.wg.Wait()
+	if want, have := 1, countSegments(t, filesys)[extFlushed]; want != have {
+		t.Errorf("resumed: want %d flushed segment, have %d", want, have)
+	}
+}
+
+func TestCompactTimeWindows(t *testing.T) {
+	t.Parallel()
+
+	filesys := fs.NewVirtualFilesystem()
+	filelog, err := NewFileLog(filesys, "/", 1024*1024, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+
+	// Three small segments in each of two hours, which the default planners
+	// would compact all together.
+	t0 := time.Now().Add(-3 * time.Hour).Truncate(time.Hour)
+	for _, offset := range []time.Duration{0, time.Minute, 2 * time.Minute, time.Hour, time.Hour + time.Minute, time.Hour + 2*time.Minute} {
+		id := ulid.MustNew(ulid.Timestamp(t0.Add(offset)), nil)
+		segment, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(segment, "%s %s\n", id, strings.Repeat("x", 100))
+		if err := segment.Close(id, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		planner = NewTimeWindowPlanner(time.Hour, 1024*1024)
+		c       = NewCompacter(
+			filelog, 1024*1024, []CompactionPlanner{planner}, time.Hour, 0, false, time.Hour, nil, 0, 1, 0,
+			prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "compact"}, []string{"kind", "compacted", "result"}),
+			prometheus.NewCounterVec(prometheus.CounterOpts{Name: "bytes"}, []string{"direction"}),
+			prometheus.NewGauge(prometheus.GaugeOpts{Name: "queue"}),
+			prometheus.NewCounterVec(prometheus.CounterOpts{Name: "trash"}, []string{"success"}),
+			prometheus.NewCounterVec(prometheus.CounterOpts{Name: "purge"}, []string{"success"}),
+			&eventRecorder{},
+		)
+		compact = func() (int, string) {
+			return c.compact(planner.Kind(), func() ([]ReadSegment, error) { return filelog.Compactable(planner) })
+		}
+	)
+	for i, want := range []struct {
+		compacted int
+		result    string
+	}{
+		{3, "OK"},
+		{3, "OK"},
+		{0, "NoSegmentsAvailable"}, // one segment per hour
+	} {
+		if compacted, result := compact(); want.compacted != compacted || want.result != result {
+			t.Fatalf("compaction %d: want %d compacted (%s), have %d (%s)", i+1, want.compacted, want.result, compacted, result)
+		}
+	}
+	if want, have := 2, countSegments(t, filesys)[extFlushed]; want != have {
+		t.Errorf("want %d flushed segments, have %d", want, have)
+	}
+}
+
+func TestCompactCrashConsistency(t *testing.T) {
+	t.Parallel()
+
+	for seed := int64(0); seed < 100; seed++ {
+		// Overlapping segments are compacted, until a fault, and then the
+		// machine crashes. Merged segments are small, so there are several.
+		var (
+			rng     = rand.New(rand.NewSource(seed))
+			filesys = fs.NewFaultyFilesystem(fs.NewVirtualFilesystem())
+			op      = []string{"create", "write", "sync", "rename"}[rng.Intn(4)]
+		)
+		filelog, err := NewFileLog(filesys, "/", 1024, 1024, FileLogConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeOverlappingSegments(t, filelog, 3, 2048)
+		written := readFlushedRecords(t, filesys, "/")
+
+		filesys.SetTornWrites(rng.Intn(2) == 0)
+		filesys.Fail(op, 1+rng.Intn(20))
+		newTestCompacter(filelog, 0, &eventRecorder{}).compact("Overlapping", filelog.Overlapping)
+		if err := filesys.Crash(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Once recovered, and compacted again, every record is there, once.
+		recovered, err := NewFileLog(filesys, "/", 1024, 1024, FileLogConfig{})
+		if err != nil {
+			t.Fatalf("seed %d: recovering: %v", seed, err)
+		}
+		c := newTestCompacter(recovered, 0, &eventRecorder{})
+		if _, result := c.compact("Overlapping", recovered.Overlapping); result == "Error" {
+			t.Errorf("seed %d: %s fault: compacting recovered segments failed", seed, op)
+		}
+		if want, have := written, readFlushedRecords(t, filesys, "/"); !reflect.DeepEqual(want, have) {
+			t.Errorf("seed %d: %s fault: want %d records, have %d", seed, op, len(want), len(have))
+		}
+		recovered.Close()
+	}
+}
+
+func TestCompactOpenSegment(t *testing.T) {
+	t.Parallel()
+
+	// On Windows, a segment that's being queried can't be renamed, so
+	// compaction can't take it.
+	filesys := fs.NewVirtualFilesystemWithWindowsSemantics()
+	filelog, err := NewFileLog(filesys, "/", 1024*1024, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+	writeOverlappingSegments(t, filelog, 3, 1024)
+	var path string
+	filesys.Walk("/", func(p string, info os.FileInfo, err error) error {
+		if filepath.Ext(p) == extFlushed {
+			path = p
+		}
+		return nil
+	})
+	f, err := filesys.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The segments taken before it are given back.
+	c := newTestCompacter(filelog, 0, &eventRecorder{})
+	if _, result := c.compact("Overlapping", filelog.Overlapping); result != "Error" {
+		t.Errorf("while open: want Error, have %s", result)
+	}
+	if want, have := map[string]int{extFlushed: 3}, countSegments(t, filesys); !reflect.DeepEqual(want, have) {
+		t.Errorf("while open: want %v, have %v", want, have)
+	}
+
+	// Once it's closed, compaction goes ahead.
+	f.Close()
+	if _, result := c.compact("Overlapping", filelog.Overlapping); result != "OK" {
+		t.Errorf("once closed: want OK, have %s", result)
+	}
+	if want, have := map[string]int{extFlushed: 1}, countSegments(t, filesys); !reflect.DeepEqual(want, have) {
+		t.Errorf("once closed: want %v, have %v", want, have)
+	}
+}
+
+// readFlushedRecords returns the records in the flushed segments under root,
+// sorted.
+func readFlushedRecords(t *testing.T, filesys fs.Filesystem, root string) []string {
+	var records []string
+	filesys.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || filepath.Ext(path) != extFlushed {
+			return err
+		}
+		f, err := filesys.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		buf, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, strings.SplitAfter(string(buf), "\n")...)
+		if last := len(records) - 1; records[last] == "" {
+			records = records[:last]
+		}
+		return nil
+	})
+	sort.Strings(records)
+	return records
+}
+
+func newTestCompacter(log Log, bytesPerSecond int64, reporter EventReporter) *Compacter {
+	return NewCompacter(
+		log, 1024*1024, nil, time.Hour, 0, false, time.Hour, nil, 0, 1, bytesPerSecond,
+		prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "compact"}, []string{"kind", "compacted", "result"}),
+		prometheus.NewCounterVec(prometheus.CounterOpts{Name: "bytes"}, []string{"direction"}),
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "queue"}),
+		prometheus.NewCounterVec(prometheus.CounterOpts{Name: "trash"}, []string{"success"}),
+		prometheus.NewCounterVec(prometheus.CounterOpts{Name: "purge"}, []string{"success"}),
+		reporter,
+	)
+}
+
+// writeOverlappingSegments writes n segments of about size bytes each, with
+// interleaved records, so that they all overlap.
+func writeOverlappingSegments(t testing.TB, log Log, n, size int) {
+	const recordSize = 64
+	for i := 0; i < n; i++ {
+		segment, err := log.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var low, high ulid.ULID
+		for j := 0; j < size/recordSize; j++ {
+			id := ulid.MustNew(uint64(1000+j*n+i), nil)
+			if j == 0 {
+				low = id
+			}
+			high = id
+			fmt.Fprintf(segment, "%s %s\n", id, strings.Repeat("x", recordSize-ulid.EncodedSize-2))
+		}
+		if err := segment.Close(low, high); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+// Compacted segments may be stored compressed, with zstd. Segments are
+// written, and flushed, uncompressed, as appending to them is what matters;
+// it's once segments are merged by compaction, and sealed, that they're
+// compressed. Compressed and uncompressed segments share names and
+// extensions, and are told apart by their contents: records begin with a
+// ULID, which never begins with a zstd magic number. So a store directory may
+// contain a mix of both.
+
+const (
+	// extSealing is the extension of a segment while it's being compressed.
+	// Such files are incomplete, and removed during recovery.
+	extSealing = ".sealing"
+
+	zstdMagic          = 0xFD2FB528 // of a zstd frame; see RFC 8878, section 3.1.1
+	zstdSkippableMagic = 0x184D2A5E // of the skippable frame recording the logical size
+)
+
+// The logical (uncompressed) size of a compressed segment is recorded in a
+// skippable frame before the compressed one, so it can be learned without
+// decompressing the segment. Decoders skip it. See RFC 8878, section 3.1.2.
+var logicalSizeTag = [2]byte{'O', 'K'}
+
+// logicalSizeFrameSize is the size of that frame: its magic number and
+// size, the tag, and the logical size.
+const logicalSizeFrameSize = 4 + 4 + 2 + 8
+
+// openSegmentFile opens the segment at path for reading, verifying,
+// decrypting with keys, and decompressing it if necessary. If the segment
+// fails verification, or decryption, corrupt is called with its path, and
+// reads return errCorruptSegment.
+func openSegmentFile(filesys fs.Filesystem, path string, keys KeyWrapper, corrupt func(path string)) (fs.File, error) {
+	f, err := filesys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = f
+	switch sums, err := readChecksums(filesys, modifyExtension(path, extChecksum)); {
+	case err == nil:
+		r = newChecksumReader(f, sums, func() { corrupt(path) })
+	case err == os.ErrNotExist:
+		// e.g. segments written before checksums, or recovered segments
+	default:
+		f.Close()
+		if err == errCorruptSegment {
+			corrupt(path)
+		}
+		return nil, errors.Wrapf(err, "reading checksums of segment %s", path)
+	}
+	br := bufio.NewReader(r)
+	if isEncrypted(br) {
+		dr, _, err := newDecryptReader(br, keys, func() { corrupt(path) })
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrapf(err, "decrypting segment %s", path)
+		}
+		br = bufio.NewReader(dr)
+	}
+	if !isCompressed(br) {
+		return segmentFile{File: f, r: br}, nil
+	}
+	zr, err := newDecompressReader(br)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "reading compressed segment %s", path)
+	}
+	return segmentFile{File: f, r: zr, zr: zr}, nil
+}
+
+// segmentFile is a segment file which Reads its records, decrypting and
+// decompressing them if necessary. Size still returns the size on disk.
+type segmentFile struct {
+	fs.File
+	r  io.Reader
+	zr io.Closer // the decompressor, if any
+}
+
+func (f segmentFile) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
+
+func (f segmentFile) Close() error {
+	if f.zr != nil {
+		f.zr.Close()
+	}
+	return f.File.Close()
+}
+
+// DecompressSegment returns a reader of the records of a segment, as stored,
+// e.g. as exported, read from r. If the segment is compressed, they're
+// decompressed; otherwise they're read as they are. Close the reader once
+// it's done with, to release the decompressor; it doesn't close r.
+func DecompressSegment(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if !isCompressed(br) {
+		return ioutil.NopCloser(br), nil
+	}
+	return newDecompressReader(br)
+}
+
+func isCompressed(br *bufio.Reader) bool {
+	magic, err := br.Peek(4)
+	if err != nil {
+		return false
+	}
+	m := binary.LittleEndian.Uint32(magic)
+	return m == zstdMagic || m == zstdSkippableMagic
+}
+
+// newDecompressReader returns a reader of the records of the compressed
+// segment read from br, past the frame recording its logical size, if there
+// is one.
+func newDecompressReader(br *bufio.Reader) (io.ReadCloser, error) {
+	if _, ok, err := readLogicalSize(br); err != nil {
+		return nil, err
+	} else if ok {
+		br.Discard(logicalSizeFrameSize)
+	}
+	zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
+
+// readLogicalSize peeks at the frame, at the start of br, recording the
+// logical size of a compressed segment, and returns the size, if it's there.
+func readLogicalSize(br *bufio.Reader) (size int64, ok bool, err error) {
+	frame, err := br.Peek(logicalSizeFrameSize)
+	if err != nil || binary.LittleEndian.Uint32(frame) != zstdSkippableMagic {
+		return 0, false, nil
+	}
+	if n := binary.LittleEndian.Uint32(frame[4:]); n != logicalSizeFrameSize-8 || frame[8] != logicalSizeTag[0] || frame[9] != logicalSizeTag[1] {
+		return 0, false, errors.New("unexpected skippable frame in compressed segment")
+	}
+	return int64(binary.LittleEndian.Uint64(frame[10:])), true, nil
+}
+
+// sealSegment writes the plain segment at src to dst, compressed, if compress
+// is true, and encrypted, if keys isn't nil, and returns the checksums of what
+// it wrote. The logical size is written ahead of the compressed records.
+func sealSegment(filesys fs.Filesystem, src, dst string, compress bool, keys KeyWrapper) (sums []uint32, err error) {
+	in, err := filesys.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	out, err := filesys.Create(dst)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			filesys.Remove(dst)
+		}
+	}()
+
+	var (
+		checksum blockChecksum
+		w        io.Writer   = io.MultiWriter(out, &checksum)
+		closers  []io.Closer // innermost first
+	)
+	if keys != nil {
+		ew, err := newEncryptWriter(w, keys, in.Size())
+		if err != nil {
+			return nil, err
+		}
+		w, closers = ew, append(closers, ew)
+	}
+	if compress {
+		zw, err := newCompressWriter(w, in.Size())
+		if err != nil {
+			return nil, err
+		}
+		w, closers = zw, append(closers, zw)
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		return nil, err
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := out.Sync(); err != nil {
+		return nil, err
+	}
+	fs.Seal(out) // just advice
+	return checksum.blocks(), out.Close()
+}
+
+// newCompressWriter writes the frame recording the logical size of a segment
+// to w, and returns a writer of its records, compressed, to w after it. Close
+// the writer to finish the compressed frame; it doesn't close w.
+func newCompressWriter(w io.Writer, logicalSize int64) (io.WriteCloser, error) {
+	frame := make([]byte, logicalSizeFrameSize)
+	binary.LittleEndian.PutUint32(frame, zstdSkippableMagic)
+	binary.LittleEndian.PutUint32(frame[4:], logicalSizeFrameSize-8)
+	copy(frame[8:], logicalSizeTag[:])
+	binary.LittleEndian.PutUint64(frame[10:], uint64(logicalSize))
+	if _, err := w.Write(frame); err != nil {
+		return nil, err
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+}
+
+// logicalSize returns the plain size of the segment at path, which is
+// diskSize if the segment isn't compressed, or encrypted. Encrypted segments
+// record it in their header, so they needn't be decrypted.
+func logicalSize(filesys fs.Filesystem, path string, diskSize int64) (int64, error) {
+	f, err := filesys.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	if isEncrypted(br) {
+		h, _, err := readEncryptionHeader(br)
+		if err != nil {
+			return 0, errors.Wrapf(err, "reading header of encrypted segment %s", path)
+		}
+		return int64(h.logicalSize), nil
+	}
+	if !isCompressed(br) {
+		return diskSize, nil
+	}
+	size, ok, err := readLogicalSize(br)
+	if err != nil {
+		return 0, errors.Wrapf(err, "reading logical size of compressed segment %s", path)
+	}
+	if !ok {
+		return 0, errors.Errorf("compressed segment %s doesn't record its logical size", path)
+	}
+	return size, nil
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestMixedCompressedSegments(t *testing.T) {
+	t.Parallel()
+
+	var (
+		filesys = fs.NewVirtualFilesystem()
+		t0      = time.Now().Add(-time.Hour)
+		records []string
+	)
+	writeSegments := func(filelog Log, offset int) {
+		for i := offset; i < offset+3; i++ {
+			id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Second)), nil)
+			record := fmt.Sprintf("%s segment %d %s\n", id, i, strings.Repeat("x", 100))
+			records = append(records, record)
+			segment, err := filelog.Create()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := segment.Write([]byte(record)); err != nil {
+				t.Fatal(err)
+			}
+			if err := segment.Close(id, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// A store directory written before compression was enabled.
+	filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSegments(filelog, 0)
+	filelog.Close()
+
+	// And written to again, after. A compression interrupted by a crash
+	// leaves an incomplete file behind, too. Flushed segments aren't
+	// compressed, either way.
+	if f, err := filesys.Create("/interrupted" + extSealing); err != nil {
+		t.Fatal(err)
+	} else {
+		f.Close()
+	}
+	filelog, err = NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+	writeSegments(filelog, 3)
+	if want, have := map[string]int{extFlushed: 6}, countSegments(t, filesys); !reflect.DeepEqual(want, have) {
+		t.Fatalf("before compaction: want %v, have %v", want, have)
+	}
+
+	query := func() string {
+		result, err := filelog.Query(context.Background(), QueryParams{
+			From: ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(t0), nil)},
+			To:   ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(time.Now()), nil)},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer result.Records.Close()
+		b, err := ioutil.ReadAll(result.Records)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	compact := func() {
+		readSegments, err := filelog.Sequential()
+		if err != nil {
+			t.Fatal(err)
+		}
+		readers := make([]io.Reader, len(readSegments))
+		for i := range readSegments {
+			readers[i] = readSegments[i]
+		}
+		if _, err := mergeRecordsToLog(filelog, 10240, readers...); err != nil {
+			t.Fatal(err)
+		}
+		for _, readSegment := range readSegments {
+			if err := readSegment.Purge(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Compaction writes compressed segments.
+	compact()
+	if want, have := map[string]int{"compressed" + extFlushed: 1}, countSegments(t, filesys); !reflect.DeepEqual(want, have) {
+		t.Fatalf("after compaction: want %v, have %v", want, have)
+	}
+	if want, have := strings.Join(records, ""), query(); want != have {
+		t.Fatalf("after compaction: want %q, have %q", want, have)
+	}
+
+	// Queries, and compaction, read both kinds.
+	writeSegments(filelog, 6)
+	if want, have := map[string]int{"compressed" + extFlushed: 1, extFlushed: 3}, countSegments(t, filesys); !reflect.DeepEqual(want, have) {
+		t.Fatalf("mixed: want %v, have %v", want, have)
+	}
+	if want, have := strings.Join(records, ""), query(); want != have {
+		t.Fatalf("mixed: want %q, have %q", want, have)
+	}
+	compact()
+	if want, have := map[string]int{"compressed" + extFlushed: 1}, countSegments(t, filesys); !reflect.DeepEqual(want, have) {
+		t.Fatalf("after compacting both: want %v, have %v", want, have)
+	}
+	if want, have := strings.Join(records, ""), query(); want != have {
+		t.Fatalf("after compacting both: want %q, have %q", want, have)
+	}
+
+	// Compressed segments are trashed and purged like any other.
+	oldSegments, err := filelog.Trashable(time.Now(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, oldSegment := range oldSegments {
+		if err := oldSegment.Trash(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	trashSegments, err := filelog.Purgeable(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, trashSegment := range trashSegments {
+		if err := trashSegment.Purge(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want, have := map[string]int{}, countSegments(t, filesys); !reflect.DeepEqual(want, have) {
+		t.Fatalf("after purge: want %v, have %v", want, have)
+	}
+}
+
+func TestSequentialCompressedLogicalSize(t *testing.T) {
+	t.Parallel()
+
+	// Two compacted segments which are small on disk, but too big to compact
+	// together.
+	const segmentTargetSize = 1000
+	filesys := fs.NewVirtualFilesystem()
+	filelog, err := NewFileLog(filesys, "/", segmentTargetSize, 1024, FileLogConfig{Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+	t0 := time.Now().Add(-time.Minute)
+	for i := 0; i < 2; i++ {
+		id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Second)), nil)
+		record := fmt.Sprintf("%s %s\n", id, strings.Repeat("x", 600))
+		if _, err := mergeRecordsToLog(filelog, segmentTargetSize, strings.NewReader(record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want, have := map[string]int{"compressed" + extFlushed: 2}, countSegments(t, filesys); !reflect.DeepEqual(want, have) {
+		t.Fatalf("want %v, have %v", want, have)
+	}
+
+	var diskSize int64
+	filesys.Walk("/", func(path string, info os.FileInfo, err error) error {
+		if filepath.Ext(path) == extFlushed {
+			diskSize += info.Size()
+		}
+		return nil
+	})
+	if diskSize > segmentTargetSize {
+		t.Fatalf("segments take %d bytes on disk, which defeats the test", diskSize)
+	}
+
+	if want, have := ErrNoSegmentsAvailable, func() error { _, err := filelog.Sequential(); return err }(); want != have {
+		t.Fatalf("want %v, have %v", want, have)
+	}
+}
+
+// countSegments counts segment files by extension, prefixing "compressed"
+// for compressed ones.
+func countSegments(t *testing.T, filesys fs.Filesystem) map[string]int {
+	counts := map[string]int{}
+	filesys.Walk("/", func(path string, info os.FileInfo, err error) error {
+		switch ext := filepath.Ext(path); ext {
+		case extActive, extFlushed, extReading, extTrashed, extSealing:
+			f, err := filesys.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if isCompressed(bufio.NewReader(f)) {
+				ext = "compressed" + ext
+			}
+			counts[ext]++
+		}
+		return nil
+	})
+	return counts
+}
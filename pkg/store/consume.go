@@ -5,16 +5,21 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math/rand"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/oklog/oklog/pkg/breaker"
 	"github.com/oklog/oklog/pkg/cluster"
 	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/ulidutil"
 )
 
 // Consumer reads segments from the ingesters, and replicates merged segments to
@@ -22,17 +27,29 @@ import (
 // segments, replicate, commit, and repeat. All failures invalidate the entire
 // batch.
 type Consumer struct {
-	peer               *cluster.Peer
+	peer               ClusterPeer
+	name               string // our API host:port, as ingesters know it
 	client             *http.Client
 	segmentTargetSize  int64
 	segmentTargetAge   time.Duration
 	segmentDelay       time.Duration
 	replicationFactor  int
+	chunkSize          int                 // zero to replicate segments whole
+	transferTimeout    time.Duration       // of a segment replicated in chunks
+	unchunked          map[string]bool     // targets that don't take chunks
 	gatherErrors       int                 // heuristic to move out of gather state
 	pending            map[string][]string // ingester: segment IDs
 	active             *bytes.Buffer       // merged pending segments
+	origins            map[string]bool     // labels of the ingesters of pending segments
+	dedup              *dedupBatch         // nil if records aren't deduplicated
+	breakers           *breaker.Set        // of ingesters and targets; nil to always try them
+	scheduler          *ConsumeScheduler   // of ingesters, shared by consumers
 	activeSince        time.Time           // active segment has been "open" since this time
+	drain              chan chan struct{}
 	stop               chan chan struct{}
+	done               chan struct{} // closed when Run returns
+	lastStep           int64         // UnixNano, atomic
+	diskLevel          int32         // DiskLevel, atomic
 	consumedSegments   prometheus.Counter
 	consumedBytes      prometheus.Counter
 	replicatedSegments prometheus.Counter
@@ -40,31 +57,59 @@ type Consumer struct {
 	reporter           EventReporter
 }
 
-// NewConsumer creates a consumer.
-// Don't forget to Run it.
+// NewConsumer creates a consumer. Name is this node's API host:port, which
+// ingesters use to prefer some segments for it over the others; it may be
+// empty, to take the oldest segments, regardless. If dedup isn't nil, records
+// already consumed within its window are dropped; it's shared by consumers.
+// Segments bigger than chunkSize, if it's positive, are replicated in chunks
+// of that size, each of which can be retried, until transferTimeout; targets
+// that don't take chunks get them whole. Ingesters and targets whose breakers
+// are open are skipped, if breakers isn't nil. Consumers that share a
+// scheduler take turns of the ingesters; if it's nil, the consumer has one of
+// its own, without an in-flight limit. Don't forget to Run it.
 func NewConsumer(
-	peer *cluster.Peer,
+	peer ClusterPeer,
+	name string,
 	client *http.Client,
 	segmentTargetSize int64,
 	segmentTargetAge time.Duration,
 	segmentDelay time.Duration,
 	replicationFactor int,
+	chunkSize int,
+	transferTimeout time.Duration,
+	dedup *Deduper,
+	breakers *breaker.Set,
+	scheduler *ConsumeScheduler,
 	consumedSegments, consumedBytes prometheus.Counter,
 	replicatedSegments, replicatedBytes prometheus.Counter,
 	reporter EventReporter,
 ) *Consumer {
+	if scheduler == nil {
+		scheduler = NewConsumeScheduler(0, nil, nil, nil)
+	}
 	return &Consumer{
 		peer:               peer,
+		name:               name,
 		client:             client,
 		segmentTargetSize:  segmentTargetSize,
 		segmentTargetAge:   segmentTargetAge,
 		segmentDelay:       segmentDelay,
 		replicationFactor:  replicationFactor,
+		chunkSize:          chunkSize,
+		transferTimeout:    transferTimeout,
+		unchunked:          map[string]bool{},
 		gatherErrors:       0,
 		pending:            map[string][]string{},
 		active:             &bytes.Buffer{},
+		origins:            map[string]bool{},
+		dedup:              newDedupBatch(dedup),
+		breakers:           breakers,
+		scheduler:          scheduler,
 		activeSince:        time.Time{},
+		drain:              make(chan chan struct{}),
 		stop:               make(chan chan struct{}),
+		done:               make(chan struct{}),
+		lastStep:           time.Now().UnixNano(),
 		consumedSegments:   consumedSegments,
 		consumedBytes:      consumedBytes,
 		replicatedSegments: replicatedSegments,
@@ -76,6 +121,7 @@ func NewConsumer(
 // Run consumes segments from ingest nodes, and replicates them to the cluster.
 // Run returns when Stop is invoked.
 func (c *Consumer) Run() {
+	defer close(c.done)
 	step := time.NewTicker(c.segmentDelay)
 	defer step.Stop()
 	state := c.gather
@@ -83,6 +129,12 @@ func (c *Consumer) Run() {
 		select {
 		case <-step.C:
 			state = state()
+			atomic.StoreInt64(&c.lastStep, time.Now().UnixNano())
+
+		case q := <-c.drain:
+			c.flush()
+			state = c.drained
+			close(q)
 
 		case q := <-c.stop:
 			c.fail() // any outstanding segments
@@ -92,6 +144,33 @@ func (c *Consumer) Run() {
 	}
 }
 
+// LastStep returns when the consumer last completed a step of its state
+// machine, or was created. A consumer stuck in a step, e.g. replicating to an
+// unresponsive node, stops advancing it.
+func (c *Consumer) LastStep() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.lastStep))
+}
+
+// Drain the consumer ahead of shutdown. Any segments gathered so far are
+// replicated and committed, or failed back to the ingesters, and the consumer
+// stops gathering new segments. Drain returns when that's done. Stop must
+// still be invoked. Drain is a no-op if the consumer has already stopped.
+func (c *Consumer) Drain() {
+	q := make(chan struct{})
+	select {
+	case c.drain <- q:
+		<-q
+	case <-c.done:
+	}
+}
+
+// SetDiskLevel tells the consumer how full this node's disk is. From DiskHigh
+// up, it stops gathering segments, and leaves them to nodes with more room;
+// segments already gathered are still replicated.
+func (c *Consumer) SetDiskLevel(level DiskLevel) {
+	atomic.StoreInt32(&c.diskLevel, int32(level))
+}
+
 // Stop the consumer from consuming.
 func (c *Consumer) Stop() {
 	q := make(chan struct{})
@@ -119,11 +198,17 @@ func (c *Consumer) gather() stateFn {
 	if len(instances) == 0 {
 		return c.gather // maybe some will come back later
 	}
-	if want, have := c.replicationFactor, len(c.peer.Current(cluster.PeerTypeStore)); have < want {
+	if DiskLevel(atomic.LoadInt32(&c.diskLevel)) >= DiskHigh {
+		if c.active.Len() > 0 {
+			return c.replicate
+		}
+		return c.gather // until there's room again
+	}
+	if len(c.peer.Current(cluster.PeerTypeStore)) == 0 {
 		// Don't gather if we can't replicate.
 		// Better to queue up on the ingesters.
 		c.reporter.ReportEvent(Event{
-			Op: "gather", Warning: fmt.Errorf("replication factor %d, available peers %d: replication currently impossible", want, have),
+			Op: "gather", Warning: errors.New("no store peers available: replication currently impossible"),
 		})
 		time.Sleep(time.Second)
 		c.gatherErrors++
@@ -139,10 +224,29 @@ func (c *Consumer) gather() stateFn {
 		return c.replicate
 	}
 
-	// Get the oldest segment ID from a random ingester.
-	instance := instances[rand.Intn(len(instances))]
-	nextResp, err := c.client.Get(fmt.Sprintf("http://%s/ingest%s", instance, ingest.APIPathNext))
+	// Get the oldest segment ID from the next ingester the scheduler gives
+	// us, of those whose breakers aren't open. We hold it until its segments
+	// are committed or failed; if it gives us none, we let it go now.
+	held := func(instance string) bool { return len(c.pending[instance]) > 0 }
+	instance := c.scheduler.next(instances, c.breakers.Allow, held)
+	if instance == "" {
+		c.gatherErrors++
+		return c.gather // they're all failing, or busy, for now
+	}
+	if !held(instance) {
+		defer func() {
+			if !held(instance) {
+				c.scheduler.release(instance, 0, false)
+			}
+		}()
+	}
+	nextURL := fmt.Sprintf("http://%s/ingest%s", instance, ingest.APIPathNext)
+	if c.name != "" {
+		nextURL += "?consumer=" + url.QueryEscape(c.name)
+	}
+	nextResp, err := c.client.Get(nextURL)
 	if err != nil {
+		c.breakers.Failure(instance)
 		c.reporter.ReportEvent(Event{
 			Op: "gather", Warning: err,
 			Msg: fmt.Sprintf("ingester %s, during %s: fatal error", instance, ingest.APIPathNext),
@@ -153,6 +257,7 @@ func (c *Consumer) gather() stateFn {
 	defer nextResp.Body.Close()
 	nextRespBody, err := ioutil.ReadAll(nextResp.Body)
 	if err != nil {
+		c.breakers.Failure(instance)
 		c.reporter.ReportEvent(Event{
 			Op: "gather", Warning: err,
 			Msg: fmt.Sprintf("ingester %s, during %s: read error", instance, ingest.APIPathNext),
@@ -160,9 +265,15 @@ func (c *Consumer) gather() stateFn {
 		c.gatherErrors++
 		return c.gather
 	}
+	if nextResp.StatusCode >= http.StatusInternalServerError {
+		c.breakers.Failure(instance)
+	} else {
+		c.breakers.Success(instance)
+	}
 	nextID := strings.TrimSpace(string(nextRespBody))
 	if nextResp.StatusCode == http.StatusNotFound {
 		// Normal, when the ingester has no more segments to give right now.
+		c.scheduler.drained(instance)
 		c.gatherErrors++ // after enough of these errors, we should replicate
 		return c.gather
 	}
@@ -203,9 +314,26 @@ func (c *Consumer) gather() stateFn {
 		return c.fail // fail everything, same as above
 	}
 
-	// Merge the segment into our active segment.
-	var cw countingWriter
-	if _, _, _, err := mergeRecords(c.active, io.TeeReader(readResp.Body, &cw)); err != nil {
+	// Merge the segment into our active segment, without the records we've
+	// consumed before, if we're deduplicating.
+	var (
+		cw      countingWriter
+		records io.Reader = io.TeeReader(readResp.Body, &cw)
+	)
+	if c.dedup != nil {
+		segment, err := ioutil.ReadAll(records)
+		if err != nil {
+			c.reporter.ReportEvent(Event{
+				Op: "gather", Error: err,
+				Msg: fmt.Sprintf("ingester %s, during %s: read error", instance, ingest.APIPathRead),
+			})
+			c.gatherErrors++
+			return c.fail // fail everything, same as above
+		}
+		records = bytes.NewReader(c.dedup.filter(segment))
+	}
+	low, _, _, err := mergeRecords(c.active, records)
+	if err != nil {
 		c.reporter.ReportEvent(Event{
 			Op: "gather", Error: err,
 			Msg: fmt.Sprintf("ingester %s, during %s: fatal error", instance, "mergeRecords"),
@@ -216,6 +344,14 @@ func (c *Consumer) gather() stateFn {
 	if c.activeSince.IsZero() {
 		c.activeSince = time.Now()
 	}
+	if labels := readResp.Header.Get(ingest.HTTPHeaderLabels); labels != "" {
+		c.origins[labels] = true
+	}
+	var oldest time.Time
+	if low != (ulid.ULID{}) {
+		oldest = ulidutil.TimeOf(low)
+	}
+	c.scheduler.gathered(instance, oldest)
 
 	// Repeat!
 	c.consumedSegments.Inc()
@@ -223,58 +359,174 @@ func (c *Consumer) gather() stateFn {
 	return c.gather
 }
 
+// flush finishes the current transaction, whatever state it's in.
+func (c *Consumer) flush() {
+	if c.active.Len() <= 0 {
+		c.fail() // any outstanding segments
+		return
+	}
+	next := c.replicate() // commit or fail
+	next()
+}
+
+func (c *Consumer) drained() stateFn {
+	return c.drained // nothing more to do
+}
+
 func (c *Consumer) replicate() stateFn {
-	// Replicate the segment to the cluster.
+	// Replicate the segment to the cluster. With fewer peers than the
+	// replication factor, replicate to all of them, rather than not at all.
 	var (
 		peers      = c.peer.Current(cluster.PeerTypeStore)
-		indices    = rand.Perm(len(peers))
+		want       = c.replicationFactor
 		replicated = 0
 	)
-	if want, have := c.replicationFactor, len(peers); have < want {
+	if len(peers) <= 0 {
 		c.reporter.ReportEvent(Event{
-			Op: "replicate", Warning: fmt.Errorf("replication factor %d, available peers %d: replication currently impossible", want, have),
+			Op: "replicate", Error: errors.New("no store peers available"),
 		})
 		return c.fail // can't do anything here
 	}
-	for i := 0; i < len(indices) && replicated < c.replicationFactor; i++ {
-		var (
-			index    = indices[i]
-			target   = peers[index]
-			uri      = fmt.Sprintf("http://%s/store%s", target, APIPathReplicate)
-			bodyType = "application/binary"
-			body     = bytes.NewReader(c.active.Bytes())
-		)
-		resp, err := c.client.Post(uri, bodyType, body)
-		if err != nil {
-			c.reporter.ReportEvent(Event{
-				Op: "replicate", Error: err,
-				Msg: fmt.Sprintf("target %s, during %s: fatal error", target, APIPathReplicate),
-			})
-			continue // we'll try another one
-		}
-		resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			c.reporter.ReportEvent(Event{
-				Op: "replicate", Error: fmt.Errorf(resp.Status),
-				Msg: fmt.Sprintf("target %s, during %s: bad status code", target, APIPathReplicate),
-			})
-			continue // we'll try another one
+	if have := len(peers); have < want {
+		c.reporter.ReportEvent(Event{
+			Op: "replicate", Warning: fmt.Errorf("replication factor %d, available peers %d: under-replicating", want, have),
+		})
+		want = have
+	}
+	targets := placeReplicas(peers, c.peer.Zones(cluster.PeerTypeStore), segmentKey(c.active.Bytes()))
+	for i := 0; i < len(targets) && replicated < want; i++ {
+		if c.replicateTo(targets[i], replicated == 0) {
+			replicated++
 		}
-		replicated++
 	}
-	if replicated < c.replicationFactor {
+	if replicated < want {
 		c.reporter.ReportEvent(Event{
-			Op: "replicate", Error: fmt.Errorf("failed to fully replicate: want %d, have %d", c.replicationFactor, replicated),
+			Op: "replicate", Error: fmt.Errorf("failed to fully replicate: want %d, have %d", want, replicated),
 		})
 		return c.fail // harsh, but OK
 	}
 
-	// All good!
+	// All good! Read-only store nodes get their copies, too, but they're
+	// best-effort: they serve queries, but they're not relied on to keep
+	// the segment, so the ingesters needn't wait for them.
+	c.replicateReadOnly()
 	c.replicatedSegments.Inc()
 	c.replicatedBytes.Add(float64(c.active.Len()))
 	return c.commit
 }
 
+// replicateReadOnly replicates the segment to as many read-only store nodes
+// as the replication factor, if there are any. Falling short is only a
+// warning.
+func (c *Consumer) replicateReadOnly() {
+	peers := c.peer.Current(cluster.PeerTypeReadOnlyStore)
+	if len(peers) <= 0 {
+		return
+	}
+	var (
+		want       = c.replicationFactor
+		replicated = 0
+		targets    = placeReplicas(peers, c.peer.Zones(cluster.PeerTypeReadOnlyStore), segmentKey(c.active.Bytes()))
+	)
+	if want > len(peers) {
+		want = len(peers)
+	}
+	for i := 0; i < len(targets) && replicated < want; i++ {
+		if c.replicateTo(targets[i], false) {
+			replicated++
+		}
+	}
+	if replicated < want {
+		c.reporter.ReportEvent(Event{
+			Op: "replicate", Warning: fmt.Errorf("failed to fully replicate to read-only store nodes: want %d, have %d", want, replicated),
+		})
+	}
+}
+
+// replicateTo sends the segment to the target, unless its breaker is open,
+// and reports if it failed. If ship is true, the target ships the segment to
+// its standby, if it has one; only the first replica to have it does.
+func (c *Consumer) replicateTo(target string, ship bool) bool {
+	if !c.breakers.Allow(target) {
+		return false // don't wait on it
+	}
+	ok := c.send(target, ship)
+	if ok {
+		c.breakers.Success(target)
+	} else {
+		c.breakers.Failure(target)
+	}
+	return ok
+}
+
+// send the segment to the target, and report if it failed.
+func (c *Consumer) send(target string, ship bool) bool {
+	if c.chunkSize > 0 && c.active.Len() > c.chunkSize && !c.unchunked[target] {
+		origins := make([]string, 0, len(c.origins))
+		for origin := range c.origins {
+			origins = append(origins, origin)
+		}
+		err := replicateChunked(c.client, target, c.active.Bytes(), origins, ship, c.chunkSize, c.transferTimeout)
+		switch {
+		case err == nil:
+			return true
+		case err == errChunksUnsupported:
+			c.unchunked[target] = true // and send it whole
+		default:
+			c.reporter.ReportEvent(Event{
+				Op: "replicate", Error: err,
+				Msg: fmt.Sprintf("target %s, during %s: fatal error", target, APIPathReplicateChunk),
+			})
+			return false
+		}
+	}
+	var (
+		uri  = fmt.Sprintf("http://%s/store%s", target, APIPathReplicate)
+		body = bytes.NewReader(c.active.Bytes())
+	)
+	req, err := http.NewRequest("POST", uri, body)
+	if err != nil {
+		c.reporter.ReportEvent(Event{
+			Op: "replicate", Error: err,
+			Msg: fmt.Sprintf("target %s, during %s: fatal error", target, APIPathReplicate),
+		})
+		return false
+	}
+	req.Header.Set("Content-Type", "application/binary")
+	for origin := range c.origins {
+		req.Header.Add(httpHeaderOrigins, origin)
+	}
+	if ship {
+		req.Header.Set(httpHeaderShip, "true")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.reporter.ReportEvent(Event{
+			Op: "replicate", Error: err,
+			Msg: fmt.Sprintf("target %s, during %s: fatal error", target, APIPathReplicate),
+		})
+		return false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.reporter.ReportEvent(Event{
+			Op: "replicate", Error: fmt.Errorf(resp.Status),
+			Msg: fmt.Sprintf("target %s, during %s: bad status code", target, APIPathReplicate),
+		})
+		return false
+	}
+	return true
+}
+
+// segmentKey is the ULID of the first record in the segment, which is as good
+// as unique.
+func segmentKey(segment []byte) []byte {
+	if len(segment) < ulid.EncodedSize {
+		return segment
+	}
+	return segment[:ulid.EncodedSize]
+}
+
 func (c *Consumer) commit() stateFn {
 	return c.resetVia("commit")
 }
@@ -315,10 +567,22 @@ func (c *Consumer) resetVia(commitOrFailed string) stateFn {
 	}
 	wg.Wait()
 
+	// Only committed records are remembered, so that failed ones aren't
+	// dropped when they're consumed again.
+	if commitOrFailed == "commit" {
+		c.dedup.commit()
+	} else {
+		c.dedup.reset()
+	}
+
 	// Reset various pending things.
+	for instance, ids := range c.pending {
+		c.scheduler.release(instance, len(ids), commitOrFailed == "commit")
+	}
 	c.gatherErrors = 0
 	c.pending = map[string][]string{}
 	c.active.Reset()
+	c.origins = map[string]bool{}
 	c.activeSince = time.Time{}
 
 	// Back to the beginning.
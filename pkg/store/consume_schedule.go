@@ -0,0 +1,233 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ConsumeScheduler shares the ingest nodes among the consumers of a store
+// node. Each consumer asks it which ingester to gather its next segment from:
+// they're taken round robin, across the consumers, so every ingester with
+// segments gets its turn, however deep another's backlog is. With an
+// in-flight limit, an ingester is gathered from by at most that many
+// consumers at once, i.e. those with its segments pending, so one can't
+// occupy them all while the others' disks fill.
+//
+// It also tracks how far behind the consumers are of each ingester: the age
+// of the oldest record of the segment it last gave, as of when it gave it,
+// the segments gathered from it that aren't yet replicated and committed,
+// and when they last were. It serves that on the lag endpoint, and should be
+// mounted at APIPathLag.
+type ConsumeScheduler struct {
+	limit      int
+	lag        *prometheus.GaugeVec
+	pending    *prometheus.GaugeVec
+	lastCommit *prometheus.GaugeVec
+	now        func() time.Time
+
+	mtx       sync.Mutex
+	last      string                  // the ingester scheduled last
+	inflight  map[string]int          // ingester: consumers holding it
+	ingesters map[string]*IngesterLag // ingesters asked for segments
+}
+
+// ConsumeLag is how far behind a store node's consumers are, of each ingest
+// node they've asked for segments, in order.
+type ConsumeLag struct {
+	Ingesters []IngesterLag `json:"ingesters"`
+}
+
+// IngesterLag is how far behind a store node's consumers are of an ingest
+// node. LagSeconds is the age of the oldest record of the segment it last
+// gave, as of Observed, when they last asked it for one, or zero, if it had
+// none to give. PendingSegments were gathered from it, but aren't yet
+// replicated and committed. LastCommit is zero until any are.
+type IngesterLag struct {
+	Ingester        string    `json:"ingester"`
+	LagSeconds      float64   `json:"lag_seconds"`
+	PendingSegments int       `json:"pending_segments"`
+	LastCommit      time.Time `json:"last_commit"`
+	Observed        time.Time `json:"observed"`
+}
+
+// NewConsumeScheduler returns a ConsumeScheduler for the consumers of a store
+// node. If limit is positive, it's the most consumers that may gather from
+// one ingester at once. The gauges, each of which may be nil, are set by the
+// "ingester" label: lag to its lag, in seconds, pending to its pending
+// segments, and lastCommit to the Unix time its segments were last
+// committed.
+func NewConsumeScheduler(limit int, lag, pending, lastCommit *prometheus.GaugeVec) *ConsumeScheduler {
+	return &ConsumeScheduler{
+		limit:      limit,
+		lag:        lag,
+		pending:    pending,
+		lastCommit: lastCommit,
+		now:        time.Now,
+		inflight:   map[string]int{},
+		ingesters:  map[string]*IngesterLag{},
+	}
+}
+
+// next returns the ingester of instances for a consumer to gather from, the
+// one after the last scheduled, in order, that allow allows, e.g. whose
+// breaker isn't open, and that's under the in-flight limit, or that the
+// consumer holds already. The consumer holds the ingester it's given until
+// it releases it. It returns "" if there's none.
+func (s *ConsumeScheduler) next(instances []string, allow, held func(instance string) bool) string {
+	sorted := append([]string(nil), instances...)
+	sort.Strings(sorted)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.forget(sorted)
+	start := sort.SearchStrings(sorted, s.last)
+	if start < len(sorted) && sorted[start] == s.last {
+		start++
+	}
+	for k := range sorted {
+		instance := sorted[(start+k)%len(sorted)]
+		holding := held(instance)
+		if !holding && s.limit > 0 && s.inflight[instance] >= s.limit {
+			continue
+		}
+		if !allow(instance) {
+			continue
+		}
+		if !holding {
+			s.inflight[instance]++
+		}
+		s.last = instance
+		return instance
+	}
+	return ""
+}
+
+// release the ingester, as a consumer's segments of it, if any, are
+// committed or failed, or it had none to give.
+func (s *ConsumeScheduler) release(instance string, segments int, committed bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.inflight[instance] <= 1 {
+		delete(s.inflight, instance)
+	} else {
+		s.inflight[instance]--
+	}
+	if segments <= 0 {
+		return
+	}
+	l := s.ingester(instance)
+	if l.PendingSegments -= segments; l.PendingSegments < 0 {
+		l.PendingSegments = 0
+	}
+	if committed {
+		l.LastCommit = s.now().UTC()
+		if s.lastCommit != nil {
+			s.lastCommit.WithLabelValues(instance).Set(float64(l.LastCommit.UnixNano()) / 1e9)
+		}
+	}
+	if s.pending != nil {
+		s.pending.WithLabelValues(instance).Set(float64(l.PendingSegments))
+	}
+}
+
+// gathered a segment of the ingester, whose oldest record is of that time,
+// or, if it's zero, e.g. as every record was a duplicate, leaving the lag as
+// it was.
+func (s *ConsumeScheduler) gathered(instance string, oldest time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	l := s.ingester(instance)
+	l.PendingSegments++
+	if s.pending != nil {
+		s.pending.WithLabelValues(instance).Set(float64(l.PendingSegments))
+	}
+	if !oldest.IsZero() {
+		s.observe(l, oldest)
+	}
+}
+
+// drained is when the ingester had no segment to give, so there's no lag.
+func (s *ConsumeScheduler) drained(instance string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.observe(s.ingester(instance), time.Time{})
+}
+
+// observe the lag of the ingester: since its oldest record, or none, if
+// oldest is zero.
+func (s *ConsumeScheduler) observe(l *IngesterLag, oldest time.Time) {
+	now := s.now()
+	var lag time.Duration
+	if !oldest.IsZero() {
+		lag = now.Sub(oldest)
+	}
+	if lag < 0 {
+		lag = 0 // clocks differ
+	}
+	l.LagSeconds, l.Observed = lag.Seconds(), now.UTC()
+	if s.lag != nil {
+		s.lag.WithLabelValues(l.Ingester).Set(l.LagSeconds)
+	}
+}
+
+// ingester returns the lag of the ingester, which it's added to those
+// tracked, if it wasn't already.
+func (s *ConsumeScheduler) ingester(instance string) *IngesterLag {
+	l, ok := s.ingesters[instance]
+	if !ok {
+		l = &IngesterLag{Ingester: instance}
+		s.ingesters[instance] = l
+	}
+	return l
+}
+
+// forget the ingesters that have left, i.e. aren't in the sorted instances,
+// once nothing of theirs is pending.
+func (s *ConsumeScheduler) forget(sorted []string) {
+	for instance, l := range s.ingesters {
+		if i := sort.SearchStrings(sorted, instance); i < len(sorted) && sorted[i] == instance {
+			continue
+		}
+		if l.PendingSegments > 0 {
+			continue
+		}
+		for _, gauge := range []*prometheus.GaugeVec{s.lag, s.pending, s.lastCommit} {
+			if gauge != nil {
+				gauge.DeleteLabelValues(instance)
+			}
+		}
+		delete(s.ingesters, instance)
+	}
+}
+
+// Lag returns how far behind the consumers are.
+func (s *ConsumeScheduler) Lag() ConsumeLag {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	lag := ConsumeLag{Ingesters: make([]IngesterLag, 0, len(s.ingesters))}
+	for _, l := range s.ingesters {
+		lag.Ingesters = append(lag.Ingesters, *l)
+	}
+	sort.Slice(lag.Ingesters, func(i, j int) bool { return lag.Ingesters[i].Ingester < lag.Ingesters[j].Ingester })
+	return lag
+}
+
+// ServeHTTP serves the lag, as JSON.
+func (s *ConsumeScheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	buf, err := json.MarshalIndent(s.Lag(), "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(buf)
+}
@@ -0,0 +1,402 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/ingest"
+)
+
+func TestConsumeSchedulerNext(t *testing.T) {
+	t.Parallel()
+
+	var (
+		s         = NewConsumeScheduler(1, nil, nil, nil)
+		instances = []string{"c", "a", "b"}
+		all       = func(string) bool { return true }
+		none      = func(string) bool { return false }
+		only      = func(instance string) func(string) bool {
+			return func(i string) bool { return i == instance }
+		}
+		not = func(instance string) func(string) bool {
+			return func(i string) bool { return i != instance }
+		}
+	)
+	for _, testcase := range []struct {
+		name    string
+		release string
+		allow   func(string) bool
+		held    func(string) bool
+		want    string
+	}{
+		{"first", "", all, none, "a"},
+		{"second", "", all, none, "b"},
+		{"third", "", all, none, "c"},
+		{"all at the limit", "", all, none, ""},
+		{"held", "", all, only("a"), "a"},
+		{"released", "b", all, none, "b"},
+		{"breaker open", "b", not("b"), none, ""},
+		{"after the last", "", all, none, "b"},
+	} {
+		if testcase.release != "" {
+			s.release(testcase.release, 0, false)
+		}
+		if want, have := testcase.want, s.next(instances, testcase.allow, testcase.held); want != have {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+	}
+
+	// Without a limit, they're just taken in turn, even when the last has
+	// left.
+	s = NewConsumeScheduler(0, nil, nil, nil)
+	var have []string
+	for i := 0; i < 4; i++ {
+		have = append(have, s.next(instances, all, none))
+	}
+	have = append(have, s.next([]string{"b", "c"}, all, none))
+	if want := "a b c a b"; want != strings.Join(have, " ") {
+		t.Errorf("no limit: want %s, have %s", want, strings.Join(have, " "))
+	}
+	if want, have := 2, s.inflight["a"]; want != have {
+		t.Errorf("no limit: want a in flight %d times, have %d", want, have)
+	}
+}
+
+func TestConsumeSchedulerLag(t *testing.T) {
+	t.Parallel()
+
+	var (
+		gauges = map[string]*prometheus.GaugeVec{}
+		now    = time.Unix(1500000000, 0)
+	)
+	for _, name := range []string{"lag", "pending", "last_commit"} {
+		gauges[name] = prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"ingester"})
+	}
+	s := NewConsumeScheduler(0, gauges["lag"], gauges["pending"], gauges["last_commit"])
+	s.now = func() time.Time { return now }
+	gauge := func(name, instance string) float64 {
+		var m dto.Metric
+		gauges[name].WithLabelValues(instance).Write(&m)
+		return m.GetGauge().GetValue()
+	}
+
+	// a has a backlog, two segments of which are gathered, b has none, and
+	// c's clock is ahead of ours.
+	s.gathered("a", now.Add(-time.Minute))
+	s.gathered("a", time.Time{}) // every record a duplicate
+	s.drained("b")
+	s.gathered("c", now.Add(time.Second))
+	for _, testcase := range []struct {
+		instance string
+		lag      float64
+		pending  float64
+	}{
+		{"a", 60, 2},
+		{"b", 0, 0},
+		{"c", 0, 1},
+	} {
+		if want, have := testcase.lag, gauge("lag", testcase.instance); want != have {
+			t.Errorf("%s: want lag %v, have %v", testcase.instance, want, have)
+		}
+		if want, have := testcase.pending, gauge("pending", testcase.instance); want != have {
+			t.Errorf("%s: want %v pending, have %v", testcase.instance, want, have)
+		}
+	}
+
+	// Committed, a's segments are no longer pending; c's are failed.
+	now = now.Add(time.Second)
+	s.release("a", 2, true)
+	s.release("c", 1, false)
+	want := ConsumeLag{Ingesters: []IngesterLag{
+		{Ingester: "a", LagSeconds: 60, LastCommit: now.UTC(), Observed: now.Add(-time.Second).UTC()},
+		{Ingester: "b", Observed: now.Add(-time.Second).UTC()},
+		{Ingester: "c", Observed: now.Add(-time.Second).UTC()},
+	}}
+	if have := s.Lag(); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %+v, have %+v", want, have)
+	}
+	if want, have := float64(now.Unix()), gauge("last_commit", "a"); want != have {
+		t.Errorf("want last commit %v, have %v", want, have)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", APIPathLag, nil))
+	var have ConsumeLag
+	if err := json.Unmarshal(w.Body.Bytes(), &have); err != nil {
+		t.Fatal(err)
+	}
+	for i := range have.Ingesters {
+		have.Ingesters[i].LastCommit = have.Ingesters[i].LastCommit.UTC()
+		have.Ingesters[i].Observed = have.Ingesters[i].Observed.UTC()
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("GET: want %+v, have %+v", want, have)
+	}
+
+	// Ingesters that leave are forgotten, unless segments of theirs are
+	// pending.
+	s.gathered("b", now)
+	s.next([]string{"a"}, func(string) bool { return true }, func(string) bool { return false })
+	var ingesters []string
+	for _, l := range s.Lag().Ingesters {
+		ingesters = append(ingesters, l.Ingester)
+	}
+	if want, have := "a b", strings.Join(ingesters, " "); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	metrics := make(chan prometheus.Metric, 3)
+	gauges["lag"].Collect(metrics)
+	close(metrics)
+	if want, have := 2, len(metrics); want != have {
+		t.Errorf("want %d lag, have %d", want, have)
+	}
+}
+
+func TestConsumersFairness(t *testing.T) {
+	t.Parallel()
+
+	// One ingester with a deep backlog, and two with a few segments each.
+	store := newFakeStore()
+	defer store.Close()
+	var (
+		deep      = newFakeIngester(30)
+		shallow   = []*fakeIngester{newFakeIngester(3), newFakeIngester(3)}
+		ingesters = []*fakeIngester{deep, shallow[0], shallow[1]}
+		hostports []string
+	)
+	for _, ing := range ingesters {
+		defer ing.Close()
+		hostports = append(hostports, ing.hostport())
+	}
+
+	// Three consumers, at most one gathering from an ingester at once.
+	var (
+		peers     = typedPeers{cluster.PeerTypeIngest: hostports, cluster.PeerTypeStore: {store.hostport()}}
+		scheduler = NewConsumeScheduler(1, nil, nil, nil)
+		consumers = make([]*Consumer, 3)
+	)
+	for i := range consumers {
+		consumers[i] = newScheduledConsumer(peers, scheduler)
+	}
+	for round := 1; round <= 4; round++ {
+		for _, c := range consumers {
+			c.gather()
+			for _, ing := range ingesters {
+				var holders int
+				for _, c := range consumers {
+					if len(c.pending[ing.hostport()]) > 0 {
+						holders++
+					}
+				}
+				if holders > 1 {
+					t.Fatalf("round %d: %d consumers gathering from %s, over the limit", round, holders, ing.hostport())
+				}
+			}
+		}
+	}
+	for _, c := range consumers {
+		if next := c.replicate(); next != nil {
+			next()
+		}
+	}
+
+	// The deep backlog doesn't hold up the others: every segment of theirs
+	// is consumed, while its consumer takes its segments in turn.
+	for i, ing := range shallow {
+		if want, have := 3, ing.committedCount(); want != have {
+			t.Errorf("shallow %d: want %d segments committed, have %d", i, want, have)
+		}
+	}
+	if want, have := 4, deep.committedCount(); want != have {
+		t.Errorf("deep: want %d segments committed, have %d", want, have)
+	}
+	if want, have := 0, len(scheduler.inflight); want != have {
+		t.Errorf("want %d ingesters in flight, have %d", want, have)
+	}
+
+	// The deep backlog is a minute behind, and the others not at all.
+	for _, l := range scheduler.Lag().Ingesters {
+		want := 0.
+		if l.Ingester == deep.hostport() {
+			want = 60
+		}
+		if have := l.LagSeconds; have < want-1 || have > want+5 { // ULIDs are to the millisecond
+			t.Errorf("%s: want lag about %vs, have %vs", l.Ingester, want, have)
+		}
+		if l.PendingSegments != 0 || l.LastCommit.IsZero() {
+			t.Errorf("%s: want everything committed, have %d pending, last commit %s", l.Ingester, l.PendingSegments, l.LastCommit)
+		}
+	}
+}
+
+func TestConsumerScheduledReadFailed(t *testing.T) {
+	t.Parallel()
+
+	store := newFakeStore()
+	defer store.Close()
+	a, b := newFakeIngester(1), newFakeIngester(1)
+	defer a.Close()
+	defer b.Close()
+	if a.hostport() > b.hostport() {
+		a, b = b, a // in the order they're scheduled
+	}
+	var (
+		peers     = typedPeers{cluster.PeerTypeIngest: {a.hostport(), b.hostport()}, cluster.PeerTypeStore: {store.hostport()}}
+		scheduler = NewConsumeScheduler(1, nil, nil, nil)
+		c         = newScheduledConsumer(peers, scheduler)
+	)
+	b.breakRead()
+
+	// The consumer gathers from one ingester, and the read from the other
+	// is cut short: everything it has pending is failed, and the ingesters
+	// are free for the next consumer to take.
+	c.gather()
+	if next := c.gather(); next != nil {
+		next()
+	}
+	if want, have := 2, a.failedCount()+b.failedCount(); want != have {
+		t.Errorf("want %d segments failed, have %d", want, have)
+	}
+	if want, have := 0, len(scheduler.inflight); want != have {
+		t.Errorf("want %d ingesters in flight, have %d", want, have)
+	}
+
+	// Consumed again, they're committed.
+	c.gather()
+	c.gather()
+	if next := c.replicate(); next != nil {
+		next()
+	}
+	if want, have := 2, a.committedCount()+b.committedCount(); want != have {
+		t.Errorf("want %d segments committed, have %d", want, have)
+	}
+	if want, have := 0, len(scheduler.inflight); want != have {
+		t.Errorf("want %d ingesters in flight, have %d", want, have)
+	}
+}
+
+func newScheduledConsumer(peers typedPeers, scheduler *ConsumeScheduler) *Consumer {
+	return NewConsumer(
+		peers,
+		"",
+		http.DefaultClient,
+		1024*1024, time.Hour, time.Hour, // only gather when told
+		1,
+		0, 0,
+		nil, nil, scheduler,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		&eventRecorder{},
+	)
+}
+
+// fakeIngester serves its queue of segments, one record each, to consumers.
+type fakeIngester struct {
+	*httptest.Server
+	mtx       sync.Mutex
+	queue     []string
+	pending   map[string]string
+	seq       int
+	broken    bool // the next read is cut short
+	committed int
+	failed    int
+}
+
+func newFakeIngester(segments int) *fakeIngester {
+	ing := &fakeIngester{pending: map[string]string{}}
+	t0 := time.Now().Add(-time.Minute)
+	for i := 0; i < segments; i++ {
+		id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Millisecond)), nil)
+		ing.queue = append(ing.queue, fmt.Sprintf("%s segment %d\n", id, i))
+	}
+	ing.Server = httptest.NewServer(http.HandlerFunc(ing.serveHTTP))
+	return ing
+}
+
+func (ing *fakeIngester) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	ing.mtx.Lock()
+	defer ing.mtx.Unlock()
+	id := r.URL.Query().Get("id")
+	switch r.URL.Path {
+	case "/ingest" + ingest.APIPathNext:
+		if len(ing.queue) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		ing.seq++
+		id = strconv.Itoa(ing.seq)
+		ing.pending[id], ing.queue = ing.queue[0], ing.queue[1:]
+		w.Header().Set(ingest.HTTPHeaderFlushed, time.Now().Add(-time.Minute).UTC().Format(time.RFC3339Nano))
+		fmt.Fprint(w, id)
+	case "/ingest" + ingest.APIPathRead:
+		segment := ing.pending[id]
+		if !ing.broken {
+			fmt.Fprint(w, segment)
+			return
+		}
+		ing.broken = false
+		w.Header().Set("Content-Length", strconv.Itoa(len(segment)))
+		fmt.Fprint(w, segment[:len(segment)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	case "/ingest" + ingest.APIPathCommit:
+		delete(ing.pending, id)
+		ing.committed++
+	case "/ingest" + ingest.APIPathFailed:
+		ing.queue = append([]string{ing.pending[id]}, ing.queue...)
+		delete(ing.pending, id)
+		ing.failed++
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (ing *fakeIngester) hostport() string { return strings.TrimPrefix(ing.URL, "http://") }
+
+func (ing *fakeIngester) breakRead() {
+	ing.mtx.Lock()
+	defer ing.mtx.Unlock()
+	ing.broken = true
+}
+
+func (ing *fakeIngester) committedCount() int {
+	ing.mtx.Lock()
+	defer ing.mtx.Unlock()
+	return ing.committed
+}
+
+func (ing *fakeIngester) failedCount() int {
+	ing.mtx.Lock()
+	defer ing.mtx.Unlock()
+	return ing.failed
+}
+
+// fakeStore takes every segment replicated to it.
+type fakeStore struct{ *httptest.Server }
+
+func newFakeStore() fakeStore {
+	return fakeStore{httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/store"+APIPathReplicate {
+			http.NotFound(w, r)
+			return
+		}
+		ioutil.ReadAll(r.Body)
+	}))}
+}
+
+func (s fakeStore) hostport() string { return strings.TrimPrefix(s.URL, "http://") }
@@ -0,0 +1,443 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/breaker"
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/ingest"
+)
+
+func TestConsumerReplicate(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		peers      int
+		replicated int
+		warning    bool
+	}{
+		{peers: 1, replicated: 1, warning: true},
+		{peers: 2, replicated: 2, warning: true},
+		{peers: 5, replicated: 3, warning: false},
+	} {
+		t.Run(fmt.Sprint(testcase.peers), func(t *testing.T) {
+			var (
+				mtx      sync.Mutex
+				received = map[string]string{}
+				ships    int // replicas told to ship the segment
+				peers    []string
+			)
+			for i := 0; i < testcase.peers; i++ {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path != "/store"+APIPathReplicate {
+						http.NotFound(w, r)
+						return
+					}
+					buf, _ := ioutil.ReadAll(r.Body)
+					mtx.Lock()
+					received[r.Host] = string(buf)
+					if r.Header.Get(httpHeaderShip) == "true" {
+						ships++
+					}
+					mtx.Unlock()
+				}))
+				defer server.Close()
+				peers = append(peers, strings.TrimPrefix(server.URL, "http://"))
+			}
+
+			reporter := &eventRecorder{}
+			c := NewConsumer(
+				staticPeer(peers),
+				"",
+				http.DefaultClient,
+				1024, time.Second, time.Second,
+				3,
+				0, 0,
+				nil, nil, nil,
+				prometheus.NewCounter(prometheus.CounterOpts{}),
+				prometheus.NewCounter(prometheus.CounterOpts{}),
+				prometheus.NewCounter(prometheus.CounterOpts{}),
+				prometheus.NewCounter(prometheus.CounterOpts{}),
+				reporter,
+			)
+			c.active.WriteString(recordA + recordB)
+			c.replicate()
+
+			if want, have := testcase.replicated, len(received); want != have {
+				t.Errorf("replicated: want %d, have %d", want, have)
+			}
+			for peer, segment := range received {
+				if want, have := recordA+recordB, segment; want != have {
+					t.Errorf("%s: want %q, have %q", peer, want, have)
+				}
+			}
+			if want, have := 1, ships; want != have {
+				t.Errorf("shipping replicas: want %d, have %d", want, have)
+			}
+			var warning, failed bool
+			for _, e := range reporter.events {
+				warning = warning || e.Warning != nil
+				failed = failed || e.Error != nil
+			}
+			if want, have := testcase.warning, warning; want != have {
+				t.Errorf("warning: want %v, have %v", want, have)
+			}
+			if failed {
+				t.Errorf("replicate failed: %+v", reporter.events)
+			}
+		})
+	}
+}
+
+func TestConsumerReplicateBreakers(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mtx      sync.Mutex
+		received = map[string]int{}
+		peers    []string
+	)
+	for i := 0; i < 3; i++ {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ioutil.ReadAll(r.Body)
+			mtx.Lock()
+			received[r.Host]++
+			mtx.Unlock()
+		}))
+		defer server.Close()
+		peers = append(peers, strings.TrimPrefix(server.URL, "http://"))
+	}
+
+	// A target whose breaker is open is skipped, in favor of the others.
+	breakers := breaker.NewSet(breaker.Policy{Failures: 1, Cooldown: time.Hour}, prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"peer"}))
+	breakers.Failure(peers[0])
+	reporter := &eventRecorder{}
+	c := NewConsumer(
+		staticPeer(peers),
+		"",
+		http.DefaultClient,
+		1024, time.Second, time.Second,
+		2,
+		0, 0,
+		nil, breakers, nil,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		reporter,
+	)
+	c.active.WriteString(recordA + recordB)
+	c.replicate()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if want, have := map[string]int{peers[1]: 1, peers[2]: 1}, received; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	for _, e := range reporter.events {
+		if e.Error != nil {
+			t.Errorf("replicate failed: %+v", e)
+		}
+	}
+}
+
+func TestConsumerReplicateNoPeers(t *testing.T) {
+	t.Parallel()
+
+	// With no store peers, the segment fails, and the failure is reported.
+	reporter := &eventRecorder{}
+	c := NewConsumer(
+		staticPeer(nil),
+		"",
+		http.DefaultClient,
+		1024, time.Second, time.Second,
+		2,
+		0, 0,
+		nil, nil, nil,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		reporter,
+	)
+	c.active.WriteString(recordA + recordB)
+	c.replicate()
+
+	reporter.mtx.Lock()
+	defer reporter.mtx.Unlock()
+	if want, have := 1, len(reporter.events); want != have {
+		t.Fatalf("want %d event, have %d: %+v", want, have, reporter.events)
+	}
+	if e := reporter.events[0]; e.Op != "replicate" || e.Error == nil {
+		t.Errorf("want a replicate error, have %+v", e)
+	}
+}
+
+func TestConsumerReplicateReadOnly(t *testing.T) {
+	t.Parallel()
+
+	// Read-only store nodes get copies of each segment, on top of the
+	// replication factor, but their failures don't fail the segment.
+	for _, testcase := range []struct {
+		name       string
+		readOnly   int
+		failing    bool // read-only nodes
+		replicated int  // to read-only nodes
+	}{
+		{name: "none", readOnly: 0, replicated: 0},
+		{name: "fewer than the factor", readOnly: 1, replicated: 1},
+		{name: "more than the factor", readOnly: 3, replicated: 2},
+		{name: "failing", readOnly: 2, failing: true, replicated: 0},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var (
+				mtx      sync.Mutex
+				received = map[string]bool{}
+				peers    = typedPeers{}
+				servers  []*httptest.Server
+			)
+			defer func() {
+				for _, server := range servers {
+					server.Close()
+				}
+			}()
+			newServer := func(typ cluster.PeerType, status int) {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					ioutil.ReadAll(r.Body)
+					if status != http.StatusOK {
+						w.WriteHeader(status)
+						return
+					}
+					mtx.Lock()
+					received[r.Host] = true
+					mtx.Unlock()
+				}))
+				servers = append(servers, server)
+				peers[typ] = append(peers[typ], strings.TrimPrefix(server.URL, "http://"))
+			}
+			for i := 0; i < 2; i++ {
+				newServer(cluster.PeerTypeStore, http.StatusOK)
+			}
+			status := http.StatusOK
+			if testcase.failing {
+				status = http.StatusInternalServerError
+			}
+			for i := 0; i < testcase.readOnly; i++ {
+				newServer(cluster.PeerTypeReadOnlyStore, status)
+			}
+
+			var (
+				replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+				c                  = NewConsumer(
+					peers,
+					"",
+					http.DefaultClient,
+					1024, time.Second, time.Second,
+					2,
+					0, 0,
+					nil, nil, nil,
+					prometheus.NewCounter(prometheus.CounterOpts{}),
+					prometheus.NewCounter(prometheus.CounterOpts{}),
+					replicatedSegments,
+					prometheus.NewCounter(prometheus.CounterOpts{}),
+					&eventRecorder{},
+				)
+			)
+			c.active.WriteString(recordA + recordB)
+			c.replicate()
+
+			var readOnly int
+			for _, hostport := range peers[cluster.PeerTypeReadOnlyStore] {
+				if received[hostport] {
+					readOnly++
+				}
+			}
+			if want, have := testcase.replicated, readOnly; want != have {
+				t.Errorf("replicated to read-only nodes: want %d, have %d", want, have)
+			}
+			if want, have := 2, len(received)-readOnly; want != have {
+				t.Errorf("replicated to store nodes: want %d, have %d", want, have)
+			}
+			var m dto.Metric
+			replicatedSegments.Write(&m)
+			if want, have := 1.0, m.GetCounter().GetValue(); want != have {
+				t.Errorf("replicated segments: want %v, have %v", want, have)
+			}
+		})
+	}
+}
+
+func TestConsumerDrain(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mtx        sync.Mutex
+		replicated string
+		origins    []string
+		committed  []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		switch r.URL.Path {
+		case "/store" + APIPathReplicate:
+			buf, _ := ioutil.ReadAll(r.Body)
+			replicated = string(buf)
+			origins = r.Header[httpHeaderOrigins]
+		case "/ingest/commit":
+			committed = append(committed, r.URL.Query().Get("id"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	hostport := strings.TrimPrefix(server.URL, "http://")
+
+	c := NewConsumer(
+		staticPeer{hostport},
+		"",
+		http.DefaultClient,
+		1024, time.Hour, time.Hour, // never gather
+		1,
+		0, 0,
+		nil, nil, nil,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		&eventRecorder{},
+	)
+	c.active.WriteString(recordA + recordB)
+	c.activeSince = time.Now()
+	c.pending[hostport] = []string{"segment-1"}
+	c.origins["env=staging"] = true
+	go c.Run()
+	defer c.Stop()
+
+	// Draining replicates and commits the in-flight segment.
+	c.Drain()
+	mtx.Lock()
+	defer mtx.Unlock()
+	if want, have := recordA+recordB, replicated; want != have {
+		t.Errorf("replicated: want %q, have %q", want, have)
+	}
+	if want, have := []string{"env=staging"}, origins; !reflect.DeepEqual(want, have) {
+		t.Errorf("origins: want %v, have %v", want, have)
+	}
+	if want, have := []string{"segment-1"}, committed; !reflect.DeepEqual(want, have) {
+		t.Errorf("committed: want %v, have %v", want, have)
+	}
+	if want, have := 0, c.active.Len(); want != have {
+		t.Errorf("active: want %d bytes, have %d", want, have)
+	}
+}
+
+func TestConsumerDedup(t *testing.T) {
+	t.Parallel()
+
+	// An ingester, which is also the store node, serving the batch of
+	// segments it's given, in order.
+	var (
+		mtx        sync.Mutex
+		queue      []string
+		replicated []string
+		t0         = time.Now().Add(-time.Minute)
+		seq        int
+	)
+	record := func(payload string) string {
+		seq++
+		return fmt.Sprintf("%s %s\n", ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(seq)*time.Millisecond)), nil), payload)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		switch r.URL.Path {
+		case "/ingest" + ingest.APIPathNext:
+			if len(queue) == 0 {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, len(queue))
+		case "/ingest" + ingest.APIPathRead:
+			fmt.Fprint(w, queue[0])
+			queue = queue[1:]
+		case "/ingest" + ingest.APIPathCommit, "/ingest" + ingest.APIPathFailed:
+		case "/store" + APIPathReplicate:
+			buf, _ := ioutil.ReadAll(r.Body)
+			replicated = append(replicated, string(buf))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	hostport := strings.TrimPrefix(server.URL, "http://")
+
+	var (
+		dropped = prometheus.NewCounter(prometheus.CounterOpts{})
+		c       = NewConsumer(
+			typedPeers{cluster.PeerTypeIngest: {hostport}, cluster.PeerTypeStore: {hostport}},
+			"",
+			http.DefaultClient,
+			1024, time.Hour, time.Hour, // only gather when told
+			1,
+			0, 0,
+			NewDeduper(time.Hour, dropped), nil, nil,
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			&eventRecorder{},
+		)
+	)
+	consume := func(segments ...string) string {
+		mtx.Lock()
+		queue, replicated = segments, nil
+		mtx.Unlock()
+		for range segments {
+			c.gather()
+		}
+		if next := c.replicate(); next != nil {
+			next()
+		}
+		mtx.Lock()
+		defer mtx.Unlock()
+		if len(replicated) != 1 {
+			t.Fatalf("want 1 segment replicated, have %d", len(replicated))
+		}
+		return replicated[0]
+	}
+
+	// The same batch, ingested twice, with other ULIDs, e.g. because a
+	// forwarder wrote it again, is only stored once, whether it's consumed
+	// in the same batch as the original or a later one.
+	var (
+		a1, b1 = record("A payload"), record("B payload")
+		a2, b2 = record("A payload"), record("B payload")
+		c2     = record("C payload")
+		a3, b3 = record("A payload"), record("B payload")
+		d3     = record("D payload")
+	)
+	if want, have := a1+b1+c2, consume(a1+b1, a2+b2+c2); want != have {
+		t.Errorf("same batch: want %q, have %q", want, have)
+	}
+	if want, have := d3, consume(a3+b3+d3); want != have {
+		t.Errorf("later batch: want %q, have %q", want, have)
+	}
+	var m dto.Metric
+	dropped.Write(&m)
+	if want, have := 4., m.GetCounter().GetValue(); want != have {
+		t.Errorf("dropped: want %v, have %v", want, have)
+	}
+}
@@ -0,0 +1,201 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"sort"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+)
+
+// continuation is what a continuation token encodes: the last record of the
+// page it continues, and, for each store node, how far the segments it read
+// were read. A page starts after the last record, backward before it, in
+// every segment but those a node hadn't read, which landed since, e.g. as
+// late replication, and may have older records, which would be skipped
+// otherwise. Tokens of the last record alone, as ContinueToken returns, and
+// as nodes that predate positions return, continue every segment after it.
+type continuation struct {
+	last  ulid.ULID
+	nodes map[string][]segmentPosition // by the address peers query the node at
+}
+
+// segmentPosition is how far the records of a segment, by its name, were
+// read: up to, and including, read, or backward, down to it. A zero read is
+// nowhere, i.e. the segment is read in full.
+type segmentPosition struct {
+	low, high ulid.ULID
+	read      ulid.ULID
+}
+
+// decodeContinuation decodes a continuation token.
+func decodeContinuation(token string) (c continuation, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, errors.Wrap(err, "invalid continuation token")
+	}
+	if len(b) < len(c.last) {
+		return c, errors.New("invalid continuation token")
+	}
+	copy(c.last[:], b)
+	r := bytes.NewReader(b[len(c.last):])
+	if r.Len() == 0 {
+		return c, nil // of the last record alone
+	}
+	c.nodes = map[string][]segmentPosition{}
+	for r.Len() > 0 {
+		node, err := readTokenBytes(r)
+		if err != nil {
+			return c, err
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > uint64(r.Len()/(3*len(c.last))) {
+			return c, errors.New("invalid continuation token")
+		}
+		positions := make([]segmentPosition, n)
+		for i := range positions {
+			r.Read(positions[i].low[:])
+			r.Read(positions[i].high[:])
+			r.Read(positions[i].read[:])
+		}
+		c.nodes[string(node)] = positions
+	}
+	return c, nil
+}
+
+func readTokenBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, errors.New("invalid continuation token")
+	}
+	b := make([]byte, n)
+	r.Read(b)
+	return b, nil
+}
+
+// encode the continuation as an opaque token. Without nodes, it's the token
+// of the last record alone.
+func (c continuation) encode() string {
+	var (
+		buf   bytes.Buffer
+		n     [binary.MaxVarintLen64]byte
+		nodes = make([]string, 0, len(c.nodes))
+	)
+	buf.Write(c.last[:])
+	for node := range c.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		buf.Write(n[:binary.PutUvarint(n[:], uint64(len(node)))])
+		buf.WriteString(node)
+		positions := c.nodes[node]
+		buf.Write(n[:binary.PutUvarint(n[:], uint64(len(positions)))])
+		for _, p := range positions {
+			buf.Write(p.low[:])
+			buf.Write(p.high[:])
+			buf.Write(p.read[:])
+		}
+	}
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes())
+}
+
+// segmentBounds returns where each of the segments a node reads is read
+// from, given the continuation of the previous page. A segment the node read
+// is read on from its position, and one another node read, e.g. as planned
+// there before, from that node's. One that no node read may be the result of
+// compacting some the node read, that are no longer present, so it's read on
+// from the furthest position of theirs it overlaps. Otherwise, it landed
+// since, and it's read in full, whatever the ULIDs of its records, unless the
+// node read no segments at all, as far as the continuation knows, in which
+// case it's read on from the last record, as it always was. The order of the
+// bounds is that of the segments.
+//
+// Records that land in a segment that's compacted with gone ones before the
+// next page are skipped, if they're before the position the gone segments
+// were read to; that's the price of not returning the gone ones' again.
+func segmentBounds(c continuation, node string, present map[[2]ulid.ULID]bool, segments []readSegment, backward bool) []segmentPosition {
+	own, ok := c.nodes[node]
+	var (
+		bounds = make([]segmentPosition, len(segments))
+		read   = map[[2]ulid.ULID]ulid.ULID{} // by any node, the furthest
+		gone   []segmentPosition
+	)
+	for _, positions := range c.nodes {
+		for _, p := range positions {
+			name := [2]ulid.ULID{p.low, p.high}
+			if r, ok := read[name]; !ok || further(p.read, r, backward) {
+				read[name] = p.read
+			}
+		}
+	}
+	for _, p := range own {
+		if !present[[2]ulid.ULID{p.low, p.high}] && p.read != (ulid.ULID{}) {
+			gone = append(gone, p)
+		}
+	}
+	for i, s := range segments {
+		var listed bool
+		low, high, _ := parseFilename(s.path) // the index has only valid names
+		bounds[i] = segmentPosition{low: low, high: high}
+		if bounds[i].read, listed = read[[2]ulid.ULID{low, high}]; listed {
+			continue
+		}
+		if !ok {
+			bounds[i].read = c.last
+			continue
+		}
+		for _, g := range gone {
+			if g.low.Compare(high) > 0 || g.high.Compare(low) < 0 {
+				continue // doesn't overlap
+			}
+			if bounds[i].read == (ulid.ULID{}) || further(g.read, bounds[i].read, backward) {
+				bounds[i].read = g.read
+			}
+		}
+	}
+	return bounds
+}
+
+// further returns whether a is further than b, in the order.
+func further(a, b ulid.ULID, backward bool) bool {
+	if backward {
+		return a.Compare(b) < 0
+	}
+	return a.Compare(b) > 0
+}
+
+// advance returns the positions of segments, read on from their bounds, once
+// a page ends with the last record: every record of every segment up to it,
+// or backward, down to it, was read. Segments read in full that start after
+// it, or backward, end before it, weren't read at all, and are left out.
+func advance(bounds []segmentPosition, last ulid.ULID, backward bool) []segmentPosition {
+	positions := make([]segmentPosition, 0, len(bounds))
+	for _, b := range bounds {
+		switch {
+		case b.read == (ulid.ULID{}) && !backward && b.low.Compare(last) > 0:
+			continue
+		case b.read == (ulid.ULID{}) && backward && b.high.Compare(last) < 0:
+			continue
+		case b.read == (ulid.ULID{}), further(last, b.read, backward):
+			b.read = last
+		}
+		positions = append(positions, b)
+	}
+	return positions
+}
+
+// readPast returns whether the bound is past every record of its segment,
+// which then needn't be read.
+func (b segmentPosition) readPast(backward bool) bool {
+	switch {
+	case b.read == (ulid.ULID{}):
+		return false
+	case backward:
+		return b.read.Compare(b.low) <= 0
+	default:
+		return b.read.Compare(b.high) >= 0
+	}
+}
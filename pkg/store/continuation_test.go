@@ -0,0 +1,140 @@
+package store
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"github.com/oklog/ulid"
+)
+
+func TestContinuationEncoding(t *testing.T) {
+	t.Parallel()
+
+	idOf := func(record string) ulid.ULID { return ulid.MustParse(record[:ulid.EncodedSize]) }
+	var (
+		a = idOf(recordA)
+		c = idOf(recordC)
+		e = idOf(recordE)
+		i = idOf(recordI)
+	)
+	for _, testcase := range []struct {
+		name string
+		c    continuation
+	}{
+		{"last alone", continuation{last: c}},
+		{"one node", continuation{last: c, nodes: map[string][]segmentPosition{
+			"store-1:7650": {{low: a, high: i, read: c}, {low: e, high: i}},
+		}}},
+		{"two nodes", continuation{last: c, nodes: map[string][]segmentPosition{
+			"store-1:7650": {{low: a, high: i, read: c}},
+			"store-2:7650": {},
+		}}},
+	} {
+		have, err := decodeContinuation(testcase.c.encode())
+		if err != nil {
+			t.Fatalf("%s: %v", testcase.name, err)
+		}
+		if want := testcase.c; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %+v, have %+v", testcase.name, want, have)
+		}
+	}
+
+	// Tokens of the last record alone are those ContinueToken always made.
+	if want, have := ContinueToken(c), (continuation{last: c}).encode(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	truncated := base64.RawURLEncoding.EncodeToString(append(c[:], 0, 1)) // of one position, missing
+	for _, token := range []string{"", "AAAA", truncated} {
+		if _, err := decodeContinuation(token); err == nil {
+			t.Errorf("%q: want error, have none", token)
+		}
+	}
+}
+
+func TestSegmentBounds(t *testing.T) {
+	t.Parallel()
+
+	idOf := func(record string) ulid.ULID { return ulid.MustParse(record[:ulid.EncodedSize]) }
+	var (
+		a, b, c = idOf(recordA), idOf(recordB), idOf(recordC)
+		e, g, i = idOf(recordE), idOf(recordG), idOf(recordI)
+		name    = func(low, high ulid.ULID) string { return low.String() + "-" + high.String() + extFlushed }
+		present = func(names ...[2]ulid.ULID) map[[2]ulid.ULID]bool {
+			m := map[[2]ulid.ULID]bool{}
+			for _, n := range names {
+				m[n] = true
+			}
+			return m
+		}
+	)
+	for _, testcase := range []struct {
+		name     string
+		c        continuation
+		present  map[[2]ulid.ULID]bool
+		segments [][2]ulid.ULID
+		want     []ulid.ULID
+	}{
+		{
+			name:     "from the last record, without positions",
+			c:        continuation{last: c},
+			segments: [][2]ulid.ULID{{a, e}, {b, i}},
+			want:     []ulid.ULID{c, c},
+		},
+		{
+			name:     "landed late",
+			c:        continuation{last: c, nodes: map[string][]segmentPosition{"": {{low: a, high: e, read: c}}}},
+			present:  present([2]ulid.ULID{a, e}, [2]ulid.ULID{b, b}),
+			segments: [][2]ulid.ULID{{a, e}, {b, b}},
+			want:     []ulid.ULID{c, {}},
+		},
+		{
+			name:     "read by another node",
+			c:        continuation{last: e, nodes: map[string][]segmentPosition{"": {}, "other": {{low: a, high: i, read: e}}}},
+			present:  present([2]ulid.ULID{a, i}),
+			segments: [][2]ulid.ULID{{a, i}},
+			want:     []ulid.ULID{e},
+		},
+		{
+			name:     "compacted",
+			c:        continuation{last: e, nodes: map[string][]segmentPosition{"": {{low: a, high: c, read: c}, {low: b, high: g, read: e}}}},
+			present:  present([2]ulid.ULID{a, g}),
+			segments: [][2]ulid.ULID{{a, g}},
+			want:     []ulid.ULID{e},
+		},
+	} {
+		segments := make([]readSegment, len(testcase.segments))
+		for n, s := range testcase.segments {
+			segments[n] = readSegment{path: name(s[0], s[1])}
+		}
+		var have []ulid.ULID
+		for _, b := range segmentBounds(testcase.c, "", testcase.present, segments, false) {
+			have = append(have, b.read)
+		}
+		if want := testcase.want; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %v, have %v", testcase.name, want, have)
+		}
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	t.Parallel()
+
+	idOf := func(record string) ulid.ULID { return ulid.MustParse(record[:ulid.EncodedSize]) }
+	var (
+		a, c, e = idOf(recordA), idOf(recordC), idOf(recordE)
+		g, i    = idOf(recordG), idOf(recordI)
+		bounds  = []segmentPosition{
+			{low: a, high: e},          // read in full, up to the last record
+			{low: g, high: i},          // read in full, not reached
+			{low: a, high: i, read: g}, // read past the last record, before
+		}
+	)
+	want := []segmentPosition{
+		{low: a, high: e, read: c},
+		{low: a, high: i, read: g},
+	}
+	if have := advance(bounds, c, false); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %+v, have %+v", want, have)
+	}
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"bytes"
+	"hash"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dedupGenerations is how many generations of record hashes a Deduper keeps,
+// each a fraction of its window, besides the current one.
+const dedupGenerations = 4
+
+// Deduper remembers the records consumers consumed within a window, by their
+// content, i.e. their topic and payload, but not their ULID, so consumers can
+// drop records which are ingested again, with another ULID, e.g. when a
+// forwarder writes them again after it reconnects.
+//
+// It's best-effort. Records are only remembered once the segment consumed
+// with them is replicated, by this node, and in memory, so duplicates are
+// still stored if they're consumed by another store node, or by another
+// consumer before the original is replicated, or after a restart. And records
+// which are really repeated, a heartbeat, say, are dropped, too, unless they
+// differ, e.g. by -forward.prefix-timestamp.
+type Deduper struct {
+	mtx         sync.Mutex
+	window      time.Duration
+	generations []map[dedupKey]struct{} // current first
+	rotated     time.Time               // when the current generation began
+	dropped     prometheus.Counter
+	now         func() time.Time
+}
+
+// dedupKey is the hash of a record's content.
+type dedupKey [16]byte
+
+// NewDeduper returns a Deduper which remembers records for at least window,
+// and at most a quarter longer. The records dropped are counted by dropped.
+func NewDeduper(window time.Duration, dropped prometheus.Counter) *Deduper {
+	d := &Deduper{
+		window:      window,
+		generations: make([]map[dedupKey]struct{}, dedupGenerations+1),
+		dropped:     dropped,
+		now:         time.Now,
+	}
+	for i := range d.generations {
+		d.generations[i] = map[dedupKey]struct{}{}
+	}
+	d.rotated = d.now()
+	return d
+}
+
+// seen reports whether a record with the key was consumed within the window.
+func (d *Deduper) seen(key dedupKey) bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.rotate()
+	for _, generation := range d.generations {
+		if _, ok := generation[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// add remembers the keys of records which were consumed.
+func (d *Deduper) add(keys map[dedupKey]struct{}) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.rotate()
+	for key := range keys {
+		d.generations[0][key] = struct{}{}
+	}
+}
+
+// rotate starts a new generation for every fraction of the window since the
+// last one, forgetting the oldest. It's called with the mutex held.
+func (d *Deduper) rotate() {
+	span := d.window / dedupGenerations
+	for now := d.now(); now.Sub(d.rotated) >= span; d.rotated = d.rotated.Add(span) {
+		if now.Sub(d.rotated) > 2*d.window {
+			// Everything's expired; don't rotate through it all.
+			for i := range d.generations {
+				d.generations[i] = map[dedupKey]struct{}{}
+			}
+			d.rotated = now
+			return
+		}
+		copy(d.generations[1:], d.generations[:len(d.generations)-1])
+		d.generations[0] = map[dedupKey]struct{}{}
+	}
+}
+
+// dedupBatch is the records of a consumer's batch, by their keys, which the
+// Deduper is told of once the batch is replicated.
+type dedupBatch struct {
+	d    *Deduper
+	h    hash.Hash
+	keys map[dedupKey]struct{}
+}
+
+func newDedupBatch(d *Deduper) *dedupBatch {
+	if d == nil {
+		return nil
+	}
+	return &dedupBatch{d: d, h: fnv.New128a(), keys: map[dedupKey]struct{}{}}
+}
+
+// filter drops the records of the ingest segment which were consumed before,
+// or are already in the batch, and returns the rest, reusing the segment's
+// memory. A nil batch returns the segment as it is.
+func (b *dedupBatch) filter(segment []byte) []byte {
+	if b == nil {
+		return segment
+	}
+	kept := segment[:0]
+	for len(segment) > 0 {
+		var record []byte
+		if i := bytes.IndexByte(segment, '\n'); i >= 0 {
+			record, segment = segment[:i+1], segment[i+1:]
+		} else {
+			record, segment = segment, nil
+		}
+		key := b.key(record)
+		if _, ok := b.keys[key]; ok || b.d.seen(key) {
+			b.d.dropped.Inc()
+			continue
+		}
+		b.keys[key] = struct{}{}
+		kept = append(kept, record...) // never ahead of the record
+	}
+	return kept
+}
+
+// key hashes the content of the record, i.e. everything after its ULID.
+func (b *dedupBatch) key(record []byte) (key dedupKey) {
+	content := record
+	if len(content) >= ulid.EncodedSize {
+		content = content[ulid.EncodedSize:]
+	}
+	b.h.Reset()
+	b.h.Write(content)
+	b.h.Sum(key[:0])
+	return key
+}
+
+// commit tells the Deduper of the batch's records, and starts a new batch.
+func (b *dedupBatch) commit() {
+	if b == nil {
+		return
+	}
+	b.d.add(b.keys)
+	b.reset()
+}
+
+// reset forgets the batch's records, e.g. because it failed.
+func (b *dedupBatch) reset() {
+	if b == nil {
+		return
+	}
+	b.keys = map[dedupKey]struct{}{}
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDeduperWindow(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now = time.Now()
+		d   = NewDeduper(4*time.Minute, prometheus.NewCounter(prometheus.CounterOpts{}))
+		b   = newDedupBatch(d)
+	)
+	d.now = func() time.Time { return now }
+	d.rotated = now
+
+	// Records are remembered from when they're committed, for at least the
+	// window, and forgotten within a quarter of it more.
+	key := b.key([]byte("01BB6RQR190000000000000000 A payload\n"))
+	if want, have := key, b.key([]byte("01BB6RRTB70000000000000000 A payload\n")); want != have {
+		t.Fatalf("records with the same content: keys %x and %x", want, have)
+	}
+	b.keys[key] = struct{}{}
+	if d.seen(key) {
+		t.Fatal("seen before it's committed")
+	}
+	b.commit()
+	t0 := now
+	for _, testcase := range []struct {
+		after time.Duration
+		seen  bool
+	}{
+		{0, true},
+		{3 * time.Minute, true},
+		{4*time.Minute + 59*time.Second, true},
+		{5 * time.Minute, false},
+		{time.Hour, false},
+	} {
+		now = t0.Add(testcase.after)
+		if want, have := testcase.seen, d.seen(key); want != have {
+			t.Errorf("after %s: want seen %v, have %v", testcase.after, want, have)
+		}
+	}
+
+	// Records of failed batches aren't remembered at all.
+	b.keys[key] = struct{}{}
+	b.reset()
+	if d.seen(key) {
+		t.Error("seen after its batch failed")
+	}
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Downloads are user query results as a file to save, rather than to show,
+// with the download parameter. The records are compressed as they're read,
+// so a download is no more buffered than any other query, and the same
+// limits apply.
+const (
+	downloadGzip = "gzip" // the records, gzipped
+	downloadZip  = "zip"  // the records, as results.log, and meta.json
+)
+
+// maxDownloadNameQ is the most of the query kept in a download's filename.
+const maxDownloadNameQ = 64
+
+// parseDownload returns the archive a user query asks for, with the download
+// parameter, or "" if it doesn't.
+func parseDownload(u *url.URL) (string, error) {
+	switch download := u.Query().Get("download"); download {
+	case downloadGzip, downloadZip, "":
+		return download, nil
+	default:
+		return "", errors.Errorf("parsing 'download': %q isn't gzip or zip", download)
+	}
+}
+
+// downloadMeta is meta.json, in zip downloads: the QueryResult, as for JSON
+// statistics queries, with complete stats, as it's written after the records,
+// and why the records are partial, if they are.
+type downloadMeta struct {
+	*QueryResult
+	Partial string `json:"partial,omitempty"`
+}
+
+// encodeDownloadTo writes the records of the QueryResult to the HTTP response
+// writer as an archive, see parseDownload, as plain text, or with asJSON, as
+// newline-delimited JSON. The headers are the same as EncodeTo's, but for the
+// Content-Type and Content-Disposition.
+// It also closes the records ReadCloser.
+func (qr *QueryResult) encodeDownloadTo(w http.ResponseWriter, download string, asJSON bool) {
+	qr.encodeHeaders(w)
+	name, ext := qr.downloadName(), ".log"
+	if asJSON {
+		ext = ".ndjson"
+	}
+	switch download {
+	case downloadGzip:
+		w.Header().Set("Content-Type", "application/gzip")
+		name += ext + ".gz"
+	case downloadZip:
+		w.Header().Set("Content-Type", "application/zip")
+		name += ".zip"
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	if qr.ErrorCount > 0 {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	// Archives are closed even if the records are cut short, so they're
+	// valid, and hold what was read; the partial trailer is set, too.
+	var err error
+	switch download {
+	case downloadGzip:
+		zw := gzip.NewWriter(w)
+		zw.Name = "results" + ext
+		err = writeDownloadRecords(zw, qr.Records, asJSON)
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+	case downloadZip:
+		zw := zip.NewWriter(w)
+		f, cerr := zw.Create("results" + ext)
+		if err = cerr; err == nil {
+			err = writeDownloadRecords(f, qr.Records, asJSON)
+		}
+		if f, cerr = zw.Create("meta.json"); cerr == nil {
+			cerr = qr.writeDownloadMeta(f, err)
+		}
+		if err == nil {
+			err = cerr
+		}
+		if cerr = zw.Close(); err == nil {
+			err = cerr
+		}
+	}
+	qr.Records.Close()
+	qr.encodeTrailers(w, err)
+}
+
+// writeDownloadRecords copies the records to w, as EncodeTo or EncodeJSONTo
+// would.
+func writeDownloadRecords(w io.Writer, records io.Reader, asJSON bool) error {
+	if asJSON {
+		return encodeRecordsJSON(w, records)
+	}
+	buf := make([]byte, 1024*1024)
+	_, err := io.CopyBuffer(w, records, buf)
+	return err
+}
+
+// writeDownloadMeta writes meta.json, once the records are, or failed to be,
+// with err.
+func (qr *QueryResult) writeDownloadMeta(w io.Writer, err error) error {
+	meta := downloadMeta{QueryResult: qr}
+	if qr.Stats != nil {
+		qr.estimate()
+	}
+	if err != nil {
+		meta.Partial = err.Error()
+	}
+	buf, err := json.MarshalIndent(meta, "", "    ")
+	if err != nil {
+		panic(err) // QueryResult always marshals
+	}
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
+
+// downloadName is the filename of a download, without its extension: the
+// time range, in UTC, and as much of the query as is safe to keep, e.g.
+// oklog-20171001T120000Z-20171001T130000Z-request_id_42.
+func (qr *QueryResult) downloadName() string {
+	const layout = "20060102T150405Z"
+	name := fmt.Sprintf("oklog-%s-%s",
+		qr.Params.From.Time.UTC().Format(layout),
+		qr.Params.To.Time.UTC().Format(layout),
+	)
+	if q := sanitizeDownloadName(qr.Params.Q); q != "" {
+		name += "-" + q
+	}
+	return name
+}
+
+// sanitizeDownloadName keeps letters, digits, dots, and dashes of s, and
+// replaces each run of anything else with an underscore, so the name is safe
+// in any filesystem, and in the header, up to maxDownloadNameQ bytes.
+func sanitizeDownloadName(s string) string {
+	var b []byte
+	for i := 0; i < len(s) && len(b) < maxDownloadNameQ; i++ {
+		switch c := s[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-':
+			b = append(b, c)
+		case len(b) > 0 && b[len(b)-1] != '_':
+			b = append(b, '_')
+		}
+	}
+	return strings.Trim(string(b), "_.")
+}
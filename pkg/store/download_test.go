@@ -0,0 +1,206 @@
+package store
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIUserQueryDownload(t *testing.T) {
+	t.Parallel()
+
+	peers := make(staticPeer, 1)
+	a, server := newStreamFixture(t, peers)
+	defer server.Close()
+	defer a.Close()
+	peers[0] = strings.TrimPrefix(server.URL, "http://")
+
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(recordA+recordB)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+	}
+
+	download := func(params string) (*http.Response, []byte) {
+		resp, err := http.Get(fmt.Sprintf(
+			"%s/store%s?from=%s&to=%s&q=%s%s",
+			server.URL,
+			APIPathUserQuery,
+			"01BB6RQR190000000000000000", // A
+			"01BB6RRTB70000000000000000", // B
+			"2017-03-14T1",
+			params,
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		buf, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: HTTP %d: %s", params, resp.StatusCode, buf)
+		}
+		return resp, buf
+	}
+
+	for _, testcase := range []struct {
+		params      string
+		contentType string
+		filename    string
+		results     string
+	}{
+		{
+			params:      "&download=gzip",
+			contentType: "application/gzip",
+			filename:    "oklog-20170314T155940Z-20170314T160015Z-2017-03-14T1.log.gz",
+			results:     recordA + recordB,
+		},
+		{
+			params:      "&download=gzip&format=json",
+			contentType: "application/gzip",
+			filename:    "oklog-20170314T155940Z-20170314T160015Z-2017-03-14T1.ndjson.gz",
+			results: "" +
+				`{"ulid":"01BB6RQR190000000000000000","time":"2017-03-14T15:59:40.585Z","topic":"A","record":"A 2017-03-14T16:59:40.585457189+01:00"}` + "\n" +
+				`{"ulid":"01BB6RRTB70000000000000000","time":"2017-03-14T16:00:15.719Z","topic":"B","record":"B 2017-03-14T17:00:15.719316824+01:00"}` + "\n",
+		},
+		{
+			params:      "&download=zip",
+			contentType: "application/zip",
+			filename:    "oklog-20170314T155940Z-20170314T160015Z-2017-03-14T1.zip",
+			results:     recordA + recordB,
+		},
+		{
+			params:      "&download=zip&limit=1", // paginated, as any query
+			contentType: "application/zip",
+			filename:    "oklog-20170314T155940Z-20170314T160015Z-2017-03-14T1.zip",
+			results:     recordA,
+		},
+	} {
+		resp, buf := download(testcase.params)
+		if want, have := testcase.contentType, resp.Header.Get("Content-Type"); want != have {
+			t.Errorf("%s: Content-Type: want %q, have %q", testcase.params, want, have)
+		}
+		if want, have := fmt.Sprintf("attachment; filename=%q", testcase.filename), resp.Header.Get("Content-Disposition"); want != have {
+			t.Errorf("%s: Content-Disposition: want %q, have %q", testcase.params, want, have)
+		}
+		if have := resp.Trailer.Get(httpHeaderPartial); have != "" {
+			t.Errorf("%s: want no %s trailer, have %q", testcase.params, httpHeaderPartial, have)
+		}
+
+		if testcase.contentType == "application/gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(buf))
+			if err != nil {
+				t.Fatalf("%s: %v", testcase.params, err)
+			}
+			results, err := ioutil.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("%s: %v", testcase.params, err)
+			}
+			if want, have := testcase.results, string(results); want != have {
+				t.Errorf("%s: want %q, have %q", testcase.params, want, have)
+			}
+			continue
+		}
+
+		zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+		if err != nil {
+			t.Fatalf("%s: %v", testcase.params, err)
+		}
+		files := map[string][]byte{}
+		var names []string
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatalf("%s: %s: %v", testcase.params, f.Name, err)
+			}
+			files[f.Name], err = ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatalf("%s: %s: %v", testcase.params, f.Name, err)
+			}
+			names = append(names, f.Name)
+		}
+		if want, have := "results.log meta.json", strings.Join(names, " "); want != have {
+			t.Fatalf("%s: want files %s, have %s", testcase.params, want, have)
+		}
+		if want, have := testcase.results, string(files["results.log"]); want != have {
+			t.Errorf("%s: want %q, have %q", testcase.params, want, have)
+		}
+		var meta struct {
+			Query           map[string]interface{} `json:"query"`
+			NodesQueried    int                    `json:"nodes_queried"`
+			SegmentsQueried int                    `json:"segments_queried"`
+			Continue        string                 `json:"continue"`
+			Stats           *QueryStats            `json:"stats"`
+			Partial         string                 `json:"partial"`
+		}
+		if err := json.Unmarshal(files["meta.json"], &meta); err != nil {
+			t.Fatalf("%s: %v: %s", testcase.params, err, files["meta.json"])
+		}
+		if want, have := "2017-03-14T1", meta.Query["q"]; want != have {
+			t.Errorf("%s: meta q: want %v, have %v", testcase.params, want, have)
+		}
+		if want, have := 1, meta.NodesQueried; want != have {
+			t.Errorf("%s: meta nodes_queried: want %d, have %d", testcase.params, want, have)
+		}
+		if want, have := strings.Contains(testcase.params, "limit"), meta.Continue != ""; want != have {
+			t.Errorf("%s: meta continue: want %v, have %q", testcase.params, want, meta.Continue)
+		}
+		if meta.Stats == nil || meta.Stats.RecordsMatched == 0 {
+			t.Errorf("%s: meta stats: want the stats, have %+v", testcase.params, meta.Stats)
+		}
+		if meta.Partial != "" {
+			t.Errorf("%s: meta partial: want none, have %q", testcase.params, meta.Partial)
+		}
+	}
+}
+
+func TestAPIUserQueryBadDownload(t *testing.T) {
+	t.Parallel()
+
+	a, server := newStreamFixture(t, staticPeer{})
+	defer server.Close()
+	defer a.Close()
+
+	for _, params := range []string{
+		"&download=tar",
+		"&download=gzip&stats",
+		"&download=zip&histogram=1m",
+	} {
+		resp, err := http.Get(fmt.Sprintf("%s/store%s?from=-1h&to=now%s", server.URL, APIPathUserQuery, params))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want, have := http.StatusBadRequest, resp.StatusCode; want != have {
+			t.Errorf("%s: want HTTP %d, have %d", params, want, have)
+		}
+	}
+}
+
+func TestSanitizeDownloadName(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		q    string
+		want string
+	}{
+		{"", ""},
+		{"ERROR", "ERROR"},
+		{"request_id=42", "request_id_42"},
+		{`"/api/v1/login" 500`, "api_v1_login_500"},
+		{"../../etc/passwd", "etc_passwd"},
+		{"ünïcode", "n_code"},
+		{strings.Repeat("a", 100), strings.Repeat("a", maxDownloadNameQ)},
+	} {
+		if want, have := testcase.want, sanitizeDownloadName(testcase.q); want != have {
+			t.Errorf("%q: want %q, have %q", testcase.q, want, have)
+		}
+	}
+}
@@ -0,0 +1,465 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+// Sealed segments may be stored encrypted, with AES-256-GCM. Each segment has
+// its own random data key, which is stored with it, wrapped by a master key;
+// see KeyWrapper. Like compressed segments, encrypted segments are told apart
+// by their contents: they begin with encryptedMagic, which neither records
+// nor zstd do. Segments are compressed before they're encrypted, since
+// ciphertext doesn't compress.
+//
+// An encrypted segment is a header, then its contents, sealed in chunks of
+// the header's chunk size. Each chunk is sealed with its index as its nonce,
+// which is safe, since the data key is never used for another segment, and
+// with the header, and whether it's the last chunk, as additional data. So
+// chunks that are tampered with, reordered, truncated, or appended to fail
+// to open, and the segment is treated as corrupt.
+//
+// Active segments aren't encrypted. They're written a record at a time, and
+// recovered by scanning them after a crash, and they're only around until
+// they're flushed, i.e. for -store.segment-target-age at most. Neither are
+// their sidecars: bloom filters, which only say whether a segment may contain
+// a word, origins, and checksums, which are of the encrypted segment.
+
+const (
+	encryptedMagic   = "\x00OKE"
+	encryptedVersion = 1
+	encryptChunkSize = 64 * 1024
+	dataKeySize      = 32 // AES-256
+)
+
+// KeyWrapper wraps the data keys of encrypted segments with a master key,
+// and unwraps them again, e.g. with MasterKeys, or a key management service.
+// Implementations must be safe for concurrent use.
+type KeyWrapper interface {
+	// WrapKey wraps a data key with the current master key, and returns
+	// that key's ID, to unwrap it with.
+	WrapKey(key []byte) (id string, wrapped []byte, err error)
+
+	// UnwrapKey unwraps a data key wrapped by the master key with the ID.
+	UnwrapKey(id string, wrapped []byte) ([]byte, error)
+}
+
+// MasterKeys is a KeyWrapper of AES-256 master keys, the first of which is
+// primary. Data keys are wrapped with the primary; the others are only used
+// to unwrap the keys of segments sealed before it was. So a master key is
+// rotated by making a new one primary, and retired once no segment is
+// wrapped by it any more, i.e. once retention or compaction has seen to them.
+type MasterKeys struct {
+	mtx  sync.RWMutex
+	keys map[string]cipher.AEAD
+	ids  []string // primary first
+}
+
+// NewMasterKeys returns MasterKeys of the keys, which must be 32 bytes each.
+func NewMasterKeys(keys [][]byte) (*MasterKeys, error) {
+	m := &MasterKeys{}
+	if err := m.Set(keys); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Set replaces the master keys, the first of which is primary. Segments
+// wrapped by keys that are no longer among them can't be read.
+func (m *MasterKeys) Set(keys [][]byte) error {
+	if len(keys) == 0 {
+		return errors.New("no master keys")
+	}
+	var (
+		aeads = map[string]cipher.AEAD{}
+		ids   = make([]string, len(keys))
+	)
+	for i, key := range keys {
+		if len(key) != dataKeySize {
+			return errors.Errorf("master key %d is %d bytes, not %d", i+1, len(key), dataKeySize)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return errors.Wrapf(err, "master key %d", i+1)
+		}
+		ids[i] = masterKeyID(key)
+		aeads[ids[i]] = aead
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.keys, m.ids = aeads, ids
+	return nil
+}
+
+// masterKeyID identifies a master key without giving it away.
+func masterKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// WrapKey implements KeyWrapper.
+func (m *MasterKeys) WrapKey(key []byte) (string, []byte, error) {
+	m.mtx.RLock()
+	id := m.ids[0]
+	aead := m.keys[id]
+	m.mtx.RUnlock()
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, err
+	}
+	return id, aead.Seal(nonce, nonce, key, []byte(id)), nil
+}
+
+// UnwrapKey implements KeyWrapper.
+func (m *MasterKeys) UnwrapKey(id string, wrapped []byte) ([]byte, error) {
+	m.mtx.RLock()
+	aead, ok := m.keys[id]
+	m.mtx.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("no master key %s", id)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errCorruptSegment
+	}
+	key, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return nil, errCorruptSegment
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptionHeader begins an encrypted segment. Its encoding is the magic,
+// the version, then each field, in order: integers big-endian, and the key ID
+// and wrapped key each prefixed by their length, in a byte.
+type encryptionHeader struct {
+	chunkSize   uint32
+	logicalSize uint64 // of the records, uncompressed
+	keyID       string
+	wrappedKey  []byte
+}
+
+func (h encryptionHeader) encode() []byte {
+	buf := make([]byte, 0, len(encryptedMagic)+1+4+8+1+len(h.keyID)+1+len(h.wrappedKey))
+	buf = append(buf, encryptedMagic...)
+	buf = append(buf, encryptedVersion)
+	buf = append(buf, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(buf[len(buf)-4:], h.chunkSize)
+	buf = append(buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(buf[len(buf)-8:], h.logicalSize)
+	buf = append(buf, byte(len(h.keyID)))
+	buf = append(buf, h.keyID...)
+	buf = append(buf, byte(len(h.wrappedKey)))
+	buf = append(buf, h.wrappedKey...)
+	return buf
+}
+
+// readEncryptionHeader reads the header of an encrypted segment from br, and
+// returns it, along with its encoding.
+func readEncryptionHeader(br *bufio.Reader) (h encryptionHeader, raw []byte, err error) {
+	fixed := make([]byte, len(encryptedMagic)+1+4+8)
+	if _, err := io.ReadFull(br, fixed); err != nil {
+		return h, nil, errCorruptSegment
+	}
+	if string(fixed[:len(encryptedMagic)]) != encryptedMagic {
+		return h, nil, errors.New("not an encrypted segment")
+	}
+	if v := fixed[len(encryptedMagic)]; v != encryptedVersion {
+		return h, nil, errors.Errorf("unknown encrypted segment version %d", v)
+	}
+	h.chunkSize = binary.BigEndian.Uint32(fixed[len(encryptedMagic)+1:])
+	h.logicalSize = binary.BigEndian.Uint64(fixed[len(encryptedMagic)+5:])
+	raw = fixed
+	readField := func() ([]byte, error) {
+		n, err := br.ReadByte()
+		if err != nil {
+			return nil, errCorruptSegment
+		}
+		field := make([]byte, n)
+		if _, err := io.ReadFull(br, field); err != nil {
+			return nil, errCorruptSegment
+		}
+		raw = append(append(raw, n), field...)
+		return field, nil
+	}
+	id, err := readField()
+	if err != nil {
+		return h, nil, err
+	}
+	if h.wrappedKey, err = readField(); err != nil {
+		return h, nil, err
+	}
+	if h.chunkSize == 0 {
+		return h, nil, errCorruptSegment
+	}
+	h.keyID = string(id)
+	return h, raw, nil
+}
+
+func isEncrypted(br *bufio.Reader) bool {
+	magic, err := br.Peek(len(encryptedMagic))
+	return err == nil && string(magic) == encryptedMagic
+}
+
+// chunkNonce returns the nonce of the chunk with the index.
+func chunkNonce(aead cipher.AEAD, index uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], index)
+	return nonce
+}
+
+// chunkData returns the additional data of a chunk: the header, and whether
+// it's the last chunk.
+func chunkData(header []byte, last bool) []byte {
+	data := append([]byte{}, header...)
+	if last {
+		return append(data, 1)
+	}
+	return append(data, 0)
+}
+
+// encryptWriter encrypts what's written to it, chunk by chunk, to w. It must
+// be closed, to seal the last chunk, which may be empty.
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	buf    []byte
+	index  uint64
+}
+
+// newEncryptWriter writes the header of a segment of logicalSize bytes of
+// records to w, with a new data key, wrapped by keys, and returns a writer
+// of its contents.
+func newEncryptWriter(w io.Writer, keys KeyWrapper, logicalSize int64) (*encryptWriter, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	id, wrapped, err := keys.WrapKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "wrapping data key")
+	}
+	if len(id) > 255 || len(wrapped) > 255 {
+		return nil, errors.New("wrapped data key is too big")
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := encryptionHeader{
+		chunkSize:   encryptChunkSize,
+		logicalSize: uint64(logicalSize),
+		keyID:       id,
+		wrappedKey:  wrapped,
+	}.encode()
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, 0, encryptChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		// A full chunk is only sealed once there's more to write, since
+		// the last one has to be marked as such.
+		if len(w.buf) == encryptChunkSize {
+			if err := w.seal(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(w.buf[len(w.buf):encryptChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Close seals the last chunk. It doesn't close the underlying writer.
+func (w *encryptWriter) Close() error {
+	return w.seal(true)
+}
+
+func (w *encryptWriter) seal(last bool) error {
+	sealed := w.aead.Seal(w.buf[:0], chunkNonce(w.aead, w.index), w.buf, chunkData(w.header, last))
+	w.index++
+	_, err := w.w.Write(sealed)
+	w.buf = w.buf[:0]
+	return err
+}
+
+// decryptReader reads the contents of an encrypted segment, chunk by chunk.
+// Chunks that fail to open make it call corrupt, and return
+// errCorruptSegment.
+type decryptReader struct {
+	br        *bufio.Reader
+	aead      cipher.AEAD
+	header    []byte
+	chunkSize int
+	buf       []byte // sealed
+	out       []byte // opened, not yet read
+	index     uint64
+	done      bool
+	err       error
+	corrupt   func()
+}
+
+// newDecryptReader reads the header of an encrypted segment from br, and
+// returns a reader of its contents, along with the header.
+func newDecryptReader(br *bufio.Reader, keys KeyWrapper, corrupt func()) (*decryptReader, encryptionHeader, error) {
+	h, raw, err := readEncryptionHeader(br)
+	if err != nil {
+		if err == errCorruptSegment {
+			corrupt()
+		}
+		return nil, h, err
+	}
+	if keys == nil {
+		return nil, h, errors.Errorf("segment is encrypted with master key %s, but there are no master keys", h.keyID)
+	}
+	key, err := keys.UnwrapKey(h.keyID, h.wrappedKey)
+	if err == errCorruptSegment {
+		corrupt()
+	}
+	if err != nil {
+		return nil, h, errors.Wrap(err, "unwrapping data key")
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, h, err
+	}
+	return &decryptReader{
+		br:        br,
+		aead:      aead,
+		header:    raw,
+		chunkSize: int(h.chunkSize),
+		corrupt:   corrupt,
+	}, h, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// next opens the next chunk.
+func (r *decryptReader) next() error {
+	if r.buf == nil {
+		r.buf = make([]byte, r.chunkSize+r.aead.Overhead())
+	}
+	n, err := io.ReadFull(r.br, r.buf)
+	switch {
+	case err == io.EOF:
+		// The last chunk, which would've said so, is missing.
+		r.corrupt()
+		return errCorruptSegment
+	case err == io.ErrUnexpectedEOF:
+		r.done = true
+	case err != nil:
+		return err
+	default:
+		_, err := r.br.Peek(1)
+		r.done = err == io.EOF
+	}
+	out, err := r.aead.Open(r.buf[:0], chunkNonce(r.aead, r.index), r.buf[:n], chunkData(r.header, r.done))
+	if err != nil {
+		r.corrupt()
+		return errCorruptSegment
+	}
+	r.index++
+	r.out = out
+	return nil
+}
+
+// decryptedSize returns the size of the contents of an encrypted segment of
+// diskSize bytes, with the header, given its encoding. Every chunk but the
+// last is full, so it's known without opening them.
+func decryptedSize(h encryptionHeader, headerSize int, overhead int, diskSize int64) int64 {
+	var (
+		body   = diskSize - int64(headerSize)
+		sealed = int64(h.chunkSize) + int64(overhead)
+		chunks = (body + sealed - 1) / sealed
+	)
+	if chunks == 0 {
+		return 0
+	}
+	return body - chunks*int64(overhead)
+}
+
+// encryptedSegmentFile is an encrypted segment file which Reads its contents,
+// as they'd be stored unencrypted, i.e. possibly compressed. Size is theirs,
+// too.
+type encryptedSegmentFile struct {
+	fs.File
+	r    io.Reader
+	size int64
+}
+
+func (f encryptedSegmentFile) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
+
+func (f encryptedSegmentFile) Size() int64 {
+	return f.size
+}
+
+// openDecrypted returns the segment file f, opened at path, for reading as
+// stored, but decrypted, if it's encrypted. Unencrypted files are returned as
+// they are, so they can still seek, if they could. If the segment fails to
+// decrypt, corrupt is called with its path. The file is closed on error.
+func openDecrypted(f fs.File, path string, keys KeyWrapper, corrupt func(path string)) (fs.File, error) {
+	head := make([]byte, len(encryptedMagic))
+	n, _ := io.ReadFull(f, head)
+	r := io.MultiReader(bytes.NewReader(head[:n]), f)
+	if string(head[:n]) != encryptedMagic {
+		if seeker, ok := f.(io.Seeker); ok {
+			if _, err := seeker.Seek(0, io.SeekStart); err == nil {
+				return f, nil
+			}
+		}
+		return segmentFile{File: f, r: r}, nil
+	}
+	dr, h, err := newDecryptReader(bufio.NewReader(r), keys, func() { corrupt(path) })
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "decrypting segment %s", path)
+	}
+	size := decryptedSize(h, len(dr.header), dr.aead.Overhead(), f.Size())
+	return encryptedSegmentFile{File: f, r: dr, size: size}, nil
+}
@@ -0,0 +1,301 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	t.Parallel()
+
+	keys, err := NewMasterKeys([][]byte{bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypt := func(contents []byte) []byte {
+		var buf bytes.Buffer
+		w, err := newEncryptWriter(&buf, keys, int64(len(contents)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(contents); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	decrypt := func(encrypted []byte) ([]byte, int64, bool, error) {
+		var corrupt bool
+		r, h, err := newDecryptReader(bufio.NewReader(bytes.NewReader(encrypted)), keys, func() { corrupt = true })
+		if err != nil {
+			return nil, 0, corrupt, err
+		}
+		size := decryptedSize(h, len(r.header), r.aead.Overhead(), int64(len(encrypted)))
+		contents, err := ioutil.ReadAll(r)
+		return contents, size, corrupt, err
+	}
+
+	// Contents round trip, whether or not they end on a chunk boundary.
+	for _, size := range []int{0, 1, encryptChunkSize - 1, encryptChunkSize, encryptChunkSize + 1, 3*encryptChunkSize + 5} {
+		contents := bytes.Repeat([]byte("x"), size)
+		encrypted := encrypt(contents)
+		if bytes.Contains(encrypted, []byte("xxxx")) {
+			t.Errorf("%d bytes: contents in the clear", size)
+		}
+		decrypted, decryptedSize, _, err := decrypt(encrypted)
+		if err != nil {
+			t.Errorf("%d bytes: %v", size, err)
+			continue
+		}
+		if !bytes.Equal(contents, decrypted) {
+			t.Errorf("%d bytes: decrypted %d bytes, which don't match", size, len(decrypted))
+		}
+		if want, have := int64(size), decryptedSize; want != have {
+			t.Errorf("%d bytes: want size %d, have %d", size, want, have)
+		}
+	}
+
+	// Tampering with them in any way is detected.
+	var (
+		contents  = bytes.Repeat([]byte("x"), 2*encryptChunkSize+100)
+		encrypted = encrypt(contents)
+		header    = len(encrypted) - len(contents) - 3*keys.keys[keys.ids[0]].Overhead()
+		sealed    = encryptChunkSize + keys.keys[keys.ids[0]].Overhead()
+	)
+	for name, tamper := range map[string]func([]byte) []byte{
+		"flipped header":   func(b []byte) []byte { b[len(encryptedMagic)+2] ^= 1; return b },
+		"flipped key":      func(b []byte) []byte { b[header-1] ^= 1; return b },
+		"flipped chunk":    func(b []byte) []byte { b[header+sealed+10] ^= 1; return b },
+		"truncated":        func(b []byte) []byte { return b[:len(b)-10] },
+		"truncated chunks": func(b []byte) []byte { return b[:header+2*sealed] },
+		"appended":         func(b []byte) []byte { return append(b, encrypted[header:header+sealed]...) },
+		"reordered": func(b []byte) []byte {
+			reordered := append([]byte{}, b[:header]...)
+			reordered = append(reordered, b[header+sealed:header+2*sealed]...)
+			reordered = append(reordered, b[header:header+sealed]...)
+			return append(reordered, b[header+2*sealed:]...)
+		},
+	} {
+		_, _, corrupt, err := decrypt(tamper(append([]byte{}, encrypted...)))
+		if err == nil {
+			t.Errorf("%s: want error, have none", name)
+			continue
+		}
+		if !corrupt {
+			t.Errorf("%s: %v, but not reported corrupt", name, err)
+		}
+	}
+}
+
+func TestEncryptedSegments(t *testing.T) {
+	t.Parallel()
+
+	for _, compress := range []bool{false, true} {
+		compress := compress
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				oldKey  = bytes.Repeat([]byte{1}, 32)
+				newKey  = bytes.Repeat([]byte{2}, 32)
+				filesys = fs.NewVirtualFilesystem()
+				t0      = time.Now().Add(-time.Hour)
+				records []string
+			)
+			keys, err := NewMasterKeys([][]byte{oldKey})
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeSegment := func(filelog Log, i int) {
+				id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Second)), nil)
+				record := fmt.Sprintf("%s segment %d %s\n", id, i, strings.Repeat("x", 100))
+				records = append(records, record)
+				segment, err := filelog.Create()
+				if err != nil {
+					t.Fatal(err)
+				}
+				segment.SetCompacted() // so it's compressed, if the log compresses them
+				if _, err := segment.Write([]byte(record)); err != nil {
+					t.Fatal(err)
+				}
+				if err := segment.Close(id, id); err != nil {
+					t.Fatal(err)
+				}
+			}
+			query := func(filelog Log) (string, error) {
+				result, err := filelog.Query(context.Background(), QueryParams{
+					From: ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(t0), nil)},
+					To:   ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(time.Now()), nil)},
+				}, false)
+				if err != nil {
+					return "", err
+				}
+				defer result.Records.Close()
+				b, err := ioutil.ReadAll(result.Records)
+				return string(b), err
+			}
+
+			// A plaintext segment, written before encryption was enabled.
+			filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{Compress: compress})
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeSegment(filelog, 0)
+			filelog.Close()
+
+			// Then encrypted ones, including one recovered after a crash.
+			filelog, err = NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{
+				Compress: compress,
+				Keys:     keys,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeSegment(filelog, 1)
+			id := ulid.MustNew(ulid.Timestamp(t0.Add(2*time.Second)), nil)
+			records = append(records, fmt.Sprintf("%s segment 2 recovered\n", id))
+			if f, err := filesys.Create(filepath.Join("/", "recovered"+extActive)); err != nil {
+				t.Fatal(err)
+			} else {
+				fmt.Fprint(f, records[2])
+				f.Close()
+			}
+			filelog.Close()
+			events := &eventRecorder{}
+			if filelog, err = NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{
+				Compress: compress,
+				Keys:     keys,
+				Reporter: events,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			// The master key is rotated, and another segment written.
+			if err := keys.Set([][]byte{newKey, oldKey}); err != nil {
+				t.Fatal(err)
+			}
+			writeSegment(filelog, 3)
+			defer filelog.Close()
+
+			var plaintext, encrypted int
+			filesys.Walk("/", func(path string, info os.FileInfo, err error) error {
+				if filepath.Ext(path) != extFlushed {
+					return nil
+				}
+				f, err := filesys.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				contents, err := ioutil.ReadAll(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if isEncrypted(bufio.NewReader(bytes.NewReader(contents))) {
+					encrypted++
+				} else {
+					plaintext++
+				}
+				if strings.Contains(string(contents), "segment") && isEncrypted(bufio.NewReader(bytes.NewReader(contents))) {
+					t.Errorf("%s: records in the clear", path)
+				}
+				return nil
+			})
+			if want, have := [2]int{1, 3}, [2]int{plaintext, encrypted}; want != have {
+				t.Errorf("want plaintext, encrypted segments %v, have %v", want, have)
+			}
+
+			// Queries read them all, with either key.
+			have, err := query(filelog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.Join(records, ""); want != have {
+				t.Fatalf("want %q, have %q", want, have)
+			}
+
+			// Segments are exported decrypted, as they'd be stored otherwise.
+			sealed, err := filelog.Sealed(ulid.ULID{}, ulid.MustNew(ulid.MaxTime(), nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, segment := range sealed {
+				f, err := filelog.OpenSealed(segment.Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				contents, err := ioutil.ReadAll(f)
+				f.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if isEncrypted(bufio.NewReader(bytes.NewReader(contents))) {
+					t.Errorf("%s: exported encrypted", segment.Name)
+				}
+				if want, have := int64(len(contents)), f.Size(); want != have {
+					t.Errorf("%s: read %d bytes, but Size is %d", segment.Name, want, have)
+				}
+				if want, have := int64(len(contents)), segment.Size; want != have {
+					t.Errorf("%s: read %d bytes, but listed as %d", segment.Name, want, have)
+				}
+			}
+
+			// Without the old key, its segments can't be read, so queries go
+			// on without them, but they aren't corrupt, either.
+			if err := keys.Set([][]byte{newKey}); err != nil {
+				t.Fatal(err)
+			}
+			if have, err = query(filelog); err != nil {
+				t.Fatal(err)
+			}
+			if want := records[0] + records[3]; want != have {
+				t.Errorf("without the old key: want %q, have %q", want, have)
+			}
+			var failed int
+			for _, e := range events.events {
+				if e.Op == "queryMatchingSegments" && e.Error != nil {
+					failed++
+				}
+			}
+			if want, have := 2, failed; want != have {
+				t.Errorf("without the old key: want %d segments failed, have %d", want, have)
+			}
+			if filesys.Exists(filepath.Join("/", corruptDir)) {
+				t.Errorf("without the old key: segments were quarantined")
+			}
+		})
+	}
+}
+
+func TestNewMasterKeys(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		keys [][]byte
+		ok   bool
+	}{
+		{nil, false},
+		{[][]byte{make([]byte, 16)}, false},
+		{[][]byte{make([]byte, 32)}, true},
+		{[][]byte{make([]byte, 32), make([]byte, 33)}, false},
+	} {
+		_, err := NewMasterKeys(testcase.keys)
+		if want, have := testcase.ok, err == nil; want != have {
+			t.Errorf("%d keys: want ok %v, have %v (%v)", len(testcase.keys), want, have, err)
+		}
+	}
+}
@@ -13,6 +13,7 @@ type Event struct {
 	Error   error
 	Warning error
 	Msg     string
+	Alert   string // if set, the type of operator alert it raises; see package alert
 }
 
 // EventReporter can receive (and, presumably, do something with) Events.
@@ -21,8 +22,9 @@ type EventReporter interface {
 }
 
 // LogReporter is a default implementation of EventReporter that logs events to
-// the wrapped logger. By default, events are logged at Warning level; if Err is
-// non-nil, events are logged at Error level.
+// the wrapped logger. By default, events are logged at Info level, or Debug
+// level, if Debug is set; if Warning is non-nil, they're logged at Warn level,
+// and if Error is non-nil, at Error level.
 type LogReporter struct{ log.Logger }
 
 // ReportEvent implements EventReporter.
@@ -53,3 +55,11 @@ func (r LogReporter) ReportEvent(e Event) {
 	}
 	levelFunc(r.Logger).Log(keyvals...)
 }
+
+// nopIfNil returns the reporter, or if it's nil, one that discards events.
+func nopIfNil(reporter EventReporter) EventReporter {
+	if reporter == nil {
+		return LogReporter{log.NewNopLogger()}
+	}
+	return reporter
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+func TestLogReporter(t *testing.T) {
+	t.Parallel()
+
+	var events []string
+	r := LogReporter{log.LoggerFunc(func(keyvals ...interface{}) error {
+		events = append(events, fmt.Sprint(keyvals...))
+		return nil
+	})}
+	r.ReportEvent(Event{Debug: true, Op: "a"})
+	r.ReportEvent(Event{Op: "b", Msg: "done"})
+	r.ReportEvent(Event{Op: "c", File: "f", Warning: errors.New("uh oh")})
+	r.ReportEvent(Event{Error: errors.New("oh no")})
+	want := []string{
+		fmt.Sprint(level.Key(), level.DebugValue(), "op", "a"),
+		fmt.Sprint(level.Key(), level.InfoValue(), "op", "b", "msg", "done"),
+		fmt.Sprint(level.Key(), level.WarnValue(), "op", "c", "file", "f", "warning", "uh oh"),
+		fmt.Sprint(level.Key(), level.ErrorValue(), "op", "undefined", "error", "oh no"),
+	}
+	if have := events; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
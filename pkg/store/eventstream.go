@@ -0,0 +1,127 @@
+package store
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/stream"
+)
+
+// User streams are served as Server-Sent Events, for browsers, if they're
+// asked for. Each record is an event, with its ULID as the event ID, so that
+// EventSource reconnects with the last one it got as Last-Event-ID, which
+// resumes the stream after it, like since does.
+
+const (
+	eventStreamType   = "text/event-stream"
+	headerLastEventID = "Last-Event-ID"
+	eventPeerError    = "peer-error" // not "error", which EventSource fires itself
+)
+
+// acceptsEventStream returns true if an Accept header asks for Server-Sent
+// Events, as EventSource's does.
+func acceptsEventStream(header string) bool {
+	for _, token := range strings.Split(header, ",") {
+		if mediaType, _, err := mime.ParseMediaType(token); err == nil && mediaType == eventStreamType {
+			return true
+		}
+	}
+	return false
+}
+
+// resumeFromLastEventID resumes the stream after the Last-Event-ID of r, if it
+// has one, which overrides since: EventSource reconnects to the URL it was
+// given, since and all, but with the ID of the last event it got.
+func resumeFromLastEventID(r *http.Request, usp *userStreamParams) error {
+	s := r.Header.Get(headerLastEventID)
+	if s == "" {
+		return nil
+	}
+	id, err := ulid.Parse(s)
+	if err != nil {
+		return errors.Wrap(err, "parsing "+headerLastEventID)
+	}
+	usp.since, usp.resume = id, true
+	return nil
+}
+
+// writeEvents writes each record to w as a Server-Sent Event, with its ULID as
+// the event's ID, and the rest of it as the event's data, until the records
+// chan is closed, or a write fails, e.g. as the client went away. Then it
+// cancels the stream, and drains the records. If no event has been written in
+// the past heartbeat interval, a comment is written instead. Peer errors are
+// peer-error events. Carriage returns, which would end a data line, break the
+// data into lines instead, so EventSource delivers them as newlines. It
+// returns the number of records written, and their bytes, as writeStream
+// counts them.
+func writeEvents(w io.Writer, flusher http.Flusher, records <-chan []byte, errs <-chan stream.PeerError, heartbeat time.Duration, cancel func()) (n, size int64) {
+	defer func() {
+		cancel()
+		for range records {
+		}
+	}()
+	flusher.Flush() // send headers straight away, so the client knows we're here
+	tk := time.NewTicker(heartbeat)
+	defer tk.Stop()
+	var (
+		buf    bytes.Buffer
+		active bool
+	)
+	for {
+		buf.Reset()
+		select {
+		case record, ok := <-records:
+			if !ok {
+				return n, size
+			}
+			record = bytes.TrimSuffix(record, []byte{'\n'})
+			if bytes.HasPrefix(record, []byte("#")) {
+				// e.g. of records dropped; see limitStream
+				buf.WriteString(":" + string(record[1:]) + "\n\n")
+				break
+			}
+			if len(record) <= ulid.EncodedSize {
+				continue // not a record
+			}
+			buf.WriteString("id: ")
+			buf.Write(record[:ulid.EncodedSize])
+			buf.WriteByte('\n')
+			writeEventData(&buf, record[ulid.EncodedSize+1:])
+			n, size = n+1, size+int64(len(record)+1)
+			active = true
+
+		case e := <-errs:
+			buf.WriteString("event: " + eventPeerError + "\n")
+			writeEventData(&buf, []byte(e.Time.UTC().Format(time.RFC3339)+" "+e.Error()))
+			active = true
+
+		case <-tk.C:
+			if active {
+				active = false
+				continue
+			}
+			buf.WriteString(":\n\n") // heartbeat
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return n, size
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEventData writes data as the data lines of an event, and ends it.
+func writeEventData(buf *bytes.Buffer, data []byte) {
+	for _, line := range bytes.Split(data, []byte{'\r'}) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+}
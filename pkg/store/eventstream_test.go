@@ -0,0 +1,255 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/stream"
+)
+
+func TestAcceptsEventStream(t *testing.T) {
+	t.Parallel()
+
+	for header, want := range map[string]bool{
+		"text/event-stream":                  true,
+		"text/html, text/event-stream;q=0.9": true,
+		"TEXT/EVENT-STREAM":                  true,
+		"":                                   false,
+		"*/*":                                false,
+		"text/plain":                         false,
+	} {
+		if have := acceptsEventStream(header); want != have {
+			t.Errorf("%q: want %v, have %v", header, want, have)
+		}
+	}
+}
+
+func TestWriteEvents(t *testing.T) {
+	t.Parallel()
+
+	var (
+		w       = httptest.NewRecorder()
+		records = make(chan []byte)
+		errs    = make(chan stream.PeerError)
+		done    = make(chan struct{})
+		a       = strings.TrimSpace(recordA)
+		b       = strings.TrimSpace(recordB)
+	)
+	go func() {
+		writeEvents(w, w, records, errs, time.Hour, func() {})
+		close(done)
+	}()
+
+	records <- []byte(a)
+	errs <- stream.PeerError{
+		Addr: "1.2.3.4:7650",
+		Err:  errors.New("connection refused"),
+		Time: time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	records <- []byte(b + "\rcarried")
+	close(records)
+	<-done
+
+	want := "" +
+		"id: " + a[:ulid.EncodedSize] + "\ndata: " + a[ulid.EncodedSize+1:] + "\n\n" +
+		"event: peer-error\ndata: 2017-01-02T03:04:05Z 1.2.3.4:7650: connection refused\n\n" +
+		"id: " + b[:ulid.EncodedSize] + "\ndata: " + b[ulid.EncodedSize+1:] + "\ndata: carried\n\n"
+	if have := w.Body.String(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestWriteEventsHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	var (
+		w       = httptest.NewRecorder()
+		records = make(chan []byte)
+		done    = make(chan struct{})
+	)
+	go func() {
+		writeEvents(w, w, records, nil, 5*time.Millisecond, func() {})
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond) // plenty of heartbeats
+	close(records)
+	<-done
+
+	if body := w.Body.String(); body == "" || strings.Trim(body, ":\n") != "" {
+		t.Errorf("want only comments, have %q", body)
+	}
+}
+
+func TestWriteEventsClientGone(t *testing.T) {
+	t.Parallel()
+
+	var (
+		records  = make(chan []byte)
+		canceled = make(chan struct{})
+		done     = make(chan struct{})
+	)
+	go func() {
+		writeEvents(failingWriter{}, httptest.NewRecorder(), records, nil, time.Hour, func() { close(canceled) })
+		close(done)
+	}()
+
+	// The first write fails, which cancels the stream; records still on
+	// their way are drained, until the stream closes them.
+	records <- []byte(strings.TrimSpace(recordA))
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the stream to be canceled")
+	}
+	records <- []byte(strings.TrimSpace(recordB))
+	close(records)
+	<-done
+}
+
+func TestAPIUserStreamEvents(t *testing.T) {
+	t.Parallel()
+
+	// Recent records, so they're within the replay overlap.
+	var records []string
+	for i, t0 := 0, time.Now().Add(-time.Second); i < 6; i++ {
+		id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Millisecond)), nil)
+		records = append(records, fmt.Sprintf("%s R%d\n", id, i))
+	}
+
+	// Two store nodes holding replicas of the same data.
+	var backends []*API
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		backends = append(backends, a)
+		addrs = append(addrs, strings.TrimPrefix(server.URL, "http://"))
+	}
+	replicate := func(records ...string) {
+		for _, a := range backends {
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(strings.Join(records, ""))))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+			}
+		}
+	}
+	front, server := newStreamFixture(t, staticPeer(addrs))
+	defer server.Close()
+	defer front.Close()
+
+	// The URL resumes after R0, as the page that opened the EventSource
+	// asked; it's the same on every reconnect.
+	url := server.URL + "/store" + APIPathUserStream + "?window=100ms&since=" + records[0][:ulid.EncodedSize]
+
+	// attach like EventSource, with the last event ID, if there is one, read
+	// n events, and verify that nothing else arrives before detaching.
+	attach := func(lastEventID string, n int, during func()) []string {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Accept", "text/event-stream")
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if want, have := "text/event-stream", resp.Header.Get("Content-Type"); want != have {
+			t.Fatalf("Content-Type: want %q, have %q", want, have)
+		}
+
+		events := make(chan string)
+		go func() {
+			defer close(events)
+			var id, data string
+			s := bufio.NewScanner(resp.Body)
+			for s.Scan() {
+				switch line := s.Text(); {
+				case line == "":
+					if id != "" { // comments, i.e. heartbeats, aren't events
+						events <- id + " " + data + "\n"
+					}
+					id, data = "", ""
+				case strings.HasPrefix(line, ":"):
+				case strings.HasPrefix(line, "id: "):
+					id = strings.TrimPrefix(line, "id: ")
+				case strings.HasPrefix(line, "data: "):
+					data = strings.TrimPrefix(line, "data: ")
+				}
+			}
+		}()
+		for _, a := range backends {
+			waitForStreamQueries(t, a, 1)
+		}
+		during()
+
+		var have []string
+		timeout := time.After(time.Second)
+		for len(have) < n {
+			select {
+			case event := <-events:
+				have = append(have, event)
+			case <-timeout:
+				t.Fatalf("timeout waiting for events; have %q", have)
+			}
+		}
+		select {
+		case event := <-events:
+			t.Errorf("unexpected event %q", event)
+		case <-time.After(300 * time.Millisecond):
+		}
+		return have
+	}
+
+	// The first connection gets the records after R0 from the replay, and
+	// R3 live. Then it drops.
+	replicate(records[:3]...)
+	have := attach("", 3, func() { replicate(records[3]) })
+	if want, have := records[1]+records[2]+records[3], strings.Join(have, ""); want != have {
+		t.Fatalf("first connection: want %q, have %q", want, have)
+	}
+
+	// R4 is written while it's down. The reconnect's Last-Event-ID, R3,
+	// overrides since, so it gets R4 from the replay, and R5 live, without
+	// gaps, or R1 to R3 again.
+	replicate(records[4])
+	last := have[len(have)-1][:ulid.EncodedSize]
+	have = attach(last, 2, func() { replicate(records[5]) })
+	if want, have := records[4]+records[5], strings.Join(have, ""); want != have {
+		t.Errorf("reconnect: want %q, have %q", want, have)
+	}
+}
+
+func TestAPIUserStreamBadLastEventID(t *testing.T) {
+	t.Parallel()
+
+	a, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer a.Close()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", APIPathUserStream, nil)
+	r.Header.Set("Accept", "text/event-stream")
+	r.Header.Set("Last-Event-ID", "nope")
+	a.ServeHTTP(w, r)
+	if want, have := http.StatusBadRequest, w.Code; want != have {
+		t.Errorf("want HTTP %d, have %d", want, have)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("client went away") }
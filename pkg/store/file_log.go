@@ -2,21 +2,30 @@ package store
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/go-kit/kit/log"
 	"github.com/oklog/ulid"
 	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/oklog/oklog/pkg/alert"
 	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/ulidutil"
 )
 
 const (
@@ -25,6 +34,10 @@ const (
 	extReading = ".reading" // compacting or trashing
 	extTrashed = ".trashed"
 
+	// extTrimming is the extension of an active segment, while it's being
+	// trimmed of the torn record a crash left at its end.
+	extTrimming = ".trimming"
+
 	ulidTimeSize = 10 // bytes
 
 	lockFile = "LOCK"
@@ -40,17 +53,68 @@ var (
 type fileLog struct {
 	root              string
 	filesys           fs.Filesystem
-	releaser          fs.Releaser // for the LOCK
+	queryFilesys      fs.Filesystem // foreground, see fs.Foreground
+	releaser          fs.Releaser   // for the LOCK
+	cache             *QueryCache
+	cold              *ColdTier // nil if there's no cold tier
 	segmentTargetSize int64
 	segmentBufferSize int64
+	queryConcurrency  int
+	compress          bool
+	keys              KeyWrapper         // nil if segments aren't encrypted
+	corruptSegments   prometheus.Counter // nil if segments aren't counted
 	reporter          EventReporter
+	index             *segmentIndex
+
+	// units is held by queries as they choose the segments they read, and
+	// by segments being published, so queries never read a segment along
+	// with sidecars that aren't its own; see segmentUnit.
+	units sync.RWMutex
+}
+
+// FileLogConfig configures NewFileLog. It may be left zero.
+type FileLogConfig struct {
+	// QueryConcurrency is how many segments queries read and filter at
+	// once; if it's not positive, GOMAXPROCS.
+	QueryConcurrency int
+
+	// Compress compresses segments, with zstd, as they're written by
+	// compaction. Segments are flushed uncompressed, either way.
+	Compress bool
+
+	// Keys, if non-nil, encrypt segments as they're flushed, with data keys
+	// it wraps, and decrypt encrypted segments as they're read; see
+	// KeyWrapper.
+	Keys KeyWrapper
+
+	// Cache, if non-nil, caches the results of queries of sealed ranges.
+	Cache *QueryCache
+
+	// Cold, if non-nil, is read by queries, too, for the segments moved to
+	// it.
+	Cold *ColdTier
+
+	// ForceRecovery starts the log even if some of the segments left by a
+	// crash are ambiguous, leaving them as they are; see RecoveryError.
+	ForceRecovery bool
+
+	// CorruptSegments, if non-nil, counts the segments moved to the corrupt
+	// directory, having failed checksum verification.
+	CorruptSegments prometheus.Counter
+
+	// Reporter, if non-nil, is reported the log's events.
+	Reporter EventReporter
 }
 
-// NewFileLog returns a Log backed by the filesystem at path root.
+// NewFileLog returns a Log backed by the filesystem at path root, per the
+// config. Segments left by a crash are recovered first. Segments which fail
+// checksum verification are moved to a corrupt directory beneath root.
 // Note that we don't own segment files! They may disappear.
-func NewFileLog(filesys fs.Filesystem, root string, segmentTargetSize, segmentBufferSize int64, reporter EventReporter) (Log, error) {
-	if reporter == nil {
-		reporter = LogReporter{log.NewNopLogger()}
+func NewFileLog(filesys fs.Filesystem, root string, segmentTargetSize, segmentBufferSize int64, cfg FileLogConfig) (Log, error) {
+	reporter := nopIfNil(cfg.Reporter)
+	queryConcurrency := cfg.QueryConcurrency
+	if queryConcurrency <= 0 {
+		queryConcurrency = runtime.GOMAXPROCS(0)
 	}
 	if err := filesys.MkdirAll(root); err != nil {
 		return nil, errors.Wrapf(err, "creating path %s", root)
@@ -65,16 +129,30 @@ func NewFileLog(filesys fs.Filesystem, root string, segmentTargetSize, segmentBu
 		// So this is like Prometheus "crash recovery" mode.
 		// But we don't have anything special we need to do.
 	}
-	if err := recoverSegments(filesys, root); err != nil {
+	if err := recoverSegments(filesys, root, cfg.Keys, cfg.ForceRecovery, reporter); err != nil {
 		return nil, errors.Wrap(err, "during recovery")
 	}
+	index := newSegmentIndex()
+	index.rebuild(filesys, root, reporter)
+	index.changed = cfg.Cache.invalidate
+	if cfg.Cold != nil {
+		cfg.Cold.changed = cfg.Cache.invalidate
+	}
 	return &fileLog{
 		root:              root,
 		filesys:           filesys,
+		queryFilesys:      fs.Foreground(filesys),
 		releaser:          r,
+		cache:             cfg.Cache,
+		cold:              cfg.Cold,
 		segmentTargetSize: segmentTargetSize,
 		segmentBufferSize: segmentBufferSize,
+		queryConcurrency:  queryConcurrency,
+		compress:          cfg.Compress,
+		keys:              cfg.Keys,
+		corruptSegments:   cfg.CorruptSegments,
 		reporter:          reporter,
+		index:             index,
 	}, nil
 }
 
@@ -84,17 +162,131 @@ func (fl *fileLog) Create() (WriteSegment, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &fileWriteSegment{fl.filesys, f}, nil
+	filter := newBloomFilter(fl.segmentTargetSize)
+	return &fileWriteSegment{fl.filesys, f, fl.index, filter, newGramWriter(filter), &blockChecksum{}, fl.compress, false, fl.keys, nil, &fl.units, false}, nil
 }
 
-func (fl *fileLog) Query(qp QueryParams, statsOnly bool) (QueryResult, error) {
+func (fl *fileLog) Query(ctx context.Context, qp QueryParams, statsOnly bool) (QueryResult, error) {
+	// A continuation token of the last record alone means we can skip
+	// everything up to the last record of the previous page. Backward,
+	// that's everything after it. With the positions of segments, each is
+	// read on from its own; see segmentBounds.
+	cont, paged, err := qp.continuation()
+	if err != nil {
+		return QueryResult{}, err
+	}
+	var (
+		after      = cont.last
+		perSegment = cont.nodes != nil
+		from, to   = qp.From.ULID, qp.To.ULID
+	)
+	if paged && !perSegment && !qp.Backward && after.Time() > from.Time() {
+		from.SetTime(after.Time())
+	}
+	if paged && !perSegment && qp.Backward && after.Time() < to.Time() {
+		to.SetTime(after.Time())
+	}
+
+	// Results of sealed ranges may be cached, if they're read in full.
+	var (
+		begin = time.Now()
+		fill  *cacheFill
+	)
+	if newest, ok := fl.index.newest(); fl.cache != nil && !statsOnly && ok && qp.To.ULID.Time() < newest.Time() {
+		var (
+			result QueryResult
+			hit    bool
+		)
+		if result, fill, hit = fl.cache.lookup(qp, begin); hit {
+			return result, nil
+		}
+	}
+
 	var (
-		begin    = time.Now()
-		segments = fl.queryMatchingSegments(qp.From.ULID, qp.To.ULID)
-		pass     = recordFilterBoundedPlain(qp.From.ULID, qp.To.ULID, []byte(qp.Q))
+		stats    = &QueryStats{}
+		segments = fl.queryMatchingSegments(from, to, queryLiteral(qp.Q, qp.Regex), qp.labelMatchers(), qp.Segments, stats)
+		pass     = recordFilterBoundedPlain(from, to, []byte(qp.Q))
+		re       *regexp.Regexp
 	)
+	segments = fl.withColdSegments(ctx, segments, from, to, qp.labelMatchers(), qp.Segments, stats)
+	stats.PlanDuration = time.Since(begin)
 	if qp.Regex {
-		pass = recordFilterBoundedRegex(qp.From.ULID, qp.To.ULID, regexp.MustCompile(qp.Q))
+		// Segments are filtered concurrently, sharing the one Regexp,
+		// which is safe for concurrent use.
+		re = regexp.MustCompile(qp.Q)
+		pass = recordFilterBoundedRegex(from, to, re)
+	}
+	if qp.Topic != "" {
+		pass = recordFilterTopic([]byte(qp.Topic), pass)
+	}
+	if qp.Sample > 0 {
+		pass = recordFilterSample(qp.Sample, pass)
+	}
+	switch {
+	case !paged || perSegment:
+	case qp.Backward:
+		pass = recordFilterBefore(after, pass)
+	default:
+		pass = recordFilterAfter(after, pass)
+	}
+
+	// Paged queries report where they read their segments from, so the
+	// next page can read on from there, and segments read past every one
+	// of their records aren't read again.
+	var bounds []segmentPosition
+	if perSegment {
+		bounds = segmentBounds(cont, qp.node, fl.presentSegments(from, to), segments, qp.Backward)
+		unread := segments[:0]
+		for i, b := range bounds {
+			if b.readPast(qp.Backward) {
+				segments[i].file.Close()
+				continue
+			}
+			segments[i].bound = b.read
+			unread = append(unread, segments[i])
+		}
+		segments = unread
+	} else if qp.Limit > 0 {
+		bounds = segmentBounds(continuation{}, qp.node, nil, segments, qp.Backward)
+	}
+	continueFrom := func(last ulid.ULID) string {
+		if bounds == nil {
+			return encodeContinue(last)
+		}
+		return continuation{last: last, nodes: map[string][]segmentPosition{
+			qp.node: advance(bounds, last, qp.Backward),
+		}}.encode()
+	}
+
+	// Queries of too many segments read only the first of them, in order,
+	// and return their records up to the first segment they didn't read,
+	// truncated, to be continued from there.
+	var truncated, truncatedToken string
+	if qp.maxSegments > 0 && len(segments) > qp.maxSegments {
+		var bound ulid.ULID
+		segments, bound = limitSegments(segments, qp.maxSegments, qp.Backward)
+		if qp.Backward {
+			pass = recordFilterAfter(bound, pass)
+		} else {
+			pass = recordFilterBefore(bound, pass)
+		}
+		truncated, truncatedToken = truncatedSegments, continueFrom(adjacentULID(bound, !qp.Backward))
+	}
+
+	// Cold segments make for slower queries, so they're counted, for the
+	// response to say so.
+	var cold int
+	for _, s := range segments {
+		if filepath.Ext(s.path) == extCold {
+			cold++
+		}
+	}
+
+	// Annotated records are of the segment they're read from.
+	if qp.Annotate {
+		for i := range segments {
+			segments[i].origin = originToken(qp.node, basename(segments[i].path))
+		}
 	}
 
 	// Time range should be inclusive, so we need a max value here.
@@ -102,16 +294,50 @@ func (fl *fileLog) Query(qp QueryParams, statsOnly bool) (QueryResult, error) {
 		panic(err)
 	}
 
-	// Build the lazy reader.
-	rc, sz, err := newQueryReadCloser(fl.filesys, segments, pass, fl.segmentBufferSize, fl.reporter)
+	// Build the lazy reader. Its stats are done when it's done.
+	var (
+		readBegin = time.Now()
+		counters  = &queryCounters{}
+	)
+	rc, sz, err := newQueryReadCloser(ctx, fl.queryFilesys, segments, pass, qp.order(), fl.segmentBufferSize, fl.queryConcurrency, counters, fl.reporter)
 	if err != nil {
+		fl.cache.end(fill, nil, nil)
 		return QueryResult{}, errors.Wrap(err, "constructing the lazy reader")
 	}
+	rc = newFinishReadCloser(rc, func() {
+		counters.copyTo(stats)
+		stats.ReadDuration = time.Since(readBegin)
+	})
+	if qp.Extract && re != nil {
+		rc = newExtractReadCloser(rc, re)
+	}
 	if statsOnly {
+		rc.Close() // don't leave segment readers hanging
 		rc = ioutil.NopCloser(bytes.NewReader(nil))
 	}
 
-	return QueryResult{
+	// A limited query reads its page into memory, because we need to know
+	// whether there are more records before the response is written.
+	var token string
+	if qp.Limit > 0 && !statsOnly {
+		var page []byte
+		page, token, err = paginate(rc, qp.Limit, nil, qp.order(), continueFrom)
+		rc.Close()
+		if err != nil {
+			fl.cache.end(fill, nil, nil)
+			return QueryResult{}, errors.Wrap(err, "reading the page")
+		}
+		rc = ioutil.NopCloser(bytes.NewReader(page))
+	}
+	switch {
+	case truncated == "":
+	case token != "":
+		truncated = "" // the page is full before the segments left out
+	default:
+		token = truncatedToken
+	}
+
+	result := QueryResult{
 		Params: qp,
 
 		NodesQueried:    1,
@@ -119,96 +345,53 @@ func (fl *fileLog) Query(qp QueryParams, statsOnly bool) (QueryResult, error) {
 		MaxDataSetSize:  sz,
 		ErrorCount:      0,
 		Duration:        time.Since(begin).String(),
+		Continue:        token,
+		Truncated:       truncated,
+		ColdSegments:    cold,
+		Stats:           stats,
 
 		Records: rc,
-	}, nil
-}
-
-func (fl *fileLog) Overlapping() ([]ReadSegment, error) {
-	// We make a simple n-squared algorithm for now.
-	// First, collect all flushed segments.
-	segments := map[string][]string{}
-	fl.filesys.Walk(fl.root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil // descend
-		}
-		if filepath.Ext(path) != extFlushed {
-			return nil // skip
-		}
-		if _, _, err := parseFilename(path); err != nil {
-			fl.reporter.ReportEvent(Event{
-				Op: "Overlapping", File: path, Warning: err,
-				Msg: fmt.Sprintf("will remove apparently-bad data file of size %d", info.Size()),
-			})
-			// TODO(pb): re-parse and recover this file, async
-			if err := fl.filesys.Remove(path); err != nil {
-				fl.reporter.ReportEvent(Event{
-					Op: "Overlapping", File: path, Warning: err,
-					Msg: "tried to remove apparently-bad data file, which failed",
-				})
-			}
-			return nil // weird; ignore
-		}
-		segments[path] = nil
-		return nil
-	})
-
-	// Then, for each segment, compare against all other segments.
-	// Record all segments which overlap.
-	for path := range segments {
-		a, b, err := parseFilename(path) // TODO(pb): maybe eliminate double work
-		if err != nil {
-			panic(fmt.Errorf("failed to parse a filename that must have successfully parsed previously: %v", err))
-		}
-		for compare := range segments {
-			if path == compare {
-				continue // we will overlap with ourselves, natch
-			}
-			c, d, err := parseFilename(compare)
-			if err != nil {
-				panic(fmt.Errorf("failed to parse a filename that must have successfully parsed previously: %v", err))
-			}
-			if overlap(a, b, c, d) {
-				segments[path] = append(segments[path], compare)
-			}
-		}
 	}
-
-	// Next, figure out which segment has the most overlap.
-	// It and all of its overlapping friends become our candidates.
-	var candidates []string
-	for path, overlaps := range segments {
-		if len(overlaps)+1 > len(candidates) {
-			candidates = append(overlaps, path)
-		}
+	if bounds != nil {
+		result.scanned = continuation{nodes: map[string][]segmentPosition{qp.node: bounds}}.encode()
 	}
-
-	// The most overlap may still not be enough.
-	const minimumOverlap = 3 // TODO(pb): parameterize
-	if len(candidates) < minimumOverlap {
-		return nil, ErrNoSegmentsAvailable
+	if fill != nil {
+		result.Records = fl.cache.filling(fill, result)
 	}
+	return result, nil
+}
 
-	// Our candidates are good enough.
-	// Create ReadSegments.
-	readSegments := make([]ReadSegment, len(candidates))
-	for i, path := range candidates {
-		readSegment, err := newFileReadSegment(fl.filesys, path)
-		if err != nil {
-			return nil, err
-		}
-		readSegments[i] = readSegment
+// presentSegments returns the names of the segments overlapping the range,
+// on disk, or in the cold tier, whether they're planned, and match, or not.
+func (fl *fileLog) presentSegments(from, to ulid.ULID) map[[2]ulid.ULID]bool {
+	present := map[[2]ulid.ULID]bool{}
+	for _, path := range fl.index.overlapping(from, to) {
+		low, high, _ := parseFilename(path)
+		present[[2]ulid.ULID{low, high}] = true
 	}
-	return readSegments, nil
+	cold, _ := fl.cold.overlapping(from, to)
+	for _, s := range cold {
+		present[[2]ulid.ULID{s.low, s.high}] = true
+	}
+	return present
+}
+
+func (fl *fileLog) Overlapping() ([]ReadSegment, error) {
+	return fl.Compactable(NewOverlappingPlanner(3))
 }
 
 func (fl *fileLog) Sequential() ([]ReadSegment, error) {
-	// First we need to build an index of all of the segments in time order.
-	// For this we only need the first ULID in the segment.
-	var segmentInfos []segmentInfo
+	return fl.Compactable(NewSequentialPlanner(fl.segmentTargetSize))
+}
+
+func (fl *fileLog) Compactable(planner CompactionPlanner) ([]ReadSegment, error) {
+	// First, describe all flushed segments, in time order. Compressed
+	// segments are planned by their logical size, which the index knows.
+	var (
+		op       = planner.Kind()
+		segments []FlushedSegment
+		sizes    = fl.index.sizes()
+	)
 	fl.filesys.Walk(fl.root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -219,49 +402,43 @@ func (fl *fileLog) Sequential() ([]ReadSegment, error) {
 		if filepath.Ext(path) != extFlushed {
 			return nil // skip
 		}
-		a, _, err := parseFilename(path)
+		a, b, err := parseFilename(path)
 		if err != nil {
 			fl.reporter.ReportEvent(Event{
-				Op: "Sequential", File: path, Warning: err,
+				Op: op, File: path, Warning: err,
 				Msg: fmt.Sprintf("will remove apparently-bad data file of size %d", info.Size()),
 			})
 			// TODO(pb): re-parse and recover this file, async
 			if err := fl.filesys.Remove(path); err != nil {
 				fl.reporter.ReportEvent(Event{
-					Op: "Sequential", File: path, Warning: err,
+					Op: op, File: path, Warning: err,
 					Msg: "tried to remove apparently-bad data file, which failed",
 				})
 			}
 			return nil // weird; skip
 		}
-		segmentInfos = append(segmentInfos, segmentInfo{a.String(), path, info.Size()})
+		size, ok := sizes[path]
+		if !ok {
+			size = info.Size()
+		}
+		segments = append(segments, FlushedSegment{path, a, b, size})
 		return nil
 	})
-	sort.Slice(segmentInfos, func(i, j int) bool { return segmentInfos[i].lowID < segmentInfos[j].lowID })
+	sort.Slice(segments, func(i, j int) bool { return segments[i].Low.Compare(segments[j].Low) < 0 })
 
-	// We'll walk all the segments and try to get at least 2 that are
-	// small enough to compact together to the given target size.
-	const minimumSegments = 2
-	candidates := chooseFirstSequential(segmentInfos, minimumSegments, fl.segmentTargetSize)
-	if len(candidates) < minimumSegments {
+	// Then, let the planner choose.
+	candidates := planner.Plan(segments)
+	if len(candidates) == 0 {
 		return nil, ErrNoSegmentsAvailable // no problem
 	}
 
 	// Our candidates are good enough.
 	// Create ReadSegments.
-	readSegments := make([]ReadSegment, len(candidates))
-	for i, path := range candidates {
-		readSegment, err := newFileReadSegment(fl.filesys, path)
-		if err != nil {
-			return nil, err
-		}
-		readSegments[i] = readSegment
-	}
-	return readSegments, nil
+	return fl.readSegments(candidates)
 }
 
-func (fl *fileLog) Trashable(oldestRecord time.Time) ([]ReadSegment, error) {
-	oldestID := ulid.MustNew(ulid.Timestamp(oldestRecord), nil)
+func (fl *fileLog) Trashable(oldestRecord time.Time, imported bool) ([]ReadSegment, error) {
+	oldestID := ulidutil.Min(ulid.Timestamp(oldestRecord))
 
 	// Get the segments we'll trash.
 	var candidates []string
@@ -290,7 +467,7 @@ func (fl *fileLog) Trashable(oldestRecord time.Time) ([]ReadSegment, error) {
 			}
 			return nil // weird; skip
 		}
-		if bytes.Compare(high[:], oldestID[:]) < 0 {
+		if bytes.Compare(high[:], oldestID[:]) < 0 && (imported || !fl.isImported(path)) {
 			candidates = append(candidates, path)
 		}
 		return nil
@@ -300,13 +477,85 @@ func (fl *fileLog) Trashable(oldestRecord time.Time) ([]ReadSegment, error) {
 	}
 
 	// We have some candidates. Create and return ReadSegments.
-	readSegments := make([]ReadSegment, len(candidates))
-	for i, path := range candidates {
-		readSegment, err := newFileReadSegment(fl.filesys, path)
+	return fl.readSegments(candidates)
+}
+
+func (fl *fileLog) TrashableBySize(maxBytes int64, imported bool) ([]ReadSegment, error) {
+	// Tally the size of all untrashed segments and their sidecars, and
+	// collect the flushed segments, which are the only ones we may trash.
+	type flushedSegment struct {
+		high ulid.ULID
+		path string
+		size int64
+	}
+	var (
+		total    int64
+		flushed  []flushedSegment
+		sidecars = map[string]int64{} // by basename
+	)
+	fl.filesys.Walk(fl.root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil // descend
+		}
+		switch filepath.Ext(path) {
+		case extActive, extReading:
+			total += info.Size()
+		case extBloom, extChecksum, extLabels:
+			total += info.Size()
+			sidecars[basename(path)] += info.Size()
+		case extFlushed:
+			_, high, err := parseFilename(path)
+			if err != nil {
+				return nil // skip; Trashable will deal with it
+			}
+			total += info.Size()
+			flushed = append(flushed, flushedSegment{high, path, info.Size()})
+		}
+		return nil
+	})
+	if total <= maxBytes {
+		return nil, ErrNoSegmentsAvailable
+	}
+
+	// Take the segments with the oldest newest records, just like Trashable
+	// would, until we're within budget.
+	sort.Slice(flushed, func(i, j int) bool { return flushed[i].high.Compare(flushed[j].high) < 0 })
+	var candidates []string
+	for _, s := range flushed {
+		if total <= maxBytes {
+			break
+		}
+		if !imported && fl.isImported(s.path) {
+			continue
+		}
+		candidates = append(candidates, s.path)
+		total -= s.size + sidecars[basename(s.path)]
+	}
+	if len(candidates) <= 0 {
+		return nil, ErrNoSegmentsAvailable
+	}
+
+	// We have some candidates. Create and return ReadSegments.
+	return fl.readSegments(candidates)
+}
+
+// readSegments takes the flushed segments at paths for reading. If one can't
+// be taken, e.g. it was renamed since, or it's open and the OS won't rename
+// it, the ones already taken are given back.
+func (fl *fileLog) readSegments(paths []string) ([]ReadSegment, error) {
+	readSegments := make([]ReadSegment, 0, len(paths))
+	for _, path := range paths {
+		readSegment, err := newFileReadSegment(fl.filesys, fl.index, path, fl.keys, fl.quarantine)
+		if err != nil {
+			for _, readSegment := range readSegments {
+				readSegment.Reset() // best effort; recovery resets the rest
+			}
 			return nil, err
 		}
-		readSegments[i] = readSegment
+		readSegments = append(readSegments, readSegment)
 	}
 	return readSegments, nil
 }
@@ -338,6 +587,9 @@ func (fl *fileLog) Purgeable(oldestModTime time.Time) ([]TrashSegment, error) {
 	for i, path := range candidates {
 		f, err := fl.filesys.Open(path)
 		if err != nil {
+			for _, trashSegment := range trashSegments[:i] {
+				trashSegment.(fileTrashSegment).f.Close() // so they can be removed later
+			}
 			return nil, errors.Wrap(err, "opening candidate segment for read")
 		}
 		trashSegments[i] = fileTrashSegment{fl.filesys, f}
@@ -345,6 +597,169 @@ func (fl *fileLog) Purgeable(oldestModTime time.Time) ([]TrashSegment, error) {
 	return trashSegments, nil
 }
 
+func (fl *fileLog) Trashed() ([]TrashedSegment, error) {
+	var segments []TrashedSegment
+	err := fl.filesys.Walk(fl.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil // descend
+		}
+		if filepath.Ext(path) != extTrashed {
+			return nil // skip
+		}
+		low, high, err := parseFilename(path)
+		if err != nil {
+			return nil // weird; Purgeable will deal with it
+		}
+		segments = append(segments, TrashedSegment{basename(path), info.Size(), low, high, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if c := segments[i].Low.Compare(segments[j].Low); c != 0 {
+			return c < 0
+		}
+		return segments[i].High.Compare(segments[j].High) < 0
+	})
+	return segments, nil
+}
+
+func (fl *fileLog) Restore(segment string) error {
+	if _, _, err := parseFilename(segment); err != nil || filepath.Base(segment) != segment {
+		return ErrSegmentNotFound
+	}
+	var (
+		oldpath = filepath.Join(fl.root, segment+extTrashed)
+		newpath = modifyExtension(oldpath, extFlushed)
+	)
+	f, err := fl.filesys.Open(oldpath)
+	if err != nil {
+		return ErrSegmentNotFound
+	}
+	diskSize := f.Size()
+	f.Close()
+	size, err := logicalSize(fl.filesys, oldpath, diskSize)
+	if err != nil {
+		size = diskSize
+	}
+	if err := fl.filesys.Rename(oldpath, newpath); err != nil {
+		return errors.Wrapf(err, "restoring %s", segment)
+	}
+	// Its sidecars went when it was trashed, so it's queried like
+	// recovered segments: without a filter, or checksums to verify. If
+	// it overlaps newer segments, it's compacted into them in time.
+	fl.index.add(newpath, size)
+	return nil
+}
+
+func (fl *fileLog) Sealed(from, to ulid.ULID) ([]SealedSegment, error) {
+	var segments []SealedSegment
+	for _, path := range fl.index.overlapping(from, to) {
+		f, err := fl.openSealed(path)
+		if err == os.ErrNotExist {
+			continue // compacted or trashed since
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "opening %s", path)
+		}
+		h := crc32.New(castagnoli)
+		n, err := io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", path)
+		}
+		low, high, _ := parseFilename(path) // indexed, so it parses
+		segments = append(segments, SealedSegment{basename(path), n, low, high, h.Sum32()})
+	}
+	return segments, nil
+}
+
+func (fl *fileLog) Queryable(from, to ulid.ULID) ([]string, error) {
+	paths := fl.index.overlapping(from, to)
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = basename(path)
+	}
+
+	// Queries read cold segments, too, so plans must cover them.
+	cold, _ := fl.cold.overlapping(from, to)
+	if len(cold) == 0 {
+		return names, nil
+	}
+	local := map[string]bool{}
+	for _, name := range names {
+		local[name] = true
+	}
+	for _, s := range cold {
+		if !local[s.Name] {
+			names = append(names, s.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (fl *fileLog) OpenSealed(segment string) (fs.File, error) {
+	if _, _, err := parseFilename(segment); err != nil || filepath.Base(segment) != segment {
+		return nil, ErrSegmentNotFound
+	}
+	f, err := fl.openSealed(filepath.Join(fl.root, segment+extFlushed))
+	if err == os.ErrNotExist {
+		return nil, ErrSegmentNotFound
+	}
+	return f, err
+}
+
+func (fl *fileLog) OpenVerified(segment string) (fs.File, error) {
+	if _, _, err := parseFilename(segment); err != nil || filepath.Base(segment) != segment {
+		return nil, ErrSegmentNotFound
+	}
+	path := filepath.Join(fl.root, segment+extFlushed)
+	f, err := openSegmentFile(fl.filesys, path, fl.keys, func(string) {})
+	if err == os.ErrNotExist {
+		f, err = openSegmentFile(fl.filesys, modifyExtension(path, extReading), fl.keys, func(string) {})
+	}
+	if err == os.ErrNotExist {
+		return nil, ErrSegmentNotFound
+	}
+	return f, err
+}
+
+func (fl *fileLog) Quarantine(segment string) error {
+	if _, _, err := parseFilename(segment); err != nil || filepath.Base(segment) != segment {
+		return ErrSegmentNotFound
+	}
+	path := filepath.Join(fl.root, segment+extFlushed)
+	if !fl.filesys.Exists(path) && !fl.filesys.Exists(modifyExtension(path, extReading)) {
+		return ErrSegmentNotFound
+	}
+	fl.quarantine(path)
+	return nil
+}
+
+// openSealed opens the flushed segment at path as stored, without verifying
+// or decompressing it, but decrypted, since our keys are no use to anyone
+// else. Like openSegment, it looks for it as reading, too.
+func (fl *fileLog) openSealed(path string) (fs.File, error) {
+	f, err := fl.filesys.Open(path)
+	if err == os.ErrNotExist {
+		other := modifyExtension(path, extReading)
+		if filepath.Ext(path) == extReading {
+			other = modifyExtension(path, extFlushed)
+		}
+		path = other
+		f, err = fl.filesys.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return openDecrypted(f, path, fl.keys, fl.quarantine)
+}
+
 func (fl *fileLog) Stats() (LogStats, error) {
 	var stats LogStats
 	fl.filesys.Walk(fl.root, func(path string, info os.FileInfo, err error) error {
@@ -377,60 +792,57 @@ func (fl *fileLog) Close() error {
 	return fl.releaser.Release()
 }
 
-func recoverSegments(filesys fs.Filesystem, root string) error {
-	var toRename, toReprocess []string
-	filesys.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil // recurse
-		}
-		switch filepath.Ext(path) {
-		case extActive:
-			toReprocess = append(toReprocess, path)
-		case extReading:
-			toRename = append(toRename, path)
-		}
-		return nil
-	})
-
-	for _, path := range toReprocess {
-		// mergeRecords has the side effect of extracting the low and high ULIDs
-		// from a segment file. We use it for that side effect. This is a little
-		// bit inefficient; that's OK.
-		f, err := filesys.Open(path)
-		if err != nil {
-			return err
+// trimSegment scans the active segment at path for the low and high ULIDs,
+// and the number, of its whole records. A crash may have torn the last one;
+// if so, it's trimmed away. The trimmed segment is written aside, and renamed
+// over the original, so a crash while trimming loses nothing.
+func trimSegment(filesys fs.Filesystem, path string) (low, high ulid.ULID, n int, err error) {
+	f, err := filesys.Open(path)
+	if err != nil {
+		return low, high, 0, err
+	}
+	buf, err := ioutil.ReadAll(f)
+	f.Close() // ignore error, for now
+	if err != nil {
+		return low, high, 0, errors.Wrapf(err, "reading %s", path)
+	}
+	var size int // of the whole records
+	for rest := buf; ; n++ {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			break
 		}
-		lo, hi, _, err := mergeRecords(ioutil.Discard, f)
-		f.Close() // ignore error, for now
-		if err != nil {
-			return err
+		var id ulid.ULID
+		if i < ulid.EncodedSize || id.UnmarshalText(rest[:ulid.EncodedSize]) != nil {
+			break
 		}
-		var (
-			oldname = path
-			oldpath = filepath.Dir(oldname)
-			newname = filepath.Join(oldpath, fmt.Sprintf("%s-%s%s", lo, hi, extFlushed))
-		)
-		if err := filesys.Rename(oldname, newname); err != nil {
-			return err
+		if n == 0 {
+			low = id
 		}
+		high = id
+		size += i + 1
+		rest = rest[i+1:]
 	}
-
-	// It's possible this will create duplicate records.
-	// We rely on repair and compaction to remove them.
-	for _, path := range toRename {
-		var (
-			oldname = path
-			newname = modifyExtension(oldname, extFlushed)
-		)
-		if err := filesys.Rename(oldname, newname); err != nil {
-			return err
-		}
+	if n == 0 || size == len(buf) {
+		return low, high, n, nil
 	}
-
-	return nil
+	trimming := modifyExtension(path, extTrimming)
+	t, err := filesys.Create(trimming)
+	if err != nil {
+		return low, high, 0, errors.Wrapf(err, "trimming %s", path)
+	}
+	if _, err := t.Write(buf[:size]); err != nil {
+		t.Close()
+		return low, high, 0, errors.Wrapf(err, "trimming %s", path)
+	}
+	if err := t.Sync(); err != nil {
+		t.Close()
+		return low, high, 0, errors.Wrapf(err, "trimming %s", path)
+	}
+	if err := t.Close(); err != nil {
+		return low, high, 0, errors.Wrapf(err, "trimming %s", path)
+	}
+	return low, high, n, filesys.Rename(trimming, path)
 }
 
 func recordFilterPlain(q []byte) recordFilter {
@@ -445,6 +857,56 @@ func recordFilterRegex(q *regexp.Regexp) recordFilter {
 	}
 }
 
+// recordFilterTopic passes records of the given topic that also pass the
+// given filter. Records without a valid topic belong to the default topic.
+func recordFilterTopic(topic []byte, pass recordFilter) recordFilter {
+	return func(b []byte) bool {
+		return len(b) > ulid.EncodedSize &&
+			bytes.Equal(record.Topic(b[ulid.EncodedSize+1:]), topic) &&
+			pass(b)
+	}
+}
+
+// recordFilterSample passes about the given fraction of the records that
+// pass the given filter. Whether a record passes is decided by the entropy of
+// its ULID, which is random, so every replica of a record agrees, and
+// duplicates are still dropped.
+func recordFilterSample(sample float64, pass recordFilter) recordFilter {
+	if sample >= 1 {
+		return pass
+	}
+	threshold := uint64(sample * (1 << 64))
+	return func(b []byte) bool {
+		var id ulid.ULID
+		return len(b) > ulid.EncodedSize &&
+			id.UnmarshalText(b[:ulid.EncodedSize]) == nil &&
+			binary.BigEndian.Uint64(id.Entropy()) < threshold &&
+			pass(b)
+	}
+}
+
+// recordFilterAfter passes records with ULIDs greater than after, that also
+// pass the given filter.
+func recordFilterAfter(after ulid.ULID, pass recordFilter) recordFilter {
+	afterBytes, _ := after.MarshalText()
+	return func(b []byte) bool {
+		return len(b) > ulid.EncodedSize &&
+			bytes.Compare(b[:ulid.EncodedSize], afterBytes) > 0 &&
+			pass(b)
+	}
+}
+
+// recordFilterBefore passes records with ULIDs less than before, that also
+// pass the given filter.
+func recordFilterBefore(before ulid.ULID, pass recordFilter) recordFilter {
+	beforeBytes, _ := before.MarshalText()
+	return func(b []byte) bool {
+		return len(b) > ulid.EncodedSize &&
+			bytes.Compare(b[:ulid.EncodedSize], beforeBytes) < 0 &&
+			pass(b)
+	}
+}
+
 func recordFilterBoundedPlain(from, to ulid.ULID, q []byte) recordFilter {
 	fromBytes, _ := from.MarshalText()
 	fromBytes = fromBytes[:ulidTimeSize]
@@ -472,44 +934,37 @@ func recordFilterBoundedRegex(from, to ulid.ULID, q *regexp.Regexp) recordFilter
 }
 
 // queryMatchingSegments returns a sorted slice of all segment files that could
-// possibly have records in the provided time range. The caller is responsible
-// for closing the segments.
-func (fl *fileLog) queryMatchingSegments(from, to ulid.ULID) (segments []readSegment) {
-	fl.filesys.Walk(fl.root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil // descend
-		}
-		// We should query .reading segments, too.
-		// Better to get duplicates than miss records.
-		if ext := filepath.Ext(path); !(ext == extFlushed || ext == extReading) {
-			return nil // skip
-		}
-		low, high, err := parseFilename(path)
-		if err != nil {
-			fl.reporter.ReportEvent(Event{
-				Op: "queryMatchingSegments", File: path, Warning: err,
-				Msg: fmt.Sprintf("will remove apparently-bad data file of size %d", info.Size()),
-			})
-			// TODO(pb): re-parse and recover this file, async
-			if err := fl.filesys.Remove(path); err != nil {
-				fl.reporter.ReportEvent(Event{
-					Op: "queryMatchingSegments", File: path, Warning: err,
-					Msg: "tried to remove apparently-bad data file, which failed",
-				})
-			}
-			return nil // weird; skip
+// possibly have records in the provided time range. If literal is non-nil,
+// segments whose bloom filter rules it out are skipped. Likewise segments
+// whose origins don't match the labels, if any. If planned isn't nil, only
+// the planned segments are returned; see plannedPaths. Skipped segments are
+// counted in stats. The caller is responsible for closing the segments.
+func (fl *fileLog) queryMatchingSegments(from, to ulid.ULID, literal []byte, labels []labelMatcher, planned []string, stats *QueryStats) (segments []readSegment) {
+	fl.units.RLock()
+	defer fl.units.RUnlock()
+
+	// The index is already sorted by low ULID.
+	stats.SegmentsConsidered = fl.index.len()
+	paths := fl.index.overlapping(from, to)
+	if planned != nil {
+		paths = plannedPaths(paths, planned)
+	}
+	stats.SegmentsPruned = stats.SegmentsConsidered - len(paths)
+	for _, path := range paths {
+		if literal != nil && !fl.mayContain(path, literal) {
+			stats.SegmentsFiltered++
+			continue
 		}
-		if !overlap(from, to, low, high) {
-			return nil
+		if len(labels) > 0 && !fl.matchesLabels(path, labels) {
+			stats.SegmentsFiltered++
+			continue
 		}
-		file, err := fl.filesys.Open(path)
+		file, err := fl.openSegment(path)
 		switch err {
 		case nil:
-			segments = append(segments, readSegment{path, file, info.Size()})
+			segments = append(segments, readSegment{path: file.Name(), file: file, size: file.Size()})
 		case os.ErrNotExist:
+			fl.index.remove(path)
 			fl.reporter.ReportEvent(Event{
 				Op: "queryMatchingSegments", File: path, Warning: err,
 				Msg: "this can happen due to e.g. compaction",
@@ -519,27 +974,129 @@ func (fl *fileLog) queryMatchingSegments(from, to ulid.ULID) (segments []readSeg
 				Op: "queryMatchingSegments", File: path, Error: err,
 			})
 		}
-		return nil
-	})
-	sort.Slice(segments, func(i, j int) bool {
-		a := strings.SplitN(basename(segments[i].path), "-", 2)[0]
-		b := strings.SplitN(basename(segments[j].path), "-", 2)[0]
-		return a < b
-	})
+	}
 	return segments
 }
 
+// mayContain returns false if the bloom filter of the segment at path rules out
+// the literal. Segments without a (readable) filter may contain anything.
+func (fl *fileLog) mayContain(path string, literal []byte) bool {
+	filter, err := readBloomFilter(fl.queryFilesys, modifyExtension(path, extBloom))
+	switch {
+	case err == os.ErrNotExist:
+		return true // e.g. recovered segments
+	case err != nil:
+		fl.reporter.ReportEvent(Event{
+			Op: "queryMatchingSegments", File: path, Warning: err,
+			Msg: "failed to read bloom filter, falling back to a full scan",
+		})
+		return true
+	}
+	return filter.mayContain(literal)
+}
+
+// openSegment opens the segment at path, which may have been renamed between
+// flushed and reading since we looked it up in the index.
+func (fl *fileLog) openSegment(path string) (fs.File, error) {
+	file, err := openSegmentFile(fl.queryFilesys, path, fl.keys, fl.quarantine)
+	if err == os.ErrNotExist {
+		other := modifyExtension(path, extReading)
+		if filepath.Ext(path) == extReading {
+			other = modifyExtension(path, extFlushed)
+		}
+		file, err = openSegmentFile(fl.queryFilesys, other, fl.keys, fl.quarantine)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// A corrupt segment has been quarantined by the time reads fail. Its
+	// records are replicated elsewhere, so the query can go on without
+	// (the rest of) them.
+	return truncateCorrupt{file}, nil
+}
+
+// quarantine moves a segment which failed checksum verification, and its
+// checksums, to the corrupt directory, so it's neither queried nor compacted.
+func (fl *fileLog) quarantine(path string) {
+	dir := filepath.Join(fl.root, corruptDir)
+	if err := fl.filesys.MkdirAll(dir); err != nil {
+		fl.reporter.ReportEvent(Event{
+			Op: "quarantine", File: path, Error: err,
+			Msg: "failed to create the directory for corrupt segments",
+		})
+		return
+	}
+	for _, ext := range []string{extFlushed, extReading} {
+		src := modifyExtension(path, ext)
+		dst := filepath.Join(dir, basename(path)+extCorrupt)
+		if err := fl.filesys.Rename(src, dst); err != nil {
+			continue // maybe it was renamed since
+		}
+		fl.index.remove(src)
+		fl.filesys.Remove(modifyExtension(src, extBloom))
+		fl.filesys.Remove(modifyExtension(src, extLabels))
+		fl.filesys.Rename(modifyExtension(src, extChecksum), filepath.Join(dir, basename(path)+extChecksum))
+		if fl.corruptSegments != nil {
+			fl.corruptSegments.Inc()
+		}
+		fl.reporter.ReportEvent(Event{
+			Op: "quarantine", File: path, Warning: errCorruptSegment,
+			Msg:   fmt.Sprintf("moved to %s", dst),
+			Alert: alert.SegmentQuarantined,
+		})
+		return
+	}
+	fl.reporter.ReportEvent(Event{
+		Op: "quarantine", File: path, Warning: errCorruptSegment,
+		Msg: "failed to move corrupt segment, which may have been moved already",
+	})
+}
+
 type fileWriteSegment struct {
-	fs fs.Filesystem
-	f  fs.File
+	fs        fs.Filesystem
+	f         fs.File
+	index     *segmentIndex
+	filter    *bloomFilter
+	grams     *gramWriter
+	checksum  *blockChecksum
+	compress  bool // once it's compacted
+	compacted bool
+	keys      KeyWrapper
+	origins   []string
+
+	units     *sync.RWMutex // see fileLog
+	committed bool
 }
 
 func (w fileWriteSegment) Write(p []byte) (int, error) {
-	return w.f.Write(p)
+	n, err := w.f.Write(p)
+	w.grams.Write(p[:n])
+	w.checksum.Write(p[:n])
+	return n, err
+}
+
+// SetOrigins of the records in the segment, which are written along with it.
+func (w *fileWriteSegment) SetOrigins(origins []string) {
+	w.origins = mergeOrigins(origins)
 }
 
-// Close the segment and make it available for query.
-func (w fileWriteSegment) Close(low, high ulid.ULID) error {
+// SetCompacted marks the segment as written by compaction, so it's
+// compressed, if the log compresses segments, as it's closed.
+func (w *fileWriteSegment) SetCompacted() {
+	w.compacted = true
+}
+
+// Close the segment and make it available for query, along with its
+// sidecars, as a unit; see segmentUnit.
+func (w *fileWriteSegment) Close(low, high ulid.ULID) error {
+	size := w.f.Size()
+	// Once it's flushed, compaction may purge the segments it came from,
+	// so it has to be durable first.
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+	fs.Seal(w.f) // just advice
 	if err := w.f.Close(); err != nil {
 		return err
 	}
@@ -549,11 +1106,72 @@ func (w fileWriteSegment) Close(low, high ulid.ULID) error {
 	if w.fs.Exists(newname) {
 		return errors.Errorf("file %s already exists", newname)
 	}
-	return w.fs.Rename(oldname, newname)
+	unit := segmentUnit{manifest: modifyExtension(newname, extUnit), segment: oldname}
+	// The filter is an optimization. If it's missing, queries scan the
+	// whole segment, so failing to write it is no reason to fail here.
+	if w.filter.fill() <= bloomMaxFill {
+		if err := writeBloomFilter(w.fs, unit.staged(extBloom), w.filter); err == nil {
+			unit.sidecars = append(unit.sidecars, extBloom)
+		}
+	}
+	// The origins aren't, since label queries would miss the segment.
+	if len(w.origins) > 0 {
+		if err := writeOrigins(w.fs, unit.staged(extLabels), w.origins); err != nil {
+			unit.discard(w.fs)
+			return err
+		}
+		unit.sidecars = append(unit.sidecars, extLabels)
+	}
+	sums := w.checksum.blocks()
+	compress := w.compress && w.compacted
+	if compress || w.keys != nil {
+		// Compression is an optimization, too. If it fails, we keep the
+		// uncompressed segment. Encryption isn't, so if it fails, the
+		// segment stays active, to be encrypted in recovery.
+		sealing := modifyExtension(oldname, extSealing)
+		sealed, err := sealSegment(w.fs, oldname, sealing, compress, w.keys)
+		if err != nil && w.keys != nil {
+			unit.discard(w.fs)
+			return errors.Wrap(err, "encrypting segment")
+		}
+		if err == nil {
+			unit.segment, sums = sealing, sealed
+		}
+	}
+	// Without checksums, corruption goes undetected, but queries still work.
+	if err := writeChecksums(w.fs, unit.staged(extChecksum), sums); err == nil {
+		unit.sidecars = append(unit.sidecars, extChecksum)
+	}
+	if err := unit.commit(w.fs); err != nil {
+		unit.discard(w.fs)
+		return errors.Wrap(err, "committing segment")
+	}
+	w.committed = true // the unit's to recovery, now, not Delete
+
+	// A segment of the same name that's being read, e.g. by the compaction
+	// that wrote this one, is replaced by it. Its reader cleans up after it.
+	w.units.Lock()
+	defer w.units.Unlock()
+	replaced := modifyExtension(newname, extReading)
+	replacing := w.fs.Exists(replaced)
+	if replacing {
+		w.index.remove(replaced)
+	}
+	if err := unit.publish(w.fs); err != nil {
+		return errors.Wrapf(err, "publishing segment, which recovery will finish")
+	}
+	w.index.add(newname, size)
+	if replacing {
+		return nil // the manifest says it's replaced
+	}
+	return w.fs.Remove(unit.manifest)
 }
 
-// Delete the segment.
-func (w fileWriteSegment) Delete() error {
+// Delete the segment, unless it's been committed.
+func (w *fileWriteSegment) Delete() error {
+	if w.committed {
+		return nil
+	}
 	if err := w.f.Close(); err != nil {
 		return err
 	}
@@ -561,37 +1179,73 @@ func (w fileWriteSegment) Delete() error {
 }
 
 type fileReadSegment struct {
-	fs fs.Filesystem
-	f  fs.File
+	fs    fs.Filesystem
+	f     fs.File
+	index *segmentIndex
 }
 
-func newFileReadSegment(fs fs.Filesystem, path string) (fileReadSegment, error) {
+func newFileReadSegment(fs fs.Filesystem, index *segmentIndex, path string, keys KeyWrapper, corrupt func(path string)) (fileReadSegment, error) {
 	if filepath.Ext(path) != extFlushed {
 		return fileReadSegment{}, errors.Errorf("newFileReadSegment from non-flushed file %s", path)
 	}
+	if fs.Exists(modifyExtension(path, extUnit)) {
+		// It's only just replaced the segment of its name, which is still
+		// being cleaned up after.
+		return fileReadSegment{}, errors.Errorf("newFileReadSegment from unpublished file %s", path)
+	}
 	oldpath := path
 	newpath := modifyExtension(oldpath, extReading)
 	if err := fs.Rename(oldpath, newpath); err != nil {
 		return fileReadSegment{}, err
 	}
-	f, err := fs.Open(newpath)
+	index.rename(oldpath, newpath)
+	f, err := openSegmentFile(fs, newpath, keys, corrupt)
 	if err != nil {
+		if fs.Rename(newpath, oldpath) == nil { // unless it was quarantined
+			index.rename(newpath, oldpath)
+		}
 		return fileReadSegment{}, err
 	}
-	return fileReadSegment{fs, f}, nil
+	return fileReadSegment{fs, f, index}, nil
 }
 
 func (r fileReadSegment) Read(p []byte) (int, error) {
 	return r.f.Read(p)
 }
 
+func (r fileReadSegment) Name() string {
+	return r.f.Name()
+}
+
+// Origins of the segment. If they can't be read, there are none.
+func (r fileReadSegment) Origins() []string {
+	origins, _ := readOrigins(r.fs, modifyExtension(r.f.Name(), extLabels))
+	return origins
+}
+
 func (r fileReadSegment) Reset() error {
 	if err := r.f.Close(); err != nil {
 		return err
 	}
 	oldpath := r.f.Name()
 	newpath := modifyExtension(oldpath, extFlushed)
-	return r.fs.Rename(oldpath, newpath)
+	if manifest := modifyExtension(oldpath, extUnit); r.fs.Exists(manifest) {
+		// A segment of the same name replaced it, so it's not to be queried
+		// again. If that one's not published yet, recovery sees it is.
+		r.index.remove(oldpath)
+		if !r.fs.Exists(newpath) {
+			return errors.Errorf("segment replacing %s isn't published", oldpath)
+		}
+		if err := r.fs.Remove(oldpath); err != nil {
+			return err
+		}
+		return r.fs.Remove(manifest)
+	}
+	if err := r.fs.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	r.index.rename(oldpath, newpath)
+	return nil
 }
 
 func (r fileReadSegment) Trash() error {
@@ -603,6 +1257,8 @@ func (r fileReadSegment) Trash() error {
 	if err := r.fs.Rename(oldpath, newpath); err != nil {
 		return err
 	}
+	r.index.remove(oldpath)
+	removeSidecars(r.fs, oldpath) // queries no longer need them
 	return r.fs.Chtimes(newpath, time.Now(), time.Now())
 }
 
@@ -610,7 +1266,19 @@ func (r fileReadSegment) Purge() error {
 	if err := r.f.Close(); err != nil {
 		return err
 	}
-	return r.fs.Remove(r.f.Name())
+	if err := r.fs.Remove(r.f.Name()); err != nil {
+		return err
+	}
+	r.index.remove(r.f.Name())
+	// If one of the segments compacted spans all of the others, what
+	// they're compacted into has its name, and sidecars, by now.
+	if !r.fs.Exists(modifyExtension(r.f.Name(), extFlushed)) {
+		removeSidecars(r.fs, r.f.Name())
+	}
+	if manifest := modifyExtension(r.f.Name(), extUnit); r.fs.Exists(manifest) {
+		return r.fs.Remove(manifest)
+	}
+	return nil
 }
 
 type fileTrashSegment struct {
@@ -622,7 +1290,19 @@ func (t fileTrashSegment) Purge() error {
 	if err := t.f.Close(); err != nil {
 		return err
 	}
-	return t.fs.Remove(t.f.Name())
+	if err := t.fs.Remove(t.f.Name()); err != nil {
+		return err
+	}
+	removeSidecars(t.fs, t.f.Name())
+	return nil
+}
+
+// removeSidecars removes the files stored alongside the segment at path.
+// They may not exist, so errors are ignored.
+func removeSidecars(filesys fs.Filesystem, path string) {
+	for _, ext := range sidecarExts {
+		filesys.Remove(modifyExtension(path, ext))
+	}
 }
 
 // chooseFirstSequential segments that are small enough to compact together to
@@ -2,6 +2,7 @@ package store
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -73,6 +74,8 @@ func TestRecoverSegments(t *testing.T) {
 	filesys := fs.NewVirtualFilesystem()
 	for filename, contents := range map[string]string{
 		"ACTIVE" + extActive:   "01ARYZ6S41TSV4RRFFQ69G5FAV One\n01ARYZ6S41TSV4RRFFZZZZZZZZ Two\n",
+		"TORN" + extActive:     "01ARYZ6S41TSV4RRFFQ69G5FAW Three\n01ARYZ6S41",
+		"EMPTY" + extActive:    "",
 		"FLUSHED" + extFlushed: "Contents ignoredt",
 		"READING" + extReading: "Contents ignored",
 		"TRASHED" + extTrashed: "Contents ignored",
@@ -94,7 +97,7 @@ func TestRecoverSegments(t *testing.T) {
 		segmentTargetSize = 10 * 1024
 		segmentBufferSize = 1024
 	)
-	filelog, err := NewFileLog(filesys, "", segmentTargetSize, segmentBufferSize, nil)
+	filelog, err := NewFileLog(filesys, "", segmentTargetSize, segmentBufferSize, FileLogConfig{})
 	if err != nil {
 		t.Fatalf("NewFileLog: %v", err)
 	}
@@ -102,6 +105,7 @@ func TestRecoverSegments(t *testing.T) {
 
 	files := map[string]bool{ // file: expected
 		"01ARYZ6S41TSV4RRFFQ69G5FAV-01ARYZ6S41TSV4RRFFZZZZZZZZ" + extFlushed: true,
+		"01ARYZ6S41TSV4RRFFQ69G5FAW-01ARYZ6S41TSV4RRFFQ69G5FAW" + extFlushed: true,
 		"FLUSHED" + extFlushed:                                               true,
 		"READING" + extFlushed:                                               true,
 		"TRASHED" + extTrashed:                                               true,
@@ -124,6 +128,17 @@ func TestRecoverSegments(t *testing.T) {
 			t.Errorf("found unexpected file %s", file)
 		}
 	}
+
+	// The torn record is trimmed away.
+	if want, have := []string{
+		"01ARYZ6S41TSV4RRFFQ69G5FAV One\n",
+		"01ARYZ6S41TSV4RRFFQ69G5FAW Three\n",
+		"01ARYZ6S41TSV4RRFFZZZZZZZZ Two\n",
+		"Contents ignored",
+		"Contents ignoredt",
+	}, readFlushedRecords(t, filesys, ""); !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
 }
 
 func TestLockBehavior(t *testing.T) {
@@ -150,13 +165,13 @@ func TestLockBehavior(t *testing.T) {
 			f.Close()
 
 			// NewFileLog should manage this fine.
-			filelog, err := NewFileLog(filesys, root, 1024, 1024, nil)
+			filelog, err := NewFileLog(filesys, root, 1024, 1024, FileLogConfig{})
 			if err != nil {
 				t.Fatalf("initial NewFileLog: %v", err)
 			}
 
 			// But a second FileLog should fail.
-			if _, err := NewFileLog(filesys, root, 1024, 1024, nil); err == nil {
+			if _, err := NewFileLog(filesys, root, 1024, 1024, FileLogConfig{}); err == nil {
 				t.Fatalf("second NewFileLog: want error, have none")
 			} else {
 				t.Logf("second NewFileLog: got expected error: %v", err)
@@ -189,7 +204,7 @@ func TestBadSegment(t *testing.T) {
 	}
 
 	// Create a filelog around that filesys.
-	filelog, _ := NewFileLog(filesys, "/", 1024, 1024, nil)
+	filelog, _ := NewFileLog(filesys, "/", 1024, 1024, FileLogConfig{})
 
 	// Perform some read op on the filelog, to trigger rm.
 	// Main thing here is just that it doesn't panic.
@@ -206,3 +221,60 @@ func TestBadSegment(t *testing.T) {
 		t.Fatalf("%s wasn't deleted", badfile)
 	}
 }
+
+func TestRecordFilterSample(t *testing.T) {
+	t.Parallel()
+
+	var (
+		records = sampleRecords(100000)
+		all     = func([]byte) bool { return true }
+	)
+	for _, sample := range []float64{0.001, 0.01, 0.1, 0.5, 1} {
+		var (
+			pass  = recordFilterSample(sample, all)
+			again = recordFilterSample(sample, all)
+			n     int
+		)
+		for _, record := range records {
+			// The same ULID is always in, or out, whatever the record,
+			// and every record in a sample is in any greater sample.
+			in := pass(record)
+			if want, have := in, again(append(record[:ulid.EncodedSize+1:ulid.EncodedSize+1], "other record"...)); want != have {
+				t.Fatalf("sample %v: %s: want %v, have %v", sample, record[:ulid.EncodedSize], want, have)
+			}
+			if in && !recordFilterSample(math.Min(1, sample*2), all)(record) {
+				t.Fatalf("sample %v: %s is in, but not in sample %v", sample, record[:ulid.EncodedSize], sample*2)
+			}
+			if in {
+				n++
+			}
+		}
+		// Within 5 standard deviations.
+		var (
+			want = sample * float64(len(records))
+			tol  = 5 * math.Sqrt(want*(1-sample))
+		)
+		if have := float64(n); math.Abs(want-have) > tol {
+			t.Errorf("sample %v: want about %.0f records, have %.0f", sample, want, have)
+		}
+	}
+
+	// Only records passing the wrapped filter are sampled.
+	pass := recordFilterSample(1, func([]byte) bool { return false })
+	if pass(records[0]) {
+		t.Errorf("want the wrapped filter to apply")
+	}
+}
+
+// sampleRecords returns n records with ULIDs of random entropy, in order.
+func sampleRecords(n int) [][]byte {
+	var (
+		entropy = rand.New(rand.NewSource(1))
+		ms      = ulid.Timestamp(time.Date(2017, 3, 14, 16, 0, 0, 0, time.UTC))
+		records = make([][]byte, n)
+	)
+	for i := range records {
+		records[i] = []byte(fmt.Sprintf("%s record %d\n", ulid.MustNew(ms+uint64(i), entropy), i))
+	}
+	return records
+}
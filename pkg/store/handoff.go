@@ -0,0 +1,149 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/oklog/oklog/pkg/ingest"
+)
+
+// handoffRetryInterval is how long Handoff waits to retry the segments that
+// store nodes refused.
+const handoffRetryInterval = time.Second
+
+// Handoff pushes the flushed segments of an ingest log, which no consumer
+// has taken, straight to store nodes, ahead of the ingest node's planned
+// shutdown, so they aren't stranded on its disk. Each segment is replicated
+// to replicationFactor of the targets, or to all of them, if there are fewer,
+// and committed, i.e. deleted from the log, only once they all have it;
+// until then, it's failed, and kept. Refused segments are retried until
+// they're all handed off, or the context is done. Handoff returns the IDs of
+// the flushed segments that remain, if any.
+func Handoff(ctx context.Context, log ingest.Log, client Doer, targets []string, replicationFactor int, reporter EventReporter) []string {
+	want := replicationFactor
+	if want > len(targets) {
+		want = len(targets)
+	}
+	var (
+		next = 0                            // target to try first, so the load is spread
+		have = map[string]map[string]bool{} // segment ID to the targets that have it
+	)
+	for want > 0 && ctx.Err() == nil {
+		var refused bool
+		tried := map[string]bool{}
+		for ctx.Err() == nil {
+			var id string
+			segment, err := log.OldestWhere(func(candidate string, _ time.Time) bool {
+				if tried[candidate] {
+					return false
+				}
+				id = candidate // the last accepted is the oldest, and chosen
+				return true
+			})
+			if err == ingest.ErrNoSegmentsAvailable {
+				break
+			}
+			if err != nil {
+				reporter.ReportEvent(Event{Op: "handoff", Error: err, Msg: "selecting a segment"})
+				refused = true
+				break
+			}
+			tried[id] = true
+			if have[id] == nil {
+				have[id] = map[string]bool{}
+			}
+			ok := handoffSegment(ctx, segment, client, targets, next, want, have[id], reporter)
+			next++
+			if !ok {
+				refused = true
+				if err := segment.Failed(); err != nil {
+					reporter.ReportEvent(Event{Op: "handoff", Error: err, Msg: fmt.Sprintf("segment %s: failing it", id)})
+				}
+				continue
+			}
+			if err := segment.Commit(); err != nil {
+				reporter.ReportEvent(Event{Op: "handoff", Error: err, Msg: fmt.Sprintf("segment %s: committing it", id)})
+				refused = true
+				continue
+			}
+			delete(have, id)
+		}
+		if !refused {
+			break
+		}
+		select {
+		case <-time.After(handoffRetryInterval):
+		case <-ctx.Done():
+		}
+	}
+
+	var remaining []string
+	log.OldestWhere(func(id string, _ time.Time) bool {
+		remaining = append(remaining, id)
+		return false
+	})
+	sort.Strings(remaining)
+	return remaining
+}
+
+// handoffSegment replicates the segment to the targets, starting at next,
+// until want of them have it, and returns true if they do. The targets that
+// have it are kept in have, so they aren't sent it again.
+func handoffSegment(ctx context.Context, segment ingest.ReadSegment, client Doer, targets []string, next, want int, have map[string]bool, reporter EventReporter) bool {
+	body, err := ioutil.ReadAll(segment)
+	if err != nil {
+		reporter.ReportEvent(Event{Op: "handoff", Error: err, Msg: "reading segment"})
+		return false
+	}
+	var origins []string
+	if labels := segment.Labels(); labels != "" {
+		origins = []string{labels}
+	}
+	for i := 0; i < len(targets) && len(have) < want; i++ {
+		target := targets[(next+i)%len(targets)]
+		if have[target] {
+			continue
+		}
+		if err := replicateWhole(ctx, client, target, body, origins, len(have) == 0); err != nil {
+			reporter.ReportEvent(Event{
+				Op: "handoff", Warning: err,
+				Msg: fmt.Sprintf("target %s, during %s", target, APIPathReplicate),
+			})
+			continue
+		}
+		have[target] = true
+	}
+	return len(have) >= want
+}
+
+// replicateWhole sends the whole segment, from the origins, to the target,
+// which ships it to its standby, if ship is true, and it has one.
+func replicateWhole(ctx context.Context, client Doer, target string, segment []byte, origins []string, ship bool) error {
+	uri := fmt.Sprintf("http://%s/store%s", target, APIPathReplicate)
+	req, err := http.NewRequest("POST", uri, bytes.NewReader(segment))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/binary")
+	for _, origin := range origins {
+		req.Header.Add(httpHeaderOrigins, origin)
+	}
+	if ship {
+		req.Header.Set(httpHeaderShip, "true")
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ingest"
+)
+
+func TestHandoff(t *testing.T) {
+	t.Parallel()
+
+	ingestLog, err := ingest.NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, records := range []string{"a 1\n", "b 2\n", "refused 3\n"} {
+		w, err := ingestLog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(w, "%s", records)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Node s1 takes everything; s2 refuses one segment; s3 is down. Each
+	// segment must reach two nodes.
+	var (
+		mtx    sync.Mutex
+		pushed = map[string][]string{}
+	)
+	client := doerFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(req.Body)
+		switch {
+		case req.URL.Host == "s3":
+			return nil, fmt.Errorf("connection refused")
+		case req.URL.Host == "s2" && strings.HasPrefix(string(body), "refused"):
+			return &http.Response{StatusCode: http.StatusInternalServerError, Status: "500 Internal Server Error", Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}
+		mtx.Lock()
+		pushed[req.URL.Host] = append(pushed[req.URL.Host], string(body))
+		mtx.Unlock()
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("OK\n"))}, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2500*time.Millisecond)
+	defer cancel()
+	remaining := Handoff(ctx, ingestLog, client, []string{"s1", "s2", "s3"}, 2, &eventRecorder{})
+	if want, have := 1, len(remaining); want != have {
+		t.Fatalf("want %d segment(s) remaining, have %d (%v)", want, have, remaining)
+	}
+
+	// The refused segment is still flushed, for the next attempt, and
+	// the others are gone.
+	stats, err := ingestLog.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := int64(1), stats.FlushedSegments; want != have {
+		t.Errorf("flushed segments: want %d, have %d", want, have)
+	}
+	if want, have := int64(0), stats.PendingSegments; want != have {
+		t.Errorf("pending segments: want %d, have %d", want, have)
+	}
+	segment, err := ingestLog.Oldest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(segment)
+	segment.Failed()
+	if want, have := "refused 3\n", string(b); want != have {
+		t.Errorf("remaining segment: want %q, have %q", want, have)
+	}
+
+	// Every other segment reached both live nodes once; the refused one
+	// was retried on s2, but only sent to s1 the once.
+	mtx.Lock()
+	defer mtx.Unlock()
+	for _, records := range pushed {
+		sort.Strings(records) // segments flushed at once can go in any order
+	}
+	if want, have := fmt.Sprint([]string{"a 1\n", "b 2\n", "refused 3\n"}), fmt.Sprint(pushed["s1"]); want != have {
+		t.Errorf("s1: want %q, have %q", want, have)
+	}
+	if want, have := fmt.Sprint([]string{"a 1\n", "b 2\n"}), fmt.Sprint(pushed["s2"]); want != have {
+		t.Errorf("s2: want %q, have %q", want, have)
+	}
+}
+
+func TestHandoffNoTargets(t *testing.T) {
+	t.Parallel()
+
+	ingestLog, err := ingest.NewFileLog(fs.NewVirtualFilesystem(), "/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := ingestLog.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(w, "a 1\n")
+	w.Close()
+
+	client := doerFunc(func(*http.Request) (*http.Response, error) {
+		t.Error("no store nodes to push to, but pushed")
+		return nil, fmt.Errorf("unreachable")
+	})
+	if want, have := 1, len(Handoff(context.Background(), ingestLog, client, nil, 2, &eventRecorder{})); want != have {
+		t.Errorf("want %d segment(s) remaining, have %d", want, have)
+	}
+}
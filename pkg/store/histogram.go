@@ -0,0 +1,111 @@
+package store
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+// HistogramBucket counts the records of a query in a span of time, from Start
+// for the bucket duration. Bytes are of the records as stored, with newlines.
+type HistogramBucket struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+	Bytes int64     `json:"bytes"`
+}
+
+// maxHistogramBuckets bounds histogram queries, so that a tiny bucket over a
+// long range can't take unbounded memory.
+const maxHistogramBuckets = 10000
+
+// parseHistogram parses the histogram query param, a bucket duration of at
+// least a millisecond, i.e. the resolution of record times, for a query over
+// the range of qp. It returns zero if there's no such param.
+func parseHistogram(u *url.URL, qp QueryParams) (time.Duration, error) {
+	s := u.Query().Get("histogram")
+	if s == "" {
+		return 0, nil
+	}
+	bucket, err := time.ParseDuration(s)
+	if err != nil || bucket < time.Millisecond {
+		return 0, errors.Errorf("parsing 'histogram': %q isn't a duration of at least 1ms", s)
+	}
+	bucket = bucket.Truncate(time.Millisecond)
+	if n := histogramBuckets(qp.From.ULID, qp.To.ULID, bucket); n > maxHistogramBuckets {
+		return 0, errors.Errorf("histogram by %s would have %d buckets, more than %d", bucket, n, maxHistogramBuckets)
+	}
+	return bucket, nil
+}
+
+// histogramBuckets returns the number of buckets from one time to another.
+// The last bucket may be cut short by the end of the range. An empty range
+// has no buckets.
+func histogramBuckets(from, to ulid.ULID, bucket time.Duration) int64 {
+	span := int64(to.Time()) - int64(from.Time())
+	if span <= 0 {
+		return 0
+	}
+	width := int64(bucket / time.Millisecond)
+	return (span + width - 1) / width
+}
+
+// histogram counts the records read from r in buckets from one time to
+// another. Records at the very end of the range are counted in the last
+// bucket, and records outside of it aren't counted.
+func histogram(r io.Reader, from, to ulid.ULID, bucket time.Duration) ([]HistogramBucket, error) {
+	var (
+		lo      = int64(from.Time())
+		hi      = int64(to.Time())
+		width   = int64(bucket / time.Millisecond)
+		buckets = make([]HistogramBucket, histogramBuckets(from, to, bucket))
+	)
+	for i := range buckets {
+		buckets[i].Start = ulidutil.TimeOf(from).Add(time.Duration(i) * bucket)
+	}
+	s := record.NewScanner(r)
+	s.Split(scanLinesPreserveNewline)
+	for s.Scan() {
+		var (
+			b  = s.Bytes()
+			id ulid.ULID
+		)
+		if len(b) < ulid.EncodedSize || id.UnmarshalText(b[:ulid.EncodedSize]) != nil {
+			continue // heartbeat, or garbage
+		}
+		ms := int64(id.Time())
+		if len(buckets) == 0 || ms < lo || ms > hi {
+			continue
+		}
+		i := (ms - lo) / width
+		if i >= int64(len(buckets)) {
+			i = int64(len(buckets)) - 1
+		}
+		buckets[i].Count++
+		buckets[i].Bytes += int64(len(b))
+	}
+	return buckets, s.Err()
+}
+
+// encodeHistogramTo writes the buckets to the HTTP response writer as a JSON
+// array, in place of the records of the QueryResult, which must be nil. The
+// headers are the same as EncodeTo's.
+func (qr *QueryResult) encodeHistogramTo(w http.ResponseWriter, buckets []HistogramBucket) {
+	qr.encodeHeaders(w)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if qr.ErrorCount > 0 {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	buf, err := json.Marshal(buckets)
+	if err != nil {
+		panic(err) // buckets always marshal
+	}
+	w.Write(append(buf, '\n'))
+}
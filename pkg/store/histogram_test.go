@@ -0,0 +1,179 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+func TestHistogram(t *testing.T) {
+	t.Parallel()
+
+	var (
+		t0     = time.Date(2017, 3, 14, 16, 0, 0, 0, time.UTC)
+		record = func(at time.Duration) string {
+			var id ulid.ULID
+			id.SetTime(ulid.Timestamp(t0.Add(at)))
+			return id.String() + " x\n" // 29 bytes
+		}
+		at = func(d time.Duration) ulid.ULID {
+			var id ulid.ULID
+			id.SetTime(ulid.Timestamp(t0.Add(d)))
+			return id
+		}
+	)
+	for _, testcase := range []struct {
+		name     string
+		from, to time.Duration
+		records  []time.Duration
+		want     []int64 // counts
+	}{
+		{
+			name:    "edges",
+			from:    0,
+			to:      3 * time.Second,
+			records: []time.Duration{0, 999 * time.Millisecond, time.Second, 2999 * time.Millisecond, 3 * time.Second},
+			want:    []int64{2, 1, 2},
+		},
+		{
+			name:    "short last bucket",
+			from:    0,
+			to:      2500 * time.Millisecond,
+			records: []time.Duration{2 * time.Second, 2500 * time.Millisecond},
+			want:    []int64{0, 0, 2},
+		},
+		{
+			name:    "outside the range",
+			from:    time.Second,
+			to:      2 * time.Second,
+			records: []time.Duration{999 * time.Millisecond, 2001 * time.Millisecond},
+			want:    []int64{0},
+		},
+		{
+			name:    "empty range",
+			from:    time.Second,
+			to:      time.Second,
+			records: []time.Duration{time.Second},
+			want:    []int64{},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var records []string
+			for _, d := range testcase.records {
+				records = append(records, record(d))
+			}
+			r := strings.NewReader(strings.Join(records, "\n")) // and heartbeats
+			buckets, err := histogram(r, at(testcase.from), at(testcase.to), time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have := []int64{}
+			for i, b := range buckets {
+				if want, have := t0.Add(testcase.from+time.Duration(i)*time.Second), b.Start; !want.Equal(have) {
+					t.Errorf("bucket %d: start: want %s, have %s", i, want, have)
+				}
+				if want, have := 29*b.Count, b.Bytes; want != have {
+					t.Errorf("bucket %d: want %d bytes, have %d", i, want, have)
+				}
+				have = append(have, b.Count)
+			}
+			if want := testcase.want; !reflect.DeepEqual(want, have) {
+				t.Errorf("want %v, have %v", want, have)
+			}
+		})
+	}
+}
+
+func TestAPIUserQueryHistogram(t *testing.T) {
+	t.Parallel()
+
+	// Two store nodes with interleaved records, and one record in common,
+	// which is counted once.
+	var addrs []string
+	for _, records := range []string{
+		recordA + recordC + recordE + recordG + recordI,
+		recordB + recordC + recordD + recordF + recordH,
+	} {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(records)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+		addrs = append(addrs, strings.TrimPrefix(server.URL, "http://"))
+	}
+	front, server := newStreamFixture(t, staticPeer(addrs))
+	defer server.Close()
+	defer front.Close()
+
+	query := func(from, to, params string, want int) []byte {
+		resp, err := http.Get(fmt.Sprintf("%s/store%s?from=%s&to=%s%s", server.URL, APIPathUserQuery, from, to, params))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		buf, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != want {
+			t.Fatalf("%s: want HTTP %d, have %d: %s", params, want, resp.StatusCode, buf)
+		}
+		return buf
+	}
+	counts := func(buf []byte) (starts []string, counts []int64) {
+		var buckets []HistogramBucket
+		if err := json.Unmarshal(buf, &buckets); err != nil {
+			t.Fatalf("%v: %s", err, buf)
+		}
+		for _, b := range buckets {
+			if want, have := b.Count*int64(len(recordA)), b.Bytes; want != have {
+				t.Errorf("%s: want %d bytes, have %d", b.Start, want, have)
+			}
+			starts = append(starts, b.Start.Format(time.RFC3339Nano))
+			counts = append(counts, b.Count)
+		}
+		return starts, counts
+	}
+
+	// From A to I, by the minute, whatever the limit: A B, C D, E F G, H I.
+	var (
+		from = "01BB6RQR190000000000000000" // A
+		to   = "01BB6RXQ090000000000000000" // I
+	)
+	starts, have := counts(query(from, to, "&histogram=1m&limit=1", http.StatusOK))
+	if want := []string{
+		"2017-03-14T15:59:40.585Z",
+		"2017-03-14T16:00:40.585Z",
+		"2017-03-14T16:01:40.585Z",
+		"2017-03-14T16:02:40.585Z",
+	}; !reflect.DeepEqual(want, starts) {
+		t.Errorf("starts: want %v, have %v", want, starts)
+	}
+	if want := []int64{2, 2, 3, 2}; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+
+	// The filter applies.
+	if _, have := counts(query(from, to, "&histogram=1m&regex&q="+url.QueryEscape("^(A|C|I) "), http.StatusOK)); !reflect.DeepEqual([]int64{1, 1, 0, 1}, have) {
+		t.Errorf("filtered: want %v, have %v", []int64{1, 1, 0, 1}, have)
+	}
+
+	// An empty range has no buckets.
+	if want, have := "[]", strings.TrimSpace(string(query(from, from, "&histogram=1m", http.StatusOK))); want != have {
+		t.Errorf("empty range: want %s, have %s", want, have)
+	}
+
+	// Bad bucket durations.
+	for _, params := range []string{"&histogram=1us", "&histogram=nope", "&histogram=1ms"} {
+		query(from, to, params, http.StatusBadRequest)
+	}
+}
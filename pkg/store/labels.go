@@ -0,0 +1,183 @@
+package store
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+// extLabels is the extension of the file stored alongside each segment with
+// its origins: the labels of the ingest nodes its records came from, one
+// node's labels, encoded by cluster.Labels, per line. Like the bloom filter,
+// it shares the segment's basename. Segments whose records came from nodes
+// without labels don't have one.
+//
+// Segments from several ingest nodes, or compacted from several segments,
+// have several origins. They match a label query if any of their origins
+// does, so label queries prune segments, but don't filter records: records
+// from other nodes in a matching segment are returned, too.
+const extLabels = ".labels"
+
+// ImportedOrigin is the origin of segments imported from an archive, rather
+// than ingested. Like any origin, it's kept by compaction, and it can be
+// queried, as the label oklog.imported:true. Retention policies skip imported
+// segments, unless they're told otherwise.
+const ImportedOrigin = "oklog.imported=true"
+
+// isImported reports whether the origins include ImportedOrigin.
+func isImported(origins []string) bool {
+	for _, origin := range origins {
+		if origin == ImportedOrigin {
+			return true
+		}
+	}
+	return false
+}
+
+// writeOrigins to path, unless there are none, and sync them, like the
+// segment. Partially written files are removed.
+func writeOrigins(filesys fs.Filesystem, path string, origins []string) error {
+	if len(origins) == 0 {
+		return nil
+	}
+	f, err := filesys.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte(strings.Join(origins, "\n") + "\n")); err != nil {
+		f.Close()
+		filesys.Remove(path)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		filesys.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		filesys.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// readOrigins from path. For a segment without origins, the error satisfies
+// os.IsNotExist.
+func readOrigins(filesys fs.Filesystem, path string) ([]string, error) {
+	f, err := filesys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var origins []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			origins = append(origins, line)
+		}
+	}
+	return origins, s.Err()
+}
+
+// mergeOrigins returns the distinct, non-empty origins, sorted.
+func mergeOrigins(sets ...[]string) []string {
+	seen := map[string]bool{}
+	for _, origins := range sets {
+		for _, origin := range origins {
+			seen[origin] = origin != ""
+		}
+	}
+	var merged []string
+	for origin, ok := range seen {
+		if ok {
+			merged = append(merged, origin)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// labelMatcher selects the records ingested by nodes with a label, given as
+// key:value in queries.
+type labelMatcher struct {
+	key, value string
+}
+
+func parseLabelMatcher(s string) (labelMatcher, error) {
+	fields := strings.SplitN(s, ":", 2)
+	if len(fields) != 2 {
+		return labelMatcher{}, errors.Errorf("label %q: want key:value", s)
+	}
+	if err := cluster.ValidateLabel(fields[0], fields[1]); err != nil {
+		return labelMatcher{}, err
+	}
+	return labelMatcher{fields[0], fields[1]}, nil
+}
+
+// originsMatch reports whether any of the origins has the labels of every
+// matcher. Origins that can't be parsed don't match.
+func originsMatch(origins []string, matchers []labelMatcher) bool {
+	for _, origin := range origins {
+		labels, err := cluster.ParseLabels(origin)
+		if err != nil {
+			continue
+		}
+		match := true
+		for _, m := range matchers {
+			if labels[m.key] != m.value {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// isImported reports whether the segment at path was imported, i.e. whether
+// its origins, if they can be read, include ImportedOrigin.
+func (fl *fileLog) isImported(path string) bool {
+	origins, _ := readOrigins(fl.filesys, modifyExtension(path, extLabels))
+	return isImported(origins)
+}
+
+// matchesLabels returns false if the origins of the segment at path rule out
+// the matchers. Segments without origins match no labels at all. Segments
+// whose origins can't be read may match anything.
+func (fl *fileLog) matchesLabels(path string, matchers []labelMatcher) bool {
+	origins, err := readOrigins(fl.queryFilesys, modifyExtension(path, extLabels))
+	switch {
+	case os.IsNotExist(err):
+		return false
+	case err != nil:
+		fl.reporter.ReportEvent(Event{
+			Op: "queryMatchingSegments", File: path, Warning: err,
+			Msg: "failed to read segment labels, so querying it regardless",
+		})
+		return true
+	}
+	return originsMatch(origins, matchers)
+}
+
+// originLog stamps every segment it creates with the given origins.
+type originLog struct {
+	Log
+	origins []string
+}
+
+func (l originLog) Create() (WriteSegment, error) {
+	w, err := l.Log.Create()
+	if err != nil {
+		return nil, err
+	}
+	w.SetOrigins(l.origins)
+	return w, nil
+}
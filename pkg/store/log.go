@@ -1,11 +1,14 @@
 package store
 
 import (
+	"context"
 	"errors"
 	"io"
 	"time"
 
 	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/fs"
 )
 
 // Log is an abstraction for segments on a storage node.
@@ -13,8 +16,9 @@ type Log interface {
 	// Create a new segment for writes.
 	Create() (WriteSegment, error)
 
-	// Query written and closed segments.
-	Query(qp QueryParams, statsOnly bool) (QueryResult, error)
+	// Query written and closed segments. Reading the records stops with an
+	// error when the context is canceled.
+	Query(ctx context.Context, qp QueryParams, statsOnly bool) (QueryResult, error)
 
 	// Overlapping returns segments that have a high degree of time overlap and
 	// can be compacted.
@@ -24,15 +28,64 @@ type Log interface {
 	// compacted.
 	Sequential() ([]ReadSegment, error)
 
+	// Compactable returns the segments the planner chooses to compact, of
+	// the flushed segments. Overlapping and Sequential are Compactable with
+	// the default planners.
+	Compactable(planner CompactionPlanner) ([]ReadSegment, error)
+
 	// Trashable segments are read segments whose newest record is older than
 	// the given time. They may be trashed, i.e. made unavailable for querying.
-	Trashable(oldestRecord time.Time) ([]ReadSegment, error)
+	// Imported segments are only included if imported is true.
+	Trashable(oldestRecord time.Time, imported bool) ([]ReadSegment, error)
+
+	// TrashableBySize segments are the oldest read segments that must be
+	// trashed for all segments, except those already trashed, to fit within
+	// the given number of bytes. Segments being compacted are never included.
+	// Imported segments count toward the bytes, but are only included if
+	// imported is true.
+	TrashableBySize(maxBytes int64, imported bool) ([]ReadSegment, error)
 
 	// Purgable segments are trash segments whose modification time (i.e. the
 	// time they were trashed) is older than the given time. They may be purged,
 	// i.e. hard deleted.
 	Purgeable(oldestModTime time.Time) ([]TrashSegment, error)
 
+	// Trashed returns the segments in the trash, ordered by their oldest
+	// record.
+	Trashed() ([]TrashedSegment, error)
+
+	// Restore the named trashed segment, making it available for querying
+	// again, as a flushed segment. It returns ErrSegmentNotFound if there's
+	// no such segment in the trash.
+	Restore(segment string) error
+
+	// Sealed returns the flushed segments overlapping the range from one
+	// ULID to another, ordered by their oldest record, with their sizes and
+	// checksums as stored, i.e. possibly compressed, but decrypted. Every one
+	// is read.
+	Sealed(from, to ulid.ULID) ([]SealedSegment, error)
+
+	// Queryable returns the names of the segments a query of the range from
+	// one ULID to another would consider, ordered by their oldest record.
+	// None is read.
+	Queryable(from, to ulid.ULID) ([]string, error)
+
+	// OpenSealed opens the named flushed segment, to read it as stored, but
+	// decrypted. It returns ErrSegmentNotFound if there's no such segment.
+	OpenSealed(segment string) (fs.File, error)
+
+	// OpenVerified opens the named flushed segment, to read its records as a
+	// query would: decrypted, decompressed, and verified against its
+	// checksums, if it has them. Unlike a query, it leaves a corrupt segment
+	// where it is; reads just fail with errCorruptSegment. It returns
+	// ErrSegmentNotFound if there's no such segment.
+	OpenVerified(segment string) (fs.File, error)
+
+	// Quarantine the named flushed segment, as if it had failed checksum
+	// verification, so it's neither queried nor compacted. It returns
+	// ErrSegmentNotFound if there's no such segment.
+	Quarantine(segment string) error
+
 	// Stats of the current state of the store log.
 	Stats() (LogStats, error)
 
@@ -44,17 +97,29 @@ type Log interface {
 // indicate no qualifying segments are currently available.
 var ErrNoSegmentsAvailable = errors.New("no segments available")
 
+// ErrSegmentNotFound is returned when the named segment doesn't exist.
+var ErrSegmentNotFound = errors.New("segment not found")
+
 // WriteSegment can be written to, and either closed or deleted.
+// Before it's closed, it may be given the origins of its records: the labels
+// of the ingest nodes they came from, encoded by cluster.Labels. And it may be
+// set compacted, as the segments written by compaction are, which the log
+// may store compressed.
 type WriteSegment interface {
 	io.Writer
+	SetOrigins(origins []string)
+	SetCompacted()
 	Close(low, high ulid.ULID) error
 	Delete() error
 }
 
 // ReadSegment can be read from, reset (back to flushed state), trashed (made
-// unavailable for queries), or purged (hard deleted).
+// unavailable for queries), or purged (hard deleted). Its origins are those it
+// was written with, if any.
 type ReadSegment interface {
 	io.Reader
+	Name() string
+	Origins() []string
 	Reset() error
 	Trash() error
 	Purge() error
@@ -65,6 +130,24 @@ type TrashSegment interface {
 	Purge() error
 }
 
+// TrashedSegment describes a segment in the trash. Its name is the ULIDs of
+// its oldest and newest records, joined by a dash.
+type TrashedSegment struct {
+	Name      string
+	Size      int64 // on disk
+	Low, High ulid.ULID
+	Trashed   time.Time
+}
+
+// SealedSegment describes a flushed segment, as stored, but decrypted. Like a
+// trashed segment, its name is the ULIDs of its oldest and newest records.
+type SealedSegment struct {
+	Name      string
+	Size      int64 // on disk, unless encrypted
+	Low, High ulid.ULID
+	Checksum  uint32 // CRC-32C of the bytes on disk, decrypted
+}
+
 // LogStats describe the current state of the store log.
 type LogStats struct {
 	ActiveSegments  int64
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// QueryMetrics tracks how long user queries take, and how streaming queries
+// fare with clients that can't keep up. A nil *QueryMetrics is valid, and
+// records nothing.
+type QueryMetrics struct {
+	duration  *prometheus.HistogramVec
+	lifetime  prometheus.Histogram
+	dropped   prometheus.Histogram
+	evictions *prometheus.CounterVec
+}
+
+// querySizes are the upper bounds of the result size label of bounded query
+// durations, in records. A query for a few records and one for millions take
+// very different times, so a single histogram of both says little about
+// either.
+var querySizes = []int64{0, 100, 10000, 1000000}
+
+// streamLifetimeBuckets are the histogram buckets, in seconds, of streaming
+// query lifetimes, which run from a one-off tail to a dashboard left open.
+var streamLifetimeBuckets = []float64{1, 10, 60, 300, 900, 3600, 4 * 3600, 24 * 3600}
+
+// streamDroppedBuckets are the histogram buckets of the records dropped per
+// streaming query connection, as its client couldn't keep up; most drop none.
+var streamDroppedBuckets = []float64{0, 1, 10, 100, 1000, 10000, 100000}
+
+// NewQueryMetrics returns query metrics registered with r, whose bounded
+// query durations have the given buckets, in seconds. If r is nil,
+// NewQueryMetrics returns nil, and no metrics are recorded.
+func NewQueryMetrics(r prometheus.Registerer, buckets []float64) *QueryMetrics {
+	if r == nil {
+		return nil
+	}
+	m := &QueryMetrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "oklog",
+			Name:      "store_query_duration_seconds",
+			Help:      "Duration of bounded user queries, by the most records they could have returned (size).",
+			Buckets:   buckets,
+		}, []string{"size"}),
+		lifetime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "oklog",
+			Name:      "store_stream_duration_seconds",
+			Help:      "Lifetime of the connections of streaming and live user queries.",
+			Buckets:   streamLifetimeBuckets,
+		}),
+		dropped: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "oklog",
+			Name:      "store_stream_dropped_records",
+			Help:      "Records dropped per user streaming query connection, as its client couldn't keep up.",
+			Buckets:   streamDroppedBuckets,
+		}),
+		evictions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "store_stream_evictions_total",
+			Help:      "Streaming query connections closed as their clients couldn't keep up, by stream, user or internal.",
+		}, []string{"stream"}),
+	}
+	r.MustRegister(m.duration, m.lifetime, m.dropped, m.evictions)
+	return m
+}
+
+// observe the user query e, once it's done.
+func (m *QueryMetrics) observe(e AuditEvent, bounded bool) {
+	if m == nil {
+		return
+	}
+	if !bounded {
+		m.lifetime.Observe(e.Duration.Seconds())
+		return
+	}
+	m.duration.WithLabelValues(querySize(e.Records)).Observe(e.Duration.Seconds())
+}
+
+// streamDone records the records a user streaming query connection dropped,
+// once it's done. Internal streams don't drop records; see StreamLimits.
+func (m *QueryMetrics) streamDone(drop bool, dropped int64) {
+	if m == nil || !drop {
+		return
+	}
+	m.dropped.Observe(float64(dropped))
+}
+
+// streamEvicted counts a streaming query connection that was evicted: a user
+// stream, if drop is true, or else an internal one.
+func (m *QueryMetrics) streamEvicted(drop bool) {
+	if m == nil {
+		return
+	}
+	stream := "internal"
+	if drop {
+		stream = "user"
+	}
+	m.evictions.WithLabelValues(stream).Inc()
+}
+
+// querySize returns the result size label of a bounded query that returned
+// n records: the least of querySizes no less than n, or +Inf.
+func querySize(n int64) string {
+	for _, size := range querySizes {
+		if n <= size {
+			return strconv.FormatInt(size, 10)
+		}
+	}
+	return "+Inf"
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestQueryMetricsObserve(t *testing.T) {
+	t.Parallel()
+
+	buckets := []float64{.001, .025, .05, 1, 30}
+	for _, testcase := range []struct {
+		name     string
+		event    AuditEvent
+		bounded  bool
+		metric   string
+		label    string
+		bucket   float64 // the least bucket the observation lands in
+		previous float64 // and the one before it
+	}{
+		{"empty", AuditEvent{Records: 0, Duration: 40 * time.Millisecond}, true, "oklog_store_query_duration_seconds", "0", .05, .025},
+		{"small", AuditEvent{Records: 100, Duration: 500 * time.Microsecond}, true, "oklog_store_query_duration_seconds", "100", .001, 0},
+		{"medium", AuditEvent{Records: 101, Duration: 2 * time.Second}, true, "oklog_store_query_duration_seconds", "10000", 30, 1},
+		{"huge", AuditEvent{Records: 5000000, Duration: 20 * time.Second}, true, "oklog_store_query_duration_seconds", "+Inf", 30, 1},
+		{"stream", AuditEvent{Records: 5, Duration: 90 * time.Second}, false, "oklog_store_stream_duration_seconds", "", 300, 60},
+	} {
+		reg := prometheus.NewRegistry()
+		NewQueryMetrics(reg, buckets).observe(testcase.event, testcase.bounded)
+		h := gatherHistogram(t, reg, testcase.metric, testcase.label)
+		if want, have := uint64(1), h.GetSampleCount(); want != have {
+			t.Errorf("%s: want %d observation, have %d", testcase.name, want, have)
+		}
+		if want, have := uint64(1), bucketCount(h, testcase.bucket); want != have {
+			t.Errorf("%s: want %d observation under %gs, have %d", testcase.name, want, testcase.bucket, have)
+		}
+		if want, have := uint64(0), bucketCount(h, testcase.previous); testcase.previous > 0 && want != have {
+			t.Errorf("%s: want %d observations under %gs, have %d", testcase.name, want, testcase.previous, have)
+		}
+	}
+}
+
+func TestNewQueryMetricsNil(t *testing.T) {
+	t.Parallel()
+
+	m := NewQueryMetrics(nil, nil)
+	if m != nil {
+		t.Fatalf("want nil, have %+v", m)
+	}
+	m.observe(AuditEvent{}, true) // records nothing
+}
+
+func TestAPIQueryMetrics(t *testing.T) {
+	t.Parallel()
+
+	backend, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer backend.Close()
+	for _, segment := range segments {
+		w := httptest.NewRecorder()
+		backend.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(segment)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+	}
+	front, frontServer := newStreamFixture(t, staticPeer{strings.TrimPrefix(server.URL, "http://")})
+	defer frontServer.Close()
+	defer front.Close()
+	reg := prometheus.NewRegistry()
+	front.queryMetrics = NewQueryMetrics(reg, []float64{.001, 1, 30})
+
+	// Bounded queries are observed by the records they return.
+	bounds := "from=01BB6RQR190000000000000000&to=01BB6RXQ090000000000000000"
+	for _, params := range []string{bounds + "&q=A", bounds + "&q=B", bounds + "&q=nope"} {
+		w := httptest.NewRecorder()
+		front.ServeHTTP(w, httptest.NewRequest("GET", APIPathUserQuery+"?"+params, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: HTTP %d: %s", params, w.Code, w.Body.String())
+		}
+	}
+	for _, testcase := range []struct {
+		size  string
+		count uint64
+	}{
+		{"0", 1},
+		{"100", 2},
+	} {
+		h := gatherHistogram(t, reg, "oklog_store_query_duration_seconds", testcase.size)
+		if want, have := testcase.count, h.GetSampleCount(); want != have {
+			t.Errorf("size %s: want %d observations, have %d", testcase.size, want, have)
+		}
+		if want, have := testcase.count, bucketCount(h, 30); want != have {
+			t.Errorf("size %s: want %d observations under 30s, have %d", testcase.size, want, have)
+		}
+	}
+
+	// Streams are observed once they end.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest("GET", frontServer.URL+"/store"+APIPathUserStream+"?window=10ms&q=A", nil)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	waitForStreamQueries(t, backend, 1)
+	if h := gatherHistogram(t, reg, "oklog_store_stream_duration_seconds", ""); h.GetSampleCount() != 0 {
+		t.Errorf("stream observed before it ended")
+	}
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for gatherHistogram(t, reg, "oklog_store_stream_duration_seconds", "").GetSampleCount() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the stream to be observed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if want, have := uint64(1), bucketCount(gatherHistogram(t, reg, "oklog_store_stream_duration_seconds", ""), 1); want != have {
+		t.Errorf("want %d stream under 1s, have %d", want, have)
+	}
+}
+
+// gatherHistogram returns the histogram name from g, with the label value,
+// if it has a label.
+func gatherHistogram(t *testing.T, g prometheus.Gatherer, name, label string) *dto.Histogram {
+	t.Helper()
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if len(m.GetLabel()) == 0 && label == "" || len(m.GetLabel()) > 0 && m.GetLabel()[0].GetValue() == label {
+				return m.GetHistogram()
+			}
+		}
+	}
+	t.Fatalf("no histogram %s{%s}", name, label)
+	return nil
+}
+
+// bucketCount returns the cumulative count of the bucket of h with the upper
+// bound le.
+func bucketCount(h *dto.Histogram, le float64) uint64 {
+	for _, b := range h.GetBucket() {
+		if b.GetUpperBound() == le {
+			return b.GetCumulativeCount()
+		}
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/oklog/ulid"
+)
+
+// annotateOrigin is the value of the annotate query param that annotates each
+// record with its origin: the store node, and the segment, it was read from.
+const annotateOrigin = "origin"
+
+// originToken returns the annotation of records read by the node from the
+// segment, by name, e.g. "[node=store-2:7650 seg=01F...-01F...]".
+func originToken(node, segment string) []byte {
+	return []byte(fmt.Sprintf("[node=%s seg=%s]", node, segment))
+}
+
+// annotate writes the record to buf with the origin token after its ULID, and
+// the space after that. Records without a ULID are written as they are.
+func annotate(buf *bytes.Buffer, record, token []byte) {
+	if len(record) <= ulid.EncodedSize || record[ulid.EncodedSize] != ' ' {
+		buf.Write(record)
+		return
+	}
+	buf.Write(record[:ulid.EncodedSize+1])
+	buf.Write(token)
+	buf.WriteByte(' ')
+	buf.Write(record[ulid.EncodedSize+1:])
+}
+
+// splitOrigin splits what's after the ULID of an annotated record into the
+// origin token, without brackets, and the rest. If rest doesn't start with a
+// token, origin is nil, and rest is as it was.
+func splitOrigin(rest []byte) (origin, record []byte) {
+	if !bytes.HasPrefix(rest, []byte("[node=")) {
+		return nil, rest
+	}
+	end := bytes.IndexByte(rest, ']')
+	if end < 0 {
+		return nil, rest
+	}
+	origin, record = rest[1:end], rest[end+1:]
+	if len(record) > 0 && record[0] == ' ' {
+		record = record[1:]
+	}
+	return origin, record
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// placeReplicas orders peers by preference for the segment with the given key.
+// Replicas should go to the first peers in the order. Peers with distinct
+// zones come first, so the first N peers span as many zones as possible; zones
+// map peers to their zone, and peers without one share the empty zone.
+func placeReplicas(peers []string, zones map[string]string, key []byte) []string {
+	return spreadZones(rankPeers(peers, key), zones, nil)
+}
+
+// rankPeers orders peers by rendezvous hashing. Each key prefers a different
+// order, which spreads segments evenly over the cluster, but the order for a
+// given key is stable, and changes little as peers come and go.
+func rankPeers(peers []string, key []byte) []string {
+	type scored struct {
+		peer  string
+		score uint64
+	}
+	s := make([]scored, len(peers))
+	for i, peer := range peers {
+		h := fnv.New64a()
+		h.Write(key)
+		h.Write([]byte(peer))
+		s[i] = scored{peer, h.Sum64()}
+	}
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].score != s[j].score {
+			return s[i].score > s[j].score
+		}
+		return s[i].peer < s[j].peer
+	})
+	ranked := make([]string, len(s))
+	for i := range s {
+		ranked[i] = s[i].peer
+	}
+	return ranked
+}
+
+// spreadZones reorders ranked peers in rounds, taking the best ranked peer of
+// each zone per round, so that zones are used evenly. Zones of the taken peers,
+// which already hold a replica, are skipped in the first round.
+func spreadZones(ranked []string, zones map[string]string, taken []string) []string {
+	var (
+		ordered = make([]string, 0, len(ranked))
+		used    = map[string]bool{}
+		placed  = make([]bool, len(ranked))
+	)
+	for _, peer := range taken {
+		used[zones[peer]] = true
+	}
+	for len(ordered) < len(ranked) {
+		for i, peer := range ranked {
+			if placed[i] || used[zones[peer]] {
+				continue
+			}
+			ordered = append(ordered, peer)
+			placed[i] = true
+			used[zones[peer]] = true
+		}
+		used = map[string]bool{} // next round
+	}
+	return ordered
+}
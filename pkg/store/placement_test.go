@@ -0,0 +1,101 @@
+package store
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid"
+)
+
+func TestPlaceReplicas(t *testing.T) {
+	t.Parallel()
+
+	peers := []string{"a:7650", "b:7650", "c:7650", "d:7650", "e:7650"}
+	first := map[string]int{}
+	for i := 0; i < 5000; i++ {
+		key := []byte(ulid.MustNew(uint64(i), nil).String())
+		placed := placeReplicas(peers, nil, key)
+		if want, have := len(peers), len(placed); want != have {
+			t.Fatalf("want %d peers, have %d", want, have)
+		}
+		if want, have := placed, placeReplicas(peers, nil, key); !reflect.DeepEqual(want, have) {
+			t.Fatalf("placement isn't stable: %v, then %v", want, have)
+		}
+		first[placed[0]]++
+	}
+
+	// Each peer should be the first choice for about a fifth of segments.
+	for _, peer := range peers {
+		if have := first[peer]; have < 800 || have > 1200 {
+			t.Errorf("%s: first choice for %d of 5000 segments", peer, have)
+		}
+	}
+}
+
+func TestPlaceReplicasByZone(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name  string
+		zones map[string]string
+		want  int // distinct zones among the first 3 peers
+	}{
+		{
+			name:  "no zones",
+			zones: map[string]string{},
+			want:  1,
+		},
+		{
+			name:  "two zones",
+			zones: map[string]string{"a:1": "x", "b:1": "x", "c:1": "x", "d:1": "y", "e:1": "y", "f:1": "y"},
+			want:  2,
+		},
+		{
+			name:  "three zones",
+			zones: map[string]string{"a:1": "x", "b:1": "x", "c:1": "y", "d:1": "y", "e:1": "z", "f:1": "z"},
+			want:  3,
+		},
+		{
+			name:  "three zones, uneven",
+			zones: map[string]string{"a:1": "x", "b:1": "x", "c:1": "x", "d:1": "x", "e:1": "y", "f:1": "z"},
+			want:  3,
+		},
+		{
+			name:  "some peers without zones",
+			zones: map[string]string{"a:1": "x", "b:1": "x", "c:1": "x", "d:1": "x"},
+			want:  2,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			peers := []string{"a:1", "b:1", "c:1", "d:1", "e:1", "f:1"}
+			for i := 0; i < 100; i++ {
+				key := []byte(ulid.MustNew(uint64(i), nil).String())
+				placed := placeReplicas(peers, testcase.zones, key)
+				if want, have := len(peers), len(placed); want != have {
+					t.Fatalf("want %d peers, have %d (%v)", want, have, placed)
+				}
+				distinct := map[string]bool{}
+				for _, peer := range placed[:3] {
+					distinct[testcase.zones[peer]] = true
+				}
+				if want, have := testcase.want, len(distinct); want != have {
+					t.Fatalf("%v: want %d zones, have %d", placed[:3], want, have)
+				}
+			}
+		})
+	}
+}
+
+func TestSpreadZonesSkipsTakenZones(t *testing.T) {
+	t.Parallel()
+
+	var (
+		zones  = map[string]string{"a:1": "x", "b:1": "x", "c:1": "y", "d:1": "z", "e:1": "y"}
+		ranked = []string{"b:1", "e:1", "d:1"}
+		taken  = []string{"a:1", "c:1"} // x and y already hold a replica
+	)
+	if want, have := "d:1,b:1,e:1", strings.Join(spreadZones(ranked, zones, taken), ","); want != have {
+		t.Errorf("want %s, have %s", want, have)
+	}
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"sort"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// QueryPlanner plans user queries, so that each segment is read by only one
+// of the store nodes holding a replica of it, rather than all of them. Each
+// node is first asked which segments it holds in the range of the query; its
+// coverage. Then every segment is assigned to one of its holders, preferring
+// those in the same zone as the planning node, and spreading the rest.
+//
+// Nodes compact their segments independently, so a record may be in
+// segments of different names on different nodes, and be read more than
+// once. Those duplicates are dropped by the merge, as without a plan.
+type QueryPlanner struct {
+	zone      string
+	fallbacks prometheus.Counter
+}
+
+// NewQueryPlanner returns a QueryPlanner for nodes in zone, which may be
+// empty. The segments planned again, on other replicas, because the node
+// they were planned on failed, are counted by fallbacks.
+func NewQueryPlanner(zone string, fallbacks prometheus.Counter) *QueryPlanner {
+	return &QueryPlanner{zone: zone, fallbacks: fallbacks}
+}
+
+// coverage maps store nodes to the names of the segments they hold.
+type coverage map[string][]string
+
+// queryPlan maps store nodes to the names of the segments they're to read.
+type queryPlan map[string][]string
+
+// plan assigns each of the segments to one of the nodes of the coverage
+// holding it, except for failed nodes. Segments without such a node are
+// returned as lost.
+func (p *QueryPlanner) plan(cov coverage, zones map[string]string, failed map[string]bool, segments []string) (plan queryPlan, lost []string) {
+	holders := map[string][]string{}
+	for node, held := range cov {
+		if failed[node] {
+			continue
+		}
+		for _, segment := range held {
+			holders[segment] = append(holders[segment], node)
+		}
+	}
+
+	// Assign the segments in order, for a stable plan, each to the least
+	// loaded of its preferred holders. Ties go to the first by rendezvous
+	// hashing, so they're spread over the holders, too.
+	sorted := append([]string(nil), segments...)
+	sort.Strings(sorted)
+	var (
+		load = map[string]int{}
+		near []string
+	)
+	plan = queryPlan{}
+	for _, segment := range sorted {
+		candidates := holders[segment]
+		if len(candidates) == 0 {
+			lost = append(lost, segment)
+			continue
+		}
+		near = near[:0]
+		for _, node := range candidates {
+			if p.zone != "" && zones[node] == p.zone {
+				near = append(near, node)
+			}
+		}
+		if len(near) > 0 {
+			candidates = near
+		}
+		var chosen string
+		for _, node := range rankPeers(candidates, []byte(segment)) {
+			if chosen == "" || load[node] < load[chosen] {
+				chosen = node
+			}
+		}
+		load[chosen]++
+		plan[chosen] = append(plan[chosen], segment)
+	}
+	return plan, lost
+}
+
+// segments of the coverage, each once.
+func (cov coverage) segments() []string {
+	var (
+		seen     = map[string]bool{}
+		segments []string
+	)
+	for _, held := range cov {
+		for _, segment := range held {
+			if !seen[segment] {
+				seen[segment] = true
+				segments = append(segments, segment)
+			}
+		}
+	}
+	return segments
+}
+
+// plannedPaths returns the paths of the named segments, of those given, in
+// order. A segment that's been compacted since it was planned is replaced by
+// the segments overlapping its range, which hold its records, along with
+// others, which are deduplicated.
+func plannedPaths(paths []string, names []string) []string {
+	var (
+		planned = make(map[string]bool, len(names))
+		found   = map[string]bool{}
+		missing [][2]ulid.ULID
+	)
+	for _, name := range names {
+		planned[name] = true
+	}
+	for _, path := range paths {
+		if name := basename(path); planned[name] {
+			found[name] = true
+		}
+	}
+	for _, name := range names {
+		if found[name] {
+			continue
+		}
+		if low, high, err := parseFilename(name); err == nil {
+			missing = append(missing, [2]ulid.ULID{low, high})
+		}
+	}
+
+	var selected []string
+	for _, path := range paths {
+		if planned[basename(path)] {
+			selected = append(selected, path)
+			continue
+		}
+		low, high, err := parseFilename(path)
+		if err != nil {
+			continue
+		}
+		for _, m := range missing {
+			if low.Compare(m[1]) <= 0 && high.Compare(m[0]) >= 0 {
+				selected = append(selected, path)
+				break
+			}
+		}
+	}
+	return selected
+}
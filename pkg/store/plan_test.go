@@ -0,0 +1,211 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestQueryPlanner(t *testing.T) {
+	t.Parallel()
+
+	var (
+		cov = coverage{
+			"a": {"s1", "s2", "s3", "s4"},
+			"b": {"s1", "s2", "s3", "s4"},
+			"c": {"s3", "s4"},
+		}
+		zones = map[string]string{"a": "z1", "b": "z2", "c": "z1"}
+	)
+	for _, testcase := range []struct {
+		name    string
+		zone    string
+		failed  map[string]bool
+		holders map[string][]string // of each planned segment, any of
+		lost    []string
+	}{
+		{
+			name:    "anywhere",
+			holders: map[string][]string{"s1": {"a", "b"}, "s2": {"a", "b"}, "s3": {"a", "b", "c"}, "s4": {"a", "b", "c"}},
+		},
+		{
+			name:    "nearest",
+			zone:    "z1",
+			holders: map[string][]string{"s1": {"a"}, "s2": {"a"}, "s3": {"a", "c"}, "s4": {"a", "c"}},
+		},
+		{
+			name:    "nearest failed",
+			zone:    "z1",
+			failed:  map[string]bool{"a": true},
+			holders: map[string][]string{"s1": {"b"}, "s2": {"b"}, "s3": {"c"}, "s4": {"c"}},
+		},
+		{
+			name:    "lost",
+			failed:  map[string]bool{"a": true, "b": true},
+			holders: map[string][]string{"s3": {"c"}, "s4": {"c"}},
+			lost:    []string{"s1", "s2"},
+		},
+	} {
+		p := NewQueryPlanner(testcase.zone, prometheus.NewCounter(prometheus.CounterOpts{}))
+		plan, lost := p.plan(cov, zones, testcase.failed, cov.segments())
+		if want, have := testcase.lost, lost; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want lost %v, have %v", testcase.name, want, have)
+		}
+
+		// Every segment is planned once, on one of its holders, and none is
+		// planned on a node with more than its share.
+		planned := map[string]string{}
+		for node, segments := range plan {
+			if len(segments) > 2 {
+				t.Errorf("%s: %s: want at most 2 segments, have %v", testcase.name, node, segments)
+			}
+			for _, segment := range segments {
+				if other, ok := planned[segment]; ok {
+					t.Errorf("%s: %s: planned on both %s and %s", testcase.name, segment, other, node)
+				}
+				planned[segment] = node
+			}
+		}
+		if want, have := len(testcase.holders), len(planned); want != have {
+			t.Errorf("%s: want %d segments planned, have %d (%v)", testcase.name, want, have, plan)
+		}
+		for segment, holders := range testcase.holders {
+			node, ok := planned[segment], false
+			for _, holder := range holders {
+				ok = ok || holder == node
+			}
+			if !ok {
+				t.Errorf("%s: %s: want one of %v, have %q", testcase.name, segment, holders, node)
+			}
+		}
+		if again, _ := p.plan(cov, zones, testcase.failed, cov.segments()); !reflect.DeepEqual(plan, again) {
+			t.Errorf("%s: plan isn't stable: %v, then %v", testcase.name, plan, again)
+		}
+	}
+}
+
+func TestPlannedPaths(t *testing.T) {
+	t.Parallel()
+
+	name := func(low, high uint64) string {
+		return fmt.Sprintf("%s-%s", ulid.MustNew(low, nil), ulid.MustNew(high, nil))
+	}
+	paths := []string{
+		"/" + name(100, 199) + extFlushed,
+		"/" + name(200, 399) + extFlushed, // compacted from 200-299 and 300-399
+		"/" + name(400, 499) + extFlushed,
+	}
+	for _, testcase := range []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{"none", []string{}, nil},
+		{"some", []string{name(400, 499), name(100, 199)}, []string{paths[0], paths[2]}},
+		{"compacted", []string{name(300, 399)}, []string{paths[1]}},
+		{"gone", []string{name(500, 599)}, nil},
+	} {
+		if want, have := testcase.want, plannedPaths(paths, testcase.names); !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %v, have %v", testcase.name, want, have)
+		}
+	}
+}
+
+func TestAPIUserQueryPlanned(t *testing.T) {
+	t.Parallel()
+
+	// Three store nodes, with two replicas of each of three segments.
+	var (
+		addrs   []string
+		failing string
+	)
+	for i, held := range [][]string{
+		{segments[0], segments[1]},
+		{segments[1], segments[2]},
+		{segments[0], segments[2]},
+	} {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		for _, segment := range held {
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(segment)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+			}
+		}
+		addrs = append(addrs, strings.TrimPrefix(server.URL, "http://"))
+
+		// The last node lists its coverage, but fails every query.
+		if i == 2 {
+			broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, APIPathInternalQuery) {
+					http.Error(w, "broken", http.StatusInternalServerError)
+					return
+				}
+				http.StripPrefix("/store", a).ServeHTTP(w, r)
+			}))
+			defer broken.Close()
+			failing = strings.TrimPrefix(broken.URL, "http://")
+		}
+	}
+
+	for _, testcase := range []struct {
+		name      string
+		addrs     []string
+		fallbacks bool
+	}{
+		{"healthy", addrs, false},
+		{"failing", []string{addrs[0], addrs[1], failing}, true},
+	} {
+		front, server := newStreamFixture(t, staticPeer(testcase.addrs))
+		defer server.Close()
+		defer front.Close()
+		fallbacks := prometheus.NewCounter(prometheus.CounterOpts{})
+		front.planner = NewQueryPlanner("", fallbacks)
+
+		resp, err := http.Get(fmt.Sprintf(
+			"%s/store%s?from=%s&to=%s",
+			server.URL,
+			APIPathUserQuery,
+			"01BB6RQR190000000000000000", // A
+			"01BB6RXQ090000000000000000", // I
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var qr QueryResult
+		if err := qr.DecodeFrom(resp); err != nil {
+			t.Fatal(err)
+		}
+		page, _ := ioutil.ReadAll(qr.Records)
+		qr.Records.Close()
+
+		// Each segment is read once, so there's nothing to deduplicate.
+		if want, have := segments[0]+segments[1]+segments[2], string(page); want != have {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+		if want, have := 0, qr.ErrorCount; want != have {
+			t.Errorf("%s: want %d errors, have %d", testcase.name, want, have)
+		}
+		if want, have := int64(9), qr.Stats.RecordsScanned; want != have {
+			t.Errorf("%s: want %d records scanned, have %d", testcase.name, want, have)
+		}
+		if want, have := int64(0), qr.Stats.RecordsDeduplicated; want != have {
+			t.Errorf("%s: want %d records deduplicated, have %d", testcase.name, want, have)
+		}
+		var m dto.Metric
+		fallbacks.Write(&m)
+		if want, have := testcase.fallbacks, m.GetCounter().GetValue() > 0; want != have {
+			t.Errorf("%s: want fallbacks %v, have %v", testcase.name, want, have)
+		}
+	}
+}
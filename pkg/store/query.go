@@ -1,18 +1,27 @@
 package store
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/ulidutil"
 )
 
 // QueryParams defines all dimensions of a query.
@@ -22,28 +31,168 @@ type QueryParams struct {
 	To    ulidOrTime `json:"to"`
 	Q     string     `json:"q"`
 	Regex bool       `json:"regex"`
+	Topic string     `json:"topic,omitempty"`
+
+	// Labels, as key:value, select records ingested by nodes with all of
+	// them. See extLabels for how precise that is.
+	Labels []string `json:"labels,omitempty"`
+
+	// Limit the number of records returned, if positive. Further pages are
+	// fetched by passing the Continue token of the QueryResult back.
+	Limit    int    `json:"limit,omitempty"`
+	Continue string `json:"continue,omitempty"`
+
+	// Backward queries return records newest first.
+	Backward bool `json:"backward,omitempty"`
+
+	// Sample, if positive, is the fraction of matching records returned,
+	// as chosen by recordFilterSample.
+	Sample float64 `json:"sample,omitempty"`
+
+	// Extract returns only what the capture groups of a Regex matched in
+	// each record, tab-separated, after its ULID; see extractReadCloser.
+	Extract bool `json:"extract,omitempty"`
+
+	// Annotate each record, after its ULID, with its origin: the store node,
+	// and the segment, it was read from; see originToken.
+	Annotate bool `json:"annotate,omitempty"`
+
+	// Segments, if not nil, are the only segments queried, by name, as
+	// planned by a QueryPlanner. They're sent in the body of the request.
+	Segments []string `json:"-"`
+
+	// maxSegments, if positive, is the most segments read; see QueryLimits.
+	// It's the node's own limit, not a parameter.
+	maxSegments int
+
+	// node is the address this node is queried by, which records are
+	// annotated with, and pages continue its segments by. It's not a
+	// parameter, either.
+	node string
 }
 
 // DecodeFrom populates a QueryParams from a URL.
 func (qp *QueryParams) DecodeFrom(u *url.URL, rb rangeBehavior) error {
-	if err := qp.From.Parse(u.Query().Get("from")); err != nil && rb == rangeRequired {
+	// Resolve relative times against the same instant.
+	now := time.Now()
+	if err := qp.From.parse(u.Query().Get("from"), now); err != nil && rb == rangeRequired {
 		return errors.Wrap(err, "parsing 'from'")
 	}
-	if err := qp.To.Parse(u.Query().Get("to")); err != nil && rb == rangeRequired {
+	if err := qp.To.parse(u.Query().Get("to"), now); err != nil && rb == rangeRequired {
 		return errors.Wrap(err, "parsing 'to'")
 	}
+	if rb == rangeRequired && qp.From.ULID.Time() > qp.To.ULID.Time() {
+		return errors.Errorf(
+			"'from' (%s) is after 'to' (%s)",
+			qp.From.Format(time.RFC3339Nano), qp.To.Format(time.RFC3339Nano),
+		)
+	}
 	qp.Q = u.Query().Get("q")
 	_, qp.Regex = u.Query()["regex"]
+	qp.Topic = u.Query().Get("topic")
+
+	if qp.Topic != "" && !record.IsValidTopic([]byte(qp.Topic)) {
+		return errors.Wrap(record.ErrIllegalTopicName, "parsing 'topic'")
+	}
+
+	qp.Labels = u.Query()["label"]
+	for _, s := range qp.Labels {
+		if _, err := parseLabelMatcher(s); err != nil {
+			return errors.Wrap(err, "parsing 'label'")
+		}
+	}
+
+	if s := u.Query().Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 0 {
+			return errors.Errorf("parsing 'limit': %q isn't a non-negative integer", s)
+		}
+		qp.Limit = limit
+	}
+	qp.Continue = u.Query().Get("continue")
+	if _, _, err := qp.continuation(); err != nil {
+		return errors.Wrap(err, "parsing 'continue'")
+	}
+
+	switch direction := u.Query().Get("direction"); direction {
+	case "", "forward":
+		qp.Backward = false
+	case "backward":
+		qp.Backward = true
+	default:
+		return errors.Errorf("parsing 'direction': %q isn't forward or backward", direction)
+	}
+
+	if s := u.Query().Get("sample"); s != "" {
+		sample, err := strconv.ParseFloat(s, 64)
+		if err != nil || !(sample > 0 && sample <= 1) {
+			return errors.Errorf("parsing 'sample': %q isn't a fraction greater than 0, and at most 1", s)
+		}
+		qp.Sample = sample
+	}
+
+	if s := u.Query().Get("extract"); s != "" {
+		extract, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.Wrap(err, "parsing 'extract'")
+		}
+		qp.Extract = extract
+	}
+
+	switch annotate := u.Query().Get("annotate"); annotate {
+	case "":
+		qp.Annotate = false
+	case annotateOrigin:
+		qp.Annotate = true
+	default:
+		return errors.Errorf("parsing 'annotate': %q isn't %s", annotate, annotateOrigin)
+	}
 
 	if qp.Regex {
-		if _, err := regexp.Compile(qp.Q); err != nil {
+		re, err := regexp.Compile(qp.Q)
+		if err != nil {
 			return errors.Wrap(err, "compiling regex")
 		}
+		if qp.Extract && re.NumSubexp() == 0 {
+			return errors.New("parsing 'extract': the regex has no capture groups")
+		}
+	} else if qp.Extract {
+		return errors.New("parsing 'extract': only regex queries can extract")
 	}
 
 	return nil
 }
 
+// after returns the ULID encoded in the continuation token, if any.
+// Only records with greater ULIDs belong to the requested page, or with lesser
+// ULIDs, for backward queries.
+func (qp *QueryParams) continuation() (c continuation, ok bool, err error) {
+	if qp.Continue == "" {
+		return c, false, nil
+	}
+	c, err = decodeContinuation(qp.Continue)
+	return c, err == nil, err
+}
+
+// labelMatchers returns the parsed Labels, which DecodeFrom validated.
+func (qp *QueryParams) labelMatchers() []labelMatcher {
+	var matchers []labelMatcher
+	for _, s := range qp.Labels {
+		if m, err := parseLabelMatcher(s); err == nil {
+			matchers = append(matchers, m)
+		}
+	}
+	return matchers
+}
+
+// order returns the order that records are returned in.
+func (qp *QueryParams) order() recordOrder {
+	if qp.Backward {
+		return orderDescending
+	}
+	return orderAscending
+}
+
 type rangeBehavior int
 
 const (
@@ -52,7 +201,7 @@ const (
 )
 
 // ulidOrTime is how we interpret the From and To query params.
-// Users may specify a valid ULID, or an RFC3339Nano timestamp.
+// Users may specify a valid ULID, or any time accepted by ParseTime.
 // We prefer them in that order, and cross-populate the fields.
 type ulidOrTime struct {
 	ulid.ULID
@@ -60,26 +209,68 @@ type ulidOrTime struct {
 }
 
 // Parse a string, likely taken from a query param.
+// Relative times are resolved against the current time.
 func (ut *ulidOrTime) Parse(s string) error {
+	return ut.parse(s, time.Now())
+}
+
+func (ut *ulidOrTime) parse(s string, now time.Time) error {
 	if id, err := ulid.Parse(s); err == nil {
 		ut.ULID = id
-		var (
-			msec = id.Time()
-			sec  = int64(msec / 1000)
-			nsec = int64(msec%1000) * 1000000
-		)
-		ut.Time = time.Unix(sec, nsec).UTC()
+		ut.Time = ulidutil.TimeOf(id)
 		return nil
 	}
+	t, err := ParseTime(s, now)
+	if err != nil {
+		return err
+	}
+	// Pass t.UTC to mirror ulid.Now, which does the same.
+	// (We use ulid.Now when generating ULIDs in the ingester.)
+	ms, err := ulidutil.Timestamp(t.UTC())
+	if err != nil {
+		return err
+	}
+	ut.ULID = ulidutil.Min(ms)
+	ut.Time = t
+	return nil
+}
+
+// epochMillisThreshold separates unix epoch seconds from milliseconds.
+// 1e12 seconds is tens of thousands of years away, and 1e12 milliseconds
+// was in 2001, well before any record we might store.
+const epochMillisThreshold = 1e12
+
+// ParseTime parses a point in time as given by a user, in order of preference:
+//
+//	now, now-15m, -15m, +1h   relative to now, with any time.ParseDuration
+//	2017-03-14T15:59:40Z      RFC3339, optionally with fractional seconds
+//	1489507180, 1489507180123 unix epoch seconds, or milliseconds if ≥ 1e12
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	switch rel := strings.TrimPrefix(strings.ToLower(s), "now"); {
+	case s == "":
+		return time.Time{}, errors.New("empty time")
+	case rel == "":
+		return now, nil
+	case rel[0] == '-' || rel[0] == '+':
+		d, err := time.ParseDuration(rel)
+		if err != nil {
+			return time.Time{}, errors.Errorf("%s: can't parse relative time: %v", s, err)
+		}
+		return now.Add(d), nil
+	}
 	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
-		ut.ULID.SetEntropy(nil)
-		// Pass t.UTC to mirror ulid.Now, which does the same.
-		// (We use ulid.Now when generating ULIDs in the ingester.)
-		ut.ULID.SetTime(ulid.Timestamp(t.UTC()))
-		ut.Time = t
-		return nil
+		return t, nil
 	}
-	return errors.Errorf("%s: can't parse as ULID or RFC3339 time", s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n >= 0 {
+		if n >= epochMillisThreshold {
+			return time.Unix(n/1e3, (n%1e3)*1e6).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+	return time.Time{}, errors.Errorf(
+		"%s: can't parse as ULID, RFC3339 time, unix epoch seconds or milliseconds, "+
+			"or relative time like now, now-15m or -15m", s,
+	)
 }
 
 // QueryResult contains statistics about, and matching records for, a query.
@@ -92,36 +283,403 @@ type QueryResult struct {
 	ErrorCount      int    `json:"error_count,omitempty"`
 	Duration        string `json:"duration"`
 
-	Records io.ReadCloser // TODO(pb): audit to ensure closing is valid throughout
+	// Continue is set if the query was limited and more records may follow.
+	// Pass it as a query parameter to fetch the next page.
+	Continue string `json:"continue,omitempty"`
+
+	// Truncated is the limit that cut the records short, if one did; see
+	// QueryLimits. Continue is set, too, to read past it.
+	Truncated string `json:"truncated,omitempty"`
+
+	// ColdSegments is how many of the segments queried were fetched from the
+	// cold tier, which makes for slower queries; see ColdTier.
+	ColdSegments int `json:"cold_segments,omitempty"`
+
+	// Watermark is the cluster's replication watermark, as the query was
+	// taken: every record before it is in the stores, and so in the results,
+	// but records after it may yet be on their way. It's nil if it's unknown.
+	// See Fresh.
+	Watermark *time.Time `json:"watermark,omitempty"`
+
+	// Stats are only complete once the records are read, see QueryStats.
+	Stats *QueryStats `json:"stats,omitempty"`
+
+	Records io.ReadCloser `json:"-"` // TODO(pb): audit to ensure closing is valid throughout
+
+	// scanned is the continuation of the segments a node's page read, and
+	// where from, for the page that follows a user query's to read on from.
+	scanned string
+}
+
+// QueryStats break down the work done for a query. Counts are summed over all
+// store nodes; durations are of the slowest node, as nodes work concurrently.
+//
+// Records are read lazily, as they're written to the response, so the stats
+// are only complete after that. They are sent as an HTTP trailer, or for
+// statistics queries, without records, as a header.
+type QueryStats struct {
+	RecordsScanned      int64 `json:"records_scanned"`
+	RecordsMatched      int64 `json:"records_matched"`
+	RecordsDeduplicated int64 `json:"records_deduplicated"`
+	BytesRead           int64 `json:"bytes_read"` // uncompressed
+
+	// RecordsEstimated is, for sampled queries, the number of records that
+	// would have been returned without sampling, as estimated from those that
+	// were. It's derived by the node taking the query, so it isn't merged.
+	RecordsEstimated int64 `json:"records_estimated,omitempty"`
+
+	SegmentsConsidered int `json:"segments_considered"`
+	SegmentsPruned     int `json:"segments_pruned"`   // by time range
+	SegmentsFiltered   int `json:"segments_filtered"` // by bloom filter, or labels
+
+	// Wall time per phase: choosing segments, reading and filtering them,
+	// and merging the results of all nodes. Duplicates are dropped as part
+	// of the merge, so there's no separate time for that.
+	PlanDuration  time.Duration `json:"plan_duration_ns"`
+	ReadDuration  time.Duration `json:"read_duration_ns"`
+	MergeDuration time.Duration `json:"merge_duration_ns"`
+}
+
+// merge the stats of another node into these.
+func (s *QueryStats) merge(other QueryStats) {
+	s.RecordsScanned += other.RecordsScanned
+	s.RecordsMatched += other.RecordsMatched
+	s.RecordsDeduplicated += other.RecordsDeduplicated
+	s.BytesRead += other.BytesRead
+	s.SegmentsConsidered += other.SegmentsConsidered
+	s.SegmentsPruned += other.SegmentsPruned
+	s.SegmentsFiltered += other.SegmentsFiltered
+	if other.PlanDuration > s.PlanDuration {
+		s.PlanDuration = other.PlanDuration
+	}
+	if other.ReadDuration > s.ReadDuration {
+		s.ReadDuration = other.ReadDuration
+	}
+	if other.MergeDuration > s.MergeDuration {
+		s.MergeDuration = other.MergeDuration
+	}
+}
+
+// queryCounters are updated concurrently while records are read, and are
+// copied to QueryStats when reading is done.
+type queryCounters struct {
+	scanned, matched, deduplicated, bytes int64 // atomic
+}
+
+func (c *queryCounters) copyTo(s *QueryStats) {
+	s.RecordsScanned = atomic.LoadInt64(&c.scanned)
+	s.RecordsMatched = atomic.LoadInt64(&c.matched)
+	s.RecordsDeduplicated = atomic.LoadInt64(&c.deduplicated)
+	s.BytesRead = atomic.LoadInt64(&c.bytes)
+}
+
+// finishReadCloser calls finish once, when the reader is drained or closed,
+// whichever comes first.
+type finishReadCloser struct {
+	io.ReadCloser
+	finish func()
+	once   sync.Once
+}
+
+func newFinishReadCloser(rc io.ReadCloser, finish func()) io.ReadCloser {
+	return &finishReadCloser{ReadCloser: rc, finish: finish}
+}
+
+func (rc *finishReadCloser) Read(p []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(p)
+	if err == io.EOF {
+		rc.once.Do(rc.finish)
+	}
+	return n, err
+}
+
+func (rc *finishReadCloser) Close() error {
+	err := rc.ReadCloser.Close()
+	rc.once.Do(rc.finish)
+	return err
+}
+
+// extractReadCloser replaces each record with what the capture groups of re
+// matched in it, joined by tabs, after its ULID, and origin token, if it's
+// annotated, so only they are sent back. Groups that matched nothing, or didn't take part in the match, are empty
+// fields. The records must have matched re already.
+type extractReadCloser struct {
+	rc  io.ReadCloser
+	s   *bufio.Scanner
+	re  *regexp.Regexp
+	buf bytes.Buffer
+}
+
+func newExtractReadCloser(rc io.ReadCloser, re *regexp.Regexp) io.ReadCloser {
+	s := record.NewScanner(rc)
+	s.Split(scanLinesPreserveNewline)
+	return &extractReadCloser{rc: rc, s: s, re: re}
+}
+
+func (rc *extractReadCloser) Read(p []byte) (int, error) {
+	for rc.buf.Len() < len(p) && rc.s.Scan() {
+		line := rc.s.Bytes()
+		if len(line) <= ulid.EncodedSize {
+			continue
+		}
+		rc.buf.Write(line[:ulid.EncodedSize+1])
+		origin, rest := splitOrigin(line[ulid.EncodedSize+1:])
+		if origin != nil {
+			rc.buf.Write(line[ulid.EncodedSize+1 : len(line)-len(rest)]) // keep it
+		}
+		// Matched as the filter matched it, newline and all.
+		for i, group := range rc.re.FindSubmatch(rest)[1:] {
+			if i > 0 {
+				rc.buf.WriteByte('\t')
+			}
+			rc.buf.Write(bytes.TrimSuffix(group, []byte{'\n'}))
+		}
+		rc.buf.WriteByte('\n')
+	}
+	if rc.buf.Len() > 0 {
+		return rc.buf.Read(p)
+	}
+	if err := rc.s.Err(); err != nil {
+		return 0, err
+	}
+	return 0, io.EOF
+}
+
+func (rc *extractReadCloser) Close() error {
+	return rc.rc.Close()
+}
+
+// statsTrailerReadCloser reads the body of a query response, and decodes the
+// stats trailer once the body is drained. Closing it early drains what's left
+// of a small body, e.g. a page of records, so its stats aren't lost. If the
+// records were cut short, reading them fails at the end of the body.
+type statsTrailerReadCloser struct {
+	resp   *http.Response
+	result *QueryResult
+	done   bool
+}
+
+// maxStatsDrain is how much of a body we'll read and discard, for its stats.
+const maxStatsDrain = 1024 * 1024
+
+func (rc *statsTrailerReadCloser) Read(p []byte) (int, error) {
+	n, err := rc.resp.Body.Read(p)
+	if err == io.EOF && !rc.done {
+		rc.done = true
+		if s := rc.resp.Trailer.Get(httpHeaderStats); s != "" {
+			json.Unmarshal([]byte(s), rc.result.Stats) // best effort
+		}
+		if s := rc.resp.Trailer.Get(httpHeaderTruncated); s != "" {
+			rc.result.Truncated = s
+			rc.result.Continue = rc.resp.Trailer.Get(httpHeaderContinue)
+		}
+		if s := rc.resp.Trailer.Get(httpHeaderPartial); s != "" {
+			return n, errors.Errorf("partial results: %s", s)
+		}
+	}
+	return n, err
+}
+
+func (rc *statsTrailerReadCloser) Close() error {
+	if !rc.done {
+		io.Copy(ioutil.Discard, io.LimitReader(rc, maxStatsDrain))
+	}
+	return rc.resp.Body.Close()
 }
 
 // EncodeTo encodes the QueryResult to the HTTP response writer.
 // It also closes the records ReadCloser.
 func (qr *QueryResult) EncodeTo(w http.ResponseWriter) {
+	qr.encodeHeaders(w)
+	if qr.ErrorCount > 0 {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	if qr.Records != nil {
+		// CopyBuffer can be useful for complex query pipelines.
+		// TODO(pb): validate the 1MB buffer size with profiling
+		buf := make([]byte, 1024*1024)
+		_, err := io.CopyBuffer(w, qr.Records, buf)
+		qr.Records.Close()
+		qr.encodeTrailers(w, err)
+	}
+}
+
+// EncodeJSONTo encodes the QueryResult to the HTTP response writer as JSON.
+// Records are newline-delimited JSON objects, see jsonRecord. Without records,
+// i.e. for statistics queries, the body is the QueryResult as a JSON object.
+// The headers are the same as EncodeTo's, either way.
+// It also closes the records ReadCloser.
+func (qr *QueryResult) EncodeJSONTo(w http.ResponseWriter) {
+	qr.encodeHeaders(w)
+	if qr.Records == nil {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	}
+	if qr.ErrorCount > 0 {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	if qr.Records == nil {
+		buf, err := json.MarshalIndent(qr, "", "    ")
+		if err != nil {
+			panic(err) // QueryResult always marshals
+		}
+		w.Write(append(buf, '\n'))
+		return
+	}
+	err := encodeRecordsJSON(w, qr.Records)
+	qr.Records.Close()
+	qr.encodeTrailers(w, err)
+}
+
+func (qr *QueryResult) encodeHeaders(w http.ResponseWriter) {
 	w.Header().Set(httpHeaderFrom, qr.Params.From.Format(time.RFC3339))
 	w.Header().Set(httpHeaderTo, qr.Params.To.Format(time.RFC3339))
 	w.Header().Set(httpHeaderQ, qr.Params.Q)
 	w.Header().Set(httpHeaderRegex, fmt.Sprint(qr.Params.Regex))
+	w.Header().Set(httpHeaderTopic, qr.Params.Topic)
 
 	w.Header().Set(httpHeaderNodesQueried, strconv.Itoa(qr.NodesQueried))
 	w.Header().Set(httpHeaderSegmentsQueried, strconv.Itoa(qr.SegmentsQueried))
 	w.Header().Set(httpHeaderMaxDataSetSize, strconv.FormatInt(qr.MaxDataSetSize, 10))
 	w.Header().Set(httpHeaderErrorCount, strconv.Itoa(qr.ErrorCount))
 	w.Header().Set(httpHeaderDuration, qr.Duration)
-
-	if qr.ErrorCount > 0 {
-		w.WriteHeader(http.StatusPartialContent)
+	if qr.Continue != "" {
+		w.Header().Set(httpHeaderContinue, qr.Continue)
+	}
+	if qr.Truncated != "" {
+		w.Header().Set(httpHeaderTruncated, qr.Truncated)
+	}
+	if qr.Params.Sample > 0 {
+		w.Header().Set(httpHeaderSample, strconv.FormatFloat(qr.Params.Sample, 'g', -1, 64))
+	}
+	if qr.ColdSegments > 0 {
+		w.Header().Set(httpHeaderColdSegments, strconv.Itoa(qr.ColdSegments))
+	}
+	if qr.scanned != "" {
+		w.Header().Set(httpHeaderScanned, qr.scanned)
+	}
+	if qr.Watermark != nil {
+		w.Header().Set(httpHeaderWatermark, qr.Watermark.UTC().Format(time.RFC3339Nano))
 	}
 
+	// Records are read as they're written, so their stats come after.
+	switch {
+	case qr.Stats == nil:
+	case qr.Records == nil:
+		qr.estimate()
+		w.Header().Set(httpHeaderStats, qr.Stats.encode())
+	default:
+		w.Header().Set("Trailer", httpHeaderStats)
+	}
 	if qr.Records != nil {
-		// CopyBuffer can be useful for complex query pipelines.
-		// TODO(pb): validate the 1MB buffer size with profiling
-		buf := make([]byte, 1024*1024)
-		io.CopyBuffer(w, qr.Records, buf)
-		qr.Records.Close()
+		w.Header().Add("Trailer", httpHeaderPartial)
+	}
+	if qr.Records != nil && qr.Continue == "" {
+		// Records may yet be truncated as they're written.
+		w.Header().Add("Trailer", httpHeaderTruncated)
+		w.Header().Add("Trailer", httpHeaderContinue)
 	}
 }
 
+// encodeTrailers sets the trailers declared by encodeHeaders, once the
+// records are written, or failed to be, with err, e.g. as the query timed
+// out, so the records are partial.
+func (qr *QueryResult) encodeTrailers(w http.ResponseWriter, err error) {
+	if qr.Stats != nil {
+		qr.estimate()
+		w.Header().Set(httpHeaderStats, qr.Stats.encode())
+	}
+	if err != nil {
+		w.Header().Set(httpHeaderPartial, err.Error())
+	}
+	if qr.Truncated != "" {
+		w.Header().Set(httpHeaderTruncated, qr.Truncated)
+		w.Header().Set(httpHeaderContinue, qr.Continue)
+	}
+}
+
+// Fresh returns whether the results are sure to include every record up to
+// the end of the query's range, i.e. the watermark is after it. A decoded end
+// is to the second, and so may be up to a second early, which Fresh allows
+// for, erring on the side of stale.
+func (qr *QueryResult) Fresh() bool {
+	to := qr.Params.To.Time
+	if to.Nanosecond() == 0 {
+		to = to.Add(time.Second - time.Nanosecond)
+	}
+	return qr.Watermark != nil && qr.Watermark.After(to)
+}
+
+// estimate the records of a sampled query, from its complete stats.
+func (qr *QueryResult) estimate() {
+	if qr.Params.Sample > 0 {
+		qr.Stats.RecordsEstimated = estimateRecords(qr.Stats.RecordsMatched-qr.Stats.RecordsDeduplicated, qr.Params.Sample)
+	}
+}
+
+// estimateRecords is how many records n sampled records stand for.
+func estimateRecords(n int64, sample float64) int64 {
+	return int64(math.Round(float64(n) / sample))
+}
+
+func (s *QueryStats) encode() string {
+	buf, err := json.Marshal(s)
+	if err != nil {
+		panic(err) // QueryStats always marshals
+	}
+	return string(buf)
+}
+
+// jsonRecord is the JSON encoding of one record. Time is derived from the
+// ULID, and Record is everything after the ULID, as in plain text results,
+// but for the origin token of annotated records, which is Origin.
+// JSON strings must be valid UTF-8, so invalid bytes in records are replaced
+// by the Unicode replacement character, U+FFFD.
+type jsonRecord struct {
+	ULID   string `json:"ulid"`
+	Time   string `json:"time"`
+	Topic  string `json:"topic"`
+	Record string `json:"record"`
+	Origin string `json:"origin,omitempty"`
+}
+
+// encodeRecordsJSON writes each record from r as a jsonRecord, one per line.
+func encodeRecordsJSON(w io.Writer, r io.Reader) error {
+	var (
+		enc = json.NewEncoder(w)
+		s   = record.NewScanner(r)
+	)
+	enc.SetEscapeHTML(false)
+	s.Split(scanLinesPreserveNewline) // ScanLines would drop trailing \r
+	for s.Scan() {
+		b := bytes.TrimSuffix(s.Bytes(), []byte{'\n'})
+		if len(b) < ulid.EncodedSize {
+			continue // heartbeat, or garbage
+		}
+		id, err := ulid.Parse(string(b[:ulid.EncodedSize]))
+		if err != nil {
+			return errors.Wrap(err, "parsing record ULID")
+		}
+		var origin, rest []byte
+		if len(b) > ulid.EncodedSize+1 {
+			origin, rest = splitOrigin(b[ulid.EncodedSize+1:])
+		}
+		if err := enc.Encode(jsonRecord{
+			ULID:   id.String(),
+			Time:   ulidutil.TimeOf(id).Format(time.RFC3339Nano),
+			Topic:  string(record.Topic(rest)),
+			Record: string(record.Unescape(rest)),
+			Origin: string(origin),
+		}); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
 // DecodeFrom decodes the QueryResult from the HTTP response.
 func (qr *QueryResult) DecodeFrom(resp *http.Response) error {
 	var err error
@@ -135,6 +693,7 @@ func (qr *QueryResult) DecodeFrom(resp *http.Response) error {
 	if qr.Params.Regex, err = strconv.ParseBool(resp.Header.Get(httpHeaderRegex)); err != nil {
 		return errors.Wrap(err, "regex")
 	}
+	qr.Params.Topic = resp.Header.Get(httpHeaderTopic)
 	if qr.NodesQueried, err = strconv.Atoi(resp.Header.Get(httpHeaderNodesQueried)); err != nil {
 		return errors.Wrap(err, "nodes queried")
 	}
@@ -148,7 +707,33 @@ func (qr *QueryResult) DecodeFrom(resp *http.Response) error {
 		return errors.Wrap(err, "error count")
 	}
 	qr.Duration = resp.Header.Get(httpHeaderDuration)
-	qr.Records = resp.Body
+	qr.Continue = resp.Header.Get(httpHeaderContinue)
+	qr.Truncated = resp.Header.Get(httpHeaderTruncated)
+	if s := resp.Header.Get(httpHeaderSample); s != "" {
+		if qr.Params.Sample, err = strconv.ParseFloat(s, 64); err != nil {
+			return errors.Wrap(err, "sample")
+		}
+	}
+	if s := resp.Header.Get(httpHeaderColdSegments); s != "" {
+		if qr.ColdSegments, err = strconv.Atoi(s); err != nil {
+			return errors.Wrap(err, "cold segments")
+		}
+	}
+	qr.scanned = resp.Header.Get(httpHeaderScanned)
+	if s := resp.Header.Get(httpHeaderWatermark); s != "" {
+		watermark, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return errors.Wrap(err, "watermark")
+		}
+		qr.Watermark = &watermark
+	}
+	qr.Stats = &QueryStats{}
+	if s := resp.Header.Get(httpHeaderStats); s != "" {
+		if err = json.Unmarshal([]byte(s), qr.Stats); err != nil {
+			return errors.Wrap(err, "stats")
+		}
+	}
+	qr.Records = &statsTrailerReadCloser{resp: resp, result: qr}
 	return nil
 }
 
@@ -161,6 +746,7 @@ func (qr *QueryResult) Merge(other QueryResult) error {
 		qr.MaxDataSetSize = other.MaxDataSetSize
 	}
 	qr.ErrorCount += other.ErrorCount
+	qr.ColdSegments += other.ColdSegments
 
 	// Merge the record readers.
 	// Both mergeRecords and multiCloser can handle nils.
@@ -178,9 +764,91 @@ const (
 	httpHeaderTo              = "X-Oklog-To"
 	httpHeaderQ               = "X-Oklog-Q"
 	httpHeaderRegex           = "X-Oklog-Regex"
+	httpHeaderTopic           = "X-Oklog-Topic"
 	httpHeaderNodesQueried    = "X-Oklog-Nodes-Queried"
 	httpHeaderSegmentsQueried = "X-Oklog-Segments-Queried"
 	httpHeaderMaxDataSetSize  = "X-Oklog-Max-Data-Set-Size"
 	httpHeaderErrorCount      = "X-Oklog-Error-Count"
 	httpHeaderDuration        = "X-Oklog-Duration"
+	httpHeaderContinue        = "X-Oklog-Continue"
+	httpHeaderTruncated       = "X-Oklog-Truncated"
+	httpHeaderSample          = "X-Oklog-Sample"
+	httpHeaderSampleEstimate  = "X-Oklog-Sample-Estimate" // trailer of sampled streams
+	httpHeaderStats           = "X-Oklog-Stats"
+	httpHeaderPartial         = "X-Oklog-Partial" // trailer of records cut short
+	httpHeaderOrigins         = "X-Oklog-Origins"
+	httpHeaderShip            = "X-Oklog-Ship" // of the replica that ships a segment to the standby
+	httpHeaderTransferOffset  = "X-Oklog-Transfer-Offset"
+	httpHeaderColdSegments    = "X-Oklog-Cold-Segments"
+	httpHeaderScanned         = "X-Oklog-Scanned"
+	httpHeaderWatermark       = "X-Oklog-Watermark"
 )
+
+// encodeContinue returns an opaque continuation token for the page that ends
+// with the given ULID, continuing every segment after it.
+func encodeContinue(last ulid.ULID) string {
+	return continuation{last: last}.encode()
+}
+
+// ContinueToken returns the continuation token of a query that's read the
+// records up to, and including, the given ULID, so a client can resume it
+// after that record, e.g. when its connection fails.
+func ContinueToken(last ulid.ULID) string {
+	return encodeContinue(last)
+}
+
+// decodeContinue returns the last record of the page a token continues.
+func decodeContinue(token string) (id ulid.ULID, err error) {
+	c, err := decodeContinuation(token)
+	return c.last, err
+}
+
+// paginate reads up to limit records from r, which must be in the given order,
+// stopping early after any record with a ULID equal to the cutoff, if one is
+// given. It returns the page, and if more records may follow, a continuation
+// token, of cont, given the last record of the page, or if cont is nil, of the
+// last record alone.
+func paginate(r io.Reader, limit int, cutoff *ulid.ULID, order recordOrder, cont func(last ulid.ULID) string) (page []byte, token string, err error) {
+	var (
+		buf    bytes.Buffer
+		n      int
+		s      = record.NewScanner(r)
+		beyond = beyondCutoff(cutoff, order)
+	)
+	s.Split(scanLinesPreserveNewline)
+	for s.Scan() {
+		record := s.Bytes()
+		if n >= limit || beyond(record) {
+			token, err = continueAfter(buf.Bytes(), cont)
+			return buf.Bytes(), token, err
+		}
+		buf.Write(record)
+		n++
+	}
+	if err := s.Err(); err != nil {
+		return nil, "", err
+	}
+	if cutoff != nil && n > 0 {
+		// The cutoff means some node had more records.
+		token, err = continueAfter(buf.Bytes(), cont)
+		return buf.Bytes(), token, err
+	}
+	return buf.Bytes(), "", nil
+}
+
+// continueAfter returns the continuation token for a page of records, of
+// cont, if it's given.
+func continueAfter(page []byte, cont func(last ulid.ULID) string) (string, error) {
+	i := bytes.LastIndexByte(bytes.TrimSuffix(page, []byte{'\n'}), '\n') + 1
+	if len(page)-i < ulid.EncodedSize {
+		return "", errors.New("can't paginate records without ULIDs")
+	}
+	last, err := ulid.Parse(string(page[i : i+ulid.EncodedSize]))
+	if err != nil {
+		return "", err
+	}
+	if cont == nil {
+		return encodeContinue(last), nil
+	}
+	return cont(last), nil
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// QueryCache caches the results of queries of a Log, so the same queries,
+// e.g. those of dashboards, needn't read the same segments again and again.
+//
+// Only queries of sealed ranges are cached, i.e. those which end before the
+// oldest record of the newest segment, so their results rarely change. They
+// still can: replication that's fallen behind, and imports, add segments of
+// older records, and retention, compaction and the like remove segments. So
+// every segment added to or removed from the log drops the cached results
+// whose range it overlaps.
+//
+// Results are cached in full, and the least recently used are evicted, to
+// keep the cache within its size in bytes. A nil QueryCache caches nothing.
+type QueryCache struct {
+	mtx       sync.Mutex
+	maxBytes  int64
+	size      int64
+	lru       *list.List // of *cacheEntry, most recently used first
+	entries   map[string]*list.Element
+	fills     map[*cacheFill]struct{}
+	hits      prometheus.Counter
+	misses    prometheus.Counter
+	evictions prometheus.Counter
+}
+
+// NewQueryCache returns a QueryCache of at most maxBytes of records. Queries
+// of sealed ranges are counted as hits or misses; other queries aren't
+// counted. Results evicted to make room are counted by evictions, but those
+// dropped because their segments changed aren't.
+func NewQueryCache(maxBytes int64, hits, misses, evictions prometheus.Counter) *QueryCache {
+	return &QueryCache{
+		maxBytes:  maxBytes,
+		lru:       list.New(),
+		entries:   map[string]*list.Element{},
+		fills:     map[*cacheFill]struct{}{},
+		hits:      hits,
+		misses:    misses,
+		evictions: evictions,
+	}
+}
+
+type cacheEntry struct {
+	key      string
+	from, to ulid.ULID
+	result   QueryResult // without its Records
+	records  []byte
+}
+
+func (e *cacheEntry) size() int64 {
+	return int64(len(e.key) + len(e.records))
+}
+
+// cacheFill is a query result being read, to be cached once it's read in
+// full, unless a segment it overlaps changes meanwhile.
+type cacheFill struct {
+	key      string
+	from, to ulid.ULID
+	stale    bool
+}
+
+// cacheKey identifies a query by all of its parameters, not just its range
+// and q, as they all change the result.
+func cacheKey(qp QueryParams) string {
+	return fmt.Sprintf(
+		"%s %s %t %q topic=%q labels=%q limit=%d continue=%q backward=%t sample=%g extract=%t annotate=%t node=%q segments=%q max-segments=%d",
+		qp.From.ULID, qp.To.ULID, qp.Regex, qp.Q, qp.Topic, qp.Labels, qp.Limit, qp.Continue, qp.Backward, qp.Sample, qp.Extract, qp.Annotate, qp.node, qp.Segments, qp.maxSegments,
+	)
+}
+
+// lookup the query, whose range must be sealed. It returns the cached result,
+// if there is one, or else a fill, to cache the result with; see filling. It
+// must be called before the query finds its segments, so the fill learns of
+// any that change.
+func (c *QueryCache) lookup(qp QueryParams, begin time.Time) (QueryResult, *cacheFill, bool) {
+	key := cacheKey(qp)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		c.hits.Inc()
+		e := elem.Value.(*cacheEntry)
+		result := e.result
+		if result.Stats != nil {
+			stats := *result.Stats
+			result.Stats = &stats
+		}
+		result.Duration = time.Since(begin).String()
+		result.Records = ioutil.NopCloser(bytes.NewReader(e.records))
+		return result, nil, true
+	}
+	c.misses.Inc()
+	fill := &cacheFill{key: key, from: qp.From.ULID, to: qp.To.ULID}
+	c.fills[fill] = struct{}{}
+	return QueryResult{}, fill, false
+}
+
+// filling returns the records of the result, which caches the result once
+// they're read in full. Results bigger than the cache aren't cached.
+func (c *QueryCache) filling(fill *cacheFill, result QueryResult) io.ReadCloser {
+	return &fillingReadCloser{ReadCloser: result.Records, c: c, fill: fill, result: result}
+}
+
+// end the fill, and cache its result, if it's given, and still valid.
+// A nil fill is ignored.
+func (c *QueryCache) end(fill *cacheFill, result *QueryResult, records []byte) {
+	if fill == nil {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.fills, fill)
+	if result == nil || fill.stale {
+		return
+	}
+	if elem, ok := c.entries[fill.key]; ok {
+		c.remove(elem) // a concurrent fill of the same query
+	}
+	e := &cacheEntry{key: fill.key, from: fill.from, to: fill.to, result: *result, records: records}
+	e.result.Records = nil
+	if result.Stats != nil {
+		stats := *result.Stats
+		e.result.Stats = &stats
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.size += e.size()
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+		c.evictions.Inc()
+	}
+}
+
+// invalidate the results overlapping a segment's range.
+func (c *QueryCache) invalidate(low, high ulid.ULID) {
+	if c == nil {
+		return
+	}
+	overlaps := func(from, to ulid.ULID) bool {
+		return from.Time() <= high.Time() && low.Time() <= to.Time()
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if e := elem.Value.(*cacheEntry); overlaps(e.from, e.to) {
+			c.remove(elem)
+		}
+		elem = next
+	}
+	for fill := range c.fills {
+		if overlaps(fill.from, fill.to) {
+			fill.stale = true
+		}
+	}
+}
+
+// remove must be called with the mutex held.
+func (c *QueryCache) remove(elem *list.Element) {
+	e := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= e.size()
+}
+
+// fillingReadCloser keeps the records read from a query result, and caches
+// the result once they're all read. A result that's closed early, or fails,
+// isn't cached.
+type fillingReadCloser struct {
+	io.ReadCloser
+	c       *QueryCache
+	fill    *cacheFill
+	result  QueryResult
+	records []byte
+	done    bool
+}
+
+func (rc *fillingReadCloser) Read(p []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(p)
+	if rc.done {
+		return n, err
+	}
+	if int64(len(rc.records)+n) > rc.c.maxBytes {
+		rc.finish(false)
+		return n, err
+	}
+	rc.records = append(rc.records, p[:n]...)
+	switch err {
+	case nil:
+	case io.EOF:
+		rc.finish(true)
+	default:
+		rc.finish(false)
+	}
+	return n, err
+}
+
+func (rc *fillingReadCloser) Close() error {
+	rc.finish(false)
+	return rc.ReadCloser.Close()
+}
+
+func (rc *fillingReadCloser) finish(ok bool) {
+	if rc.done {
+		return
+	}
+	rc.done = true
+	if !ok {
+		rc.c.end(rc.fill, nil, nil)
+		return
+	}
+	rc.c.end(rc.fill, &rc.result, rc.records)
+	rc.records = nil
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestQueryCache(t *testing.T) {
+	t.Parallel()
+
+	var (
+		hits      = prometheus.NewCounter(prometheus.CounterOpts{})
+		misses    = prometheus.NewCounter(prometheus.CounterOpts{})
+		evictions = prometheus.NewCounter(prometheus.CounterOpts{})
+		cache     = NewQueryCache(1024*1024, hits, misses, evictions)
+	)
+	filelog, err := NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, FileLogConfig{Cache: cache})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+
+	// Segments a minute apart, of two records each.
+	var (
+		t0      = time.Now().Add(-time.Hour)
+		entropy = rand.New(rand.NewSource(3))
+		mkulid  = func(t time.Time) ulid.ULID { return ulid.MustNew(ulid.Timestamp(t), entropy) }
+		write   = func(ts ...time.Time) {
+			segment, err := filelog.Create()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var low, high ulid.ULID
+			for i, t := range ts {
+				id := mkulid(t)
+				fmt.Fprintf(segment, "%s record %d\n", id, i)
+				if i == 0 {
+					low = id
+				}
+				high = id
+			}
+			if err := segment.Close(low, high); err != nil {
+				t.Fatal(err)
+			}
+		}
+	)
+	for i := 0; i < 3; i++ {
+		begin := t0.Add(time.Duration(i) * time.Minute)
+		write(begin, begin.Add(time.Second))
+	}
+
+	query := func(from, to time.Time) []byte {
+		result, err := filelog.Query(context.Background(), QueryParams{
+			From: ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(from), nil)},
+			To:   ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(to), nil)},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer result.Records.Close()
+		records, err := ioutil.ReadAll(result.Records)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return records
+	}
+	var (
+		sealedFrom, sealedTo = t0.Add(-time.Minute), t0.Add(90 * time.Second) // before the newest segment
+		liveFrom, liveTo     = t0.Add(-time.Minute), time.Now()
+	)
+	checkCounts := func(name string, wantHits, wantMisses float64) {
+		t.Helper()
+		for _, c := range []struct {
+			name string
+			c    prometheus.Counter
+			want float64
+		}{
+			{"hits", hits, wantHits},
+			{"misses", misses, wantMisses},
+			{"evictions", evictions, 0},
+		} {
+			var m dto.Metric
+			c.c.Write(&m)
+			if want, have := c.want, m.GetCounter().GetValue(); want != have {
+				t.Errorf("%s: %s: want %v, have %v", name, c.name, want, have)
+			}
+		}
+	}
+
+	// A sealed range is read once, and then served from the cache, exactly.
+	first := query(sealedFrom, sealedTo)
+	if want, have := 4, bytes.Count(first, []byte{'\n'}); want != have {
+		t.Fatalf("want %d records, have %d (%q)", want, have, first)
+	}
+	if want, have := first, query(sealedFrom, sealedTo); !bytes.Equal(want, have) {
+		t.Errorf("cached: want %q, have %q", want, have)
+	}
+	checkCounts("sealed", 1, 1)
+
+	// Queries touching the live edge are never cached, nor counted.
+	for i := 0; i < 2; i++ {
+		if want, have := 6, bytes.Count(query(liveFrom, liveTo), []byte{'\n'}); want != have {
+			t.Errorf("live edge: want %d records, have %d", want, have)
+		}
+	}
+	checkCounts("live edge", 1, 1)
+
+	// A late segment, in the sealed range, drops the cached result.
+	write(t0.Add(30 * time.Second))
+	if want, have := 5, bytes.Count(query(sealedFrom, sealedTo), []byte{'\n'}); want != have {
+		t.Errorf("after a late segment: want %d records, have %d", want, have)
+	}
+	checkCounts("after a late segment", 1, 2)
+
+	// So does retention.
+	trashable, err := filelog.Trashable(t0.Add(20*time.Second), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 1, len(trashable); want != have {
+		t.Fatalf("want %d trashable segment, have %d", want, have)
+	}
+	if err := trashable[0].Trash(); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 3, bytes.Count(query(sealedFrom, sealedTo), []byte{'\n'}); want != have {
+		t.Errorf("after retention: want %d records, have %d", want, have)
+	}
+	query(sealedFrom, sealedTo)
+	checkCounts("after retention", 2, 3)
+}
+
+func TestQueryCacheEvictions(t *testing.T) {
+	t.Parallel()
+
+	var (
+		hits      = prometheus.NewCounter(prometheus.CounterOpts{})
+		misses    = prometheus.NewCounter(prometheus.CounterOpts{})
+		evictions = prometheus.NewCounter(prometheus.CounterOpts{})
+		from      = ulid.MustNew(1000, nil)
+		to        = ulid.MustNew(2000, nil)
+		records   = bytes.Repeat([]byte("record\n"), 10)
+	)
+	// Room for one result, and a bit.
+	cache := NewQueryCache(int64(len(records)+len(cacheKey(QueryParams{From: ulidOrTime{ULID: from}, To: ulidOrTime{ULID: to}}))+10), hits, misses, evictions)
+	fill := func(q string) bool {
+		qp := QueryParams{From: ulidOrTime{ULID: from}, To: ulidOrTime{ULID: to}, Q: q}
+		_, fill, hit := cache.lookup(qp, time.Now())
+		if hit {
+			return true
+		}
+		rc := cache.filling(fill, QueryResult{Records: ioutil.NopCloser(bytes.NewReader(records))})
+		ioutil.ReadAll(rc)
+		rc.Close()
+		return false
+	}
+
+	for _, testcase := range []struct {
+		q   string
+		hit bool
+	}{
+		{"a", false},
+		{"a", true},
+		{"b", false}, // evicts a
+		{"b", true},
+		{"a", false},
+	} {
+		if want, have := testcase.hit, fill(testcase.q); want != have {
+			t.Errorf("%s: want hit %v, have %v", testcase.q, want, have)
+		}
+	}
+	var m dto.Metric
+	evictions.Write(&m)
+	if want, have := 2.0, m.GetCounter().GetValue(); want != have {
+		t.Errorf("evictions: want %v, have %v", want, have)
+	}
+}
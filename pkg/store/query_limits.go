@@ -0,0 +1,213 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sort"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/record"
+)
+
+// QueryLimits bound the results of each user query, so a careless one, say of
+// everything, can't pull terabytes. Records and Bytes count the records
+// returned, after filtering, so a query matching little isn't limited by how
+// much it scans; that's what the maximum query duration is for. Segments is
+// the most each store node reads, oldest first, or newest, for backward
+// queries. Zero values are unlimited.
+//
+// A query that reaches a limit returns the records up to it, with the limit
+// it reached as Truncated, and a Continue token, to read on, deliberately.
+type QueryLimits struct {
+	Records  int
+	Bytes    int64
+	Segments int
+}
+
+// The limits that truncate query results, as QueryResult.Truncated.
+const (
+	truncatedRecords  = "records"
+	truncatedBytes    = "bytes"
+	truncatedSegments = "segments"
+)
+
+// limitSegments returns the max oldest segments, by their oldest records, or,
+// backward, the max newest, by their newest, in the order they were given,
+// which is by their oldest records. The rest are closed. The records of the
+// segments returned are complete before the bound, backward after it, which
+// is the oldest record of the segments left out, backward the newest.
+func limitSegments(segments []readSegment, max int, backward bool) (limited []readSegment, bound ulid.ULID) {
+	type ranged struct {
+		readSegment
+		low, high ulid.ULID
+		keep      bool
+	}
+	rs := make([]*ranged, len(segments))
+	for i, s := range segments {
+		low, high, _ := parseFilename(s.path) // the index has only valid names
+		rs[i] = &ranged{readSegment: s, low: low, high: high}
+	}
+	order := append([]*ranged(nil), rs...)
+	if backward {
+		sort.SliceStable(order, func(i, j int) bool { return order[i].high.Compare(order[j].high) > 0 })
+	}
+	for i, r := range order {
+		switch {
+		case i < max:
+			r.keep = true
+		case i == max && backward:
+			bound = r.high
+		case i == max:
+			bound = r.low
+		}
+	}
+	for _, r := range rs {
+		if r.keep {
+			limited = append(limited, r.readSegment)
+			continue
+		}
+		r.file.Close()
+	}
+	return limited, bound
+}
+
+// adjacentULID returns the ULID just after id, or, backward, just before it.
+// Continuing after the ULID just before a bound includes the bound.
+func adjacentULID(id ulid.ULID, backward bool) ulid.ULID {
+	for i := len(id) - 1; i >= 0; i-- {
+		if backward {
+			if id[i]--; id[i] != 0xff {
+				break
+			}
+			continue
+		}
+		if id[i]++; id[i] != 0 {
+			break
+		}
+	}
+	return id
+}
+
+// beyondCutoff returns whether records, in the order, are beyond the cutoff,
+// which is the last record some store node returned, while it had more. A nil
+// cutoff is never reached.
+func beyondCutoff(cutoff *ulid.ULID, order recordOrder) func(record []byte) bool {
+	var cut []byte
+	if cutoff != nil {
+		cut, _ = cutoff.MarshalText()
+	}
+	return func(record []byte) bool {
+		if cut == nil || len(record) < ulid.EncodedSize {
+			return false
+		}
+		c := bytes.Compare(record[:ulid.EncodedSize], cut)
+		if order == orderDescending {
+			return c < 0
+		}
+		return c > 0
+	}
+}
+
+// truncatingReadCloser reads the records of a query result up to the limits
+// on records and bytes, if they're positive, and the cutoff, if it's not nil.
+// Once it reaches one, it ends, as if the result did, and sets the Truncated
+// and Continue of the result. A cutoff truncates the result even if there are
+// no records beyond it, as the node it's of had more. A first record over the
+// byte limit is returned anyway, so the query can continue past it. Tokens
+// are of cont, given the last record, or of the last record alone if it's nil.
+type truncatingReadCloser struct {
+	rc         io.ReadCloser
+	s          *bufio.Scanner
+	maxRecords int
+	maxBytes   int64
+	cutoff     *ulid.ULID
+	beyond     func(record []byte) bool
+	cutoffBy   string // the limit the cutoff stands for
+	cont       func(last ulid.ULID) string
+	result     *QueryResult
+	records    int
+	bytes      int64
+	last       []byte // the last record returned
+	rest       []byte // of the last record, to be read
+	done       bool
+}
+
+func newTruncatingReadCloser(rc io.ReadCloser, maxRecords int, maxBytes int64, cutoff *ulid.ULID, cutoffBy string, order recordOrder, cont func(last ulid.ULID) string, result *QueryResult) *truncatingReadCloser {
+	s := record.NewScanner(rc)
+	s.Split(scanLinesPreserveNewline)
+	return &truncatingReadCloser{
+		rc:         rc,
+		s:          s,
+		maxRecords: maxRecords,
+		maxBytes:   maxBytes,
+		cutoff:     cutoff,
+		beyond:     beyondCutoff(cutoff, order),
+		cutoffBy:   cutoffBy,
+		cont:       cont,
+		result:     result,
+	}
+}
+
+func (rc *truncatingReadCloser) Read(p []byte) (int, error) {
+	for len(rc.rest) == 0 {
+		if rc.done {
+			return 0, io.EOF
+		}
+		if !rc.s.Scan() {
+			rc.done = true
+			if err := rc.s.Err(); err != nil {
+				return 0, err
+			}
+			if rc.cutoff != nil {
+				// The node with the cutoff had more records.
+				rc.truncate(rc.cutoffBy, rc.continueFrom(*rc.cutoff))
+			}
+			return 0, io.EOF
+		}
+		record := rc.s.Bytes()
+		switch {
+		case rc.beyond(record):
+			rc.truncate(rc.cutoffBy, rc.continueFrom(*rc.cutoff))
+		case rc.maxRecords > 0 && rc.records >= rc.maxRecords:
+			rc.truncateAfterLast(truncatedRecords)
+		case rc.maxBytes > 0 && rc.records > 0 && rc.bytes+int64(len(record)) > rc.maxBytes:
+			rc.truncateAfterLast(truncatedBytes)
+		default:
+			rc.records++
+			rc.bytes += int64(len(record))
+			rc.last = append(rc.last[:0], record...)
+			rc.rest = rc.last
+		}
+	}
+	n := copy(p, rc.rest)
+	rc.rest = rc.rest[n:]
+	return n, nil
+}
+
+func (rc *truncatingReadCloser) truncateAfterLast(by string) {
+	token, err := continueAfter(rc.last, rc.cont)
+	if err != nil {
+		rc.done = true // records without ULIDs can't be continued
+		return
+	}
+	rc.truncate(by, token)
+}
+
+func (rc *truncatingReadCloser) continueFrom(last ulid.ULID) string {
+	if rc.cont == nil {
+		return encodeContinue(last)
+	}
+	return rc.cont(last)
+}
+
+func (rc *truncatingReadCloser) truncate(by, token string) {
+	rc.done = true
+	rc.result.Truncated = by
+	rc.result.Continue = token
+}
+
+func (rc *truncatingReadCloser) Close() error {
+	return rc.rc.Close()
+}
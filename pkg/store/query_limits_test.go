@@ -0,0 +1,262 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestTruncatingReadCloser(t *testing.T) {
+	t.Parallel()
+
+	idOf := func(record string) ulid.ULID { return ulid.MustParse(record[:ulid.EncodedSize]) }
+	cutoffC := idOf(recordC)
+	for _, testcase := range []struct {
+		name       string
+		maxRecords int
+		maxBytes   int64
+		cutoff     *ulid.ULID
+		want       string
+		truncated  string
+		after      string // the record continued after, if truncated
+	}{
+		{name: "unlimited", want: recordA + recordB + recordC + recordD + recordE},
+		{name: "records", maxRecords: 2, want: recordA + recordB, truncated: truncatedRecords, after: recordB},
+		{name: "records, exactly", maxRecords: 5, want: recordA + recordB + recordC + recordD + recordE},
+		{name: "bytes", maxBytes: int64(len(recordA+recordB+recordC)) - 1, want: recordA + recordB, truncated: truncatedBytes, after: recordB},
+		{name: "bytes, first record", maxBytes: 1, want: recordA, truncated: truncatedBytes, after: recordA},
+		{name: "cutoff", cutoff: &cutoffC, want: recordA + recordB + recordC, truncated: truncatedSegments, after: recordC},
+		{name: "records before cutoff", maxRecords: 1, cutoff: &cutoffC, want: recordA, truncated: truncatedRecords, after: recordA},
+	} {
+		var (
+			result QueryResult
+			rc     = newTruncatingReadCloser(
+				ioutil.NopCloser(strings.NewReader(recordA+recordB+recordC+recordD+recordE)),
+				testcase.maxRecords, testcase.maxBytes, testcase.cutoff, truncatedSegments, orderAscending, nil, &result,
+			)
+		)
+		have, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("%s: %v", testcase.name, err)
+		}
+		if want, have := testcase.want, string(have); want != have {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+		if want, have := testcase.truncated, result.Truncated; want != have {
+			t.Errorf("%s: want truncated %q, have %q", testcase.name, want, have)
+		}
+		var want string
+		if testcase.after != "" {
+			want = encodeContinue(idOf(testcase.after))
+		}
+		if have := result.Continue; want != have {
+			t.Errorf("%s: want continue %q, have %q", testcase.name, want, have)
+		}
+	}
+}
+
+func TestFileLogQueryMaxSegments(t *testing.T) {
+	t.Parallel()
+
+	// Three overlapping segments: A-E, B-C, and D-F.
+	filelog, err := NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+	for _, records := range []string{recordA + recordE, recordB + recordC, recordD + recordF} {
+		segment, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := segment.Write([]byte(records)); err != nil {
+			t.Fatal(err)
+		}
+		if err := segment.Close(ulid.MustParse(records[:ulid.EncodedSize]), ulid.MustParse(records[len(records)/2:][:ulid.EncodedSize])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Queries read at most two segments at a time, page by page.
+	for _, testcase := range []struct {
+		name     string
+		backward bool
+		limit    int
+		want     []string // pages
+		truncs   []string
+	}{
+		{
+			name:   "forward",
+			want:   []string{recordA + recordB + recordC, recordD + recordE + recordF},
+			truncs: []string{truncatedSegments, ""},
+		},
+		{
+			name:     "backward",
+			backward: true,
+			want:     []string{recordF + recordE + recordD, recordC + recordB + recordA},
+			truncs:   []string{truncatedSegments, ""},
+		},
+		{
+			name:   "paged",
+			limit:  2,
+			want:   []string{recordA + recordB, recordC, recordD + recordE, recordF},
+			truncs: []string{"", truncatedSegments, "", ""},
+		},
+	} {
+		var (
+			pages  []string
+			truncs []string
+			token  string
+		)
+		for i := 0; i < 10; i++ {
+			qp := QueryParams{
+				From:        ulidOrTime{ULID: ulid.MustParse(recordA[:ulid.EncodedSize])},
+				To:          ulidOrTime{ULID: ulid.MustParse(recordI[:ulid.EncodedSize])},
+				Limit:       testcase.limit,
+				Continue:    token,
+				Backward:    testcase.backward,
+				maxSegments: 2,
+			}
+			result, err := filelog.Query(context.Background(), qp, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, err := ioutil.ReadAll(result.Records)
+			result.Records.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages, truncs = append(pages, string(page)), append(truncs, result.Truncated)
+			if token = result.Continue; token == "" {
+				break
+			}
+		}
+		if want, have := strings.Join(testcase.want, "|"), strings.Join(pages, "|"); want != have {
+			t.Errorf("%s: want pages\n%s\nhave\n%s", testcase.name, want, have)
+		}
+		if want, have := fmt.Sprint(testcase.truncs), fmt.Sprint(truncs); want != have {
+			t.Errorf("%s: want truncated %s, have %s", testcase.name, want, have)
+		}
+	}
+}
+
+func TestAPIUserQueryLimits(t *testing.T) {
+	t.Parallel()
+
+	// Two store nodes with interleaved records, one of them in three
+	// segments, the other in two.
+	var addrs []string
+	for _, segments := range [][]string{
+		{recordA + recordC, recordE + recordG, recordI},
+		{recordB + recordD, recordF + recordH},
+	} {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		a.limits.Segments = 2
+		for _, segment := range segments {
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(segment)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+			}
+		}
+		addrs = append(addrs, strings.TrimPrefix(server.URL, "http://"))
+	}
+	front, server := newStreamFixture(t, staticPeer(addrs))
+	defer server.Close()
+	defer front.Close()
+
+	// Walk all pages of each query; every record shows up once, in order,
+	// and the pages are truncated by the limits as they're reached.
+	for _, testcase := range []struct {
+		name   string
+		limits QueryLimits
+		limit  int
+		want   []string // pages
+		truncs []string
+	}{
+		{
+			name:   "segments",
+			want:   []string{recordA + recordB + recordC + recordD + recordE + recordF + recordG + recordH, recordI},
+			truncs: []string{truncatedSegments, ""},
+		},
+		{
+			name:   "records",
+			limits: QueryLimits{Records: 4},
+			want:   []string{recordA + recordB + recordC + recordD, recordE + recordF + recordG + recordH, recordI},
+			truncs: []string{truncatedRecords, truncatedRecords, ""},
+		},
+		{
+			name:   "bytes",
+			limits: QueryLimits{Bytes: int64(len(recordA+recordB+recordC)) + 1},
+			want:   []string{recordA + recordB + recordC, recordD + recordE + recordF, recordG + recordH + recordI},
+			truncs: []string{truncatedBytes, truncatedBytes, ""},
+		},
+		{
+			name:   "segments within pages",
+			limit:  9,
+			want:   []string{recordA + recordB + recordC + recordD + recordE + recordF + recordG + recordH, recordI},
+			truncs: []string{truncatedSegments, ""},
+		},
+		{
+			name:   "records within pages",
+			limits: QueryLimits{Records: 2},
+			limit:  3,
+			want:   []string{recordA + recordB, recordC + recordD, recordE + recordF, recordG + recordH, recordI},
+			truncs: []string{truncatedRecords, truncatedRecords, truncatedRecords, truncatedRecords, ""},
+		},
+		{
+			name:   "pages within records",
+			limits: QueryLimits{Records: 3},
+			limit:  3,
+			want:   []string{recordA + recordB + recordC, recordD + recordE + recordF, recordG + recordH + recordI},
+			truncs: []string{"", "", ""},
+		},
+	} {
+		front.limits = testcase.limits
+		var (
+			pages  []string
+			truncs []string
+			token  string
+		)
+		for i := 0; i < 10; i++ {
+			resp, err := http.Get(fmt.Sprintf(
+				"%s/store%s?from=%s&to=%s&limit=%d&continue=%s",
+				server.URL, APIPathUserQuery,
+				recordA[:ulid.EncodedSize], recordI[:ulid.EncodedSize],
+				testcase.limit, token,
+			))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var qr QueryResult
+			if err := qr.DecodeFrom(resp); err != nil {
+				t.Fatal(err)
+			}
+			page, err := ioutil.ReadAll(qr.Records)
+			qr.Records.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages, truncs = append(pages, string(page)), append(truncs, qr.Truncated)
+			if token = qr.Continue; token == "" {
+				break
+			}
+		}
+		if want, have := strings.Join(testcase.want, "|"), strings.Join(pages, "|"); want != have {
+			t.Errorf("%s: want pages\n%s\nhave\n%s", testcase.name, want, have)
+		}
+		if want, have := fmt.Sprint(testcase.truncs), fmt.Sprint(truncs); want != have {
+			t.Errorf("%s: want truncated %s, have %s", testcase.name, want, have)
+		}
+	}
+}
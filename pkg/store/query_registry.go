@@ -1,13 +1,14 @@
 package store
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/record"
 )
 
 // queryRegistry holds active streaming queries.
@@ -21,6 +22,7 @@ type chanmap map[chan<- []byte]queryContext
 
 type queryContext struct {
 	pass   recordFilter
+	node   string // annotates records as read by it, if not empty
 	done   <-chan struct{}
 	cancel func()
 }
@@ -33,8 +35,9 @@ func newQueryRegistry() *queryRegistry {
 
 // Register a new query. If successful, range over the returned chan for
 // incoming records. If not successful, the returned chan will be nil.
-// Records on the returned chan will NOT have trailing newlines.
-func (qr *queryRegistry) Register(ctx context.Context, pass recordFilter) <-chan []byte {
+// Records on the returned chan will NOT have trailing newlines. If the node
+// isn't empty, they're annotated with their origin, as read by it.
+func (qr *queryRegistry) Register(ctx context.Context, pass recordFilter, node string) <-chan []byte {
 	qr.mtx.Lock()
 	defer qr.mtx.Unlock()
 
@@ -52,7 +55,7 @@ func (qr *queryRegistry) Register(ctx context.Context, pass recordFilter) <-chan
 	// Create the record chan, and register it.
 	// TODO(pb): validate the buffer size
 	c := make(chan []byte, 1024)
-	qr.reg[c] = queryContext{pass, subctx.Done(), cancel}
+	qr.reg[c] = queryContext{pass, node, subctx.Done(), cancel}
 
 	// Canceling the context should deregister the query and close the chan.
 	// Spawn a cleanup goroutine to wait for the cancelation and do just that.
@@ -107,10 +110,10 @@ func (qr *queryRegistry) Close() error {
 	}
 }
 
-// Match a segment of records against the set of registered queries.
-// The function may block if channel receivers are slow.
+// Match a segment of records, of the given name, against the set of
+// registered queries. The function may block if channel receivers are slow.
 // Perhaps best to run in a goroutine?
-func (qr *queryRegistry) Match(segment []byte) {
+func (qr *queryRegistry) Match(name string, segment []byte) {
 	qr.mtx.RLock()
 	defer qr.mtx.RUnlock()
 
@@ -124,16 +127,30 @@ func (qr *queryRegistry) Match(segment []byte) {
 		return
 	}
 
+	// Annotated queries share a token per node.
+	origins := map[string][]byte{}
+	for _, qc := range qr.reg {
+		if qc.node != "" {
+			origins[qc.node] = originToken(qc.node, name)
+		}
+	}
+
 	// Match each record in the segment against the registered queries.
 	// Send any matches immediately.
-	s := bufio.NewScanner(bytes.NewReader(segment))
+	var buf bytes.Buffer
+	s := record.NewScanner(bytes.NewReader(segment))
 	s.Split(scanLinesPreserveNewline)
 	for s.Scan() {
 		for c, qc := range qr.reg {
 			if qc.pass(s.Bytes()) {
+				record := []byte(s.Text()) // copy the record out of the Scanner
+				if qc.node != "" {
+					buf.Reset()
+					annotate(&buf, s.Bytes(), origins[qc.node])
+					record = append([]byte(nil), buf.Bytes()...)
+				}
 				select {
-				case c <- []byte(s.Text()):
-					// We use s.Text to copy the record out of the Scanner.
+				case c <- record:
 
 				case <-qc.done:
 					// We're canceled! The cancelation was also detected by the
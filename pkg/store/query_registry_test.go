@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -24,11 +25,11 @@ func TestQueryRegistry(t *testing.T) {
 
 	// Register a query for 'foo' records.
 	fooctx, foocancel := context.WithCancel(context.Background())
-	fooc := qr.Register(fooctx, recordFilterPlain([]byte("foo")))
+	fooc := qr.Register(fooctx, recordFilterPlain([]byte("foo")), "")
 
 	// Register a query for 'bar' records.
 	barctx, barcancel := context.WithCancel(context.Background())
-	barc := qr.Register(barctx, recordFilterPlain([]byte("bar")))
+	barc := qr.Register(barctx, recordFilterPlain([]byte("bar")), "")
 
 	// A helper function to generate segments.
 	nopulid := ulid.MustNew(0, nil).String()
@@ -41,7 +42,7 @@ func TestQueryRegistry(t *testing.T) {
 	}
 
 	// Push a segment through that should match foo.
-	go qr.Match(makeSegment("no match", "abc foo def", "no match again"))
+	go qr.Match("segment", makeSegment("no match", "abc foo def", "no match again"))
 	select {
 	case foo := <-fooc:
 		if want, have := nopulid+" abc foo def\n", string(foo); want != have {
@@ -65,7 +66,7 @@ func TestQueryRegistry(t *testing.T) {
 	// Push a segment through that matches foo and bar.
 	// Since foo was canceled, it shouldn't try to push records there.
 	// If it did, it would block forever, and we'd get a timeout.
-	go qr.Match(makeSegment("match on foo, but no foo registered", "abc bar def", "again, no match"))
+	go qr.Match("segment", makeSegment("match on foo, but no foo registered", "abc bar def", "again, no match"))
 	select {
 	case bar := <-barc:
 		if want, have := nopulid+" abc bar def\n", string(bar); want != have {
@@ -87,11 +88,40 @@ func TestQueryRegistry(t *testing.T) {
 	}
 }
 
+func TestQueryRegistryAnnotated(t *testing.T) {
+	t.Parallel()
+
+	qr := newQueryRegistry()
+	defer qr.Close()
+
+	// The annotated query is matched as the plain one is, on the record,
+	// not its origin.
+	var (
+		plain     = qr.Register(context.Background(), recordFilterPlain([]byte("foo")), "")
+		annotated = qr.Register(context.Background(), recordFilterRegex(regexp.MustCompile("^foo")), "store-2:7650")
+		id        = ulid.MustNew(0, nil).String()
+	)
+	go qr.Match("lo-hi", []byte(id+" bar\n"+id+" foo\n"))
+	for c, want := range map[<-chan []byte]string{
+		plain:     id + " foo\n",
+		annotated: id + " [node=store-2:7650 seg=lo-hi] foo\n",
+	} {
+		select {
+		case have := <-c:
+			if want != string(have) {
+				t.Errorf("want %q, have %q", want, have)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for %q", want)
+		}
+	}
+}
+
 func TestQueryRegistryClose(t *testing.T) {
 	t.Parallel()
 
 	qr := newQueryRegistry()
-	c := qr.Register(context.Background(), recordFilterPlain([]byte("")))
+	c := qr.Register(context.Background(), recordFilterPlain([]byte("")), "")
 	qr.Close()
 	select {
 	case _, ok := <-c:
@@ -132,7 +162,7 @@ func TestQueryRegistryRaces(t *testing.T) {
 	)
 	for i := 0; i < n; i++ {
 		ctx, cancel := context.WithCancel(context.Background())
-		records := qr.Register(ctx, recordFilterPlain([]byte("")))
+		records := qr.Register(ctx, recordFilterPlain([]byte("")), "")
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -148,7 +178,7 @@ func TestQueryRegistryRaces(t *testing.T) {
 
 	// Match the bunch of segments.
 	for i := 0; i < n; i++ {
-		go func(segment []byte) { qr.Match(segment) }(segments[i])
+		go func(segment []byte) { qr.Match("segment", segment) }(segments[i])
 	}
 
 	// Wait for it all to finish.
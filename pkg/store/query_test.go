@@ -1,11 +1,19 @@
 package store
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
 	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/record"
 )
 
 func TestQueryResultMerge(t *testing.T) {
@@ -41,6 +49,211 @@ func TestULIDOrTimeParse(t *testing.T) {
 	}
 }
 
+func TestParseTime(t *testing.T) {
+	t.Parallel()
+
+	now := mustParseRFC3339("2017-03-25T21:18:20.05731891Z")
+	for _, testcase := range []struct {
+		input string
+		want  time.Time
+	}{
+		{"now", now},
+		{"NOW", now},
+		{"-15m", now.Add(-15 * time.Minute)},
+		{"+1h30m", now.Add(90 * time.Minute)},
+		{"now-2h", now.Add(-2 * time.Hour)},
+		{"2017-03-14T15:59:40Z", mustParseRFC3339("2017-03-14T15:59:40Z")},
+		{"2017-03-14T16:59:40.123+01:00", mustParseRFC3339("2017-03-14T15:59:40.123Z")},
+		{"1489507180", mustParseRFC3339("2017-03-14T15:59:40Z")},
+		{"1489507180123", mustParseRFC3339("2017-03-14T15:59:40.123Z")},
+		{"999999999999", time.Unix(999999999999, 0)},
+		{"1000000000000", mustParseRFC3339("2001-09-09T01:46:40Z")},
+	} {
+		t.Run(testcase.input, func(t *testing.T) {
+			have, err := ParseTime(testcase.input, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := testcase.want; !want.Equal(have) {
+				t.Fatalf("want %s, have %s", want, have)
+			}
+		})
+	}
+
+	for _, input := range []string{
+		"",
+		"yesterday",
+		"-15",
+		"-15x",
+		"now-",
+		"15m ago",
+		"-1489507180",
+		"2017-03-14 15:59:40",
+		"99999999999999999999",
+	} {
+		if _, err := ParseTime(input, now); err == nil {
+			t.Errorf("%q: want error, have none", input)
+		}
+	}
+}
+
+func TestQueryParamsDecodeFromRange(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		query string
+		want  time.Duration // of the range, or -1 for an error
+	}{
+		{"from=-15m&to=now", 15 * time.Minute},
+		{"from=now-1h&to=-30m", 30 * time.Minute},
+		{"from=1489507180&to=2017-03-14T16:59:40Z", time.Hour},
+		{"from=1489507180000&to=1489507180000", 0},
+		{"from=now&to=-1m", -1},
+		{"from=2017-03-14T16:59:40Z&to=1489507180", -1},
+		{"from=bad&to=now", -1},
+		{"from=-15m&to=bad", -1},
+	} {
+		t.Run(testcase.query, func(t *testing.T) {
+			var qp QueryParams
+			err := qp.DecodeFrom(&url.URL{RawQuery: testcase.query}, rangeRequired)
+			if testcase.want < 0 {
+				if err == nil {
+					t.Fatal("want error, have none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := testcase.want, qp.To.Time.Sub(qp.From.Time); want != have {
+				t.Fatalf("want %s, have %s", want, have)
+			}
+		})
+	}
+}
+
+func TestQueryParamsDecodeFromSample(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		query string
+		want  float64 // or -1 for an error
+	}{
+		{"", 0},
+		{"sample=0.01", 0.01},
+		{"sample=1", 1},
+		{"sample=0", -1},
+		{"sample=1.5", -1},
+		{"sample=-0.5", -1},
+		{"sample=NaN", -1},
+		{"sample=half", -1},
+	} {
+		var qp QueryParams
+		err := qp.DecodeFrom(&url.URL{RawQuery: testcase.query}, rangeNotRequired)
+		if testcase.want < 0 {
+			if err == nil {
+				t.Errorf("%q: want error, have none", testcase.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", testcase.query, err)
+			continue
+		}
+		if want, have := testcase.want, qp.Sample; want != have {
+			t.Errorf("%q: want %v, have %v", testcase.query, want, have)
+		}
+	}
+}
+
+func TestQueryParamsDecodeFromExtract(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		query string
+		want  string // error, if any
+	}{
+		{"q=user=(%5Cd%2B)&regex=true&extract=true", ""},
+		{"q=user=(%5Cd%2B)&regex=true&extract=false", ""},
+		{"q=user&regex=true", ""},
+		{"q=user&regex=true&extract=true", "parsing 'extract': the regex has no capture groups"},
+		{"q=user=(%5Cd%2B)&extract=true", "parsing 'extract': only regex queries can extract"},
+		{"q=user=(%5Cd%2B)&regex=true&extract=maybe", "parsing 'extract'"},
+	} {
+		var qp QueryParams
+		err := qp.DecodeFrom(&url.URL{RawQuery: testcase.query}, rangeNotRequired)
+		switch {
+		case testcase.want == "" && err != nil:
+			t.Errorf("%q: %v", testcase.query, err)
+		case testcase.want != "" && (err == nil || !strings.HasPrefix(err.Error(), testcase.want)):
+			t.Errorf("%q: want error %q, have %v", testcase.query, testcase.want, err)
+		}
+	}
+}
+
+func TestExtractReadCloser(t *testing.T) {
+	t.Parallel()
+
+	const id = "01BB6RQR190000000000000000"
+	for _, testcase := range []struct {
+		name    string
+		regex   string
+		records []string
+		want    []string
+	}{
+		{
+			name:    "groups",
+			regex:   `user_id=(\d+) latency=(\d+)ms`,
+			records: []string{"GET / user_id=42 latency=7ms\n", "user_id=9 latency=120ms status=500\n"},
+			want:    []string{"42\t7\n", "9\t120\n"},
+		},
+		{
+			name:    "named groups",
+			regex:   `(?P<method>GET|POST) (?P<path>\S+)`,
+			records: []string{"web POST /orders 201\n"},
+			want:    []string{"POST\t/orders\n"},
+		},
+		{
+			name:    "empty groups",
+			regex:   `level=(\w+)(?: err=(\w*))?( *)`,
+			records: []string{"level=info\n", "level=error err= msg\n", "level=error err=eof\n"},
+			want:    []string{"info\t\t\n", "error\t\t \n", "error\teof\t\n"},
+		},
+		{
+			name:    "multibyte",
+			regex:   `user=(\S+) city=(\S+)`,
+			records: []string{"user=José city=Zürich\n", "user=山田 city=東京 ✓\n"},
+			want:    []string{"José\tZürich\n", "山田\t東京\n"},
+		},
+		{
+			name:    "to the end",
+			regex:   `msg=(.*)`,
+			records: []string{"msg=all of it\n"},
+			want:    []string{"all of it\n"},
+		},
+		{
+			name:    "annotated",
+			regex:   `^user_id=(\d+)`,
+			records: []string{"[node=store-2:7650 seg=a-b] user_id=42\n"},
+			want:    []string{"[node=store-2:7650 seg=a-b] 42\n"},
+		},
+	} {
+		var records, want string
+		for i := range testcase.records {
+			records += id + " " + testcase.records[i]
+			want += id + " " + testcase.want[i]
+		}
+		have, err := ioutil.ReadAll(newExtractReadCloser(ioutil.NopCloser(strings.NewReader(records)), regexp.MustCompile(testcase.regex)))
+		if err != nil {
+			t.Errorf("%s: %v", testcase.name, err)
+			continue
+		}
+		if want != string(have) {
+			t.Errorf("%s: want %q, have %q", testcase.name, want, have)
+		}
+	}
+}
+
 func mustParseRFC3339(s string) time.Time {
 	t, err := time.ParseInLocation(time.RFC3339Nano, s, time.UTC)
 	if err != nil {
@@ -48,3 +261,123 @@ func mustParseRFC3339(s string) time.Time {
 	}
 	return t
 }
+
+func TestPaginate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		records  = recordA + recordB + recordC + recordD
+		reversed = recordD + recordC + recordB + recordA
+		b        = ulid.MustParse(recordB[:ulid.EncodedSize])
+		c        = ulid.MustParse(recordC[:ulid.EncodedSize])
+		d        = ulid.MustParse(recordD[:ulid.EncodedSize])
+	)
+	for _, testcase := range []struct {
+		name   string
+		order  recordOrder
+		limit  int
+		cutoff *ulid.ULID
+		page   string
+		last   *ulid.ULID
+	}{
+		{"under limit", orderAscending, 5, nil, records, nil},
+		{"at limit", orderAscending, 4, nil, records, nil},
+		{"over limit", orderAscending, 2, nil, recordA + recordB, &b},
+		{"cutoff", orderAscending, 5, &c, recordA + recordB + recordC, &c},
+		{"cutoff after limit", orderAscending, 2, &c, recordA + recordB, &b},
+		{"cutoff at end", orderAscending, 5, &d, records, &d},
+		{"descending under limit", orderDescending, 5, nil, reversed, nil},
+		{"descending over limit", orderDescending, 2, nil, recordD + recordC, &c},
+		{"descending cutoff", orderDescending, 5, &b, recordD + recordC + recordB, &b},
+		{"descending cutoff after limit", orderDescending, 1, &c, recordD, &d},
+	} {
+		input := records
+		if testcase.order == orderDescending {
+			input = reversed
+		}
+		page, token, err := paginate(strings.NewReader(input), testcase.limit, testcase.cutoff, testcase.order, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", testcase.name, err)
+		}
+		if want, have := testcase.page, string(page); want != have {
+			t.Errorf("%s: want page %q, have %q", testcase.name, want, have)
+		}
+		switch {
+		case testcase.last == nil && token != "":
+			t.Errorf("%s: want no token, have %q", testcase.name, token)
+		case testcase.last != nil:
+			last, err := decodeContinue(token)
+			if err != nil {
+				t.Fatalf("%s: %v", testcase.name, err)
+			}
+			if want, have := *testcase.last, last; want != have {
+				t.Errorf("%s: want token for %s, have %s", testcase.name, want, have)
+			}
+		}
+	}
+}
+
+func TestEncodeRecordsJSON(t *testing.T) {
+	t.Parallel()
+
+	// Records can't contain newlines, which delimit them, but they can
+	// contain carriage returns, escaped newlines, quotes, and any bytes.
+	for _, testcase := range []struct {
+		name  string
+		input string
+		want  jsonRecord
+	}{
+		{
+			name:  "plain",
+			input: "01BC3NABW20000000000000000 loki hello world\n",
+			want:  jsonRecord{"01BC3NABW20000000000000000", "2017-03-25T21:17:54.946Z", "loki", "loki hello world", ""},
+		},
+		{
+			name:  "quotes",
+			input: "01BC3NABW20000000000000000 loki say \"hi\" <b>\n",
+			want:  jsonRecord{"01BC3NABW20000000000000000", "2017-03-25T21:17:54.946Z", "loki", "loki say \"hi\" <b>", ""},
+		},
+		{
+			name:  "newlines",
+			input: "01BC3NABW20000000000000000 loki one\\ntwo\r\n",
+			want:  jsonRecord{"01BC3NABW20000000000000000", "2017-03-25T21:17:54.946Z", "loki", "loki one\\ntwo\r", ""},
+		},
+		{
+			name:  "escaped",
+			input: "01BC3NABW20000000000000000 loki \x1eone\\ntwo\\\\n\n",
+			want:  jsonRecord{"01BC3NABW20000000000000000", "2017-03-25T21:17:54.946Z", "loki", "loki one\ntwo\\n", ""},
+		},
+		{
+			name:  "invalid UTF-8",
+			input: "01BC3NABW20000000000000000 loki \xff\xfe ok\n",
+			want:  jsonRecord{"01BC3NABW20000000000000000", "2017-03-25T21:17:54.946Z", "loki", "loki �� ok", ""},
+		},
+		{
+			name:  "no topic",
+			input: "01BC3NABW20000000000000000 !!\n",
+			want:  jsonRecord{"01BC3NABW20000000000000000", "2017-03-25T21:17:54.946Z", record.DefaultTopic, "!!", ""},
+		},
+		{
+			name:  "annotated",
+			input: "01BC3NABW20000000000000000 [node=store-2:7650 seg=01BC3NABW20000000000000000-01BC3NABW20000000000000000] loki hello world\n",
+			want:  jsonRecord{"01BC3NABW20000000000000000", "2017-03-25T21:17:54.946Z", "loki", "loki hello world", "node=store-2:7650 seg=01BC3NABW20000000000000000-01BC3NABW20000000000000000"},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeRecordsJSON(&buf, strings.NewReader(testcase.input)); err != nil {
+				t.Fatal(err)
+			}
+			if want, have := 1, strings.Count(buf.String(), "\n"); want != have {
+				t.Fatalf("want %d line, have %d: %q", want, have, buf.String())
+			}
+			var have jsonRecord
+			if err := json.Unmarshal(buf.Bytes(), &have); err != nil {
+				t.Fatal(err)
+			}
+			if want := testcase.want; want != have {
+				t.Errorf("want %+v, have %+v", want, have)
+			}
+		})
+	}
+}
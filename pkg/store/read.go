@@ -1,11 +1,14 @@
 package store
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"sort"
 	"strings"
+	"sync/atomic"
 
 	"github.com/djherbis/buffer"
 	"github.com/djherbis/nio"
@@ -13,6 +16,8 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/mergelog"
+	"github.com/oklog/oklog/pkg/record"
 )
 
 // ErrShortRead is returned when a read is unexpectedly shortened.
@@ -20,129 +25,36 @@ var ErrShortRead = errors.New("short read")
 
 // mergeRecords takes a set of io.Readers that contain ULID-prefixed records in
 // individually-sorted order, and writes the globally-sorted output to the
-// io.Writer.
+// io.Writer, deduplicated.
 func mergeRecords(w io.Writer, readers ...io.Reader) (low, high ulid.ULID, n int64, err error) {
-	// Optimization and safety.
-	if len(readers) == 0 {
-		return low, high, 0, nil
-	}
-
-	// https://github.com/golang/go/wiki/SliceTricks
-	notnil := readers[:0]
-	for _, r := range readers {
-		if r != nil {
-			notnil = append(notnil, r)
-		}
-	}
-	readers = notnil
-
-	// Initialize our state.
-	var (
-		first   = true
-		scanner = make([]*bufio.Scanner, len(readers))
-		ok      = make([]bool, len(readers))
-		record  = make([][]byte, len(readers))
-		id      = make([][]byte, len(readers))
-	)
-
-	// Advance moves the next record from a reader into our state.
-	advance := func(i int) error {
-		if ok[i] = scanner[i].Scan(); ok[i] {
-			record[i] = scanner[i].Bytes()
-			// Something nice, like bytes.Fields, is too slow!
-			//id[i] = bytes.Fields(record[i])[0]
-			if len(record[i]) < ulid.EncodedSize {
-				panic("short record")
-			}
-			id[i] = record[i][:ulid.EncodedSize]
-		} else if err := scanner[i].Err(); err != nil && err != io.EOF {
-			return err
+	m := mergelog.NewMerger(mergelog.Options{}, readers...)
+	for first := true; m.Next(); first = false {
+		if first {
+			low = m.ID()
 		}
-		return nil
-	}
-
-	// Initialize all of the scanners and their first record.
-	for i := 0; i < len(readers); i++ {
-		scanner[i] = bufio.NewScanner(readers[i])
-		scanner[i].Split(scanLinesPreserveNewline)
-		if err := advance(i); err != nil {
-			return low, high, n, err
-		}
-	}
-
-	// Loop until all readers are drained.
-	var (
-		chosenIndex int
-		chosenULID  ulid.ULID
-	)
-	for {
-		// Choose the smallest ULID from all of the IDs.
-		chosenIndex = -1
-		for i := 0; i < len(readers); i++ {
-			if !ok[i] {
-				continue
-			}
-			if chosenIndex < 0 || bytes.Compare(id[i], id[chosenIndex]) < 0 {
-				chosenIndex = i
-			}
-		}
-		if chosenIndex < 0 {
-			break // drained all the scanners
-		}
-
-		// The first ULID from this batch of readers is the low ULID.
-		// The last ULID from this batch of readers is the high ULID.
-		// Record the first ULID as low, and the latest ULID as high.
-		chosenULID.UnmarshalText(id[chosenIndex])
-		if first { // record first as low
-			low, first = chosenULID, false
-		} else if !first && chosenULID == high { // duplicate!
-			if err := advance(chosenIndex); err != nil {
-				return low, high, n, err
-			}
-			continue
-		}
-		high = chosenULID // record most recent as high
-
-		// Write the record.
-		n0, err := w.Write(record[chosenIndex])
+		high = m.ID()
+		n0, err := w.Write(m.Record())
 		if err != nil {
 			return low, high, n, err
 		}
 		n += int64(n0)
-
-		// Advance the chosen scanner by 1 record.
-		if err := advance(chosenIndex); err != nil {
-			return low, high, n, err
-		}
 	}
-
-	return low, high, n, nil
+	return low, high, n, m.Err()
 }
 
-// mergeRecordsToLog is a specialization of mergeRecords.
-// It enforces segmentTargetSize by creating WriteSegments as necessary.
-// It has best-effort semantics, e.g. it won't split large records.
+// mergeRecordsToLog is a specialization of mergeRecords, for compaction.
+// It enforces segmentTargetSize by creating WriteSegments as necessary, each
+// set compacted. It has best-effort semantics, e.g. it won't split large
+// records.
 func mergeRecordsToLog(dst Log, segmentTargetSize int64, readers ...io.Reader) (n int64, err error) {
-	// Optimization and safety.
-	if len(readers) == 0 {
-		return 0, nil
-	}
-
-	// https://github.com/golang/go/wiki/SliceTricks
-	notnil := readers[:0]
-	for _, r := range readers {
-		if r != nil {
-			notnil = append(notnil, r)
-		}
-	}
-	readers = notnil
+	m := mergelog.NewMerger(mergelog.Options{}, readers...)
 
 	// Per-segment state.
 	writeSegment, err := dst.Create()
 	if err != nil {
 		return n, err
 	}
+	writeSegment.SetCompacted()
 	defer func() {
 		// Don't leak active segments.
 		if writeSegment != nil {
@@ -152,81 +64,18 @@ func mergeRecordsToLog(dst Log, segmentTargetSize int64, readers ...io.Reader) (
 		}
 	}()
 	var (
-		nSegment int64
-		first    = true
-		low      ulid.ULID
-		high     ulid.ULID
-	)
-
-	// Global state.
-	var (
-		scanner = make([]*bufio.Scanner, len(readers))
-		ok      = make([]bool, len(readers))
-		record  = make([][]byte, len(readers))
-		id      = make([][]byte, len(readers))
-	)
-
-	// Advance moves the next record from a reader into our state.
-	advance := func(i int) error {
-		if ok[i] = scanner[i].Scan(); ok[i] {
-			record[i] = scanner[i].Bytes()
-			// Something nice, like bytes.Fields, is too slow!
-			//id[i] = bytes.Fields(record[i])[0]
-			if len(record[i]) < ulid.EncodedSize {
-				panic("short record")
-			}
-			id[i] = record[i][:ulid.EncodedSize]
-		} else if err := scanner[i].Err(); err != nil && err != io.EOF {
-			return err
-		}
-		return nil
-	}
-
-	// Initialize all of the scanners and their first record.
-	for i := 0; i < len(readers); i++ {
-		scanner[i] = bufio.NewScanner(readers[i])
-		scanner[i].Split(scanLinesPreserveNewline)
-		if err := advance(i); err != nil {
-			return n, err
-		}
-	}
-
-	// Loop until all readers are drained.
-	var (
-		chosenIndex int
-		chosenULID  ulid.ULID
+		nSegment  int64
+		low, high ulid.ULID
 	)
-	for {
-		// Choose the smallest ULID.
-		chosenIndex = -1
-		for i := 0; i < len(readers); i++ {
-			if !ok[i] {
-				continue
-			}
-			if chosenIndex < 0 || bytes.Compare(id[i], id[chosenIndex]) < 0 {
-				chosenIndex = i
-			}
-		}
-		if chosenIndex < 0 {
-			break // drained all the scanners
-		}
 
-		// The first ULID from this batch of readers is the low ULID.
-		// The last ULID from this batch of readers is the high ULID.
-		// Record the first ULID as low, and the latest ULID as high.
-		chosenULID.UnmarshalText(id[chosenIndex])
-		if first { // record first as low
-			low, first = chosenULID, false
-		} else if !first && chosenULID == high { // duplicate!
-			if err := advance(chosenIndex); err != nil {
-				return n, err
-			}
-			continue
+	for m.Next() {
+		if nSegment == 0 {
+			low = m.ID()
 		}
-		high = chosenULID // record most recent as high
+		high = m.ID()
 
 		// Write the record.
-		n0, err := writeSegment.Write(record[chosenIndex])
+		n0, err := writeSegment.Write(m.Record())
 		if err != nil {
 			return n, err
 		}
@@ -244,15 +93,13 @@ func mergeRecordsToLog(dst Log, segmentTargetSize int64, readers ...io.Reader) (
 			if err != nil {
 				return n, err
 			}
+			writeSegment.SetCompacted()
 			nSegment = 0
-			first = true
-		}
-
-		// Advance the chosen scanner by 1 record.
-		if err := advance(chosenIndex); err != nil {
-			return n, err
 		}
 	}
+	if err := m.Err(); err != nil {
+		return n, err
+	}
 
 	if nSegment > 0 {
 		if err = writeSegment.Close(low, high); err != nil {
@@ -265,11 +112,53 @@ func mergeRecordsToLog(dst Log, segmentTargetSize int64, readers ...io.Reader) (
 	return n, err
 }
 
+// sortRecords returns the ULID-prefixed records of the segment in ULID order.
+// Records from ingesters that honor client timestamps may be out of order, as
+// may those of several ingest segments, merged by a consumer; others are
+// returned as they are. Records with the same ULID keep their order.
+func sortRecords(segment []byte) []byte {
+	var (
+		records [][]byte
+		sorted  = true
+	)
+	for rest := segment; len(rest) > 0; {
+		i := bytes.IndexByte(rest, '\n') + 1
+		if i <= 0 {
+			i = len(rest)
+		}
+		record := rest[:i]
+		if n := len(records); n > 0 && bytes.Compare(recordID(records[n-1]), recordID(record)) > 0 {
+			sorted = false
+		}
+		records, rest = append(records, record), rest[i:]
+	}
+	if sorted {
+		return segment
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return bytes.Compare(recordID(records[i]), recordID(records[j])) < 0
+	})
+	return bytes.Join(records, nil)
+}
+
+// recordID is the ULID prefix of a record, which sorts as the ULID does.
+func recordID(record []byte) []byte {
+	if len(record) < ulid.EncodedSize {
+		return record
+	}
+	return record[:ulid.EncodedSize]
+}
+
 // newQueryReadCloser converts a batch of segments to a single io.ReadCloser.
-// Records are yielded in time order, oldest first, hopefully efficiently!
-// Only records passing the recordFilter are yielded.
-// The sz of the segment files can be used as a proxy for read effort.
-func newQueryReadCloser(fs fs.Filesystem, segments []readSegment, pass recordFilter, bufsz int64, reporter EventReporter) (rc io.ReadCloser, sz int64, err error) {
+// Records are yielded in time order, oldest or newest first according to the
+// recordOrder, hopefully efficiently! Only records passing the recordFilter
+// are yielded. The sz of the segment files can be used as a proxy for read
+// effort. The work done is counted in counters, if they're non-nil.
+//
+// Segments are read and filtered concurrently, by at most concurrency at a
+// time. Reading stops, and the ReadCloser returns an error, when the context
+// is canceled.
+func newQueryReadCloser(ctx context.Context, fs fs.Filesystem, segments []readSegment, pass recordFilter, order recordOrder, bufsz int64, concurrency int, counters *queryCounters, reporter EventReporter) (rc io.ReadCloser, sz int64, err error) {
 	// We will build successive ReadClosers for each batch.
 	var rcs []io.ReadCloser
 
@@ -289,6 +178,8 @@ func newQueryReadCloser(fs fs.Filesystem, segments []readSegment, pass recordFil
 	}()
 
 	// Batch the segments, and construct a ReadCloser for each batch.
+	// All of them share a worker slot per concurrent segment.
+	slots := make(chan struct{}, concurrency)
 	for _, batch := range batchSegments(segments) {
 		switch len(batch) {
 		case 0:
@@ -297,23 +188,31 @@ func newQueryReadCloser(fs fs.Filesystem, segments []readSegment, pass recordFil
 		case 1:
 			// A batch of one can be read straight thru.
 			sz += batch[0].size
-			rcs = append(rcs, newConcurrentFilteringReadCloser(batch[0].file, pass, bufsz))
+			rcs = append(rcs, newConcurrentFilteringReadCloser(ctx, batch[0].file, batch[0].filter(pass, order), batch[0].origin, bufsz, slots, counters))
 
 		default:
 			// A batch of N requires a K-way merge.
-			cfrcs, batchsz, err := makeConcurrentFilteringReadClosers(fs, batch, pass, bufsz)
-			if err != nil {
-				return nil, sz, err
-			}
-			mrc, err := newMergeReadCloser(cfrcs)
+			cfrcs, batchsz, err := makeConcurrentFilteringReadClosers(ctx, fs, batch, pass, order, bufsz, slots, counters)
 			if err != nil {
 				return nil, sz, err
 			}
-			rcs = append(rcs, mrc)
+			rcs = append(rcs, newMergeReadCloser(cfrcs, orderAscending, counters))
 			sz += batchsz
 		}
 	}
 
+	// Batches don't overlap, so newest first is the newest batch first,
+	// each batch reversed. Segments can only be read forwards, so each
+	// batch is reversed in memory, one after the other.
+	if order == orderDescending {
+		for i, j := 0, len(rcs)-1; i < j; i, j = i+1, j-1 {
+			rcs[i], rcs[j] = rcs[j], rcs[i]
+		}
+		for i := range rcs {
+			rcs[i] = newReverseReadCloser(rcs[i])
+		}
+	}
+
 	// MultiReadCloser uses an io.MultiReader under the hood.
 	// A MultiReader reads from each reader in sequence.
 	rc = newMultiReadCloser(rcs...)
@@ -366,37 +265,91 @@ func batchSegments(segments []readSegment) [][]readSegment {
 	return result
 }
 
-func makeConcurrentFilteringReadClosers(fs fs.Filesystem, segments []readSegment, pass recordFilter, bufsz int64) (rcs []io.ReadCloser, sz int64, err error) {
+func makeConcurrentFilteringReadClosers(ctx context.Context, fs fs.Filesystem, segments []readSegment, pass recordFilter, order recordOrder, bufsz int64, slots chan struct{}, counters *queryCounters) (rcs []io.ReadCloser, sz int64, err error) {
 	rcs = make([]io.ReadCloser, len(segments))
 	for i := range segments {
 		sz += segments[i].size
-		rcs[i] = newConcurrentFilteringReadCloser(segments[i].file, pass, bufsz)
+		rcs[i] = newConcurrentFilteringReadCloser(ctx, segments[i].file, segments[i].filter(pass, order), segments[i].origin, bufsz, slots, counters)
 	}
 	return rcs, sz, nil
 }
 
-func newConcurrentFilteringReadCloser(src io.ReadCloser, pass recordFilter, bufsz int64) io.ReadCloser {
+// filterChunkSize is how many bytes of records are filtered per worker slot.
+// Matching records are written after the slot is released, as the write may
+// block until they're read, e.g. by a merge waiting on another segment.
+const filterChunkSize = 64 * 1024
+
+// cancelCheckInterval is how many records are filtered between checks of the
+// context, which isn't free.
+const cancelCheckInterval = 1024
+
+// newConcurrentFilteringReadCloser reads and filters src in a goroutine. While
+// filtering, the goroutine holds one of the slots, if they're non-nil, which
+// bounds the number of segments being filtered at once. If the origin token
+// is non-nil, the records that pass are annotated with it.
+func newConcurrentFilteringReadCloser(ctx context.Context, src io.ReadCloser, pass recordFilter, origin []byte, bufsz int64, slots chan struct{}, counters *queryCounters) io.ReadCloser {
+	if counters == nil {
+		counters = &queryCounters{}
+	}
 	r, w := nio.Pipe(buffer.New(bufsz))
 	go func() {
 		defer src.Close() // close the fs.File when we're done reading
 
 		// TODO(pb): this may be a regression; need to benchmark
-		s := bufio.NewScanner(src)
+		s := record.NewScanner(src)
 		s.Split(scanLinesPreserveNewline)
 
-		for s.Scan() {
-			line := s.Bytes()
-			if !pass(line) {
+		var (
+			chunk   bytes.Buffer
+			scanned int
+		)
+		for more := true; more; {
+			if slots != nil {
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					w.CloseWithError(ctx.Err())
+					return
+				}
+			}
+			chunk.Reset()
+			for chunk.Len() < filterChunkSize {
+				if more = s.Scan(); !more {
+					break
+				}
+				line := s.Bytes()
+				atomic.AddInt64(&counters.scanned, 1)
+				atomic.AddInt64(&counters.bytes, int64(len(line)))
+				if pass(line) {
+					atomic.AddInt64(&counters.matched, 1)
+					if origin != nil {
+						annotate(&chunk, line, origin)
+					} else {
+						chunk.Write(line)
+					}
+				}
+				if scanned++; scanned%cancelCheckInterval == 0 && ctx.Err() != nil {
+					break // few records may match, so don't wait for a full chunk
+				}
+			}
+			if slots != nil {
+				<-slots
+			}
+			if err := ctx.Err(); err != nil {
+				w.CloseWithError(err)
+				return
+			}
+			if chunk.Len() <= 0 {
 				continue
 			}
 
-			switch n, err := w.Write(line); {
+			switch n, err := w.Write(chunk.Bytes()); {
 			case err == io.ErrClosedPipe:
 				return // no need to close
 			case err != nil:
 				w.CloseWithError(err)
 				return
-			case n < len(line):
+			case n < chunk.Len():
 				w.CloseWithError(io.ErrShortWrite)
 				return
 			}
@@ -408,101 +361,127 @@ func newConcurrentFilteringReadCloser(src io.ReadCloser, pass recordFilter, bufs
 
 // readSegment models a segment file on disk.
 type readSegment struct {
-	path string // ULID-ULID.extension
-	file io.ReadCloser
-	size int64
+	path   string // ULID-ULID.extension
+	file   io.ReadCloser
+	size   int64
+	origin []byte    // annotates its records, if non-nil; see originToken
+	bound  ulid.ULID // its records are after it, backward before, if non-zero
 }
 
-// mergeReadCloser performs a K-way merge from multiple readers.
-type mergeReadCloser struct {
-	close   []io.Closer
-	scanner []*bufio.Scanner
-	ok      []bool
-	record  [][]byte
-	id      [][]byte
+// filter returns the filter of the segment's records, which is pass, and
+// within its bound, in the order.
+func (s readSegment) filter(pass recordFilter, order recordOrder) recordFilter {
+	switch {
+	case s.bound == (ulid.ULID{}):
+		return pass
+	case order == orderDescending:
+		return recordFilterBefore(s.bound, pass)
+	default:
+		return recordFilterAfter(s.bound, pass)
+	}
 }
 
-func newMergeReadCloser(rcs []io.ReadCloser) (io.ReadCloser, error) {
-	// Initialize our state.
-	rc := &mergeReadCloser{
-		close:   make([]io.Closer, len(rcs)),
-		scanner: make([]*bufio.Scanner, len(rcs)),
-		ok:      make([]bool, len(rcs)),
-		record:  make([][]byte, len(rcs)),
-		id:      make([][]byte, len(rcs)),
-	}
+// recordOrder is the order of records in a reader.
+type recordOrder int
 
-	// Initialize all of the scanners and their first record.
-	const (
-		scanBufferSize   = 64 * 1024      // 64KB
-		scanMaxTokenSize = scanBufferSize // if equal, no allocs
-	)
-	for i := 0; i < len(rcs); i++ {
-		rc.close[i] = rcs[i]
-		rc.scanner[i] = bufio.NewScanner(rcs[i])
-		rc.scanner[i].Split(scanLinesPreserveNewline)
-		rc.scanner[i].Buffer(make([]byte, scanBufferSize), scanMaxTokenSize)
-		if err := rc.advance(i); err != nil {
-			return nil, err
-		}
-	}
+const (
+	orderAscending  recordOrder = iota // oldest first
+	orderDescending                    // newest first
+)
 
-	// Ready to read.
-	return rc, nil
+// mergeReadCloser performs a K-way merge from multiple readers, which must all
+// be in the given order.
+type mergeReadCloser struct {
+	*mergelog.Reader
+	close    multiCloser
+	counters *queryCounters
+	counted  int64 // duplicates
 }
 
-func (rc *mergeReadCloser) Read(p []byte) (int, error) {
-	// Pick the source with the smallest ID.
-	// TODO(pb): could be improved with an e.g. tournament tree
-	smallest := -1 // index
-	for i := range rc.id {
-		if !rc.ok[i] {
-			continue // already drained
-		}
-		switch {
-		case smallest < 0, bytes.Compare(rc.id[i], rc.id[smallest]) < 0:
-			smallest = i
-		case bytes.Compare(rc.id[i], rc.id[smallest]) == 0: // duplicate
-			if err := rc.advance(i); err != nil {
-				return 0, err
-			}
-			continue
-		}
+// newMergeReadCloser merges the readers. Dropped duplicates are counted in
+// counters, if they're non-nil.
+func newMergeReadCloser(rcs []io.ReadCloser, order recordOrder, counters *queryCounters) io.ReadCloser {
+	if counters == nil {
+		counters = &queryCounters{}
 	}
-	if smallest < 0 {
-		return 0, io.EOF // everything is drained
+	readers := make([]io.Reader, len(rcs))
+	closers := make(multiCloser, len(rcs))
+	for i := range rcs {
+		readers[i], closers[i] = rcs[i], rcs[i]
 	}
-
-	// Copy the record over.
-	n := copy(p, rc.record[smallest])
-	if n < len(rc.record[smallest]) {
-		return n, ErrShortRead
+	return &mergeReadCloser{
+		Reader:   mergelog.NewReader(mergelog.Options{Descending: order == orderDescending}, readers...),
+		close:    closers,
+		counters: counters,
 	}
+}
 
-	// Advance the chosen source.
-	if err := rc.advance(smallest); err != nil {
-		return n, errors.Wrapf(err, "advancing reader %d", smallest)
+// newReplicaMergeReadCloser merges the readers, as newMergeReadCloser does,
+// but keeps every record with the same ULID, e.g. the replicas of a record,
+// one from each node that returned it.
+func newReplicaMergeReadCloser(rcs []io.ReadCloser, order recordOrder) io.ReadCloser {
+	readers := make([]io.Reader, len(rcs))
+	closers := make(multiCloser, len(rcs))
+	for i := range rcs {
+		readers[i], closers[i] = rcs[i], rcs[i]
+	}
+	return readCloser{
+		Reader: mergelog.NewReader(mergelog.Options{Descending: order == orderDescending, KeepDuplicates: true}, readers...),
+		Closer: closers,
 	}
+}
 
-	// One read is complete.
-	return n, nil
+func (rc *mergeReadCloser) Read(p []byte) (int, error) {
+	n, err := rc.Reader.Read(p)
+	if d := rc.Duplicates(); d > rc.counted {
+		atomic.AddInt64(&rc.counters.deduplicated, d-rc.counted)
+		rc.counted = d
+	}
+	return n, err
 }
 
 func (rc *mergeReadCloser) Close() error {
-	return multiCloser(rc.close).Close()
+	return rc.close.Close()
+}
+
+// reverseReadCloser yields the records of the underlying reader in reverse
+// order. That takes all of them, so they're read into memory on first Read.
+type reverseReadCloser struct {
+	src     io.ReadCloser
+	done    bool   // src is read
+	data    []byte // records not yet yielded
+	pending []byte // rest of the record being yielded
+}
+
+func newReverseReadCloser(src io.ReadCloser) io.ReadCloser {
+	return &reverseReadCloser{src: src}
 }
 
-func (rc *mergeReadCloser) advance(i int) error {
-	if rc.ok[i] = rc.scanner[i].Scan(); rc.ok[i] {
-		rc.record[i] = rc.scanner[i].Bytes()
-		if len(rc.record[i]) < ulid.EncodedSize {
-			panic("record is too short")
+func (rc *reverseReadCloser) Read(p []byte) (int, error) {
+	if !rc.done {
+		data, err := ioutil.ReadAll(rc.src)
+		if err != nil {
+			return 0, err
+		}
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n') // a record without newline would merge with the next
 		}
-		rc.id[i] = rc.record[i][:ulid.EncodedSize]
-	} else if err := rc.scanner[i].Err(); err != nil && err != io.EOF {
-		return err
+		rc.done, rc.data = true, data
 	}
-	return nil
+	if len(rc.pending) == 0 {
+		if len(rc.data) == 0 {
+			return 0, io.EOF
+		}
+		i := bytes.LastIndexByte(rc.data[:len(rc.data)-1], '\n') + 1
+		rc.data, rc.pending = rc.data[:i], rc.data[i:]
+	}
+	n := copy(p, rc.pending)
+	rc.pending = rc.pending[n:]
+	return n, nil
+}
+
+func (rc *reverseReadCloser) Close() error {
+	return rc.src.Close()
 }
 
 type readCloser struct {
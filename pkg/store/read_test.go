@@ -3,6 +3,7 @@ package store
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -12,9 +13,11 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/oklog/oklog/pkg/fs"
@@ -171,7 +174,7 @@ func BenchmarkMergeRecordsToLog(b *testing.B) {
 		charset           = "0123456789ABCDEFGHJKMNPQRSTVWXYZ "
 	)
 
-	dst, err := NewFileLog(fs.NewNopFilesystem(), "/", segmentTargetSize, segmentBufferSize, nil)
+	dst, err := NewFileLog(fs.NewNopFilesystem(), "/", segmentTargetSize, segmentBufferSize, FileLogConfig{})
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -206,6 +209,132 @@ func BenchmarkMergeRecordsToLog(b *testing.B) {
 	}
 }
 
+func TestMergeRecordsToLogDedupesAcrossSegments(t *testing.T) {
+	t.Parallel()
+
+	var (
+		a = fmt.Sprintf("%s A\n", ulid.MustNew(100, nil).String())
+		b = fmt.Sprintf("%s B\n", ulid.MustNew(101, nil).String())
+		c = fmt.Sprintf("%s C\n", ulid.MustNew(102, nil).String())
+	)
+
+	// The first segment fills up with B, and the replica of B from the
+	// second reader must not begin the next one.
+	dst := &mockLog{&bytes.Buffer{}}
+	if _, err := mergeRecordsToLog(dst, int64(len(a+b)), strings.NewReader(a+b), strings.NewReader(b+c)); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := a+b+c, dst.Buffer.String(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestMergeRecordsMemoryBounded(t *testing.T) {
+	// Not parallel: allocations are counted process-wide.
+	const (
+		readerCount = 4
+		readerSize  = 4 * 1024 * 1024
+		recordSize  = 1024
+	)
+	readers := make([]io.Reader, readerCount)
+	reset := func() {
+		for i := range readers {
+			readers[i] = newSyntheticSegment(i%2, readerSize, recordSize) // pairs of replicas
+		}
+	}
+
+	// Merging allocates per reader, not per record.
+	var n int64
+	allocs := testing.AllocsPerRun(1, func() {
+		reset()
+		_, _, n, _ = mergeRecords(ioutil.Discard, readers...)
+	})
+	if want, have := int64(2*readerSize), n; want != have {
+		t.Fatalf("merged bytes: want %d, have %d", want, have)
+	}
+	if max := float64(20 * readerCount); allocs > max {
+		t.Errorf("merging %d records: want at most %.0f allocations, have %.0f", 2*readerSize/recordSize, max, allocs)
+	}
+
+	// And the memory it allocates is a small fraction of the input.
+	reset()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, _, _, err := mergeRecords(ioutil.Discard, readers...); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	if max, have := uint64(readerCount*128*1024), after.TotalAlloc-before.TotalAlloc; have > max {
+		t.Errorf("merging %d bytes: want at most %d bytes allocated, have %d", readerCount*readerSize, max, have)
+	}
+}
+
+// BenchmarkMergeRecordsToLogLarge merges 4 synthetic 256MB segments, generated
+// on the fly, so the benchmark's own memory doesn't muddy the numbers.
+func BenchmarkMergeRecordsToLogLarge(b *testing.B) {
+	const (
+		readerCount       = 4
+		readerSize        = 256 * 1024 * 1024
+		recordSize        = 1024
+		segmentTargetSize = 128 * 1024 * 1024
+	)
+	dst, err := NewFileLog(fs.NewNopFilesystem(), "/", segmentTargetSize, 1024, FileLogConfig{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(readerCount * readerSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		readers := make([]io.Reader, readerCount)
+		for j := range readers {
+			readers[j] = newSyntheticSegment(j, readerSize, recordSize)
+		}
+		if n, err := mergeRecordsToLog(dst, segmentTargetSize, readers...); err != nil {
+			b.Errorf("n=%d err=%v", n, err)
+		}
+	}
+}
+
+// syntheticSegment generates size bytes of records of recordSize bytes, with
+// ULIDs whose timestamps depend on seed, without holding them in memory.
+// Segments with the same seed are replicas of each other.
+type syntheticSegment struct {
+	stamp     uint64
+	remaining int
+	record    []byte
+	pending   []byte
+}
+
+func newSyntheticSegment(seed, size, recordSize int) *syntheticSegment {
+	record := bytes.Repeat([]byte{'x'}, recordSize)
+	record[ulid.EncodedSize] = ' '
+	record[recordSize-1] = '\n'
+	return &syntheticSegment{
+		stamp:     uint64(seed),
+		remaining: size / recordSize,
+		record:    record,
+	}
+}
+
+func (s *syntheticSegment) Read(p []byte) (int, error) {
+	if len(s.pending) == 0 {
+		if s.remaining <= 0 {
+			return 0, io.EOF
+		}
+		s.remaining--
+		s.stamp += 4
+		var id ulid.ULID
+		id.SetTime(s.stamp)
+		id.MarshalTextTo(s.record[:ulid.EncodedSize])
+		s.pending = s.record
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
 func TestBatchSegments(t *testing.T) {
 	t.Parallel()
 
@@ -330,10 +459,7 @@ func TestMergeReadCloser(t *testing.T) {
 			}
 
 			// Construct the merge reader from the set of readers.
-			rc, err := newMergeReadCloser(rcs)
-			if err != nil {
-				t.Fatal(err)
-			}
+			rc := newMergeReadCloser(rcs, orderAscending, nil)
 
 			// Take lines from the merge reader until EOF.
 			have := []string{}
@@ -348,6 +474,55 @@ func TestMergeReadCloser(t *testing.T) {
 				t.Fatalf("want %v, have %v", want, have)
 			}
 		})
+
+		t.Run(testcase.name+" descending", func(t *testing.T) {
+			// The same, with every reader newest first.
+			rcs := make([]io.ReadCloser, len(testcase.input))
+			for i, segment := range testcase.input {
+				rcs[i] = ioutil.NopCloser(strings.NewReader(strings.Join(reverseStrings(segment), "")))
+			}
+			rc := newMergeReadCloser(rcs, orderDescending, nil)
+			have := []string{}
+			s := bufio.NewScanner(rc)
+			s.Split(scanLinesPreserveNewline)
+			for s.Scan() {
+				have = append(have, s.Text())
+			}
+			if want := reverseStrings(testcase.want); !reflect.DeepEqual(want, have) {
+				t.Fatalf("want %v, have %v", want, have)
+			}
+		})
+	}
+}
+
+func reverseStrings(a []string) []string {
+	r := make([]string, len(a))
+	for i := range a {
+		r[len(a)-1-i] = a[i]
+	}
+	return r
+}
+
+func TestReverseReadCloser(t *testing.T) {
+	t.Parallel()
+
+	for input, want := range map[string]string{
+		"":                          "",
+		recordA:                     recordA,
+		recordA + recordB:           recordB + recordA,
+		recordA + recordB + "\n":    "\n" + recordB + recordA,
+		recordA + "no newline":      "no newline\n" + recordA,
+		recordA + recordB + recordC: recordC + recordB + recordA,
+	} {
+		// Reading a byte at a time makes sure records can be yielded in parts.
+		rc := newReverseReadCloser(ioutil.NopCloser(strings.NewReader(input)))
+		have, err := ioutil.ReadAll(iotest.OneByteReader(rc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, have := want, string(have); want != have {
+			t.Errorf("%q: want %q, have %q", input, want, have)
+		}
 	}
 }
 
@@ -360,10 +535,7 @@ func TestMergeReadCloser(t *testing.T) {
 //
 func BenchmarkMergeReadCloser(b *testing.B) {
 	const size = 32 * 1024 * 1024
-	r, err := newMergeReadCloser(generateSegments(b, 128, size, "testdata/segments"))
-	if err != nil {
-		b.Fatal(err)
-	}
+	r := newMergeReadCloser(generateSegments(b, 128, size, "testdata/segments"), orderAscending, nil)
 	p := make([]byte, 4096)
 	b.ReportAllocs()
 	b.ResetTimer()
@@ -430,6 +602,145 @@ func generateSegments(b testing.TB, count, size int, datadir string) (segs []io.
 	return segs
 }
 
+func TestQueryConcurrency(t *testing.T) {
+	t.Parallel()
+
+	// All segments overlap, so records are merged from all of them at once,
+	// which must also work with fewer workers than segments.
+	var want []byte
+	for _, concurrency := range []int{1, 3, 32} {
+		filelog, err := NewFileLog(fs.NewVirtualFilesystem(), "/", 1024*1024, 1024, FileLogConfig{QueryConcurrency: concurrency})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer filelog.Close()
+		writeOverlappingSegments(t, filelog, 32, 16*1024)
+
+		result, err := filelog.Query(context.Background(), QueryParams{
+			From:  ulidOrTime{ULID: ulid.MustNew(0, nil)},
+			To:    ulidOrTime{ULID: ulid.MustNew(1<<40, nil)},
+			Q:     "x{8}",
+			Regex: true,
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := ioutil.ReadAll(result.Records)
+		result.Records.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, have := 32*16*1024/64, bytes.Count(have, []byte{'\n'}); want != have {
+			t.Errorf("concurrency %d: want %d records, have %d", concurrency, want, have)
+		}
+		if want == nil {
+			want = have
+		} else if !bytes.Equal(want, have) {
+			t.Errorf("concurrency %d: records differ from concurrency 1", concurrency)
+		}
+	}
+}
+
+func TestQueryCanceled(t *testing.T) {
+	t.Parallel()
+
+	filelog, err := NewFileLog(fs.NewVirtualFilesystem(), "/", 4*1024*1024, 1024, FileLogConfig{QueryConcurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+	const segments, size = 8, 2 * 1024 * 1024
+	writeSequentialSegments(t, filelog, segments, size)
+
+	// Nothing matches, so readers only stop early if they're canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	result, err := filelog.Query(ctx, QueryParams{
+		From:  ulidOrTime{ULID: ulid.MustNew(0, nil)},
+		To:    ulidOrTime{ULID: ulid.MustNew(1<<40, nil)},
+		Q:     "[yz]{3}",
+		Regex: true,
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := ioutil.ReadAll(result.Records)
+		result.Records.Close()
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if want, have := context.Canceled, err; want != have {
+			t.Errorf("want %v, have %v", want, have)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading didn't stop")
+	}
+	if scanned, total := result.Stats.RecordsScanned, int64(segments*size/64); scanned >= total {
+		t.Errorf("scanned all %d records", scanned)
+	}
+}
+
+// BenchmarkQueryConcurrency reads 32 segments with a regex that's expensive,
+// and matches nothing, so the read and filter phase dominates.
+func BenchmarkQueryConcurrency(b *testing.B) {
+	const segments, size = 32, 4 * 1024 * 1024
+	for _, concurrency := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", concurrency), func(b *testing.B) {
+			filelog, err := NewFileLog(fs.NewVirtualFilesystem(), "/", size, 1024*1024, FileLogConfig{QueryConcurrency: concurrency})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer filelog.Close()
+			writeSequentialSegments(b, filelog, segments, size)
+
+			b.SetBytes(segments * size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				result, err := filelog.Query(context.Background(), QueryParams{
+					From:  ulidOrTime{ULID: ulid.MustNew(0, nil)},
+					To:    ulidOrTime{ULID: ulid.MustNew(1<<40, nil)},
+					Q:     "[yz]{3}x",
+					Regex: true,
+				}, false)
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(ioutil.Discard, result.Records)
+				result.Records.Close()
+			}
+		})
+	}
+}
+
+// writeSequentialSegments writes n segments of about size bytes, each of which
+// is newer than the one before.
+func writeSequentialSegments(t testing.TB, log Log, n, size int) {
+	const recordSize = 64
+	for i := 0; i < n; i++ {
+		segment, err := log.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var low, high ulid.ULID
+		for j := 0; j < size/recordSize; j++ {
+			id := ulid.MustNew(uint64(1000+i*size+j), nil)
+			if j == 0 {
+				low = id
+			}
+			high = id
+			fmt.Fprintf(segment, "%s %s\n", id, strings.Repeat("x", recordSize-ulid.EncodedSize-2))
+		}
+		if err := segment.Close(low, high); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestConcurrentFilteringReadCloser(t *testing.T) {
 	t.Parallel()
 
@@ -494,7 +805,7 @@ func TestConcurrentFilteringReadCloser(t *testing.T) {
 			in := bytes.NewReader(input.Bytes())
 			re := regexp.MustCompile(testcase.q)
 			pass := recordFilterBoundedRegex(testcase.from, testcase.to, re)
-			rc := newConcurrentFilteringReadCloser(ioutil.NopCloser(in), pass, 1024)
+			rc := newConcurrentFilteringReadCloser(context.Background(), ioutil.NopCloser(in), pass, nil, 1024, nil, nil)
 			if want, have := testcase.want, records(rc); !reflect.DeepEqual(want, have) {
 				t.Errorf("want %v, have %v", want, have)
 			}
@@ -513,7 +824,7 @@ func TestIssue23(t *testing.T) {
 		src             = ioutil.NopCloser(strings.NewReader(input))
 		pass            = func([]byte) bool { return true }
 		pipeBufSz       = 1024 * 1024 // different than bufio.Reader bufsz
-		rc              = newConcurrentFilteringReadCloser(src, pass, int64(pipeBufSz))
+		rc              = newConcurrentFilteringReadCloser(context.Background(), src, pass, nil, int64(pipeBufSz), nil, nil)
 	)
 	output, err := ioutil.ReadAll(rc)
 	if err != nil {
@@ -542,7 +853,7 @@ func TestIssue41(t *testing.T) {
 	f.Close()
 
 	// Should not panic.
-	makeConcurrentFilteringReadClosers(filesys, segments, pass, bufsz)
+	makeConcurrentFilteringReadClosers(context.Background(), filesys, segments, pass, orderAscending, bufsz, nil, nil)
 }
 
 type mockLog struct {
@@ -553,7 +864,7 @@ func (log *mockLog) Create() (WriteSegment, error) {
 	return &mockWriteSegment{log.Buffer}, nil
 }
 
-func (log *mockLog) Query(qp QueryParams, statsOnly bool) (QueryResult, error) {
+func (log *mockLog) Query(ctx context.Context, qp QueryParams, statsOnly bool) (QueryResult, error) {
 	return QueryResult{}, errors.New("not implemented")
 }
 
@@ -565,7 +876,15 @@ func (log *mockLog) Sequential() ([]ReadSegment, error) {
 	return nil, errors.New("not implemented")
 }
 
-func (log *mockLog) Trashable(oldestRecord time.Time) ([]ReadSegment, error) {
+func (log *mockLog) Compactable(planner CompactionPlanner) ([]ReadSegment, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (log *mockLog) Trashable(oldestRecord time.Time, imported bool) ([]ReadSegment, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (log *mockLog) TrashableBySize(maxBytes int64, imported bool) ([]ReadSegment, error) {
 	return nil, errors.New("not implemented")
 }
 
@@ -573,6 +892,34 @@ func (log *mockLog) Purgeable(oldestModTime time.Time) ([]TrashSegment, error) {
 	return nil, errors.New("not implemented")
 }
 
+func (log *mockLog) Trashed() ([]TrashedSegment, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (log *mockLog) Restore(segment string) error {
+	return errors.New("not implemented")
+}
+
+func (log *mockLog) Sealed(from, to ulid.ULID) ([]SealedSegment, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (log *mockLog) Queryable(from, to ulid.ULID) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (log *mockLog) OpenSealed(segment string) (fs.File, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (log *mockLog) OpenVerified(segment string) (fs.File, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (log *mockLog) Quarantine(segment string) error {
+	return errors.New("not implemented")
+}
+
 func (log *mockLog) Stats() (LogStats, error) {
 	return LogStats{}, errors.New("not implemented")
 }
@@ -581,5 +928,7 @@ func (log *mockLog) Close() error { return nil }
 
 type mockWriteSegment struct{ *bytes.Buffer }
 
+func (mockWriteSegment) SetOrigins([]string)              {}
+func (mockWriteSegment) SetCompacted()                    {}
 func (mockWriteSegment) Close(ulid.ULID, ulid.ULID) error { return nil }
 func (mockWriteSegment) Delete() error                    { return nil }
@@ -0,0 +1,323 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+// probeTailSize is how much of the end of a plain segment is read, to find
+// its last record, when recovery probes it.
+const probeTailSize = 64 * 1024
+
+// errNotProbed is the error probing an encrypted segment whose master key is
+// gone. Queries skip those, so recovery leaves them be, too.
+var errNotProbed = errors.New("can't be decrypted, so it isn't probed")
+
+// RecoveryError is returned by NewFileLog when recovery finds segments it
+// can't make sense of without risking their records, and it isn't forced to
+// leave them as they are. Each of them is reported, with why, as it's found.
+type RecoveryError struct {
+	Root     string
+	Segments []string
+}
+
+func (e RecoveryError) Error() string {
+	return fmt.Sprintf("recovering %s: %d ambiguous segments, like %s", e.Root, len(e.Segments), e.Segments[0])
+}
+
+// recoverSegments recovers the segments in root after a crash, and reports
+// what it does with every file that's ours, as it classifies them.
+//
+// Units a crash left in the middle of being published are resolved first, by
+// their manifests; see recoverUnits. Active segments are trimmed, and flushed,
+// encrypted if keys isn't nil, like they would've been, unless they're named
+// like a segment that's queryable: those are compaction's, which it never
+// published, so they're moved to the trash, since their records are all in
+// the segments they were compacted from. Reading segments are flushed. Orphans of interrupted
+// writes, like sealing and trimming files, are moved to the trash; sidecars
+// of segments that are gone are removed, as are zero-length segments, which
+// hold nothing. Segments with malformed names are reported, and left for
+// compaction to remove. Flushed segments are probed, to check their first and
+// last records are within the bounds their names claim.
+//
+// Some segments are ambiguous: flushed segments whose records can't be read,
+// are torn, or are out of their bounds, and reading segments whose flushed
+// twins exist, which we'd rename over them. They're left as they are, and,
+// unless force is set, recovery fails with a RecoveryError, once it's
+// recovered the rest.
+func recoverSegments(filesys fs.Filesystem, root string, keys KeyWrapper, force bool, reporter EventReporter) error {
+	var (
+		corrupt                        = filepath.Join(root, corruptDir)
+		toReprocess, toRename, toTrash []string
+		toProbe, toReconcile, toRemove []string
+		ambiguous                      []string
+	)
+	report := func(path, msg string) {
+		reporter.ReportEvent(Event{Op: "recoverSegments", File: path, Msg: msg})
+	}
+	warn := func(path string, err error, msg string) {
+		reporter.ReportEvent(Event{Op: "recoverSegments", File: path, Warning: err, Msg: msg})
+	}
+	if err := recoverUnits(filesys, root, reporter); err != nil {
+		return err
+	}
+	filesys.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == corrupt && info.IsDir() {
+			return filepath.SkipDir // quarantined, not ours to recover
+		}
+		if info.IsDir() || filepath.Dir(path) == corrupt {
+			return nil // recurse
+		}
+		switch ext := filepath.Ext(path); ext {
+		case extActive, extReading, extFlushed, extSealing, extTrimming:
+			if info.Size() == 0 {
+				toRemove = append(toRemove, path)
+				break
+			}
+			switch ext {
+			case extActive:
+				toReprocess = append(toReprocess, path)
+			case extReading:
+				toRename = append(toRename, path)
+			case extFlushed:
+				toProbe = append(toProbe, path)
+			default:
+				toTrash = append(toTrash, path)
+			}
+		case extBloom, extChecksum, extLabels:
+			toReconcile = append(toReconcile, path)
+		}
+		return nil
+	})
+
+	for _, path := range toRemove {
+		if err := filesys.Remove(path); err != nil {
+			return err
+		}
+		report(path, "removed zero-length segment")
+	}
+
+	// Segments that were being compressed are incomplete. But their
+	// uncompressed originals are still around as active segments. The same
+	// goes for segments that were being trimmed. They keep their extension
+	// in the trash, so they can't be mistaken for trashed segments.
+	for _, path := range toTrash {
+		if err := filesys.Rename(path, path+extTrashed); err != nil {
+			return err
+		}
+		report(path, "moved orphan of an interrupted write to the trash")
+	}
+
+	for _, path := range toReprocess {
+		lo, hi, n, err := trimSegment(filesys, path)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			// Nothing survived.
+			if err := filesys.Remove(path); err != nil {
+				return err
+			}
+			report(path, "removed active segment without a whole record")
+			continue
+		}
+		var (
+			oldname = path
+			oldpath = filepath.Dir(oldname)
+			newname = filepath.Join(oldpath, fmt.Sprintf("%s-%s%s", lo, hi, extFlushed))
+		)
+		if filesys.Exists(newname) || filesys.Exists(modifyExtension(newname, extReading)) {
+			// Flushing it would put it alongside the other's sidecars, or
+			// over the other.
+			if err := filesys.Rename(oldname, oldname+extTrashed); err != nil {
+				return err
+			}
+			report(path, fmt.Sprintf("moved unpublished segment of %d records to the trash, as %s exists", n, newname))
+			continue
+		}
+		// A crash during compression may leave checksums of the compressed
+		// segment behind, which don't match the uncompressed one.
+		filesys.Remove(modifyExtension(newname, extChecksum))
+		if keys != nil {
+			sealing := modifyExtension(oldname, extSealing)
+			sums, err := sealSegment(filesys, oldname, sealing, false, keys)
+			if err != nil {
+				return errors.Wrapf(err, "encrypting %s", oldname)
+			}
+			writeChecksums(filesys, modifyExtension(newname, extChecksum), sums)
+			if err := filesys.Rename(sealing, newname); err != nil {
+				return err
+			}
+			if err := filesys.Remove(oldname); err != nil {
+				return err
+			}
+		} else if err := filesys.Rename(oldname, newname); err != nil {
+			return err
+		}
+		report(path, fmt.Sprintf("flushed %d records to %s", n, newname))
+	}
+
+	// It's possible this will create duplicate records.
+	// We rely on repair and compaction to remove them.
+	for _, path := range toRename {
+		var (
+			oldname = path
+			newname = modifyExtension(oldname, extFlushed)
+		)
+		if filesys.Exists(newname) {
+			warn(path, errors.New("flushed twin exists"), "won't rename it over its twin, which may hold other records")
+			ambiguous = append(ambiguous, path)
+			continue
+		}
+		if err := filesys.Rename(oldname, newname); err != nil {
+			return err
+		}
+		report(path, fmt.Sprintf("interrupted while being read, so renamed to %s", newname))
+		toProbe = append(toProbe, newname)
+	}
+
+	for _, path := range toProbe {
+		low, high, err := parseFilename(path)
+		if err != nil {
+			warn(path, err, "malformed name, so it won't be queried, and will be removed by compaction")
+			continue
+		}
+		first, last, hasLast, err := probeSegment(filesys, path, keys)
+		switch {
+		case errors.Cause(err) == errCorruptSegment:
+			warn(path, err, "will be quarantined when it's read")
+			continue
+		case errors.Cause(err) == errNotProbed:
+			warn(path, err, "its master key may be gone")
+			continue
+		case err != nil:
+		case first.Compare(low) < 0 || first.Compare(high) > 0:
+			err = errors.Errorf("first record %s is out of its bounds", first)
+		case hasLast && (last.Compare(low) < 0 || last.Compare(high) > 0):
+			err = errors.Errorf("last record %s is out of its bounds", last)
+		}
+		if err != nil {
+			warn(path, err, "its name doesn't match its records")
+			ambiguous = append(ambiguous, path)
+		}
+	}
+
+	// Sidecars are written before their segments are flushed, and removed
+	// after they're trashed, so a crash in between leaves them orphaned.
+	for _, path := range toReconcile {
+		if filesys.Exists(modifyExtension(path, extFlushed)) || filesys.Exists(modifyExtension(path, extReading)) {
+			continue
+		}
+		if err := filesys.Remove(path); err != nil {
+			return err
+		}
+		report(path, "removed sidecar of a segment that's gone")
+	}
+
+	if len(ambiguous) == 0 {
+		return nil
+	}
+	err := RecoveryError{Root: root, Segments: ambiguous}
+	if force {
+		warn(root, err, "forced to start anyway, leaving them as they are")
+		return nil
+	}
+	return err
+}
+
+// probeSegment returns the IDs of the first and last records of the flushed
+// segment at path. Plain segments are read at their start and end only, so
+// it's cheap. Sealed segments would have to be decrypted and decompressed
+// whole to get at their end, so they're read at their start only; their
+// checksums cover the rest. Then, or if the last record is longer than the
+// end that's read, hasLast is false.
+func probeSegment(filesys fs.Filesystem, path string, keys KeyWrapper) (first, last ulid.ULID, hasLast bool, err error) {
+	f, err := filesys.Open(path)
+	if err != nil {
+		return first, last, false, err
+	}
+	defer f.Close()
+	head := make([]byte, ulid.EncodedSize)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	if br := bufio.NewReader(bytes.NewReader(head)); isEncrypted(br) || isCompressed(br) {
+		first, err = probeSealedSegment(filesys, path, keys, isEncrypted(br))
+		return first, last, false, err
+	}
+	if err := first.UnmarshalText(head); err != nil {
+		return first, last, false, errors.Wrap(err, "parsing first record")
+	}
+
+	var (
+		rest    = f.Size() - int64(n)
+		skipped = rest > probeTailSize
+	)
+	if skipped {
+		if err := fs.Skip(f, rest-probeTailSize); err != nil {
+			return first, last, false, err
+		}
+	}
+	tail, err := ioutil.ReadAll(f)
+	if err != nil {
+		return first, last, false, err
+	}
+	if !skipped {
+		tail = append(head, tail...)
+	}
+	if len(tail) == 0 || tail[len(tail)-1] != '\n' {
+		return first, last, false, errors.New("last record is torn")
+	}
+	i := bytes.LastIndexByte(tail[:len(tail)-1], '\n')
+	if i < 0 && skipped {
+		return first, last, false, nil
+	}
+	record := tail[i+1:]
+	if len(record) < ulid.EncodedSize {
+		return first, last, false, errors.New("last record is too short")
+	}
+	if err := last.UnmarshalText(record[:ulid.EncodedSize]); err != nil {
+		return first, last, false, errors.Wrap(err, "parsing last record")
+	}
+	return first, last, true, nil
+}
+
+// probeSealedSegment returns the ID of the first record of the sealed segment
+// at path. If the segment fails verification, the error is errCorruptSegment;
+// if it's encrypted, and can't be decrypted, it's errNotProbed.
+func probeSealedSegment(filesys fs.Filesystem, path string, keys KeyWrapper, encrypted bool) (first ulid.ULID, err error) {
+	var corrupt bool
+	f, err := openSegmentFile(filesys, path, keys, func(string) { corrupt = true })
+	switch {
+	case err != nil && corrupt:
+		return first, errCorruptSegment
+	case err != nil && encrypted:
+		return first, errors.Wrap(errNotProbed, err.Error())
+	case err != nil:
+		return first, err
+	}
+	defer f.Close()
+	head := make([]byte, ulid.EncodedSize)
+	if _, err := io.ReadFull(f, head); err != nil {
+		if corrupt {
+			err = errCorruptSegment
+		}
+		return first, errors.Wrap(err, "reading first record")
+	}
+	if err := first.UnmarshalText(head); err != nil {
+		return first, errors.Wrap(err, "parsing first record")
+	}
+	return first, nil
+}
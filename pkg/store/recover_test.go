@@ -0,0 +1,260 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestRecoverSegmentsLayouts(t *testing.T) {
+	t.Parallel()
+
+	var (
+		id      = func(i int) ulid.ULID { return ulid.MustNew(uint64(1500000000000+i), nil) }
+		segment = func(lo, hi int) string { return fmt.Sprintf("/%s-%s", id(lo), id(hi)) }
+		records = func(ids ...int) string {
+			var s string
+			for _, i := range ids {
+				s += fmt.Sprintf("%s record %d\n", id(i), i)
+			}
+			return s
+		}
+		long = func(lo, hi int) string { // longer than the probe reads
+			s := records(lo)
+			for len(s) < 2*probeTailSize {
+				s += records(lo + 1)
+			}
+			return s + records(hi)
+		}
+	)
+	for _, testcase := range []struct {
+		name      string
+		files     map[string]string
+		force     bool
+		want      []string // files, after
+		ambiguous []string // segments in the RecoveryError, if any
+	}{
+		{
+			name: "orphans",
+			files: map[string]string{
+				segment(1, 3) + extFlushed:            records(1, 2, 3),
+				segment(1, 3) + extBloom:              "filter",
+				segment(4, 5) + extBloom:              "filter of a trashed segment",
+				segment(4, 5) + extTrashed:            records(4, 5),
+				segment(6, 7) + extChecksum:           "checksums of a segment never flushed",
+				"/compacted" + extSealing:             "incomplete",
+				"/compacted" + extActive:              records(8, 9),
+				"/torn" + extTrimming:                 records(10),
+				"/empty" + extFlushed:                 "",
+				"/empty" + extActive:                  "",
+				"/" + corruptDir + "/x" + extCorrupt:  "quarantined",
+				"/" + corruptDir + "/x" + extChecksum: "checksums of the quarantined segment",
+				"/transfers/y" + extTransfer:          "not ours",
+			},
+			want: []string{
+				segment(1, 3) + extBloom,
+				segment(1, 3) + extFlushed,
+				segment(4, 5) + extTrashed,
+				segment(8, 9) + extFlushed,
+				"/compacted" + extSealing + extTrashed,
+				"/" + corruptDir + "/x" + extCorrupt,
+				"/" + corruptDir + "/x" + extChecksum,
+				"/torn" + extTrimming + extTrashed,
+				"/transfers/y" + extTransfer,
+			},
+		},
+		{
+			name: "malformed names",
+			files: map[string]string{
+				"/malformed" + extFlushed: records(1),
+				"/malformed" + extReading: records(2),
+				"/malformed-too.ignored":  records(3),
+			},
+			want: []string{
+				"/malformed-too.ignored",
+				"/malformed" + extFlushed,
+				"/malformed" + extReading, // its flushed twin exists
+			},
+			ambiguous: []string{"/malformed" + extReading},
+		},
+		{
+			name: "reading",
+			files: map[string]string{
+				segment(1, 2) + extReading: records(1, 2),
+			},
+			want: []string{segment(1, 2) + extFlushed},
+		},
+		{
+			name: "out of bounds",
+			files: map[string]string{
+				segment(1, 3) + extFlushed: records(1, 2, 3),
+				segment(4, 5) + extFlushed: records(4, 5, 6),
+				segment(7, 8) + extReading: records(6, 7, 8),
+				segment(9, 9) + extFlushed: records(9) + id(9).String(),
+				segment(1, 9) + extFlushed: "not records\n",
+			},
+			want: []string{
+				segment(1, 3) + extFlushed,
+				segment(1, 9) + extFlushed,
+				segment(4, 5) + extFlushed,
+				segment(7, 8) + extFlushed,
+				segment(9, 9) + extFlushed,
+			},
+			ambiguous: []string{
+				segment(1, 9) + extFlushed,
+				segment(4, 5) + extFlushed,
+				segment(7, 8) + extFlushed,
+				segment(9, 9) + extFlushed,
+			},
+		},
+		{
+			name: "long",
+			files: map[string]string{
+				segment(1, 3) + extFlushed: long(1, 3),
+				segment(4, 5) + extFlushed: long(4, 6),
+			},
+			want: []string{
+				segment(1, 3) + extFlushed,
+				segment(4, 5) + extFlushed,
+			},
+			ambiguous: []string{segment(4, 5) + extFlushed},
+		},
+		{
+			name: "forced",
+			files: map[string]string{
+				segment(1, 2) + extFlushed: records(1, 2),
+				segment(1, 2) + extReading: records(1, 2),
+				segment(3, 4) + extFlushed: records(5),
+			},
+			force: true,
+			want: []string{
+				segment(1, 2) + extFlushed,
+				segment(1, 2) + extReading,
+				segment(3, 4) + extFlushed,
+			},
+		},
+	} {
+		filesys := fs.NewVirtualFilesystem()
+		for path, contents := range testcase.files {
+			f, err := filesys.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write([]byte(contents))
+			f.Close()
+		}
+
+		reporter := &eventRecorder{}
+		err := recoverSegments(filesys, "/", nil, testcase.force, reporter)
+		var ambiguous []string
+		if e, ok := err.(RecoveryError); ok {
+			ambiguous = e.Segments
+		} else if err != nil {
+			t.Errorf("%s: %v", testcase.name, err)
+			continue
+		}
+		sort.Strings(ambiguous)
+		if want, have := testcase.ambiguous, ambiguous; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: ambiguous: want %v, have %v", testcase.name, want, have)
+		}
+		if want, have := testcase.want, allFiles(filesys); !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: files: want %v, have %v", testcase.name, want, have)
+		}
+
+		// Every file that's moved, removed, or left ambiguous has its say.
+		reported := map[string]bool{}
+		for _, e := range reporter.events {
+			reported[e.File] = true
+		}
+		for path := range testcase.files {
+			if strings.HasPrefix(path, "/"+corruptDir) || strings.HasPrefix(path, "/transfers") {
+				continue
+			}
+			kept := false
+			for _, want := range testcase.want {
+				kept = kept || want == path
+			}
+			if !kept && !reported[path] {
+				t.Errorf("%s: %s is gone, but wasn't reported", testcase.name, path)
+			}
+		}
+		for _, path := range ambiguous {
+			if !reported[path] {
+				t.Errorf("%s: %s is ambiguous, but wasn't reported", testcase.name, path)
+			}
+		}
+	}
+}
+
+func TestRecoverSegmentsSealed(t *testing.T) {
+	t.Parallel()
+
+	keys, err := NewMasterKeys([][]byte{bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		filesys = fs.NewVirtualFilesystem()
+		a, b, c = ulid.MustNew(1, nil), ulid.MustNew(2, nil), ulid.MustNew(3, nil)
+		name    = func(lo, hi ulid.ULID) string { return fmt.Sprintf("/%s-%s%s", lo, hi, extFlushed) }
+	)
+	f, err := filesys.Create("/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(f, "%s One\n%s Two\n", a, b)
+	f.Close()
+
+	// Only the first record of a sealed segment is probed: the last record
+	// of the first is out of its bounds, unseen, but the first records of the
+	// others are out of theirs.
+	for _, s := range []struct {
+		name string
+		keys KeyWrapper
+	}{
+		{name(a, a), nil},
+		{name(b, c), nil},
+		{name(c, c), keys},
+	} {
+		if _, err := sealSegment(filesys, "/plain", s.name, true, s.keys); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, testcase := range []struct {
+		keys KeyWrapper
+		want []string
+	}{
+		{keys, []string{name(b, c), name(c, c)}},
+		{nil, []string{name(b, c)}}, // the encrypted one can't be probed
+	} {
+		var have []string
+		if e, ok := recoverSegments(filesys, "/", testcase.keys, false, &eventRecorder{}).(RecoveryError); ok {
+			have = e.Segments
+		}
+		sort.Strings(have)
+		if want := testcase.want; !reflect.DeepEqual(want, have) {
+			t.Errorf("keys %v: want %v, have %v", testcase.keys != nil, want, have)
+		}
+	}
+}
+
+// allFiles returns the paths of all the files in filesys, sorted.
+func allFiles(filesys fs.Filesystem) []string {
+	var files []string
+	filesys.Walk("/", func(path string, info os.FileInfo, err error) error {
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
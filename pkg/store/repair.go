@@ -0,0 +1,360 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+// Repairs compare the records held by each store node one bucket of time at a
+// time, so only a bucket of records from each node is ever held in memory.
+const defaultRepairBucket = time.Minute
+
+// maxRepairErrors is how many errors a RepairStatus keeps.
+const maxRepairErrors = 10
+
+// Repairer re-replicates records held by fewer store nodes than the
+// replication factor, e.g. after a node was replaced and lost its segments.
+// Segments are compacted independently on each node, so they're compared by
+// the records they hold, rather than by name. Repairs are idempotent: once
+// every record is sufficiently replicated, repairs do nothing.
+type Repairer struct {
+	peer              ClusterPeer
+	client            Doer
+	replicationFactor int
+	bytesPerSecond    int64
+	reporter          EventReporter
+
+	mtx    sync.Mutex
+	status RepairStatus
+	cancel context.CancelFunc
+}
+
+// RepairStatus describes the progress of a repair.
+type RepairStatus struct {
+	State           string    `json:"state"` // idle, running, done, failed, or canceled
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	Started         time.Time `json:"started"`
+	Finished        time.Time `json:"finished"`
+	BucketsTotal    int       `json:"buckets_total"`
+	BucketsDone     int       `json:"buckets_done"`
+	RecordsCompared int64     `json:"records_compared"`
+	RecordsRepaired int64     `json:"records_repaired"`
+	BytesSent       int64     `json:"bytes_sent"`
+	Errors          []string  `json:"errors"`
+}
+
+// NewRepairer returns a Repairer which sends at most bytesPerSecond of
+// repaired records to store nodes, so as not to starve regular replication.
+// If bytesPerSecond is zero, repairs aren't rate limited.
+func NewRepairer(peer ClusterPeer, client Doer, replicationFactor int, bytesPerSecond int64, reporter EventReporter) *Repairer {
+	return &Repairer{
+		peer:              peer,
+		client:            client,
+		replicationFactor: replicationFactor,
+		bytesPerSecond:    bytesPerSecond,
+		reporter:          reporter,
+		status:            RepairStatus{State: "idle"},
+	}
+}
+
+// ServeHTTP handles the repair endpoint.
+func (r *Repairer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "POST":
+		r.handleStart(w, req)
+	case "GET":
+		r.writeStatus(w, http.StatusOK)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *Repairer) handleStart(w http.ResponseWriter, req *http.Request) {
+	var from, to ulidOrTime
+	if err := from.Parse(req.URL.Query().Get("from")); err != nil {
+		http.Error(w, errors.Wrap(err, "parsing 'from'").Error(), http.StatusBadRequest)
+		return
+	}
+	if err := to.Parse(req.URL.Query().Get("to")); err != nil {
+		http.Error(w, errors.Wrap(err, "parsing 'to'").Error(), http.StatusBadRequest)
+		return
+	}
+	if !from.Time.Before(to.Time) {
+		http.Error(w, "'from' must be before 'to'", http.StatusBadRequest)
+		return
+	}
+	bucket := defaultRepairBucket
+	if s := req.URL.Query().Get("bucket"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < time.Millisecond {
+			http.Error(w, fmt.Sprintf("invalid 'bucket' %q", s), http.StatusBadRequest)
+			return
+		}
+		bucket = d
+	}
+
+	ctx, err := r.start(from.Time, to.Time, bucket)
+	if err != nil {
+		r.writeStatus(w, http.StatusConflict)
+		return
+	}
+	go r.run(ctx, from.Time, to.Time, bucket)
+	r.writeStatus(w, http.StatusAccepted)
+}
+
+func (r *Repairer) writeStatus(w http.ResponseWriter, code int) {
+	buf, err := json.MarshalIndent(r.Status(), "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write(buf)
+}
+
+// Status of the latest repair.
+func (r *Repairer) Status() RepairStatus {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	status := r.status
+	status.Errors = append([]string{}, r.status.Errors...)
+	return status
+}
+
+// Stop any running repair.
+func (r *Repairer) Stop() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// start a repair, unless one is already running.
+func (r *Repairer) start(from, to time.Time, bucket time.Duration) (context.Context, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.status.State == "running" {
+		return nil, errors.New("a repair is already running")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.status = RepairStatus{
+		State:        "running",
+		From:         from,
+		To:           to,
+		Started:      time.Now(),
+		BucketsTotal: int((to.Sub(from) + bucket - 1) / bucket),
+	}
+	return ctx, nil
+}
+
+func (r *Repairer) run(ctx context.Context, from, to time.Time, bucket time.Duration) {
+	var (
+		limiter = newThrottle(r.bytesPerSecond)
+		state   = "done"
+	)
+	for begin := from; begin.Before(to); begin = begin.Add(bucket) {
+		if ctx.Err() != nil {
+			state = "canceled"
+			break
+		}
+		end := begin.Add(bucket)
+		if end.After(to) {
+			end = to
+		}
+		if err := r.repairBucket(ctx, begin, end, limiter); err != nil {
+			r.update(func(s *RepairStatus) { s.addError(err) })
+			r.reporter.ReportEvent(Event{
+				Op: "repair", Error: err,
+				Msg: fmt.Sprintf("repairing %s to %s", begin.Format(time.RFC3339Nano), end.Format(time.RFC3339Nano)),
+			})
+			state = "failed" // but try the other buckets
+		}
+		r.update(func(s *RepairStatus) { s.BucketsDone++ })
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.status.State = state
+	r.status.Finished = time.Now()
+	r.cancel()
+	r.cancel = nil
+}
+
+func (r *Repairer) update(f func(*RepairStatus)) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	f(&r.status)
+}
+
+func (s *RepairStatus) addError(err error) {
+	if len(s.Errors) < maxRepairErrors {
+		s.Errors = append(s.Errors, err.Error())
+	}
+}
+
+// repairBucket gathers the records in [begin, end) from every store node,
+// and replicates each record held by too few of them to enough of the others.
+func (r *Repairer) repairBucket(ctx context.Context, begin, end time.Time, limiter *throttle) error {
+	peers := r.peer.Current(cluster.PeerTypeStore)
+	sort.Strings(peers)
+	if len(peers) <= 0 {
+		return errors.New("no store nodes available")
+	}
+
+	// Which nodes hold which records? If we can't ask all of them, we can't
+	// tell if a record is missing, so we don't try.
+	type holding struct {
+		record  []byte
+		holders map[int]bool
+	}
+	records := map[string]*holding{}
+	for i, hostport := range peers {
+		err := r.gather(ctx, hostport, begin, end, func(record []byte) {
+			id := string(record[:ulid.EncodedSize])
+			h, ok := records[id]
+			if !ok {
+				h = &holding{record: record, holders: map[int]bool{}}
+				records[id] = h
+			}
+			h.holders[i] = true
+		})
+		if err != nil {
+			return errors.Wrapf(err, "gathering records from %s", hostport)
+		}
+	}
+	r.update(func(s *RepairStatus) { s.RecordsCompared += int64(len(records)) })
+
+	// With fewer nodes than the replication factor, every node should hold
+	// every record.
+	want := r.replicationFactor
+	if want > len(peers) {
+		want = len(peers)
+	}
+
+	// Choose nodes for each under-replicated record, the way the consumer
+	// chooses them for segments, preferring zones which lack the record, and
+	// batch them by node, in ULID order.
+	zones := r.peer.Zones(cluster.PeerTypeStore)
+	ids := make([]string, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	batches := make([]bytes.Buffer, len(peers))
+	counts := make([]int64, len(peers))
+	for _, id := range ids {
+		h := records[id]
+		if len(h.holders) >= want {
+			continue
+		}
+		var lacking, holders []string
+		for i, hostport := range peers {
+			if h.holders[i] {
+				holders = append(holders, hostport)
+			} else {
+				lacking = append(lacking, hostport)
+			}
+		}
+		targets := spreadZones(rankPeers(lacking, []byte(id)), zones, holders)
+		for _, hostport := range targets[:want-len(h.holders)] {
+			i := sort.SearchStrings(peers, hostport)
+			batches[i].Write(h.record)
+			counts[i]++
+		}
+	}
+
+	// Send each batch as a segment, just like regular replication.
+	for i := range batches {
+		if batches[i].Len() == 0 {
+			continue
+		}
+		if err := limiter.wait(ctx, int64(batches[i].Len())); err != nil {
+			return err
+		}
+		if err := r.replicate(ctx, peers[i], batches[i].Bytes()); err != nil {
+			return errors.Wrapf(err, "replicating to %s", peers[i])
+		}
+		n := int64(batches[i].Len())
+		r.update(func(s *RepairStatus) {
+			s.RecordsRepaired += counts[i]
+			s.BytesSent += n
+		})
+	}
+	return nil
+}
+
+// gather every record in [begin, end) held by the store node at hostport.
+func (r *Repairer) gather(ctx context.Context, hostport string, begin, end time.Time, f func(record []byte)) error {
+	// Query by ULID, with a To just before end, which is inclusive.
+	var (
+		from = ulidutil.Min(ulid.Timestamp(begin))
+		to   = ulidutil.Min(ulid.Timestamp(end) - 1)
+	)
+	u := url.URL{
+		Scheme:   "http",
+		Host:     hostport,
+		Path:     fmt.Sprintf("/store%s", APIPathInternalQuery),
+		RawQuery: url.Values{"from": {from.String()}, "to": {to.String()}}.Encode(),
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		buf, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("%s (%s)", resp.Status, strings.TrimSpace(string(buf)))
+	}
+	s := record.NewScanner(resp.Body)
+	s.Split(scanLinesPreserveNewline)
+	for s.Scan() {
+		if len(s.Bytes()) <= ulid.EncodedSize {
+			continue
+		}
+		f(append([]byte{}, s.Bytes()...))
+	}
+	return s.Err()
+}
+
+func (r *Repairer) replicate(ctx context.Context, hostport string, segment []byte) error {
+	u := fmt.Sprintf("http://%s/store%s", hostport, APIPathReplicate)
+	req, err := http.NewRequest("POST", u, bytes.NewReader(segment))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/binary")
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		buf, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("%s (%s)", resp.Status, strings.TrimSpace(string(buf)))
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestRepair(t *testing.T) {
+	t.Parallel()
+
+	// Three store nodes: one with every record, one with a few of them, and
+	// one which lost all of its segments.
+	var (
+		all  = []string{recordA, recordB, recordC, recordD, recordE, recordF, recordG, recordH, recordI}
+		apis []*API
+		urls []string
+		addr []string
+	)
+	for _, records := range []string{
+		strings.Join(all, ""),
+		recordA + recordB + recordC,
+		"",
+	} {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		if records != "" {
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(records)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+			}
+		}
+		apis = append(apis, a)
+		urls = append(urls, server.URL)
+		addr = append(addr, strings.TrimPrefix(server.URL, "http://"))
+	}
+
+	repairer := NewRepairer(staticPeer(addr), http.DefaultClient, 2, 0, LogReporter{log.NewNopLogger()})
+	defer repairer.Stop()
+	server := httptest.NewServer(http.StripPrefix("/store", repairer))
+	defer server.Close()
+
+	// The records span about three and a half minutes, from 15:59:40Z.
+	repair := func() RepairStatus {
+		resp, err := http.Post(fmt.Sprintf(
+			"%s/store%s?from=%s&to=%s&bucket=1m",
+			server.URL,
+			APIPathRepair,
+			"2017-03-14T15:59:00Z",
+			"2017-03-14T16:04:00Z",
+		), "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want, have := http.StatusAccepted, resp.StatusCode; want != have {
+			t.Fatalf("POST: want HTTP %d, have %d", want, have)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			resp, err := http.Get(fmt.Sprintf("%s/store%s", server.URL, APIPathRepair))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var status RepairStatus
+			err = json.NewDecoder(resp.Body).Decode(&status)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.State != "running" {
+				return status
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("repair didn't finish: %+v", status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	status := repair()
+	if want, have := "done", status.State; want != have {
+		t.Fatalf("state: want %q, have %q (%v)", want, have, status.Errors)
+	}
+	if want, have := 5, status.BucketsDone; want != have {
+		t.Errorf("buckets done: want %d, have %d", want, have)
+	}
+	if want, have := int64(len(all)), status.RecordsCompared; want != have {
+		t.Errorf("records compared: want %d, have %d", want, have)
+	}
+	if want, have := int64(len(all)-3), status.RecordsRepaired; want != have {
+		t.Errorf("records repaired: want %d, have %d", want, have)
+	}
+
+	// Every record is now held by two nodes.
+	holders := map[string]int{}
+	for _, u := range urls {
+		resp, err := http.Get(fmt.Sprintf(
+			"%s/store%s?from=%s&to=%s",
+			u,
+			APIPathInternalQuery,
+			"01BB6RQR190000000000000000", // A
+			"01BB6RXQ090000000000000000", // I
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var qr QueryResult
+		if err := qr.DecodeFrom(resp); err != nil {
+			t.Fatal(err)
+		}
+		buf, _ := ioutil.ReadAll(qr.Records)
+		qr.Records.Close()
+		for _, record := range strings.SplitAfter(string(buf), "\n") {
+			if record != "" {
+				holders[record]++
+			}
+		}
+	}
+	for _, record := range all {
+		if want, have := 2, holders[record]; want != have {
+			t.Errorf("%q: want %d holders, have %d", strings.TrimSpace(record), want, have)
+		}
+	}
+
+	// Repairs are idempotent.
+	status = repair()
+	if want, have := "done", status.State; want != have {
+		t.Fatalf("state: want %q, have %q (%v)", want, have, status.Errors)
+	}
+	if want, have := int64(0), status.RecordsRepaired; want != have {
+		t.Errorf("repeated repair: records repaired: want %d, have %d", want, have)
+	}
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+// streamReplayOverlap is how far back, from the start of a replay, replayed
+// records are remembered so that duplicates on the live stream can be
+// dropped. Replicated segments are matched against live queries as soon as
+// they're written, so duplicates should only appear among recent records.
+const streamReplayOverlap = time.Minute
+
+// parseSince returns the since query parameter of a streaming query, which
+// resumes the stream after the given ULID.
+func parseSince(u *url.URL) (id ulid.ULID, ok bool, err error) {
+	s := u.Query().Get("since")
+	if s == "" {
+		return id, false, nil
+	}
+	id, err = ulid.Parse(s)
+	if err != nil {
+		return id, false, errors.Wrap(err, "parsing 'since'")
+	}
+	return id, true, nil
+}
+
+// resumeStream returns a chan of records, each with a trailing newline. It
+// first replays records from the log matching the query, with ULIDs greater
+// than since. Then it forwards records from the live chan, except those with
+// ULIDs not greater than since, and recent records that were already
+// replayed. The returned chan is closed when the live chan is closed, or if
+// the replay fails.
+func resumeStream(ctx context.Context, log Log, qp QueryParams, since ulid.ULID, live <-chan []byte, reporter EventReporter) <-chan []byte {
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		sinceBytes, _ := since.MarshalText()
+		replayed, err := replaySince(ctx, log, qp, sinceBytes, time.Now().Add(-streamReplayOverlap), out)
+		if err != nil {
+			reporter.ReportEvent(Event{Op: "resumeStream", Error: err, Msg: "replay failed; the client should reconnect"})
+			return
+		}
+		for record := range live {
+			if len(record) < ulid.EncodedSize || bytes.Compare(record[:ulid.EncodedSize], sinceBytes) <= 0 {
+				continue // the caller already has it
+			}
+			if _, ok := replayed[string(record[:ulid.EncodedSize])]; ok {
+				continue // replayed
+			}
+			out <- record
+		}
+	}()
+	return out
+}
+
+// replaySince sends records to out, and returns the ULIDs of replayed records
+// newer than the overlap time.
+func replaySince(ctx context.Context, log Log, qp QueryParams, since []byte, overlap time.Time, out chan<- []byte) (map[string]struct{}, error) {
+	qp.Backward = false // replay in order, oldest first
+	qp.From = ulidOrTime{}
+	if err := qp.From.Parse(string(since)); err != nil {
+		return nil, err
+	}
+	// Up to the end of this millisecond, as records of it written before the
+	// live stream was registered don't come live.
+	qp.To = ulidOrTime{Time: time.Now()}
+	qp.To.ULID = ulidutil.Max(ulid.Timestamp(qp.To.Time))
+	result, err := log.Query(ctx, qp, false)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Records.Close()
+
+	var (
+		overlapBytes, _ = ulidutil.Min(ulid.Timestamp(overlap)).MarshalText()
+		replayed        = map[string]struct{}{}
+		s               = record.NewScanner(result.Records)
+	)
+	s.Split(scanLinesPreserveNewline)
+	for s.Scan() {
+		record := s.Bytes()
+		if len(record) < ulid.EncodedSize || bytes.Compare(record[:ulid.EncodedSize], since) <= 0 {
+			continue // the caller already has it
+		}
+		if bytes.Compare(record[:ulid.EncodedSize], overlapBytes) >= 0 {
+			replayed[string(record[:ulid.EncodedSize])] = struct{}{}
+		}
+		select {
+		case out <- []byte(s.Text()): // copy the record out of the Scanner
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return replayed, s.Err()
+}
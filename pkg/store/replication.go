@@ -0,0 +1,150 @@
+package store
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/mergelog"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+// reportReplication is the report parameter of a user query that asks for a
+// ReplicationReport, in place of the records.
+const reportReplication = "replication"
+
+// parseReport returns the report a user query asks for, with the report
+// parameter, or "" if it doesn't.
+func parseReport(u *url.URL) (string, error) {
+	switch report := u.Query().Get("report"); report {
+	case reportReplication, "":
+		return report, nil
+	default:
+		return "", errors.Errorf("parsing 'report': %q isn't replication", report)
+	}
+}
+
+// parseDedup returns whether a user query's records are deduplicated, as they
+// are unless the dedup parameter is false.
+func parseDedup(u *url.URL) (bool, error) {
+	s := u.Query().Get("dedup")
+	if s == "" {
+		return true, nil
+	}
+	dedup, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, errors.Errorf("parsing 'dedup': %q isn't a boolean", s)
+	}
+	return dedup, nil
+}
+
+// ReplicaCounts counts records by how many nodes returned them.
+type ReplicaCounts struct {
+	One  int64 `json:"1"`
+	Two  int64 `json:"2"`
+	More int64 `json:"3+"`
+}
+
+func (c *ReplicaCounts) add(nodes int) {
+	switch {
+	case nodes <= 1:
+		c.One++
+	case nodes == 2:
+		c.Two++
+	default:
+		c.More++
+	}
+}
+
+// ReplicationBucket counts the records of a span of time, from Start for the
+// bucket duration, as HistogramBucket does, by how many nodes returned them.
+type ReplicationBucket struct {
+	Start time.Time `json:"start"`
+	ReplicaCounts
+}
+
+// ReplicationReport is the result of a user query with report=replication:
+// how many nodes returned each record, of every node queried, each reading
+// everything it has of the range. Records returned by fewer nodes than the
+// replication factor are under-replicated, or were written since the query
+// began. Buckets are by the histogram parameter, if it's given.
+type ReplicationReport struct {
+	NodesQueried int                 `json:"nodes_queried"`
+	Records      ReplicaCounts       `json:"records"`
+	Buckets      []ReplicationBucket `json:"buckets,omitempty"`
+}
+
+// replicationReport counts the records read from the readers, one per node,
+// each deduplicated, and in the order, by how many of them returned each, in
+// buckets from one time to another, if bucket is nonzero.
+func replicationReport(readers []io.Reader, order recordOrder, from, to ulid.ULID, bucket time.Duration) (ReplicationReport, error) {
+	var (
+		report = ReplicationReport{NodesQueried: len(readers)}
+		lo     = int64(from.Time())
+		width  = int64(bucket / time.Millisecond)
+	)
+	if bucket > 0 {
+		report.Buckets = make([]ReplicationBucket, histogramBuckets(from, to, bucket))
+		for i := range report.Buckets {
+			report.Buckets[i].Start = ulidutil.TimeOf(from).Add(time.Duration(i) * bucket)
+		}
+	}
+	count := func(id ulid.ULID, nodes int) {
+		report.Records.add(nodes)
+		if len(report.Buckets) == 0 {
+			return
+		}
+		ms := int64(id.Time())
+		if ms < lo || ms > int64(to.Time()) {
+			return
+		}
+		i := (ms - lo) / width
+		if i >= int64(len(report.Buckets)) {
+			i = int64(len(report.Buckets)) - 1
+		}
+		report.Buckets[i].add(nodes)
+	}
+
+	// Every node's copy of a record is merged, one after another.
+	var (
+		m     = mergelog.NewMerger(mergelog.Options{Descending: order == orderDescending, KeepDuplicates: true}, readers...)
+		last  ulid.ULID
+		nodes int
+	)
+	for m.Next() {
+		if nodes > 0 && m.ID() == last {
+			nodes++
+			continue
+		}
+		if nodes > 0 {
+			count(last, nodes)
+		}
+		last, nodes = m.ID(), 1
+	}
+	if nodes > 0 {
+		count(last, nodes)
+	}
+	return report, m.Err()
+}
+
+// encodeReplicationTo writes the report to the HTTP response writer as JSON,
+// in place of the records of the QueryResult, which must be nil. The headers
+// are the same as EncodeTo's.
+func (qr *QueryResult) encodeReplicationTo(w http.ResponseWriter, report ReplicationReport) {
+	qr.encodeHeaders(w)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if qr.ErrorCount > 0 {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	buf, err := json.Marshal(report)
+	if err != nil {
+		panic(err) // reports always marshal
+	}
+	w.Write(append(buf, '\n'))
+}
@@ -0,0 +1,232 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+func TestAPIUserQueryReplication(t *testing.T) {
+	t.Parallel()
+
+	// Three nodes, whose replicas have diverged: A is on every one, B on
+	// two, and C on just one.
+	var (
+		peers   = make(staticPeer, 3)
+		apis    = make([]*API, 3)
+		servers = make([]*httptest.Server, 3)
+	)
+	for i := range peers {
+		apis[i], servers[i] = newStreamFixture(t, peers)
+		defer servers[i].Close()
+		defer apis[i].Close()
+		peers[i] = strings.TrimPrefix(servers[i].URL, "http://")
+	}
+	for i, records := range []string{recordA + recordB + recordC, recordA + recordB, recordA} {
+		w := httptest.NewRecorder()
+		apis[i].ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(records)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate %d failed: HTTP %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	query := func(params string) []byte {
+		resp, err := http.Get(fmt.Sprintf(
+			"%s/store%s?from=%s&to=%s%s",
+			servers[0].URL,
+			APIPathUserQuery,
+			"2017-03-14T15:59:00Z",
+			"2017-03-14T16:01:00Z",
+			params,
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		buf, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: HTTP %d: %s", params, resp.StatusCode, buf)
+		}
+		return buf
+	}
+
+	for _, testcase := range []struct {
+		params string
+		want   ReplicationReport
+	}{
+		{
+			params: "&report=replication",
+			want: ReplicationReport{
+				NodesQueried: 3,
+				Records:      ReplicaCounts{One: 1, Two: 1, More: 1},
+			},
+		},
+		{
+			params: "&report=replication&histogram=1m&limit=1", // counts every record
+			want: ReplicationReport{
+				NodesQueried: 3,
+				Records:      ReplicaCounts{One: 1, Two: 1, More: 1},
+				Buckets: []ReplicationBucket{
+					{Start: time.Date(2017, 3, 14, 15, 59, 0, 0, time.UTC), ReplicaCounts: ReplicaCounts{More: 1}},
+					{Start: time.Date(2017, 3, 14, 16, 0, 0, 0, time.UTC), ReplicaCounts: ReplicaCounts{One: 1, Two: 1}},
+				},
+			},
+		},
+		{
+			params: "&report=replication&q=B",
+			want: ReplicationReport{
+				NodesQueried: 3,
+				Records:      ReplicaCounts{Two: 1},
+			},
+		},
+	} {
+		var have ReplicationReport
+		if err := json.Unmarshal(query(testcase.params), &have); err != nil {
+			t.Fatalf("%s: %v", testcase.params, err)
+		}
+		for i := range have.Buckets {
+			have.Buckets[i].Start = have.Buckets[i].Start.UTC()
+		}
+		if want := testcase.want; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %+v, have %+v", testcase.params, want, have)
+		}
+	}
+
+	// Without deduplication, every replica is returned, in order.
+	if want, have := recordA+recordA+recordA+recordB+recordB+recordC, string(query("&dedup=false")); want != have {
+		t.Errorf("dedup=false: want %q, have %q", want, have)
+	}
+	if want, have := recordA+recordB+recordC, string(query("&dedup=true")); want != have {
+		t.Errorf("dedup=true: want %q, have %q", want, have)
+	}
+}
+
+func TestAPIUserQueryOrigin(t *testing.T) {
+	t.Parallel()
+
+	// Two nodes, with a replica of A each, and B on just the second.
+	var (
+		peers   = make(staticPeer, 2)
+		apis    = make([]*API, 2)
+		servers = make([]*httptest.Server, 2)
+	)
+	for i := range peers {
+		apis[i], servers[i] = newStreamFixture(t, peers)
+		defer servers[i].Close()
+		defer apis[i].Close()
+		peers[i] = strings.TrimPrefix(servers[i].URL, "http://")
+	}
+	for i, records := range []string{recordA, recordA + recordB} {
+		w := httptest.NewRecorder()
+		apis[i].ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(records)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate %d failed: HTTP %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	query := func(params string) string {
+		resp, err := http.Get(fmt.Sprintf(
+			"%s/store%s?from=%s&to=%s&annotate=origin%s",
+			servers[0].URL,
+			APIPathUserQuery,
+			"2017-03-14T15:59:00Z",
+			"2017-03-14T16:01:00Z",
+			params,
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		buf, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: HTTP %d: %s", params, resp.StatusCode, buf)
+		}
+		return string(buf)
+	}
+
+	// Each node annotates its records as its own, of the segment it
+	// replicated them to.
+	var (
+		segmentA = "01BB6RQR190000000000000000-01BB6RQR190000000000000000"
+		segmentB = "01BB6RQR190000000000000000-01BB6RRTB70000000000000000"
+		origin   = func(node int, segment string) string {
+			return fmt.Sprintf("[node=%s seg=%s] ", peers[node], segment)
+		}
+		annotated = func(record, origin string) string {
+			return record[:ulid.EncodedSize+1] + origin + record[ulid.EncodedSize+1:]
+		}
+	)
+	want := []string{
+		annotated(recordA, origin(0, segmentA)),
+		annotated(recordA, origin(1, segmentB)),
+		annotated(recordB, origin(1, segmentB)),
+		"",
+	}
+	sort.Strings(want[:2]) // the replicas of A are in either order
+	have := strings.SplitAfter(query("&dedup=false"), "\n")
+	if len(have) > 2 {
+		sort.Strings(have[:2])
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("dedup=false: want %q, have %q", want, have)
+	}
+
+	// Deduplicated, by ULID, different origins and all, one of the replicas
+	// of A is returned, as it was annotated.
+	records := strings.SplitAfter(query(""), "\n")
+	if want, have := 3, len(records); want != have {
+		t.Fatalf("want %d records, have %d: %q", want, have, records)
+	}
+	if a0, a1 := annotated(recordA, origin(0, segmentA)), annotated(recordA, origin(1, segmentB)); records[0] != a0 && records[0] != a1 {
+		t.Errorf("want %q or %q, have %q", a0, a1, records[0])
+	}
+	if want, have := annotated(recordB, origin(1, segmentB)), records[1]; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+
+	// As JSON, the origin is a field of its own, not part of the record.
+	var record jsonRecord
+	if err := json.Unmarshal([]byte(query("&q=B&format=json")), &record); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "node="+peers[1]+" seg="+segmentB, record.Origin; want != have {
+		t.Errorf("json: want origin %q, have %q", want, have)
+	}
+	if want, have := strings.TrimSpace(recordB[ulid.EncodedSize+1:]), record.Record; want != have {
+		t.Errorf("json: want record %q, have %q", want, have)
+	}
+}
+
+func TestAPIUserQueryBadReport(t *testing.T) {
+	t.Parallel()
+
+	a, server := newStreamFixture(t, staticPeer{})
+	defer server.Close()
+	defer a.Close()
+
+	for _, params := range []string{
+		"&report=consistency",
+		"&report=replication&stats",
+		"&report=replication&download=gzip",
+		"&dedup=maybe",
+		"&annotate=node",
+	} {
+		resp, err := http.Get(fmt.Sprintf("%s/store%s?from=-1h&to=now%s", server.URL, APIPathUserQuery, params))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want, have := http.StatusBadRequest, resp.StatusCode; want != have {
+			t.Errorf("%s: want HTTP %d, have %d", params, want, have)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+// segmentIndex tracks the ULID range of every queryable segment, i.e. every
+// flushed or reading segment, so that queries needn't walk the filesystem,
+// and can skip segments outside of their time range without opening them.
+//
+// Segments move between the flushed and reading states during compaction
+// and trashing, but stay in the index until they're trashed or purged. And
+// compaction closes, and so indexes, a new segment before it purges the
+// segments it replaces. So records are never invisible to queries.
+type segmentIndex struct {
+	mtx      sync.RWMutex
+	segments []indexedSegment // sorted by low ULID
+	longest  uint64           // widest segment ever added, in ms
+
+	// changed, if set, is called with the range of every segment added to
+	// or removed from the index, with the lock held.
+	changed func(low, high ulid.ULID)
+}
+
+type indexedSegment struct {
+	path      string // ULID-ULID.extension
+	low, high ulid.ULID
+	size      int64 // logical, i.e. uncompressed
+}
+
+func newSegmentIndex() *segmentIndex {
+	return &segmentIndex{}
+}
+
+// rebuild the index from the segments in the filesystem. Segments added to
+// the filesystem by anyone other than this process are only picked up here.
+func (idx *segmentIndex) rebuild(filesys fs.Filesystem, root string, reporter EventReporter) {
+	var segments []indexedSegment
+	filesys.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil // descend
+		}
+		// We should query .reading segments, too.
+		// Better to get duplicates than miss records.
+		if ext := filepath.Ext(path); !(ext == extFlushed || ext == extReading) {
+			return nil // skip
+		}
+		low, high, err := parseFilename(path)
+		if err != nil {
+			reporter.ReportEvent(Event{
+				Op: "rebuildSegmentIndex", File: path, Warning: err,
+				Msg: fmt.Sprintf("won't query apparently-bad data file of size %d", info.Size()),
+			})
+			return nil // weird; skip
+		}
+		size, err := logicalSize(filesys, path, info.Size())
+		if err != nil {
+			reporter.ReportEvent(Event{
+				Op: "rebuildSegmentIndex", File: path, Warning: err,
+				Msg: "failed to learn logical size, using size on disk",
+			})
+			size = info.Size()
+		}
+		segments = append(segments, indexedSegment{path, low, high, size})
+		return nil
+	})
+	sort.Slice(segments, func(i, j int) bool { return segments[i].less(segments[j]) })
+
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	idx.segments = segments
+	idx.longest = 0
+	for _, s := range segments {
+		idx.widen(s)
+	}
+}
+
+// add a segment by its path and logical size.
+// Paths that don't parse are ignored.
+func (idx *segmentIndex) add(path string, size int64) {
+	if idx == nil {
+		return
+	}
+	low, high, err := parseFilename(path)
+	if err != nil {
+		return
+	}
+	s := indexedSegment{path, low, high, size}
+
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	i := sort.Search(len(idx.segments), func(i int) bool { return !idx.segments[i].less(s) })
+	idx.segments = append(idx.segments, indexedSegment{})
+	copy(idx.segments[i+1:], idx.segments[i:])
+	idx.segments[i] = s
+	idx.widen(s)
+	if idx.changed != nil {
+		idx.changed(low, high)
+	}
+}
+
+// rename a segment, e.g. from flushed to reading, keeping it in the index.
+func (idx *segmentIndex) rename(oldpath, newpath string) {
+	if idx == nil {
+		return
+	}
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	for i := range idx.segments {
+		if idx.segments[i].path == oldpath {
+			idx.segments[i].path = newpath
+			return
+		}
+	}
+}
+
+// len returns the number of indexed segments.
+func (idx *segmentIndex) len() int {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	return len(idx.segments)
+}
+
+// newest returns the low ULID of the newest segment, i.e. the one with the
+// newest oldest record, if there are any segments.
+func (idx *segmentIndex) newest() (ulid.ULID, bool) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	if len(idx.segments) == 0 {
+		return ulid.ULID{}, false
+	}
+	return idx.segments[len(idx.segments)-1].low, true
+}
+
+// sizes returns the logical size of every segment, by path.
+func (idx *segmentIndex) sizes() map[string]int64 {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	sizes := make(map[string]int64, len(idx.segments))
+	for _, s := range idx.segments {
+		sizes[s.path] = s.size
+	}
+	return sizes
+}
+
+// remove a segment from the index.
+func (idx *segmentIndex) remove(path string) {
+	if idx == nil {
+		return
+	}
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	for i := range idx.segments {
+		if s := idx.segments[i]; s.path == path {
+			idx.segments = append(idx.segments[:i], idx.segments[i+1:]...)
+			if idx.changed != nil {
+				idx.changed(s.low, s.high)
+			}
+			return
+		}
+	}
+}
+
+// overlapping returns the paths of all segments overlapping the given range,
+// ordered by their low ULID.
+func (idx *segmentIndex) overlapping(from, to ulid.ULID) []string {
+	if from.Compare(to) > 0 {
+		from, to = to, from
+	}
+
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	// Segments are sorted by low ULID, so segments starting after the end
+	// of the range can be skipped without looking at them. And no segment
+	// is wider than the longest, so neither can segments starting too long
+	// before the beginning of the range.
+	var (
+		fromTime = from.Time()
+		begin    = sort.Search(len(idx.segments), func(i int) bool {
+			return idx.segments[i].low.Time()+idx.longest >= fromTime
+		})
+		end = sort.Search(len(idx.segments), func(i int) bool {
+			return idx.segments[i].low.Compare(to) > 0
+		})
+		paths []string
+	)
+	for i := begin; i < end; i++ {
+		if s := idx.segments[i]; s.high.Compare(from) >= 0 {
+			paths = append(paths, s.path)
+		}
+	}
+	return paths
+}
+
+// widen the longest segment span, if necessary. Spans never narrow, even
+// when the widest segment is removed, which only makes queries a bit slower.
+func (idx *segmentIndex) widen(s indexedSegment) {
+	if s.high.Time() > s.low.Time() && s.high.Time()-s.low.Time() > idx.longest {
+		idx.longest = s.high.Time() - s.low.Time()
+	}
+}
+
+func (s indexedSegment) less(other indexedSegment) bool {
+	if c := s.low.Compare(other.low); c != 0 {
+		return c < 0
+	}
+	return strings.Compare(s.path, other.path) < 0
+}
@@ -0,0 +1,224 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestQueryOpensOnlyOverlappingSegments(t *testing.T) {
+	t.Parallel()
+
+	// A day of hourly segments, with one record each.
+	var (
+		filesys = &openRecorder{Filesystem: fs.NewVirtualFilesystem()}
+		now     = time.Now()
+		entropy = rand.New(rand.NewSource(1))
+		mkulid  = func(t time.Time) ulid.ULID { return ulid.MustNew(ulid.Timestamp(t), entropy) }
+	)
+	filelog, err := NewFileLog(filesys, "/", 1024, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+
+	var lastHour []string
+	for i := 24; i > 0; i-- {
+		id := mkulid(now.Add(-time.Duration(i) * time.Hour).Add(time.Minute))
+		segment, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(segment, "%s record %d\n", id, i)
+		if err := segment.Close(id, id); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			lastHour = append(lastHour,
+				fmt.Sprintf("/%s-%s%s", id, id, extChecksum),
+				fmt.Sprintf("/%s-%s%s", id, id, extFlushed),
+			)
+		}
+	}
+
+	result, err := filelog.Query(context.Background(), QueryParams{
+		From: ulidOrTime{ULID: mkulid(now.Add(-time.Hour))},
+		To:   ulidOrTime{ULID: mkulid(now)},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := ioutil.ReadAll(result.Records)
+	result.Records.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := 1, strings.Count(string(records), "\n"); want != have {
+		t.Errorf("records: want %d, have %d (%q)", want, have, records)
+	}
+	if want, have := lastHour, filesys.opened(); !reflect.DeepEqual(want, have) {
+		t.Errorf("opened: want %v, have %v", want, have)
+	}
+}
+
+func TestSegmentIndexFollowsCompaction(t *testing.T) {
+	t.Parallel()
+
+	filesys := fs.NewVirtualFilesystem()
+	filelog, err := NewFileLog(filesys, "/", 1024, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+
+	var (
+		t0      = time.Now().Add(-time.Minute)
+		entropy = rand.New(rand.NewSource(2))
+	)
+	for i := 0; i < 3; i++ {
+		id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Second)), entropy)
+		segment, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(segment, "%s record %d\n", id, i)
+		if err := segment.Close(id, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := func() int {
+		result, err := filelog.Query(context.Background(), QueryParams{
+			From: ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(t0.Add(-time.Minute)), nil)},
+			To:   ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(time.Now()), nil)},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer result.Records.Close()
+		records, err := ioutil.ReadAll(result.Records)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(records), "\n")
+	}
+
+	// Segments being compacted or trashed are still queryable.
+	readSegments, err := filelog.Sequential()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 3, count(); want != have {
+		t.Fatalf("while reading: want %d, have %d", want, have)
+	}
+
+	// Reset segments are flushed again.
+	if err := readSegments[0].Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 3, count(); want != have {
+		t.Fatalf("after Reset: want %d, have %d", want, have)
+	}
+
+	// Trashed and purged segments aren't.
+	if err := readSegments[1].Trash(); err != nil {
+		t.Fatal(err)
+	}
+	if err := readSegments[2].Purge(); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 1, count(); want != have {
+		t.Fatalf("after Trash and Purge: want %d, have %d", want, have)
+	}
+}
+
+func TestSegmentIndexOverlapping(t *testing.T) {
+	t.Parallel()
+
+	var (
+		idx    = newSegmentIndex()
+		t0     = time.Now()
+		mkulid = func(i int) ulid.ULID { return ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Second)), nil) }
+		mkpath = func(a, b int) string { return fmt.Sprintf("%s-%s%s", mkulid(a), mkulid(b), extFlushed) }
+	)
+	// Added out of order, to check they come back sorted by low ULID.
+	for _, path := range []string{mkpath(20, 30), mkpath(0, 10), mkpath(5, 25), mkpath(40, 50)} {
+		idx.add(path, 0)
+	}
+
+	for _, testcase := range []struct {
+		name     string
+		from, to int
+		want     []string
+	}{
+		{"none", 31, 39, nil},
+		{"one", 41, 42, []string{mkpath(40, 50)}},
+		{"edges", 10, 20, []string{mkpath(0, 10), mkpath(5, 25), mkpath(20, 30)}},
+		{"all", -10, 60, []string{mkpath(0, 10), mkpath(5, 25), mkpath(20, 30), mkpath(40, 50)}},
+		{"inverted", 42, 41, []string{mkpath(40, 50)}},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			have := idx.overlapping(mkulid(testcase.from), mkulid(testcase.to))
+			if want := testcase.want; !reflect.DeepEqual(want, have) {
+				t.Fatalf("want %v, have %v", want, have)
+			}
+		})
+	}
+}
+
+func BenchmarkSegmentIndexOverlapping(b *testing.B) {
+	// Ten thousand segments, spanning a minute each, and a query over the
+	// last hour of them.
+	var (
+		idx    = newSegmentIndex()
+		t0     = time.Now().Add(-10000 * time.Minute)
+		mkulid = func(i int) ulid.ULID { return ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Minute)), nil) }
+	)
+	for i := 0; i < 10000; i++ {
+		idx.add(filepath.Join("/", fmt.Sprintf("%s-%s%s", mkulid(i), mkulid(i+1), extFlushed)), 0)
+	}
+	from, to := mkulid(10000-60), mkulid(10000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if want, have := 61, len(idx.overlapping(from, to)); want != have {
+			b.Fatalf("want %d, have %d", want, have)
+		}
+	}
+}
+
+// openRecorder records the paths of all files opened through it.
+type openRecorder struct {
+	fs.Filesystem
+	mtx   sync.Mutex
+	paths []string
+}
+
+func (r *openRecorder) Open(path string) (fs.File, error) {
+	r.mtx.Lock()
+	r.paths = append(r.paths, path)
+	r.mtx.Unlock()
+	return r.Filesystem.Open(path)
+}
+
+func (r *openRecorder) opened() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	paths := append([]string{}, r.paths...)
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,382 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+// ListedSegment is a sealed segment of the cluster, for export, with each of
+// the store nodes that have it. Replicas of a segment have the same records,
+// but may not have the same bytes, e.g. if only some nodes compress them.
+type ListedSegment struct {
+	Segment  string           `json:"segment"`
+	Low      ulid.ULID        `json:"low"`
+	High     ulid.ULID        `json:"high"`
+	From     time.Time        `json:"from"`
+	To       time.Time        `json:"to"`
+	Replicas []SegmentReplica `json:"replicas"`
+}
+
+// SegmentReplica is a sealed segment as stored by a node, whose store API is
+// at Node. Download it from APIPathSegment on that node.
+type SegmentReplica struct {
+	Node     string `json:"node"`
+	Size     int64  `json:"size"`
+	Checksum uint32 `json:"checksum"` // CRC-32C
+}
+
+type sealedSegmentJSON struct {
+	Segment  string    `json:"segment"`
+	Low      ulid.ULID `json:"low"`
+	High     ulid.ULID `json:"high"`
+	Size     int64     `json:"size"`
+	Checksum uint32    `json:"checksum"`
+}
+
+// handleUserSegments lists the sealed segments of every store node with
+// records from one time to another, by segment, ordered by their oldest
+// record. Nodes that fail are counted in the error count header, like
+// queries, and the response is then 206 Partial Content.
+func (a *API) handleUserSegments(w http.ResponseWriter, r *http.Request) {
+	var qp QueryParams
+	if err := qp.DecodeFrom(r.URL, rangeRequired); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	members := a.queryPeers()
+	if len(members) <= 0 {
+		http.Error(w, "no store nodes available", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Pin relative times, so all nodes list the same range.
+	pinned := url.Values{}
+	pinned.Set("from", qp.From.ULID.String())
+	pinned.Set("to", qp.To.ULID.String())
+
+	type response struct {
+		hostport string
+		segments []sealedSegmentJSON
+		err      error
+	}
+	c := make(chan response, len(members))
+	for _, hostport := range members {
+		go func(hostport string) {
+			segments, err := a.listSegments(hostport, pinned)
+			c <- response{hostport, segments, err}
+		}(hostport)
+	}
+
+	var (
+		byName     = map[string]*ListedSegment{}
+		errorCount int
+	)
+	for range members {
+		response := <-c
+		if response.err != nil {
+			a.reporter.ReportEvent(Event{
+				Op: "handleUserSegments", Error: response.err,
+				Msg: fmt.Sprintf("list segments of %s", response.hostport),
+			})
+			errorCount++
+			continue
+		}
+		for _, s := range response.segments {
+			listed, ok := byName[s.Segment]
+			if !ok {
+				listed = &ListedSegment{
+					Segment: s.Segment,
+					Low:     s.Low,
+					High:    s.High,
+					From:    ulidutil.TimeOf(s.Low),
+					To:      ulidutil.TimeOf(s.High),
+				}
+				byName[s.Segment] = listed
+			}
+			listed.Replicas = append(listed.Replicas, SegmentReplica{response.hostport, s.Size, s.Checksum})
+		}
+	}
+
+	segments := make([]ListedSegment, 0, len(byName))
+	for _, listed := range byName {
+		sort.Slice(listed.Replicas, func(i, j int) bool { return listed.Replicas[i].Node < listed.Replicas[j].Node })
+		segments = append(segments, *listed)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if c := segments[i].Low.Compare(segments[j].Low); c != 0 {
+			return c < 0
+		}
+		return segments[i].Segment < segments[j].Segment
+	})
+
+	buf, err := json.Marshal(segments)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set(httpHeaderErrorCount, strconv.Itoa(errorCount))
+	if errorCount > 0 {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	w.Write(append(buf, '\n'))
+}
+
+// listSegments gets the sealed segments of the store node at hostport.
+func (a *API) listSegments(hostport string, params url.Values) ([]sealedSegmentJSON, error) {
+	u := url.URL{
+		Scheme:   "http",
+		Host:     hostport,
+		Path:     fmt.Sprintf("store%s", APIPathInternalSegments),
+		RawQuery: params.Encode(),
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.queryClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		buf, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, errors.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(buf)))
+	}
+	var segments []sealedSegmentJSON
+	if err := json.NewDecoder(resp.Body).Decode(&segments); err != nil {
+		return nil, errors.Wrap(err, "decoding segments")
+	}
+	return segments, nil
+}
+
+// handleInternalSegments lists the sealed segments of this node. The to time
+// is inclusive, to the millisecond, as for queries.
+func (a *API) handleInternalSegments(w http.ResponseWriter, r *http.Request) {
+	var qp QueryParams
+	if err := qp.DecodeFrom(r.URL, rangeRequired); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	segments, err := a.log.Sealed(qp.From.ULID, ulidutil.Max(qp.To.ULID.Time()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list := make([]sealedSegmentJSON, len(segments))
+	for i, s := range segments {
+		list[i] = sealedSegmentJSON{s.Name, s.Low, s.High, s.Size, s.Checksum}
+	}
+	buf, err := json.Marshal(list)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(append(buf, '\n'))
+}
+
+// handleSegment serves the raw bytes of a sealed segment of this node, named
+// by the path after APIPathSegment. Byte range requests are supported, so
+// downloads can be resumed.
+func (a *API) handleSegment(w http.ResponseWriter, r *http.Request) {
+	segment := strings.TrimPrefix(r.URL.Path, APIPathSegment)
+	f, err := a.log.OpenSealed(segment)
+	if err == ErrSegmentNotFound {
+		http.Error(w, fmt.Sprintf("%s: %v", segment, err), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, segment, time.Time{}, &segmentSeeker{f: f, size: f.Size()})
+}
+
+// handleImportSegment stores the segment uploaded as the request body, e.g.
+// one exported before, as stored, so possibly compressed, but not encrypted;
+// it's encrypted like any other, if we encrypt segments. The segment param
+// names it, and must agree with its first and last records, and the checksum
+// param is its CRC-32C, as listed. Unless imported is false, it's marked as
+// imported, with ImportedOrigin. Segments already stored are refused.
+func (a *API) handleImportSegment(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	name := r.URL.Query().Get("segment")
+	low, high, err := parseFilename(name)
+	if err != nil || filepath.Base(name) != name {
+		http.Error(w, fmt.Sprintf("parsing 'segment': %q isn't a segment name", name), http.StatusBadRequest)
+		return
+	}
+	checksum, err := strconv.ParseUint(r.URL.Query().Get("checksum"), 10, 32)
+	if err != nil {
+		http.Error(w, "parsing 'checksum': want the CRC-32C of the segment, as listed", http.StatusBadRequest)
+		return
+	}
+	imported := true
+	if s := r.URL.Query().Get("imported"); s != "" {
+		if imported, err = strconv.ParseBool(s); err != nil {
+			http.Error(w, errors.Wrap(err, "parsing 'imported'").Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if f, err := a.log.OpenSealed(name); err == nil {
+		f.Close()
+		http.Error(w, fmt.Sprintf("%s is already stored", name), http.StatusConflict)
+		return
+	}
+
+	segment, err := a.log.Create()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if imported {
+		segment.SetOrigins([]string{ImportedOrigin})
+	}
+	h := crc32.New(castagnoli)
+	n, err := importRecords(io.TeeReader(r.Body, h), segment, low, high)
+	if err == nil && h.Sum32() != uint32(checksum) {
+		err = importError{errors.Errorf("checksum is %d, not %d", h.Sum32(), checksum)}
+	}
+	if err != nil {
+		segment.Delete()
+		code := http.StatusInternalServerError
+		if _, ok := err.(importError); ok {
+			code = http.StatusBadRequest
+		}
+		http.Error(w, fmt.Sprintf("%s: %v", name, err), code)
+		return
+	}
+	if err := segment.Close(low, high); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.reporter.ReportEvent(Event{
+		Op: "importSegment", File: name,
+		Msg: fmt.Sprintf("imported %d bytes of records", n),
+	})
+	fmt.Fprintln(w, "OK")
+}
+
+// importError is a problem with an imported segment, rather than with us.
+type importError struct{ error }
+
+// importRecords copies the records of a segment, as stored, from r to w, and
+// checks that they're in order, from low to high. It reads r to the end,
+// even past the end of a compressed segment.
+func importRecords(r io.Reader, w io.Writer, low, high ulid.ULID) (n int, err error) {
+	src, err := DecompressSegment(r)
+	if err != nil {
+		return 0, importError{errors.Wrap(err, "decompressing")}
+	}
+	defer src.Close()
+	var (
+		s       = record.NewScanner(src)
+		id, ids ulid.ULID
+		records int
+	)
+	s.Split(scanLinesPreserveNewline)
+	for s.Scan() {
+		line := s.Bytes()
+		records++
+		if len(line) < ulid.EncodedSize || id.UnmarshalText(line[:ulid.EncodedSize]) != nil {
+			return n, importError{errors.Errorf("record %d doesn't begin with a ULID", records)}
+		}
+		switch {
+		case records == 1 && id != low:
+			return n, importError{errors.Errorf("the first record is %s, not %s, as named", id, low)}
+		case id.Compare(ids) < 0:
+			return n, importError{errors.Errorf("record %d (%s) is out of order", records, id)}
+		}
+		ids = id
+		n0, err := w.Write(line)
+		if err != nil {
+			return n, err
+		}
+		n += n0
+	}
+	if err := s.Err(); err != nil {
+		return n, importError{err}
+	}
+	switch {
+	case records == 0:
+		return n, importError{errors.New("no records")}
+	case ids != high:
+		return n, importError{errors.Errorf("the last record is %s, not %s, as named", ids, high)}
+	}
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return n, importError{err}
+	}
+	return n, nil
+}
+
+// segmentSeeker lets http.ServeContent seek in a segment file. Files that
+// can't seek, e.g. memory mapped ones, are read forward to the next read.
+type segmentSeeker struct {
+	f    fs.File
+	size int64
+	pos  int64 // of the next read
+	off  int64 // of the file
+}
+
+func (s *segmentSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errors.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+func (s *segmentSeeker) Read(p []byte) (int, error) {
+	if s.pos != s.off {
+		if err := s.seek(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.f.Read(p)
+	s.off += int64(n)
+	s.pos = s.off
+	return n, err
+}
+
+func (s *segmentSeeker) seek() error {
+	if seeker, ok := s.f.(io.Seeker); ok {
+		off, err := seeker.Seek(s.pos, io.SeekStart)
+		s.off = off
+		return err
+	}
+	if s.pos < s.off {
+		return errors.New("can't seek backward in segment")
+	}
+	n, err := io.CopyN(ioutil.Discard, s.f, s.pos-s.off)
+	s.off += n
+	return err
+}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+func TestAPIImportSegment(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	// writeSegment writes a segment of records from oldest to newest ago, as
+	// compaction would, so it's compressed, if the log compresses them.
+	writeSegment := func(filelog Log, oldest, newest time.Duration) (name string, records []string) {
+		segment, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		segment.SetCompacted()
+		var ids []ulid.ULID
+		for _, ago := range []time.Duration{oldest, (oldest + newest) / 2, newest} {
+			id := ulid.MustNew(ulid.Timestamp(now.Add(-ago)), rand.Reader)
+			ids = append(ids, id)
+			records = append(records, fmt.Sprintf("%s %s ago\n", id, ago))
+		}
+		fmt.Fprint(segment, strings.Join(records, ""))
+		if err := segment.Close(ids[0], ids[len(ids)-1]); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("%s-%s", ids[0], ids[len(ids)-1]), records
+	}
+
+	// A segment past retention, compressed, as exported from another node.
+	source, err := NewFileLog(fs.NewVirtualFilesystem(), "/", 10240, 1024, FileLogConfig{Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	name, records := writeSegment(source, 50*time.Hour, 40*time.Hour)
+	f, err := source.OpenSealed(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived, _ := ioutil.ReadAll(f)
+	f.Close()
+	if !isCompressed(bufio.NewReader(bytes.NewReader(archived))) {
+		t.Fatal("archived segment isn't compressed")
+	}
+	checksum := crc32.Checksum(archived, castagnoli)
+
+	a, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer a.Close()
+	upload := func(segment string, checksum uint32, body []byte) (int, string) {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("POST", fmt.Sprintf("%s?segment=%s&checksum=%d", APIPathImportSegment, segment, checksum), bytes.NewReader(body)))
+		return w.Code, w.Body.String()
+	}
+	query := func() string {
+		result, err := a.log.Query(context.Background(), QueryParams{
+			From: ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(now.Add(-72*time.Hour)), nil)},
+			To:   ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(now), nil)},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer result.Records.Close()
+		b, err := ioutil.ReadAll(result.Records)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	// Bad uploads are refused, and leave nothing behind.
+	var (
+		low, high, _ = parseFilename(name)
+		misnamed     = fmt.Sprintf("%s-%s", ulidutil.Min(low.Time()), high)
+		corrupt      = append([]byte(nil), archived...)
+	)
+	corrupt[len(corrupt)/2] ^= 0xFF
+	for _, testcase := range []struct {
+		name     string
+		segment  string
+		checksum uint32
+		body     []byte
+	}{
+		{"corrupt", name, checksum, corrupt},
+		{"bad checksum", name, checksum + 1, archived},
+		{"misnamed", misnamed, checksum, archived},
+		{"not a segment name", "nope", checksum, archived},
+		{"no records", name, crc32.Checksum(nil, castagnoli), nil},
+	} {
+		if code, body := upload(testcase.segment, testcase.checksum, testcase.body); code != http.StatusBadRequest {
+			t.Errorf("%s: want HTTP %d, have %d: %s", testcase.name, http.StatusBadRequest, code, body)
+		}
+	}
+	if want, have := "", query(); want != have {
+		t.Fatalf("after bad uploads: want no records, have %q", have)
+	}
+
+	// A good upload is queryable, and can't be uploaded again.
+	if code, body := upload(name, checksum, archived); code != http.StatusOK {
+		t.Fatalf("want HTTP %d, have %d: %s", http.StatusOK, code, body)
+	}
+	if want, have := strings.Join(records, ""), query(); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if code, body := upload(name, checksum, archived); code != http.StatusConflict {
+		t.Errorf("again: want HTTP %d, have %d: %s", http.StatusConflict, code, body)
+	}
+
+	// Retention skips imported segments, unless told otherwise.
+	trashable := func(imported bool) int {
+		var n int
+		for _, getSegments := range []func() ([]ReadSegment, error){
+			func() ([]ReadSegment, error) { return a.log.Trashable(now, imported) },
+			func() ([]ReadSegment, error) { return a.log.TrashableBySize(0, imported) },
+		} {
+			segments, err := getSegments()
+			if err != nil && err != ErrNoSegmentsAvailable {
+				t.Fatal(err)
+			}
+			for _, segment := range segments {
+				segment.Reset()
+			}
+			n += len(segments)
+		}
+		return n
+	}
+	if want, have := 0, trashable(false); want != have {
+		t.Errorf("imported segments skipped: want %d trashable, have %d", want, have)
+	}
+	if want, have := 2, trashable(true); want != have {
+		t.Errorf("imported segments included: want %d trashable, have %d", want, have)
+	}
+
+	// Imported segments are compacted with overlapping ones, and what
+	// they're compacted into is imported, too.
+	_, more := writeSegment(a.log, 48*time.Hour, 42*time.Hour)
+	records = append(records, more...)
+	_, more = writeSegment(a.log, 47*time.Hour, 41*time.Hour)
+	records = append(records, more...)
+	sort.Strings(records)
+	c := newTestCompacter(a.log, 0, LogReporter{log.NewNopLogger()})
+	if compacted, result := c.compact("Overlapping", a.log.Overlapping); compacted != 3 || result != "OK" {
+		t.Fatalf("compact: want 3 OK, have %d %s", compacted, result)
+	}
+	if want, have := strings.Join(records, ""), query(); want != have {
+		t.Errorf("compacted: want %q, have %q", want, have)
+	}
+	if want, have := 0, trashable(false); want != have {
+		t.Errorf("compacted: want %d trashable, have %d", want, have)
+	}
+}
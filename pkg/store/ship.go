@@ -0,0 +1,364 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+// A Shipper retries a segment the standby fails to import after
+// shipRetryMin, and backs off, doubling the wait, to shipRetryMax, while it
+// keeps failing.
+const (
+	shipRetryMin = time.Second
+	shipRetryMax = time.Minute
+)
+
+// Shipper ships segments to a standby store node outside the cluster, e.g.
+// for disaster recovery, which imports them, as with APIPathImportSegment,
+// but not marked as imported. Segments are queued by name, and the queue is
+// kept in a file, so it survives restarts. They're shipped one at a time, in
+// the order they're queued, and each is retried until the standby has it.
+// Queueing a segment never waits on the standby, or on the disk.
+//
+// The queue holds at most maxQueued segments; past that, the oldest are
+// dropped, unshipped. Segments that are compacted or trashed before they're
+// shipped are dropped, too, so a standby that's away for long misses some.
+type Shipper struct {
+	target      string // URL of the standby's API, e.g. https://standby:7650
+	client      Doer
+	log         Log
+	filesys     fs.Filesystem
+	path        string // of the queue
+	maxQueued   int
+	retry       time.Duration // initial wait to retry a segment
+	backlog     prometheus.Gauge
+	lastShipped prometheus.Gauge
+	dropped     prometheus.Counter
+	reporter    EventReporter
+
+	mtx   sync.Mutex
+	queue []string // segment names, oldest first
+	dirty bool     // the queue changed since it was written
+	wake  chan struct{}
+	stop  chan chan struct{}
+}
+
+// NewShipper returns a Shipper of the segments of log, to the standby store
+// node whose API is at target, with the queue kept in the file at path. The
+// segments left in it when the node last stopped are shipped first. backlog
+// is the number of queued segments, lastShipped the Unix time the last one
+// was shipped, and dropped counts those that never will be. Don't forget to
+// Run it.
+func NewShipper(
+	target string,
+	client Doer,
+	log Log,
+	filesys fs.Filesystem,
+	path string,
+	maxQueued int,
+	backlog, lastShipped prometheus.Gauge,
+	dropped prometheus.Counter,
+	reporter EventReporter,
+) (*Shipper, error) {
+	s := &Shipper{
+		target:      strings.TrimSuffix(target, "/"),
+		client:      client,
+		log:         log,
+		filesys:     filesys,
+		path:        path,
+		maxQueued:   maxQueued,
+		retry:       shipRetryMin,
+		backlog:     backlog,
+		lastShipped: lastShipped,
+		dropped:     dropped,
+		reporter:    reporter,
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan chan struct{}),
+	}
+	queue, err := readShipQueue(filesys, path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading shipping queue")
+	}
+	for _, segment := range queue {
+		s.Enqueue(segment)
+	}
+	s.dirty = len(s.queue) != len(queue) // it's as read, unless some were dropped
+	return s, nil
+}
+
+// Enqueue queues the named segment to be shipped. It's a no-op on a nil
+// Shipper.
+func (s *Shipper) Enqueue(segment string) {
+	if s == nil {
+		return
+	}
+	s.mtx.Lock()
+	s.queue = append(s.queue, segment)
+	var dropped []string
+	if s.maxQueued > 0 && len(s.queue) > s.maxQueued {
+		n := len(s.queue) - s.maxQueued
+		dropped = append(dropped, s.queue[:n]...)
+		s.queue = append(s.queue[:0], s.queue[n:]...)
+	}
+	s.dirty = true
+	s.backlog.Set(float64(len(s.queue)))
+	s.mtx.Unlock()
+
+	for _, segment := range dropped {
+		s.drop(segment, errors.Errorf("shipping queue is full, at %d segments", s.maxQueued))
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default: // already woken
+	}
+}
+
+// Queued returns the names of the segments waiting to be shipped, oldest
+// first, including the one being shipped.
+func (s *Shipper) Queued() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]string(nil), s.queue...)
+}
+
+// Run ships the queued segments, until Stop is invoked.
+func (s *Shipper) Run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		shipping string // segment being shipped, if any
+		shipped  = make(chan error, 1)
+		retry    <-chan time.Time
+		wait     = s.retry
+	)
+	next := func() {
+		if shipping != "" || retry != nil {
+			return
+		}
+		s.mtx.Lock()
+		if len(s.queue) > 0 {
+			shipping = s.queue[0]
+		}
+		s.mtx.Unlock()
+		if shipping != "" {
+			go func(segment string) { shipped <- s.ship(ctx, segment) }(shipping)
+		}
+	}
+	s.persist()
+	next()
+	for {
+		select {
+		case <-s.wake:
+			s.persist()
+			next()
+
+		case err := <-shipped:
+			segment := shipping
+			shipping = ""
+			switch err.(type) {
+			case nil:
+				s.lastShipped.Set(float64(time.Now().UnixNano()) / 1e9)
+				s.remove(segment)
+				wait = s.retry
+			case shipDropped:
+				s.drop(segment, err)
+				s.remove(segment)
+			default:
+				s.reporter.ReportEvent(Event{
+					Op: "ship", File: segment, Warning: err,
+					Msg: fmt.Sprintf("to %s: retrying in %s", s.target, wait),
+				})
+				retry = time.After(wait)
+				if wait *= 2; wait > shipRetryMax {
+					wait = shipRetryMax
+				}
+			}
+			s.persist()
+			next()
+
+		case <-retry:
+			retry = nil
+			next()
+
+		case q := <-s.stop:
+			cancel()
+			if shipping != "" {
+				<-shipped // it's retried when we next run, even if it made it
+			}
+			s.persist()
+			close(q)
+			return
+		}
+	}
+}
+
+// Stop the Shipper, interrupting the segment being shipped, and writing the
+// queue.
+func (s *Shipper) Stop() {
+	q := make(chan struct{})
+	s.stop <- q
+	<-q
+}
+
+// remove the segment from the head of the queue, unless it's been dropped
+// from the queue already.
+func (s *Shipper) remove(segment string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if len(s.queue) > 0 && s.queue[0] == segment {
+		s.queue = s.queue[1:]
+		s.dirty = true
+	}
+	s.backlog.Set(float64(len(s.queue)))
+}
+
+// drop reports a segment that won't be shipped, and why.
+func (s *Shipper) drop(segment string, err error) {
+	s.dropped.Inc()
+	s.reporter.ReportEvent(Event{
+		Op: "ship", File: segment, Error: err,
+		Msg: fmt.Sprintf("to %s: dropped, never to be shipped", s.target),
+	})
+}
+
+// shipDropped is why a segment can't be shipped, ever.
+type shipDropped struct{ error }
+
+// ship the named segment to the standby. It's read twice: once for its
+// checksum, which the standby checks, and again as it's sent.
+func (s *Shipper) ship(ctx context.Context, segment string) error {
+	h := crc32.New(castagnoli)
+	if err := s.readSegment(segment, h); err != nil {
+		return err
+	}
+	body, err := s.log.OpenSealed(segment)
+	if err != nil {
+		return s.openError(err)
+	}
+	defer body.Close()
+	params := url.Values{}
+	params.Set("segment", segment)
+	params.Set("checksum", fmt.Sprint(h.Sum32()))
+	params.Set("imported", "false")
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/store%s?%s", s.target, APIPathImportSegment, params.Encode()), body)
+	if err != nil {
+		return shipDropped{err}
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusConflict: // the standby has it, either way
+		return nil
+	case http.StatusBadRequest:
+		return shipDropped{errors.Errorf("refused by the standby: %s", strings.TrimSpace(string(msg)))}
+	default:
+		return errors.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+}
+
+// readSegment copies the named segment, as stored, to w.
+func (s *Shipper) readSegment(segment string, w io.Writer) error {
+	f, err := s.log.OpenSealed(segment)
+	if err != nil {
+		return s.openError(err)
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (s *Shipper) openError(err error) error {
+	if err == ErrSegmentNotFound {
+		return shipDropped{errors.New("gone, compacted or trashed, before it was shipped")}
+	}
+	return err
+}
+
+// persist writes the queue, if it changed. If that fails, it's tried again
+// with the next change.
+func (s *Shipper) persist() {
+	s.mtx.Lock()
+	if !s.dirty {
+		s.mtx.Unlock()
+		return
+	}
+	queue := append([]string(nil), s.queue...)
+	s.dirty = false
+	s.mtx.Unlock()
+
+	if err := writeShipQueue(s.filesys, s.path, queue); err != nil {
+		s.mtx.Lock()
+		s.dirty = true
+		s.mtx.Unlock()
+		s.reporter.ReportEvent(Event{Op: "ship", File: s.path, Error: err, Msg: "writing shipping queue"})
+	}
+}
+
+// readShipQueue reads the segment names of a queue file, one per line. A
+// missing file is an empty queue.
+func readShipQueue(filesys fs.Filesystem, path string) ([]string, error) {
+	f, err := filesys.Open(path)
+	if err == os.ErrNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		queue []string
+		s     = bufio.NewScanner(f)
+	)
+	for s.Scan() {
+		if segment := strings.TrimSpace(s.Text()); segment != "" {
+			queue = append(queue, segment)
+		}
+	}
+	return queue, s.Err()
+}
+
+// writeShipQueue replaces the queue file at path, so it's never left half
+// written.
+func writeShipQueue(filesys fs.Filesystem, path string, queue []string) error {
+	tmp := path + ".tmp"
+	f, err := filesys.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, segment := range queue {
+		fmt.Fprintln(w, segment)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return filesys.Rename(tmp, path)
+}
@@ -0,0 +1,277 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+func TestShipperFlakyStandby(t *testing.T) {
+	t.Parallel()
+
+	// The standby fails each segment's first import outright, and its second
+	// after it's stored, as if the response were lost, so the third finds
+	// it's already there.
+	standby, standbyServer := newStreamFixture(t, staticPeer(nil))
+	defer standbyServer.Close()
+	defer standby.Close()
+	var (
+		mtx      sync.Mutex
+		attempts = map[string]int{}
+	)
+	flaky := httptest.NewServer(http.StripPrefix("/store", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		segment := r.URL.Query().Get("segment")
+		attempts[segment]++
+		attempt := attempts[segment]
+		mtx.Unlock()
+		if attempt == 1 {
+			http.Error(w, "not now", http.StatusServiceUnavailable)
+			return
+		}
+		rec := httptest.NewRecorder()
+		standby.ServeHTTP(rec, r)
+		if attempt == 2 {
+			http.Error(w, "lost", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	})))
+	defer flaky.Close()
+
+	// Segments replicated here first are shipped; the other replicas aren't.
+	filesys := fs.NewVirtualFilesystem()
+	filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{Reporter: LogReporter{log.NewNopLogger()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+	var (
+		backlog     = prometheus.NewGauge(prometheus.GaugeOpts{})
+		lastShipped = prometheus.NewGauge(prometheus.GaugeOpts{})
+		dropped     = prometheus.NewCounter(prometheus.CounterOpts{})
+	)
+	shipper, err := NewShipper(flaky.URL+"/", http.DefaultClient, filelog, filesys, "/ship.queue", 100, backlog, lastShipped, dropped, LogReporter{log.NewNopLogger()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shipper.retry = time.Millisecond
+	var (
+		replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+		replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
+		duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+		a                  = NewAPI(staticPeer(nil), filelog, APIConfig{
+			QueryClient:        http.DefaultClient,
+			StreamClient:       http.DefaultClient,
+			ReplicatedSegments: replicatedSegments,
+			ReplicatedBytes:    replicatedBytes,
+			Duration:           duration,
+			Reporter:           LogReporter{log.NewNopLogger()},
+			Shipper:            shipper,
+		})
+	)
+	defer a.Close()
+	var (
+		now     = time.Now()
+		shipped []string
+		want    []string // records
+	)
+	for i := 0; i < 10; i++ {
+		var segment string
+		for j := 0; j < 3; j++ {
+			segment += fmt.Sprintf("%s segment %d record %d\n", ulid.MustNew(ulid.Timestamp(now.Add(time.Duration(i*3+j)*time.Millisecond)), rand.Reader), i, j)
+		}
+		first := i%2 == 0
+		r := httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(segment))
+		if first {
+			r.Header.Set(httpHeaderShip, "true")
+			shipped = append(shipped, segmentName(segment))
+			want = append(want, segment)
+		}
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("replicating segment %d: HTTP %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+	if want, have := shipped, shipper.Queued(); !reflect.DeepEqual(want, have) {
+		t.Fatalf("queued: want %v, have %v", want, have)
+	}
+
+	go shipper.Run()
+	defer shipper.Stop()
+	deadline := time.Now().Add(10 * time.Second)
+	for len(shipper.Queued()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout, with %v still queued", shipper.Queued())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Every one made it, once.
+	sealed, err := standby.log.Sealed(ulidutil.Min(ulid.Timestamp(now.Add(-time.Hour))), ulidutil.Max(ulid.Timestamp(now.Add(time.Hour))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have []string
+	for _, s := range sealed {
+		have = append(have, s.Name)
+	}
+	if want := shipped; !reflect.DeepEqual(want, have) {
+		t.Errorf("standby segments: want %v, have %v", want, have)
+	}
+	result, err := standby.log.Query(context.Background(), QueryParams{
+		From: ulidOrTime{ULID: ulidutil.Min(ulid.Timestamp(now.Add(-time.Hour)))},
+		To:   ulidOrTime{ULID: ulidutil.Max(ulid.Timestamp(now.Add(time.Hour)))},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, _ := ioutil.ReadAll(result.Records)
+	result.Records.Close()
+	if want, have := strings.Join(want, ""), string(records); want != have {
+		t.Errorf("standby records: want\n%s\nhave\n%s", want, have)
+	}
+	for _, s := range shipped {
+		if want, have := 3, attempts[s]; want != have {
+			t.Errorf("%s: want %d attempts, have %d", s, want, have)
+		}
+	}
+	if want, have := 0.0, gaugeValue(backlog); want != have {
+		t.Errorf("backlog: want %v, have %v", want, have)
+	}
+	if gaugeValue(lastShipped) < float64(now.Unix()) {
+		t.Errorf("last shipped: want at least %d, have %v", now.Unix(), gaugeValue(lastShipped))
+	}
+	if want, have := 0.0, counterValue(dropped); want != have {
+		t.Errorf("dropped: want %v, have %v", want, have)
+	}
+}
+
+func TestShipperRestart(t *testing.T) {
+	t.Parallel()
+
+	// A standby that's down, and then one that's up.
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	var (
+		mtx      sync.Mutex
+		received []string
+	)
+	standby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		received = append(received, r.URL.Query().Get("segment"))
+		fmt.Fprintln(w, "OK")
+	}))
+	defer standby.Close()
+
+	filesys := fs.NewVirtualFilesystem()
+	filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{Reporter: LogReporter{log.NewNopLogger()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+	var names []string
+	for i := 0; i < 3; i++ {
+		names = append(names, writeShipSegment(t, filelog, i))
+	}
+	newShipper := func(target string, maxQueued int, dropped prometheus.Counter) *Shipper {
+		s, err := NewShipper(target, http.DefaultClient, filelog, filesys, "/ship.queue", maxQueued, prometheus.NewGauge(prometheus.GaugeOpts{}), prometheus.NewGauge(prometheus.GaugeOpts{}), dropped, LogReporter{log.NewNopLogger()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.retry = time.Millisecond
+		return s
+	}
+
+	// While the standby is down, the queue is kept.
+	s := newShipper(down.URL, 10, prometheus.NewCounter(prometheus.CounterOpts{}))
+	go s.Run()
+	for _, name := range names {
+		s.Enqueue(name)
+	}
+	time.Sleep(20 * time.Millisecond)
+	s.Stop()
+
+	// And it's shipped after a restart, minus what no longer fits, or no
+	// longer exists.
+	dropped := prometheus.NewCounter(prometheus.CounterOpts{})
+	s = newShipper(standby.URL, 2, dropped)
+	if want, have := names[1:], s.Queued(); !reflect.DeepEqual(want, have) {
+		t.Fatalf("after restart: want %v queued, have %v", want, have)
+	}
+	s.Enqueue("01BB6RQR190000000000000000-01BB6RQR190000000000000001")
+	if want, have := float64(2), counterValue(dropped); want != have {
+		t.Errorf("dropped: want %v, have %v", want, have)
+	}
+	go s.Run()
+	defer s.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Queued()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout, with %v still queued", s.Queued())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if want, have := names[2:], received; !reflect.DeepEqual(want, have) {
+		t.Errorf("received: want %v, have %v", want, have)
+	}
+	if want, have := float64(3), counterValue(dropped); want != have {
+		t.Errorf("dropped: want %v, have %v", want, have)
+	}
+}
+
+// writeShipSegment writes a segment of one record, and returns its name.
+func writeShipSegment(t *testing.T, filelog Log, i int) string {
+	t.Helper()
+	segment, err := filelog.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := ulid.MustNew(uint64(1000+i), rand.Reader)
+	fmt.Fprintf(segment, "%s record %d\n", id, i)
+	if err := segment.Close(id, id); err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%s-%s", id, id)
+}
+
+// segmentName is the name of the segment of the sorted records.
+func segmentName(records string) string {
+	lines := strings.Split(strings.TrimSuffix(records, "\n"), "\n")
+	return lines[0][:ulid.EncodedSize] + "-" + lines[len(lines)-1][:ulid.EncodedSize]
+}
+
+func counterValue(c prometheus.Counter) float64 {
+	var m dto.Metric
+	c.Write(&m)
+	return m.GetCounter().GetValue()
+}
+
+func gaugeValue(g prometheus.Gauge) float64 {
+	var m dto.Metric
+	g.Write(&m)
+	return m.GetGauge().GetValue()
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+// DiskUsage is the disk usage of the store log, and of its filesystem.
+type DiskUsage struct {
+	Segments       int64     `json:"segments"` // live, i.e. active, flushed, or reading
+	SegmentBytes   int64     `json:"segment_bytes"`
+	TrashSegments  int64     `json:"trash_segments"` // not yet purged
+	TrashBytes     int64     `json:"trash_bytes"`
+	CapacityBytes  int64     `json:"capacity_bytes"`  // of the filesystem, or zero, if it can't tell
+	AvailableBytes int64     `json:"available_bytes"` // of the filesystem, to us
+	Level          DiskLevel `json:"level"`
+	Updated        time.Time `json:"updated"`
+}
+
+// DiskLevel is how full the filesystem of the store log is, by watermark.
+type DiskLevel int
+
+// These are the disk levels. At DiskHigh, a node stops consuming segments
+// from ingest nodes. At DiskCritical, it also refuses replication, so peers
+// replicate elsewhere. Either way, compaction goes on, as it frees up space.
+const (
+	DiskOK DiskLevel = iota
+	DiskHigh
+	DiskCritical
+)
+
+var diskLevelNames = []string{"ok", "high", "critical"}
+
+func (l DiskLevel) String() string {
+	if l < 0 || int(l) >= len(diskLevelNames) {
+		return fmt.Sprintf("DiskLevel(%d)", int(l))
+	}
+	return diskLevelNames[l]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (l DiskLevel) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (l *DiskLevel) UnmarshalText(text []byte) error {
+	for i, name := range diskLevelNames {
+		if string(text) == name {
+			*l = DiskLevel(i)
+			return nil
+		}
+	}
+	return errors.Errorf("invalid disk level %q", text)
+}
+
+// DiskMonitor tracks the disk usage of the store log, and serves it on the
+// status endpoint. It should be mounted at APIPathStatus.
+type DiskMonitor struct {
+	log      Log
+	filesys  fs.Filesystem
+	root     string
+	interval time.Duration
+	high     float64
+	critical float64
+	bytes    *prometheus.GaugeVec
+	publish  func(DiskUsage)
+	reporter EventReporter
+	stop     chan chan struct{}
+
+	mtx   sync.Mutex
+	usage DiskUsage
+}
+
+// NewDiskMonitor returns a DiskMonitor of the log, stored at root of the
+// filesystem, which it checks every interval. Each check sets the bytes
+// gauge, by kind, i.e. segments, trash, capacity, and available, and is
+// passed to publish, which may be nil, e.g. to gossip it, or to act on its
+// level. The high and critical watermarks are the fractions of the
+// filesystem's capacity in use, by anyone, at which the level is DiskHigh and
+// DiskCritical, respectively. Warnings are reported at every check while the
+// level isn't DiskOK.
+func NewDiskMonitor(
+	log Log,
+	filesys fs.Filesystem, root string,
+	interval time.Duration,
+	high, critical float64,
+	bytes *prometheus.GaugeVec,
+	publish func(DiskUsage),
+	reporter EventReporter,
+) *DiskMonitor {
+	return &DiskMonitor{
+		log:      log,
+		filesys:  filesys,
+		root:     root,
+		interval: interval,
+		high:     high,
+		critical: critical,
+		bytes:    bytes,
+		publish:  publish,
+		reporter: reporter,
+		stop:     make(chan chan struct{}),
+	}
+}
+
+// Run checks disk usage, immediately and then every interval, until Stop.
+func (m *DiskMonitor) Run() {
+	m.Check()
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.Check()
+		case q := <-m.stop:
+			close(q)
+			return
+		}
+	}
+}
+
+// Stop the monitor from checking.
+func (m *DiskMonitor) Stop() {
+	q := make(chan struct{})
+	m.stop <- q
+	<-q
+}
+
+// Check disk usage now, and return it.
+func (m *DiskMonitor) Check() DiskUsage {
+	stats, err := m.log.Stats()
+	if err != nil {
+		m.reporter.ReportEvent(Event{Op: "DiskMonitor", Error: err, Msg: "log stats failed"})
+		return m.Usage()
+	}
+	usage := DiskUsage{
+		Segments:      stats.ActiveSegments + stats.FlushedSegments + stats.ReadingSegments,
+		SegmentBytes:  stats.ActiveBytes + stats.FlushedBytes + stats.ReadingBytes,
+		TrashSegments: stats.TrashedSegments,
+		TrashBytes:    stats.TrashedBytes,
+		Updated:       time.Now().UTC(),
+	}
+	switch u, err := m.filesys.Statfs(m.root); err {
+	case nil:
+		usage.CapacityBytes, usage.AvailableBytes = u.Capacity, u.Available
+	case fs.ErrStatfsUnsupported:
+		// Capacity stays zero, and the level OK.
+	default:
+		m.reporter.ReportEvent(Event{Op: "DiskMonitor", File: m.root, Error: err, Msg: "statfs failed"})
+	}
+	if usage.CapacityBytes > 0 {
+		used := 1 - float64(usage.AvailableBytes)/float64(usage.CapacityBytes)
+		switch {
+		case used >= m.critical:
+			usage.Level = DiskCritical
+		case used >= m.high:
+			usage.Level = DiskHigh
+		}
+	}
+
+	m.mtx.Lock()
+	was := m.usage.Level
+	m.usage = usage
+	m.mtx.Unlock()
+
+	switch {
+	case usage.Level != DiskOK:
+		m.reporter.ReportEvent(Event{
+			Op: "DiskMonitor", File: m.root,
+			Warning: fmt.Errorf("disk level %s: %d of %d bytes available", usage.Level, usage.AvailableBytes, usage.CapacityBytes),
+		})
+	case was != DiskOK:
+		m.reporter.ReportEvent(Event{
+			Op: "DiskMonitor", File: m.root,
+			Msg: fmt.Sprintf("disk level %s: %d of %d bytes available", usage.Level, usage.AvailableBytes, usage.CapacityBytes),
+		})
+	}
+	m.bytes.WithLabelValues("segments").Set(float64(usage.SegmentBytes))
+	m.bytes.WithLabelValues("trash").Set(float64(usage.TrashBytes))
+	m.bytes.WithLabelValues("capacity").Set(float64(usage.CapacityBytes))
+	m.bytes.WithLabelValues("available").Set(float64(usage.AvailableBytes))
+	if m.publish != nil {
+		m.publish(usage)
+	}
+	return usage
+}
+
+// Usage returns the disk usage as of the latest check.
+func (m *DiskMonitor) Usage() DiskUsage {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.usage
+}
+
+// ServeHTTP serves the disk usage as of the latest check, as JSON.
+func (m *DiskMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	buf, err := json.MarshalIndent(m.Usage(), "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(buf)
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestDiskMonitor(t *testing.T) {
+	t.Parallel()
+
+	var (
+		capacity = fs.NewVirtualCapacity(10000)
+		filesys  = fs.NewVirtualFilesystemWithCapacity(capacity)
+	)
+	filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+	usage, err := filesys.Statfs("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := usage.Capacity - usage.Available + 1750 // e.g. the lock file
+	for path, size := range map[string]int{
+		"/a" + extFlushed: 1000,
+		"/b" + extActive:  500,
+		"/c" + extTrashed: 250,
+	} {
+		f, err := filesys.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(bytes.Repeat([]byte{'x'}, size))
+		f.Close()
+	}
+
+	var (
+		gauges    = prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"kind"})
+		reporter  = &eventRecorder{}
+		published []DiskUsage
+		m         = NewDiskMonitor(filelog, filesys, "/", time.Hour, 0.9, 0.97, gauges, func(u DiskUsage) { published = append(published, u) }, reporter)
+	)
+	for _, testcase := range []struct {
+		capacity int64
+		level    DiskLevel
+		event    bool
+	}{
+		{10000, DiskOK, false},
+		{1900, DiskHigh, true},     // over 90% used
+		{1800, DiskCritical, true}, // over 97% used
+		{1900, DiskHigh, true},     // warned at every check
+		{3000, DiskOK, true},
+		{3000, DiskOK, false},
+	} {
+		available := testcase.capacity - used
+		capacity.Set(testcase.capacity)
+		reporter.events = nil
+		have := m.Check()
+		want := DiskUsage{
+			Segments:       2,
+			SegmentBytes:   1500,
+			TrashSegments:  1,
+			TrashBytes:     250,
+			CapacityBytes:  testcase.capacity,
+			AvailableBytes: available,
+			Level:          testcase.level,
+			Updated:        have.Updated,
+		}
+		if want != have {
+			t.Errorf("capacity %d: want %+v, have %+v", testcase.capacity, want, have)
+		}
+		if want, have := testcase.event, len(reporter.events) > 0; want != have {
+			t.Errorf("capacity %d: want event %v, have %v", testcase.capacity, want, have)
+		}
+		if want, have := testcase.level != DiskOK, len(reporter.events) > 0 && reporter.events[0].Warning != nil; want != have {
+			t.Errorf("capacity %d: want warning %v, have %v", testcase.capacity, want, have)
+		}
+		var g dto.Metric
+		gauges.WithLabelValues("available").Write(&g)
+		if want, have := float64(available), g.GetGauge().GetValue(); want != have {
+			t.Errorf("capacity %d: want available gauge %v, have %v", testcase.capacity, want, have)
+		}
+		if want, have := have, published[len(published)-1]; want != have {
+			t.Errorf("capacity %d: want published %+v, have %+v", testcase.capacity, want, have)
+		}
+	}
+
+	// The status endpoint serves the latest check.
+	server := httptest.NewServer(m)
+	defer server.Close()
+	resp, err := http.Get(server.URL + APIPathStatus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var have DiskUsage
+	if err := json.NewDecoder(resp.Body).Decode(&have); err != nil {
+		t.Fatal(err)
+	}
+	if want := m.Usage(); !want.Updated.Equal(have.Updated) || want.AvailableBytes != have.AvailableBytes || want.Level != have.Level {
+		t.Errorf("GET %s: want %+v, have %+v", APIPathStatus, want, have)
+	}
+}
+
+func TestDiskWatermarks(t *testing.T) {
+	t.Parallel()
+
+	var (
+		capacity = fs.NewVirtualCapacity(fs.DefaultVirtualCapacity)
+		filesys  = fs.NewVirtualFilesystemWithCapacity(capacity)
+	)
+	filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+	f, err := filesys.Create("/other") // used by someone else
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, 100000))
+	f.Close()
+
+	// An ingest node with no segments, which counts requests for them.
+	var nexts int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&nexts, 1)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	var (
+		peer = staticPeer{strings.TrimPrefix(server.URL, "http://")}
+		c    = NewConsumer(
+			peer, "", http.DefaultClient,
+			1024, time.Hour, time.Millisecond,
+			1, 0, 0, nil, nil, nil,
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			prometheus.NewCounter(prometheus.CounterOpts{}),
+			&eventRecorder{},
+		)
+		a = NewAPI(peer, filelog, APIConfig{
+			QueryClient:        mockDoer{},
+			StreamClient:       mockDoer{},
+			ReplicatedSegments: prometheus.NewCounter(prometheus.CounterOpts{}),
+			ReplicatedBytes:    prometheus.NewCounter(prometheus.CounterOpts{}),
+			Duration:           prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"}),
+			Reporter:           &eventRecorder{},
+		})
+		m = NewDiskMonitor(
+			filelog, filesys, "/", time.Hour, 0.9, 0.97,
+			prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"kind"}),
+			func(u DiskUsage) { a.SetDiskLevel(u.Level); c.SetDiskLevel(u.Level) },
+			&eventRecorder{},
+		)
+	)
+	defer a.Close()
+	go c.Run()
+	defer c.Stop()
+
+	// gathering reports whether the consumer asks for segments, once any
+	// request in flight is done.
+	gathering := func() bool {
+		time.Sleep(20 * time.Millisecond)
+		before := atomic.LoadInt64(&nexts)
+		time.Sleep(50 * time.Millisecond)
+		return atomic.LoadInt64(&nexts) > before
+	}
+	for i, testcase := range []struct {
+		used      float64
+		level     DiskLevel
+		gathering bool
+		code      int // of replication
+	}{
+		{0.50, DiskOK, true, http.StatusOK},
+		{0.92, DiskHigh, false, http.StatusOK},
+		{0.98, DiskCritical, false, http.StatusServiceUnavailable},
+		{0.92, DiskHigh, false, http.StatusOK},
+		{0.50, DiskOK, true, http.StatusOK},
+	} {
+		usage, err := filesys.Statfs("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		capacity.Set(int64(float64(usage.Capacity-usage.Available) / testcase.used))
+		if want, have := testcase.level, m.Check().Level; want != have {
+			t.Fatalf("%.0f%% used: want level %s, have %s", 100*testcase.used, want, have)
+		}
+		if want, have := testcase.gathering, gathering(); want != have {
+			t.Errorf("%s: want gathering %v, have %v", testcase.level, want, have)
+		}
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader([]string{recordA, recordB, recordC, recordD, recordE}[i])))
+		if want, have := testcase.code, w.Code; want != have {
+			t.Errorf("%s: want replicate HTTP %d, have %d: %s", testcase.level, want, have, w.Body.String())
+		}
+		if testcase.code != http.StatusOK && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: want Retry-After, have none", testcase.level)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// StreamLimits bound what a store node holds for the client of a streaming
+// query that isn't keeping up, e.g. a tail over a bad link, so it can't make
+// the node buffer without bound, or hold up the records of other streams.
+// Records are queued for the client up to Buffered bytes. Past that, or once
+// the client has taken longer than Stall to accept a write, records are
+// dropped, and the client is told how many, with a "# dropped N records"
+// line, where they'd have been. A client that's still dropping records after
+// Evict is told it's too slow, and disconnected. Internal streams, which
+// other store nodes fan user streams out to, are disconnected as soon as
+// they'd drop a record, instead, as the node resumes them where they left
+// off, with no gap. Zero values are no limit.
+type StreamLimits struct {
+	Buffered int64
+	Stall    time.Duration
+	Evict    time.Duration
+}
+
+// zero returns true if the limits limit nothing.
+func (l StreamLimits) zero() bool {
+	return l.Buffered <= 0 && l.Stall <= 0 && l.Evict <= 0
+}
+
+// checkInterval returns how often a stream checks for stalls and evictions
+// when no records are arriving: often enough to notice either on time.
+func (l StreamLimits) checkInterval() time.Duration {
+	interval := time.Second
+	for _, d := range []time.Duration{l.Stall, l.Evict} {
+		if d > 0 && d/4 < interval {
+			interval = d / 4
+		}
+	}
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	return interval
+}
+
+// queued is a record queued for a stream's client, or, if record is nil, the
+// marker of the records dropped after those before it.
+type queued struct {
+	record  []byte
+	dropped int64
+}
+
+// limitStream passes records through to the returned chan, queued as the
+// limits allow; see StreamLimits. Records the client can't keep up with are
+// dropped, and counted, with a marker, if drop is true, and the client is
+// evicted once it's been behind for limits.Evict; otherwise, it's evicted as
+// soon as it falls behind. An evicted client is sent why, if drop is true,
+// and the returned chan is closed. Either way, records is drained until it's
+// closed, which means the stream is done, and the returned chan is closed,
+// too. Drops and evictions are recorded in metrics.
+func limitStream(records <-chan []byte, limits StreamLimits, drop bool, metrics *QueryMetrics) <-chan []byte {
+	if limits.zero() {
+		return records
+	}
+	out := make(chan []byte)
+	go func() {
+		var (
+			queue    []queued
+			buffered int64     // bytes of records in the queue
+			dropped  int64     // records dropped in all
+			waiting  time.Time // since when the head of the queue has waited
+			behind   time.Time // since when the client's been dropping records
+			evicted  bool
+			closed   bool // out
+			tk       = time.NewTicker(limits.checkInterval())
+		)
+		defer tk.Stop()
+		defer func() { metrics.streamDone(drop, dropped) }()
+
+		// evict the client, if it's been behind too long, dropping what's
+		// queued for it, but for why, if drop is true.
+		evict := func(now time.Time) {
+			if evicted || behind.IsZero() || drop && (limits.Evict <= 0 || now.Sub(behind) < limits.Evict) {
+				return
+			}
+			for _, q := range queue {
+				if q.record != nil {
+					dropped++
+				}
+			}
+			queue, buffered, evicted = nil, 0, true
+			metrics.streamEvicted(drop)
+			if drop {
+				reason := fmt.Sprintf("# too slow: %d records dropped in all, behind since %s; disconnecting", dropped, behind.UTC().Format(time.RFC3339))
+				queue = []queued{{record: []byte(reason)}}
+			}
+		}
+
+		for records != nil || !closed {
+			var (
+				send chan<- []byte
+				head []byte
+			)
+			switch {
+			case len(queue) > 0 && !closed:
+				send, head = out, queue[0].record
+				if head == nil {
+					head = []byte(fmt.Sprintf("# dropped %d records", queue[0].dropped))
+				}
+			case evicted && !closed, records == nil && !closed:
+				close(out)
+				closed = true
+				continue
+			}
+
+			select {
+			case record, ok := <-records:
+				if !ok {
+					records = nil
+					continue
+				}
+				if evicted {
+					continue
+				}
+				now := time.Now()
+				var (
+					full    = limits.Buffered > 0 && buffered+int64(len(record)) > limits.Buffered
+					stalled = limits.Stall > 0 && !waiting.IsZero() && now.Sub(waiting) > limits.Stall
+				)
+				if !full && !stalled {
+					if len(queue) == 0 {
+						waiting = now
+					}
+					queue = append(queue, queued{record: record})
+					buffered += int64(len(record))
+					continue
+				}
+				dropped++
+				if behind.IsZero() {
+					behind = now
+				}
+				if last := len(queue) - 1; last >= 0 && queue[last].record == nil {
+					queue[last].dropped++
+				} else {
+					queue = append(queue, queued{dropped: 1})
+				}
+				evict(now)
+
+			case send <- head:
+				buffered -= int64(len(queue[0].record))
+				queue = queue[1:]
+				waiting = time.Time{}
+				if len(queue) > 0 {
+					waiting = time.Now()
+				} else if !evicted {
+					behind = time.Time{} // caught up
+				}
+
+			case now := <-tk.C:
+				evict(now)
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,251 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLimitStream(t *testing.T) {
+	t.Parallel()
+
+	record := func(i int) []byte { return []byte(fmt.Sprintf("record %02d", i)) } // 9 bytes
+	receive := func(out <-chan []byte) string {
+		select {
+		case record, ok := <-out:
+			if !ok {
+				return "closed"
+			}
+			return string(record)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for a record")
+			return ""
+		}
+	}
+	expect := func(name string, out <-chan []byte, want ...string) {
+		t.Helper()
+		for _, want := range want {
+			if have := receive(out); !strings.HasPrefix(have, want) {
+				t.Errorf("%s: want %q, have %q", name, want, have)
+			}
+		}
+	}
+	var (
+		reg     = prometheus.NewRegistry()
+		metrics = NewQueryMetrics(reg, nil)
+	)
+
+	// Without limits, the records pass straight through.
+	in := make(chan []byte)
+	if want, have := (<-chan []byte)(in), limitStream(in, StreamLimits{}, true, metrics); want != have {
+		t.Errorf("no limits: want the records chan, have another")
+	}
+
+	// Records past the buffer are dropped, and marked, where they'd have
+	// been, while the client isn't reading; those queued by then are at
+	// most the buffer's bytes.
+	in = make(chan []byte)
+	out := limitStream(in, StreamLimits{Buffered: 27}, true, metrics)
+	for i := 0; i < 5; i++ {
+		in <- record(i)
+	}
+	expect("buffered", out, "record 00")
+	in <- record(5)
+	close(in)
+	expect("buffered", out, "record 01", "record 02", "# dropped 2 records", "record 05", "closed")
+
+	// So are records that arrive while the client is stalled, however few.
+	// Once it's caught up, it's sent records as they come.
+	in = make(chan []byte)
+	out = limitStream(in, StreamLimits{Stall: 20 * time.Millisecond}, true, metrics)
+	in <- record(0)
+	time.Sleep(50 * time.Millisecond)
+	in <- record(1)
+	expect("stalled", out, "record 00", "# dropped 1 records")
+	in <- record(2)
+	expect("stalled", out, "record 02")
+	close(in)
+	expect("stalled", out, "closed")
+
+	// A client that's behind for too long is told why, and disconnected,
+	// but the stream is drained until it's done.
+	in = make(chan []byte)
+	out = limitStream(in, StreamLimits{Buffered: 9, Evict: 20 * time.Millisecond}, true, metrics)
+	in <- record(0)
+	in <- record(1)
+	time.Sleep(50 * time.Millisecond)
+	expect("evicted", out, "# too slow: 2 records dropped in all", "closed")
+	in <- record(2)
+	close(in)
+
+	// An internal stream is disconnected as soon as it's behind.
+	in = make(chan []byte)
+	out = limitStream(in, StreamLimits{Buffered: 9}, false, metrics)
+	in <- record(0)
+	in <- record(1)
+	expect("internal", out, "closed")
+	in <- record(2)
+	close(in)
+
+	for _, testcase := range []struct {
+		stream string
+		want   float64
+	}{
+		{"user", 1},
+		{"internal", 1},
+	} {
+		if have := counterValue(metrics.evictions.WithLabelValues(testcase.stream)); testcase.want != have {
+			t.Errorf("%s: want %v evictions, have %v", testcase.stream, testcase.want, have)
+		}
+	}
+
+	// Every user stream's drops are observed, once it's done.
+	deadline := time.Now().Add(time.Second)
+	for {
+		h := gatherHistogram(t, reg, "oklog_store_stream_dropped_records", "")
+		if h.GetSampleCount() == 3 {
+			if want, have := 5., h.GetSampleSum(); want != have {
+				t.Errorf("want %v records dropped, have %v", want, have)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want 3 streams observed, have %d", h.GetSampleCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAPIUserStreamSlowClient(t *testing.T) {
+	t.Parallel()
+
+	backend, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer backend.Close()
+	front, frontServer := newStreamFixture(t, staticPeer{strings.TrimPrefix(server.URL, "http://")})
+	defer frontServer.Close()
+	defer front.Close()
+	front.streamLimits = StreamLimits{Buffered: 100}
+
+	// The client takes its first record, and then stalls.
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		client      = newSlowWriter()
+		done        = make(chan struct{})
+	)
+	defer cancel()
+	go func() {
+		defer close(done)
+		front.ServeHTTP(client, httptest.NewRequest("GET", APIPathUserStream+"?window=100ms", nil).WithContext(ctx))
+	}()
+	waitForStreamQueries(t, backend, 1)
+
+	var records bytes.Buffer
+	for i, t0 := 0, time.Now(); i < 20; i++ {
+		fmt.Fprintf(&records, "%s record %02d\n", ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Millisecond)), nil), i) // 36 bytes, and the newline
+	}
+	w := httptest.NewRecorder()
+	backend.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, &records))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+	}
+	time.Sleep(500 * time.Millisecond) // for the window, and then some
+	client.release()
+
+	// Every record was written, or dropped, and marked, in order. By the
+	// time the client was released, the node held at most its buffer for
+	// it, besides the records it had written, and was writing: two more.
+	var (
+		written []string
+		markers int
+		dropped int
+	)
+	deadline := time.Now().Add(time.Second)
+	for len(written)+dropped < 20 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for every record, or its marker; have %q", client.lines())
+		}
+		time.Sleep(10 * time.Millisecond)
+		written, markers, dropped = nil, 0, 0
+		for _, line := range client.lines() {
+			var n int
+			if _, err := fmt.Sscanf(line, "# dropped %d records", &n); err == nil {
+				markers, dropped = markers+1, dropped+n
+				continue
+			}
+			written = append(written, line[ulid.EncodedSize+1:])
+		}
+	}
+	if markers == 0 {
+		t.Errorf("want a marker of dropped records, have none")
+	}
+	if n := len(written); n > 4 {
+		t.Errorf("want at most 4 records held for the client, have %d: %q", n, written)
+	}
+	for i := 1; i < len(written); i++ {
+		if written[i-1] >= written[i] {
+			t.Errorf("records out of order: %q", written)
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the stream to end")
+	}
+}
+
+// slowWriter is the ResponseWriter of a client that takes its first record,
+// and then stalls, until it's released.
+type slowWriter struct {
+	header  http.Header
+	blocked chan struct{} // closed to release the client
+
+	mtx sync.Mutex
+	buf bytes.Buffer
+}
+
+func newSlowWriter() *slowWriter {
+	return &slowWriter{header: http.Header{}, blocked: make(chan struct{})}
+}
+
+func (w *slowWriter) Header() http.Header { return w.header }
+func (w *slowWriter) WriteHeader(int)     {}
+func (w *slowWriter) Flush()              {}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	w.mtx.Lock()
+	stall := bytes.HasSuffix(w.buf.Bytes(), []byte{'\n'}) // a record's written
+	w.mtx.Unlock()
+	if stall {
+		<-w.blocked
+	}
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *slowWriter) release() { close(w.blocked) }
+
+// lines written so far, but for heartbeats.
+func (w *slowWriter) lines() []string {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	var lines []string
+	for _, line := range strings.Split(w.buf.String(), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// throttle paces I/O to bytesPerSecond, on average, and can be paused. Callers
+// wait before each read or write. If bytesPerSecond is zero, only pauses
+// apply.
+type throttle struct {
+	mtx            sync.Mutex
+	bytesPerSecond int64
+	next           time.Time // when the next bytes may go
+	paused         bool
+	resume         chan struct{} // closed when unpaused
+}
+
+func newThrottle(bytesPerSecond int64) *throttle {
+	return &throttle{bytesPerSecond: bytesPerSecond}
+}
+
+// wait until n more bytes may go, or the context is done.
+func (t *throttle) wait(ctx context.Context, n int64) error {
+	t.mtx.Lock()
+	for t.paused {
+		resume := t.resume
+		t.mtx.Unlock()
+		select {
+		case <-resume:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		t.mtx.Lock()
+	}
+	if err := ctx.Err(); err != nil {
+		t.mtx.Unlock()
+		return err
+	}
+	if t.bytesPerSecond <= 0 {
+		t.mtx.Unlock()
+		return nil
+	}
+
+	// Idle time doesn't bank credit, so bursts stay short.
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	due := t.next
+	t.next = t.next.Add(time.Duration(float64(n) / float64(t.bytesPerSecond) * float64(time.Second)))
+	t.mtx.Unlock()
+
+	if due.Equal(now) {
+		return nil
+	}
+	timer := time.NewTimer(due.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pause all I/O until resume.
+func (t *throttle) pause() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if !t.paused {
+		t.paused, t.resume = true, make(chan struct{})
+	}
+}
+
+func (t *throttle) unpause() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.paused {
+		t.paused = false
+		close(t.resume)
+	}
+}
+
+// rate returns the bytes per second.
+func (t *throttle) rate() int64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.bytesPerSecond
+}
+
+// setRate changes the bytes per second, from the next wait on.
+func (t *throttle) setRate(bytesPerSecond int64) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.bytesPerSecond = bytesPerSecond
+}
+
+func (t *throttle) isPaused() bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.paused
+}
+
+// throttledReader throttles reads, and counts the bytes read.
+type throttledReader struct {
+	ctx      context.Context
+	throttle *throttle
+	counter  prometheus.Counter
+	r        io.Reader
+}
+
+func (r throttledReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.counter.Add(float64(n))
+		if werr := r.throttle.wait(r.ctx, int64(n)); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// throttledLog throttles writes to the segments it creates, and counts the
+// bytes written.
+type throttledLog struct {
+	Log
+	ctx      context.Context
+	throttle *throttle
+	counter  prometheus.Counter
+}
+
+func (l throttledLog) Create() (WriteSegment, error) {
+	w, err := l.Log.Create()
+	if err != nil {
+		return nil, err
+	}
+	return throttledWriteSegment{w, l}, nil
+}
+
+type throttledWriteSegment struct {
+	WriteSegment
+	l throttledLog
+}
+
+func (w throttledWriteSegment) Write(p []byte) (int, error) {
+	if err := w.l.throttle.wait(w.l.ctx, int64(len(p))); err != nil {
+		return 0, err
+	}
+	n, err := w.WriteSegment.Write(p)
+	w.l.counter.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	t.Parallel()
+
+	var (
+		throttle = newThrottle(1000)
+		begin    = time.Now()
+	)
+	for i := 0; i < 3; i++ {
+		if err := throttle.wait(context.Background(), 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want, have := 200*time.Millisecond, time.Since(begin); have < want {
+		t.Errorf("300 bytes at 1000 bytes/sec: want at least %s, have %s", want, have)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if want, have := context.Canceled, throttle.wait(ctx, 1000); want != have {
+		t.Errorf("canceled: want %v, have %v", want, have)
+	}
+}
+
+func TestThrottlePause(t *testing.T) {
+	t.Parallel()
+
+	throttle := newThrottle(0)
+	throttle.pause()
+	done := make(chan error)
+	go func() { done <- throttle.wait(context.Background(), 1) }()
+	select {
+	case err := <-done:
+		t.Fatalf("wait returned while paused: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	throttle.unpause()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait didn't return after unpause")
+	}
+}
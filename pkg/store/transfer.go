@@ -0,0 +1,492 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+// extTransfer is the extension of the files transfers are staged in.
+const extTransfer = ".transfer"
+
+// Senders retry a chunk that fails up to maxChunkRetries times in a row,
+// waiting chunkRetryWait between tries, as long as the transfer hasn't run for
+// its timeout, before they abandon it.
+const (
+	maxChunkRetries = 5
+	chunkRetryWait  = 250 * time.Millisecond
+)
+
+// validTransferID matches the IDs senders give their transfers, which name
+// the files they're staged in.
+var validTransferID = regexp.MustCompile(`^[0-9A-Za-z-]{1,64}$`)
+
+// Transfers stages the segments replicated to this node in chunks, with
+// APIPathReplicateChunk, each in a file in a directory, until the last chunk,
+// with the checksum of the whole segment, arrives. A transfer that fails part
+// way is resumed from the last byte that was staged, so a big segment needn't
+// be sent again from the start. Transfers that get no
+// chunk for the timeout are abandoned, and their files removed.
+type Transfers struct {
+	filesys  fs.Filesystem
+	dir      string
+	timeout  time.Duration
+	reporter EventReporter
+
+	mtx    sync.Mutex
+	active map[string]*transfer
+	stop   chan chan struct{}
+}
+
+// transfer is a segment being staged. Its fields are guarded by the mutex of
+// its Transfers; its file is written by one chunk at a time.
+type transfer struct {
+	file     fs.File
+	offset   int64
+	crc      uint32
+	origins  []string
+	lastSeen time.Time
+	busy     bool // writing a chunk
+}
+
+// NewTransfers returns Transfers staged in dir, abandoned after timeout.
+// Files left in dir by transfers that were in progress when the node last
+// stopped are removed, as they can't be resumed. Don't forget to Run it.
+func NewTransfers(filesys fs.Filesystem, dir string, timeout time.Duration, reporter EventReporter) (*Transfers, error) {
+	if err := filesys.MkdirAll(dir); err != nil {
+		return nil, errors.Wrap(err, "creating transfer directory")
+	}
+	var leftovers []string
+	if err := filesys.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(path) == extTransfer && filepath.Dir(path) == filepath.Clean(dir) {
+			leftovers = append(leftovers, path)
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "finding abandoned transfers")
+	}
+	for _, path := range leftovers {
+		if err := filesys.Remove(path); err != nil {
+			return nil, errors.Wrap(err, "removing abandoned transfer")
+		}
+	}
+	return &Transfers{
+		filesys:  filesys,
+		dir:      dir,
+		timeout:  timeout,
+		reporter: reporter,
+		active:   map[string]*transfer{},
+		stop:     make(chan chan struct{}),
+	}, nil
+}
+
+// Run abandons transfers that time out, until Stop is invoked.
+func (t *Transfers) Run() {
+	ticker := time.NewTicker(t.timeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			t.sweep(now)
+		case q := <-t.stop:
+			t.sweep(time.Now().Add(t.timeout)) // all of them
+			close(q)
+			return
+		}
+	}
+}
+
+// Stop the Transfers, abandoning those in progress.
+func (t *Transfers) Stop() {
+	q := make(chan struct{})
+	t.stop <- q
+	<-q
+}
+
+// sweep abandons the transfers that had no chunk for the timeout, as of now,
+// unless they're writing one.
+func (t *Transfers) sweep(now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for id, tr := range t.active {
+		if tr.busy || now.Sub(tr.lastSeen) < t.timeout {
+			continue
+		}
+		t.remove(id, tr)
+		t.reporter.ReportEvent(Event{
+			Op: "replicateChunk", File: tr.file.Name(),
+			Warning: errors.Errorf("transfer %s abandoned, after %d bytes", id, tr.offset),
+		})
+	}
+}
+
+// remove the transfer, and its file. The mutex must be held.
+func (t *Transfers) remove(id string, tr *transfer) {
+	delete(t.active, id)
+	tr.file.Close()
+	t.filesys.Remove(tr.file.Name())
+}
+
+// Offset returns how many bytes of the transfer are staged: zero, if there's
+// no such transfer.
+func (t *Transfers) Offset(id string) int64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if tr, ok := t.active[id]; ok {
+		return tr.offset
+	}
+	return 0
+}
+
+// Abandon the transfer, if it's in progress, and not writing a chunk.
+func (t *Transfers) Abandon(id string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if tr, ok := t.active[id]; ok && !tr.busy {
+		t.remove(id, tr)
+	}
+}
+
+// offsetError is why a chunk is refused, if it doesn't start at the offset
+// the transfer has reached, e.g. because the acknowledgement of the last one
+// was lost. The sender should carry on from there.
+type offsetError struct {
+	offset int64
+}
+
+func (e offsetError) Error() string {
+	return fmt.Sprintf("transfer is at offset %d", e.offset)
+}
+
+// write stages a chunk of the transfer, which starts at offset, and returns
+// the offset it reached. A transfer is begun by its first chunk, at offset
+// zero. What's read of the chunk is staged, even if the rest of it can't be,
+// so a chunk cut short is resumed from where it stopped.
+func (t *Transfers) write(id string, offset int64, origins []string, chunk io.Reader) (int64, error) {
+	t.mtx.Lock()
+	tr, ok := t.active[id]
+	switch {
+	case !ok && offset == 0:
+		f, err := t.filesys.Create(filepath.Join(t.dir, id+extTransfer))
+		if err != nil {
+			t.mtx.Unlock()
+			return 0, errors.Wrap(err, "creating transfer")
+		}
+		tr = &transfer{file: f, origins: origins}
+		t.active[id] = tr
+	case !ok:
+		t.mtx.Unlock()
+		return 0, offsetError{0}
+	case tr.busy:
+		t.mtx.Unlock()
+		return 0, errors.New("transfer is already writing a chunk")
+	case offset != tr.offset:
+		t.mtx.Unlock()
+		return 0, offsetError{tr.offset}
+	}
+	tr.busy, tr.lastSeen = true, time.Now()
+	t.mtx.Unlock()
+
+	var (
+		buf   = make([]byte, 32*1024)
+		n     int64
+		crc   = tr.crc
+		rerr  error
+		werr  error
+		nread int
+	)
+	for rerr == nil && werr == nil {
+		nread, rerr = chunk.Read(buf)
+		if nread > 0 {
+			_, werr = tr.file.Write(buf[:nread])
+			crc = crc32.Update(crc, castagnoli, buf[:nread])
+			n += int64(nread)
+		}
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if werr != nil {
+		t.remove(id, tr) // what's staged is no longer what was sent
+		return 0, errors.Wrap(werr, "staging chunk")
+	}
+	tr.offset += n
+	tr.crc = crc
+	tr.busy, tr.lastSeen = false, time.Now()
+	if rerr != io.EOF {
+		return tr.offset, errors.Wrap(rerr, "reading chunk")
+	}
+	return tr.offset, nil
+}
+
+// finish ends the transfer, once its last chunk is staged, and returns its
+// file, to be read from the start, and the origins it was begun with. The
+// transfer fails, and is abandoned, if what's staged isn't the size, or
+// doesn't have the checksum, of the whole segment. The caller must close, and
+// remove, the file.
+func (t *Transfers) finish(id string, size int64, checksum uint32) (fs.File, []string, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	tr, ok := t.active[id]
+	if !ok {
+		return nil, nil, offsetError{0}
+	}
+	if tr.busy {
+		return nil, nil, errors.New("transfer is still writing a chunk")
+	}
+	if tr.offset != size {
+		return nil, nil, offsetError{tr.offset}
+	}
+	if tr.crc != checksum {
+		t.remove(id, tr)
+		return nil, nil, checksumError{errors.Errorf("checksum of %d bytes is %d, not %d", size, tr.crc, checksum)}
+	}
+	delete(t.active, id)
+	name := tr.file.Name()
+	if err := tr.file.Close(); err != nil {
+		t.filesys.Remove(name)
+		return nil, nil, errors.Wrap(err, "closing transfer")
+	}
+	f, err := t.filesys.Open(name)
+	if err != nil {
+		t.filesys.Remove(name)
+		return nil, nil, errors.Wrap(err, "opening transfer")
+	}
+	return f, tr.origins, nil
+}
+
+// checksumError is a transfer whose staged bytes aren't the segment's.
+type checksumError struct{ error }
+
+// handleReplicateChunk serves APIPathReplicateChunk, for segments replicated
+// in chunks; see Transfers. A POST stages a chunk of the transfer, from the
+// offset, and the last chunk, with final, and the CRC-32C checksum of the
+// whole segment, creates the segment, as a POST to APIPathReplicate does. A
+// GET returns how many bytes of the transfer are staged, and a DELETE
+// abandons it. Either way, the offset the transfer has reached is in the
+// httpHeaderTransferOffset header. A chunk that starts elsewhere is refused
+// with 409 Conflict.
+func (a *API) handleReplicateChunk(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if a.transfers == nil {
+		http.NotFound(w, r) // so senders replicate whole segments
+		return
+	}
+	id := r.URL.Query().Get("transfer")
+	if !validTransferID.MatchString(id) {
+		http.Error(w, fmt.Sprintf("parsing 'transfer': %q isn't a transfer ID", id), http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		offset := a.transfers.Offset(id)
+		w.Header().Set(httpHeaderTransferOffset, strconv.FormatInt(offset, 10))
+		fmt.Fprintln(w, offset)
+		return
+	case "DELETE":
+		a.transfers.Abandon(id)
+		w.Header().Set(httpHeaderTransferOffset, "0")
+		fmt.Fprintln(w, "OK")
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "parsing 'offset': want the byte offset of the chunk", http.StatusBadRequest)
+		return
+	}
+	var (
+		final    bool
+		checksum uint64
+	)
+	if s := r.URL.Query().Get("final"); s != "" {
+		if final, err = strconv.ParseBool(s); err != nil {
+			http.Error(w, errors.Wrap(err, "parsing 'final'").Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if final {
+		if checksum, err = strconv.ParseUint(r.URL.Query().Get("checksum"), 10, 32); err != nil {
+			http.Error(w, "parsing 'checksum': want the CRC-32C of the segment", http.StatusBadRequest)
+			return
+		}
+	}
+
+	reached, err := a.transfers.write(id, offset, r.Header[httpHeaderOrigins], r.Body)
+	if err, ok := err.(offsetError); ok {
+		w.Header().Set(httpHeaderTransferOffset, strconv.FormatInt(err.offset, 10))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set(httpHeaderTransferOffset, strconv.FormatInt(reached, 10))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !final {
+		fmt.Fprintln(w, reached)
+		return
+	}
+
+	f, origins, err := a.transfers.finish(id, reached, uint32(checksum))
+	switch err.(type) {
+	case nil:
+	case offsetError:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case checksumError:
+		w.Header().Set(httpHeaderTransferOffset, "0")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer a.transfers.filesys.Remove(f.Name())
+	defer f.Close()
+	body, err := ioutil.ReadAll(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, err := a.replicate(body, origins, r.Header.Get(httpHeaderShip) == "true"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else if n == 0 {
+		fmt.Fprintln(w, "No records")
+	} else {
+		fmt.Fprintln(w, "OK")
+	}
+}
+
+// errChunksUnsupported is why replicateChunked fails, if the target doesn't
+// serve APIPathReplicateChunk. The segment should be replicated whole.
+var errChunksUnsupported = errors.New("target doesn't support chunked replication")
+
+// replicateChunked replicates the segment to the target's APIPathReplicate
+// Chunk, chunkSize bytes at a time. A chunk that fails is retried, from the
+// offset the target reached, as long as the transfer hasn't run for timeout;
+// then the transfer is abandoned, and the target told so.
+func replicateChunked(client Doer, target string, segment []byte, origins []string, ship bool, chunkSize int, timeout time.Duration) error {
+	var (
+		id       = uuid.New()
+		checksum = crc32.Checksum(segment, castagnoli)
+		uri      = fmt.Sprintf("http://%s/store%s?transfer=%s", target, APIPathReplicateChunk, id)
+		deadline = time.Now().Add(timeout)
+		offset   int64
+		failures int
+		size     = int64(len(segment))
+	)
+	for {
+		end := offset + int64(chunkSize)
+		if end > size {
+			end = size
+		}
+		query := fmt.Sprintf("&offset=%d", offset)
+		if end == size {
+			query += fmt.Sprintf("&final=true&checksum=%d", checksum)
+		}
+		req, err := http.NewRequest("POST", uri+query, bytes.NewReader(segment[offset:end]))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/binary")
+		for _, origin := range origins {
+			req.Header.Add(httpHeaderOrigins, origin)
+		}
+		if ship {
+			req.Header.Set(httpHeaderShip, "true")
+		}
+
+		reached, err := chunkResponse(client.Do(req))
+		switch {
+		case err == nil && end == size:
+			return nil
+		case err == nil:
+			offset, failures = reached, 0
+			continue
+		case err == errChunksUnsupported && offset == 0:
+			return err
+		case isPermanent(err):
+			abandonTransfer(client, uri)
+			return err
+		}
+
+		// Resume from wherever the target got to, if it's sensible.
+		if failures++; failures > maxChunkRetries || time.Now().Add(chunkRetryWait).After(deadline) {
+			abandonTransfer(client, uri)
+			return errors.Wrapf(err, "transfer abandoned at offset %d", offset)
+		}
+		time.Sleep(chunkRetryWait)
+		if reached < 0 {
+			req, _ := http.NewRequest("GET", uri, nil)
+			reached, _ = chunkResponse(client.Do(req))
+		}
+		if reached >= 0 && reached <= size {
+			offset = reached
+		}
+	}
+}
+
+// permanentError is a chunk the target refused, which won't work again.
+type permanentError struct{ error }
+
+func isPermanent(err error) bool {
+	_, ok := err.(permanentError)
+	return ok
+}
+
+// chunkResponse returns the offset a transfer reached, from the response to
+// one of its requests, or -1 if it doesn't say.
+func chunkResponse(resp *http.Response, err error) (int64, error) {
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	reached, perr := strconv.ParseInt(resp.Header.Get(httpHeaderTransferOffset), 10, 64)
+	if perr != nil {
+		reached = -1
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		if reached < 0 {
+			return -1, errors.New("no transfer offset in response")
+		}
+		return reached, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return -1, errChunksUnsupported
+	case resp.StatusCode == http.StatusConflict, resp.StatusCode >= 500:
+		return reached, errors.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	default:
+		return reached, permanentError{errors.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))}
+	}
+}
+
+// abandonTransfer tells the target to abandon the transfer, if it can, so
+// its file is removed before it times out.
+func abandonTransfer(client Doer, uri string) {
+	req, err := http.NewRequest("DELETE", uri, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := client.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,279 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestReplicateChunkedResume(t *testing.T) {
+	t.Parallel()
+
+	a, server, filesys := newTransferFixture(t)
+	defer server.Close()
+	defer a.Close()
+	segment := transferSegment(200)
+
+	// The third request is cut off half way through its chunk, and the
+	// response to the fifth is lost, so the sender resumes from wherever
+	// the target got to, mid-chunk, and past the chunk it thinks it sent.
+	var (
+		mtx      sync.Mutex
+		requests int
+		resumes  []string
+	)
+	client := doerFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != "POST" {
+			resp, err := http.DefaultClient.Do(req)
+			if err == nil {
+				mtx.Lock()
+				resumes = append(resumes, resp.Header.Get(httpHeaderTransferOffset))
+				mtx.Unlock()
+			}
+			return resp, err
+		}
+		mtx.Lock()
+		requests++
+		n := requests
+		mtx.Unlock()
+		switch n {
+		case 3:
+			chunk, _ := ioutil.ReadAll(req.Body)
+			req.Body = ioutil.NopCloser(bytes.NewReader(chunk[:len(chunk)/2]))
+			req.ContentLength = int64(len(chunk) / 2)
+			if resp, err := http.DefaultClient.Do(req); err == nil {
+				resp.Body.Close()
+			}
+			return nil, fmt.Errorf("connection reset")
+		case 5:
+			if resp, err := http.DefaultClient.Do(req); err == nil {
+				resp.Body.Close()
+			}
+			return nil, fmt.Errorf("connection reset")
+		}
+		return http.DefaultClient.Do(req)
+	})
+
+	target := strings.TrimPrefix(server.URL, "http://")
+	if err := replicateChunked(client, target, segment, []string{"env=prod"}, false, 1000, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := fmt.Sprint([]string{"2500", "4500"}), fmt.Sprint(resumes); want != have {
+		t.Errorf("resumed from: want %s, have %s", want, have)
+	}
+
+	// The replicated segment is the one that was sent.
+	have := queryAll(t, a.log)
+	if !bytes.Equal(segment, have) {
+		t.Fatalf("want %d bytes replicated, have %d", len(segment), len(have))
+	}
+	if want, have := crc32.Checksum(segment, castagnoli), crc32.Checksum(have, castagnoli); want != have {
+		t.Errorf("checksum: want %d, have %d", want, have)
+	}
+	if want, have := 0, len(transferFiles(t, filesys)); want != have {
+		t.Errorf("transfer files left: want %d, have %d", want, have)
+	}
+}
+
+func TestReplicateChunkedChecksum(t *testing.T) {
+	t.Parallel()
+
+	a, server, filesys := newTransferFixture(t)
+	defer server.Close()
+	defer a.Close()
+	segment := transferSegment(10)
+
+	post := func(query string, body []byte) int {
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicateChunk+"?transfer=abc&"+query, bytes.NewReader(body)))
+		return w.Code
+	}
+	half := len(segment) / 2
+	for _, testcase := range []struct {
+		name  string
+		query string
+		body  []byte
+		want  int
+	}{
+		{"first chunk", "offset=0", segment[:half], http.StatusOK},
+		{"again", "offset=0", segment[:half], http.StatusConflict},
+		{"gap", fmt.Sprintf("offset=%d", half+1), segment[half+1:], http.StatusConflict},
+		{"bad checksum", fmt.Sprintf("offset=%d&final=true&checksum=%d", half, crc32.Checksum(segment, castagnoli)+1), segment[half:], http.StatusBadRequest},
+		{"abandoned", fmt.Sprintf("offset=%d", half), segment[half:], http.StatusConflict},
+	} {
+		if want, have := testcase.want, post(testcase.query, testcase.body); want != have {
+			t.Errorf("%s: want HTTP %d, have %d", testcase.name, want, have)
+		}
+	}
+	if want, have := 0, len(queryAll(t, a.log)); want != have {
+		t.Errorf("want %d bytes replicated, have %d", want, have)
+	}
+	if want, have := 0, len(transferFiles(t, filesys)); want != have {
+		t.Errorf("transfer files left: want %d, have %d", want, have)
+	}
+}
+
+func TestTransfersAbandoned(t *testing.T) {
+	t.Parallel()
+
+	filesys := fs.NewVirtualFilesystem()
+	if err := filesys.MkdirAll("/transfers"); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := filesys.Create("/transfers/leftover" + extTransfer); err != nil {
+		t.Fatal(err)
+	} else {
+		f.Close()
+	}
+	reporter := &eventRecorder{}
+	transfers, err := NewTransfers(filesys, "/transfers", time.Minute, reporter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 0, len(transferFiles(t, filesys)); want != have {
+		t.Errorf("after restart: want %d transfer files, have %d", want, have)
+	}
+
+	if _, err := transfers.write("abc", 0, nil, bytes.NewReader([]byte("partial"))); err != nil {
+		t.Fatal(err)
+	}
+	transfers.sweep(time.Now())
+	if want, have := int64(len("partial")), transfers.Offset("abc"); want != have {
+		t.Errorf("before the timeout: want offset %d, have %d", want, have)
+	}
+	transfers.sweep(time.Now().Add(time.Minute))
+	if want, have := int64(0), transfers.Offset("abc"); want != have {
+		t.Errorf("after the timeout: want offset %d, have %d", want, have)
+	}
+	if want, have := 0, len(transferFiles(t, filesys)); want != have {
+		t.Errorf("after the timeout: want %d transfer files, have %d", want, have)
+	}
+	if want, have := 1, len(reporter.events); want != have {
+		t.Errorf("want %d events, have %d", want, have)
+	}
+}
+
+func TestReplicateChunkedUnsupported(t *testing.T) {
+	t.Parallel()
+
+	a, server := newStreamFixture(t, staticPeer(nil)) // no transfers
+	defer server.Close()
+	defer a.Close()
+	segment := transferSegment(20)
+
+	target := strings.TrimPrefix(server.URL, "http://")
+	if want, have := errChunksUnsupported, replicateChunked(http.DefaultClient, target, segment, nil, false, 100, time.Minute); want != have {
+		t.Fatalf("want %v, have %v", want, have)
+	}
+
+	// Consumers send such targets whole segments, instead.
+	c := NewConsumer(
+		staticPeer{target}, "", http.DefaultClient,
+		1024, time.Hour, time.Hour,
+		1, 100, time.Minute, nil, nil, nil,
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		prometheus.NewCounter(prometheus.CounterOpts{}),
+		&eventRecorder{},
+	)
+	c.active.Write(segment)
+	if !c.replicateTo(target, false) {
+		t.Fatal("replication failed")
+	}
+	if !c.unchunked[target] {
+		t.Error("target not remembered as unchunked")
+	}
+	if want, have := segment, queryAll(t, a.log); !bytes.Equal(want, have) {
+		t.Errorf("want %d bytes replicated, have %d", len(want), len(have))
+	}
+}
+
+// newTransferFixture returns an empty API, which takes segments in chunks,
+// served by a real HTTP server.
+func newTransferFixture(t *testing.T) (*API, *httptest.Server, fs.Filesystem) {
+	filesys := fs.NewVirtualFilesystem()
+	filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{Reporter: LogReporter{log.NewNopLogger()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfers, err := NewTransfers(filesys, "/transfers", time.Minute, LogReporter{log.NewNopLogger()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		replicatedSegments = prometheus.NewCounter(prometheus.CounterOpts{})
+		replicatedBytes    = prometheus.NewCounter(prometheus.CounterOpts{})
+		duration           = prometheus.NewHistogramVec(prometheus.HistogramOpts{}, []string{"method", "path", "status_code"})
+		mux                = http.NewServeMux()
+		a                  = NewAPI(staticPeer(nil), filelog, APIConfig{
+			QueryClient:        http.DefaultClient,
+			StreamClient:       http.DefaultClient,
+			ReplicatedSegments: replicatedSegments,
+			ReplicatedBytes:    replicatedBytes,
+			Duration:           duration,
+			Reporter:           LogReporter{log.NewNopLogger()},
+			Transfers:          transfers,
+		})
+	)
+	mux.Handle("/store/", http.StripPrefix("/store", a))
+	return a, httptest.NewServer(mux), filesys
+}
+
+// transferSegment returns a segment of n records, in order.
+func transferSegment(n int) []byte {
+	var (
+		buf bytes.Buffer
+		now = time.Now()
+	)
+	for i := 0; i < n; i++ {
+		id := ulid.MustNew(ulid.Timestamp(now.Add(time.Duration(i)*time.Millisecond)), rand.Reader)
+		fmt.Fprintf(&buf, "%s record %07d\n", id, i)
+	}
+	return buf.Bytes()
+}
+
+func queryAll(t *testing.T, l Log) []byte {
+	result, err := l.Query(context.Background(), QueryParams{
+		From: ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(time.Now().Add(-time.Hour)), nil)},
+		To:   ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(time.Now().Add(time.Hour)), nil)},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer result.Records.Close()
+	b, err := ioutil.ReadAll(result.Records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func transferFiles(t *testing.T, filesys fs.Filesystem) []string {
+	var files []string
+	if err := filesys.Walk("/transfers", func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
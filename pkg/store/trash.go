@@ -0,0 +1,90 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+// TrashHandler serves the trash admin API: GET lists the trashed segments,
+// POST to /restore?segment=NAME makes one queryable again, e.g. after it was
+// trashed by mistake, and POST to /purge purges them all, without waiting out
+// the purge window. A restored segment is trashed again if it's still outside
+// the retention window, so widen that first.
+func (c *Compacter) TrashHandler() http.Handler {
+	return http.HandlerFunc(c.serveTrash)
+}
+
+func (c *Compacter) serveTrash(w http.ResponseWriter, r *http.Request) {
+	var result interface{}
+	switch {
+	case r.Method == "GET" && (r.URL.Path == "" || r.URL.Path == "/"):
+		segments, err := c.log.Trashed()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list := make([]trashedSegmentJSON, len(segments))
+		for i, s := range segments {
+			list[i] = trashedSegmentJSON{
+				Segment: s.Name,
+				Size:    s.Size,
+				Low:     s.Low.String(),
+				High:    s.High.String(),
+				From:    ulidutil.TimeOf(s.Low),
+				To:      ulidutil.TimeOf(s.High),
+				Trashed: s.Trashed.UTC(),
+			}
+		}
+		result = list
+
+	case r.Method == "POST" && r.URL.Path == "/restore":
+		segment := r.URL.Query().Get("segment")
+		if segment == "" {
+			http.Error(w, "segment is required", http.StatusBadRequest)
+			return
+		}
+		err := c.log.Restore(segment)
+		if err == ErrSegmentNotFound {
+			http.Error(w, fmt.Sprintf("%s: %v", segment, err), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		c.reporter.ReportEvent(Event{Op: "restoreTrash", File: segment, Msg: "restored from the trash"})
+		result = map[string]string{"restored": segment}
+
+	case r.Method == "POST" && r.URL.Path == "/purge":
+		// Anything trashed by now, give or take the filesystem's clock.
+		purged := c.purgeTrash(time.Now().Add(time.Minute))
+		c.reporter.ReportEvent(Event{Op: "emptyTrash", Msg: fmt.Sprintf("purged %d segment(s) on request", purged)})
+		result = map[string]int{"purged": purged}
+
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	buf, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(buf)
+}
+
+type trashedSegmentJSON struct {
+	Segment string    `json:"segment"`
+	Size    int64     `json:"size"`
+	Low     string    `json:"low"`
+	High    string    `json:"high"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Trashed time.Time `json:"trashed"`
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestTrashHandler(t *testing.T) {
+	t.Parallel()
+
+	filesys := fs.NewVirtualFilesystem()
+	filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+
+	now := time.Now()
+	// writeSegment writes a segment of records from oldest to newest ago.
+	writeSegment := func(oldest, newest time.Duration) (name string, records []string) {
+		segment, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []ulid.ULID
+		for _, ago := range []time.Duration{oldest, (oldest + newest) / 2, newest} {
+			id := ulid.MustNew(ulid.Timestamp(now.Add(-ago)), rand.Reader)
+			ids = append(ids, id)
+			records = append(records, fmt.Sprintf("%s %s ago\n", id, ago))
+		}
+		fmt.Fprint(segment, strings.Join(records, ""))
+		if err := segment.Close(ids[0], ids[len(ids)-1]); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("%s-%s", ids[0], ids[len(ids)-1]), records
+	}
+	query := func() string {
+		result, err := filelog.Query(context.Background(), QueryParams{
+			From: ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(now.Add(-24*time.Hour)), nil)},
+			To:   ulidOrTime{ULID: ulid.MustNew(ulid.Timestamp(now), nil)},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer result.Records.Close()
+		b, err := ioutil.ReadAll(result.Records)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	// Two segments are trashed, and two more are replicated since, which
+	// overlap one of them.
+	var (
+		oldest, _       = writeSegment(6*time.Hour, 5*time.Hour)
+		old, oldRecords = writeSegment(4*time.Hour, 2*time.Hour)
+	)
+	trashable, err := filelog.Trashable(now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, segment := range trashable {
+		if err := segment.Trash(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, newRecords := writeSegment(3*time.Hour, time.Hour)
+	_, newerRecords := writeSegment(3*time.Hour+30*time.Minute, 30*time.Minute)
+	newRecords = append(newRecords, newerRecords...)
+	sort.Strings(newRecords)
+
+	c := newTestCompacter(filelog, 0, &eventRecorder{})
+	do := func(method, path string, want int) string {
+		w := httptest.NewRecorder()
+		c.TrashHandler().ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		if w.Code != want {
+			t.Fatalf("%s %s: want HTTP %d, have %d: %s", method, path, want, w.Code, strings.TrimSpace(w.Body.String()))
+		}
+		return w.Body.String()
+	}
+	list := func() (names []string) {
+		var segments []trashedSegmentJSON
+		if err := json.Unmarshal([]byte(do("GET", "/", http.StatusOK)), &segments); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range segments {
+			if s.Size <= 0 || s.Segment != s.Low+"-"+s.High || s.To.Before(s.From) || time.Since(s.Trashed) > time.Minute {
+				t.Errorf("%s: bad listing: %+v", s.Segment, s)
+			}
+			names = append(names, s.Segment)
+		}
+		return names
+	}
+
+	// List.
+	if want, have := []string{oldest, old}, list(); !reflect.DeepEqual(want, have) {
+		t.Fatalf("trash: want %v, have %v", want, have)
+	}
+
+	// Restore. The restored segment is queried again, and compacted with
+	// the ones it overlaps.
+	if want, have := strings.Join(newRecords, ""), query(); want != have {
+		t.Fatalf("before restore: want %q, have %q", want, have)
+	}
+	do("POST", "/restore?segment="+old, http.StatusOK)
+	do("POST", "/restore?segment="+old, http.StatusNotFound)
+	do("POST", "/restore?segment=../"+oldest, http.StatusNotFound)
+	do("POST", "/restore", http.StatusBadRequest)
+	if want, have := []string{oldest}, list(); !reflect.DeepEqual(want, have) {
+		t.Fatalf("after restore: want %v, have %v", want, have)
+	}
+	records := append(oldRecords, newRecords...)
+	sort.Strings(records)
+	if want, have := strings.Join(records, ""), query(); want != have {
+		t.Fatalf("after restore: want %q, have %q", want, have)
+	}
+	if compacted, result := c.compact("Overlapping", filelog.Overlapping); compacted != 3 || result != "OK" {
+		t.Fatalf("after restore: compacted %d segments, %s", compacted, result)
+	}
+	if want, have := map[string]int{extFlushed: 1, extTrashed: 1}, countSegments(t, filesys); !reflect.DeepEqual(want, have) {
+		t.Errorf("after compaction: want %v, have %v", want, have)
+	}
+	if want, have := strings.Join(records, ""), query(); want != have {
+		t.Fatalf("after compaction: want %q, have %q", want, have)
+	}
+
+	// Purge, without waiting out the purge window.
+	if want, have := `{"purged":1}`, compactJSON(t, do("POST", "/purge", http.StatusOK)); want != have {
+		t.Errorf("purge: want %s, have %s", want, have)
+	}
+	if want, have := 0, len(list()); want != have {
+		t.Errorf("after purge: want %d trashed segments, have %d", want, have)
+	}
+	if want, have := map[string]int{extFlushed: 1}, countSegments(t, filesys); !reflect.DeepEqual(want, have) {
+		t.Errorf("after purge: want %v, have %v", want, have)
+	}
+}
+
+func compactJSON(t *testing.T, s string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
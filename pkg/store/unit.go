@@ -0,0 +1,251 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+// extUnit is the extension of the manifest of a segment unit.
+const extUnit = ".unit"
+
+// sidecarExts are the extensions of the files stored alongside a segment, by
+// the same name, which queries read along with it.
+var sidecarExts = []string{extBloom, extChecksum, extLabels}
+
+// errUncommittedUnit is the error reading a manifest that's incomplete, e.g.
+// torn by a crash, so its unit was never committed.
+var errUncommittedUnit = errors.New("incomplete manifest, so the unit wasn't committed")
+
+// segmentUnit is a segment and its sidecars, which are published together, so
+// no query reads a segment without its sidecars, or, when compaction replaces
+// a segment with one of the same name, e.g. one that spans the segments it
+// overlapped, with the sidecars of the segment it replaces.
+//
+// A unit is published in three steps.
+//
+//  1. The segment and its sidecars are written, and synced, under the active
+//     segment's name, e.g. UUID.active, or UUID.sealing, and UUID.bloom.
+//  2. The manifest, LOW-HIGH.unit, which names the staged segment, and the
+//     sidecars the unit has, is written, and synced. That commits the unit.
+//  3. The sidecars are renamed into place, as LOW-HIGH.bloom and so on, and
+//     those the unit hasn't got are removed. Then the segment is renamed, to
+//     LOW-HIGH.flushed, and the manifest is removed.
+//
+// The log's queries are held off during the third step, so they never see
+// the unit in between. A reading segment that the unit replaces leaves the
+// index then, too; its records are all in the unit, which spans it. It keeps
+// the manifest, as the record of that, until it's purged.
+//
+// Recovery resolves the units a crash left in between by their manifests.
+// Without a complete manifest, a unit was never committed, so its staged
+// files are recovered like any others. With one, it's rolled forward: the
+// third step is done again, skipping what's done already, and a reading
+// segment it replaces is removed.
+type segmentUnit struct {
+	manifest string   // LOW-HIGH.unit
+	segment  string   // staged, e.g. UUID.active
+	sidecars []string // extensions, of those staged, as UUID.ext
+}
+
+// staged returns the path of the unit's file with the extension, before it's
+// published.
+func (u segmentUnit) staged(ext string) string {
+	return modifyExtension(u.segment, ext)
+}
+
+// target returns the path of the unit's file with the extension, once it's
+// published.
+func (u segmentUnit) target(ext string) string {
+	return modifyExtension(u.manifest, ext)
+}
+
+func (u segmentUnit) has(ext string) bool {
+	for _, sidecar := range u.sidecars {
+		if sidecar == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// commit the unit, by writing and syncing its manifest: the name of the
+// staged segment, and the sidecars' extensions, a line each, and an empty
+// line, so a torn manifest is told apart.
+func (u segmentUnit) commit(filesys fs.Filesystem) error {
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, filepath.Base(u.segment))
+	for _, ext := range u.sidecars {
+		fmt.Fprintln(&buf, ext)
+	}
+	fmt.Fprintln(&buf)
+	f, err := filesys.Create(u.manifest)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		filesys.Remove(u.manifest)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		filesys.Remove(u.manifest)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		filesys.Remove(u.manifest)
+		return err
+	}
+	return nil
+}
+
+// discard the staged files of a unit that won't be committed, except for the
+// active segment, which is its writer's to delete.
+func (u segmentUnit) discard(filesys fs.Filesystem) {
+	for _, ext := range u.sidecars {
+		filesys.Remove(u.staged(ext))
+	}
+	if filepath.Ext(u.segment) == extSealing {
+		filesys.Remove(u.segment)
+	}
+}
+
+// publish the committed unit, i.e. the third step, but for removing the
+// manifest. It skips what's done already, so it can be done again.
+func (u segmentUnit) publish(filesys fs.Filesystem) error {
+	for _, ext := range sidecarExts {
+		switch {
+		case !u.has(ext):
+			filesys.Remove(u.target(ext)) // of the segment the unit replaces, if any
+		case filesys.Exists(u.staged(ext)):
+			if err := filesys.Rename(u.staged(ext), u.target(ext)); err != nil {
+				return err
+			}
+		}
+	}
+	if !filesys.Exists(u.segment) {
+		return nil
+	}
+	if filepath.Ext(u.segment) == extSealing {
+		// The sealed segment supersedes the active one it was sealed from.
+		filesys.Remove(modifyExtension(u.segment, extActive))
+	}
+	return filesys.Rename(u.segment, u.target(extFlushed))
+}
+
+// readUnit reads the manifest at path.
+func readUnit(filesys fs.Filesystem, path string) (segmentUnit, error) {
+	f, err := filesys.Open(path)
+	if err != nil {
+		return segmentUnit{}, err
+	}
+	defer f.Close()
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		return segmentUnit{}, err
+	}
+	if !bytes.HasSuffix(buf, []byte("\n\n")) {
+		return segmentUnit{}, errUncommittedUnit
+	}
+	lines := strings.Split(string(buf[:len(buf)-2]), "\n")
+	u := segmentUnit{
+		manifest: path,
+		segment:  filepath.Join(filepath.Dir(path), lines[0]),
+		sidecars: lines[1:],
+	}
+	if ext := filepath.Ext(u.segment); ext != extActive && ext != extSealing {
+		return segmentUnit{}, errors.Errorf("invalid staged segment %q", lines[0])
+	}
+	for _, ext := range u.sidecars {
+		if !isSidecarExt(ext) {
+			return segmentUnit{}, errors.Errorf("invalid sidecar %q", ext)
+		}
+	}
+	return u, nil
+}
+
+func isSidecarExt(ext string) bool {
+	for _, sidecar := range sidecarExts {
+		if sidecar == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// recoverUnits resolves the units in root that a crash left in the middle of
+// being published, by their manifests; see segmentUnit. It's the first step
+// of recoverSegments, which recovers the uncommitted units' staged files.
+func recoverUnits(filesys fs.Filesystem, root string, reporter EventReporter) error {
+	report := func(path, msg string) {
+		reporter.ReportEvent(Event{Op: "recoverSegments", File: path, Msg: msg})
+	}
+	warn := func(path string, err error, msg string) {
+		reporter.ReportEvent(Event{Op: "recoverSegments", File: path, Warning: err, Msg: msg})
+	}
+	var manifests []string
+	corrupt := filepath.Join(root, corruptDir)
+	filesys.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == corrupt && info.IsDir() {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && filepath.Ext(path) == extUnit {
+			manifests = append(manifests, path)
+		}
+		return nil
+	})
+
+	for _, path := range manifests {
+		u, err := readUnit(filesys, path)
+		switch {
+		case err != nil:
+			if err := filesys.Remove(path); err != nil {
+				return err
+			}
+			warn(path, err, "removed the manifest, and will recover the unit's staged files like any others")
+			continue
+
+		case !filesys.Exists(u.segment) && !filesys.Exists(u.target(extFlushed)):
+			// The staged segment is gone, so the sidecars that were renamed
+			// into place are of nothing. A segment the unit would replace
+			// is kept, without any, rather than with the unit's.
+			for _, ext := range sidecarExts {
+				filesys.Remove(u.staged(ext))
+				filesys.Remove(u.target(ext))
+			}
+			if err := filesys.Remove(path); err != nil {
+				return err
+			}
+			warn(path, errors.Errorf("staged segment %s is gone", u.segment), "removed the unit's sidecars")
+			continue
+
+		default:
+			if err := u.publish(filesys); err != nil {
+				return errors.Wrapf(err, "publishing %s", path)
+			}
+			report(path, fmt.Sprintf("published %s", u.target(extFlushed)))
+		}
+
+		if replaced := u.target(extReading); filesys.Exists(replaced) {
+			if err := filesys.Remove(replaced); err != nil {
+				return err
+			}
+			report(replaced, "removed reading segment, which the unit replaced")
+		}
+		if err := filesys.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
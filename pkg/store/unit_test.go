@@ -0,0 +1,203 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/fs"
+)
+
+func TestSegmentUnitCrashConsistency(t *testing.T) {
+	t.Parallel()
+
+	// Segments, one spanning the others, are compacted into one of the
+	// spanning segment's name, until the nth call of an op fails, and then
+	// the machine crashes. While recovered, every segment has its own
+	// sidecars, or none, as does every segment queries would read before
+	// the crash, and, once compacted again, every record is there,
+	// though a failed purge may leave duplicates, for compaction to remove.
+	for _, op := range []string{"create", "write", "sync", "rename", "remove"} {
+		for n := 1; n <= 128; n++ {
+			for _, torn := range []bool{false, true} {
+				var (
+					name    = fmt.Sprintf("%s %d torn=%v", op, n, torn)
+					filesys = fs.NewFaultyFilesystem(fs.NewVirtualFilesystem())
+				)
+				filelog, err := NewFileLog(filesys, "/", 1024*1024, 1024, FileLogConfig{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				origins := writeSpanningSegments(t, filelog, 32)
+				written := readFlushedRecords(t, filesys, "/")
+
+				filesys.SetTornWrites(torn)
+				filesys.Fail(op, n)
+				newTestCompacter(filelog, 0, &eventRecorder{}).compact("Overlapping", filelog.Overlapping)
+				for path := range filelog.(*fileLog).index.sizes() {
+					checkSegmentUnit(t, name, filesys, path, origins) // as queries would read it
+				}
+				if err := filesys.Crash(); err != nil {
+					t.Fatal(err)
+				}
+
+				recovered, err := NewFileLog(filesys, "/", 1024*1024, 1024, FileLogConfig{})
+				if err != nil {
+					t.Fatalf("%s: recovering: %v", name, err)
+				}
+				checkSegmentUnits(t, name, filesys, origins)
+				c := newTestCompacter(recovered, 0, &eventRecorder{})
+				if _, result := c.compact("Overlapping", recovered.Overlapping); result == "Error" {
+					t.Errorf("%s: compacting recovered segments failed", name)
+				}
+				checkSegmentUnits(t, name, filesys, origins)
+				if want, have := written, dedupRecords(readFlushedRecords(t, filesys, "/")); !reflect.DeepEqual(want, have) {
+					t.Errorf("%s: want %d records, have %d", name, len(want), len(have))
+				}
+				recovered.Close()
+			}
+		}
+	}
+}
+
+func TestReadUnit(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name     string
+		manifest string
+		want     segmentUnit
+		err      bool
+	}{
+		{"committed", "a.active\n.bloom\n.crc\n\n", segmentUnit{"/x.unit", "/a.active", []string{extBloom, extChecksum}}, false},
+		{"without sidecars", "a.sealing\n\n", segmentUnit{"/x.unit", "/a.sealing", []string{}}, false},
+		{"torn", "a.active\n.bloom\n", segmentUnit{}, true},
+		{"torn name", "a.act", segmentUnit{}, true},
+		{"empty", "", segmentUnit{}, true},
+		{"not staged", "a.flushed\n\n", segmentUnit{}, true},
+		{"unknown sidecar", "a.active\n.foo\n\n", segmentUnit{}, true},
+	} {
+		filesys := fs.NewVirtualFilesystem()
+		f, err := filesys.Create("/x.unit")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(testcase.manifest))
+		f.Close()
+		have, err := readUnit(filesys, "/x.unit")
+		if want, have := testcase.err, err != nil; want != have {
+			t.Errorf("%s: want error %v, have %v", testcase.name, want, err)
+		}
+		if want := testcase.want; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want %+v, have %+v", testcase.name, want, have)
+		}
+	}
+}
+
+// writeSpanningSegments writes three segments, with origins, of n records,
+// but for the first, which has one more, and spans the others, whose records
+// are interleaved with its own. It returns the origin of each record, by ID.
+func writeSpanningSegments(t *testing.T, log Log, n int) map[string]string {
+	origins := map[string]string{}
+	for i, origin := range []string{"spanning", "spanned", "also-spanned"} {
+		segment, err := log.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		segment.SetOrigins([]string{origin})
+		var low, high ulid.ULID
+		for j := 0; j < n || i == 0 && j == n; j++ {
+			id := ulid.MustNew(uint64(1000+3*j+i), nil)
+			if j == 0 {
+				low = id
+			}
+			high = id
+			fmt.Fprintf(segment, "%s record%d%s\n", id, j, origin)
+			origins[id.String()] = origin
+		}
+		if err := segment.Close(low, high); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return origins
+}
+
+// checkSegmentUnits fails the test if any flushed segment under the root has
+// sidecars that aren't its own, or if any file of a unit is left over.
+func checkSegmentUnits(t *testing.T, name string, filesys fs.Filesystem, origins map[string]string) {
+	t.Helper()
+	filesys.Walk("/", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		switch ext := filepath.Ext(path); {
+		case ext == extUnit:
+			t.Errorf("%s: %s left over", name, path)
+		case isSidecarExt(ext) && !filesys.Exists(modifyExtension(path, extFlushed)):
+			t.Errorf("%s: %s of no segment", name, path)
+		case ext == extFlushed:
+			checkSegmentUnit(t, name, filesys, path, origins)
+		}
+		return nil
+	})
+}
+
+func checkSegmentUnit(t *testing.T, name string, filesys fs.Filesystem, path string, origins map[string]string) {
+	t.Helper()
+	corrupt := false
+	f, err := openSegmentFile(filesys, path, nil, func(string) { corrupt = true })
+	if err != nil {
+		t.Errorf("%s: %s: %v", name, path, err)
+		return
+	}
+	buf, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil || corrupt {
+		t.Errorf("%s: %s doesn't match its checksums: %v", name, path, err)
+		return
+	}
+
+	filter, err := readBloomFilter(filesys, modifyExtension(path, extBloom))
+	if err != nil && !os.IsNotExist(err) {
+		t.Errorf("%s: %s: %v", name, path, err)
+	}
+	want := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n") {
+		fields := strings.Fields(line)
+		want[origins[fields[0]]] = true
+		if filter != nil && !filter.mayContain([]byte(fields[1])) {
+			t.Errorf("%s: %s: bloom filter rules out its record %s", name, path, fields[0])
+		}
+	}
+	var wantOrigins []string
+	for origin := range want {
+		wantOrigins = append(wantOrigins, origin)
+	}
+	sort.Strings(wantOrigins)
+	haveOrigins, err := readOrigins(filesys, modifyExtension(path, extLabels))
+	if err != nil {
+		t.Errorf("%s: %s: %v", name, path, err)
+	}
+	sort.Strings(haveOrigins)
+	if !reflect.DeepEqual(wantOrigins, haveOrigins) {
+		t.Errorf("%s: %s: want origins %v, have %v", name, path, wantOrigins, haveOrigins)
+	}
+}
+
+// dedupRecords removes adjacent duplicates from the sorted records.
+func dedupRecords(records []string) []string {
+	var deduped []string
+	for i, record := range records {
+		if i == 0 || record != records[i-1] {
+			deduped = append(deduped, record)
+		}
+	}
+	return deduped
+}
@@ -0,0 +1,308 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+// maxVerifyProblems is how many problems a SegmentVerification lists. The
+// rest are only counted.
+const maxVerifyProblems = 10
+
+// Kinds of VerifyProblem.
+const (
+	ProblemChecksum   = "checksum"   // failed checksum verification, or decryption
+	ProblemMalformed  = "malformed"  // a line that isn't a record
+	ProblemUnsorted   = "unsorted"   // a record older than the one before it
+	ProblemBounds     = "bounds"     // a record outside the ULIDs of the segment's name
+	ProblemUnreadable = "unreadable" // e.g. it couldn't be opened, or decompressed
+)
+
+// Verifier audits the flushed segments of a log, one at a time: that each
+// line is a record, beginning with a ULID and ending with a newline, that
+// records are in ULID order, within the ULIDs of the segment's name, and that
+// the segment matches its checksums, if it has them. Queries quarantine the
+// corrupt segments they happen upon; a verification finds them before a
+// query does, and damage checksums don't catch, like segments written out of
+// order. It changes nothing, unless it's asked to quarantine the segments it
+// finds damaged. One verification runs at a time.
+type Verifier struct {
+	log      Log
+	throttle *throttle
+	reporter EventReporter
+
+	mtx     sync.Mutex
+	running bool
+}
+
+// VerifyProblem is something wrong with a segment.
+type VerifyProblem struct {
+	Kind   string `json:"kind"`
+	Line   int64  `json:"line,omitempty"` // from 1, if it's of a line
+	Detail string `json:"detail"`
+}
+
+// SegmentVerification is what a verification found of one segment.
+type SegmentVerification struct {
+	Name         string          `json:"name"`
+	Records      int64           `json:"records"`
+	Bytes        int64           `json:"bytes"` // of records, as read
+	Problems     []VerifyProblem `json:"problems,omitempty"`
+	ProblemCount int             `json:"problem_count"` // including those not listed
+	Quarantined  bool            `json:"quarantined,omitempty"`
+	Done         int             `json:"done"`  // segments verified, including this one
+	Total        int             `json:"total"` // segments to verify
+
+	kinds map[string]int // problems of each kind
+}
+
+// VerifySummary describes a verification, once it's over.
+type VerifySummary struct {
+	State       string         `json:"state"` // done, failed, or canceled
+	Started     time.Time      `json:"started"`
+	Finished    time.Time      `json:"finished"`
+	Segments    int            `json:"segments"` // verified
+	Total       int            `json:"total"`    // to verify
+	Records     int64          `json:"records"`
+	Bytes       int64          `json:"bytes"`
+	Problems    map[string]int `json:"problems"` // by kind
+	Damaged     []string       `json:"damaged"`  // segments with problems
+	Quarantined int            `json:"quarantined"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// VerifyUpdate is a line of the response to POST: a segment, as it's
+// verified, or the summary, last.
+type VerifyUpdate struct {
+	Segment *SegmentVerification `json:"segment,omitempty"`
+	Summary *VerifySummary       `json:"summary,omitempty"`
+}
+
+// NewVerifier returns a Verifier of the log, which reads at most
+// bytesPerSecond of records, so as not to starve queries and compaction. If
+// bytesPerSecond is zero, verifications aren't rate limited.
+func NewVerifier(log Log, bytesPerSecond int64, reporter EventReporter) *Verifier {
+	return &Verifier{
+		log:      log,
+		throttle: newThrottle(bytesPerSecond),
+		reporter: reporter,
+	}
+}
+
+// ServeHTTP handles the verify endpoint. POST verifies every flushed segment,
+// and quarantines the damaged ones, too, if quarantine=true. The response is
+// a VerifyUpdate per line, one per segment as it's verified, and the summary.
+// Hanging up cancels the verification.
+func (v *Verifier) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var quarantine bool
+	if s := r.URL.Query().Get("quarantine"); s != "" {
+		var err error
+		if quarantine, err = strconv.ParseBool(s); err != nil {
+			http.Error(w, fmt.Sprintf("invalid 'quarantine' %q", s), http.StatusBadRequest)
+			return
+		}
+	}
+	if !v.start() {
+		http.Error(w, "a verification is already running", http.StatusConflict)
+		return
+	}
+	defer v.stop()
+
+	w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	write := func(u VerifyUpdate) {
+		enc.Encode(u)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	summary := v.Verify(r.Context(), quarantine, func(sv SegmentVerification) {
+		write(VerifyUpdate{Segment: &sv})
+	})
+	write(VerifyUpdate{Summary: &summary})
+}
+
+func (v *Verifier) start() bool {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if v.running {
+		return false
+	}
+	v.running = true
+	return true
+}
+
+func (v *Verifier) stop() {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	v.running = false
+}
+
+// Verify every flushed segment, and quarantine those with problems, if
+// quarantine is true. Each segment is passed to progress once it's verified.
+// Segments compacted or trashed before they're verified are skipped. It stops
+// early if the context is canceled.
+func (v *Verifier) Verify(ctx context.Context, quarantine bool, progress func(SegmentVerification)) VerifySummary {
+	summary := VerifySummary{
+		State:    "done",
+		Started:  time.Now().UTC(),
+		Problems: map[string]int{},
+		Damaged:  []string{},
+	}
+	defer func() { summary.Finished = time.Now().UTC() }()
+
+	segments, err := v.log.Queryable(ulid.ULID{}, ulidutil.Max(ulid.MaxTime()))
+	if err != nil {
+		summary.State, summary.Error = "failed", errors.Wrap(err, "listing segments").Error()
+		return summary
+	}
+	summary.Total = len(segments)
+	for i, segment := range segments {
+		sv, err := v.verifySegment(ctx, segment)
+		if err == ErrSegmentNotFound {
+			continue // compacted or trashed since
+		}
+		if err != nil {
+			summary.State, summary.Error = "canceled", err.Error()
+			return summary
+		}
+		if sv.ProblemCount > 0 && quarantine {
+			if err := v.log.Quarantine(segment); err != nil && err != ErrSegmentNotFound {
+				v.reporter.ReportEvent(Event{Op: "verify", File: segment, Error: err, Msg: "failed to quarantine damaged segment"})
+			} else {
+				sv.Quarantined = err == nil
+			}
+		}
+		sv.Done, sv.Total = i+1, len(segments)
+		summary.Segments++
+		summary.Records += sv.Records
+		summary.Bytes += sv.Bytes
+		if sv.ProblemCount > 0 {
+			summary.Damaged = append(summary.Damaged, segment)
+			v.reporter.ReportEvent(Event{
+				Op: "verify", File: segment, Warning: errors.New(sv.Problems[0].Detail),
+				Msg: fmt.Sprintf("%d problem(s) found", sv.ProblemCount),
+			})
+		}
+		if sv.Quarantined {
+			summary.Quarantined++
+		}
+		for kind, n := range sv.kinds {
+			summary.Problems[kind] += n
+		}
+		progress(sv)
+	}
+	return summary
+}
+
+// verifySegment reads the named segment, throttled, and returns what's wrong
+// with it. It fails with ErrSegmentNotFound if it's gone, or the context's
+// error if it's canceled.
+func (v *Verifier) verifySegment(ctx context.Context, segment string) (SegmentVerification, error) {
+	sv := SegmentVerification{Name: segment, kinds: map[string]int{}}
+	problem := func(kind string, line int64, format string, args ...interface{}) {
+		sv.kinds[kind]++
+		if sv.ProblemCount++; len(sv.Problems) < maxVerifyProblems {
+			sv.Problems = append(sv.Problems, VerifyProblem{kind, line, fmt.Sprintf(format, args...)})
+		}
+	}
+	low, high, err := parseFilename(segment)
+	if err != nil {
+		problem(ProblemUnreadable, 0, "%v", err)
+		return sv, nil
+	}
+	f, err := v.log.OpenVerified(segment)
+	if err == ErrSegmentNotFound {
+		return sv, err
+	}
+	if err != nil {
+		problem(readProblem(err), 0, "%v", err)
+		return sv, nil
+	}
+	defer f.Close()
+
+	var (
+		br   = bufio.NewReader(f)
+		prev ulid.ULID
+		line int64
+	)
+	for {
+		record, err := br.ReadBytes('\n')
+		if len(record) > 0 {
+			line++
+			sv.Bytes += int64(len(record))
+			if werr := v.throttle.wait(ctx, int64(len(record))); werr != nil {
+				return sv, werr
+			}
+			id, detail := parseVerifiedRecord(record)
+			switch {
+			case detail != "":
+				problem(ProblemMalformed, line, "%s", detail)
+			case id.Compare(low) < 0 || id.Compare(high) > 0:
+				problem(ProblemBounds, line, "%s is outside %s", id, segment)
+			case sv.Records > 0 && id.Compare(prev) < 0:
+				problem(ProblemUnsorted, line, "%s comes after %s", id, prev)
+			}
+			if detail == "" {
+				sv.Records++
+				prev = id
+			}
+		}
+		if err == io.EOF {
+			return sv, nil
+		}
+		if err != nil {
+			problem(readProblem(err), line+1, "%v", err)
+			return sv, nil
+		}
+	}
+}
+
+// parseVerifiedRecord parses the ULID of a line of a segment, and returns
+// what's wrong with it, if it's not a record.
+func parseVerifiedRecord(line []byte) (ulid.ULID, string) {
+	if line[len(line)-1] != '\n' {
+		return ulid.ULID{}, "the last line has no newline"
+	}
+	record := line[:len(line)-1]
+	if len(record) > ulid.EncodedSize && record[ulid.EncodedSize] != ' ' {
+		return ulid.ULID{}, fmt.Sprintf("%q isn't followed by a space", record[:ulid.EncodedSize])
+	}
+	prefix := record
+	if len(prefix) > ulid.EncodedSize {
+		prefix = prefix[:ulid.EncodedSize]
+	}
+	id, err := ulidutil.Parse(string(prefix))
+	if err != nil {
+		return id, err.Error()
+	}
+	return id, ""
+}
+
+// readProblem is the kind of problem for an error opening or reading a
+// segment.
+func readProblem(err error) string {
+	if errors.Cause(err) == errCorruptSegment {
+		return ProblemChecksum
+	}
+	return ProblemUnreadable
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/fs"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+func TestVerifier(t *testing.T) {
+	t.Parallel()
+
+	filesys := fs.NewVirtualFilesystem()
+	filelog, err := NewFileLog(filesys, "/", 10240, 1024, FileLogConfig{Reporter: LogReporter{log.NewNopLogger()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filelog.Close()
+
+	t0 := time.Now().Add(-time.Hour)
+	ids := make([]ulid.ULID, 10)
+	for i := range ids {
+		ids[i] = ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Second)), nil)
+	}
+	write := func(low, high ulid.ULID, records string) string {
+		segment, err := filelog.Create()
+		if err != nil {
+			t.Fatal(err)
+		}
+		segment.Write([]byte(records))
+		if err := segment.Close(low, high); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("%s-%s", low, high)
+	}
+	var (
+		good      = write(ids[0], ids[1], fmt.Sprintf("%s a\n%s b\n", ids[0], ids[1]))
+		unsorted  = write(ids[2], ids[3], fmt.Sprintf("%s a\n%s b\n", ids[3], ids[2]))
+		bounds    = write(ids[4], ids[5], fmt.Sprintf("%s a\n%s b\n", ids[4], ids[9]))
+		malformed = write(ids[6], ids[7], fmt.Sprintf("%s a\nnot a record\n%s b", ids[6], ids[7]))
+		checksum  = write(ids[8], ids[8], fmt.Sprintf("%s a\n", ids[8]))
+	)
+	flipByte(t, filesys, filepath.Join("/", checksum+extFlushed))
+	want := map[string][]string{
+		good:      nil,
+		unsorted:  {ProblemUnsorted},
+		bounds:    {ProblemBounds},
+		malformed: {ProblemMalformed, ProblemMalformed},
+		checksum:  {ProblemChecksum},
+	}
+
+	// Without quarantine, every problem is found, and nothing is changed.
+	v := NewVerifier(filelog, 0, LogReporter{log.NewNopLogger()})
+	var done []int
+	summary := v.Verify(context.Background(), false, func(sv SegmentVerification) {
+		var kinds []string
+		for _, p := range sv.Problems {
+			kinds = append(kinds, p.Kind)
+		}
+		if want, have := want[sv.Name], kinds; !reflect.DeepEqual(want, have) {
+			t.Errorf("%s: want problems %v, have %v (%v)", sv.Name, want, have, sv.Problems)
+		}
+		if want, have := len(kinds), sv.ProblemCount; want != have {
+			t.Errorf("%s: want %d problem(s) counted, have %d", sv.Name, want, have)
+		}
+		done = append(done, sv.Done)
+	})
+	if want, have := []int{1, 2, 3, 4, 5}, done; !reflect.DeepEqual(want, have) {
+		t.Errorf("progress: want %v, have %v", want, have)
+	}
+	if want, have := "done", summary.State; want != have {
+		t.Errorf("state: want %q, have %q (%s)", want, have, summary.Error)
+	}
+	if want, have := map[string]int{ProblemUnsorted: 1, ProblemBounds: 1, ProblemMalformed: 2, ProblemChecksum: 1}, summary.Problems; !reflect.DeepEqual(want, have) {
+		t.Errorf("problems: want %v, have %v", want, have)
+	}
+	if want, have := []string{unsorted, bounds, malformed, checksum}, summary.Damaged; !reflect.DeepEqual(want, have) {
+		t.Errorf("damaged: want %v, have %v", want, have)
+	}
+	if want, have := 0, summary.Quarantined; want != have {
+		t.Errorf("quarantined: want %d, have %d", want, have)
+	}
+	if have := queryable(t, filelog); len(have) != 5 {
+		t.Errorf("want 5 segments left alone, have %v", have)
+	}
+	if filesys.Exists(filepath.Join("/", corruptDir)) {
+		t.Errorf("want nothing quarantined, have %v", filesIn(filesys, filepath.Join("/", corruptDir)))
+	}
+
+	// With quarantine, over HTTP, the damaged segments are moved aside.
+	w := httptest.NewRecorder()
+	v.ServeHTTP(w, httptest.NewRequest("POST", "/?quarantine=true", nil))
+	var (
+		s       = bufio.NewScanner(w.Body)
+		updates []VerifyUpdate
+	)
+	for s.Scan() {
+		var u VerifyUpdate
+		if err := json.Unmarshal(s.Bytes(), &u); err != nil {
+			t.Fatalf("%q: %v", s.Text(), err)
+		}
+		updates = append(updates, u)
+	}
+	if want, have := 6, len(updates); want != have {
+		t.Fatalf("want %d updates, have %d: %s", want, have, w.Body.String())
+	}
+	for _, u := range updates[:5] {
+		if want, have := want[u.Segment.Name] != nil, u.Segment.Quarantined; want != have {
+			t.Errorf("%s: want quarantined %v, have %v", u.Segment.Name, want, have)
+		}
+	}
+	if want, have := 4, updates[5].Summary.Quarantined; want != have {
+		t.Errorf("quarantined: want %d, have %d", want, have)
+	}
+	if want, have := []string{good}, queryable(t, filelog); !reflect.DeepEqual(want, have) {
+		t.Errorf("segments left: want %v, have %v", want, have)
+	}
+	if want, have := 4, strings.Count(strings.Join(filesIn(filesys, filepath.Join("/", corruptDir)), " "), extCorrupt); want != have {
+		t.Errorf("want %d corrupt segments, have %d", want, have)
+	}
+
+	// A canceled verification stops where it is.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if want, have := "canceled", v.Verify(ctx, false, func(SegmentVerification) {}).State; want != have {
+		t.Errorf("state: want %q, have %q", want, have)
+	}
+}
+
+func TestParseVerifiedRecord(t *testing.T) {
+	t.Parallel()
+
+	id := ulid.MustNew(1000, nil)
+	for _, testcase := range []struct {
+		line string
+		ok   bool
+	}{
+		{id.String() + " record\n", true},
+		{id.String() + "\n", true},
+		{id.String() + " no newline", false},
+		{id.String() + "x\n", false},
+		{"short\n", false},
+		{"\n", false},
+		{strings.Repeat("Z", ulid.EncodedSize) + " too big\n", false},
+	} {
+		have, detail := parseVerifiedRecord([]byte(testcase.line))
+		if want, have := testcase.ok, detail == ""; want != have {
+			t.Errorf("%q: want well-formed %v, have %v (%s)", testcase.line, want, have, detail)
+		}
+		if testcase.ok && have != id {
+			t.Errorf("%q: want %s, have %s", testcase.line, id, have)
+		}
+	}
+}
+
+func queryable(t *testing.T, l Log) []string {
+	t.Helper()
+	segments, err := l.Queryable(ulid.ULID{}, ulidutil.Max(ulid.MaxTime()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return segments
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/ingest"
+)
+
+const (
+	// watermarkMaxAge is how long the watermark is reused for user queries,
+	// before the ingest nodes are asked for it again.
+	watermarkMaxAge = time.Second
+
+	// watermarkTimeout bounds asking an ingest node for its watermark, so
+	// one that's down doesn't hold queries up.
+	watermarkTimeout = time.Second
+
+	// freshTimeout bounds how long a query waits for fresh records, with
+	// wait_for_fresh, and freshPollInterval is how often it asks.
+	freshTimeout      = 10 * time.Second
+	freshPollInterval = 250 * time.Millisecond
+)
+
+// watermarks holds the latest replication watermark of the cluster, and when
+// it was taken.
+type watermarks struct {
+	mtx     sync.Mutex
+	checked time.Time
+	value   time.Time // zero if unknown
+}
+
+// parseWaitForFresh returns whether a user query waits for the stores to
+// have every record up to the end of its range, per the wait_for_fresh
+// parameter, before it's run.
+func parseWaitForFresh(u *url.URL) (bool, error) {
+	s := u.Query().Get("wait_for_fresh")
+	if s == "" {
+		return false, nil
+	}
+	wait, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, errors.Errorf("parsing 'wait_for_fresh': %q isn't a boolean", s)
+	}
+	return wait, nil
+}
+
+// watermark returns the replication watermark of the cluster: the time before
+// which every record ingested is in the stores, and so in the results of a
+// query run now. It's the oldest of the watermarks of the ingest nodes, see
+// ingest.Lag, or zero if it's unknown, as there are no ingest nodes, or one
+// of them couldn't say, e.g. as it's down, or of an older version. Unless
+// fresh, the ingest nodes are asked at most every watermarkMaxAge, and in
+// between, the watermark is what they said last.
+func (a *API) watermark(ctx context.Context, fresh bool) time.Time {
+	a.watermarks.mtx.Lock()
+	if !fresh && time.Since(a.watermarks.checked) < watermarkMaxAge {
+		defer a.watermarks.mtx.Unlock()
+		return a.watermarks.value
+	}
+	a.watermarks.mtx.Unlock()
+
+	ingesters := a.peer.Current(cluster.PeerTypeIngest)
+	type response struct {
+		watermark time.Time
+		err       error
+	}
+	c := make(chan response, len(ingesters))
+	for _, hostport := range ingesters {
+		go func(hostport string) {
+			wm, err := a.ingestWatermark(ctx, hostport, fresh)
+			c <- response{wm, err}
+		}(hostport)
+	}
+	var (
+		value   time.Time
+		unknown = len(ingesters) == 0
+	)
+	for range ingesters {
+		r := <-c
+		switch {
+		case r.err != nil || r.watermark.IsZero():
+			unknown = true
+		case value.IsZero() || r.watermark.Before(value):
+			value = r.watermark
+		}
+	}
+	if unknown {
+		value = time.Time{}
+	}
+
+	a.watermarks.mtx.Lock()
+	defer a.watermarks.mtx.Unlock()
+	a.watermarks.checked, a.watermarks.value = time.Now(), value
+	return value
+}
+
+// ingestWatermark returns the watermark of the ingest node, as of a check
+// made now, if fresh, or else of its latest.
+func (a *API) ingestWatermark(ctx context.Context, hostport string, fresh bool) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, watermarkTimeout)
+	defer cancel()
+	u := fmt.Sprintf("http://%s/ingest%s", hostport, ingest.APIPathLag)
+	if fresh {
+		u += "?fresh=true"
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := a.queryClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, errors.Errorf("%s: %s", u, resp.Status)
+	}
+	var lag ingest.Lag
+	if err := json.NewDecoder(resp.Body).Decode(&lag); err != nil {
+		return time.Time{}, errors.Wrap(err, u)
+	}
+	return lag.Watermark, nil
+}
+
+// waitForFresh waits until the watermark is after to, i.e. the stores have
+// every record up to it, asking the ingest nodes every freshPollInterval, for
+// up to freshTimeout, or until ctx is done. It returns the latest watermark,
+// which may not be after to, if it timed out.
+func (a *API) waitForFresh(ctx context.Context, to time.Time) time.Time {
+	deadline := time.Now().Add(freshTimeout)
+	for {
+		wm := a.watermark(ctx, true)
+		if wm.After(to) || !time.Now().Add(freshPollInterval).Before(deadline) {
+			return wm
+		}
+		select {
+		case <-ctx.Done():
+			return wm
+		case <-time.After(freshPollInterval):
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/cluster"
+	"github.com/oklog/oklog/pkg/ingest"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+func TestAPIUserQueryWatermark(t *testing.T) {
+	t.Parallel()
+
+	// A store with records A to E, and so far without I, which is yet to be
+	// consumed from the ingest node.
+	storeAPI, storeServer := newStreamFixture(t, staticPeer(nil))
+	defer storeServer.Close()
+	defer storeAPI.Close()
+	replicate := func(records string) {
+		w := httptest.NewRecorder()
+		storeAPI.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(records)))
+		if w.Code != http.StatusOK {
+			t.Errorf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+	}
+	replicate(recordA + recordC + recordE)
+
+	// The ingest node is deliberately lagging: I is consumed, and the
+	// watermark passes it, only once the node's been checked on twice.
+	var (
+		mtx       sync.Mutex
+		checks    int
+		watermark = ulidTime(t, recordI)
+	)
+	ingestServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ingest"+ingest.APIPathLag {
+			http.NotFound(w, r)
+			return
+		}
+		mtx.Lock()
+		defer mtx.Unlock()
+		if _, fresh := r.URL.Query()["fresh"]; fresh {
+			if checks++; checks == 2 {
+				replicate(recordI)
+				watermark = time.Now()
+			}
+		}
+		json.NewEncoder(w).Encode(ingest.Lag{Watermark: watermark, Updated: time.Now()})
+	}))
+	defer ingestServer.Close()
+
+	front, frontServer := newStreamFixture(t, typedPeers{
+		cluster.PeerTypeStore:  {strings.TrimPrefix(storeServer.URL, "http://")},
+		cluster.PeerTypeIngest: {strings.TrimPrefix(ingestServer.URL, "http://")},
+	})
+	defer frontServer.Close()
+	defer front.Close()
+	query := func(params string) (QueryResult, string) {
+		resp, err := http.Get(fmt.Sprintf(
+			"%s/store%s?from=%s&to=%s%s",
+			frontServer.URL,
+			APIPathUserQuery,
+			"01BB6RQR190000000000000000", // A
+			"01BB6RXQ090000000000000000", // I
+			params,
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var qr QueryResult
+		if err := qr.DecodeFrom(resp); err != nil {
+			t.Fatal(err)
+		}
+		records, _ := ioutil.ReadAll(qr.Records)
+		qr.Records.Close()
+		return qr, string(records)
+	}
+
+	// By default, the query says how far it's fresh, which isn't up to I.
+	qr, records := query("")
+	if qr.Watermark == nil {
+		t.Fatal("want a watermark, have none")
+	}
+	if want, have := ulidTime(t, recordI), *qr.Watermark; !want.Equal(have) {
+		t.Errorf("want watermark %s, have %s", want, have)
+	}
+	if qr.Fresh() {
+		t.Errorf("lagging: want not fresh, have fresh")
+	}
+	if want, have := recordA+recordC+recordE, records; want != have {
+		t.Errorf("lagging: want %q, have %q", want, have)
+	}
+
+	// Waiting for fresh records, it has I.
+	qr, records = query("&wait_for_fresh=true")
+	if !qr.Fresh() {
+		t.Errorf("waited: want fresh, have watermark %v", qr.Watermark)
+	}
+	if want, have := recordA+recordC+recordE+recordI, records; want != have {
+		t.Errorf("waited: want %q, have %q", want, have)
+	}
+
+	// Bad values are refused.
+	resp, err := http.Get(frontServer.URL + "/store" + APIPathUserQuery + "?from=now&wait_for_fresh=maybe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want, have := http.StatusBadRequest, resp.StatusCode; want != have {
+		t.Errorf("bad wait_for_fresh: want HTTP %d, have %d", want, have)
+	}
+}
+
+func TestAPIWatermarkUnknown(t *testing.T) {
+	t.Parallel()
+
+	// One ingest node that's up to date, and one that can't say, as it's
+	// of an older version, so the watermark of the cluster is unknown.
+	current := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ingest.Lag{Watermark: time.Now(), Updated: time.Now()})
+	}))
+	defer current.Close()
+	older := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ingest.Lag{Updated: time.Now()})
+	}))
+	defer older.Close()
+
+	for _, testcase := range []struct {
+		name    string
+		servers []*httptest.Server
+		known   bool
+	}{
+		{"none", nil, false},
+		{"current", []*httptest.Server{current}, true},
+		{"older", []*httptest.Server{current, older}, false},
+	} {
+		var hostports []string
+		for _, server := range testcase.servers {
+			hostports = append(hostports, strings.TrimPrefix(server.URL, "http://"))
+		}
+		a := &API{peer: typedPeers{cluster.PeerTypeIngest: hostports}, queryClient: http.DefaultClient}
+		if want, have := testcase.known, !a.watermark(context.Background(), false).IsZero(); want != have {
+			t.Errorf("%s: want known %v, have %v", testcase.name, want, have)
+		}
+	}
+}
+
+// ulidTime returns the time of the record, by its ID.
+func ulidTime(t *testing.T, record string) time.Time {
+	id, err := ulid.Parse(record[:ulid.EncodedSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ulidutil.TimeOf(id)
+}
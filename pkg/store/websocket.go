@@ -0,0 +1,222 @@
+package store
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// This is just enough of the server side of the WebSocket protocol, RFC 6455,
+// for the UI's live tail: the handshake, unfragmented messages to the client,
+// pings, and closing with a status code. Messages from the client are read,
+// and discarded, except for control frames.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpText   = 0x1
+	wsOpBinary = 0x2
+	wsOpClose  = 0x8
+	wsOpPing   = 0x9
+	wsOpPong   = 0xA
+)
+
+// WebSocket close codes; see RFC 6455, section 7.4.1.
+const (
+	wsCloseNormal          = 1000
+	wsCloseGoingAway       = 1001
+	wsCloseProtocolError   = 1002
+	wsClosePolicyViolation = 1008
+)
+
+// wsWriteTimeout bounds each frame written to the client, so a client that
+// stops reading altogether is dropped.
+const wsWriteTimeout = 10 * time.Second
+
+var errWebSocketProtocol = errors.New("WebSocket protocol error")
+
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// upgradeWebSocket completes the WebSocket handshake, and returns the
+// connection. If the request isn't a WebSocket handshake, or the connection
+// can't be taken over, it responds with an error, and returns false.
+//
+// Browsers don't hold WebSockets to the same-origin policy, so any page could
+// otherwise tail the store from its visitors' browsers. Unless crossOrigin
+// is true, handshakes from another origin are refused; see sameOrigin.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, crossOrigin bool) (*wsConn, bool) {
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a WebSocket handshake", http.StatusBadRequest)
+		return nil, false
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, false
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, false
+	}
+	if !crossOrigin && !sameOrigin(r) {
+		http.Error(w, "cross-origin WebSocket refused", http.StatusForbidden)
+		return nil, false
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "can't stream to your client", http.StatusPreconditionFailed)
+		return nil, false
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]),
+	); err != nil {
+		conn.Close()
+		return nil, false
+	}
+	return &wsConn{conn: conn, br: brw.Reader}, true
+}
+
+// sameOrigin reports whether the request has no Origin, as from clients that
+// aren't browsers, or one whose host is the host the request was sent to, as
+// from the UI.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// headerHasToken reports whether the comma-separated header contains the
+// token, case-insensitively, e.g. "keep-alive, Upgrade" contains "upgrade".
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeFrame writes a whole message, or a control frame, of the given opcode.
+// It must not be called concurrently.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | op // FIN
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = header[:4]
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = 127
+		header = header[:10]
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := c.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+// writeClose writes a close frame with the status code and reason. Control
+// frames carry at most 125 bytes, so the reason is cut short if need be.
+func (c *wsConn) writeClose(code int, reason string) error {
+	return c.writeFrame(wsOpClose, closePayload(code, reason))
+}
+
+func closePayload(code int, reason string) []byte {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+	return payload
+}
+
+// readFrame reads the next frame from the client, and returns its opcode and
+// payload. The payloads of data frames longer than max are discarded.
+func (c *wsConn) readFrame(max int64) (op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return 0, nil, err
+	}
+	op = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	n := int64(header[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	isControl := op&0x8 != 0
+	if !masked || n < 0 || (isControl && (n > 125 || header[0]&0x80 == 0)) {
+		return 0, nil, errWebSocketProtocol // clients must mask; RFC 6455, section 5.1
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	if !isControl && n > max {
+		_, err := io.CopyN(ioutil.Discard, c.br, n)
+		return op, nil, err
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
+
+// Close the underlying connection.
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
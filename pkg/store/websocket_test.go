@@ -0,0 +1,259 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIUserLive(t *testing.T) {
+	t.Parallel()
+
+	// Two store nodes holding replicas of the same data.
+	var backends []*API
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		a, server := newStreamFixture(t, staticPeer(nil))
+		defer server.Close()
+		defer a.Close()
+		backends = append(backends, a)
+		addrs = append(addrs, strings.TrimPrefix(server.URL, "http://"))
+	}
+
+	// The node serving the socket fans out to both, and they filter.
+	front, server := newStreamFixture(t, staticPeer(addrs))
+	defer server.Close()
+	defer front.Close()
+	front.streamHeartbeat = 50 * time.Millisecond
+
+	c := dialWebSocket(t, server.URL, "/store"+APIPathUserLive+"?regex=true&window=100ms&q="+url.QueryEscape("^(A|C) "))
+	defer c.conn.Close()
+	for _, a := range backends {
+		waitForStreamQueries(t, a, 1)
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(segments[0]+segments[1])))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	// Only the matching records arrive, a message each, without newlines,
+	// and only once, with pings in between.
+	var have []string
+	for len(have) < 2 {
+		op, payload := c.read(t, time.Second)
+		if op != wsOpBinary {
+			t.Fatalf("want a binary message, have opcode %d: %q", op, payload)
+		}
+		have = append(have, string(payload)+"\n")
+	}
+	if want, have := recordA+recordC, strings.Join(have, ""); want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	c.write(t, wsOpPing, []byte("hello"))
+	if op, payload := c.read(t, time.Second); op != wsOpPong || string(payload) != "hello" {
+		t.Errorf("want pong %q, have opcode %d: %q", "hello", op, payload)
+	}
+
+	// The server echoes our close.
+	c.write(t, wsOpClose, closePayload(wsCloseNormal, "bye"))
+	if want, have := wsCloseNormal, c.readClose(t); want != have {
+		t.Errorf("want close %d, have %d", want, have)
+	}
+}
+
+func TestAPIUserLiveSlowClient(t *testing.T) {
+	t.Parallel()
+
+	a, backend := newStreamFixture(t, staticPeer(nil))
+	defer backend.Close()
+	defer a.Close()
+	front, server := newStreamFixture(t, staticPeer{strings.TrimPrefix(backend.URL, "http://")})
+	defer server.Close()
+	defer front.Close()
+	front.liveMaxBuffered = 1 // less than any record
+
+	c := dialWebSocket(t, server.URL, "/store"+APIPathUserLive+"?window=100ms")
+	defer c.conn.Close()
+	waitForStreamQueries(t, a, 1)
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, httptest.NewRequest("POST", APIPathReplicate, strings.NewReader(segments[0])))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Replicate failed: HTTP %d: %s", w.Code, w.Body.String())
+	}
+
+	if want, have := wsClosePolicyViolation, c.readClose(t); want != have {
+		t.Errorf("want close %d, have %d", want, have)
+	}
+}
+
+func TestAPIUserLiveBadHandshake(t *testing.T) {
+	t.Parallel()
+
+	a, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer a.Close()
+
+	for _, testcase := range []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"plain GET", http.Header{}, http.StatusBadRequest},
+		{"no key", http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"13"}}, http.StatusBadRequest},
+		{"old version", http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"8"}}, http.StatusUpgradeRequired},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", APIPathUserLive, nil)
+		r.Header = testcase.header
+		a.ServeHTTP(w, r)
+		if want, have := testcase.want, w.Code; want != have {
+			t.Errorf("%s: want HTTP %d, have %d", testcase.name, want, have)
+		}
+	}
+}
+
+func TestAPIUserLiveOrigin(t *testing.T) {
+	t.Parallel()
+
+	a, server := newStreamFixture(t, staticPeer(nil))
+	defer server.Close()
+	defer a.Close()
+
+	// A recorder can't be hijacked, so a handshake that gets past the origin
+	// check fails after it, with 500.
+	for _, testcase := range []struct {
+		name        string
+		origin      string
+		crossOrigin bool
+		want        int
+	}{
+		{"no origin", "", false, http.StatusInternalServerError},
+		{"same origin", "http://example.com", false, http.StatusInternalServerError},
+		{"same origin, other case", "https://Example.COM", false, http.StatusInternalServerError},
+		{"other port", "http://example.com:8080", false, http.StatusForbidden},
+		{"other host", "http://evil.example", false, http.StatusForbidden},
+		{"bad origin", "null", false, http.StatusForbidden},
+		{"other host, allowed", "http://evil.example", true, http.StatusInternalServerError},
+	} {
+		a.crossOriginLive = testcase.crossOrigin
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", APIPathUserLive, nil) // Host is example.com
+		r.Header = http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"13"}, "Sec-Websocket-Key": {"dGhlIHNhbXBsZSBub25jZQ=="}}
+		if testcase.origin != "" {
+			r.Header.Set("Origin", testcase.origin)
+		}
+		a.ServeHTTP(w, r)
+		if want, have := testcase.want, w.Code; want != have {
+			t.Errorf("%s: want HTTP %d, have %d", testcase.name, want, have)
+		}
+	}
+}
+
+// wsTestClient is just enough of a WebSocket client to test the server.
+type wsTestClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, serverURL, path string) *wsTestClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The key and accept values are the example in RFC 6455.
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\n"+
+		"Host: %s\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n",
+		path, conn.RemoteAddr(),
+	)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := http.StatusSwitchingProtocols, resp.StatusCode; want != have {
+		t.Fatalf("handshake: want HTTP %d, have %d", want, have)
+	}
+	if want, have := "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"); want != have {
+		t.Fatalf("handshake: want accept %q, have %q", want, have)
+	}
+	return &wsTestClient{conn: conn, br: br}
+}
+
+// read the next frame, other than a ping.
+func (c *wsTestClient) read(t *testing.T, timeout time.Duration) (op byte, payload []byte) {
+	c.conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(c.br, header[:]); err != nil {
+			t.Fatal(err)
+		}
+		if header[1]&0x80 != 0 {
+			t.Fatal("server frames must not be masked")
+		}
+		n := uint64(header[1] & 0x7F)
+		switch n {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+				t.Fatal(err)
+			}
+			n = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+				t.Fatal(err)
+			}
+			n = binary.BigEndian.Uint64(ext[:])
+		}
+		payload = make([]byte, n)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			t.Fatal(err)
+		}
+		if op = header[0] & 0x0F; op != wsOpPing {
+			return op, payload
+		}
+	}
+}
+
+// readClose skips past messages to the close frame, and returns its code.
+func (c *wsTestClient) readClose(t *testing.T) int {
+	for {
+		op, payload := c.read(t, time.Second)
+		if op != wsOpClose {
+			continue
+		}
+		if len(payload) < 2 {
+			t.Fatalf("close frame without a status code: %q", payload)
+		}
+		return int(binary.BigEndian.Uint16(payload))
+	}
+}
+
+// write a masked frame.
+func (c *wsTestClient) write(t *testing.T, op byte, payload []byte) {
+	if len(payload) > 125 {
+		t.Fatalf("payload of %d bytes: too long for the test client", len(payload))
+	}
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | op, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
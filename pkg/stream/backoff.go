@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"math/rand"
+	"time"
+)
+
+// BackoffPolicy describes how long to wait between reconnects to a peer.
+// Delays start at Base and double with each consecutive failure, up to Max.
+// Each delay is varied randomly by ±Jitter (a fraction) to avoid reconnecting
+// in lockstep with every other client of a restarted peer. A connection that
+// stays up for at least Healthy resets the delay to Base.
+type BackoffPolicy struct {
+	Base    time.Duration
+	Max     time.Duration
+	Jitter  float64
+	Healthy time.Duration
+}
+
+// DefaultBackoffPolicy is used by Execute unless WithBackoff is given.
+var DefaultBackoffPolicy = BackoffPolicy{
+	Base:    100 * time.Millisecond,
+	Max:     10 * time.Second,
+	Jitter:  0.2,
+	Healthy: 5 * time.Second,
+}
+
+// backoff tracks the reconnect delay for a single peer.
+type backoff struct {
+	policy BackoffPolicy
+	next   time.Duration
+	rand   func() float64 // [0.0, 1.0)
+}
+
+func newBackoff(policy BackoffPolicy) *backoff {
+	return &backoff{
+		policy: policy,
+		next:   policy.Base,
+		rand:   rand.Float64,
+	}
+}
+
+// delay returns the duration to wait before the next reconnect,
+// and advances the backoff.
+func (b *backoff) delay() time.Duration {
+	d := b.next
+	if b.next *= 2; b.next > b.policy.Max {
+		b.next = b.policy.Max
+	}
+	if b.policy.Jitter > 0 {
+		d += time.Duration(float64(d) * b.policy.Jitter * (2*b.rand() - 1))
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// observe records how long the most recent connection lasted.
+func (b *backoff) observe(connected time.Duration) {
+	if connected >= b.policy.Healthy {
+		b.next = b.policy.Base
+	}
+}
@@ -0,0 +1,117 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	t.Parallel()
+
+	b := newBackoff(BackoffPolicy{
+		Base: 100 * time.Millisecond,
+		Max:  time.Second,
+	})
+	var have []time.Duration
+	for i := 0; i < 6; i++ {
+		have = append(have, b.delay())
+	}
+	want := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		1000 * time.Millisecond,
+		1000 * time.Millisecond,
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		rand float64
+		want time.Duration
+	}{
+		{0.0, 80 * time.Millisecond},
+		{0.5, 100 * time.Millisecond},
+		{0.999, 119960 * time.Microsecond},
+	} {
+		b := newBackoff(BackoffPolicy{Base: 100 * time.Millisecond, Max: time.Second, Jitter: 0.2})
+		b.rand = func() float64 { return testcase.rand }
+		if want, have := testcase.want, b.delay(); want != have {
+			t.Errorf("rand %f: want %s, have %s", testcase.rand, want, have)
+		}
+	}
+}
+
+func TestReadUntilCanceledBackoffReset(t *testing.T) {
+	t.Parallel()
+
+	// The 4th connection stays up long enough to be considered healthy.
+	// Every other connection fails immediately.
+	var (
+		connects int
+		rcf      = func(ctx context.Context, addr string) (io.ReadCloser, error) {
+			if connects++; connects == 4 {
+				return &slowReader{delay: 20 * time.Millisecond, rec: []byte(addr + "\n")}, nil
+			}
+			return nil, errors.New("connection refused")
+		}
+		ctx, cancel = context.WithCancel(context.Background())
+		sink        = make(chan []byte, 16)
+		have        []time.Duration
+		sleep       = func(d time.Duration) {
+			if have = append(have, d); len(have) >= 6 {
+				cancel()
+			}
+		}
+		c = newExecuteConfig(WithBackoff(BackoffPolicy{
+			Base:    100 * time.Millisecond,
+			Max:     10 * time.Second,
+			Healthy: 10 * time.Millisecond,
+		}))
+	)
+
+	readUntilCanceled(ctx, rcf, "some.addr.local", sink, sleep, c)
+
+	want := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		100 * time.Millisecond, // reset by the healthy connection
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if want, have := 1, len(sink); want != have {
+		t.Errorf("records: want %d, have %d", want, have)
+	}
+}
+
+// slowReader yields a single record after a delay, and then fails.
+type slowReader struct {
+	delay time.Duration
+	rec   []byte
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if r.rec == nil {
+		return 0, errors.New("connection reset")
+	}
+	time.Sleep(r.delay)
+	n := copy(p, r.rec)
+	r.rec = nil
+	return n, nil
+}
+
+func (*slowReader) Close() error { return nil }
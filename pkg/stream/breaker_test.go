@@ -0,0 +1,47 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oklog/oklog/pkg/breaker"
+)
+
+func TestReadUntilCanceledBreaker(t *testing.T) {
+	t.Parallel()
+
+	var (
+		breakers = breaker.NewSet(breaker.Policy{Failures: 3, Window: time.Hour, Cooldown: time.Hour}, prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"peer"}))
+		dials    = 0
+		sleeps   = 0
+	)
+	rcf := func(ctx context.Context, addr string) (io.ReadCloser, error) {
+		dials++
+		return nil, errors.New("dial failed")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sleep := func(time.Duration) {
+		if sleeps++; sleeps >= 10 {
+			cancel()
+		}
+	}
+
+	// Once the breaker trips, the peer isn't dialed again, within the
+	// cool-down, but the connection manager keeps waiting it out.
+	readUntilCanceled(ctx, rcf, "some-peer", make(chan []byte), sleep, newExecuteConfig(WithBreakers(breakers)))
+	if want, have := 3, dials; want != have {
+		t.Errorf("dials: want %d, have %d", want, have)
+	}
+	if want, have := 10, sleeps; want != have {
+		t.Errorf("sleeps: want %d, have %d", want, have)
+	}
+	if want, have := breaker.Open, breakers.State("some-peer"); want != have {
+		t.Errorf("breaker: want %s, have %s", want, have)
+	}
+}
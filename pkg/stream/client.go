@@ -0,0 +1,159 @@
+package stream
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/record"
+	"github.com/oklog/oklog/pkg/ulidutil"
+)
+
+// Client streams records from every store node of a cluster, deduplicated
+// and in order, like the store API's stream endpoint does, for programs that
+// would sooner tail OK Log in process than through a store node.
+//
+// A Client is safe for concurrent use, and has no state of its own, so one
+// may serve any number of streams.
+type Client struct {
+	peers   PeerFactory
+	client  Doer
+	window  time.Duration
+	backoff BackoffPolicy
+}
+
+// NewClient returns a Client of the store nodes at the API addresses from
+// peers, i.e. host:port, which is invoked every DefaultPeerRefreshInterval,
+// to follow the cluster as it changes. Requests are made with the client,
+// which mustn't time out, since streams don't end; it's also the place to
+// add auth tokens or TLS. Records are deduplicated within the window, i.e.
+// delivered that much later than they're written; DefaultDedupeWindow is a
+// good start. Connections to failed peers are retried by the backoff policy.
+func NewClient(peers PeerFactory, client Doer, window time.Duration, backoff BackoffPolicy) *Client {
+	return &Client{
+		peers:   peers,
+		client:  client,
+		window:  window,
+		backoff: backoff,
+	}
+}
+
+// Query selects the records of a stream. The zero Query streams every live
+// record.
+type Query struct {
+	Q     string // records containing Q, or matching it, if Regex is set
+	Regex bool
+	Topic string    // records of this topic, if it isn't empty
+	Since ulid.ULID // if it isn't zero, replay the records after it first
+}
+
+// Record is a streamed record.
+type Record struct {
+	ID   ulid.ULID
+	Time time.Time // of the ID, to the millisecond, in UTC
+	Data []byte    // the record as it was ingested, without its newline
+}
+
+// clientIdleTimeout is how long a Client waits for data, or heartbeats, on a
+// connection before reconnecting. Store nodes send a heartbeat every ten
+// seconds.
+const clientIdleTimeout = 30 * time.Second
+
+// Stream the records selected by the query until the context is canceled,
+// when both chans are closed. Failed connections to peers are sent as
+// PeerErrors to the error chan, which is buffered, and dropped if it's full,
+// so it needn't be read at all; they're retried regardless. A zero or
+// negative dedup window fails the stream with ErrInvalidWindow. Records
+// without a valid ULID are skipped.
+func (c *Client) Stream(ctx context.Context, q Query) (<-chan Record, <-chan error) {
+	var (
+		records = make(chan Record, 1024)
+		errs    = make(chan error, 64)
+	)
+	if c.window <= 0 {
+		errs <- ErrInvalidWindow
+		close(errs)
+		close(records)
+		return records, errs
+	}
+
+	peerErrs := make(chan PeerError, cap(errs))
+	options := []ExecuteOption{
+		WithBackoff(c.backoff),
+		WithIdleTimeout(clientIdleTimeout),
+		WithErrors(peerErrs),
+		WithTopic(q.Topic),
+	}
+	if q.Since != (ulid.ULID{}) {
+		options = append(options, WithSince(q.Since))
+	}
+	v := url.Values{}
+	if q.Q != "" {
+		v.Set("q", q.Q)
+	}
+	if q.Regex {
+		v.Set("regex", "true")
+	}
+	rcf := HTTPReadCloserFactory(c.client, func(addr string) string {
+		return (&url.URL{Scheme: "http", Host: addr, Path: "/store/_stream", RawQuery: v.Encode()}).String()
+	})
+
+	// Execute returns when the context is canceled, once its connections
+	// are done, so nothing is sent to raw, or peerErrs, after that.
+	raw := make(chan []byte, 1024)
+	go func() {
+		Execute(ctx, c.peers, rcf, time.Sleep, time.NewTicker, raw, options...)
+		close(raw)
+		close(peerErrs)
+	}()
+	go func() {
+		for err := range peerErrs {
+			select {
+			case errs <- err:
+			default:
+			}
+		}
+		close(errs)
+	}()
+
+	// Deduplicate returns when raw is closed. Records still buffered then are
+	// drained, whether or not anyone's reading, so it doesn't block.
+	deduplicated := make(chan []byte, 1024)
+	go func() {
+		Deduplicate(raw, c.window, time.NewTicker, deduplicated)
+		close(deduplicated)
+	}()
+	go func() {
+		defer close(records)
+		for line := range deduplicated {
+			rec, ok := parseRecord(line)
+			if !ok {
+				continue
+			}
+			select {
+			case records <- rec:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return records, errs
+}
+
+// parseRecord parses a streamed line, i.e. a ULID, a space, and the record,
+// as it's stored.
+func parseRecord(line []byte) (Record, bool) {
+	if len(line) <= ulid.EncodedSize || line[ulid.EncodedSize] != ' ' {
+		return Record{}, false
+	}
+	id, err := ulid.Parse(string(line[:ulid.EncodedSize]))
+	if err != nil {
+		return Record{}, false
+	}
+	return Record{
+		ID:   id,
+		Time: ulidutil.TimeOf(id),
+		Data: record.Unescape(line[ulid.EncodedSize+1:]),
+	}, true
+}
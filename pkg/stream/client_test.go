@@ -0,0 +1,228 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+var testBackoff = BackoffPolicy{Base: 10 * time.Millisecond, Max: 10 * time.Millisecond}
+
+func TestClientStream(t *testing.T) {
+	t.Parallel()
+
+	// Both nodes have some of the same records, in their own order.
+	var (
+		a = newStoreServer(t, "01BB6RQR190000000000000000 greek Alpha", "01BB6RSR1W0000000000000000 greek Gamma")
+		b = newStoreServer(t, "01BB6RRTB70000000000000000 greek \x1eBeta\\nbis", "01BB6RQR190000000000000000 greek Alpha")
+	)
+	defer a.Close()
+	defer b.Close()
+	var (
+		c           = NewClient(addrs(a, b), http.DefaultClient, 100*time.Millisecond, testBackoff)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+	records, _ := c.Stream(ctx, Query{Q: "a", Topic: "greek"})
+
+	for _, want := range []struct{ id, data string }{
+		{"01BB6RQR190000000000000000", "greek Alpha"},
+		{"01BB6RRTB70000000000000000", "greek Beta\nbis"}, // escaped
+		{"01BB6RSR1W0000000000000000", "greek Gamma"},
+	} {
+		select {
+		case rec := <-records:
+			if want, have := want.id, rec.ID.String(); want != have {
+				t.Errorf("ID: want %s, have %s", want, have)
+			}
+			if want, have := ulid.MustParse(want.id).Time(), ulid.Timestamp(rec.Time); want != have {
+				t.Errorf("Time: want %d, have %d", want, have)
+			}
+			if want, have := want.data, string(rec.Data); want != have {
+				t.Errorf("Data: want %q, have %q", want, have)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s", want.id)
+		}
+	}
+	for _, s := range []*storeServer{a, b} {
+		if want, have := "q=a&topic=greek", s.lastQuery(); want != have {
+			t.Errorf("query: want %q, have %q", want, have)
+		}
+	}
+}
+
+func TestClientCancel(t *testing.T) {
+	t.Parallel()
+
+	s := newStoreServer(t)
+	defer s.Close()
+	var (
+		c           = NewClient(addrs(s), http.DefaultClient, 100*time.Millisecond, testBackoff)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	records, errs := c.Stream(ctx, Query{})
+	s.waitConnected(t, 1)
+	cancel()
+
+	// Both chans are closed, once the connection is done.
+	for name, closed := range map[string]func() bool{
+		"records": func() bool { _, ok := <-records; return !ok },
+		"errors":  func() bool { _, ok := <-errs; return !ok },
+	} {
+		done := make(chan bool)
+		go func() { done <- closed() }()
+		select {
+		case ok := <-done:
+			if !ok {
+				t.Errorf("%s: want closed chan, have a value", name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: timeout waiting for close", name)
+		}
+	}
+}
+
+func TestClientPeerFailure(t *testing.T) {
+	t.Parallel()
+
+	// The node fails after its first record, and has the next one by the
+	// time the client reconnects.
+	s := newStoreServer(t, "01BB6RQR190000000000000000 Alpha")
+	s.fail = true
+	defer s.Close()
+	var (
+		c           = NewClient(addrs(s), http.DefaultClient, 100*time.Millisecond, testBackoff)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+	records, errs := c.Stream(ctx, Query{})
+
+	select {
+	case err := <-errs:
+		if want, have := strings.TrimPrefix(s.URL, "http://"), err.(PeerError).Addr; want != have {
+			t.Errorf("Addr: want %q, have %q", want, have)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for peer error")
+	}
+	s.add("01BB6RRTB70000000000000000 Beta")
+	for _, want := range []string{"Alpha", "Beta"} {
+		select {
+		case rec := <-records:
+			if have := string(rec.Data); want != have {
+				t.Errorf("want %q, have %q", want, have)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %q", want)
+		}
+	}
+
+	// The reconnection resumes after the record it already had.
+	if want, have := "since=01BB6RQR190000000000000000", s.lastQuery(); want != have {
+		t.Errorf("query: want %q, have %q", want, have)
+	}
+}
+
+func TestClientInvalidWindow(t *testing.T) {
+	t.Parallel()
+
+	records, errs := NewClient(addrs(), http.DefaultClient, 0, testBackoff).Stream(context.Background(), Query{})
+	if want, have := ErrInvalidWindow, <-errs; want != have {
+		t.Errorf("want %v, have %v", want, have)
+	}
+	if _, ok := <-records; ok {
+		t.Errorf("want closed records chan")
+	}
+}
+
+// storeServer serves a store node's internal stream, of its records, after
+// the since parameter, if it's given, and then heartbeats. If fail is set,
+// the first connection fails once its records are written.
+type storeServer struct {
+	*httptest.Server
+	records   chan string
+	queries   chan string
+	connected int32
+	fail      bool
+}
+
+func newStoreServer(t *testing.T, records ...string) *storeServer {
+	s := &storeServer{
+		records: make(chan string, 16),
+		queries: make(chan string, 16),
+	}
+	for _, record := range records {
+		s.add(record)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *storeServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/store/_stream" {
+		http.NotFound(w, r)
+		return
+	}
+	n := atomic.AddInt32(&s.connected, 1)
+	select {
+	case <-s.queries:
+	default:
+	}
+	s.queries <- r.URL.RawQuery
+	since := r.URL.Query().Get("since")
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case record := <-s.records:
+			if record[:ulid.EncodedSize] > since {
+				fmt.Fprintf(w, "%s\n", record)
+				w.(http.Flusher).Flush()
+			}
+			if n == 1 && s.fail && len(s.records) == 0 {
+				panic(http.ErrAbortHandler)
+			}
+		case <-time.After(10 * time.Millisecond):
+			fmt.Fprintf(w, "\n")
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *storeServer) add(record string) { s.records <- record }
+
+func (s *storeServer) lastQuery() string {
+	select {
+	case q := <-s.queries:
+		return q
+	case <-time.After(time.Second):
+		return "no query"
+	}
+}
+
+func (s *storeServer) waitConnected(t *testing.T, n int32) {
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&s.connected) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %d connections", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func addrs(servers ...*storeServer) PeerFactory {
+	var addrs []string
+	for _, s := range servers {
+		addrs = append(addrs, strings.TrimPrefix(s.URL, "http://"))
+	}
+	return func() []string { return addrs }
+}
@@ -0,0 +1,67 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/oklog/ulid"
+)
+
+// WithSince resumes the stream after the given ULID. Peers are asked to
+// replay any records with greater ULIDs before streaming live records.
+// By default, peers stream live records only.
+//
+// Regardless of this option, each peer connection tracks the greatest ULID
+// it has delivered to the sink, and resumes from there when it reconnects,
+// so dropped connections don't create gaps.
+func WithSince(id ulid.ULID) ExecuteOption {
+	return func(c *executeConfig) {
+		c.since, _ = id.MarshalText()
+	}
+}
+
+// SinceFromContext returns the ULID after which a ReadCloserFactory should
+// resume the stream, if any. The HTTPReadCloserFactory passes it to the peer
+// as the since query parameter.
+func SinceFromContext(ctx context.Context) (ulid.ULID, bool) {
+	id, ok := ctx.Value(sinceKey{}).(ulid.ULID)
+	return id, ok
+}
+
+type sinceKey struct{}
+
+// cursor tracks the greatest ULID delivered from a single peer.
+// It's owned by one readUntilCanceled goroutine, and isn't goroutine safe.
+type cursor struct {
+	last []byte // encoded ULID, or nil
+}
+
+func newCursor(since []byte) *cursor {
+	if since == nil {
+		return &cursor{}
+	}
+	return &cursor{last: append([]byte(nil), since...)} // since is shared by peers
+}
+
+// advance the cursor, if the record is greater than anything seen so far.
+func (c *cursor) advance(record []byte) {
+	if c == nil || len(record) < ulid.EncodedSize {
+		return
+	}
+	if id := record[:ulid.EncodedSize]; c.last == nil || bytes.Compare(id, c.last) > 0 {
+		c.last = append(c.last[:0], id...)
+	}
+}
+
+// context returns a child of ctx carrying the cursor, for the
+// ReadCloserFactory.
+func (c *cursor) context(ctx context.Context) context.Context {
+	if c == nil || c.last == nil {
+		return ctx
+	}
+	id, err := ulid.Parse(string(c.last))
+	if err != nil {
+		return ctx // record without a valid ULID; don't resume from it
+	}
+	return context.WithValue(ctx, sinceKey{}, id)
+}
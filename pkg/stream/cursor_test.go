@@ -0,0 +1,191 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+func TestReadUntilCanceledResumes(t *testing.T) {
+	t.Parallel()
+
+	var (
+		t0      = time.Now()
+		records []string
+	)
+	for i := 0; i < 6; i++ {
+		id := ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Millisecond)), nil)
+		records = append(records, fmt.Sprintf("%s %d", id, i))
+	}
+	since := func(id ulid.ULID, ok bool) []string {
+		var rest []string
+		for _, record := range records {
+			if !ok || record[:ulid.EncodedSize] > id.String() {
+				rest = append(rest, record)
+			}
+		}
+		return rest
+	}
+
+	var (
+		mtx         sync.Mutex
+		cursors     []string
+		ctx, cancel = context.WithCancel(context.Background())
+		rcf         = func(ctx context.Context, addr string) (io.ReadCloser, error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			id, ok := SinceFromContext(ctx)
+			cursors = append(cursors, fmt.Sprint(ok))
+			rest := since(id, ok)
+			if len(cursors) == 1 {
+				// The first connection dies after delivering half the records.
+				return &failingReader{data: strings.Join(rest[:3], "\n") + "\n"}, nil
+			}
+			return &stalledReader{ctx: ctx, data: strings.Join(rest, "\n") + "\n"}, nil
+		}
+		sink = make(chan []byte, 16)
+		done = make(chan struct{})
+	)
+	go func() {
+		readUntilCanceled(ctx, rcf, "addr", sink, func(time.Duration) {}, newExecuteConfig())
+		close(done)
+	}()
+
+	var have []string
+	for len(have) < len(records) {
+		select {
+		case record := <-sink:
+			have = append(have, string(record))
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for records; have %q", have)
+		}
+	}
+	cancel()
+	<-done
+
+	if !reflect.DeepEqual(records, have) {
+		t.Errorf("want %q, have %q", records, have)
+	}
+	if len(sink) > 0 {
+		t.Errorf("unexpected duplicates: %d", len(sink))
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if want, have := []string{"false", "true"}, cursors; !reflect.DeepEqual(want, have) {
+		t.Errorf("resumed: want %v, have %v", want, have)
+	}
+}
+
+func TestReadUntilCanceledDropsCutRecord(t *testing.T) {
+	t.Parallel()
+
+	var records []string
+	for i := 0; i < 4; i++ {
+		id := ulid.MustNew(ulid.Timestamp(time.Now().Add(time.Duration(i)*time.Millisecond)), nil)
+		records = append(records, fmt.Sprintf("%s record %d", id, i))
+	}
+
+	var (
+		mtx         sync.Mutex
+		since       []string
+		ctx, cancel = context.WithCancel(context.Background())
+		rcf         = func(ctx context.Context, addr string) (io.ReadCloser, error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			id, _ := SinceFromContext(ctx)
+			since = append(since, id.String())
+			if len(since) == 1 {
+				// The first connection dies in the middle of the third record.
+				return &failingReader{data: records[0] + "\n" + records[1] + "\n" + records[2][:ulid.EncodedSize+3]}, nil
+			}
+			return &stalledReader{ctx: ctx, data: strings.Join(records[2:], "\n") + "\n"}, nil
+		}
+		sink = make(chan []byte, 16)
+		done = make(chan struct{})
+	)
+	go func() {
+		readUntilCanceled(ctx, rcf, "addr", sink, func(time.Duration) {}, newExecuteConfig())
+		close(done)
+	}()
+
+	var have []string
+	for len(have) < len(records) {
+		select {
+		case record := <-sink:
+			have = append(have, string(record))
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for records; have %q", have)
+		}
+	}
+	cancel()
+	<-done
+
+	if !reflect.DeepEqual(records, have) {
+		t.Errorf("want %q, have %q", records, have)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	if want, have := records[1][:ulid.EncodedSize], since[1]; want != have {
+		t.Errorf("resumed: want since %s, have %s", want, have)
+	}
+}
+
+func TestHTTPReadCloserFactorySince(t *testing.T) {
+	t.Parallel()
+
+	var (
+		id     = ulid.MustParse("01BB6RQR190000000000000000")
+		urls   = make(chan string, 2)
+		client = doerFunc(func(req *http.Request) (*http.Response, error) {
+			urls <- req.URL.String()
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		})
+		rcf = HTTPReadCloserFactory(client, func(addr string) string {
+			return "http://" + addr + "/store/_stream?q=foo&since=stale"
+		})
+	)
+
+	if _, err := rcf(context.Background(), "a:7650"); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "http://a:7650/store/_stream?q=foo&since=stale", <-urls; want != have {
+		t.Errorf("without cursor: want %q, have %q", want, have)
+	}
+
+	ctx := newCursor([]byte(id.String())).context(context.Background())
+	if _, err := rcf(ctx, "a:7650"); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "http://a:7650/store/_stream?q=foo&since="+id.String(), <-urls; want != have {
+		t.Errorf("with cursor: want %q, have %q", want, have)
+	}
+}
+
+type failingReader struct {
+	data string
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func (*failingReader) Close() error { return nil }
+
+type doerFunc func(*http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) { return f(req) }
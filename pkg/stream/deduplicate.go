@@ -2,57 +2,200 @@ package stream
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/btree"
 	"github.com/oklog/ulid"
+
+	"github.com/oklog/oklog/pkg/ulidutil"
 )
 
+// DefaultDedupeWindow is the deduplication window used by the store API when
+// the user doesn't specify one.
+const DefaultDedupeWindow = 3 * time.Second
+
+// ErrInvalidWindow is returned by Deduplicate for zero or negative windows.
+var ErrInvalidWindow = errors.New("deduplication window must be positive")
+
+// Gauge models prometheus.Gauge.
+type Gauge interface {
+	Add(float64)
+}
+
+// Counter models prometheus.Counter.
+type Counter interface {
+	Add(float64)
+}
+
+// DeduplicateOption configures optional behavior of Deduplicate.
+type DeduplicateOption func(*dedupeConfig)
+
+type dedupeConfig struct {
+	buffered Gauge
+	late     Counter
+}
+
+// WithBufferedGauge reports the number of records held by the deduplicator.
+// The gauge is only ever incremented and decremented, so it may be shared by
+// multiple concurrent invocations of Deduplicate to track their total.
+func WithBufferedGauge(g Gauge) DeduplicateOption {
+	return func(c *dedupeConfig) { c.buffered = g }
+}
+
+// WithLateRecords counts records that arrived after a record with a greater
+// ULID had already been emitted, i.e. records older than the window. Late
+// records are still emitted, but out of order.
+func WithLateRecords(c Counter) DeduplicateOption {
+	return func(c2 *dedupeConfig) { c2.late = c }
+}
+
 // Deduplicate and order records within the given time window.
 // A smaller window may cause duplicate or out-of-order messages.
 // A larger window will cause higher end-to-end latency.
 // The ticker is used every window / 10 to flush the buffer.
-// The function returns when the `in` chan is closed.
-func Deduplicate(in <-chan []byte, window time.Duration, ticker func(time.Duration) *time.Ticker, out chan<- []byte) {
+// Records that are already older than the window when they arrive, e.g.
+// because a peer is replaying them, are buffered for a full window after
+// they arrive, so duplicates replayed by other peers are suppressed, too.
+// Records are remembered for a window after they're emitted, as well, so a
+// replica that arrives just too late, e.g. from a slow peer, is dropped.
+// The function returns when the `in` chan is closed, after emitting any
+// records still in the buffer.
+// A zero or negative window returns ErrInvalidWindow immediately.
+func Deduplicate(in <-chan []byte, window time.Duration, ticker func(time.Duration) *time.Ticker, out chan<- []byte, options ...DeduplicateOption) error {
+	if window <= 0 {
+		return ErrInvalidWindow
+	}
 	var (
-		d  = dedupe{BTree: btree.New(2)}
-		tk = ticker(window / 10)
+		d    = newDedupe(window, time.Now(), options...)
+		tk   = ticker(d.interval())
+		emit = func(record []byte) { out <- record }
 	)
 	defer tk.Stop()
 	for {
 		select {
 		case record, ok := <-in:
 			if !ok {
-				return
+				d.removeAll(emit)
+				return nil
 			}
 			d.insert(record)
 
 		case now := <-tk.C:
-			d.remove(now.Add(-window), out)
+			d.remove(now, emit)
 		}
 	}
 }
 
-type dedupe struct{ *btree.BTree }
+type dedupe struct {
+	*btree.BTree
+	window   time.Duration
+	now      time.Time            // of the most recent tick
+	held     map[string]time.Time // stale records, and when to emit them
+	emitted  map[string]time.Time // ULIDs emitted within the window, and when
+	recent   []string             // the ULIDs of emitted, in the order they were
+	buffered Gauge
+	late     Counter
+	last     item // most recently emitted
+}
 
-func (d dedupe) insert(record []byte) {
-	d.BTree.ReplaceOrInsert(item(record))
+// newDedupe returns the state of Deduplicate, as of now, which is driven by
+// the clock of whoever calls remove, e.g. Replay's, rather than the wall's.
+func newDedupe(window time.Duration, now time.Time, options ...DeduplicateOption) *dedupe {
+	c := dedupeConfig{buffered: nopGauge{}, late: nopGauge{}}
+	for _, option := range options {
+		option(&c)
+	}
+	return &dedupe{
+		BTree:    btree.New(2),
+		window:   window,
+		now:      now,
+		held:     map[string]time.Time{},
+		emitted:  map[string]time.Time{},
+		buffered: c.buffered,
+		late:     c.late,
+	}
 }
 
-func (d dedupe) remove(olderThan time.Time, dst chan<- []byte) {
-	var (
-		pivot, _ = ulid.MustNew(ulid.Timestamp(olderThan), nil).MarshalText()
-		toEmit   [][]byte
-	)
-	d.BTree.AscendLessThan(item(pivot), func(i btree.Item) bool {
+// interval returns how often the buffer is flushed.
+func (d *dedupe) interval() time.Duration {
+	return d.window / 10
+}
+
+func (d *dedupe) insert(record []byte) {
+	if len(record) >= ulid.EncodedSize {
+		if _, ok := d.emitted[string(record[:ulid.EncodedSize])]; ok {
+			return // a replica of a record already emitted
+		}
+	}
+	if d.last != nil && item(record).Less(d.last) {
+		d.late.Add(1)
+	}
+	if d.BTree.ReplaceOrInsert(item(record)) == nil {
+		d.buffered.Add(1)
+		if item(record).Less(d.pivot(d.now)) {
+			d.held[string(record[:ulid.EncodedSize])] = d.now.Add(d.window)
+		}
+	}
+}
+
+// pivot returns the ULID, as an item, that marks the start of the window.
+func (d *dedupe) pivot(now time.Time) item {
+	pivot, _ := ulidutil.Min(ulid.Timestamp(now.Add(-d.window))).MarshalText()
+	return item(pivot)
+}
+
+func (d *dedupe) remove(now time.Time, emit func([]byte)) {
+	d.now = now
+	d.forget(now.Add(-d.window))
+	var toEmit [][]byte
+	d.BTree.AscendLessThan(d.pivot(now), func(i btree.Item) bool {
+		// Stop at held records, so that records stay in order.
+		if until, ok := d.held[string(i.(item)[:ulid.EncodedSize])]; ok && now.Before(until) {
+			return false
+		}
 		// Unfortunately, can't mutate the tree during iteration.
 		toEmit = append(toEmit, i.(item))
 		return true
 	})
-	for _, record := range toEmit {
-		dst <- record
+	d.emit(toEmit, emit)
+}
+
+// forget the records emitted before the given time.
+func (d *dedupe) forget(before time.Time) {
+	var n int
+	for _, id := range d.recent {
+		if !d.emitted[id].Before(before) {
+			break
+		}
+		delete(d.emitted, id)
+		n++
+	}
+	d.recent = d.recent[n:]
+}
+
+func (d *dedupe) removeAll(emit func([]byte)) {
+	var toEmit [][]byte
+	d.BTree.Ascend(func(i btree.Item) bool {
+		toEmit = append(toEmit, i.(item))
+		return true
+	})
+	d.emit(toEmit, emit)
+}
+
+func (d *dedupe) emit(records [][]byte, emit func([]byte)) {
+	for _, record := range records {
+		emit(record)
 		d.BTree.Delete(item(record))
+		id := string(record[:ulid.EncodedSize])
+		delete(d.held, id)
+		d.emitted[id] = d.now
+		d.recent = append(d.recent, id)
+		d.buffered.Add(-1)
+		if d.last == nil || d.last.Less(item(record)) {
+			d.last = item(record[:ulid.EncodedSize])
+		}
 	}
 }
 
@@ -67,5 +210,11 @@ func (i item) Less(other btree.Item) bool {
 	// We rely on the BTree itself to deduplicate. From the docs:
 	// "If !a.Less(b) && !b.Less(a), we treat this to mean a == b."
 	// So make sure to return false when bytes.Compare == 0.
+	// Only the ULIDs are compared, so replicas are duplicates, whatever
+	// follows, e.g. the origin annotations of different store nodes.
 	return bytes.Compare(i[:ulid.EncodedSize], otherItem[:ulid.EncodedSize]) < 0
 }
+
+type nopGauge struct{}
+
+func (nopGauge) Add(float64) {}
@@ -2,7 +2,11 @@ package stream
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -117,3 +121,306 @@ func TestDeduplicate(t *testing.T) {
 		t.Fatalf("timeout waiting for chan close")
 	}
 }
+
+func TestDeduplicateWindow(t *testing.T) {
+	t.Parallel()
+
+	const window = time.Second
+	t0 := time.Now().Truncate(time.Millisecond)
+	for _, testcase := range []struct {
+		name  string
+		first time.Time // tick between the record and its duplicate
+		want  int
+	}{
+		{"just inside", t0.Add(window - time.Millisecond), 1},
+		{"just outside", t0.Add(window + time.Millisecond), 2},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var (
+				in     = make(chan []byte)
+				tick   = make(chan time.Time)
+				ticker = func(time.Duration) *time.Ticker { return &time.Ticker{C: tick} }
+				out    = make(chan []byte, 16)
+				gauge  = &testGauge{}
+				record = []byte(fmt.Sprintf("%s Aaaa", ulid.MustNew(ulid.Timestamp(t0), nil).String()))
+				done   = make(chan error)
+			)
+			go func() {
+				done <- Deduplicate(in, window, ticker, out, WithBufferedGauge(gauge))
+			}()
+
+			in <- record
+			tick <- testcase.first
+			tick <- testcase.first.Add(window + time.Millisecond) // forgets what was emitted at the first
+			in <- record                                          // the duplicate
+			tick <- t0.Add(10 * window)
+			close(in)
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			close(out)
+
+			var have int
+			for range out {
+				have++
+			}
+			if want := testcase.want; want != have {
+				t.Errorf("records: want %d, have %d", want, have)
+			}
+			if want, have := 0.0, gauge.get(); want != have {
+				t.Errorf("buffered: want %f, have %f", want, have)
+			}
+		})
+	}
+}
+
+func TestDeduplicateBufferedGauge(t *testing.T) {
+	t.Parallel()
+
+	var (
+		in     = make(chan []byte)
+		tick   = make(chan time.Time)
+		ticker = func(time.Duration) *time.Ticker { return &time.Ticker{C: tick} }
+		window = time.Second
+		out    = make(chan []byte, 16)
+		gauge  = &testGauge{}
+		t0     = time.Now()
+		done   = make(chan error)
+	)
+	go func() {
+		done <- Deduplicate(in, window, ticker, out, WithBufferedGauge(gauge))
+	}()
+
+	for i := 0; i < 3; i++ {
+		in <- []byte(fmt.Sprintf("%s %d", ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*window)), nil).String(), i))
+	}
+	in <- []byte(fmt.Sprintf("%s dupe", ulid.MustNew(ulid.Timestamp(t0), nil).String()))
+	tick <- t0 // no-op, but synchronizes with the inserts
+	if want, have := 3.0, gauge.get(); want != have {
+		t.Errorf("after insert: want %f, have %f", want, have)
+	}
+
+	tick <- t0.Add(window + window/2)
+	tick <- t0 // synchronize again
+	if want, have := 2.0, gauge.get(); want != have {
+		t.Errorf("after first flush: want %f, have %f", want, have)
+	}
+
+	// Records still buffered when the in chan closes are flushed.
+	close(in)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 3, len(out); want != have {
+		t.Errorf("after close: want %d records out, have %d", want, have)
+	}
+	if want, have := 0.0, gauge.get(); want != have {
+		t.Errorf("after close: want %f, have %f", want, have)
+	}
+}
+
+func TestDeduplicateInvalidWindow(t *testing.T) {
+	t.Parallel()
+
+	for _, window := range []time.Duration{0, -time.Second} {
+		ticker := func(time.Duration) *time.Ticker { t.Fatal("ticker invoked"); return nil }
+		if want, have := ErrInvalidWindow, Deduplicate(nil, window, ticker, nil); want != have {
+			t.Errorf("window %s: want %v, have %v", window, want, have)
+		}
+	}
+}
+
+type testGauge struct {
+	mtx sync.Mutex
+	val float64
+}
+
+func (g *testGauge) Add(delta float64) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.val += delta
+}
+
+func (g *testGauge) get() float64 {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.val
+}
+
+func TestDeduplicateOrdersPeers(t *testing.T) {
+	t.Parallel()
+
+	// Two peers with interleaved timestamps, one of them lagging.
+	var (
+		t0      = time.Now()
+		records = map[string]string{}
+		want    []string
+	)
+	for i := 0; i < 6; i++ {
+		peer := []string{"even", "odd"}[i%2]
+		record := fmt.Sprintf("%s %d", ulid.MustNew(ulid.Timestamp(t0.Add(time.Duration(i)*time.Millisecond)), nil).String(), i)
+		records[peer] += record + "\n"
+		want = append(want, record)
+	}
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		pf          = func() []string { return []string{"even", "odd"} }
+		rcf         = func(ctx context.Context, addr string) (io.ReadCloser, error) {
+			if addr == "odd" {
+				time.Sleep(50 * time.Millisecond)
+			}
+			return &stalledReader{ctx: ctx, data: records[addr]}, nil
+		}
+		raw          = make(chan []byte, 16)
+		deduplicated = make(chan []byte, 16)
+		done         = make(chan struct{})
+	)
+	go func() {
+		Execute(ctx, pf, rcf, func(time.Duration) {}, time.NewTicker, raw)
+		close(raw)
+	}()
+	go func() {
+		// A large window means nothing is emitted until shutdown.
+		Deduplicate(raw, time.Hour, time.NewTicker, deduplicated)
+		close(done)
+	}()
+
+	time.Sleep(250 * time.Millisecond)
+	cancel()
+	<-done
+	close(deduplicated)
+
+	var have []string
+	for record := range deduplicated {
+		have = append(have, string(record))
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestDeduplicateLateRecords(t *testing.T) {
+	t.Parallel()
+
+	var (
+		in     = make(chan []byte)
+		tick   = make(chan time.Time)
+		ticker = func(time.Duration) *time.Ticker { return &time.Ticker{C: tick} }
+		window = time.Second
+		out    = make(chan []byte, 16)
+		late   = &testGauge{}
+		t0     = time.Now()
+		done   = make(chan error)
+		rec0   = []byte(fmt.Sprintf("%s 0", ulid.MustNew(ulid.Timestamp(t0), nil).String()))
+		rec1   = []byte(fmt.Sprintf("%s 1", ulid.MustNew(ulid.Timestamp(t0.Add(window)), nil).String()))
+	)
+	go func() {
+		done <- Deduplicate(in, window, ticker, out, WithLateRecords(late))
+	}()
+
+	in <- rec1
+	tick <- t0.Add(3 * window) // emits rec1
+	in <- rec0                 // older than what's been emitted
+	in <- rec1                 // a duplicate of what's been emitted, so dropped
+	close(in)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	close(out)
+
+	var have []string
+	for record := range out {
+		have = append(have, string(record))
+	}
+	if want := []string{string(rec1), string(rec0)}; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+	if want, have := 1.0, late.get(); want != have {
+		t.Errorf("late: want %f, have %f", want, have)
+	}
+}
+
+func TestDeduplicateReplayedRecords(t *testing.T) {
+	t.Parallel()
+
+	var (
+		in     = make(chan []byte)
+		tick   = make(chan time.Time)
+		ticker = func(time.Duration) *time.Ticker { return &time.Ticker{C: tick} }
+		window = time.Second
+		out    = make(chan []byte, 16)
+		t0     = time.Now()
+		done   = make(chan error)
+		old    = []byte(fmt.Sprintf("%s old", ulid.MustNew(ulid.Timestamp(t0.Add(-time.Hour)), nil).String()))
+	)
+	go func() {
+		done <- Deduplicate(in, window, ticker, out)
+	}()
+
+	in <- old                  // replayed by one peer
+	tick <- t0.Add(window / 2) // still held
+	in <- old                  // replayed by another peer
+	if want, have := 0, len(out); want != have {
+		t.Fatalf("want %d record(s) before the window, have %d", want, have)
+	}
+	tick <- t0.Add(2 * window) // emitted
+	select {
+	case record := <-out:
+		if want, have := old, record; !bytes.Equal(want, have) {
+			t.Errorf("want %q, have %q", want, have)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for replayed record")
+	}
+	close(in)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 0, len(out); want != have {
+		t.Errorf("want %d duplicate(s), have %d", want, have)
+	}
+}
+
+func TestDeduplicateAnnotatedRecords(t *testing.T) {
+	t.Parallel()
+
+	// Replicas annotated with different origins are still duplicates, as
+	// records are compared by ULID only.
+	var (
+		in     = make(chan []byte)
+		ticker = func(time.Duration) *time.Ticker { return &time.Ticker{C: make(chan time.Time)} }
+		out    = make(chan []byte, 16)
+		done   = make(chan error)
+		id1    = ulid.MustNew(ulid.Timestamp(time.Now()), nil).String()
+		id2    = ulid.MustNew(ulid.Timestamp(time.Now().Add(time.Millisecond)), nil).String()
+	)
+	go func() {
+		done <- Deduplicate(in, time.Second, ticker, out)
+	}()
+	for _, record := range []string{
+		id2 + " [node=store-1:7650 seg=a-b] two",
+		id1 + " [node=store-1:7650 seg=a-b] one",
+		id1 + " [node=store-2:7650 seg=c-d] one",
+		id2 + " [node=store-3:7650 seg=e-f] two",
+	} {
+		in <- []byte(record)
+	}
+	close(in)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	close(out)
+
+	var have []string
+	for record := range out {
+		have = append(have, string(record))
+	}
+	// The replica inserted last is kept, annotation and all.
+	want := []string{
+		id1 + " [node=store-2:7650 seg=c-d] one",
+		id2 + " [node=store-3:7650 seg=e-f] two",
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
@@ -0,0 +1,80 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadUntilCanceledErrors(t *testing.T) {
+	t.Parallel()
+
+	errDial := errors.New("dial failed")
+	rcf := func(ctx context.Context, addr string) (io.ReadCloser, error) {
+		return nil, errDial
+	}
+	errs := make(chan PeerError, 1)
+	c := newExecuteConfig(WithErrors(errs))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go readUntilCanceled(ctx, rcf, "some-peer", make(chan []byte), func(time.Duration) {}, c)
+
+	select {
+	case e := <-errs:
+		if want, have := "some-peer", e.Addr; want != have {
+			t.Errorf("Addr: want %q, have %q", want, have)
+		}
+		if want, have := errDial, e.Err; want != have {
+			t.Errorf("Err: want %v, have %v", want, have)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("Time: want non-zero")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for peer error")
+	}
+}
+
+func TestReadUntilCanceledErrorsNeverBlock(t *testing.T) {
+	t.Parallel()
+
+	for name, errs := range map[string]chan PeerError{
+		"nil":  nil,
+		"full": make(chan PeerError), // unbuffered, never read
+	} {
+		errs := errs
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var attempts uint64
+			rcf := func(ctx context.Context, addr string) (io.ReadCloser, error) {
+				atomic.AddUint64(&attempts, 1)
+				return nil, errors.New("dial failed")
+			}
+			c := newExecuteConfig(WithErrors(errs))
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				readUntilCanceled(ctx, rcf, "some-peer", make(chan []byte), func(time.Duration) {}, c)
+				close(done)
+			}()
+
+			deadline := time.Now().Add(time.Second)
+			for atomic.LoadUint64(&attempts) < 10 {
+				if time.Now().After(deadline) {
+					t.Fatalf("retry loop stalled after %d attempts", atomic.LoadUint64(&attempts))
+				}
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("readUntilCanceled didn't return")
+			}
+		})
+	}
+}
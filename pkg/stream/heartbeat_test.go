@@ -0,0 +1,122 @@
+package stream
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadOnceHeartbeats(t *testing.T) {
+	t.Parallel()
+
+	rcf := func(ctx context.Context, addr string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("\n\nfoo\n\nbar\n\n")), nil
+	}
+	sink := make(chan []byte, 16)
+	if err := readOnce(context.Background(), rcf, "addr", sink, nil, newExecuteConfig()); err != nil {
+		t.Fatal(err)
+	}
+	close(sink)
+
+	var have []string
+	for record := range sink {
+		have = append(have, string(record))
+	}
+	if want := "foo bar"; want != strings.Join(have, " ") {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
+func TestReadOnceIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	rcf := func(ctx context.Context, addr string) (io.ReadCloser, error) {
+		return &stalledReader{ctx: ctx, data: "\nfoo\n"}, nil
+	}
+	sink := make(chan []byte, 16)
+	c := newExecuteConfig(WithIdleTimeout(25 * time.Millisecond))
+
+	errc := make(chan error)
+	go func() { errc <- readOnce(context.Background(), rcf, "addr", sink, nil, c) }()
+	select {
+	case err := <-errc:
+		if want, have := ErrIdleTimeout, err; want != have {
+			t.Errorf("want %v, have %v", want, have)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for idle timeout")
+	}
+	if want, have := 1, len(sink); want != have {
+		t.Errorf("records: want %d, have %d", want, have)
+	}
+}
+
+func TestReadUntilCanceledIdleReconnect(t *testing.T) {
+	t.Parallel()
+
+	var (
+		connects    int32
+		ctx, cancel = context.WithCancel(context.Background())
+		rcf         = func(ctx context.Context, addr string) (io.ReadCloser, error) {
+			if atomic.AddInt32(&connects, 1) >= 3 {
+				cancel()
+			}
+			return &stalledReader{ctx: ctx, data: "foo\n"}, nil
+		}
+		sink = make(chan []byte, 16)
+		c    = newExecuteConfig(WithIdleTimeout(10 * time.Millisecond))
+		done = make(chan struct{})
+	)
+	go func() {
+		readUntilCanceled(ctx, rcf, "addr", sink, func(time.Duration) {}, c)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for reconnects; have %d", atomic.LoadInt32(&connects))
+	}
+}
+
+func TestReadOnceNoIdleTimeoutOnSlowSink(t *testing.T) {
+	t.Parallel()
+
+	rcf := func(ctx context.Context, addr string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("foo\nbar\n")), nil
+	}
+	var (
+		sink = make(chan []byte) // unbuffered
+		c    = newExecuteConfig(WithIdleTimeout(10 * time.Millisecond))
+		errc = make(chan error, 1)
+	)
+	go func() { errc <- readOnce(context.Background(), rcf, "addr", sink, nil, c) }()
+	for i := 0; i < 2; i++ {
+		time.Sleep(30 * time.Millisecond) // longer than the idle timeout
+		<-sink
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("want no error, have %v", err)
+	}
+}
+
+// stalledReader yields its data, and then blocks until the context is done.
+type stalledReader struct {
+	ctx  context.Context
+	data string
+}
+
+func (r *stalledReader) Read(p []byte) (int, error) {
+	if r.data != "" {
+		n := copy(p, r.data)
+		r.data = r.data[n:]
+		return n, nil
+	}
+	<-r.ctx.Done()
+	return 0, r.ctx.Err()
+}
+
+func (*stalledReader) Close() error { return nil }
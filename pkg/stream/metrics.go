@@ -0,0 +1,141 @@
+package stream
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics tracks the health of the streams to each peer, labeled by address.
+// A single Metrics may be shared between many invocations of Execute; a
+// peer's series are deleted once none of them streams from it.
+// A nil *Metrics is valid, and records nothing.
+type Metrics struct {
+	records     *prometheus.CounterVec
+	bytes       *prometheus.CounterVec
+	reconnects  *prometheus.CounterVec
+	drops       *prometheus.CounterVec
+	lastRead    *prometheus.GaugeVec
+	connections *prometheus.GaugeVec
+
+	mtx   sync.Mutex
+	peers map[string]int // streams from each peer
+}
+
+// NewMetrics returns per-peer stream metrics registered with r.
+// If r is nil, NewMetrics returns nil, and no metrics are recorded.
+func NewMetrics(r prometheus.Registerer) *Metrics {
+	if r == nil {
+		return nil
+	}
+	m := &Metrics{
+		records: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "stream_peer_records",
+			Help:      "Records received from each peer by streaming queries.",
+		}, []string{"peer"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "stream_peer_bytes",
+			Help:      "Record bytes received from each peer by streaming queries.",
+		}, []string{"peer"}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "stream_peer_reconnects",
+			Help:      "Connection attempts to each peer after a stream was lost.",
+		}, []string{"peer"}),
+		drops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "oklog",
+			Name:      "stream_peer_dropped_records",
+			Help:      "Records from each peer dropped because the sink was full.",
+		}, []string{"peer"}),
+		lastRead: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "oklog",
+			Name:      "stream_peer_last_read_timestamp_seconds",
+			Help:      "Unix time of the last record received from each peer.",
+		}, []string{"peer"}),
+		connections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "oklog",
+			Name:      "stream_peer_connections",
+			Help:      "Currently established streams to each peer.",
+		}, []string{"peer"}),
+		peers: map[string]int{},
+	}
+	r.MustRegister(
+		m.records,
+		m.bytes,
+		m.reconnects,
+		m.drops,
+		m.lastRead,
+		m.connections,
+	)
+	return m
+}
+
+func (m *Metrics) reconnected(addr string) {
+	if m == nil {
+		return
+	}
+	m.reconnects.WithLabelValues(addr).Inc()
+}
+
+func (m *Metrics) connected(addr string) {
+	if m == nil {
+		return
+	}
+	m.connections.WithLabelValues(addr).Inc()
+}
+
+func (m *Metrics) disconnected(addr string) {
+	if m == nil {
+		return
+	}
+	m.connections.WithLabelValues(addr).Dec()
+}
+
+func (m *Metrics) received(addr string, record []byte) {
+	if m == nil {
+		return
+	}
+	m.records.WithLabelValues(addr).Inc()
+	m.bytes.WithLabelValues(addr).Add(float64(len(record)))
+	m.lastRead.WithLabelValues(addr).Set(float64(time.Now().UnixNano()) / 1e9)
+}
+
+func (m *Metrics) dropped(addr string) {
+	if m == nil {
+		return
+	}
+	m.drops.WithLabelValues(addr).Inc()
+}
+
+// track counts a stream from a peer, until it's forgotten.
+func (m *Metrics) track(addr string) {
+	if m == nil {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.peers[addr]++
+}
+
+// forget a stream from a peer that has left its peer set, and if it was the
+// last stream from the peer, remove the peer's series.
+func (m *Metrics) forget(addr string) {
+	if m == nil {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.peers[addr]--; m.peers[addr] > 0 {
+		return
+	}
+	delete(m.peers, addr)
+	m.records.DeleteLabelValues(addr)
+	m.bytes.DeleteLabelValues(addr)
+	m.reconnects.DeleteLabelValues(addr)
+	m.drops.DeleteLabelValues(addr)
+	m.lastRead.DeleteLabelValues(addr)
+	m.connections.DeleteLabelValues(addr)
+}
@@ -0,0 +1,205 @@
+package stream
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMetricsReadOnce(t *testing.T) {
+	t.Parallel()
+
+	var (
+		registry = prometheus.NewRegistry()
+		metrics  = NewMetrics(registry)
+		c        = newExecuteConfig(WithMetrics(metrics))
+		addr     = "my.address.co"
+		n        = 3
+		rcf      = func(ctx context.Context, addr string) (io.ReadCloser, error) {
+			return &ctxReader{ctx, []byte(addr), int32(n)}, nil
+		}
+		sink = make(chan []byte, n)
+	)
+
+	// The reader fails after n records.
+	begin := time.Now()
+	if err := readOnce(context.Background(), rcf, addr, sink, nil, c); err == nil {
+		t.Fatal("want error, have none")
+	}
+
+	families := gather(t, registry)
+	for name, want := range map[string]float64{
+		"oklog_stream_peer_records":     float64(n),
+		"oklog_stream_peer_bytes":       float64(n * len(addr)),
+		"oklog_stream_peer_reconnects":  0,
+		"oklog_stream_peer_connections": 0,
+	} {
+		if have := families.value(name, addr); want != have {
+			t.Errorf("%s: want %f, have %f", name, want, have)
+		}
+	}
+	if have := families.value("oklog_stream_peer_last_read_timestamp_seconds", addr); have < float64(begin.Unix()) {
+		t.Errorf("last read: want at least %d, have %f", begin.Unix(), have)
+	}
+
+	// Removing the peer drops its series.
+	metrics.forget(addr)
+	if have := len(gather(t, registry)); have != 0 {
+		t.Errorf("after forget: want no metric families, have %d", have)
+	}
+}
+
+func TestMetricsReconnects(t *testing.T) {
+	t.Parallel()
+
+	var (
+		registry    = prometheus.NewRegistry()
+		c           = newExecuteConfig(WithMetrics(NewMetrics(registry)))
+		addr        = "some.addr.local"
+		ctx, cancel = context.WithCancel(context.Background())
+		rcf         = func(ctx context.Context, addr string) (io.ReadCloser, error) {
+			return &ctxReader{ctx, []byte(addr), 1}, nil
+		}
+		sink  = make(chan []byte, 16)
+		sleep = func(time.Duration) {
+			if len(sink) >= 3 {
+				cancel()
+			}
+		}
+	)
+	readUntilCanceled(ctx, rcf, addr, sink, sleep, c)
+
+	if want, have := 3.0, gather(t, registry).value("oklog_stream_peer_records", addr); want != have {
+		t.Errorf("records: want %f, have %f", want, have)
+	}
+	// Every connection dies after 1 record, and is followed by a reconnect.
+	if want, have := 3.0, gather(t, registry).value("oklog_stream_peer_reconnects", addr); want != have {
+		t.Errorf("reconnects: want %f, have %f", want, have)
+	}
+}
+
+func TestMetricsSharedPeer(t *testing.T) {
+	t.Parallel()
+
+	// Two streams from one peer share their Metrics. The peer leaves the
+	// peer set of one of them only, so its series stay.
+	var (
+		registry    = prometheus.NewRegistry()
+		metrics     = NewMetrics(registry)
+		addr        = "shared.addr.local"
+		ctx, cancel = context.WithCancel(context.Background())
+		open        int32
+		rcf         = func(ctx context.Context, addr string) (io.ReadCloser, error) {
+			atomic.AddInt32(&open, 1)
+			return &blockingReader{ctx: ctx, open: &open}, nil
+		}
+		dropped = make([]int32, 2)
+		ticks   = []chan time.Time{make(chan time.Time), make(chan time.Time)}
+		done    = make(chan error, len(ticks))
+	)
+	for i, tick := range ticks {
+		var (
+			dropped = &dropped[i]
+			pf      = func() []string {
+				if atomic.LoadInt32(dropped) == 1 {
+					return nil
+				}
+				return []string{addr}
+			}
+			ticker = func(tick chan time.Time) func(time.Duration) *time.Ticker {
+				return func(time.Duration) *time.Ticker { return &time.Ticker{C: tick} }
+			}(tick)
+		)
+		go func() {
+			done <- Execute(ctx, pf, rcf, func(time.Duration) {}, ticker, make(chan []byte), WithMetrics(metrics))
+		}()
+	}
+	waitConnections := func(want float64) {
+		deadline := time.Now().Add(time.Second)
+		for gather(t, registry).value("oklog_stream_peer_connections", addr) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("connections: want %f, have %f", want, gather(t, registry).value("oklog_stream_peer_connections", addr))
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitConnections(2)
+
+	// Each tick is processed synchronously, so two ticks guarantee the
+	// first one was fully applied.
+	drop := func(i int) {
+		atomic.StoreInt32(&dropped[i], 1)
+		ticks[i] <- time.Now()
+		ticks[i] <- time.Now()
+	}
+	drop(0)
+	if want, have := int32(1), atomic.LoadInt32(&open); want != have {
+		t.Errorf("open readers: want %d, have %d", want, have)
+	}
+	if want, have := 1.0, gather(t, registry).value("oklog_stream_peer_connections", addr); want != have {
+		t.Errorf("connections: want %f, have %f", want, have)
+	}
+
+	// Once the last stream from the peer drops it, its series go, too.
+	drop(1)
+	if have := len(gather(t, registry)); have != 0 {
+		t.Errorf("after both drop the peer: want no metric families, have %d", have)
+	}
+
+	cancel()
+	for range ticks {
+		if want, have := context.Canceled, <-done; want != have {
+			t.Errorf("Execute: want %v, have %v", want, have)
+		}
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	t.Parallel()
+
+	if m := NewMetrics(nil); m != nil {
+		t.Fatalf("want nil Metrics, have %v", m)
+	}
+	var m *Metrics
+	m.connected("a")
+	m.received("a", []byte("record"))
+	m.disconnected("a")
+	m.reconnected("a")
+	m.track("a")
+	m.forget("a")
+}
+
+type metricFamilies map[string]*dto.MetricFamily
+
+func gather(t *testing.T, g prometheus.Gatherer) metricFamilies {
+	t.Helper()
+	mfs, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	families := metricFamilies{}
+	for _, mf := range mfs {
+		families[mf.GetName()] = mf
+	}
+	return families
+}
+
+// value returns the value of the named counter or gauge for the given peer.
+func (f metricFamilies) value(name, peer string) float64 {
+	for _, m := range f[name].GetMetric() {
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "peer" && label.GetValue() == peer {
+				if m.GetCounter() != nil {
+					return m.GetCounter().GetValue()
+				}
+				return m.GetGauge().GetValue()
+			}
+		}
+	}
+	return 0
+}
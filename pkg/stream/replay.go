@@ -0,0 +1,66 @@
+package stream
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Replay the traces of a stream through its deduplication, as it happened,
+// and pass every record the stream emitted to emit, in order, e.g. to
+// reproduce a bug report's duplicate records.
+//
+// Execute merged the records of the peers in the order they were received,
+// and so does Replay, from their traced times; records received at the same
+// time are merged in the order of the traces. Deduplicate was ticked every
+// tenth of the window from the start of the stream, and so is the replay,
+// but by a clock that's driven by the traced times, rather than the wall's,
+// so a replay of the same traces always emits the same records. Once every
+// record is in, it ticks up to the end of the stream, if it's known, and then
+// flushes whatever's left, as Deduplicate does when its stream is done.
+//
+// The traces must be of the same stream, i.e. of the same window and start.
+func Replay(traces []Trace, emit func([]byte)) error {
+	if len(traces) == 0 {
+		return errors.New("no traces to replay")
+	}
+	var (
+		window = traces[0].Window
+		start  = traces[0].Start
+		end    time.Time
+		events []TracedRecord
+	)
+	for _, t := range traces {
+		if t.Window != window || !t.Start.Equal(start) {
+			return errors.Errorf("trace of %s isn't of the same stream as that of %s", t.Peer, traces[0].Peer)
+		}
+		if t.End.After(end) {
+			end = t.End
+		}
+		events = append(events, t.Records...)
+	}
+	if window <= 0 {
+		return ErrInvalidWindow
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Received.Before(events[j].Received) })
+
+	var (
+		d    = newDedupe(window, start)
+		tick = start.Add(d.interval())
+	)
+	tickUntil := func(t time.Time) {
+		for ; !tick.After(t); tick = tick.Add(d.interval()) {
+			d.remove(tick, emit)
+		}
+	}
+	for _, e := range events {
+		tickUntil(e.Received)
+		d.insert(e.Record)
+	}
+	if !end.IsZero() {
+		tickUntil(end)
+	}
+	d.removeAll(emit)
+	return nil
+}
@@ -0,0 +1,48 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReplayLateDuplicate(t *testing.T) {
+	t.Parallel()
+
+	// Two peers replicate the same records, but the second is slow: its
+	// replica of the first record arrives after the first peer's has been
+	// emitted, which used to emit the record twice.
+	traces, err := ReadTraces("testdata/late-duplicate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := 2, len(traces); want != have {
+		t.Fatalf("want %d traces, have %d", want, have)
+	}
+	for i := 0; i < 2; i++ {
+		var have []string
+		if err := Replay(traces, func(record []byte) { have = append(have, string(record)) }); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{
+			"01BHHRDNHJ3MQKRJTTD5W8F5N5 GET /index.html 200",
+			"01BHHRDNZM1CE2TFJFB9NQS3CY GET /favicon.ico 404",
+		}
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf("replay %d: want %q, have %q", i, want, have)
+		}
+	}
+}
+
+func TestReplayDifferentStreams(t *testing.T) {
+	t.Parallel()
+
+	t0 := time.Now()
+	traces := []Trace{
+		{Peer: "a", Window: time.Second, Start: t0},
+		{Peer: "b", Window: time.Second, Start: t0.Add(time.Minute)},
+	}
+	if err := Replay(traces, func([]byte) {}); err == nil {
+		t.Errorf("want an error replaying traces of different streams, have none")
+	}
+}
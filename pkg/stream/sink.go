@@ -0,0 +1,79 @@
+package stream
+
+import (
+	"context"
+)
+
+// SinkPolicy determines what happens to records from a peer when the sink
+// can't keep up with them.
+type SinkPolicy int
+
+const (
+	// Block waits for the sink to accept each record. A slow sink consumer
+	// stalls every peer connection, but no records are dropped.
+	Block SinkPolicy = iota
+
+	// DropOldest buffers records per peer, and when the buffer is full,
+	// discards the oldest buffered record to make room for the newest.
+	DropOldest
+
+	// DropNewest buffers records per peer, and when the buffer is full,
+	// discards incoming records until there is room again.
+	DropNewest
+)
+
+// DefaultSinkBuffer is the per-peer buffer size used by the dropping sink
+// policies when WithSinkPolicy is given a non-positive size.
+const DefaultSinkBuffer = 1024
+
+// bufferSink interposes a per-peer buffer between a connection manager and
+// the shared sink, per the policy. It returns the chan the connection manager
+// should send to, and a func that stops the buffer and waits for it to exit.
+// Any records still buffered when the context is canceled are discarded.
+func bufferSink(ctx context.Context, addr string, sink chan<- []byte, policy SinkPolicy, size int, m *Metrics) (chan<- []byte, func()) {
+	if policy == Block {
+		return sink, func() {}
+	}
+	if size <= 0 {
+		size = DefaultSinkBuffer
+	}
+
+	var (
+		in   = make(chan []byte)
+		done = make(chan struct{})
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer close(done)
+		var queue [][]byte
+		for {
+			// Only try to send when we have something to send.
+			var (
+				out  chan<- []byte
+				head []byte
+			)
+			if len(queue) > 0 {
+				out, head = sink, queue[0]
+			}
+			select {
+			case record := <-in:
+				if len(queue) < size {
+					queue = append(queue, record)
+					continue
+				}
+				m.dropped(addr)
+				if policy == DropOldest {
+					queue = append(queue[1:], record)
+				}
+
+			case out <- head:
+				queue[0] = nil // let it be GC'd
+				queue = queue[1:]
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return in, func() { cancel(); <-done }
+}
@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBufferSink(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		policy SinkPolicy
+		want   []string
+	}{
+		{DropOldest, []string{"c", "d", "e"}},
+		{DropNewest, []string{"a", "b", "c"}},
+	} {
+		var (
+			registry = prometheus.NewRegistry()
+			metrics  = NewMetrics(registry)
+			sink     = make(chan []byte) // nobody's reading, yet
+		)
+		in, stop := bufferSink(context.Background(), "addr", sink, testcase.policy, 3, metrics)
+		for _, s := range []string{"a", "b", "c", "d", "e"} {
+			in <- []byte(s)
+		}
+		var have []string
+		for i := 0; i < 3; i++ {
+			have = append(have, string(<-sink))
+		}
+		stop()
+		if !reflect.DeepEqual(testcase.want, have) {
+			t.Errorf("policy %d: want %v, have %v", testcase.policy, testcase.want, have)
+		}
+		if want, have := 2.0, gather(t, registry).value("oklog_stream_peer_dropped_records", "addr"); want != have {
+			t.Errorf("policy %d: dropped: want %f, have %f", testcase.policy, want, have)
+		}
+	}
+}
+
+func TestSinkPolicySlowConsumer(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name    string
+		policy  SinkPolicy
+		dropped bool
+	}{
+		{"Block", Block, false},
+		{"DropOldest", DropOldest, true},
+		{"DropNewest", DropNewest, true},
+	} {
+		testcase := testcase
+		t.Run(testcase.name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				registry    = prometheus.NewRegistry()
+				ctx, cancel = context.WithCancel(context.Background())
+				pf          = func() []string { return []string{"alpha"} }
+				rcf         = func(_ context.Context, peer string) (io.ReadCloser, error) { return infiniteReader(peer), nil }
+				sink        = make(chan []byte)
+				done        = make(chan struct{})
+			)
+			go func() {
+				Execute(ctx, pf, rcf, func(time.Duration) {}, time.NewTicker, sink,
+					WithMetrics(NewMetrics(registry)),
+					WithSinkPolicy(testcase.policy, 8),
+				)
+				close(done)
+			}()
+
+			// Drain slowly.
+			for i := 0; i < 20; i++ {
+				<-sink
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+			<-done
+
+			dropped := gather(t, registry).value("oklog_stream_peer_dropped_records", "alpha")
+			if want, have := testcase.dropped, dropped > 0; want != have {
+				t.Errorf("dropped records: want nonzero %v, have %f", want, dropped)
+			}
+		})
+	}
+}
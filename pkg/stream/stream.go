@@ -2,12 +2,21 @@ package stream
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/golang/snappy"
 	"github.com/pkg/errors"
+
+	"github.com/oklog/oklog/pkg/breaker"
 )
 
 // PeerFactory should return the current set of peer addresses.
@@ -20,6 +29,124 @@ type PeerFactory func() []string
 // Other errors will cause the managing goroutine to remanufacture.
 type ReadCloserFactory func(context.Context, string) (io.ReadCloser, error)
 
+// ErrIdleTimeout is returned when a peer connection sees no records or
+// heartbeats within the idle timeout.
+var ErrIdleTimeout = errors.New("stream idle timeout")
+
+// DefaultPeerRefreshInterval is how often Execute re-invokes the PeerFactory
+// unless WithPeerRefreshInterval is given.
+const DefaultPeerRefreshInterval = time.Second
+
+// ExecuteOption configures optional behavior of Execute.
+type ExecuteOption func(*executeConfig)
+
+type executeConfig struct {
+	backoff  BackoffPolicy
+	metrics  *Metrics
+	refresh  time.Duration
+	idle     time.Duration
+	policy   SinkPolicy
+	buffer   int
+	errs     chan<- PeerError
+	since    []byte
+	topic    string
+	breakers *breaker.Set
+	logger   log.Logger
+	tracer   *Tracer
+}
+
+func newExecuteConfig(options ...ExecuteOption) executeConfig {
+	c := executeConfig{
+		backoff: DefaultBackoffPolicy,
+		refresh: DefaultPeerRefreshInterval,
+		logger:  log.NewNopLogger(),
+	}
+	for _, option := range options {
+		option(&c)
+	}
+	return c
+}
+
+// WithBackoff sets the policy used to delay reconnects to a single peer.
+// By default, DefaultBackoffPolicy is used.
+func WithBackoff(policy BackoffPolicy) ExecuteOption {
+	return func(c *executeConfig) { c.backoff = policy }
+}
+
+// WithMetrics records the health of the stream to each peer.
+// By default, no metrics are recorded.
+func WithMetrics(m *Metrics) ExecuteOption {
+	return func(c *executeConfig) { c.metrics = m }
+}
+
+// WithTracer records the records received from each peer, and when, to a
+// trace the stream can be replayed from. By default, nothing is traced.
+func WithTracer(t *Tracer) ExecuteOption {
+	return func(c *executeConfig) { c.tracer = t }
+}
+
+// WithPeerRefreshInterval sets how often the PeerFactory is re-invoked.
+// Non-positive durations are ignored.
+func WithPeerRefreshInterval(d time.Duration) ExecuteOption {
+	return func(c *executeConfig) {
+		if d > 0 {
+			c.refresh = d
+		}
+	}
+}
+
+// WithIdleTimeout tears down and re-establishes each peer connection that
+// yields no data within the given duration. Peers are expected to send
+// heartbeats, i.e. empty lines, when they have no records; heartbeats are
+// never forwarded to the sink. By default, there is no idle timeout.
+func WithIdleTimeout(d time.Duration) ExecuteOption {
+	return func(c *executeConfig) { c.idle = d }
+}
+
+// WithSinkPolicy determines what happens when the sink can't keep up.
+// The buffer size applies per peer, and is ignored by the Block policy.
+// Dropped records are counted by Metrics, if provided.
+// By default, the Block policy is used.
+func WithSinkPolicy(policy SinkPolicy, buffer int) ExecuteOption {
+	return func(c *executeConfig) {
+		c.policy = policy
+		c.buffer = buffer
+	}
+}
+
+// WithBreakers skips connecting to peers whose breakers are open, and
+// reports the outcome of each connection attempt to them. The breakers are
+// meant to be shared, between invocations of Execute, and other clients of
+// the peers. By default, every peer is always tried.
+func WithBreakers(breakers *breaker.Set) ExecuteOption {
+	return func(c *executeConfig) { c.breakers = breakers }
+}
+
+// WithLogger logs each connection to a peer, and how it ended, at debug
+// level. Peers skipped for their breakers are logged, too. Records are never
+// logged. By default, nothing is logged.
+func WithLogger(logger log.Logger) ExecuteOption {
+	return func(c *executeConfig) { c.logger = logger }
+}
+
+// PeerError describes a failed connection to a peer.
+type PeerError struct {
+	Addr string
+	Err  error
+	Time time.Time
+}
+
+func (e PeerError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Addr, e.Err)
+}
+
+// WithErrors reports connection errors to the given chan. Errors caused by
+// context cancelation aren't reported. Sends never block, so if the chan is
+// full, errors are dropped. By default, errors aren't reported.
+func WithErrors(errs chan<- PeerError) ExecuteOption {
+	return func(c *executeConfig) { c.errs = errs }
+}
+
 type canceldone struct {
 	cancel func()
 	done   <-chan struct{}
@@ -29,8 +156,10 @@ type canceldone struct {
 // It muxes the streams of incoming records to the sink chan of records.
 // It's designed to be invoked once per user stream request.
 //
-// The sleep func is used to backoff between retries of a single peer.
-// The ticker func is used to regularly resolve peers.
+// The sleep func is used to backoff between retries of a single peer,
+// for durations determined by the backoff policy.
+// The ticker func is used to regularly resolve peers. Connection managers are
+// started for new peers, and stopped for peers that have gone away.
 func Execute(
 	ctx context.Context,
 	pf PeerFactory,
@@ -38,14 +167,17 @@ func Execute(
 	sleep func(time.Duration),
 	ticker func(time.Duration) *time.Ticker,
 	sink chan<- []byte,
+	options ...ExecuteOption,
 ) error {
+	c := newExecuteConfig(options...)
+
 	// Invoke the PeerFactory to get the initial addrs.
 	// Initialize connection managers to each of them.
-	active := updateActive(ctx, nil, pf(), rcf, sink, sleep)
+	active := updateActive(ctx, nil, pf(), rcf, sink, sleep, c)
 
-	// Re-invoke the peerFactory every second.
+	// Re-invoke the peerFactory regularly.
 	// This catches changes in topology.
-	tk := ticker(time.Second)
+	tk := ticker(c.refresh)
 	defer tk.Stop()
 
 	for {
@@ -53,7 +185,7 @@ func Execute(
 		case <-tk.C:
 			// Detect new peers, and create connection managers for them.
 			// Terminate connection managers for peers that have gone away.
-			active = updateActive(ctx, active, pf(), rcf, sink, sleep)
+			active = updateActive(ctx, active, pf(), rcf, sink, sleep, c)
 
 		case <-ctx.Done():
 			// Context cancelation is transitive.
@@ -73,6 +205,7 @@ func updateActive(
 	rcf ReadCloserFactory,
 	sink chan<- []byte,
 	sleep func(time.Duration),
+	c executeConfig,
 ) map[string]canceldone {
 	// Create the "new" collection of peer managers.
 	// Really, we just have to track the cancel func.
@@ -92,8 +225,9 @@ func updateActive(
 				ctx, cancel = context.WithCancel(parent)
 				done        = make(chan struct{})
 			)
+			c.metrics.track(addr)
 			go func(addr string) {
-				readUntilCanceled(ctx, rcf, addr, sink, sleep)
+				readUntilCanceled(ctx, rcf, addr, sink, sleep, c)
 				close(done)
 			}(addr)
 			nextgen[addr] = canceldone{cancel, done}
@@ -102,9 +236,10 @@ func updateActive(
 
 	// All the addrs left over in the previous collection are gone.
 	// Their connection managers should be canceled.
-	for _, cd := range prevgen {
+	for addr, cd := range prevgen {
 		cd.cancel()
 		<-cd.done
+		c.metrics.forget(addr)
 	}
 
 	// Good to go.
@@ -113,60 +248,243 @@ func updateActive(
 
 // readUntilCanceled is a kind of connection manager to the given addr.
 // We connect to addr via the factory, read records, and put them on the sink.
-// Any connection error causes us to wait a second and then reconnect.
+// Any connection error causes us to back off and then reconnect. While the
+// peer's breaker is open, we don't connect, but keep backing off.
 // readUntilCanceled blocks until the context is canceled.
-func readUntilCanceled(ctx context.Context, rcf ReadCloserFactory, addr string, sink chan<- []byte, sleep func(time.Duration)) {
+func readUntilCanceled(ctx context.Context, rcf ReadCloserFactory, addr string, sink chan<- []byte, sleep func(time.Duration), c executeConfig) {
+	sink, stop := bufferSink(ctx, addr, sink, c.policy, c.buffer, c.metrics)
+	defer stop()
+	b := newBackoff(c.backoff)
+	cur := newCursor(c.since)
 	for {
-		readOnce(ctx, rcf, addr, sink)
+		tried := c.breakers.Allow(addr)
+		if tried {
+			begin := time.Now()
+			if err := readOnce(ctx, rcf, addr, sink, cur, c); err != nil && ctx.Err() == nil {
+				level.Debug(c.logger).Log("peer", addr, "err", err)
+				c.reportError(addr, err)
+			}
+			b.observe(time.Since(begin))
+		} else {
+			level.Debug(c.logger).Log("peer", addr, "breaker", c.breakers.State(addr), "msg", "skipped")
+		}
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			sleep(time.Second) // TODO(pb): better strategy?
+			sleep(b.delay())
+			if tried {
+				c.metrics.reconnected(addr)
+			}
 		}
 	}
 }
 
+// reportError without blocking. A nil errs chan is fine: the send case
+// will never be selected.
+func (c executeConfig) reportError(addr string, err error) {
+	select {
+	case c.errs <- PeerError{Addr: addr, Err: err, Time: time.Now()}:
+	default:
+	}
+}
+
 // readOnce uses rcf to construct a ReadCloser to the given addr, and consumes
-// and forwards records to the sink until
-func readOnce(ctx context.Context, rcf ReadCloserFactory, addr string, sink chan<- []byte) error {
-	rc, err := rcf(ctx, addr)
+// and forwards records to the sink until the context is canceled or the
+// connection fails. Empty lines are heartbeats, and are not forwarded.
+// If the cursor is non-nil, the connection resumes from it, and it's advanced
+// past each forwarded record.
+func readOnce(ctx context.Context, rcf ReadCloserFactory, addr string, sink chan<- []byte, cur *cursor, c executeConfig) error {
+	// The connection gets its own context, so that an idle timeout can tear
+	// it down without affecting the caller.
+	connctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rc, err := rcf(withTopic(cur.context(connctx), c.topic), addr)
 	if err != nil {
+		if ctx.Err() == nil {
+			c.breakers.Failure(addr)
+		}
 		return err
 	}
+	c.breakers.Success(addr)
+	level.Debug(c.logger).Log("peer", addr, "msg", "connected")
 	defer rc.Close()
-	s := bufio.NewScanner(rc)
-	for s.Scan() {
-		select {
-		case sink <- []byte(s.Text()):
-			// We use s.Text to copy the record out of the Scanner.
-		case <-ctx.Done():
-			return ctx.Err()
+	c.metrics.connected(addr)
+	defer c.metrics.disconnected(addr)
+
+	idle := newIdleTimer(c.idle, cancel)
+	defer idle.stop()
+
+	br := bufio.NewReader(rc)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			// A record cut short by the connection is dropped, rather than
+			// advancing the cursor past it, so it's read in full once we
+			// reconnect.
+			line = nil
+		}
+		if record := dropCR(bytes.TrimSuffix(line, []byte{'\n'})); len(record) == 0 && len(line) > 0 {
+			idle.reset() // heartbeat
+		} else if len(record) > 0 {
+			c.metrics.received(addr, record)
+			c.tracer.record(addr, record)
+			idle.stop() // a slow sink isn't an idle connection
+			select {
+			case sink <- record:
+				cur.advance(record)
+			case <-connctx.Done():
+				return connError(ctx, idle)
+			}
+			idle.reset()
+		}
+		switch {
+		case err != nil && idle.fired():
+			return ErrIdleTimeout
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
 		}
 	}
-	return s.Err()
+}
+
+// dropCR drops a terminal \r from the record, like bufio.ScanLines.
+func dropCR(record []byte) []byte {
+	return bytes.TrimSuffix(record, []byte{'\r'})
+}
+
+func connError(ctx context.Context, idle *idleTimer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if idle.fired() {
+		return ErrIdleTimeout
+	}
+	return context.Canceled
+}
+
+// idleTimer invokes a cancel func if it isn't reset within a timeout.
+// A zero timeout disables the timer.
+type idleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+	once    sync.Once
+	firing  chan struct{}
+}
+
+func newIdleTimer(timeout time.Duration, cancel func()) *idleTimer {
+	t := &idleTimer{timeout: timeout, firing: make(chan struct{})}
+	if timeout > 0 {
+		t.timer = time.AfterFunc(timeout, func() {
+			t.once.Do(func() { close(t.firing) })
+			cancel()
+		})
+	}
+	return t
+}
+
+func (t *idleTimer) reset() {
+	if t.timer != nil && !t.fired() {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+func (t *idleTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+func (t *idleTimer) fired() bool {
+	select {
+	case <-t.firing:
+		return true
+	default:
+		return false
+	}
 }
 
 // HTTPReadCloserFactory returns a ReadCloserFactory that converts the addr to a
 // URL via the addr2url function, makes a GET request via the client, and
-// returns the response body as the ReadCloser.
+// returns the response body as the ReadCloser. If the stream is resuming,
+// the since query parameter is set to the ULID from SinceFromContext, and
+// the topic query parameter is set from TopicFromContext.
+// The factory asks for a compressed response, with snappy or gzip, and
+// decompresses it transparently, if the peer obliges.
 func HTTPReadCloserFactory(client Doer, addr2url func(string) string) ReadCloserFactory {
 	return func(ctx context.Context, addr string) (io.ReadCloser, error) {
 		req, err := http.NewRequest("GET", addr2url(addr), nil)
 		if err != nil {
 			return nil, errors.Wrap(err, "NewRequest")
 		}
+		since, resume := SinceFromContext(ctx)
+		topic, filter := TopicFromContext(ctx)
+		if resume || filter {
+			query := req.URL.Query()
+			if resume {
+				query.Set("since", since.String())
+			}
+			if filter {
+				query.Set("topic", topic)
+			}
+			req.URL.RawQuery = query.Encode()
+		}
+		req.Header.Set("Accept-Encoding", "snappy, gzip")
 		resp, err := client.Do(req.WithContext(ctx))
 		if err != nil {
 			return nil, errors.Wrap(err, "Do")
 		}
 		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
 			return nil, errors.Errorf("GET: %s", resp.Status)
 		}
-		return resp.Body, nil
+		switch resp.Header.Get("Content-Encoding") {
+		case "snappy":
+			return snappyReadCloser{snappy.NewReader(resp.Body), resp.Body}, nil
+		case "gzip":
+			return newGzipReadCloser(resp.Body)
+		default:
+			return resp.Body, nil
+		}
 	}
 }
 
+// snappyReadCloser decompresses a response body, in snappy's framing
+// format, and closes it.
+type snappyReadCloser struct {
+	*snappy.Reader
+	body io.Closer
+}
+
+func (rc snappyReadCloser) Close() error {
+	return rc.body.Close()
+}
+
+// gzipReadCloser decompresses a response body, and closes it.
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func newGzipReadCloser(body io.ReadCloser) (io.ReadCloser, error) {
+	// gzip.NewReader reads the header, i.e. blocks until the peer
+	// has flushed something. Store nodes flush as soon as they
+	// accept the stream.
+	r, err := gzip.NewReader(body)
+	if err != nil {
+		body.Close()
+		return nil, errors.Wrap(err, "gzip")
+	}
+	return gzipReadCloser{r, body}, nil
+}
+
+func (rc gzipReadCloser) Close() error {
+	rc.Reader.Close()
+	return rc.body.Close()
+}
+
 // Doer models http.Client.
 type Doer interface {
 	Do(*http.Request) (*http.Response, error)
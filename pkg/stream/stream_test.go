@@ -2,12 +2,24 @@ package stream
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/golang/snappy"
 )
 
 func TestReadOnce(t *testing.T) {
@@ -39,7 +51,7 @@ func TestReadOnce(t *testing.T) {
 	}()
 
 	// Make sure the context cancelation terminates the function.
-	if want, have := context.Canceled, readOnce(ctx, rcf, addr, sink); want != have {
+	if want, have := context.Canceled, readOnce(ctx, rcf, addr, sink, nil, newExecuteConfig()); want != have {
 		t.Errorf("want %v, have %v", want, have)
 	}
 }
@@ -77,7 +89,7 @@ func TestReadUntilCanceled(t *testing.T) {
 	done := make(chan struct{})
 	go func() {
 		noSleep := func(time.Duration) { /* no delay pls */ }
-		readUntilCanceled(ctx, rcf, "some.addr.local", sink, noSleep)
+		readUntilCanceled(ctx, rcf, "some.addr.local", sink, noSleep, newExecuteConfig())
 		close(done)
 	}()
 	select {
@@ -87,6 +99,40 @@ func TestReadUntilCanceled(t *testing.T) {
 	}
 }
 
+func TestReadUntilCanceledLogger(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dials  = 0
+		events []string
+		logger = log.LoggerFunc(func(keyvals ...interface{}) error {
+			events = append(events, fmt.Sprint(keyvals...))
+			return nil
+		})
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rcf := func(ctx context.Context, addr string) (io.ReadCloser, error) {
+		if dials++; dials == 1 {
+			return nil, errors.New("dial failed")
+		}
+		cancel() // once this connection ends
+		return ioutil.NopCloser(bytes.NewReader([]byte("some record\n"))), nil
+	}
+
+	// The failed connection is logged, and then the one that succeeds, but
+	// not its records.
+	noSleep := func(time.Duration) {}
+	readUntilCanceled(ctx, rcf, "some.addr.local", make(chan []byte, 1), noSleep, newExecuteConfig(WithLogger(logger)))
+	want := []string{
+		fmt.Sprint(level.Key(), level.DebugValue(), "peer", "some.addr.local", "err", "dial failed"),
+		fmt.Sprint(level.Key(), level.DebugValue(), "peer", "some.addr.local", "msg", "connected"),
+	}
+	if have := events; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
+
 func TestIssue59(t *testing.T) {
 	// Start Execute, streaming from some infinite sources.
 	var (
@@ -126,6 +172,78 @@ func TestIssue59(t *testing.T) {
 	<-done
 }
 
+func TestExecutePeerChanges(t *testing.T) {
+	// Not parallel: we count goroutines.
+	baseline := runtime.NumGoroutine()
+
+	var (
+		mtx   sync.Mutex
+		peers = []string{"alpha"}
+		set   = func(addrs ...string) { mtx.Lock(); peers = addrs; mtx.Unlock() }
+		pf    = func() []string { mtx.Lock(); defer mtx.Unlock(); return append([]string{}, peers...) }
+		open  int32
+		rcf   = func(ctx context.Context, addr string) (io.ReadCloser, error) {
+			atomic.AddInt32(&open, 1)
+			return &blockingReader{ctx: ctx, open: &open}, nil
+		}
+		tick        = make(chan time.Time)
+		ticker      = func(time.Duration) *time.Ticker { return &time.Ticker{C: tick} }
+		ctx, cancel = context.WithCancel(context.Background())
+		sink        = make(chan []byte)
+		done        = make(chan error)
+	)
+	go func() {
+		done <- Execute(ctx, pf, rcf, func(time.Duration) {}, ticker, sink)
+	}()
+
+	// Each tick is processed synchronously, including the shutdown of removed
+	// peers. So two ticks guarantee the first one was fully applied.
+	refresh := func() {
+		tick <- time.Now()
+		tick <- time.Now()
+	}
+	waitOpen := func(want int32) {
+		deadline := time.Now().Add(time.Second)
+		for atomic.LoadInt32(&open) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("open readers: want %d, have %d", want, atomic.LoadInt32(&open))
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	waitOpen(1)
+	set("alpha", "bravo")
+	refresh()
+	waitOpen(2)
+	set("alpha")
+	refresh()
+	waitOpen(1)
+
+	// A flapping peer shouldn't leak connection managers.
+	for i := 0; i < 10; i++ {
+		set("alpha", "charlie")
+		refresh()
+		set("alpha")
+		refresh()
+	}
+	waitOpen(1)
+
+	cancel()
+	if want, have := context.Canceled, <-done; want != have {
+		t.Errorf("Execute: want %v, have %v", want, have)
+	}
+	waitOpen(0)
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines: want %d, have %d", baseline, runtime.NumGoroutine())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 type ctxReader struct {
 	ctx context.Context
 	rec []byte
@@ -146,6 +264,22 @@ func (r *ctxReader) Read(p []byte) (int, error) {
 
 func (*ctxReader) Close() error { return nil }
 
+// blockingReader never yields records, and fails when its context is canceled.
+type blockingReader struct {
+	ctx  context.Context
+	open *int32
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	<-r.ctx.Done()
+	return 0, r.ctx.Err()
+}
+
+func (r *blockingReader) Close() error {
+	atomic.AddInt32(r.open, -1)
+	return nil
+}
+
 type infiniteReader string
 
 func (r infiniteReader) Read(p []byte) (int, error) {
@@ -153,3 +287,59 @@ func (r infiniteReader) Read(p []byte) (int, error) {
 }
 
 func (r infiniteReader) Close() error { return nil }
+
+func TestHTTPReadCloserFactoryEncoding(t *testing.T) {
+	t.Parallel()
+
+	const records = "record 1\nrecord 2\n"
+	for _, testcase := range []struct {
+		encoding string
+		compress func(io.Writer) io.WriteCloser
+	}{
+		{"snappy", func(w io.Writer) io.WriteCloser { return snappy.NewBufferedWriter(w) }},
+		{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		{"", nil},
+	} {
+		testcase := testcase
+		t.Run(fmt.Sprintf("encoding=%q", testcase.encoding), func(t *testing.T) {
+			t.Parallel()
+
+			accepts := make(chan string, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				accepts <- r.Header.Get("Accept-Encoding")
+				if testcase.compress == nil {
+					io.WriteString(w, records)
+					return
+				}
+				w.Header().Set("Content-Encoding", testcase.encoding)
+				cw := testcase.compress(w)
+				io.WriteString(cw, records)
+				cw.Close()
+			}))
+			defer server.Close()
+
+			// The transport doesn't decompress anything itself, so it's the
+			// factory that does.
+			var (
+				transport = &http.Transport{DisableCompression: true}
+				rcf       = HTTPReadCloserFactory(&http.Client{Transport: transport}, func(string) string { return server.URL })
+			)
+			defer transport.CloseIdleConnections()
+			rc, err := rcf(context.Background(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			if want, have := "snappy, gzip", <-accepts; want != have {
+				t.Errorf("Accept-Encoding: want %q, have %q", want, have)
+			}
+			buf, err := ioutil.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := records, string(buf); want != have {
+				t.Errorf("want %q, have %q", want, have)
+			}
+		})
+	}
+}
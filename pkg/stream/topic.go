@@ -0,0 +1,27 @@
+package stream
+
+import "context"
+
+// WithTopic streams only records of the given topic. The topic is passed to
+// the ReadCloserFactory via the context; see TopicFromContext.
+// By default, records of all topics are streamed.
+func WithTopic(topic string) ExecuteOption {
+	return func(c *executeConfig) { c.topic = topic }
+}
+
+// TopicFromContext returns the topic a ReadCloserFactory should stream, if
+// any. The HTTPReadCloserFactory passes it to the peer as the topic query
+// parameter.
+func TopicFromContext(ctx context.Context) (string, bool) {
+	topic, ok := ctx.Value(topicKey{}).(string)
+	return topic, ok
+}
+
+type topicKey struct{}
+
+func withTopic(ctx context.Context, topic string) context.Context {
+	if topic == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, topicKey{}, topic)
+}
@@ -0,0 +1,52 @@
+package stream
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReadOnceTopic(t *testing.T) {
+	t.Parallel()
+
+	for _, topic := range []string{"", "topic_A"} {
+		var have, filter = "unset", false
+		rcf := func(ctx context.Context, addr string) (io.ReadCloser, error) {
+			have, filter = TopicFromContext(ctx)
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		}
+		if err := readOnce(context.Background(), rcf, "addr", make(chan []byte), nil, newExecuteConfig(WithTopic(topic))); err != nil {
+			t.Fatal(err)
+		}
+		if want := topic != ""; want != filter {
+			t.Errorf("%q: want filter %v, have %v", topic, want, filter)
+		}
+		if filter && topic != have {
+			t.Errorf("want topic %q, have %q", topic, have)
+		}
+	}
+}
+
+func TestHTTPReadCloserFactoryTopic(t *testing.T) {
+	t.Parallel()
+
+	var (
+		urls   = make(chan string, 1)
+		client = doerFunc(func(req *http.Request) (*http.Response, error) {
+			urls <- req.URL.String()
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		})
+		rcf = HTTPReadCloserFactory(client, func(addr string) string {
+			return "http://" + addr + "/store/_stream?q=foo"
+		})
+	)
+	if _, err := rcf(withTopic(context.Background(), "topic_A"), "a:7650"); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "http://a:7650/store/_stream?q=foo&topic=topic_A", <-urls; want != have {
+		t.Errorf("want %q, have %q", want, have)
+	}
+}
@@ -0,0 +1,231 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	traceMagic      = "# oklog stream trace"
+	traceExt        = ".trace"
+	traceTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+)
+
+// Tracer records the raw records a stream receives from each of its peers,
+// and when it received them, to a trace file per peer, in a directory, for
+// debugging deduplication and ordering: a trace read by ReadTraces and passed
+// to Replay reproduces what the stream emitted. See WithTracer. A nil Tracer
+// records nothing.
+//
+// Trace files are text. A header of "# key value" lines says whose trace it
+// is, and of what stream. Then, every record is on a line of its own, after
+// the time it was received, and a space. The last line, once the Tracer's
+// closed, is "# end" and the time.
+type Tracer struct {
+	dir    string
+	window time.Duration
+	start  time.Time
+	now    func() time.Time
+
+	mtx    sync.Mutex
+	files  map[string]*os.File // by peer
+	err    error               // the first to write a trace
+	closed bool
+}
+
+// NewTracer returns a Tracer of a stream, deduplicated within window, which
+// starts now, writing to dir, which is created, if it doesn't exist.
+func NewTracer(dir string, window time.Duration) (*Tracer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "creating trace directory")
+	}
+	return &Tracer{
+		dir:    dir,
+		window: window,
+		start:  time.Now(),
+		now:    time.Now,
+		files:  map[string]*os.File{},
+	}, nil
+}
+
+// record the record, received from the peer, now.
+func (t *Tracer) record(peer string, record []byte) {
+	if t == nil {
+		return
+	}
+	received := t.now()
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.closed || t.err != nil {
+		return
+	}
+	f, ok := t.files[peer]
+	if !ok {
+		var err error
+		if f, err = t.create(peer); err != nil {
+			t.err = err
+			return
+		}
+		t.files[peer] = f
+	}
+	if _, err := fmt.Fprintf(f, "%s %s\n", received.UTC().Format(traceTimeFormat), record); err != nil {
+		t.err = errors.Wrapf(err, "tracing %s", peer)
+	}
+}
+
+// create the trace file of the peer, and write its header.
+func (t *Tracer) create(peer string) (*os.File, error) {
+	f, err := os.Create(filepath.Join(t.dir, traceFilename(peer)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "tracing %s", peer)
+	}
+	if _, err := fmt.Fprintf(f, "%s\n# peer %s\n# window %s\n# start %s\n", traceMagic, peer, t.window, t.start.UTC().Format(traceTimeFormat)); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "tracing %s", peer)
+	}
+	return f, nil
+}
+
+// Close the trace files, each ended now. It returns the first error writing
+// any trace, if there was one; tracing stops at the first.
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	end := t.now().UTC().Format(traceTimeFormat)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.closed = true
+	for peer, f := range t.files {
+		if _, err := fmt.Fprintf(f, "# end %s\n", end); err != nil && t.err == nil {
+			t.err = errors.Wrapf(err, "tracing %s", peer)
+		}
+		if err := f.Close(); err != nil && t.err == nil {
+			t.err = errors.Wrapf(err, "tracing %s", peer)
+		}
+	}
+	return t.err
+}
+
+// traceFilename returns the name of the trace file of the peer, which is
+// its address, but for characters that don't belong in filenames.
+func traceFilename(peer string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, peer) + traceExt
+}
+
+// Trace is the raw records a stream received from one of its peers, as a
+// Tracer records them.
+type Trace struct {
+	Peer    string
+	Window  time.Duration // of the stream's deduplication
+	Start   time.Time     // of the stream
+	End     time.Time     // of the stream, unless it's zero, e.g. after a crash
+	Records []TracedRecord
+}
+
+// TracedRecord is a record of a Trace, and when it was received.
+type TracedRecord struct {
+	Received time.Time
+	Record   []byte
+}
+
+// ReadTrace reads the Trace written by a Tracer.
+func ReadTrace(r io.Reader) (Trace, error) {
+	var (
+		t Trace
+		s = bufio.NewScanner(r)
+	)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if !s.Scan() || s.Text() != traceMagic {
+		if err := s.Err(); err != nil {
+			return t, err
+		}
+		return t, errors.New("not a stream trace")
+	}
+	for line := 2; s.Scan(); line++ {
+		if bytes.HasPrefix(s.Bytes(), []byte("# ")) {
+			if err := t.parseHeader(strings.TrimPrefix(s.Text(), "# ")); err != nil {
+				return t, errors.Wrapf(err, "line %d", line)
+			}
+			continue
+		}
+		i := bytes.IndexByte(s.Bytes(), ' ')
+		if i < 0 {
+			return t, errors.Errorf("line %d: want the time received, and a record", line)
+		}
+		received, err := time.Parse(traceTimeFormat, string(s.Bytes()[:i]))
+		if err != nil {
+			return t, errors.Wrapf(err, "line %d", line)
+		}
+		t.Records = append(t.Records, TracedRecord{received, append([]byte(nil), s.Bytes()[i+1:]...)})
+	}
+	if err := s.Err(); err != nil {
+		return t, err
+	}
+	if t.Window <= 0 || t.Start.IsZero() {
+		return t, errors.New("trace has no window, or start")
+	}
+	return t, nil
+}
+
+func (t *Trace) parseHeader(header string) (err error) {
+	fields := strings.SplitN(header, " ", 2)
+	if len(fields) != 2 {
+		return nil // a comment
+	}
+	switch key, value := fields[0], fields[1]; key {
+	case "peer":
+		t.Peer = value
+	case "window":
+		t.Window, err = time.ParseDuration(value)
+	case "start":
+		t.Start, err = time.Parse(traceTimeFormat, value)
+	case "end":
+		t.End, err = time.Parse(traceTimeFormat, value)
+	}
+	return err
+}
+
+// ReadTraces reads the Traces of the trace files in dir, in order of their
+// names, i.e. of their peers.
+func ReadTraces(dir string) ([]Trace, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+traceExt))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, errors.Errorf("%s: no trace files", dir)
+	}
+	sort.Strings(paths)
+	traces := make([]Trace, 0, len(paths))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		t, err := ReadTrace(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, path)
+		}
+		traces = append(traces, t)
+	}
+	return traces, nil
+}
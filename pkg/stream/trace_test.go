@@ -0,0 +1,73 @@
+package stream
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTracer(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "oklog-trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tracer, err := NewTracer(dir, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		t0    = time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+		clock = t0
+	)
+	tracer.start = t0
+	tracer.now = func() time.Time { clock = clock.Add(time.Millisecond); return clock }
+	tracer.record("10.0.0.1:7650", []byte("01BHHRDNHJ3MQKRJTTD5W8F5N5 a"))
+	tracer.record("[::1]:7650", []byte("01BHHRDNHJ3MQKRJTTD5W8F5N5 a"))
+	tracer.record("10.0.0.1:7650", []byte("01BHHRDNZM1CE2TFJFB9NQS3CY b"))
+	if err := tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tracer.record("10.0.0.1:7650", []byte("01BHHRDNZM1CE2TFJFB9NQS3CY after")) // ignored
+
+	traces, err := ReadTraces(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Trace{
+		{
+			Peer:   "10.0.0.1:7650",
+			Window: time.Second,
+			Start:  t0,
+			End:    t0.Add(4 * time.Millisecond),
+			Records: []TracedRecord{
+				{t0.Add(1 * time.Millisecond), []byte("01BHHRDNHJ3MQKRJTTD5W8F5N5 a")},
+				{t0.Add(3 * time.Millisecond), []byte("01BHHRDNZM1CE2TFJFB9NQS3CY b")},
+			},
+		},
+		{
+			Peer:   "[::1]:7650",
+			Window: time.Second,
+			Start:  t0,
+			End:    t0.Add(4 * time.Millisecond),
+			Records: []TracedRecord{
+				{t0.Add(2 * time.Millisecond), []byte("01BHHRDNHJ3MQKRJTTD5W8F5N5 a")},
+			},
+		},
+	}
+	if have := traces; !reflect.DeepEqual(want, have) {
+		t.Errorf("want %+v, have %+v", want, have)
+	}
+
+	// A nil Tracer traces nothing.
+	var nilTracer *Tracer
+	nilTracer.record("10.0.0.1:7650", []byte("01BHHRDNHJ3MQKRJTTD5W8F5N5 a"))
+	if err := nilTracer.Close(); err != nil {
+		t.Errorf("nil Tracer: want no error, have %v", err)
+	}
+}
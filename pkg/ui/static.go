@@ -649,833 +649,843 @@ lI8AAAD//48fXu9AAgAA
 
 	"/scripts/oklog.js": {
 		local:   "scripts/oklog.js",
-		size:    249014,
-		modtime: 1516288186,
+		size:    254146,
+		modtime: 1791988089,
 		compressed: `
-H4sIAAAAAAAC/+y9/XvbNrIw+rP0V6C9OZW0ZmRJlp1EjtMnn93sm49u7O7e+7p5VYiCJK4pUiUp2W7r
-//0+MwOAAL/tONtzznu6z8YiCQxmBoPBYDAYtLuLbeAmXhh0e+z3dmcbCxYnkecmneN2W31jb0ZQrtf+
-vc2YfnkZ8c1GRF3eY7+zSCTbKNAfuzP7ZZc7s94xuzlmN22mavZ55CXX7ISNjo2XAIKdQCV4K0HIj8ft
-GxOrgxqs2oyxOszopZtDl80c5kqUAZEivA/uiPf4C7mZ4lxI4byYGIfNFT3lJI3vSNLhv5UkeilK6XSY
-MEgtp/bwjtQe/fnU0stFHoTNBoctbE6UM+Pojsx49J+YGfRhWSUoDls4bJljUjmfHt2RT4//q/GJXq4a
-iJjDlg5bFfGwnI2P78jGJ/912Zh76TXmrcO8EvaWc/jJ3Tj8HCd7hwEixOcUOwX75ISNEPHv8S3U7VJ5
-eDkhQnrdWQ9Ap5APUsgwu5YDPygCjlUy8Ltupomx1QTMeeWtjEtawVr5hrrzTFuH2bZg3ilv7rC8OaxY
-2GJXZBo9KmgUtHx5u0eV7WLdsqa7i0zrj4pbBw1ajsCjOgSwegUO3WUGjcelaIAeKsfkcQNMEEI1Mt1V
-Bp8nVfjA2C1H6UkzlBBILVZdDxFr7+97600YJewDT7yd6L/z4oTt77fbOx6xqfDXU58HywduGIkHVGT6
-PIr4NWmIdEHQ3t9nz9mnTy8enkVCsBWPWXIZsrkXJ17gJmzOE86S642I+1D0neAL9vAZ+3YlvOUq+ZYx
-L2bcv+TXMRtAAfXftwmf+eJbRgUCxrHxcMGEL9YiSGIo/CGcizJoy0jwREQsWfGgIWh35flzFoRzEVvl
-fREsk1X8bbY8d93teuvzRMyZLAOvk5WwQAGs91AXPqz5lbfmPkMcWOz9JvrsYMRiIdYxW/A46bPXqiz3
-/fBSzJkXuJHgsQBA4YLFgkfuisWJ2MTsciUC5oaBy5PEC5YsCdnCC+aApxfMxVWfvQsvRcR23N+KmF16
-vg9g5oJAshn3eeB6wdJhs22C33V7Vkt9lIz3sKgZHePv17QwQwkImFhvkmviDRWlFyfs93bLTcJowjok
-QR2n3aL+mrCB024hJybs/HP75rhtzDJLkXQ9hyDC6Gh5C9b12FM2YH/8wTz27EQyvUtFeu3W7+1WK1lF
-4SULxCV7HUVh1G23Wq3OW2AF67A95rE91gEGh9sEmBnxYCn67OVKuBfIdIIJnzpsDytfh9tIdvrCi+KE
-hRGDZfBSJO/59UzA81Ik//SS1Sux4Fs/6Xd6x+3WTbslx/M2iPlC/GAShIMwJbagBJC8CCPWBWZesRPJ
-W2LdMbtiz9jgmF09fCgJh2KxHybsBJjzjHWv2F/YISDSulx5vmDEp76U1HMo+5k9PQG10UIILXi1twc1
-btot5DcCfMYGuojHHipMTEDsIRt+VhW5VBRUDPuXWrOYYn71PhM/9vfZqUhI+lFiGU/wAWWZeX32MfCv
-8Q2OLeYLPpdi75HwLkUCYNxw4wkYBnO23cxhiPZTbsfEZy8R61IBs2RLsQlYYKJf0MunediFfX1ajIPi
-HZD3MtxcdxUIQs+UAZwcBhIrm5sgA4lYE3rCj0VORJYiOfVDSyC/tMfNnmYnpWSaxXp5icgwywu8xOO+
-95vo+iKQZgwi6osAumVgdwtqHYIK1K7YCXvPk1V/4Ydh1KXffriE2j22nz6/7zFARkJJW512Fzi3DhyQ
-iJ5tCOeLLaJw7bAk1FiurF4ClEjzn6CKQoXY7SYhe4hVe+w/WPc922PDHnaIHv8eO4HRDtKJ9WVXHDNv
-b0/1FGNG9y+6AA8UXk91kqQNOzWnkVuWTm4prYx/oD6ylHgK04Fi6ya87L7HlV27hDgs5grPt8jcRyg9
-VU3NnmZFk04o15QXOAkY4yDTRyC31E9sD4b7XwgTh+hZe4FiXLfrYUekJZKQekUNA4Qv9YRqsUdQn7EB
-+57pgg+Hn9mEDWxxB0Tz/aC6YeW07V5w0pYnCnIbOsaUSMAdTLmu78VJOlS8OOlDUyiMnfPPnbJB027B
-bO77ocsTwd6jgTJnMz90L2JGRPZQqV5GXiIYANYWGSrhpF8qCKqzSXOfsPPP8gV1aLut5qkU3W9sdI1u
-xTLTAXYHIKHeDFGPwSTWbgEthIcXs8XW9x0Wh+xSMJcHbLONV4zDBLIA+ynhXgATiZcwL0hCmGIIQCCu
-EkS5LxWkh0x8r/UjyS9fkKlTPLYygys7unB4tVqq837cxqsugHSIVyh0rRKOgoJG9uEglz1IdkmyEhHS
-HodrkayAPF8sEhYGOIPS4FHT3jNLSZkE3UpX9OON77miO3DIrkDKqgiTGP8ALI/C7XIFZq8yo0lUQN7E
-TgTJlvv+NfVcshJr6qmVt1wJKVV9Q02sSE2s2FP5TVp2D9nwmK20qgDq8fv56nPf1CfWJGhRoIqb3XOT
-6seV4HM5g8fn2aZB5nFeEHyu5nFQFt99h/VsDEDQhvZQTQudDz5n53ejDH7CdR77kSQdMCGOcZNnjMeM
-03qln9cjSG8Swh9FLSgVxV/6omzSjOwReBQ2L2aS1nkoYhaECRNXMF7bKf9NoleGKCKUelFcgbI2xfH8
-Mz5plXn+WYkjNbdRXamkMCMFm5R0Y5oyNL7+ZImQbM8Wot9Jd7M9JRZpwfOymlJYbgzEVIkNjaNAm4XF
-Aqz01O/tBgKs3t0rq00RxIGMhiDbeRxH8ZSRpmWzMEnCNYtQRGBlzZJICEMekWJpRGoJhJcChhrC0p9l
-j8ivMIUEW9+3hxF9NIyaQFyiA+OEueg4UNCkbBu2YezNfC8WXe6oSsqjwj4JdxvF3k7AGiXyBE6JNNFI
-yi16HxK96zDGJQuQzDZhDA2IPnu7SBV4ELJ4w11B+htUHC6KAEWoCfTR6mcmpA/JWu/Y/AH27e+zv/Jg
-7kPxGHCGVVESbmC9hbrfFzvhy+HJixYc9MGSt6eZWTEQl8/vMCsqqDFOJL10fgR45uAEgmgKlF0DBZS1
-S1pRGsbq+9b37YnS7DGAWSFYszD5BOh2ea8nVd0Z9s8lj2XveEFemqFX0e6AL7hwQh8MVJ+JdG1aIbIG
-K9NVIY1ZzZBzgzeG/pAkoKRTaa11jAezBi3/bX5KXv1zJQIpkkCyJZMOc9GD4hlCm37F6iC1HK0XyYVk
-Jcc5u1x57kpZYTEL1RofGI91pReAGKulskD4DH6d0kK3cDgDqcjBJryVMwVB7GU5qb/W85btqblDAesV
-MTs/oUu5Vdr0ZRjsRJQYzkg5raMlbPhIDRWQhLgsoNEvwdK7abfY3Qvf+h88n1SquchQ9aA5pVCs1RnP
-SeIxOexg2aYdVmS3w/C1FQzqgu9ZBVYvwyBW/X/ufXYYrXag3iSLnS5lL77gq1Lb7/kGbCBNX7gTpGD1
-ygamJOWxSvmw5htYUqYTkqHwyhd2ilhjfZea9Dbneri+s3VwalCYYoZMl7+JzqLlsg3dXDAbmgSWV6Wd
-sjDYrhiu2FDCaZLrppxGtZCshBdJnx+PpdeVR8stlOmb/pe5uBLz92Y/aA+O+oTLfu7g6tt23mRLoGvi
-/56+fD4CupWbyOpA2bNZFhkjDlbB6OPA+hMFRiN+7qHKKxGFdJ0R+nMfYM9U/5UaHM2ZQBbIjJ1IEk28
-Z+lqzdCzd4FtoW7JvgQviZ7lKY7uQHEOnYcPj9mXE1sP1kK4lk6wij6++jhh7jaKRJD41w7zEoa2HPn1
-0Sxy4GcgN1wWSZ+dwRrR5QGb0TbXJvHW3m+21x7tQeVhNbmHwvc05RvKYro9JIUQSiahUS4JC0opKx8a
-eycWiWwQn8n+o7Yz2iT3XeGWhNinupXMLkJqXkl7vJn1bWoohvpJqye50p4M2I1txxi9HSsfTRL2Su29
-UyiUdhmLUltZOvnofbqZQJTLxTK2AUa0xRr2kHUj7fX43lAYkTLMyFWaCht++NzLuReUS0P6E3YCCBBz
-MXdg0pDNa6MSalyuQl/QF8ncKMdZs//nKTNeohmJ2l06A79kksj1A+LRs1y8mjPZUulEQkgWea0y8wCx
-UPVFfjWgv0sxpWLoyzY7K18n7a8aRZ8dT5nBW9ADf+rQkEjarN2Ti4aa0YJr9PxgwdfpWFFsKBwtmlEw
-XLBidrTgy4LBAu+/0lghAk6KzPs/b+zQ4rOgo6yxVGaUsYfYLXJIGQNmYA2W1Pc3KNmIyi2/TYNMev7S
-td9zexq1hpXaVJLsKzCin282IphTnA0sn81lHsdvGEyfmhY5p2BmpM3S+XFWW5gbTjMXxg22OKXgPil3
-L5UvYBYmK+nEp7mdudE2QCdHEi5FshKRFC73fPA524nu+TDz7mnq0CyupBAm80WiDHDMoIY83JJqA1mN
-doKez/+1jRMmNQYP5qyvt+FaKSrshBl4UWiO0aTeaMdC1kLA3E8yHM1QkNxcRZKHkG1ng7ZVW9L1ZhQB
-+dpTAkYsIdzTxYf5aOEv3/U0U2xG3bTbJYTpre/wk1iHO2QR990z+ahkpyUNJlnoGXutmQKSFq+2i4Uv
-EL6DdDsaorkHk/HTpsUNPy2UsIO5YDShpB5LswY6mGzTj4Hcy5iu+fUUpBg3THPDTg6CYpueffcdmxXN
-VxLdc6hrslFX/+bkhA3ZH3+k1b8x9oVyLalSmnc879xCw16/I95jDxEhOBEpmgy/JzpBcW6akQ+01fKC
-WESqgKPrE7f1d6pjfB7oBQQuTFhmWdyIhkb41qCpRhbwY8NhwYKu/ZQKiySFoDIEMn7m23CVF/DSsBIM
-BAs0FfueDdiEDXUDyhDXUzQUGYJpUNUJylaQ/C2gn+xCowq9KODDTVbzq7hCtDnQ1MARpaYcHos57Q3y
-pF8+UZHY181J1thpomgsPfP0BBVNMTytTaTyodhbQ+2QRvmr8DciUvogJmc3dXWffRIbn8Pylxtxocqn
-HXtzoba7qQcsB1cqtvSRtuy0l4p8ZKrv8m7Xdsv8co7FP0spTT/quUF9VqaK3B0tLrZ3Ipsn27SokLZQ
-s643LY85qtR2ZtmqxqJnYNCSxXKQJ6RdMLtm4OXDroY0z9rQC71Ctp1nM16OsyyTUmMv56axujReeYuk
-+yXIFbWcf/eQ5bioFF2mjRSjm8ysiv7cqyTidqQy4P0aBsNCRGofdMM3YAFqwcgPViXo8Xb2TlsoZVZ4
-uU/UqL53Yrix7AqlztZZQ8CzCsA5zZRbtMyylfQ+jazzkHWNYMau0Taswdg+e9+TOpl6ZCmSkcNikYxQ
-98Z8J3BXjEeCrVBjSU3luiKOQVmnOx7omb8MyUAylxgAVKpBHOM5rzt2BNHQbrW+Z1wqjHarNWEzrRhU
-mc8ZR0EGvEOBwGmAbqYJFf+aKi8sn91JK2jXKmqhIPlkoxH7IUXUEYbUV47qNLvYsextn50ojPV0lj7y
-zIDtIbsGyCfisirgMOOn1qzYTJwpOMsUdJif7jvGctNR7iPiujxWzoFQhn3JndmltxOBCoenycqTcfAk
-NTDhhWseuAKPdryVG7dbmNln12rGNEc3tvchnIvuymGK5jScl7ZxjXgZnO5xtMtwXl7rMFgVbsXktmDM
-GYX3i8JP08BTI0C5bgFBVo+Yq2i0VKSKzYfMZpPBIO34SONS3zt1KoM9TEHraEtx+aIMdFHQQPd2bZDv
-68Lb6PgGuYcXe78J9r7P3oeRYJtIuF4sJswNN9dpJEQEc4EIXBEjGDkpKD+R9DFTNB0IgQwPXRaPPyjY
-s1H9D/beMhdxrKREIwNemPUdVgUcp98Uhh5nCEU/WXCKhmUKC35hwIW0nn/c+j4FoeJpoChck0WfhGrX
-xOUuxnF6AePEw5lYAIcvIy/xgiWCMWJYNTNj6XWjuN0TREK7HjFQAkoWSAnFSw+UOJG3lsJ1YdDL4060
-2UOgvJjFief7ZljtnCc83fMBfGW0EqfgEF/wOGFhINhaUSNUtO48RKflLBL8gmIJ/TDcsGsBCwcpEygl
-DyV1D+kUQ86CVGuiHntqDEGUjP199sYL5ngqSB7T0qFYqjvCCMXXC5Z9dZYi3EauIKduqdQca+eHCprH
-wcweshySjoTYz8S+E4KwqsR5nJMjCkeYCuJtpcDQc6khSweOBdjeSetZZz+qXVJYImNm5jxTYNCi2YQG
-MdNh/1m/lAnMCqZP0deGc67w3kkaZ29/s/YkyHZFb5XaFkxCxVE8TLSJQlegQ5JivVGHQQueLdsgnJc8
-ppqLre9fy0NGKjC8oO9gbZmEhmMRx7sxiFLvIuJC488MkypAwovZwvN9MWfbTd/sucLgT3myS5k0oLlI
-Yzl6lKmwplZshkyVaYFWC+vpc2Jq5e8LHmw3jC8SGdMBo7RPUouPMMKJpiLlVExFOks3oiDFTO3KwCoF
-29oGSbh1V2IuJymJAoWnmVrkae0s2wCj2mlEq/4MzsoDkcL8rIyOD3znLTkFEShHQ2phGG4vwyBXK538
-ls1n63yy8kUVVh5oFF6CwGuDEQY9BjCCSmQfwkSgO4ddh1sWr8ItejoSPCuJattb4NY+GomyGj2BVIcL
-fTA3jIwzt9rSjNDUBBbGYWDaVoZf8EuDd3Khp3cI2VGVS4OglPG4Ci/ZmgfXcn6BRZkMIM0EP1tHEbV3
-uewkYP54pbW8zQUX2kf7rKdcKLqUAu67eOw5BoQpeBMHttGHKnwT1OuMz/xr5sVkAAAEPKJMfgLuSq2w
-8zh09iWP5tJxIA2dVBj6lo+BzjdbC1N9pDH1G5gnYg/ZX6yIbnUutvhM7O9t40SsGRkSJkUB365eTVFM
-q7mKkt2UGkR6IAAhVAa4lVssybjVVcl5wrsc6TsHkGmA/u1Po53bqOFK9LO13Xo+/KxOplUzCdWFte1M
-vMhG/2vPNEVTZ9mBxfWOgcEY+GAr1luQmWu1iFJ1GCQSomcS/Xq9WXGw0GI288NwzmZRCJbvCn+LQPBk
-VbiDaxwvmJnKuJkuUyczFA3oyC7EmPecNCgp9RDMUiqMeN+/ncrdcz2u/hWrdBDZJTPFx7d0pWlXlsVD
-tNw4SSHflzRm1PNyUcYJ+eaSAqdfYh3tyoWIkD0kQZ97YJ9+Tp1x58nnoo0dcrW77IQl1g5MqjnS89CF
-lEM7XuA6Rjvpzkn2AKfitqythV0+V2yEVJ9+1oedbUCZc9BGBxnIGLTQaegMjOMyKuyKNeej76LPFCKZ
-Rc1/6UPLJfz7U84ul4R43ePp5RQiyu+ExNhp60NrE30e0QHFQq/or9NupSe8J+zNqJs+9px2izbh8AP9
-hJebbbzCV/ADXqDsTNibA4p8g1dLkWCRpcC4vBgfD7oxPa75Br+u+aaHKKhAaYmCeoSPGCiMlfGXehXp
-VxG8Ip4o3jhtQ4NOUqUomaI/GA+YPuUG7M5sbp+fEs+Pa5L7vOCx58a57D56RM+9XW5K6nK2z2Y99gft
-7+mykVjnynL2HxQhnJ6eCOd2vMTMUgXZPC6dlzyA1YRcC0B1NuizV97Ow9Nrs2v2m4hCJqC0TsCCHkRQ
-79Q8Pq/x2VTj3ZkU+i7HUyrsexaxCYtg6ddjE/YQcH3IHfZQ7tVLoihucSahrC3y/HD5gseiO+OxcFhg
-8kIrWzsFBZS0s0YFYgmGllX5YWAV4bPY/h5gApPv2cOATVhgq2XQENmOKRYHFJm+u95QeQmTs0m2E/nV
-HSE+K4Ho+ny96fqhw1Zehm91gAOH+SHiihspfog7KQ1qrTzEp43HIlZeGw8/EO9AYMJozk7YeefdWcdh
-ndd/h39/OOt8NhPguuEa7MXulcOuLbONQlABxnkdJlgX9PZnlrHArsKoYER9A8JnC0yYdK1C39jfvfht
-sAAFKbJCA4Isv12zP/6Qbx6qVxkbLdoGLs8D+SO70T8XSzBvu3Oz3Jz9hYT+x7dsnw0f28oD13fdxKww
-Mir8hSVWcVCAP4Y+j7qb0AsSbZ/CoMc3lCRC2Yzy1fC4kVCdbTe+GHUj1b4bAmYO0y9iL+jKDTXDgC3C
-5yqPz/Vd8aGmf40STPF0xfbYNfsLu1Z2AE94MOpeO+xKbvWl8+vc2+EENfd2MOdEYo2PkVjjpBbSRLkO
-YZZstzbeRPHdabeEfHjttFtuGE80S2B29IKJ5gjm9FLPCYdnnlbgVIOnVTjV4WklLmsBIYhRShciJsVq
-ouQLWgSxmZD0yEkSu2GSSgjaDvKl/AHAgJEK+V8jMCik6saW5W9gD2njidTKgN8snoACBtYBNcA6LyDz
-4EqaB1fwiDoNp3v8ha9IX2Ap+RtJuwJl8WbUvQrRKgjCZAKjGu0BOeomevwBHOH5XrBUvSE8H6gHc39i
-mP7Q1+EW7CB8h7+RHW/8kCeTdNK/MpKQXh2zG7Bt4g/8w4ThH3xUKmRiqJMC46Pa3iCbpCCZ4MuP7398
-/unt6ccPp4YiEb+mmpXMee5eWDlk4te/brnPTpj49a/CJ2WKCxUsqmz2Dfei1PGjKn33HevCF3ZCpfub
-cNPtqaM6OdBQtH/lILB+ppHUQJbVMvmsLOzmYoObPlhZmUH4kj1jw4F2fRNO23jV/Z1dTRhUnrBrdmOe
-RkiirTCiRynC4DrrDrHKJNcbES7YFaXZCWf/Em7SMdbO+jtmDVIkdPQiuijVXqtzFl3LjGzbWLBfuicn
-vV+Y6bPuy3PzlNfgkl9D2YsgvGTeIi2F/tBvcauYr8W3yjX62l+zWASx6HewuT3WYZ8En9O+IZ/RBp4X
-M56wVZJsJvv7G+5e8KXoC3/9EOSwH0ZL9TLeV2/3QTr30auZ7JM1/P+cnKSNkJtzLmI38mYiZpera9xo
-jak5IAPzIq3UWXWRJCJiO0HJFXC/0w/DC+Z7FxL5bGauBffjfB9icoc//mDX+snuVKxlVvKCOOGBC133
-iifCLn3VX4rkzFuLbo8kJH02Wv6m2wGzpQNcv+pljyNeiGv6oFPEQRUl2ecX4vqzw67lXxLnPVi4kpwb
-G4AZutVeXZG8Yko/PPbOXnluQkmBKFdgiIe5Y0m+kefq04sP4Vyg/pltPT/xgg4w0i7yGtaaVhlJLszY
-Gd0FLT+QJ+mvsPeuqwtdG0cPzWZPRdKwyVNR36JR5tpIqaQzMiB7cDwJVGSXXrKCcSLPKIVBHsHJpGPE
-7XN2wq7UPvaMnbBrM6ukXY3i3LOQ8nLC+9OBw2b4761lBOOVucz2hWHXM/lgSI+BGCFUwJrnFM6keZPn
-hHRuGNy4ivNdYKbI7af+0iu9+3/dvFKai/FK78CAhr4248TMgyqaNzclR5mvikNCrWEb44nha/pzT4PW
-agB56rBr+beoid+LdWGR4lFz1K3UThnT0kmbkFebnZgwi/0gAhHxROz/je/4qRt5m6S/ih1Gk0T/X7GD
-yggzU/wrhpbxeFaIO10yrDvx3K2PTuRELNN0vDyOvWVAwQfvzhz2+u8E64ezPhlP787YCXs4hC/QnQ77
-4Qyjfs2Vp1o56hPHFdO6mgVI97PvAe6EXbGn+PDujE3YD2fHJbPJaRJ5wTKrF/pIy8dFt2dpCPu1XrMq
-hwm2y9lTfChoN6NUMmo7TQkoldBVXgldlyihdEWPnEMFdN2fytgGaBy+Au9e/z0v9mE0T7XQFdIvtdA1
-Up3TQgZmEiPFdJueCjakB4CPelIp4UrQVEoSL9z8RqyMikc99pCCTTAvcwR2bscld5pce7AEAMrQPTSl
-MG/2UZpKpqOUUiDddGqZ8Prv6ZdnJ2wIK4hi/rIMc5nNUw1ilAMxRBDD5iAOciBGCGLUHMQ4B+IAQRw0
-B3GYAzFGEOPmII5yIA4RxGFzEI96LO9MxW73YliRwJsJJscWUdQ7Zjfp/1Ixxl4GsSww+guguekbT8YF
-z8XCC+jQjxckscPABt5jnQUsQWOHJd5axA5zVzyKHbxjKljGjjRewoUEiVs1pD01BNCYUn6LyoGx3dP5
-pV9+fP/+4wf2j+fvfnp9SkoWB9PATlVO7zq4rtWqVvpfcj4+YyuEiuBeyHQASzX4MZyw69yuqruKuq7l
-PxOXUsXKOysQ3x9+evuK0HTDbUD7nkbMw9abd6cmFCy1t6frf3r98uOnV+ZamnKOdUN//km4YTR3VBay
-N57w57EZREMFgDPAh9xErEGkITH0jJMwO0kL4IuS6TzTejEkq5AJLWUeVVCE7++zd29Pz9jp2U9v3jB4
-Ji5+8Pw0MwBpXquPMbfUau6wxC/p48lEd+9qrvo38XMdLM9iX8VgVqmse/RS9nNsT9gxKXcS/eyMHbM9
-dh2nJqwE9M5Y+sRVOX5lXXKOhhgUg6RexaihP3i+8pG4W5whoNBxu4XWLhQapn4T1VImPS9U7E+HxZBt
-QC3ZiKxCqKX1EVmJOOGhRu+n56d/fW1KsxvxeNVdh/OtLz7wNQbZLb3Q8kxrJ9NaxDFfih4rvSngE16c
-gNnUfnklZttlHxv4BQSVGmG/gKpMG2R7rPMLqk9q+CyUg1jiAd9/DnDBv8c6ZyvBJBZsE4U7b06nJTDI
-E48FbpNVGDEvnvwc/BwwxpisKmu1yW+QVSaA5EseiwJOmCdo/m0MAeRTmtFBEjOXq8MhQO4vLo/FL0xc
-bSIRo5Okmon9FOLHQJ+ZnEU8cFciZnTCVoZdIY5oSkOZRej74aUXLOWlAsswUdmGUy5jpLJslRhGPffV
-+66YYmXN02M/TniU9H0vEOzkRFbpi2COr+yR3gkDhgVTdhrVLR9lZyaSSyGofFxcAS/MAE4aX1XDelye
-fWSnZ5/efvjBiuRR3NRTCmg6dsKkwtsdp/ov72M0KXqqPjzrZPyXVG8Whr7g2Wo79j3rnEVb0WET1nkD
-C77i6sF2PRNRrvYe65jld6VrIYXmzx3gEZ/PT30er0Tc3Tm4oiRJ6hQ3XqjuO9/mIeGKFUF9a6NV7Bfs
-wKviJuWaEFZJqZ9vZ6wm4OUpSIAAJb2Ti4ntjHCFlcghHUvAfA9mYb06ySy4tslmmyiHvelLVE2rdRZA
-vCA4iFoP4wO9YEvOhhZBUtmZlYSdX3zupeH+mgVd4KKs8a/QC7odp4Mc7HV07H0JCTy+6GR9Bp2nCY8v
-nnXMqrtCX5FxboKy02dcP1hQOe12VhLbDvmDVMSLrZgw0eVxWftP5wL0UPSsAHP9qbT29McodEUcF1Te
-0JcJ4LLre3NgYQWk3HJb9X7n3Fazetm9QzGTK2lpZRRAlDIi4e2dsI5TAtCGaAqFqsw6n8spIKPG5sJ5
-RfkCh65d+VQkJV1a7szd9cq7usS3vav3bdt4vfLchoiZfm0TM7uDO5kj6mp0a4ejVz62aWMvwrzyemCr
-A0Colga4QxfJU+lyRy8SgS9izFwzIOC/Iy/UU9d6emo9fYtPcRL1MWbr46LbYR0MIcEGDEFD3nTT1r5H
-VCdSx8BvVCvZPR3ZIUoLValjw6u5K9jEyQxJGoqaUb3CIQk9eClm0zh0L0SSB3IpZvTJqFmgrgu09e/t
-jC6+QDvhJGNHab2sci/JKlV5lzq/33QyXOz8zvKanJEqZzcdeynYeeoFiYgC7kO3bN1kGwmgz1qbpTNr
-nEQO8+KXKx6l28skZ/2IMnd093/+eX/psM7PP//8MykixoyPgfwYFHxL5Lek4Fskv0UF33by267g20B+
-G3RUMhOFv5WGzajRUeh3VGRc7hyIWfxbWfzbjk7wYEZp/jph4len3XLXmwlz1xun3SJ/yUT6UtSLkXwx
-gsKraMLcVeS0W7SYn8hFvdNuLbfefILODKddHLPZbqFJPyHL3pGPLzFMQ/+kqEmSvYmWwjQ2oSAcgZz4
-DwKxQ1NHC0h3uhngqgi/TPTSl8w5ZSdNN7BanW60c3W6oxdDeTfNdAMqa7qjNa9UdgxhEmOrkNoGsCK+
-ZifAiXYrxW3hsOlmZKJxgK2ODFc7ZYOdbg5wEY5/MVnPTSUfdIMH2QYpas/cocH14e9ZxxebDiZQeDqc
-sNlNfYsL39sUNoj5cc0GZX5bmcKnGqq8BDLHOUBsM7bA8lpg3lwECd2Ym0K6QiA6VKayJ6fhpmD7z/j2
-xx/oYSstcN55+kfnc6EgXGU65aqWOfeAzR/PirC5ctjiz8DmmcQmJ0LLLHuWKLOA1r8Dr6dPi/Ba4o2t
-fyZee3uIV1WkIendqkGhtGsNIFWscnzpMLJSYHKvNS1ZDe8D/1AP6gP/UE0gBsfVwZHFKpUqxejVQZLF
-qpVlCNZ9NRwsVEmZDB+sJU2Wq4KFoYR1gLBQ5fQb1vI5CCt5fFXPl6tKrtyHVvyjYlxJJL42Dt99V48D
-r+6MNb+qg7DmV5UQvKAWghdUDhm5LV03ZKjYV55eTupZuvzKODxtgIP/tfnQgA3JV2ZDAy58ZRT2G/RE
-IH79ukicNECiEocHtUOrUutvvLrqG69yePt8vakd3FCoCoqMza+VCCpWuVyYxbVKcxZXLyCXDWZUKlUF
-J/41qp0KoUwlNQkPRrX0QKE6KE2AVMKI62cCKFMJww3rO8cNK3unASk1lDQgJK6b0uL66Sz+unrj/zRQ
-G1ebr4vDf9TjsA4rDZRIrGstTrH+ytPAfj0Zc2/3lZGoxwGjq159bUT+0qBPt/7XxeFhPQ7xdvaVV9YN
-jO95zbIaD6bVrzqxWOVaUZ17qxURVbASL0y7U4cVFKqCIs/r1Q4cKlapA/jc40FsueQS0yWXVLvkHmAg
-tfJe/nDWqSyM0deq8Ou/Vxd+Z0J+VwP5b9s4+RgIzJJp0sJNWhQwo7BytN4gmUUN4OUvDy69ZPVKLPjW
-T/IOuwdz+uKwNRQ2HcoDdkIvVSjpdDMw9hYBkw6V1wdXNwPp9L5hmNPf/KhaUgH3xR4uQvlDSHeVp0yU
-b0o4SbV4MD9bYY7CDJEu9/0Zdy8kkf+g0B7bg59+SckdVpOrwHbJ2d8rIbyKwibMgJabCYYtEaUA13xT
-6EfOScAoLwGjGgkoI4BOBi4QwnTQ+1q8WnNEOusH3gYukOew9Sy7ZVK8e7GW2xfr2Y2ivdudbg7MWAlZ
-oYdnR2mXJccc4+Ow4OMtWPd8JMmQLaVbOl+Zn8CkN+NSfjps7Zo8Hed4epDjqcOmowlbuwZvu9PNOMfc
-A83ccRVzx8XM1R9HX8j5A835ccr5MXFe/vzaQg1cfXNY2QkOW8/NjjjMdcS4tCMcNj2YsPXc7JDudHOY
-65Gx7pHDqh45rOqRw+Ie0R8PvrC7xrq7DtPuOky765C6S/48+Mo9B93w5qi25xy2tlTvUa73Dmt7z2HT
-8YSthdWL3enmKNeNh7obj6q68aiqG4+quvGouBv1x/EX9vGh7uOjtI+P0j4+Svv4iPpY/hzfQ3ffKbvS
-O8+axSnZwZecRmDGWQQmTyIwOoeQzR0D5r3M3helES4hhvd88PxskjIeRbnLYIFNVIFu3o4iPCUabhM7
-5UG4TbLJ/OQ52DjTMMYVVZ8mCFVkEZ4jyB8hqGjWvLLWaJpHFFumcZIHHrjrMsyk04wTVFxGI0hWcNfN
-XBXgupncS3yDNYzjIClOVezAs4zFLAIMkUXPJWg6bBdrMbfPXGBAxHWOfbaA5LA+SLF22G9fijm8+62O
-moMsNdBwE6Jav8HTb7clcQztXcYNyWSMXWYoaLdajAFpV2Ufrss+1DJDIodcKOXJJdB9qbhw/xw6BCR2
-8e24tCuj+d/JPok5MqyOizvgzU5x6qvyNA6j5MU1ybl1MkfXMfRUH0p39eyRC8WqSyy2wGyvC7pprnXT
-K8Dln16y+lJs0pPV0GB31lNZF4zD0zTrv/57RybN06/encGrh0N5r91NLnfVB8+fwITltFswC01wLsJM
-SvDwZtSF5x5mNdJZE82ciUbGRPm6KA8jpnYc4Sv4IXM9HkxgFQQ/5IvxBCxy+CFfHE7A0IMfmC0Sexex
-op/qJbBZv4aHXmV0ItgND1TRUq8ZZh5QparhvLiuh/LiuhqGHQYXm/6I56NuectOTXgdCl+Z84LgeMHS
-F0kYWCjstEen8qwmFlPHNX9PDa4bOpBV3uo8CgtcJgEdTSbJhyKTNBtBGiRKjpP6DIR4J8lQ1lF0AHw6
-vmBYq4Z/Tn8vcNCBKpQVcuBseEbcaoAJZulta7obUWyrOkTRagVpLGur1VInW3Yj+ULHtwI7ZEtGgpCb
-ChmXa6UKyYQSlfXHtfXHlfUPausfVNYf1dYfldfnQUGYrxd/vODXppzx4LpYzFJXpu7lvBfTkIl8EhdT
-JCiiHBpX3s2sLMkkLyWyBF0hkdfCdKjiopX4UAEUoHFWog6zEsWD69sJFPf9JgxVaTKfj3BtWdI1SIUZ
-Gj7K8PEbza2RPIWGVdRprSpEceKpFh0sUg3BL/N7ctc16aVcxBUidJAXoYNKEcKFTqGO2j2SaloKwXT3
-WK6bDFcmLZ10iScoJQdaSqAoSsQjeqa113T3mB61wDyhZy0vSOdxQ1nRN82VTmvA2VYp7wH7NyRAppCM
-HeZlmIVZuQktpBkTmdfOetu1hRudVv1iBCnbrIUephLNoqeaq8RxE4XzrZv82/D8i4XnsDGea37lrTP8
-1KMjdZ3KEUDyf5g5h1hheWdcVc8PuuW0lkdfKu+lcl2S1Z6Or2YOq5tKPnhBHR+Osnw4+vfywQuUh0+5
-974GHwQITeFRBqkCDNO2+QzBMwJbZQGKX2EJdWXOG+SaqlJZXoxnO4t0FvXeI1yt6r57VKTDMwnbcoxN
-c7BVcDDh6MIsFaPHWTF6fCcxgnryANO9CsCKrpcsRf9JFv0nd0T/iXRi3iv6xSEr+ktxwIr6fA74f642
-PWBxXWn1Fp9Jygydg9Khg6YNyrzU+/YYBNsgY3nKp8wCD62HwQRPHOnn4QQA0NONNB/pq7n8azjiFp6f
-FGmKTSTmKcWUpymYe/CR+y/DQB9CM0lbRGGQOGzG3YuMpgBw9LnHvtfLVO3mlxXxcB13L24Y/ZVz4fEt
-eZ7B9K6swSgBRWruENb6ymbPdDMcoItofdUzoi1qoktynMAqODcMJ+wqvinZ1UEdWGcAUt++v0dprmRT
-d3FnKYzETkSxKNZY92tk5Th+Rby+vjEsrywJcsVTZc26PPDLDnyacgIFh0WDh/TC81Q1SKmCwvTBdIoM
-h0UKu6k+kRsrDsIHDZ5RLs+z+sVaDWc4CUwyV7HmeK3obGVCYc3Kbm21kGn0U+KQowvImqnfOVeYtkFA
-GOukUeYgy1tPtMdlDvmRyuqlumVUuKq0R21+ONexgUafnkxKJLypjOv5onUda6Y00Cd0525ukN5iKYR0
-lLO8bOjVrH4IrzI9l/OKlIMgkSx29q75Bk+4Irg6CcLUuIhBycSaImXc4lWkEqab4UFGIYzJ5XRwbL48
-opdjGauo3x/q99L1YE7IVzgZWwPKzPQoR1WZNEGrN8aIg9aktpjUQ4XaBcO1oJFDOX7vaA0Ac500yU4h
-RiaZetoqVCPNPWDb4DdMAWB0PfeidDFjdbrpYBk+xm5/ZPtAyYU0fHycvhsN6N0jM89SQypNg+OJNjgA
-Zn86KKA/U35olh8SZ1CDGNfsNVAFqm+sm/FMnAs7pqBf8APxt1JVYAqVeCONjczQjMUma9ONhmrBqWJF
-h1UKPjslmqo+P9DtkR4JpRKazuKxFOyaIQSAbzLLhTQxEfICJruGc5AeTq2CAQPsoeVslYU7GmqBk83f
-NJh9En4hPmk7MWNnyW0rh0GpQOZ9TCvc/yYWtlO2izUaFWxjjUbV+1gpxMLNh9FBwU4WTQWjEQzI9K0Z
-JWmyfaTZjm3dWNtfo4Pc/pfav8DS9Cq3g2Ew+XY7GVDxjHv+J+HW7ELegylpYEl8ChztaM8Lc+30DuDe
-cGRTRg7dJHKYhf1dhKyhNpluRuXR3gH1NCBCHT3djY6mhzASWvNQyha+G+K79KWS1+LAcKWSdKFpyV5c
-0Q5tVrRtMNOyNQ2onUsvcVeq7MD81HJ5LJikgv6bRYJfMKLuOFNwZBbM6NkSZWsYLRLTgf1pOLFBlMGw
-geTgFC9c5H/mw02WqAOTqAxPq9hawoJm+Bchb70pBVPHhyJY5cBy0AoAVrLWZm7myeR1TnwzwnZolU1/
-y2NC2U6q7iUKLLaoypbJdKVUCo9pVrDYcVxQ7lGmXGGhI7NQYYnDfHNlRceFRYfHBfJYqzRR1Q4HgwFe
-cmmsZJqJ8NEXC++j+5DZx4VymnlXAUbBOcx/GE7KApeMuddBm2KMmdfGvQyMWwwSNvkf9ufZf9CtMh8c
-5mJ+zeF9dcKXayr9K1c9nVQox+jQ0j3FE24eh2IM0lbb1t9M/YLK0jXA0LjvUippy89R5S7MTWTFfkNp
-5eeayFg3DezdZoZurdQMUhOz1q++ETz5q/ALchFGIsYzsjqRvsRB1bj/NRO1WBZWg9NRbtlC4Y1qHbv1
-E+1x2uE8Z66IprvRE3ZCVZQQxHRCGMDTK7mQeay8ZP5W0JtsrE3KiaYBN1SjsJMtDtf5rtKWi/dTaPFC
-IOsEgAdLUdz/6i5qQ/5U4bt3PQG1Op969wAjO0PdUwdDdsJWntV7B6MiCQAc7ZVMyw+xyw6kjbHy6HGY
-iZ46GGW7VBGYl8FcbGqD7gZo+d5WLGjY1wol8isSg1ZeruNrIyf03fxfuNm35psRhX040hteuqpG3Kn3
-pAYtD0PDMI6HbNjL7AgWEURZ5PUuTNX1ghUJHQmKDoKrgiKPQ5VDKYpL4fDF3PqoiYbJ+0JNDCU4DE8r
-dWFSBbz9rIYiLFMFQyR1EERSUX8pCvSchwfHJFO0HV+rMwYYUIgaA5c8NcVRFRXtRhd0qeQqZj7vwRKh
-JqBr1K2CuRSJwzSRPTapjXHpVbBws43r5BKKVEAQUiarQGCZChhl8R8qpphHUeoPp8TWJTtVSsWkUaEU
-PIybTDWcBUJxPxqATKTDPbfXUwVBBt3J1Nv1LCHK6vqoOoo5bTmqgeE3gOFX6R9Tu1cBSgtWQFvXgllX
-1k/Ct9RM5vxvgU4s3wNS80xOlHYDh+2GJVEbto9zJ93Zu6EZvFER0pjOWIPbaRA9dVXfdYu3SEj1UK3E
-qWzt5bnv0B4ply11w0WNeMlilRLmJR73vd9ErYSpghXQKixh0SD8NIuSYfVW5UXvil7tiMZ/DTOTrra5
-ueMB+JcrHuUOwKcrT+D7y3AuJmkJt8d+Z03ON66iLqWYxt6DhgBS1+31jtkNHgesgOz2XVnhedId6Bo/
-bTYiuiMybl/Wx+vYUizehZdfBBPr52C63Bdfiq0BpRD+l2OuoaTwK889Qi8+UEJROs6gVF+VKodDAlAN
-hcpUwTCIqANlFK2HiGxvBhGLVkNshF0NXo0wqsHFi1/Im+UKltOXsO5brhz2AAafGThb1E1GH3apgmHs
-NDKCAW6RTjQh++Flr8eesYe3MK6bwAVCe2S0l2tcyTLFeNT1lVx12q26gdd53uk1Kfa/O71KpJRM3Q9S
-vBlSv9Ug9cpbesm9ITVohtSTGqQ+usmfgtejGrz+Kq4UXkbqPz30ihW5yWhV+I8/WLfQTs2R1lQQ6sst
-qFyKwX0h8LwhAm9MBMhWTS2gT+Q2rbZ9XtFS0LZ9rPQ88rasOEnz88j1YyAu8f4v/JZGjOHlFV0oA2vt
-M28Nk2q71cqt2wnBB6+jqNv5KcBLsZOQbXgUC0a3Vcqby37uMB4zju32scmYrbdxwmaCeQFecfr29CN7
-fDQYskUYrXnSx4upJiUtfrxA9CiJAxF0fYbtn7Dzzuk26Dis8z7EP2dbAX/+Keb4tNrCnzeRB39OedL5
-TNK9DoNkJWG0W+edv3Gs/UbMEBaP4M/zTURP1/Dnb9BOuwU/fPy6XSJQsYE/H90E/nwId/DnlXChpaxZ
-qm6TSn877da14KZBNDcMojn0yJut7/9/gkddaUkh6iUVVC6nlLxzhPEenru9z+yGYMwxe0VpkyglsrlV
-uK1E76/hNoo1bl6wTURV8fdYQleIhRsG86oKp1jCaMH3vfpa79NiumoSgnBX1SLhp9LQR5nyiVFeD6ak
-p1n6cfFPIS5qukbJ7rnk9LXqltSIvcui6NRdifnWF1FharD3z//f6enZ6x9P2Qnu3g+O5VW7z0//l3kB
-drx1XSHm3dwlz9a19Dy+mMqSuLOHpeWuUe5G4gX3/C7e5F8JD4qZwLBGDliAxL7wgjnebC/TplYCtqpg
-C6raROddpbeBK/wJXn6bv36dEsIa+V8THle3K6tUtAggJggo114Y0K3Zt2hPVrlbe5FwhbcTzTgqC5e0
-pGCDeP346ePL16en1h3rEb883fDLoKspwps36VJYdmI1py6RhZa8+aRygbjcevMuTq9RGCZEJ0U7I3rQ
-rfC45p4/C68m7PwzYtpuieDXrdiKrkQB7yLW8fr4KpPhyMZe6QNLMtPlrWKoXpiklNqcODa42VXjUOGk
-7P2bDCNFoMs4bB0vESP5oi9JpdxV8PG4iFiLtEJ4t6GwEKlC0qr6ki5+LKT6wvN9jf1d+A/SwU5UN/Th
-UQWaw28r/DKvP2A9R8VQXaTXjabvuul1tmYjjO7Vxpuu74sZsS/Eppt4a3EnVnhzdsJimvbCrZGGS/qB
-74pm68ZhiBQSqw6AG8CZ6wseqWa9OUyhKXmgOWCyKlQfcSI23WC7Pk3EJnaYKQly81x9ZE/TaS9zHXmm
-/2VqMeP+blMA1Eyn+1q2oyCgggG5sF7k5EjpZ+PqaRvCSQZAJIxdccQsUz69qV0BxFidtE5G/DL4qc61
-OKHjGxpjt7enGH7cNrb9c1eim7zAyf4L+anm1//hp82L34vaypxPyton5jxuDwzDfMDAnmRi463PIJUx
-B8HABHdn4syB05Q40xj6T02cPbvkSDSmlZzOUvKmFWsgLj+FoT7OlJ186CsF5+TNALnz2zalvhRrZQFa
-F/NLc8PAU77R6Z+UQZK9sLtgtNUxXVOvYMYrb5F0afqp7YlkFYWXuISTZnYS0ra0vE69YgpRc6wqQTmY
-birNyBQZObv98+On/8X+/tPrn17T8uwyjC7olgqZJkW9/DuAlMlQ0zkw2xROfqo0mXsmFkDRN7IJSYUx
-6cMHh1FO5BQPlcfFMjfgc1eb7JoFJ3jBvWHbHlfOxegST63gFHHVhcbd9Wafa2EzGi6xBlRkqKRd8wnr
-55itOpX6sZA19p3l0iKYqOWy027BjDbBta7TblmDemLbY067JTUv3UlOv2HdInUWvpa/4bUcaxO1RnPa
-7RYuQSa0EnHaLbCJJ2gZO+0W2oQTMg3RwSJvP4/V3edq2THRCxCnrez2iVpVFDgjqv0PP/o8WYTROud+
-kOvAHz49f2/acZsoXEZ83fXWGysbua688PnylXDDuchcRa9LhLN/CTdx2Dqcb33xgYMVLEWEPp13oAdF
-hIlpLCkWEcKPDe0DkpJcb0S4YPiJsgBvg7lYeIE0/3QihKwCkbHSnbOVYL902J6BE9tjnV/kM5uHImZB
-mLBAiDm10/856Mjqe6zzkvs+ywPoS6R77NJLViwIGY+W27UIkpjxYM6uwy2LV+HWn7OZYAAjFsk3Em5P
-nRG04oT0Pr9EHjoC4wwc41lfqq/fxNtZ7EbeBlgp8xi0IhHMRSSidtoaHZ07zjkaZLf/00tWb4D6/7T9
-L5umWe+WUvA8EtgjSXQNiiYJWRwIfsE4+yB2IiJHGfOCJGSv/fX37Czy3Is4EdE3liy8TZgfhhcx870L
-USQUa+4FzIuZRI5k45csi39hs23CVjxmQB775Uf6Trj8YovfT7HQAH5hXhAngs+Zt0By5iGK7iUPEim6
-hQKGi2wVAl4agva3OAz60TZwTG7TgzRHaEmOgAzj/3UUNeqE4vHT7/d77JLH6K1SHOMB2wbiaiPcRMz1
-wLIZ85YlkSfm0JduGOxElDAvgSceQB+qiHngdMQD6ttk5cUg8DNfrCc/ByY8SdZ0cKcR2tXVe191sKqi
-XWlwOGxaOFSnPUwNJo2bv569f8fOPiqlb8BbJWv/LJTy190F4VxoawLjA19wmJZnPHFX3YpEYh88X123
-EIQvVzIivNY5MerW7NGRCwP4pLBpt0w7Lq2786Jky/3pPFw/+Af9fhWuH6hJDc2XwEsmGj/0bHvi0tgc
-WIdz4RsbBDCaaSuhRT2J03ZaPF6iqrPqKPDHjKLwrA6fGFu02YqKwGN2Y/ld3n54e/b2+bu3//s1e17Q
-g4ZM4lShQz9tSdOSg927v8/4euaJIGFxwhPRlsuFgC9FhC7fG9mbBO0fnrgEru/vY3s4wckgWKzPPGKW
-MveoLhR9vimPsdQbJP3G/jFkGjtB0PJsZYohOykYH8TmY+VqWs9jXX2o3gKrwHQ1OdZNK869eAMD4PVi
-Idwk7io+OQiOOG17VOvoVd47akOfAWgZuw3vRRzzpTCFzJpz74WlxswQ09SgpMdoFhWSYrwsrM61psw3
-+GVyWpcfpqk2qrndnN1fwm8Kqgb1LhfKwY96/YNG/Lsw3HSlBDtpf9jdpJZ96JfH3qnDRHnjjRa1R15h
-A7Z9TH7g7SbPBdmotSuCNb5nv9OviXyBp1HTaeD1mzevX56x988/PP/h9adTWjsIhP/eHvrm/kMhDtau
-lMZZqgisgyZvIIBAHl3LZrSKMe7iuRDXoD5sPAzvsKzCTjJFzi/E9WftIpal+l78JoyEtwxSx43kJv2V
-OTPVewSCNyFS9QSmOzBq3PWcbIPviZyP22QZesHyxzBKuhfimgyeCX18G7jh2vho8Ec7ONYm2tjihZCk
-KOTtajeZ7s1e2pJW94JFWNAlUbilIw2/0yZbYO89xsJfTJi2o+XWG1REJjCACvyQE0EYSClQn/QLXeBU
-+Iv38TItIF9UaTacPgz3wjpeGqYl4Ji6tNJYeg3akVTiGMK0LgRQsx0wW1wBv/E7vFcpNBK+1KAxeQR2
-+sQ0+LApSWba1OKqLzWRbCuFEG9nDSGAFiuCsLjKABhXopCDJN0s2T1cU6ctQlpVWlqtRaD7wPLUtXdc
-s/EqgvlZ+Hyz6RrdYBqkXzpLySmPUAMZ7uZ2L5vq/rtu6CGJIG5lNJYuqAwcRDBXnYccdsxNdZRydY/J
-Ol5a5t9fX7/78fUnBury9Oz52es3P71j7z5+/PE0u/+tJyyzX/UFTvr63DpUZUlrzPoA2hypAHLFg7kv
-aLzXznoymME0ne0cP4VqQc/TBqslfg4i5aRYmBNowuMLMmcypYE9xcuH8tnajAeQffLi+Q8m+33BF91V
-aG/5alJl4I5puyHhsPSfsA5Upk0RgDBh8G96rlmH8BQtBmlVhueWM8EhEjYs5xD2LOKBuxIxnR7OAVrz
-DWhDnIJmfFkCbc03HQpagZITJmvAm0iICdSU7ml0ML798TUyir39cPYxb3voxivNvRd8iQbfC4lVarHE
-rzy8kABn8yVPViJSEJIIDH9V2yju0G5irgJ6nVU7xTUMgwV6iBY8OVsFZxr13QDTRkPCeHEOhT630YSQ
-m2XreTxh1UtsmXluO6stKX0ItzJIpX2CmDnpHZSLK5Wc+opJo9mUHZuTXvxyPUchyrCRhIU2RtQEPOPL
-PsiWZCDNfzgeJmqtgLw8AXh9+KnXENKcPGFJSE2rlnH4qNYQEXPDN9cDaKvEItL1qYST7ysz14WMGAF0
-cYhpdOWRe2hVDbljYz/dx5zrmfvslNuskJFYA8yaQmZa5/yp6DDdG8/hCgMYUS3rsz4M5ExbhJwa81hI
-j3u1RSvxSc+qmts39oWhlb2VxjimYX6bjX99RgW6V8ZQS8R6A/1Pn46NTA1ivdF2HYxHeCGR7sp7GFRl
-+KK2+W9S/XxlLQ03eN3Ry/W8nQ7i99ZoAVvsPd9gvHTh93g7w6Oops2AiXRN8jT9N5Z7x5TOQFy+tgUU
-uSW0Za5+wTKn3VypNFMpN/KWBERGdoVssC+X+xUgMDV6ngCsac7xQq8qbjRlfekzuAN45S3IQlfT1MdP
-Z+Zs5K6EewHruA98LboBl5M6bkFzU69nVqpZn3fnbCUiwVwOpo1/zWaChYHAlRwDQHPalArUdhQ5qq/D
-baQ2ZHB/YL31E2/ji35Ha17A+uNPZz98fPvhhxz6oblMBeCOco5Lz18BfceKzVpo4fVnuXBM+HJCKyOH
-BOo930ysdt5zTNqh25mkTWKUqFqRT3ALm8RIpRkBy0kiIQ8SZCDT2dm0e7B9bazk7gaUOW/Qm2b7MD5m
-OaPtCSlbeLupvOCBsM+7HJAxfV1A+jtefnr9/Oy1sm3aqfOzgWWsViepmWEEHEsFrdYd7hpPmtuLZqn1
-5Lf87IJqcH+fLSM+Y5zFYsMjnggWiYWIRODiiRFkgRcwnCe2gXTNzQTz1L6Mdutto0gEyWnqw9Nzssoh
-pNmjkZL3O9v3Lw+OmceemgDT65j39oyJ0Shx7n3uGtM5TnOyEWhYNTfM6HPoC6nSCztU9pUsVljEdH+8
-Mdb0PSkDP/704t3bl+z5j2/NPtSMzK5o4QOFhWRdPrqu0Q3Z2vv7zA0316rbkpBxVD144r66H3F/zQsY
-JzC6xNyIFm8ZHlrKoNLVDnRMrKC+4cPHhUUDzRBY6pkMJsJuJGAbhIafHTozqdwVxnpDIzVJ8cM9mMD4
-YjyY8e1vP7z8+L5IM3qmj+4eNWO8nXXkFIqa0WznfjVjBnJGM1L7WjMuvID7ZFg0XZVKE8moKUv15NIz
-r1TfFjA164aMRZC8EIswEm9pmGlFWz+p0wX2t1XKpqL6aIzbDaHwMeO4VPqFsizJQqeYTukrqvcsMlrL
-x9tZXsuTiz1OoMontZOvXtTCwDXAIoyyutfumqz6ld5zagPXiHb5c+9z6mfN9TJG1rP9fZheIuEL0EgU
-AxKzlfDnoKZwH6OdanjZA0aTx+lXqyezlBv2o82mrFZtzLNUT5O2eyczouWnlIoZuxCmyk2RIau88/6E
-icsYBZaqyEgMzmBpAr4iRudAGIs3ZT4YK7cSA0Z7e7HMdGBoJns1p+d+Cxk8RaP05z8yyFRExvwtDoMp
-RcI8mOOff1BUSarHmQ1WH1wpi5Ih319utZDGJcEgsONfMEgoXEgDC+pulytaStiLiMnPATynsSh6eBoj
-rGt9NqdeRpGJiMFN5nr2/X3pvo4pgBG9/jqKEZ96jvp0iltL+hs8YpwjmKF+OOM+zR5Zic0unp12y1wN
-2KsOp90yJ0R74oXGrNCWiR3p4uCRLPqwyb7SYVqTXGwcNqriLSbMzMyD1Em31Iwv43YLpvAJTuROu4W+
-2gm5bOlKeWTQmm+MK+KLgjlVFOf05Xr+AKuXTjuqaB+LHddCC2BFelLfYLedTcFYA7n43sJcieL7C7PF
-zjvfYLRgJoUSbuXDQFyveTC30zpWXqNCFdX9KfXE6xaUE76e/srMYrqXypKLWZBerudGlqaX6znmaKqq
-dbqd3aOcALQaOdEN3k5OoNr98AkgnW5nBp9Ot7M6Pj1Y0VGVhhZcJQYPUj1XT05atgnMqvipDMjnm2o+
-Pchqs3rA2RqN4DcGWw3tRw1N9ap807mprnhGu3+qFjzWVZGROG/ndmv0rq7yJx1nIWvSizIBlBk0khCz
-ZFpZW2hmNq6nHegIKn1BrXmR5seL5hfUDu77glpJx6WXrF7RtQ55JT0XC4cZVKlLvEyy1I2BRXRpFDfq
-JoWCSwPnYlGddzzNkmInaTQdh6rvwEyj7S5+c1xNebqnnqE6TRGQJ31UQPqoivQ0zmEz0iZdngnliWHM
-enUs+nhRz6GPF00ZVHx/8DZwHRZxkykHePQ+ZchBpSyUJaTRV4khhKk6+Hw7Xh005tWaY2dmLzqV5Dks
-mpkkjksvKIKymNZ9dpNyYNyfFg709HPxeGnGpNbzkURUtkSXsI/pEgC5qipKC17FOVU7TRt+O85LRBoz
-H4TmzbiU+Q6LXLMDDnMdcJDrAIdNRxMWuUZHHFZ3xGFpR+jvxaO7aU+1nh/orjpMu+pQ3tfAZBO614qv
-qK3iu6pvXlt2y64//MKuP7xl18NgenNY2fUOi+Zm9x/lun9c2v0Omx5MWDQ3xOCoWgyOasTgqFwMdIGD
-kgJNBaX1fKwl5SiVlKNUUo6op+XPA0NosjeMNOgzBSFzAckthe/oy4Xv6AuF7+iWwgeK5M1RrfDB5G8K
-4KOcAB7WCqDDpuMJi4QhiI+qBfFRjSA+qhPERxWCqEuMy0o0ltXW80MtrI9SYX2UCuujVFgfkajJn2NT
-bnNX6zTocAXjuPKSnWaA7mEIPPryIfDoC4fAo1sOAXRaFt6vkTd4HxcYvI/vZN9BvbsYwGQXqurNiFxE
-4VqtzzJUiihyGF72b5L5BEP6r2cipfKJQSUswprT+eROdApK5K+IK6IO1sIP5En2Br4PWfK4FNQdworL
-QGEMM3m7MgxX+yLTzSC7iJxuBsfNj0RRmrCK21xMmgovcsk7ZyR2PXXxrzagS+QLm1hwz2/AMyhWDqR8
-HMrNCZmhrj7NvCkVjn0JwXQzql5ZaHq6+kJcaBsrSn2EIFVCtSq2SFfbFzrlFHPKlp6AyfOmXDGFIbsu
-ruaJ2vkltuCylOc48ryOJVWLTARAf17cLz1qeNSPDwPIrM5iLWCLsRLlDpul5qijblwG2u7AtNLFock0
-+vPyPyXvNJgmgExQrnkf4S06wlhpQlc4zE2NLN0f1AEv762bShdyBd1Ef1799+8tA1gzcCbAuX0V7q0E
-wFhCShFw2NyQAlMOqI9ffX0RKV1ulYsI/Xn9P5JyB0mxQDYFaoIVmbuYbyuCxtIwFUKHCUsObUkkYXr9
-ZwpqLH7dYjCt6T6HmrGxm3OA5xXii1hv5hwUXRnfkGG5WxFzGzvFtxtquwKpk9dO2VeYXWedlLnLKK/I
-ZXEtL6KkVBctcp87ZY0qJpGbfdjrVewuKZvUjF0qWhSo3XkVLdVwzK8pMtOydMeVd20NOjeGUFSS124Z
-S4yyS7+ccm2ilkL22qKlAxFq1xfFwYkZCcqR16vqiPRsd6YjpptH6FBEV/SdBNhEoJIsyYD6/WUMnqWN
-3wpwP4ookx6tZMdLFqzd9kKoGw01s/pIQnnCtWBdVkFtqQhLrLS0lYk5yzZcKz48ScR6U7CdS36cs69M
-SPnAMNeo9th9fKfFR4aedB6qcpY97uWWKemk2WC+NNF+Uus6LZ4nSxFvVXmVeobbVGEjJaJ26K2Lr9RV
-4ebTzdB2zpB3Zljhnsn1faUMp+1YHpYaRZCJiCWVgPH7m4vlhHWEv34ItfehdofOh09KVaqTRvhOqucr
-J82GMalWqEiaOmDF1PGq8i646w19r8Rsuyy/psYPl9CX5hFMPPyIGj/hS7bHOhNMeFeVRiEJ5VU3OiTY
-TkKhfqkkLHbG53m4TWRYrv2yfxl5iejqLDktMHTkmeEwiENf9AH/9HvmMJh5vC/i8aq7NrIjZENx1zoj
-hhX/ihUnVN9pt/xwifGbfrjsFSTmRNexo/qHornNznKaXS1E3CzvNXkds75ZSKIbJ5GV0BdISTkQBnHX
-XUVgMFm13FVE9wVZxbcBVjDvLlphjvokOh98ln24mlfmpjLjkOozwtVd2bSa9xB3eTJpKJVXu1k4k0Ea
-3ZndRceTwQfO9tgsyzKXJ8CDuD63CZ5bSUK8T5Oq9P8VekG30+lZQOW1qqVdZxVe8013kfaYPCdJ3YCH
-qhKCb5+wg6Gjz3Q8fHjMZC+F2+TcwwSctcymohkOA9xCmugS5e4mEvOceFmY9oGgmrZ7fQNcCRMjsRNR
-LLqVbalCJTDwzmHg7sxmsI/7GmaHFJ5f9EVwzPb2PMnbGZ0jWDi1V2fCCPI+90D6LO7OcthFGewsNAwE
-rU6+b0SIn7HY5Hq2YhwsonCtR0Jfg+jZPYDdoiB/wRADyBnx2AiedAO7Y/V5j07HSIvNnuFhRZWHKmDf
-saGReQqr7J2QfqRN1oA9e3bChg7dsaY+pfxTu54mE1FlxQmPEodhTqAiyc0UyuqNhUWRSjvJnrIh+551
-OmxiQBk4LMjwxFuubgHgYab6PAo376pRAHaYIAogfKpBIgti4LAsIhs+BwDWTEZpiTAIuxuwh8bY6LF9
-Njo2ugYF4z1PVn1XeH4XavUQWk9fmicLIcA/2IC+ZnHQlBRNqRYcG6FiaIqzRcAqwKTztpFqI/LWRXoR
-39sNwytsuaB4JDY+d0V3///8HO/tOyyrPaEu8aCq8s/x3oO0spW+fh5376pPiBSpVqCN/WVGs/heIO4O
-XwGOfg7++Dn64+dAwTcTmuCtroWMNq+JtnlGl/QWVzLuUc5eeHadmVkbzQNkY9fkPzOmgV423Z68d0Bm
-71fniClPv2lN4SVQd0Lvmy/CT18ZYCFIWFumfxgk3ANbdjsr1LvqNHu8ndFVwbbqBn0c/9MDm60JgLzl
-LYJ5dX1psz/Dg5Hq6bvv8Ma0qO/zOHmbbcGo9tCoZbWLaIkM3fL89TsycoyKZNHLT09xDqzNOmuc1VZp
-czzjDgpPpdfQs21XiYTBMod56opmKRoyQ4JHhyrZCfNA0SFm9snFRiPak1ermePwbZB046zFZ7Bif595
-C8rMTHzBIvKSlN/N08DJ6yjqxupEJdVbiSt5whzApssllxz+A7y6LD4ffqbnq44Eag2cUc7MTO93Ibje
-Z32dSxeAPj1hLkB24VfnSYdu9u08z355o77w7JdFp2fm3zDuajEzS1lUm+k2Sn1QeDEt8txhw6Oeya2Y
-zYXrrbmvWPQMUEf8XPZUMculk8EPzYe9Tq+qM2xuDguN9iwvCQNq9Y8/EJGnzM0qniz55QJZwoFBdjbR
-EMtnK8MV+a2Lt0sEYaIT4MfkMOh8CwOF7bFvOzIh/tsg+TYv/m/8kKsBsL9PuY9AcL0EOoSDADssdBPu
-OyyM2MwLeHTNgu16JiKpJyxHAzBr//zn+GoWft7vJyIG4JmrIqBJs3swZTw7YXvxMSKx4HEiIroCmTAy
-rEO8EIx9X87foMcmdhvWxafph3vmMENWFrAYlNAXGiBN18uZZW0UrrFxd8VvvaiiOtZ62fCFSbfTRPmf
-nDb64dAhBj96TrtFfqOJ9B857RZ5W+iGHfzZo2ouTybSw+K0WyRNE+kdyRyUdtotcglQGn78Sffx4AJ/
-otwBUA4W9RP25qCLv3ryVaRfRT26tcf3EjqpDr+gGNCMb+AHQQe7G1/RT6oJ6xKEhr96iPuCisEPrAl2
-MVWEX/BKLZ/wrXpQHz7p8voJ29rwOba04cg0uU5QrxQEtRhR79P6YCdP0FJ36IGqq1/ypaysf0JNtM8n
-ZKYDhWBOT8iqRsBk4k6UGYw3OqMBO1FGLhTjwbW8WekaEOW+T4++j+gpw0zJDz5gMgFtclEX6Uf4qKwp
-/KQeenhAH80dfC9/Exdgtp/QpI+I4pCdKDVIuHuYzhD/ygun6ZX6VX1Wn/y1D1Th8kBGLNdX5Y4rYBEu
-dZCoVDUcpLIeEBarhvQ2aADnbVAJxQvmniviOjiyA2sgQZF7gKSkqA6UKlcFKxXWOmhpySp4alzUQVPl
-qmBx368Dw32/EkJwXQshuK6Ra1APDQQbilVDQt1TDwmLVUFCvVYHBwtVQUFlWQcFC1VSpdRwLV2qYB00
-UPVNgEG5OlhN4FTBUNNTHRxVrgZWE9JksRpIDaBUQdDzdh0cXbAOWhPSVLkqWFETrKI6jPwG2Pg1mKC9
-VKsUoVAlPWiK1RKEparggJVXBwXKVFIEtmMtRVCoCgpapbUmAxSqg+I3geJXcxcN6Xr2YrFKfNBKr0UI
-S1XBqcoUI4GU5YnRsksL1TrpJd9P5Uzs1kselaqcQ3EVVDuNYqkqOLTCqoNDpWroamJdVMIAi/blitt5
-Nh7AatKMq8sH+hgoOAzLq82CSsuPlp+1lh8VKzbZX3luoode9piNw7jrOkyeZ6QFpJGuLtoK4xotytaS
-HKeHcc2Dup9eIBLY+mzr+YkXZHM2cNfNJ15AyLshMFRFjO5G7ETF9rZa+vVm0J8OzYeRik476JYS7TBF
-JFYZ93q6lQM6X9efHlDQGKY22lF++RZ3XXwc0SMOh50sqPyFTCordSa1NMIM0bkQ17ElNnPPTSypOSi4
-LNCgpN1qvSGmpDDwLiZ5EeSFuIZFUkmQr45sxirT4USVl1G/yBcz5NrBi+HcpFRIETVs++vShX+aUCbL
-A226zpdRpxenX486v4AwGQ6dkidFdjApSbGi+xSBqthHeEHXoehL5e/KCDXrligQzRTpl6rQITDSobih
-Rob3pkYOLTVyVKxGhqYaGTZSI76pRob96YGhRh5RIGh/OjbVyKGtRo7ocU5Xukx3jwo0id9Uk6xFhLeP
-Zk4NgV16moiNw2ZhsqJfaPDST/hMN17gS/opEzx+ypxqjxOxOcV7L2WXm9Ib/S+QtkgmCjUO0OpadL9X
-XgLMdEjTjVStxvlyOjZhvX6sXg+s12N8/fjYzOwwLjprkh9WxYkT1fiabh6nz8MJyI/BwyzpT3oq3Lg4
-zUiaGYPSBx1b74/U+0Hu06HxSVFOZFb5yNeb7nRzSGj22FM2MKKv5TyLCdeAijQUfIexzJIo8/VI5gGv
-5ppk2yPjBfEtlUdESh6h0CzTPGu1ACGafAfpu3/IbPuAn35L+cUAN/1KjyEtfmWpM27Jv2cW/3JSVMGR
-nCTdSpZMzmRJuAMWj7JYjLupfkh7pg6RTC4RI5eHTp0/3aB4FZ/KMnRp29QVjrEPW0QJElE6NXeVVlP5
-CYYTW6elJ5q01tP4Qt1wR5eCAu5yqFH280REazH3eCJ0OnIqMzyuO4CGJ6BSUvMn0Kab4dBOJZJOjyNq
-SIl82pA5nIYqcwz8SEFZZ9XyJOBrTXTFiQhkcCQ2YZR8EusXGFefOWyOl9i5DvOXIcwoyzCpOiZjxuj3
-KUS9gG/W+rNrXrheaAp13gKFAfdZJOYPZz53L1gSCcG8YMcjjwcJ23mhzxMxd5jONd0xjCM1inLg1UWF
-+tEoXFCa0MFLo5dhwjrWDJLToGbFIvF+wWPPjR/oswZuz1at+bFvQSRk9juZYW+eWS2shvWwO813mZol
-VQvaLKhbVhlrR5mWi+qXAqD2fw5+pDT8JLp0Gf5si1nHn66SZBNP9veXXrLazvpuuN63Dsfse3G8FfGz
-HORhanSDvWx9tZ7MB+N3+vOmWpn26kakF7944VNS34L1iNQfB6l9Pd0Nx9PRpN2ah+z3NA/pgWVufwjn
-osja1oWtdFyEQNYiVxF09nQ1iwS/YIREYeKm4ibefXkb7dYNQ+uTLj40bsdSYX3lTI6938RfhV9wFCww
-1zmqWOVSZ1yw1hnfbrETlHpMjgoT+ls0OCxge2yIE8W4Px2ni5ahXLWMtfcjILsqu1AZZlcqCnbTxQqU
-r15A19EwkHyv7LalSIoO70VLkaCdlfbcUiSVnXZY0GmHt+u0moTDRf25KelPORm44XrDIzyQqklCvKZD
-OeurOycBEmKrDQu6G/Hdmbx2WQnQCL15GpyesnYjebTxUMtGq6XLkVNMm+laTkbaRteSshTJsYnB679r
-DBqkc4bmR+o455zyL2cIGJURcKAJGJcQMMoTcFBOwE3jhfl6JgryVV3YEig7/FH5AF6KxGFpLSOJ9KPq
-nGs6ljmfV80KI64igl/90055bft8Lhy2c5gUL7tw5bjCPHnmoHp8u0FV4vmSfq+bMj05olX28LHh9dmN
-HumXo/TlY/1Sis0FSYbUiTt6kgoxoqfHGfVoM6Spkvyg5nVFJL3oVCi8F9kqL+qrZGvUVUCb2otXdtIP
-09p4IncEZJc+aWJayDzhA+L2E7nqqlw40Ppc/NqFek45cRjve3cQBKMw1YgcWDdVc9AnYabX/yTmVbxd
-h5HIW3Nu6EvNLbk0xPsG/RBGTqriR0NDxZN2pc6clCdSNEg81rUAydo6dpUPzVr6JPBuK1NzN14bdl7y
-4OdOwtb8QjDO5uF25gtGK7wgnAsGzKPnbzq9um7xRRw34PSomNOjPKcbstpm26241rxzPuhm7oPTgVhi
-GZPXwL7GvH6XU0vv6vXSu3yduioF80V9mpOiSaYu5Qm2Jop3Ycsw6ZYTWbm6U5u95bZyjWqbo0+/lIJq
-Czqvr/O56+yEVdaNRJrHOa0vWUwTtUwBLTNAywTQ4qZm5SuCeCvV5acwTKoWwCNjAYwnRuBV3bT03XeM
-ylkrURh/PTvh0mG3Gesq5ijcMjlAtx39GKkfB+rHuHgOklQ1U3ZnkRCVfBrbfII3TWbvlBNlTt4CbpQV
-1dhS89OBSrMFD0Pj98j4fWD8Hje68eVuA7Wa0TPu88AV8xyf3dA3h6yRd8zOJGR82NlGfPrl+iJjBBuf
-dtkcZum33y5ym1/Gx10+J09BVsDCrzMr913us1uYca80I19GlspS/FQJVWWdVLqgT+zy1xeZ5539fD8j
-/Qr+v5O5X79GA7/B/3cFiSyNrRvrt7Gjc5zduzw2AwWO1W1wlZMG2gUiKF0gjA6tBcKomSPlfkdxPm3g
-fWnxQ6XFD5UWP1Ra/FDppiruRWI+r2Lekc28oy9gXpHt51q23zvBFyyCKe9rMO2TmCNfjhTLjhTLjhTL
-jpqwTKpd6aE1+BYJYbIOFvjwDt3gB0fTo9QNjs+HYCfLF/RmjJazekXvDsjjpF/S25H0Q6Wv6f1Q+aeM
-D/RloL5Yn1S/PmrkkM9UmR7copZRbXybauZCSF4GYfsW1b6MvV4pqz8uq18BoaWtOEKgqS2nSpdZdPZ/
-ah8B+uo4+zW3CV+M2fhWmI0bYmaiNsyhVo6bidz4VmwbN2ebhd0oj10Fehn8xrfCrzHzLAQPChCswtCs
-e1RYt93gVe7NTaHom26V/5H++5H+rsKvcAszI/HV6FcPEAkyJ6W3gjkugVkz7Ma3G3Y1Mn0H+c1szvyP
-5H6Z5FZ3UF1v3LSbqpZ7npq/2hxTOcM06eKvN7tUzy33pJwObqecDpoop4PbKaeDOyunwz9bOdVPrhWd
-UCJW9yXy/+5Zo3rSqBXX+1Hl/3dJYxnwStC3mmD/u6qRym67F77aj8VM/p9J8k+bJL/MDmqyqvrvujyo
-1PNfVyVVACmPlS3A6Ev9Tl9/7VGx8ihh8b9h1VG15ijr+Kp+v/Pi4r/x1FQxMZWwuOmgKBlVpdXLAs7z
-WNyP+3f8JcPwK019FRNf/TD8WpNe1ZT3n3cY/tea5iomuT9zGBY0XVax+IxIDkBx9fQsSfakQ1WEdS5y
-QUlGz9KtQ/txZDyan/R7/XJkVzywH8fGo/49Nm46L6Lk7oQUokqKfmg/1hBiF8485gkppOOOZOQRGtu0
-jW3yxvanlAy7fOZxbDwqMoqouE8iCtEc5z6VEmGXyTxKIgpoyISc3CbUpDwWQF6NbXRP/pWMM7+32INH
-aiP9kdpIf6Q20o1u1o22S6NkZM855SUMIlOShtkXo+wLEKwKqBT8YAqevLo+12n3GnKWEmMphNwbIqdK
-TizGNRKOrGSkYlHLIKM3bWWk0PyaUkX9o2WLDiqWnLCjoIv6CI58cKnrMDpb4uvjJQAjoQC7W5BoAzqu
-DihSZxxkBMn3dVEnstxERZdUha3OtrOZ34xSiWG36txn1y8632AXiXpAQ8VQMaW28lyCOndMEryrj+FE
-1S/j7OoLAqKTL+rV6sPr63An3vOrxmI23Yz0CSW5XGp4QCk9ol+CCR2UV7JYcDSrUsugDNHId+mP1Cky
-YtGvnFg0I3D0PpZpA0aP1Th/rMb5YzV7PFYjvO7QUiTW+dNheIKCks3IRDMWi58YUf72QS6qMR1OqNaN
-0Q9PMquu8q5IKzTNKSQT0gyMwx/WuvdgUHSY0lzq3muwYtqEvZ67l0asVjKLnFtFDQZhwlZ8J9iMzomE
-EQvSEyMx4/Ls/Sb0gqTTMw9R5g++HshsQNhpypcmP430p0H20zAnSQdSkqQIgigBCDpwAO3IAFe9nXVg
-ComCoZajB8PKxS18Hlqn1vPfR6WugvsORCXeDY3fI+P3gfE7Ne/NdabCZ1xyzWsuIYiKZSa27BP1+0Ck
-o0/R+voi21ZNhgvopl7zsge9XvZcbi6rwB10wFG5HB6Wy+G4oRweajk8ysnhuEoOx9VyOM7QSXKWfhwV
-CunXk8OBIYcDQw4HhhwOvpYcfhJzKYt3lcPDW8jhUa9GtY0HptyMLLl5Yn4aW58em5+G6adAXMpsyY0m
-eymtDoJ0EJ1sZxw86VktP6L0TfXHwrNALUAXlLPtkTVUdvrl0HImlJAizR41iMhikwxQhkXjfHlFFzsv
-8ifyx2ZuQplTbngrG/CejABTlCRqNBOOh4p9X+LHQDAD/aA8E3SXJjzLlpROLklSgPdWL1Thg9sUbmZg
-nvK1MLQrPFaeCUXpt05gw4uqKm+DWESJUYVeVFXZbuZGXkQrLQL3ExFlxWq7KT6Fp3v2IJ9vZHxwq5lr
-DHMQNt6tyjzSS6cdqGM0IQt0svNCsaVe1lVyqis7fXpTofAzibiyuezKWqXeMpN03ccpFZzKxmNSnWXU
-VB2ztY9TlcwNhzLF40FmYjgc6/fWrHB4oN8fWO9H+v3Qej/U7y2DZXzYKM8MMuFwlEsuMz4sWg8ZqV1k
-K0daJNvFJ/SsZC+Hh+nhNSmfR1XyWZAHsTo9Zam6yGWtLF3DA0vxX5w5D8f5PJbZvZsvxxGHlY3hLQRc
-IUwK/UjaAhX4V+UL2ozBONhihsyDnpmtdOHzJcnaIyNZqW2w0MdMktMxGDpQW702xOxxdqOZsMI5YHL3
-bJi1PP4yJh8eGkaKxWTj4CVRImea+6XFVojV1ChH4F1IyO2Q3gfy2QFZibw0D2+P+015RqnN+IkW8XGJ
-iD/Ji7i+DwW/ZhP5Dkpl/HDwX1bGSYso2v9rCnk9Df+JpbwW+ZuMgyTN0Xt4REI+N1PhagE/PDKy4JKt
-O38lc6Thx6EB6ZEh24ZcPzLlOifTkokG7ON2scBULKoyCUG6BjQauFbf1W3/iCAHoGZp4qmFQ3YVYGT2
-T039ymzBxqqC9ltkLrtiA437l/w6Llz0GRYVYiBz1Kt+rk7SGCx9kYRBSe46gpehpZwvMneduo+hIh9N
-JVbbwCvCKBk6LBk1wUam7q9CNBk5LBnWYaIv+cmgsonE3HOh57C3vTDg0XW69uPzeVEC/WIhaRkJMQ24
-Jv+/vw3bCfIkXVve9I6bcozP55VrH4PYupy1QSKiWLhJs34clacOxy4oSahNq5XHOb9miS8C0zTiGicZ
-2Umz60Vhw6PESwoFMyMNt5KD6ebwib2qPyLn4eETc/V2RKu9o0FmtXc01O8Hx02FyU6unZnDYP66zSDf
-HA17RmptQFWu9yf1DUFto/Lt2h31rAtOjhsp3DQ9O8g65qBv7OxQDoBKb0dj3Wtcpmqk4Ynj0I1r75mx
-M83LcWHmmT86sFWMlBbyMRwd2KJSzXWoJpeQRxgxk+YmlaOnnFftVktSdFydD0V68Krzp97/dFrpNmvc
-k3NvsWg6XdXLpVQXucyrSUMtR8wkLZdVcvRnpAhq7+97a0yZThu+/VN3JeZbX0Rsf7/wVjG5MXzmrc3k
-V11ADYsH4WX5rWUKeD/AFy+8YO4Fy66G4nLfn3H3Au/0Vg/dOmDx1nWFmHdf8UT0g/Cyi/FkSJ5mYSwS
-vDRgx/1p15O/HJbw+KL+AvFb4K0v3fdA8Rutdi1W5WUg11TEL083/DLoIo5omTpMYQ605dJsAWTm+oJH
-ulFv3jtmKseeddN5EF5OoLOcdsvkDV1HbbzopfdCF0gDiMEDo3hp10PBvgm3AhxQrRKx20Z2FG7R0a7Y
-EDtsE4WuiGMRm/s5MIHqMumezqDwnqDirj/j8cUDJVlpI8WbNEN1oRxNwXiRElDxSWS0uzfPmnwHxQGa
-NifkDCnJL7gVr1aDDx3mzU1u9dJkXym+0GrUYPhi4f+fvXfvbttGGsb/tj4F0pNfKD1R5EtuXbluTxLL
-bdrEzmM73d03m9eFRFhiTZEsSdlxG3/338EMrryApCPn2X3Ps6cbiyQwGMwMBoPBYNCXuz6ODmiG63u3
-JMol5fUupPl5nC7vZyzyT+MTFp4PiWT5WbItwkTrtR/wjEb+6YJFQ82BodG5hiUeYE19/+31yWpa1uhn
-yc6QZDnNmSltxqVW5vVOj+0ls3Wdlb7LypUHHO7oweaMjcl693hBphwSIXYAnw4b71o5S56Z96YU78MQ
-N85pJKuC3DrjU7zfD2+QAuOSWyLlRt0MDaK3QRgGGZvFkZ9VZF2TEax1NgpAWWoYZI9su/ShLLO1tUX+
-qwmYq8VoBTuOz+rANEFYxKvUVR9bcFHup3iVukhGNmsbdlKT84S3fQvYEmkn9JNGZtdAlyR1QHfZODDR
-RfFVfe044prtbTZvnt8qlE3T3QGFqqOczufiziehQJ43KhDXVFg90iFcm4XhKbZmUz1YMvc1GdgA+2PF
-ohnrq+mhOhwHVj5LKudE69IP3nh5q1CDKgErTDkvkkT7Z63ZFi6S4OCxO/roktqDTuDgizmtFpp3TVal
-a8JKHo12PFEINU2OBrOGdTI+aKNbs9U0m6VBIhwj1YNCknkUMnre93hFzwFTXUC5U8pBbaeeFsINOaaV
-aTMmU0dWaaEeqm41t2jaqyKhQu6W8QEDl1aYnJ+zWZ7VawVOarymz7xMBJ1Ff5NWhbpnsMrvdJZs76Ah
-eJZsb9uuge3H1v1zlTfSqjBH0z6Aa5wsB9D2Y+OU0M6Y1I7l8hgoYPukPJoR/E55ADbYrBdBCOuhss+I
-919ejCjvuzPxMJeLYsQIEj4dlG/y4a87k/CZTcIGc14jJPB4NjrTPrgdCXGnsqfyNsEq+ajo6Vmy/bzQ
-S3FbyvNuvSwZdboxITXfatNuQ7/atvv1bV2/InalZ58yAQ2HmdPod45sPgLNSy//xpt6VuvSget61d2L
-cIUjf1CXcKrLKdWT7oQ4lra9NVKKre7CzMfGhZnFC54FJV3+OUFapy7cKLlJt7ybgc0AWGQJf6ZxvQv/
-xD4FWR5Ec7WfuP03Y3HERyZvT33Z2W3aGCgpDuOyNnb1zvYJtJpD6xalps43uEOsZsSsjyfybjPd72yV
-fHuP+26XgFoZK7oPLTrb9oCkseuqQWhgcsnS6zZzr5AGKF+46aFp+mXVbRS1jyurdcn26Pfq2Qc4mmpT
-wG+iRbaavq2JID5Ldrat803iwMp2s+hqjMTJ0x2p/C2JeFy8AKCvTtnujM62schAK0H+T4P1xcDCeEsj
-ymX4A9phH8ke+Su5mI+JZ12L6eEd4eNaA2pIlM0ydps0vKRY84zdSyJgzZh42Wrqgbp9S5Oxgzc3u5VO
-6n2aF9frNeeb+BKpaS0O0NoAaoKh1vNOZGpX5ABDrOgdEHDpXVffp9dH539n7MINRBVzQmqE4aBFHOWL
-BlLwIvUQrhltoAQvUV//PI2XYhvDAUOWqoeTx81QsIwbFzxe0owNlquHhd6JmgUgROO7qFG/GqxvcR+X
-a3JK4I91gfS8+MkqMoP7V5GzMM2tkwC5q/BBGhiFD9LAVfh0sTIKny5WrsJ/t254+3v9DW8AeWWS43Tl
-pMbb2KTG29hJjX02MwnNZq7Ch/GlebFgfOkqfDQz6Xw0c9L5BJYPiikscRV+AbeIy8IvVnNX4Z9XoVH4
-51XoLhxZhZ2kewvqStGZXjtxTlIT5yR1Q04tyM7CB2xqiiibOjtIrQ5S6GBlaTZdze/DOd16BaLP8u7W
-wwjjeQOEMJ6bG8ewZT6U+8cv0pReqye0SsUDXFY2JOJSfff28s9ZHJW2l3ubm+TV0fGE7E9eHe1Pjk/M
-/V1hxi+zubmfC3f3IfW+89ks9lmK93xLMwNqwZslN06W2RwvvjFAn9Mg7AiXV3EDxUrv0mAZ8A73c9oB
-fk7rAL6Ko5wGEUs5wKF4mXaCPIQbBeHDWAKoae1wFYYi4rA9baJViLSBimMM56lp4CBgod8/5//eojMe
-VIRn+DUmCKl9B19HPvvUD/i/t2kfKsIz/BoThNS+/V/Y9a+cPO9okGb97ghcsOtHQF+vVaNLmryl0TWc
-kMQiWYfGljR5tKTRNRJ8Fc3G5NxoNlPtZqWGxbpYxVHchtgCRmVPh3CzJsIeE/mrhEYcsaPz/i26DhU9
-d2e59gLF9frwR3L08ufJq9MTm/bbQPhts12DIx/87Y+DEr92sM6Q+Dv19fjXirqPdd0h8R+76/MSFTCe
-2DCGxH/SDIeXqoD1tAxrSPyn7eDxkhUwn1XDHBL/WXu4vHQF7Of1sIfEf94NPq9R0ca37jaGxP+2ezu8
-lmhLSeWE/DR5886eVOOLCu0uVujxhSdCMYUKJ4XBNKW+Mb1dJ0zGn1YAS2RBb0h40TExKtTDt9RzxLKc
-+e/SeBqyZVbVilDHxFLGJGVZPi7UrmjLmoqa2xJTD7EmnrZtfc1+HYHOSxzghXIjssxY/aoAVzKUiGkR
-EWkPVdQ8lfkVBHSAwi3EWRzl7BNfnXhn3m5P3jOvioFLXB5CEW9HYE8JbzkeMNEyZh0N8SafEjbL+crb
-Iw+Jqn+dMPS3PSR9hQGk6fDID8TzyJh4hOZQSXwfyAoema5yEkRZzqhP5nE+hmK/Z8U+jnBEQDCfQBOZ
-OVZ3y/N2H+4R74OJHRQiD4n30UMvr/hA9lQRzn78BmlEzSZQNstNjMwmoNAtgKO0jNV+kZIVXVu+Qgjn
-cUr6EDFJ9sjWLgnId6rSKGTRPF/skuDhw4EZqiQLfAg+kr0q6eFfzBwdit2vSUojEkR5TPIFI+dxGMZX
-nPuyond7to//Ff0rMoiYjX6Pg6jv/SvyLB7DYBjXoUXJb7zAb9KC+BKELJleZnO5oW8NPkMuSxoaVS9v
-cBX57DyImN/b2PiBeOqRozcmP58cHY4yABKcX/elXFszjNFkuoqOItGmtNEIVlfj/vcsjnZ7G3l6jUP8
-d1wTQksJTTPWFxXg5siNGQUFwIRCqN42wMXn/Uma9r0fg0vGTU8SRJc0DHyAjBRjoyXLMjpnArYAlq4i
-jS1HpzBfW981KWFbHle9e7wMJBMslNNpFPtYlGswZHR84Q2A5tV9ObqQNUSLnB313TbHCtYblHtRhSHv
-idSy4pPQsvqC/Gkch9bF9TDxx+eGGEEZRiMPpfQHw8jgz2PbbvAoeclhajL1tKIUpwWD80Iz93gz0Wo5
-ZalX2EQpAI/I6yg3gIO2kDAf7Ww/ef7k28fPnjwn3wnQDx6IH98R4+uDBwT7QD6TrQF00zg3pxpXPS00
-FGQHQRTkTHzl4O4JeP8f2R60gNKud4p052FM8yY+SQK2ZNMBwKxoDAdpU2uiVF1rghx8SqXRjNc9Ecpi
-w67AJ0UBpQJJrFSFJXglLBw1cvybgZgUfgc50MdRbgXX4mYzBjdVqTDIDNG+V+47ONkwkMUl3eQNB1Qh
-3RAGIjbqK91vvOLoMAihjjVBAyw9LT96tEsMPFyabmTrEz0/804aOu+eofPUfK87KGzjoWhnYEzxzV16
-FUeZpS2HQAedT8pgi/iguEI50dfBlggL1jIG7oW26Cw/AQpkj0TsCmH0QxYNykwKWfRvwRvT/gLc0Vwz
-GVBF+WoGQodhA+znE+w8RXobPFrS66kYXx26a50qqJt+xeCvP3ltTcJSLdTV0ImZehVWOZzL549kTxqB
-hj1ePd/F09/ZLPfI58/E1lz8zT1cuJJAGHRthBQBkqsgXxAq0InokvnkN24i4YuHxPutTpDbChtA+tjM
-BPKDBDkuLciVwPUq1lEwLGDFpMkJz7vrGMy0ajDLmR1a/d4ezs16O4yjORPDfUQOGfMF/pzwau0Hi8x8
-wVJGaMpIHIXXUMBsC8qxKE8Dln0pn6Dh7nyynBllPmkX9fiWwl3DurYSXkeWC9P33nGmvGDXeqzdTgVf
-sOvbKWEcF3BwtkINw5KcBvWBE7BLN8KT0CaUkUGkjQ60gSmXtzi0KVo55xZLGIpd7C2oAU2j7ArOqikF
-uYpmaqaUznfju3xVni6F00EWKDkdmpmXfQg+WmLUhWdYzJorZd/wR7/MgQLdsJxlrYjdkLXNhfcKcyF+
-EtNcEaY6umthXmEQG94iiBNN0xiY9uHjrj5Wskzq2ChcgbwIHmq5J492NvANapxtWRiVmLbXmmnwB5Ef
-Jats0Tf13MaG6AI2ul1ioPLCIgTLKFCeIl1WUXmZWQaE3MwuLC/s0uj66W1uksl/v3/x5vXpP42VP/tj
-RcMgv8ZoT77g5xShQIip7VfJU7DdeNehjJKRqeEUkJGLNMxkYelBoCXfgYl+Tecp7wRig86ssuPB9g0U
-l7ulFWndsgy7V786pCM9D02lJVtewBVXDkUrtXIKFE1oZughOpU/awxHhZ2wHgE7/P3gQXuIhu2kIAoD
-CiDi7y4Qbf2NEsPFTogM/1mesKXc2KOFE3dSajczGs5qFaHqjVRQokPqsUufDN3VCbWC99WutK/r7Jv7
-0HplqIro1SGnJ/8IxCx8rhuKlVMgLhxh2vtLnBe8x0q4wWQ3NZ4GaqulyLkb032Kg0qqn8OCS5hFHB4Y
-ilH+hl2ysGLDsMrNPARLELe/RM2CRzPgH3gXqt3bdmHE4whsw4JBIhkRT38ne+SvG70ZZZUrTUUyTFwY
-XnZhPCURT3//wD+Pzrb4Ehl/wlRRtLUKtbctD3U8/b2Q5wG7A2kd8Odg2Nsw3O/wxXgWn+XrwbDX29DR
-PmMj8mcoPyirelwMa1JFVFwSwC28M9o4wO1SVQaeBwrMa9zhVJ/hGaovabINH/gPXmFJk50xOXjMX+yI
-F4/H5OAJf/FYvHgyJgdP+Ysn4sXTMTl4xl88FS+ejcnBc/7imXjxfEwOvuUvnosX347Jwd/4i281nlbc
-zrgqmIfjLFQToC1+cxB82htD1NmwtyFmxbEMcBv2NkDvjDFYhYOR0j1Wcj6UbEeWRcgsfAWLozFx+Vjy
-WHhYVCVuyY9dVn4e2xVw+IytwcRxlcpkrNSsTi9SFQ74cxZHZxMAct/p3uMFRxrZ3SZg0pXWCA361QhO
-OEtawENaNAKExW0LcJzDjcC4deQGJiWnERTYUmuCFUTrgpS5Q+e7AUPCtiF+I6hf0UhUEbzwXBfDCxVx
-Vm3Bfq2Hd5uACVO1GZrhHkF7dNAIW+gtN3RRqBEY13luSLxEIxihKt2QRKFGYCH989pOZ7BYRRdWfrad
-ivxsFTSCcEFeeegubp5ILJ+5rM2jZoJAdv7azPd0FbUEdtJiiBlmRCNUPmG6ofESbcA8bwTzvA2YZ41g
-nrUB87QRzNM2YJ40gnnSBszjRjCP24DZaQSz0wZMI5TtRihg9bjhQJEW6FxPmX1Bh1ji2UO7UWkqM3Yo
-V/Y6ernNWJU7E40NvcYtiyYdKvaNGsEd4IZSk36vSN8KTWS6l+58vOrgfTpsxFvBFIGTmeOErlm5nT/a
-6LxlizdrQDy23iQqbrUuUta4EoE2TAwXlacBWgmZNHfXKu1y56uLtIfFfKdrwCPEMIcuaHD7iuINrU5U
-mjRRX8WY2rnTKhLIFptvkXoUMq71qlKzQY7eEpmK4kZqd6s1tXSSiGJuN8ge34qaLRYFJQMTnbKDFuqx
-K2Rx82QD3OY1UQkwOJmbIbdZjJRgy/inRujC7WafAoUw0ZplBViOXBxO5An2ojpfRbMhOUu2rLRCmNHS
-yGZgirmVyFmksJFJDLgocZB9eLc9EHcQ1OVZkNgdBGmW1yO3U5NwsQ1yApvHo7MtPa4wP2Mb5NTJfzM9
-AyYmMlM7PtEhnGfJU3DM3Tignov+WjmbDaDPMVGzCRQv2Smz+TJI8xUNz/x4ef9X/L0fL/G05v2rlCa7
-XSv8PcgXByGdZ862hEBrCJUJgU9O//lmcvbL5J9kj3jw4CE+k18nh6fyAzyIDy9OT4/le/7bfH14Yn45
-OzzxBIphPOM4zMgeEfEDfjxbLVmUoydWxyuTH/SnMXhxe71N43+E/Pr6+PT9izdk/+gtOTzan5wQYhbo
-Gd7inH3K+0bgsiGPeJDF4yXwqBj7lI9FkLM6FKYARbFfOgV6sKOzBp/TWY7HaS8Cn/+wzC5eGzc26XxI
-ymV1BmC7RVcd5e1O5zQK/oQFtfx9QGd5pnDi4CEFE12yLKFwxbuqNVJvRSleK7NKwJvdnjjusQhCPwWX
-AuwC43Z+NmORT6M8exWvYEbYMpzviHCt2/0CcjHLUuhvL0F8uAeARqUPnz+TLdgVl4jhDu9F4MNbAdZs
-QLjkq5pQMOTeTZXEcMaUjuQCjcZIvKGBzVjB5G8VrceaGcOK7o5LJC1L5AW7Zv6hEMv/FRApIGfb/w4y
-Asx59G8iKbNVlsdLQ0UtY5+FQxIsk1BJSZGrBQnRPC53FuF7VZ2Dlsaiwd7GBm9yDA2X0VzSROQIHYLy
-q1PYUESSdc7SscgXBWSDzTT+bzWxtslD0uefa4SkjBW4BIWdQ9N5NsQ3dcjxb+YJa16vt7HBa46xvnQz
-jonyNiLWxgmewvG7kP553T+PhoSazQrMoiH5QD8OSSGBvdzqjfrUmF4skDsIUwaTVIAdTmsBvzBq18B/
-rEoMyay+ieGsvhEbhDFN9jY3ycELOKNtHIitll0p4nogKWkH80LqIVmhVhGxKIfEaKqgTqF3wfgHKDC6
-YNcQhxCcw84zBDEoo+nzZ2K9ExaT8VoZXmrbHtL3raYHAmlAHiIQebW/MNOi/P4BcUgZDX/hJSRSOpzb
-qL6nwIpogA3IGWwiruxDG5v8OmS1uKgSQq0WMRD0VkWcwWFQimOqSsubdBCJD/BHbMyL39tGAYGDUd0I
-8bJpAfBqKeEp+fEULcwZs9DLahizkGbZIV0aMGDS5K8LBC0zS1jOqrBtOIvIPwMNEf4nyz8kHh6fKyJK
-EFOJkNVmRa+k+FsjYVtEkBk6sTgZVM1pSuEWbPx3x0fvJsenrycn5MXhPgyV1y/fn7psfWBfdb6TC3Y9
-1pJcl91Eg0rSOGFpfm1eslYFUtxh4wZG8zwNpqucNUGTOmIIChDGb9cmDk/6hpZr0x7qH0eTQkZ180NL
-8C1eQkBRAbc4ApSGJIZEkFlt8hDASSk/C6NIXJNpoiTAjRVcvF2wmEOlCiUIbphcsijPCrGUIwFMBL6J
-JyPeSpUYZXmcvEvjhM4pALVqlL5+/kx01SRlvHFxZX+hpv2xXeiWayu8IV6uaIK9k6KPJo8cCYpE8gWf
-5QBzc7oypm5Zzo5/gjygCoTg79B8h8cjDJ628KPaqAoQSso21EFnU8EcTw73J8f12iRlkc/S/iVfYQ0J
-sORQGqUyShY+Qi4CK1QWjUB9FA2LoUmrpzb1kuwRAQjMonIEuYkK1DDxMSIehWU8NkyGQxN+BDERMm4b
-Cuu24REDouX0jNWhfzjXiAaMXogZSQAzD4PIk5+qnQ/Stldw4fmjPAyKj7gys4vIOG3dH/ld9UifC8lW
-UxjZx3EMGfNIYZFAEpoyvhRQJCTaaPHjpWhB0Fw0NLTAiotMseyIyybAOuPYnKXsHBFUxc2QfVHJZBr7
-ZJ/1lZ6y0SxlNGen7BNgKYWNfbLO58ASc1zGX3DcUM2cGQXYk5AtORFO+oXiQy0V8qhcddW+LodMokkS
-XqP9LZAxhFWCBYtAVCi4DLCAfIFFqkJhi6vwwmkQyRyaJCzyX/HCfcFSWRPCZPU4qjivXWaWsaz/X5rf
-juZwQWFHsgsHQy3Jg2USjiwtCQ4HhN2JOhVYiCMZhenjxbt3b/6JK9D6OaShaWyUTyjFk2nii1p4yhAx
-c3FgZNW5YNd2Nh1l6mIWE8DjBFY3GhHzOFQxTYya0436wl6qpKEDlDRqDUgv8jxtiYhhohYBHJ60A2Ee
-H4H5WNTCBc49lQzCPEVkFdkjeuUqToAZbVj3WdfXEzUq0rtUMgeXospzId6fiKWwHGlQiqNRlB9ZHfpj
-VraXunKZWYGQg9vwU+NGw/AnGvmhOM5nzIoL+Vp4Bsp4SlBK0EUVsmeCVathcyhgVT0WSidTC6tjNUAk
-hngNJ/STr2BZxFJcoAkchPYooEGMTDulVb5oX3WiBgO7o0t6gViIdvrVA0tpV9+/Bc7iu4mxxEZ8GgXR
-eWzK7A2u5ysZarGnmBSvvju8CdR3aiVWKmne0YkYmWUAS+C3KQvuiJR0FWHTegGELSm5wQWDvnbr6MJm
-llwU7iEY8aiOp9es+YypEdorfu8XTqPXLwAtKPbnfvFctMiMpHJUnG0Zc/4q5bbvRFm+e3pcm465YrmC
-R06Z9MVyahWxYR8VlxU4bSXr7WObGmtxjZeR4ElpXSG1qpJlo4jlQzn1iSpeauRD8LHQjmgI/62gVqnD
-uJhQfERfQ2+jJLJCdIz9E7PIbln/FuZIyh8rTQXxpWQqwHulOW+pHV+YrqtBlfZQUxHLX1T5ueqnvNIk
-HmUvanupvhUPa4kP1hRhOmXhpJa5g2kRCb7q46FfSqWS9601yWr9dib9ijbo/uuDg3rj0w/Oz7V3C0mW
-zxZMnd/mBSDAALdXxNchbpVKLw6+LLmJLtg7/kUkDpUZmGlOi069YmZlI30oN01oTsdQb6gNFWMnjL9V
-Gqpih8zubVVnoGHnWWnhtwZT5hRcHYSCz0PsXU/Fy6l42dvY3CQvaRDyKf86XpF0JTIDchwY1wfQv4zE
-57ATmY3I62USBiwj+YJCThCAkeXpapavUkYWNCOzBY3mzCdZMI+C82BGozy8JjTySZB7GYninFzFKSR7
-4e2MRIcAOXAgnmo3lOg9+lI0s7zkUcr8lF55imXTgXEtv6DE5iY5jK/IFSMXUXyFOE/jfIGdgWQm+YKR
-jC4ZdHSkHWImEiVfGFD4RToH82FE03mm/C5T8Xpqv+Z6HWoUMy1B2xwKHFLeU4eUyYMHvBJ/LlaTTi1e
-k5d69MiY1SQ8XgmSIEkIH4KP9iTNSxoVp9KDR7UvSlNT1FOFppaLT3ir3tmjcsMYl8LZNxV/dWExSAVK
-6rXMKvM97GRLHOulQexWS2HQgAYlJ2SNm3Fzk8xpvmCpyGQrL6ZT/NZ3vlHTOsCBpb5Ni984NIzSFA5v
-BfBEOQENkgvmyo9Ol6UGrbIIKD+mQrfKk2n05QNVF43pNm13piyBZC+Ukh5Nszcn9T7NqS42LXV6+qWd
-nro6bTDpw1R1elrT6anV6Wl1p83e1HR6c5P8vMpyMhVqVmtWTHsIulWI2oicLoIMYkpQxTIBQetXXnjB
-iAiOhLhBQ+WO5ECSRHrwQHNPjCjUsNa7ViOsRt8WdIRAeLZgswveXdEzULXfSF37TRHNH8g9br9cBRk7
-ZueQo6Cv5VJiOyBjW6zVh1YaQgTbKPxl5YGNOmcQgXvjID6eTFkIUwczFYJWbCfSrT5Vv+wZmzwk26Y7
-rtJhLjKbsE9yC01l123sFgR9qk5hxTrOlDDQ/l/DEoinl0G8yjjMYEbzOM3Igl4yJWTKBljGKSMZS3np
-gqTSUBTPSLaaLXDqLUz/QU6EqTEyaGBmd8G9Rm0E4wf1vGa5VbFj+1wE9gAzdHlS9Kpy+prOZ8PI1vXu
-lQ3tRhyhtkZRAbNkk6PzSnifq23Daikrevr/l9P/CZz+hXPtNuw2dxiQ0Hw+EQTFOMn/OVp+dVKqxSKR
-3R+J1eRUowMFWrUp40Nlo1izSd3qVFg0y1ZLnNpJEM3iJZ9h4HRbYTWCE7MRxlOaHjldCx4GY4OLFpPL
-qagPWBWANEBCHWdQRnVCndOj/SPyWtw5EJ8T2NKDjkC+WJhA0fYaoiJI4iwLpiHjSuB3bgzlLMtJcM6B
-YVrJ/wqy/5LLQbK/gmNNnBZ0BmYOkHlIfMykDw3QOQ3gOh9YwoOttLlJlrEPK050cvpBymZ5eC3sqit6
-PcT2QDkBsjQMY1F8RP4ulNUP9mJcSDNGbtKczeP0Wu9nBOfnYiUdxvEF4cyQ+pBjB34VGmYGm+gvwt9l
-suWXYpAiaMRfioGU1lszEtN+iftMxajL8gj9wKt9HJIp/sDtjSEAs1ZlMK6M/VENyIiVhNcC0J5sT6++
-ZnGUB5H0yPdgEkGvE5+K+GQRRMBfzhcYzTIxVF9SbKrzP1WjYGIAKElVI/lW5QeD1YEsSGV1I1e4vP5A
-p+fewE2yvgXWii8FoJ5XX9piqfVFslWBMS9EUND+IkbgmsDa2oLHADNVl9yIncQiG0AkZQYHAUhdVi/f
-T+V7yTdYxMwYBqANSRYTP448mPDTa0Kn8YpbAVK6f9U57H6V6e2BqaD4cVuTI1ckhSaSzJcmY91+xYRc
-CE6LRal3lXJiCSqC0B4j6vsgglm+Oj83hu1UCaGRs6w/VYO5jWhOZZv4q6xoUZ2U/IHaEHgHbvohmcof
-yihI4zh/rXyEwNVXOjJCVDRiI5DBRpFpqYgA8wYhvCoeF0EI+HX6qnyYZHOTHLz+8f3xhBy9PyWvD8jp
-T5PjCXlxPCGvD08mx6cn5OiYHE/eHv364s2JTPDI4X0PYFv4ALn6eBRSOJatCDBElB8hEHGzhtrahG/f
-tWsAA0Bs2LqnWRjMGMAbiFagz+9evD7+++uTCXq1J79Ojv95+tPrwx/J5M3JRNBU5mJQcAU1l0EkqK2x
-JD/g0xiedqsnfKxozfYc7MOHcigj+0w+Co+gXsvCB6ODEFdUYXSKda0EVX0ApS7c5JfJPyf7LRz+BQO4
-i9xDsJHtjJQHunBihtMSZHOT7AezXNzVQCYRXACD3MlYmou6vBzk5iJ/CbaNyWuOAZ6hGGNFcgO8B8/V
-RByugIg9MhYNDMklOE/H5Fe5h2wA82lOyZicEeXB/9LB+yVjF+u+FkK6JYsbL2rFWJ1BEdW/QxwePJDV
-raEH7VhCidX0DGTi92EqP8qqYPUQahxfmeKrqfGKKjcrHpiAYsoLyd/1bK/VBbvOyJILUK9on3HwStMb
-Q8wYRsIfhH9MWbQWbnoQHdYe4hJBca+NZqbmQ5VJBVYoXXDbfBtW3Sxns1yINJjFplk6UpR8E8cXL6Da
-nuT8Q7It2KeoZpaamqVQNUlqqWKWCUoP8Xa1IrM5CJ2GGUoJvvKf8pCM+ia5iR+31cc49N/KpZ5klwSm
-KMTRm1ajNxXoFcXNRm+q0ZsW0Zsa6E2L6EXsSqKnpclGDzmYXdGEUGDTtERQGEjWk4L74IEiQUsJFdg6
-pZSLDUTtCuVZLMz7oqR9KuZIoUC7SrqJLc7tzS1T3Yvq0SU+N48wXnzHGGT6uWqcYRcVh6p5UsmHZppO
-G2l6O1520zi86HZreoilHK2UWKdctue0g8sdJMugnSJaB239RfK03Ui/YVGyXGNf60pDmaydyF8urutk
-VCdBv4vBLwNghbnPaE5WCaHRNechDSJuTGKAAVxpoymPMRCKnDWmUo357jKSigZOC2bDnQQlZrfjk2WS
-SHuVRf5rZLlOh1Bl8elycCRTPXz+LKIGHFZfK2GEnk0hOF9H3xgtQUendgcgr7kBxgg/4IgJWS68FR4j
-ow9lN3bT+jVOfdiUNNaXMHRFnbHdOT0cs7FECl5qHMYGPpBWa1C3EHv104vDHycn5OD46K1rVcb58e7o
-5PTg9T/gZlwWLv/+7OUbb9dcsTXzBSPBokodIRdu8lS6AKFCojc3ScQuWUoyxiKSL4IMoumm7DxOWc/c
-UhAQKvkgoQOB5YXGHAFM4HSJuQsuZcoFGfAlkAWFBEFepjsOnWpSPoDDfxG7IuI0FqjdiOwduoPyZDJA
-KoYvqb5e0UxoEp8wmoYBS4eE4iLlHpIAzzer+0SwtKfUSScUJbkQHPEAlBydFaE+SlWLQ9bI58tytA9+
-1xrHeFZLCv2eExz+kWxT48KAiQNAd0CxpZaYC5oRGqaM+lyImBRf5pM4JUBjTlt/lYTBjOaM07eNfJOH
-cqDUSnrBt9esqM1hE1hejrsdLObGWYXPTW+BqZrATkuJgqzhFhluUNpSb4xDCdQ1DoPCMATAzbzmA0ex
-t93IEVrBVBudx4FgmTUczHEgR0AXUncaAc3saD88pOKpGx2txLhidEgiVJ1K29+vzYoG/5EJnS2gCHjV
-AOeIfAMgvyE0y4J5BNfZEZhjIXIqpZcszWg4Iq9zgpFWcZrTKIedyJgsgyhYBn8yEq9SMkvpVUhiPpKM
-rcj9o7ew25EvWMawAywjfRrG0RztPbEVWbKd4nMVtgXW4YCELCerjGQXQULyeDWDeCMW5UHKOHfzlEHo
-rdgmhb4G50Y0q7yQL4pVQDS8HFkn93x/H6ORzYNqhUgl+1C4UQUv26qrtgX/XVbaivbJ7sL+928CxG+c
-C1EcPWLLJBcxwoKkQTRLGc0YWcZRnMdRMKNheD2q7Jgby4AL49WQLIL5othVc+yJCugWN72b8EFe5KiM
-W31PURhfFbWmiLTGmjLaWgcbnKoARxm6qhZt9fwSsbMIEyLNLRIXTnCV2pHGpmpJAFInUPU5UfmNVR+v
-qQz51WiNVKh9y7DeJk5a0cI1zDQPrjiJII2iNdFAGCe698UgFyhQH98CBNPGTgGFMplLBG6gsDwytDYa
-b9wUKf3FtJSuWb4cUxur5VE54IuufsWgHJDvAddiMEtg7K82JbpolXDClVLiGwTxjRmL35TlQd4SVseb
-rBxSCqwhD8m2ZE998ob65AqXr+qPzJuH6gEl4yisfmnfbfk77kP+Tr7ToFX80e/W0fowvhLeHQMTjoZa
-7f/+UX+O2Kf8TXxF9kSv+5eOHUfjQkxe+rs9oq6Pwx/f7UmA1tCAsxkFFuiefvj941BgVzGnCHjlUfJl
-Umwc9TNluXCsLwTKCBRKuVaChmwP/+ZCoFKf/a8crE8OVMR56UhTvkjjK4h7maRpnPa9bBGvQl8sJYXl
-zMhvHMJvfCHwG1T+TXg6wwCC8ILMG7jzTLx7cfrqp0lTpgkxFfXTOM73pTaMQ19kgHZar2re15Mh189b
-dlInA7JYAZmGV9d29TFDE32QIAuUqDqoOCbbWKcu1NPuqxkBUmvcbhh5rOVsbc3ePbVlKT3LCsW+WU9G
-wMqDuTbMvT2TzHp21u9AbK+0FWAk2LIYVE0tPVGKCF4joZW2vK15XkU2W7d0KojH8LEAV9jaBRPGnF1l
-MPK4LktLoa4JeOBOqiROeIzts7pJSGdsn+a0v6UtABSAbrC1AqiT3wpa2F03TSfT7q1PKuWwhmsrjdRR
-/YKpDapOnqdvgmKl0bKZi6m0inbqTUmdVpHRjEMbm0c+C7jKlaN1YtM+gY3JhhRLaZbDm0ErPES42tgI
-OZCzdwGTKkUiS3dPiiRr6oCxUTkvUhsSGomRWq2r9holCRlbR2Arct9asNyom8KFm1Uv1IqYmC7se2tB
-6EY59OSisH5YmgvCxvEufQB12g++FtWqBaGYwAoOl5T4JE2PZRKOqvQ1HsRQqsTMPFQyRI6pOJROI7KK
-LqL4Shzmv2fYGhWzQ1GXV+Y/xCky1cvSMptkRnk1F9blU9ztWd51UaFSC1W63F0VHOrU2MI0eoJBKPCT
-y6Sv5mDckTRkEOYSFEJRQ00pAyvlpZqpawleKT7qpER5RPeMwAem9sYzkcY9BZd7Cf5E7W/iQMBxKd+Z
-QiuBw/EL7ZdoPZZ6Os4nKwaGQtFAbXhX6VN717homIkojz1ZzLDMpMrBL1rpgBgK74m9YwG6s2ckTebo
-9eAgs5BWayOibMpo/YSNvoTdon5kSoOx8vsgUAOl93FgB89bnDSPe6XixF9Z9KvmFl58YKdi9g170CGB
-BQkpC4dcJpR38KtHZim9hpDNQlbDfXHZy0FK55DecFAjGbrBJuHQJVvIB8fKIuF6paS3sWErBN6ecu2/
-Oz768fjF2xMMGEjSeJ7SpdzRwqc+BNgexnDhj7gISRRU9wBV1fgny2SVQuYWUeo8pPNXvKSditm81cZn
-09X87ylN5GUR1mX16u6bkM73VbZd+2ScLCOPti1jfxWyQ0gIDdDfspxi4hgrx9QMESN7xEDTbMkENShl
-nLJAVx9fEi6CKE6XNDxh+Srp8z4OSRWqAh1nOipoEwG92DFJZyEjKNm6GbClbypuWMhymgczycxLa3KO
-8Jq62kvO3udBmI3wIq6KexHLpbYq7j58F9L8PE6XZ6+W/v0ojhhkWjbuhxBSOuxytdVQZA0K8rHsBST+
-DtjV2Lokgoh2oOO75IaXWiU+zfEy/aqiAt4uuYF7xrLVNJulgUwjXlWjrscnqyn0eJfw1fegr/fqDt68
-+JG8+mny6pfJ8Yl5B4sxiGvF2BiFChtOiiEMgmxYMEjMWQK1QE26KmlYRkFuHWBj3FZ8K7Oi8ZLe6YKR
-3zzy0ECLPCTeb+KZ+DHDM+oRYz42O/pXBPrxIfFeR0Ee0DD4k5Egx43dKCY0nYOGxyD663hFhJtsyggN
-Q5Kx/J6H9nJKs0XfRMu2quwRYKm5OyKqus/PkcuxTMYN70XKoKd5eg3HcmOSRYxeEEoOwTeI+cXAQp+E
-yx/IaRrMLrKcpfcENYGcORxMEI7CMldGSxpEJMiIPK0IFP+tODv8RqarHPb6Yd/lN6EzEJPfRkaD7zOm
-qv/GZ0o4rSzyXPkxJiegUS4Y7+HZSDfTtLilLFuFebt8jRY3z8U8htxBMDXpGg1RlwXPtgaNUq+4FGgJ
-zhuGAhAbllfsU8JmuRgP5nAgeRown8OdxdElN04wqQONONfFdQrAnVSu1yCeJEnjaciW439FCpjqzG0G
-iqO0tOrsUaDt2oilP52+fSMI9Z0fXGLy2L1vEur7QTR/FLLzfLzNlrvffC87/t1iR5Y6j6P80RUL5ot8
-jHPt7jfffzf9/ihOsnvfbU6/JyfxkuF0dcWinFylEBSyYDDFpXBG/jpepUAxIZuj7zYXO7q1JGUupMhD
-m+e8ymaSMg1g0w8uv/eEqVpcS5t1taInh0fHb1+8ISeT0/fvrGv72tgTRdsLy3zw2HLKfO+jefEkvBJr
-ChwIyCLhFotsj5e6mKboKonKnrEbHc9UYyfICW+khwXce2/aZOCVsBQq3HSAQWj8G87K+tmad/EyEaDZ
-MVjTLBV9hbJ83lcmNJd8SajzVRhms5SxyKaWft83iXUHvZSXVI6msX/9Jd21AFX3+6YkYKq29koMCdaq
-mO/k3Qeig28hO7pxr5URYVB/YYJ1KF6uuACesdFD9gCLvtWSLF66XqFcv7gXaDhdzDWaOb+IzvKlzUnO
-ksR0pnBchqSxmRs1rE9OJ+/eTY5xPZa+OOB6T5gDKftjxbL8RRQsIffFQcpnhHulS5h+qC7Z4ytGxZEZ
-DcMpnV1wYzNj+WmwZPEqV6+HZHtra4tskmdbg11IQmAt4W7VT7k44AsHzgPv8OjsePLf7ycnp55w181W
-aSo4VIalXHqfcmArJPSWWKHUvz4/ZMxnfl8Il9xXgibtFPVm65iboah3cVXlvdfTq5/SKyJJxOdZ8lAU
-ehdC1FvKkjjNcQ7NY/LdIs+TbLy5OQ/yxWo6msXLTRYuH3ENsCmWIo/8eLkZZNmKZd+P0BAamNnj300O
-918f/ljANX1x0Le7PJBXjgniTv5xevzCoK+1K2+OFEXPgd6515laIe+OZMtQVRZlq91zWix0xertV5Hl
-WG0qfjLitMwkSYIWdp/GdodtabIy+9jZGowVLErx0lBHEJeFIPdsoNrEq6Y9Xy0rZIpc2wVPsSA02cML
-Ka2Bvz95+f7H0mxurOm7T+Yd5yhgfJzEq/xY7Ln58aykdr/6TNbPZmkchqc0u+gr9AYD1wQHVFMzlOXy
-sec6Bc+Y9oyfryPj4WiVV1oCFSaTQeCy3fQ/RuZKs2it1BUeyFsT1XIvVeFl2BbVlDmZLRjHJx1F8OJl
-EHFzvF+e9zQzfLgVXDUy8uOZXOr58cxaaS+zOQZVzUZzlov7cLKX16/krYp9D6gzZ+mjLPDZlKaPRIb3
-zBt82PqodiE5JMPlyB9HostxwhWEfvETLF6sUFnZi34TFbLVbMaY3292sA0qLwGv57Vp9xkcR2ZLPisW
-d7cJaZJMbmsW3sKexOO8kJUMDVw5O2h02lqZNElsK9OuO7S65jIyBSATsDC8hL9dmmGioKR+Q3tGV+NL
-lob0utBX/rbc2deR3V0jLQevYHe5AKKlVS3hqB5fpfyz/ys0T/bgGR/6ZqeGCgMpegMTtWqi6SpWK0Pi
-xN0gnhzpBerhlG01uW+8soioRoh1wY05tKwhp/SgcRKo3pwRJxOU0PSNS6kMspivTdyN9zcl7dyiVx27
-JFcH3B7ctW4d2u1gut2DF6Mg2xfMOUrgDLPpnLOyityz9L5eIqzSVA5ykz7K3o0TFkEbfw8iP77qV3YK
-DeCSzVtAA5KHwDolj5WBQuJzAUceCNuvmqZ62qYvo1tjyaMVb24fO+33Wttd0IgD27X7wacm3hmhSWWf
-7J7It+WpvyVtL93LzCuyR/62JbMgLcgeefxMPn0iewQNtNFV4OcL8ohciU/X+tMCJl7yiMjcSr5Giisj
-+DHi2PY9b0jg/wBuzyMPyRV5SLwhwoAXC3gRsnN8/ASPeZzA07WMXNCigPAN6pnE05iMNCF7G5Z4GHvd
-u7r2KA9yuMXLk2OEPCr49s3S3FDGi75GS5rOA66GvS2vpohwf6oylV6Xy9qJwQZZ7XAxSpXuovIu2LUf
-X0WecaE73rVEpIbAS4yWLId0Pg8eIAKjq0Uww5Djb3eUFhAclslGRykLY+r31XJPw9PVH3+rqrPCvUT9
-v8gsj9Mx8d4nnjhT7rhUqa6FJ1stWtjnVGjVBh4c1776MM6Y9J8Uxcm6esyUQVELAw0E2crcWUWcft4Q
-G+GlTRiO8oXb+Z1oidarrlerQMBBwle8jKDhTWF4Sg0HmU+LWq5SyVWHw2xukpdvjl79gjkzzQ1bp6kT
-0mvL2pE6L5hHcarMjtf41DdqDGRSuDCeXYiBegj4y9HKC5+H8ZVMFoe9O5VxvCYu+tIMBVKVMzl2UzGD
-WzM3XOrFVyHa1LRnsYhdvdQYQ9HR2RZswUFikzJSGKOuK+3pjpIf7E6NTdTlyk8R6N6eBUkNPXm4ou9V
-SJo3lKwYKlLjUNTViuJu1jEb1LnMp1W9MRaRknWG3Jm6WXMWXXf1JbhULALfZ5FnnHvDux+qaWqFzDoB
-W1ggYEMYDfhSBcpk1sj07dJ1kYqilyydWhStYoI+bdDX74yjBqI/48os7e/oKmNWGK5sHLMHOBBYxhle
-25aZkbliV+92IGkYKog1NKmDIS5SlLMvXTpOqugiFWFvFrM/lFr62Ne1IcxcNZynK1bGu05rVfkPzNsa
-9TSpL6GRpoCe49tN+gXrHKiRnYAnRh6ANVpBF41HPn8ufbpaMBZ62kY3TtCOcprOGfh0jG1U1DUiXfVf
-ashBEKd0MCFoFi4fCfpI/9Ijn+U0CDPor0TYGJalPPcSNkA0iM3r32sCIHZ4+YgtxV0jfMeVk7XmCAgD
-+NnUaCF75ENvw5uFweyC29f+NFS/l/EqUylI8GmVqA/CDsQHFuWgYfEpZFRUggQOsM3PP8ITpg7G3zMa
-zVioHlVbSRxwgLIJ8YiNiwdOUfNxlZs1FT7iWWCknkUKEfko8ehteH5K5wph/iD/Crzxp4DOHyQi/Ldq
-xk/jBMBdsGtEW1vO/GeSsiyDAkGUrKAtzBEC787j2Srj76bhKvV6H3eRa0ohwQaH5OBoFkczmvfFeBiq
-McMVYU9f1YcJZET+mJx9yseE/zvsbeDphTHBv8PexpImEGS3pMlg2OttxNGYHDzux9Fg2NuAGWeM8RjD
-3kaSxglL82uoIB94OSrvPoQv6sn6dHgCgI3nATb/zoRqPAM6If0TP/AfvAL/uwOQ4Jd89XhMDp7Aq8f8
-FRz3xYsGDx731ROAFHEnYxmAMlSvVJTVuBSVC8QwgjTHdsxmj9tlN3zgAfeagiTvVwT9KsUN2w1gnOvw
-y2qAwvWs4Y5KaHeJ1zRqAQq7vFddurPmXnQMNu2IsxIKK7LWjZiq07INkMcO8KF8B9g7HWHvdIDdEXRL
-yOKg05G6hfmvwrQ2xhtYhsSe08TrtsyNIy7MupW2PYmj1g2QPa6WjNW+ts+GRNxOjUtsOQAe97vhbZiU
-w66U1SiIFXerXmXiUvq25BKX1reCbWj2Di0YtVq2Y0wwHdoxanVt5zattNerXQmWdKPWkibduNESbo5e
-9LaAc3B8t4IcdVPZUXttrdVFYWDDzcvmUC4rLVpWWNObLkNPbrEKhxl/9NpqO2NcyfryFYdRALLIl+H9
-n/g/FVZIZ8tltwl6B6D1sKZsDuHL7yoMjbNkC5gDdZNt3l6ytVsR3FBCra/zRAf5mFsosDpznI05i5Ps
-g3fP+zjEksn2CLxr+CiJ/+Gjh8dSzFMsUEJjvczmQwxdQsnSTguJRhdENja4eZVsy4hVYoCXJSzsxKkk
-/Igncnh12GzsbdQeqOHU3pEItz1Yo6ItqqwzzRSXKrI1Vj0Mp9opqKd6KE4VU1BFDpmNfVtx2w30PV7A
-G9QDyBjS3AVDlHGBieilE0REL13VaZoHs4JVUAQhyjjBZIHfAISXcIFYbDvrL7adlXfclXeclR+7Kz92
-Vn7irvzEWfmpu/JTZ+Vn7srPnJUZhcNSLgBQxAXkPI7zBiBYxCk6vp+yLHMLD5ZxgVnSIDpzAuElXBAS
-Z+3ESc0GSjoJkKTukZOkznEDzvk/VnHuhqKLuYDFoRNIHLoqr9yVV87KYeCsHAauyr67Zd/Zsp+7K+fO
-yr67su8cP8F81cB8LNIAZEaTxqlEF3N2J3DPJn7gnk3co9hVlS2dddnSOZfmcBTNOZVCESeQJQ3dcgQl
-nCDc1V1VZ0HDAOYFXAD+cNb+w8n1c7fs+OdOoaHTqVv/8QIuAHmwdPedF3ASL26wPngBFwD+3lX/kjo7
-kNGle/bgBVwALqZuPXIxdSqSbDV1N7+auqs3YL9yIu/W3E7F7UbbifTKPdm4bYX0osFUSC9cANLV1G38
-8wJOAO45J3XOOambW6mTWVPfza6p72aYHzdUj52SltCGFU9CnbqmQdO49cxVQ+0rd/Ugcuv3IHJqeDzP
-5NCyzDm3BEv3BBcsnbNbcA6HIJ0QoIh7kp4yv2GenjKnqsLDQG4rE4o4TWZadD2VjGZewqnxA5+5RRlK
-OOe9lR+4QUAJ53iIV+nMzRUs4pw+Uzpz6zMo4ZxAaXRJ3dKNRdxqNV80qNV84ewInTa4IqCEuyPNpnAL
-O3gWh/M0bpgWZaEGQE0wnBRpdDPlTX6mXFxn6gDBSzhB8FW8GwQv4ZbRBgF1Vm7A3438oqHzbg9Humzw
-b6RL9+qMhX7G8oa1GRZyro/ZnEVuOmARJxA6bZiEoIR7EkxWecM0mKycXZmu8rxhiGIRt/s0bJpHsIhz
-SqY5DYOswQEgCjlntSRv1heyUAOgJvUVN2qvnH3Kacrcq3FZyLksYddz5sYGizi7tMqbRAaLuJ1k8bzR
-TSgLOScp1uSyhBJuQw7iBxuMOYwxdK66lkuaXjesvKCMu0PRKsgb3CeyUBOgRiDeoH7H8eyF3ADPOmz3
-1AUAVIJt3pav2sNvBXoWR3xICCroLTFI/VQb6uTGckg8A6w3xDxSzo0yE46f0vlc2ERrQ0gB7YwOF6Ak
-hUPXa8NGwuyMTE6n8nIJjUxUQMRKhdiAS29jg5uXcKGhV5FE8SXNgll2P49P8jSI5v1o0BrX2YKmaAOs
-T6wQZGeyiZN6TZh0JRyCbUM2bK01vnjocN3oAtQ7wJZbg1Ru666N1xzqC9wI7spuYdysDRWwg7oisQwi
-eVHJGsfqMojeANQ1D9Yl/XQX2Eqoa8Y2C/5ka0WUA1wzjmIRtdbx0FkIZ3GYrZVQHOCaCZXGV+vFkQNc
-/1wWcklma57NEGh33cL8gK4TFQDYGY0UltVrQyKF4x8djUWaM7GRtj5bUcDsjEyymvqY4GttuAiQtxr4
-uOuw3rGf0OgOhv+6MRUw1z5HRsE5W69pIWF2l7WmMOqKkOt2cyvQxQi/LQQORxC6j6XsswAY49kSb8w0
-ymH1ylGhP2dxdDaJZrHPBD590WB16H/1EAhpVphY6LIjq2xicJ0tD1p6QxJhav+Wy0h/3agEflccZGaP
-taIBQLtiQmczlmUX7NrCBpaMnYd+ASM+/hH8L+y6SgPgwL9/nsbLVwuailbbzzhB+qUKoERDP0hv4SaJ
-kz/jiK0fGQG4+7KLQjTSerHhRW8x+0U5i/K1IyPgdvc/5Hky+WMFYWbrxUhBvhW3VnTO7oRjHHBnjLJ0
-tnZksnTWGQ8arl9yaHibKR7yCa0dFwG3Oz5xlrP1Kz8E2xmbiyBaP2k40NvI7Z2oPgG3Oz408qfxp/Xj
-g3BvQx/Mw7R28vhx99GdXyfsbO3IcKidUcFLVtaNCsDobk7gEb9f7wQlE3h3tRPSGVvEoX8XukfD7j5N
-zGYsuYOZAsDeEptX69lzqUHq1S23X9azOVCB1K12B+gqj2fxMglZwVUzjeNwLasPowFYgHDA5AfixZFH
-xsSLz8+91tiyaIYpg9ZMPAH3Fq7HfBGvf+JFsJ2xiehy/aSJ6G18fzTPWbp+IRdwO+NzHqd3sNhYhgdx
-d025pOs3Rpb002225NaPR9CdN1nOEqe/s7MplLPEG5Ko/QZzSpO1k4ID7UyLVcaWd4DLKmNvb4FNtqB3
-oGsB6i2cGHHqZ3fgw+Bguy+32PWdzEMC7i0W6cH8DkwKDrU7p4J8/YSBk2+dHU14r/ia1X7Kzm8RqZTO
-78AQRbDdVzfxFaT2fbH+8SRB34pXd+I3kIC72zDBHWDDgd5ihqRp/oVbghWWuUiMuNZdQUwYsH65EnC7
-k24W38UUxqF2xoUvfJp2EtWq6473EXk7uMTrsIeIWY6bVokdqDBUmZNFzztuaTA/yEuxsV+MkgA+EcC7
-4pYlLAzhtuP1oqXhdsWIZtfRbL3IAMiuePjsvOC1+mI8AGRnDvHh66+ZOwCzM2dWeZyE9HrNzBFQbzOq
-0mKM3FqGUwqBct2wCeNCmPkXY8Ih3kJm6aqwBbYOqeVAO8sto8uQZWvmj4TaWVrg7rw1DyMBtDtlQrx0
-dM2UQai3GdWQ9Xn9w1omk+4mw0HGJ7I1U0dC7YrNchXmQbLuSVtC7YpNFF/SMCgFKn4xPlH8q4DbFaOU
-UT+OwjXPCRzqURRed8fmj1WQrlt2JNSu2ATZGtxjBVyC7Da+MbnQXfOY0svnjlyCGyzWziWE2nlmCGmW
-vSkeOwmDLDfRaQOEr31KKyAzbu33OIhgreMRWMlu1KT45NjcX9JkWPUR7vS8fx6kWY7fLUrp+udBmLN0
-SCqrZ2wWR/6QQDcHHU5vODMyF1M3O05e4gUC9y/Y9StMhVTuBawA9yFtNJ5KR5cjL++VumUWDqLcsUQU
-LaM36pUyC4AVDqCUUxsuk8G0peMxOiO2xtqzxZ+3x5iO1C6G5ZS9AG94SSMHqriya+jEQkh2q77JeICv
-0TMRuHDrfokQ4caelfK1d8xD3thAu0ztdSnSW4BvB7MFoIOSzbbM5u08bQoGeNaEldbbcDJI3DbM23Br
-CwX8ZbhK14Ef3ESyfvROVtNlUClJ5XuUxYXavY3WosmHVDEDd56u2M2gNWpO2j1upJ2ZuR8cqAC0QMgm
-uqyf7K9Kvia81e02kqHvrdlwTx98LlWXRLedFNr26LVIMLKOHokredbcoV9bHApWeLyNVxk7WuXrGLpw
-JZO4H2nNcoRoXrJ0fXjCbUp3g+gbRi/Z2jBVl1zdBaqTKF8jUcV9VXeD6vtkbXiukrtCcj++itaGJt7j
-tXZE9+PVNGSvwqCgmm+Jqr7Jbf3Tx7pwvBsE7+rOjlK7eSItlJ/yPCncyoq3z04OXx3tvz78kbw43Cf7
-E3wwbmRksLn2Pg3kAT3jKkbx7fj1q3iZxBGL8r4y0c1bHfFWnwKMPL3GBUX1jQxv6fWU3f95leV9Ub2i
-GXHf8Izms0WfDZrhHcb5Aq8WvZHX755MDvfJ8eS/309OTs0bNONTml30U/bHimX5kCx5/XciE5NJhGqL
-8GS2YP4qZOkoghcvg8gPonlfMWBGw3BKZxfGDbifFuLWWvKPt284w46x8b64MTSOMG22xKL/aZEWEYOS
-nxZpxWXKLE0htK9wl/KGxKTf1JNzGoT6duRDll/F6cUEoJKbAV4nDf9Wt58HS5zl14XBqQDYpvHqe6R1
-y3gv6THLkjjKGFJW8H7EPiVslo9S8fE0PmbZKsx1o70NlGa8l4UjAHfCy/oY+qrhrdJQ338Kl4yAABOQ
-YPMOUnJLwryk/vs09IaEr7qNVhWhLHGSUmb2GYplLPJtSkxjH++pL13GOiB/EaD8NE65wBKpk0w90EqC
-+dAKzknfegs3PcsLh2EIe9ZohwHdq+G9yp9Wfyn8PbySFHOZcDWzgn3yyjthS3NBiRspvTpJ6FVU6MPZ
-Vh+ATa9zlo3FRbBcMJk/VO8nIGzMl9/zOKchyNnARdFKJsKNvrJoxvKfIOKkn9AgFdTjBMtYLmob30dn
-W0OCP7YHgro1LkRYZSjoWlhEfAuvzZtRwweDDOsG13XCRIWrIF+8SpnPojygsIMr6xS+cIHkTJSfhaIx
-ZIZPI57RZVHCACnrnG2V7iTWwwDEX18gTfpwwzVvxrpCerJM8uuXsX+N1zojjSMf774tXyqNbt9i+QJP
-vFcYwfHoFGMpoeWzLQSpWsC32zUNHcTpcp/mtAI1C5wxpMQceTw5eXd0eDIx76ev1pgFFSnvpZcfyB7J
-Y7POQDIPUMlpvsrId2Rna4t8/kweb22R7/aI/qTGPAIYiTSylnjBJUkbbWdnVJyGw/Il9U+gLe23lKDl
-FHPTU53CbfRit/vyxUCLJn9vSOTRhec0V0qISiNTQEJe3fQ2WMgR+wpUeUevcRI1yIKYKIdumVDWneQ2
-4w0TireEDB6Tv8gMbsDVTB8SccO1+ZJ3iNzwloWaGZOEwoXn8ATiNGf5izCUjcovA7g+bJWGY4tC74/f
-4Eke/9r+0Nu4sXWu1U5Kr8RPJes6XrBA5v1glt9nXDlIsbhnVjelQcAwhA3fvKMBQNb1RlkSBnnf+9dq
-a2vLh38h96l9lbtRW1/i/ujRLjHMT13GrvAh+Lgr70EXqQn11xG8OjpHBB5T/u/OFiAAPcQa35MtNZVy
-OJgXwoCSraYiDcjWEFtBVcQLy0OUlcUR/kOyg2bJhia+dXOppr+8a+6CXRvmQBz6v6pdV3E3unxXMY+o
-O9GbFy+I/UPiDYlHHhIFVCpbvEu9JRyscjMkxtwK+ya9XklyhOqe/OPd5NXp0bGpunHOxXlHjclK3W0M
-UHOGHhPIswu6oFhvXFKHpRG0pAmaObAcGgp83A1W2AnVrSueKiVMlNzN4uiSpTnzj/V8VGPdmzrcuuaw
-wCIsjUYQ9qbUiOKSYsrLo/1/mvSAQA+a5n3+j9Yk52LCFqtCOX/jevBqEYSMYA0U0XtcRD989IwxnWCU
-NRYC22ZDAh3RJOFTP/8mrD3+A40HqKArbu9aMqYWGpZFgcsNhTP2VvMTF9RwqyT+5Hq4ShLHlfKJ166j
-2MhL1/EJbmSXFBxrYnLw0nkx1n6MYW9D+SPG2jVRexk6eFH4avzsdZSzNKLy0seC7waZL01v0ji1F/aM
-eGl0NfSUdmGit4UoB9urM1KEkAJom9agrm7qQqJLfTumV8Ly5F18XnJPDclsSPwhYUNyPiR2gqi/cKUL
-Tio1LU+HBCbbGRqtY6gsOsaGRBjeYw6tYNePyfymNdoKZwNd0+MnN5tFQSGt9KbSX1cCjwQ2rqrFF16b
-uuYgMSBYY6cNHL1OaOM4FK0YiwvR4yHhptq0NWXVasbsvVrhtEH8J3kpY1uksUINwnXt3VdDuZDtuzBc
-VLFazO8rXeGGpIo5IFVosgagFTWa4P+cFQ7fmze5V4QmubDjqkgDKsyhtbOg6Q7HxhGqutFdrw2lE6n2
-at0q7Mo0c3WgDv9qfSxm8KOLfglFxwC5r+aZl+W7TIoaWhath5aZg7ulGqiH9nsWRwJWpwzTjsYw8UGS
-hMEMdiI2eRuuPWhxKgcHyZBsyWjEBqYb2qadWqqHVXkZbI12qoeSqpmlzQRUDyeJcUp9bAko+IK5uKmR
-UiOqJYT62k6Q06737ujkFBfoellsRlnhJ5iOecPwhJPyVLBYGx1udaNUDFZSs7hr1wWLlib5cwoujGYj
-5T6eNy3MIkDBNdDux8ktSecU4/8EmioVaxG1afIwSAmULBOyno4WGdtSsZmIYs7pdSJeLe0apidcxHS5
-1N9txiO8Idxoz5djLsTdmGV4o1JhnKC77jR+i8606qVKdWAyR+w+zXPOjyHaATas4nFOm0bSMT9okkXD
-Qjp4UrPysA1GECQ6JNJ7ODUWHnrB0WDr3tfezQ5GqukS7WJZ31ce5ubFiuGMbrFcuW9uyRrWurVT66h+
-qnZF/irssN44e/M+DVt1Re9JNvQDx/E79F10W+m8g/PfnfiRma250ZGrj/gijOf38V8xho8PXj1+/Phv
-xRgLQqQbJqDhKeYx7/cI/G/z//b/5f/15GbwiP/d0X9Pxd9x4W//h/G/Rvz345vB4IfNHiF8PYRNcIV3
-uFoenZ9jejBsZPP//p/P/Q8PH320Ad2364KeFU6mqyDy46vRPs1Z3/g9en/6qr8FZtw2/Cv+Gwx2Cdnc
-JNt/29p6sd8jCGuUsfz96auDVRj+k9G0vyVK8SI9QpRTiKOIk57ht8sG4gsitxRuKEG/EfvEZv1ssCuK
-gBt9qaso6GjWjyZp2v9mFcGR6jxG5z3B295oRgTXvlHgbnpG09eMpvCwRx4uP2x/3DXRiqN8ob7tWN98
-ek10vcfWt0W8MmA+sWEG0Spn8ttT6xuexZDfntn1MjbTMJ9/JJ8/k61d2ROuZzLhMu8vP2x9FDsAqs+c
-wpb4fE0a53/+FEMEOFBYYG5+fhtEish2x/C7kvii9A5Gc5ZzkfkzjhiW6g/IQ9nif5FnW/D0Nohki3a3
-ji76qsNF4Fw0hkIIHvEh4dPrITB3KNn4SCE3JPIkDefUQAAV9LgZYn9woWSMA18T3Nh78vsJ9YckMrkB
-8gFXUX7zDXlIVHdUhxLq21ss/IW4DuYRrypFgjzkTyVGaTD9b7a2tra+GRKfU9cc4wNe+ZtH36i2yUMi
-axjl33KSAR+221VAXkLZ06aynLGZKDxuxATY1Lr4CbBQFv8/3xS4x9XeGP8MewS839qZbM4XYjjcl0rX
-MZmMxGZhPYxIXhHvAgKFHFBQAzdAwUJVHXpLg+h+krI8v36XBlG+T3N6UsgMlAV/Wq6HvssnPlsmUGFI
-trfk/wawh0h+KDktjOwuZ3GSffAePvQ+tkgAAy2QTauJz2QL1l7ejy+9ARmTfjc07xpHA8G33RG8U+wM
-1C4QtXW1ApIDgF9e5yzzrGOIJTEUx2v+Dpqa7BFve+E1lD2NebksTxldBtG8vjiktNh5Qv6rdFgyWLL7
-XPXXVcWJY3+V0lKaVPxkrBq3yJ6YaHZ1nJFcWIpAnqdLDN8Rg+lpDUo4D+2qatuFetutK+4s7Io7TiKo
-ar5Vq5KkuvRju/Rj3oS7xnO7xnNXDcFsC5/6DtzUS9hlwK7QPngdncd2BqvV8pjN4tTPFD9TeH4Vr6K8
-4fAY+8OoP6weqcYlqwmFAPWiZ8V8rhqFLSDUHN6su5C37+0HWRLS6yCaE2+gD3eCY6oACCDJ48zVaOVp
-LL1aG2X/mwy7KAFuQFKUUUepK05MV+kmR0EjlZhmu67jCdZzhaUwLJ95BQ+dIE3F1xsZSdV0bOG+H1x2
-5F75YLqHbp1HQXQem5wsHNN1tWPIe219l/7mo+tdWLgsKstpnhUca/BuF6OozpLtqvjgdinHJOU26gW2
-HfGSkEaei5fdWxED7J98ufLHiqXXZEGz6F9eTqaMRYS3GDGfXLN85GwZ/G6EhRkjMjDkLHkC7sltERWC
-S8z5kkU5xtaZDDAiaM6SHaj3ZCRL//eKpQHzIUoGubEDjNiWsVSCBd62bMDDKCaNUJFNbcdmw8CswFKO
-RU911hMxVVwyMUKXdzOKfeYmw2NBBl6yggaP62jAy39NApj46d7D2+qus5ABYche7UH+ckKK8rxSpb2F
-8i7p7tbiP4tXoS9Xo1Lkq/Xqzb/7VNRmDQUcXNJP4vGE28JdphMHvfVM6OZiZddV3ys638BNkjLqG7ZC
-fU9UV8y+1FDbmNcbWVndI92lqj65O2UqTsMGqOmW7pfVsTpSVpss1ayq6ZrRt8rONbEsjkxu1XfM6Jnd
-tVqSmp1rw7m6Dpo9rO6iu49S3w+sGnXdNPtZz+We9fdGB/uCwt39NzROpOofNC+B3tJ8thD5kAp7daCq
-hyQMIiZiuVk2VNMKzogWCL4oE9GscCrOnGaflpdNcOhowajfF8AHxrz7tNYSbBWOyf6onn9Faib0kvZ5
-16QEwEJNzZnjrjO4rNlqTmnScqYmWLeOM/vcXrdVTE9l2wc5/QwMqqfCHpVmWARSMkEqyTRFLQhwJ0vH
-OqE4z4e8Ayjzg3YUgP7BUHnDorKQ2wIH5Yx6y1sSpSsFKjTJIpgvwmC+yL2mft75it2kvyojSarf1DLO
-T+PkTZF5Hbh3dsm1E6o7Qf/LZ5VJyqoaJA8V+0XbCsjzSiCg9zgI2IKVuk9V+rZaENamfApjsYsJs6yo
-V2v02XRGu3+P0xpfcErB8zN8FnSAV8/xlbGCObv8Ft/N4igPohUj1syj1z9GiECNy28Wp345fk9MdoDF
-ULg/BmqVPWNh+ErcUtxi2inz3GTc/+d9VA3tIN9h8vHYJRP3Tvm+186uyNN1mBWqe1/g9nDqrtyvV+cv
-nqgFjNtCkRJnDtQN5NQIjJReg55QNoxgtlF3ULVIGjT6YlqIWlaILHtuOMC+hamSSzs+/w2evx0Jl2Mb
-fyEcb+/i/3Wt+XMdPVpmFCYhq09fuSM1mIMYfd47oP4oZ+lSUr1qDathpzSaK+ZuDR0lxSx7lvxNqX/9
-+zYuzH02XdkBlcvYZ6FiYRYGy7f8Ddkjf0Xx1ZjA91EUXwkpk2+EyIG7U76Dh5uv5hX2eWdu6Q92T+9N
-W3+SSrfkBPuUp3SWn3By1Z1BEdGCMmxwYDhIt7cqp2E4RTpnuaxiH8YU/uit+mWIYBpYuaYZXPAAVh9S
-uAryhcj7g4K6VZn9VSiuPH4d5YjO2dZAHUOs1T64CVoM50PjU4quPBlYkwp0NNrM8jhlmwjrh+akoA/+
-2PNauOr06G/YLoFzlpKaWCtlc/aJ/FBjY8/iaEbz+rS8lcYTkKFhavMeQMOeazYYkLEbLTwR6pBy6CLy
-rHj9itImWqzzuO4ojcrz1CsqYzvapFI892nO4ML902DJeMODgXIo89dfoVHU21F8RR41bsGjTI/E5ruB
-qyndldKq5Bsg/MBbbyW+vGA7x6z3II/3vNaezzzuYonr0dbeR1cceetxenUbmXU5sKsXNnpwbrgpbY7P
-um2E1iPUpVhnaRyGtYuAdyHNz+N0OYpX+TwOovm7OOXd9rAeR9A4xmVtbF7uNiv0VzSasdu0btT+Yhzk
-+uu2WIj6X4rHccVprg5oqNPDt8ViznJt37fQ16s0bF47ihEaD804Jr40dEzxclrH0+W1s8qQGFiZGWTc
-9IUDRK3EQl3T3MCPIJrFS8kPz67tTvRuZw2vQUSembgFFhORV+9LUXgjPBsdMFByyet67uTpYZDl/WYc
-a5GU65WDp/U5AeyDGbCwoWpBM5UrZzybI5Y0Pv8FkrOKoiCajwm7cQrOfwuPUMsTQqDiAQ0+gwEWeQwI
-4OxfPB5Uai+Igly2+eJJvwahIR4bGxKPS0J9rOGwKWixFg/tgWo6EBMGEYMer8LALx6AKcGF5VF7ekIW
-yQzA2xvTQFoz2gC5bMdftKK2xKiS2vDROoFSBypleHrK9qRYJ8Ih3gFXiWqB2GYdqU+KG2s/AAbUgawy
-BtS+949HRxzeI9AVjyA+ypN1NBnr672lnx7xQo9OWP6IU1vVNileX/+Ql3okiqm6BebUVz8RBS0ITafp
-e+Cjq+UgksqUIlt8SrLjDPw9UWqwxbE6o3DFgbQa2HKGaAVbzQntYBvTYCvw5sTX1EK2mmazNFAph6t8
-UtWslHPO2clqen8KOXZdrp6GKb7f1Pk2ATvO6bvvZF3LuBjX7Nx3yp07HMkM52ySBmmvF5iOhviNU5G/
-T0r3ftXIkSrcRojglLiYJ9xGa/3eg3k8edir9PgaWNWeKTaP8MvlXeuD+K0PkatsIo55RTLckS9An4r/
-afJiX8pZh5P9eFS+vYkuapUOtefpiskFbbN5haZIW1kqVWkjUVyxiC1BdVqjcAeRsYcNtxbWXkDkuFDY
-Sudu3QXS5u6MFuRpf7GG8oRauuHmFr26H4M2/7ItPMjG0veeLu8maPkpWQbukKNBk2vYteVkUKBrWGkF
-EbY1FWrU95cEsG5btLircFWTIl8W6SGJsrjjEA9vmyzSzPsqAa0WdW4TvlpFoJ1FiyDWLw+Z3d6x6XT3
-8bI2tW4XNlZFMN9rE0K2jnA1b5v49Drzvno4boF0tw29raDeY79lEO664n4fl0j4NSN/i4S8fYhvBS2f
-27R0hfquL8jYe14m6N0GGTcaeqdxJyNPFu9o4MER2/8U40728T/dsDN2Au7CvmsH/t/Ixtu6Qwsviq/a
-m3flW08HLcbQMZdtR1zGNA38OfuCvaKvcVSYRr4jkOhrHVjOXadbv+JpW9BWt4ur+ron8M7TeLmG5UsL
-J0A7Ux9lvbWx2zA3NSw/OrjvcP5g6bLbpKoqdJxW5a5UlUr4OiKcs3R5BxIMqaO+WO/TVR7DrcV4qqi9
-uDRe49pvZH2nJUVDP5KQztgiDmFHBu/dBD57XU3uVvOk5UbsbHmW9c7tQjeBnMdszj51GkpGjY5j6UXm
-MlFxsFRbc+1GChVm/5rsRKXjSyr+NrYcze7OiFPWfcNgdrpvCpZ+0dj/InvfkJluJv8XWJJf31eVhNRw
-Qd6ltwpaInA9zH++xwoDBL+a06p9c4NWVsvtVh0wLA7idKlumLeUrP7iOTVr2TyxD0HQPE/bHYxyno00
-zknowyFwMOpW+toPMjoNma+NhgqVTew3IpyCzkR6L3lMwwhrci6wpqs8R+HtYo7Ztx333bvJaz6+4c1w
-M9q9mOs3sNZiXZcVqSYYCNHtuoCN3Xo9uhYcTEOuEoVWy1E+2r7AmA/8CkQ6eZ+UKKJe6DfqlKacV7dd
-Och8CV+ybpDL80afTouWGpdv1err7nYJFYHWchgcNV5GTFp90V4hAuy0eHJb9V2XSI0uOJNht1gmrWUz
-UzPxS63DCllfg21Ym9atbxxgHHwxa+xUjJXbSaUznoiAiEMedGHgGsK7OMLuCLy78tdwFZ/QO3E3RvTy
-Nt7GryzhszjKaRCx9E7lXJm9grPd1j93kMKMzdYVFMIlCPNDrikqxHX2vUC+uwwMOY/jnKVfkuusKSLA
-kOW1hAM4JHqNUQH159qLst0hKqDzCGilVksJQysdhLxUG6fgSjocC4Guy2w+JFphy0Pi23y9l813extG
-tuZtTEgqTnxjtuLD+ArTFZt33GoWnJ2ukpDtVNupzntDNzY2AC0lr3DuBpA427LoWxff/Wrp34/iSASI
-7mqcgWZjI0nTNmb/3N620jTNlj7ZI/17XZZ7LF0OiecNxEKvPuQYbkTaGZr5ECqOZJb6svtVSb1j0Xm2
-9EukLLpOvo4oyNGnDl5VpgUrHMBSscKF4VnHJpW02khiYXKrmhamr35sZ8RSLhR40nKGp4UbPUZCPodE
-+tPID9AnIu722v2qpBen39qDKWSq2diQZ9jgz82gijWdR3Zx57EFB/6DCIZH/YoqkAs6nDl0hd3XCX7F
-jWgJS8HzUjMlDSszzEfxVc2AUMFV/4/xIl4jJ24n59bZhP+3qCsPsf7PUdg8SYS0FTlwOD5GGpyjC5WI
-s0DgGgp3JLFNY8PIdRHi51WWK1zPtgbV+yutaCKIYqe2LBqhqotghyLGpE0TErhJd+NQ2NexJgp2Akym
-tvA4M1D0PW9QIT7WgcZ/345AKg5HF/DI578L/u1HsXkzisyBkzF12lwvgCDfXUGujbV1zYH1xux6Oinm
-znM7EWZTytUdlbRz1+iPce9KVp9HEyICjJ4OpQYd7P7PGObu3I+Q24ZYzkuVTaGzQaiO8t7OyWUnZOEj
-4os9uXpwdXHIaqY7t7MP46tm7wBfnbdwDgQR7of3KkQCfEFPwX9bnTwDNqaHld9VkomqCNemU6Iw/Dnl
-bmerHvL1Wq2pWkuKJQ2iQlov6fFK0nie0mW/t/EX79i4hpBDYp1NHzcdXh8SHFHjWq/NENK71nmvbgbq
-Rr5JuORsvNntTcLlB48X8T6SPWI+ff4MBbg1k18nLD6vI8I9bt6sIp+dBxHzPXkzY3XpvtHEkOCPIVG1
-B7u9m57ZJr4HE+obKcPfkAcPxIcPHl363sdBj7eJr/ofPg6tS2jlhRmTcLlLbuDaSXxTbGsZ+6tQtBVP
-f2ez/BsEjB8+eOxTEqd5JklVgMQJOw/jKQ2RvPkiyD54k3DpfbTIaJThLam+i8aMapXNnMcp6cNEtZqG
-wewtIh1A/xACb6v4UTU66BHBoHyRxldwsyemD/BOFyxlhKaM5FcxyAh2PCMzGobMJ7955KHd7EPi/Ubi
-CJAmCZ2ze+SYRXTJSBwxEp+TfMGWIw+IftMjGo0PJhgpetY76OzNYMTb7nP4XHj//wAAAP//RB5XFLbM
-AwA=
+H4sIAAAAAAACA+y9+3/bNrIo/rP9V7D95lTSRlEsWbYTuWk/eTjd7MlrY3f3e2+am1ISbbGWSZWkHLut
+//c7DzxJEKQdZx/n7p6TWiSBwWAwGMwMBoPN7vE6mRVxmnR7we+bnXUeBXmRxbOis7+5Kb8Fz0dYrrf5
++2YQqJefsnC1irJuCDWDLCrWWaI+dqf2y27Yn/b2gyv4fwAhag7CLC4ug0fBaN94iSDgHfzBtwKE+Li/
+eWVitd2AFbwPmjDjl7MKusG0H8wEyoiIC+/tG+I9/kxqapydPZy7O9MP5rI/9V0a37BLO//QLvHLqLaf
+/SAyulrf250b9nb3n99bfnlcBWGToR8c25SoJ8buDYmx9y9MDP5w4mMUoFA/OKkQqZ5Oezek04N/Nzrx
+y0ULFgMC9oOFi4b1ZHxwQzI+/PclY+Vl3Jq2/SCuIW89hR/ejMKPabHvB4gI01ljJ2E/gkWbEP+e3mLd
+LpfHlxPuSA9Ij6A15G0NGVfXeuDbLuBUpQQfBtJuYmw1gWtefSvjmlaoVrUh4A27rZ1yW7ju1De3U98c
+VXS2CLxnN7rraBSlfH27u952qW5d08Dkdut77tZRgtYjsNeEAFX34ABTykbjQS0aKIfqMXnQAhOC4EcG
+ZrONz0MfPjh361F62A4lAtKIFUgUmsz378dnqzQrgtdhEZ9Hg5dxXgT3729unodZ8DFann1chsnJnVma
+RXe4yMfHWRZesoTQBgEACh4H7949uXeURVGwCPOg+JQGcwAXQ7FgHhZhUFyuonyARV9G4XFw77vg60UU
+nyyKr4MgzoNw+Sm8zIMtLCD/93URTpcRfKcCSRBS4+lxEC2jsygpciz8Op1HddBOsigsoiwoFlC7HejZ
+Il7OgwSA5lb5ZZScFIv863L5cDZbn62X0Mw8EGXwdbGILFAI6xXWxQ9n4UV8Fi4DwiHI49+iQbA9CvIo
+OsuD4zAvBsGBLBsul+kngA2EhM7kEQIC+HkUZrMFWGHRKg8+LaIkmKXJLCyA4CdBkQbHcTJHPOFPdDEI
+XgKMLDgPl+sIisfLJYKZRwwymIYwzjOoCTy1Lui7as9qaUCc8QqNGrDG8PcBG2bEAUkQna2AX4k2XJRf
+PAIe2ZgVaTYJOsxBnf7mBo/XJNiC30SJSfD+wyasU8YqcxIV3bjPEHF2bMTHQTcOvg22gj/+COLgu0eC
+6F0u0tvcgEIbxSJLPwVJ9Ck4yLI068Krjc4LJEXQCe5CvbvwFwicQm+BmBlwOQzB00U0OyWiM0z8BMWp
+8mW6zsSgH8cZTJM0C9AMBgRfhZfTCJ/h99/jYvEsOg7Xy2LQgUm2cbW5IebzOsnD4+gHs0M0CXVnHSWw
+y8cAuovEvABCMm2ZdPvw5rtgC/7cuyc6jsXyZVpASSDOd0H3IvhTsIOIbHwCbowCptNAcOp7LPsh+PYR
+io0NgrCBr+7exRqAO9GbAEJDqkgc3JOYmICCe8Hwg6wYCkHBxWh8uTWLKObX+APTA1jpMCqY+4ljg7Cg
+B+LlIB4Eb5LlJb2huQWjFc4F28fMvDASCGaWruIIp8E8WK/mOEUHmto50zkuorNaBrN4S5IJSWCi7xjl
+wyps51gfunGQtMPuPU1Xl10JgtEzeYAWhy2BlU1N5AEAzOhFSxAdZRYBMh3CL5MhP3fEzZGGFuq6aRbr
+VTmiRKw4iYs4XIKc7ELrQo0hROERh2XLHhaSOgwVe7sARF6FxWJwvExBGPDvZXqCtXvBff38qhcgMgKK
+bvVj95jW1q0+ckTPVoSrxY6zFPpZpArLhTVKiBJL/kckokggdrvAvfeoai/4r6D7CkTUsEcDouZ/DBVg
+tiN3Un0xFPDm7l05UkFgDP9xF+GhwOvJQRJ9o0GtSOQNSyZvSKlMf7A+kZRpisuBJOsq/dR9RZbdZk3n
+qNgsipdWN+8TlJ6sJldPs6LZTyzXlha0CBjzoDRGyLc8TkAcmO5/Ykz63J+zOJGE63ZjGghdAoaViCmn
+AcEXckK22GOoMIFAY1MF7w0/gFq2ZbM7IlodBzkMi/6mPQp93fJEQt7EgTE5EnFHVa67hP/oqQIPA2yK
+mLHz/kOnbtJsbuBqDnoH6BMRrPaooMyDKTyf5gF3skdC9ROop7BYotYoNTISwsWglhHkYLPkfgQrvnjB
+Awpti3VKo/uVja4xrFTm4xYNByIh3wxJjuEiBn+hL4wHrPfH6+WyH+Rp8Am0M9COVut8EYS4gByj/lSE
+wCiwkMQFcAx0BJYYBpBEFwWhPBACMiYivlLykfkXoDziqeWaW6XJVZ5dNL1gtovBewuodRFkn2lFTLdR
+Q1EU0EQ+muRiBFkvgT5k1Pc8PYuKBXZvGR2D/pLQCsqTRy5731lCyuzQtWTFIF8t41nU3eqzXkE983VM
+YPwDkjxL1ycLVHulGs2sgvwWnQOLreHTJY8cfD3jkVoAKpHgqoEhJhYsJhYgJvib0Oxg/sNbJSqw9/T9
+/eLDwJQn1iJo9UAWN4fnSsvHBegkYgXP35ebRp6ndQEKyXUchcU331A9GwNktKE9VXWh91sfyuu7UYY+
+kZ0XvGVOR0yYYqFJswAstpDtlUFVjlB/ixT/yN6iUJH05S9SJy3xHoMnZgMeFH2dpzCgCagP0QXO101N
+f7PTC4MVCUozKy5QWJvs+P4DPSmRCQaGYEdubiWHUnJhiQtWuuvGMmVIfPXJYiHRns1Ev7PsDu5KttAF
+39fVFMxyZSAmS6x4HiVKLXQzsJRTv2+2YGD57lZJbbIgTWRSBIPzOKRZ/DFgSRtM06KARTcjFkHLOiiy
+KDL4kXoslEjFgfgywqlGsNRnMSLiKy4hCch+exrxR0OpAalKDoxHwYwcBxKa4G1DN8zjKSw1EXphRCXp
+UQneRbN1lsfnEdooWRzRksgLjei51d973N+zNCeTBbscrNIcGwCT9MWxFuBJGuSrcBax/EYRR0YRoog1
+sX9s/cDMYzQte8emD5IPKv0ZxOoSi+eIM1pFRbpCe4tk/xIE7lJMz9BlcPAHi9++La2KQJ7HN1gVJdSc
+FpKeXh8Rnjk5sUO8BIqhwQJS22WpKBRj+R3oZC+U5oghTA9jwZi9Q3S7Ya8nRN0Rjc8nkKA8OnFS5WYc
+VdI78AsZTuSDweowWMo29bCsQUptFfKcVQR5b9DGkB+iC8TpXFpJHePBrMHmv01PQau/o6upUF22eLIP
+Kwh6UGKDafVXqo5cG5L2IqhQLMQ8D0Dvmy2kFpbDkiFsfCQ81RVeACas4koH8xn0OmRD1zmdsatEwTa0
+FSsFQ+yVKam+NtMWxKZYOySwnovY1QVd8K2Upk/T5DzKCsMZKZZ10oQNH6khAoqUzAKe/QIsv/vYdbt7
+8dvgdbxkkWoaGbIeNicFimWdhRVO3GeHHZptymHFejtOX1vAkCz4PvBgBQTI5fiDOdAP2NrBepMydqqU
+bXzhVym2X4Ur1IFU/9LziAWssmxwSZIeK02Hs3CFJqVekAyBV2/Yyc4a9p1W6W3K9ci+s2WwVihMNiOi
+i9/cT5e5bEM3DWZDkqB5VTsoxwbZJcElGWoozXzdltIkFuBNnAmfH0ga9rqG2ckaywxM/wuUiOavzHFQ
+Hhz5icx+WKy3Ks6bcglyTfy/M5a4jas8IbE1gGJkyyQyZhxaweTjoPoTCUYh/j4mkVfDCtrOSJfzJcKe
+yvGrVTjaE4E1kCkU4y6aeE+1tWbI2ZvAtlC3eF+AF52eVnuc3aDHFXTu3dsPPr+zzWAthBv7iVrRm2dv
+JgHoVRnM1uUlOn8D0uXYr09qUR9/JmLD5bgYgCoFGgP6Zaa8zbUq4jP0PZlee9IHpYfVpB4x37eabsSL
+entIMCGWhGVSl4OHaimp5WNjLwE10SA9s/7HbZekSeW7xA0awTFVrZR2EbR6JfTxdtq3KaECkk9KPAlL
+e7IVXNl6jDHaufTRFGmvVt87xEJ6yECJVrqycPLxe72ZwD0XxjK1gUq0RRqQCt1MeT2+NwRGJhUzdpVq
+ZqMPH3oV94J0aQh/wnmEHYjm0byPi4ZoXimVWOPTIsVNV/wiiJtVKGuO/1wT4ympkSTdhTPwcxaJyjgQ
+Hj3LxasoUy6lFxJG0uW1Kq0DTEI5FlVrQH0XbMrFyJdtDla1jh6vBkFfnk+lyesYgX/q1BBI2qS9K4yG
+htlCNnp1stBrPVckGZyzRREKpwtVLM8WeumYLPj+C80V7sAjl3r/z5s7bHw6BsqaS3VKGeCOAMSUMibM
+ljVZtO9vq2YjqmJ+mwqZ8Pxp2++xvYxa00puKgnyOZTox6tVlMw5zgbNZ9PMC+kbBdNr1aLiFCzNtKle
+H6eNhUPDaYbxgtziRw7uE3z3VPoCwGBfCCc+r+1gjq8TcnIUKcyERZQJ5poBycuDOHs/LL37Vjs03ZUk
+wqy+CJQRjhnUUIVbU21LVOOdoMfzX9ZghwiJgZsSA7UNt6FRQZ+DxotDc4wm1UY7FbIMAXM/yXA0Y0F2
+c7k4jyDbzgalq24I15tRBPnrrmQwJgnjro0P89HCX7zrKaLYhLra3KzpmNr6Tt9FZ2DzYSPhcnYkHiXv
+bAiFSRT6LjhQREFOyxfr4+NlRPD71O++gmjuwZT8tLq44afFEnYwF84m4tR9odbgALNu+iYRexkfz8LL
+j8jFtGFamXZiErh1etzhmbrWK4Hue6xrklFVR3fgEENSptYbyw9rwJWlFO3CqnOLFHv1jmlPI8QdoYVI
+9snwe5ITlNamKftAofkkjzJZoK/qM7XVd65jfN5SBgQZJkHJLG7Vh1b4NqApZxbSYxWiwUKufd0Lq0sS
+QakIlPzM16Fq6KCloSUYCDokFWgCW7DuD1UDUhFXSzQWGaJq4BsEqSsI+jr6z3qhUYVfOOhwVZb8Mq6Q
+dA5SNWhGySUnzOEF7Q2GxaB+oWK2b1qTrLnTRtBYcgYWlYNaeEqaCOHDsbeG2GGJ8udouYoyKQ9ydnbz
+UA9A3KyWIZq/oREXKn3aeYybpLzdzSNgObg02/JH3rJTXir2kcmxq7pdNzfML++p+AfBpfqjWhvkZ6mq
+iN1Rd7G7j0TzrJu6CikNtex6U/xY6ZXczqyzaqz+bBl9KWO5Ve3IpmN1LcGrhl0NeZ21oTu9QraeZxNe
+zLMykbSyV3HTWEOaL2Ig1ucg52q5+u5eUKGiFHSlNjRGV6VVlfy5F0UW2pHKiPcBToZj9PmmguHx5Ilm
+jOpklYyer6cvlYZSp4XX+0SN6ncfGW4su0Kts3XaEvDUA7gimSpGy7RcSe3TiDpgDBrBjF2jbbTBMJyx
+J2Qyjwho2KM+RruOSPbm4XlEu2IwkmAKo8QSkmoG0ilHYa13PMgzDzoRKUimiYFAhRikOV7xutNAcB82
+0c8cCoGxiS7lqRIMssyHkqOgBL7PgcA6QLfUhIx/1cKLypd30hztWkUtFASdbDRw15KwYAx5rPpy0Oxi
++2K0l9CGwFgtZ/oxLE3YHpFri+jEVJYF+oHxU0lWaiYvFZyWCvYBibvar8ObjmIfkezyXDoHUhH2JXZm
+T2L0Egjm5MUqFnHwzDW44KVnsMpHdLTjhdi4XePKPr2UK6Y5u6k9PLTRXfQD2WcdzsvbuEa8DC33NNtF
+OG/Y6DBYOLdiKlsw5ooSDlzhpzrw1AhQbjIgWOuJ5jIaTbOUW30obTYZBFKODx2X+qrfJDKAKRRoFW0Z
+fXpSB9oVNNC9Xhvs+zqNVyq+QezhYeRo8GoQvEpB2KyyaAaK5QTD8i91JESGa0EEBMsJjFgUpJ9I+Jg5
+mg6ZQISHnrjnHxbs2aj+F55XMdRFmiu600SAJ2b9fuADTsuvhqHmGUFRTxYc17TUsPAXBVwI7fnternk
+IFQ6DYT+P9LogTBi12QWziiOMwbGYxpOo2OkMMbjwgcCY8SwKmLmwuvGcbuPCAnleqRACSzp4BKOl96S
+7MTeWg7XxUkvjjvxZg+DwtCPAoORjLBaPAam93wQXxGtFHJwCAgeDF0AQ/tM9iaS0brzlJyWU8DtlGMJ
+YflbBZcRGg6CJ4hL7one3eNTDBUNUtpEPYwcV1OQOANQeI7HpvBUkDimpUKx5HCAyEP2he4M5FmKdJ3N
+Inbq1nLNvnJ+yKB5msyAZQXJvoA4KMW+M4JoVdI6HrIjimaYDOLd0MDIc6kgCweOBdjeSetZZz/8Likq
+UVIzK54pVGhJbSKFOFBh/2W/lAnMCqbX6CvFuVL47iMdZ29/s/YkWHclb5XcFixSSVE6TLTK0llEDkmO
+9SYZhi3ENm8jc34Kc66J0eSX4pCRDAx3jB3alngYRDkWab4bk0h7FwkXnn9mmJQDCQxmh9kT4cmmgTly
+zuBPcbJLqjQouVhi9dUsk2FNG7kZMlUnBTY2qJ46JyYtf5jCyXoVhMeFiOnAWTpgrqVHnOHcJ5dwcvdC
+r9KteqAxk7syaKVQW2todD1DzzMvUgIFDk8zpci3jatsC4walxEl+ks4Sw+EhvlBKh2vw/P4JOQgAulo
+0BqG4fYyFHJp6VS3bD5Y55OlL8pZeUuh8BQZXimMOOkpgBFFYvA6LSJy5wSX6RoUnnRNno6CzkqS2I6P
+aWuflERRjZ+Qq0GDkgdzAaw+c6s0zYxUTSRhDh03dCvDL/i5wTuV0NMbhOzIyrVBUFJ5XKSfYJ1JLsX6
+gkaZCCAtBT9bRxGVd7nuJGD1eKVl3laCC+2jfdZTJRRdcAFY6XTsOUeEOXiTJrYxhjJ8E8XrFF5BL3NW
+ABACHVFmP0E4E1IBg8JhlD+F2Vw4DoSio5lhYPkY+HyzZZiqI43ab2CeiN0J/mRFdMtzse4zsb9vGidi
+zciQtHAFfM+UNcUxraYVJYZJK0RqImBHuAxSq2IsibjVRc15wpsc6XuPIHWA/vVPo723USNL9IO13fp+
++EGeTPMTicSFte3MtChH/yvPNEdTl8lBxdWOgUEY/GAL1mt0s9Kqq6fyMAgeAzA7fXC2WoSooeV4ei4F
+izhLUfNd0O8oATIsnDu4xvGCqSmM28kyeTJD9oEc2U6McXdE/dQegqnuhRHv+5dDsXuu5tUvuUwHUTaZ
+OT5+Q1X62BVl6RBtaJykEO9rGjPqxZUo44J9c4XD6VdYR7sqISKsDwnQ7/GIJwW+yLWu+ODa2GFXO25C
+FtYOjJYc+jy0s+fYDgDoG+3onZPyAU5JbVFbMbt49myE+E8/q8PONqDSOWhjgAxkjL7waegSjP26XtgV
+G85H30SeSURKRs2/9aHlGvr9U84u14R43eLpZQ2R+HfCbAw15KG1iTqPiPlCUn7Ff+GFPuE9wTyU+hFj
+gHgTjj7wT3yJRzboFf7AF8Q7E8wXSb/wFWgTVAT+Ugl6hO/8eBau6Cv87REKMlBaoCAf8SMFClNl+iVf
+ZepVhq+YJpI2/U1Dgk60UBREUR+MB0qfcoV6Zzm3z49FvMwbkvs8gcVqlley+6gZPY/PK0tSN4QpMe0F
+f/D+niqbRWeVsmHwXxwhrE9PpHM7XmJqiYJyHpfO0zBBa0LYAlg92BoEz+LzmE6vTS+D36IsDSIsrRKw
+kAcRxTs3T89n9GyKcWiamR569B2/zuB1hqZfD37cQ1zvAbL3xF696BTHLU4FlDOreyBMgaZRF3e6wZAz
+aaGErZ2CAkvaWaOS6AQVLavyvcQqEk5z+3tCCUy+h3KAUmKLZZQQ5YFxswOxzGB2tuLyAmYIIEuDGF7c
+EOJ3NRBnyxDKLFMQd3GJbk2AE9BoUsKVNlKWKe2ktKi1iAmfTToWsYg36fAD0w4ZJs3QA/2+8/Ko0w86
+B3/F//5w1PlgJsCdpWeoL3Yv+sGlpbZxCCrCeN+ECdVFuf0hKGlgFzABqjMKw4Bs4sEE6VqFvrK/x/mL
+5BgFZFRmGmRk8e0Sd6n4zT35qqSjZWt0KlaA/FHe6J9HJ6jedudmuTmsSsT0b18A+w8f2MKD7LtuYVYY
+GRX+FBRWcRSAb9NlmHVXaZwUSj/FSU9vOEmE1BnFq+F+K6Y6Wq+W0aibyfZnKWLWD9SLHCaU2FAzFFgX
+PhdVfC5vig83/WtWUIqnC+CYS/h7KfWAsAiTURf0hQux1afXV5DitEDBX1xzQFDTI/ylRS3lhRL+9nAB
+WsUTSXf4GomHA/gNhJgokuDqGCcTRRHK6SWf4ReuwrpCyDVCXSXkOqGuFIpa2BHCSPeLEBNsNZH8hS0i
+20yYe8QiScMw0RxCuoN4KX4gMCSkRB5+4lLMoptaFr+RPCyNJ0IqI35TDNOfYntn2BskXZywenAh1IML
+fCSZRss9/aJXLC+olPhNXbtAYQHv4C+1mQJu8B/SB8Ssm6j5h3BASY2TEzka8IS9R3V/Yqj+ONbpGvUg
+eke/iRzPl2lYTPSif2EkIb3YD65Qt8lfh68nAf2hRylCJoY4cSgffn2DdRJHMsGnb169ffzuxeGb14eG
+IIl+1ZKV1flwdmrlkMkPfl2HuN8e/YrBWFScDBUqKnX2VRhn2vEjK33zTdDFL7jBgaXBQlh1e/KoTgU0
+Fh0AfPpbakQryKJaKZ+Vhd08WtGmD1WWahC9hOVouKVc34wTnjP+PQDGwsoTmPNX5mkE4InIiB7lCIPL
+sjvEKoNpGdNjECCUZied/hLNio5hO6vvlDVIdqGjjGhXqr2NzlF2KTKyoeP35+6jR72fA9NnPRDn5jmv
+wafwEsueJgAKGtUhdOgP/Zq2isOz6GvpGj1YngV5lOTRoEPNYTa/d+i2p33DcMobeJiosQgWRbGa3L+/
+AuqFJ9EA+PAe8uEgzU7ky/y+fHsfufM+eTWL+6wN/3+PHulG2M05j/JZFk8xk+LikjZac24Ou0F5kRby
+rHpU4EbIecTJFWi/E6biabCMTwXy5cxcx+Eyr44hJXeAFflSPdmDSrXMSnECDJPMcOieQXfs0hcDMGiO
+4rMIJhxxiH42Wv6q20G1pYNUv+iVjyOeRpf8QaWIwyqSs9/D5w/AoeIvszO6pQSfGxuApX7LvToXv1JK
+Pzr2Dir/rOCkQJwrMKXD3LnovpHn6t0T3MMi+TNdx8siTjpISLvIAdqaVhnRXVyxS7ILW74jTtJf0Ohd
++gtdGkcPzWYB8ZZNQsnGFo0yl0ZKJZWRgchD8ykiQYauaZwn4oxSmlQRnEw6Rtw+ht1cyH1sDHK+NLNK
+2tU4zr0MqconIShCuDOG/702j1C8ciiyfVHY9VQ8GNxjIMYIOUjzmMOZFG2qlBDODYMaF3l1CMwUuQPt
+L71Qu/+X7SvpXIwXagcGJfSlGSdmHlRRtLmqOcp84Q4JtaZtTieGL/nPLU1aqwGiKbQg/rqa+N0tC12C
+R65R1xI7dUTTizYjLzc7KWFW8EOURBkI0vt/Cc/DQxD/q2KAcTy8SAx+weg8EEaUmeKXHFum41kp7XSJ
+sO4ixh0zdCIX0YlOxxvmeXyScPDBy6N+cPBXhvXD0YCVp5dHMIr3hvgFh7MPXyjq17Q8peWoThx7lnW5
+CrDsBwMc4IJCATyCD9DaBFrYr1lNDosMVvayXBhQX94cd3uWhLBfK5tVOkyo3RBDa93tloRKSWzrlIBC
+CF1UhdBljRDSFj1RjgTQJfxXnFeBxvEr0u7gr1W2h29aCl1Q/4UUuqReV6SQgZnASBLd7o+HDPoA8G5P
+CCWyBE2hJPCizW/CyqgIte5xsAnlZc5Qz+3M2J0mbA8wnACgCN0jVYryZu/qVDIdKZQS4aaTZsLBX/WX
+7/BcElgQbvoGJeIGNk0ViFEFxJBADNuD2K6AGBGIUXsQ4wqIbQKx3R7ETgXEmECM24PYrYDYIRA77UHs
+9YKqM5WGPc7RIsE3E0qODT/xDgn9f5qNaZSRLR1KvwPaTL+JRVzwPAJTkQ/9gBQEoYk6MGjWx2iCYmwA
+KKE55pEKs7xPd0wlJ3lfKC+YnZ1A0lYNS08FASWm4F9XOVS2eyq/NNiXr968Dv72+OWPB4csZGkybdmp
+yvldh+xaJWqF/6Xi4zO2QrgI7YV83EJTDX8MwVqr7KrOFll3ZvnPgKYsYsWdFYTvDz++eMZozsBq531P
+I+ZhHc+7H00oVApDFkT9dwdP37x7ZtrSnHOsmy7n7yLQQ+Z9mYXseRwt57kZRMMFkDJIh8pCrEDokBh+
+pkUYqqkC9KJmOS+17oZkFTKhaeJxBdlxvGzgxeFRcHj04/PnAT4zFV/HS50ZgCWvNcaUW2oBRCmWNWMM
+i4kc3sVcjm+xrAywOIt9kaNaJbPu8Usxzrm9YOcs3Jn1yyt2jm6+XKuwAtBLw/TJfTl+RV12jqYUFENd
+hVoooYEs0keCsYYYIZxinMsGabtYaKj9JrKlUnperAjl3JBtQBuiEVGFUdP1CVmBOOMhZ++7x4d/PjC5
+eZaF+QJdlutl9Do8oyC7E/hgDp5yMoGEycHq7wW1NwW8o4sTKJvaz8+i6fpkQA38jIzKjQQ/o6jUDeKF
+Aj+T+OSGj1IxiQUe+P2nhAx++HWEwcWMBYZGncdzPi1BQZ50LHANxhn6syY/JT8leP+EqCpqbbLfoCxM
+EMmnuN9UpYR5guYfRhBEXveZHCSYA0AeDsHu/jwDfH8OootVhqePoBd+Ig40xDeJOjM5zUA7xeSifMJW
+hF0RjqRKY5njFG/SQK8UXypwkhYy27CmMkUqi1aZYDxyX3zs3D2W2jw/DkAJz4rBElZQTLwlXkKX6ZU9
+0zu4+4gFNTmN6paPsjONik9RxOVzdwW6MAMpaXyVDat5efQGBO27F69/sCJ5JDXVkoKSDoNoWOCd72v5
+V/Uxmj36Vn74rlPyX3K9aZpi+HGp2jno1J0jsOg6oFd3nqPB566erM+mUVapDR03y5/X2kISzZ86SKNw
+Pj9chpjwtnveJ4uSOanjbtwp7jtfVyGRxUqgvrbRcvsFO/jK3aSwCdFK0n6+c8OawJeHyAERCulzYUys
+p4wrWiI7fCyB8j2YhZV1UjK41sVqXUiHvelLlE1LOwshnjIcQq1H8YFxsmZnwwZDktmZJYe9P/3Q0+H+
+igRdpKKo8UsaJ91Ov0MU7HVU7H1NF8L8tFP2GXS+LeD1dx2z6rnTV2Scm+Ds9CXXDxWUTrtzK4lth/1B
+MuLFFkyU6HK/rv1v5xHKoew7B+bqU23tj2/xJESeOyqv+MsEcTkfxHMkoQdSxdyWo995b4tZZXafE5sJ
+S1poGQ6IgkcEvLvwoV8D0IZoMoWsHHQ+1PeAlRqbCu895R0OXbsyFKgZ0npn7nmvfqhrfNvnzb5tGy/0
+VrdDzPRrm5jZA9wpHVGXs1s5HOP6uc0bexnllVcTWx4AIrG0RTt0mTiVLnb0sigB048y12wx8N+JFvKp
+az19az19TU8AckAxW2+OoXCHQkioAYPRiDZd3dr3hOpEyBj8TWKlvKcjBkRKIZ84Nrya545NnNKU5Kmo
+CNVzTkkcwU/R9GOezk6jogoEvvEno6ZDXDuk9e+bJVl8SnrCo5IepeSyzL0kqvjyLnV+v+qUqNj5PahK
+8oBFeXDVsU3BzrfoZc2ScInDsp7Bywj7Z9lmemWFMn1Q2Z4uwkxvLzOfDTLO3NG9/9NP90+gwZ/gfyyI
+gsD4mIiPieNbIb4Vjm+Z+JY5vp2Lb+eOb1vi21ZHJjOR+Ftp2IwaHYl+R0bGVc6BmMW/FsW/7qgED2aU
+5q+TIPoVgw8wqgH+Az/ZXzIRvhT5YiRejLDwAv1CC4xFYGN+Iox6DLZcx/MJOTMw0MEVswn1UaWfsGbf
+F49PKUxD/eSoSea9ieJCHZvgCEdgJ/6dJDonVUcxSPfjaousIvoyUaYvq3NST/q4QmsVikrn6sdzfjEU
+d9PAJ3w+Z5tXCLuAYDJhfUgBLmARo18ZKLG5oXE77kMTIxONbWp1ZLjaORssfCEjnP5Ssp4rLx1Ug9vl
+Bjlqz9yhIfvw97LjK0C/CBRGp8j0qrnF42W8cjZI+XHNBkV+W5HCxw9VXAJZoRwithpbYMNGYGDnwcAV
+lxZ/XBAQFSrjHcmP6cqx/Wd8gzUIPWy1Bd53vv2j88HJCBelQbloJM4tYPPHdy5sLvB6tn8CNt8JbCos
+dFImzwnxLKL1j8Dr229deJ3Qja3/TLzu3iW8fJGGLHd9k0JK1wZAsph3fqkwslpgYq9Vl/TDex2+bgYF
+hfwdpOC4JjiimFeocoxeEyRRzC8sU9Tu/XCokLdnInywsWuinA8WhRI2AaJC3uU3baRzknppfNFMlwsv
+VW5DKv7hmVcCiS+NwzffNOMQ+gcDc180QIAiXghx0gghTrxTRmxLN00ZLvaFl5dHzSQ9+cI4fNsCh+WX
+pkMLMhRfmAwtqPCFUbjfYiSS6Ncvi8SjFkh4cbjTOLW8Un8VN1Vfxd7pjWHwjZMbC/mgiNj8Ro7gYl5z
+YZo3Cs1p7jcgT1qsqFzKBwePIDRBwTLe3uBBicb+YKEmKG2AeGHkzSsBlvHCmKXNgwNlvBpPc1caetKi
+I3nTkpY3L2f5l5Ub/6eF2LhYfVkc/qsZh7PUq6Bk0VmjxomXn3/RZeB+czfm8fkXRqIZB4quevalEflT
+izFdL78sDveaccjX0y9sWbdQvucNZjUdTGu2OqmY11aU594aWUQW9OJFaXeasMJCPijivF7jxOFiXhkQ
+zuMwyS2XXGG65Aq/S+4OBVJL7+UPRx1vYYq+loUP/uov/NKE/LIB8l/WefEmiShLptmX0OyLBGYUlo7W
+K+qmqwG6/OUOxsM8i47D9bKoOuxgPOhLPzjDwqZDGd3W9FKGksIrY28RMelweXVwFQqw0/sqoJz+5kfZ
+kgy4d3u4GOXXKd9Vroko3tRQkmuBUXu0oByFpU7OwuVyGs5ORSf/xqE9tgdff9HdHfq7K8F22dnfq+m4
+r4dtiIEtt2MMmyNqAZ6FK6cfucIBoyoHjBo4oK4DfDLwmCAAqb4UraBrI4cfeI15d85C+Dctb5m4dy/O
+xPbF2fRK9r3bxR0UI1ZCVOjR2VHeZakQx/g4dHy8Bulw64O6IVrSWzpfmJ5IpOfjWnrCv5lJ03GFptsV
+msLfEfydGbQFGo0rxN1WxB37iDt2E1d9HH0m5bcV5cea8mOmvPj5pZkaqfp8xzsI8G9uDsROZSDGtQMB
+f7fh79wcEKDdTmVExmpEdnwjsuMbkR33iKiP2585XGM1XDt6uHb0cO3wcImf21945HAYnu82jhz8s0Tv
+bmX0dhpHD/6O4W9kjSLQdLcyjDtqGHd9w7jrG8Zd3zDuuodRfRx/5hjvqDHe1WO8q8d4V4/xLo+x+Dm+
+heG+UXall7G1inOyg885jRAYZxECcRIh4HMI5dwxqN6L7H2ZjnBJKbwHmi8nKYNClctgkUxcgW/ezjI6
+JQqv7JQH6booJ/MT52DzUsMUV+Q/TZDKyCI6R1A9QuBp1ryy1mg6zDi2TOEkDjyEM8zsN21LCS4uohEE
+KeBd6aqA2ayUewmUE9qv18dBNE4+ctBZRjeJEEMi0WMBmg/b5YrN7TMXFBBxWSGfzSAVrLc11v3gt8/F
+HN/91tSb7XJvsOE2ndr4DZ9+u24Xx9jep7xlN4MAyto92MQALezaRd2Hy7oPjcQQyBEVamnyCfv9SVLh
+9im0g0ic59ej0nldn/+R5BOYE8GaqHiOtDmXlPqiNM1hBXlyyXxuncxRdQw5NcDSXbV6VEKxmhKLHVO2
+12O+aQ5WMQcuf4+Lxedio09WY4PQmsy6YBye5lX/4K8dkTRPvXp5hK/uDcW9dleV3FWwVk1wwepvbuAq
+NKG1iDIp4QMYtPjco6xGKmuimTPRyJgoXrvyMFJqxxG9wh8i1yNoWGAF4Q/xAlQt0Mjxh3ixM0FFD39Q
+tkgaXcKKf8qXSGb1Gh963uhE1BvuyKK1XjPKPCBL+eE8uWyG8uTSD8MOg8tNfwSsQ/Ut9xvC64j56pwX
+DAdUsWVUpImFwrny6HjPalIxeVzzd61wXfGBrPpW51nqcJkkfDSZOR+LTHQ2Ah0kyo6T5gyEdCfJUNSR
+/UD4fHzB0FYN/5z67nDQoSgUFSrgbHhG3GpCCWb57cbH8xHHtspDFBsbiY5lxevuxMmW85F4oeJbkRyi
+JSNByJWHx4Wt5OFMLOGtP26sP/bW326sv+2tP2qsP6qvj9cAVFgszt+cYt5fzWdQzM1m2pWpRrnqxTR4
+oprExWQJjijHxqV3s8xLIslLDS/hUAjkFTPtyLhoyT5cgBhoXOaonTJHQcevx1DhctmGoDJN5uMR2ZY1
+Q0O9MEPDRyU6fqWoNRKn0KiKPK3lQ5QWHj/rUBE/hGWd3xPsELO/nIvYw0LbVRba9rIQGTpOGXW+J8S0
+YIKP5w+E3WS4Mtl0UiUeEpdsKy7BosQRe/zMthdA4kfFMA/5WfEL9XO/Ja+om+ZqlzWk7EYt7RH758xA
+JpOM+0FcIhZl5Wa0qM+UyLxx1VufWbjxadXPRpCzzVroUSrRMnqyOS+Oqyydr2fFPwzPP1l4DlvjeRZe
+xGcleqrZoV2nYgYw/++UziF6NO+Sqwq6W9/X+uhL6b2UrkvW2vX8auewuvLSIU6a6LBbpsPuP5YOcSI9
+fNK99yXoECHTOI8yCBFgqLbtV4iwxLA+DTD6FU2oC3PdYNeUT2TFOZ3tdMksHr09slbV2O25ZHgpYVuF
+sDoHm4eCRUguzFo2elBmowc3YiOsJw4w3SoDLPh6yVr0H5bRf3hD9B8KJ+atou8OWVFf3AEr8vN7xP+D
+X/VA49qr9brPJJWmznbt1CHVhnheyH17DqJuUNI8xVPJwCPtAYw8PEKjnsHOAwD8dCXUR/5qmn8tZ9xx
+vCxckmKVRXPdY87TlMxj/Bgu0SUhq5hdO85SvPQc4wdKkgLB8ede8L0yU5WbX1Skw3VQ+Srgv2It3L8m
+zUuY3pQ0FCUgu1o5hHV2YZMHjIAtchGdXfSMaIuG6JIKJagKrQ1Ai4v8qmZXh2RgkwLIY/vqFrnZS6bu
+8Y25MMOTo3nklli3q2RVKH7BtL68MjSvcheExePTZmdhsqw78GnyCRYcuiYPy4XHWjQIrsLC/MF0igyH
+LoHdVp6IjZU+wUcJXhIuj8vyxbKGS5REIplWrDlfPYMtVSiq6R3WjQ0iGv8UOFT6hd2ayt8VV5jSQZAZ
+m7hR5CCrak+8x2VO+ZHM6iWHZeS0Ku1ZW53OTWTg2acWkxoOb8vjar3YuMwVUVrIE75ztzJJr2EKUT/q
+SV439RqsH8arTs5VvCL1IJgl3c5eUArohCuBa+IgSo1LGNQsrBop4xYvl0gAltouCYQxu5y2982Xu/xy
+LGIV1fsd9V64HswF+YIWY2tCmZkexayq4yZs9cqYcdiakBaTZqhY2zFdHY3siPl7Q20AidvXSXacGJnd
+VMuWU4y094Ctk98oBYAx9GGcaWPGGnTTwTJ8QMO+Z/tA2YU0fLCv3422+N2emWepZS9NheOhUjgQJjw4
++l8qPzTLD5kyJEGMa/ZaiAI5NtbNeCbOzoFxjAt9YPp6RQWlUMlXQtkoTc0ckCnpdKOhNDhlrOjQJ+DL
+S6Ip6qsT3Z7pWSRFQttVPBeM3TCFEPBVyVzQiYmIFrjYtVyD1HTacEwYJA+bsz4NdzRUDCeav2qx+hTh
+afRO6YklPUtsW/UDLJWIvI+6wu1vYlE7dbtYo5FjG2s08u9jaYjOzYfRtmMni5cCgPzRfGtGSZpkHymy
+U1tX1vbXaLuy/yX3L6g0v6rsYBhEvt5OBlY8CuPlu2jWsAt5C6qkgSXTKekrR3uVmRuXdwT3PCQylfhw
+hlmXLOxvwmQtpQkMaX20d8IjjYjwQMPo7X7cwZmwMU8Fb9G7Ib3TLyW/ugPDpUhShT7W7MW5dmjLrG2D
++Vhn06DY+RQXs4Usu2V+2sCEq4HoBf9vmkXhacC92y8VHJkFS3K2RtgaSovAdMv+NJzYIOpg2EAqcNyG
+i/if+XBV7tS22akSTX1krSFBO/xdyFtvasE00cEFqx5YBZoDoJe0NnFLTyatK+xbYrYdq6z+LY4JlQfJ
+P0ocWGz1qlymNJRCKDzgVcEix76j3F6pnLPQrlnIWWKn2lxd0bGz6HDfwY+NQpNE7XBra4suuTQsmXYs
+vPvZzLt3Gzz7wMmnpXceMBLOTvXDcFIXuGSsvX3SKcaUeW3cK8G4xiQJJv8hf5X8212f+tAPZpRfc3hb
+g/D5kkr9qlTXiwrnGB1asse94FZxcGOgW920/pbqOyoL10BAyn2XU0lbfg6fu7CykLn9hkLLrzRR0m5a
+6LvtFN1GrtnSKmajX30VhQXeJFVVVcEspDOyKpG+wEHWuH2biVusC6uh5ahitnB4o7RjobryOJ3TOmda
+RPAKvSTn8sArNpzzCWEEz6+EIfNAeskwcT69KcfaaEq0DbjhGs5Btijc5LvSLbv3U9h4YZBNDACPkXv8
+5V3UBv/JwjcfegZqDT6P7jZFdqZqpLbRsbKIrdHbHrk4AHG0LZmNZUpDti10jEXMj8NS9NT2qDyksoNV
+HqzEprYYboRWHW1JgpZjLVFivyITCLpcHvjGyAnM8xzNP3+zDwM6OeyjL7zhtVY14c6jJyRofRgahXHA
+YPdKO4KuDnEWebUL47te0JPQkaGoIDgfFHEcqh6KKy4lxC/m1kdDNEzVF2piKMBReFqtC5Mr0O1nDT2i
+Mj4YUdEEISo89U8ih5yL6eCYIIrS4xtlxhYFFJLEIJOnoTiJItdutGNIBVUp83kPTYSGgK5R1wcTOg2o
+yk72QOVtinHpeUiI53gaxgCLeCBEgid9IKiMB0Zd/IeMKcYjPsofzomta3aqpIjRUaEcPEybTA2UxY7S
+fjQCmQiHe2WvxwdBBN2J1NvNJOGeNY2RP4pZt5w1wFi2gLH0yR9TuvsA6YIeaGeNYM689Yv0BTdTOv/r
+kIn1e0Bynamw0jnIg/NhTdSG7eM8F+7s86EZvOEJadQr1tb1JIhauvx33dItEkI8+IU4l228PPcl6SP1
+vCVvuGhgL1HMy2FxEYfL+LeokcNkQQ80jyYctQg/LaNkaL2+vOjdqNc4o+m/hprJV9tc3fAAPN5OUDkA
+ry1PpDtetzvRJTC6J2hzvnGRdTnFNI0eNoSQoD5eZUnHAT2QZ4OZqPC46G6pGj+CtpTdEJnZQNSn69g0
+Fi/TT58Fk+pXYM7CZfS52BpQnPA/H3MFRcP3nnvEUbwjmaJ2nmGpgSxVD4cZwA+Fy/hgGJ1oAmUUbYZI
+ZG8HkYr6IbbCrgGvVhg14BLnT8TNcg5z+hPafSegx9zByWcGzrqGyRjDLlcwlJ1WSjDCdclEEzJg1UP/
++L1rKNdt4GJHe6y010tcQTJJeJL1Xqr2NzeaJl7ncafXptj/7vS8SEmeuh2kwnZI/daA1LP4JC5uDamt
+dkg9bEDqzaz4p+C114DXn6MLiZeR+k9NPbcgNwktC//xR9B16qmVrrVlhOZyx1xOY3BbCDxuicBzEwHW
+VbUG9I7dpn7d5xmbgrbuY6XnEbdl5YXOzyPsR7yMFevTNx0xRpdXdLEM2tpH8RkuqoBlxW5nBO8cZNCT
+HxO6FLtI8c60PAr4tkpxc9lPnSDMg5DaHVCTeXCGuQenEd75hVecvjh8EzzY3RoGx2l2FhYDuphqUtPi
+m1NCj5M4cIcuj6j9R8H7zuE6wfu7XqX052iN6Sw7f4/m9LRY45/nWYx/DsOi84G5+yxNioWAsbnxvvOX
+kGo/j6YEK8zwz+NVxk+X+Ocv2M7mBv5Y0tf1CQGNVvgHJiz+eZ2e459n0QxbKqul8jYp/RsAXkahqRDN
+DYVojiPyfL1c/i8o0xWaFKFeU0HmctLde08wXuFzt/chuGIYc8peUdskcYlobpGuvej9Gb7nCrc4WReR
+r/grKqEq5BGeG/FVOKQSRgvLZdxc65UupqoWKTK3rxYzP5fGMSqVL4zyajIVPUXSN8d/j6LThqGRvPte
+UPpSDotWYm9iFB3OFhFempw5U4O9evz/fzw8Onh7CF9x935rX1y1+/jwv80LsPP1bBZF827lkmfrWvow
+P/0oStLOHpUWu0aVG4mPw3jZjfAOaC88LGYCoxoVYAl19kmczOlme5E21QvYqkItyGoTlXeV3yazaDmh
+y2+r169zQlgj/yte3uptV1TxtIggJgSo0l6a8K3Z12hPVLlZe1k0i4BK7SgqCte0JGEje7199+bpweGh
+dcd6Fn46XIWfYDbJHtHNm3wpLPoIjObkJbLYEl7q51tg8cK/Li2veMk795OjnQk9HFZ8PAM+m6YXk+D9
+B8J0cyNKfl1H66grUKC7iFW8Pr0qZTiysZfywOJMbd5KgirDRPfUpsS+Qc2unIcSJ6nvX5UIGSWqTD84
+y08II/FiILrKuavw476rs1bXnPCu00MnUs6u+caSL3509voUBLvC/ib0R+4A4ksi4aMMNMffVvhlVX6g
+PcfFSFzo60b1u66+ztZsJOB7temm69siRr6MolW3gFXqRqSIcaMv52UvXRtpuIQf+KZoblyBvEKkqLPy
+ALgBPJgtQaGRzcZzXEJ191By4GLlFB8YCY/ZIA7hL7CXyQli81x+BDtZLXul68hL4y9Sixn3d5sMIFc6
+NdaiHQmBBAzyhfWiwkdSPhtXT9sQHpUA4AkCfeE0YlYqr29qlwApVkfXKbFfCT85uBYlVHxDa+zu3pUE
+3980tv0rV6KbtKDF/jPpKdfX/9DTpsXvrrZK55PK+om5jtsTw1AfKLCnmNh4qzNIdcQhMLjA3bhz5sRp
+2zlTGfqX7py9ulS6aCwrFZkl+U0JVjBJ3sEXuYlXXnz4KwfnVNUAsfO7aXJ9LdZSA1T4kknN6oaBp3ij
+0j9JhaR8YbdjtjURXfVewswX8XHR5eWncSSKRZZ+IhNOqNnQv55xnbpnCZFrrCzBOZiuvGqkRkasbn9/
+8+6/g7/+ePDjAZtnn9LslG+pEGlS5Mu/IkiRDFWvgeWmaPGTpVndM7HAHn0lmhC9MBZ9/IChg5SlVOEh
+87hY6gZ+7iqVXZHgEV1wb+i2+961mFziWgvWiMshNO6uN8dcMZvRcI02ICNDRd8Vnah+hdhyUHkcnaSx
+7ywXGsFEmsvoLQgxoyj+Fx6sST2x9TH4LCQv30nOv9FuETKLXovf+FrMtYm00TCtKJkgE7ZEoAjqxBPS
+jNGjgjrhhFVDcrCI289zefe5NDsmygDpb0q9fSKtCoczwu9/eLsMC/TlVdwPwg784d3jV6YeB2NykoVn
+XQBuZSNXlY+X4cmzCLdFSlfRqxLp9JdohvfNpOj4eB2iFixYhD+97+AIRhklprG4OMoIfm5IH+SU4nIV
+pccBfeIswOtkHh3HiVD/VCKEsgARsdIdGMvgZ/SEapzQIfqzeA7maZQHeEFtAmzD7Qx+SjqiOpR8irkG
+qwAGAulegHfwAIQgzE7WZ1FS5OibCC7TdZAv0vVyjj5WhAFs/JWA25NnBK04IbXPL5DHgaA4g77xLCJ7
+jDf5eprPsniFpBR5DAAkUCmLsk3dGh+d2684GsSwY3LZ59j7f9nxF03zqndNLnicRTQiRXaJgqZIgzzB
+IPoweI3HIdlRBiMAHw6WZ98HR1k8OwVRln1l8cKLIlim6WkeLOPTyMUUsPah+z4QyDFv/Fwm8c/BdF0E
+izAPsHvBz2/5O+Pys81+P+aRAvAzYAhIhfMASIPdmafEup/CpBCs62QwMrJlCHhtCNpf8jQZZOukb1Kb
+H4Q6wiY5ATKUf6B0q0Fwz5/BYABTCEiB+oOkWJgE6yS6WAHHwCs5sWzCvIDBjOErDBloE0C4IogLfILK
+MIYyYh4pnYUJj22xgLEBYk6X0dnkp8SEJ7r1cetGM7Srqve+6GSVRbtC4egHH51T9WOPUoMJ5ebPR69e
+BkdvpNA34C2Ks+VRKvive57AkCttguIDn4S4LE/DYrboehKJvY6X8rqFJH26EBHhjc6JUbdhj45dGEgn
+ic3mhqnH6brncVasw+XHeXp252/8+xn8lIsaqS8wUBOFH3m24+iTsTkAHBotjQ0CnM28lbDBI0nLti6e
+n5Cos+pI8FCPWMEa8ImxRVuuKDuI+w6m3+XF6xdHLx6/fPG/D4LHjhE0eJKWChX6aXOa4hwaXgAbnk1j
+mFOgr0HpTWEuJOFJlJHL90qMJkP7G9AJqQ71sBFa4EQQLNXHPUQSfUKv47pY9PGqPsZSbZAMWvvHiGiY
+fhhAi7OVGkN04FbmB5N5X7qazua5qj6Ub5FUqLqaFOvqivMY1DqYAAfHxyCQ4IugU5/AMaVtj2pTf6X3
+jttQZwA2jN2GV0BGaMVkMmvNvRWSGitDzkuD5B6jWRJIkvCisDzXqolv0MuktCo/1Kk2/NRuT+7PoTcH
+VaN4F4Zy8lbZP6TEv0zTVVdwcF+Phz1M0uwjvzyNThMm0htvtKg88hIb1O1z9gOvV1UqiEatXRGq8T0I
+E/o1ES/oNKpeBg6ePz94egRm3+vHPxy8O2TbISL4r+ypb+4/OHGwdqUUzkJEUB1SeZMIOxhml6IZJWKM
+u3hOo0sUHzYehndYVAHM7CLvoeIH5SIWpQZx/hzoHp8k2nEjqMl/Rc5M+Z6A0E2IXL3A5Q6VGmA11g2+
+5+68WRcnKcykt3g5BlRihWfCH18ks/TM+GjQRzk4zky0qcXTSHRFIm9XuyoNb/nSFl09To5Tx5BkYDAT
+3X7nTbbE3nvMo+XxJFB6tNh6w4pEhAChIj3EQgD2L3OB/KReqAKHAPFVfqILiBc+yUbLh+FegJeGaok4
+apeWjqVXoPuilzSHKK0LA1RkR8yO0QPG3/G9TKEBfVOgKXkEDfrEVPioKdFN3dTxxUBIItGWhgCyqSUE
+lGIuCMcXJQBjLwoVSMLNUt7DNWUajA2rCqZU22DQAyS5du3tN2y8gig7SkFCdo1hMBXSz12lxJLHqCEP
+dyu7l21l/0039KiLyG51faw1qAwcMKlfYFC4b26qE5fLe0wAuKX+/fng5duDdxiUFRwePT46eP7jy+Dl
+mzdvD8v732rBMsdVXeCkrs9tQlWUtObsEkGbMxVBgpY7X0Y83xtXPRHMYKrOdo4fp1hQ67RBaoFfn5Dq
+ayzMBRT9/6zOlEojedzmQ/1qbcYDiDF58vgHk/zLKDzuLlJ7y1d1VQTumLobdRxNfxh8rMybIghhEuB/
+9blmFcLjMgbZKqNzy6XgEAEbzTmCPQULGDqV8+nhCqCzcIXSkJagaXhSAw1KdThoBUtiOAfVwDdZFGGm
+4hPhniYH44u3B0QoMGDA9KzoHqpxr7oH9hApfE8EVlpjyZ/FdCEBreYnYbGIMgkBPeW6tlG8z7uJlQrk
+dZbtuGsYCguOEBs8FV2FVhr53QCzSYqE8eI9FvqwSSqE2CwDcT4J/Ca2yDwH8r6ppPAhXEshFfoJYdbX
+d1DCgiSSU18EQmk2ecemZJw/xbtKpxUyMrPwxohcgKHUAHlLEJDXP5oPE2krEC3R/3AywJ/KhhDqJF73
+yE3Llmn6yNYIEXPDtzICpKvkUabqc4l+dazMXBciYgTRpSmm0BVH7rFVOeX2jf30JeVcL91nJ91mTkJS
+DVRrnMS0zvlz0aHeG6/gihOYUK0bswFO5FJbjJyc81RIzXu5RSvw0WdVze0b+8JQ72jpGEcd5rdaLS+P
+uED3wphqRXSGngVRd9/I1AAflF6H8xFfCKS74h4GWRm/yG3+Ky2fLyzTcEXXHQG+m3oSv7JmC+pir8IV
+xUs7v8OUpaOops5AiXTN7qn+X1nuHZM7k+jTgc2gRK1IaebyF5o5m+2FSjuRciVuSSBkxFCIBgfC3PeA
+oNTo1Q5QTXONj5RVcaV6NhA+gxuAl96CMnS5TL15d2SuRjBlZ6dox6GfupuEYlGnLejQlOslS7Xs88Z9
+pywCgwtVm+Ul7gGlSUSWXICA5rwplcjtKHZUX6brTG7I0P7A2XpZxKCbDjpK8iLWb348+uHNi9c/VNBP
+TTMVgfelc1x4/hz925dkVkyLrz8IwxEmzoQtoz4zFDDyxGoHXtAn2c5EN0lRotIin9AWNrORTDOCmpNA
+QhwkKEHms7N6eKh9paxU7gYUOW/Im2b7MN6UKaP0CcFbdLupuOCBsa+6HIgwA1VA+DuevjsAxVzqNpva
++dlCM5bWiVYzjIBjIaCl3QGdf0nJXU1VXEg98a26upAYBCSBpaZBiLlywww9tll0DAyazOjECJEAWJvW
+iXUiXHN4NkTuyyi33jqDWsWh9uGpNVnmEFLkUUiJ+53t+5e39uHPtyZAfR3z3bvGwmiUeB9/6BrLOS1z
+ohFsWDY3LMlzHAsh0p0DKsZKFHMWMd0fzw2bvid44O2PT16+eBo8fvvCHENFyLJFix84LKTs8lF1jWEo
+14b2ZunqUg4b7nmR6KET9/5xpP01KBEyGFVibkSLbxgeWs6g0lUOdEqsIL/Rw5tjqw+8QlCp70QwEQ0j
+A1sRNPrc5zOT0l1h2BsKqYnGj/ZgEuOL8WDGt794/fTNK5dkjE0f3S1KRvT4iCWUJKPZzu1KxhLkkmTk
+9pVkPI6TcMmKRVurVKhIRk1RqidMz6pQfeEgatkNmcPcfRLB1I9e8DRTgrZ5UecL7K8rlE1B9caYtytG
+4U3JcSnlC2dZEoUOKZ3SFxTvZWSUlAeqVKU8u9jzAqu8kzv58kUjDLIBYATKstcemrL4Fd5zboNsRLs8
+CGPtZ62MMkXWB0A+kE5ZBOwMEoljQPJgES3nKKZoH2NTS3gxAkaT+/qrNZLlnhv6o02mslRtTTMtp1na
+vRQZ0apLimfFdsKUuSlK3aofvH/CwmXMAktUlDiGVjCdgM9F6AoIw3iT6oNhudUoMMrbS2U+bhmSybbm
+1NpvIUOnaKT8/FsJGU9kDIbEfORImDtz+vM3jirRcjywwaqDK3VRMuz7q1gLOi4JJ4Ed/0JBQumxULCw
+7vpkwaaEbURMfkrwWceiqOlpzLCu9dlcegOOTCQMrkrXswOnMH/mHMBIXn8VxUhPvb78dEhbS+obPlKc
+I6qhy3QaLnn1KHNs2XjGCExDa7etDvhoLoj2wouNWaEtEzvSpU9HsvjDqvxKhWlNKrFx1KiMt5gEZmYe
+6p1wS02h6OYGLuETWsihGvlqJ+yy5SvliUDw17gi3hXMKaM4P4LNfYeq1y47suiAiu03QkvQIn3U3GB3
+s5yCsQGy+97CSgn3/YXlYu87X1G0YCmFEm3l40Q8OwuTuZ3W0XuNCleU96c0d161IJ3wzf33ZhZTo1SX
+XMyCBP+MLE3wRDmafLXATrpFPkFoDXyiGrwen2C126ETQoJ/Bp3gqYlOdxZ8VKWlBufF4I6Wc83d0WXb
+wPTFT5VAQlE/xLI0awZcrtEKfmuwfmhvFTQ5quJN58pf8Yh3/2QtfGyqIiJxXszt1vhdU+V3Ks5C1OQX
+dQwoMmgUKWXJtLK28MpsXE+7pSKo1AW15kWab07bX1C7ddsX1Ip+oD/hGV/rUBXS8+i4Hxi9kpd4md2S
+Nwa6+qVQXMmbFByXBkIj/rzjOkuKnaTRdBzKsUM1jbe7wqt9f8/1nnqp1zpFQLXrI0fXR76u6ziH1Uip
+dFUi1CeGMes1kejNaTOFAMOWBHLfHwy/gDChSZRtOnqvCbLt5YW6hDTqKjGC8FEefL4erbZb0woTdzou
+OhXdg39Ts4vj2guKsCyldZ9eaQrg/YVOIqjP7vnSjkiYGpQRFS3xJexjvgRAWFWutOA+ysnaOm349Sgv
+EGlNfGSa5+Na4sO/mTkAO5UB2K4MAPwdwd+ZMRA7/oHYqR0I9d09u9uOFF7nJYdqRw/VjrivIRBNqFFz
+X1Hro7usb15bds2h3/nMod+55tDjZHq+4x16+Dc3h3+3Mvzj2uGHv9vwd26wwa6fDXYb2GC3ng1Uge2a
+Am0ZZePxWHHKruaUXc0puzzS4ue2wTTlG0ZajJmEULqA5JrMt/v5zLf7mcy3e03mQ0HyfLeR+XDxNxlw
+r8KAO40MCH/HeMrUYMQ9PyPuNTDiXhMj7nkYUZUY15Vozasbj3cUs+5pZt3TzLqnmXWPWU38HJt8W7la
+p8WASxj73kt22gG6hSmw9/lTYO8zp8DeNacAOS2d92tUFd4HDoX3wY30O6x3EwWY9UJZvV0nMdWctM9K
+vYwyDAHGb2Y3H1JIP7zUvXxo9BKNsPb9fHijfkacyF92ztU7tIXviJPsLXwfouR+LagbhBXXgaIYZvZ2
+lQgu90XAhi0bkfBqv/2RKE4T5rnNxeyT8yKXqnNGYNeTF/8qBbqGv6gJTErQgmZYrB5I/TwUmxMiQ11z
+mnmTK/r2JQRgPPotC9WfrroQF9umikIeEUiZUM1HFuFq+0ynnCROnemJmDxuSxWTGcp2sZ8mcueXyUJm
+aVihyOMmkviMTALAf57cbn/k9GieHwaQaZPG6iCLYYmCEjTV6mhf3riMfbsB0WqNQ5No/OfpvyTtFJg2
+gExQM/M+wmsMhGFp4lD0g5lWstR48AA8vbVhqjXkHMPEf579zx8tA1g7cCbAuX0V7rUYwDAhBQv0g7nB
+BSYf8Bg/+/IsUmtu1bMI/zn4D6fcgFMskG2BmmCj0l3M12VBwzTUTIjX5fSs25GvrOZ5vP+JjJpHv64p
+mNZ0n2PN3NjN2abzCvBObeZsu66Mb0mwyq2IlY0d9+2GSq+g3olrp+wrzC7LTsrKZZQX7LK4FBdRcqqL
+DXaf9+salURiN/uw1/PsLkmd1IxdchkFcndeRku1nPNnHJlpabpj711bW50rgym83dvcMEyMuku/+vXS
+RJpCtm2xoQIRGu0Ld3BiiYMq3ev5BkKf7S4NxMfVHjkUyRV9IwY2EfB2SxCgeX+Zgmd549cD7m2UldKj
+1ex4iYKN214EdaWglqyPIhUnXB12mae3tSwssFLcVsfmQbnhRvYJCwylc2znsh/n6At3pH5imDaqPXcf
+3Mj4KPVHr0M+Z9mDXsVM0Ytmi/XSRPtho+vUvU7WIr7h8yr1DLepxEZwROPUO3NfqSvDzT+uhrZzhr0z
+Q497pjL2Xh7W7VgelgZBUIqIZZFA8furUwzeh9r3sPZ9rN3h8+GTWpHa1xG+E/961dfZMCZ+gUpdkwes
+Anm8qn4IbnpD37Nouj6pv6ZmmZ7gWJpHMOnwI0l8zAdyFxZ/SnjnS6NQpOKqGxUSbCehkL9kEhY74/Mc
+VjsRlmu/HHzK4iLqqiw5G6joiDPDaZKny2iA+OvvpcNg5vG+LMTM+0Z2hHIo7pnKiGHFv1LFCdeHuQPt
+Ufwm/O05EnOS67gvx4ejuc3B6re7WoipWT9q4jpmdbOQQBcerYS+2BVNATwnOVtgnLldC97xfUFWcfiL
+Fcy7ixaUo77I3m99EGO4mHtzU5lxSM0Z4ZqubILGCHdxMmkohNdmu3Amo2t8Z3aXHE8GHUKgwrRMsllY
+IA3y5twmdG6lSOk+Ta4y+CWNk26n07OAimtVa4fOKowJGo71iIlzkjwMdKiqYPj2CTucOupMx717+4EY
+JXj/PqYEnI3E5qIlCiNcZ5/4EmWY0tG8wl4WphjT2dR2b2CAqyFihgkz86jrbUsWqoFBdw4jdac2gZe0
+r2EOiPP8InzcD+7ejQVtp3yO4LjfeHUmziAgLXKfRd1pBbushJ2FhoGgNci3jQjTM49WlZH1zAPcRlMz
+YaBA9OwRoGGRkD9jiiHkEnvg9bt42645sOq8R6djpMUOvqPDijIPVRJ8EwyNzFNU5e4jlo+8yQpVvnsU
+DPt8x5r8pOkndz1NIpLIAksVd2coJ5CLc0uFynLj2OqRTDuJd1AG30OfgokBZasfJCWaxCeLawC4V6o+
+z9LVSz8KSA4ThAPCuwYkyiCgG2VEVuEcAVgrGacloiBsGMB7xtzoBfeD0b4xNMQYr8JiMZhF8bKLtXoE
+racuzROFCOAfwRZ/LeOgeuJaUi04NkJuaJKyLmAeMHrdNlJtZPGZSy7Se7thfEUtO4pDq8sQRuD+//kp
+v3u/H5SlJ9ZlGvgqQ907urKVvn6ed28qT7grQqxgG/dPSpJlGSfRzeFLwNlPyR8/ZX/8lEj4ZkITutXV
+SWjzmmibZnxJr7uScY9y+cKzy9LK2modYB27If+ZsQz0yun2xL0DInu/PEfMefpNbYougboRel99Fn7q
+ygALQcbaUv3TpAhj1GXXU6fclafZ4TtfFWyLbpTHOZ6EaAegqnmDKPfXFzr7d3QwUj598w3dmAZfQzxQ
+WWrBqHbPqGW1S2hFpX6L89cvWckxKrJGLz59S2tgY9ZZ46y2TJsTG3dQxDK9hlptu5IlDJKB9S2vaBas
+ITIkxHyoEs+5oqAjzOyTi61mdCyuVjPn4YsE5FZZ4zNIgfmOjzkzM9OFiohLUn43TwMX6BzK5YlKrreI
+LsQJcwSrzaUZO/y36Oqy/P3wAz9fdARQa+KMKmqmvt+F4cYf1HUueKlw8O0j+ACQZ/gLrzWmm307j8tf
+nssvYfnLcadn5t8w7moxM0tZvTbTbdT6oOhiWqJ5Pxju9kxqYcr8WXwWLiWJvkPUCT/ASRJrxieD75kP
+dzs932DY1Bw6lfYyLRkDbhUwQES+DWZlwVPufj1D1lBgq7yaKIj1q5Xhivx6RrdL4AUAMgF+zg6Dztc4
+UeDf1x2REB+a/LrK/s+XaSgnAOYUwQwYyLhxgQMSIgP3g3RWhEv4kwXTOMFUvsn6bIrJ6klOWI4GJNb9
+9z/lF9P0w/1BEeUIvHRVBDZpDg+ljAfa38VdMUDiOMRrF/gKZMbI0A7pQrDg+3r6Jj3QG602rItP9Ydb
+pnBApHSQGIXQZyogbe3lklkLkKhxvNn6ukYV17HsZcMXJtxOE+l/6m+SH44cYvgDN6zYbzQR/iO8Yoe8
+LXzDDv3scbVZWEyEhwX9asRNE+EdKR2Uxkt9yCXAafjpJ9/HQwb+RLoDsBwa9RPcq6JfPfEqU6+yHt/a
+s0SHL55Ux19YDPtMb/AHQ0e9m17xT66JdglBo189wv2Yi+EPqol6MVfEX/hKmk/0Vj7ID+9UefVEbYFh
+QC3BXywq7AT5SkKQxoh8r+ujnjwhTb3PD1xd/hIvRWX1E2uSfj5hNR17iOr0hLVqAswq7kSqwXSjMymw
+E6nkYjHQXMXNSpeIaIhXI+HjcknoScVM8g89UDIBpXLxEKlH/Ci1KfokH3p0QJ/UHXovfjMVcLWf8KJP
+iNKUnUgxyLjHlM6Q/ooLp/mV/OU/q8/+2juycH0gI5UbyHL7HliMSxMkLuWHQ71sBkTF/JCAgM1woJAP
+CmZ8nkV5ExwxgA2QsMgtQJJc1ARKlvPB0szaBE2X9MGT86IJmizng4WZ+RvAhMulF0Jy2QghuWzgaxQP
+LRgbi/khkexphkTFfJBIrjXBoUI+KCQsm6BQIW+vpBhu7Jcs2AQNRX0bYFiuCVYbOD4YcnlqgiPLNcBq
+0zVRrAFSCyg+CGrdboKjCjZBa9M1Wc4HK2uDVdaE0bIFNssGTEhfahSKWMjbH1LFGjtEpXxwUMtrgoJl
+vD1C3bGxR1jIB4W00kaVAQs1QVm2gbL0U5cU6WbyUjEvPqSlNyJEpXxwfJliBJC6PDGKd9lQbeJe9v14
+V+JZM+dxKe8aSlZQ4zJKpXxw2MJqgsOlGvrVRrvwwkCN9inYjlZM3R20Js24umqgj4FCP6DycrPAq/mx
++dmo+XExt8qOSc7V1Csfs+kH4QwjzTmyiQ1II11dto6Ma7Q4W0uxrw/jmgd13z0hJKj16RrYPU7KORug
+rWriBYJ8jtFUxzJi9BxPBInYXsBKvsYML0PzYSSj07a7tZ3uB7KTVGXc66lWtvl83eDjNgeNUWqjc84v
+vwFV6HHEjzQdzkVB6S8MhLCSZ1JrI8wIndPoMrfYBuyDwuKabcdlgUZP4ONzJoqGQXcxiYsg4TcaSTVB
+viqymapgbLMoL6J+iS5myHWfLoabFbVMSqhR21+2X/SnTc9EeeybqvN5vVPG6Zfr3dLRMREOrbsnWBb6
+6E6xosaUgMrYR3zB16GoS+VvSgi56tYIEEUU4ZfyyBCc6VjcECPDWxMjO5YY2XWLkaEpRoatxMjSFCNQ
+ZdsQI3scCAqyxRQjO7YY2eXHOV/pApUckmTZVpKcRRndPlo6NYR6KV5K3g+mabHgX6Tw8k/8zDde0Ev+
+KRI8viudasc7zg/p3ksx5Cb3Zv+N3JaJRKHGAVpVi+/3qnKAmQ4J6u2b7x7Su215wYd5up5PXVivx/T6
+wb6Z2WHsOmtSnVbuxIlyfgFQ/QzzB5jCoGG56w97MtzYnWZEZ8bg9EH71vtd+X6r8mnH+CR7zt30+cjP
+VphrhtHsBd8GW0b0tVhnKeEa9kKHgp9TLLPolPl6JPKA+6kmyLZnvGC6aX4kpMQRCkUyRTMYIECIF98t
+/e5vIts+4qfecn4xxE29UnNIsV9d6oxr0u87i34VLvJQpMJJ1+IlkzLlLtwAi70yFuOulg96ZJoQKeUS
+MXJ5qNT5GA6vRW69LN00ZUXf2Id19YQ6Ubs0d6VUk/kJhhNbpukTTUrqKXyxbnrOl4Ii7mKqcfZzMNfO
+onkMGKp05FxmuN90AI1OQOmuVk+gYZC/nUpEL48jbkiyvG7InE5DmTkGf2hQ1lm1ahfoteq050QEETiL
+MNL7XXT2hOLqS4fN6RI7WA6XJymuKPBf3zEZM0Z/wCHqDrpZ9mfXvHDdqQp1XmAPk3AJ3Z/fmy4x3Sne
+7wSDB32K8cr48zhdQvfxeKXMNd0xlCM5iyrg5UWF6tEo7CjN6NCl0UCIoGOtIBUJalZ0sfeTMI9n+R11
+1mDWs0Vrde5bEBmZ+53StDfPrDqrUT0aTvNdqWZNVUebjrp1lal2VmrZVb8WALf/U/KW0/Az6wbFIs4D
+PBVSpMG3i6JY5ZP790/iYrGegqF/dt86HHM/znOwZL6rQB5qpRv1Zeur9WQ+GL/1zyu/MO01zcg4f/Jk
+yUl9HfaIkB/bWr+GZXL8cQTK2DwNftd5SLctdft1Oo9c2rYqbKXjYgTKGrmMoLOXq2kWhacBI+FM3ORu
+4uXnt4FnhUn75IsPjduxZFhfPZHz+Lfoz9HScRQsMe0cWcxr6owdts74esZOUusx2XUm9Lf60A+S4C4G
+cFO7H8faaBkKq2WsvB8J61VlQ2VYtlQk7LbGCpb3G9BNfdgSdPcO20lUuA7vgaFUkJ6lRw7eeAdtxzFo
+O9cbtIaEw67xXNWMp1gMQFytwowOpKouEV4fh2LVl3dOIiTCVikWfDfiyyNx7bJkoBF58xQ4tWSdj8TR
+xh3FG3iKUpRjp5hS0xWfjJSOrjgFKuybGBz8VWHQIp0zNj+SxznnnH+51IFRXQe2VQfGNR0YVTuwXd+B
+q9aGOQaOVfnw1OZAMeB79RMYWu4HupaRRHrPn3NNxTJX86pZYcS+ToQXf7dTXts+n9N+cA4aX0/cum4W
+9s4rypNnTqoH15tUNZ4v4fe6qpOTI7ayoTXt9Tkf7amXI/3ygXop2OaUOUPIxHN+EgIx46cHJfFoE6St
+kHwt13XZSX7R8Qi8J+UqT5qrlGs0VSCdOs4XdtIPU9t4KHYExJA+bKNaiDzhW0zth8Lq8hoObJ9Hv2LW
+ta1+feco3vfmIBiGM9WImFhXvjXoXWSm14cnH23P4FdVm5ulSyG5BZWGdN/gEnMUGiJ+NDREPEtXHsxJ
+fSJFo4v7qhYi2VjHrvK6XUvvIrrbypTcrW3DztMw+alTwGQ6jYIwmKfrKcgUtvDwPuIAicfPX3V6TcOy
+jPK8BaVHbkqPqpRuSWqbbNeiWvvBea2auQ1KJ9EJlTFpjeRrTeuXFbH0slkuvazWaariWC+a05y4Fpmm
+lCfUWuTeha3DpFvfSa91Jzd763XlBtE2J59+bQ/8GnRVXldz19kJq6wbiRSNK1JfkJgXapECWmSAFgmg
+o6sGyzdK8rUQl+/StPAZwCPDAKYTI/iqaVn65puAy1mWKM6/np1waafbjnSeNYq2TLbJbcc/RvLHtvwx
+dq9BolfthN0ResJ8dBrbdMI3bVZvTYk6J6+DGnVFFbbc/MctmWYLH4bG75Hxe9v4PW5148vNJqqf0NMQ
+XsyieYXOsIaYU9bIO2ZnEjI+nNtKvP5yeVpSgo1P5+UcZvrbb6eVzS/j43k1J48jK6Dz69TKfVf5PHNm
+3KvNyFfipboUPz6m8tbR3IVjYpe/PC09n9vPtzPTL/Dfucj9+iUa+A3/nTsSWRpbN9ZvY0dnv7x3uW8G
+CuzL2+C8iwbpBVFSayCMdiwDYdTOkXK7s7iaNvC2pPiOlOI7UorvSCm+I2WTj3pZNJ/7iLdrE2/3M4jn
+0v1mlu73MgqPcSel80WI9g43YagPgmS7kmS7kmS7bUgmxK7w0Bp0AzFskg4NfHxHbvDt3Y+72g1Ozzuo
+J4sX/GZMmrN8xe+22eOkXvLbkfBD6df8fij9U8YH/rIlv1if5LjutXLIl6p83L5GLaPa+DrVTENIXAZh
++xblvoxtr9TVH9fV90DYUFocI9BWl5Ol6zQ6+39yHwHHar/8tbIJ78ZsfC3Mxi0xM1EbVlCrx81Ebnwt
+so3bk83CblTFzoNeCb/xtfBrTTwLwW0Hgj4Mzbq7zrqbLV5V3lw5Wd90q/yH+2+H+7sSP+cWZonj/ej7
+J4gAWeHSa8Ec18BsmHbj6027Bp6+Af+WNmf+w7mfx7n+AWoajavNtqLllpfmL7bGeFeYNkP85VYX/9py
+S8Jp+3rCabuNcNq+nnDavrFw2vlnC6fmxdUzCDVsdVss/49eNfyLRiO73o4o/3+LG+uAe0Ffa4H9nypG
+vMN2K3S1H91E/s8i+U9bJD9PD2pjVf1PNQ+8cv7LiiQPkPpYWQdGn+t3+vK2h8fyqCHxP8Dq8NkcdQPv
+G/cbGxf/g5cmz8JUQ+K2k6JmVtVWrws4r2JxO+7f8edMwy+09HkWvuZp+KUWPd+S9687Df+9ljnPIvfP
+nIaOpusqus+IVAC4q+uzJOWTDr4I60rkguSMniVbh/bjyHg0P6n36uXIrrhtP46NR/V7bNx07urJzTvi
+RJUF/dB+bOiIXbj0WO2Isx837EYVobHdt7HdvbH9SXfDLl96HBuPshuuXtxmJ5xojiufajthlyk9ik44
++lAKOblOqEl9LIC4GtsYnuorEWd+a7EHe3IjfU9upO/JjXRjmFWjm7VRMmLk+vUljE7qLg3LL0blF8hY
+Hqgc/GAynri6vjJotxpypjtjCYTKG+6Oj08swrVijjJnaLZoJJAxmrYwkmh+Sa7i8VG8xQcVa07YcdBF
+cwRHNbh01g/4bMlSHS9BGAUH2F2jizagfX9AkTzjICJIvm+KOhHlJjK6xBe2Ol1PMXC9TU8Fhl3fuc/u
+0nW+wS6S9bAPnqlicq33XII8d8wcfN4cw0miX8TZNRdERCefNar+w+tn6Xn0KrxozWbA2+qEkjCXWh5Q
+0kf0azDhg/KSFx1Hs7xShniIZ/6M/wiZIiIWl96FRRGCZu8DkTZg9EDO8wdynj+Qq8cDOcObDi0B6Orp
+MDpBwclmRKIZi8QPjSh/+yAX18AQcap1ZYzDw5LVVT8UukLbnEIiIc2WcfjDsnu3t1yHKU1T91aDFXUT
+tj13K41YrZSMnGtFDWK++EWIx0T4nAgQOtEnRvIgFGfvV2mcFJ2eeYiyevB1W2QDokGTvjTxaaQ+bZU/
+DSuctC04SbAgshKC4AMH2I4IcFXbWdsmk0gY0hzdHnqNW/w8tE6tV7+Pal0Ftx2IyrQbGr9Hxu9t47dW
+7007U+IzrrnmtZIQRMYyM1nuc+/vYyf76hTtUl1ku9GQ4QKHqde+7HavVz6XW8kqcAMZsFvPhzv1fDhu
+yYc7ig93K3w49vHh2M+H41I/mc/0x5GTSb8cH24ZfLhl8OGWwYdbX4oPofeCF2/KhzvX4MPdXoNoG2+Z
+fDOy+Oah+WlsfXpgfhrqT0n0SWRLbrXYC27tE8g+oVMejO2HPavlPU7f1HwsvAzUAnTKOdv2rKlyrl4O
+LWdCTVeE2iMnEWtsggBSsWidL891sfNx9UT+2MxNKHLKDa+lA96SEmCykkCNV8LxUJLvc/wYBGZLPUjP
+BN+lic+iJSmTa5IU0L3Vx7Lw9nUKt1MwD8OzyJCu+Og9E0rcb53Axhe+Ki+SHO+80VX4ha/KejU38iJa
+aRFCzPFcZqv1yn0KT43sdjXfyHj7WivXGNcgarzryzzS08sO1jGaEAU65XXBranXDZVY6upOn155BH4p
+EVc5l11dqzxaZpKu2zilQkvZeMyis643vmO29nGqmrVhR6R43C4tDDtj9d5aFXa21ftt6/1IvR9a74fq
+vaWwjHda5ZkhIuyMKsllxjsue8hI7SJa2VUsuek+oWcle9nZ0YfXBH/u+vjTkQfRn56yVlxUslbW2vBI
+UvovrZw742oey/LezefjSNPKxvAaDC4RZoG+K3QBD/6+fEGrMSoHa8qQud0zs5UeL8MT5rU9I1mprbDw
+x1KS0zEqOlhbvjbY7EF5o5mxojVgcvNsmI00/jwi7+wYSopFZOPgJfdErDS32xdbIPp7Ix2BN+lCZYf0
+NpAvT0gv8kI9vD7uV/UZpVbjh4rFxzUs/rDK4uo+FPpaTuS7VcvjO1v/tjzOUkT2/d+TyZv78C/M5Y3I
+X5UcJDpH784uM/ncTIWrGHxn18iCy7ru/JnIkUYfhwakPYO3Db7eM/m6wtOCiAbs/U03w3iMqlJCkK4B
+jSeuNXZN2z9RUgHQYJrE0nAoWwFGZn+t6nuzBRtWBe+3iFx2bgUtXH4KL3On0WdoVISByFEvx9mfpDE5
+WUZFmtTkrmN4pb7U00XkrpP3MXjy0XixWiexC6MC5kIxaoONSN3vQ7SAKVUMmzBRl/yUUMF7veMZjhyN
+NrwLs0tt+4XzuSuBvptJNoyEmAZck/7fX4fsDHmibcur3n5bigHiXtvH6GxTzlrM0ZxHs6LdOI7qU4fT
+ENQk1GZr5UHFr1nji6A0jWTjFCM7aXYzK4B5VMSFkzFL3HAtPgD0H9pW/S47D3cemtbbLlt7u1sla293
+qN5v7bdlJju5dmkNw/XrOpMcUOgZqbURVWHvT5obwtpG5eu1O+pZF5zstxK4Oj078jrloG/t7JAOAK+3
+o7XsNS5TNdLw5Hk6yxvvmbEzzYt5YeaZ3922RYzgFvYx7G7brOKnOlYTJuQuRczo3KRi9tTTCj6KHu37
+86EID54/f+rtL6det1nrkZzHx8dtl6tmvhTiopJ5tWgp5ZiYLOXKQo7/jGSHNu/fj88oZTpv+A4OZ4to
+vl7Cknf/vvNWMbExfBSfmcmvuogaFU/ST/W3lkngg4RePMGrcpOTroIyC5fLKfrC8U5v+dBtApavZ7Mo
+mnefwcgPoP0uxZNR9xQJ86igSwNAeHzsxuIXJlXOT5svEL8G3htS8sco+I1WuxapqjxQaSoLPx2uwk9J
+l3AkzbQfSMyxb5U0Wwg5mC2jMFONxvPefiBz7Fk3nQOdJjhYeBm1QRu+jtp40dP3Qju4AdngjlG8duix
+4MCE6wGHvZaJ2G0lO0vX5GiXZMj7wSpLZ1GeR7m5n4MLqCqj93S2nPcEuYf+CKh+R3KWbsS9STOUF8rx
+EkwXKWEv3kUl6R7PyyrftjtA06aEWCFF9x234jVKcBBF8dykVk8n+9L4YqtZi+lLhbty18fTAT3g+t4t
+iXJFeL1dhsVxmp1BtWR+lB5Gy+N+IIccKoow0XrpR2MWQt1FlPT1CPSNzjWYeIQ16AWvLg/X06pE/7gC
+oyHHy2tMbjMutTKvd9q2TWbrOit9l5UvDzjd0cPNGRuT9e7xEk95OELsAO70G+9awSuCNuvvwxA3zmkk
+XUFu18anfL8f3yBFyiVqItVG/QMaJ6/i5TIGYyRN5rkj65qMYK3TUQjKmYYBIIY+eSjLbG1tBX9qAuZr
+MVnTjuNuHZgmCIt0nfnqcws+yv0ZIPhIFtyvbdhLTRwTbPsGsCXSXuiHjYNdA12S1APdp+PQQgcF6mun
+CUq2V/lJ8/rmEDZNdweUqg6K8ORE3PkkBMheowDxLYXumU7h2tFyecSt2VSHTvuvyeAGol/XUTKLump5
+cIfjkOWDQQXis3npBzZe3SrUoCrASkvO49VK+2et1ZYukkDw3B19dEntQa/o4Iu5rJaa9y1WlWvCKh6N
+dmOiEGpaHI3B6tfxeK+NbM3X03yWxSvhGHFPCknmASinx90OVux4YKoLKEeVHNR26mnB3JRjWqk2k2Dq
+ySotxIPrVnOLppsuEirkbhgf0PNJhYPj42hW5PVSAUnN1/SZl4mws+ih1CrUPYMuvxNeG8eKIF40Z7sG
+htvW/XPOG2lVmKOpH9A1TpYDaLhtnBIaTYLauVydAyVsx9XZzOBH1QnYoLOewoqL+nfVZ4T9lxcjyvvu
+TDxMc1HMGEHCnV71Jh98fW0S7tokbFDnNUICD9yd6RkE51cjZ0/lbYIu/nD0FG+eKfVS3Jayd71eVpQ6
+3ZjgmgdatdvQr4Z2vx7U9SuJPunVp0pAw2HmVfq9MxtnoHnpJe4aP96tdenQdb3q7kW6whEf1CWc6nJK
+9aQ7IY6lDbcGSrDVXZi5bVyYWb7gWVDS558TpPXKwo2Km3Src9WzB4CMLOHPNK53wU/RBbwGPUPtJw4f
+GsYRzkxsT30Z7TdtDFQEh3FZW/Tpre0TaLWG1hmlpsw3RiewmhGrPp/Iu8lyP9qq+Pa2u36XgLKMFd37
+Fp1tfUDS2HfVIDVwcB5ll23WXsENVL5000PT8hu52yhLH19W64ru0d2sHz7C0RSbAn4TLQD+q5oIYryJ
+xzrfJA6sDJtZV2MkTp6OpPC3OGK7fAFAV52yxatfuUhPC0H8T4P2FZGG8SpMQuTh96yHfcAg2NXpCYyl
+dS1mh+8In9QqUP1A6SwTv0qDJYXNM/GbRDQ0gAlQvkPiFug/8YwN+iZdTnmYriV7veZ8E5pITbY4QWsD
+qAmGsue9yNRa5ARDWPQeCGx619Wfh5dvjv8eRad+IKqYF1IjDA8t0qRYNJACi9RDuIzCBkpgifr6uP0m
+tjE8MGSpejhF2gyFy/hx4eMlzdhwuXpY7J2oMQApGt9HjXprsL7FZ2yuySUBH+sC6bH44Toxg/vXibdw
+WFgnAQpf4edZbBSGJ1/ho8XaKAxPvsJ/t254+3v9DW8EeW2SA558hV+lJjXgyVf4WTQzCR3NfIVfp+fm
+xYLpua/wm5lJZ3jyDgqZD2pQopWv8GO6RVwWhidf4b+sl0ZhePIXTqzCXtK9InGl6BxeenFeZSbOq8wP
+ObMgews/j6Ymi0ZTbwdDq4MhddBZGs/p3qFzuvUCRJ/l3a+HsUxPGiBACXPjmLbM+3L/+HGWhZfqibVS
+8UCXlfUDvpG+YXv5L3maVLaXoc3g6Zt3B8Gzg6dvnh28OzT3d4Uaf5afmPu5dHcfU+/bOazO8yjje76l
+mkG16M0ZKifwH774xgB9HMbLa8LFKn6gXOltFp/F2GH0XbaHD/+pAfgUlswwTtBNGYIyJapeC3KfbhSk
+DxMJoKa11+vlUkQctqdNApXokSpOOJynpoHncbScd4/xvzfoTIcq0jP9mgQMqX0HXyTz6ALsEvjvTdqn
+ivRMv9DlgZDat//f0eXfkDxvwzjLu9dH4DS6vEf07bRqFJQDMA4u6YQkF8mv0RjUvncG1ZngABPobTSb
+q3bzSsPCLlZxFDchtoDh7GmfbtZk2JNA/qqgkSbRm+PuDbpOFTv+zqL0IsH14vUPwZsnfzl4enRo035I
+hB+a7Roj8n4+/NCrjNeI68C/UX09/Oqou63rwr9tf30s4YAxtmHAv3EzHCzlgLVThQX/dtrBw5IOmLtu
+mPBvtz1cLO2AvVcPG/7tXQ8+1nC08cDfBvx7cP12sJZoS3HlQfDng5dv7UU1PXVId2Ghp6cdEYopRHhQ
+mkzTcG4sb5erSMafOoCtZEGAiUUngVGhHr4lnpMoLyJoMp0uo7Pc1YoQx4EljIMM6k1KtR1tWUtRc1ti
+6QmshadtW//Ifr0hmbfygBfCLZBlJuqXA1xFUQpMjSiQ+pCj5pHMryCgExTUEPGG9egCrZPOx87+prxn
+XhUjl7g8hCLeDkifEt5yPmCiecw6GtI5uFhFM3SaBp3gbqDqA/+xv+0upjYSGFCajk7wfdDpBNApTHeD
+lcT3nqzQCabrAsYBSB/Og5O0mFCxX/JyHwc8IyiYT6DJgzlRd8tju3cxXs3EjgrBc+dDh7284gPQSBbB
+4edvlEbUbIJ5s9rEwGyCCt0AOHPLRO0XKV7RteUrhnCcZkGXIiahyNY+/PlWVRoso+SkWMDLu3d7ZqiS
+LPA+Rvelg3vwi5mjQw33iyADoypOijQoFlFwnC6X6SccfVmxc/Nhn/yU/JQYRMwHv6Rx0u3AS2uMaTJM
+6tAKg5+xwM9Sg/gchCyehnknN/StyWfwZUVCs+jFBtfAc8dgWswBBDSsHhG9SfCXwzevBzkBiY8vu5Kv
+rRXGaDJbJ28S0abU0QKurub9L2ADAr5FdslT/Be2CamlVZjlUVdUoJsjgbQkACIhENzbBmx83jnIsm7n
+B5AFqHoC1QHdeE6QmWLR4CzK8/AkErAFMMBaY4volNZr67smJW3Ls9X7CMtQMsFSOZ1GsctFUYLxQMNK
+2yOau/vy5lTWEC3icNR325wrXK9X7YULQ+yJlLLik5Cyv6t766dpurQurqeFPz022IjKRGHSYS793lAy
+8Hli6w2dMHiCMDWZNrWgFKcFMarJauYrbCZZ41GfTmkTpQQ8CV4AFGMMcHZImPdGw/He+MH27ngPRBKD
+/uYb8ePbwPiKOZf49R/BVo+6aZybU42rnpYaivPnuJ8Sia8I7isB77+CYa8FlHa9U6Q7XqZh0TROkoAt
+h+k5wXQ0xpO0qTVRqq41QQ5cUvFUL9Q9FMJiw66Ai6KA4kCSK7mwJK+EhaNGDr8ZiEnm95CDfRzVVtgW
+N5sxRlOVWsa5wdpfVftOTjYOZPFxd4DuNxd3UxiI2Kh3ut+w4uB1vKQ61gJNsPSyfO/efmDg4ZN0A1ue
+6PUZO2nIvK8MmafWe91BoRv3RTs9Y4lv7tLTNMktadknOuh8UsawiA9qVEIk+m0MS8IFaweG7oW26Cw/
+EQrwMYk+MYwuFOhVBwne/kuMjal/Ee6srpkD4KK8ewCpw7QB9pdD7nzI9DbG6Ax90TxG1+iudaqgbvkV
+k7/+5LW1CEuxUFdDJ2badGjldC4fHzFBlEBZ6+Pu9S6d/gJmTAfTBNuSC998xYYrMGtg4OdnUgYYwIq/
+AJWU6yfhWTQPfkYViV+AtP25jpHbMhtB+tA8CKDuCpCTikGuGG7TYUfRtCCLSZOTnvdvYzKHrsksV3Zq
+9Tt7OjfL7WWanERiug+C11E0F/gj4ZXtR0Ym2DBZBCWjIE2Wl1TAbIvKRQkse1H+ueNEDV9/nCxnRnWc
+tIt6ckPmrhm6thxeR5ZT0/d+zZUS6uq5djMRDCBuJoR5XtDBWYcYJpMcelTbIdqlG/BJaBPKwCDSxjVo
+Q0sutti3Kepcc8slDMEu9hbUhA6T/BOdVVMCEuwXtVJK57vxXb6qLpfC6SALVJwOzYOH3gaLja4zZlzM
+Witl3/hHtzoCJbpxOUtbEbsht7YWflVaC/mTWObKMNXRXQtzh0JseIsoTjTLUhq09x/29bGSs1XdMApX
+IBbhQy1fyaOdDeNGNfBIu+mAKw/ao9aDRn8Y+cFqnS+6ppzb2BBd4EaHlQFUXliGYCkFylOkyyoqo6vV
+NLTEZnbJvLBLs+sHfTIHf/3x8csXR//LsPz/b3tf/922kSv6s/1XMDl5K+lGVmynTbtK0x7Hdtq8Jnau
+7XS3N5uXUhJtcyORKknF9Xb9v78BMB8YfgxJmc5279me3VgkZzAYDAaDwWCA4NeVPw+za/L2hA0/UMRH
+Qkxsu0qWoO4GXccymkcmzCigPBchUYQsrCwIfsF2wNGv6LwPnSBsyJhVNDzYtoH8drewI63allH3qneH
+/sisQxOlyRY3cPmdQ15LLV0CZRNmMMwUnaifFYqjxk5qj4gd/f7Tn5pDZLqThigVKIRIv9tAtOU3cQyw
+nWQZ+FlcsBXf2LMFiHtYaDdlDaeVglD3Rgko2SH92KZPTHa1Qi1nfbUrHZg6B/wc2uwMdRGzOwR6wkck
+Zu5z1VQsXQJp44jL3u/yvuC9oIAbLnYT9jTQRy35kbvh5lOaVEr8HOVMwkEE8FBRjLJXwadgXnJgWGZm
+HqImSMdfsmbOohnCB+hCuXnbLkx4HKNumFNI1EAIxRHcsm7MYZRVrrAUKTdxqXjZhemWhAD5Dj6LR9gi
+009cKvK6Vq72jmWhFmBycR6oOxjWgX7CPSFmfscv7Fl+Vq/F4+aG8fYZM8+fofqgtepx3q1JF9F+SQg3
+94618YKOS3UZfB5oMC/phFN/xmesDu4T+AF+QAXwjRjDDSf4IV88HsPlLvghX3wxhhwx8EO++FK8eAIv
+vpQvnogXX8GLJ/LFV+LF1/DiK/nia/Hiz/Dia4On5bczLnPmAZylaEK05W8AAcveGL3OIDYHrYpj5eAm
+XqHcGZOzCoBR3D3WfD5Uw05DFtFg0SvcHI09l40li6WFRVcCTX7s0vKz2K5A02dsTSbAVQmTsRazJrxI
+mTsg+AF+OEQgD5zmPSg4Msg+rQOmTGm10LBfteCksaQBPKJFLUDc3DYAByNcCwy0IzcwxTm1oFCX6giW
+0NI6gpS6XefbASPCNiF+LaifSEnUHrz4XOXDixVpVW0w/EYOP60DJlXVemjMPEL66KAWtpRbbuiyUC0w
+kHluSFCiFowUlW5IslAtsLn/j2s7nMHlKvpoxWfbLYnPVkIjdBeEykN3cX4jsXjnsjKOGgdBw/lT/biL
+Fb4hsNMGU4ypEbVQYcF0Q4MSTcB8VQvmqyZgntSCedIEzJe1YL5sAuaLWjBfNAHzuBbM4yZgdmvB7DYB
+UwtlpxYKaj1uOFikATpiE24n6JBbPHtq1wpNrcYO1c7eeC83mavqZKK2oZd0ZFEnQ+W5US24F3SgVCff
+S8K3YhOp6aU7Hq++eJ8Ma/HWMKXjZOq4ocsrN7NHs85buni9BKRr63Ws4hbrMmSNKxBozcLwsfQ2QCMm
+U+pup9yuTr7acPs8H++0Azzm5ObQBg3Qr3zK0OpEpU4S9bWPqR07rSSAbL75BqFHMeLaZlloNozRWyBT
+nt28ytNqQy0TJCIf2w2jxzeiZoNNQUHBJKPsoIF4bAtZZp6sgVu/JyoARiNzPeQmm5ECbOX/VAtdmt3s
+W6DoJlqxrUDNEdjhVN1gz4tz8QsCGmxbYYUooiWLZsDZ3ArkLEPYqCAGwEoAso/vdgYyB0FVnAWF3Qsh
+07Jq5HYrAi42QU5iA2GKzLyi+IxNkNM3/3l4BgpMxEM7fmFcOMUrNMzdOKCey/5aMZsZ0K8oUDMHSkl2
+isP8KUyylT//MIsXD36i3wfxgm5rPrhK/OXTthUg39+LuX+ROtuSDG0glAYEPj37+dXhhx8PfwYHfnzo
+ET6HPx0enakP+CA/7J2dnaj38Ju/PjrlX8RjT6I4j6eAA1yPlv4Ds3i6Wog9P1lijb+y9535NEYrLhik
+zX+e99PLk7O3e6+8g+PX3tHxweGp5/ECm8xaDP7Wfea4zPiRLrL0oARdFRM/xtLJWV8K04Agf27+FqiY
+C5qe5/40o+u0H8MZ/LDULqhNB5tw7bNY1kQAtlt01dHW7uTCj8J/4IZa/X4hSqcaJwCPIZj8RZAufUzx
+rmuN9FtZCmqlVgl8AycreN3jMhS6IpoU8BSYjvPTaRDN/ChL9+MVrgjbzPhOCFea3T9iLGZViuztBYgP
+nyGgUeHDP8GnF6ooxOiE9yOEVgbzPIHlDUiTfFkTGoY6uynjGBiYwpVcpNGYiDdk2Iw1THiraT02gzEs
+6e64QNIiRwp1M5gdSbb8D4MoBvmw80fgERycrT8Ip0yFRhkvmIhaCLzgRG6xnGsuyY9qjkPMGBc7S/B7
+ZZ3DlsayQTiyFE2OseEimkLLkDFChyj8qgQ2FlFkvYAzK1kLyIaHafBvObF2vIdeHz5XMEkRKzQJSj3H
+Ty7EvposjBXIwTd+wxrqQZIFUXNM9ZWZcexpayNhzW7w5K7fgZGzfx4JBHizEjPx+p3/fujlAtiro96o
+77PlxQK5SzCVM0kJ2OGkEvAeq10B/7EuMfSm1U0Mp9WN2CDYMgln1C/28I42uxBbzruKxc1E0tyO6oWS
+Q6pCpSACT03cpquCJoQeuBQ+owIj8Rv9EOB8Ht8LSFppEmxmvZMaE3utFS99bI/h+1aTFxJpRB49EKHa
+7xRpUX1/RzgkgT//EUoopIw7N6v+TIOV3gAbGDOYI671Qxub7HoeVOKiS0ixmsdA0lsXcTqHYSnAVJdW
+mXQIiXf4Rx7My987rIDEgVVnLl42LRBeJSV6mn96mhZ8xcz1shzGdO6n6REkXbPoia9zBC0OltScdWFb
+cZaefwwN6f6nyoOzMV6fyyPqEaYKIavNkl4p9rdmwo70IGMyMb8YlK1pWuDmdPw3J8dvDk/OXgrlfu/o
+AKfKy+dvz1y6Pg5febwT0Zex4eSq6CYG1DKJl0GSXfMka2UgZQ4bNzA/E3uKySoL6qApGTFEAYjzt20T
+R6d9JuWatEfyx9Gk5FHT/NBifGss0aEoh5uQ6REmoY4xEGRaGTwEcdLCz8IokmkyOUoS3FjDpeyC+Rgq
+ZSihc8PhJ8Haac6XciSBScc3+cT8rXSJkdB5lm8En/gXPgK1ahS+CuFoqi6TABo/oFSIuZr2x2auW66j
+8Bp/ubwK9kaxPqk8aiZoEqkXsMoh5ny5Yku3Kmf7P2EcUA1Cju+Qv6PrEWxMG9hRbVQlCM1lG/qiMxcw
+J4dHB4cn1dJE6OGidv8T7LCGHg7JkVJKlZcsfsRYBJarLCmB5ioaFSOV1ixt+iVcJyNAqBYVPcg5KliD
+48M8HqVmPGYqwxGHH6FPhPLbxsKmbXwkh2i1PFN17B+tNbIB1gu5Iklg/DKIuvmp23mndHsNF5/fq8ug
+9Eg7M7uI8tM2/VHfdY/MvRDxCWc2ZB8FBc/LbRI8SKMOWwFNQs8oLbN4IVuQNJcNDS2wMpEplR0BbyKs
+D4DNhyQ4JwR1ce6yLyvxQQP7k+WlKi1lo6mYHllwJr7jLl+OEwQQ4K7PsMUcF/GXI85EMwxGDvbhPAAz
+m1g0csWHhivUVbnyqn1TjgbJXy7n16R/S2QYsyqwqBHICjmTARVQL6hImStsfheeuw2iBkegIwZyHwr3
+5ZCqmugma+ZRyX3t4mCxbf1/aL4ezTFBYUuySwNDJcnBnjCypCQaHAh2K+qUYCGvZOSWj703b179TDvQ
+6jWkpmlqFBaU/M00+UVvPJWLGN8csKg64oUdTUeruhTFBPE4xd2NQYRfh8qHidFrOqsv9aVSGjpAKaWW
+QdoT2mpDRJiKmgcgZlAjEPz6CK7HshZtcO7pYBD8FpFV5Jlndq7yBhhrw8pnXV1P1igJ71I6OLQV1ZYL
++f5UboXVTMNSgEaef1R17A+vbG911TazBCHHaONPg5s/n//gR7O5vM7HVsVL9VpaBop4KlCa0WUVuEdh
+wOrdMJ8KVNXMhcLN1NzuWE8QhSGl4cR+wg42gKicuGGSOEjpkUPDY5F2Crt82b7uRAUGdkcX/kfCQrbT
+L59YWrrOZmvgLL9zjBU28tMojM5jzrM3tJ8vHVBrePJB8aq7A02QvNM7sUJJnqOTMOJlEEscb84Lbo+U
+ZBVR02YDRC1pvqENg0m7dfzRHiy1KXxGYOSjvp5esedjSyO2l//ez91Gr94AWlDsz/38vWgZGUnHqABj
+mV7zVwnovoda831m5jU3zOXL5SxyWqXPl9O7iA37qriqALRVQ29f2zRYyzReLMCTlrqSa3UlS0eR24di
+6BNdvNCI0EZy7ciG6N8SahU6TJsJPY5ka9jcKLCsZB12fsKLPC3K39waCQaeclVBfimoCvheS841peMe
+N10NyqSHXoqCbK/MzlW95BUW8Sjdq+yl/pa/rCU/WEsEN8riTS1+gmkRCb+a66G3pVLB+taYZJV2O06/
+vA568PLFi2rlE5JeG+sWkUxoi4G+vw0F0MGAjlfk1yEdlSorDr0smIk+Bm/giwwcqiIw+5mfN+rlIyuz
+8KGgmogaY6w3NIoKOwmDt1pClZyQ2b0t6ww27LwrLe3WqMqcoanD89HmIc+uJ/LlRL7c3BC0fw5XIQTE
+63gFl9YpMiDgEIA8wP6lnmAj2CqmI++l2KCE4k126WNMEISRZslqKjAIxOqcis2VWLyCmZeGF1F4Hk79
+KJtfQ+RlL8x6qQCUeVdxgsFeoJ2R7BAihwbEM2OGkr0nW4oZrN5yKwlmiX/V00M2oQ2YRQmB2lF85V0F
+3kfIVYE4Q04s6gwGM4HQjKngV+zoyBjEOBIFWxhSeC+5QPVhBGeh2u4yka8n9muQ61gjH2kJ2wYoeEn5
+mb6kDBeEQ3rOV1NGLagJpba22Kqm4EElDIKkIIgHe5GGkqziRFnwfGOLMtSU9XShiWXik9aqN/as3GDz
+Uhr7JvKvKSwnqURJv1ZRZb7Fk2yFYzU3yNNqxQwG0KBghKwwMwpeEcrMZZDISLYqMZ0eb5PzzefaAU0s
+/W2S/wbQyEtTGrw1wFNtBGQkl4OrPjpNlga0jiKg7Zga3TJLJuvLO18nGjNt2uZMVYLIniulLJq8N6fV
+Ns2JKTYpdHpy205PXJ1mg/Ruojs9qej0xOr0pLzTvDcVnRZsBW7Q3kSKWSNZKewhylbJaiPv7DJM0aeE
+RGwgIRj5CoWFxJLOkeg3yETuSE0kRSQhHvToyRlFEtZ612iGVcjbnIyQCAsY04/QXdkzFLX3lay9n0fz
+O+8e6C9XYRqcBOcYo6Bv+FJhO/DGNlvrD40khHS20firygMbdRggD/PGoX+8NwnmuHQEXCAYwXaqzOoT
+/ctesb2H3g43x5UazGVkEwi5K0ObqOi6td1Cp0/dKapYNTIFDIz9l2kC8eRTGK9SgCkW7wzi5Fz6nwLN
+ZFoHWIj9qZcGCZTOcargTSqewn3yS1p6c8t/KBSIWKkAG2XRXeis0SjB9EE/d8y32nfsAFjgGWJGJk+f
+rKpAX258Zkq2qXevqGjX4oi1DYoamMWbgM6+tD6X64blXJa39P9npP8dRvpHGLV1hpufMBChYT2RBCU/
+yX8dLT87KfVm0VPdH8nd5MSggwUatan8Q1WjVLNO3JpQWH6arha0tAsQ03gBKwzebsvtRmhhZm48heUR
+6JqzMLADLj8fXE57feCuALkBA+o4nTLKA+qcHR8cey9lzgFw4oIjPewIxovFBZR0ryEJgmWcpiHcgRNC
+4O+gDGVi3RfyB4BRWMn/CtP/UttB72CF15qAFmJMQc1BMotdOUXSxwb8Cz/EdD64hUddSUBbxDPccZKR
+cxYmAon5tdSrriBfGLaHwgmR9edwMknWSu8vUlh9Z2/GJTeT56afBRdxcm3OM0QBuZOex/FHDwZDyUPA
+Du0qgqhsmPwfpb2LD8uPeSdFlIg/5h0prbfcE9N+SedMea/L4gx9B9UgxhL9oOONIQKzdmU4r9j5qAHE
+fCXxtQT0TLVndl+QMyCMlEV+ExcRsjrBUgSLRRjh+MK44GxWgaH6imITE/+pHAWOAaKkRI0atzI7GO4O
+VEFfVWexwlX6AxOee4MOyfoWWMu/FIH2etWlrSG1vqhh1WB4QgQN7XePOa5JrK0jeHIw03W9G3mSmB8G
+ZEkVwUEC0snq1fuJeq/GDTcxYqFGpyyx4RbLexz1cMEX3fAnMeQlyRR3/2Ri2P2kwtvjoKLgp2NNQC5P
+CkMkFS9N+br9RAG5CJxhi0LvSvnEYlQCYSxG/myGLJhmq/NzNm0nmglZzLL+RE/mJqw5UW3Sr6KgJXFS
+sAcaReANmulFx9UPrRQkcZy91DZCHNV94xkhKzLfCBpgVmRSKCLBvCII+/nrIgSBvk72i5dJwLH95fdv
+Tw6947dn3ssX3tkPh+JhT/z/5dHp4cnZqXd84p0cvj7+ae/VqQrwCPC+RbANbIAgPrbmPl7L1gQYEspb
+BERm1tBHm/jtm2YNkAOIDdv0NJ2H0wDhDWQr2Oc3ey9P/vLy9JCs2oKFT34++wFysR2+Oj2UNFWxGDRc
+SU2hEEhqGyyF+MGnMT49LV/wqaK12gPYhw/VVKbh4+MoLYJmL4sfWAfRr6hE6ZT7WgWq/AJKlbuJmMyH
+Bw0M/jkFuA3fo7ORbYxUF7poYcbbEh6ki4F4CzLgzGGECWBodMReJ5N1oRzG5vJ+l8M2hnQXQ3mHYkwV
+vRsce7RcHcrLFeixJwpQA0Iko/F07P2kzpAZMDg5EL8/eNqCf9vJe5u5S3VfSibdVsXZi0o21ndQZPVv
+CAchvyfqBZt62I7FlFTNrEAcv3cT9VFVRa1H7BzN9ZUJvZqwV742s9KFCSymrZDwbtO2Wokts9jzAgNt
+5vUzAK8lPZtibBpJexD94bxobdzMJDqqvMQlneJesmYm/KFMpUIt1L8E3XwHd91BBgHjiKVRLeZq6UhT
+8pWot4fVnqmRfygg0PBpqvFSE16KRJOili5mqaD+EWVXyw82gDBhmLGUHFf4qS7J6G9qNOnjjv4Yz2ev
+1VZPDZcCpikE6E3K0ZtI9PLsZqM3MehN8uhNGHqTPHpCp1DoGW6y0aMRTK/8pZgUMEyTAkFxIllPGq74
+rUjQkEMltk4uBbZBr10pPPOFoS+a2ydyjZQCtC2nc2xpba9v2Te9KJ9d8nP9DIPiu2ySmeeyeUZd1CNU
+Pial41BP00ktTdcby3YSB4ruNKaH3Mr5pRzr5MvmI+0Y5RacxWinidZCWt+Kn3Zq6TfMc5Zr7htZyYRJ
+50S+Pbt2OVCtGP0uJr9ygJXqfuBn3koI7OgaxtAPI1AmycEAU9oYypMPhCZnhapUob67lKS8gtNgsDEn
+QWGwm42TpZIofVWUe0lDbsIhlGl8phxeydQPAvS7Oq2vETNizybonG+8b1hL2NGJ3QGMa87AMPcDQEzy
+cu6ttBixPhTN2HX71ziZ4aEk21/i1JV1xnbnzHRMxwopfGlwGDN8MKzWoGojtv/D3tH3h6fei5Pj165d
+GYzHm+PTsxcv/4qZcYP54i9Pnr+CcDgs8HntuJAnWFQqI9TGTd1KlyC0S7RAN4IjWS8NArARhil6000C
+sRMONvmRgoRQOg4KOhJYJTQGBCiA0yeKXfBJhVxQDl8SWRRI6OTFzXFkVFP8gSP8u2dXJJzGErUbGb3D
+dFDdTEZIefcl3dcrP5WSZCYkTjIPwfnXp03KPSIB3W/W+USodE+Lk1YoKnIROK+HoNTsLHH10aJaXrKm
+cf5U9Pah70bisGe9pTDvgeD4jxo2PS8YTJoApgN6WCqJCS4T/lyI8RkwUaDYV5A2TjykMdB2tlrO4Swh
+APo24W+xUZATpZLTc7a9ekHNp01oWTnudrLwg7MSm5s5AtM1cTgtIYq8RkdkdEBpcz2bhwqoax6GuWmI
+gOvHGiaOHt5mM0dKBS42Ws8DOWTWdODzQM2ANqRuNQPqh6P59FCCp2p2NGLjktmhiFB2K+3goDIqGv7P
+O/QFxaAIWtUQ58i7jyDvw0FreBFhOjsP11j0nEp8MS9Sfz7yXmYeeVrFSSbUGzyJjMGIGi7CfwRevEq8
+aeJfzb0YZhI7ihQN4mmHeAX2ZGhNDH/fh0x6pO/Jo8iC7gSu2NJtC7XDgTcPhOaYeunHcClaX03R3whi
+x4OzxWqSJQG63spjUuyr4FbjzaoS8kWxdojGlyPr5t5sdkDeyPyiWs5Tyb4UzqpQsq2qatv4v0+luqJ9
+szt3/v2LBPELjEIUR1vBYplJH2FJ0jCCc2VB40UcxVkchZA653pU2jE3liEw49XQuwwvLvNd5XNPViCz
+OLdu4geVyFErtyZPkYCel5rS05pqKm9r42xwph0cleuq3rRVj5f0nSWY6GlukTh3g6vQjlI2dUsSkL6B
+au6Jqm9B+fWaUpdfg9ZIu9o3dOutG0nLW7hiMPnFFScRlFLUEQ2kcmJ6n3dywQLV/i1IMKPs5FAokrlA
+4BoKqytDndF44yZP6VvTUplmYTumD1aLs3IAm65+yaQciN4CrnlnlpCdr9YFumgUcMIVUuI+gbjPffHr
+ojyoLGFVY5MWXUpxaMAirYanOnhDdXCFT/vVV+b5pXpEiV2FNS/t3JZ/p3PIv0P2+vxZkvd362q9wF5a
+dxgmgIbe7f/9vfkcBb9lr0R/n8le9z85ThxZQkwo/c0zT6ePox/fPFMAramBdzNyQ2B6KvAZSuxK1hQJ
+rzhLbsfF7Kof5+Xctb45UkaiUIi1EtZEe/iDM4EOffYfPuiOD7THeeFKU3aZCCjg93IIuUH7vfQyXkEi
+btxKSs058H4BCL/ARuAXrPyLtHTOQ3TCC9PewB1n4s3e2f4Ph3WRJuRS1Aez2IGShvF8JiNAO7VXve6b
+xRDk87Yd1IlBljsgrni1bddcM+ToIwdZoGTVQck12do6Va6edl+5B0ilcrvB4lir1dpavTf1kaWyLGsU
++7ye8oBVF3NtmM+ecTKb1dm8Q7a9MloAC7BlDVA5tcxCKT14WUAro3lb67z2bLaydGqIJ/gxB1fq2jkV
+hq+uyhl5XBWlJVeXAx64gyrJGx5j+67ucu5PgwNRu79tNABigHawjQCo4t8SWthd56oT13urg0o5tOHK
+SiN9VT+naqOoU/fp66BYYbTswaVQWnk99aYgTsvIyP3QxvzKZw5XtXO0bmzaN7Ap2JAeUgER3wwa4SHd
+1cbM5UCt3jlMygSJKt0+KJKqaRzGRsW4SE1IyAIjNdpXPavlJBrYKgJbnvvWhuVGZwqXZlazUctjwk3Y
+9zpB6EYb9NSmsHpa8g1h7XxXNoAq6Ydf82LVgpAPYIWXSwrjpFQPuG9RJq/pIoYWJTzyUEEROfHlpXTx
+V0irKL6Sl/nvMV2jZHXIy/LS+Ie0RCZmW1ocJhVRXq+FVfEUn25a1nVZoVQKlZrcXRUc4pQdYbKekBMK
+/gSenOk1mE4kGQ/iWkJMKGvoJWVghbzUK3UlwUvZR9+UKM7oTeb4EOiz8VSGcU/Q5F6Af6jPN2ki0LxU
+7zjTKuB4/cLYJRrPpU3j55PmHUOxaKgPvMvkqX1qnFfMpJfHM1WMaWZK5NAXI3SQDaX1xD6xQNm5yYIm
+A3qbeJFZcqt1EFFUZYx8okaf42lRP+LcwHZ+7yRqKPTeD2zneWsk+XWvRN74K7J+2doCxQd2KOYZ0wcd
+HJjjkCJzqG1C8QS/fGYWwmtI3sxFNTyQyV5eiK8Y3nBQwRmmwTrmMCUb8AdgZZGwWy4RJW2BAO1p0/6b
+k+PvT/Zen5LDwDKJLxJ/oU606KmPDrZHMSb8kYmQZEGdB6isxs9BqqrkIrfIUufi6z6UtEMx86w2M0g5
+9JcEYuzKS5A8tYDOfSMAHehou/bNOFVGXW1bxLPVPDjCgNAI/XWQ+RQ4xooxNSXEIACEQZO3xEENChGn
+LNDl15ekiSCKk4U/PxXoLvvQx6FXhqpExxmOCtskQHu7nHQWMpKSjZtBXfqmJMNCmvlZOFWD+clanCNK
+U1eZ5OxtFs7TESXiKsmLWCy1XZL78M3cz8Q8XXzYX8weRHEUYKRllh9CcumwTWqroYwaFGZj1QsM/B0G
+V2MrSYQn28GOP/VuoNRqKSgcjC0WZkUlPFEY84ylq0k6TUIVRrysRlWPT1cT7PFTuMBwM+ibs7oXr/a+
+9/Z/ONz/8fDklOdgYZO4ko3ZLNTYACmGOAnSYU4h4asESYGKcFVKsRSgrAtsAeiKr1VUNCjZO7sMvF8g
+SYBBC/IG/CKfBQYB3VGPIIUzNjv6W4TyURR7KVoI/TkcBocZHexGMaQ9QQlPTvQQMkmaySYBXCX10iC7
+1yN9OfHTyz5Hy9aq7Blgibk7IqrO5+eI5Vgk40ZvLwmwp2JlwGu5sZdGgf/R870jtA1SfDHU0A/ni++8
+syScfkyzILknqYnkzPBigjQUFkdlBI6TcBisbisixX/Jrw6/eJNVhmf9eO7yi5QZhMkvI9bgWzBWyuq/
+wEqJt5VlnKtZTMEJ/CiTA9+ju5HuQTPslgQphLtvFK/RGs1zuY7R6BCYinCNjNVVwQ/bg1qu16MUGg7O
+aqYCEhu3V8FvSyHK5Xzg00EMfwhBkWJvGkefQDmhoA6ilhh1mU4BRydR+zX0JxFDMJkHi/HfIg1Md2ad
+ieIorbQ6exYYvTYKkh/OXr+ShPpmFn6i4LHP7i+F2iqotjUPzrPxTrB4ev9b1fFvLndVqfM4yraugvDi
+MhvTWivKfTP59jhepve+eTT51juNFwEtV1cQ4ecqQacQyFovlrgE78hfg2sJUEzy5uibR5e7prUluH5U
+IwUpT/iYQ5VHoo4B8Eh069ueVFXze2le1wh67+j45PXeK+/08OztGyttXxN9Iq97UZl3vWAxEdLlPU88
+ia/knoImAg2RNItFtsVLJ6bJm0qiomXsxvgzVegJasEbmWmBee+5ToZWCUugYqYDckKDb7Qqm2dr3aVk
+IkizE9SmwTBmrB2w7msVGjhfEep8NZ8LKEEQ2dQy7/ucWHfQS5WkcjSJZ9e36a4FqLzfNwUG07WNVWLo
+Ua2S9U7lPpAdfI3R0VleK+ZhUJ0wwboUr3ZcCI8d9MB5pMCib7WkihfSKxTr588CmdGF79H4+iI7C1ub
+0ywQhZgxBXAZerXN3OhpfXp2+ObN4Qntx5K9FyD3pDqQBL+ugjTbi8IFxr4QG9ZFkN+ab8I+sbTkJuwY
+9YiAX9bEn34EZVPoP2fhIohXmX499Ha2t7e9R94TsXhhEAJrC7dWP9XmADYOMAa9o+MPJ4f//fbwFDK7
+6gDBcoSKsLRJ77cMhxUDeiusiOtfnh8JtVCIK8lc6lwJm7RD1PPWKTZDXu7Srqr31iyvYJr0FIlgnfUe
+ykJv5uj1lgTgmkhrqFhLv7nMsmU6fvToQizVq8loGi8eCQmwBRLgkdyKbAkaPgrTVAzYtyNShAY8evyb
+w6ODl0ff53AVnNG3uzxQKcckcQ//enayx+hrncrzmaLpOTAn9yZSK8bdUcMy1JVl2XLznGELU7H8+FVG
+OdaHir8xPy0eJEnSwu7T2O6wzU1WZB87WgPbwRIXL5g4Qr8sAvnMBmpUvHLaw25ZI5MftadoKZaEBmsJ
+MTCb+AeHz99+X1jN2Z6+/WLeco3CgY+XQgycyDM3sTIUxO5nX8n6AtV4Pj/z0499jd5g4FrgkGp6hbJM
+PvZap+GxZY/9fBmxh+NVVqoJlKhMjMBFvelfRuZStahT6koL5NpEtcxLZXgx3aKcMqdCyAA+EHMbXjyH
+IHnRRb+47pnBmGFWcN3ISDyrrZ74ae20F+kFOVVNRxdBJvPhpM+v91VWxX4PqSP0lq00FD/9ZEtGeE97
+g3fb7/UpJEBiJkd4HMkux0sQEObFD7h5sVxlVS/6dVRIV9OpEFH9egPboDQJePVYc72PjTgNthpnPcTt
+dUKxoByuqxauoU/SdV6MSkYKrlodDDpNtUxR1NYy7bpDq2suJVMC4oCl4iXt7UoNkwUV9WvaY12FexJz
+/zrXV3hb7OzLyO4uC8sBFewu50A01KoVHN1jsMgug9lP2LyADs/00OedGmoMFOsNOGrlRDNVrFaGnhN3
+Rjw103PUoyXbavKAvbKIqGeIleCGTy1rymk5yG4CVasz8maCZpo+S0rFyMJfc9zZ+5uCdG7Qq5ZdUrsD
+0AefWlmHnrZQ3e7hi1GYHsjBOV7iHWZunLOiityz5L7ZIggs1CTn9NH6bizgYht/EStMfNUv7RQpwAWd
+N4cGBg/BfQoEfpEKClw8IjjqQthB2TK1aXT6IroVmjxp8fz42Km/V+rukkYA7KndD1iaoDNSkqo+2T1R
+b4tLf0PafnJvM8G79s/bKgoSeFM+fqKewHmXFLTRVTjLLr0t70p+ujafLnHhFd9UbKWZQQqEEf4YAbb9
+Xm/o4f8R3DMw+YHHc29IMPDFJb4AwyA+/oaPWbzEp2vluWBYgeAz6nHiGUxGhpCbGxZ7sLPup6b2KAsz
+zOLVU3NE9NA2M/PSoChToq/Rwk8uQhDDve1eRRFp/tRlSq0unyoXBhtkucGFlSrkogKXeUGSqMcSulOu
+JU9JCEpitAgyDOcDAQrxxdVlOCWX4693tRSQI6yCjY6SYB77s77e7hl4pvrjr3X1IJeXqP+7B4cGY6/3
+dtmTd8odSZWqWvhiu0ELB0CFRm3QxXFjq5/HaaDsJ3l2slKPcR6UtcjRQJKtODqrCOgnBgeLQ2kOw1Ge
+n43WoSVbL0uvVoKAg4T7UEbS8CY3PZWEw8ineSlXKuTK3WEgrPer4/0fKWYmP7B1qjpCZ7O0HSXzwguB
+jFY7XtJTn9UYqKBwAsePcqIeIf5qtkLh8zncSFBH+fD1TPnxclxM0gwNUpfjI3ZTsoJbKzcm9YJdiFE1
+7VUsCq6eG4yx6OjDNh7BYWCTIlLko24qPTMd9b6zOzXmqKudnyYQ2FcZJD311OWKfq+E0+D2NxF/qElN
+U9FUy7M7r8MbNLHMJ2W9YZtINXSM77hsNiNLprvqEsAVl+FsFkQ9du+Ncj+U09RymXUCtrAgwIwZGXwl
+AlUwaxr0nUK6SE1R8e/EomjZIJjbBn3zjl01kP0Zl0Zpf+Ov0sByw1WNU/QABwKLOKW0bSn3zJWneuuB
+9OdzDbGCJlUwZCJFtfpC/OHKmyqmSInbmzXY7wotve+b2uhmrhuG2ORFvKukVpn9gGdrNMukSUKjVAGz
+xjdb9HPaOVIjPUVLjLoAy1ohE00ProXlP11dBsG8Z3R0doNWCKnkIkCbDjtGJVkjw1X/rqccOnEqAxOB
+hkMESR9lX9qaid6F8xT7qxBm07IQ517BRoiM2FD/Xh0AecILM7bgd03wHSknK9URZAa0s+nZAjE6Njd6
+03k4hUxRvdlkrn8vYjEdVQgSelot9QepB9KDAIUSlp7mgS8rYQAHPOaHj/hEoYPp99SPpmIM1aNuaxmH
+AFA1IR+pcfkAFOWPq4zX1PjIZ4mRfpYhRNSjwkMAmCX+hUYYHtRfiTf9lNDhQSECv3UzMzEmCE7MEkLb
+aM7wUwxOmmKBMFqusC2KEYLvzsWshyQOvcl8lfQ2IYCNzMSrB82M4GgaR0J/7sv5MNRzBgThpknVRwFk
+ZPwYuD419uBf8UC3F8Ye/RUvFv4SnezE38EQTPGReHzcjyOwW+OKMyZ/DPG4FD0NkuwaK6gHKOer3If4
+RT9Zn45OETB7HlDzbzhU9ozozP1/0Af4ARXg7y5Cwl/q1WPx6gt89Rhe4XVfSjQoSuonBCn9TsbKAWWo
+X2kvq3HBKxeJwZw0x7bP5iboZTcw8XD06pwkH5Q4/WrBjccNqJwb98tygNL0bOCOCmi38ddktRCFp9Cr
+Nt3puBctnU1b4qyZwvKsdSOm6zRsA/mxBXws3wL2bkvYuy1gtwTdELK86HSsszD/nlvWxpSBZejZa5p8
+3XRw4wiY2bTStCdx1LgBAfUFOFwbjtf6GbiJkwu9xxyW9h732+HNVMphW8oaFOSOu1GvUpmUvim5ZNL6
+RrCZZG/RAqvVsB22wLRoh9Vq2846rTSXq20JtmxHLUHfdqPREG5GVvSmgDM0fDeCHLUT2VFzaW3ERW5i
+Y+ZlPpWLQssvCqzJTZupp45YpcEMHntNpR2bV6q+egUwckAus8X8wQ/wT4kW0lpzeVoHvQXQaliT4ALd
+l9+UKBoflts4OFh3uQPtLbefljg3FFDrmzjRcEdlb5f81Bx3Yz7Ey/Rd717v/ZBKLndGaF2jR0X8d+97
+dC2F32LBEgbrRXoxJNcl4ixjtFBotEFkYwPUK4GN9Fj1GHhVwsJO3kqij3QjB6rjYePmRuWFGqD2rkK4
+6cUa7W1Rpp2ZQXGJIltiVcNwip2ceKqG4hQxOVHk4Nl4Zgtuu4F+Dwr0BtUA0oBo7oIhy7jARP4nJwjx
+3VUd3PanOa0gD0KWcYIBHx43ECjhAnG546x/ueOsvOuuvOus/Nhd+bGz8hfuyl84K3/prvyls/ITd+Un
+zsqBj5elXACwiAvIeRxnNUCoiJN1ZjMwobiZh8q4wMAFqw9OIFDCBWHprL10UrOGkk4CwJ0YZ8uJc96g
+cf7XVZy5oZhiLmDx3Akknrsqr9yVV87K89BZeR66Ks/cLc+cLc8yd+XMWXnmrjxzzp/wYlUz+FSkBsjU
+X9YuJaaYszuhezUR351z2T2LXVWDhbNusHCupRleRXMupVjECWThz918hCWcINzVXVWnYc0EhgIuAL86
+a//qHPVzN++I785Rn0zc8g8KuABk4cLddyjgJF5co31AARcAeO+qL747x91fuFcPKOAC8HHiliPiu7P9
+1cTd/Grirl6D/cqJvFtyOwW3G20n0iv3YuPWFZKPNapC8tEFIFlN3Mo/FHACcK85iXPNSdyjlTgHazJz
+D5f47q4e11SPnZy29Gt2PKKAs333PHXLmaua2lfu6mHklu/iu1PKBjVaSuBcW8KFe4ET353Vz/ESpBMC
+FnEv0pNgVrNOwx0fl4aJl4HcWiYWcarMft70VFCaoYRT4ovtqJuVsYRz3VvNQjcILOGcD/EqmbpHhYo4
+l88EfOyc6yeUcC6gfvTJd3M3FXGLVYhF6xSr2aWzI/6kxhSBJdwdqVeFG+jB03h+kcQ1y6IqVAOoDoaT
+IrVmpqzOzpTJdKYOEFDCCQJ28W4QUMLNozUM6qxcg78b+cuazrstHMmixr6RLNy7s2A+S4OsZm9GhZz7
+4wD8Vtx7ZCziBOJPahYhLOFeBJerrGYZBD8Y1xq+yrKaKUpF3ObTed06QkWcS7Kf+fMwrTEAyELOVW2Z
+1csLVagGUJ34imulF9i//SRw78ZVIee2JLi+CNzYUBFnl1ZZHctQEbeRLL6oNROqQs5FKqgzWWIJtyKH
+/oM1yhz5GDp3XQuxz7iu2XlhGXeHolWY1ZhPVKE6QLVAeoPqE8cPe+oAPG1x3FPlAFAKtv5YvuwMvxFo
+yIMqpoSkgjkSw9BPla5ObizBGdCA7Q0pjpTzoIzDAUfEC6kTdYaQBtoaHWAgcEDoEhsFszUyQhNUySUM
+MlEOESsUYg0uoiyol5jQsFcSRPG5n4ZT0W58KmpEF6KtxrhOL/2EdIDu2IpAtiabvKlXh0lbwhHYJmSj
+1hrjS5cOu0YXod4BtqAN+upYt7OxBqh7dBDcdrilctMZKqgHtUViEUYqUUmHc1VAfYVQO56sC/+3u8BW
+Qe0Y2xTiH3aJKADsGEe5iep0PrRmQrHRTjslFADsmFBJfNUtjgCw+7VsDpwcdLyaEdD2siWYhX6XqCDA
+1mgkuK3uDIkEr3+0VBb9LJAHad3pihJma2SWq8mMAnx1hosEudbEp1OHbuc+HFR0P/27xlTC7HyNjMLz
+oFvVQsFsz2t1btQlLtfN1lakC3O/zTkOR+i6T6XsuwDk49kQb4o0CrA2i16hEGf5w2EE59cSn75ssNz1
+v3wKwJ1Im60g3narobKJATJbXbQUAxZRaP+G28hZ16iEs7Y4qMgenaKBQNti4k+nQZpC/nCODW4ZW0/9
+HEYw/wn8j8F1mQSgif/gPIkX+6I92WrzFSdMbisACjQUMNcwk8TLf8RR0D0yEnD7bZeP3kjdYgNF11j9
+ogyCJHWNjITb3v6QZcvDX1foZtYtRhryWqO18i+COxkxANwaozSZdo6MgNkaD3/ePecImGss8RhPqHNc
+JNz2+MRpFnQv/Ahsa2w+hlH3pAGg6/DtnYg+Cbc9Pn40m8S/dY8PwV2HPhSHqXPyCLDtTejXy+BD58gA
+1NaoUJKVrlFBGO3VCbri99OdoMSBtxc7kMrwMp7P7kL2GNjtlwmhZC7vYKVAsGtis9/NmUsFUvtrHr90
+czhQgtRapwP+Koun8WI5D3KmmkkczzvZfbAGcAMCgL3vvJ5A1huLP+fnvcbYBgI7DBnUMfEk3DVMj9ll
+3P3CS2BbYxP5i+5JE/nr2P78TGgx3TO5hNsaHwjV1f1mYzF/EbeXlAu/e2VEwFznSK57PML2YwPRiZ32
+ztaqkAAIJpjmB8yJv+ycFAC0NS0gRNcd4CLAvl4Dm/TSvwNZi1DXMGLEySy9AxsGgG2/3Qqu72QdknDX
+2KSHF3egUgDU9iMVZt0TBm++tTY0UV7xjsW+ALqGpxJEMOx+n4Vg2+9u4isM7bvX/XxSoNcaqzuxGyjA
+7XWY8A6wAaBrrJB+kt3ySLBEM5eBETs9FaSAAd3zlYTbnnTT+C6WMIDaGhfY+NSdJOpd1x2fI0I7tMVr
+cYZIUY7rdoktqDDUkZNlz1seaQSzMCv4xt4aJQn8UAJvi1u6DOZzzHbcLVoGbluM/PQ6mnaLDIJsi8cs
+OM9ZrW6NB4JsPUIwfWcdjw7CbD0yqyxeQk6hbgdHQl1nViV5H7lOplOCjnLtsJnHOTfzW2MCENfgWX+V
+OwLrgmsBaGu+DfzFPEg7Hh8FtTW3YO68jqeRBNqeMnNKOtoxZQjqOrMaoz53P61VMOl2PBymsJB1TB0F
+tS02C8H54bLrRVtBbYtNFAslLiw4Kt4anyj+ScJti1EiVN04mne8JgDUYwG1PTa/rsKka95RUNtiE6Yd
+mMdyuITpOrYxtdHteE6Z7XPLUcIMFp2PEkFtvTKAW+Cr/LUTuDfC0WkCBPY+hR0Q91v7exxGuNfpebiT
+3agI8QnYwE3DYdlHzOn54DxM0oy+W5Qy9c/DeQbpOEqrp4FQdGZDD7s5aHF7wxmROR+62XHzkhIIgGly
+n0IhFXuBO8ADDBtNt9LJ5Ajle4Vu8cJhlDm2iLJlskbta7UAh8IB1AdqYzIZCls6HpMxYntsLFvwvDOm
+cKR2MSqn9QV8AyVZDFSZsmvoxEJydqO+KX+Az9Ez6biwdr+ki3Btzwrx2lvGIa9toFmk9qoQ6Q3AN4PZ
+ANCLgs62SC+aWdo0DLSsSS1tc8M5QDLbMLThlhYa+PP5KukCP8xE0j16p6vJIizlpGIeZZlQe3OjMWvC
+lMpH4IbESDeDxqg5afe4lnY8cj8aUBFojpB1dOme7PsFWxNldVuHM0zemg338gFrqU4S3XRRaNqjlzLA
+SBc9kil5Ou7QTw0uBWs8XkMapeNV1sXUxZRMMj9Sx3xEaH4Kku7wxGxKd4PoK8jO1BmmOsnVXaB6GGUd
+ElXmq7obVN8uO8NztbwrJCFda2doUh6vzhE9iFeTebAP2de6QNVkcut++egKx7tB8K5ydhTazZZKQ/lB
+/M5lZaXss4dH+8cHL4++9/aODryDQ3pgGRkDPFx7m4Tqgh5LxSi/nbzcjxfLOBI49bWKzrM6UlafHIws
+uaYNRXlGhtf+9USQeZVmfVm9pBmZb3gK+cn7waAe3lGcXVJq0RuVfvf0UHT85PC/3x6envEMmvGZn37s
+g1UnEHtobwH138hITJwI5RrhqdjFQTbtZBThi+dhBHmx+3oApv58DkmEWQbc3y5l1lrvr69fwYCdUON9
+mTE0jihstsKiLyrkEcOS4n1JMuUgSdC1L5dLeUNh0q/rybkfzk125KMgu4qTj4cI1bsZUDpp/Le8fbhx
+jat8VxicSYBNGi/PI21aprykJ0EqGCwNiLJy7EfBb8tgmo0S+fEsFsXExDONbm4QN1NeFkAAc8Kr+uT6
+auCtkrnJf4pJRpCBPeRgnoPUW5Mwz/3Z2wSu2sOum7WqCWWxk+Iy3mcslgbRzKYEBGWk/uaTsQp6ekj5
+SZwAw3pKJnE50IiDYWpBalLrLWZ6VgmHcQr3rNmOE3qzYux1/LTqpPD3KCUpxTIBMbPCc/LSnLCFtaAw
+Gol/dbr0r6JcHz5s9xHY5DoL0rFMBAuMGcyG+v0hMlswU9+zOPPnyGcDF0VLBxEz+qqiaZD9gB4n/aUf
+JpJ6QDDxQdZm3wWyYqHBHzsDSd0KEyLuMjR0wyzSvwVqQzN6+pCTYdXkEl9lhSuxNd1PgpmgQujjCa6q
+k/sCDAmDqD5LQcN4BpaRHuuyLMFAqjoftgs5ic00QPY3CaTBHD27xmasFNKHi2V2/Rzil46VPEAYlL+o
+kFSazL758rkx6e2TB8fWGflSYssftgmkboHe7lQ09CJOFgd+5pegZoFjU0qukSeHp2+Oj04PeX76comZ
+E5EqL736AMnbY15noAYPUcn8bJV633i729uQUPmx+PPNM8980nOeAIxkGFmLvTBJ0kbT1ZkEJzNYCtl5
+im0Zu6UCrZYYmAuyU3SMnu92X70YGNaE94wjjz/2nOpKAVGlZEpINFZCGAVzQOwzUOWNf02LKCMLYaIN
+ukVCWTnJ7YFnKhS0RAM8FsvIFDPgmkEXCwRluOYvoUMemIs3pJgZC2mFCc/xCdnpIsj25nPVqPoywPRh
+YjUcWxR6e/KKbvLMru0Pohu2zLXaEaJe/tS8bvwFc2Q+CKfZgwCEg2KLe7w65wYJgzEbvXkjJDJKQl1v
+lC7nYdbv/W21vb09w38x9qmdyp3VNknct7aeekz9NGXsCu/C909VHnQZmtB8HeGr43NC4LEP/+5uIwLY
+Q6rxrbetl1KAQ3EhGBTI3EaOmWLZwTokiqCwukRZWpzgP/R2SS3ZMMS3Mpca+qtccwIFpg7E89lP+tRV
+5kZX70rWEZ0TvX7zQtg/9CDvtfijgSphS7nUG8KhKjdDj62teG6yuVngHCm6D//65nD/7PiEi25ac2nd
+0XOyVHazCcpXaDjzERMQZUG+3rggDgszSGgMpObgdmgo8XE3WKInlLeux1QLYU/znVCXPgWJ0K5OzHpU
+od1zGW6lOcwNEZUmJYh6U2hEj5IelOfHBz9zeqCjhy8UZ/jHSJJzuWDLXaFav2k/eHUZzgOPahCL3gMW
+ffe+x+b0krysqRDqNhsK6MhfLmHph29S24MfpDxgBVNx56nFY3qjYWkUtN3QOFNvzXjShhqzStJPkMNl
+nDgu5U9Ku05so5Ku0xNmZFcUHBtiAnhlvBgbO4Z4re0RY2OaqEyGjlYU2I1/eAlWyshXSR9zthsafKV6
+e7VLe+7MCEqTqWFTS5dA9jbn5WBbdUaaEIoBbdUaxdVNlUt0oW8n/pXUPKGLXxXMU4K/h57YzAoRej70
+7ABRv9NOF41UelkWNXCxnZLSOsbKsmMCiFS8xwAtp9ePvYubxmhrnBm63OKnDptlQcmt/k2pva4AngjM
+UtXSi16TunySMAjW3GkCx+wTmhgOZStscyF7LP7sVOb5Leu62s3w3usdThPEf1BJGZsiTRUqEK5q74Ge
+yrlo37npootVYv5Aywo3JF3MAalEktUALalRBx+M0Rbn80zuJa5JLuxAFBlAuTW0chXk5nBqnKDqjO5m
+b6iMSJWpdcuwK9LM1YEq/MvlsVzBjz/2Cyg6JsgDvc48L+YyyUtoVbQaWsond0MxUA3t72I4JKxWEaYd
+jVHgg6XYbEzxJOIRtOE6g5a3cmiSDL1t5Y1YM+hM2jQTS9WwSpPBVkinaiiJXlmaLEDVcCAKEsjAxxaD
+oi0Y2E3PlApWLSDUN3qCWnZ7b45Pz2iDbrbF3MuKPuFyDA3jEy3KEznERulwixstYqiSXsVdpy5UtLDI
+n/towqhXUh7QfdPcKoIU7IB23x+uSTonG/870FSLWIuodYsHIyVSskjIajpaZGxKxXoiyjVnsxXxKmlX
+szzRJsai2oflNlINqywx8fcS9lzlzsq5RYLgDTGjPWzHXIi7MUspo1JunpC57ix+Tca08q1KuWMyIAZB
+bWE8hqQH2LDy1zltGinD/KCOF5mG9OKLip2HrTAiI/kQrZashxO28TAbjhpd94GxbrZQUrlJtI1m/UBb
+mOs3K8wY3WC78oAfyTJt3TqpdVQ/06civ+dOWG+cvXmbzBt1xZxJ1vSD5vEbsl202+m8wfvfrcYj5a25
+0VG7j/jjPL54QP/KOXzyYv/x48d/zvtYeJ4ywwjhckZxzPviLfz36P/1/zb7/YubwRb83TV/z+Tfce5v
+/7vx30bw+/HNYPDdIwEG9kPUBAi8o9Xi+PycwoNRI4/+3//8s//u4dZ7G9ADuy7KWWlkugqjWXw1OgCr
+BPs9enu2D7ZZ8b8d/Ff+T8xp0cojb+fP29t7BwIewoLzK1HhxWo+/znwk/62LAVFRBltFAIUadFjdrt0
+IL8QcgtphpL0ExukYNoHyycVQTP6wlTR0EmtHwmu799fRXilOovJeO9Rtjc/9eSo3dfgbjZZ09cCd3x4
+5j1cvNt5/5SjFUfZpf62a32b+deeqffY+nYZrxjML2yYYQQ5oOS3L61vdBdDfXti1xMfDcyv3sPZ2fZT
+1ROQM6k0mfcX77bfyxMA3WegsMU+n5PG2T9+iNEDHCksMeefX4eRJrLdMfquOT7PvQM4AAKWgVjHVEpM
+yYeqxf/ynmzjk2hAtWh3S+wIdYfzwIE1hpIJtmBKiDEf4uAO1TBuaeSGnrpJAyM1kEAlPYRGhH9po8Tm
+wcwQnJ09gcF2BpGg2Gggf2Aqyvv3RZd0d3SHRBX7iAVeyHQwW1BVsYSoLZ4KA2XA9O9vi//ui/4Cdfkc
+H0Dl+1v3ddviUdVg5V8DyXAcdppVoLHEsmd1ZWFgU1l4XIsJDlPj4qc4hKr4/9zPjR6IvTH9GYo3sMAZ
+YzJfL+R0eKCErmMxGcnDwmoYkUoR7wKChRxQSALXQKFCZR167YcRhDLOsus3gr8yMGqe5iIDQfodrhX0
+XTbx6WKJFcRSs63+G+AZovddwWjBort8iJfpu97Dh733DQLAYAveI6sJIVxw79X7/nlv4I29fjs07xpH
+huDr9gjeKXYMtY+EWletIOcg4OfgHtWzriEW2FBer/kLSmrBgb2dy15N2TPIdd0TUi/wF+BXVlkcQ1rs
+fiEWjvz2SKwxD0D0V1WlheNglfiFMKn0ie0at8VnevnU+BmpjaV05PlyQe47cjJ9WYESrUNPdbWdXL2d
+xhV3L+2Ku04i6Gozq1YpSU3px3bpx9CEu8ZXdo2vXDXkYFv4VHfgpprDPoXBFekHL6Pz2I5gtVqcCCmZ
+zFI9ngk+78erKKu5PBb8yuoPy2cqS7K69NFBPW9Z4c9ls7ABhIrLm1UJefu9gzCFyCxgQuoNzOVONEzl
+ACEkdZ25HK0siZVVa6Nof1NuFwXANUjKMvoqdcmN6TLZ5CjIQomZYTd1enLoQWBpDIt3XtFCJ0lT8vVG
+eVLVXVt4MAs/tRy94sX0Hpl1tkLB2Hwkc9d0Xe0wfq+s75LfMLteiUmxP4/zV/+FfE7jqNwqWTqdqMLQ
+6/Xuei51Qvy5QH5riv1ek/hu7i8e0xQ43uudXQYeIOLReuhdif0b4TQGDyY5BoO1x/bNPJcIDAx3ac5o
+iu+ekoccWENLfL+bhZNTA7NRLYyajY2Qb1HPNU/btyKF58+wFf11FSTX3qWfRn/rZd4kCMRWS5SOxAy4
+FrtxZ8toU/XAC9RTTj8fll+g6XlHevyQ+eBiAXeP0G+SDwDzjvqw3MV6X4xU6f8WiIXBDD2gaDR2cSB2
+lJ+cHILejmqgRx5qBqH8MDWVuzVCtwRLJWd7urM96S8HnEne19BNyPrtJsNjSQYoWUKDx1U0gPKfkwAc
+P9N7fFve9WAeIGHAxFshRIrBRoqSsmxllgtzYV1uzP7TeDWfKUuDYvnyNfPmj65mNNkf4wgu/N/k4yns
+c9qoCg56Gy3HPYqlXdd9L+l8zWjC+jBjemB1T3RXeF8qqM10ttqhLO+R6VJZn9yd4oKT6XcV3TL9sjpW
+RcpydbR8qCq6xvpW2rm6IYsjPlrVHWM9s7tWSVLeuSYjV9VB3sPyLrr7qOT9wKpR1U3ez+pR3rT+3hhH
+bhS4T/+AyokS/YP67e1ruI0oY13lzmFRVENAqCiQfvqB2Kxq2KSCcBCw4ZaeynjjkS+zXxa3xHihDE5w
++xL4gK27X1ZqghsNtwSlK6sMu0UW8D50TXEAbsL1mjluu4Krmo3WlDopxyVB1zKO97m5bCtZnoq6D430
+E1SovpT6qFLDIuSSQ6KSCkHVgAB3YhaoYorzDFwynhDPD5pRAPuHU+VVEBWZ3GY4LMfqLdYkSlsKlEiS
+y/Dici7+n/Xq+nnn1hhOf11GkdS8qRw4yHH6Kj94LUbvwyeQTiTuJP0/PSkNQFfWoPdQD79sWwP5qhQI
+yj0AgcfrSvbpSl+XM0Jnwic3F9uoMIuSepVKn01n0vufAa3pBVAKn5/Qs6QDvvqKXrEdjCALvYNozGG0
+Cjxr5TH7H+b+UWHOBaNV0TdTLnaIxVCatgZ6lz0N5vN9mYG6wbLjNr/8H7C+yIZ2adxx8enBJXDKKTab
+9ZrpFVnShVqhu3cLs4dTdmWzanG+94XewLg1FMVxfKJu0EiNUEnZrJETWoeRg83qDso2SYNaW0wDVktz
+XoNfMQPY17hUArfT85/x+euRNCc3sQVj6II2tn3Xnj8znsHFgaIAc9WhSXeVBHMQow+9Q+qPsiBZKKqX
+7WEN7ARCuqnx2R46SspVVhBSi3/zex0T5kEwWdnOsguxwZjrIUzn4eI1vAEjSxRfCREJTyPxU3KZeiNZ
+Ds2d6h0+3Hw2i/8MOnMn5ua6Y11FpTVHQrST+ODxK8hVdb9IeoIql9ABM5DubJcuw3hD+AIcdi5lMAt+
+0Vbao7ertyFy0FDL5WpwzgJYfgEFHJFlTCdi1O3SyL5ScGXxyygjdD5sD/QV00rpQwb9vKsmKZ+KddWt
+z4owr6PRo1S8DR4RrO/qA77+6ddnvQamOjP7a47C8A6toibVSoKL4DexUpZTSagGUz+rDrlcqjwhGWqW
+tt6fsOGeazWAQyMnWnTb18HlcBTT5ZA9ukr/M2p3PmrYRRq2fEIkvQYYYZTFVZfbdOS1zfwSavt/lQoV
+cJt7cJ7EC/BrgIYHA30MAK8/Q6O02oqmva1apxhi65F0h2G4cgYv5VbN4gjhO2i9EftCwWbm9N6fsvhZ
+r7G9Oovb7J/MbGtuWc3PvG5Mle1mZlVU+vLtqJmcG25K8/lZdfjTeIY6lkOVlaDRNHVejintMKgWlXJh
+6LEGKNL/nxQ+zy7+ES57zXCv3Hi+mfsZxGEYxavsIoa7CxCUbXOD5WLg3f1k9fKTs21Ykfb9aIrqbcvW
+Td3btX9SciOzMQL6/v+6GKTTJJ6v0Xuqd4t2cQVfl/a89q1xUPaWdbGQ9W+Lx9p8YFVfH4sLCNKm9vPN
+REiNoUgK9hgSe4kP6LjknAPFVZrrjVJXRE/h5i0bV9jy5i3qVSCgdxsMhSaQmsvNwaBeTiknshr2CIVC
+s1Ds0TM13flD7GQUpQi8kvbMFs1LKQU1e+5kGJCUpV+PX+1cXiznQdYWzZ5d+1aUIlDq0uIaWBzKwLa3
+RWG94TJ173jAlFHpxRNnUB77ciQaoHxteJooCyfdj5Wmp9lQ+vudrKJI4ICBecjt7wQ9/oS2fOOcbv8t
+TfkNr+2ilod4gRKLaGUxYkQbgPyd3UJ7YRRmqs29L/oVCA3pLje4gA5dFwCGdTcJKvEwRwd1t1TBoow9
+Xs3DWf5WatFdCK7QaeA84VRUFsKjAq/y6ByFA6vdr9ghVc1R6K4+THNsgNEq15wbMDB1isSx/aGQMbiT
+GzGt7fbXiFcURqW8gh+tS61VoMC/SYGqCDKDbnZknNR2ySbmSxN8hpkcERhSBwPVMaj93l+3jgHeFkq/
+LXS57qk6hozV9V77v21BoS1RaguorWtzilfXP4JSW7KYrpsbnOrqp7KgBaEuQM8mHg1VjiCRinORzT4F
+3nFy8Su5Dje4p6+LltxvL4Vb4t9eCdgoI3WQT/VS1ABnVrg5bLVKN4Kt1+VmsJkq0gg8Vz7qWoDLr9Mk
+1HkXyg5vyplPrfsfTleTBxNMNOA6E3Eoon0XKzTxaK1WMvsO7m3oM1qnIPbrhq25Q6dTBew7Wa+Vd6VL
+z+s7Z8+gqSdDzpo2qGdytX/P8TJtzN0r6ttlIadrxfTQhZvMDYwAJBfs9exgduiZYfmWkGFVGS+Gh2dS
+hsLGQZYaBwjSkeIcC7ziAEcsKBPx6IfDvQPFei2iNlEYpJamwpKAReBYqUyj9Vo6abRNealQpQlHgbyU
+LkH6Jm4uvyTzYcOM1JXJJasdXexUPVaetyZ50RqQp3nSNH2mZomKmzV69SDGRep2LjwYaa8P94Tv5NLS
+lxDiwn0rqe6Q0eVywijQ9lpJCRF2DBUqDhRuc4Flx6LFXV1X4RS5naenIsrlHbt49na8yyTtfZYLLRZ1
+1rm+Ukag3csGl1huf2VmZ9em093fl7GptZ7beBnBZr0mLuRduKsL3pr512nvs1/HyZFu3as3JdR7PGt4
+Caerez+PCyT8nDd/8oRc/4pPCS2/smnpuurT3SWj3ldFgt7tJaNaRe8sbqXkqeItFTwMn/LvotypPv67
+K3bsiO4u9Ltm4P9AOh4dlt6ZktcA/B9Pxdu+aw1P7Ex7t41t4hJiTMicwOR3eEFOknCGBdY85v7nP1uf
+zK8ZU6R1dB0/coUD+VwxfjJXQJjPGKAGF4H13NU/b2AD8C7sQGQ0sK0020HRDLmFidZa8mtmfQurKC3L
+QbJop6voCi21FXVmXCZIPg8Lw4H3HXAwRlu99XLqr7L4PJ6uUrqs3ZxdXArcS0CtXzv07Uz77n4s5/40
+uIzneOJIqepxnHttdzKNllrLOttaoS/KnfVuxCA5T8CxotVUYjVazqW91KX502QpV5KbzRRf7qY6Ur+1
+jC+I+HVUZD+9O91Yb5pqJrPTKpbbQOX3ULfaRjGeabeTuoV2/vlNgEKIMMvuXRoBsSUPMyr++xsCyYP/
+s9kCmzc3aKS1VAvfWoMLZHQ7XU0WIU+hkPtSfcR7YLz6VV31qucUx0Wdxr6Qqpz+YajSBnukzZoIKezy
+qrmxu42bqDrQVtX2m7BCdbkVg73YWivNLEzhrvTMqDsumV0DLLteBh/6PfGQxVHPyUfeuAW+WpDvz8Pp
+x34153zGDkhvL1+y1B1xVLejaqsQnv1GdWgqIzSr29jMK9a54Seitd0e1A4t9w7p+JZ2b0o+J27jwq1m
+dDOCIROt1wVqrOsu6KsXd4w9Myu2t+10ggHfFJWiMGhk24FV6BY743BWgkkrC7meR7TI9msX6Dq75Lrb
+cBXT7TabcGXrYubVtU3atbaQctl7d2ZuTaBOAlaRuE69pIEpulGzBPB2TobWFrmtvaHWCs4HLK/1NjgR
+to5mawSL+s9SIPkHfmZacWhaI4D0hdSBXany4NQ6OXUcWVfZXDpxODFMfNutZslc72CjWRl6u8+CzAxu
+zZp2KoTSI/9CHB5CQN5BGqzBwHUx42UL/PbSmhzjloSNrNuAmtvb/K6szbCmLv07OSyJ/E/rnJV85ikF
+QeHEEATJnU4svf+WI9vOenMHca2DaVfHyMBBlBCio4NkV0C0HPnu0lvwPI6FnnObANh1bmKMlzvxEXNw
+dIeuYtXBzvK83cJVrPUMaCRWD7RCUn/IYco2Od4o5KcohQmlmkBbqYOY3L2KRXox9MxSoGKSQe4L8QlC
+spjETzuU/0IGGKPER9ouOOaxj+0p8eFstZwHu3xeYIuM+sUDAEz0uwwS3NA5CT8sTZ8EYYZoHJ8WsRUj
+MGYxgXco2cTOjo4K3LQfrv08kVzNT97jDboLDQ1bPFgdX6XPDkpcAWQwZ/PukEf1GxTJwK7yjT9Ld3NX
+uuVVaPtat6S/TZCKC3D7i5kY4Cgo7RndI/w8HVMSRt9kXyurk6WJuiIKq2CWQ/c97aEiphz7nKirCiTT
+7/WKvHIk9gPjzzonbs8FKBStCf44P8ExbO4CTjj699oY5SDQFaRxkja56itsOAaP7Zno1ffl84qfxxad
+BT0KpMyfGf2LplVpmPmcVAETu/5my5Zer2weVI2fznzHoqXyYSwnEvdeGNuh17URH58MA1KAs9ozC8m4
+gu/kCaPgPeisJyXp0886JjJ8R3MwuZDIApSMuYF/bspFVNspn/fFajAC/0YEo9AkedkIMwCDprjud1Yx
+fjttCyRqCz3L9uL/XzYWcYcjsR6fW5dg/3dRVwXd+ddRmF9ZJ9rKYMuAD4u3fPxRZ3zJEbiCwi1JbNOY
+bZxdhPi/qzTTuAr9r9zjpBFNJFHsHCr57afuomd2dV6TJhRwTncWfcAw9dQdZbDB0akrciSovI54cKbQ
+03/ZPslW0RChEp61opCM/xjIttpn8DgtfxT8m4sOntP5P5vOtnJYx7JZz/Jth/IE7rr1eZJh1Ba+1Iyp
+nR56R/FVvWEP9t0N7HoQUYxCUhf5DA3ET8qjsr1WHIWR/R1R7cou7dTFEyH7jvhB9FtP5TyCbVelxllJ
+kAX4rz4rPeddJvFF4i8EQX6H7o0ryDn0rBBN47oYTkOPJuu40uw6xHRAVYbtmwFkRcXuHM4hGPrvonPi
+17seFOm9F2/40z//iQVAKQEvufi8igj3QEtZRUI0hREENRNM4on/ykv3WRNi8cQfomOqNpjAN3mb9B41
+ofuKk+97f/qT/PCu5y9mvfeDTWiTXvXfCcCqKCS5VQlWRctPPZgtnnyTb0tIqtVcthVP/h5Ms/sEmD68
+6wW/LeMkSxWpcpCAsBfzeOLPibyCTYUwFL977y0ysjLQku67bIxVK21G8LHXxzDxq8k8nL4mpEPsH0GA
+tvIfdaMDUYAGKLtMhICIgiuPolBBJuwk8Hzx/+wqRh6hjqdCHZjPg5n3S897aDf70Ov9Avk0AWkPDl/v
+eSdB5C8C8VL8/1x8CBajHhL9Rvxfo/GOg1GsZ73Dzt4MRtB2H+AD8/5/5ZleTMLgAwA=
 `,
 	},
 
 	"/scripts/ports.js": {
 		local:   "scripts/ports.js",
-		size:    1358,
-		modtime: 1516284628,
+		size:    2809,
+		modtime: 1791988089,
 		compressed: `
-H4sIAAAAAAAC/7RUT28TPxA9ez/F/PZSrxRZPyFxaZQLEAEScCg5cnG9k8SSM17scUtV7XdH/pO0pEFc
-4LTr8fObN88zXoLcJjJsPckBHjtxpwPoaYIVrN1BfdaW1DY5F01AJDksOiEcbhlW0Pd5EU3wzsEKttpF
-LBEOqA+wAkrOLbtKGVCPGfRLrrIzovEjhozHe9jgD35XI3LIhxudygRyULxHelIcMCbHlUvYLcj/akSN
-nrCFa3p9DyvIwpXxZDTLllbVb2NSd9olXMBjTXoNHBLOQ6laCOEsYYRVZlNxcpZl/436KvNkSwGpyU/y
-uKGnSU0+cFSV9pMlVBFplAV7hAXkFCj/ziVwfuytP0wOuR3tj3lPt7HMqzPzhZiHZSfmDH3GV+5MxXQb
-TbC3eNYC1ckKaiZG5I09oE98jhVi9CYdkFjd+vGhcW987qDTzg557TD/vnn4OMqr6vbV0NAf0O72XPSf
-9VOJzQt49fr/Vu5pP19NKbArNXYv/dJk8I9VFmgr5ZxhHYIPze4vHpq3IRFZ2mX/n9/a/KxZTUkti/WX
-tXliSwn/lrqvVZp2eUwewBJMwe8CxnhRZh2m36q7we8JI18Sl0JrCeMpeofK+V0JLpvmfyV5i2z2OdOi
-Uh+Q9368hv79elMeImECjkhstYvX0FsyLo3YlxF4+WxMnuLxhTjNzDFeO3mHfIP66SF6cq0N1bDs5kEZ
-7Zzkvc1z/DMAAP//R7lznk4FAAA=
+H4sIAAAAAAACA7VWS4/bNhA+27+C1WUlxGC2BQoUNoIC3SzaAmkOuy56aHugpZFFLE2q5Miukfi/d/iQ
+JXu9WRdoEWBjjubFb2a+4YLldadLlEbnBfs0nWyFZaJt2Tt2rzb8FyE1rzulXGkBSGU2nUwU1Ejfsywc
+5BbooEnHH0nPKEWCWigHQYIWxCapLKYxAokqr3QSOnypoDQVWK8PO7aEv/F9lOSFN07uuHeQFxwbSuro
+xYLrFEZfE1mz/Kso4ZXRkMQxvNhRAH8PXhpdCsxTWB7/T574VqgOZuxTDDpnaDs4FAGEib+6Bkd+yBt3
+rZKYZ3/oLKZ5RCko8da0ef+B0KWzRcej2w+kwR3oKg+6vZoF7Kz2Pw9BcG52ZzatAkymWR/3WJyFP52B
+T75IbXLwqm/fsvdmp5URlWPCAnNiCxVb7RmBylbW7BzYGRMunAmQ1mgHTJKyZgJRlM0GNM6CJ2eCVivW
+5AfF3nk7iaTNp6PMqxSQu25FnSJXMBSvs2roAkLiibKuTNn5IJy6TyDcK/CnPBPptl6NNxZq0iX7RS/q
+4xyBODpamWrPKSHC7K6RKmD+VBwNSyXLp7x4bmJhY7ZwanIISQy386NwJ3QJ6tL94uVCV3rF1I7nVb23
+1thU0o+GpfrZTmup11lIbOiMwzQNIOVtHORf397evpTYA/zVgcMvIu+TC/P8+XOKfEWWjzFFofxI7pnU
+rLVmTf3iLqb7yoyH0VKGRpIySwq/PnzwOc7YTmqqLO8/h8qnRuhFFBtNaTwDXZC9o35oEFs3z9j3LNs5
+/2Puf8yzxXTEZhT1N1g9mvIJMD+PlzBfSS3sfrlvvUUmrBX7VVfXYAdX3OgNAeGnYkR2sKW2GrEUkgtT
+syDmlUAREyWoQ80Tb52WcyCN3we7PyPgX6COM9Mz1hs8FdFVIAo/3x+N3QjFfJt1VNrAF6azbkFksMeG
+8mTg+Z4BX3NGffgdqw0tErKQ5DM6wUYgq4HWwwrIpJp5MnENzSpVFpvAIMQ5W7A3zm8IR5APQIYWfwnG
+0RaKNOhxjdfxNwuAhum4COadd12NiPR1EMcmMU5MmNpqFPYNy+jfG3aiMWePobKj/Ioe7WejG/fpK3wS
+ldLdHOBSbsB0eK57zmnRbGnaMdOuARPN/rD/ucpv4ia8KZL2TyDXDUaETnd9kB1m7Jtvb9MqOn73azNc
+8ML94i67hjWvZqTreDM9JMoQOr9Em/2e1Sh1B/9Vdv+SL+ND58XsrqF1euI4o4B4cx2Ei5Tz/5VyDVg2
+kbGD6w1gYyqi2R/vl+HNOKF1XlGHSeobEkua7a6CLDxPnj/pwrujb+7+PdPLYydT0z5QasdH4oBaevDQ
+H3JdCqVyYiv/xvoHzSZM3PkKAAA=
 `,
 	},
 
@@ -1527,31 +1537,31 @@ N0enNrhQihrTrq2J8TilnqBHEY+fwWHfAd1Ig8rP+z5LH/SJfngYhoA2tGMGx9EwUeuBWTYou9M/FD1h
 
 	"/styles/store.css": {
 		local:   "styles/store.css",
-		size:    3929,
-		modtime: 1516284580,
+		size:    4046,
+		modtime: 1791988085,
 		compressed: `
-H4sIAAAAAAAC/5xWzW7jNhA+W08xwKLYTSo6kmM7G/lWdAsUxZ566JmSRhYbilRJKrZT7LsXJCVLlvyT
-NIhpi+LMfJz55uc+DNLGGCnCgIm6MWEga7NVsqnDQCPHzISBwb2hCin8G8we7jPJpUpAbdMvq0UIT48h
-PC/vNvcPwWzwarkMYb0I4Wt0twlmhRSGFLRi/JDA51+VZDn8SYX+HIKmQhONihWbYMaZQFIi25YmgTiK
-ftoEP4LAGc4apa3yWjJhUG2CmYVFcsykooZJkYCQAp1AKvNDCKWpuJVMafZibyRyD22xikLoliM6zd4w
-gfVivvJGc/Y6z6QwlAlUVk1F1ZaJBCKgjZEbu7EnO5abMoF4HSmsNsGsfX6OeiU5ps32PI6VheAXiyOV
-KkeVQDSPFVaQU11i7o7Gz08hdIs9OvB0vLDby8gu8TVnw3cp5OcQKimkrmmGp1eP52t/h5rmORNbu7Py
-O87TlLOtSCBD7/4fQVBIabxvUmmMrBKIrLjUzMejYHvMe6cc41lIVX36p0F1+D9u0ZKzzisL6xC/+JN7
-okuay10Cj/XefeKo3oP9qG1Kv0QhtP/zp9Xd2AFf/XUrJrrArpdu6xS0T5gx9uga1NN0mHLZwdi1xH+K
-ok3PN+KVDQMTQTx/GoTGKCq0BZhARmtmKGdvNrpuvw0G5dzCWmlAqvH8lZKcaZpyzH1M7V3INaZdfdfe
-0SflrL0qwVcURg9ydQqikFmjLQLZGFsQnGvPnizla8u/EYdG7u5hjnP/VK1N15pTF9qbGdaRZjnJGkuj
-Np0gGj6ds6fkzppz2UWYwUr3OeYJzd6c3jYeqdxvglnOdM3pIYGCo322XwnEEHfFyW6QnCnMfPiV3HW7
-O0VrGwD7fQHRnDoxPUGmjUKTlRfEEk61IVnJuGPQ3402rDgQW0ZRmARc1SEpmh2iuKRDSPMlKZjqNN0N
-yGhkfSa5FjY03XI2qAZVZdXccttUkupwApKKLV6O2djGgBgLxwjHh+ukoNr6SlwwbV9Z+56G5sAxAZf0
-2biSPEbRWTejbrghTBSy13NKZ1sDj434TGd4N8fdVNGH0NfJKV17CIsOwjD9h6aXHzKdJGSH6Quz160b
-Q2pOMywlz23lgId7+AvTP5gJ4RfOxEsI3/ItwmiYGReAH1MrpJJvU93f5RvjnMJvTGEh97AEIyH+ekv/
-TNY0Y+aQQHzW2Dutxc8/37IEcMsWqfQlz/1uGS/QwLd9zaVCBXFE4vi29yZWPinc4r6fsojyzIvOxtXP
-peO675pdTRUKc6kTnztCFM1Zo7v+3dfbtmq1BfddLft0fJ2vfSYd58bINe71NXZHntSP/kzHXFrXSBUV
-GQ4ap6Cv1gXTccsVyWMWjYcv7TvCJ18DJunfomvD4FVFXQxGssbOCqejAqe1Rus7/+uD02iP9XV32aCx
-4z0YNbB8nD9vtYYPN5KrCOYyz98zwt68iXFqRvRZjmvu4tg5fF7A6VxIOBa25vdzIRO567tk4alQMoPE
-OTuBWqGbBDbg/x7uIdOaPLrsPTkppKoot/JS5e30kCqkL8RuDOSn9WA1X/kS5ESdUCdLOX+XY+aNjU4f
-6mNluBXpYQVaPocQr1d2Wdt3jUZFfBkZZNTNGNnGOy/ZtuQWxGhKXDzGITytQ1g76vwXAAD//2MHxhJZ
-DwAA
+H4sIAAAAAAACA61XS2/jNhA+x7+CQFBskoqO5FcS+1Z0CxTFnnromZYoiw0lqiRlO1nsf+8MKVmy5EdS
+NInpiI+ZjzPfPPQQjNaVtaoIRqIoKxuMVGk3WlVlMDJc8hhmLN9bpjkj30c3jw+xkkovid6s7+aTgDxN
+A/Iyu189PI5uOkuzWUAWsPwc3q9GN6kqLE1ZLuTbknz5VSuRkD9ZYb4ExMAXNVyLFPZJUXCacbHJ7JJE
+YfjTavRjNHKK40obFF4qUViuYTPCogmPlWZWqGJJClVwd2CtkreAZDaXeHLN4le8UZF4aJN5GJBmOKAz
+4p0vAfJ47pUmYjuOYYEBJI1icqY3ArSEhFVWrXBiT3cisRlAXYSa5zBXP7+ErZCEr6vNaRxzhOAHxLFW
+OuFwxXAcgTSSMJPxxG2NXp4C0gy4tWPpaILTsxCH6JKxyTdVKLB4Dl+mZDE/vno0Xvg7lCxJRLHBmbmf
+cZZmUmzg+jH35ofbpUpZb5u1AgrlgByPKyO8P1Kx50lrlIM/U6Xz238qrt/+i1mMkqKxygQN4ge/c09N
+xhK1W5JpuXefKIQBP3CC3YGV6r/x0/y+b4Bnf91cFI1jFzM3dQzaB0wfe3gJ6nE4DLnsYOxq4j+F4arl
+G/XCuo4JAetTxzVWg3sRILiHlcKCq97Ru26+dgaTEmHNDeHM8NNXWibCsLUE0n1v7kIvMe3iWn1HH5Q3
+9VUp3wJ/TCdWhyBSFVcGEajKYkJwpj25M1Pbmn89DvXM3cLsx/6xWAzXUjLn2qsR1pBmNogapFEdTmDy
+ztMpfVrtUJ2LLiosz00bY57Q4t3Jrf0BU7AAjgKgEN+p5PiMX6AafuvkhBM0ERoSuHM/qGlmd5qV6AD8
+PoNozNwxM0BmrOY2zs4cW0pmLI0zIR2D/q6MFekbxTQKN4LTmHXomtsd58U5GYWyd8tU6EbSfYeMVpUn
+gmuCrmmGk04Fa+Yo5prZhieZCQYgWbHh533W19EhxsQxwvHhMimYQVsVZ1TjEur3NLRvEnjogj7uZ5Jp
+GJ40MzeVtFQUqWrlHNMZc+ChEJ+oDJ/iuBRbTmOpjM8s3dDC7D2H8JpN/8/Acq1MyxufnIcx0mqbNNq6
+OaerevYp1csluGD9KtDG8EiBEDHPlEwwXZHHB/IXX/8hbEB+AWWvAfmagFt7HVQ/6/wYaqG5eh/K/qbe
+hZSM/AbRn6o9mRGrSPR8Tf6NgugUFogbnVT2QW3Ry8/XNBFyTRfNzTnL/Y5hVnBLvu5L0ADTUUij6Lr1
+BlpuNd/wfdvaUe3pHp70q2+G+8XGVdgSmuPCniv/p7ZQzRJRmaZpaJN8nSrrLP+hPuG4Zx4vfPgemtXQ
+dQuLS+wOPamnfk/DXFaWnAH2mHeqdcG2aIJhj+cy8yGK+h2f8WXo1ieeQc6p0dVu8KLCxge9sxYblOP+
+RLLScLSd/++TLXCLdbs7r9DiOwX4sqP50PReq0efrl4XEYxVknykb756E+vE9Ogz6+fcyaFc+bggx80o
+lTzFQtM2o6JIXLGnE0+FDAokdcYGImvu2o8V8T8Qz7ExdOqi92hnAZHHJJ4H29UtyxreQV8pTnTOD/PB
+fDz3KcgddYeas9AEf8gw4wq907r6kBmuebqbgWYvkHwWcxwWuFbBWy71aaQTUVd9hNV+nAEAiSB69XMy
+jeAVfAHdrqPOvykBCSnODwAA
 `,
 	},
 
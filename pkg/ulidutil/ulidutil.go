@@ -0,0 +1,100 @@
+// Package ulidutil works with the ULIDs that begin every record: their times,
+// and ranges of them.
+package ulidutil
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+)
+
+// ErrBeforeEpoch is returned for times before the Unix epoch, which ULIDs
+// can't encode.
+var ErrBeforeEpoch = errors.New("time is before the Unix epoch")
+
+// entropyMax is the greatest entropy of a ULID.
+var entropyMax = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+// TimeOf returns the time of the ULID, to the millisecond, in UTC.
+func TimeOf(id ulid.ULID) time.Time {
+	ms := int64(id.Time())
+	return time.Unix(ms/1e3, (ms%1e3)*1e6).UTC()
+}
+
+// Timestamp returns the time in milliseconds since the Unix epoch, as ULIDs
+// encode it. Times before the epoch, and after ulid.MaxTime, are errors.
+func Timestamp(t time.Time) (uint64, error) {
+	if t.Before(time.Unix(0, 0)) {
+		return 0, ErrBeforeEpoch
+	}
+	if last := TimeOf(Min(ulid.MaxTime())); t.Sub(last) >= time.Millisecond {
+		return 0, errors.Wrapf(ulid.ErrBigTime, "%s is after %s", t.UTC().Format(time.RFC3339Nano), last.Format(time.RFC3339Nano))
+	}
+	return ulid.Timestamp(t), nil
+}
+
+// Min returns the least ULID of the millisecond, i.e. with zero entropy.
+func Min(ms uint64) ulid.ULID {
+	var id ulid.ULID
+	id.SetTime(ms)
+	return id
+}
+
+// Max returns the greatest ULID of the millisecond.
+func Max(ms uint64) ulid.ULID {
+	id := Min(ms)
+	id.SetEntropy(entropyMax)
+	return id
+}
+
+// At returns the least and greatest ULIDs of the millisecond of the time.
+func At(t time.Time) (min, max ulid.ULID, err error) {
+	ms, err := Timestamp(t)
+	if err != nil {
+		return min, max, err
+	}
+	return Min(ms), Max(ms), nil
+}
+
+// Range returns the least ULID of the from time, and the greatest of the to
+// time, so that a record was made from one to the other, inclusive, to the
+// millisecond, if and only if its ULID is from lo to hi, inclusive.
+func Range(from, to time.Time) (lo, hi ulid.ULID, err error) {
+	if from.After(to) {
+		return lo, hi, errors.Errorf("from (%s) is after to (%s)", from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano))
+	}
+	if lo, _, err = At(from); err != nil {
+		return lo, hi, errors.Wrap(err, "from")
+	}
+	if _, hi, err = At(to); err != nil {
+		return lo, hi, errors.Wrap(err, "to")
+	}
+	return lo, hi, nil
+}
+
+// Parse a ULID, like ulid.Parse, but strictly, with an error saying what's
+// wrong. ulid.Parse itself doesn't check for characters outside the Crockford
+// base32 alphabet, or for overflow, but decodes them into some other ULID.
+func Parse(s string) (ulid.ULID, error) {
+	var id ulid.ULID
+	if len(s) != ulid.EncodedSize {
+		return id, errors.Errorf("ULID %q has %d characters, not %d", s, len(s), ulid.EncodedSize)
+	}
+	for i, c := range s {
+		if !isEncoding(c) {
+			return id, errors.Errorf("ULID %q has %q at %d, which isn't in the Crockford base32 alphabet", s, c, i)
+		}
+	}
+	if s[0] > '7' {
+		return id, errors.Errorf("ULID %q is too big: the greatest is %s", s, Max(ulid.MaxTime()))
+	}
+	id, err := ulid.Parse(s)
+	return id, errors.Wrapf(err, "ULID %q", s)
+}
+
+func isEncoding(c rune) bool {
+	return strings.ContainsRune(ulid.Encoding, unicode.ToUpper(c))
+}
@@ -0,0 +1,139 @@
+package ulidutil
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+func TestTimeOf(t *testing.T) {
+	t.Parallel()
+
+	for _, testcase := range []struct {
+		name string
+		time time.Time
+		min  string
+		max  string
+	}{
+		{"epoch", time.Unix(0, 0).UTC(), "00000000000000000000000000", "0000000000ZZZZZZZZZZZZZZZZ"},
+		{"record", time.Date(2017, 3, 14, 15, 59, 40, 585000000, time.UTC), "01BB6RQR190000000000000000", "01BB6RQR19ZZZZZZZZZZZZZZZZ"},
+		{"2081", time.Date(2081, 1, 1, 0, 0, 0, 0, time.UTC), "035YB089000000000000000000", "035YB08900ZZZZZZZZZZZZZZZZ"},
+		{"past int64 nanoseconds", time.Date(2262, 4, 11, 23, 47, 16, 855000000, time.UTC), "08CDXX0PQQ0000000000000000", "08CDXX0PQQZZZZZZZZZZZZZZZZ"},
+		{"last", time.Date(10889, 8, 2, 5, 31, 50, 655000000, time.UTC), "7ZZZZZZZZZ0000000000000000", "7ZZZZZZZZZZZZZZZZZZZZZZZZZ"},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			want := testcase.time
+			min, max, err := At(want.Add(999 * time.Microsecond)) // the same millisecond
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := testcase.min, min.String(); want != have {
+				t.Errorf("min: want %s, have %s", want, have)
+			}
+			if want, have := testcase.max, max.String(); want != have {
+				t.Errorf("max: want %s, have %s", want, have)
+			}
+			for _, id := range []ulid.ULID{min, max} {
+				if have := TimeOf(id); !want.Equal(have) || have.Location() != time.UTC {
+					t.Errorf("%s: want %s, have %s", id, want, have)
+				}
+			}
+		})
+	}
+}
+
+func TestTimestampBounds(t *testing.T) {
+	t.Parallel()
+
+	var (
+		epoch = time.Unix(0, 0)
+		last  = TimeOf(Min(ulid.MaxTime()))
+	)
+	for _, testcase := range []struct {
+		time time.Time
+		want string // error substring, if any
+	}{
+		{epoch, ""},
+		{epoch.Add(-time.Nanosecond), "before the Unix epoch"},
+		{last.Add(time.Millisecond - time.Nanosecond), ""},
+		{last.Add(time.Millisecond), "time too big"},
+		{time.Date(300000000, 1, 1, 0, 0, 0, 0, time.UTC), "time too big"}, // past uint64 milliseconds
+	} {
+		_, err := Timestamp(testcase.time)
+		switch {
+		case testcase.want == "" && err != nil:
+			t.Errorf("%s: %v", testcase.time, err)
+		case testcase.want != "" && (err == nil || !strings.Contains(err.Error(), testcase.want)):
+			t.Errorf("%s: want error containing %q, have %v", testcase.time, testcase.want, err)
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	t.Parallel()
+
+	var (
+		from = time.Date(2017, 3, 14, 15, 59, 40, 585000000, time.UTC)
+		to   = from.Add(time.Minute)
+	)
+	lo, hi, err := Range(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, testcase := range []struct {
+		id   ulid.ULID
+		want bool
+	}{
+		{Max(ulid.Timestamp(from) - 1), false},
+		{Min(ulid.Timestamp(from)), true},
+		{Max(ulid.Timestamp(to)), true},
+		{Min(ulid.Timestamp(to) + 1), false},
+	} {
+		if want, have := testcase.want, lo.Compare(testcase.id) <= 0 && testcase.id.Compare(hi) <= 0; want != have {
+			t.Errorf("%s (%s): in range: want %v, have %v", testcase.id, TimeOf(testcase.id), want, have)
+		}
+	}
+
+	// A range of one millisecond.
+	if lo, hi, err := Range(from, from); err != nil || lo != Min(ulid.Timestamp(from)) || hi != Max(ulid.Timestamp(from)) {
+		t.Errorf("from = to: have %s, %s, %v", lo, hi, err)
+	}
+	for _, testcase := range []struct {
+		from, to time.Time
+		want     string
+	}{
+		{to, from, "is after to"},
+		{time.Unix(-1, 0), from, "from: time is before the Unix epoch"},
+	} {
+		if _, _, err := Range(testcase.from, testcase.to); err == nil || !strings.Contains(err.Error(), testcase.want) {
+			t.Errorf("%s to %s: want error containing %q, have %v", testcase.from, testcase.to, testcase.want, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	for input, want := range map[string]string{
+		"01BB6RQR190000000000000000":  "",
+		"01bb6rqr190000000000000000":  "",
+		"7ZZZZZZZZZZZZZZZZZZZZZZZZZ":  "",
+		"01BB6RQR19":                  "has 10 characters, not 26",
+		"01BB6RQR1900000000000000000": "has 27 characters, not 26",
+		"01BB6RQR19000000000000000U":  `has 'U' at 25`,
+		"01BB6RQR19-000000000000000":  `has '-' at 10`,
+		"80000000000000000000000000":  "is too big: the greatest is 7ZZZZZZZZZZZZZZZZZZZZZZZZZ",
+	} {
+		id, err := Parse(input)
+		switch {
+		case want == "" && err != nil:
+			t.Errorf("%q: %v", input, err)
+		case want == "" && !strings.EqualFold(input, id.String()):
+			t.Errorf("%q: have %s", input, id)
+		case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+			t.Errorf("%q: want error containing %q, have %v", input, want, err)
+		}
+	}
+}
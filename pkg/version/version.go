@@ -0,0 +1,130 @@
+// Package version describes the build of the running binary, so nodes of a
+// cluster can tell which versions the others run.
+package version
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// These are set at build time, by the release script, with -ldflags -X, e.g.
+// -X github.com/oklog/oklog/pkg/version.Version=1.2.3.
+var (
+	Version   = "dev" // semantic version, without a v prefix
+	Revision  = ""    // git SHA
+	BuildDate = ""    // RFC 3339
+)
+
+// Info describes the build of a node, and how it was started.
+type Info struct {
+	Version   string            `json:"version"`
+	Revision  string            `json:"revision,omitempty"`
+	BuildDate string            `json:"build_date,omitempty"`
+	GoVersion string            `json:"go_version"`
+	NodeType  string            `json:"node_type,omitempty"`
+	Flags     map[string]string `json:"flags,omitempty"`
+}
+
+// Get returns the Info of this build, for a node of the given type, started
+// with the flags, whose secrets are redacted; see Flags. The flagset may be
+// nil.
+func Get(nodeType string, flagset *flag.FlagSet) Info {
+	return Info{
+		Version:   Version,
+		Revision:  Revision,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		NodeType:  nodeType,
+		Flags:     Flags(flagset),
+	}
+}
+
+// Handler serves the Info as JSON.
+func Handler(info Info) http.Handler {
+	buf, err := json.Marshal(info)
+	if err != nil {
+		panic(err) // only strings
+	}
+	buf = append(buf, '\n')
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(buf)
+	})
+}
+
+// Redacted replaces secrets in the summary of flags.
+const Redacted = "REDACTED"
+
+// secretWords in the name of a flag mark its value as secret, or as naming
+// where a secret is kept, which is nobody else's business either.
+var secretWords = []string{"secret", "password", "token", "key", "auth"}
+
+// Flags summarizes the flags that were set, by name. The values of flags
+// whose names suggest secrets are redacted, as are the passwords of any URLs.
+// A nil flagset has no flags.
+func Flags(flagset *flag.FlagSet) map[string]string {
+	if flagset == nil {
+		return nil
+	}
+	flags := map[string]string{}
+	flagset.Visit(func(f *flag.Flag) {
+		flags[f.Name] = redact(f.Name, f.Value.String())
+	})
+	return flags
+}
+
+// urlPassword matches the password in the userinfo of URLs, wherever they
+// are in a value, e.g. one of the several of a repeatable flag.
+var urlPassword = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s,]*):[^@/\s,]*@`)
+
+func redact(name, value string) string {
+	lower := strings.ToLower(name)
+	for _, word := range secretWords {
+		if strings.Contains(lower, word) {
+			return Redacted
+		}
+	}
+	return urlPassword.ReplaceAllString(value, "${1}:"+Redacted+"@")
+}
+
+// Compatible reports whether nodes running versions a and b are expected to
+// work together, i.e. they differ by no more than their patch versions.
+// Versions that aren't semantic, like dev builds, are compatible with any.
+func Compatible(a, b string) bool {
+	am, an, ok := majorMinor(a)
+	if !ok {
+		return true
+	}
+	bm, bn, ok := majorMinor(b)
+	if !ok {
+		return true
+	}
+	return am == bm && an == bn
+}
+
+// Major returns the major version of v, if it's semantic.
+func Major(v string) (int, bool) {
+	major, _, ok := majorMinor(v)
+	return major, ok
+}
+
+func majorMinor(v string) (major, minor int, ok bool) {
+	fields := strings.SplitN(strings.TrimPrefix(v, "v"), ".", 3)
+	if len(fields) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
@@ -25,6 +25,6 @@ for pair in linux/386 linux/amd64 linux/arm linux/arm64 darwin/amd64 dragonfly/a
 	set GOARCH (echo $pair | cut -d'/' -f2)
 	set BIN    $DISTDIR/oklog-$VERSION-$GOOS-$GOARCH
 	echo $BIN
-	env GOOS=$GOOS GOARCH=$GOARCH go build -o $BIN -ldflags="-X main.version=$VERSION" github.com/oklog/oklog/cmd/oklog
+	env GOOS=$GOOS GOARCH=$GOARCH go build -o $BIN -ldflags="-X github.com/oklog/oklog/pkg/version.Version=$VERSION -X github.com/oklog/oklog/pkg/version.Revision=$REV -X github.com/oklog/oklog/pkg/version.BuildDate="(date -u +%Y-%m-%dT%H:%M:%SZ) github.com/oklog/oklog/cmd/oklog
 end
 
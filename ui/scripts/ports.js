@@ -1,6 +1,7 @@
 ; (function() {
 	var app = Elm.Main.fullscreen(),
 		left = "",
+		live = null,
 		scroll = false,
 		stream = null;
 
@@ -26,6 +27,64 @@
 		});
 	};
 
+	// Downloads are saved by the browser, as the response is an attachment,
+	// so the page stays as it is.
+	app.ports.download.subscribe(function(url) {
+		var link = document.createElement("a");
+
+		link.href = url;
+		link.download = "";
+		document.body.appendChild(link);
+		link.click();
+		document.body.removeChild(link);
+	});
+
+	app.ports.liveCancel.subscribe(function() {
+		if (!live) {
+			app.ports.streamError.send("No stream running");
+			return
+		}
+
+		live.close(1000);
+	});
+
+	app.ports.liveRequest.subscribe(function(url) {
+		if (live || stream) {
+			app.ports.streamError.send("Stream already in progress");
+			return
+		}
+
+		var decoder = new TextDecoder(),
+			location = new URL(url, window.location.href);
+
+		location.protocol = location.protocol === "https:" ? "wss:" : "ws:";
+
+		live = new WebSocket(location.href);
+		live.binaryType = "arraybuffer";
+
+		live.onmessage = function(event) {
+			if (typeof event.data === "string") {
+				app.ports.liveLine.send([event.data]);
+				return
+			}
+
+			app.ports.liveLine.send([decoder.decode(event.data)]);
+		};
+
+		// Normal closures are ours; anything else, e.g. 1008 for a client
+		// that fell behind, is shown with the server's reason.
+		live.onclose = function(event) {
+			live = null;
+
+			if (event.code === 1000) {
+				app.ports.liveClosed.send("");
+				return
+			}
+
+			app.ports.liveClosed.send(event.reason ? event.code + " " + event.reason : String(event.code));
+		};
+	});
+
 	app.ports.scroll.subscribe(function() {
 		if (!scroll) {
 			setTimeout(function() {
@@ -53,6 +53,7 @@ type alias Model =
     , records : List Record
     , stats : Maybe Stats
     , streamRunning : Bool
+    , closedReason : String
     }
 
 
@@ -80,7 +81,7 @@ type alias Stats =
 
 init : ( Model, Cmd Msg )
 init =
-    ( Model 0 initQuery [] Nothing False, Task.perform Now Time.now )
+    ( Model 0 initQuery [] Nothing False "", Task.perform Now Time.now )
 
 
 initQuery : Query
@@ -98,7 +99,11 @@ initStats =
 
 
 type Msg
-    = Now Time
+    = Download
+    | DownloadAt Time
+    | LiveClosed String
+    | LiveLines (List String)
+    | Now Time
     | Plan Time
     | QueryFormSubmit
     | QueryRegexUpdate String
@@ -115,6 +120,18 @@ type Msg
 update : Msg -> Model -> ( Model, Cmd Msg )
 update msg model =
     case msg of
+        Download ->
+            ( model, Task.perform DownloadAt Time.now )
+
+        DownloadAt now ->
+            ( { model | now = now }, download (downloadUrl now model.query) )
+
+        LiveClosed reason ->
+            ( { model | streamRunning = False, closedReason = reason }, Cmd.none )
+
+        LiveLines lines ->
+            ( { model | records = (model.records ++ (List.map parseRecord lines)) }, scroll "" )
+
         Now now ->
             ( { model | now = now }, Cmd.none )
 
@@ -129,7 +146,7 @@ update msg model =
                 ( { model | now = now }, cmd )
 
         QueryFormSubmit ->
-            ( { model | records = [], streamRunning = True }, getRecords model.now model.query )
+            ( { model | records = [], streamRunning = True, closedReason = "" }, getRecords model.now model.query )
 
         QueryRegexUpdate val ->
             let
@@ -174,7 +191,14 @@ update msg model =
             ( model, Cmd.none )
 
         StreamCancel ->
-            ( { model | streamRunning = False }, streamCancel "" )
+            let
+                cancel =
+                    if model.query.to == "live" then
+                        liveCancel ""
+                    else
+                        streamCancel ""
+            in
+                ( { model | streamRunning = False }, cancel )
 
         StreamComplete _ ->
             ( { model | streamRunning = False }, scroll "" )
@@ -183,19 +207,17 @@ update msg model =
             ( { model | streamRunning = False }, Cmd.none )
 
         StreamLines lines ->
-            let
-                parseRecord line =
-                    Record (String.dropLeft 27 line) (String.left 26 line)
+            ( { model | records = (model.records ++ (List.map parseRecord lines)) }
+            , Cmd.batch
+                [ streamContinue ""
+                , scroll ""
+                ]
+            )
 
-                records =
-                    List.map parseRecord lines
-            in
-                ( { model | records = (model.records ++ records) }
-                , Cmd.batch
-                    [ streamContinue ""
-                    , scroll ""
-                    ]
-                )
+
+parseRecord : String -> Record
+parseRecord line =
+    Record (String.dropLeft 27 line) (String.left 26 line)
 
 
 
@@ -205,7 +227,9 @@ update msg model =
 subscriptions : Model -> Sub Msg
 subscriptions model =
     Sub.batch
-        [ streamComplete StreamComplete
+        [ liveClosed LiveClosed
+        , liveLine LiveLines
+        , streamComplete StreamComplete
         , streamError StreamError
         , streamLine StreamLines
         ]
@@ -215,6 +239,21 @@ subscriptions model =
 -- PORTS
 
 
+port download : String -> Cmd msg
+
+
+port liveCancel : String -> Cmd msg
+
+
+port liveRequest : String -> Cmd msg
+
+
+port liveClosed : (String -> msg) -> Sub msg
+
+
+port liveLine : (List String -> msg) -> Sub msg
+
+
 port scroll : String -> Cmd msg
 
 
@@ -279,16 +318,34 @@ streamUrl query =
             String.concat parts
 
 
-getRecords : Time -> Query -> Cmd Msg
-getRecords now query =
+liveUrl : Query -> String
+liveUrl query =
     let
-        url =
-            if query.to == "streaming" then
-                streamUrl query
-            else
-                queryUrl now query
+        parts =
+            [ "../store/stream/ws?"
+            , "&q="
+            , query.term
+            ]
     in
-        streamRequest url
+        if query.regex then
+            String.concat (parts ++ [ "&regex" ])
+        else
+            String.concat parts
+
+
+downloadUrl : Time -> Query -> String
+downloadUrl now query =
+    queryUrl now query ++ "&download=gzip"
+
+
+getRecords : Time -> Query -> Cmd Msg
+getRecords now query =
+    if query.to == "live" then
+        liveRequest (liveUrl query)
+    else if query.to == "streaming" then
+        streamRequest (streamUrl query)
+    else
+        streamRequest (queryUrl now query)
 
 
 getStats : Time -> Query -> Cmd Msg
@@ -479,8 +536,16 @@ formQuery model =
                 button [ onClick StreamCancel ] [ text "cancel" ]
             else if model.query.to == "streaming" then
                 button attrs [ text "stream" ]
+            else if model.query.to == "live" then
+                button attrs [ text "live" ]
             else
                 button attrs [ text "query" ]
+
+        downloadAttrs =
+            if String.length model.query.term == 0 || model.query.to == "streaming" || model.query.to == "live" then
+                [ disabled True, type_ "button" ]
+            else
+                [ onClick Download, type_ "button" ]
     in
         form [ id "query", onSubmit QueryFormSubmit ]
             [ div [ class "row" ]
@@ -490,14 +555,24 @@ formQuery model =
                 [ action
                 , formElementAs
                 , formElementRange model.query
+                , button downloadAttrs [ text "download" ]
                 ]
             , div [ class "row" ]
                 [ viewPlan model.stats
                 , viewResultInfo (List.length model.records)
+                , viewLiveClosed model.closedReason
                 ]
             ]
 
 
+viewLiveClosed : String -> Html Msg
+viewLiveClosed reason =
+    if reason == "" then
+        span [] []
+    else
+        div [ class "live-closed" ] [ text ("The live stream was closed: " ++ reason) ]
+
+
 formElementAs : Html Msg
 formElementAs =
     div [ class "as" ]
@@ -513,7 +588,7 @@ formElementRange : Query -> Html Msg
 formElementRange query =
     let
         bridge =
-            if query.to == "streaming" then
+            if query.to == "streaming" || query.to == "live" then
                 span [] [ text "and" ]
             else
                 span [] [ text "to" ]
@@ -530,6 +605,7 @@ formElementTo : Html Msg
 formElementTo =
     select [ on "change" (Json.map QueryToUpdate targetValue) ]
         [ option [ value "streaming" ] [ text "streaming" ]
+        , option [ value "live" ] [ text "live" ]
         , option [ value "0" ] [ text "now" ]
         ]
 